@@ -0,0 +1,397 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	crdvalidation "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel"
+	structuraldefaulting "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
+	apiservervalidation "k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"sigs.k8s.io/yaml"
+)
+
+const customHTTPRouteCRD = "../../config/operator/deploy/crd/bases/customrouter.freepik.com_customhttproutes.yaml"
+
+// loadCustomHTTPRouteCRD reads the generated CRD and checks it the way the
+// API server does on install, which rejects CEL rules that do not compile or
+// exceed the cost budget.
+func loadCustomHTTPRouteCRD(t *testing.T) *apiextensions.CustomResourceDefinition {
+	t.Helper()
+	data, err := os.ReadFile(filepath.FromSlash(customHTTPRouteCRD))
+	if err != nil {
+		t.Fatalf("reading CRD: %v", err)
+	}
+	var v1crd apiextensionsv1.CustomResourceDefinition
+	if err := yaml.Unmarshal(data, &v1crd); err != nil {
+		t.Fatalf("decoding CRD: %v", err)
+	}
+	apiextensionsv1.SetObjectDefaults_CustomResourceDefinition(&v1crd)
+	var crd apiextensions.CustomResourceDefinition
+	if err := apiextensionsv1.Convert_v1_CustomResourceDefinition_To_apiextensions_CustomResourceDefinition(&v1crd, &crd, nil); err != nil {
+		t.Fatalf("converting CRD: %v", err)
+	}
+	if errs := crdvalidation.ValidateCustomResourceDefinition(context.Background(), &crd); len(errs) > 0 {
+		t.Fatalf("invalid CRD: %v", errs.ToAggregate())
+	}
+	return &crd
+}
+
+// validateManifest defaults and validates manifest against the schema of
+// version, including its CEL rules, and returns the errors.
+func validateManifest(t *testing.T, crd *apiextensions.CustomResourceDefinition, version, manifest string) field.ErrorList {
+	t.Helper()
+	var props *apiextensions.JSONSchemaProps
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version {
+			props = v.Schema.OpenAPIV3Schema
+		}
+	}
+	if props == nil {
+		t.Fatalf("version %s not found", version)
+	}
+	structural, err := structuralschema.NewStructural(props)
+	if err != nil {
+		t.Fatalf("building structural schema: %v", err)
+	}
+	var obj map[string]any
+	if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+		t.Fatalf("decoding manifest: %v", err)
+	}
+	structuraldefaulting.Default(obj, structural)
+
+	schemaValidator, _, err := apiservervalidation.NewSchemaValidator(props)
+	if err != nil {
+		t.Fatalf("building schema validator: %v", err)
+	}
+	errs := apiservervalidation.ValidateCustomResource(nil, obj, schemaValidator)
+	celErrs, _ := cel.NewValidator(structural, true, celconfig.PerCallLimit).
+		Validate(context.Background(), nil, structural, obj, nil, celconfig.RuntimeCELCostBudget)
+	return append(errs, celErrs...)
+}
+
+func TestCustomHTTPRouteSamplesPassCRDValidation(t *testing.T) {
+	crd := loadCustomHTTPRouteCRD(t)
+	for _, version := range []string{"v1alpha1", "v1alpha2"} {
+		data, err := os.ReadFile(filepath.FromSlash("../../config/operator/samples/" + version + "_customhttproute.yaml"))
+		if err != nil {
+			t.Fatalf("reading sample: %v", err)
+		}
+		for _, doc := range strings.Split(string(data), "\n---") {
+			if strings.TrimSpace(doc) == "" {
+				continue
+			}
+			if errs := validateManifest(t, crd, version, doc); len(errs) > 0 {
+				t.Errorf("%s sample rejected: %v", version, errs.ToAggregate())
+			}
+		}
+	}
+}
+
+func TestCustomHTTPRouteCELValidation(t *testing.T) {
+	crd := loadCustomHTTPRouteCRD(t)
+
+	const route = `
+apiVersion: customrouter.freepik.com/%s
+kind: CustomHTTPRoute
+metadata:
+  name: test
+  namespace: default
+spec:
+  targetRef:
+    name: default
+`
+	tests := []struct {
+		name        string
+		version     string
+		spec        string
+		errContains string
+	}{
+		{
+			name:    "valid route",
+			version: "v1alpha1",
+			spec: `
+  hostnames: ["example.com", "*.example.com"]
+  rules:
+  - matches: [{path: /api}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+		},
+		{
+			name:    "redirect rule without backendRefs",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /old}]
+    actions: [{type: redirect, redirect: {path: /new}}]
+`,
+		},
+		{
+			name:    "backendRefs inherited from defaults",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  defaults:
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+  rules:
+  - matches: [{path: /api}]
+`,
+		},
+		{
+			name:    "no backendRefs and no redirect",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api}]
+`,
+			errContains: "backendRefs is required on rules without a redirect action",
+		},
+		{
+			name:    "rule without matches",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "at least one of matches or grpcMatches is required",
+		},
+		{
+			name:    "backendFailover with outlierPolicy",
+			version: "v1alpha2",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api}]
+    backendRefs:
+    - {name: api, namespace: eu, port: 8080}
+    - {name: api, namespace: us, port: 8080}
+    backendFailover: {healthSignal: Responses}
+    outlierPolicy:
+      fallbackBackendRef: {name: api, namespace: us, port: 8080}
+`,
+			errContains: "backendFailover and outlierPolicy are mutually exclusive",
+		},
+		{
+			name:    "redirect type without redirect config",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /old}]
+    actions: [{type: redirect}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "redirect is required when type is redirect",
+		},
+		{
+			name:    "redirect without target",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /old}]
+    actions: [{type: redirect, redirect: {statusCode: 301}}]
+`,
+			errContains: "at least one of scheme, hostname, path or port must be set",
+		},
+		{
+			name:    "redirect to the request itself",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /old}]
+    actions: [{type: redirect, redirect: {scheme: preserve}}]
+`,
+			errContains: "scheme preserve needs a hostname, path or port",
+		},
+		{
+			name:    "empty rewrite",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api}]
+    actions: [{type: rewrite, rewrite: {}}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "at least one of path, segments or hostname must be set",
+		},
+		{
+			name:    "rewrite of the path and its segments",
+			version: "v1alpha2",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api}]
+    actions: [{type: rewrite, rewrite: {path: /v2, segments: {"0": v2}}}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "path and segments are mutually exclusive",
+		},
+		{
+			name:    "header-remove without headerName",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api}]
+    actions: [{type: header-remove}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "headerName is required",
+		},
+		{
+			name:    "default action without config",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  defaults:
+    actions: [{type: header-set}]
+  rules:
+  - matches: [{path: /api}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "header is required",
+		},
+		{
+			name:    "fraction above its default denominator",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api, fraction: {numerator: 150}}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "numerator must not exceed denominator",
+		},
+		{
+			name:    "hostname with a scheme",
+			version: "v1alpha1",
+			spec: `
+  hostnames: ["https://example.com"]
+  rules:
+  - matches: [{path: /api}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "spec.hostnames[0]",
+		},
+		{
+			name:    "alias repeating a hostname",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  hostnameAliases: [{hostname: example.com, canonical: example.com}]
+  rules:
+  - matches: [{path: /api}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "hostnameAliases must not repeat one of hostnames",
+		},
+		{
+			name:    "alias of an unknown hostname",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  hostnameAliases: [{hostname: www.example.com, canonical: example.org}]
+  rules:
+  - matches: [{path: /api}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "canonical of every hostnameAlias must be one of hostnames",
+		},
+		{
+			name:    "maintenance ending before it starts",
+			version: "v1alpha1",
+			spec: `
+  hostnames: [example.com]
+  maintenance:
+    start: "2026-01-02T00:00:00Z"
+    end: "2026-01-01T00:00:00Z"
+  rules:
+  - matches: [{path: /api}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "end must be after start",
+		},
+		{
+			name:    "v1alpha2 header-remove with header name",
+			version: "v1alpha2",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api}]
+    actions: [{type: header-remove, header: {name: x-debug}}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+		},
+		{
+			name:    "v1alpha2 header-remove without header",
+			version: "v1alpha2",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api}]
+    actions: [{type: header-remove}]
+    backendRefs: [{name: api, namespace: default, port: 8080}]
+`,
+			errContains: "header is required for the header-* and response-header-* types",
+		},
+		{
+			name:    "v1alpha2 no backendRefs and no redirect",
+			version: "v1alpha2",
+			spec: `
+  hostnames: [example.com]
+  rules:
+  - matches: [{path: /api}]
+`,
+			errContains: "backendRefs is required on rules without a redirect action",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := strings.Replace(route, "%s", tt.version, 1) + tt.spec
+			errs := validateManifest(t, crd, tt.version, manifest)
+			if tt.errContains == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no error, got %v", errs.ToAggregate())
+				}
+				return
+			}
+			if len(errs) == 0 {
+				t.Fatalf("expected error containing %q, got none", tt.errContains)
+			}
+			if got := errs.ToAggregate().Error(); !strings.Contains(got, tt.errContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errContains, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"time"
+)
+
+// EffectiveRules returns the rules with spec.defaults merged in, following
+// the precedence documented on RuleDefaults. Without defaults it returns
+// s.Rules itself, so callers must treat the result as read-only.
+func (s *CustomHTTPRouteSpec) EffectiveRules() []Rule {
+	if s.Defaults == nil {
+		return s.Rules
+	}
+	rules := make([]Rule, len(s.Rules))
+	for i := range s.Rules {
+		rules[i] = s.Defaults.Apply(&s.Rules[i])
+	}
+	return rules
+}
+
+// ActiveRules returns the EffectiveRules that are enabled, or none when the
+// route itself is disabled. Everything building the route table or its Envoy
+// config must iterate ActiveRules; validation still covers every rule.
+func (s *CustomHTTPRouteSpec) ActiveRules() []Rule {
+	if !s.IsEnabled() {
+		return nil
+	}
+	rules := s.EffectiveRules()
+	if s.DisabledRuleCount() == 0 {
+		return rules
+	}
+	active := make([]Rule, 0, len(rules))
+	for i := range rules {
+		if rules[i].IsEnabled() {
+			active = append(active, rules[i])
+		}
+	}
+	return active
+}
+
+// ServedHostnames returns the hostnames requests for which the route
+// handles: hostnames, then the hostnameAliases.
+func (s *CustomHTTPRouteSpec) ServedHostnames() []string {
+	if len(s.HostnameAliases) == 0 {
+		return s.Hostnames
+	}
+	served := make([]string, 0, len(s.Hostnames)+len(s.HostnameAliases))
+	served = append(served, s.Hostnames...)
+	for _, alias := range s.HostnameAliases {
+		served = append(served, alias.Hostname)
+	}
+	return served
+}
+
+// RoutedHostnames returns the hostnames that get the route's rules:
+// hostnames, then the hostnameAliases that do not redirect.
+func (s *CustomHTTPRouteSpec) RoutedHostnames() []string {
+	if len(s.HostnameAliases) == 0 {
+		return s.Hostnames
+	}
+	routed := make([]string, 0, len(s.Hostnames)+len(s.HostnameAliases))
+	routed = append(routed, s.Hostnames...)
+	for _, alias := range s.HostnameAliases {
+		if !alias.Redirect {
+			routed = append(routed, alias.Hostname)
+		}
+	}
+	return routed
+}
+
+// IsEnabled reports whether the route is enabled: spec.enabled unset or true.
+func (s *CustomHTTPRouteSpec) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// DeletionDrainRemaining returns how much longer the routes of r stay in
+// the route table after its deletion, or zero when it is not being deleted,
+// sets no deletionDrainSeconds or its drain period is over at now.
+func (r *CustomHTTPRoute) DeletionDrainRemaining(now time.Time) time.Duration {
+	if r.DeletionTimestamp.IsZero() || r.Spec.DeletionDrainSeconds <= 0 {
+		return 0
+	}
+	deadline := r.DeletionTimestamp.Add(time.Duration(r.Spec.DeletionDrainSeconds) * time.Second)
+	if remaining := deadline.Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// DisabledRuleCount returns the number of rules ActiveRules leaves out: all
+// of them when the route is disabled.
+func (s *CustomHTTPRouteSpec) DisabledRuleCount() int32 {
+	if !s.IsEnabled() {
+		return int32(len(s.Rules))
+	}
+	var n int32
+	for i := range s.Rules {
+		if !s.Rules[i].IsEnabled() {
+			n++
+		}
+	}
+	return n
+}
+
+// IsEnabled reports whether maintenance is configured and enabled: the block
+// is set and enabled is unset or true. A nil Maintenance is not enabled.
+func (m *Maintenance) IsEnabled() bool {
+	return m != nil && (m.Enabled == nil || *m.Enabled)
+}
+
+// MaintenanceHostnames returns the hostnames maintenance applies to:
+// maintenance.hostnames, or every served hostname when it lists none.
+func (s *CustomHTTPRouteSpec) MaintenanceHostnames() []string {
+	if s.Maintenance == nil || len(s.Maintenance.Hostnames) == 0 {
+		return s.ServedHostnames()
+	}
+	return s.Maintenance.Hostnames
+}
+
+// IsEnabled reports whether the rule is enabled: enabled unset or true.
+func (r *Rule) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// IsExpired reports whether the rule sets an expiresAt at or before now.
+func (r *Rule) IsExpired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(r.ExpiresAt.Time)
+}
+
+// ExpiredRules returns the indexes in spec.rules of the rules expired at now.
+func (s *CustomHTTPRouteSpec) ExpiredRules(now time.Time) []int {
+	var expired []int
+	for i := range s.Rules {
+		if s.Rules[i].IsExpired(now) {
+			expired = append(expired, i)
+		}
+	}
+	return expired
+}
+
+// NextRuleExpiry returns how long after now the next rule of s expires, or
+// zero when no rule expires after now.
+func (s *CustomHTTPRouteSpec) NextRuleExpiry(now time.Time) time.Duration {
+	var next time.Duration
+	for i := range s.Rules {
+		if s.Rules[i].ExpiresAt == nil {
+			continue
+		}
+		if d := s.Rules[i].ExpiresAt.Sub(now); d > 0 && (next == 0 || d < next) {
+			next = d
+		}
+	}
+	return next
+}
+
+// Apply returns a copy of rule with the defaults it does not override.
+func (d *RuleDefaults) Apply(rule *Rule) Rule {
+	out := *rule.DeepCopy()
+	if d == nil {
+		return out
+	}
+
+	if len(d.Actions) > 0 {
+		overridden := make(map[string]bool, len(out.Actions))
+		for i := range out.Actions {
+			overridden[actionOverrideKey(&out.Actions[i])] = true
+		}
+		for i := range d.Actions {
+			if !overridden[actionOverrideKey(&d.Actions[i])] {
+				out.Actions = append(out.Actions, *d.Actions[i].DeepCopy())
+			}
+		}
+	}
+
+	if len(out.BackendRefs) == 0 && !out.HasRedirectAction() && len(d.BackendRefs) > 0 {
+		out.BackendRefs = append([]BackendRef(nil), d.BackendRefs...)
+	}
+
+	if d.Priority != 0 {
+		for i := range out.Matches {
+			if out.Matches[i].Priority == 0 {
+				out.Matches[i].Priority = d.Priority
+			}
+		}
+		for i := range out.GRPCMatches {
+			if out.GRPCMatches[i].Priority == 0 {
+				out.GRPCMatches[i].Priority = d.Priority
+			}
+		}
+	}
+	return out
+}
+
+// actionOverrideKey identifies what an action configures, so that a rule
+// action replaces the default action with the same key. Header actions are
+// keyed by direction and header name, which lets a rule's header-remove
+// cancel a default header-set of the same header.
+func actionOverrideKey(a *Action) string {
+	switch a.Type {
+	case ActionTypeHeaderSet, ActionTypeHeaderAdd, ActionTypeHeaderRemove:
+		return "request-header:" + strings.ToLower(actionHeaderName(a))
+	case ActionTypeResponseHeaderSet, ActionTypeResponseHeaderAdd, ActionTypeResponseHeaderRemove:
+		return "response-header:" + strings.ToLower(actionHeaderName(a))
+	default:
+		return string(a.Type)
+	}
+}
+
+// actionHeaderName returns the header a header action applies to.
+func actionHeaderName(a *Action) string {
+	if a.Type == ActionTypeHeaderRemove || a.Type == ActionTypeResponseHeaderRemove {
+		return a.HeaderName
+	}
+	if a.Header != nil {
+		return a.Header.Name
+	}
+	return ""
+}
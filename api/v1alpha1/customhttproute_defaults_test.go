@@ -0,0 +1,197 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRuleDefaultsApply(t *testing.T) {
+	defaultBackend := BackendRef{Name: "web", Namespace: "default", Port: 80}
+	ruleBackend := BackendRef{Name: "api", Namespace: "default", Port: 8080}
+	defaults := &RuleDefaults{
+		Actions: []Action{
+			{Type: ActionTypeHeaderSet, Header: &HeaderConfig{Name: "X-Team", Value: "web"}},
+			{Type: ActionTypeResponseHeaderSet, Header: &HeaderConfig{Name: "Cache-Control", Value: "no-store"}},
+			{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "/"}},
+		},
+		BackendRefs: []BackendRef{defaultBackend},
+		Priority:    2000,
+	}
+
+	tests := []struct {
+		name string
+		rule Rule
+		want Rule
+	}{
+		{
+			name: "inherits everything",
+			rule: Rule{Matches: []PathMatch{{Path: "/a"}}},
+			want: Rule{
+				Matches:     []PathMatch{{Path: "/a", Priority: 2000}},
+				Actions:     defaults.Actions,
+				BackendRefs: []BackendRef{defaultBackend},
+			},
+		},
+		{
+			name: "rule values win",
+			rule: Rule{
+				Matches: []PathMatch{{Path: "/a", Priority: 500}},
+				Actions: []Action{
+					{Type: ActionTypeHeaderRemove, HeaderName: "x-team"},
+					{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "/v2"}},
+				},
+				BackendRefs: []BackendRef{ruleBackend},
+			},
+			want: Rule{
+				Matches: []PathMatch{{Path: "/a", Priority: 500}},
+				Actions: []Action{
+					{Type: ActionTypeHeaderRemove, HeaderName: "x-team"},
+					{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "/v2"}},
+					defaults.Actions[1],
+				},
+				BackendRefs: []BackendRef{ruleBackend},
+			},
+		},
+		{
+			name: "redirect does not inherit backends",
+			rule: Rule{
+				GRPCMatches: []GRPCMatch{{Service: "users.v1.UserService"}},
+				Actions:     []Action{{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Scheme: "https"}}},
+			},
+			want: Rule{
+				GRPCMatches: []GRPCMatch{{Service: "users.v1.UserService", Priority: 2000}},
+				Actions: []Action{
+					{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Scheme: "https"}},
+					defaults.Actions[0],
+					defaults.Actions[1],
+					defaults.Actions[2],
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := *tt.rule.DeepCopy()
+			got := defaults.Apply(&tt.rule)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.rule, original) {
+				t.Errorf("Apply() modified the rule: %+v", tt.rule)
+			}
+		})
+	}
+}
+
+func TestEffectiveRulesWithoutDefaults(t *testing.T) {
+	spec := CustomHTTPRouteSpec{Rules: []Rule{{Matches: []PathMatch{{Path: "/a"}}}}}
+	rules := spec.EffectiveRules()
+	if len(rules) != 1 || &rules[0] != &spec.Rules[0] {
+		t.Errorf("EffectiveRules() = %+v, want spec.Rules unchanged", rules)
+	}
+}
+
+func TestActiveRules(t *testing.T) {
+	disabled := false
+	spec := CustomHTTPRouteSpec{
+		Defaults: &RuleDefaults{Priority: 2000},
+		Rules: []Rule{
+			{Matches: []PathMatch{{Path: "/a"}}},
+			{Matches: []PathMatch{{Path: "/b"}}, Enabled: &disabled},
+			{Matches: []PathMatch{{Path: "/c"}}},
+		},
+	}
+
+	rules := spec.ActiveRules()
+	if len(rules) != 2 || rules[0].Matches[0].Path != "/a" || rules[1].Matches[0].Path != "/c" {
+		t.Fatalf("ActiveRules() = %+v, want /a and /c", rules)
+	}
+	if rules[0].Matches[0].Priority != 2000 {
+		t.Errorf("ActiveRules() priority = %d, want the default applied", rules[0].Matches[0].Priority)
+	}
+	if got := spec.DisabledRuleCount(); got != 1 {
+		t.Errorf("DisabledRuleCount() = %d, want 1", got)
+	}
+
+	spec.Enabled = &disabled
+	if rules := spec.ActiveRules(); len(rules) != 0 {
+		t.Errorf("ActiveRules() of a disabled route = %+v, want none", rules)
+	}
+	if got := spec.DisabledRuleCount(); got != 3 {
+		t.Errorf("DisabledRuleCount() of a disabled route = %d, want 3", got)
+	}
+}
+
+func TestDeletionDrainRemaining(t *testing.T) {
+	now := time.Now()
+	deleted := func(ago time.Duration, drainSeconds int32) *CustomHTTPRoute {
+		deletionTime := metav1.NewTime(now.Add(-ago))
+		return &CustomHTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &deletionTime},
+			Spec:       CustomHTTPRouteSpec{DeletionDrainSeconds: drainSeconds},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		route *CustomHTTPRoute
+		want  time.Duration
+	}{
+		{name: "not deleted", route: &CustomHTTPRoute{Spec: CustomHTTPRouteSpec{DeletionDrainSeconds: 60}}, want: 0},
+		{name: "no drain period", route: deleted(time.Second, 0), want: 0},
+		{name: "draining", route: deleted(10*time.Second, 60), want: 50 * time.Second},
+		{name: "drain period over", route: deleted(2*time.Minute, 60), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.route.DeletionDrainRemaining(now); got != tt.want {
+				t.Errorf("DeletionDrainRemaining = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleExpiry(t *testing.T) {
+	now := time.Now()
+	at := func(offset time.Duration) *metav1.Time {
+		expiresAt := metav1.NewTime(now.Add(offset))
+		return &expiresAt
+	}
+	spec := CustomHTTPRouteSpec{Rules: []Rule{
+		{},
+		{ExpiresAt: at(-time.Minute)},
+		{ExpiresAt: at(time.Hour)},
+		{ExpiresAt: at(0)},
+		{ExpiresAt: at(10 * time.Minute)},
+	}}
+
+	if got := spec.ExpiredRules(now); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("ExpiredRules() = %v, want [1 3]", got)
+	}
+	if got := spec.NextRuleExpiry(now); got != 10*time.Minute {
+		t.Errorf("NextRuleExpiry() = %s, want 10m", got)
+	}
+	if got := (&CustomHTTPRouteSpec{Rules: spec.Rules[:2]}).NextRuleExpiry(now); got != 0 {
+		t.Errorf("NextRuleExpiry() without a future expiry = %s, want 0", got)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import "strings"
+
+const (
+	// GRPCMethod is the HTTP method every gRPC call uses.
+	GRPCMethod HTTPMethod = "POST"
+
+	// GRPCContentTypeHeader is the header carrying the gRPC content type.
+	GRPCContentTypeHeader = "content-type"
+
+	// GRPCContentTypePattern matches "application/grpc" and its "+proto",
+	// "+json", ... subtypes, optionally followed by parameters.
+	GRPCContentTypePattern = `^application/grpc(\+[A-Za-z0-9.-]+)?(;.*)?$`
+)
+
+// Path returns the HTTP/2 path of the matched calls: "/<service>/<method>",
+// or "/<service>/" when every method of the service is matched.
+func (m GRPCMatch) Path() string {
+	return "/" + m.Service + "/" + m.Method
+}
+
+// PathMatch translates the gRPC match into the equivalent HTTP match: an
+// Exact (or, without method, PathPrefix) match on Path, restricted to POST
+// and to a gRPC content type. A content-type header match set by the user
+// replaces the default check.
+func (m GRPCMatch) PathMatch() PathMatch {
+	matchType := MatchTypeExact
+	if m.Method == "" {
+		matchType = MatchTypePathPrefix
+	}
+
+	headers := make([]HeaderMatch, 0, len(m.Headers)+1)
+	hasContentType := false
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Name, GRPCContentTypeHeader) {
+			hasContentType = true
+		}
+		headers = append(headers, h)
+	}
+	if !hasContentType {
+		headers = append(headers, HeaderMatch{
+			Name:  GRPCContentTypeHeader,
+			Value: GRPCContentTypePattern,
+			Type:  HeaderMatchTypeRegularExpression,
+		})
+	}
+
+	return PathMatch{
+		Path:     m.Path(),
+		Type:     matchType,
+		Method:   GRPCMethod,
+		Headers:  headers,
+		Priority: m.Priority,
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGRPCMatchPathMatch(t *testing.T) {
+	tests := []struct {
+		name            string
+		match           GRPCMatch
+		wantPath        string
+		wantType        MatchType
+		wantContentType string
+	}{
+		{
+			name:            "service and method",
+			match:           GRPCMatch{Service: "users.v1.UserService", Method: "GetUser"},
+			wantPath:        "/users.v1.UserService/GetUser",
+			wantType:        MatchTypeExact,
+			wantContentType: GRPCContentTypePattern,
+		},
+		{
+			name:            "whole service",
+			match:           GRPCMatch{Service: "users.v1.UserService"},
+			wantPath:        "/users.v1.UserService/",
+			wantType:        MatchTypePathPrefix,
+			wantContentType: GRPCContentTypePattern,
+		},
+		{
+			name: "user content-type replaces the default",
+			match: GRPCMatch{
+				Service: "users.v1.UserService",
+				Headers: []HeaderMatch{{Name: "Content-Type", Value: "application/grpc-web"}},
+			},
+			wantPath:        "/users.v1.UserService/",
+			wantType:        MatchTypePathPrefix,
+			wantContentType: "application/grpc-web",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.match.PathMatch()
+			if got.Path != tt.wantPath || got.Type != tt.wantType || got.Method != GRPCMethod {
+				t.Errorf("PathMatch() = %s %s %s, want %s %s %s",
+					got.Method, got.Type, got.Path, GRPCMethod, tt.wantType, tt.wantPath)
+			}
+			if len(got.Headers) != 1 || got.Headers[0].Value != tt.wantContentType {
+				t.Errorf("PathMatch() headers = %+v, want one content-type match %q", got.Headers, tt.wantContentType)
+			}
+		})
+	}
+}
+
+func TestGRPCContentTypePattern(t *testing.T) {
+	re := regexp.MustCompile(GRPCContentTypePattern)
+	for value, want := range map[string]bool{
+		"application/grpc":                true,
+		"application/grpc+proto":          true,
+		"application/grpc+json":           true,
+		"application/grpc; charset=utf-8": true,
+		"application/grpc-web":            false,
+		"application/json":                false,
+	} {
+		if got := re.MatchString(value); got != want {
+			t.Errorf("%q matches = %v, want %v", value, got, want)
+		}
+	}
+}
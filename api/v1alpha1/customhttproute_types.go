@@ -54,8 +54,20 @@ const (
 // +kubebuilder:validation:Enum=GET;HEAD;POST;PUT;DELETE;CONNECT;OPTIONS;TRACE;PATCH
 type HTTPMethod string
 
+// RequestScheme defines a scheme to match against the request scheme.
+// +kubebuilder:validation:Enum=http;https
+type RequestScheme string
+
+const (
+	// RequestSchemeHTTP matches plain HTTP requests.
+	RequestSchemeHTTP RequestScheme = "http"
+
+	// RequestSchemeHTTPS matches HTTPS requests.
+	RequestSchemeHTTPS RequestScheme = "https"
+)
+
 // HeaderMatchType defines how a header value is compared.
-// +kubebuilder:validation:Enum=Exact;RegularExpression
+// +kubebuilder:validation:Enum=Exact;RegularExpression;Exists;Absent;NotValue
 type HeaderMatchType string
 
 const (
@@ -64,8 +76,36 @@ const (
 
 	// HeaderMatchTypeRegularExpression matches when the header value matches the Go regexp.
 	HeaderMatchTypeRegularExpression HeaderMatchType = "RegularExpression"
+
+	// HeaderMatchTypeExists matches when the header is present, whatever its value.
+	HeaderMatchTypeExists HeaderMatchType = "Exists"
+
+	// HeaderMatchTypeAbsent matches when the header is not present.
+	HeaderMatchTypeAbsent HeaderMatchType = "Absent"
+
+	// HeaderMatchTypeNotValue matches when the header is absent or its value
+	// differs from value (case-sensitive).
+	HeaderMatchTypeNotValue HeaderMatchType = "NotValue"
 )
 
+// Fraction selects numerator out of every denominator requests.
+// +kubebuilder:validation:XValidation:rule="self.numerator <= (has(self.denominator) ? self.denominator : 100)",message="numerator must not exceed denominator"
+type Fraction struct {
+	// numerator is the number of requests, out of every denominator, that
+	// match.
+	// +required
+	// +kubebuilder:validation:Minimum=0
+	Numerator int32 `json:"numerator"`
+
+	// denominator is the number of requests the numerator is a share of.
+	// Defaults to 100, making the numerator a percentage.
+	// +optional
+	// +kubebuilder:default=100
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=1000000
+	Denominator int32 `json:"denominator,omitempty"`
+}
+
 // HeaderMatch defines a single HTTP header matching criterion.
 // Mirrors Gateway API HTTPHeaderMatch. Header names are compared
 // case-insensitively; values are compared according to Type.
@@ -77,17 +117,55 @@ type HeaderMatch struct {
 	Name string `json:"name"`
 
 	// value is the value (or pattern) to compare against the request header.
-	// +required
-	// +kubebuilder:validation:MinLength=1
+	// Required for Exact, RegularExpression and NotValue; must be empty for
+	// Exists and Absent.
+	// +optional
 	// +kubebuilder:validation:MaxLength=4096
-	Value string `json:"value"`
+	Value string `json:"value,omitempty"`
 
-	// type is the comparison mode: Exact (default) or RegularExpression.
+	// type is the comparison mode: Exact (default), RegularExpression,
+	// Exists, Absent or NotValue.
 	// +optional
 	// +kubebuilder:default=Exact
 	Type HeaderMatchType `json:"type,omitempty"`
 }
 
+// GRPCMatch defines a gRPC call matching criterion.
+// Mirrors Gateway API GRPCMethodMatch with Exact semantics.
+type GRPCMatch struct {
+	// service is the fully-qualified gRPC service name, including its
+	// package (e.g. "users.v1.UserService").
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=1024
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`
+	Service string `json:"service"`
+
+	// method is the gRPC method name (e.g. "GetUser"). When empty, every
+	// method of the service is matched.
+	// +optional
+	// +kubebuilder:validation:MaxLength=1024
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*$`
+	Method string `json:"method,omitempty"`
+
+	// headers is the list of gRPC metadata (HTTP header) matching criteria,
+	// AND-combined with the service/method match.
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	// +listType=map
+	// +listMapKey=name
+	Headers []HeaderMatch `json:"headers,omitempty"`
+
+	// priority defines the order in which routes are evaluated
+	// Higher values are evaluated first. When unset, spec.defaults.priority
+	// applies, or the operator's default priority for the match type if
+	// that is unset too (1000 unless configured with --priority-bands).
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10000
+	Priority int32 `json:"priority,omitempty"`
+}
+
 // QueryParamMatchType defines how a query parameter value is compared.
 // +kubebuilder:validation:Enum=Exact;RegularExpression
 type QueryParamMatchType string
@@ -135,7 +213,14 @@ type QueryParamMatch struct {
 // to Gateway API's HTTPCORSFilter. Preflight handling and response-header
 // injection happen in Envoy's native CORS filter, so the ExtProc hot path
 // is likewise untouched.
-// +kubebuilder:validation:Enum=redirect;rewrite;header-set;header-add;header-remove;response-header-set;response-header-add;response-header-remove;request-mirror;cors
+// The require-auth action asks an external authorization service whether the
+// request may proceed before it is forwarded. Unlike mirror and cors, the
+// check is performed by the ExtProc itself, which returns the auth service's
+// denial (e.g. 401 or 403) to the client instead of routing the request.
+// The strip-upgrade and deny-upgrade actions protect backends that mishandle
+// protocol upgrades (e.g. WebSocket): the ExtProc either removes the Upgrade
+// and Connection headers before forwarding, or rejects the upgrade attempt.
+// +kubebuilder:validation:Enum=redirect;rewrite;header-set;header-add;header-remove;response-header-set;response-header-add;response-header-remove;request-mirror;cors;require-auth;strip-upgrade;deny-upgrade
 type ActionType string
 
 const (
@@ -172,11 +257,28 @@ const (
 	// both preflight (OPTIONS) and actual cross-origin responses.
 	// Equivalent to Gateway API HTTPCORSFilter.
 	ActionTypeCORS ActionType = "cors"
+
+	// ActionTypeRequireAuth checks the request against an external HTTP
+	// authorization service before forwarding it. A 2xx answer lets the
+	// request through; any other answer is returned to the client.
+	ActionTypeRequireAuth ActionType = "require-auth"
+
+	// ActionTypeStripUpgrade removes the Upgrade and Connection headers of
+	// requests attempting a protocol upgrade, which reach the backend as
+	// plain HTTP requests.
+	ActionTypeStripUpgrade ActionType = "strip-upgrade"
+
+	// ActionTypeDenyUpgrade rejects requests attempting a protocol upgrade
+	// with upgradeStatusCode. Other requests are forwarded normally.
+	ActionTypeDenyUpgrade ActionType = "deny-upgrade"
 )
 
 const (
 	// DefaultPriority is the default priority for routes
 	DefaultPriority int32 = 1000
+
+	// DefaultFractionDenominator is the default Fraction denominator
+	DefaultFractionDenominator int32 = 100
 )
 
 // Status condition types for CustomHTTPRoute
@@ -189,6 +291,21 @@ const (
 
 	// ConditionTypeCatchAllProgrammed indicates whether the route's catchAllRoute is applied to the dataplane
 	ConditionTypeCatchAllProgrammed = "CatchAllProgrammed"
+
+	// ConditionTypeBackendsResolved indicates whether every backendRef points to an existing Service and port
+	ConditionTypeBackendsResolved = "BackendsResolved"
+
+	// ConditionTypeRoutesShadowed indicates whether some of the route's routes can never match because
+	// an earlier route of their host matches every request they would
+	ConditionTypeRoutesShadowed = "RoutesShadowed"
+
+	// ConditionTypeHTTPProxyRoutesSkipped indicates whether some of the route's routes use a feature
+	// Contour HTTPProxies cannot express and are denied, or their host left unpublished, in them
+	ConditionTypeHTTPProxyRoutesSkipped = "HTTPProxyRoutesSkipped"
+
+	// ConditionTypeRulesExpired indicates whether some of the route's rules are past their expiresAt
+	// and no longer routed, while still present in the manifest
+	ConditionTypeRulesExpired = "RulesExpired"
 )
 
 // PathPrefixes defines path prefixes configuration (e.g., for languages)
@@ -219,7 +336,11 @@ type PathPrefixes struct {
 // criteria (headers, query parameters) are applied via sibling fields on the
 // containing Rule and are AND-combined with this match at request-routing time.
 type PathMatch struct {
-	// path is the value to match against the request path
+	// path is the value to match against the request path.
+	// It may contain a {prefix} placeholder marking where path prefixes are
+	// substituted (e.g. "/app/{prefix}/settings") instead of being prepended.
+	// For Exact and PathPrefix matches, the unprefixed variant drops the
+	// placeholder segment ("/app/settings").
 	// +required
 	// +kubebuilder:validation:MaxLength=4096
 	Path string `json:"path"`
@@ -232,12 +353,27 @@ type PathMatch struct {
 	// +kubebuilder:default=PathPrefix
 	Type MatchType `json:"type,omitempty"`
 
+	// caseInsensitive matches the path regardless of letter case, for every
+	// match type: "/Shop" then also matches "/shop" and "/SHOP". For Regex it
+	// is the same as starting the pattern with the (?i) flag. It covers the
+	// path prefixes inserted into the path too.
+	// +optional
+	CaseInsensitive bool `json:"caseInsensitive,omitempty"`
+
 	// method restricts this match to requests using the given HTTP method.
 	// When empty (default), requests with any method are matched.
 	// Mirrors Gateway API HTTPRouteMatch.method.
 	// +optional
 	Method HTTPMethod `json:"method,omitempty"`
 
+	// scheme restricts this match to requests using the given scheme, e.g.
+	// to redirect the plain HTTP requests of a hostname serving both during
+	// a migration. The external processor reads the :scheme pseudo-header,
+	// falling back to X-Forwarded-Proto, then to https. When empty
+	// (default), requests with any scheme are matched.
+	// +optional
+	Scheme RequestScheme `json:"scheme,omitempty"`
+
 	// headers is the list of HTTP header matching criteria. All listed headers
 	// must match for this rule to apply (AND-combined). When empty, any headers
 	// are accepted. Mirrors Gateway API HTTPRouteMatch.headers.
@@ -256,10 +392,19 @@ type PathMatch struct {
 	// +listMapKey=name
 	QueryParams []QueryParamMatch `json:"queryParams,omitempty"`
 
+	// fraction restricts this match to a share of requests: numerator out of
+	// every denominator. Requests are picked by a hash of their x-request-id
+	// header, so the same request id always gets the same answer and requests
+	// without one never match. Combined with headers, it enables gradual
+	// rollouts at the routing layer.
+	// +optional
+	Fraction *Fraction `json:"fraction,omitempty"`
+
 	// priority defines the order in which routes are evaluated
-	// Higher values are evaluated first. Default is 1000.
+	// Higher values are evaluated first. When unset, spec.defaults.priority
+	// applies, or the operator's default priority for the match type if
+	// that is unset too (1000 unless configured with --priority-bands).
 	// +optional
-	// +kubebuilder:default=1000
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:validation:Maximum=10000
 	Priority int32 `json:"priority,omitempty"`
@@ -286,9 +431,22 @@ type BackendRef struct {
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:validation:Maximum=65535
 	Port int32 `json:"port"`
+
+	// protocol is the protocol spoken to the backend, as an ALPN id: h2
+	// (HTTP/2 over TLS), h2c (cleartext HTTP/2, e.g. gRPC) or http/1.1.
+	// It configures the upstream cluster of the backend, so it applies to
+	// every route forwarding to it. Unset keeps the protocol the gateway
+	// picks (on Istio, from the Service port name or appProtocol). Only
+	// read on the backends of rules, defaults, override variants and
+	// outlier fallbacks.
+	// +optional
+	// +kubebuilder:validation:Enum=h2;h2c;http/1.1
+	Protocol string `json:"protocol,omitempty"`
 }
 
 // RewriteConfig defines URL rewrite configuration
+// +kubebuilder:validation:XValidation:rule="has(self.path) || has(self.segments) || has(self.hostname)",message="at least one of path, segments or hostname must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.path) || !has(self.segments)",message="path and segments are mutually exclusive"
 type RewriteConfig struct {
 	// path is the new path to rewrite to. Supports variables:
 	// ${path} - original request path
@@ -296,6 +454,8 @@ type RewriteConfig struct {
 	// ${method} - HTTP method (GET, POST, etc.)
 	// ${scheme} - request scheme (http or https)
 	// ${path.segment.N} - Nth segment of the path (0-indexed)
+	// ${header.<name>} - value of a request header, percent-encoded
+	// ${query.<name>} - value of a query parameter, percent-encoded
 	//
 	// For PathPrefix matches: if the path does not contain variables (${...}),
 	// only the matched prefix is replaced and the remaining suffix and query
@@ -307,6 +467,19 @@ type RewriteConfig struct {
 	// +kubebuilder:validation:MaxLength=4096
 	Path string `json:"path,omitempty"`
 
+	// segments rewrites single segments of the request path instead of the
+	// whole path, keyed by their 0-based index as in ${path.segment.N}:
+	// {"2": "v2"} turns /api/shop/v1/items into /api/shop/v2/items. Values
+	// support the same variables as path, so
+	// {"1": "${path.segment.3}", "3": "${path.segment.1}"} swaps two
+	// segments, and an empty value removes the segment. Indexes past the
+	// last segment of a request are ignored; the other segments, a trailing
+	// slash and the query string are kept. Indexes run from 0 to 99;
+	// values are up to 256 characters without "/", "?" or "#".
+	// +optional
+	// +kubebuilder:validation:MaxProperties=16
+	Segments map[string]string `json:"segments,omitempty"`
+
 	// replacePrefixMatch explicitly controls whether prefix rewrite is used.
 	// When true, only the matched prefix is replaced and the remaining path
 	// suffix and query parameters are preserved. When false, the entire path
@@ -328,11 +501,18 @@ type RewriteConfig struct {
 	PreservePrefix *bool `json:"preservePrefix,omitempty"`
 }
 
+// RedirectSchemePreserve is the redirect scheme that keeps the scheme of
+// the request.
+const RedirectSchemePreserve = "preserve"
+
 // RedirectConfig defines HTTP redirect configuration
+// +kubebuilder:validation:XValidation:rule="has(self.scheme) || has(self.hostname) || has(self.path) || has(self.port)",message="at least one of scheme, hostname, path or port must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.scheme) || self.scheme != 'preserve' || has(self.hostname) || has(self.path) || has(self.port)",message="scheme preserve needs a hostname, path or port to redirect to"
 type RedirectConfig struct {
-	// scheme is the scheme to redirect to (http or https)
+	// scheme is the scheme to redirect to: http, https, or preserve to keep
+	// the scheme of the request, which is also what an unset scheme does.
 	// +optional
-	// +kubebuilder:validation:Enum=http;https
+	// +kubebuilder:validation:Enum=http;https;preserve
 	Scheme string `json:"scheme,omitempty"`
 
 	// hostname is the hostname to redirect to
@@ -346,6 +526,8 @@ type RedirectConfig struct {
 	// ${method} - HTTP method (GET, POST, etc.)
 	// ${scheme} - request scheme (http or https)
 	// ${path.segment.N} - Nth segment of the path (0-indexed)
+	// ${header.<name>} - value of a request header, percent-encoded
+	// ${query.<name>} - value of a query parameter, percent-encoded
 	// +optional
 	// +kubebuilder:validation:MaxLength=4096
 	Path string `json:"path,omitempty"`
@@ -366,6 +548,22 @@ type RedirectConfig struct {
 	// +kubebuilder:validation:Maximum=65535
 	Port *int32 `json:"port,omitempty"`
 
+	// preservePort keeps the port of the request's authority in the
+	// redirect location, for servers listening on a non-standard port (e.g.
+	// a NodePort). It only applies when port and hostname are not set and the
+	// redirect keeps the request scheme; the default port of the scheme is
+	// always left out. Defaults to true.
+	// +optional
+	PreservePort *bool `json:"preservePort,omitempty"`
+
+	// altSvc is the Alt-Svc header sent with the redirect, e.g.
+	// `h3=":443"; ma=86400` so HTTP/3 clients keep using HTTP/3 for the
+	// redirect location, or "clear". It overrides the external processor's
+	// --redirect-alt-svc.
+	// +optional
+	// +kubebuilder:validation:MaxLength=256
+	AltSvc string `json:"altSvc,omitempty"`
+
 	// statusCode is the HTTP status code to use for the redirect
 	// +optional
 	// +kubebuilder:default=302
@@ -448,10 +646,62 @@ type CORSConfig struct {
 	MaxAge int32 `json:"maxAge,omitempty"`
 }
 
+// AuthConfig defines a forward-authentication check, in the style of
+// nginx's auth_request or Envoy's ext_authz HTTP service. For every matched
+// request the ExtProc sends a GET to the auth service carrying the selected
+// request headers plus X-Forwarded-Method, X-Forwarded-Host and
+// X-Forwarded-Uri. A 2xx response allows the request; 3xx and 4xx responses
+// (typically 401, 403 or a redirect to a login page) are returned to the
+// client as-is, and 5xx responses or transport errors deny the request with
+// 403 unless failOpen is set.
+type AuthConfig struct {
+	// backendRef is the Service exposing the HTTP authorization endpoint.
+	// Names containing a dot are treated as external hostnames, like the
+	// rule's backendRefs.
+	// +required
+	BackendRef BackendRef `json:"backendRef"`
+
+	// path is the path requested on the authorization service.
+	// Defaults to "/" if not specified.
+	// +optional
+	// +kubebuilder:validation:MaxLength=1024
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path,omitempty"`
+
+	// forwardHeaders lists the request headers copied to the authorization
+	// request. Header names are case-insensitive.
+	// Defaults to ["authorization", "cookie"] if not specified.
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	ForwardHeaders []string `json:"forwardHeaders,omitempty"`
+
+	// upstreamHeaders lists the headers of a successful authorization
+	// response that are copied onto the request forwarded to the backend
+	// (e.g. "x-user-id"). Headers not listed here are dropped.
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	UpstreamHeaders []string `json:"upstreamHeaders,omitempty"`
+
+	// timeout bounds the authorization request. It must be lower than the
+	// ExternalProcessorAttachment messageTimeout, otherwise Envoy gives up on
+	// the ExtProc before the check completes.
+	// Defaults to "1s" if not specified.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(s|ms|m|h)$`
+	Timeout string `json:"timeout,omitempty"`
+
+	// failOpen lets requests through when the authorization service cannot
+	// be reached, times out or answers with a 5xx status. Defaults to false,
+	// which denies those requests with 403.
+	// +optional
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
 // HeaderConfig defines a header name-value pair
 type HeaderConfig struct {
 	// name is the header name
 	// +required
+	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:validation:MaxLength=256
 	Name string `json:"name"`
 
@@ -462,12 +712,21 @@ type HeaderConfig struct {
 	// ${path} - original request path
 	// ${method} - HTTP method (GET, POST, etc.)
 	// ${scheme} - request scheme (http or https)
+	// ${header.<name>} - value of a request header
+	// ${query.<name>} - value of a query parameter
 	// +required
 	// +kubebuilder:validation:MaxLength=4096
 	Value string `json:"value"`
 }
 
 // Action defines an action to perform on a matched request
+// +kubebuilder:validation:XValidation:rule="self.type != 'redirect' || has(self.redirect)",message="redirect is required when type is redirect"
+// +kubebuilder:validation:XValidation:rule="self.type != 'rewrite' || has(self.rewrite)",message="rewrite is required when type is rewrite"
+// +kubebuilder:validation:XValidation:rule="!(self.type in ['header-set', 'header-add', 'response-header-set', 'response-header-add']) || has(self.header)",message="header is required when type is header-set, header-add, response-header-set or response-header-add"
+// +kubebuilder:validation:XValidation:rule="!(self.type in ['header-remove', 'response-header-remove']) || has(self.headerName)",message="headerName is required when type is header-remove or response-header-remove"
+// +kubebuilder:validation:XValidation:rule="self.type != 'request-mirror' || has(self.mirror)",message="mirror is required when type is request-mirror"
+// +kubebuilder:validation:XValidation:rule="self.type != 'cors' || has(self.cors)",message="cors is required when type is cors"
+// +kubebuilder:validation:XValidation:rule="self.type != 'require-auth' || has(self.auth)",message="auth is required when type is require-auth"
 type Action struct {
 	// type is the type of action to perform
 	// +required
@@ -498,6 +757,17 @@ type Action struct {
 	// cors specifies the CORS policy (required when type is "cors")
 	// +optional
 	CORS *CORSConfig `json:"cors,omitempty"`
+
+	// auth specifies the authorization check (required when type is "require-auth")
+	// +optional
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// upgradeStatusCode is the status upgrade attempts are rejected with
+	// when type is "deny-upgrade": 400 (Bad Request) or 426 (Upgrade
+	// Required). Defaults to 400 if not specified.
+	// +optional
+	// +kubebuilder:validation:Enum=400;426
+	UpgradeStatusCode int32 `json:"upgradeStatusCode,omitempty"`
 }
 
 // RulePathPrefixes defines path prefix overrides for a specific rule
@@ -526,18 +796,44 @@ type TargetRef struct {
 }
 
 // Rule defines a routing rule
+// +kubebuilder:validation:XValidation:rule="has(self.matches) || has(self.grpcMatches)",message="at least one of matches or grpcMatches is required"
+// +kubebuilder:validation:XValidation:rule="!has(self.backendFailover) || !has(self.outlierPolicy)",message="backendFailover and outlierPolicy are mutually exclusive"
 type Rule struct {
-	// matches defines the conditions for matching this rule
-	// +required
+	// matches defines the conditions for matching this rule.
+	// Required unless grpcMatches is set.
+	// +optional
 	// +kubebuilder:validation:MinItems=1
 	// +kubebuilder:validation:MaxItems=128
-	Matches []PathMatch `json:"matches"`
+	Matches []PathMatch `json:"matches,omitempty"`
 
-	// actions defines transformations to apply to matched requests
-	// Actions are applied in order: redirect (terminates), rewrite, then header modifications
+	// grpcMatches matches gRPC calls by service and method. Each entry is
+	// translated to a POST match on the "/<service>/<method>" path plus a
+	// gRPC content-type check. pathPrefixes are never applied to them.
 	// +optional
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=128
+	GRPCMatches []GRPCMatch `json:"grpcMatches,omitempty"`
+
+	// actions defines transformations to apply to matched requests.
+	// How they are applied depends on actionOrder.
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
 	Actions []Action `json:"actions,omitempty"`
 
+	// actionOrder controls how actions are applied.
+	// Fixed (the default) applies a redirect first (terminating the request),
+	// then the rewrites and header modifications, each seeing the original
+	// request; when several rewrites set the same field only the last one
+	// takes effect.
+	// Sequential applies the actions one after another in the order they are
+	// listed, each seeing the request as left by the previous ones: a
+	// hostname rewrite changes ${host} for later actions, a path rewrite
+	// changes ${path} and ${path.segment.N}, a header-remove drops headers
+	// set before it, and a redirect ends the sequence, so no action may
+	// follow it.
+	// +optional
+	ActionOrder ActionOrder `json:"actionOrder,omitempty"`
+
 	// backendRefs defines the backend services to route to
 	// Required unless actions contains a redirect action
 	// +optional
@@ -554,18 +850,574 @@ type Rule struct {
 	// always rejected regardless of this setting.
 	// +optional
 	AllowOverlap bool `json:"allowOverlap,omitempty"`
+
+	// protocolHints marks the rule as serving long-lived connections. The
+	// operator then routes its requests through a dedicated Envoy route with
+	// no request timeout and no retries, and for websocket also enables the
+	// WebSocket upgrade, so connections are not cut at the route timeout.
+	// +optional
+	ProtocolHints ProtocolHint `json:"protocolHints,omitempty"`
+
+	// outlierPolicy fails the rule over to a fallback backend while its
+	// backend answers with too many server errors, for backends without
+	// mesh outlier detection. The external processor tracks the responses,
+	// so the decision is local to each extproc replica.
+	// +optional
+	OutlierPolicy *OutlierPolicy `json:"outlierPolicy,omitempty"`
+
+	// backendFailover treats backendRefs as an ordered fallback chain: the
+	// external processor sends the rule's requests to the first backendRef
+	// that is healthy instead of always to the first one, e.g. to fail a
+	// primary region over to a secondary one. Requires at least two
+	// backendRefs and cannot be combined with outlierPolicy.
+	// +optional
+	BackendFailover *BackendFailover `json:"backendFailover,omitempty"`
+
+	// hashPolicy pins the rule's requests to upstream endpoints by a header
+	// or cookie value, so requests with the same value keep reaching the
+	// same pod, e.g. for WebSocket sessions or queue workers. The Envoy
+	// route the operator generates for the rule hashes on it, which only
+	// takes effect when the backend's cluster uses a consistent-hash load
+	// balancer (a DestinationRule with loadBalancer.consistentHash).
+	// +optional
+	HashPolicy *HashPolicy `json:"hashPolicy,omitempty"`
+
+	// maxRequestBytes answers requests whose body is larger than this many
+	// bytes with 413 Payload Too Large instead of forwarding them, so every
+	// backend of the rule gets the same limit. The external processor checks
+	// Content-Length; the body of a request without one is buffered by Envoy
+	// and checked once complete, so the Envoy buffer limit applies to it too.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxRequestBytes *int64 `json:"maxRequestBytes,omitempty"`
+
+	// expiresAt retires the rule at this time, e.g. a campaign redirect: the
+	// external processor stops matching its routes from then on, and the
+	// controller drops them from the route table on the rebuild it schedules
+	// for that time. The rule stays in the manifest, listed by the
+	// RulesExpired condition, until it is removed.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// enabled set to false pulls the rule out of the route table without
+	// removing it from the manifest. Defaults to true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// description says what the rule is for, overriding spec.description
+	// for its routes.
+	// +optional
+	// +kubebuilder:validation:MaxLength=256
+	Description string `json:"description,omitempty"`
+
+	// owner names who to contact about the rule, overriding spec.owner for
+	// its routes.
+	// +optional
+	// +kubebuilder:validation:MaxLength=128
+	Owner string `json:"owner,omitempty"`
 }
 
+// OutlierPolicy ejects the backend of a rule when too many of its recent
+// responses are server errors (5xx), sending the rule's requests to a
+// fallback backend until the ejection time has passed.
+type OutlierPolicy struct {
+	// fallbackBackendRef receives the requests of the rule while its backend
+	// is ejected.
+	// +required
+	FallbackBackendRef BackendRef `json:"fallbackBackendRef"`
+
+	// errorRatePercent is the share of 5xx responses within interval that
+	// ejects the backend.
+	// Defaults to 50 if not specified.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	ErrorRatePercent int32 `json:"errorRatePercent,omitempty"`
+
+	// minRequests is the number of responses within interval needed before
+	// the error rate is evaluated, so a few errors on a quiet route do not
+	// eject its backend.
+	// Defaults to 10 if not specified.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100000
+	MinRequests int32 `json:"minRequests,omitempty"`
+
+	// interval is the window the error rate is computed over.
+	// Defaults to "30s" if not specified.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(s|ms|m|h)$`
+	Interval string `json:"interval,omitempty"`
+
+	// ejectionTime is how long the backend stays ejected before requests
+	// are sent to it again.
+	// Defaults to "30s" if not specified.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(s|ms|m|h)$`
+	EjectionTime string `json:"ejectionTime,omitempty"`
+}
+
+// BackendHealthSignal is how the external processor tells that a backendRef
+// of a backendFailover chain is unhealthy.
+// +kubebuilder:validation:Enum=Endpoints;Responses
+type BackendHealthSignal string
+
+const (
+	// BackendHealthEndpoints marks a backendRef unhealthy while its Service
+	// has no ready endpoints.
+	BackendHealthEndpoints BackendHealthSignal = "Endpoints"
+
+	// BackendHealthResponses marks a backendRef unhealthy while too many of
+	// its recent responses are server errors (5xx).
+	BackendHealthResponses BackendHealthSignal = "Responses"
+)
+
+// BackendFailover sends the requests of a rule to the first of its
+// backendRefs that is healthy, in the order they are listed. While none is,
+// the first backendRef keeps receiving them.
+type BackendFailover struct {
+	// healthSignal tells when a backendRef is unhealthy.
+	// Endpoints: its Service has no ready endpoints. The external processor
+	// watches EndpointSlices when started with --backend-health-endpoints;
+	// without it, and for external hostnames, backendRefs are always healthy.
+	// Responses: too many of its recent responses are server errors, counted
+	// by the external processor as for outlierPolicy with the thresholds
+	// below, so the decision is local to each extproc replica.
+	// Defaults to Endpoints.
+	// +optional
+	HealthSignal BackendHealthSignal `json:"healthSignal,omitempty"`
+
+	// errorRatePercent is the share of 5xx responses within interval that
+	// marks a backendRef unhealthy with the Responses signal.
+	// Defaults to 50 if not specified.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	ErrorRatePercent int32 `json:"errorRatePercent,omitempty"`
+
+	// minRequests is the number of responses within interval needed before
+	// the error rate is evaluated with the Responses signal.
+	// Defaults to 10 if not specified.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100000
+	MinRequests int32 `json:"minRequests,omitempty"`
+
+	// interval is the window the error rate is computed over with the
+	// Responses signal.
+	// Defaults to "30s" if not specified.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(s|ms|m|h)$`
+	Interval string `json:"interval,omitempty"`
+
+	// ejectionTime is how long a backendRef stays unhealthy with the
+	// Responses signal before requests are sent to it again.
+	// Defaults to "30s" if not specified.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(s|ms|m|h)$`
+	EjectionTime string `json:"ejectionTime,omitempty"`
+}
+
+// HashPolicy selects the request value a rule's requests are hashed on to
+// pick an upstream endpoint. Exactly one of header and cookie must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.header) != has(self.cookie)",message="exactly one of header and cookie must be set"
+type HashPolicy struct {
+	// header hashes on the value of this request header. Requests without
+	// it are balanced as usual.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=256
+	Header string `json:"header,omitempty"`
+
+	// cookie hashes on the value of a cookie.
+	// +optional
+	Cookie *HashPolicyCookie `json:"cookie,omitempty"`
+}
+
+// HashPolicyCookie is the cookie a HashPolicy hashes on.
+type HashPolicyCookie struct {
+	// name is the cookie name.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=256
+	Name string `json:"name"`
+
+	// ttl makes Envoy generate the cookie, with this lifetime, for requests
+	// that do not send it, so the first request of a client is pinned too.
+	// Without it, requests without the cookie are balanced as usual.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(s|m|h)$`
+	TTL string `json:"ttl,omitempty"`
+
+	// path is the Path attribute of a generated cookie.
+	// +optional
+	// +kubebuilder:validation:MaxLength=1024
+	Path string `json:"path,omitempty"`
+}
+
+// ActionOrder controls how the actions of a rule are applied.
+// +kubebuilder:validation:Enum=Fixed;Sequential
+type ActionOrder string
+
+const (
+	// ActionOrderFixed applies a redirect first, then rewrites and header
+	// modifications against the original request.
+	ActionOrderFixed ActionOrder = "Fixed"
+
+	// ActionOrderSequential applies the actions in the order they are
+	// listed, each seeing the result of the previous ones.
+	ActionOrderSequential ActionOrder = "Sequential"
+)
+
+// ProtocolHint identifies a long-lived connection protocol served by a rule.
+// +kubebuilder:validation:Enum=websocket;sse
+type ProtocolHint string
+
+const (
+	// ProtocolHintWebSocket marks WebSocket endpoints (HTTP/1.1 Upgrade).
+	ProtocolHintWebSocket ProtocolHint = "websocket"
+
+	// ProtocolHintSSE marks Server-Sent Events endpoints (text/event-stream).
+	ProtocolHintSSE ProtocolHint = "sse"
+)
+
+// Backend protocols accepted in BackendRef.Protocol. The field is a plain
+// string so BackendRef keeps the same shape in every API version.
+const (
+	// BackendProtocolH2 is HTTP/2 over TLS.
+	BackendProtocolH2 = "h2"
+
+	// BackendProtocolH2C is cleartext HTTP/2 (prior knowledge), as spoken
+	// by most gRPC servers.
+	BackendProtocolH2C = "h2c"
+
+	// BackendProtocolHTTP11 is HTTP/1.1.
+	BackendProtocolHTTP11 = "http/1.1"
+)
+
 // CatchAllBackendRef defines the default backend for catch-all route generation.
 // When specified on a CustomHTTPRoute, the operator will generate catch-all virtual hosts
 // for the route's hostnames, allowing requests to be processed without requiring a base HTTPRoute.
+// +kubebuilder:validation:XValidation:rule="!has(self.excludePaths) || !has(self.listenerProtocol) || self.listenerProtocol != 'TLSPassthrough'",message="excludePaths cannot be used with listenerProtocol TLSPassthrough"
 type CatchAllBackendRef struct {
 	// backendRef defines the default backend service to route unmatched requests to.
 	// +required
 	BackendRef BackendRef `json:"backendRef"`
+
+	// excludePaths lists paths, such as the health checks of the gateway,
+	// that the catch-all virtual host answers before anything else instead
+	// of routing them.
+	// +optional
+	// +listType=map
+	// +listMapKey=path
+	// +kubebuilder:validation:MaxItems=16
+	ExcludePaths []CatchAllExcludePath `json:"excludePaths,omitempty"`
+
+	// listenerProtocol is the protocol of the Gateway listener serving the
+	// hostnames. TLSPassthrough hostnames get a filter chain forwarding TLS
+	// connections with a matching SNI to backendRef, since their traffic
+	// cannot be routed by path. Defaults to HTTP.
+	// +optional
+	// +kubebuilder:default=HTTP
+	ListenerProtocol ListenerProtocol `json:"listenerProtocol,omitempty"`
+
+	// hostnameAutomation asks the operator to provision DNS records and TLS
+	// certificates for the hostnames, which no HTTPRoute or Gateway owner
+	// does for a catch-all route. Only hostnames the operator allows are
+	// provisioned.
+	// +optional
+	HostnameAutomation *HostnameAutomation `json:"hostnameAutomation,omitempty"`
+}
+
+// HostnameAutomation selects the objects the operator writes for every
+// hostname of a catch-all route.
+type HostnameAutomation struct {
+	// dns writes an ExternalDNS DNSEndpoint pointing the hostname at the
+	// gateway address configured for the route's target.
+	// +optional
+	DNS bool `json:"dns,omitempty"`
+
+	// certificate writes a cert-manager Certificate for the hostname,
+	// issued by the issuer the operator is configured with.
+	// +optional
+	Certificate bool `json:"certificate,omitempty"`
+}
+
+// ListenerProtocol is the protocol of the Gateway listener serving a
+// catch-all hostname.
+// +kubebuilder:validation:Enum=HTTP;TLSPassthrough
+type ListenerProtocol string
+
+const (
+	// ListenerProtocolHTTP is a listener terminating HTTP, or HTTPS at the
+	// gateway.
+	ListenerProtocolHTTP ListenerProtocol = "HTTP"
+
+	// ListenerProtocolTLSPassthrough is a TLS listener forwarding encrypted
+	// connections by SNI.
+	ListenerProtocolTLSPassthrough ListenerProtocol = "TLSPassthrough"
+)
+
+// CatchAllExcludeAction selects how the catch-all virtual host serves an
+// excluded path.
+// +kubebuilder:validation:Enum=DirectResponse;PassThrough
+type CatchAllExcludeAction string
+
+const (
+	// CatchAllExcludeDirectResponse answers the path with an empty 200
+	// response from the gateway itself.
+	CatchAllExcludeDirectResponse CatchAllExcludeAction = "DirectResponse"
+
+	// CatchAllExcludePassThrough forwards the path to the catch-all backend
+	// without consulting the external processor.
+	CatchAllExcludePassThrough CatchAllExcludeAction = "PassThrough"
+)
+
+// CatchAllExcludePath is a path the catch-all virtual host keeps out of
+// routing.
+type CatchAllExcludePath struct {
+	// path is the request path to exclude, matched exactly (e.g. /healthz).
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path"`
+
+	// action selects how the path is served. Defaults to DirectResponse.
+	// +optional
+	// +kubebuilder:default=DirectResponse
+	Action CatchAllExcludeAction `json:"action,omitempty"`
+}
+
+// DecisionHeadersMode controls when the external processor adds its routing
+// decision headers (x-original-authority, x-customrouter-matched-path and
+// x-customrouter-matched-type) to the request forwarded to the backend.
+// +kubebuilder:validation:Enum=Always;Never;OnDebug
+type DecisionHeadersMode string
+
+const (
+	// DecisionHeadersAlways adds the decision headers to every forwarded request.
+	DecisionHeadersAlways DecisionHeadersMode = "Always"
+
+	// DecisionHeadersNever never adds them, and strips client-supplied copies.
+	DecisionHeadersNever DecisionHeadersMode = "Never"
+
+	// DecisionHeadersOnDebug adds them only to requests carrying the external
+	// processor's debug header (see its --debug-header flag).
+	DecisionHeadersOnDebug DecisionHeadersMode = "OnDebug"
+)
+
+// UnmatchedRequestPolicy controls what the external processor does with a
+// request that matches no route.
+// +kubebuilder:validation:Enum=Passthrough;"404";"503"
+type UnmatchedRequestPolicy string
+
+const (
+	// UnmatchedRequestPassthrough lets the request continue to whatever Envoy
+	// route matches it, e.g. the catch-all backend.
+	UnmatchedRequestPassthrough UnmatchedRequestPolicy = "Passthrough"
+
+	// UnmatchedRequestNotFound answers the request with 404 Not Found.
+	UnmatchedRequestNotFound UnmatchedRequestPolicy = "404"
+
+	// UnmatchedRequestServiceUnavailable answers the request with 503
+	// Service Unavailable.
+	UnmatchedRequestServiceUnavailable UnmatchedRequestPolicy = "503"
+)
+
+// DefaultOverrideHeaderName is the request header carrying the variant name
+// when overrideHeader.name is not set.
+const DefaultOverrideHeaderName = "x-route-override"
+
+// OverrideHeader defines the request header used to select a backend
+// variant, and the variants it may select. Requests whose header value does
+// not name a variant (or that do not carry the header) use the rule's
+// backendRefs as usual. Matching of the header value is exact and
+// case-sensitive.
+type OverrideHeader struct {
+	// name is the request header carrying the variant name.
+	// Defaults to "x-route-override" if not specified.
+	// +optional
+	// +kubebuilder:validation:MaxLength=256
+	Name string `json:"name,omitempty"`
+
+	// variants lists the backends selectable through the header.
+	// +required
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=64
+	// +listType=map
+	// +listMapKey=name
+	Variants []RouteVariant `json:"variants"`
+}
+
+// RouteVariant is a named alternate backend selectable via overrideHeader.
+type RouteVariant struct {
+	// name is the header value selecting this variant (e.g. a developer's
+	// branch name).
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`
+	Name string `json:"name"`
+
+	// backendRef is the backend requests are routed to when this variant is
+	// selected.
+	// +required
+	BackendRef BackendRef `json:"backendRef"`
+}
+
+// RuleDefaults holds settings inherited by every rule of a CustomHTTPRoute.
+// A rule overrides them as follows:
+//   - actions: the rule's own actions come first; a default action is dropped
+//     when the rule has an action of the same type, or, for header actions,
+//     one touching the same request or response header.
+//   - backendRefs: used only by rules without backendRefs and without a
+//     redirect action.
+//   - priority: used only by matches without a priority.
+type RuleDefaults struct {
+	// actions are appended to the actions of every rule, unless overridden.
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	Actions []Action `json:"actions,omitempty"`
+
+	// backendRefs are the backends of rules that declare none.
+	// +optional
+	BackendRefs []BackendRef `json:"backendRefs,omitempty"`
+
+	// priority is the priority of matches that do not set one.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10000
+	Priority int32 `json:"priority,omitempty"`
+}
+
+// HostnameAlias serves an alias hostname with the routes of one of the
+// route's hostnames, e.g. www.example.com with the routes of example.com.
+type HostnameAlias struct {
+	// hostname is the alias. It must not be one of spec.hostnames.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^(\*\.)?[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*(:[0-9]{1,5})?$`
+	Hostname string `json:"hostname"`
+
+	// canonical is the hostname, one of spec.hostnames, whose routes the
+	// alias gets.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^(\*\.)?[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*(:[0-9]{1,5})?$`
+	Canonical string `json:"canonical"`
+
+	// redirect set to true answers every request for the alias with a 301
+	// redirect to the same path and query on the canonical hostname, instead
+	// of routing it.
+	// +optional
+	Redirect bool `json:"redirect,omitempty"`
+}
+
+// DefaultMaintenanceStatusCode is the status maintenance answers requests
+// with when statusCode is not set.
+const DefaultMaintenanceStatusCode int32 = 503
+
+// Maintenance answers the requests of some hostnames and paths of a route
+// with a fixed maintenance response instead of forwarding them.
+// +kubebuilder:validation:XValidation:rule="!has(self.start) || !has(self.end) || self.end > self.start",message="end must be after start"
+type Maintenance struct {
+	// enabled set to false keeps the maintenance configured but inactive.
+	// Defaults to true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// start and end bound the maintenance window. Requests are only answered
+	// with the maintenance response from start (inclusive) until end
+	// (exclusive); an unset bound leaves the window open on that side.
+	// +optional
+	Start *metav1.Time `json:"start,omitempty"`
+	// +optional
+	End *metav1.Time `json:"end,omitempty"`
+
+	// hostnames restricts maintenance to some of the route's hostnames and
+	// hostname aliases. Defaults to every hostname of the route.
+	// +optional
+	// +kubebuilder:validation:MaxItems=128
+	// +kubebuilder:validation:items:MaxLength=253
+	// +kubebuilder:validation:items:Pattern=`^(\*\.)?[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*(:[0-9]{1,5})?$`
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	// paths restricts maintenance to requests whose path starts with one of
+	// these prefixes. Defaults to every path of the hostnames, including
+	// the paths served by other CustomHTTPRoutes sharing them.
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	// +kubebuilder:validation:items:MaxLength=1024
+	Paths []string `json:"paths,omitempty"`
+
+	// statusCode is the status of the maintenance response. Defaults to 503.
+	// +optional
+	// +kubebuilder:validation:Minimum=500
+	// +kubebuilder:validation:Maximum=599
+	StatusCode int32 `json:"statusCode,omitempty"`
+
+	// retryAfterSeconds sets the Retry-After header of the maintenance
+	// response. When unset, Retry-After is the end of the window, if any.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=604800
+	RetryAfterSeconds *int32 `json:"retryAfterSeconds,omitempty"`
+
+	// contentType is the Content-Type of body. Defaults to
+	// "text/html; charset=utf-8".
+	// +optional
+	// +kubebuilder:validation:MaxLength=256
+	ContentType string `json:"contentType,omitempty"`
+
+	// body is the maintenance page. It is copied into the route table once
+	// per hostname and path, so keep it small and link larger assets.
+	// +optional
+	// +kubebuilder:validation:MaxLength=16384
+	Body string `json:"body,omitempty"`
+
+	// bypass lets some requests through to the routes as usual, e.g. from
+	// the office or from the team checking the release.
+	// +optional
+	Bypass *MaintenanceBypass `json:"bypass,omitempty"`
+}
+
+// MaintenanceBypass selects the requests maintenance lets through. A request
+// matching any of them bypasses maintenance.
+type MaintenanceBypass struct {
+	// sourceCIDRs lets through requests from these client addresses, taken
+	// from the first X-Forwarded-For entry.
+	// +optional
+	// +kubebuilder:validation:MaxItems=64
+	// +kubebuilder:validation:items:MaxLength=64
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty"`
+
+	// header lets through requests carrying a header with a given value.
+	// +optional
+	Header *MaintenanceBypassHeader `json:"header,omitempty"`
+}
+
+// MaintenanceBypassHeader is a request header that bypasses maintenance.
+type MaintenanceBypassHeader struct {
+	// name is the header name, matched case-insensitively.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=256
+	Name string `json:"name"`
+
+	// value is the exact value the header must have. Anyone able to read
+	// the CustomHTTPRoute can read it.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=256
+	Value string `json:"value"`
 }
 
 // CustomHTTPRouteSpec defines the desired state of CustomHTTPRoute
+// +kubebuilder:validation:XValidation:rule="(has(self.defaults) && (has(self.defaults.backendRefs) || (has(self.defaults.actions) && self.defaults.actions.exists(a, a.type == 'redirect')))) || self.rules.all(r, has(r.backendRefs) || (has(r.actions) && r.actions.exists(a, a.type == 'redirect')))",message="backendRefs is required on rules without a redirect action, unless set in defaults",fieldPath=".rules"
+// +kubebuilder:validation:XValidation:rule="!has(self.hostnameAliases) || self.hostnameAliases.all(a, !(a.hostname in self.hostnames))",message="hostnameAliases must not repeat one of hostnames",fieldPath=".hostnameAliases"
+// +kubebuilder:validation:XValidation:rule="!has(self.hostnameAliases) || self.hostnameAliases.all(a, a.canonical in self.hostnames)",message="the canonical of every hostnameAlias must be one of hostnames",fieldPath=".hostnameAliases"
 type CustomHTTPRouteSpec struct {
 	// targetRef identifies the target external processor for this route.
 	// Routes are grouped by targetRef.name into separate ConfigMaps.
@@ -576,8 +1428,19 @@ type CustomHTTPRouteSpec struct {
 	// +required
 	// +kubebuilder:validation:MinItems=1
 	// +kubebuilder:validation:MaxItems=128
+	// +kubebuilder:validation:items:MaxLength=253
+	// +kubebuilder:validation:items:Pattern=`^(\*\.)?[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*(:[0-9]{1,5})?$`
 	Hostnames []string `json:"hostnames"`
 
+	// hostnameAliases serves further hostnames with the routes of one of
+	// hostnames, declared once, instead of listing them as hostnames of
+	// their own. An alias can instead redirect to its canonical hostname.
+	// +optional
+	// +kubebuilder:validation:MaxItems=128
+	// +listType=map
+	// +listMapKey=hostname
+	HostnameAliases []HostnameAlias `json:"hostnameAliases,omitempty"`
+
 	// pathPrefixes defines prefixes to prepend to paths (e.g., language prefixes)
 	// +optional
 	PathPrefixes *PathPrefixes `json:"pathPrefixes,omitempty"`
@@ -589,6 +1452,104 @@ type CustomHTTPRouteSpec struct {
 	// +optional
 	CatchAllRoute *CatchAllBackendRef `json:"catchAllRoute,omitempty"`
 
+	// overrideHeader lets a request select a named backend variant instead of
+	// the rule's backendRefs, e.g. to route a developer's own requests to a
+	// preview deployment without creating a CustomHTTPRoute per developer.
+	// It applies to every rule of this route that has backendRefs.
+	// +optional
+	OverrideHeader *OverrideHeader `json:"overrideHeader,omitempty"`
+
+	// decisionHeaders controls whether the routing decision headers are added
+	// to requests matched by this route: Always, Never or OnDebug. When not
+	// specified, the ExternalProcessorAttachment setting (or the external
+	// processor's --decision-headers flag) applies.
+	// +optional
+	DecisionHeaders DecisionHeadersMode `json:"decisionHeaders,omitempty"`
+
+	// scrubHeaders lists request headers removed from the client requests
+	// matched by this route before they are forwarded, e.g. x-user-id or
+	// x-internal-* that backends would otherwise trust. "*" matches any run
+	// of characters; a pattern starting with "!" keeps the headers it
+	// matches even when another pattern lists them, so ["*", "!accept*"]
+	// only lets accept headers through. Pseudo-headers and host are never
+	// removed. The external processor's --scrub-headers applies on top.
+	// +optional
+	// +kubebuilder:validation:MaxItems=32
+	// +kubebuilder:validation:items:MaxLength=256
+	// +kubebuilder:validation:items:Pattern=`^!?[A-Za-z0-9*._-]+$`
+	ScrubHeaders []string `json:"scrubHeaders,omitempty"`
+
+	// unmatchedRequestPolicy controls what happens to requests for this
+	// route's hostnames that match none of their routes: Passthrough, 404 or
+	// 503. When not specified, the ExternalProcessorAttachment setting (or
+	// the external processor's --unmatched-request-policy flag) applies.
+	// CustomHTTPRoutes sharing a hostname should agree on it.
+	// +optional
+	UnmatchedRequestPolicy UnmatchedRequestPolicy `json:"unmatchedRequestPolicy,omitempty"`
+
+	// precedence orders the routes of this CustomHTTPRoute against the routes
+	// of other CustomHTTPRoutes sharing a hostname when they tie on priority
+	// and specificity: higher values are evaluated first, so e.g.
+	// platform-owned routes can reliably win over team-owned ones. Routes
+	// still tied fall back to namespace/name order.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1000
+	Precedence int32 `json:"precedence,omitempty"`
+
+	// enabled set to false pulls every rule of this route out of the route
+	// table, e.g. to take routes out of service while the manifest stays in
+	// git. The catchAllRoute is still generated, so requests fall through to
+	// it. Defaults to true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// deletionDrainSeconds keeps the routes of this CustomHTTPRoute in the
+	// route table for this many seconds after it is deleted, flagged as
+	// draining, so in-flight client flows (e.g. a multi-step checkout) are
+	// not cut off mid-way. The object is removed once the period is over.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=3600
+	DeletionDrainSeconds int32 `json:"deletionDrainSeconds,omitempty"`
+
+	// maintenance answers requests for the route's hostnames with a
+	// maintenance response, while active, instead of routing them.
+	// +optional
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+
+	// defaults declares actions, backendRefs and priority once for every
+	// rule. Each rule can still override them; see RuleDefaults.
+	// +optional
+	Defaults *RuleDefaults `json:"defaults,omitempty"`
+
+	// variant puts the routes of this CustomHTTPRoute in a named variant of
+	// the route tables of its hostnames, e.g. blue or green. A request is
+	// matched against the routes of the variant its attachment's
+	// variantSelector picks, when its hostnames have routes of that variant,
+	// and against the routes of CustomHTTPRoutes without a variant
+	// otherwise; routes of other variants never match it. Routes of
+	// different variants do not conflict with each other.
+	// +optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Variant string `json:"variant,omitempty"`
+
+	// description says what the routes of this CustomHTTPRoute are for. It
+	// is carried into the route table and shown by the extproc debug
+	// endpoints and decision traces. A rule's description wins over it.
+	// +optional
+	// +kubebuilder:validation:MaxLength=256
+	Description string `json:"description,omitempty"`
+
+	// owner names who to contact about the routes of this CustomHTTPRoute,
+	// e.g. a team or an on-call rotation. It is carried into the route table
+	// and attributed in access logs, analytics records and decision traces.
+	// A rule's owner wins over it.
+	// +optional
+	// +kubebuilder:validation:MaxLength=128
+	Owner string `json:"owner,omitempty"`
+
 	// rules defines the routing rules
 	// +required
 	// +kubebuilder:validation:MinItems=1
@@ -602,6 +1563,17 @@ type CustomHTTPRouteStatus struct {
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
+	// disabledRules is the number of rules left out of the route table
+	// because they, or the whole route, are disabled.
+	// +optional
+	DisabledRules int32 `json:"disabledRules,omitempty"`
+
+	// warnings lists what of the spec the route table does not reflect,
+	// e.g. backendRefs that receive no traffic. The route is still served.
+	// +optional
+	// +listType=atomic
+	Warnings []string `json:"warnings,omitempty"`
+
 	// The status of each condition is one of True, False, or Unknown.
 	// +listType=map
 	// +listMapKey=type
@@ -611,6 +1583,7 @@ type CustomHTTPRouteStatus struct {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="Target",type="string",JSONPath=".spec.targetRef.name",description="Target external processor"
 // +kubebuilder:printcolumn:name="Reconciled",type="string",JSONPath=".status.conditions[?(@.type=='Reconciled')].status",description="Whether the manifest was reconciled"
 // +kubebuilder:printcolumn:name="ConfigMapSynced",type="string",JSONPath=".status.conditions[?(@.type=='ConfigMapSynced')].status",description="Whether the ConfigMap was synced"
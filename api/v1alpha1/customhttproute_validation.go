@@ -18,17 +18,275 @@ package v1alpha1
 
 import (
 	"fmt"
+	"net/netip"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 // ValidateCustomHTTPRoute validates the CustomHTTPRoute spec
 func (r *CustomHTTPRoute) Validate() error {
-	for i, rule := range r.Spec.Rules {
+	if err := validateOverrideHeader(r.Spec.OverrideHeader); err != nil {
+		return err
+	}
+	if err := validateHostnameAliases(r.Spec.Hostnames, r.Spec.HostnameAliases); err != nil {
+		return err
+	}
+	if err := validateDefaults(r.Spec.Defaults); err != nil {
+		return err
+	}
+	if err := validateMaintenance(&r.Spec); err != nil {
+		return err
+	}
+	if err := validateBackendProtocols(&r.Spec); err != nil {
+		return err
+	}
+	// Rules are validated with their inherited defaults, which follow the
+	// rule's own actions so that action indexes in errors still match.
+	for i, rule := range r.Spec.EffectiveRules() {
 		if err := validateRule(i, &rule); err != nil {
 			return err
 		}
 	}
+	// The action order is checked on the rule's own actions: inherited
+	// defaults after a redirect are ignored like in the Fixed order.
+	for i := range r.Spec.Rules {
+		if err := validateActionOrder(i, &r.Spec.Rules[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ActionOrderWarnings returns a warning for every rule whose actions do not
+// all take effect with the Fixed action order: rewrites overridden by a later
+// rewrite of the same field, and request modifications next to a redirect.
+// Such rules are valid, so they are reported without being rejected.
+func (r *CustomHTTPRoute) ActionOrderWarnings() []string {
+	var warnings []string
+	for i := range r.Spec.Rules {
+		rule := &r.Spec.Rules[i]
+		if rule.ActionOrder == ActionOrderSequential {
+			continue
+		}
+		var pathRewrites, hostnameRewrites, modifications int
+		hasRedirect := false
+		for _, action := range rule.Actions {
+			switch action.Type {
+			case ActionTypeRedirect:
+				hasRedirect = true
+			case ActionTypeRewrite:
+				modifications++
+				if action.Rewrite != nil && (action.Rewrite.Path != "" || len(action.Rewrite.Segments) > 0) {
+					pathRewrites++
+				}
+				if action.Rewrite != nil && action.Rewrite.Hostname != "" {
+					hostnameRewrites++
+				}
+			case ActionTypeHeaderSet, ActionTypeHeaderAdd, ActionTypeHeaderRemove:
+				modifications++
+			}
+		}
+		if pathRewrites > 1 {
+			warnings = append(warnings, fmt.Sprintf(
+				"rules[%d]: %d rewrites set the path but only the last one applies; set actionOrder: Sequential to compose them", i, pathRewrites))
+		}
+		if hostnameRewrites > 1 {
+			warnings = append(warnings, fmt.Sprintf(
+				"rules[%d]: %d rewrites set the hostname but only the last one applies; set actionOrder: Sequential to compose them", i, hostnameRewrites))
+		}
+		if hasRedirect && modifications > 0 {
+			warnings = append(warnings, fmt.Sprintf(
+				"rules[%d]: the redirect action runs first, so rewrite and request header actions are never applied", i))
+		}
+	}
+	return warnings
+}
+
+// validateActionOrder rejects Sequential rules listing request modifications
+// after a redirect, which ends the sequence before they apply.
+func validateActionOrder(index int, rule *Rule) error {
+	if rule.ActionOrder != ActionOrderSequential {
+		return nil
+	}
+	redirect := -1
+	for j, action := range rule.Actions {
+		switch action.Type {
+		case ActionTypeRedirect, ActionTypeRewrite, ActionTypeHeaderSet, ActionTypeHeaderAdd, ActionTypeHeaderRemove:
+			if redirect >= 0 {
+				return fmt.Errorf("rules[%d].actions[%d]: %s follows the redirect at actions[%d] and is never applied with actionOrder Sequential",
+					index, j, action.Type, redirect)
+			}
+			if action.Type == ActionTypeRedirect {
+				redirect = j
+			}
+		}
+	}
+	return nil
+}
+
+// validateDefaults validates the spec-level defaults on their own, so errors
+// in inherited actions are reported once instead of once per rule.
+func validateDefaults(d *RuleDefaults) error {
+	if d == nil {
+		return nil
+	}
+	for j := range d.Actions {
+		if err := validateAction(fmt.Sprintf("defaults.actions[%d]", j), &d.Actions[j]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBackendProtocols rejects a backend given two different protocols:
+// the protocol configures the backend's upstream cluster, shared by every
+// route forwarding to it.
+func validateBackendProtocols(spec *CustomHTTPRouteSpec) error {
+	type backendKey struct {
+		name, namespace string
+		port            int32
+	}
+	type protocolField struct{ protocol, field string }
+	seen := make(map[backendKey]protocolField)
+	check := func(field string, ref *BackendRef) error {
+		if ref.Protocol == "" {
+			return nil
+		}
+		key := backendKey{ref.Name, ref.Namespace, ref.Port}
+		if prev, ok := seen[key]; ok {
+			if prev.protocol != ref.Protocol {
+				return fmt.Errorf("%s.protocol: %q conflicts with %q set on the same backend at %s",
+					field, ref.Protocol, prev.protocol, prev.field)
+			}
+			return nil
+		}
+		seen[key] = protocolField{ref.Protocol, field}
+		return nil
+	}
+
+	if spec.Defaults != nil {
+		for j := range spec.Defaults.BackendRefs {
+			if err := check(fmt.Sprintf("defaults.backendRefs[%d]", j), &spec.Defaults.BackendRefs[j]); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range spec.Rules {
+		rule := &spec.Rules[i]
+		for j := range rule.BackendRefs {
+			if err := check(fmt.Sprintf("rules[%d].backendRefs[%d]", i, j), &rule.BackendRefs[j]); err != nil {
+				return err
+			}
+		}
+		if rule.OutlierPolicy != nil {
+			field := fmt.Sprintf("rules[%d].outlierPolicy.fallbackBackendRef", i)
+			if err := check(field, &rule.OutlierPolicy.FallbackBackendRef); err != nil {
+				return err
+			}
+		}
+	}
+	if spec.OverrideHeader != nil {
+		for i := range spec.OverrideHeader.Variants {
+			field := fmt.Sprintf("overrideHeader.variants[%d].backendRef", i)
+			if err := check(field, &spec.OverrideHeader.Variants[i].BackendRef); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateHostnameAliases validates that every alias points to one of
+// hostnames and is not one of them itself
+func validateHostnameAliases(hostnames []string, aliases []HostnameAlias) error {
+	declared := make(map[string]bool, len(hostnames))
+	for _, h := range hostnames {
+		declared[h] = true
+	}
+	seen := make(map[string]bool, len(aliases))
+	for i, a := range aliases {
+		if declared[a.Hostname] {
+			return fmt.Errorf("hostnameAliases[%d]: %q is already one of hostnames", i, a.Hostname)
+		}
+		if seen[a.Hostname] {
+			return fmt.Errorf("hostnameAliases[%d]: duplicate alias %q", i, a.Hostname)
+		}
+		seen[a.Hostname] = true
+		if !declared[a.Canonical] {
+			return fmt.Errorf("hostnameAliases[%d]: canonical %q is not one of hostnames", i, a.Canonical)
+		}
+	}
+	return nil
+}
+
+// validateOverrideHeader validates the spec-level override header and its variants
+// validateMaintenance validates that maintenance only covers hostnames the
+// route serves, with a non-empty window and parseable bypass addresses
+func validateMaintenance(spec *CustomHTTPRouteSpec) error {
+	m := spec.Maintenance
+	if m == nil {
+		return nil
+	}
+	if m.Start != nil && m.End != nil && !m.End.After(m.Start.Time) {
+		return fmt.Errorf("maintenance.end must be after maintenance.start")
+	}
+	served := make(map[string]bool)
+	for _, h := range spec.ServedHostnames() {
+		served[h] = true
+	}
+	for i, h := range m.Hostnames {
+		if !served[h] {
+			return fmt.Errorf("maintenance.hostnames[%d]: %q is not one of hostnames or hostnameAliases", i, h)
+		}
+	}
+	for i, path := range m.Paths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("maintenance.paths[%d]: %q must start with /", i, path)
+		}
+	}
+	if b := m.Bypass; b != nil {
+		for i, cidr := range b.SourceCIDRs {
+			if _, err := netip.ParsePrefix(cidr); err != nil {
+				return fmt.Errorf("maintenance.bypass.sourceCIDRs[%d]: %w", i, err)
+			}
+		}
+		if b.Header != nil && strings.HasPrefix(b.Header.Name, ":") {
+			return fmt.Errorf("maintenance.bypass.header.name: pseudo-header %q cannot be used", b.Header.Name)
+		}
+	}
+	return nil
+}
+
+func validateOverrideHeader(cfg *OverrideHeader) error {
+	if cfg == nil {
+		return nil
+	}
+	if len(cfg.Variants) == 0 {
+		return fmt.Errorf("overrideHeader.variants must contain at least one entry")
+	}
+	if strings.HasPrefix(cfg.Name, ":") {
+		return fmt.Errorf("overrideHeader.name: pseudo-header %q cannot be used as override header", cfg.Name)
+	}
+	seen := make(map[string]bool, len(cfg.Variants))
+	for i, v := range cfg.Variants {
+		if v.Name == "" {
+			return fmt.Errorf("overrideHeader.variants[%d]: name is required", i)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("overrideHeader.variants[%d]: duplicate variant name %q", i, v.Name)
+		}
+		seen[v.Name] = true
+		if v.BackendRef.Name == "" || v.BackendRef.Namespace == "" {
+			return fmt.Errorf("overrideHeader.variants[%d]: backendRef.name and backendRef.namespace are required", i)
+		}
+		if v.BackendRef.Port <= 0 || v.BackendRef.Port > 65535 {
+			return fmt.Errorf("overrideHeader.variants[%d]: backendRef.port must be in [1, 65535]", i)
+		}
+	}
 	return nil
 }
 
@@ -42,6 +300,10 @@ func validateRule(index int, rule *Rule) error {
 		}
 	}
 
+	if len(rule.Matches) == 0 && len(rule.GRPCMatches) == 0 {
+		return fmt.Errorf("rules[%d]: at least one of matches or grpcMatches is required", index)
+	}
+
 	// If no redirect action, backendRefs is required
 	if !hasRedirect && len(rule.BackendRefs) == 0 {
 		return fmt.Errorf("rules[%d]: backendRefs is required when no redirect action is specified", index)
@@ -49,22 +311,72 @@ func validateRule(index int, rule *Rule) error {
 
 	// Validate actions
 	for j, action := range rule.Actions {
-		if err := validateAction(index, j, &action); err != nil {
+		if err := validateAction(fmt.Sprintf("rules[%d].actions[%d]", index, j), &action); err != nil {
 			return err
 		}
 	}
 
-	// Validate regex patterns with {prefix} placeholder
+	// Validate regex patterns with {prefix} placeholder. Both the Required
+	// "(...)" and the Optional "(...)?" substitutions must compile: the latter
+	// is rejected by Go when the placeholder is followed by a repetition
+	// operator (e.g. "{prefix}{2}").
 	for j, match := range rule.Matches {
 		if match.Type == MatchTypeRegex && strings.Contains(match.Path, "{prefix}") {
-			testPattern := strings.ReplaceAll(match.Path, "{prefix}", "(test)")
-			if _, err := regexp.Compile(testPattern); err != nil {
-				return fmt.Errorf("rules[%d].matches[%d]: regex with {prefix} placeholder produces invalid pattern: %s → %s: %v",
-					index, j, match.Path, testPattern, err)
+			for _, group := range []string{"(test)", "(test)?"} {
+				testPattern := strings.ReplaceAll(match.Path, "{prefix}", group)
+				if _, err := regexp.Compile(testPattern); err != nil {
+					return fmt.Errorf("rules[%d].matches[%d]: regex with {prefix} placeholder produces invalid pattern: %s → %s: %v",
+						index, j, match.Path, testPattern, err)
+				}
+			}
+		}
+	}
+
+	// Regex paths must compile: the extproc compiles them when it loads the
+	// routes. Inline flags such as (?i) are accepted; a leading flag group
+	// stays in front of the path prefixes inserted into the pattern.
+	for j, match := range rule.Matches {
+		if match.Type == MatchTypeRegex && !strings.Contains(match.Path, "{prefix}") {
+			if _, err := regexp.Compile(match.Path); err != nil {
+				return fmt.Errorf("rules[%d].matches[%d]: invalid regex path %q: %v", index, j, match.Path, err)
 			}
 		}
 	}
 
+	for j, match := range rule.Matches {
+		for k := range match.Headers {
+			if err := validateHeaderMatch(&match.Headers[k]); err != nil {
+				return fmt.Errorf("rules[%d].matches[%d].headers[%d]: %w", index, j, k, err)
+			}
+		}
+		if f := match.Fraction; f != nil && f.Numerator > f.EffectiveDenominator() {
+			return fmt.Errorf("rules[%d].matches[%d].fraction: numerator %d exceeds denominator %d",
+				index, j, f.Numerator, f.EffectiveDenominator())
+		}
+	}
+
+	if rule.ProtocolHints != "" && hasRedirect {
+		return fmt.Errorf("rules[%d]: protocolHints is not supported on rules with a redirect action", index)
+	}
+	if rule.HashPolicy != nil && hasRedirect {
+		return fmt.Errorf("rules[%d]: hashPolicy is not supported on rules with a redirect action", index)
+	}
+	if err := validateUpgradeActions(index, rule); err != nil {
+		return err
+	}
+	if rule.BackendFailover != nil {
+		if rule.OutlierPolicy != nil {
+			return fmt.Errorf("rules[%d]: backendFailover and outlierPolicy are mutually exclusive", index)
+		}
+		if len(rule.BackendRefs) < 2 {
+			return fmt.Errorf("rules[%d]: backendFailover requires at least two backendRefs", index)
+		}
+	}
+
+	if err := validateGRPCMatches(index, rule); err != nil {
+		return err
+	}
+
 	// Validate preservePrefix is not used with Regex match types
 	if ruleHasPreservePrefix(rule) && ruleHasRegexMatch(rule) {
 		return fmt.Errorf("rules[%d]: preservePrefix is not supported with Regex match type", index)
@@ -78,6 +390,65 @@ func validateRule(index int, rule *Rule) error {
 	return nil
 }
 
+// validateGRPCMatches validates the gRPC matches of a rule and the actions
+// that cannot keep gRPC semantics: clients do not follow redirects, and a
+// gRPC path never carries a query string.
+func validateGRPCMatches(index int, rule *Rule) error {
+	if len(rule.GRPCMatches) == 0 {
+		return nil
+	}
+	for j, match := range rule.GRPCMatches {
+		if match.Service == "" {
+			return fmt.Errorf("rules[%d].grpcMatches[%d]: service is required", index, j)
+		}
+		for k := range match.Headers {
+			if err := validateHeaderMatch(&match.Headers[k]); err != nil {
+				return fmt.Errorf("rules[%d].grpcMatches[%d].headers[%d]: %w", index, j, k, err)
+			}
+		}
+	}
+	for j, action := range rule.Actions {
+		switch {
+		case action.Type == ActionTypeRedirect:
+			return fmt.Errorf("rules[%d].actions[%d]: redirect is not supported with grpcMatches", index, j)
+		case action.Type == ActionTypeRewrite && action.Rewrite != nil && strings.Contains(action.Rewrite.Path, "?"):
+			return fmt.Errorf("rules[%d].actions[%d]: rewrite.path must not contain a query string with grpcMatches", index, j)
+		}
+	}
+	return nil
+}
+
+// validateHeaderMatch checks that value is set exactly when the match type
+// compares against it, and that regular expressions compile.
+func validateHeaderMatch(h *HeaderMatch) error {
+	switch h.Type {
+	case HeaderMatchTypeExists, HeaderMatchTypeAbsent:
+		if h.Value != "" {
+			return fmt.Errorf("value must be empty for type %s", h.Type)
+		}
+	case HeaderMatchTypeRegularExpression:
+		if h.Value == "" {
+			return fmt.Errorf("value is required for type %s", h.Type)
+		}
+		if _, err := regexp.Compile(h.Value); err != nil {
+			return fmt.Errorf("invalid regular expression %q: %v", h.Value, err)
+		}
+	default:
+		if h.Value == "" {
+			return fmt.Errorf("value is required for type %s", headerMatchTypeOrDefault(h.Type))
+		}
+	}
+	return nil
+}
+
+// headerMatchTypeOrDefault returns t, or Exact when t is unset.
+func headerMatchTypeOrDefault(t HeaderMatchType) HeaderMatchType {
+	if t == "" {
+		return HeaderMatchTypeExact
+	}
+	return t
+}
+
 // ruleHasRedirectReplacePrefixMatch returns true if any redirect action in the rule has replacePrefixMatch enabled
 func ruleHasRedirectReplacePrefixMatch(rule *Rule) bool {
 	for _, action := range rule.Actions {
@@ -101,6 +472,25 @@ func ruleHasPreservePrefix(rule *Rule) bool {
 	return false
 }
 
+// validateUpgradeActions rejects rules both stripping and denying upgrades,
+// and rules refusing the WebSocket upgrades their protocolHints announce.
+func validateUpgradeActions(index int, rule *Rule) error {
+	var upgradeAction ActionType
+	for _, action := range rule.Actions {
+		if action.Type != ActionTypeStripUpgrade && action.Type != ActionTypeDenyUpgrade {
+			continue
+		}
+		if upgradeAction != "" && upgradeAction != action.Type {
+			return fmt.Errorf("rules[%d]: strip-upgrade and deny-upgrade actions are mutually exclusive", index)
+		}
+		upgradeAction = action.Type
+	}
+	if upgradeAction != "" && rule.ProtocolHints == ProtocolHintWebSocket {
+		return fmt.Errorf("rules[%d]: %s action contradicts protocolHints %q", index, upgradeAction, ProtocolHintWebSocket)
+	}
+	return nil
+}
+
 // ruleHasRegexMatch returns true if any match in the rule uses Regex type
 func ruleHasRegexMatch(rule *Rule) bool {
 	for _, match := range rule.Matches {
@@ -111,10 +501,8 @@ func ruleHasRegexMatch(rule *Rule) bool {
 	return false
 }
 
-// validateAction validates a single action
-func validateAction(ruleIndex, actionIndex int, action *Action) error {
-	prefix := fmt.Sprintf("rules[%d].actions[%d]", ruleIndex, actionIndex)
-
+// validateAction validates a single action; prefix locates it in errors.
+func validateAction(prefix string, action *Action) error {
 	switch action.Type {
 	case ActionTypeRedirect:
 		return validateRedirectAction(prefix, action)
@@ -129,6 +517,10 @@ func validateAction(ruleIndex, actionIndex int, action *Action) error {
 		return validateMirrorAction(prefix, action)
 	case ActionTypeCORS:
 		return validateCORSAction(prefix, action)
+	case ActionTypeRequireAuth:
+		return validateAuthAction(prefix, action)
+	case ActionTypeStripUpgrade, ActionTypeDenyUpgrade:
+		return validateUpgradeAction(prefix, action)
 	default:
 		return fmt.Errorf("%s: unknown action type '%s'", prefix, action.Type)
 	}
@@ -142,15 +534,74 @@ func validateRedirectAction(prefix string, action *Action) error {
 		action.Redirect.Path == "" && action.Redirect.Port == nil {
 		return fmt.Errorf("%s: at least one redirect field (scheme, hostname, path, or port) must be specified", prefix)
 	}
-	return nil
+	// A redirect keeping the scheme, host, path and port would redirect to
+	// the request itself.
+	if action.Redirect.Scheme == RedirectSchemePreserve && action.Redirect.Hostname == "" &&
+		action.Redirect.Path == "" && action.Redirect.Port == nil {
+		return fmt.Errorf("%s: redirect scheme %q needs a hostname, path or port to redirect to", prefix, RedirectSchemePreserve)
+	}
+	if strings.IndexFunc(action.Redirect.AltSvc, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%s: redirect.altSvc must not contain control characters", prefix)
+	}
+	return validateRequestVariables(prefix+".redirect.path", action.Redirect.Path)
 }
 
 func validateRewriteAction(prefix string, action *Action) error {
 	if action.Rewrite == nil {
 		return fmt.Errorf("%s: rewrite config is required when type is 'rewrite'", prefix)
 	}
-	if action.Rewrite.Path == "" && action.Rewrite.Hostname == "" {
-		return fmt.Errorf("%s: at least one rewrite field (path or hostname) must be specified", prefix)
+	rewrite := action.Rewrite
+	if rewrite.Path == "" && len(rewrite.Segments) == 0 && rewrite.Hostname == "" {
+		return fmt.Errorf("%s: at least one rewrite field (path, segments or hostname) must be specified", prefix)
+	}
+	if len(rewrite.Segments) > 0 {
+		if rewrite.Path != "" {
+			return fmt.Errorf("%s: rewrite.path and rewrite.segments are mutually exclusive", prefix)
+		}
+		if rewrite.ReplacePrefixMatch != nil || rewrite.PreservePrefix != nil {
+			return fmt.Errorf("%s: rewrite.replacePrefixMatch and rewrite.preservePrefix only apply to rewrite.path", prefix)
+		}
+		return validateRewriteSegments(prefix+".rewrite.segments", rewrite.Segments)
+	}
+	return validateRequestVariables(prefix+".rewrite.path", rewrite.Path)
+}
+
+// MaxRewriteSegment is the highest path segment index rewrite.segments may
+// set.
+const MaxRewriteSegment = 99
+
+// RewriteSegmentIndex parses a rewrite.segments key, a path segment index
+// from 0 to MaxRewriteSegment without leading zeros.
+func RewriteSegmentIndex(key string) (int, error) {
+	index, err := strconv.Atoi(key)
+	if err != nil || strconv.Itoa(index) != key || index < 0 || index > MaxRewriteSegment {
+		return 0, fmt.Errorf("segment index %q is not an integer from 0 to %d", key, MaxRewriteSegment)
+	}
+	return index, nil
+}
+
+// validateRewriteSegments checks that every key of segments is a segment
+// index and that no value adds segments or a query string of its own.
+func validateRewriteSegments(field string, segments map[string]string) error {
+	keys := make([]string, 0, len(segments))
+	for key := range segments {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := RewriteSegmentIndex(key); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		value := segments[key]
+		if len(value) > 256 {
+			return fmt.Errorf("%s[%s]: value must be at most 256 characters", field, key)
+		}
+		if strings.ContainsAny(value, "/?#") {
+			return fmt.Errorf("%s[%s]: value must not contain \"/\", \"?\" or \"#\"", field, key)
+		}
+		if err := validateRequestVariables(fmt.Sprintf("%s[%s]", field, key), value); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -162,6 +613,27 @@ func validateHeaderAction(prefix string, action *Action) error {
 	if action.Header.Name == "" {
 		return fmt.Errorf("%s: header.name is required", prefix)
 	}
+	return validateRequestVariables(prefix+".header.value", action.Header.Value)
+}
+
+// requestVariablePattern matches the ${header.<name>} and ${query.<name>}
+// variables, which read a request header or query parameter.
+var requestVariablePattern = regexp.MustCompile(`\$\{(header|query)\.([^}]*)\}`)
+
+// headerNamePattern matches an HTTP header name (an RFC 9110 token).
+var headerNamePattern = regexp.MustCompile("^[-!#$%&'*+.^_`|~0-9A-Za-z]+$")
+
+// validateRequestVariables checks that the ${header.<name>} and
+// ${query.<name>} variables of value name a header or query parameter.
+func validateRequestVariables(field, value string) error {
+	for _, m := range requestVariablePattern.FindAllStringSubmatch(value, -1) {
+		switch {
+		case m[2] == "":
+			return fmt.Errorf("%s: %s is missing the %s name", field, m[0], m[1])
+		case m[1] == "header" && !headerNamePattern.MatchString(m[2]):
+			return fmt.Errorf("%s: %s does not name a valid header", field, m[0])
+		}
+	}
 	return nil
 }
 
@@ -214,6 +686,54 @@ func validateCORSAction(prefix string, action *Action) error {
 	return nil
 }
 
+func validateUpgradeAction(prefix string, action *Action) error {
+	if action.UpgradeStatusCode == 0 {
+		return nil
+	}
+	if action.Type != ActionTypeDenyUpgrade {
+		return fmt.Errorf("%s: upgradeStatusCode is only supported when type is 'deny-upgrade'", prefix)
+	}
+	if action.UpgradeStatusCode != 400 && action.UpgradeStatusCode != 426 {
+		return fmt.Errorf("%s: upgradeStatusCode must be 400 or 426", prefix)
+	}
+	return nil
+}
+
+func validateAuthAction(prefix string, action *Action) error {
+	if action.Auth == nil {
+		return fmt.Errorf("%s: auth config is required when type is 'require-auth'", prefix)
+	}
+	if action.Auth.BackendRef.Name == "" {
+		return fmt.Errorf("%s: auth.backendRef.name is required", prefix)
+	}
+	if action.Auth.BackendRef.Namespace == "" {
+		return fmt.Errorf("%s: auth.backendRef.namespace is required", prefix)
+	}
+	if action.Auth.BackendRef.Port <= 0 || action.Auth.BackendRef.Port > 65535 {
+		return fmt.Errorf("%s: auth.backendRef.port must be in [1, 65535]", prefix)
+	}
+	if action.Auth.Path != "" && !strings.HasPrefix(action.Auth.Path, "/") {
+		return fmt.Errorf("%s: auth.path must start with '/'", prefix)
+	}
+	if action.Auth.Timeout != "" {
+		d, err := time.ParseDuration(action.Auth.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%s: auth.timeout %q is not a valid positive duration", prefix, action.Auth.Timeout)
+		}
+	}
+	for i, name := range action.Auth.ForwardHeaders {
+		if name == "" {
+			return fmt.Errorf("%s: auth.forwardHeaders[%d] must not be empty", prefix, i)
+		}
+	}
+	for i, name := range action.Auth.UpstreamHeaders {
+		if name == "" || strings.HasPrefix(name, ":") {
+			return fmt.Errorf("%s: auth.upstreamHeaders[%d]: %q is not a valid header name", prefix, i, name)
+		}
+	}
+	return nil
+}
+
 // isValidCORSOrigin returns true when the given string is an absolute URI
 // suitable as a CORS origin: a scheme (http/https) followed by "://" and a
 // non-empty host. No path, query, or fragment is permitted — browsers never
@@ -247,3 +767,12 @@ func (r *Rule) HasRedirectAction() bool {
 	}
 	return false
 }
+
+// EffectiveDenominator returns the denominator, defaulting to
+// DefaultFractionDenominator when unset.
+func (f *Fraction) EffectiveDenominator() int32 {
+	if f.Denominator <= 0 {
+		return DefaultFractionDenominator
+	}
+	return f.Denominator
+}
@@ -19,6 +19,9 @@ package v1alpha1
 import (
 	"strings"
 	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestValidateCustomHTTPRoute(t *testing.T) {
@@ -130,6 +133,54 @@ func TestValidateCustomHTTPRoute(t *testing.T) {
 			wantErr:     true,
 			errContains: "at least one redirect field",
 		},
+		{
+			name: "invalid: redirect preserving the scheme only",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "/old"}},
+							Actions: []Action{
+								{
+									Type:     ActionTypeRedirect,
+									Redirect: &RedirectConfig{Scheme: RedirectSchemePreserve},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "needs a hostname, path or port",
+		},
+		{
+			name: "invalid: redirect altSvc with a line break",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "/old"}},
+							Actions: []Action{
+								{
+									Type: ActionTypeRedirect,
+									Redirect: &RedirectConfig{
+										Scheme:   RedirectSchemePreserve,
+										Hostname: "www.example.com",
+										AltSvc:   "h3=\":443\"\r\nx-injected: 1",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "control characters",
+		},
 		{
 			name: "invalid: rewrite without config",
 			route: &CustomHTTPRoute{
@@ -479,154 +530,109 @@ func TestValidateCustomHTTPRoute(t *testing.T) {
 			errContains: "not a valid origin",
 		},
 		{
-			name: "valid: multiple actions with redirect",
+			name: "valid: require-auth with backend",
 			route: &CustomHTTPRoute{
 				Spec: CustomHTTPRouteSpec{
 					TargetRef: TargetRef{Name: "default"},
 					Hostnames: []string{"example.com"},
 					Rules: []Rule{
 						{
-							Matches: []PathMatch{{Path: "/old"}},
-							Actions: []Action{
-								{
-									Type:     ActionTypeRedirect,
-									Redirect: &RedirectConfig{Path: "/new", StatusCode: 301},
+							Matches: []PathMatch{{Path: "/api"}},
+							Actions: []Action{{
+								Type: ActionTypeRequireAuth,
+								Auth: &AuthConfig{
+									BackendRef:      BackendRef{Name: "auth", Namespace: "auth-system", Port: 8080},
+									Path:            "/verify",
+									UpstreamHeaders: []string{"x-user-id"},
+									Timeout:         "500ms",
 								},
-							},
+							}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: require-auth without config",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
 						{
 							Matches: []PathMatch{{Path: "/api"}},
-							Actions: []Action{
-								{
-									Type:    ActionTypeRewrite,
-									Rewrite: &RewriteConfig{Path: "/v2/api"},
-								},
-								{
-									Type:   ActionTypeHeaderSet,
-									Header: &HeaderConfig{Name: "X-Test", Value: "value"},
-								},
-							},
-							BackendRefs: []BackendRef{
-								{Name: "api", Namespace: "default", Port: 8080},
-							},
+							Actions: []Action{{
+								Type: ActionTypeRequireAuth,
+							}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 						},
 					},
 				},
 			},
-			wantErr: false,
+			wantErr:     true,
+			errContains: "auth config is required",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := tt.route.Validate()
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("expected error containing %q, got nil", tt.errContains)
-					return
-				}
-				if !strings.Contains(err.Error(), tt.errContains) {
-					t.Errorf("expected error containing %q, got %q", tt.errContains, err.Error())
-				}
-			} else {
-				if err != nil {
-					t.Errorf("expected no error, got %v", err)
-				}
-			}
-		})
-	}
-}
-
-func boolPtr(v bool) *bool { return &v }
-
-func TestValidatePreservePrefixWithRegex(t *testing.T) {
-	tests := []struct {
-		name        string
-		route       *CustomHTTPRoute
-		wantErr     bool
-		errContains string
-	}{
 		{
-			name: "preservePrefix on rewrite with regex match is rejected",
+			name: "invalid: require-auth with zero timeout",
 			route: &CustomHTTPRoute{
 				Spec: CustomHTTPRouteSpec{
 					TargetRef: TargetRef{Name: "default"},
 					Hostnames: []string{"example.com"},
 					Rules: []Rule{
 						{
-							Matches: []PathMatch{
-								{Path: "^/api/[0-9]+$", Type: MatchTypeRegex},
-							},
-							Actions: []Action{
-								{
-									Type: ActionTypeRewrite,
-									Rewrite: &RewriteConfig{
-										Path:           "/v2/api",
-										PreservePrefix: boolPtr(true),
-									},
+							Matches: []PathMatch{{Path: "/api"}},
+							Actions: []Action{{
+								Type: ActionTypeRequireAuth,
+								Auth: &AuthConfig{
+									BackendRef: BackendRef{Name: "auth", Namespace: "auth-system", Port: 8080},
+									Timeout:    "0s",
 								},
-							},
-							BackendRefs: []BackendRef{
-								{Name: "api", Namespace: "default", Port: 8080},
-							},
+							}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 						},
 					},
 				},
 			},
 			wantErr:     true,
-			errContains: "preservePrefix is not supported with Regex",
+			errContains: "not a valid positive duration",
 		},
 		{
-			name: "preservePrefix on redirect with regex match is rejected",
+			name: "invalid: require-auth copying a pseudo-header upstream",
 			route: &CustomHTTPRoute{
 				Spec: CustomHTTPRouteSpec{
 					TargetRef: TargetRef{Name: "default"},
 					Hostnames: []string{"example.com"},
 					Rules: []Rule{
 						{
-							Matches: []PathMatch{
-								{Path: "^/old/[0-9]+$", Type: MatchTypeRegex},
-							},
-							Actions: []Action{
-								{
-									Type: ActionTypeRedirect,
-									Redirect: &RedirectConfig{
-										Path:           "/new",
-										StatusCode:     301,
-										PreservePrefix: boolPtr(true),
-									},
+							Matches: []PathMatch{{Path: "/api"}},
+							Actions: []Action{{
+								Type: ActionTypeRequireAuth,
+								Auth: &AuthConfig{
+									BackendRef:      BackendRef{Name: "auth", Namespace: "auth-system", Port: 8080},
+									UpstreamHeaders: []string{":authority"},
 								},
-							},
+							}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 						},
 					},
 				},
 			},
 			wantErr:     true,
-			errContains: "preservePrefix is not supported with Regex",
+			errContains: "not a valid header name",
 		},
 		{
-			name: "preservePrefix with PathPrefix match is allowed",
+			name: "valid: deny-upgrade with 426",
 			route: &CustomHTTPRoute{
 				Spec: CustomHTTPRouteSpec{
 					TargetRef: TargetRef{Name: "default"},
 					Hostnames: []string{"example.com"},
 					Rules: []Rule{
 						{
-							Matches: []PathMatch{
-								{Path: "/blog", Type: MatchTypePathPrefix},
-							},
-							Actions: []Action{
-								{
-									Type: ActionTypeRewrite,
-									Rewrite: &RewriteConfig{
-										Path:           "/cms/blog",
-										PreservePrefix: boolPtr(true),
-									},
-								},
-							},
-							BackendRefs: []BackendRef{
-								{Name: "cms", Namespace: "default", Port: 8080},
-							},
+							Matches:     []PathMatch{{Path: "/api"}},
+							Actions:     []Action{{Type: ActionTypeDenyUpgrade, UpgradeStatusCode: 426}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 						},
 					},
 				},
@@ -634,123 +640,1161 @@ func TestValidatePreservePrefixWithRegex(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "preservePrefix with Exact match is allowed",
+			name: "invalid: upgradeStatusCode on strip-upgrade",
 			route: &CustomHTTPRoute{
 				Spec: CustomHTTPRouteSpec{
 					TargetRef: TargetRef{Name: "default"},
 					Hostnames: []string{"example.com"},
 					Rules: []Rule{
 						{
-							Matches: []PathMatch{
-								{Path: "/about", Type: MatchTypeExact},
-							},
-							Actions: []Action{
-								{
-									Type: ActionTypeRewrite,
-									Rewrite: &RewriteConfig{
-										Path:           "/pages/about",
-										PreservePrefix: boolPtr(true),
-									},
-								},
-							},
-							BackendRefs: []BackendRef{
-								{Name: "web", Namespace: "default", Port: 80},
-							},
+							Matches:     []PathMatch{{Path: "/api"}},
+							Actions:     []Action{{Type: ActionTypeStripUpgrade, UpgradeStatusCode: 400}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 						},
 					},
 				},
 			},
-			wantErr: false,
+			wantErr:     true,
+			errContains: "only supported when type is 'deny-upgrade'",
 		},
 		{
-			name: "preservePrefix=false with regex is allowed",
+			name: "invalid: strip-upgrade and deny-upgrade together",
 			route: &CustomHTTPRoute{
 				Spec: CustomHTTPRouteSpec{
 					TargetRef: TargetRef{Name: "default"},
 					Hostnames: []string{"example.com"},
 					Rules: []Rule{
 						{
-							Matches: []PathMatch{
-								{Path: "^/api/[0-9]+$", Type: MatchTypeRegex},
-							},
-							Actions: []Action{
-								{
-									Type: ActionTypeRewrite,
-									Rewrite: &RewriteConfig{
-										Path:           "/v2/api",
-										PreservePrefix: boolPtr(false),
-									},
-								},
-							},
-							BackendRefs: []BackendRef{
-								{Name: "api", Namespace: "default", Port: 8080},
-							},
+							Matches:     []PathMatch{{Path: "/api"}},
+							Actions:     []Action{{Type: ActionTypeStripUpgrade}, {Type: ActionTypeDenyUpgrade}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 						},
 					},
 				},
 			},
-			wantErr: false,
+			wantErr:     true,
+			errContains: "mutually exclusive",
 		},
 		{
-			name: "redirect.replacePrefixMatch with regex match is rejected",
+			name: "invalid: deny-upgrade on a websocket rule",
 			route: &CustomHTTPRoute{
 				Spec: CustomHTTPRouteSpec{
 					TargetRef: TargetRef{Name: "default"},
 					Hostnames: []string{"example.com"},
 					Rules: []Rule{
 						{
-							Matches: []PathMatch{
-								{Path: "^/old/[0-9]+$", Type: MatchTypeRegex},
-							},
-							Actions: []Action{
-								{
-									Type: ActionTypeRedirect,
-									Redirect: &RedirectConfig{
-										Path:               "/new",
-										StatusCode:         301,
-										ReplacePrefixMatch: boolPtr(true),
-									},
-								},
-							},
+							Matches:       []PathMatch{{Path: "/api"}},
+							Actions:       []Action{{Type: ActionTypeDenyUpgrade}},
+							ProtocolHints: ProtocolHintWebSocket,
+							BackendRefs:   []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 						},
 					},
 				},
 			},
 			wantErr:     true,
-			errContains: "redirect.replacePrefixMatch is not supported with Regex",
+			errContains: "contradicts protocolHints",
 		},
 		{
-			name: "redirect.replacePrefixMatch with PathPrefix match is allowed",
+			name: "valid: multiple actions with redirect",
 			route: &CustomHTTPRoute{
 				Spec: CustomHTTPRouteSpec{
 					TargetRef: TargetRef{Name: "default"},
 					Hostnames: []string{"example.com"},
 					Rules: []Rule{
 						{
-							Matches: []PathMatch{
-								{Path: "/old-api", Type: MatchTypePathPrefix},
+							Matches: []PathMatch{{Path: "/old"}},
+							Actions: []Action{
+								{
+									Type:     ActionTypeRedirect,
+									Redirect: &RedirectConfig{Path: "/new", StatusCode: 301},
+								},
 							},
+						},
+						{
+							Matches: []PathMatch{{Path: "/api"}},
 							Actions: []Action{
 								{
-									Type: ActionTypeRedirect,
-									Redirect: &RedirectConfig{
-										Path:               "/app",
-										StatusCode:         302,
-										ReplacePrefixMatch: boolPtr(true),
-									},
+									Type:    ActionTypeRewrite,
+									Rewrite: &RewriteConfig{Path: "/v2/api"},
+								},
+								{
+									Type:   ActionTypeHeaderSet,
+									Header: &HeaderConfig{Name: "X-Test", Value: "value"},
 								},
 							},
+							BackendRefs: []BackendRef{
+								{Name: "api", Namespace: "default", Port: 8080},
+							},
 						},
 					},
 				},
 			},
 			wantErr: false,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := tt.route.Validate()
+		{
+			name: "invalid: {prefix} placeholder followed by a repetition operator",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "^/{prefix}{2}/api$", Type: MatchTypeRegex}},
+							BackendRefs: []BackendRef{
+								{Name: "api", Namespace: "default", Port: 8080},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "regex with {prefix} placeholder produces invalid pattern",
+		},
+		{
+			name: "invalid: regex path that does not compile",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "^/api/(v1$", Type: MatchTypeRegex}},
+							BackendRefs: []BackendRef{
+								{Name: "api", Namespace: "default", Port: 8080},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "invalid regex path",
+		},
+		{
+			name: "valid: regex path with inline flags",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "(?i)^/legacy/(?-i:ID)/[0-9]+$", Type: MatchTypeRegex}},
+							BackendRefs: []BackendRef{
+								{Name: "api", Namespace: "default", Port: 8080},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid: override header with variants",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					OverrideHeader: &OverrideHeader{
+						Variants: []RouteVariant{
+							{Name: "alice", BackendRef: BackendRef{Name: "api-alice", Namespace: "preview", Port: 8080}},
+							{Name: "bob", BackendRef: BackendRef{Name: "api-bob", Namespace: "preview", Port: 8080}},
+						},
+					},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: override header without variants",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:      TargetRef{Name: "default"},
+					Hostnames:      []string{"example.com"},
+					OverrideHeader: &OverrideHeader{Name: "x-preview"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "overrideHeader.variants must contain at least one entry",
+		},
+		{
+			name: "invalid: override header with duplicate variants",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					OverrideHeader: &OverrideHeader{
+						Variants: []RouteVariant{
+							{Name: "alice", BackendRef: BackendRef{Name: "api-alice", Namespace: "preview", Port: 8080}},
+							{Name: "alice", BackendRef: BackendRef{Name: "api-bob", Namespace: "preview", Port: 8080}},
+						},
+					},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "duplicate variant name",
+		},
+		{
+			name: "valid hostname alias",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:       TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					HostnameAliases: []HostnameAlias{{Hostname: "www.example.com", Canonical: "example.com", Redirect: true}},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: hostname alias canonical not in hostnames",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:       TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					HostnameAliases: []HostnameAlias{{Hostname: "www.example.com", Canonical: "example.org"}},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "canonical \"example.org\" is not one of hostnames",
+		},
+		{
+			name: "invalid: hostname alias already in hostnames",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:       TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					HostnameAliases: []HostnameAlias{{Hostname: "example.com", Canonical: "example.com"}},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "is already one of hostnames",
+		},
+		{
+			name: "valid: maintenance on an alias with a bypass",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:       TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					HostnameAliases: []HostnameAlias{{Hostname: "www.example.com", Canonical: "example.com"}},
+					Maintenance:     &Maintenance{Hostnames: []string{"www.example.com"}, Paths: []string{"/checkout"}, Bypass: &MaintenanceBypass{SourceCIDRs: []string{"203.0.113.0/24", "2001:db8::/32"}}},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: maintenance on a hostname the route does not serve",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:       TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					HostnameAliases: []HostnameAlias{{Hostname: "www.example.com", Canonical: "example.com"}},
+					Maintenance:     &Maintenance{Hostnames: []string{"shop.example.com"}},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: `maintenance.hostnames[0]: "shop.example.com" is not one of hostnames`,
+		},
+		{
+			name: "invalid: maintenance window ending before it starts",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:       TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					HostnameAliases: []HostnameAlias{{Hostname: "www.example.com", Canonical: "example.com"}},
+					Maintenance:     &Maintenance{Start: &metav1.Time{Time: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)}, End: &metav1.Time{Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "maintenance.end must be after maintenance.start",
+		},
+		{
+			name: "invalid: maintenance path without a leading slash",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:       TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					HostnameAliases: []HostnameAlias{{Hostname: "www.example.com", Canonical: "example.com"}},
+					Maintenance:     &Maintenance{Paths: []string{"checkout"}},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: `maintenance.paths[0]: "checkout" must start with /`,
+		},
+		{
+			name: "invalid: maintenance bypass with a bare address",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef:       TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					HostnameAliases: []HostnameAlias{{Hostname: "www.example.com", Canonical: "example.com"}},
+					Maintenance:     &Maintenance{Bypass: &MaintenanceBypass{SourceCIDRs: []string{"203.0.113.7"}}},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "maintenance.bypass.sourceCIDRs[0]",
+		},
+		{
+			name: "invalid: override header on a pseudo-header",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					OverrideHeader: &OverrideHeader{
+						Name:     ":authority",
+						Variants: []RouteVariant{{Name: "alice", BackendRef: BackendRef{Name: "api-alice", Namespace: "preview", Port: 8080}}},
+					},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "pseudo-header",
+		},
+		{
+			name: "valid absent header match",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api", Headers: []HeaderMatch{{Name: "x-internal-token", Type: HeaderMatchTypeAbsent}}}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid notValue header match",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api", Headers: []HeaderMatch{{Name: "x-env", Value: "canary", Type: HeaderMatchTypeNotValue}}}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: exists header match with value",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api", Headers: []HeaderMatch{{Name: "x-debug", Value: "1", Type: HeaderMatchTypeExists}}}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "value must be empty for type Exists",
+		},
+		{
+			name: "invalid: exact header match without value",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api", Headers: []HeaderMatch{{Name: "x-env"}}}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "value is required for type Exact",
+		},
+		{
+			name: "invalid: header regex does not compile",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api", Headers: []HeaderMatch{{Name: "x-env", Value: "(", Type: HeaderMatchTypeRegularExpression}}}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "invalid regular expression",
+		},
+		{
+			name: "valid grpc-only rule",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							GRPCMatches: []GRPCMatch{{Service: "users.v1.UserService", Method: "GetUser"}},
+							BackendRefs: []BackendRef{{Name: "users", Namespace: "default", Port: 9000}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: rule without matches or grpcMatches",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							BackendRefs: []BackendRef{{Name: "users", Namespace: "default", Port: 9000}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "at least one of matches or grpcMatches is required",
+		},
+		{
+			name: "invalid: redirect with grpcMatches",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							GRPCMatches: []GRPCMatch{{Service: "users.v1.UserService"}},
+							Actions:     []Action{{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Path: "/new"}}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "redirect is not supported with grpcMatches",
+		},
+		{
+			name: "valid: websocket protocol hint with backend",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:       []PathMatch{{Path: "/ws"}},
+							ProtocolHints: ProtocolHintWebSocket,
+							BackendRefs:   []BackendRef{{Name: "ws", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: protocol hint with redirect",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:       []PathMatch{{Path: "/events"}},
+							ProtocolHints: ProtocolHintSSE,
+							Actions:       []Action{{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Path: "/new"}}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "protocolHints is not supported on rules with a redirect action",
+		},
+		{
+			name: "invalid: hash policy with redirect",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:    []PathMatch{{Path: "/ws"}},
+							HashPolicy: &HashPolicy{Header: "x-session-id"},
+							Actions:    []Action{{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Path: "/new"}}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "hashPolicy is not supported on rules with a redirect action",
+		},
+		{
+			name: "valid: backend failover chain from defaults",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Defaults: &RuleDefaults{BackendRefs: []BackendRef{
+						{Name: "api", Namespace: "us", Port: 8080},
+						{Name: "api", Namespace: "eu", Port: 8080},
+					}},
+					Rules: []Rule{
+						{
+							Matches:         []PathMatch{{Path: "/api"}},
+							BackendFailover: &BackendFailover{},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: backend failover with one backend",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:         []PathMatch{{Path: "/api"}},
+							BackendRefs:     []BackendRef{{Name: "api", Namespace: "us", Port: 8080}},
+							BackendFailover: &BackendFailover{HealthSignal: BackendHealthResponses},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "backendFailover requires at least two backendRefs",
+		},
+		{
+			name: "invalid: backend failover with outlier policy",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{
+								{Name: "api", Namespace: "us", Port: 8080},
+								{Name: "api", Namespace: "eu", Port: 8080},
+							},
+							BackendFailover: &BackendFailover{},
+							OutlierPolicy:   &OutlierPolicy{FallbackBackendRef: BackendRef{Name: "api", Namespace: "eu", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "backendFailover and outlierPolicy are mutually exclusive",
+		},
+		{
+			name: "invalid: grpc rewrite with query string",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							GRPCMatches: []GRPCMatch{{Service: "users.v1.UserService"}},
+							Actions:     []Action{{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "/users.v2.UserService/GetUser?x=1"}}},
+							BackendRefs: []BackendRef{{Name: "users", Namespace: "default", Port: 9000}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "must not contain a query string",
+		},
+		{
+			name: "invalid: grpc header regex",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							GRPCMatches: []GRPCMatch{{
+								Service: "users.v1.UserService",
+								Headers: []HeaderMatch{{Name: "x-tenant", Value: "([", Type: HeaderMatchTypeRegularExpression}},
+							}},
+							BackendRefs: []BackendRef{{Name: "users", Namespace: "default", Port: 9000}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "invalid regular expression",
+		},
+		{
+			name: "valid: backend inherited from defaults",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Defaults: &RuleDefaults{
+						BackendRefs: []BackendRef{{Name: "web", Namespace: "default", Port: 80}},
+					},
+					Rules: []Rule{
+						{Matches: []PathMatch{{Path: "/api"}}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: defaults action",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Defaults: &RuleDefaults{
+						Actions: []Action{{Type: ActionTypeHeaderSet}},
+					},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "defaults.actions[0]",
+		},
+		{
+			name: "invalid: defaults without backends do not satisfy rules",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Defaults:  &RuleDefaults{Priority: 2000},
+					Rules: []Rule{
+						{Matches: []PathMatch{{Path: "/api"}}},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "rules[0]: backendRefs is required",
+		},
+		{
+			name: "valid: header and query variables",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "/api"}},
+							Actions: []Action{
+								{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "/t/${header.X-Tenant-ID}${path}"}},
+								{Type: ActionTypeHeaderSet, Header: &HeaderConfig{Name: "x-ref", Value: "${query.ref}"}},
+							},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: header variable without a name",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "/old"}},
+							Actions: []Action{
+								{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Path: "/new/${header.}"}},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "rules[0].actions[0].redirect.path: ${header.} is missing the header name",
+		},
+		{
+			name: "invalid: header variable with an invalid name",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{{Path: "/api"}},
+							Actions: []Action{
+								{Type: ActionTypeHeaderSet, Header: &HeaderConfig{Name: "x-a", Value: "${header.x tenant}"}},
+							},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "does not name a valid header",
+		},
+		{
+			name: "valid: sequential rewrites before a redirect",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/old"}},
+							ActionOrder: ActionOrderSequential,
+							Actions: []Action{
+								{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Hostname: "new.example.com"}},
+								{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Path: "/${host}${path}"}},
+								{Type: ActionTypeResponseHeaderSet, Header: &HeaderConfig{Name: "x-a", Value: "1"}},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: sequential action after a redirect",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/old"}},
+							ActionOrder: ActionOrderSequential,
+							Actions: []Action{
+								{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Path: "/new"}},
+								{Type: ActionTypeHeaderSet, Header: &HeaderConfig{Name: "x-a", Value: "1"}},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "rules[0].actions[1]: header-set follows the redirect at actions[0]",
+		},
+		{
+			name: "valid: inherited defaults after a sequential redirect",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Defaults: &RuleDefaults{
+						Actions: []Action{{Type: ActionTypeHeaderSet, Header: &HeaderConfig{Name: "x-a", Value: "1"}}},
+					},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/old"}},
+							ActionOrder: ActionOrderSequential,
+							Actions: []Action{
+								{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Path: "/new"}},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid fraction with default denominator",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api", Fraction: &Fraction{Numerator: 100}}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: fraction numerator above denominator",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api", Fraction: &Fraction{Numerator: 11, Denominator: 10}}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "rules[0].matches[0].fraction: numerator 11 exceeds denominator 10",
+		},
+		{
+			name: "valid: same backend protocol repeated or left unset",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080, Protocol: BackendProtocolH2C}},
+						},
+						{
+							Matches:     []PathMatch{{Path: "/v2"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+						},
+						{
+							Matches:     []PathMatch{{Path: "/v3"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080, Protocol: BackendProtocolH2C}},
+						},
+						{
+							Matches:     []PathMatch{{Path: "/web"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 80, Protocol: BackendProtocolHTTP11}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid: conflicting protocols for the same backend",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches:     []PathMatch{{Path: "/api"}},
+							BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080, Protocol: BackendProtocolH2C}},
+						},
+					},
+					OverrideHeader: &OverrideHeader{
+						Variants: []RouteVariant{{
+							Name:       "dev",
+							BackendRef: BackendRef{Name: "api", Namespace: "default", Port: 8080, Protocol: BackendProtocolHTTP11},
+						}},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: `overrideHeader.variants[0].backendRef.protocol: "http/1.1" conflicts with "h2c" set on the same backend at rules[0].backendRefs[0]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.route.Validate()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error containing %q, got nil", tt.errContains)
+					return
+				}
+				if !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("expected error containing %q, got %q", tt.errContains, err.Error())
+				}
+			} else {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func boolPtr(v bool) *bool { return &v }
+
+func TestValidatePreservePrefixWithRegex(t *testing.T) {
+	tests := []struct {
+		name        string
+		route       *CustomHTTPRoute
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name: "preservePrefix on rewrite with regex match is rejected",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{
+								{Path: "^/api/[0-9]+$", Type: MatchTypeRegex},
+							},
+							Actions: []Action{
+								{
+									Type: ActionTypeRewrite,
+									Rewrite: &RewriteConfig{
+										Path:           "/v2/api",
+										PreservePrefix: boolPtr(true),
+									},
+								},
+							},
+							BackendRefs: []BackendRef{
+								{Name: "api", Namespace: "default", Port: 8080},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "preservePrefix is not supported with Regex",
+		},
+		{
+			name: "preservePrefix on redirect with regex match is rejected",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{
+								{Path: "^/old/[0-9]+$", Type: MatchTypeRegex},
+							},
+							Actions: []Action{
+								{
+									Type: ActionTypeRedirect,
+									Redirect: &RedirectConfig{
+										Path:           "/new",
+										StatusCode:     301,
+										PreservePrefix: boolPtr(true),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "preservePrefix is not supported with Regex",
+		},
+		{
+			name: "preservePrefix with PathPrefix match is allowed",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{
+								{Path: "/blog", Type: MatchTypePathPrefix},
+							},
+							Actions: []Action{
+								{
+									Type: ActionTypeRewrite,
+									Rewrite: &RewriteConfig{
+										Path:           "/cms/blog",
+										PreservePrefix: boolPtr(true),
+									},
+								},
+							},
+							BackendRefs: []BackendRef{
+								{Name: "cms", Namespace: "default", Port: 8080},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "preservePrefix with Exact match is allowed",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{
+								{Path: "/about", Type: MatchTypeExact},
+							},
+							Actions: []Action{
+								{
+									Type: ActionTypeRewrite,
+									Rewrite: &RewriteConfig{
+										Path:           "/pages/about",
+										PreservePrefix: boolPtr(true),
+									},
+								},
+							},
+							BackendRefs: []BackendRef{
+								{Name: "web", Namespace: "default", Port: 80},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "preservePrefix=false with regex is allowed",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{
+								{Path: "^/api/[0-9]+$", Type: MatchTypeRegex},
+							},
+							Actions: []Action{
+								{
+									Type: ActionTypeRewrite,
+									Rewrite: &RewriteConfig{
+										Path:           "/v2/api",
+										PreservePrefix: boolPtr(false),
+									},
+								},
+							},
+							BackendRefs: []BackendRef{
+								{Name: "api", Namespace: "default", Port: 8080},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "redirect.replacePrefixMatch with regex match is rejected",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{
+								{Path: "^/old/[0-9]+$", Type: MatchTypeRegex},
+							},
+							Actions: []Action{
+								{
+									Type: ActionTypeRedirect,
+									Redirect: &RedirectConfig{
+										Path:               "/new",
+										StatusCode:         301,
+										ReplacePrefixMatch: boolPtr(true),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			errContains: "redirect.replacePrefixMatch is not supported with Regex",
+		},
+		{
+			name: "redirect.replacePrefixMatch with PathPrefix match is allowed",
+			route: &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{
+						{
+							Matches: []PathMatch{
+								{Path: "/old-api", Type: MatchTypePathPrefix},
+							},
+							Actions: []Action{
+								{
+									Type: ActionTypeRedirect,
+									Redirect: &RedirectConfig{
+										Path:               "/app",
+										StatusCode:         302,
+										ReplacePrefixMatch: boolPtr(true),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.route.Validate()
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("expected error containing %q, got nil", tt.errContains)
@@ -820,3 +1864,96 @@ func TestHasRedirectAction(t *testing.T) {
 }
 
 func int32Ptr(v int32) *int32 { return &v }
+
+func TestActionOrderWarnings(t *testing.T) {
+	backend := []BackendRef{{Name: "api", Namespace: "default", Port: 8080}}
+	route := &CustomHTTPRoute{
+		Spec: CustomHTTPRouteSpec{
+			TargetRef: TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []Rule{
+				{
+					Matches:     []PathMatch{{Path: "/a"}},
+					BackendRefs: backend,
+					Actions: []Action{
+						{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Hostname: "a.example.com"}},
+						{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "/v1"}},
+						{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "/v2"}},
+					},
+				},
+				{
+					Matches: []PathMatch{{Path: "/b"}},
+					Actions: []Action{
+						{Type: ActionTypeHeaderSet, Header: &HeaderConfig{Name: "x-a", Value: "1"}},
+						{Type: ActionTypeRedirect, Redirect: &RedirectConfig{Path: "/new"}},
+					},
+				},
+				{
+					Matches:     []PathMatch{{Path: "/c"}},
+					BackendRefs: backend,
+					ActionOrder: ActionOrderSequential,
+					Actions: []Action{
+						{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "/v1"}},
+						{Type: ActionTypeRewrite, Rewrite: &RewriteConfig{Path: "${path}/v2"}},
+					},
+				},
+			},
+		},
+	}
+
+	warnings := route.ActionOrderWarnings()
+	want := []string{
+		"rules[0]: 2 rewrites set the path",
+		"rules[1]: the redirect action runs first",
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("got %d warnings %q, want %d", len(warnings), warnings, len(want))
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(warnings[i], prefix) {
+			t.Errorf("warnings[%d] = %q, want prefix %q", i, warnings[i], prefix)
+		}
+	}
+}
+
+func TestValidateRewriteSegments(t *testing.T) {
+	tests := []struct {
+		name        string
+		rewrite     RewriteConfig
+		errContains string
+	}{
+		{name: "valid", rewrite: RewriteConfig{Segments: map[string]string{"2": "v2", "4": "${path.segment.3}", "5": ""}}},
+		{name: "valid with hostname", rewrite: RewriteConfig{Segments: map[string]string{"0": "v2"}, Hostname: "api.example.com"}},
+		{name: "with path", rewrite: RewriteConfig{Path: "/v2", Segments: map[string]string{"0": "v2"}}, errContains: "mutually exclusive"},
+		{name: "with replacePrefixMatch", rewrite: RewriteConfig{Segments: map[string]string{"0": "v2"}, ReplacePrefixMatch: boolPtr(true)}, errContains: "only apply to rewrite.path"},
+		{name: "index out of range", rewrite: RewriteConfig{Segments: map[string]string{"100": "v2"}}, errContains: `segment index "100"`},
+		{name: "leading zero", rewrite: RewriteConfig{Segments: map[string]string{"02": "v2"}}, errContains: `segment index "02"`},
+		{name: "slash in value", rewrite: RewriteConfig{Segments: map[string]string{"1": "v2/beta"}}, errContains: "segments[1]: value must not contain"},
+		{name: "invalid variable", rewrite: RewriteConfig{Segments: map[string]string{"1": "${header.}"}}, errContains: "missing the header name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &CustomHTTPRoute{
+				Spec: CustomHTTPRouteSpec{
+					TargetRef: TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					Rules: []Rule{{
+						Matches:     []PathMatch{{Path: "/api"}},
+						Actions:     []Action{{Type: ActionTypeRewrite, Rewrite: &tt.rewrite}},
+						BackendRefs: []BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+					}},
+				},
+			}
+			err := route.Validate()
+			if tt.errContains == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.errContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// RouterConfigResolver gives CustomHTTPRoutes the defaults of the
+// CustomRouterConfigs selecting their namespace, the way the controller
+// does before expanding them, so the checks run on a route see the same
+// fields the controller serves.
+type RouterConfigResolver struct {
+	configs []*CustomRouterConfig
+
+	// namespaceLabels returns the labels of a namespace, nil when it does
+	// not exist.
+	namespaceLabels func(namespace string) (map[string]string, error)
+
+	selected map[string][]*CustomRouterConfigSpec
+}
+
+// NewRouterConfigResolver returns a RouterConfigResolver for configs, which
+// it does not modify. namespaceLabels returns the labels of a namespace,
+// nil when it does not exist; it is called once per namespace.
+func NewRouterConfigResolver(
+	configs []CustomRouterConfig,
+	namespaceLabels func(namespace string) (map[string]string, error),
+) *RouterConfigResolver {
+	sorted := make([]*CustomRouterConfig, len(configs))
+	for i := range configs {
+		sorted[i] = &configs[i]
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return &RouterConfigResolver{
+		configs:         sorted,
+		namespaceLabels: namespaceLabels,
+		selected:        make(map[string][]*CustomRouterConfigSpec),
+	}
+}
+
+// Resolve returns route with the defaults it inherits set, as a copy, or
+// route itself when it inherits none. A nil route or resolver returns route.
+func (r *RouterConfigResolver) Resolve(route *CustomHTTPRoute) (*CustomHTTPRoute, error) {
+	if r == nil || route == nil || len(r.configs) == 0 {
+		return route, nil
+	}
+	specs, ok := r.selected[route.Namespace]
+	if !ok {
+		namespaceLabels, err := r.namespaceLabels(route.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range r.configs {
+			if selects, err := c.SelectsNamespace(namespaceLabels); err == nil && selects {
+				specs = append(specs, &c.Spec)
+			}
+		}
+		r.selected[route.Namespace] = specs
+	}
+	if len(specs) == 0 {
+		return route, nil
+	}
+	inheriting := route.DeepCopy()
+	if !inheriting.Spec.InheritDefaults(specs) {
+		return route, nil
+	}
+	return inheriting, nil
+}
+
+// SelectsNamespace reports whether c gives its defaults to the
+// CustomHTTPRoutes of a namespace with the given labels.
+func (c *CustomRouterConfig) SelectsNamespace(namespaceLabels map[string]string) (bool, error) {
+	if c.Spec.NamespaceSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(c.Spec.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(namespaceLabels)), nil
+}
+
+// InheritDefaults sets the fields of s that are unset to the defaults of
+// configs, which must be ordered by name: each field, and each priority
+// band, is taken from the first of them that sets it. The bands are written
+// into the matches of the rules, so s must be a copy the caller owns. It
+// reports whether it set anything.
+func (s *CustomHTTPRouteSpec) InheritDefaults(configs []*CustomRouterConfigSpec) bool {
+	changed := false
+	var bands MatchPriorityBands
+	for _, c := range configs {
+		if s.PathPrefixes == nil && c.PathPrefixes != nil {
+			s.PathPrefixes = c.PathPrefixes.DeepCopy()
+			changed = true
+		}
+		if s.DecisionHeaders == "" && c.DecisionHeaders != "" {
+			s.DecisionHeaders = c.DecisionHeaders
+			changed = true
+		}
+		if s.UnmatchedRequestPolicy == "" && c.UnmatchedRequestPolicy != "" {
+			s.UnmatchedRequestPolicy = c.UnmatchedRequestPolicy
+			changed = true
+		}
+		if s.Precedence == 0 && c.Precedence != 0 {
+			s.Precedence = c.Precedence
+			changed = true
+		}
+		if c.PriorityBands != nil {
+			bands.inherit(c.PriorityBands)
+		}
+	}
+	if s.Defaults == nil || s.Defaults.Priority == 0 {
+		changed = s.applyPriorityBands(bands) || changed
+	}
+	return changed
+}
+
+// inherit sets the bands of b that are unset to those of from.
+func (b *MatchPriorityBands) inherit(from *MatchPriorityBands) {
+	if b.Exact == 0 {
+		b.Exact = from.Exact
+	}
+	if b.Regex == 0 {
+		b.Regex = from.Regex
+	}
+	if b.Prefix == 0 {
+		b.Prefix = from.Prefix
+	}
+}
+
+// For returns the band of matchType, or 0 when it is unset. An empty type
+// is a PathPrefix.
+func (b *MatchPriorityBands) For(matchType MatchType) int32 {
+	switch matchType {
+	case MatchTypeExact:
+		return b.Exact
+	case MatchTypeRegex:
+		return b.Regex
+	default:
+		return b.Prefix
+	}
+}
+
+// applyPriorityBands gives the matches of s without a priority the band of
+// their type. It reports whether it set any.
+func (s *CustomHTTPRouteSpec) applyPriorityBands(bands MatchPriorityBands) bool {
+	if bands == (MatchPriorityBands{}) {
+		return false
+	}
+	changed := false
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		for j := range rule.Matches {
+			match := &rule.Matches[j]
+			if p := bands.For(match.Type); match.Priority == 0 && p != 0 {
+				match.Priority = p
+				changed = true
+			}
+		}
+		for j := range rule.GRPCMatches {
+			match := &rule.GRPCMatches[j]
+			if p := bands.For(match.PathMatch().Type); match.Priority == 0 && p != 0 {
+				match.Priority = p
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCustomRouterConfigSelectsNamespace(t *testing.T) {
+	all := &CustomRouterConfig{}
+	if ok, err := all.SelectsNamespace(nil); err != nil || !ok {
+		t.Errorf("config without namespaceSelector: got %v, %v, want every namespace", ok, err)
+	}
+
+	web := &CustomRouterConfig{Spec: CustomRouterConfigSpec{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"site": "web"}},
+	}}
+	if ok, _ := web.SelectsNamespace(map[string]string{"site": "web"}); !ok {
+		t.Error("namespace with the selected label not selected")
+	}
+	if ok, _ := web.SelectsNamespace(map[string]string{"site": "api"}); ok {
+		t.Error("namespace without the selected label selected")
+	}
+
+	invalid := &CustomRouterConfig{Spec: CustomRouterConfigSpec{
+		NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "site", Operator: "Matches"},
+		}},
+	}}
+	if _, err := invalid.SelectsNamespace(nil); err == nil {
+		t.Error("expected an error for an invalid namespaceSelector")
+	}
+}
+
+func TestInheritDefaults(t *testing.T) {
+	locales := &CustomRouterConfigSpec{
+		PathPrefixes:           &PathPrefixes{Values: []string{"es", "fr"}, Policy: PathPrefixPolicyOptional},
+		UnmatchedRequestPolicy: UnmatchedRequestNotFound,
+		PriorityBands:          &MatchPriorityBands{Exact: 500},
+	}
+	platform := &CustomRouterConfigSpec{
+		PathPrefixes:    &PathPrefixes{Values: []string{"de"}},
+		DecisionHeaders: DecisionHeadersNever,
+		Precedence:      100,
+		PriorityBands:   &MatchPriorityBands{Exact: 900, Prefix: 300},
+	}
+
+	spec := CustomHTTPRouteSpec{Rules: []Rule{{
+		Matches: []PathMatch{
+			{Path: "/a", Type: MatchTypeExact},
+			{Path: "/b"},
+			{Path: "/c", Type: MatchTypeRegex},
+			{Path: "/d", Type: MatchTypeExact, Priority: 2000},
+		},
+		GRPCMatches: []GRPCMatch{{Service: "pkg.Svc", Method: "Get"}, {Service: "pkg.Svc"}},
+	}}}
+	if !spec.InheritDefaults([]*CustomRouterConfigSpec{locales, platform}) {
+		t.Fatal("InheritDefaults reported no change for an empty spec")
+	}
+	want := CustomHTTPRouteSpec{
+		PathPrefixes:           &PathPrefixes{Values: []string{"es", "fr"}, Policy: PathPrefixPolicyOptional},
+		DecisionHeaders:        DecisionHeadersNever,
+		UnmatchedRequestPolicy: UnmatchedRequestNotFound,
+		Precedence:             100,
+		Rules: []Rule{{
+			Matches: []PathMatch{
+				{Path: "/a", Type: MatchTypeExact, Priority: 500},
+				{Path: "/b", Priority: 300},
+				{Path: "/c", Type: MatchTypeRegex},
+				{Path: "/d", Type: MatchTypeExact, Priority: 2000},
+			},
+			GRPCMatches: []GRPCMatch{
+				{Service: "pkg.Svc", Method: "Get", Priority: 500},
+				{Service: "pkg.Svc", Priority: 300},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("inherited spec = %+v, want %+v", spec, want)
+	}
+	spec.PathPrefixes.Values[0] = "it"
+	if locales.PathPrefixes.Values[0] != "es" {
+		t.Error("the inherited pathPrefixes share the config's values")
+	}
+
+	// Fields the route sets win, a disabled pathPrefixes included, and
+	// spec.defaults.priority wins over the bands.
+	own := CustomHTTPRouteSpec{
+		PathPrefixes:           &PathPrefixes{Policy: PathPrefixPolicyDisabled},
+		DecisionHeaders:        DecisionHeadersAlways,
+		UnmatchedRequestPolicy: UnmatchedRequestPassthrough,
+		Precedence:             10,
+		Defaults:               &RuleDefaults{Priority: 2000},
+		Rules:                  []Rule{{Matches: []PathMatch{{Path: "/a", Type: MatchTypeExact}}}},
+	}
+	before := *own.DeepCopy()
+	if own.InheritDefaults([]*CustomRouterConfigSpec{locales, platform}) {
+		t.Error("InheritDefaults reported a change for a spec setting every field")
+	}
+	if !reflect.DeepEqual(own, before) {
+		t.Errorf("spec setting every field changed: %+v", own)
+	}
+}
+
+func TestRouterConfigResolver(t *testing.T) {
+	configs := []CustomRouterConfig{
+		{ObjectMeta: metav1.ObjectMeta{Name: "web"}, Spec: CustomRouterConfigSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"site": "web"}},
+			Precedence:        20,
+		}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "all"}, Spec: CustomRouterConfigSpec{Precedence: 10}},
+	}
+	lookups := 0
+	resolver := NewRouterConfigResolver(configs, func(namespace string) (map[string]string, error) {
+		lookups++
+		if namespace == "web" {
+			return map[string]string{"site": "web"}, nil
+		}
+		return nil, nil
+	})
+
+	for namespace, want := range map[string]int32{"web": 10, "api": 10} {
+		route := &CustomHTTPRoute{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: namespace}}
+		for range 2 {
+			resolved, err := resolver.Resolve(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resolved.Spec.Precedence != want {
+				t.Errorf("%s: precedence = %d, want %d from the first config by name", namespace, resolved.Spec.Precedence, want)
+			}
+			if route.Spec.Precedence != 0 {
+				t.Errorf("%s: Resolve modified the route", namespace)
+			}
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("namespace labels looked up %d times, want once per namespace", lookups)
+	}
+
+	own := &CustomHTTPRoute{ObjectMeta: metav1.ObjectMeta{Namespace: "web"}, Spec: CustomHTTPRouteSpec{Precedence: 5}}
+	if resolved, _ := resolver.Resolve(own); resolved != own {
+		t.Error("a route inheriting nothing was copied")
+	}
+	if resolved, err := (*RouterConfigResolver)(nil).Resolve(own); err != nil || resolved != own {
+		t.Error("a nil resolver changed the route")
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CustomRouterConfigSpec defines the defaults a CustomRouterConfig gives the
+// CustomHTTPRoutes of the namespaces it selects. Each default only applies
+// to CustomHTTPRoutes that leave the field it defaults unset.
+type CustomRouterConfigSpec struct {
+	// namespaceSelector selects the namespaces whose CustomHTTPRoutes inherit
+	// these defaults. When not specified, every namespace is selected.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// pathPrefixes is the spec.pathPrefixes of CustomHTTPRoutes that set
+	// none, e.g. the locale prefixes of every site of the cluster. A
+	// CustomHTTPRoute opts out by setting its own, such as policy Disabled.
+	// +optional
+	PathPrefixes *PathPrefixes `json:"pathPrefixes,omitempty"`
+
+	// decisionHeaders is the spec.decisionHeaders of CustomHTTPRoutes that
+	// set none. It wins over the ExternalProcessorAttachment setting.
+	// +optional
+	DecisionHeaders DecisionHeadersMode `json:"decisionHeaders,omitempty"`
+
+	// unmatchedRequestPolicy is the spec.unmatchedRequestPolicy of
+	// CustomHTTPRoutes that set none. It wins over the
+	// ExternalProcessorAttachment setting.
+	// +optional
+	UnmatchedRequestPolicy UnmatchedRequestPolicy `json:"unmatchedRequestPolicy,omitempty"`
+
+	// priorityBands are the priorities of the matches of CustomHTTPRoutes
+	// that set none, neither on the match nor in spec.defaults, by match
+	// type, e.g. to keep the routes of team namespaces below those of the
+	// platform. Match types left unset get the operator's --priority-bands.
+	// +optional
+	PriorityBands *MatchPriorityBands `json:"priorityBands,omitempty"`
+
+	// precedence is the spec.precedence of CustomHTTPRoutes that set none
+	// (or 0).
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1000
+	Precedence int32 `json:"precedence,omitempty"`
+}
+
+// MatchPriorityBands are priorities by match type. gRPC matches are Exact
+// matches, or PathPrefix ones without a method.
+type MatchPriorityBands struct {
+	// exact is the priority of Exact matches.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10000
+	Exact int32 `json:"exact,omitempty"`
+
+	// regex is the priority of Regex matches.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10000
+	Regex int32 `json:"regex,omitempty"`
+
+	// prefix is the priority of PathPrefix matches.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10000
+	Prefix int32 `json:"prefix,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CustomRouterConfig is the Schema for the customrouterconfigs API. It
+// declares defaults once for the CustomHTTPRoutes of many namespaces, such
+// as the locale pathPrefixes every team would otherwise copy into each of
+// its routes. The controller resolves them when it expands the routes, so
+// a change to a CustomRouterConfig rebuilds the route tables of every
+// CustomHTTPRoute it selects. When several CustomRouterConfigs select a
+// namespace, each default is taken from the first of them, by name, that
+// sets it.
+type CustomRouterConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// spec defines the defaults of the selected CustomHTTPRoutes
+	// +required
+	Spec CustomRouterConfigSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// CustomRouterConfigList contains a list of CustomRouterConfig
+type CustomRouterConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []CustomRouterConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CustomRouterConfig{}, &CustomRouterConfigList{})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// GatewayNameLabel is the label Istio sets on the Deployment it manages for a
+// Gateway API Gateway, holding the Gateway's name.
+const GatewayNameLabel = "gateway.networking.k8s.io/gateway-name"
+
+// GatewayNamespace returns the namespace of the Gateway named by
+// spec.gatewayRef.name, defaulting to the attachment's own namespace.
+func (a *ExternalProcessorAttachment) GatewayNamespace() string {
+	return a.GatewayRefNamespace(a.Spec.GatewayRef)
+}
+
+// GatewayRefNamespace returns the namespace of the Gateway named by ref, one
+// of the attachment's Gateway references, defaulting to the attachment's own
+// namespace.
+func (a *ExternalProcessorAttachment) GatewayRefNamespace(ref GatewayRef) string {
+	if ref.Namespace != "" {
+		return ref.Namespace
+	}
+	return a.Namespace
+}
+
+// GatewayRefs returns spec.gatewayRef followed by spec.additionalGatewayRefs.
+func (a *ExternalProcessorAttachment) GatewayRefs() []GatewayRef {
+	return append([]GatewayRef{a.Spec.GatewayRef}, a.Spec.AdditionalGatewayRefs...)
+}
+
+// WorkloadSelector returns the labels of the Gateway workload the generated
+// EnvoyFilters select: spec.gatewayRef.selector when set, otherwise the
+// labels the controller resolved from spec.gatewayRef.name into
+// status.gatewaySelector. It is empty until a Gateway reference is resolved.
+func (a *ExternalProcessorAttachment) WorkloadSelector() map[string]string {
+	if len(a.Spec.GatewayRef.Selector) > 0 {
+		return a.Spec.GatewayRef.Selector
+	}
+	return a.Status.GatewaySelector
+}
+
+// WorkloadSelectors returns the labels of every Gateway workload the
+// attachment selects, in the order of GatewayRefs: WorkloadSelector first,
+// then, for each of spec.additionalGatewayRefs, its selector or the labels
+// resolved into status.additionalGatewaySelectors. An entry is empty until
+// its Gateway reference is resolved.
+func (a *ExternalProcessorAttachment) WorkloadSelectors() []map[string]string {
+	selectors := []map[string]string{a.WorkloadSelector()}
+	for i, ref := range a.Spec.AdditionalGatewayRefs {
+		var selector map[string]string
+		switch {
+		case len(ref.Selector) > 0:
+			selector = ref.Selector
+		case i < len(a.Status.AdditionalGatewaySelectors):
+			selector = a.Status.AdditionalGatewaySelectors[i]
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors
+}
+
+// EffectiveProvider returns spec.provider, defaulting to GatewayProviderIstio
+// for objects stored before the field existed.
+func (a *ExternalProcessorAttachment) EffectiveProvider() GatewayProvider {
+	if a.Spec.Provider == "" {
+		return GatewayProviderIstio
+	}
+	return a.Spec.Provider
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExternalProcessorAttachmentWorkloadSelector(t *testing.T) {
+	resolved := map[string]string{"gateway.networking.k8s.io/gateway-name": "public"}
+
+	bySelector := &ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "istio-system"},
+		Spec: ExternalProcessorAttachmentSpec{
+			GatewayRef: GatewayRef{Selector: map[string]string{"istio": "gateway"}},
+		},
+		Status: ExternalProcessorAttachmentStatus{GatewaySelector: resolved},
+	}
+	if got := bySelector.WorkloadSelector(); !reflect.DeepEqual(got, map[string]string{"istio": "gateway"}) {
+		t.Errorf("WorkloadSelector() = %v, want the spec selector", got)
+	}
+
+	byName := &ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "istio-system"},
+		Spec: ExternalProcessorAttachmentSpec{
+			GatewayRef: GatewayRef{Name: "public"},
+		},
+		Status: ExternalProcessorAttachmentStatus{GatewaySelector: resolved},
+	}
+	if got := byName.WorkloadSelector(); !reflect.DeepEqual(got, resolved) {
+		t.Errorf("WorkloadSelector() = %v, want the resolved selector", got)
+	}
+	if got := byName.GatewayNamespace(); got != "istio-system" {
+		t.Errorf("GatewayNamespace() = %q, want the attachment namespace", got)
+	}
+
+	byName.Spec.GatewayRef.Namespace = "gateways"
+	if got := byName.GatewayNamespace(); got != "gateways" {
+		t.Errorf("GatewayNamespace() = %q, want %q", got, "gateways")
+	}
+}
+
+func TestExternalProcessorAttachmentWorkloadSelectors(t *testing.T) {
+	epa := &ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "istio-system"},
+		Spec: ExternalProcessorAttachmentSpec{
+			GatewayRef: GatewayRef{Selector: map[string]string{"istio": "public"}},
+			AdditionalGatewayRefs: []GatewayRef{
+				{Name: "internal", Namespace: "gateways"},
+				{Selector: map[string]string{"istio": "partners"}},
+				{Name: "pending"},
+			},
+		},
+		Status: ExternalProcessorAttachmentStatus{
+			AdditionalGatewaySelectors: []map[string]string{{"gateway.networking.k8s.io/gateway-name": "internal"}},
+		},
+	}
+	want := []map[string]string{
+		{"istio": "public"},
+		{"gateway.networking.k8s.io/gateway-name": "internal"},
+		{"istio": "partners"},
+		nil,
+	}
+	if got := epa.WorkloadSelectors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("WorkloadSelectors() = %v, want %v", got, want)
+	}
+
+	refs := epa.GatewayRefs()
+	if len(refs) != 4 || refs[1].Name != "internal" {
+		t.Fatalf("GatewayRefs() = %v, want gatewayRef followed by the additional refs", refs)
+	}
+	if got := epa.GatewayRefNamespace(refs[1]); got != "gateways" {
+		t.Errorf("GatewayRefNamespace() = %q, want %q", got, "gateways")
+	}
+	if got := epa.GatewayRefNamespace(refs[3]); got != "istio-system" {
+		t.Errorf("GatewayRefNamespace() = %q, want the attachment namespace", got)
+	}
+}
+
+func TestExternalProcessorAttachmentEffectiveProvider(t *testing.T) {
+	epa := &ExternalProcessorAttachment{}
+	if got := epa.EffectiveProvider(); got != GatewayProviderIstio {
+		t.Errorf("EffectiveProvider() = %q, want %q", got, GatewayProviderIstio)
+	}
+	epa.Spec.Provider = GatewayProviderEnvoyGateway
+	if got := epa.EffectiveProvider(); got != GatewayProviderEnvoyGateway {
+		t.Errorf("EffectiveProvider() = %q, want %q", got, GatewayProviderEnvoyGateway)
+	}
+}
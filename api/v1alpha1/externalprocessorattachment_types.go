@@ -20,13 +20,31 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// GatewayRef defines the reference to a Gateway workload by label selector
+// GatewayRef defines the reference to a Gateway workload, either by label
+// selector or by the Gateway API Gateway it serves. Exactly one of selector
+// and name must be set.
+// +kubebuilder:validation:XValidation:rule="has(self.selector) != has(self.name)",message="exactly one of selector and name must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.__namespace__) || has(self.name)",message="namespace requires name"
 type GatewayRef struct {
 	// selector is a set of labels used to identify the Gateway workload.
 	// These labels are used in the EnvoyFilter's workloadSelector.
-	// +required
+	// +optional
 	// +kubebuilder:validation:MinProperties=1
-	Selector map[string]string `json:"selector"`
+	Selector map[string]string `json:"selector,omitempty"`
+
+	// name is the name of a Gateway API Gateway. The controller resolves the
+	// workload labels from the selector of the Deployment Istio manages for
+	// it (labeled gateway.networking.k8s.io/gateway-name=<name>) and reports
+	// them in status.gatewaySelector, or status.additionalGatewaySelectors
+	// for additionalGatewayRefs.
+	// +optional
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name,omitempty"`
+
+	// namespace is the namespace of the Gateway named by name. Defaults to
+	// the namespace of the ExternalProcessorAttachment.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // ServiceRef defines a reference to a Kubernetes Service
@@ -80,6 +98,51 @@ type ExternalProcessorRef struct {
 	// +optional
 	// +kubebuilder:default=false
 	FailureModeAllow bool `json:"failureModeAllow,omitempty"`
+
+	// tls makes the Gateway connect to the external processor over TLS,
+	// for processors serving gRPC with --tls-cert outside a service mesh.
+	// When not specified, the connection is plaintext (or encrypted by the
+	// mesh).
+	// +optional
+	TLS *ExternalProcessorTLS `json:"tls,omitempty"`
+}
+
+// ExternalProcessorTLSMode selects how the Gateway authenticates to the
+// external processor.
+// +kubebuilder:validation:Enum=Simple;Mutual
+type ExternalProcessorTLSMode string
+
+const (
+	// ExternalProcessorTLSSimple verifies the external processor's
+	// certificate without presenting a client certificate.
+	ExternalProcessorTLSSimple ExternalProcessorTLSMode = "Simple"
+
+	// ExternalProcessorTLSMutual also presents the client certificate of
+	// the credential, for processors started with --tls-client-ca.
+	ExternalProcessorTLSMutual ExternalProcessorTLSMode = "Mutual"
+)
+
+// ExternalProcessorTLS configures TLS from the Gateway to the external
+// processor.
+type ExternalProcessorTLS struct {
+	// mode is Simple (verify the processor) or Mutual (also present a client
+	// certificate). Defaults to Simple.
+	// +optional
+	// +kubebuilder:default=Simple
+	Mode ExternalProcessorTLSMode `json:"mode,omitempty"`
+
+	// credentialName is a Secret in the Gateway's namespace, read by the
+	// Gateway through SDS like a Gateway listener credential: ca.crt holds
+	// the CA that signed the processor's certificate, and tls.crt/tls.key
+	// the client certificate presented in Mutual mode.
+	// +required
+	// +kubebuilder:validation:MinLength=1
+	CredentialName string `json:"credentialName"`
+
+	// sni is the server name sent to, and verified against the certificate
+	// of, the external processor. Defaults to <service>.<namespace>.svc.
+	// +optional
+	SNI string `json:"sni,omitempty"`
 }
 
 // RetryPolicyConfig defines the retry policy configuration applied to all
@@ -123,26 +186,229 @@ type RetryPolicyConfig struct {
 }
 
 // CatchAllRouteConfig defines the configuration for the catch-all route
+// +kubebuilder:validation:XValidation:rule="!has(self.excludePaths) || !has(self.listenerProtocol) || self.listenerProtocol != 'TLSPassthrough'",message="excludePaths cannot be used with listenerProtocol TLSPassthrough"
+// +kubebuilder:validation:XValidation:rule="has(self.hostnames) || has(self.hostnameSetSelector)",message="at least one of hostnames and hostnameSetSelector must be set"
 type CatchAllRouteConfig struct {
 	// hostnames is a list of hostnames that the catch-all route should match.
-	// When specified, the catch-all route will only be generated for these hostnames.
-	// If empty, no catch-all route will be generated.
-	// +required
+	// An entry may be a wildcard such as "*.example.com", which Envoy matches
+	// against every subdomain without a virtual host of its own.
+	// +optional
 	// +kubebuilder:validation:MinItems=1
-	Hostnames []string `json:"hostnames"`
+	// +kubebuilder:validation:items:MaxLength=253
+	// +kubebuilder:validation:items:Pattern=`^(\*\.)?[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*(:[0-9]{1,5})?$`
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	// hostnameSetSelector adds the hostnames of the HostnameSets in the
+	// namespace of the ExternalProcessorAttachment whose labels match it, so
+	// a hostname added to a selected set is served without editing the
+	// attachment. An empty selector selects every HostnameSet of the
+	// namespace.
+	// +optional
+	HostnameSetSelector *metav1.LabelSelector `json:"hostnameSetSelector,omitempty"`
 
 	// backendRef defines the default backend service to route unmatched requests to.
 	// This is used when no CustomHTTPRoute matches the request.
 	// +required
 	BackendRef BackendRef `json:"backendRef"`
+
+	// excludePaths lists paths, such as the health checks of the gateway,
+	// that the catch-all virtual host answers before anything else instead
+	// of routing them. It replaces the excludePaths of CustomHTTPRoutes
+	// declaring the same hostnames.
+	// +optional
+	// +listType=map
+	// +listMapKey=path
+	// +kubebuilder:validation:MaxItems=16
+	ExcludePaths []CatchAllExcludePath `json:"excludePaths,omitempty"`
+
+	// listenerProtocol is the protocol of the Gateway listener serving the
+	// hostnames. TLSPassthrough hostnames get a filter chain forwarding TLS
+	// connections with a matching SNI to backendRef, since their traffic
+	// cannot be routed by path. Defaults to HTTP.
+	// +optional
+	// +kubebuilder:default=HTTP
+	ListenerProtocol ListenerProtocol `json:"listenerProtocol,omitempty"`
+}
+
+// RoutingDecisionMatch selects how the generated Envoy routes recognise a
+// request the external processor has routed.
+// +kubebuilder:validation:Enum=Header;Metadata
+type RoutingDecisionMatch string
+
+const (
+	// RoutingDecisionMatchHeader matches on the presence of the
+	// x-customrouter-cluster request header.
+	RoutingDecisionMatchHeader RoutingDecisionMatch = "Header"
+
+	// RoutingDecisionMatchMetadata matches on the routing decision the
+	// external processor emits as Envoy dynamic metadata.
+	RoutingDecisionMatchMetadata RoutingDecisionMatch = "Metadata"
+)
+
+// PathNormalization selects how the external processor normalizes request
+// paths before matching them, so that variants of a path such as //api or
+// /%61pi cannot bypass the routes written for /api. The path is also
+// forwarded normalized; the query string is never touched.
+type PathNormalization struct {
+	// mergeSlashes collapses runs of slashes: //api//v1 is matched, and
+	// forwarded, as /api/v1.
+	// +optional
+	MergeSlashes bool `json:"mergeSlashes,omitempty"`
+
+	// decodeUnreserved decodes percent-encoded unreserved characters
+	// (letters, digits, "-", ".", "_" and "~"): /%61pi is matched, and
+	// forwarded, as /api. Other escapes are kept.
+	// +optional
+	DecodeUnreserved bool `json:"decodeUnreserved,omitempty"`
+
+	// rejectEncodedSlashes answers requests whose path contains an encoded
+	// slash or backslash (%2F, %5C) with 400, since backends disagree on
+	// whether to decode them.
+	// +optional
+	RejectEncodedSlashes bool `json:"rejectEncodedSlashes,omitempty"`
+}
+
+// ClusterNameConfig sets how the Envoy clusters of backends are named, for
+// Gateways whose clusters are not named like Istio's
+// (outbound|<port>||<name>.<namespace>.svc.cluster.local), such as
+// sidecar-less setups or a non-default cluster domain.
+type ClusterNameConfig struct {
+	// template is the cluster name, with the variables {service},
+	// {namespace}, {port}, {subset} (always empty), {domain} and {host}
+	// (<service>.<namespace>.svc.<domain> for a Service, the hostname for an
+	// external backend). It must use {port} and one of {host} and {service}.
+	// Defaults to outbound|{port}|{subset}|{host}.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:XValidation:rule="self.contains('{port}')",message="template must use {port}"
+	// +kubebuilder:validation:XValidation:rule="self.contains('{host}') || self.contains('{service}')",message="template must use {host} or {service}"
+	Template string `json:"template,omitempty"`
+
+	// domain is the cluster domain of Service backends, used in {domain}
+	// and {host}. Defaults to cluster.local.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	Domain string `json:"domain,omitempty"`
+}
+
+// VariantSelector picks the route table variant a request is matched
+// against (see CustomHTTPRoute spec.variant) from a request header or
+// cookie. The header wins when a request carries both.
+// +kubebuilder:validation:XValidation:rule="has(self.header) || has(self.cookie)",message="variantSelector must set header or cookie"
+type VariantSelector struct {
+	// header is the request header carrying the variant name.
+	// +optional
+	// +kubebuilder:validation:MaxLength=256
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9!#$%&'*+.^_|~-]+$`
+	Header string `json:"header,omitempty"`
+
+	// cookie is the cookie carrying the variant name.
+	// +optional
+	// +kubebuilder:validation:MaxLength=256
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9!#$%&'*+.^_|~-]+$`
+	Cookie string `json:"cookie,omitempty"`
 }
 
+// HeaderProcessingMode selects whether the Gateway sends a set of headers
+// to the external processor.
+// +kubebuilder:validation:Enum=Send;Skip
+type HeaderProcessingMode string
+
+const (
+	// HeaderProcessingModeSend sends the headers.
+	HeaderProcessingModeSend HeaderProcessingMode = "Send"
+
+	// HeaderProcessingModeSkip does not send the headers.
+	HeaderProcessingModeSkip HeaderProcessingMode = "Skip"
+)
+
+// BodyProcessingMode selects how the Gateway sends a body to the external
+// processor. The external processor acknowledges body chunks without
+// changing them, so every mode Envoy offers except full duplex streaming is
+// supported.
+// +kubebuilder:validation:Enum=None;Streamed;Buffered;BufferedPartial
+type BodyProcessingMode string
+
+const (
+	// BodyProcessingModeNone does not send the body.
+	BodyProcessingModeNone BodyProcessingMode = "None"
+
+	// BodyProcessingModeStreamed sends the body in chunks as they arrive.
+	BodyProcessingModeStreamed BodyProcessingMode = "Streamed"
+
+	// BodyProcessingModeBuffered buffers the whole body and sends it at once.
+	BodyProcessingModeBuffered BodyProcessingMode = "Buffered"
+
+	// BodyProcessingModeBufferedPartial buffers the body up to the buffer
+	// limit of the Gateway and sends what was buffered.
+	BodyProcessingModeBufferedPartial BodyProcessingMode = "BufferedPartial"
+)
+
+// ProcessingMode selects which parts of a request and its response the
+// Gateway sends to the external processor. Request headers are always sent,
+// since routing depends on them, and trailers never are, since the external
+// processor does not handle them.
+type ProcessingMode struct {
+	// responseHeaderMode is Send or Skip. Routes with an outlier policy ask
+	// for their response headers even when it is Skip. Defaults to Skip.
+	// +optional
+	// +kubebuilder:default=Skip
+	ResponseHeaderMode HeaderProcessingMode `json:"responseHeaderMode,omitempty"`
+
+	// requestBodyMode is None, Streamed, Buffered or BufferedPartial.
+	// Defaults to None.
+	// +optional
+	// +kubebuilder:default=None
+	RequestBodyMode BodyProcessingMode `json:"requestBodyMode,omitempty"`
+
+	// responseBodyMode is None, Streamed, Buffered or BufferedPartial.
+	// Defaults to None.
+	// +optional
+	// +kubebuilder:default=None
+	ResponseBodyMode BodyProcessingMode `json:"responseBodyMode,omitempty"`
+}
+
+// GatewayProvider is the gateway implementation an attachment generates
+// configuration for.
+// +kubebuilder:validation:Enum=istio;envoy-gateway
+type GatewayProvider string
+
+const (
+	// GatewayProviderIstio generates Istio EnvoyFilters.
+	GatewayProviderIstio GatewayProvider = "istio"
+
+	// GatewayProviderEnvoyGateway generates Envoy Gateway
+	// EnvoyExtensionPolicy and EnvoyPatchPolicy resources.
+	GatewayProviderEnvoyGateway GatewayProvider = "envoy-gateway"
+)
+
 // ExternalProcessorAttachmentSpec defines the desired state of ExternalProcessorAttachment
+// +kubebuilder:validation:XValidation:rule="!has(self.provider) || self.provider != 'envoy-gateway' || has(self.gatewayRef.name)",message="provider envoy-gateway requires gatewayRef.name"
+// +kubebuilder:validation:XValidation:rule="!has(self.additionalGatewayRefs) || !has(self.provider) || self.provider == 'istio'",message="additionalGatewayRefs requires provider istio"
 type ExternalProcessorAttachmentSpec struct {
+	// provider is the gateway implementation to generate configuration for:
+	// istio (EnvoyFilters) or envoy-gateway (EnvoyExtensionPolicy and
+	// EnvoyPatchPolicy, targeting the Gateway named by gatewayRef.name).
+	// Defaults to istio.
+	// +optional
+	// +kubebuilder:default=istio
+	Provider GatewayProvider `json:"provider,omitempty"`
+
 	// gatewayRef identifies the Gateway workload to attach the external processor to
 	// +required
 	GatewayRef GatewayRef `json:"gatewayRef"`
 
+	// additionalGatewayRefs attaches the external processor, with the same
+	// routing config, to more Gateway workloads, such as an internal Gateway
+	// serving the routes of the public one. Every generated EnvoyFilter is
+	// repeated for each of them, named after the one for gatewayRef with a
+	// -<n> suffix, n being the position of the Gateway in this list starting
+	// at 1. Only supported with the istio provider.
+	// +optional
+	// +kubebuilder:validation:MaxItems=8
+	AdditionalGatewayRefs []GatewayRef `json:"additionalGatewayRefs,omitempty"`
+
 	// externalProcessorRef identifies the external processor service to use
 	// +required
 	ExternalProcessorRef ExternalProcessorRef `json:"externalProcessorRef"`
@@ -167,6 +433,63 @@ type ExternalProcessorAttachmentSpec struct {
 	// +kubebuilder:default="30s"
 	// +kubebuilder:validation:Pattern=`^[0-9]+(s|ms|m|h)$`
 	RouteTimeout string `json:"routeTimeout,omitempty"`
+
+	// decisionHeaders controls whether the external processor adds its routing
+	// decision headers to requests passing through this Gateway: Always,
+	// Never or OnDebug. CustomHTTPRoutes may override it. When not specified,
+	// the external processor's --decision-headers flag applies.
+	// +optional
+	DecisionHeaders DecisionHeadersMode `json:"decisionHeaders,omitempty"`
+
+	// unmatchedRequestPolicy controls what the external processor does with
+	// requests passing through this Gateway that match no route: Passthrough
+	// lets them reach the Envoy route they would have taken (e.g. the
+	// catch-all backend), 404 and 503 answer them with that status.
+	// CustomHTTPRoutes may override it for their hostnames. When not
+	// specified, the external processor's --unmatched-request-policy flag
+	// applies.
+	// +optional
+	UnmatchedRequestPolicy UnmatchedRequestPolicy `json:"unmatchedRequestPolicy,omitempty"`
+
+	// routingDecisionMatch selects what the generated Envoy routes match on
+	// to recognise a request the external processor has routed. Header
+	// matches on the x-customrouter-cluster header, which a client can send
+	// itself when the listener does not strip it. Metadata matches on the
+	// dynamic metadata the external processor emits under the "customrouter"
+	// namespace, which clients cannot set; it requires Envoy 1.31 or later.
+	// Defaults to Header.
+	// +optional
+	// +kubebuilder:default=Header
+	RoutingDecisionMatch RoutingDecisionMatch `json:"routingDecisionMatch,omitempty"`
+
+	// pathNormalization controls how the external processor normalizes the
+	// paths of requests passing through this Gateway before matching them.
+	// When not specified, the external processor's --path-normalization
+	// flag applies; set it with every option off to disable normalization.
+	// +optional
+	PathNormalization *PathNormalization `json:"pathNormalization,omitempty"`
+
+	// processingMode selects which parts of requests and responses the
+	// Gateway sends to the external processor. When not specified, only the
+	// request headers are sent.
+	// +optional
+	ProcessingMode *ProcessingMode `json:"processingMode,omitempty"`
+
+	// clusterName sets how the clusters of backends are named, both in the
+	// generated Envoy configuration and by the external processor. When not
+	// specified, the external processor's --cluster-name-template and
+	// --cluster-domain flags apply, and the generated configuration uses
+	// Istio's names.
+	// +optional
+	ClusterName *ClusterNameConfig `json:"clusterName,omitempty"`
+
+	// variantSelector selects, per request, the variant of the route tables
+	// of hostnames served by several CustomHTTPRoute variants, e.g. to flip
+	// a hostname between blue and green route sets by header or cookie.
+	// When not specified, the external processor's --variant-header and
+	// --variant-cookie flags apply.
+	// +optional
+	VariantSelector *VariantSelector `json:"variantSelector,omitempty"`
 }
 
 // ExternalProcessorAttachmentStatus defines the observed state of ExternalProcessorAttachment.
@@ -175,6 +498,18 @@ type ExternalProcessorAttachmentStatus struct {
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
+	// gatewaySelector holds the workload labels resolved from
+	// spec.gatewayRef.name, used in the EnvoyFilters' workloadSelector.
+	// Empty when spec.gatewayRef.selector is set.
+	// +optional
+	GatewaySelector map[string]string `json:"gatewaySelector,omitempty"`
+
+	// additionalGatewaySelectors holds, in the order of
+	// spec.additionalGatewayRefs, the workload labels resolved from the name
+	// of each of them. Entries of Gateways referenced by selector are empty.
+	// +optional
+	AdditionalGatewaySelectors []map[string]string `json:"additionalGatewaySelectors,omitempty"`
+
 	// conditions represent the current state of the ExternalProcessorAttachment resource.
 	// +listType=map
 	// +listMapKey=type
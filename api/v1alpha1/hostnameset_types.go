@@ -0,0 +1,68 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HostnameSetSpec defines the hostnames of a HostnameSet.
+type HostnameSetSpec struct {
+	// hostnames is the list of hostnames of the set. An entry may be a
+	// wildcard such as "*.example.com", matching every subdomain of
+	// example.com without a more specific entry of its own.
+	// +required
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=1024
+	// +kubebuilder:validation:items:MaxLength=253
+	// +kubebuilder:validation:items:Pattern=`^(\*\.)?[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*(:[0-9]{1,5})?$`
+	// +listType=set
+	Hostnames []string `json:"hostnames"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// HostnameSet is the Schema for the hostnamesets API. It names a group of
+// hostnames, e.g. every country domain of a site, that
+// ExternalProcessorAttachments in the same namespace select by label as the
+// hostnames of their catchAllRoute, so adding a domain to the set is enough
+// to serve it.
+type HostnameSet struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitzero"`
+
+	// spec defines the hostnames of the set
+	// +required
+	Spec HostnameSetSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// HostnameSetList contains a list of HostnameSet
+type HostnameSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []HostnameSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HostnameSet{}, &HostnameSetList{})
+}
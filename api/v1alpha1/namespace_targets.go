@@ -0,0 +1,108 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// AllowedTargetsAnnotation, set on a Namespace, lists the targetRef names the
+// CustomHTTPRoutes of the namespace may use, comma-separated. It takes
+// precedence over the operator's TargetAllowList; an empty value allows no
+// target.
+const AllowedTargetsAnnotation = "customrouter.freepik.com/allowed-targets"
+
+// AllNamespaces is the TargetAllowList key applying to namespaces without an
+// entry of their own.
+const AllNamespaces = "*"
+
+// TargetAllowList maps a namespace to the targetRef names its CustomHTTPRoutes
+// may use, as set by the operator's --policy-allowed-targets flag. It is the
+// fallback for namespaces without the AllowedTargetsAnnotation.
+type TargetAllowList map[string][]string
+
+// ParseTargetAllowList parses the --policy-allowed-targets flag value:
+// semicolon-separated "namespace=target1,target2" entries, where namespace
+// may be AllNamespaces for the default.
+func ParseTargetAllowList(value string) (TargetAllowList, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	out := make(TargetAllowList)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ns, targets, ok := strings.Cut(entry, "=")
+		ns = strings.TrimSpace(ns)
+		if !ok || ns == "" {
+			return nil, fmt.Errorf("invalid allowed-targets entry %q: expected namespace=target[,target...]", entry)
+		}
+		if _, dup := out[ns]; dup {
+			return nil, fmt.Errorf("duplicate allowed-targets entry for namespace %q", ns)
+		}
+		names := splitTargets(targets)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("allowed-targets entry for namespace %q lists no targets", ns)
+		}
+		out[ns] = names
+	}
+	return out, nil
+}
+
+// AllowedTargets returns the targets the CustomHTTPRoutes of namespace may
+// use, given the annotations of the Namespace, and false when they are
+// unrestricted. The AllowedTargetsAnnotation wins over the namespace's entry
+// in the list, which wins over the AllNamespaces entry.
+func (l TargetAllowList) AllowedTargets(namespace string, annotations map[string]string) ([]string, bool) {
+	if value, ok := annotations[AllowedTargetsAnnotation]; ok {
+		return splitTargets(value), true
+	}
+	if targets, ok := l[namespace]; ok {
+		return targets, true
+	}
+	targets, ok := l[AllNamespaces]
+	return targets, ok
+}
+
+// Allows reports whether the CustomHTTPRoutes of namespace may use target.
+func (l TargetAllowList) Allows(namespace string, annotations map[string]string, target string) bool {
+	allowed, restricted := l.AllowedTargets(namespace, annotations)
+	return !restricted || slices.Contains(allowed, target)
+}
+
+// TargetRestrictionSource names what restricts the targets of a namespace
+// with the given annotations, for error messages.
+func TargetRestrictionSource(annotations map[string]string) string {
+	if _, ok := annotations[AllowedTargetsAnnotation]; ok {
+		return "its " + AllowedTargetsAnnotation + " annotation"
+	}
+	return "--policy-allowed-targets"
+}
+
+func splitTargets(value string) []string {
+	targets := []string{}
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
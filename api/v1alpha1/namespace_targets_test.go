@@ -0,0 +1,83 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTargetAllowList(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    TargetAllowList
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{
+			name:  "namespaces and default",
+			value: "team-a=public, internal; *=public",
+			want:  TargetAllowList{"team-a": {"public", "internal"}, AllNamespaces: {"public"}},
+		},
+		{name: "missing separator", value: "team-a", wantErr: true},
+		{name: "no targets", value: "team-a=", wantErr: true},
+		{name: "duplicate namespace", value: "team-a=x;team-a=y", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTargetAllowList(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTargetAllowList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTargetAllowList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetAllowListAllows(t *testing.T) {
+	list := TargetAllowList{"team-a": {"public"}, AllNamespaces: {"internal"}}
+	tests := []struct {
+		name        string
+		list        TargetAllowList
+		namespace   string
+		annotations map[string]string
+		target      string
+		want        bool
+	}{
+		{"no annotation nor list", nil, "team-a", nil, "web", true},
+		{"listed in the annotation", nil, "team-a", map[string]string{AllowedTargetsAnnotation: "web, api"}, "api", true},
+		{"not listed in the annotation", nil, "team-a", map[string]string{AllowedTargetsAnnotation: "web,api"}, "internal", false},
+		{"empty annotation allows none", nil, "team-a", map[string]string{AllowedTargetsAnnotation: ""}, "web", false},
+		{"namespace entry", list, "team-a", nil, "public", true},
+		{"namespace entry wins over the default", list, "team-a", nil, "internal", false},
+		{"default entry", list, "team-b", nil, "internal", true},
+		{"not in the default entry", list, "team-b", nil, "public", false},
+		{"annotation wins over the list", list, "team-a", map[string]string{AllowedTargetsAnnotation: "internal"}, "internal", true},
+		{"annotation restricts further", list, "team-a", map[string]string{AllowedTargetsAnnotation: "web"}, "public", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.list.Allows(tt.namespace, tt.annotations, tt.target); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -53,6 +53,11 @@ func (in *Action) DeepCopyInto(out *Action) {
 		*out = new(CORSConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(AuthConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Action.
@@ -65,6 +70,47 @@ func (in *Action) DeepCopy() *Action {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthConfig) DeepCopyInto(out *AuthConfig) {
+	*out = *in
+	out.BackendRef = in.BackendRef
+	if in.ForwardHeaders != nil {
+		in, out := &in.ForwardHeaders, &out.ForwardHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UpstreamHeaders != nil {
+		in, out := &in.UpstreamHeaders, &out.UpstreamHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthConfig.
+func (in *AuthConfig) DeepCopy() *AuthConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendFailover) DeepCopyInto(out *BackendFailover) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendFailover.
+func (in *BackendFailover) DeepCopy() *BackendFailover {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendFailover)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackendRef) DeepCopyInto(out *BackendRef) {
 	*out = *in
@@ -119,6 +165,16 @@ func (in *CORSConfig) DeepCopy() *CORSConfig {
 func (in *CatchAllBackendRef) DeepCopyInto(out *CatchAllBackendRef) {
 	*out = *in
 	out.BackendRef = in.BackendRef
+	if in.ExcludePaths != nil {
+		in, out := &in.ExcludePaths, &out.ExcludePaths
+		*out = make([]CatchAllExcludePath, len(*in))
+		copy(*out, *in)
+	}
+	if in.HostnameAutomation != nil {
+		in, out := &in.HostnameAutomation, &out.HostnameAutomation
+		*out = new(HostnameAutomation)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatchAllBackendRef.
@@ -131,6 +187,21 @@ func (in *CatchAllBackendRef) DeepCopy() *CatchAllBackendRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CatchAllExcludePath) DeepCopyInto(out *CatchAllExcludePath) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatchAllExcludePath.
+func (in *CatchAllExcludePath) DeepCopy() *CatchAllExcludePath {
+	if in == nil {
+		return nil
+	}
+	out := new(CatchAllExcludePath)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CatchAllRouteConfig) DeepCopyInto(out *CatchAllRouteConfig) {
 	*out = *in
@@ -139,7 +210,17 @@ func (in *CatchAllRouteConfig) DeepCopyInto(out *CatchAllRouteConfig) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.HostnameSetSelector != nil {
+		in, out := &in.HostnameSetSelector, &out.HostnameSetSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	out.BackendRef = in.BackendRef
+	if in.ExcludePaths != nil {
+		in, out := &in.ExcludePaths, &out.ExcludePaths
+		*out = make([]CatchAllExcludePath, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CatchAllRouteConfig.
@@ -152,6 +233,21 @@ func (in *CatchAllRouteConfig) DeepCopy() *CatchAllRouteConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterNameConfig) DeepCopyInto(out *ClusterNameConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterNameConfig.
+func (in *ClusterNameConfig) DeepCopy() *ClusterNameConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterNameConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CustomHTTPRoute) DeepCopyInto(out *CustomHTTPRoute) {
 	*out = *in
@@ -220,6 +316,11 @@ func (in *CustomHTTPRouteSpec) DeepCopyInto(out *CustomHTTPRouteSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.HostnameAliases != nil {
+		in, out := &in.HostnameAliases, &out.HostnameAliases
+		*out = make([]HostnameAlias, len(*in))
+		copy(*out, *in)
+	}
 	if in.PathPrefixes != nil {
 		in, out := &in.PathPrefixes, &out.PathPrefixes
 		*out = new(PathPrefixes)
@@ -228,8 +329,33 @@ func (in *CustomHTTPRouteSpec) DeepCopyInto(out *CustomHTTPRouteSpec) {
 	if in.CatchAllRoute != nil {
 		in, out := &in.CatchAllRoute, &out.CatchAllRoute
 		*out = new(CatchAllBackendRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OverrideHeader != nil {
+		in, out := &in.OverrideHeader, &out.OverrideHeader
+		*out = new(OverrideHeader)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ScrubHeaders != nil {
+		in, out := &in.ScrubHeaders, &out.ScrubHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
 		**out = **in
 	}
+	if in.Maintenance != nil {
+		in, out := &in.Maintenance, &out.Maintenance
+		*out = new(Maintenance)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Defaults != nil {
+		in, out := &in.Defaults, &out.Defaults
+		*out = new(RuleDefaults)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Rules != nil {
 		in, out := &in.Rules, &out.Rules
 		*out = make([]Rule, len(*in))
@@ -252,6 +378,11 @@ func (in *CustomHTTPRouteSpec) DeepCopy() *CustomHTTPRouteSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CustomHTTPRouteStatus) DeepCopyInto(out *CustomHTTPRouteStatus) {
 	*out = *in
+	if in.Warnings != nil {
+		in, out := &in.Warnings, &out.Warnings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -271,6 +402,94 @@ func (in *CustomHTTPRouteStatus) DeepCopy() *CustomHTTPRouteStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomRouterConfig) DeepCopyInto(out *CustomRouterConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomRouterConfig.
+func (in *CustomRouterConfig) DeepCopy() *CustomRouterConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomRouterConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CustomRouterConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomRouterConfigList) DeepCopyInto(out *CustomRouterConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CustomRouterConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomRouterConfigList.
+func (in *CustomRouterConfigList) DeepCopy() *CustomRouterConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomRouterConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CustomRouterConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomRouterConfigSpec) DeepCopyInto(out *CustomRouterConfigSpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PathPrefixes != nil {
+		in, out := &in.PathPrefixes, &out.PathPrefixes
+		*out = new(PathPrefixes)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PriorityBands != nil {
+		in, out := &in.PriorityBands, &out.PriorityBands
+		*out = new(MatchPriorityBands)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomRouterConfigSpec.
+func (in *CustomRouterConfigSpec) DeepCopy() *CustomRouterConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomRouterConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExternalProcessorAttachment) DeepCopyInto(out *ExternalProcessorAttachment) {
 	*out = *in
@@ -334,7 +553,14 @@ func (in *ExternalProcessorAttachmentList) DeepCopyObject() runtime.Object {
 func (in *ExternalProcessorAttachmentSpec) DeepCopyInto(out *ExternalProcessorAttachmentSpec) {
 	*out = *in
 	in.GatewayRef.DeepCopyInto(&out.GatewayRef)
-	out.ExternalProcessorRef = in.ExternalProcessorRef
+	if in.AdditionalGatewayRefs != nil {
+		in, out := &in.AdditionalGatewayRefs, &out.AdditionalGatewayRefs
+		*out = make([]GatewayRef, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.ExternalProcessorRef.DeepCopyInto(&out.ExternalProcessorRef)
 	if in.CatchAllRoute != nil {
 		in, out := &in.CatchAllRoute, &out.CatchAllRoute
 		*out = new(CatchAllRouteConfig)
@@ -345,6 +571,26 @@ func (in *ExternalProcessorAttachmentSpec) DeepCopyInto(out *ExternalProcessorAt
 		*out = new(RetryPolicyConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.PathNormalization != nil {
+		in, out := &in.PathNormalization, &out.PathNormalization
+		*out = new(PathNormalization)
+		**out = **in
+	}
+	if in.ProcessingMode != nil {
+		in, out := &in.ProcessingMode, &out.ProcessingMode
+		*out = new(ProcessingMode)
+		**out = **in
+	}
+	if in.ClusterName != nil {
+		in, out := &in.ClusterName, &out.ClusterName
+		*out = new(ClusterNameConfig)
+		**out = **in
+	}
+	if in.VariantSelector != nil {
+		in, out := &in.VariantSelector, &out.VariantSelector
+		*out = new(VariantSelector)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalProcessorAttachmentSpec.
@@ -360,6 +606,26 @@ func (in *ExternalProcessorAttachmentSpec) DeepCopy() *ExternalProcessorAttachme
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExternalProcessorAttachmentStatus) DeepCopyInto(out *ExternalProcessorAttachmentStatus) {
 	*out = *in
+	if in.GatewaySelector != nil {
+		in, out := &in.GatewaySelector, &out.GatewaySelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AdditionalGatewaySelectors != nil {
+		in, out := &in.AdditionalGatewaySelectors, &out.AdditionalGatewaySelectors
+		*out = make([]map[string]string, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = make(map[string]string, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+		}
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -383,6 +649,11 @@ func (in *ExternalProcessorAttachmentStatus) DeepCopy() *ExternalProcessorAttach
 func (in *ExternalProcessorRef) DeepCopyInto(out *ExternalProcessorRef) {
 	*out = *in
 	out.Service = in.Service
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(ExternalProcessorTLS)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalProcessorRef.
@@ -395,6 +666,56 @@ func (in *ExternalProcessorRef) DeepCopy() *ExternalProcessorRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalProcessorTLS) DeepCopyInto(out *ExternalProcessorTLS) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalProcessorTLS.
+func (in *ExternalProcessorTLS) DeepCopy() *ExternalProcessorTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalProcessorTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Fraction) DeepCopyInto(out *Fraction) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Fraction.
+func (in *Fraction) DeepCopy() *Fraction {
+	if in == nil {
+		return nil
+	}
+	out := new(Fraction)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GRPCMatch) DeepCopyInto(out *GRPCMatch) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]HeaderMatch, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GRPCMatch.
+func (in *GRPCMatch) DeepCopy() *GRPCMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(GRPCMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayRef) DeepCopyInto(out *GatewayRef) {
 	*out = *in
@@ -417,6 +738,41 @@ func (in *GatewayRef) DeepCopy() *GatewayRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashPolicy) DeepCopyInto(out *HashPolicy) {
+	*out = *in
+	if in.Cookie != nil {
+		in, out := &in.Cookie, &out.Cookie
+		*out = new(HashPolicyCookie)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashPolicy.
+func (in *HashPolicy) DeepCopy() *HashPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(HashPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HashPolicyCookie) DeepCopyInto(out *HashPolicyCookie) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HashPolicyCookie.
+func (in *HashPolicyCookie) DeepCopy() *HashPolicyCookie {
+	if in == nil {
+		return nil
+	}
+	out := new(HashPolicyCookie)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HeaderConfig) DeepCopyInto(out *HeaderConfig) {
 	*out = *in
@@ -447,6 +803,217 @@ func (in *HeaderMatch) DeepCopy() *HeaderMatch {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostnameAlias) DeepCopyInto(out *HostnameAlias) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostnameAlias.
+func (in *HostnameAlias) DeepCopy() *HostnameAlias {
+	if in == nil {
+		return nil
+	}
+	out := new(HostnameAlias)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostnameAutomation) DeepCopyInto(out *HostnameAutomation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostnameAutomation.
+func (in *HostnameAutomation) DeepCopy() *HostnameAutomation {
+	if in == nil {
+		return nil
+	}
+	out := new(HostnameAutomation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostnameSet) DeepCopyInto(out *HostnameSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostnameSet.
+func (in *HostnameSet) DeepCopy() *HostnameSet {
+	if in == nil {
+		return nil
+	}
+	out := new(HostnameSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *HostnameSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostnameSetList) DeepCopyInto(out *HostnameSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]HostnameSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostnameSetList.
+func (in *HostnameSetList) DeepCopy() *HostnameSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(HostnameSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *HostnameSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostnameSetSpec) DeepCopyInto(out *HostnameSetSpec) {
+	*out = *in
+	if in.Hostnames != nil {
+		in, out := &in.Hostnames, &out.Hostnames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostnameSetSpec.
+func (in *HostnameSetSpec) DeepCopy() *HostnameSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HostnameSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Maintenance) DeepCopyInto(out *Maintenance) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Start != nil {
+		in, out := &in.Start, &out.Start
+		*out = (*in).DeepCopy()
+	}
+	if in.End != nil {
+		in, out := &in.End, &out.End
+		*out = (*in).DeepCopy()
+	}
+	if in.Hostnames != nil {
+		in, out := &in.Hostnames, &out.Hostnames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RetryAfterSeconds != nil {
+		in, out := &in.RetryAfterSeconds, &out.RetryAfterSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Bypass != nil {
+		in, out := &in.Bypass, &out.Bypass
+		*out = new(MaintenanceBypass)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Maintenance.
+func (in *Maintenance) DeepCopy() *Maintenance {
+	if in == nil {
+		return nil
+	}
+	out := new(Maintenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceBypass) DeepCopyInto(out *MaintenanceBypass) {
+	*out = *in
+	if in.SourceCIDRs != nil {
+		in, out := &in.SourceCIDRs, &out.SourceCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(MaintenanceBypassHeader)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceBypass.
+func (in *MaintenanceBypass) DeepCopy() *MaintenanceBypass {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceBypass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceBypassHeader) DeepCopyInto(out *MaintenanceBypassHeader) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceBypassHeader.
+func (in *MaintenanceBypassHeader) DeepCopy() *MaintenanceBypassHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceBypassHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MatchPriorityBands) DeepCopyInto(out *MatchPriorityBands) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MatchPriorityBands.
+func (in *MatchPriorityBands) DeepCopy() *MatchPriorityBands {
+	if in == nil {
+		return nil
+	}
+	out := new(MatchPriorityBands)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MirrorConfig) DeepCopyInto(out *MirrorConfig) {
 	*out = *in
@@ -468,6 +1035,42 @@ func (in *MirrorConfig) DeepCopy() *MirrorConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutlierPolicy) DeepCopyInto(out *OutlierPolicy) {
+	*out = *in
+	out.FallbackBackendRef = in.FallbackBackendRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutlierPolicy.
+func (in *OutlierPolicy) DeepCopy() *OutlierPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(OutlierPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OverrideHeader) DeepCopyInto(out *OverrideHeader) {
+	*out = *in
+	if in.Variants != nil {
+		in, out := &in.Variants, &out.Variants
+		*out = make([]RouteVariant, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OverrideHeader.
+func (in *OverrideHeader) DeepCopy() *OverrideHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(OverrideHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PathMatch) DeepCopyInto(out *PathMatch) {
 	*out = *in
@@ -481,6 +1084,11 @@ func (in *PathMatch) DeepCopyInto(out *PathMatch) {
 		*out = make([]QueryParamMatch, len(*in))
 		copy(*out, *in)
 	}
+	if in.Fraction != nil {
+		in, out := &in.Fraction, &out.Fraction
+		*out = new(Fraction)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PathMatch.
@@ -493,6 +1101,21 @@ func (in *PathMatch) DeepCopy() *PathMatch {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PathNormalization) DeepCopyInto(out *PathNormalization) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PathNormalization.
+func (in *PathNormalization) DeepCopy() *PathNormalization {
+	if in == nil {
+		return nil
+	}
+	out := new(PathNormalization)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PathPrefixes) DeepCopyInto(out *PathPrefixes) {
 	*out = *in
@@ -518,6 +1141,21 @@ func (in *PathPrefixes) DeepCopy() *PathPrefixes {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProcessingMode) DeepCopyInto(out *ProcessingMode) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProcessingMode.
+func (in *ProcessingMode) DeepCopy() *ProcessingMode {
+	if in == nil {
+		return nil
+	}
+	out := new(ProcessingMode)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QueryParamMatch) DeepCopyInto(out *QueryParamMatch) {
 	*out = *in
@@ -546,6 +1184,11 @@ func (in *RedirectConfig) DeepCopyInto(out *RedirectConfig) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.PreservePort != nil {
+		in, out := &in.PreservePort, &out.PreservePort
+		*out = new(bool)
+		**out = **in
+	}
 	if in.PreservePrefix != nil {
 		in, out := &in.PreservePrefix, &out.PreservePrefix
 		*out = new(bool)
@@ -586,6 +1229,13 @@ func (in *RetryPolicyConfig) DeepCopy() *RetryPolicyConfig {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RewriteConfig) DeepCopyInto(out *RewriteConfig) {
 	*out = *in
+	if in.Segments != nil {
+		in, out := &in.Segments, &out.Segments
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.ReplacePrefixMatch != nil {
 		in, out := &in.ReplacePrefixMatch, &out.ReplacePrefixMatch
 		*out = new(bool)
@@ -608,6 +1258,22 @@ func (in *RewriteConfig) DeepCopy() *RewriteConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteVariant) DeepCopyInto(out *RouteVariant) {
+	*out = *in
+	out.BackendRef = in.BackendRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteVariant.
+func (in *RouteVariant) DeepCopy() *RouteVariant {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteVariant)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Rule) DeepCopyInto(out *Rule) {
 	*out = *in
@@ -618,6 +1284,13 @@ func (in *Rule) DeepCopyInto(out *Rule) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.GRPCMatches != nil {
+		in, out := &in.GRPCMatches, &out.GRPCMatches
+		*out = make([]GRPCMatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Actions != nil {
 		in, out := &in.Actions, &out.Actions
 		*out = make([]Action, len(*in))
@@ -635,6 +1308,35 @@ func (in *Rule) DeepCopyInto(out *Rule) {
 		*out = new(RulePathPrefixes)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.OutlierPolicy != nil {
+		in, out := &in.OutlierPolicy, &out.OutlierPolicy
+		*out = new(OutlierPolicy)
+		**out = **in
+	}
+	if in.BackendFailover != nil {
+		in, out := &in.BackendFailover, &out.BackendFailover
+		*out = new(BackendFailover)
+		**out = **in
+	}
+	if in.HashPolicy != nil {
+		in, out := &in.HashPolicy, &out.HashPolicy
+		*out = new(HashPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxRequestBytes != nil {
+		in, out := &in.MaxRequestBytes, &out.MaxRequestBytes
+		*out = new(int64)
+		**out = **in
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Rule.
@@ -647,6 +1349,33 @@ func (in *Rule) DeepCopy() *Rule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RuleDefaults) DeepCopyInto(out *RuleDefaults) {
+	*out = *in
+	if in.Actions != nil {
+		in, out := &in.Actions, &out.Actions
+		*out = make([]Action, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BackendRefs != nil {
+		in, out := &in.BackendRefs, &out.BackendRefs
+		*out = make([]BackendRef, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuleDefaults.
+func (in *RuleDefaults) DeepCopy() *RuleDefaults {
+	if in == nil {
+		return nil
+	}
+	out := new(RuleDefaults)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RulePathPrefixes) DeepCopyInto(out *RulePathPrefixes) {
 	*out = *in
@@ -696,3 +1425,18 @@ func (in *TargetRef) DeepCopy() *TargetRef {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VariantSelector) DeepCopyInto(out *VariantSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VariantSelector.
+func (in *VariantSelector) DeepCopy() *VariantSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(VariantSelector)
+	in.DeepCopyInto(out)
+	return out
+}
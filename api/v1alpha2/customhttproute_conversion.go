@@ -0,0 +1,485 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// ConvertTo converts this CustomHTTPRoute to the v1alpha1 hub version.
+// It fails when a *-remove action carries a header value, which v1alpha1
+// has no field for.
+func (r *CustomHTTPRoute) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1alpha1.CustomHTTPRoute)
+	if !ok {
+		return fmt.Errorf("expected *v1alpha1.CustomHTTPRoute, got %T", dstRaw)
+	}
+	src := r.DeepCopy()
+
+	dst.ObjectMeta = src.ObjectMeta
+	dst.Status = v1alpha1.CustomHTTPRouteStatus(src.Status)
+
+	rules := make([]v1alpha1.Rule, 0, len(src.Spec.Rules))
+	for i := range src.Spec.Rules {
+		rule, err := convertRuleToHub(&src.Spec.Rules[i])
+		if err != nil {
+			return fmt.Errorf("spec.rules[%d]: %w", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	if src.Spec.Rules == nil {
+		rules = nil
+	}
+
+	dst.Spec = v1alpha1.CustomHTTPRouteSpec{
+		TargetRef:              v1alpha1.TargetRef(src.Spec.TargetRef),
+		Hostnames:              src.Spec.Hostnames,
+		DecisionHeaders:        v1alpha1.DecisionHeadersMode(src.Spec.DecisionHeaders),
+		ScrubHeaders:           src.Spec.ScrubHeaders,
+		UnmatchedRequestPolicy: v1alpha1.UnmatchedRequestPolicy(src.Spec.UnmatchedRequestPolicy),
+		Precedence:             src.Spec.Precedence,
+		Enabled:                src.Spec.Enabled,
+		DeletionDrainSeconds:   src.Spec.DeletionDrainSeconds,
+		Variant:                src.Spec.Variant,
+		Description:            src.Spec.Description,
+		Owner:                  src.Spec.Owner,
+		Rules:                  rules,
+	}
+	dst.Spec.HostnameAliases = convertSlice(src.Spec.HostnameAliases, func(a HostnameAlias) v1alpha1.HostnameAlias {
+		return v1alpha1.HostnameAlias(a)
+	})
+	if m := src.Spec.Maintenance; m != nil {
+		dst.Spec.Maintenance = &v1alpha1.Maintenance{
+			Enabled:           m.Enabled,
+			Start:             m.Start,
+			End:               m.End,
+			Hostnames:         m.Hostnames,
+			Paths:             m.Paths,
+			StatusCode:        m.StatusCode,
+			RetryAfterSeconds: m.RetryAfterSeconds,
+			ContentType:       m.ContentType,
+			Body:              m.Body,
+		}
+		if b := m.Bypass; b != nil {
+			dst.Spec.Maintenance.Bypass = &v1alpha1.MaintenanceBypass{
+				SourceCIDRs: b.SourceCIDRs,
+				Header:      (*v1alpha1.MaintenanceBypassHeader)(b.Header),
+			}
+		}
+	}
+	if p := src.Spec.PathPrefixes; p != nil {
+		dst.Spec.PathPrefixes = &v1alpha1.PathPrefixes{
+			Values:           p.Values,
+			Policy:           v1alpha1.PathPrefixPolicy(p.Policy),
+			ExpandMatchTypes: convertSlice(p.ExpandMatchTypes, castString[MatchType, v1alpha1.MatchType]),
+		}
+	}
+	if c := src.Spec.CatchAllRoute; c != nil {
+		dst.Spec.CatchAllRoute = &v1alpha1.CatchAllBackendRef{
+			BackendRef:         v1alpha1.BackendRef(c.BackendRef),
+			ExcludePaths:       convertSlice(c.ExcludePaths, convertCatchAllExcludePathToHub),
+			ListenerProtocol:   v1alpha1.ListenerProtocol(c.ListenerProtocol),
+			HostnameAutomation: (*v1alpha1.HostnameAutomation)(c.HostnameAutomation),
+		}
+	}
+	if d := src.Spec.Defaults; d != nil {
+		defaults, err := convertDefaultsToHub(d)
+		if err != nil {
+			return fmt.Errorf("spec.defaults: %w", err)
+		}
+		dst.Spec.Defaults = defaults
+	}
+	if o := src.Spec.OverrideHeader; o != nil {
+		dst.Spec.OverrideHeader = &v1alpha1.OverrideHeader{
+			Name: o.Name,
+			Variants: convertSlice(o.Variants, func(v RouteVariant) v1alpha1.RouteVariant {
+				return v1alpha1.RouteVariant{Name: v.Name, BackendRef: v1alpha1.BackendRef(v.BackendRef)}
+			}),
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1alpha1 hub version to this CustomHTTPRoute.
+// The v1alpha1 headerName is kept only for the *-remove actions that read
+// it; on other action types it was ignored and does not survive conversion.
+func (r *CustomHTTPRoute) ConvertFrom(srcRaw conversion.Hub) error {
+	hub, ok := srcRaw.(*v1alpha1.CustomHTTPRoute)
+	if !ok {
+		return fmt.Errorf("expected *v1alpha1.CustomHTTPRoute, got %T", srcRaw)
+	}
+	src := hub.DeepCopy()
+
+	r.ObjectMeta = src.ObjectMeta
+	r.Status = CustomHTTPRouteStatus(src.Status)
+
+	r.Spec = CustomHTTPRouteSpec{
+		TargetRef:              TargetRef(src.Spec.TargetRef),
+		Hostnames:              src.Spec.Hostnames,
+		DecisionHeaders:        DecisionHeadersMode(src.Spec.DecisionHeaders),
+		ScrubHeaders:           src.Spec.ScrubHeaders,
+		UnmatchedRequestPolicy: UnmatchedRequestPolicy(src.Spec.UnmatchedRequestPolicy),
+		Precedence:             src.Spec.Precedence,
+		Enabled:                src.Spec.Enabled,
+		DeletionDrainSeconds:   src.Spec.DeletionDrainSeconds,
+		Variant:                src.Spec.Variant,
+		Description:            src.Spec.Description,
+		Owner:                  src.Spec.Owner,
+		Rules:                  convertSlice(src.Spec.Rules, convertRuleFromHub),
+	}
+	r.Spec.HostnameAliases = convertSlice(src.Spec.HostnameAliases, func(a v1alpha1.HostnameAlias) HostnameAlias {
+		return HostnameAlias(a)
+	})
+	if m := src.Spec.Maintenance; m != nil {
+		r.Spec.Maintenance = &Maintenance{
+			Enabled:           m.Enabled,
+			Start:             m.Start,
+			End:               m.End,
+			Hostnames:         m.Hostnames,
+			Paths:             m.Paths,
+			StatusCode:        m.StatusCode,
+			RetryAfterSeconds: m.RetryAfterSeconds,
+			ContentType:       m.ContentType,
+			Body:              m.Body,
+		}
+		if b := m.Bypass; b != nil {
+			r.Spec.Maintenance.Bypass = &MaintenanceBypass{
+				SourceCIDRs: b.SourceCIDRs,
+				Header:      (*MaintenanceBypassHeader)(b.Header),
+			}
+		}
+	}
+	if p := src.Spec.PathPrefixes; p != nil {
+		r.Spec.PathPrefixes = &PathPrefixes{
+			Values:           p.Values,
+			Policy:           PathPrefixPolicy(p.Policy),
+			ExpandMatchTypes: convertSlice(p.ExpandMatchTypes, castString[v1alpha1.MatchType, MatchType]),
+		}
+	}
+	if c := src.Spec.CatchAllRoute; c != nil {
+		r.Spec.CatchAllRoute = &CatchAllBackendRef{
+			BackendRef:         BackendRef(c.BackendRef),
+			ExcludePaths:       convertSlice(c.ExcludePaths, convertCatchAllExcludePathFromHub),
+			ListenerProtocol:   ListenerProtocol(c.ListenerProtocol),
+			HostnameAutomation: (*HostnameAutomation)(c.HostnameAutomation),
+		}
+	}
+	if d := src.Spec.Defaults; d != nil {
+		r.Spec.Defaults = &RuleDefaults{
+			Actions:     convertSlice(d.Actions, convertActionFromHub),
+			BackendRefs: convertSlice(d.BackendRefs, castBackendRef[v1alpha1.BackendRef, BackendRef]),
+			Priority:    d.Priority,
+		}
+	}
+	if o := src.Spec.OverrideHeader; o != nil {
+		r.Spec.OverrideHeader = &OverrideHeader{
+			Name: o.Name,
+			Variants: convertSlice(o.Variants, func(v v1alpha1.RouteVariant) RouteVariant {
+				return RouteVariant{Name: v.Name, BackendRef: BackendRef(v.BackendRef)}
+			}),
+		}
+	}
+	return nil
+}
+
+func convertDefaultsToHub(in *RuleDefaults) (*v1alpha1.RuleDefaults, error) {
+	actions, err := convertActionsToHub(in.Actions)
+	if err != nil {
+		return nil, err
+	}
+	return &v1alpha1.RuleDefaults{
+		Actions:     actions,
+		BackendRefs: convertSlice(in.BackendRefs, castBackendRef[BackendRef, v1alpha1.BackendRef]),
+		Priority:    in.Priority,
+	}, nil
+}
+
+func convertRuleToHub(in *Rule) (v1alpha1.Rule, error) {
+	out := v1alpha1.Rule{
+		Matches: convertSlice(in.Matches, func(m RouteMatch) v1alpha1.PathMatch {
+			return v1alpha1.PathMatch{
+				Path:            m.Path,
+				Type:            v1alpha1.MatchType(m.Type),
+				CaseInsensitive: m.CaseInsensitive,
+				Method:          v1alpha1.HTTPMethod(m.Method),
+				Scheme:          v1alpha1.RequestScheme(m.Scheme),
+				Headers:         convertSlice(m.Headers, convertHeaderMatchToHub),
+				QueryParams:     convertSlice(m.QueryParams, convertQueryParamMatchToHub),
+				Fraction:        (*v1alpha1.Fraction)(m.Fraction),
+				Priority:        m.Priority,
+			}
+		}),
+		GRPCMatches: convertSlice(in.GRPCMatches, func(m GRPCMatch) v1alpha1.GRPCMatch {
+			return v1alpha1.GRPCMatch{
+				Service:  m.Service,
+				Method:   m.Method,
+				Headers:  convertSlice(m.Headers, convertHeaderMatchToHub),
+				Priority: m.Priority,
+			}
+		}),
+		BackendRefs:     convertSlice(in.BackendRefs, castBackendRef[BackendRef, v1alpha1.BackendRef]),
+		AllowOverlap:    in.AllowOverlap,
+		ProtocolHints:   v1alpha1.ProtocolHint(in.ProtocolHint),
+		ActionOrder:     v1alpha1.ActionOrder(in.ActionOrder),
+		MaxRequestBytes: in.MaxRequestBytes,
+		ExpiresAt:       in.ExpiresAt,
+		Enabled:         in.Enabled,
+		Description:     in.Description,
+		Owner:           in.Owner,
+	}
+	if p := in.PathPrefixes; p != nil {
+		out.PathPrefixes = &v1alpha1.RulePathPrefixes{
+			Policy:           v1alpha1.PathPrefixPolicy(p.Policy),
+			ExpandMatchTypes: convertSlice(p.ExpandMatchTypes, castString[MatchType, v1alpha1.MatchType]),
+		}
+	}
+	if o := in.OutlierPolicy; o != nil {
+		out.OutlierPolicy = &v1alpha1.OutlierPolicy{
+			FallbackBackendRef: v1alpha1.BackendRef(o.FallbackBackendRef),
+			ErrorRatePercent:   o.ErrorRatePercent,
+			MinRequests:        o.MinRequests,
+			Interval:           o.Interval,
+			EjectionTime:       o.EjectionTime,
+		}
+	}
+	if f := in.BackendFailover; f != nil {
+		out.BackendFailover = &v1alpha1.BackendFailover{
+			HealthSignal:     v1alpha1.BackendHealthSignal(f.HealthSignal),
+			ErrorRatePercent: f.ErrorRatePercent,
+			MinRequests:      f.MinRequests,
+			Interval:         f.Interval,
+			EjectionTime:     f.EjectionTime,
+		}
+	}
+	if h := in.HashPolicy; h != nil {
+		out.HashPolicy = &v1alpha1.HashPolicy{
+			Header: h.Header,
+			Cookie: (*v1alpha1.HashPolicyCookie)(h.Cookie),
+		}
+	}
+	actions, err := convertActionsToHub(in.Actions)
+	if err != nil {
+		return v1alpha1.Rule{}, err
+	}
+	out.Actions = actions
+	return out, nil
+}
+
+func convertActionsToHub(in []Action) ([]v1alpha1.Action, error) {
+	if in == nil {
+		return nil, nil
+	}
+	out := make([]v1alpha1.Action, 0, len(in))
+	for i := range in {
+		action, err := convertActionToHub(&in[i])
+		if err != nil {
+			return nil, fmt.Errorf("actions[%d]: %w", i, err)
+		}
+		out = append(out, action)
+	}
+	return out, nil
+}
+
+func convertRuleFromHub(in v1alpha1.Rule) Rule {
+	out := Rule{
+		Matches: convertSlice(in.Matches, func(m v1alpha1.PathMatch) RouteMatch {
+			return RouteMatch{
+				Path:            m.Path,
+				Type:            MatchType(m.Type),
+				CaseInsensitive: m.CaseInsensitive,
+				Method:          HTTPMethod(m.Method),
+				Scheme:          RequestScheme(m.Scheme),
+				Headers:         convertSlice(m.Headers, convertHeaderMatchFromHub),
+				QueryParams:     convertSlice(m.QueryParams, convertQueryParamMatchFromHub),
+				Fraction:        (*Fraction)(m.Fraction),
+				Priority:        m.Priority,
+			}
+		}),
+		GRPCMatches: convertSlice(in.GRPCMatches, func(m v1alpha1.GRPCMatch) GRPCMatch {
+			return GRPCMatch{
+				Service:  m.Service,
+				Method:   m.Method,
+				Headers:  convertSlice(m.Headers, convertHeaderMatchFromHub),
+				Priority: m.Priority,
+			}
+		}),
+		Actions:         convertSlice(in.Actions, convertActionFromHub),
+		BackendRefs:     convertSlice(in.BackendRefs, castBackendRef[v1alpha1.BackendRef, BackendRef]),
+		AllowOverlap:    in.AllowOverlap,
+		ProtocolHint:    ProtocolHint(in.ProtocolHints),
+		ActionOrder:     ActionOrder(in.ActionOrder),
+		MaxRequestBytes: in.MaxRequestBytes,
+		ExpiresAt:       in.ExpiresAt,
+		Enabled:         in.Enabled,
+		Description:     in.Description,
+		Owner:           in.Owner,
+	}
+	if p := in.PathPrefixes; p != nil {
+		out.PathPrefixes = &RulePathPrefixes{
+			Policy:           PathPrefixPolicy(p.Policy),
+			ExpandMatchTypes: convertSlice(p.ExpandMatchTypes, castString[v1alpha1.MatchType, MatchType]),
+		}
+	}
+	if o := in.OutlierPolicy; o != nil {
+		out.OutlierPolicy = &OutlierPolicy{
+			FallbackBackendRef: BackendRef(o.FallbackBackendRef),
+			ErrorRatePercent:   o.ErrorRatePercent,
+			MinRequests:        o.MinRequests,
+			Interval:           o.Interval,
+			EjectionTime:       o.EjectionTime,
+		}
+	}
+	if f := in.BackendFailover; f != nil {
+		out.BackendFailover = &BackendFailover{
+			HealthSignal:     BackendHealthSignal(f.HealthSignal),
+			ErrorRatePercent: f.ErrorRatePercent,
+			MinRequests:      f.MinRequests,
+			Interval:         f.Interval,
+			EjectionTime:     f.EjectionTime,
+		}
+	}
+	if h := in.HashPolicy; h != nil {
+		out.HashPolicy = &HashPolicy{
+			Header: h.Header,
+			Cookie: (*HashPolicyCookie)(h.Cookie),
+		}
+	}
+	return out
+}
+
+// isHeaderRemove reports whether the action type removes a header, the only
+// types that used the v1alpha1 headerName field.
+func isHeaderRemove(t ActionType) bool {
+	return t == ActionTypeHeaderRemove || t == ActionTypeResponseHeaderRemove
+}
+
+func convertActionToHub(in *Action) (v1alpha1.Action, error) {
+	out := v1alpha1.Action{
+		Type:              v1alpha1.ActionType(in.Type),
+		Redirect:          (*v1alpha1.RedirectConfig)(in.Redirect),
+		Rewrite:           (*v1alpha1.RewriteConfig)(in.Rewrite),
+		CORS:              (*v1alpha1.CORSConfig)(in.CORS),
+		UpgradeStatusCode: in.UpgradeStatusCode,
+	}
+	if in.Header != nil {
+		if isHeaderRemove(in.Type) {
+			if in.Header.Value != "" {
+				return v1alpha1.Action{}, fmt.Errorf("header.value must be empty when type is '%s'", in.Type)
+			}
+			out.HeaderName = in.Header.Name
+		} else {
+			out.Header = (*v1alpha1.HeaderConfig)(in.Header)
+		}
+	}
+	if m := in.Mirror; m != nil {
+		out.Mirror = &v1alpha1.MirrorConfig{BackendRef: v1alpha1.BackendRef(m.BackendRef), Percent: m.Percent}
+	}
+	if a := in.Auth; a != nil {
+		out.Auth = &v1alpha1.AuthConfig{
+			BackendRef:      v1alpha1.BackendRef(a.BackendRef),
+			Path:            a.Path,
+			ForwardHeaders:  a.ForwardHeaders,
+			UpstreamHeaders: a.UpstreamHeaders,
+			Timeout:         a.Timeout,
+			FailOpen:        a.FailOpen,
+		}
+	}
+	return out, nil
+}
+
+func convertActionFromHub(in v1alpha1.Action) Action {
+	out := Action{
+		Type:              ActionType(in.Type),
+		Redirect:          (*RedirectConfig)(in.Redirect),
+		Rewrite:           (*RewriteConfig)(in.Rewrite),
+		CORS:              (*CORSConfig)(in.CORS),
+		UpgradeStatusCode: in.UpgradeStatusCode,
+	}
+	if isHeaderRemove(out.Type) {
+		if in.HeaderName != "" {
+			out.Header = &HeaderConfig{Name: in.HeaderName}
+		}
+	} else {
+		out.Header = (*HeaderConfig)(in.Header)
+	}
+	if m := in.Mirror; m != nil {
+		out.Mirror = &MirrorConfig{BackendRef: BackendRef(m.BackendRef), Percent: m.Percent}
+	}
+	if a := in.Auth; a != nil {
+		out.Auth = &AuthConfig{
+			BackendRef:      BackendRef(a.BackendRef),
+			Path:            a.Path,
+			ForwardHeaders:  a.ForwardHeaders,
+			UpstreamHeaders: a.UpstreamHeaders,
+			Timeout:         a.Timeout,
+			FailOpen:        a.FailOpen,
+		}
+	}
+	return out
+}
+
+func convertHeaderMatchToHub(in HeaderMatch) v1alpha1.HeaderMatch {
+	return v1alpha1.HeaderMatch{Name: in.Name, Value: in.Value, Type: v1alpha1.HeaderMatchType(in.Type)}
+}
+
+func convertHeaderMatchFromHub(in v1alpha1.HeaderMatch) HeaderMatch {
+	return HeaderMatch{Name: in.Name, Value: in.Value, Type: HeaderMatchType(in.Type)}
+}
+
+func convertQueryParamMatchToHub(in QueryParamMatch) v1alpha1.QueryParamMatch {
+	return v1alpha1.QueryParamMatch{Name: in.Name, Value: in.Value, Type: v1alpha1.QueryParamMatchType(in.Type)}
+}
+
+func convertQueryParamMatchFromHub(in v1alpha1.QueryParamMatch) QueryParamMatch {
+	return QueryParamMatch{Name: in.Name, Value: in.Value, Type: QueryParamMatchType(in.Type)}
+}
+
+func convertCatchAllExcludePathToHub(in CatchAllExcludePath) v1alpha1.CatchAllExcludePath {
+	return v1alpha1.CatchAllExcludePath{Path: in.Path, Action: v1alpha1.CatchAllExcludeAction(in.Action)}
+}
+
+func convertCatchAllExcludePathFromHub(in v1alpha1.CatchAllExcludePath) CatchAllExcludePath {
+	return CatchAllExcludePath{Path: in.Path, Action: CatchAllExcludeAction(in.Action)}
+}
+
+// convertSlice maps in through fn, keeping a nil slice nil so that omitted
+// fields stay omitted after conversion.
+func convertSlice[S, D any](in []S, fn func(S) D) []D {
+	if in == nil {
+		return nil
+	}
+	out := make([]D, len(in))
+	for i, v := range in {
+		out[i] = fn(v)
+	}
+	return out
+}
+
+// castString converts between the v1alpha1 and v1alpha2 variants of a
+// string enum type.
+func castString[S ~string, D ~string](v S) D {
+	return D(v)
+}
+
+// castBackendRef converts between the v1alpha1 and v1alpha2 BackendRef.
+func castBackendRef[S BackendRef | v1alpha1.BackendRef, D BackendRef | v1alpha1.BackendRef](v S) D {
+	return D(v)
+}
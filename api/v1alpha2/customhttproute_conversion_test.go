@@ -0,0 +1,229 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+// hubRoute returns a v1alpha1 route touching every field that conversion maps.
+func hubRoute() *v1alpha1.CustomHTTPRoute {
+	backend := v1alpha1.BackendRef{Name: "web", Namespace: "apps", Port: 80, Protocol: v1alpha1.BackendProtocolH2C}
+	return &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "routes", Namespace: "apps", Generation: 3},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			HostnameAliases: []v1alpha1.HostnameAlias{
+				{Hostname: "www.example.com", Canonical: "example.com", Redirect: true},
+			},
+			PathPrefixes: &v1alpha1.PathPrefixes{
+				Values:           []string{"es", "fr"},
+				Policy:           v1alpha1.PathPrefixPolicyOptional,
+				ExpandMatchTypes: []v1alpha1.MatchType{v1alpha1.MatchTypePathPrefix},
+			},
+			CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+				BackendRef: backend,
+				ExcludePaths: []v1alpha1.CatchAllExcludePath{
+					{Path: "/healthz", Action: v1alpha1.CatchAllExcludeDirectResponse},
+					{Path: "/ready", Action: v1alpha1.CatchAllExcludePassThrough},
+				},
+				ListenerProtocol:   v1alpha1.ListenerProtocolHTTP,
+				HostnameAutomation: &v1alpha1.HostnameAutomation{DNS: true, Certificate: true},
+			},
+			OverrideHeader: &v1alpha1.OverrideHeader{
+				Name:     "x-branch",
+				Variants: []v1alpha1.RouteVariant{{Name: "feature-a", BackendRef: backend}},
+			},
+			DecisionHeaders:        v1alpha1.DecisionHeadersOnDebug,
+			ScrubHeaders:           []string{"x-user-id", "x-internal-*", "!x-internal-trace"},
+			UnmatchedRequestPolicy: v1alpha1.UnmatchedRequestNotFound,
+			Precedence:             100,
+			DeletionDrainSeconds:   60,
+			Enabled:                ptr(true),
+			Variant:                "green",
+			Description:            "Storefront API",
+			Owner:                  "team-shop",
+			Maintenance: &v1alpha1.Maintenance{
+				Enabled:           ptr(true),
+				End:               &metav1.Time{Time: time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)},
+				Hostnames:         []string{"example.com"},
+				Paths:             []string{"/checkout"},
+				StatusCode:        503,
+				RetryAfterSeconds: ptr(int32(600)),
+				ContentType:       "text/plain",
+				Body:              "back soon",
+				Bypass: &v1alpha1.MaintenanceBypass{
+					SourceCIDRs: []string{"203.0.113.0/24"},
+					Header:      &v1alpha1.MaintenanceBypassHeader{Name: "x-bypass", Value: "s3cret"},
+				},
+			},
+			Defaults: &v1alpha1.RuleDefaults{
+				Actions: []v1alpha1.Action{
+					{Type: v1alpha1.ActionTypeResponseHeaderRemove, HeaderName: "x-powered-by"},
+					{Type: v1alpha1.ActionTypeResponseHeaderSet, Header: &v1alpha1.HeaderConfig{Name: "x-frame-options", Value: "DENY"}},
+				},
+				BackendRefs: []v1alpha1.BackendRef{backend},
+				Priority:    1500,
+			},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches: []v1alpha1.PathMatch{{
+						Path:            "/api",
+						Type:            v1alpha1.MatchTypePathPrefix,
+						CaseInsensitive: true,
+						Method:          "GET",
+						Scheme:          v1alpha1.RequestSchemeHTTPS,
+						Headers:         []v1alpha1.HeaderMatch{{Name: "x-env", Value: "dev", Type: v1alpha1.HeaderMatchTypeExact}},
+						QueryParams:     []v1alpha1.QueryParamMatch{{Name: "v", Value: "2", Type: v1alpha1.QueryParamMatchTypeExact}},
+						Fraction:        &v1alpha1.Fraction{Numerator: 5, Denominator: 1000},
+						Priority:        2000,
+					}},
+					Actions: []v1alpha1.Action{
+						{Type: v1alpha1.ActionTypeRewrite, Rewrite: &v1alpha1.RewriteConfig{Path: "/v2", ReplacePrefixMatch: ptr(true)}},
+						{Type: v1alpha1.ActionTypeHeaderSet, Header: &v1alpha1.HeaderConfig{Name: "x-a", Value: "1"}},
+						{Type: v1alpha1.ActionTypeHeaderRemove, HeaderName: "x-b"},
+						{Type: v1alpha1.ActionTypeResponseHeaderRemove, HeaderName: "server"},
+						{Type: v1alpha1.ActionTypeRequestMirror, Mirror: &v1alpha1.MirrorConfig{BackendRef: backend, Percent: ptr(int32(10))}},
+						{Type: v1alpha1.ActionTypeCORS, CORS: &v1alpha1.CORSConfig{AllowOrigins: []string{"*"}, MaxAge: 60}},
+						{Type: v1alpha1.ActionTypeRequireAuth, Auth: &v1alpha1.AuthConfig{BackendRef: backend, Path: "/check", FailOpen: true}},
+						{Type: v1alpha1.ActionTypeRewrite, Rewrite: &v1alpha1.RewriteConfig{Segments: map[string]string{"1": "v2"}}},
+					},
+					BackendRefs:   []v1alpha1.BackendRef{backend},
+					PathPrefixes:  &v1alpha1.RulePathPrefixes{Policy: v1alpha1.PathPrefixPolicyDisabled},
+					AllowOverlap:  true,
+					ProtocolHints: v1alpha1.ProtocolHintWebSocket,
+					ActionOrder:   v1alpha1.ActionOrderSequential,
+					OutlierPolicy: &v1alpha1.OutlierPolicy{
+						FallbackBackendRef: backend,
+						ErrorRatePercent:   25,
+						MinRequests:        20,
+						Interval:           "10s",
+						EjectionTime:       "1m",
+					},
+					HashPolicy: &v1alpha1.HashPolicy{
+						Cookie: &v1alpha1.HashPolicyCookie{Name: "session", TTL: "1h", Path: "/"},
+					},
+					MaxRequestBytes: ptr(int64(1 << 20)),
+					ExpiresAt:       &metav1.Time{Time: time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC)},
+					Description:     "Legacy checkout, kept for old mobile apps",
+					Owner:           "team-payments",
+				},
+				{
+					GRPCMatches: []v1alpha1.GRPCMatch{{Service: "users.v1.UserService", Method: "GetUser", Priority: 1000}},
+					Actions: []v1alpha1.Action{{
+						Type:     v1alpha1.ActionTypeRedirect,
+						Redirect: &v1alpha1.RedirectConfig{Scheme: "https", Port: ptr(int32(443)), PreservePort: ptr(false), StatusCode: 301},
+					}},
+					Enabled: ptr(false),
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/regional", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendRefs: []v1alpha1.BackendRef{backend, {Name: "api-eu", Namespace: "default", Port: 8080}},
+					BackendFailover: &v1alpha1.BackendFailover{
+						HealthSignal:     v1alpha1.BackendHealthResponses,
+						ErrorRatePercent: 30,
+						MinRequests:      5,
+						Interval:         "20s",
+						EjectionTime:     "2m",
+					},
+				},
+			},
+		},
+		Status: v1alpha1.CustomHTTPRouteStatus{
+			ObservedGeneration: 3,
+			DisabledRules:      1,
+			Conditions:         []metav1.Condition{{Type: v1alpha1.ConditionTypeReconciled, Status: metav1.ConditionTrue}},
+		},
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	hub := hubRoute()
+
+	var spoke CustomHTTPRoute
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom() error = %v", err)
+	}
+
+	var back v1alpha1.CustomHTTPRoute
+	if err := spoke.ConvertTo(&back); err != nil {
+		t.Fatalf("ConvertTo() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(hub, &back) {
+		t.Errorf("round trip mismatch:\n got: %+v\nwant: %+v", back.Spec, hub.Spec)
+	}
+}
+
+func TestConvertFromRenamedFields(t *testing.T) {
+	var spoke CustomHTTPRoute
+	if err := spoke.ConvertFrom(hubRoute()); err != nil {
+		t.Fatalf("ConvertFrom() error = %v", err)
+	}
+
+	rule := spoke.Spec.Rules[0]
+	if rule.ProtocolHint != ProtocolHintWebSocket {
+		t.Errorf("protocolHint = %q, want %q", rule.ProtocolHint, ProtocolHintWebSocket)
+	}
+	remove := rule.Actions[2]
+	if remove.Header == nil || remove.Header.Name != "x-b" || remove.Header.Value != "" {
+		t.Errorf("header-remove header = %+v, want name x-b and no value", remove.Header)
+	}
+}
+
+func TestConvertFromDropsIgnoredHeaderName(t *testing.T) {
+	hub := hubRoute()
+	hub.Spec.Rules[0].Actions[1].HeaderName = "ignored"
+
+	var spoke CustomHTTPRoute
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom() error = %v", err)
+	}
+	if got := spoke.Spec.Rules[0].Actions[1].Header; got == nil || got.Name != "x-a" {
+		t.Errorf("header-set header = %+v, want the header config untouched", got)
+	}
+}
+
+func TestConvertToRejectsHeaderRemoveValue(t *testing.T) {
+	spoke := CustomHTTPRoute{
+		Spec: CustomHTTPRouteSpec{
+			Rules: []Rule{{
+				Matches: []RouteMatch{{Path: "/"}},
+				Actions: []Action{{Type: ActionTypeHeaderRemove, Header: &HeaderConfig{Name: "x-b", Value: "v"}}},
+			}},
+		},
+	}
+
+	var hub v1alpha1.CustomHTTPRoute
+	err := spoke.ConvertTo(&hub)
+	if err == nil {
+		t.Fatal("ConvertTo() error = nil, want an error for a header-remove value")
+	}
+	if !strings.Contains(err.Error(), "spec.rules[0]: actions[0]") {
+		t.Errorf("ConvertTo() error = %v, want it to name the action", err)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// customrouter is the CustomRouter command line tool. Its lint command checks
+// CustomHTTPRoute manifests offline, for CI pipelines.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/lint"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const usage = `Usage:
+  customrouter lint <file|directory|->... [flags]
+
+Checks CustomHTTPRoute manifests without a cluster: the admission webhook's
+validation, overlap, conflict and rule simulation checks, routes shadowed by
+the routes of other CustomHTTPRoutes of the same target, and regular
+expressions that are costly or likely mistaken. Directories are walked for
+.yaml, .yml and .json files; other kinds are skipped.
+
+Exits 1 when an error is found (or a warning, with --strict), 2 on usage
+errors.
+
+Flags:
+`
+
+// errFindings is returned by runLint when the findings fail the run.
+var errFindings = errors.New("lint findings")
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "lint" {
+		fmt.Fprint(os.Stderr, usage)
+		newLintFlags().PrintDefaults()
+		os.Exit(2)
+	}
+	err := runLint(os.Args[2:], os.Stdout)
+	switch {
+	case err == nil:
+	case errors.Is(err, errFindings):
+		os.Exit(1)
+	default:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// lintFlags are the flags of the lint command.
+type lintFlags struct {
+	*flag.FlagSet
+
+	output        string
+	strict        bool
+	priorityBands string
+	matchStrategy string
+}
+
+func newLintFlags() *lintFlags {
+	f := &lintFlags{FlagSet: flag.NewFlagSet("lint", flag.ContinueOnError)}
+	f.StringVar(&f.output, "o", "text", "Output format: text or json")
+	f.BoolVar(&f.strict, "strict", false, "Also exit 1 when only warnings are found")
+	f.StringVar(&f.priorityBands, "priority-bands", "",
+		"The operator's --priority-bands, as 'exact=3000,regex=2000,prefix=1000' (default: 1000 for every type)")
+	f.StringVar(&f.matchStrategy, "match-strategy", routes.MatchStrategyFirstMatch,
+		"The operator's match strategy for the targets: FirstMatch or MostSpecific")
+	return f
+}
+
+func runLint(args []string, out io.Writer) error {
+	f := newLintFlags()
+	f.Usage = func() {
+		fmt.Fprint(f.Output(), usage)
+		f.PrintDefaults()
+	}
+	// Accept flags after the paths too.
+	var paths []string
+	for len(args) > 0 {
+		if err := f.Parse(args); err != nil {
+			return err
+		}
+		args = f.Args()
+		if len(args) > 0 {
+			paths = append(paths, args[0])
+			args = args[1:]
+		}
+	}
+	if len(paths) == 0 {
+		f.Usage()
+		return errors.New("lint takes at least one file or directory")
+	}
+	if f.output != "text" && f.output != "json" {
+		return fmt.Errorf("unknown output format %q", f.output)
+	}
+
+	bands, err := routes.ParsePriorityBands(f.priorityBands, v1alpha1.DefaultPriority)
+	if err != nil {
+		return fmt.Errorf("--priority-bands: %w", err)
+	}
+	routes.SetPriorityBands(bands)
+	if err := routes.ValidateMatchStrategy(f.matchStrategy); err != nil {
+		return fmt.Errorf("--match-strategy: %w", err)
+	}
+
+	docs, findings, err := lint.LoadPaths(paths)
+	if err != nil {
+		return err
+	}
+	findings = append(findings, lint.Lint(docs, lint.Options{MatchStrategy: f.matchStrategy})...)
+
+	if f.output == "json" {
+		if findings == nil {
+			findings = []lint.Finding{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, finding := range findings {
+			fmt.Fprintln(out, finding)
+		}
+		fmt.Fprintf(out, "%d CustomHTTPRoutes checked, %d findings\n", lint.CountRoutes(docs), len(findings))
+	}
+
+	if lint.HasErrors(findings) || (f.strict && len(findings) > 0) {
+		return errFindings
+	}
+	return nil
+}
@@ -23,7 +23,9 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
+	"unicode"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -32,12 +34,17 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/freepik-company/customrouter/internal/extproc"
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
 func main() {
 	config := extproc.DefaultServerConfig()
 	var debug bool
 	var kubeconfig string
+	var bucketURL, bucketEndpoint, bucketRegion string
+	var signingKeyFile, encryptionKeyFile, reentryKeyFile string
+	clearRouteCache := true
 
 	// Basic flags
 	flag.StringVar(&config.Addr, "addr", config.Addr, "The address to listen on for gRPC connections")
@@ -45,19 +52,186 @@ func main() {
 		"The target name to filter ConfigMaps (must match spec.targetRef.name in CustomHTTPRoute)")
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to kubeconfig file (optional, uses in-cluster config if not set)")
 	flag.BoolVar(&debug, "debug", false, "Enable debug logging")
+	flag.Float64Var(&config.DebugLogRate, "debug-log-rate", config.DebugLogRate,
+		"Most debug log lines written per second, the rest are dropped (0 = unlimited)")
 	flag.BoolVar(&config.AccessLogEnabled, "access-log", config.AccessLogEnabled, "Enable access logging")
+	flag.Float64Var(&config.AccessLogSampleRate, "access-log-sample-rate", config.AccessLogSampleRate,
+		"Fraction of requests, from 0 to 1, that get an access log line")
+	flag.StringVar(&config.RuntimeConfigMap, "runtime-configmap", config.RuntimeConfigMap,
+		"namespace/name of a ConfigMap whose log-level, access-log, access-log-sample-rate and debug-trace-hosts "+
+			"keys are applied without a restart, overriding the flags (empty = disabled)")
+	flag.BoolVar(&config.BackendHealthEndpoints, "backend-health-endpoints", config.BackendHealthEndpoints,
+		"Watch EndpointSlices so backendFailover chains with the Endpoints signal skip backends without ready endpoints")
 	flag.StringVar(&config.RoutesNamespace, "routes-configmap-namespace", config.RoutesNamespace,
 		"Namespace to read route ConfigMaps from (empty = all namespaces)")
+	flag.Func("allowed-source-namespaces",
+		"Comma-separated namespaces route ConfigMaps may be loaded from; labeled ConfigMaps "+
+			"elsewhere are ignored (default: any namespace)",
+		func(s string) error {
+			for _, ns := range strings.Split(s, ",") {
+				if ns = strings.TrimSpace(ns); ns != "" {
+					config.AllowedSourceNamespaces = append(config.AllowedSourceNamespaces, ns)
+				}
+			}
+			return nil
+		})
+	flag.StringVar(&signingKeyFile, "routes-signing-key-file", "",
+		"File holding the key shared with the operator's --routes-signing-key-file; only route "+
+			"ConfigMaps carrying a valid signature are loaded (empty = signatures not checked)")
+	flag.StringVar(&encryptionKeyFile, "routes-encryption-key-file", "",
+		"File holding the key of the operator's --routes-encryption-key-file, to decrypt encrypted route "+
+			"ConfigMaps (empty = only plain ConfigMaps load)")
 	flag.StringVar(&config.RoutePartitionHeader, "route-partition-header", config.RoutePartitionHeader,
 		"Request header used to index/partition routes for faster lookup "+
 			"(empty = disabled, full scan). Set e.g. to 'env' in sandbox environments "+
 			"where one extproc serves many route sets keyed by that header.")
+	flag.IntVar(&config.MaxRouteTableBytes, "max-route-table-bytes", config.MaxRouteTableBytes,
+		"Memory budget of the route table, in bytes of its estimated size (0 = unlimited). A larger table "+
+			"is not loaded: the previous one keeps being served and the largest hosts are logged. It bounds "+
+			"one table: with --routes-history-size, a reload and the cached ConfigMaps the extproc can hold "+
+			"about max(--routes-history-size, 1)+2 times this, plus regexes and indexes.")
 	flag.DurationVar(&config.RoutesReloadDebounce, "routes-reload-debounce", config.RoutesReloadDebounce,
 		"Debounce window for coalescing ConfigMap change events before rebuilding "+
 			"the route table (0 = rebuild on every event). Caps full rebuilds at one "+
 			"per window under churn.")
+	flag.DurationVar(&config.RoutesReloadJitter, "routes-reload-jitter", config.RoutesReloadJitter,
+		"Maximum random delay added before every route table rebuild, so replicas do not all "+
+			"rebuild at the same instant (0 = disabled).")
+	flag.DurationVar(&config.RoutesResyncPeriod, "routes-resync-period", config.RoutesResyncPeriod,
+		"How often the ConfigMap informer re-delivers every route ConfigMap, triggering a rebuild "+
+			"that only decodes what changed (0 = 10m, negative = disabled).")
+	flag.StringVar(&config.SnapshotPath, "snapshot-path", config.SnapshotPath,
+		"Local file where the last-known-good route config is persisted (empty = disabled). "+
+			"When present on start, routes are served from it while ConfigMaps load in the background.")
+	flag.StringVar(&bucketURL, "routes-bucket-url", "",
+		"Read routes from the object the operator publishes to this bucket (s3://bucket/prefix or "+
+			"gs://bucket/prefix) instead of from ConfigMaps. Credentials come from AWS_ACCESS_KEY_ID, "+
+			"AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN (HMAC keys for GCS).")
+	flag.StringVar(&bucketEndpoint, "routes-bucket-endpoint", "",
+		"S3-compatible endpoint for --routes-bucket-url (e.g. a MinIO URL; empty = AWS or GCS)")
+	flag.StringVar(&bucketRegion, "routes-bucket-region", "",
+		"Signing region for --routes-bucket-url (empty = AWS_REGION, then us-east-1)")
+	flag.DurationVar(&config.RoutesBucketPollInterval, "routes-bucket-poll-interval", routes.DefaultBucketPollInterval,
+		"How often the routes bucket object is checked for changes")
 	flag.StringVar(&config.MetricsAddr, "metrics-addr", config.MetricsAddr,
 		"Address to expose Prometheus metrics on (empty to disable)")
+	flag.StringVar(&config.HealthAddr, "health-addr", config.HealthAddr,
+		"Address to serve HTTP /healthz, /readyz, /version and /debug/routes on (empty to disable)")
+	flag.IntVar(&config.RoutesHistorySize, "routes-history-size", config.RoutesHistorySize,
+		"Number of recent route tables kept to export and diff on /debug/routes (0 disables /debug/routes)")
+	flag.StringVar(&config.RoutesDebugToken, "routes-debug-token", config.RoutesDebugToken,
+		"Bearer token the /debug/routes endpoints require (empty = none)")
+	flag.StringVar(&config.DecisionHeaders, "decision-headers", config.DecisionHeaders,
+		"When to add the x-original-authority and x-customrouter-matched-* headers to forwarded requests: "+
+			"always, never or on-debug. Routes and attachments may override it.")
+	flag.StringVar(&config.DebugHeader, "debug-header", config.DebugHeader,
+		"Request header that enables the decision headers in on-debug mode")
+	flag.StringVar(&config.DebugHeaderValue, "debug-header-value", config.DebugHeaderValue,
+		"Value the debug header must carry in on-debug mode (empty = any value)")
+	flag.BoolVar(&config.ConfigHashHeader, "config-hash-header", config.ConfigHashHeader,
+		"Add the x-customrouter-config-hash header, the hash of the route table being served, to requests "+
+			"carrying the debug header, to compare what each replica serves")
+	flag.BoolVar(&config.RequireRoutes, "require-routes", config.RequireRoutes,
+		"Refuse to start when no route ConfigMap or bucket object exists for --target-name, instead of warning")
+	flag.BoolVar(&config.HostMetrics, "host-metrics", config.HostMetrics,
+		"Record customrouter_host_requests_total, the requests of each host of the route table by whether "+
+			"a route matched, for per-host route miss ratio alerts")
+	flag.BoolVar(&config.MissDiagnostics, "miss-diagnostics", config.MissDiagnostics,
+		"Log the nearest route of each request matching no route and why it did not match (path variants "+
+			"such as a trailing slash, longest common prefix), counted in customrouter_route_miss_reasons_total. "+
+			"Scans every route of the host per miss")
+	flag.Func("scrub-headers",
+		"Comma-separated request headers removed from every client request before it is forwarded, "+
+			"e.g. x-user-id,x-internal-*: \"*\" matches any run of characters and a leading \"!\" keeps the "+
+			"headers it matches. CustomHTTPRoute scrubHeaders apply on top",
+		func(s string) error {
+			patterns, err := routes.ParseScrubPatterns(s)
+			if err != nil {
+				return err
+			}
+			config.ScrubHeaders = patterns
+			return nil
+		})
+	flag.Func("debug-trace-hosts",
+		"Comma-separated hostnames (\"*\" for all) whose requests may set the debug header to \"true\" "+
+			"to get their full routing decision logged (empty = disabled)",
+		func(s string) error {
+			for _, host := range strings.Split(s, ",") {
+				if host = strings.TrimSpace(host); host != "" {
+					config.DebugTraceHosts = append(config.DebugTraceHosts, host)
+				}
+			}
+			return nil
+		})
+	flag.StringVar(&config.DebugTraceToken, "debug-trace-token", config.DebugTraceToken,
+		"Token traced requests must also send in the x-customrouter-debug-token header (empty = none)")
+	flag.BoolVar(&config.ReentryGuard, "reentry-guard", config.ReentryGuard,
+		"Mark every request let through with the x-customrouter-processed header and let requests carrying "+
+			"a valid marker through without rewriting them again, for Envoy setups that run the filter twice on a request")
+	flag.StringVar(&reentryKeyFile, "reentry-key-file", "",
+		"File holding the key signing the --reentry-guard markers, shared by the replicas of the target "+
+			"(empty = a random key per process, only recognizing its own markers)")
+	flag.BoolVar(&clearRouteCache, "clear-route-cache", clearRouteCache,
+		"Ask Envoy to pick the route again after setting the routing headers. Disable it only when the "+
+			"Envoy route does not depend on them, e.g. one route forwarding on cluster_header.")
+	flag.StringVar(&config.UnmatchedRequestPolicy, "unmatched-request-policy", config.UnmatchedRequestPolicy,
+		"What to do with requests no route matches: passthrough, 404 or 503. Hostnames and attachments may override it.")
+	flag.StringVar(&config.RedirectAltSvc, "redirect-alt-svc", config.RedirectAltSvc,
+		"Alt-Svc header sent with redirect responses whose action sets none, e.g. 'h3=\":443\"; ma=86400' "+
+			"so HTTP/3 clients keep using HTTP/3 (empty = none)")
+	flag.IntVar(&config.Overload.MaxInFlight, "overload-max-in-flight", config.Overload.MaxInFlight,
+		"Overloaded when more requests than this are processed at once (0 = not checked)")
+	flag.IntVar(&config.Overload.MaxGoroutines, "overload-max-goroutines", config.Overload.MaxGoroutines,
+		"Overloaded when the process runs more goroutines than this (0 = not checked)")
+	flag.DurationVar(&config.Overload.MaxLatency, "overload-max-latency", config.Overload.MaxLatency,
+		"Overloaded when the moving average of the route lookup latency exceeds this (0 = not checked)")
+	flag.StringVar(&config.Overload.Action, "overload-action", config.Overload.Action,
+		"What to do with requests while overloaded: shed-regex (skip regex routes, serve exact and prefix "+
+			"routes) or fail-open (let requests through unrouted, except to hosts with require-auth or maintenance routes)")
+	flag.StringVar(&config.Analytics.Sink, "analytics-sink", config.Analytics.Sink,
+		"Export the routing decision of every request to http, clickhouse or bigquery (empty = disabled). "+
+			"Credentials come from ANALYTICS_TOKEN, CLICKHOUSE_USER and CLICKHOUSE_PASSWORD.")
+	flag.StringVar(&config.Analytics.Endpoint, "analytics-endpoint", config.Analytics.Endpoint,
+		"URL batches are POSTed to (http), ClickHouse HTTP interface URL (clickhouse), "+
+			"or BigQuery API override (bigquery)")
+	flag.StringVar(&config.Analytics.Table, "analytics-table", config.Analytics.Table,
+		"Table routing decisions are inserted into: database.table (clickhouse) or project.dataset.table (bigquery)")
+	flag.IntVar(&config.Analytics.BatchSize, "analytics-batch-size", config.Analytics.BatchSize,
+		"Most routing decisions written to the analytics sink at once")
+	flag.DurationVar(&config.Analytics.FlushInterval, "analytics-flush-interval", config.Analytics.FlushInterval,
+		"Longest a routing decision waits to be written to the analytics sink")
+	flag.IntVar(&config.Analytics.BufferSize, "analytics-buffer-size", config.Analytics.BufferSize,
+		"Routing decisions waiting to be written beyond which new ones are dropped")
+	flag.Func("path-normalization",
+		"Comma-separated normalizations of request paths before matching: merge-slashes, decode-unreserved, "+
+			"reject-encoded-slashes, or none (default). Attachments may override it.",
+		func(s string) error {
+			n, err := routes.ParsePathNormalization(s)
+			if err != nil {
+				return err
+			}
+			config.PathNormalization = n
+			return nil
+		})
+	flag.StringVar(&config.ClusterNaming.Template, "cluster-name-template", config.ClusterNaming.Template,
+		"Name of the cluster a request is routed to, with {service}, {namespace}, {port}, {subset}, {domain} "+
+			"and {host} variables (empty = outbound|{port}|{subset}|{host}, Istio's). Attachments may override it.")
+	flag.StringVar(&config.ClusterNaming.Domain, "cluster-domain", config.ClusterNaming.Domain,
+		"Cluster domain of Service backends in cluster names (empty = cluster.local). Attachments may override it.")
+	flag.StringVar(&config.VariantSelector.Header, "variant-header", config.VariantSelector.Header,
+		"Request header selecting the route table variant (CustomHTTPRoute spec.variant) of a request (empty = none). "+
+			"Attachments may override it.")
+	flag.StringVar(&config.VariantSelector.Cookie, "variant-cookie", config.VariantSelector.Cookie,
+		"Cookie selecting the route table variant of a request when --variant-header is absent (empty = none). "+
+			"Attachments may override it.")
+
+	// gRPC TLS flags
+	flag.StringVar(&config.TLSCertFile, "tls-cert", config.TLSCertFile,
+		"Path to the PEM certificate to serve gRPC over TLS with (empty = plaintext); reloaded when it changes")
+	flag.StringVar(&config.TLSKeyFile, "tls-key", config.TLSKeyFile,
+		"Path to the PEM private key of --tls-cert")
+	flag.StringVar(&config.TLSClientCAFile, "tls-client-ca", config.TLSClientCAFile,
+		"Path to a PEM CA bundle; when set, clients must present a certificate signed by it (mTLS)")
 
 	// gRPC server configuration flags
 	flag.IntVar(&config.MaxRecvMsgSize, "grpc-max-recv-msg-size",
@@ -95,6 +269,7 @@ func main() {
 		logConfig.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
 	}
 	config.Debug = debug
+	config.LogLevel = &logConfig.Level
 	logger, err := logConfig.Build()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to build logger: %v\n", err)
@@ -102,25 +277,89 @@ func main() {
 	}
 	defer func() { _ = logger.Sync() }()
 
-	// Create Kubernetes client
-	var k8sConfig *rest.Config
-	if kubeconfig != "" {
-		k8sConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			logger.Fatal("failed to build kubeconfig", zap.Error(err))
+	if !routes.ValidDecisionHeadersMode(config.DecisionHeaders) {
+		logger.Fatal("invalid --decision-headers, must be always, never or on-debug",
+			zap.String("value", config.DecisionHeaders))
+	}
+	if config.AccessLogSampleRate < 0 || config.AccessLogSampleRate > 1 {
+		logger.Fatal("invalid --access-log-sample-rate, must be from 0 to 1",
+			zap.Float64("value", config.AccessLogSampleRate))
+	}
+	if config.DebugLogRate < 0 {
+		logger.Fatal("invalid --debug-log-rate, must not be negative",
+			zap.Float64("value", config.DebugLogRate))
+	}
+	if err := routes.ValidateClusterNameTemplate(config.ClusterNaming.Template); err != nil {
+		logger.Fatal("invalid --cluster-name-template", zap.Error(err))
+	}
+	if !routes.ValidUnmatchedPolicy(config.UnmatchedRequestPolicy) {
+		logger.Fatal("invalid --unmatched-request-policy, must be passthrough, 404 or 503",
+			zap.String("value", config.UnmatchedRequestPolicy))
+	}
+
+	if err := config.Overload.Validate(); err != nil {
+		logger.Fatal("invalid --overload-action", zap.Error(err))
+	}
+
+	if strings.IndexFunc(config.RedirectAltSvc, unicode.IsControl) >= 0 {
+		logger.Fatal("invalid --redirect-alt-svc, must not contain control characters")
+	}
+
+	if signingKeyFile != "" {
+		if config.RoutesSigningKey, err = routes.ReadSigningKey(signingKeyFile); err != nil {
+			logger.Fatal("invalid --routes-signing-key-file", zap.Error(err))
+		}
+	}
+	if encryptionKeyFile != "" {
+		if config.RoutesEncryptionKey, err = routes.ReadEncryptionKey(encryptionKeyFile); err != nil {
+			logger.Fatal("invalid --routes-encryption-key-file", zap.Error(err))
+		}
+	}
+	if reentryKeyFile != "" {
+		if !config.ReentryGuard {
+			logger.Fatal("--reentry-key-file requires --reentry-guard")
+		}
+		if config.ReentryKey, err = routes.ReadSigningKey(reentryKeyFile); err != nil {
+			logger.Fatal("invalid --reentry-key-file", zap.Error(err))
 		}
-	} else {
-		k8sConfig, err = rest.InClusterConfig()
+	}
+	config.RetainRouteCache = !clearRouteCache
+
+	if bucketURL != "" {
+		// Routes come from the bucket; Kubernetes access is only needed
+		// for the runtime config ConfigMap.
+		bucketConfig := objectstore.ConfigFromEnv(bucketURL)
+		bucketConfig.Endpoint = bucketEndpoint
+		if bucketRegion != "" {
+			bucketConfig.Region = bucketRegion
+		}
+		bucket, err := objectstore.New(bucketConfig)
 		if err != nil {
-			logger.Fatal("failed to get in-cluster config", zap.Error(err))
+			logger.Fatal("invalid --routes-bucket-url", zap.Error(err))
 		}
+		config.RoutesBucket = bucket
 	}
+	if bucketURL == "" || config.RuntimeConfigMap != "" || config.BackendHealthEndpoints {
+		// Create Kubernetes client
+		var k8sConfig *rest.Config
+		if kubeconfig != "" {
+			k8sConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+			if err != nil {
+				logger.Fatal("failed to build kubeconfig", zap.Error(err))
+			}
+		} else {
+			k8sConfig, err = rest.InClusterConfig()
+			if err != nil {
+				logger.Fatal("failed to get in-cluster config", zap.Error(err))
+			}
+		}
 
-	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
-	if err != nil {
-		logger.Fatal("failed to create Kubernetes client", zap.Error(err))
+		k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+		if err != nil {
+			logger.Fatal("failed to create Kubernetes client", zap.Error(err))
+		}
+		config.K8sClient = k8sClient
 	}
-	config.K8sClient = k8sClient
 
 	// Create context that cancels on SIGTERM/SIGINT
 	ctx, cancel := context.WithCancel(context.Background())
@@ -0,0 +1,282 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-customroute is a kubectl plugin inspecting CustomRouter routing.
+// Installed on the PATH it runs as "kubectl customroute".
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/internal/explain"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const usage = `Usage:
+  kubectl customroute explain <url> [flags]
+
+Prints the route a request to <url> matches in every target serving its
+hostname: the CustomHTTPRoute and rule it comes from, its priority, actions
+and the route ConfigMap holding it.
+
+Flags:
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "explain" {
+		fmt.Fprint(os.Stderr, usage)
+		newExplainFlags().PrintDefaults()
+		os.Exit(2)
+	}
+	if err := runExplain(os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// explainFlags are the flags of the explain command.
+type explainFlags struct {
+	*flag.FlagSet
+
+	kubeconfig      string
+	context         string
+	method          string
+	target          string
+	routesNamespace string
+	output          string
+	priorityBands   string
+	matchStrategy   string
+	variant         string
+	headers         []string
+}
+
+func newExplainFlags() *explainFlags {
+	f := &explainFlags{FlagSet: flag.NewFlagSet("explain", flag.ContinueOnError)}
+	f.StringVar(&f.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file (default: KUBECONFIG or ~/.kube/config)")
+	f.StringVar(&f.context, "context", "", "The kubeconfig context to use")
+	f.StringVar(&f.method, "method", "GET", "The request method")
+	f.StringVar(&f.method, "X", "GET", "Shorthand for --method")
+	f.StringVar(&f.target, "target", "", "Only explain this target (default: every target serving the hostname)")
+	f.StringVar(&f.routesNamespace, "routes-namespace", "",
+		"Namespace of the route ConfigMaps (default: all namespaces)")
+	f.StringVar(&f.output, "o", "text", "Output format: text or json")
+	f.StringVar(&f.priorityBands, "priority-bands", "",
+		"The operator's --priority-bands, as 'exact=3000,regex=2000,prefix=1000' (default: 1000 for every type)")
+	f.StringVar(&f.matchStrategy, "match-strategy", routes.MatchStrategyFirstMatch,
+		"The operator's match strategy for the target: FirstMatch or MostSpecific")
+	f.StringVar(&f.variant, "variant", "",
+		"The route table variant the request selects (default: the routes without a variant)")
+	f.Func("H", "A request header as 'name: value' (repeatable)", func(s string) error {
+		if !strings.Contains(s, ":") {
+			return fmt.Errorf("header %q is not 'name: value'", s)
+		}
+		f.headers = append(f.headers, s)
+		return nil
+	})
+	return f
+}
+
+func runExplain(args []string, out io.Writer) error {
+	f := newExplainFlags()
+	f.Usage = func() {
+		fmt.Fprint(f.Output(), usage)
+		f.PrintDefaults()
+	}
+	// Accept flags after the URL too, as kubectl users expect.
+	var positional []string
+	for len(args) > 0 {
+		if err := f.Parse(args); err != nil {
+			return err
+		}
+		args = f.Args()
+		if len(args) > 0 {
+			positional = append(positional, args[0])
+			args = args[1:]
+		}
+	}
+	if len(positional) != 1 {
+		f.Usage()
+		return fmt.Errorf("explain takes exactly one URL, got %d", len(positional))
+	}
+	if f.output != "text" && f.output != "json" {
+		return fmt.Errorf("unknown output format %q", f.output)
+	}
+
+	bands, err := routes.ParsePriorityBands(f.priorityBands, v1alpha1.DefaultPriority)
+	if err != nil {
+		return fmt.Errorf("--priority-bands: %w", err)
+	}
+	routes.SetPriorityBands(bands)
+	if err := routes.ValidateMatchStrategy(f.matchStrategy); err != nil {
+		return fmt.Errorf("--match-strategy: %w", err)
+	}
+
+	req, err := explain.ParseRequest(positional[0])
+	if err != nil {
+		return err
+	}
+	req.Method = strings.ToUpper(f.method)
+	req.MatchStrategy = f.matchStrategy
+	req.Variant = f.variant
+	for _, h := range f.headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Headers[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	c, err := newClient(f.kubeconfig, f.context)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var customRoutes v1alpha1.CustomHTTPRouteList
+	if err := c.List(ctx, &customRoutes); err != nil {
+		return fmt.Errorf("listing CustomHTTPRoutes: %w", err)
+	}
+	var configMaps corev1.ConfigMapList
+	if err := c.List(ctx, &configMaps,
+		client.InNamespace(f.routesNamespace),
+		client.MatchingLabels{explain.ManagedByLabel: explain.ManagedByValue},
+	); err != nil {
+		return fmt.Errorf("listing route ConfigMaps: %w", err)
+	}
+
+	results, err := explain.Explain(customRoutes.Items, configMaps.Items, req)
+	if err != nil {
+		return err
+	}
+	if f.target != "" {
+		filtered := results[:0]
+		for _, result := range results {
+			if result.Target == f.target {
+				filtered = append(filtered, result)
+			}
+		}
+		results = filtered
+	}
+
+	if f.output == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(out, "No CustomHTTPRoute serves %s\n", req.Host)
+		return nil
+	}
+	return printResults(out, results)
+}
+
+// newClient returns a client for the cluster of the kubeconfig context.
+func newClient(kubeconfig, kubeContext string) (client.Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return client.New(restConfig, client.Options{Scheme: scheme})
+}
+
+// printResults writes results as one block per target.
+func printResults(out io.Writer, results []explain.Result) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for i, result := range results {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Target:\t%s\n", result.Target)
+		fmt.Fprintf(w, "Host:\t%s\n", result.Host)
+		route := result.Route
+		if route == nil {
+			fmt.Fprintln(w, "Route:\t<no route matches>")
+		} else {
+			rule := fmt.Sprintf("%d", result.Rule)
+			switch result.Rule {
+			case explain.UnmatchedRule:
+				rule = "unmatchedRequestPolicy"
+			case explain.AliasRedirectRule:
+				rule = "hostnameAliases"
+			case explain.MaintenanceRule:
+				rule = "maintenance"
+			}
+			fmt.Fprintf(w, "Source:\t%s\n", result.Source)
+			fmt.Fprintf(w, "Rule:\t%s\n", rule)
+			if route.Owner != "" {
+				fmt.Fprintf(w, "Owner:\t%s\n", route.Owner)
+			}
+			if route.Description != "" {
+				fmt.Fprintf(w, "Description:\t%s\n", route.Description)
+			}
+			fmt.Fprintf(w, "Match:\t%s %s\n", route.Type, route.Path)
+			if route.Method != "" {
+				fmt.Fprintf(w, "Method:\t%s\n", route.Method)
+			}
+			fmt.Fprintf(w, "Priority:\t%d\n", route.Priority)
+			if route.Backend != "" {
+				fmt.Fprintf(w, "Backend:\t%s\n", route.Backend)
+			}
+			if route.UnmatchedPolicy != "" {
+				fmt.Fprintf(w, "Unmatched:\t%s\n", route.UnmatchedPolicy)
+			}
+			if route.Maintenance != nil {
+				fmt.Fprintf(w, "Maintenance:\t%d\n", route.Maintenance.StatusCode)
+			}
+			for j, action := range route.Actions {
+				data, err := json.Marshal(action)
+				if err != nil {
+					return err
+				}
+				label := ""
+				if j == 0 {
+					label = "Actions:"
+				}
+				fmt.Fprintf(w, "%s\t%s\n", label, data)
+			}
+		}
+		configMaps := strings.Join(result.ConfigMaps, ", ")
+		if configMaps == "" {
+			configMaps = "<not written yet>"
+		}
+		fmt.Fprintf(w, "ConfigMaps:\t%s\n", configMaps)
+	}
+	return w.Flush()
+}
@@ -20,28 +20,39 @@ import (
 	"context"
 	"crypto/tls"
 	"flag"
+	"net/http"
 	"os"
+	"slices"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	appsv1 "k8s.io/api/apps/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	crv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+	crv1alpha2 "github.com/freepik-company/customrouter/api/v1alpha2"
 	"github.com/freepik-company/customrouter/internal/controller/customhttproute"
 	"github.com/freepik-company/customrouter/internal/controller/externalprocessorattachment"
 	customwebhook "github.com/freepik-company/customrouter/internal/webhook"
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+	"github.com/freepik-company/customrouter/pkg/routes"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 	// +kubebuilder:scaffold:imports
@@ -52,9 +63,15 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+// baseLeaderElectionID is the leader election ID of the unsharded controller;
+// shards prefix it with their name (see customhttproute.LeaderElectionID).
+const baseLeaderElectionID = "495e98d5.customrouter.freepik.com"
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(crv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(crv1alpha2.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	utilruntime.Must(gatewayv1.Install(scheme))
 	// +kubebuilder:scaffold:scheme
 }
@@ -63,17 +80,46 @@ func main() {
 	var metricsAddr string
 	var metricsCertPath, metricsCertName, metricsCertKey string
 	var webhookCertPath, webhookCertName, webhookCertKey string
+	var webhookCertSource string
 	var enableLeaderElection bool
+	var targetShard, shardName string
+	var reconcileAttachments bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var routesConfigMapNamespace string
 	var maxConcurrentReconciles int
 	var rebuildCooldown time.Duration
+	var routesFormatVersion int
+	var routesCompression bool
+	var omitRouteSource bool
+	var routesGzipThreshold int
+	var partitionStrategy string
+	var hostHashBuckets int
+	var maxRoutesPerTarget int
+	var defaultPriority int
+	var priorityBands string
+	var routesSigningKeyFile string
+	var routesEncryptionKeyFile, routesEncryptionTargets string
+	var routesBucketURL, routesBucketEndpoint, routesBucketRegion string
+	var hostRouteFiles string
+	var httpProxyTargets string
+	var matchStrategy, matchStrategyTargets string
+	var prometheusRules bool
+	var prometheusRuleOptions customhttproute.PrometheusRuleOptions
+	var prometheusRuleLabels string
+	var hostnameAutomationDomains, hostnameAutomationNamespace string
+	var hostnameDNSTargets, hostnameCertificateIssuer string
+	var dryRunAddr string
+	var secureDryRun bool
+	var expansionAnnotations bool
 	var enableWebhooks bool
 	var webhookConfigName string
 	var webhookServiceName string
 	var webhookPort int
+	var crdConversionWebhook bool
+	var policy customwebhook.AdmissionPolicy
+	var policyAllowedTargets string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -81,11 +127,24 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&targetShard, "target-shard", "",
+		"Only reconcile the targets of this shard, so several controller deployments split the targets: "+
+			"\"hash:<from>[-<to>]/<count>\" owns the targets whose name hashes into [from, to] modulo count, "+
+			"\"targets:<name>,...\" owns the listed targets. Empty owns every target")
+	flag.StringVar(&shardName, "shard-name", "",
+		"Name of the shard in the labels of its ConfigMaps and in its leader election ID. "+
+			"Empty derives it from --target-shard")
+	flag.BoolVar(&reconcileAttachments, "reconcile-attachments", true,
+		"Run the ExternalProcessorAttachment controller. With --target-shard, enable it on one deployment only")
 	flag.BoolVar(&secureMetrics, "metrics-secure", true,
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.StringVar(&webhookCertPath, "webhook-cert-path", "", "The directory that contains the webhook certificate.")
 	flag.StringVar(&webhookCertName, "webhook-cert-name", "tls.crt", "The name of the webhook certificate file.")
 	flag.StringVar(&webhookCertKey, "webhook-cert-key", "tls.key", "The name of the webhook key file.")
+	flag.StringVar(&webhookCertSource, "webhook-cert-source", "",
+		"Where the webhook serving certificate comes from: self-signed (generated, CA bundles patched by the "+
+			"operator), cert-manager or secret (read from --webhook-cert-path and reloaded on change, CA bundles "+
+			"left alone). Empty infers secret when --webhook-cert-path is set, self-signed otherwise")
 	flag.StringVar(&metricsCertPath, "metrics-cert-path", "",
 		"The directory that contains the metrics server certificate.")
 	flag.StringVar(&metricsCertName, "metrics-cert-name", "tls.crt", "The name of the metrics server certificate file.")
@@ -100,19 +159,251 @@ func main() {
 		"Minimum interval between ConfigMap rebuilds for the same target. Higher values reduce "+
 			"rebuild frequency (CPU/memory) under churn at the cost of slower route propagation. "+
 			"0 uses the default; negative disables throttling.")
+	flag.IntVar(&routesFormatVersion, "routes-format-version", routes.FormatVersion1,
+		"Wire format version of the route ConfigMaps (1 or 2). Keep 1 until every extproc "+
+			"understands version 2, so mixed versions keep routing during upgrades.")
+	flag.BoolVar(&routesCompression, "routes-compression", false,
+		"Store route ConfigMaps gzip-compressed. Requires --routes-format-version=2.")
+	flag.BoolVar(&omitRouteSource, "omit-route-source", false,
+		"Leave the owning CustomHTTPRoute and rule out of version 2 route documents, keeping only "+
+			"the opaque route id, e.g. to keep resource names out of production access logs.")
+	flag.IntVar(&routesGzipThreshold, "routes-gzip-threshold", 0,
+		"Write a route ConfigMap whose routes document exceeds this many bytes as gzip-compressed "+
+			"routes.json.gz binaryData, so large targets fit in fewer ConfigMaps. 0 disables it. "+
+			"Every extproc must read routes.json.gz before this is enabled.")
+	flag.StringVar(&partitionStrategy, "partition-strategy", customhttproute.PartitionStrategySize,
+		"How a target's routes are split into ConfigMaps: \"size\" packs hosts into as few ConfigMaps "+
+			"as fit, \"host-hash\" gives each hostname hash bucket its own ConfigMap so a change only "+
+			"rewrites one bucket")
+	flag.IntVar(&hostHashBuckets, "partition-host-buckets", customhttproute.DefaultHostHashBuckets,
+		"Number of ConfigMaps per target under --partition-strategy=host-hash")
+	flag.IntVar(&maxRoutesPerTarget, "max-routes-per-target", 0,
+		"Maximum number of routes in the merged route table of a target. CustomHTTPRoutes that do not fit "+
+			"are left out, newest first, and report RouteBudgetExceeded. 0 means unlimited.")
+	flag.IntVar(&defaultPriority, "default-priority", int(crv1alpha1.DefaultPriority),
+		"Priority of matches that set none, neither directly nor through spec.defaults.priority")
+	flag.StringVar(&priorityBands, "priority-bands", "",
+		"Per match type overrides of --default-priority, as \"exact=3000,regex=2000,prefix=1000\". "+
+			"Changing them reorders the routes of every CustomHTTPRoute relying on the default.")
+	flag.StringVar(&matchStrategy, "match-strategy", routes.MatchStrategyFirstMatch,
+		"How the routes of a host are ordered: \"FirstMatch\" by priority, then specificity; \"MostSpecific\" "+
+			"by specificity (path type, path length, method, headers, query parameters), then priority, "+
+			"like Gateway API HTTPRoutes. Upgrade every extproc before enabling MostSpecific.")
+	flag.StringVar(&matchStrategyTargets, "match-strategy-targets", "",
+		"Per target overrides of --match-strategy, as \"web=MostSpecific,api=FirstMatch\"")
+	flag.StringVar(&routesSigningKeyFile, "routes-signing-key-file", "",
+		"File holding a key to sign route ConfigMaps with (HMAC-SHA256). Extprocs given the same key "+
+			"with --routes-signing-key-file only load signed ConfigMaps. Empty disables signing.")
+	flag.StringVar(&routesEncryptionKeyFile, "routes-encryption-key-file", "",
+		"File holding an AES key (16, 24 or 32 bytes, raw or base64) to encrypt the routes of route ConfigMaps "+
+			"with (AES-GCM). Extprocs need the same key in --routes-encryption-key-file: upgrade and configure "+
+			"them first. Empty disables encryption.")
+	flag.StringVar(&routesEncryptionTargets, "routes-encryption-targets", "",
+		"Comma-separated targets whose route ConfigMaps are encrypted with --routes-encryption-key-file "+
+			"(empty = every target)")
+	flag.StringVar(&routesBucketURL, "routes-bucket-url", "",
+		"Also publish the merged routes of every target to this bucket (s3://bucket/prefix or "+
+			"gs://bucket/prefix), for route consumers that cannot read ConfigMaps. Credentials come from "+
+			"AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN (HMAC keys for GCS).")
+	flag.StringVar(&routesBucketEndpoint, "routes-bucket-endpoint", "",
+		"S3-compatible endpoint for --routes-bucket-url (e.g. a MinIO URL; empty = AWS or GCS)")
+	flag.StringVar(&routesBucketRegion, "routes-bucket-region", "",
+		"Signing region for --routes-bucket-url (empty = AWS_REGION, then us-east-1)")
+	flag.StringVar(&hostRouteFiles, "host-route-files", "",
+		"Also write the routes of every target as one JSON file per host, for reviewing route changes "+
+			"as diffs in GitOps pipelines: \"configmap\" for a customrouter-host-routes-<target> ConfigMap, "+
+			"an s3:// or gs:// URL (with --routes-bucket-endpoint and --routes-bucket-region) or an absolute "+
+			"directory, e.g. on a PersistentVolume. Empty disables it.")
+	flag.StringVar(&httpProxyTargets, "httpproxy-targets", "",
+		"Comma-separated targets whose routes are also written as Contour HTTPProxies. Suffix a target "+
+			"with '=only' to write HTTPProxies instead of route ConfigMaps (e.g. 'web,api=only').")
+	flag.BoolVar(&prometheusRules, "prometheus-rules", false,
+		"Write a customrouter-<target> PrometheusRule per target, in --routes-configmap-namespace, alerting "+
+			"on its route budget, route ConfigMap partitions and per-host route misses. "+
+			"Needs the Prometheus Operator CRDs.")
+	flag.Float64Var(&prometheusRuleOptions.BudgetRatio, "prometheus-rule-budget-ratio", 0.9,
+		"Alert when a target uses more than this fraction of --max-routes-per-target (0 disables the alert)")
+	flag.IntVar(&prometheusRuleOptions.MaxPartitions, "prometheus-rule-max-partitions", 8,
+		"Alert when a target is split into more route ConfigMaps than this (0 disables the alert)")
+	flag.Float64Var(&prometheusRuleOptions.MissRatio, "prometheus-rule-miss-ratio", 0.2,
+		"Alert when more than this fraction of the requests of a host match no route. Needs extprocs "+
+			"run with --host-metrics (0 disables the alert)")
+	flag.StringVar(&prometheusRuleOptions.For, "prometheus-rule-for", "15m",
+		"How long an alert condition must hold before the alert fires")
+	flag.StringVar(&prometheusRuleLabels, "prometheus-rule-labels", "",
+		"Comma-separated key=value labels added to every PrometheusRule, e.g. to match the ruleSelector "+
+			"of a Prometheus (\"release=kube-prometheus-stack\")")
+	flag.StringVar(&hostnameAutomationDomains, "hostname-automation-domains", "",
+		"Comma-separated domains whose hostnames (the domain and its subdomains) catch-all routes may ask "+
+			"DNS records and certificates for with catchAllRoute.hostnameAutomation. Empty disables it.")
+	flag.StringVar(&hostnameAutomationNamespace, "hostname-automation-namespace", "",
+		"Namespace of the generated DNSEndpoints and Certificates, the one the gateway reads certificate "+
+			"Secrets from. Defaults to --routes-configmap-namespace.")
+	flag.StringVar(&hostnameDNSTargets, "hostname-dns-targets", "",
+		"Comma-separated target=address pairs: the address the gateway of each target is reached at, "+
+			"an IP (A/AAAA records) or a hostname (CNAME). Targets not listed get no ExternalDNS DNSEndpoints.")
+	flag.StringVar(&hostnameCertificateIssuer, "hostname-certificate-issuer", "",
+		"cert-manager issuer of the generated Certificates, as [Issuer/|ClusterIssuer/]name. "+
+			"Empty writes no Certificates.")
+	flag.StringVar(&dryRunAddr, "dry-run-bind-address", "0",
+		"The address the CustomHTTPRoute dry-run expansion endpoint binds to (POST "+
+			customhttproute.DryRunPath+"). Set it to '0' to disable the endpoint.")
+	flag.BoolVar(&secureDryRun, "dry-run-secure", true,
+		"If set, dry-run callers must send a bearer token whose user can create CustomHTTPRoutes "+
+			"in the namespace of the submitted route. Use --dry-run-secure=false to serve it unauthenticated.")
+	flag.BoolVar(&expansionAnnotations, "expansion-annotations", false,
+		"Annotate every CustomHTTPRoute with the number and a hash of the routes it expands to, "+
+			"so GitOps tools show when a spec edit changes the generated routes.")
 	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
 		"Enable validating admission webhooks for hostname conflict detection")
 	flag.StringVar(&webhookConfigName, "webhook-config-name", "",
-		"Name of the ValidatingWebhookConfiguration to patch with the CA bundle (auto-cert mode)")
+		"Name of the ValidatingWebhookConfiguration to patch with the CA bundle (self-signed mode) "+
+			"or to check for cert-manager CA injection (cert-manager mode)")
 	flag.StringVar(&webhookServiceName, "webhook-service-name", "",
 		"Name of the webhook Service for TLS certificate SAN (auto-cert mode)")
 	flag.IntVar(&webhookPort, "webhook-port", 9443, "Port for the webhook server to listen on")
+	flag.BoolVar(&crdConversionWebhook, "crd-conversion-webhook", true,
+		"In auto-cert mode, point the CustomHTTPRoute CRD's conversion at the webhook server so "+
+			"v1alpha2 clients are served. Disable when the CRD conversion is managed elsewhere")
+	flag.IntVar(&policy.MaxHostnames, "policy-max-hostnames", 0,
+		"Admission policy: maximum hostnames per CustomHTTPRoute (0 = no limit beyond the CRD schema)")
+	flag.IntVar(&policy.MaxRules, "policy-max-rules", 0,
+		"Admission policy: maximum rules per CustomHTTPRoute (0 = no limit beyond the CRD schema)")
+	flag.IntVar(&policy.MaxNamespaceRoutes, "policy-max-namespace-routes", 0,
+		"Admission policy: maximum expanded routes across all CustomHTTPRoutes of a namespace (0 = unlimited)")
+	flag.StringVar(&policyAllowedTargets, "policy-allowed-targets", "",
+		"targetRef names allowed per namespace, as \"ns=target1,target2;*=default\", enforced by the webhook "+
+			"and the controller. \"*\" applies to unlisted namespaces; the namespace annotation "+
+			"customrouter.freepik.com/allowed-targets takes precedence; empty allows any target")
+	flag.BoolVar(&policy.WarnOnly, "policy-warn-only", false,
+		"Admission policy: return violations as warnings instead of rejecting the request")
 	opts := zap.Options{}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	shard, err := customhttproute.ParseTargetShard(targetShard)
+	if err != nil {
+		setupLog.Error(err, "invalid --target-shard")
+		os.Exit(1)
+	}
+	if shardName != "" {
+		if shard == nil {
+			setupLog.Error(nil, "--shard-name requires --target-shard")
+			os.Exit(1)
+		}
+		if err := customhttproute.ValidateShardName(shardName); err != nil {
+			setupLog.Error(err, "invalid --shard-name")
+			os.Exit(1)
+		}
+		shard.Name = shardName
+	}
+	leaderElectionID := customhttproute.LeaderElectionID(baseLeaderElectionID, shard)
+
+	allowedTargets, err := crv1alpha1.ParseTargetAllowList(policyAllowedTargets)
+	if err != nil {
+		setupLog.Error(err, "invalid --policy-allowed-targets")
+		os.Exit(1)
+	}
+	policy.AllowedTargets = allowedTargets
+
+	bands, err := routes.ParsePriorityBands(priorityBands, int32(defaultPriority))
+	if err != nil {
+		setupLog.Error(err, "invalid --default-priority or --priority-bands")
+		os.Exit(1)
+	}
+	routes.SetPriorityBands(bands)
+	if bands != routes.UniformPriorityBands(crv1alpha1.DefaultPriority) {
+		setupLog.Info("default match priorities", "bands", bands.String())
+	}
+
+	routesFormat := routes.EncodeOptions{Version: routesFormatVersion, Compress: routesCompression}
+	if err := routesFormat.Validate(); err != nil {
+		setupLog.Error(err, "invalid routes format flags")
+		os.Exit(1)
+	}
+	if err := customhttproute.ValidatePartitionStrategy(partitionStrategy, hostHashBuckets); err != nil {
+		setupLog.Error(err, "invalid partition flags")
+		os.Exit(1)
+	}
+	var routesSigningKey []byte
+	if routesSigningKeyFile != "" {
+		if routesSigningKey, err = routes.ReadSigningKey(routesSigningKeyFile); err != nil {
+			setupLog.Error(err, "invalid --routes-signing-key-file")
+			os.Exit(1)
+		}
+	}
+	var routesEncryptionKey []byte
+	if routesEncryptionKeyFile != "" {
+		if routesEncryptionKey, err = routes.ReadEncryptionKey(routesEncryptionKeyFile); err != nil {
+			setupLog.Error(err, "invalid --routes-encryption-key-file")
+			os.Exit(1)
+		}
+	} else if routesEncryptionTargets != "" {
+		setupLog.Error(nil, "--routes-encryption-targets requires --routes-encryption-key-file")
+		os.Exit(1)
+	}
+	if err := routes.ValidateMatchStrategy(matchStrategy); err != nil {
+		setupLog.Error(err, "invalid --match-strategy")
+		os.Exit(1)
+	}
+	matchStrategies, err := customhttproute.ParseMatchStrategyTargets(matchStrategyTargets)
+	if err != nil {
+		setupLog.Error(err, "invalid --match-strategy-targets")
+		os.Exit(1)
+	}
+	httpProxyModes, err := customhttproute.ParseHTTPProxyTargets(httpProxyTargets)
+	if err != nil {
+		setupLog.Error(err, "invalid --httpproxy-targets")
+		os.Exit(1)
+	}
+	var prometheusRuleConfig *customhttproute.PrometheusRuleOptions
+	if prometheusRules {
+		if prometheusRuleOptions.Labels, err = customhttproute.ParsePrometheusRuleLabels(prometheusRuleLabels); err != nil {
+			setupLog.Error(err, "invalid --prometheus-rule-labels")
+			os.Exit(1)
+		}
+		prometheusRuleConfig = &prometheusRuleOptions
+	}
+	var hostnameAutomation *customhttproute.HostnameAutomationOptions
+	if domains := customhttproute.ParseHostnameAutomationDomains(hostnameAutomationDomains); len(domains) > 0 {
+		hostnameAutomation = &customhttproute.HostnameAutomationOptions{
+			Domains:   domains,
+			Namespace: hostnameAutomationNamespace,
+		}
+		if hostnameAutomation.Namespace == "" {
+			hostnameAutomation.Namespace = routesConfigMapNamespace
+		}
+		if hostnameAutomation.DNSTargets, err = customhttproute.ParseHostnameDNSTargets(hostnameDNSTargets); err != nil {
+			setupLog.Error(err, "invalid --hostname-dns-targets")
+			os.Exit(1)
+		}
+		hostnameAutomation.IssuerKind, hostnameAutomation.IssuerName, err =
+			customhttproute.ParseCertificateIssuer(hostnameCertificateIssuer)
+		if err != nil {
+			setupLog.Error(err, "invalid --hostname-certificate-issuer")
+			os.Exit(1)
+		}
+	}
+	newBucket := func(url string) (objectstore.Bucket, error) {
+		bucketConfig := objectstore.ConfigFromEnv(url)
+		bucketConfig.Endpoint = routesBucketEndpoint
+		if routesBucketRegion != "" {
+			bucketConfig.Region = routesBucketRegion
+		}
+		return objectstore.New(bucketConfig)
+	}
+	var routesBucket objectstore.Bucket
+	if routesBucketURL != "" {
+		bucket, err := newBucket(routesBucketURL)
+		if err != nil {
+			setupLog.Error(err, "invalid routes bucket flags")
+			os.Exit(1)
+		}
+		routesBucket = bucket
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -135,28 +426,61 @@ func main() {
 		Port:    webhookPort,
 	}
 
-	if len(webhookCertPath) > 0 {
-		setupLog.Info("Initializing webhook certificate watcher using provided certificates",
-			"webhook-cert-path", webhookCertPath, "webhook-cert-name", webhookCertName, "webhook-cert-key", webhookCertKey)
-
-		webhookServerOptions.CertDir = webhookCertPath
-		webhookServerOptions.CertName = webhookCertName
-		webhookServerOptions.KeyName = webhookCertKey
+	certSource, err := customwebhook.ParseCertSource(webhookCertSource, webhookCertPath)
+	if err != nil {
+		setupLog.Error(err, "invalid webhook certificate configuration")
+		os.Exit(1)
 	}
 
-	// Auto-generate webhook TLS certificates when webhooks are enabled
-	// and no explicit cert path is provided (i.e., not using cert-manager).
 	cfg := ctrl.GetConfigOrDie()
 	var webhookCaPEM []byte
+	var webhookNamespace string
+	var conversionCRDs []string
+	var webhookCertWatcher *certwatcher.CertWatcher
+
+	if enableWebhooks && !certSource.PatchesCABundle() {
+		// Serve the mounted certificate through a watcher so a rotation of
+		// the Secret is picked up without a restart. The CA bundles belong
+		// to cert-manager's CA injector or whoever manages the Secret.
+		setupLog.Info("Initializing webhook certificate watcher using provided certificates",
+			"cert-source", certSource, "webhook-cert-path", webhookCertPath,
+			"webhook-cert-name", webhookCertName, "webhook-cert-key", webhookCertKey)
+
+		webhookCertWatcher, err = customwebhook.NewCertWatcher(webhookCertPath, webhookCertName, webhookCertKey)
+		if err != nil {
+			setupLog.Error(err, "unable to initialize webhook certificate watcher")
+			os.Exit(1)
+		}
+		webhookServerOptions.TLSOpts = append(slices.Clone(webhookServerOptions.TLSOpts), func(c *tls.Config) {
+			c.GetCertificate = webhookCertWatcher.GetCertificate
+		})
+
+		if certSource == customwebhook.CertSourceCertManager && webhookConfigName != "" {
+			directClient, err := client.New(cfg, client.Options{Scheme: scheme})
+			if err != nil {
+				setupLog.Error(err, "unable to create client for CA injection check")
+				os.Exit(1)
+			}
+			checkCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := customwebhook.CheckCAInjection(checkCtx, directClient, webhookConfigName); err != nil {
+				setupLog.Error(err, "webhook requests may fail TLS verification")
+			}
+			cancel()
+		}
+	}
 
-	if enableWebhooks && webhookCertPath == "" {
+	// Auto-generate webhook TLS certificates when webhooks are enabled
+	// and the certificate is self-signed.
+	if enableWebhooks && certSource.PatchesCABundle() {
 		if webhookConfigName == "" || webhookServiceName == "" {
 			setupLog.Error(nil,
 				"--webhook-config-name and --webhook-service-name are required "+
-					"in auto-cert mode (when --webhook-cert-path is not set)")
+					"in self-signed mode (--webhook-cert-source=self-signed)")
 			os.Exit(1)
 		}
-		webhookCertPath = "/tmp/k8s-webhook-server/serving-certs"
+		if webhookCertPath == "" {
+			webhookCertPath = "/tmp/k8s-webhook-server/serving-certs"
+		}
 		setupLog.Info("Auto-generating webhook TLS certificates",
 			"cert-dir", webhookCertPath,
 			"webhook-config-name", webhookConfigName,
@@ -169,13 +493,16 @@ func main() {
 			os.Exit(1)
 		}
 
-		ns := customwebhook.GetNamespace()
+		webhookNamespace = customwebhook.GetNamespace()
+		if crdConversionWebhook {
+			conversionCRDs = []string{customwebhook.CustomHTTPRouteCRDName}
+		}
 		webhookCaPEM, err = func() ([]byte, error) {
 			certCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 			return customwebhook.EnsureCerts(
 				certCtx, directClient, webhookCertPath,
-				webhookConfigName, webhookServiceName, ns,
+				webhookConfigName, webhookServiceName, webhookNamespace, conversionCRDs,
 			)
 		}()
 		if err != nil {
@@ -226,13 +553,26 @@ func main() {
 		metricsServerOptions.KeyName = metricsCertKey
 	}
 
+	// Deployments are only read to resolve gatewayRef.name, so cache just the
+	// ones Istio manages for Gateway API Gateways.
+	gatewayDeployments, err := labels.Parse(crv1alpha1.GatewayNameLabel)
+	if err != nil {
+		setupLog.Error(err, "unable to build Gateway Deployment selector")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&appsv1.Deployment{}: {Label: gatewayDeployments},
+			},
+		},
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "495e98d5.customrouter.freepik.com",
+		LeaderElectionID:       leaderElectionID,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -250,27 +590,88 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := (&customhttproute.CustomHTTPRouteReconciler{
+	var hostFiles customhttproute.HostFilesSink
+	if hostRouteFiles != "" {
+		hostFiles, err = customhttproute.NewHostFilesSink(hostRouteFiles, mgr.GetClient(), routesConfigMapNamespace, newBucket)
+		if err != nil {
+			setupLog.Error(err, "invalid --host-route-files")
+			os.Exit(1)
+		}
+	}
+
+	routeReconciler := &customhttproute.CustomHTTPRouteReconciler{
 		Client:                  mgr.GetClient(),
 		Scheme:                  mgr.GetScheme(),
 		ConfigMapNamespace:      routesConfigMapNamespace,
 		MaxConcurrentReconciles: maxConcurrentReconciles,
 		RebuildCooldown:         rebuildCooldown,
-	}).SetupWithManager(mgr); err != nil {
+		RoutesFormat:            routesFormat,
+		AllowedTargets:          allowedTargets,
+		OmitRouteSource:         omitRouteSource,
+		InsecureDryRun:          !secureDryRun,
+		RoutesGzipThreshold:     routesGzipThreshold,
+		PartitionStrategy:       partitionStrategy,
+		HostHashBuckets:         hostHashBuckets,
+		RoutesBucket:            routesBucket,
+		HostFiles:               hostFiles,
+		MaxRoutesPerTarget:      maxRoutesPerTarget,
+		RoutesSigningKey:        routesSigningKey,
+		RoutesEncryptionKey:     routesEncryptionKey,
+		RoutesEncryptionTargets: customhttproute.ParseRoutesEncryptionTargets(routesEncryptionTargets),
+		MatchStrategy:           matchStrategy,
+		MatchStrategyTargets:    matchStrategies,
+		HTTPProxyTargets:        httpProxyModes,
+		PrometheusRules:         prometheusRuleConfig,
+		HostnameAutomation:      hostnameAutomation,
+		Recorder:                mgr.GetEventRecorderFor("customhttproute-controller"),
+		ExpansionAnnotations:    expansionAnnotations,
+		Shard:                   shard,
+	}
+	if shard != nil {
+		// Without leader election there are no Leases to tell a running
+		// shard from a stopped one, so overlapping shards go unnoticed.
+		if enableLeaderElection {
+			routeReconciler.ShardLeases = &customhttproute.ShardLeases{
+				Reader:           mgr.GetAPIReader(),
+				Namespace:        customwebhook.GetNamespace(),
+				LeaderElectionID: baseLeaderElectionID,
+			}
+		}
+		setupLog.Info("controller sharded by target", "shard", shard.Name, "targetShard", shard.String())
+	}
+	if err := routeReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CustomHTTPRoute")
 		os.Exit(1)
 	}
-	if err := (&externalprocessorattachment.ExternalProcessorAttachmentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "ExternalProcessorAttachment")
-		os.Exit(1)
+	if dryRunAddr != "0" && dryRunAddr != "" {
+		// Served by every replica, not only the leader: the endpoint only
+		// reads from the cache, besides reviewing its callers' tokens.
+		if err := mgr.Add(&manager.Server{
+			Name: "dry-run",
+			Server: &http.Server{
+				Addr:              dryRunAddr,
+				Handler:           routeReconciler.DryRunHandler(),
+				ReadHeaderTimeout: 10 * time.Second,
+			},
+		}); err != nil {
+			setupLog.Error(err, "unable to add dry-run server")
+			os.Exit(1)
+		}
+		setupLog.Info("dry-run endpoint enabled", "address", dryRunAddr, "path", customhttproute.DryRunPath)
+	}
+	if reconcileAttachments {
+		if err := (&externalprocessorattachment.ExternalProcessorAttachmentReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ExternalProcessorAttachment")
+			os.Exit(1)
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
 	if enableWebhooks {
-		if err := customwebhook.SetupCustomHTTPRouteWebhookWithManager(mgr); err != nil {
+		if err := customwebhook.SetupCustomHTTPRouteWebhookWithManager(mgr, &policy); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "CustomHTTPRoute")
 			os.Exit(1)
 		}
@@ -280,14 +681,24 @@ func main() {
 			&admission.Webhook{Handler: customwebhook.NewHTTPRouteValidator(mgr.GetClient())},
 		)
 
+		if webhookCertWatcher != nil {
+			if err := mgr.Add(webhookCertWatcher); err != nil {
+				setupLog.Error(err, "unable to add webhook certificate watcher")
+				os.Exit(1)
+			}
+		}
+
 		// In auto-cert mode, periodically reconcile the CA bundle in case
 		// a Helm upgrade or external change wipes it.
 		if webhookCaPEM != nil {
 			if err := mgr.Add(&customwebhook.CABundleReconciler{
-				Client:     mgr.GetClient(),
-				ConfigName: webhookConfigName,
-				CaPEM:      webhookCaPEM,
-				Interval:   60 * time.Second,
+				Client:         mgr.GetClient(),
+				ConfigName:     webhookConfigName,
+				CaPEM:          webhookCaPEM,
+				Interval:       60 * time.Second,
+				ConversionCRDs: conversionCRDs,
+				ServiceName:    webhookServiceName,
+				Namespace:      webhookNamespace,
 			}); err != nil {
 				setupLog.Error(err, "unable to add CA bundle reconciler")
 				os.Exit(1)
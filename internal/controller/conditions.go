@@ -34,10 +34,24 @@ const (
 	ConditionReasonConfigMapError        = "ConfigMapSyncError"
 	ConditionReasonConfigMapErrorMessage = "Failed to generate or sync ConfigMap"
 
+	// ConditionReasonRouteBudgetExceeded indicates the route was left out of its target's ConfigMaps
+	// because it does not fit in the target's route budget
+	ConditionReasonRouteBudgetExceeded = "RouteBudgetExceeded"
+
+	// ConditionReasonTargetNotAllowed indicates the route was left out of its target's ConfigMaps
+	// because its namespace does not allow the target
+	ConditionReasonTargetNotAllowed = "TargetNotAllowed"
+
 	// ConditionReasonCatchAllProgrammed indicates the catchAllRoute is applied on at least one EPA
 	ConditionReasonCatchAllProgrammed        = "Programmed"
 	ConditionReasonCatchAllProgrammedMessage = "catchAllRoute is applied to the dataplane"
 
+	// ConditionReasonCatchAllTLSPassthrough indicates the catchAllRoute is applied as TLS
+	// passthrough, so the route's rules cannot apply to its hostnames
+	ConditionReasonCatchAllTLSPassthrough        = "ProgrammedTLSPassthrough"
+	ConditionReasonCatchAllTLSPassthroughMessage = "catchAllRoute forwards TLS connections to backendRef by SNI; " +
+		"rules do not apply to TLS passthrough hostnames"
+
 	// ConditionReasonCatchAllNotConfigured indicates the route has no catchAllRoute in its spec
 	ConditionReasonCatchAllNotConfigured        = "NotConfigured"
 	ConditionReasonCatchAllNotConfiguredMessage = "Route has no catchAllRoute configured"
@@ -53,4 +67,34 @@ const (
 	// ConditionReasonCatchAllOverriddenByRoute indicates another CustomHTTPRoute wins the dedup for all hostnames
 	ConditionReasonCatchAllOverriddenByRoute        = "OverriddenByRoute"
 	ConditionReasonCatchAllOverriddenByRouteMessage = "catchAllRoute is overridden by another CustomHTTPRoute for the same hostname"
+
+	// ConditionReasonBackendsResolved indicates every backendRef points to an existing Service and port
+	ConditionReasonBackendsResolved        = "ResolvedRefs"
+	ConditionReasonBackendsResolvedMessage = "All backendRefs resolve to existing Services"
+
+	// ConditionReasonBackendNotFound indicates at least one backendRef points to a missing Service or port
+	ConditionReasonBackendNotFound = "BackendNotFound"
+
+	// ConditionReasonRoutesShadowed indicates at least one route can never match because an earlier
+	// route of its host matches every request it would
+	ConditionReasonRoutesShadowed = "RoutesShadowed"
+
+	// ConditionReasonNoShadowedRoutes indicates every route can match some request
+	ConditionReasonNoShadowedRoutes        = "NoShadowedRoutes"
+	ConditionReasonNoShadowedRoutesMessage = "No route is shadowed by an earlier route of its host"
+
+	// ConditionReasonHTTPProxyRoutesSkipped indicates at least one route uses a feature Contour
+	// HTTPProxies cannot express and is not served through them
+	ConditionReasonHTTPProxyRoutesSkipped = "RoutesSkipped"
+
+	// ConditionReasonAllRoutesExpressed indicates every route is served through the HTTPProxies
+	ConditionReasonAllRoutesExpressed        = "AllRoutesExpressed"
+	ConditionReasonAllRoutesExpressedMessage = "Every route is expressed in the HTTPProxies"
+
+	// ConditionReasonRulesExpired indicates at least one rule is past its expiresAt
+	ConditionReasonRulesExpired = "RulesExpired"
+
+	// ConditionReasonNoExpiredRules indicates no rule is past its expiresAt
+	ConditionReasonNoExpiredRules        = "NoExpiredRules"
+	ConditionReasonNoExpiredRulesMessage = "No rule is past its expiresAt"
 )
@@ -0,0 +1,106 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// serviceBackendRefs returns every backendRef of the route that points to an
+// in-cluster Service: backends of enabled rules, overrideHeader variants, mirror and
+// require-auth targets and the catchAllRoute backend. Names containing a dot
+// are external hostnames and are skipped. Duplicates are removed, preserving
+// first-seen order.
+func serviceBackendRefs(route *v1alpha1.CustomHTTPRoute) []v1alpha1.BackendRef {
+	var refs []v1alpha1.BackendRef
+	seen := make(map[v1alpha1.BackendRef]bool)
+	add := func(ref v1alpha1.BackendRef) {
+		if strings.Contains(ref.Name, ".") || seen[ref] {
+			return
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+
+	for _, rule := range route.Spec.ActiveRules() {
+		for _, ref := range rule.BackendRefs {
+			add(ref)
+		}
+		for _, action := range rule.Actions {
+			if action.Mirror != nil {
+				add(action.Mirror.BackendRef)
+			}
+			if action.Auth != nil {
+				add(action.Auth.BackendRef)
+			}
+		}
+	}
+	if route.Spec.OverrideHeader != nil {
+		for _, variant := range route.Spec.OverrideHeader.Variants {
+			add(variant.BackendRef)
+		}
+	}
+	if route.Spec.CatchAllRoute != nil {
+		add(route.Spec.CatchAllRoute.BackendRef)
+	}
+	return refs
+}
+
+// ResolveBackends checks that every in-cluster backendRef of the route names
+// an existing Service exposing the referenced port, and returns a description
+// of each one that does not. ExternalName Services accept any port, since
+// they carry no port list. API errors other than NotFound are returned so the
+// condition is not flipped on a transient failure.
+func (r *CustomHTTPRouteReconciler) ResolveBackends(
+	ctx context.Context,
+	route *v1alpha1.CustomHTTPRoute,
+) ([]string, error) {
+	var unresolved []string
+	for _, ref := range serviceBackendRefs(route) {
+		svc := &corev1.Service{}
+		err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: ref.Namespace}, svc)
+		if apierrors.IsNotFound(err) {
+			unresolved = append(unresolved, fmt.Sprintf("Service %s/%s not found", ref.Namespace, ref.Name))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Service %s/%s: %w", ref.Namespace, ref.Name, err)
+		}
+		if svc.Spec.Type == corev1.ServiceTypeExternalName || serviceHasPort(svc, ref.Port) {
+			continue
+		}
+		unresolved = append(unresolved, fmt.Sprintf("Service %s/%s has no port %d", ref.Namespace, ref.Name, ref.Port))
+	}
+	return unresolved, nil
+}
+
+func serviceHasPort(svc *corev1.Service, port int32) bool {
+	for _, p := range svc.Spec.Ports {
+		if p.Port == port {
+			return true
+		}
+	}
+	return false
+}
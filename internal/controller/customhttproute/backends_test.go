@@ -0,0 +1,145 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/internal/controller"
+)
+
+func testService(name string, svcType corev1.ServiceType, ports ...int32) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: name},
+		Spec:       corev1.ServiceSpec{Type: svcType},
+	}
+	for _, p := range ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Port: p})
+	}
+	return svc
+}
+
+func routeWithBackends(refs ...v1alpha1.BackendRef) *v1alpha1.CustomHTTPRoute {
+	return &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: "route"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Rules: []v1alpha1.Rule{{BackendRefs: refs}},
+		},
+	}
+}
+
+func TestResolveBackends(t *testing.T) {
+	ref := func(name string, port int32) v1alpha1.BackendRef {
+		return v1alpha1.BackendRef{Name: name, Namespace: testNS, Port: port}
+	}
+
+	tests := []struct {
+		name  string
+		route *v1alpha1.CustomHTTPRoute
+		want  []string
+	}{
+		{name: "existing service and port", route: routeWithBackends(ref("api", 8080))},
+		{
+			name:  "missing service",
+			route: routeWithBackends(ref("api", 8080), ref("gone", 80)),
+			want:  []string{"Service ns/gone not found"},
+		},
+		{
+			name:  "missing port",
+			route: routeWithBackends(ref("api", 9999)),
+			want:  []string{"Service ns/api has no port 9999"},
+		},
+		{name: "ExternalName accepts any port", route: routeWithBackends(ref("legacy", 443))},
+		{name: "external hostname is not checked", route: routeWithBackends(ref("api.example.com", 443))},
+		{
+			name: "variant, mirror and catch-all backends",
+			route: func() *v1alpha1.CustomHTTPRoute {
+				route := routeWithBackends(ref("api", 8080))
+				route.Spec.Rules[0].Actions = []v1alpha1.Action{{
+					Type:   v1alpha1.ActionTypeRequestMirror,
+					Mirror: &v1alpha1.MirrorConfig{BackendRef: ref("shadow", 80)},
+				}}
+				route.Spec.OverrideHeader = &v1alpha1.OverrideHeader{
+					Variants: []v1alpha1.RouteVariant{{Name: "dev", BackendRef: ref("api-dev", 8080)}},
+				}
+				route.Spec.CatchAllRoute = &v1alpha1.CatchAllBackendRef{BackendRef: ref("api", 8080)}
+				return route
+			}(),
+			want: []string{"Service ns/shadow not found", "Service ns/api-dev not found"},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(
+		testService("api", corev1.ServiceTypeClusterIP, 80, 8080),
+		testService("legacy", corev1.ServiceTypeExternalName),
+	).Build()
+	r := &CustomHTTPRouteReconciler{Client: c}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.ResolveBackends(context.Background(), tt.route)
+			if err != nil {
+				t.Fatalf("ResolveBackends: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unresolved = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateConditionBackendsResolved(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{}
+	route := routeWithBackends()
+
+	r.UpdateConditionBackendsResolved(route, []string{"Service ns/a not found", "Service ns/b has no port 80"})
+	cond := meta.FindStatusCondition(route.Status.Conditions, v1alpha1.ConditionTypeBackendsResolved)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != controller.ConditionReasonBackendNotFound {
+		t.Fatalf("expected BackendNotFound condition, got %+v", cond)
+	}
+	if cond.Message != "Service ns/a not found; Service ns/b has no port 80" {
+		t.Errorf("message = %q", cond.Message)
+	}
+
+	r.UpdateConditionBackendsResolved(route, nil)
+	cond = meta.FindStatusCondition(route.Status.Conditions, v1alpha1.ConditionTypeBackendsResolved)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != controller.ConditionReasonBackendsResolved {
+		t.Errorf("expected ResolvedRefs condition, got %+v", cond)
+	}
+}
+
+func TestRouteReferencesServiceCoversAllBackends(t *testing.T) {
+	route := routeWithBackends(v1alpha1.BackendRef{Name: "api", Namespace: testNS, Port: 80})
+	route.Spec.CatchAllRoute = &v1alpha1.CatchAllBackendRef{
+		BackendRef: v1alpha1.BackendRef{Name: "fallback", Namespace: testNS, Port: 80},
+	}
+
+	if !routeReferencesService(route, "fallback", testNS) {
+		t.Error("a catch-all backend Service must enqueue the route")
+	}
+	if routeReferencesService(route, "fallback", "other") {
+		t.Error("a Service in another namespace must not enqueue the route")
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// expandedRoute is a CustomHTTPRoute with the routes it generates.
+type expandedRoute struct {
+	route  *v1alpha1.CustomHTTPRoute
+	hosts  map[string][]routes.Route
+	routes int
+}
+
+// applyRouteBudget enforces MaxRoutesPerTarget on the expanded routes of a
+// target. CustomHTTPRoutes are admitted oldest first (by creation time, then
+// namespace/name), so routes that are already being served keep their place
+// and the one that pushes the target over its budget is the one left out.
+// A CustomHTTPRoute is admitted or excluded as a whole; a later, smaller
+// one can still fit after a larger one was excluded.
+//
+// The admitted routes keep their input order. The second return value maps
+// every excluded CustomHTTPRoute to the reason, for its status.
+func (r *CustomHTTPRouteReconciler) applyRouteBudget(
+	target string,
+	expanded []expandedRoute,
+) ([]expandedRoute, map[types.NamespacedName]string) {
+	budget := r.MaxRoutesPerTarget
+	if budget <= 0 {
+		return expanded, nil
+	}
+
+	order := make([]int, len(expanded))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := expanded[order[a]].route, expanded[order[b]].route
+		if !ra.CreationTimestamp.Equal(&rb.CreationTimestamp) {
+			return ra.CreationTimestamp.Before(&rb.CreationTimestamp)
+		}
+		if ra.Namespace != rb.Namespace {
+			return ra.Namespace < rb.Namespace
+		}
+		return ra.Name < rb.Name
+	})
+
+	admitted := make([]bool, len(expanded))
+	var excluded map[types.NamespacedName]string
+	used := 0
+	for _, i := range order {
+		e := expanded[i]
+		if used+e.routes <= budget {
+			admitted[i] = true
+			used += e.routes
+			continue
+		}
+		if excluded == nil {
+			excluded = make(map[types.NamespacedName]string)
+		}
+		excluded[types.NamespacedName{Namespace: e.route.Namespace, Name: e.route.Name}] = fmt.Sprintf(
+			"route budget of target %s exceeded: this route generates %d routes and %d of %d are in use; "+
+				"its routes are not served",
+			target, e.routes, used, budget)
+	}
+
+	out := make([]expandedRoute, 0, len(expanded))
+	for i, e := range expanded {
+		if admitted[i] {
+			out = append(out, e)
+		}
+	}
+	return out, excluded
+}
+
+// setRouteBudgetExclusions records the CustomHTTPRoutes of target left out by
+// the last rebuild, replacing the previous set. Routes that entered or left
+// the set are enqueued: a change of another route of the target can push
+// them out of the budget or let them back in, and only their own reconcile
+// updates their RouteBudgetExceeded condition.
+func (r *CustomHTTPRouteReconciler) setRouteBudgetExclusions(
+	ctx context.Context,
+	target string,
+	excluded map[types.NamespacedName]string,
+) {
+	r.budgetMu.Lock()
+	previous := r.budgetExclusions[target]
+	if len(excluded) == 0 {
+		delete(r.budgetExclusions, target)
+	} else {
+		if r.budgetExclusions == nil {
+			r.budgetExclusions = make(map[string]map[types.NamespacedName]string)
+		}
+		r.budgetExclusions[target] = excluded
+	}
+	r.budgetMu.Unlock()
+
+	for _, key := range budgetChanges(previous, excluded) {
+		r.enqueueBudgetChange(ctx, key)
+	}
+}
+
+// budgetChanges returns the CustomHTTPRoutes excluded in exactly one of the
+// two sets, sorted by namespace/name.
+func budgetChanges(previous, current map[types.NamespacedName]string) []types.NamespacedName {
+	var changed []types.NamespacedName
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	for key := range current {
+		if _, ok := previous[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].String() < changed[j].String() })
+	return changed
+}
+
+// enqueueBudgetChange reconciles the given CustomHTTPRoute so its status
+// reflects the route budget. It is a no-op before SetupWithManager, and gives
+// up when ctx is done so a shutdown does not wait on the stopped watch.
+func (r *CustomHTTPRouteReconciler) enqueueBudgetChange(ctx context.Context, key types.NamespacedName) {
+	if r.budgetEvents == nil {
+		return
+	}
+	select {
+	case r.budgetEvents <- event.GenericEvent{Object: &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+	}}:
+	case <-ctx.Done():
+	}
+}
+
+// routeBudgetExclusion returns why the last rebuild of target left the given
+// CustomHTTPRoute out, or "" when its routes are being served.
+func (r *CustomHTTPRouteReconciler) routeBudgetExclusion(target string, key types.NamespacedName) string {
+	r.budgetMu.Lock()
+	defer r.budgetMu.Unlock()
+	return r.budgetExclusions[target][key]
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func budgetRoute(name string, created time.Time, paths ...string) *v1alpha1.CustomHTTPRoute {
+	matches := make([]v1alpha1.PathMatch, 0, len(paths))
+	for _, p := range paths {
+		matches = append(matches, v1alpha1.PathMatch{Path: p, Type: v1alpha1.MatchTypeExact})
+	}
+	return &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "ns",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{name + ".example.com"},
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Rules: []v1alpha1.Rule{{
+				BackendRefs: []v1alpha1.BackendRef{{Name: "svc", Namespace: "ns", Port: 80}},
+				Matches:     matches,
+			}},
+		},
+	}
+}
+
+func TestApplyRouteBudget(t *testing.T) {
+	now := time.Now()
+	// Input in namespace/name order, as rebuildConfigMapsForTarget passes it.
+	expanded := []expandedRoute{
+		{route: budgetRoute("a-newest", now), routes: 2},
+		{route: budgetRoute("b-oldest", now.Add(-2*time.Hour)), routes: 3},
+		{route: budgetRoute("c-middle", now.Add(-time.Hour)), routes: 4},
+		{route: budgetRoute("d-small", now.Add(time.Hour)), routes: 1},
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		r := &CustomHTTPRouteReconciler{}
+		admitted, excluded := r.applyRouteBudget("default", expanded)
+		if len(admitted) != len(expanded) || excluded != nil {
+			t.Fatalf("got %d admitted, %v excluded; want everything admitted", len(admitted), excluded)
+		}
+	})
+
+	t.Run("oldest first", func(t *testing.T) {
+		r := &CustomHTTPRouteReconciler{MaxRoutesPerTarget: 8}
+		admitted, excluded := r.applyRouteBudget("default", expanded)
+
+		// b (3) + c (4) fit; a (2) would make 9; d (1) still fits.
+		var names []string
+		for _, e := range admitted {
+			names = append(names, e.route.Name)
+		}
+		if got := strings.Join(names, ","); got != "b-oldest,c-middle,d-small" {
+			t.Errorf("admitted = %s, want b-oldest,c-middle,d-small in input order", got)
+		}
+		reason := excluded[types.NamespacedName{Namespace: "ns", Name: "a-newest"}]
+		if len(excluded) != 1 || !strings.Contains(reason, "generates 2 routes and 7 of 8 are in use") {
+			t.Errorf("excluded = %v, want a-newest with its usage", excluded)
+		}
+	})
+}
+
+func TestRebuildEnforcesRouteBudget(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	older := budgetRoute("older", now.Add(-time.Hour), "/a", "/b")
+	newer := budgetRoute("newer", now, "/c", "/d")
+	r := newReconciler(older, newer)
+	r.MaxRoutesPerTarget = 3
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+
+	cms := &corev1.ConfigMapList{}
+	if err := r.List(ctx, cms, client.InNamespace("test-ns"), client.MatchingLabels{configMapTargetLabel: "default"}); err != nil {
+		t.Fatalf("failed to list ConfigMaps: %v", err)
+	}
+	if len(cms.Items) != 1 {
+		t.Fatalf("expected 1 ConfigMap, got %d", len(cms.Items))
+	}
+	cm := cms.Items[0]
+	if strings.Contains(cm.Data[routesDataKey], "newer.example.com") {
+		t.Error("routes of the CustomHTTPRoute over budget were written")
+	}
+	if !strings.Contains(cm.Data[routesDataKey], "older.example.com") {
+		t.Error("routes of the CustomHTTPRoute within budget are missing")
+	}
+	if cm.Annotations[routesCountAnnotation] != "2" || cm.Annotations[routeBudgetAnnotation] != "3" {
+		t.Errorf("annotations = %v, want 2 routes of a budget of 3", cm.Annotations)
+	}
+
+	if reason := r.routeBudgetExclusion("default", types.NamespacedName{Namespace: "ns", Name: "newer"}); reason == "" {
+		t.Error("expected the newer CustomHTTPRoute to be reported over budget")
+	}
+	if reason := r.routeBudgetExclusion("default", types.NamespacedName{Namespace: "ns", Name: "older"}); reason != "" {
+		t.Errorf("older CustomHTTPRoute reported over budget: %s", reason)
+	}
+
+	// Raising the budget admits it again and clears the exclusion.
+	r.MaxRoutesPerTarget = 4
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if reason := r.routeBudgetExclusion("default", types.NamespacedName{Namespace: "ns", Name: "newer"}); reason != "" {
+		t.Errorf("CustomHTTPRoute still reported over budget after raising it: %s", reason)
+	}
+}
+
+func TestRebuildEnqueuesRoutesWhoseBudgetChanged(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	older := budgetRoute("older", base, "/a")
+	newer := budgetRoute("newer", base.Add(time.Hour), "/b", "/c")
+	r := newReconciler(older, newer)
+	r.MaxRoutesPerTarget = 2
+	r.budgetEvents = make(chan event.GenericEvent, 10)
+
+	enqueued := func() []string {
+		var names []string
+		for len(r.budgetEvents) > 0 {
+			e := <-r.budgetEvents
+			names = append(names, e.Object.GetNamespace()+"/"+e.Object.GetName())
+		}
+		return names
+	}
+
+	// "newer" only leaves the route table because "older" was there first:
+	// its own reconcile is not what excluded it.
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if got := enqueued(); len(got) != 1 || got[0] != "ns/newer" {
+		t.Errorf("enqueued %v after the exclusion, want [ns/newer]", got)
+	}
+
+	// An unchanged result enqueues nothing.
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if got := enqueued(); len(got) != 0 {
+		t.Errorf("enqueued %v without a budget change", got)
+	}
+
+	// Deleting "older" lets "newer" back in.
+	if err := r.Delete(ctx, older); err != nil {
+		t.Fatalf("failed to delete CustomHTTPRoute: %v", err)
+	}
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if got := enqueued(); len(got) != 1 || got[0] != "ns/newer" {
+		t.Errorf("enqueued %v after the admission, want [ns/newer]", got)
+	}
+}
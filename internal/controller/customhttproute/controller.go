@@ -19,6 +19,7 @@ package customhttproute
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -26,18 +27,25 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	crv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
 	"github.com/freepik-company/customrouter/internal/controller"
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
 const targetRefIndexField = ".spec.targetRef.name"
@@ -54,6 +62,36 @@ const DefaultRebuildCooldown = 2 * time.Second
 // the controller lifetime when targets are created and deleted repeatedly.
 const DefaultStateGCInterval = 1 * time.Hour
 
+// Partition strategies for the route ConfigMaps of a target.
+const (
+	// PartitionStrategySize packs hosts into as few ConfigMaps as fit under
+	// the size limit (the historical behavior).
+	PartitionStrategySize = "size"
+
+	// PartitionStrategyHostHash assigns each hostname to one of a fixed
+	// number of ConfigMaps by hashing it, so a change to one hostname only
+	// rewrites (and makes the extprocs re-parse) its own bucket.
+	PartitionStrategyHostHash = "host-hash"
+)
+
+// DefaultHostHashBuckets is the number of ConfigMaps per target used by the
+// host-hash partition strategy when HostHashBuckets is zero.
+const DefaultHostHashBuckets = 64
+
+// ValidatePartitionStrategy checks a --partition-strategy flag value.
+func ValidatePartitionStrategy(strategy string, buckets int) error {
+	switch strategy {
+	case "", PartitionStrategySize, PartitionStrategyHostHash:
+	default:
+		return fmt.Errorf("unknown partition strategy %q (want %q or %q)",
+			strategy, PartitionStrategySize, PartitionStrategyHostHash)
+	}
+	if buckets < 0 {
+		return fmt.Errorf("host-hash bucket count must not be negative, got %d", buckets)
+	}
+	return nil
+}
+
 // CustomHTTPRouteReconciler reconciles a CustomHTTPRoute object
 type CustomHTTPRouteReconciler struct {
 	client.Client
@@ -72,6 +110,114 @@ type CustomHTTPRouteReconciler struct {
 	// the periodic GC entirely (useful in tests).
 	StateGCInterval time.Duration
 
+	// RoutesFormat selects the wire format of the route ConfigMaps. The zero
+	// value writes format v1, which every extproc version can read; switch to
+	// v2 (and compression) only once all extprocs understand it.
+	RoutesFormat routes.EncodeOptions
+
+	// AllowedTargets restricts the targets of the CustomHTTPRoutes of
+	// namespaces without the crv1alpha1.AllowedTargetsAnnotation, like the
+	// webhook does; routes a namespace may not use are left out of their
+	// target's ConfigMaps. Nil leaves such namespaces unrestricted.
+	AllowedTargets crv1alpha1.TargetAllowList
+
+	// RoutesGzipThreshold, when positive, writes the routes document of a
+	// ConfigMap larger than this many bytes gzip-compressed under the
+	// routes.CompressedRoutesDataKey binaryData key. A target that only
+	// fits in one ConfigMap compressed is then not split.
+	RoutesGzipThreshold int
+
+	// PartitionStrategy selects how a target's routes are split into
+	// ConfigMaps: PartitionStrategySize (default when empty) or
+	// PartitionStrategyHostHash.
+	PartitionStrategy string
+
+	// HostHashBuckets is the number of ConfigMaps hostnames are hashed into
+	// under PartitionStrategyHostHash. When zero, DefaultHostHashBuckets is
+	// used.
+	HostHashBuckets int
+
+	// RoutesBucket, when set, receives the merged routes of every target as
+	// one object (see publishRoutes), for consumers that cannot read the
+	// ConfigMaps. Nil disables publishing.
+	RoutesBucket objectstore.Bucket
+
+	// HostFiles, when set, receives the routes of every target as one file
+	// per host (see writeHostFiles), for reviewing route changes as diffs in
+	// GitOps pipelines. Nil disables it.
+	HostFiles HostFilesSink
+
+	// OmitRouteSource leaves the CustomHTTPRoute and rule each route was
+	// expanded from out of the v2 route documents (see
+	// routes.StripRouteSource), keeping only the opaque route id.
+	OmitRouteSource bool
+
+	// InsecureDryRun serves DryRunHandler without authenticating or
+	// authorizing its callers.
+	InsecureDryRun bool
+
+	// MaxRoutesPerTarget caps the number of routes in the merged route table
+	// of a target (see applyRouteBudget). Zero or negative means unlimited.
+	MaxRoutesPerTarget int
+
+	// RoutesSigningKey, when set, signs every route ConfigMap with
+	// routes.SignConfigMap so extprocs sharing the key only load ConfigMaps
+	// written by the controller.
+	RoutesSigningKey []byte
+
+	// RoutesEncryptionKey, when set, encrypts the routes of the targets in
+	// RoutesEncryptionTargets with routes.EncryptConfigMap, under the
+	// routes.EncryptedRoutesDataKey binaryData key, for extprocs given the
+	// same key.
+	RoutesEncryptionKey []byte
+
+	// RoutesEncryptionTargets lists the targets whose route ConfigMaps are
+	// encrypted with RoutesEncryptionKey. Nil encrypts every target.
+	RoutesEncryptionTargets map[string]bool
+
+	// MatchStrategy is the match strategy of targets not listed in
+	// MatchStrategyTargets (one of the routes.MatchStrategy* constants).
+	// Empty means routes.MatchStrategyFirstMatch.
+	MatchStrategy string
+
+	// MatchStrategyTargets overrides MatchStrategy per target name.
+	MatchStrategyTargets map[string]string
+
+	// HTTPProxyTargets lists the targets whose routes are also, or only,
+	// written as Contour HTTPProxies (see syncHTTPProxies). Targets not
+	// listed only get ConfigMaps.
+	HTTPProxyTargets map[string]HTTPProxyMode
+
+	// PrometheusRules, when set, writes a PrometheusRule alerting on the
+	// route budget, partitions and per-host route misses of every target
+	// (see syncPrometheusRule). Nil disables it.
+	PrometheusRules *PrometheusRuleOptions
+
+	// HostnameAutomation, when set, writes DNSEndpoints and Certificates
+	// for the hostnames of catch-all routes that ask for them (see
+	// syncHostnameAutomation). Nil disables it.
+	HostnameAutomation *HostnameAutomationOptions
+
+	// Recorder records the Events of CustomHTTPRoutes, e.g. their expansion
+	// warnings. Nil records none.
+	Recorder record.EventRecorder
+
+	// Shard, when set, restricts the controller to the targets it owns
+	// (--target-shard), so several controller deployments split the targets
+	// between them. Nil owns every target.
+	Shard *TargetShard
+
+	// ExpansionAnnotations, when true, annotates every CustomHTTPRoute with
+	// the number and a hash of the routes it expands to (see
+	// expansionannotations.go), so GitOps diffs show when a spec edit
+	// changes the generated routes.
+	ExpansionAnnotations bool
+
+	// ShardLeases, when set, lets a rebuild check the ConfigMaps of its
+	// target against the leader election Leases of the other shards (see
+	// checkShardOwnership). Nil, without leader election, checks nothing.
+	ShardLeases *ShardLeases
+
 	// lastRebuildAt records the last successful rebuild time per target name.
 	// Read/written under rebuildMu.
 	lastRebuildAt map[string]time.Time
@@ -92,6 +238,61 @@ type CustomHTTPRouteReconciler struct {
 	// concurrently — each expands the entire route set, so N concurrent rebuilds
 	// multiply peak memory N-fold and can OOM the operator. Guarded by rebuildMu.
 	rebuilding map[string]bool
+
+	// publishedChecksums caches the checksum of the last routes object
+	// published to RoutesBucket per target, so unchanged routes are not
+	// uploaded on every rebuild. Guarded by publishedMu.
+	publishedChecksums map[string]string
+	publishedMu        sync.Mutex
+
+	// hostFilesChecksums caches, per target, a checksum of the host files
+	// last written to HostFiles. Guarded by publishedMu.
+	hostFilesChecksums map[string]string
+
+	// budgetExclusions holds, per target, the CustomHTTPRoutes the last
+	// rebuild left out because they did not fit in MaxRoutesPerTarget, with
+	// the reason. Guarded by budgetMu.
+	budgetExclusions map[string]map[types.NamespacedName]string
+	budgetMu         sync.Mutex
+
+	// budgetEvents enqueues the CustomHTTPRoutes a rebuild admitted to or
+	// excluded from their target's route budget, so their status follows
+	// changes of the other routes. Nil until SetupWithManager.
+	budgetEvents chan event.GenericEvent
+
+	// shadowedRoutes holds, per target, the routes of each CustomHTTPRoute
+	// the last rebuild found shadowed by an earlier route of their host (see
+	// buildRoutingReport). Guarded by shadowMu.
+	shadowedRoutes map[string]map[types.NamespacedName][]string
+	shadowMu       sync.Mutex
+
+	// httpProxySkipped holds, per target listed in HTTPProxyTargets, the
+	// routes of each CustomHTTPRoute the last HTTPProxy sync left out (see
+	// buildHTTPProxies). Guarded by httpProxyMu.
+	httpProxySkipped map[string]map[types.NamespacedName][]string
+	httpProxyMu      sync.Mutex
+
+	// targetDenials holds, per target, the CustomHTTPRoutes the last rebuild
+	// left out because their namespace does not allow the target (see
+	// filterNamespaceTargets), with the reason. Guarded by denialsMu.
+	targetDenials map[string]map[types.NamespacedName]string
+	denialsMu     sync.Mutex
+
+	// expansionWarnings holds, per target, the warnings each CustomHTTPRoute
+	// got from the last rebuild's expansion (see
+	// routes.ExpandRoutesWithWarnings). Guarded by warningsMu.
+	expansionWarnings map[string]map[types.NamespacedName][]string
+	warningsMu        sync.Mutex
+
+	// expansionSummaries holds, per target, the route count and hash of each
+	// CustomHTTPRoute's routes from the last rebuild, for
+	// ExpansionAnnotations. Guarded by summariesMu.
+	expansionSummaries map[string]map[types.NamespacedName]expansionSummary
+	summariesMu        sync.Mutex
+
+	// expansions caches the routes each CustomHTTPRoute expands to across
+	// rebuilds (see expansionCache).
+	expansions expansionCache
 }
 
 // effectiveRebuildCooldown returns the cooldown to apply. A zero value falls
@@ -228,6 +429,20 @@ func (r *CustomHTTPRouteReconciler) clearTargetState(target string) {
 		}
 	}
 	r.partitionHashesMu.Unlock()
+
+	r.publishedMu.Lock()
+	delete(r.publishedChecksums, target)
+	delete(r.hostFilesChecksums, target)
+	r.publishedMu.Unlock()
+
+	r.budgetMu.Lock()
+	delete(r.budgetExclusions, target)
+	r.budgetMu.Unlock()
+	r.setShadowedRoutes(target, nil)
+	r.setSkippedHTTPProxyRoutes(target, nil)
+	r.setExpansionWarnings(target, nil)
+	r.setExpansionSummaries(target, nil)
+	forgetTargetMetrics(target)
 }
 
 // effectiveStateGCInterval returns the GC interval. Zero falls back to the
@@ -239,13 +454,14 @@ func (r *CustomHTTPRouteReconciler) effectiveStateGCInterval() time.Duration {
 	return r.StateGCInterval
 }
 
-// runStateGC is registered as a manager runnable. It sweeps lastRebuildAt and
-// partitionHashes on a fixed interval, dropping entries for targets that no
-// longer have any live CustomHTTPRoute. Without this sweep the maps grow
-// monotonically as targets are created and deleted, since clearTargetState is
-// only invoked on the deletion path of the last route for a target — a path
-// that can be missed if the controller restarts mid-deletion or if entries
-// were created by a now-vanished resource.
+// runStateGC is registered as a manager runnable. It sweeps lastRebuildAt,
+// partitionHashes, publishedChecksums and budgetExclusions on a fixed
+// interval, dropping entries for targets that no longer have any live
+// CustomHTTPRoute. Without this sweep the maps grow monotonically as targets
+// are created and deleted, since clearTargetState is only invoked on the
+// deletion path of the last route for a target — a path that can be missed
+// if the controller restarts mid-deletion or if entries were created by a
+// now-vanished resource.
 func (r *CustomHTTPRouteReconciler) runStateGC(ctx context.Context) error {
 	interval := r.effectiveStateGCInterval()
 	if interval <= 0 {
@@ -314,6 +530,59 @@ func (r *CustomHTTPRouteReconciler) gcStateOnce(ctx context.Context) error {
 	hashesSize := len(r.partitionHashes)
 	r.partitionHashesMu.Unlock()
 
+	r.publishedMu.Lock()
+	for t := range r.publishedChecksums {
+		if _, ok := live[t]; !ok {
+			delete(r.publishedChecksums, t)
+		}
+	}
+	for t := range r.hostFilesChecksums {
+		if _, ok := live[t]; !ok {
+			delete(r.hostFilesChecksums, t)
+		}
+	}
+	r.publishedMu.Unlock()
+
+	r.budgetMu.Lock()
+	for t := range r.budgetExclusions {
+		if _, ok := live[t]; !ok {
+			delete(r.budgetExclusions, t)
+		}
+	}
+	r.budgetMu.Unlock()
+
+	r.shadowMu.Lock()
+	for t := range r.shadowedRoutes {
+		if _, ok := live[t]; !ok {
+			delete(r.shadowedRoutes, t)
+		}
+	}
+	r.shadowMu.Unlock()
+
+	r.httpProxyMu.Lock()
+	for t := range r.httpProxySkipped {
+		if _, ok := live[t]; !ok {
+			delete(r.httpProxySkipped, t)
+		}
+	}
+	r.httpProxyMu.Unlock()
+
+	r.warningsMu.Lock()
+	for t := range r.expansionWarnings {
+		if _, ok := live[t]; !ok {
+			delete(r.expansionWarnings, t)
+		}
+	}
+	r.warningsMu.Unlock()
+
+	r.summariesMu.Lock()
+	for t := range r.expansionSummaries {
+		if _, ok := live[t]; !ok {
+			delete(r.expansionSummaries, t)
+		}
+	}
+	r.summariesMu.Unlock()
+
 	if rebuildEvicted > 0 || hashesEvicted > 0 {
 		logger.Info("evicted stale in-memory state",
 			"liveTargets", len(live),
@@ -330,10 +599,20 @@ func (r *CustomHTTPRouteReconciler) gcStateOnce(ctx context.Context) error {
 // +kubebuilder:rbac:groups=customrouter.freepik.com,resources=customhttproutes/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=customrouter.freepik.com,resources=customhttproutes/finalizers,verbs=update
 // +kubebuilder:rbac:groups=customrouter.freepik.com,resources=externalprocessorattachments,verbs=get;list;watch
+// +kubebuilder:rbac:groups=customrouter.freepik.com,resources=hostnamesets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=customrouter.freepik.com,resources=customrouterconfigs,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
 // +kubebuilder:rbac:groups=networking.istio.io,resources=envoyfilters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=projectcontour.io,resources=httpproxies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=externaldns.k8s.io,resources=dnsendpoints,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -354,9 +633,20 @@ func (r *CustomHTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return result, err
 	}
 
+	// The routes of a target of another shard are that shard's business,
+	// unless they just moved away from one of ours.
+	if !r.Shard.Owns(objectManifest.Spec.TargetRef.Name) {
+		return r.releaseMovedRoute(ctx, objectManifest)
+	}
+
 	// 3. Check if the resource instance is marked to be deleted
 	if !objectManifest.DeletionTimestamp.IsZero() {
 		if controllerutil.ContainsFinalizer(objectManifest, controller.ResourceFinalizer) {
+			// Taken before the rebuild: a rebuild that runs after the drain
+			// period ends drops the routes, never the other way around, so the
+			// finalizer is not removed while the routes are still served.
+			drain := objectManifest.DeletionDrainRemaining(time.Now())
+
 			result, _, _, err = r.ReconcileObject(ctx, watch.Deleted, objectManifest)
 			if err != nil {
 				logger.Error(err, "Failed to reconcile deletion", "name", req.Name)
@@ -372,6 +662,26 @@ func (r *CustomHTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 				return result, nil
 			}
 
+			// The shard of the previous target of a moved route has not
+			// dropped it yet: removing the finalizer now would let it go
+			// before that shard sees it.
+			if r.handoverPending(objectManifest) {
+				logger.V(1).Info("previous target not released by its shard yet, keeping finalizer and requeueing", "name", req.Name)
+				return ctrl.Result{RequeueAfter: r.requeueDelay()}, nil
+			}
+
+			// The routes stay in the table, flagged as draining, until the
+			// deletionDrainSeconds are over.
+			if drain > 0 {
+				logger.Info("CustomHTTPRoute deleted, draining its routes before removing them",
+					"name", req.Name, "namespace", req.Namespace, "remaining", drain.String())
+				if r.Recorder != nil {
+					r.Recorder.Eventf(objectManifest, corev1.EventTypeNormal, eventReasonDraining,
+						"Routes kept for %s after deletion (deletionDrainSeconds)", drain.Round(time.Second))
+				}
+				return ctrl.Result{RequeueAfter: drain}, nil
+			}
+
 			err = controller.UpdateWithRetry(ctx, r.Client, objectManifest, func(object client.Object) error {
 				controllerutil.RemoveFinalizer(object, controller.ResourceFinalizer)
 				return nil
@@ -452,7 +762,28 @@ func (r *CustomHTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 
 	// 8. Success, update the status
 	r.UpdateConditionReconciled(objectManifest)
-	r.UpdateConditionConfigMapSynced(objectManifest)
+	objectManifest.Status.DisabledRules = objectManifest.Spec.DisabledRuleCount()
+	r.UpdateWarnings(objectManifest, slices.Concat(
+		r.routeExpansionWarnings(objectManifest.Spec.TargetRef.Name, req.NamespacedName),
+		r.hostnameAutomationWarnings(objectManifest)))
+	if reason := r.targetDenial(objectManifest.Spec.TargetRef.Name, req.NamespacedName); reason != "" {
+		r.UpdateConditionTargetNotAllowed(objectManifest, reason)
+	} else if reason := r.routeBudgetExclusion(objectManifest.Spec.TargetRef.Name, req.NamespacedName); reason != "" {
+		r.UpdateConditionRouteBudgetExceeded(objectManifest, reason)
+	} else {
+		r.UpdateConditionConfigMapSynced(objectManifest)
+	}
+	r.UpdateConditionRoutesShadowed(objectManifest,
+		r.routeShadowing(objectManifest.Spec.TargetRef.Name, req.NamespacedName))
+	r.UpdateConditionHTTPProxyRoutesSkipped(objectManifest,
+		r.skippedHTTPProxyRoutes(objectManifest.Spec.TargetRef.Name, req.NamespacedName))
+	now := time.Now()
+	r.UpdateConditionRulesExpired(objectManifest, now)
+	// Rebuild the target when the next rule expires, so its routes leave
+	// the route table on time and the condition lists the rule.
+	if next := objectManifest.Spec.NextRuleExpiry(now); next > 0 {
+		result.RequeueAfter = next
+	}
 
 	catchAllStatus, catchAllErr := r.ComputeCatchAllProgrammedStatus(ctx, objectManifest, routeList, epaList)
 	if catchAllErr != nil {
@@ -461,6 +792,15 @@ func (r *CustomHTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		r.UpdateConditionCatchAllProgrammed(objectManifest, catchAllStatus)
 	}
 
+	// Missing backends do not block the rebuild (Envoy answers 503 for them),
+	// they are only surfaced on the status.
+	unresolved, resolveErr := r.ResolveBackends(ctx, objectManifest)
+	if resolveErr != nil {
+		logger.Error(resolveErr, "Failed to resolve backendRefs", "name", req.Name)
+	} else {
+		r.UpdateConditionBackendsResolved(objectManifest, unresolved)
+	}
+
 	return result, err
 }
 
@@ -486,11 +826,29 @@ func (r *CustomHTTPRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if err := mgr.Add(manager.RunnableFunc(r.runStateGC)); err != nil {
 		return fmt.Errorf("register state GC runnable: %w", err)
 	}
+	r.budgetEvents = make(chan event.GenericEvent)
+
+	var forOptions []builder.ForOption
+	if r.Shard != nil {
+		forOptions = append(forOptions, builder.WithPredicates(r.shardPredicate()))
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&crv1alpha1.CustomHTTPRoute{}).
+		For(&crv1alpha1.CustomHTTPRoute{}, forOptions...).
 		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.findRoutesForService)).
 		Watches(&gatewayv1.HTTPRoute{}, handler.EnqueueRequestsFromMapFunc(r.findRoutesForHTTPRoute)).
+		Watches(&crv1alpha1.CustomRouterConfig{}, handler.EnqueueRequestsFromMapFunc(r.findRoutesForRouterConfig)).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.findRoutesForNamespace),
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc:  func(event.CreateEvent) bool { return false },
+				DeleteFunc:  func(event.DeleteEvent) bool { return false },
+				GenericFunc: func(event.GenericEvent) bool { return false },
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					return allowedTargetsChanged(e.ObjectOld, e.ObjectNew) ||
+						!mapsEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+				},
+			})).
+		WatchesRawSource(source.Channel(r.budgetEvents, &handler.EnqueueRequestForObject{})).
 		WithOptions(ctrlcontroller.Options{MaxConcurrentReconciles: maxConcurrent}).
 		Named("customhttproute").
 		Complete(r)
@@ -524,11 +882,9 @@ func (r *CustomHTTPRouteReconciler) findRoutesForService(ctx context.Context, ob
 
 // routeReferencesService checks if a CustomHTTPRoute has any backendRef pointing to the given service.
 func routeReferencesService(route *crv1alpha1.CustomHTTPRoute, svcName, svcNamespace string) bool {
-	for _, rule := range route.Spec.Rules {
-		for _, ref := range rule.BackendRefs {
-			if ref.Name == svcName && ref.Namespace == svcNamespace {
-				return true
-			}
+	for _, ref := range serviceBackendRefs(route) {
+		if ref.Name == svcName && ref.Namespace == svcNamespace {
+			return true
 		}
 	}
 	return false
@@ -559,7 +915,7 @@ func (r *CustomHTTPRouteReconciler) findRoutesForHTTPRoute(ctx context.Context,
 		if route.Spec.CatchAllRoute == nil {
 			continue
 		}
-		for _, h := range route.Spec.Hostnames {
+		for _, h := range route.Spec.ServedHostnames() {
 			if _, match := hostSet[h]; match {
 				requests = append(requests, reconcile.Request{
 					NamespacedName: types.NamespacedName{
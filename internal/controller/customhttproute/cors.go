@@ -56,13 +56,24 @@ func (r *CustomHTTPRouteReconciler) reconcileCORSFromRoutes(
 
 	for i := range epaList.Items {
 		epa := &epaList.Items[i]
+		if epa.EffectiveProvider() != v1alpha1.GatewayProviderIstio {
+			continue
+		}
+		if !ef.SelectorResolved(epa) {
+			// Not resolved yet (see ef.SelectorResolved): the attachment's
+			// reconcile writes the filter once it is.
+			logger.V(1).Info("Skipping CORS EnvoyFilter: gateway selector of the attachment not resolved yet",
+				"epa", epa.Name,
+				"namespace", epa.Namespace)
+			continue
+		}
 
 		if len(entries) == 0 {
 			key := types.NamespacedName{
 				Name:      epa.Name + ef.CORSFilterSuffix,
 				Namespace: epa.Namespace,
 			}
-			if err := ef.DeleteEnvoyFilter(ctx, r.Client, key); err != nil {
+			if err := ef.DeleteEnvoyFilters(ctx, r.Client, key); err != nil {
 				return err
 			}
 			continue
@@ -74,7 +85,7 @@ func (r *CustomHTTPRouteReconciler) reconcileCORSFromRoutes(
 				epa.Namespace, epa.Name, err)
 		}
 
-		if err := ef.UpsertUnstructured(ctx, r.Client, envoyFilter); err != nil {
+		if err := ef.UpsertEnvoyFilters(ctx, r.Client, epa, envoyFilter); err != nil {
 			return fmt.Errorf("failed to reconcile CORS EnvoyFilter for EPA %s/%s: %w",
 				epa.Namespace, epa.Name, err)
 		}
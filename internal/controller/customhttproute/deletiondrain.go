@@ -0,0 +1,34 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// eventReasonDraining is the reason of the Event recorded when a deleted
+// CustomHTTPRoute keeps its routes for its deletionDrainSeconds.
+const eventReasonDraining = "Draining"
+
+// markDraining flags every route of hosts as draining.
+func markDraining(hosts map[string][]routes.Route) {
+	for _, hostRoutes := range hosts {
+		for i := range hostRoutes {
+			hostRoutes[i].Draining = true
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/internal/controller"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// drainingRoute returns a CustomHTTPRoute of target-a deleted at deletedAt
+// that keeps its routes for drainSeconds.
+func drainingRoute(deletedAt time.Time, drainSeconds int32) *v1alpha1.CustomHTTPRoute {
+	deletionTime := metav1.NewTime(deletedAt)
+	return &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "checkout",
+			Namespace:         "default",
+			UID:               "uid-checkout",
+			Finalizers:        []string{controller.ResourceFinalizer},
+			DeletionTimestamp: &deletionTime,
+		},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames:            []string{"shop.example.com"},
+			TargetRef:            v1alpha1.TargetRef{Name: "target-a"},
+			DeletionDrainSeconds: drainSeconds,
+			Rules: []v1alpha1.Rule{{
+				BackendRefs: []v1alpha1.BackendRef{{Name: "checkout", Namespace: "ns", Port: 80}},
+				Matches:     []v1alpha1.PathMatch{{Path: "/checkout", Type: v1alpha1.MatchTypeExact}},
+			}},
+		},
+	}
+}
+
+func TestRebuildKeepsDrainingRoutes(t *testing.T) {
+	r := newReconciler(drainingRoute(time.Now(), 60))
+	if err := r.rebuildConfigMapsForTarget(context.Background(), "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(context.Background(), types.NamespacedName{
+		Name: "customrouter-routes-target-a-0", Namespace: "test-ns",
+	}, cm); err != nil {
+		t.Fatalf("expected the draining routes to be kept, got error: %v", err)
+	}
+	config, err := routes.DecodeRoutesConfig([]byte(cm.Data[routesDataKey]))
+	if err != nil {
+		t.Fatalf("failed to decode ConfigMap data: %v", err)
+	}
+	hostRoutes := config.Hosts["shop.example.com"]
+	if len(hostRoutes) != 1 || !hostRoutes[0].Draining {
+		t.Fatalf("routes = %+v, want the /checkout route flagged as draining", hostRoutes)
+	}
+}
+
+func TestRebuildDropsDrainedRoutes(t *testing.T) {
+	r := newReconciler(drainingRoute(time.Now().Add(-2*time.Minute), 60))
+	if err := r.rebuildConfigMapsForTarget(context.Background(), "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+
+	cms := &corev1.ConfigMapList{}
+	if err := r.List(context.Background(), cms); err != nil {
+		t.Fatalf("List ConfigMaps: %v", err)
+	}
+	if len(cms.Items) != 0 {
+		t.Errorf("ConfigMaps = %d, want none once the drain period is over", len(cms.Items))
+	}
+}
+
+func TestReconcile_DeletionDrainKeepsFinalizer(t *testing.T) {
+	route := drainingRoute(time.Now(), 60)
+	r := newReconciler(route)
+	r.StateGCInterval = -1
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Name: route.Name, Namespace: route.Namespace},
+	})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter <= 0 || res.RequeueAfter > time.Minute {
+		t.Errorf("RequeueAfter = %s, want the remaining drain period", res.RequeueAfter)
+	}
+	if got := fetchFinalizers(t, r, route.Name); len(got) == 0 {
+		t.Error("finalizer removed while the routes still drain")
+	}
+}
+
+func TestDrainSiblingsForDeletion_SkipsDrainingSiblings(t *testing.T) {
+	now := time.Now()
+	self := crForDrain("self", "default", "uid-self", &now, true)
+	sibling := crForDrain("sib-draining", "default", "uid-sib", &now, true)
+	sibling.Spec.DeletionDrainSeconds = 60
+
+	r := newReconciler(self, sibling)
+	r.drainSiblingsForDeletion(context.Background(), "default", self.UID)
+
+	if got := fetchFinalizers(t, r, "sib-draining"); len(got) == 0 {
+		t.Error("draining sibling lost its finalizer; it must remove it itself once drained")
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// DryRunPath is where DryRunHandler accepts CustomHTTPRoute manifests.
+const DryRunPath = "/dry-run"
+
+// maxDryRunBodySize caps the manifest accepted by the dry-run endpoint. It
+// matches the size limit the API server applies to a single object.
+const maxDryRunBodySize = 3 << 20
+
+// DryRunResult is the body returned by the dry-run endpoint: the routes the
+// controller would generate for the submitted CustomHTTPRoute.
+type DryRunResult struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Target    string `json:"target"`
+
+	// Routes is the total number of generated routes across all hosts.
+	Routes int `json:"routes"`
+
+	// Hosts holds the routes of every hostname after prefix expansion, in
+	// evaluation order.
+	Hosts map[string][]routes.Route `json:"hosts"`
+}
+
+// dryRunAccessError is an authentication or authorization failure, with the
+// HTTP status it is answered with.
+type dryRunAccessError struct {
+	code int
+	msg  string
+}
+
+func (e *dryRunAccessError) Error() string { return e.msg }
+
+// dryRunError is the body returned when the manifest cannot be expanded.
+type dryRunError struct {
+	Error string `json:"error"`
+}
+
+// DryRunHandler serves DryRunPath. A POST with a CustomHTTPRoute manifest
+// (YAML or JSON, any served API version) returns its expanded routes as a
+// DryRunResult, exactly as the controller would write them to the route
+// ConfigMaps. Nothing is written to the cluster: the handler only reads the
+// Services referenced by the route to resolve ExternalName backends, and the
+// CustomRouterConfigs it inherits defaults from.
+//
+// Manifests that fail the admission validation are rejected with 422 and
+// the validation error; unknown fields are rejected too, so typos surface
+// before the manifest reaches the API server.
+//
+// Unless InsecureDryRun is set, requests must carry a Kubernetes bearer
+// token, and its user must be allowed to create CustomHTTPRoutes in the
+// namespace of the submitted route: the dry-run reads that namespace's
+// Services, so it is open to exactly who could apply the route.
+func (r *CustomHTTPRouteReconciler) DryRunHandler() http.Handler {
+	decoder := serializer.NewCodecFactory(r.Scheme, serializer.EnableStrict).UniversalDeserializer()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(DryRunPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeDryRunJSON(w, http.StatusMethodNotAllowed, dryRunError{Error: "only POST is supported"})
+			return
+		}
+
+		var user *authenticationv1.UserInfo
+		if !r.InsecureDryRun {
+			var err error
+			if user, err = r.authenticateDryRun(req); err != nil {
+				writeDryRunAccessError(w, err)
+				return
+			}
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxDryRunBodySize))
+		if err != nil {
+			code := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			writeDryRunJSON(w, code, dryRunError{Error: fmt.Sprintf("failed to read manifest: %v", err)})
+			return
+		}
+
+		route, err := decodeDryRunRoute(decoder, body)
+		if err != nil {
+			writeDryRunJSON(w, http.StatusBadRequest, dryRunError{Error: err.Error()})
+			return
+		}
+		if user != nil {
+			if err := r.authorizeDryRun(req, user, route.Namespace); err != nil {
+				writeDryRunAccessError(w, err)
+				return
+			}
+		}
+		if err := route.Validate(); err != nil {
+			writeDryRunJSON(w, http.StatusUnprocessableEntity, dryRunError{Error: err.Error()})
+			return
+		}
+
+		inheriting, _, err := r.inheritRouterConfigs(req.Context(), []*v1alpha1.CustomHTTPRoute{route})
+		if err != nil {
+			writeDryRunJSON(w, http.StatusInternalServerError, dryRunError{Error: err.Error()})
+			return
+		}
+		route = inheriting[0]
+
+		externalNames := r.resolveExternalNames(req.Context(), []*v1alpha1.CustomHTTPRoute{route})
+		hosts, err := routes.ExpandRoutes(route, externalNames)
+		if err != nil {
+			writeDryRunJSON(w, http.StatusUnprocessableEntity, dryRunError{Error: err.Error()})
+			return
+		}
+		routes.PruneExpired(hosts, time.Now())
+		(&routes.RoutesConfig{Hosts: hosts}).ApplyMatchStrategy(r.matchStrategy(route.Spec.TargetRef.Name))
+		if r.RoutesFormat.Version >= routes.FormatVersion2 {
+			routes.AssignRouteIdentity(hosts, route.Namespace+"/"+route.Name)
+			if r.OmitRouteSource {
+				routes.StripRouteSource(hosts)
+			}
+		}
+
+		result := DryRunResult{
+			Name:      route.Name,
+			Namespace: route.Namespace,
+			Target:    route.Spec.TargetRef.Name,
+			Hosts:     hosts,
+		}
+		for _, hostRoutes := range hosts {
+			result.Routes += len(hostRoutes)
+		}
+		log.FromContext(req.Context()).V(1).Info("Dry-run expansion served",
+			"name", route.Name,
+			"namespace", route.Namespace,
+			"routes", result.Routes)
+		writeDryRunJSON(w, http.StatusOK, result)
+	})
+	return mux
+}
+
+// authenticateDryRun resolves the bearer token of req to its user with a
+// TokenReview.
+func (r *CustomHTTPRouteReconciler) authenticateDryRun(req *http.Request) (*authenticationv1.UserInfo, error) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return nil, &dryRunAccessError{code: http.StatusUnauthorized, msg: "a bearer token is required"}
+	}
+
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: strings.TrimSpace(token)}}
+	if err := r.Create(req.Context(), review); err != nil {
+		return nil, fmt.Errorf("failed to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, &dryRunAccessError{code: http.StatusUnauthorized, msg: "the bearer token is not valid"}
+	}
+	return &review.Status.User, nil
+}
+
+// authorizeDryRun checks with a SubjectAccessReview that user may create
+// CustomHTTPRoutes in namespace.
+func (r *CustomHTTPRouteReconciler) authorizeDryRun(req *http.Request, user *authenticationv1.UserInfo, namespace string) error {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "create",
+				Group:     v1alpha1.GroupVersion.Group,
+				Resource:  "customhttproutes",
+			},
+		},
+	}
+	if err := r.Create(req.Context(), review); err != nil {
+		return fmt.Errorf("failed to review access: %w", err)
+	}
+	if !review.Status.Allowed {
+		return &dryRunAccessError{
+			code: http.StatusForbidden,
+			msg:  fmt.Sprintf("user %q cannot create customhttproutes in namespace %q", user.Username, namespace),
+		}
+	}
+	return nil
+}
+
+func writeDryRunAccessError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	var accessErr *dryRunAccessError
+	if errors.As(err, &accessErr) {
+		code = accessErr.code
+	}
+	writeDryRunJSON(w, code, dryRunError{Error: err.Error()})
+}
+
+// decodeDryRunRoute decodes a CustomHTTPRoute manifest, converting spoke
+// versions to the v1alpha1 hub the expansion works on.
+func decodeDryRunRoute(decoder runtime.Decoder, body []byte) (*v1alpha1.CustomHTTPRoute, error) {
+	obj, _, err := decoder.Decode(body, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	switch o := obj.(type) {
+	case *v1alpha1.CustomHTTPRoute:
+		return o, nil
+	case conversion.Convertible:
+		hub := &v1alpha1.CustomHTTPRoute{}
+		if err := o.ConvertTo(hub); err != nil {
+			return nil, fmt.Errorf("failed to convert manifest to %s: %w", v1alpha1.GroupVersion, err)
+		}
+		return hub, nil
+	default:
+		return nil, fmt.Errorf("expected a CustomHTTPRoute, got %s", obj.GetObjectKind().GroupVersionKind().Kind)
+	}
+}
+
+func writeDryRunJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
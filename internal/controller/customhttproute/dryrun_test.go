@@ -0,0 +1,256 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+const dryRunManifest = `
+apiVersion: customrouter.freepik.com/v1alpha1
+kind: CustomHTTPRoute
+metadata:
+  name: web
+  namespace: ns
+spec:
+  targetRef:
+    name: default
+  hostnames:
+    - www.example.com
+  pathPrefixes:
+    values: ["es", "fr"]
+  rules:
+    - matches:
+        - path: /pricing
+          type: PathPrefix
+      backendRefs:
+        - name: external
+          namespace: ns
+          port: 443
+`
+
+func postDryRun(t *testing.T, r *CustomHTTPRouteReconciler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, DryRunPath, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	r.InsecureDryRun = true
+	r.DryRunHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDryRunHandlerExpandsRoute(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "external", Namespace: "ns"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "api.example.net"},
+	}
+	r := newReconciler(svc)
+
+	rec := postDryRun(t, r, dryRunManifest)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", rec.Code, rec.Body)
+	}
+	var result DryRunResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if result.Name != "web" || result.Namespace != "ns" || result.Target != "default" {
+		t.Errorf("result identity = %s/%s -> %s, want ns/web -> default", result.Namespace, result.Name, result.Target)
+	}
+	hostRoutes := result.Hosts["www.example.com"]
+	// One route per prefix plus the unprefixed one.
+	if len(hostRoutes) != 3 || result.Routes != 3 {
+		t.Fatalf("got %d routes (total %d), want 3: %+v", len(hostRoutes), result.Routes, hostRoutes)
+	}
+	paths := make(map[string]bool)
+	for _, route := range hostRoutes {
+		paths[route.Path] = true
+		if route.Backend != "api.example.net:443" {
+			t.Errorf("route %s backend = %q, want the resolved ExternalName", route.Path, route.Backend)
+		}
+	}
+	for _, want := range []string{"/pricing", "/es/pricing", "/fr/pricing"} {
+		if !paths[want] {
+			t.Errorf("missing expanded path %s in %v", want, paths)
+		}
+	}
+
+	// Nothing is written to the cluster.
+	var cms corev1.ConfigMapList
+	if err := r.List(t.Context(), &cms); err != nil {
+		t.Fatalf("failed to list ConfigMaps: %v", err)
+	}
+	if len(cms.Items) != 0 {
+		t.Errorf("dry-run created %d ConfigMaps", len(cms.Items))
+	}
+}
+
+func TestDryRunHandlerRejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{
+			name:     "GET is not allowed",
+			method:   http.MethodGet,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:     "malformed manifest",
+			method:   http.MethodPost,
+			body:     "not: [valid",
+			wantCode: http.StatusBadRequest,
+			wantErr:  "failed to decode manifest",
+		},
+		{
+			name:     "unknown field",
+			method:   http.MethodPost,
+			body:     strings.Replace(dryRunManifest, "hostnames:", "hostname: x\n  hostnames:", 1),
+			wantCode: http.StatusBadRequest,
+			wantErr:  "hostname",
+		},
+		{
+			name:     "other kind",
+			method:   http.MethodPost,
+			body:     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n",
+			wantCode: http.StatusBadRequest,
+			wantErr:  "expected a CustomHTTPRoute",
+		},
+		{
+			name:     "fails validation",
+			method:   http.MethodPost,
+			body:     dryRunManifest[:strings.Index(dryRunManifest, "      backendRefs:")],
+			wantCode: http.StatusUnprocessableEntity,
+			wantErr:  "backendRefs is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReconciler()
+			r.InsecureDryRun = true
+			req := httptest.NewRequest(tt.method, DryRunPath, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			r.DryRunHandler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantErr != "" && !strings.Contains(rec.Body.String(), tt.wantErr) {
+				t.Errorf("body = %s, want it to mention %q", rec.Body, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDryRunHandlerAcceptsJSON(t *testing.T) {
+	r := newReconciler()
+	rec := postDryRun(t, r, `{"apiVersion":"customrouter.freepik.com/v1alpha1","kind":"CustomHTTPRoute",`+
+		`"metadata":{"name":"json","namespace":"ns"},"spec":{"targetRef":{"name":"t"},"hostnames":["a.example.com"],`+
+		`"rules":[{"matches":[{"path":"/","type":"Exact"}],"backendRefs":[{"name":"svc","namespace":"ns","port":80}]}]}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", rec.Code, rec.Body)
+	}
+	var result DryRunResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if got := result.Hosts["a.example.com"]; len(got) != 1 || got[0].Backend != "svc.ns.svc.cluster.local:80" {
+		t.Errorf("routes = %+v, want the single Exact route", got)
+	}
+}
+
+func TestDryRunHandlerAuthorization(t *testing.T) {
+	// The fake API server knows one token, for a user that may create
+	// CustomHTTPRoutes in "ns" only.
+	scheme := newScheme()
+	_ = authenticationv1.AddToScheme(scheme)
+	_ = authorizationv1.AddToScheme(scheme)
+	var reviewed []authorizationv1.SubjectAccessReviewSpec
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			switch review := obj.(type) {
+			case *authenticationv1.TokenReview:
+				if review.Spec.Token == "good" {
+					review.Status.Authenticated = true
+					review.Status.User = authenticationv1.UserInfo{Username: "alice", Groups: []string{"devs"}}
+				}
+				return nil
+			case *authorizationv1.SubjectAccessReview:
+				reviewed = append(reviewed, review.Spec)
+				attrs := review.Spec.ResourceAttributes
+				review.Status.Allowed = review.Spec.User == "alice" && attrs != nil &&
+					attrs.Namespace == "ns" && attrs.Verb == "create" && attrs.Resource == "customhttproutes"
+				return nil
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}).Build()
+	r := &CustomHTTPRouteReconciler{Client: c, Scheme: scheme}
+
+	tests := []struct {
+		name     string
+		token    string
+		body     string
+		wantCode int
+	}{
+		{name: "no token", body: dryRunManifest, wantCode: http.StatusUnauthorized},
+		{name: "invalid token", token: "bad", body: dryRunManifest, wantCode: http.StatusUnauthorized},
+		{name: "allowed namespace", token: "good", body: dryRunManifest, wantCode: http.StatusOK},
+		{
+			name:     "other namespace",
+			token:    "good",
+			body:     strings.Replace(dryRunManifest, "namespace: ns\n", "namespace: other\n", 1),
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, DryRunPath, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			r.DryRunHandler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d; body: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+
+	if len(reviewed) != 2 {
+		t.Fatalf("got %d SubjectAccessReviews, want one per authenticated request", len(reviewed))
+	}
+	if got := reviewed[0].Groups; len(got) != 1 || got[0] != "devs" {
+		t.Errorf("SubjectAccessReview groups = %v, want the token's groups", got)
+	}
+}
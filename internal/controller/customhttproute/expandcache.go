@@ -0,0 +1,141 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// expansionCache keeps the routes every CustomHTTPRoute expanded to, so a
+// rebuild only expands the ones whose spec changed since the last one. The
+// zero value is ready to use.
+type expansionCache struct {
+	mu      sync.Mutex
+	entries map[types.UID]*expansionCacheEntry
+}
+
+// expansionCacheEntry is the expansion of one generation of a
+// CustomHTTPRoute with the ExternalName services it was resolved against
+// and the CustomRouterConfigs it inherited defaults from.
+type expansionCacheEntry struct {
+	target        string
+	generation    int64
+	externalNames string
+	inherited     string
+	hosts         map[string][]routes.Route
+	warnings      []routes.Warning
+}
+
+// expand returns the routes of route and the warnings about them (see
+// routes.ExpandRoutesWithWarnings), expanding them only when the cache
+// holds none for its generation, externalNames and inherited defaults.
+// ExpandRoutes only reads the spec and the ExternalName services, so an
+// unchanged generation with the same ExternalName services and
+// CustomRouterConfigs (see inheritRouterConfigs) yields the same routes.
+// Routes without a UID are never cached.
+//
+// The result is a copy the caller may modify: the rebuild assigns route
+// identities and sorts hosts in place. Only Route values are copied; the
+// structs they point to are shared, and nothing after expansion writes to
+// them.
+func (c *expansionCache) expand(
+	target string,
+	route *v1alpha1.CustomHTTPRoute,
+	externalNames map[string]string,
+	externalNamesKey string,
+	inheritedKey string,
+) (map[string][]routes.Route, []routes.Warning, error) {
+	if route.UID == "" {
+		return routes.ExpandRoutesWithWarnings(route, externalNames)
+	}
+
+	c.mu.Lock()
+	entry := c.entries[route.UID]
+	c.mu.Unlock()
+	if entry != nil && entry.generation == route.Generation && entry.externalNames == externalNamesKey &&
+		entry.inherited == inheritedKey {
+		expansionCacheLookups.WithLabelValues("hit").Inc()
+		return cloneHostRoutes(entry.hosts), entry.warnings, nil
+	}
+	expansionCacheLookups.WithLabelValues("miss").Inc()
+
+	hosts, warnings, err := routes.ExpandRoutesWithWarnings(route, externalNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[types.UID]*expansionCacheEntry)
+	}
+	c.entries[route.UID] = &expansionCacheEntry{
+		target:        target,
+		generation:    route.Generation,
+		externalNames: externalNamesKey,
+		inherited:     inheritedKey,
+		hosts:         hosts,
+		warnings:      warnings,
+	}
+	c.mu.Unlock()
+	return cloneHostRoutes(hosts), warnings, nil
+}
+
+// prune drops the entries of target for CustomHTTPRoutes that are not in
+// seen, i.e. that were deleted or moved to another target since they were
+// cached.
+func (c *expansionCache) prune(target string, seen map[types.UID]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for uid, entry := range c.entries {
+		if entry.target == target && !seen[uid] {
+			delete(c.entries, uid)
+		}
+	}
+}
+
+// externalNamesKey serializes the ExternalName services resolved for a
+// target, so cached expansions are redone when any of them changes.
+func externalNamesKey(externalNames map[string]string) string {
+	keys := make([]string, 0, len(externalNames))
+	for key := range externalNames {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(externalNames[key])
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// cloneHostRoutes copies the route slices of hosts.
+func cloneHostRoutes(hosts map[string][]routes.Route) map[string][]routes.Route {
+	out := make(map[string][]routes.Route, len(hosts))
+	for host, hostRoutes := range hosts {
+		out[host] = append([]routes.Route(nil), hostRoutes...)
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestExpansionCache(t *testing.T) {
+	route := budgetRoute("web", time.Now(), "/a")
+	route.UID = "uid-web"
+	route.Generation = 1
+	host := "web.example.com"
+	var c expansionCache
+
+	first, _, err := c.expand("default", route, nil, "", "")
+	if err != nil {
+		t.Fatalf("expand failed: %v", err)
+	}
+	if len(first[host]) != 1 {
+		t.Fatalf("got %d routes for %s, want 1", len(first[host]), host)
+	}
+
+	// The caller owns the result: changing it must not reach the cache.
+	first[host][0].Path = "/changed"
+
+	// A spec change without a new generation cannot happen in the API
+	// server, so the cached expansion is served as is.
+	route.Spec.Rules[0].Matches[0].Path = "/b"
+	cached, _, err := c.expand("default", route, nil, "", "")
+	if err != nil {
+		t.Fatalf("expand failed: %v", err)
+	}
+	if got := cached[host][0].Path; got != "/a" {
+		t.Errorf("cached path = %s, want /a", got)
+	}
+
+	route.Generation = 2
+	expanded, _, _ := c.expand("default", route, nil, "", "")
+	if got := expanded[host][0].Path; got != "/b" {
+		t.Errorf("path after a new generation = %s, want /b", got)
+	}
+
+	route.Spec.Rules[0].Matches[0].Path = "/c"
+	expanded, _, _ = c.expand("default", route, nil, externalNamesKey(map[string]string{"svc/ns": "svc.example.net"}), "")
+	if got := expanded[host][0].Path; got != "/c" {
+		t.Errorf("path after an ExternalName change = %s, want /c", got)
+	}
+
+	c.prune("other", nil)
+	if len(c.entries) != 1 {
+		t.Fatal("pruning another target dropped the entry")
+	}
+	c.prune("default", map[types.UID]bool{})
+	if len(c.entries) != 0 {
+		t.Error("pruning the target kept the entry of a route it no longer has")
+	}
+}
+
+func TestRebuildReusesExpansions(t *testing.T) {
+	ctx := context.Background()
+	route := budgetRoute("web", time.Now(), "/a")
+	route.UID = "uid-web"
+	r := newReconciler(route)
+
+	for i := 0; i < 2; i++ {
+		if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+			t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+		}
+	}
+	if entry := r.expansions.entries["uid-web"]; entry == nil || entry.target != "default" {
+		t.Fatalf("expansion of the route was not cached for its target: %+v", entry)
+	}
+
+	// Once the route is gone its expansion is dropped.
+	if err := r.Delete(ctx, &v1alpha1.CustomHTTPRoute{ObjectMeta: route.ObjectMeta}); err != nil {
+		t.Fatalf("failed to delete route: %v", err)
+	}
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if len(r.expansions.entries) != 0 {
+		t.Errorf("expansion of a deleted route is still cached: %v", r.expansions.entries)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const (
+	// expandedRouteCountAnnotation is the number of routes the last rebuild
+	// generated from a CustomHTTPRoute (see ExpansionAnnotations).
+	expandedRouteCountAnnotation = "customrouter.freepik.com/expanded-route-count"
+
+	// expandedRoutesHashAnnotation is a hash of the routes the last rebuild
+	// generated from a CustomHTTPRoute (see ExpansionAnnotations).
+	expandedRoutesHashAnnotation = "customrouter.freepik.com/expanded-routes-hash"
+
+	// expandedRoutesHashLength is the number of hex digits of the hash kept
+	// in expandedRoutesHashAnnotation.
+	expandedRoutesHashLength = 16
+)
+
+// expansionSummary is what the expansion annotations of a CustomHTTPRoute
+// report about its generated routes.
+type expansionSummary struct {
+	routes int
+	hash   string
+}
+
+// summarizeExpansion returns the route count and hash of the routes a
+// CustomHTTPRoute expanded to. The hash covers the routes as they are
+// written to the route ConfigMaps, so a spec edit changes it only when it
+// changes the generated routes.
+func summarizeExpansion(hosts map[string][]routes.Route, count int) (expansionSummary, error) {
+	// encoding/json writes map keys sorted, so equal routes hash equal.
+	data, err := json.Marshal(hosts)
+	if err != nil {
+		return expansionSummary{}, err
+	}
+	sum := sha256.Sum256(data)
+	return expansionSummary{
+		routes: count,
+		hash:   hex.EncodeToString(sum[:])[:expandedRoutesHashLength],
+	}, nil
+}
+
+// setExpansionSummaries records the expansion summaries the last rebuild of
+// target computed for its CustomHTTPRoutes, replacing the previous set.
+func (r *CustomHTTPRouteReconciler) setExpansionSummaries(target string, summaries map[types.NamespacedName]expansionSummary) {
+	r.summariesMu.Lock()
+	defer r.summariesMu.Unlock()
+	if len(summaries) == 0 {
+		delete(r.expansionSummaries, target)
+		return
+	}
+	if r.expansionSummaries == nil {
+		r.expansionSummaries = make(map[string]map[types.NamespacedName]expansionSummary)
+	}
+	r.expansionSummaries[target] = summaries
+}
+
+// routeExpansionSummary returns the expansion summary the last rebuild of
+// target computed for the given CustomHTTPRoute. It returns nil when
+// ExpansionAnnotations is off or the rebuild generated nothing for it.
+func (r *CustomHTTPRouteReconciler) routeExpansionSummary(target string, key types.NamespacedName) *expansionSummary {
+	if !r.ExpansionAnnotations {
+		return nil
+	}
+	r.summariesMu.Lock()
+	defer r.summariesMu.Unlock()
+	summary, ok := r.expansionSummaries[target][key]
+	if !ok {
+		return nil
+	}
+	return &summary
+}
+
+// expansionAnnotationsCurrent checks if the expansion annotations match
+// summary; a nil summary wants them absent.
+func expansionAnnotationsCurrent(ann map[string]string, summary *expansionSummary) bool {
+	if summary == nil {
+		_, hasCount := ann[expandedRouteCountAnnotation]
+		_, hasHash := ann[expandedRoutesHashAnnotation]
+		return !hasCount && !hasHash
+	}
+	return ann[expandedRouteCountAnnotation] == strconv.Itoa(summary.routes) &&
+		ann[expandedRoutesHashAnnotation] == summary.hash
+}
+
+// setExpansionAnnotations sets the expansion annotations from summary, or
+// removes them when it is nil.
+func setExpansionAnnotations(ann map[string]string, summary *expansionSummary) {
+	if summary == nil {
+		delete(ann, expandedRouteCountAnnotation)
+		delete(ann, expandedRoutesHashAnnotation)
+		return
+	}
+	ann[expandedRouteCountAnnotation] = strconv.Itoa(summary.routes)
+	ann[expandedRoutesHashAnnotation] = summary.hash
+}
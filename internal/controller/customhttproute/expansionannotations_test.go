@@ -0,0 +1,106 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestRebuildRecordsExpansionSummaries(t *testing.T) {
+	ctx := context.Background()
+	two := budgetRoute("two", time.Now(), "/a", "/b")
+	one := budgetRoute("one", time.Now(), "/a")
+	r := newReconciler(two, one)
+	r.ExpansionAnnotations = true
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	twoKey := types.NamespacedName{Namespace: "ns", Name: "two"}
+	first := r.routeExpansionSummary("default", twoKey)
+	if first == nil || first.routes != 2 || len(first.hash) != expandedRoutesHashLength {
+		t.Fatalf("summary of two = %+v, want 2 routes and a %d digit hash", first, expandedRoutesHashLength)
+	}
+	other := r.routeExpansionSummary("default", types.NamespacedName{Namespace: "ns", Name: "one"})
+	if other == nil || other.routes != 1 || other.hash == first.hash {
+		t.Errorf("summary of one = %+v, want 1 route with another hash than %s", other, first.hash)
+	}
+
+	// An unchanged route hashes the same on the next rebuild, so the
+	// annotations are not rewritten.
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("second rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if again := r.routeExpansionSummary("default", twoKey); again == nil || *again != *first {
+		t.Errorf("summary after second rebuild = %+v, want %+v", again, first)
+	}
+
+	r.ExpansionAnnotations = false
+	if got := r.routeExpansionSummary("default", twoKey); got != nil {
+		t.Errorf("summary with ExpansionAnnotations off = %+v, want nil", got)
+	}
+}
+
+func TestReconcileObjectWritesExpansionAnnotations(t *testing.T) {
+	ctx := context.Background()
+	route := budgetRoute("web", time.Now(), "/a", "/b", "/c")
+	r := newReconciler(route)
+	r.RebuildCooldown = -1
+	r.ExpansionAnnotations = true
+
+	reconcile := func() *v1alpha1.CustomHTTPRoute {
+		t.Helper()
+		current := &v1alpha1.CustomHTTPRoute{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(route), current); err != nil {
+			t.Fatalf("get CustomHTTPRoute: %v", err)
+		}
+		if _, _, _, err := r.ReconcileObject(ctx, watch.Modified, current); err != nil {
+			t.Fatalf("ReconcileObject failed: %v", err)
+		}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(route), current); err != nil {
+			t.Fatalf("get CustomHTTPRoute: %v", err)
+		}
+		return current
+	}
+
+	got := reconcile()
+	if count := got.Annotations[expandedRouteCountAnnotation]; count != "3" {
+		t.Errorf("%s = %q, want 3", expandedRouteCountAnnotation, count)
+	}
+	if hash := got.Annotations[expandedRoutesHashAnnotation]; len(hash) != expandedRoutesHashLength {
+		t.Errorf("%s = %q, want a %d digit hash", expandedRoutesHashAnnotation, hash, expandedRoutesHashLength)
+	}
+
+	r.ExpansionAnnotations = false
+	got = reconcile()
+	for _, key := range []string{expandedRouteCountAnnotation, expandedRoutesHashAnnotation} {
+		if value, ok := got.Annotations[key]; ok {
+			t.Errorf("%s = %q after turning the annotations off, want it removed", key, value)
+		}
+	}
+	if got.Annotations[lastTargetAnnotation] != "default" {
+		t.Errorf("%s = %q, want default", lastTargetAnnotation, got.Annotations[lastTargetAnnotation])
+	}
+}
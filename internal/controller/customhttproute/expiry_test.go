@@ -0,0 +1,134 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/internal/controller"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// campaignRoute returns a CustomHTTPRoute of target-a with a /campaign rule
+// expiring at expiresAt and a catch-all rule.
+func campaignRoute(expiresAt time.Time) *v1alpha1.CustomHTTPRoute {
+	return &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "shop",
+			Namespace:  "default",
+			UID:        "uid-shop",
+			Finalizers: []string{controller.ResourceFinalizer},
+		},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{"shop.example.com"},
+			TargetRef: v1alpha1.TargetRef{Name: "target-a"},
+			Rules: []v1alpha1.Rule{
+				{
+					BackendRefs: []v1alpha1.BackendRef{{Name: "campaign", Namespace: "ns", Port: 80}},
+					Matches:     []v1alpha1.PathMatch{{Path: "/campaign", Type: v1alpha1.MatchTypeExact}},
+					ExpiresAt:   &metav1.Time{Time: expiresAt},
+				},
+				{
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "ns", Port: 80}},
+					Matches:     []v1alpha1.PathMatch{{Path: "/"}},
+				},
+			},
+		},
+	}
+}
+
+func TestRebuildPrunesExpiredRules(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		expiresAt time.Time
+		wantPaths []string
+	}{
+		{"not expired yet", time.Now().Add(time.Hour), []string{"/campaign", "/"}},
+		{"expired", time.Now().Add(-time.Minute), []string{"/"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReconciler(campaignRoute(tt.expiresAt))
+			if err := r.rebuildConfigMapsForTarget(context.Background(), "target-a"); err != nil {
+				t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+			}
+
+			cm := &corev1.ConfigMap{}
+			if err := r.Get(context.Background(), types.NamespacedName{
+				Name: "customrouter-routes-target-a-0", Namespace: "test-ns",
+			}, cm); err != nil {
+				t.Fatalf("get ConfigMap: %v", err)
+			}
+			config, err := routes.DecodeRoutesConfig([]byte(cm.Data[routesDataKey]))
+			if err != nil {
+				t.Fatalf("failed to decode ConfigMap data: %v", err)
+			}
+			var paths []string
+			for _, route := range config.Hosts["shop.example.com"] {
+				paths = append(paths, route.Path)
+			}
+			if strings.Join(paths, " ") != strings.Join(tt.wantPaths, " ") {
+				t.Errorf("paths = %v, want %v", paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestReconcile_RequeuesAtNextRuleExpiry(t *testing.T) {
+	route := campaignRoute(time.Now().Add(30 * time.Minute))
+	r := newReconciler(route)
+	r.StateGCInterval = -1
+
+	res, err := r.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Name: route.Name, Namespace: route.Namespace},
+	})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if res.RequeueAfter <= 29*time.Minute || res.RequeueAfter > 30*time.Minute {
+		t.Errorf("RequeueAfter = %s, want the time left until the rule expires", res.RequeueAfter)
+	}
+}
+
+func TestUpdateConditionRulesExpired(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{}
+	expiresAt := time.Date(2026, 11, 30, 23, 0, 0, 0, time.UTC)
+	route := campaignRoute(expiresAt)
+
+	r.UpdateConditionRulesExpired(route, expiresAt.Add(-time.Second))
+	cond := route.Status.Conditions[0]
+	if cond.Status != metav1.ConditionFalse || cond.Reason != controller.ConditionReasonNoExpiredRules {
+		t.Errorf("condition = %+v, want False/NoExpiredRules", cond)
+	}
+
+	r.UpdateConditionRulesExpired(route, expiresAt)
+	cond = route.Status.Conditions[0]
+	if cond.Status != metav1.ConditionTrue || cond.Reason != controller.ConditionReasonRulesExpired {
+		t.Errorf("condition = %+v, want True/RulesExpired", cond)
+	}
+	if want := "1 rule(s) expired and no longer routed: rules[0] (expired 2026-11-30T23:00:00Z)"; cond.Message != want {
+		t.Errorf("message = %q, want %q", cond.Message, want)
+	}
+}
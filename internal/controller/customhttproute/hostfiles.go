@@ -0,0 +1,344 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const (
+	// HostFilesDestinationConfigMap selects ConfigMapHostFiles as the
+	// destination of NewHostFilesSink.
+	HostFilesDestinationConfigMap = "configmap"
+
+	// hostFilesBaseName is the base name of the host files ConfigMap of a
+	// target: "customrouter-host-routes-<target>". It does not start with
+	// configMapBaseName, so it is never taken for a route partition.
+	hostFilesBaseName = "customrouter-host-routes"
+
+	// hostFilesLabel holds the target of a host files ConfigMap. Like the
+	// routing report, it does not carry configMapTargetLabel, so extprocs
+	// never load it.
+	hostFilesLabel = "customrouter.freepik.com/host-routes"
+)
+
+// HostFilesSink stores the host files of a target (see
+// routes.RenderHostFiles).
+type HostFilesSink interface {
+	// SyncHostFiles makes files, keyed by file name, the host files of
+	// target, removing the files of hosts the target no longer has.
+	SyncHostFiles(ctx context.Context, target string, files map[string][]byte) error
+}
+
+// NewHostFilesSink returns the sink dest selects:
+//
+//   - HostFilesDestinationConfigMap writes a ConfigMap per target in
+//     namespace with c.
+//   - An s3:// or gs:// URL writes objects to the bucket newBucket opens.
+//   - An absolute path writes a directory per target under it, e.g. on a
+//     PersistentVolume shared with a job committing it to Git.
+func NewHostFilesSink(
+	dest string,
+	c client.Client,
+	namespace string,
+	newBucket func(url string) (objectstore.Bucket, error),
+) (HostFilesSink, error) {
+	switch {
+	case dest == HostFilesDestinationConfigMap:
+		return &ConfigMapHostFiles{Client: c, Namespace: namespace}, nil
+	case strings.HasPrefix(dest, objectstore.SchemeS3+"://"), strings.HasPrefix(dest, objectstore.SchemeGCS+"://"):
+		bucket, err := newBucket(dest)
+		if err != nil {
+			return nil, err
+		}
+		return &BucketHostFiles{Bucket: bucket}, nil
+	case filepath.IsAbs(dest):
+		return &DirHostFiles{Dir: filepath.Clean(dest)}, nil
+	default:
+		return nil, fmt.Errorf("invalid host files destination %q: want %q, an s3:// or gs:// URL or an absolute path",
+			dest, HostFilesDestinationConfigMap)
+	}
+}
+
+// writeHostFiles renders the routes of target as one file per host into
+// HostFiles, so route changes can be reviewed as diffs before they are
+// promoted. Like publishRoutes, a target without routes keeps an empty
+// index rather than nothing, and unchanged files are not written again.
+func (r *CustomHTTPRouteReconciler) writeHostFiles(ctx context.Context, target string, config *routes.RoutesConfig) error {
+	if r.HostFiles == nil {
+		return nil
+	}
+
+	files, err := routes.RenderHostFiles(config)
+	if err != nil {
+		return fmt.Errorf("failed to render host files for target %s: %w", target, err)
+	}
+	checksum := hostFilesChecksum(files)
+	if r.hostFilesChecksum(target) == checksum {
+		return nil
+	}
+	if err := r.HostFiles.SyncHostFiles(ctx, target, files); err != nil {
+		return fmt.Errorf("failed to write host files for target %s: %w", target, err)
+	}
+	r.setHostFilesChecksum(target, checksum)
+
+	log.FromContext(ctx).Info("Host route files written",
+		"target", target,
+		"hostsCount", len(config.Hosts))
+	return nil
+}
+
+// hostFilesChecksum returns a checksum of files, names included.
+func hostFilesChecksum(files map[string][]byte) string {
+	h := sha256.New()
+	for _, name := range sortedFileNames(files) {
+		sum := sha256.Sum256(files[name])
+		_, _ = fmt.Fprintf(h, "%s %x\n", name, sum)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hostFilesChecksum returns the checksum of the host files last written for
+// target, or "" when none were written by this process.
+func (r *CustomHTTPRouteReconciler) hostFilesChecksum(target string) string {
+	r.publishedMu.Lock()
+	defer r.publishedMu.Unlock()
+	return r.hostFilesChecksums[target]
+}
+
+// setHostFilesChecksum records the checksum of the host files written for
+// target.
+func (r *CustomHTTPRouteReconciler) setHostFilesChecksum(target, checksum string) {
+	r.publishedMu.Lock()
+	defer r.publishedMu.Unlock()
+	if r.hostFilesChecksums == nil {
+		r.hostFilesChecksums = make(map[string]string)
+	}
+	r.hostFilesChecksums[target] = checksum
+}
+
+func sortedFileNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConfigMapHostFiles writes the host files of a target as the keys of the
+// ConfigMap "customrouter-host-routes-<target>", for GitOps tooling reading
+// from the cluster. A ConfigMap holds at most 1 MiB, so large targets need
+// a bucket or a directory instead.
+type ConfigMapHostFiles struct {
+	Client    client.Client
+	Namespace string
+}
+
+// SyncHostFiles implements HostFilesSink.
+func (s *ConfigMapHostFiles) SyncHostFiles(ctx context.Context, target string, files map[string][]byte) error {
+	data := make(map[string]string, len(files))
+	for name, content := range files {
+		data[name] = string(content)
+	}
+	labels := map[string]string{
+		"app.kubernetes.io/name": "customrouter",
+		configMapManagedByLabel:  configMapManagedByValue,
+		hostFilesLabel:           target,
+	}
+	key := types.NamespacedName{Name: hostFilesBaseName + "-" + target, Namespace: s.Namespace}
+
+	existing := &corev1.ConfigMap{}
+	if err := s.Client.Get(ctx, key, existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		return s.Client.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, Labels: labels},
+			Data:       data,
+		})
+	}
+	if mapsEqual(existing.Data, data) && mapsEqual(existing.Labels, labels) {
+		return nil
+	}
+	existing.Labels = labels
+	existing.Data = data
+	return s.Client.Update(ctx, existing)
+}
+
+// BucketHostFiles writes the host files of a target under "<target>/hosts/"
+// in Bucket. The index is written after the host files and stale host files
+// are deleted after the index, so a reader following the index never finds
+// a file missing.
+type BucketHostFiles struct {
+	Bucket objectstore.Bucket
+
+	// written caches the checksum of every object this process wrote, so
+	// only the files of changed hosts are uploaded. Guarded by mu.
+	written map[string]string
+	mu      sync.Mutex
+}
+
+// SyncHostFiles implements HostFilesSink.
+func (s *BucketHostFiles) SyncHostFiles(ctx context.Context, target string, files map[string][]byte) error {
+	prefix := target + "/hosts/"
+	indexKey := prefix + routes.HostFilesIndexName
+
+	// The previous index, rather than process state, tells which files are
+	// stale, so hosts removed while the controller was down are deleted too.
+	var previous routes.HostFilesIndex
+	obj, err := s.Bucket.Get(ctx, indexKey, "")
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(obj.Data, &previous); err != nil {
+			return fmt.Errorf("invalid host files index %s: %w", indexKey, err)
+		}
+	case !errors.Is(err, objectstore.ErrNotFound):
+		return err
+	}
+
+	for _, name := range sortedFileNames(files) {
+		if name == routes.HostFilesIndexName {
+			continue
+		}
+		if err := s.put(ctx, prefix+name, files[name]); err != nil {
+			return err
+		}
+	}
+	if err := s.put(ctx, indexKey, files[routes.HostFilesIndexName]); err != nil {
+		return err
+	}
+	for _, name := range previous.Hosts {
+		if _, ok := files[name]; ok {
+			continue
+		}
+		if err := s.Bucket.Delete(ctx, prefix+name); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		delete(s.written, prefix+name)
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// put writes key unless this process already wrote the same data to it.
+func (s *BucketHostFiles) put(ctx context.Context, key string, data []byte) error {
+	checksum := routes.BucketChecksum(data)
+	s.mu.Lock()
+	unchanged := s.written[key] == checksum
+	s.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+	if err := s.Bucket.Put(ctx, key, data, map[string]string{routes.BucketMetadataSHA256: checksum}); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.written == nil {
+		s.written = make(map[string]string)
+	}
+	s.written[key] = checksum
+	return nil
+}
+
+// DirHostFiles writes the host files of a target into the directory
+// "<Dir>/<target>". Every file is replaced by a rename, so a reader sees
+// either its previous or its new content, and JSON files of hosts the
+// target no longer has are removed.
+type DirHostFiles struct {
+	Dir string
+}
+
+// SyncHostFiles implements HostFilesSink.
+func (s *DirHostFiles) SyncHostFiles(_ context.Context, target string, files map[string][]byte) error {
+	if target == "" || target == "." || target == ".." || strings.ContainsAny(target, `/\`) {
+		return fmt.Errorf("target %q is not a valid directory name", target)
+	}
+	dir := filepath.Join(s.Dir, target)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, name := range sortedFileNames(files) {
+		path := filepath.Join(dir, name)
+		if current, err := os.ReadFile(path); err == nil && string(current) == string(files[name]) {
+			continue
+		}
+		if err := writeFileAtomic(path, files[name]); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := files[name]; ok || entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
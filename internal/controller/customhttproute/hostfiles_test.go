@@ -0,0 +1,221 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// mapBucket is an in-memory objectstore.Bucket counting its writes.
+type mapBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func (b *mapBucket) Get(_ context.Context, key, _ string) (*objectstore.Object, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, objectstore.ErrNotFound
+	}
+	return &objectstore.Object{Data: data}, nil
+}
+
+func (b *mapBucket) Put(_ context.Context, key string, data []byte, _ map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key] = data
+	b.puts++
+	return nil
+}
+
+func (b *mapBucket) Delete(_ context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, key)
+	return nil
+}
+
+func (b *mapBucket) keys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hostRoute(target, host, path string) *v1alpha1.CustomHTTPRoute {
+	route := routeForTarget(target, path)
+	route.Spec.Hostnames = []string{host}
+	return route
+}
+
+func TestRebuildWritesHostFilesToDirectory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a := hostRoute("target-a", "a.example.com", "/a")
+	b := hostRoute("target-a", "b.example.com", "/b")
+	r := newReconciler(a, b)
+	r.HostFiles = &DirHostFiles{Dir: dir}
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	for _, name := range []string{"a.example.com.json", "b.example.com.json", routes.HostFilesIndexName} {
+		if _, err := os.Stat(filepath.Join(dir, "target-a", name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "target-a", "b.example.com.json"))
+	if err != nil {
+		t.Fatalf("failed to read host file: %v", err)
+	}
+	var file routes.HostFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("invalid host file: %v", err)
+	}
+	if file.Host != "b.example.com" || len(file.Routes) != 1 || file.Routes[0].Path != "/b" {
+		t.Errorf("host file = %+v, want the route of b.example.com", file)
+	}
+
+	// The file of a host the target no longer has is removed.
+	if err := r.Delete(ctx, b); err != nil {
+		t.Fatalf("failed to delete route: %v", err)
+	}
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "target-a", "b.example.com.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the file of b.example.com to be removed, stat error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "target-a", "a.example.com.json")); err != nil {
+		t.Errorf("expected the file of a.example.com to be kept: %v", err)
+	}
+}
+
+func TestBucketHostFiles(t *testing.T) {
+	ctx := context.Background()
+	bucket := &mapBucket{objects: make(map[string][]byte)}
+	// Another process left a host behind in the index.
+	bucket.objects["target-a/hosts/gone.example.com.json"] = []byte("{}")
+	bucket.objects["target-a/hosts/index.json"] = []byte(`{"hosts":{"gone.example.com":"gone.example.com.json"}}`)
+
+	a := hostRoute("target-a", "a.example.com", "/a")
+	b := hostRoute("target-a", "b.example.com", "/b")
+	r := newReconciler(a, b)
+	r.HostFiles = &BucketHostFiles{Bucket: bucket}
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	want := []string{"target-a/hosts/a.example.com.json", "target-a/hosts/b.example.com.json", "target-a/hosts/index.json"}
+	if got := bucket.keys(); !slices.Equal(got, want) {
+		t.Errorf("bucket keys = %v, want %v", got, want)
+	}
+
+	// Unchanged host files are not uploaded again, and the file of a
+	// removed host is deleted after the index no longer lists it.
+	puts := bucket.puts
+	if err := r.Delete(ctx, b); err != nil {
+		t.Fatalf("failed to delete route: %v", err)
+	}
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if got := bucket.puts - puts; got != 1 {
+		t.Errorf("expected only the index to be uploaded, got %d uploads", got)
+	}
+	want = []string{"target-a/hosts/a.example.com.json", "target-a/hosts/index.json"}
+	if got := bucket.keys(); !slices.Equal(got, want) {
+		t.Errorf("bucket keys = %v, want %v", got, want)
+	}
+}
+
+func TestConfigMapHostFiles(t *testing.T) {
+	ctx := context.Background()
+	r := newReconciler(hostRoute("target-a", "a.example.com", "/a"))
+	r.HostFiles = &ConfigMapHostFiles{Client: r.Client, Namespace: r.ConfigMapNamespace}
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: "customrouter-host-routes-target-a", Namespace: r.ConfigMapNamespace}
+	if err := r.Get(ctx, key, cm); err != nil {
+		t.Fatalf("expected the host files ConfigMap: %v", err)
+	}
+	if _, ok := cm.Data["a.example.com.json"]; !ok {
+		t.Errorf("ConfigMap keys = %v, want a.example.com.json", cm.Data)
+	}
+	if _, ok := cm.Labels[configMapTargetLabel]; ok {
+		t.Error("host files ConfigMap must not carry the target label extprocs load")
+	}
+}
+
+func TestNewHostFilesSink(t *testing.T) {
+	newBucket := func(string) (objectstore.Bucket, error) {
+		return &mapBucket{objects: make(map[string][]byte)}, nil
+	}
+	tests := []struct {
+		dest    string
+		want    string
+		wantErr bool
+	}{
+		{dest: "configmap", want: "*customhttproute.ConfigMapHostFiles"},
+		{dest: "s3://routes/review", want: "*customhttproute.BucketHostFiles"},
+		{dest: "gs://routes/review", want: "*customhttproute.BucketHostFiles"},
+		{dest: "/var/lib/customrouter/hosts", want: "*customhttproute.DirHostFiles"},
+		{dest: "relative/dir", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dest, func(t *testing.T) {
+			sink, err := NewHostFilesSink(tt.dest, nil, "ns", newBucket)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewHostFilesSink(%q) succeeded, want an error", tt.dest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewHostFilesSink(%q) error = %v", tt.dest, err)
+			}
+			if got := fmt.Sprintf("%T", sink); got != tt.want {
+				t.Errorf("NewHostFilesSink(%q) = %s, want %s", tt.dest, got, tt.want)
+			}
+		})
+	}
+}
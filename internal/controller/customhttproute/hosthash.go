@@ -0,0 +1,98 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"fmt"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// effectiveHostHashBuckets returns the bucket count of the host-hash
+// strategy, falling back to DefaultHostHashBuckets.
+func (r *CustomHTTPRouteReconciler) effectiveHostHashBuckets() int {
+	if r.HostHashBuckets > 0 {
+		return r.HostHashBuckets
+	}
+	return DefaultHostHashBuckets
+}
+
+// hostBucket maps a hostname to its host-hash bucket.
+func hostBucket(host string, buckets int) int {
+	return int(fnvHash(host) % uint32(buckets))
+}
+
+// partitionByHostHash implements PartitionStrategyHostHash: bucket b holds
+// every hostname hashing to b and is written to partition index b, so a
+// hostname always lives in the same ConfigMap and editing it leaves every
+// other bucket's bytes (and therefore its ConfigMap) untouched. Empty buckets
+// emit no ConfigMap.
+//
+// A bucket that does not fit in one ConfigMap is split with the size
+// strategy into overflow partitions numbered from the bucket count upwards,
+// so the regular bucket names never shift.
+func (r *CustomHTTPRouteReconciler) partitionByHostHash(
+	target string,
+	config *routes.RoutesConfig,
+) ([]ConfigMapPartition, error) {
+	bucketCount := r.effectiveHostHashBuckets()
+
+	buckets := make([]*routes.RoutesConfig, bucketCount)
+	for host, hostRoutes := range config.Hosts {
+		b := hostBucket(host, bucketCount)
+		if buckets[b] == nil {
+			buckets[b] = &routes.RoutesConfig{
+				Version: config.Version,
+				Hosts:   make(map[string][]routes.Route),
+			}
+		}
+		buckets[b].Hosts[host] = hostRoutes
+	}
+
+	var partitions []ConfigMapPartition
+	var overflow []*routes.RoutesConfig
+	for b, bucket := range buckets {
+		if bucket == nil {
+			continue
+		}
+		data, err := r.encodeRoutes(bucket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize host bucket %d for target %s: %w", b, target, err)
+		}
+		if len(data) > maxConfigMapSize {
+			overflow = append(overflow, bucket)
+			continue
+		}
+		partitions = append(partitions, ConfigMapPartition{
+			Name:   r.partitionName(target, b),
+			Target: target,
+			Data:   string(data),
+			Routes: bucket.RouteCount(),
+		})
+	}
+
+	next := bucketCount
+	for _, bucket := range overflow {
+		parts, nextIndex, err := r.splitByHostsFrom(target, bucket, next)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, parts...)
+		next = nextIndex
+	}
+	return partitions, nil
+}
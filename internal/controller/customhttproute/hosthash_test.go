@@ -0,0 +1,142 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func hostHashTestConfig(hosts int) *routes.RoutesConfig {
+	config := &routes.RoutesConfig{Version: 1, Hosts: make(map[string][]routes.Route)}
+	for i := 0; i < hosts; i++ {
+		host := fmt.Sprintf("host-%d.example.com", i)
+		config.Hosts[host] = []routes.Route{{Path: "/", Type: routes.RouteTypePrefix, Backend: "svc:80"}}
+	}
+	return config
+}
+
+func TestPartitionByHostHash_OneBucketPerChange(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{PartitionStrategy: PartitionStrategyHostHash, HostHashBuckets: 8}
+
+	before, err := r.partitionConfig("default", hostHashTestConfig(40))
+	if err != nil {
+		t.Fatalf("partitionConfig: %v", err)
+	}
+	if len(before) < 2 || len(before) > 8 {
+		t.Fatalf("expected between 2 and 8 bucket partitions, got %d", len(before))
+	}
+
+	changedConfig := hostHashTestConfig(40)
+	changedConfig.Hosts["host-7.example.com"][0].Backend = "other:80"
+	after, err := r.partitionConfig("default", changedConfig)
+	if err != nil {
+		t.Fatalf("partitionConfig: %v", err)
+	}
+
+	changed, added, removed := diffPartitions(partitionsByName(before), partitionsByName(after))
+	want := r.partitionName("default", hostBucket("host-7.example.com", 8))
+	if len(changed) != 1 || changed[0] != want || len(added) != 0 || len(removed) != 0 {
+		t.Errorf("changed=%v added=%v removed=%v, want only %s to change", changed, added, removed, want)
+	}
+}
+
+func TestPartitionByHostHash_HostStaysInItsBucket(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{PartitionStrategy: PartitionStrategyHostHash, HostHashBuckets: 4}
+
+	parts, err := r.partitionConfig("default", hostHashTestConfig(20))
+	if err != nil {
+		t.Fatalf("partitionConfig: %v", err)
+	}
+	for _, p := range parts {
+		_, index, ok := parsePartitionName(p.Name)
+		if !ok {
+			t.Fatalf("unparseable partition name %q", p.Name)
+		}
+		config, err := routes.DecodeRoutesConfig([]byte(p.Data))
+		if err != nil {
+			t.Fatalf("decode %s: %v", p.Name, err)
+		}
+		for host := range config.Hosts {
+			if b := hostBucket(host, 4); b != index {
+				t.Errorf("host %s written to partition %d, want bucket %d", host, index, b)
+			}
+		}
+	}
+}
+
+func TestPartitionByHostHash_OversizedBucketOverflows(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{PartitionStrategy: PartitionStrategyHostHash, HostHashBuckets: 2}
+
+	config := hostHashTestConfig(4)
+	big := "big.example.com"
+	config.Hosts[big] = largeRouteSet("big", 300)
+
+	parts, err := r.partitionConfig("default", config)
+	if err != nil {
+		t.Fatalf("partitionConfig: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	bigRoutes := 0
+	for _, p := range parts {
+		if len(p.Data) > maxConfigMapSize {
+			t.Errorf("partition %s is %d bytes, above the limit", p.Name, len(p.Data))
+		}
+		if seen[p.Name] {
+			t.Errorf("duplicate partition name %s", p.Name)
+		}
+		seen[p.Name] = true
+
+		_, index, _ := parsePartitionName(p.Name)
+		decoded, err := routes.DecodeRoutesConfig([]byte(p.Data))
+		if err != nil {
+			t.Fatalf("decode %s: %v", p.Name, err)
+		}
+		if _, ok := decoded.Hosts[big]; ok && index < 2 {
+			t.Errorf("oversized bucket written to regular bucket index %d", index)
+		}
+		bigRoutes += len(decoded.Hosts[big])
+	}
+	if bigRoutes != 300 {
+		t.Errorf("expected all 300 routes of %s across overflow partitions, got %d", big, bigRoutes)
+	}
+}
+
+func TestValidatePartitionStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		buckets  int
+		wantErr  bool
+	}{
+		{name: "default", strategy: ""},
+		{name: "size", strategy: PartitionStrategySize},
+		{name: "host-hash", strategy: PartitionStrategyHostHash, buckets: 16},
+		{name: "unknown strategy", strategy: "round-robin", wantErr: true},
+		{name: "negative buckets", strategy: PartitionStrategyHostHash, buckets: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePartitionStrategy(tt.strategy, tt.buckets); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePartitionStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
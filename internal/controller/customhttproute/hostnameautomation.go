@@ -0,0 +1,329 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
+)
+
+// dnsEndpointGVK is the ExternalDNS DNSEndpoint kind.
+var dnsEndpointGVK = schema.GroupVersionKind{
+	Group:   "externaldns.k8s.io",
+	Version: "v1alpha1",
+	Kind:    "DNSEndpoint",
+}
+
+// certificateGVK is the cert-manager Certificate kind.
+var certificateGVK = schema.GroupVersionKind{
+	Group:   "cert-manager.io",
+	Version: "v1",
+	Kind:    "Certificate",
+}
+
+// HostnameAutomationOptions configures the DNSEndpoints and Certificates
+// written for the hostnames of catch-all routes that set
+// hostnameAutomation (see syncHostnameAutomation).
+type HostnameAutomationOptions struct {
+	// Domains allow-lists the hostnames provisioned: a hostname is
+	// provisioned when it is one of them or a subdomain of one.
+	Domains []string
+
+	// Namespace is where the DNSEndpoints and Certificates are written. It
+	// must be the namespace the gateway reads certificate Secrets from.
+	Namespace string
+
+	// DNSTargets maps a target to the address its gateway is reached at:
+	// an IP gets A or AAAA records, a hostname CNAME records. Targets not
+	// listed get no DNSEndpoints.
+	DNSTargets map[string]string
+
+	// IssuerKind and IssuerName are the cert-manager issuer of the
+	// Certificates. An empty IssuerName writes no Certificates.
+	IssuerKind string
+	IssuerName string
+}
+
+// ParseHostnameAutomationDomains parses the --hostname-automation-domains
+// flag value: comma-separated domains, lowercased.
+func ParseHostnameAutomationDomains(value string) []string {
+	var out []string
+	for _, domain := range strings.Split(value, ",") {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "*.")
+		if domain = strings.Trim(domain, "."); domain != "" {
+			out = append(out, domain)
+		}
+	}
+	return out
+}
+
+// ParseHostnameDNSTargets parses the --hostname-dns-targets flag value:
+// comma-separated target=address pairs.
+func ParseHostnameDNSTargets(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	out := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, address, ok := strings.Cut(entry, "=")
+		target, address = strings.TrimSpace(target), strings.TrimSpace(address)
+		if !ok || target == "" || address == "" {
+			return nil, fmt.Errorf("invalid hostname-dns-targets entry %q: expected target=address", entry)
+		}
+		out[target] = address
+	}
+	return out, nil
+}
+
+// ParseCertificateIssuer parses the --hostname-certificate-issuer flag
+// value: [Issuer/|ClusterIssuer/]name, a ClusterIssuer by default.
+func ParseCertificateIssuer(value string) (kind, name string, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", "", nil
+	}
+	kind, name, ok := strings.Cut(value, "/")
+	if !ok {
+		kind, name = "ClusterIssuer", value
+	}
+	if (kind != "Issuer" && kind != "ClusterIssuer") || name == "" {
+		return "", "", fmt.Errorf("invalid hostname-certificate-issuer %q: expected [Issuer/|ClusterIssuer/]name", value)
+	}
+	return kind, name, nil
+}
+
+// allowsHostname reports whether host is one of the allowed domains or a
+// subdomain of one.
+func (o *HostnameAutomationOptions) allowsHostname(host string) bool {
+	host = strings.TrimPrefix(strings.ToLower(host), "*.")
+	for _, domain := range o.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostnameAutomationWarnings returns why hostnames of route requesting
+// hostnameAutomation get no DNSEndpoint or Certificate, for its status.
+func (r *CustomHTTPRouteReconciler) hostnameAutomationWarnings(route *v1alpha1.CustomHTTPRoute) []string {
+	if route.Spec.CatchAllRoute == nil || route.Spec.CatchAllRoute.HostnameAutomation == nil {
+		return nil
+	}
+	automation := route.Spec.CatchAllRoute.HostnameAutomation
+	opts := r.HostnameAutomation
+	if opts == nil {
+		if automation.DNS || automation.Certificate {
+			return []string{"catchAllRoute.hostnameAutomation is ignored: the operator runs without --hostname-automation-domains"}
+		}
+		return nil
+	}
+
+	var warnings []string
+	if automation.DNS && opts.DNSTargets[route.Spec.TargetRef.Name] == "" {
+		warnings = append(warnings, fmt.Sprintf(
+			"catchAllRoute.hostnameAutomation.dns is ignored: target %s has no address in --hostname-dns-targets",
+			route.Spec.TargetRef.Name))
+	}
+	if automation.Certificate && opts.IssuerName == "" {
+		warnings = append(warnings,
+			"catchAllRoute.hostnameAutomation.certificate is ignored: the operator runs without --hostname-certificate-issuer")
+	}
+	if automation.DNS || automation.Certificate {
+		for _, host := range route.Spec.Hostnames {
+			if !opts.allowsHostname(host) {
+				warnings = append(warnings, fmt.Sprintf(
+					"hostname %s is outside --hostname-automation-domains: no DNS record or certificate is provisioned", host))
+			}
+		}
+	}
+	return warnings
+}
+
+// syncHostnameAutomation writes a DNSEndpoint and a Certificate for every
+// allowed hostname of the admitted catch-all routes of target that ask for
+// them, and deletes the ones of target no longer needed. It does nothing
+// unless HostnameAutomation is set, and skips a kind whose CRD is not
+// installed.
+func (r *CustomHTTPRouteReconciler) syncHostnameAutomation(ctx context.Context, target string, admitted []expandedRoute) error {
+	opts := r.HostnameAutomation
+	if opts == nil {
+		return nil
+	}
+
+	dnsHosts := make(map[string]bool)
+	certificateHosts := make(map[string]bool)
+	for _, e := range admitted {
+		catchAll := e.route.Spec.CatchAllRoute
+		if catchAll == nil || catchAll.HostnameAutomation == nil {
+			continue
+		}
+		for _, host := range e.route.Spec.Hostnames {
+			if !opts.allowsHostname(host) {
+				continue
+			}
+			if catchAll.HostnameAutomation.DNS && opts.DNSTargets[target] != "" {
+				dnsHosts[host] = true
+			}
+			if catchAll.HostnameAutomation.Certificate && opts.IssuerName != "" {
+				certificateHosts[host] = true
+			}
+		}
+	}
+
+	endpoints := make([]*unstructured.Unstructured, 0, len(dnsHosts))
+	for _, host := range slices.Sorted(maps.Keys(dnsHosts)) {
+		endpoints = append(endpoints, r.buildDNSEndpoint(target, host))
+	}
+	if err := r.syncHostnameObjects(ctx, target, dnsEndpointGVK, endpoints); err != nil {
+		return err
+	}
+
+	certificates := make([]*unstructured.Unstructured, 0, len(certificateHosts))
+	for _, host := range slices.Sorted(maps.Keys(certificateHosts)) {
+		certificates = append(certificates, r.buildCertificate(target, host))
+	}
+	return r.syncHostnameObjects(ctx, target, certificateGVK, certificates)
+}
+
+// syncHostnameObjects upserts objects, all of kind gvk, and deletes the
+// other objects of that kind generated for target.
+func (r *CustomHTTPRouteReconciler) syncHostnameObjects(
+	ctx context.Context,
+	target string,
+	gvk schema.GroupVersionKind,
+	objects []*unstructured.Unstructured,
+) error {
+	logger := log.FromContext(ctx)
+
+	active := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		if err := ef.UpsertUnstructured(ctx, r.Client, obj); err != nil {
+			if meta.IsNoMatchError(err) {
+				logger.Info(gvk.Kind+" CRD not installed, skipping hostname automation", "target", target)
+				return nil
+			}
+			return fmt.Errorf("failed to upsert %s %s/%s: %w", gvk.Kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+		active[obj.GetName()] = true
+	}
+
+	existing := &unstructured.UnstructuredList{}
+	existing.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err := r.List(ctx, existing, &client.ListOptions{
+		Namespace: r.HostnameAutomation.Namespace,
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			configMapManagedByLabel: configMapManagedByValue,
+			configMapTargetLabel:    target,
+		}),
+	}); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list %ss for target %s: %w", gvk.Kind, target, err)
+	}
+	for i := range existing.Items {
+		obj := &existing.Items[i]
+		if active[obj.GetName()] {
+			continue
+		}
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete stale %s %s/%s: %w", gvk.Kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// hostnameObjectName is the name of the DNSEndpoint and the Certificate
+// (and its Secret) of host for target.
+func hostnameObjectName(target, host string) string {
+	return fmt.Sprintf("customrouter-%s-%08x", target, fnvHash(strings.ToLower(host)))
+}
+
+// newHostnameObject returns an empty object of kind gvk for host, labeled
+// like the route ConfigMaps of target.
+func (r *CustomHTTPRouteReconciler) newHostnameObject(gvk schema.GroupVersionKind, target, host string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(hostnameObjectName(target, host))
+	obj.SetNamespace(r.HostnameAutomation.Namespace)
+	obj.SetLabels(map[string]string{
+		configMapManagedByLabel: configMapManagedByValue,
+		configMapTargetLabel:    target,
+	})
+	obj.SetAnnotations(map[string]string{hostnameAnnotation: host})
+	return obj
+}
+
+// buildDNSEndpoint returns the DNSEndpoint pointing host at the address of
+// target.
+func (r *CustomHTTPRouteReconciler) buildDNSEndpoint(target, host string) *unstructured.Unstructured {
+	address := r.HostnameAutomation.DNSTargets[target]
+	recordType := "CNAME"
+	if ip := net.ParseIP(address); ip != nil {
+		recordType = "A"
+		if ip.To4() == nil {
+			recordType = "AAAA"
+		}
+	}
+	endpoint := r.newHostnameObject(dnsEndpointGVK, target, host)
+	endpoint.Object["spec"] = map[string]interface{}{
+		"endpoints": []interface{}{
+			map[string]interface{}{
+				"dnsName":    host,
+				"recordType": recordType,
+				"targets":    []interface{}{address},
+			},
+		},
+	}
+	return endpoint
+}
+
+// buildCertificate returns the Certificate of host, stored in a Secret of
+// the same name.
+func (r *CustomHTTPRouteReconciler) buildCertificate(target, host string) *unstructured.Unstructured {
+	certificate := r.newHostnameObject(certificateGVK, target, host)
+	certificate.Object["spec"] = map[string]interface{}{
+		"secretName": certificate.GetName(),
+		"dnsNames":   []interface{}{host},
+		"issuerRef": map[string]interface{}{
+			"group": certificateGVK.Group,
+			"kind":  r.HostnameAutomation.IssuerKind,
+			"name":  r.HostnameAutomation.IssuerName,
+		},
+	}
+	return certificate
+}
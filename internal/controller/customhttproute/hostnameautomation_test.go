@@ -0,0 +1,176 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestParseHostnameAutomationFlags(t *testing.T) {
+	if got := ParseHostnameAutomationDomains(" Example.com, *.shop.io ,,.dev."); !reflect.DeepEqual(got, []string{"example.com", "shop.io", "dev"}) {
+		t.Errorf("ParseHostnameAutomationDomains() = %v", got)
+	}
+
+	targets, err := ParseHostnameDNSTargets("web = lb.example.net, api=203.0.113.10")
+	if err != nil {
+		t.Fatalf("ParseHostnameDNSTargets failed: %v", err)
+	}
+	if want := map[string]string{"web": "lb.example.net", "api": "203.0.113.10"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("ParseHostnameDNSTargets() = %v, want %v", targets, want)
+	}
+	for _, bad := range []string{"web", "web=", "=lb.example.net"} {
+		if _, err := ParseHostnameDNSTargets(bad); err == nil {
+			t.Errorf("ParseHostnameDNSTargets(%q) succeeded, want an error", bad)
+		}
+	}
+
+	for value, want := range map[string][2]string{
+		"letsencrypt":              {"ClusterIssuer", "letsencrypt"},
+		"Issuer/internal-ca":       {"Issuer", "internal-ca"},
+		"ClusterIssuer/production": {"ClusterIssuer", "production"},
+		"":                         {"", ""},
+	} {
+		kind, name, err := ParseCertificateIssuer(value)
+		if err != nil || kind != want[0] || name != want[1] {
+			t.Errorf("ParseCertificateIssuer(%q) = %q, %q, %v, want %v", value, kind, name, err, want)
+		}
+	}
+	for _, bad := range []string{"Secret/ca", "Issuer/"} {
+		if _, _, err := ParseCertificateIssuer(bad); err == nil {
+			t.Errorf("ParseCertificateIssuer(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+// automatedRoute returns a catch-all CustomHTTPRoute of target web for
+// hostnames, asking for DNS records and certificates.
+func automatedRoute(hostnames ...string) *v1alpha1.CustomHTTPRoute {
+	return &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "default"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "web"},
+			Hostnames: hostnames,
+			CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+				BackendRef:         v1alpha1.BackendRef{Name: "web", Namespace: "default", Port: 80},
+				HostnameAutomation: &v1alpha1.HostnameAutomation{DNS: true, Certificate: true},
+			},
+		},
+	}
+}
+
+func TestSyncHostnameAutomation(t *testing.T) {
+	scheme := newScheme()
+	for _, gvk := range []schema.GroupVersionKind{dnsEndpointGVK, certificateGVK} {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+	r := &CustomHTTPRouteReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		HostnameAutomation: &HostnameAutomationOptions{
+			Domains:    []string{"example.com"},
+			Namespace:  "istio-system",
+			DNSTargets: map[string]string{"web": "203.0.113.10"},
+			IssuerKind: "ClusterIssuer",
+			IssuerName: "letsencrypt",
+		},
+	}
+	ctx := context.Background()
+	list := func(gvk schema.GroupVersionKind) []unstructured.Unstructured {
+		t.Helper()
+		objects := &unstructured.UnstructuredList{}
+		objects.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.List(ctx, objects, client.InNamespace("istio-system")); err != nil {
+			t.Fatalf("List %s: %v", gvk.Kind, err)
+		}
+		return objects.Items
+	}
+
+	route := automatedRoute("shop.example.com", "shop.example.org")
+	if err := r.syncHostnameAutomation(ctx, "web", []expandedRoute{{route: route}}); err != nil {
+		t.Fatalf("syncHostnameAutomation failed: %v", err)
+	}
+
+	endpoints := list(dnsEndpointGVK)
+	if len(endpoints) != 1 {
+		t.Fatalf("DNSEndpoints = %d, want one for the allowed hostname", len(endpoints))
+	}
+	endpoint, _, _ := unstructured.NestedSlice(endpoints[0].Object, "spec", "endpoints")
+	wantEndpoint := map[string]interface{}{
+		"dnsName":    "shop.example.com",
+		"recordType": "A",
+		"targets":    []interface{}{"203.0.113.10"},
+	}
+	if len(endpoint) != 1 || !reflect.DeepEqual(endpoint[0], wantEndpoint) {
+		t.Errorf("endpoints = %v, want %v", endpoint, wantEndpoint)
+	}
+
+	certificates := list(certificateGVK)
+	if len(certificates) != 1 {
+		t.Fatalf("Certificates = %d, want one for the allowed hostname", len(certificates))
+	}
+	certificate := certificates[0]
+	if got := certificate.GetAnnotations()[hostnameAnnotation]; got != "shop.example.com" {
+		t.Errorf("hostname annotation = %q, want shop.example.com", got)
+	}
+	secretName, _, _ := unstructured.NestedString(certificate.Object, "spec", "secretName")
+	issuer, _, _ := unstructured.NestedString(certificate.Object, "spec", "issuerRef", "name")
+	if secretName != certificate.GetName() || issuer != "letsencrypt" {
+		t.Errorf("Certificate spec = %v, want its own Secret issued by letsencrypt", certificate.Object["spec"])
+	}
+
+	// The hostname leaves the route: its objects are deleted.
+	if err := r.syncHostnameAutomation(ctx, "web", []expandedRoute{{route: automatedRoute("shop.example.org")}}); err != nil {
+		t.Fatalf("syncHostnameAutomation failed: %v", err)
+	}
+	if n, m := len(list(dnsEndpointGVK)), len(list(certificateGVK)); n != 0 || m != 0 {
+		t.Errorf("DNSEndpoints = %d, Certificates = %d after the hostname was removed, want none", n, m)
+	}
+}
+
+func TestHostnameAutomationWarnings(t *testing.T) {
+	route := automatedRoute("shop.example.com", "shop.example.org")
+
+	r := &CustomHTTPRouteReconciler{}
+	if got := r.hostnameAutomationWarnings(route); len(got) != 1 {
+		t.Errorf("warnings without the feature enabled = %v, want one", got)
+	}
+
+	r.HostnameAutomation = &HostnameAutomationOptions{Domains: []string{"example.com"}}
+	want := []string{
+		"catchAllRoute.hostnameAutomation.dns is ignored: target web has no address in --hostname-dns-targets",
+		"catchAllRoute.hostnameAutomation.certificate is ignored: the operator runs without --hostname-certificate-issuer",
+		"hostname shop.example.org is outside --hostname-automation-domains: no DNS record or certificate is provisioned",
+	}
+	if got := r.hostnameAutomationWarnings(route); !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+
+	route.Spec.CatchAllRoute.HostnameAutomation = nil
+	if got := r.hostnameAutomationWarnings(route); got != nil {
+		t.Errorf("warnings without hostnameAutomation = %v, want none", got)
+	}
+}
@@ -0,0 +1,632 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// HTTPProxyMode selects, for a target listed in HTTPProxyTargets, whether
+// Contour HTTPProxies replace its route ConfigMaps or are written alongside
+// them.
+type HTTPProxyMode string
+
+const (
+	// HTTPProxyModeAlso writes HTTPProxies in addition to the ConfigMaps.
+	HTTPProxyModeAlso HTTPProxyMode = "also"
+
+	// HTTPProxyModeOnly writes HTTPProxies instead of the ConfigMaps.
+	HTTPProxyModeOnly HTTPProxyMode = "only"
+)
+
+// httpProxyGVK is the Contour HTTPProxy kind.
+var httpProxyGVK = schema.GroupVersionKind{
+	Group:   "projectcontour.io",
+	Version: "v1",
+	Kind:    "HTTPProxy",
+}
+
+// hostnameAnnotation records on every object generated per hostname
+// (HTTPProxies, DNSEndpoints, Certificates) the hostname it serves, since
+// object names carry a hash of it.
+const hostnameAnnotation = "customrouter.freepik.com/hostname"
+
+// ParseHTTPProxyTargets parses the --httpproxy-targets flag value:
+// comma-separated target names, each optionally followed by "=also" (the
+// default) or "=only".
+func ParseHTTPProxyTargets(value string) (map[string]HTTPProxyMode, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	out := make(map[string]HTTPProxyMode)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, mode, hasMode := strings.Cut(entry, "=")
+		target = strings.TrimSpace(target)
+		if target == "" {
+			return nil, fmt.Errorf("invalid httpproxy-targets entry %q: expected target[=also|only]", entry)
+		}
+		m := HTTPProxyModeAlso
+		if hasMode {
+			m = HTTPProxyMode(strings.TrimSpace(mode))
+		}
+		if m != HTTPProxyModeAlso && m != HTTPProxyModeOnly {
+			return nil, fmt.Errorf("invalid httpproxy-targets mode %q for target %q (want %q or %q)",
+				m, target, HTTPProxyModeAlso, HTTPProxyModeOnly)
+		}
+		if _, dup := out[target]; dup {
+			return nil, fmt.Errorf("duplicate httpproxy-targets entry for target %q", target)
+		}
+		out[target] = m
+	}
+	return out, nil
+}
+
+// writesConfigMaps reports whether target's routes are written to
+// ConfigMaps, i.e. it is not an HTTPProxyModeOnly target.
+func (r *CustomHTTPRouteReconciler) writesConfigMaps(target string) bool {
+	return r.HTTPProxyTargets[target] != HTTPProxyModeOnly
+}
+
+// httpProxyDenyStatus is the status of the direct response answering the
+// paths of the routes left out of an HTTPProxy, so their requests do not
+// fall through to a broader route of the host.
+const httpProxyDenyStatus = 503
+
+// skippedHTTPProxyRoute is a route left out of the HTTPProxies because it
+// uses a feature HTTPProxy cannot express. Its requests are answered with
+// httpProxyDenyStatus, unless its match conditions cannot be expressed
+// either and its whole host is left unpublished (refused).
+type skippedHTTPProxyRoute struct {
+	host    string
+	route   *routes.Route
+	reason  string
+	refused bool
+}
+
+// message describes s for the HTTPProxyRoutesSkipped condition of its
+// CustomHTTPRoute.
+func (s skippedHTTPProxyRoute) message() string {
+	source := types.NamespacedName{}
+	source.Namespace, source.Name, _ = strings.Cut(s.route.Source, "/")
+	outcome := fmt.Sprintf("answered with %d", httpProxyDenyStatus)
+	if s.refused {
+		outcome = "host not published"
+	}
+	return fmt.Sprintf("%s on %s: %s, %s", reportRoute(s.route, source), s.host, s.reason, outcome)
+}
+
+// syncHTTPProxies writes the HTTPProxies of a target listed in
+// HTTPProxyTargets from its admitted CustomHTTPRoutes and deletes the ones it
+// no longer needs. Other targets are left alone, so HTTPProxies of a target
+// removed from HTTPProxyTargets must be deleted by hand.
+func (r *CustomHTTPRouteReconciler) syncHTTPProxies(ctx context.Context, target string, admitted []expandedRoute) error {
+	if _, ok := r.HTTPProxyTargets[target]; !ok {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+
+	// Expanded again without ExternalName resolution: HTTPProxy services
+	// are referenced by name, and Contour resolves ExternalName Services
+	// itself.
+	expanded := make([]map[string][]routes.Route, 0, len(admitted))
+	for _, e := range admitted {
+		hosts, err := routes.ExpandRoutes(e.route, nil)
+		if err != nil {
+			continue
+		}
+		routes.AssignRouteIdentity(hosts, e.route.Namespace+"/"+e.route.Name)
+		expanded = append(expanded, hosts)
+	}
+	config := routes.MergeRoutesConfig(expanded...)
+
+	proxies, skipped := buildHTTPProxies(r.ConfigMapNamespace, target, config)
+	var bySource map[types.NamespacedName][]string
+	for _, s := range skipped {
+		logger.Info("route left out of the HTTPProxies: not expressible in Contour",
+			"target", target,
+			"host", s.host,
+			"path", s.route.Path,
+			"source", s.route.Source,
+			"reason", s.reason,
+			"hostRefused", s.refused)
+		source := types.NamespacedName{}
+		source.Namespace, source.Name, _ = strings.Cut(s.route.Source, "/")
+		if bySource == nil {
+			bySource = make(map[types.NamespacedName][]string)
+		}
+		bySource[source] = append(bySource[source], s.message())
+	}
+	r.setSkippedHTTPProxyRoutes(target, bySource)
+
+	active := make(map[string]bool, len(proxies))
+	for _, proxy := range proxies {
+		if err := ef.UpsertUnstructured(ctx, r.Client, proxy); err != nil {
+			if meta.IsNoMatchError(err) {
+				logger.Info("HTTPProxy CRD not installed, skipping Contour output", "target", target)
+				return nil
+			}
+			return fmt.Errorf("failed to upsert HTTPProxy %s/%s: %w", proxy.GetNamespace(), proxy.GetName(), err)
+		}
+		active[proxy.GetNamespace()+"/"+proxy.GetName()] = true
+	}
+
+	existing := &unstructured.UnstructuredList{}
+	existing.SetGroupVersionKind(httpProxyGVK.GroupVersion().WithKind(httpProxyGVK.Kind + "List"))
+	if err := r.List(ctx, existing, &client.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			configMapManagedByLabel: configMapManagedByValue,
+			configMapTargetLabel:    target,
+		}),
+	}); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list HTTPProxies for target %s: %w", target, err)
+	}
+	for i := range existing.Items {
+		proxy := &existing.Items[i]
+		if active[proxy.GetNamespace()+"/"+proxy.GetName()] {
+			continue
+		}
+		if err := r.Delete(ctx, proxy); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete stale HTTPProxy %s/%s: %w", proxy.GetNamespace(), proxy.GetName(), err)
+		}
+	}
+
+	logger.Info("HTTPProxies updated successfully",
+		"target", target,
+		"proxies", len(proxies),
+		"skippedRoutes", len(skipped))
+	return nil
+}
+
+// setSkippedHTTPProxyRoutes records the routes the last HTTPProxy sync of
+// target left out, by CustomHTTPRoute, replacing the previous set.
+func (r *CustomHTTPRouteReconciler) setSkippedHTTPProxyRoutes(target string, skipped map[types.NamespacedName][]string) {
+	r.httpProxyMu.Lock()
+	defer r.httpProxyMu.Unlock()
+	if len(skipped) == 0 {
+		delete(r.httpProxySkipped, target)
+		return
+	}
+	if r.httpProxySkipped == nil {
+		r.httpProxySkipped = make(map[string]map[types.NamespacedName][]string)
+	}
+	r.httpProxySkipped[target] = skipped
+}
+
+// skippedHTTPProxyRoutes returns the descriptions of the routes of the given
+// CustomHTTPRoute that the last HTTPProxy sync of target left out.
+func (r *CustomHTTPRouteReconciler) skippedHTTPProxyRoutes(target string, key types.NamespacedName) []string {
+	r.httpProxyMu.Lock()
+	defer r.httpProxyMu.Unlock()
+	return r.httpProxySkipped[target][key]
+}
+
+// httpProxyName is the name of the HTTPProxies serving host for target.
+// The root proxy and its children share it; each lives in its own
+// namespace.
+func httpProxyName(target, host string) string {
+	return fmt.Sprintf("customrouter-%s-%08x", target, fnvHash(host))
+}
+
+// newHTTPProxy returns an empty HTTPProxy labeled like the route ConfigMaps
+// of target.
+func newHTTPProxy(namespace, target, host string) *unstructured.Unstructured {
+	proxy := &unstructured.Unstructured{}
+	proxy.SetGroupVersionKind(httpProxyGVK)
+	proxy.SetName(httpProxyName(target, host))
+	proxy.SetNamespace(namespace)
+	proxy.SetLabels(map[string]string{
+		configMapManagedByLabel: configMapManagedByValue,
+		configMapTargetLabel:    target,
+	})
+	proxy.SetAnnotations(map[string]string{hostnameAnnotation: host})
+	return proxy
+}
+
+// buildHTTPProxies translates config into Contour HTTPProxies: for every
+// hostname, a root proxy in namespace owning the virtual host, which
+// includes one child proxy per other namespace of the Services its routes
+// forward to (HTTPProxy services must live in the proxy's namespace). Routes
+// to Services in namespace stay in the root proxy. Routes using a
+// feature HTTPProxy cannot express are returned as skipped instead, and
+// their match conditions answered with httpProxyDenyStatus so their requests
+// do not reach a broader route of the host. A host with a skipped route whose
+// match conditions cannot be expressed either gets no proxies, and all its
+// routes are returned as skipped.
+func buildHTTPProxies(
+	namespace, target string,
+	config *routes.RoutesConfig,
+) ([]*unstructured.Unstructured, []skippedHTTPProxyRoute) {
+	hosts := make([]string, 0, len(config.Hosts))
+	for host := range config.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var proxies []*unstructured.Unstructured
+	var skipped []skippedHTTPProxyRoute
+	for _, host := range hosts {
+		byNamespace := make(map[string][]interface{})
+		var hostSkipped []skippedHTTPProxyRoute
+		var emitted [][]interface{}
+		for i := range config.Hosts[host] {
+			route := &config.Hosts[host][i]
+			routeNamespace, converted, reason := convertHTTPProxyRoute(route, namespace)
+			if reason != "" {
+				hostSkipped = append(hostSkipped, skippedHTTPProxyRoute{host: host, route: route, reason: reason})
+				continue
+			}
+			byNamespace[routeNamespace] = append(byNamespace[routeNamespace], converted)
+			emitted = append(emitted, converted["conditions"].([]interface{}))
+		}
+
+		// Deny the requests of every skipped route. Contour rejects two
+		// routes with the same conditions, and a route emitted with the
+		// same conditions (e.g. the unsampled sibling of a fraction) is
+		// the one those requests were meant to reach anyway.
+		refusal := ""
+		var denies []interface{}
+		for _, s := range hostSkipped {
+			conditions, reason := httpProxyConditions(s.route)
+			if reason != "" {
+				refusal = reason
+				break
+			}
+			if slices.ContainsFunc(emitted, func(c []interface{}) bool { return reflect.DeepEqual(c, conditions) }) {
+				continue
+			}
+			emitted = append(emitted, conditions)
+			denies = append(denies, map[string]interface{}{
+				"conditions":           conditions,
+				"directResponsePolicy": map[string]interface{}{"statusCode": int64(httpProxyDenyStatus)},
+			})
+		}
+		if refusal != "" {
+			// Every route of the host is reported: none of them is served.
+			for i := range config.Hosts[host] {
+				route := &config.Hosts[host][i]
+				reason := "host has a route with a " + refusal
+				for _, s := range hostSkipped {
+					if s.route == route {
+						reason = s.reason
+					}
+				}
+				skipped = append(skipped, skippedHTTPProxyRoute{host: host, route: route, reason: reason, refused: true})
+			}
+			continue
+		}
+		skipped = append(skipped, hostSkipped...)
+		byNamespace[namespace] = append(byNamespace[namespace], denies...)
+		if len(byNamespace[namespace]) == 0 {
+			delete(byNamespace, namespace)
+		}
+		if len(byNamespace) == 0 {
+			continue
+		}
+
+		namespaces := make([]string, 0, len(byNamespace))
+		for ns := range byNamespace {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+
+		root := newHTTPProxy(namespace, target, host)
+		rootSpec := map[string]interface{}{
+			"virtualhost": map[string]interface{}{"fqdn": host},
+		}
+		var includes []interface{}
+		for _, ns := range namespaces {
+			if ns == namespace {
+				rootSpec["routes"] = byNamespace[ns]
+				continue
+			}
+			child := newHTTPProxy(ns, target, host)
+			child.Object["spec"] = map[string]interface{}{
+				"routes": byNamespace[ns],
+			}
+			proxies = append(proxies, child)
+			includes = append(includes, map[string]interface{}{
+				"name":      child.GetName(),
+				"namespace": ns,
+			})
+		}
+
+		if len(includes) > 0 {
+			rootSpec["includes"] = includes
+		}
+		root.Object["spec"] = rootSpec
+		proxies = append(proxies, root)
+	}
+	return proxies, skipped
+}
+
+// convertHTTPProxyRoute translates route into an HTTPProxy route and the
+// namespace of the proxy it belongs in: the namespace of its Service, or
+// defaultNamespace for a redirect. It returns a non-empty reason instead
+// when route uses a feature HTTPProxy cannot express.
+func convertHTTPProxyRoute(route *routes.Route, defaultNamespace string) (string, map[string]interface{}, string) {
+	switch {
+	case route.Fraction != nil:
+		return "", nil, "fraction"
+	case route.CaseInsensitive:
+		return "", nil, "caseInsensitive"
+	case route.OverrideHeader != "":
+		return "", nil, "overrideHeader"
+	case route.Outlier != nil:
+		return "", nil, "outlierPolicy"
+	case route.Failover != nil:
+		return "", nil, "backendFailover"
+	case route.MaxRequestBytes > 0:
+		return "", nil, "maxRequestBytes"
+	case route.UnmatchedPolicy != "":
+		return "", nil, "unmatchedRequestPolicy"
+	case route.Maintenance != nil:
+		return "", nil, "maintenance"
+	case route.Variant != "":
+		return "", nil, "variant"
+	case len(route.Mirrors) > 0:
+		return "", nil, "request-mirror"
+	case route.CORS != nil:
+		return "", nil, "cors"
+	case route.SequentialActions && len(route.Actions) > 1:
+		return "", nil, "actionOrder Sequential"
+	case route.ProtocolHint != "" && route.ProtocolHint != routes.ProtocolHintWebSocket:
+		return "", nil, "protocolHints " + route.ProtocolHint
+	case route.HashPolicy != nil && route.HashPolicy.CookieName != "":
+		return "", nil, "hashPolicy cookie"
+	}
+
+	conditions, reason := httpProxyConditions(route)
+	if reason != "" {
+		return "", nil, reason
+	}
+	out := map[string]interface{}{"conditions": conditions}
+	if route.ProtocolHint == routes.ProtocolHintWebSocket {
+		out["enableWebsockets"] = true
+	}
+
+	var requestSet, responseSet []interface{}
+	var requestRemove, responseRemove []interface{}
+	redirect := false
+	for i := range route.Actions {
+		action := &route.Actions[i]
+		switch action.Type {
+		case routes.ActionTypeRedirect:
+			policy, reason := httpProxyRedirect(route, action)
+			if reason != "" {
+				return "", nil, reason
+			}
+			out["requestRedirectPolicy"] = policy
+			redirect = true
+		case routes.ActionTypeRewrite:
+			if len(action.RewriteSegments) > 0 {
+				return "", nil, "rewrite of path segments"
+			}
+			if action.RewritePath != "" {
+				if route.Type != routes.RouteTypePrefix || action.RewriteReplacePrefixMatch == nil || !*action.RewriteReplacePrefixMatch {
+					return "", nil, "rewrite of the full path"
+				}
+				out["pathRewritePolicy"] = map[string]interface{}{
+					"replacePrefix": []interface{}{
+						map[string]interface{}{"prefix": route.Path, "replacement": action.RewritePath},
+					},
+				}
+			}
+			if action.RewriteHostname != "" {
+				requestSet = append(requestSet, httpProxyHeader("Host", action.RewriteHostname))
+			}
+		case routes.ActionTypeHeaderSet:
+			requestSet = append(requestSet, httpProxyHeader(action.HeaderName, action.Value))
+		case routes.ActionTypeHeaderRemove:
+			requestRemove = append(requestRemove, action.HeaderName)
+		case routes.ActionTypeResponseHeaderSet:
+			responseSet = append(responseSet, httpProxyHeader(action.HeaderName, action.Value))
+		case routes.ActionTypeResponseHeaderRemove:
+			responseRemove = append(responseRemove, action.HeaderName)
+		default:
+			return "", nil, action.Type + " action"
+		}
+	}
+	if policy := httpProxyHeadersPolicy(requestSet, requestRemove); policy != nil {
+		out["requestHeadersPolicy"] = policy
+	}
+	if policy := httpProxyHeadersPolicy(responseSet, responseRemove); policy != nil {
+		out["responseHeadersPolicy"] = policy
+	}
+	if redirect {
+		return defaultNamespace, out, ""
+	}
+
+	name, namespace, port, ok := parseServiceBackend(route.Backend)
+	if !ok {
+		return "", nil, "backend " + route.Backend + " is not a Service"
+	}
+	service := map[string]interface{}{"name": name, "port": int64(port)}
+	switch protocol := route.BackendProtocols[route.Backend]; {
+	case protocol == v1alpha1.BackendProtocolH2 || protocol == v1alpha1.BackendProtocolH2C:
+		service["protocol"] = protocol
+	case protocol == "" && route.GRPC:
+		service["protocol"] = "h2c"
+	}
+	out["services"] = []interface{}{service}
+	if route.HashPolicy != nil {
+		out["loadBalancerPolicy"] = map[string]interface{}{
+			"strategy": "RequestHash",
+			"requestHashPolicies": []interface{}{
+				map[string]interface{}{
+					"headerHashOptions": map[string]interface{}{"headerName": route.HashPolicy.Header},
+				},
+			},
+		}
+	}
+	return namespace, out, ""
+}
+
+// httpProxyConditions translates the match criteria of route into HTTPProxy
+// match conditions.
+func httpProxyConditions(route *routes.Route) ([]interface{}, string) {
+	var conditions []interface{}
+	switch route.Type {
+	case routes.RouteTypeExact:
+		conditions = append(conditions, map[string]interface{}{"exact": route.Path})
+	case routes.RouteTypePrefix:
+		conditions = append(conditions, map[string]interface{}{"prefix": route.Path})
+	default:
+		return nil, route.Type + " path match"
+	}
+	if route.Scheme != "" {
+		return nil, "scheme match"
+	}
+	if route.Method != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"header": map[string]interface{}{"name": ":method", "exact": strings.ToUpper(route.Method)},
+		})
+	}
+	for _, h := range route.Headers {
+		header := map[string]interface{}{"name": h.Name}
+		switch h.Type {
+		case routes.HeaderMatchRegex:
+			header["regex"] = h.Value
+		case routes.HeaderMatchExists:
+			header["present"] = true
+		case routes.HeaderMatchAbsent:
+			header["notpresent"] = true
+		case routes.HeaderMatchNotValue:
+			header["notexact"] = h.Value
+		default:
+			header["exact"] = h.Value
+		}
+		conditions = append(conditions, map[string]interface{}{"header": header})
+	}
+	for _, q := range route.QueryParams {
+		param := map[string]interface{}{"name": q.Name}
+		if q.Type == routes.HeaderMatchRegex {
+			param["regex"] = q.Value
+		} else {
+			param["exact"] = q.Value
+		}
+		conditions = append(conditions, map[string]interface{}{"queryParameter": param})
+	}
+	return conditions, ""
+}
+
+// httpProxyRedirect translates a redirect action into an HTTPProxy
+// requestRedirectPolicy, which only supports 301 and 302 and always keeps the
+// request port when it sets neither a hostname nor a port.
+func httpProxyRedirect(route *routes.Route, action *routes.RouteAction) (map[string]interface{}, string) {
+	if action.RedirectStripPort && action.RedirectHostname == "" && action.RedirectPort == 0 {
+		return nil, "redirect preservePort false"
+	}
+	if action.RedirectAltSvc != "" {
+		return nil, "redirect altSvc"
+	}
+	policy := map[string]interface{}{}
+	if action.RedirectScheme != "" {
+		policy["scheme"] = action.RedirectScheme
+	}
+	if action.RedirectHostname != "" {
+		policy["hostname"] = action.RedirectHostname
+	}
+	if action.RedirectPort != 0 {
+		policy["port"] = int64(action.RedirectPort)
+	}
+	switch action.RedirectStatusCode {
+	case 0:
+	case 301, 302:
+		policy["statusCode"] = int64(action.RedirectStatusCode)
+	default:
+		return nil, "redirect status " + strconv.Itoa(int(action.RedirectStatusCode))
+	}
+	if action.RedirectPath != "" {
+		if action.RedirectReplacePrefixMatch != nil && *action.RedirectReplacePrefixMatch {
+			if route.Type != routes.RouteTypePrefix {
+				return nil, "redirect prefix replacement on a " + route.Type + " match"
+			}
+			policy["prefix"] = action.RedirectPath
+		} else {
+			policy["path"] = action.RedirectPath
+		}
+	}
+	return policy, ""
+}
+
+func httpProxyHeader(name, value string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "value": value}
+}
+
+// httpProxyHeadersPolicy returns an HTTPProxy headers policy, or nil when
+// it would be empty.
+func httpProxyHeadersPolicy(set, remove []interface{}) map[string]interface{} {
+	if len(set) == 0 && len(remove) == 0 {
+		return nil
+	}
+	policy := map[string]interface{}{}
+	if len(set) > 0 {
+		policy["set"] = set
+	}
+	if len(remove) > 0 {
+		policy["remove"] = remove
+	}
+	return policy
+}
+
+// parseServiceBackend splits a "name.namespace.svc.cluster.local:port"
+// backend into its Service name, namespace and port.
+func parseServiceBackend(backend string) (name, namespace string, port int, ok bool) {
+	host, portStr, found := strings.Cut(backend, ":")
+	if !found {
+		return "", "", 0, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", "", 0, false
+	}
+	service, found := strings.CutSuffix(host, ".svc.cluster.local")
+	if !found {
+		return "", "", 0, false
+	}
+	name, namespace, found = strings.Cut(service, ".")
+	if !found || strings.Contains(namespace, ".") {
+		return "", "", 0, false
+	}
+	return name, namespace, port, true
+}
@@ -0,0 +1,442 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestParseHTTPProxyTargets(t *testing.T) {
+	got, err := ParseHTTPProxyTargets(" web , api=only,shop=also ")
+	if err != nil {
+		t.Fatalf("ParseHTTPProxyTargets failed: %v", err)
+	}
+	want := map[string]HTTPProxyMode{
+		"web":  HTTPProxyModeAlso,
+		"api":  HTTPProxyModeOnly,
+		"shop": HTTPProxyModeAlso,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseHTTPProxyTargets() = %v, want %v", got, want)
+	}
+
+	if got, err := ParseHTTPProxyTargets(""); err != nil || got != nil {
+		t.Errorf("ParseHTTPProxyTargets(\"\") = %v, %v; want nil, nil", got, err)
+	}
+	for _, bad := range []string{"=only", "web=sometimes", "web,web=only"} {
+		if _, err := ParseHTTPProxyTargets(bad); err == nil {
+			t.Errorf("ParseHTTPProxyTargets(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestWritesConfigMaps(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{HTTPProxyTargets: map[string]HTTPProxyMode{
+		"web": HTTPProxyModeAlso,
+		"api": HTTPProxyModeOnly,
+	}}
+	for target, want := range map[string]bool{"web": true, "api": false, "other": true} {
+		if got := r.writesConfigMaps(target); got != want {
+			t.Errorf("writesConfigMaps(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
+
+func TestParseServiceBackend(t *testing.T) {
+	name, namespace, port, ok := parseServiceBackend("api.shop.svc.cluster.local:8080")
+	if !ok || name != "api" || namespace != "shop" || port != 8080 {
+		t.Errorf("parseServiceBackend() = %q, %q, %d, %v", name, namespace, port, ok)
+	}
+	for _, bad := range []string{"api.example.com:443", "api.shop.svc.cluster.local", "a.b.c.svc.cluster.local:80"} {
+		if _, _, _, ok := parseServiceBackend(bad); ok {
+			t.Errorf("parseServiceBackend(%q) succeeded, want it rejected", bad)
+		}
+	}
+}
+
+func TestBuildHTTPProxies(t *testing.T) {
+	replace := true
+	config := routes.MergeRoutesConfig(map[string][]routes.Route{
+		"www.example.com": {
+			{
+				Path:    "/api",
+				Type:    routes.RouteTypePrefix,
+				Backend: "api.shop.svc.cluster.local:8080",
+				Method:  "get",
+				Headers: []routes.RouteHeaderMatch{{Name: "x-beta", Type: routes.HeaderMatchExists}},
+				BackendProtocols: map[string]string{
+					"api.shop.svc.cluster.local:8080": v1alpha1.BackendProtocolH2C,
+				},
+				Actions: []routes.RouteAction{
+					{Type: routes.ActionTypeRewrite, RewritePath: "/v2", RewriteReplacePrefixMatch: &replace},
+					{Type: routes.ActionTypeHeaderSet, HeaderName: "x-env", Value: "prod"},
+				},
+			},
+			{
+				Path:    "/old",
+				Type:    routes.RouteTypeExact,
+				Backend: "web.web.svc.cluster.local:80",
+				Actions: []routes.RouteAction{
+					{Type: routes.ActionTypeRedirect, RedirectPath: "/new", RedirectStatusCode: 301},
+				},
+			},
+			{
+				Path:    "/",
+				Type:    routes.RouteTypePrefix,
+				Backend: "web.routes.svc.cluster.local:80",
+			},
+			{
+				Path:     "/canary",
+				Type:     routes.RouteTypePrefix,
+				Backend:  "web.web.svc.cluster.local:80",
+				Fraction: &routes.RouteFraction{Numerator: 1, Denominator: 10},
+			},
+		},
+		"skipped.example.com": {
+			{Path: "^/x", Type: routes.RouteTypeRegex, Backend: "web.web.svc.cluster.local:80"},
+		},
+	})
+
+	proxies, skipped := buildHTTPProxies("routes", "public", config)
+
+	if len(skipped) != 2 {
+		t.Fatalf("expected 2 skipped routes, got %d: %+v", len(skipped), skipped)
+	}
+	reasons := map[string]string{}
+	for _, s := range skipped {
+		reasons[s.route.Path] = s.reason
+	}
+	if reasons["/canary"] != "fraction" || reasons["^/x"] != "regex path match" {
+		t.Errorf("unexpected skip reasons: %v", reasons)
+	}
+	for _, s := range skipped {
+		if s.refused != (s.host == "skipped.example.com") {
+			t.Errorf("skipped route %s on %s has refused = %v", s.route.Path, s.host, s.refused)
+		}
+	}
+
+	// The regex path of skipped.example.com cannot be denied, so the host
+	// gets no proxies: only www.example.com gets a child proxy in shop and
+	// a root proxy in routes.
+	if len(proxies) != 2 {
+		t.Fatalf("expected 2 proxies, got %d", len(proxies))
+	}
+	child, root := proxies[0], proxies[1]
+	name := httpProxyName("public", "www.example.com")
+	if child.GetNamespace() != "shop" || child.GetName() != name {
+		t.Errorf("child proxy = %s/%s, want shop/%s", child.GetNamespace(), child.GetName(), name)
+	}
+	if root.GetNamespace() != "routes" || root.GetName() != name {
+		t.Errorf("root proxy = %s/%s, want routes/%s", root.GetNamespace(), root.GetName(), name)
+	}
+	for _, proxy := range proxies {
+		if proxy.GetLabels()[configMapTargetLabel] != "public" {
+			t.Errorf("proxy %s/%s has labels %v", proxy.GetNamespace(), proxy.GetName(), proxy.GetLabels())
+		}
+		if proxy.GetAnnotations()[hostnameAnnotation] != "www.example.com" {
+			t.Errorf("proxy %s/%s has annotations %v", proxy.GetNamespace(), proxy.GetName(), proxy.GetAnnotations())
+		}
+	}
+
+	wantRoot := map[string]interface{}{
+		"virtualhost": map[string]interface{}{"fqdn": "www.example.com"},
+		"includes": []interface{}{
+			map[string]interface{}{"name": name, "namespace": "shop"},
+		},
+		"routes": []interface{}{
+			// The redirect has no service and stays in the root proxy.
+			map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"exact": "/old"}},
+				"requestRedirectPolicy": map[string]interface{}{
+					"path":       "/new",
+					"statusCode": int64(301),
+				},
+			},
+			map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"prefix": "/"}},
+				"services":   []interface{}{map[string]interface{}{"name": "web", "port": int64(80)}},
+			},
+			// The skipped fraction route is denied instead of falling
+			// through to /.
+			map[string]interface{}{
+				"conditions":           []interface{}{map[string]interface{}{"prefix": "/canary"}},
+				"directResponsePolicy": map[string]interface{}{"statusCode": int64(503)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(root.Object["spec"], wantRoot) {
+		t.Errorf("root spec = %#v\nwant %#v", root.Object["spec"], wantRoot)
+	}
+
+	wantChild := map[string]interface{}{
+		"routes": []interface{}{
+			map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"prefix": "/api"},
+					map[string]interface{}{"header": map[string]interface{}{"name": ":method", "exact": "GET"}},
+					map[string]interface{}{"header": map[string]interface{}{"name": "x-beta", "present": true}},
+				},
+				"pathRewritePolicy": map[string]interface{}{
+					"replacePrefix": []interface{}{
+						map[string]interface{}{"prefix": "/api", "replacement": "/v2"},
+					},
+				},
+				"requestHeadersPolicy": map[string]interface{}{
+					"set": []interface{}{map[string]interface{}{"name": "x-env", "value": "prod"}},
+				},
+				"services": []interface{}{
+					map[string]interface{}{"name": "api", "port": int64(8080), "protocol": "h2c"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(child.Object["spec"], wantChild) {
+		t.Errorf("child spec = %#v\nwant %#v", child.Object["spec"], wantChild)
+	}
+}
+
+func TestBuildHTTPProxiesDeniesSkippedRoutes(t *testing.T) {
+	config := routes.MergeRoutesConfig(map[string][]routes.Route{
+		"www.example.com": {
+			// The sampled route is skipped, and its unsampled sibling with
+			// the same conditions already serves its requests.
+			{
+				Path:     "/canary",
+				Type:     routes.RouteTypePrefix,
+				Backend:  "canary.routes.svc.cluster.local:80",
+				Fraction: &routes.RouteFraction{Numerator: 1, Denominator: 10},
+			},
+			{Path: "/canary", Type: routes.RouteTypePrefix, Backend: "web.routes.svc.cluster.local:80"},
+		},
+		"cors.example.com": {
+			{
+				Path:    "/api",
+				Type:    routes.RouteTypeExact,
+				Method:  "POST",
+				Backend: "api.shop.svc.cluster.local:8080",
+				CORS:    &routes.RouteCORS{AllowOrigins: []string{"https://www.example.com"}},
+			},
+		},
+		"scheme.example.com": {
+			{Path: "/", Type: routes.RouteTypePrefix, Backend: "web.routes.svc.cluster.local:80"},
+			{Path: "/", Type: routes.RouteTypePrefix, Scheme: "http", Backend: "web.routes.svc.cluster.local:80"},
+		},
+	})
+
+	proxies, skipped := buildHTTPProxies("routes", "public", config)
+
+	specs := map[string]interface{}{}
+	for _, proxy := range proxies {
+		specs[proxy.GetAnnotations()[hostnameAnnotation]+" "+proxy.GetNamespace()] = proxy.Object["spec"]
+	}
+
+	wantCORS := map[string]interface{}{
+		"virtualhost": map[string]interface{}{"fqdn": "cors.example.com"},
+		"routes": []interface{}{
+			map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"exact": "/api"},
+					map[string]interface{}{"header": map[string]interface{}{"name": ":method", "exact": "POST"}},
+				},
+				"directResponsePolicy": map[string]interface{}{"statusCode": int64(503)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(specs["cors.example.com routes"], wantCORS) {
+		t.Errorf("cors.example.com root spec = %#v\nwant %#v", specs["cors.example.com routes"], wantCORS)
+	}
+
+	wantWWW := map[string]interface{}{
+		"virtualhost": map[string]interface{}{"fqdn": "www.example.com"},
+		"routes": []interface{}{
+			map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"prefix": "/canary"}},
+				"services":   []interface{}{map[string]interface{}{"name": "web", "port": int64(80)}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(specs["www.example.com routes"], wantWWW) {
+		t.Errorf("www.example.com root spec = %#v\nwant %#v", specs["www.example.com routes"], wantWWW)
+	}
+
+	if len(proxies) != 2 {
+		t.Errorf("expected 2 proxies, got %d: %v", len(proxies), specs)
+	}
+
+	// scheme.example.com is refused: both its routes are reported.
+	var refused []string
+	for _, s := range skipped {
+		if s.refused {
+			refused = append(refused, s.host+" "+s.reason)
+		}
+	}
+	wantRefused := []string{
+		"scheme.example.com host has a route with a scheme match",
+		"scheme.example.com scheme match",
+	}
+	slices.Sort(refused)
+	if !reflect.DeepEqual(refused, wantRefused) {
+		t.Errorf("refused routes = %v, want %v", refused, wantRefused)
+	}
+	if len(skipped) != 4 {
+		t.Errorf("expected 4 skipped routes, got %d: %+v", len(skipped), skipped)
+	}
+}
+
+func TestSkippedHTTPProxyRouteMessage(t *testing.T) {
+	route := &routes.Route{Path: "/canary", Type: routes.RouteTypePrefix, Source: "shop/web"}
+	s := skippedHTTPProxyRoute{host: "www.example.com", route: route, reason: "fraction"}
+	if got, want := s.message(), "prefix /canary on www.example.com: fraction, answered with 503"; got != want {
+		t.Errorf("message() = %q, want %q", got, want)
+	}
+	s.refused = true
+	if got, want := s.message(), "prefix /canary on www.example.com: fraction, host not published"; got != want {
+		t.Errorf("message() = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateConditionHTTPProxyRoutesSkipped(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{HTTPProxyTargets: map[string]HTTPProxyMode{"public": HTTPProxyModeAlso}}
+	route := &v1alpha1.CustomHTTPRoute{Spec: v1alpha1.CustomHTTPRouteSpec{TargetRef: v1alpha1.TargetRef{Name: "public"}}}
+
+	r.UpdateConditionHTTPProxyRoutesSkipped(route, nil)
+	cond := meta.FindStatusCondition(route.Status.Conditions, v1alpha1.ConditionTypeHTTPProxyRoutesSkipped)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "AllRoutesExpressed" {
+		t.Fatalf("condition = %+v, want False/AllRoutesExpressed", cond)
+	}
+
+	r.UpdateConditionHTTPProxyRoutesSkipped(route, []string{"a", "b", "c", "d", "e", "f"})
+	cond = meta.FindStatusCondition(route.Status.Conditions, v1alpha1.ConditionTypeHTTPProxyRoutesSkipped)
+	if cond.Status != metav1.ConditionTrue || cond.Reason != "RoutesSkipped" {
+		t.Errorf("condition = %+v, want True/RoutesSkipped", cond)
+	}
+	if !strings.HasPrefix(cond.Message, "6 route(s) not served through the HTTPProxies: a; b; c; d; e") ||
+		!strings.HasSuffix(cond.Message, "; and 1 more") {
+		t.Errorf("message = %q", cond.Message)
+	}
+
+	// A route whose target is no longer written as HTTPProxies loses it.
+	r.HTTPProxyTargets = nil
+	r.UpdateConditionHTTPProxyRoutesSkipped(route, nil)
+	if cond := meta.FindStatusCondition(route.Status.Conditions, v1alpha1.ConditionTypeHTTPProxyRoutesSkipped); cond != nil {
+		t.Errorf("condition kept for a target without HTTPProxies: %+v", cond)
+	}
+}
+
+func TestConvertHTTPProxyRouteRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  routes.Route
+		reason string
+	}{
+		{
+			name: "full path rewrite",
+			route: routes.Route{Path: "/a", Type: routes.RouteTypePrefix, Backend: "a.b.svc.cluster.local:80",
+				Actions: []routes.RouteAction{{Type: routes.ActionTypeRewrite, RewritePath: "/b"}}},
+			reason: "rewrite of the full path",
+		},
+		{
+			name: "redirect with status 308",
+			route: routes.Route{Path: "/a", Type: routes.RouteTypePrefix,
+				Actions: []routes.RouteAction{{Type: routes.ActionTypeRedirect, RedirectStatusCode: 308}}},
+			reason: "redirect status 308",
+		},
+		{
+			name: "redirect stripping the request port",
+			route: routes.Route{Path: "/a", Type: routes.RouteTypePrefix,
+				Actions: []routes.RouteAction{{Type: routes.ActionTypeRedirect, RedirectPath: "/b", RedirectStripPort: true}}},
+			reason: "redirect preservePort false",
+		},
+		{
+			name: "require-auth",
+			route: routes.Route{Path: "/a", Type: routes.RouteTypePrefix, Backend: "a.b.svc.cluster.local:80",
+				Actions: []routes.RouteAction{{Type: routes.ActionTypeRequireAuth, AuthURL: "http://auth"}}},
+			reason: "require-auth action",
+		},
+		{
+			name:   "external backend",
+			route:  routes.Route{Path: "/a", Type: routes.RouteTypePrefix, Backend: "api.example.com:443"},
+			reason: "backend api.example.com:443 is not a Service",
+		},
+		{
+			name:   "sse hint",
+			route:  routes.Route{Path: "/a", Type: routes.RouteTypePrefix, ProtocolHint: routes.ProtocolHintSSE},
+			reason: "protocolHints sse",
+		},
+		{
+			name: "cookie hash policy",
+			route: routes.Route{Path: "/a", Type: routes.RouteTypePrefix, Backend: "api.apps.svc.cluster.local:8080",
+				HashPolicy: &routes.RouteHashPolicy{CookieName: "session"}},
+			reason: "hashPolicy cookie",
+		},
+		{
+			name: "variant",
+			route: routes.Route{Path: "/a", Type: routes.RouteTypePrefix, Backend: "api.apps.svc.cluster.local:8080",
+				Variant: "green"},
+			reason: "variant",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, reason := convertHTTPProxyRoute(&tt.route, "routes")
+			if reason != tt.reason {
+				t.Errorf("reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRebuildRecordsSkippedHTTPProxyRoutes(t *testing.T) {
+	ctx := context.Background()
+	plain := prefixRoute("plain", "/", 1000)
+	regex := prefixRoute("regex", "^/api/v[0-9]+", 1000)
+	regex.Spec.Rules[0].Matches[0].Type = v1alpha1.MatchTypeRegex
+	r := newReconciler(plain, regex)
+	r.HTTPProxyTargets = map[string]HTTPProxyMode{"default": HTTPProxyModeAlso}
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+
+	// The regex route refuses its host, so the plain route of the same
+	// host is not served through the HTTPProxies either.
+	for name, want := range map[string]string{
+		"regex": "regex ^/api/v[0-9]+ on shop.example.com: regex path match, host not published",
+		"plain": "prefix / on shop.example.com: host has a route with a regex path match, host not published",
+	} {
+		got := r.skippedHTTPProxyRoutes("default", types.NamespacedName{Namespace: "ns", Name: name})
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("%s skipped routes = %v, want [%s]", name, got, want)
+		}
+	}
+
+	r.clearTargetState("default")
+	if got := r.skippedHTTPProxyRoutes("default", types.NamespacedName{Namespace: "ns", Name: "regex"}); got != nil {
+		t.Errorf("skipped routes kept after clearing the target: %v", got)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// ParseMatchStrategyTargets parses the --match-strategy-targets flag value:
+// comma-separated target=strategy pairs, each strategy one of the
+// routes.MatchStrategy* constants.
+func ParseMatchStrategyTargets(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	out := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, strategy, ok := strings.Cut(entry, "=")
+		target, strategy = strings.TrimSpace(target), strings.TrimSpace(strategy)
+		if !ok || target == "" {
+			return nil, fmt.Errorf("invalid match-strategy-targets entry %q: expected target=strategy", entry)
+		}
+		if err := routes.ValidateMatchStrategy(strategy); err != nil {
+			return nil, fmt.Errorf("target %q: %w", target, err)
+		}
+		if _, dup := out[target]; dup {
+			return nil, fmt.Errorf("duplicate match-strategy-targets entry for target %q", target)
+		}
+		out[target] = strategy
+	}
+	return out, nil
+}
+
+// matchStrategy returns the match strategy of target: its
+// MatchStrategyTargets entry, else MatchStrategy, else FirstMatch.
+func (r *CustomHTTPRouteReconciler) matchStrategy(target string) string {
+	if strategy, ok := r.MatchStrategyTargets[target]; ok {
+		return strategy
+	}
+	if r.MatchStrategy != "" {
+		return r.MatchStrategy
+	}
+	return routes.MatchStrategyFirstMatch
+}
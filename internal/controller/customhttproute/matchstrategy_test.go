@@ -0,0 +1,60 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestParseMatchStrategyTargets(t *testing.T) {
+	got, err := ParseMatchStrategyTargets(" web=MostSpecific , api=FirstMatch")
+	if err != nil {
+		t.Fatalf("ParseMatchStrategyTargets failed: %v", err)
+	}
+	want := map[string]string{"web": routes.MatchStrategyMostSpecific, "api": routes.MatchStrategyFirstMatch}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMatchStrategyTargets() = %v, want %v", got, want)
+	}
+	for _, bad := range []string{"web", "=MostSpecific", "web=Longest", "web=MostSpecific,web=FirstMatch"} {
+		if _, err := ParseMatchStrategyTargets(bad); err == nil {
+			t.Errorf("ParseMatchStrategyTargets(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestMatchStrategy(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{}
+	if got := r.matchStrategy("web"); got != routes.MatchStrategyFirstMatch {
+		t.Errorf("default matchStrategy = %q, want FirstMatch", got)
+	}
+
+	r = &CustomHTTPRouteReconciler{
+		MatchStrategy:        routes.MatchStrategyMostSpecific,
+		MatchStrategyTargets: map[string]string{"legacy": routes.MatchStrategyFirstMatch},
+	}
+	for target, want := range map[string]string{
+		"web":    routes.MatchStrategyMostSpecific,
+		"legacy": routes.MatchStrategyFirstMatch,
+	} {
+		if got := r.matchStrategy(target); got != want {
+			t.Errorf("matchStrategy(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const metricsNamespace = "customrouter"
+
+var (
+	targetRoutes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_routes",
+			Help:      "Number of routes in the merged route table of a target.",
+		},
+		[]string{"target"},
+	)
+
+	targetRouteBudget = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_route_budget",
+			Help:      "Maximum number of routes a target may hold (--max-routes-per-target). Absent when unlimited.",
+		},
+		[]string{"target"},
+	)
+
+	targetExcludedRoutes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_excluded_customhttproutes",
+			Help:      "Number of CustomHTTPRoutes left out of a target's route table because they exceed its route budget.",
+		},
+		[]string{"target"},
+	)
+
+	targetDrainingCustomHTTPRoutes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_draining_customhttproutes",
+			Help:      "Number of deleted CustomHTTPRoutes whose routes a target keeps for their deletionDrainSeconds.",
+		},
+		[]string{"target"},
+	)
+
+	targetDrainingRoutes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_draining_routes",
+			Help:      "Number of routes in a target's route table kept only until their deleted CustomHTTPRoute drains.",
+		},
+		[]string{"target"},
+	)
+
+	targetPartitions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_configmap_partitions",
+			Help:      "Number of route ConfigMaps a target's route table is partitioned into.",
+		},
+		[]string{"target"},
+	)
+
+	partitionBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "configmap_partition_bytes",
+			Help:      "Size in bytes of the routes data of a route ConfigMap, compressed when written as binaryData.",
+		},
+		[]string{"target", "configmap"},
+	)
+
+	partitionSizeLimit = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "configmap_partition_size_limit_bytes",
+			Help:      "Maximum size in bytes of the routes data of a route ConfigMap.",
+		},
+	)
+
+	hostRoutes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_host_routes",
+			Help:      "Number of routes of a host in a target's route table.",
+		},
+		[]string{"target", "host"},
+	)
+
+	expansionCacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "expansion_cache_lookups_total",
+			Help:      "Number of CustomHTTPRoute expansions looked up in the expansion cache, by result (hit or miss).",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	partitionSizeLimit.Set(maxConfigMapSize)
+	metrics.Registry.MustRegister(
+		targetRoutes,
+		targetRouteBudget,
+		targetExcludedRoutes,
+		targetDrainingCustomHTTPRoutes,
+		targetDrainingRoutes,
+		targetPartitions,
+		partitionBytes,
+		partitionSizeLimit,
+		hostRoutes,
+		expansionCacheLookups,
+	)
+}
+
+// recordTargetRoutes publishes the route usage of target after a rebuild.
+func (r *CustomHTTPRouteReconciler) recordTargetRoutes(target string, routeCount, excluded int) {
+	targetRoutes.WithLabelValues(target).Set(float64(routeCount))
+	targetExcludedRoutes.WithLabelValues(target).Set(float64(excluded))
+	if r.MaxRoutesPerTarget > 0 {
+		targetRouteBudget.WithLabelValues(target).Set(float64(r.MaxRoutesPerTarget))
+	}
+}
+
+// recordTargetDraining publishes how many deleted CustomHTTPRoutes, and
+// routes of them, target keeps while they drain.
+func recordTargetDraining(target string, customHTTPRoutes, drainingRoutes int) {
+	targetDrainingCustomHTTPRoutes.WithLabelValues(target).Set(float64(customHTTPRoutes))
+	targetDrainingRoutes.WithLabelValues(target).Set(float64(drainingRoutes))
+}
+
+// recordTargetPartitions publishes the routes per host of config and the
+// ConfigMap partitions it was split into. The per-host and per-ConfigMap
+// series of target are replaced, so hosts and partitions that went away do
+// not linger.
+func recordTargetPartitions(target string, config *routes.RoutesConfig, partitions []ConfigMapPartition) {
+	labels := prometheus.Labels{"target": target}
+	hostRoutes.DeletePartialMatch(labels)
+	partitionBytes.DeletePartialMatch(labels)
+
+	for host, hr := range config.Hosts {
+		hostRoutes.WithLabelValues(target, host).Set(float64(len(hr)))
+	}
+	for _, p := range partitions {
+		partitionBytes.WithLabelValues(target, p.Name).Set(float64(p.Size()))
+	}
+	targetPartitions.WithLabelValues(target).Set(float64(len(partitions)))
+}
+
+// forgetTargetMetrics drops the series of a target that has no routes left.
+func forgetTargetMetrics(target string) {
+	targetRoutes.DeleteLabelValues(target)
+	targetRouteBudget.DeleteLabelValues(target)
+	targetExcludedRoutes.DeleteLabelValues(target)
+	targetDrainingCustomHTTPRoutes.DeleteLabelValues(target)
+	targetDrainingRoutes.DeleteLabelValues(target)
+	targetPartitions.DeleteLabelValues(target)
+	labels := prometheus.Labels{"target": target}
+	hostRoutes.DeletePartialMatch(labels)
+	partitionBytes.DeletePartialMatch(labels)
+}
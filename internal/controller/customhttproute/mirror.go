@@ -56,13 +56,24 @@ func (r *CustomHTTPRouteReconciler) reconcileMirrorFromRoutes(
 
 	for i := range epaList.Items {
 		epa := &epaList.Items[i]
+		if epa.EffectiveProvider() != v1alpha1.GatewayProviderIstio {
+			continue
+		}
+		if !ef.SelectorResolved(epa) {
+			// Left to the attachment's own reconcile, which retries until its
+			// Gateway selector resolves and then writes this filter too.
+			logger.V(1).Info("Skipping mirror EnvoyFilter: gateway selector of the attachment not resolved yet",
+				"epa", epa.Name,
+				"namespace", epa.Namespace)
+			continue
+		}
 
 		if len(entries) == 0 {
 			key := types.NamespacedName{
 				Name:      epa.Name + ef.MirrorFilterSuffix,
 				Namespace: epa.Namespace,
 			}
-			if err := ef.DeleteEnvoyFilter(ctx, r.Client, key); err != nil {
+			if err := ef.DeleteEnvoyFilters(ctx, r.Client, key); err != nil {
 				return err
 			}
 			continue
@@ -74,7 +85,7 @@ func (r *CustomHTTPRouteReconciler) reconcileMirrorFromRoutes(
 				epa.Namespace, epa.Name, err)
 		}
 
-		if err := ef.UpsertUnstructured(ctx, r.Client, envoyFilter); err != nil {
+		if err := ef.UpsertEnvoyFilters(ctx, r.Client, epa, envoyFilter); err != nil {
 			return fmt.Errorf("failed to reconcile mirror EnvoyFilter for EPA %s/%s: %w",
 				epa.Namespace, epa.Name, err)
 		}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// filterNamespaceTargets leaves out of target's routes the CustomHTTPRoutes
+// whose namespace does not allow target, by its AllowedTargetsAnnotation or,
+// without it, by AllowedTargets. The webhook rejects such routes, but routes created before the namespace
+// was restricted, or while the webhook was down, still reach the controller.
+// The second return value maps every CustomHTTPRoute left out to the reason,
+// for its status.
+func (r *CustomHTTPRouteReconciler) filterNamespaceTargets(
+	ctx context.Context,
+	target string,
+	customRoutes []*v1alpha1.CustomHTTPRoute,
+) ([]*v1alpha1.CustomHTTPRoute, map[types.NamespacedName]string, error) {
+	allowedByNamespace := make(map[string]bool)
+	sourceByNamespace := make(map[string]string)
+	var denied map[types.NamespacedName]string
+	out := customRoutes[:0]
+	for _, route := range customRoutes {
+		allowed, seen := allowedByNamespace[route.Namespace]
+		if !seen {
+			var ns corev1.Namespace
+			err := r.Get(ctx, types.NamespacedName{Name: route.Namespace}, &ns)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return nil, nil, fmt.Errorf("failed to get namespace %s: %w", route.Namespace, err)
+			}
+			allowed = r.AllowedTargets.Allows(route.Namespace, ns.Annotations, target)
+			allowedByNamespace[route.Namespace] = allowed
+			sourceByNamespace[route.Namespace] = v1alpha1.TargetRestrictionSource(ns.Annotations)
+		}
+		if allowed {
+			out = append(out, route)
+			continue
+		}
+		if denied == nil {
+			denied = make(map[types.NamespacedName]string)
+		}
+		denied[types.NamespacedName{Namespace: route.Namespace, Name: route.Name}] = fmt.Sprintf(
+			"target %s is not allowed in namespace %s by %s; its routes are not served",
+			target, route.Namespace, sourceByNamespace[route.Namespace])
+	}
+	return out, denied, nil
+}
+
+// setTargetDenials records the CustomHTTPRoutes of target left out by the
+// last rebuild because their namespace does not allow it, replacing the
+// previous set.
+func (r *CustomHTTPRouteReconciler) setTargetDenials(target string, denied map[types.NamespacedName]string) {
+	r.denialsMu.Lock()
+	defer r.denialsMu.Unlock()
+	if len(denied) == 0 {
+		delete(r.targetDenials, target)
+		return
+	}
+	if r.targetDenials == nil {
+		r.targetDenials = make(map[string]map[types.NamespacedName]string)
+	}
+	r.targetDenials[target] = denied
+}
+
+// targetDenial returns why the last rebuild of target left the given
+// CustomHTTPRoute out for its namespace, or "" when it was not.
+func (r *CustomHTTPRouteReconciler) targetDenial(target string, key types.NamespacedName) string {
+	r.denialsMu.Lock()
+	defer r.denialsMu.Unlock()
+	return r.targetDenials[target][key]
+}
+
+// findRoutesForNamespace returns reconcile requests for every CustomHTTPRoute
+// in the namespace, so a change of its allowed targets, or of the labels
+// CustomRouterConfigs select it by, rebuilds their targets.
+func (r *CustomHTTPRouteReconciler) findRoutesForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	routeList := &v1alpha1.CustomHTTPRouteList{}
+	if err := r.List(ctx, routeList, client.InNamespace(obj.GetName())); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(routeList.Items))
+	for i := range routeList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      routeList.Items[i].Name,
+				Namespace: routeList.Items[i].Namespace,
+			},
+		})
+	}
+	return requests
+}
+
+// allowedTargetsChanged reports whether a Namespace update changed its
+// AllowedTargetsAnnotation.
+func allowedTargetsChanged(oldObj, newObj client.Object) bool {
+	oldValue, oldOK := oldObj.GetAnnotations()[v1alpha1.AllowedTargetsAnnotation]
+	newValue, newOK := newObj.GetAnnotations()[v1alpha1.AllowedTargetsAnnotation]
+	return oldOK != newOK || strings.TrimSpace(oldValue) != strings.TrimSpace(newValue)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestRebuildEnforcesNamespaceTargets(t *testing.T) {
+	ctx := context.Background()
+	restricted := budgetRoute("restricted", time.Now(), "/a")
+	unrestricted := budgetRoute("allowed", time.Now(), "/b")
+	unrestricted.Namespace = "other"
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "ns",
+		Annotations: map[string]string{v1alpha1.AllowedTargetsAnnotation: "internal"},
+	}}
+	r := newReconciler(restricted, unrestricted, ns)
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	cms := &corev1.ConfigMapList{}
+	if err := r.List(ctx, cms, client.InNamespace("test-ns"), client.MatchingLabels{configMapTargetLabel: "default"}); err != nil {
+		t.Fatalf("failed to list ConfigMaps: %v", err)
+	}
+	if len(cms.Items) != 1 {
+		t.Fatalf("expected 1 ConfigMap, got %d", len(cms.Items))
+	}
+	data := cms.Items[0].Data[routesDataKey]
+	if strings.Contains(data, "restricted.example.com") {
+		t.Error("routes of a CustomHTTPRoute whose namespace does not allow the target were written")
+	}
+	if !strings.Contains(data, "allowed.example.com") {
+		t.Error("routes of a CustomHTTPRoute in a namespace without the annotation are missing")
+	}
+
+	restrictedKey := types.NamespacedName{Namespace: "ns", Name: "restricted"}
+	if reason := r.targetDenial("default", restrictedKey); reason == "" {
+		t.Error("expected the restricted CustomHTTPRoute to be reported as not allowed")
+	}
+	if reason := r.targetDenial("default", types.NamespacedName{Namespace: "other", Name: "allowed"}); reason != "" {
+		t.Errorf("unrestricted CustomHTTPRoute reported as not allowed: %s", reason)
+	}
+
+	// Allowing the target admits it again and clears the denial.
+	ns.Annotations[v1alpha1.AllowedTargetsAnnotation] = "internal, default"
+	if err := r.Update(ctx, ns); err != nil {
+		t.Fatalf("failed to update namespace: %v", err)
+	}
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if reason := r.targetDenial("default", restrictedKey); reason != "" {
+		t.Errorf("CustomHTTPRoute still reported as not allowed after allowing the target: %s", reason)
+	}
+}
+
+func TestRebuildEnforcesAllowedTargetsFlag(t *testing.T) {
+	ctx := context.Background()
+	listed := budgetRoute("listed", time.Now(), "/a")
+	annotated := budgetRoute("annotated", time.Now(), "/b")
+	annotated.Namespace = "other"
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+	other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "other",
+		Annotations: map[string]string{v1alpha1.AllowedTargetsAnnotation: "default"},
+	}}
+	r := newReconciler(listed, annotated, ns, other)
+	r.AllowedTargets = v1alpha1.TargetAllowList{v1alpha1.AllNamespaces: {"internal"}}
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	reason := r.targetDenial("default", types.NamespacedName{Namespace: "ns", Name: "listed"})
+	if !strings.Contains(reason, "--policy-allowed-targets") {
+		t.Errorf("expected the CustomHTTPRoute to be denied by --policy-allowed-targets, got %q", reason)
+	}
+	if reason := r.targetDenial("default", types.NamespacedName{Namespace: "other", Name: "annotated"}); reason != "" {
+		t.Errorf("the namespace annotation should take precedence over the flag: %s", reason)
+	}
+}
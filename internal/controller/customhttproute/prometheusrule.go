@@ -0,0 +1,207 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
+)
+
+// prometheusRuleGVK is the Prometheus Operator PrometheusRule kind.
+var prometheusRuleGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "PrometheusRule",
+}
+
+// PrometheusRuleOptions configures the PrometheusRule written for every
+// target (see syncPrometheusRule). An alert whose threshold is zero is left
+// out.
+type PrometheusRuleOptions struct {
+	// BudgetRatio fires CustomRouterRouteBudgetNearlyExhausted when the
+	// routes of a target exceed this fraction of MaxRoutesPerTarget. It is
+	// ignored while the route budget is unlimited.
+	BudgetRatio float64
+
+	// MaxPartitions fires CustomRouterTooManyPartitions when a target is
+	// split into more route ConfigMaps than this.
+	MaxPartitions int
+
+	// MissRatio fires CustomRouterHostRouteMissRatioHigh when more than
+	// this fraction of the requests of a host of the target match no
+	// route. It needs the extprocs of the target to run with
+	// --host-metrics.
+	MissRatio float64
+
+	// For is how long an alert condition must hold before it fires.
+	For string
+
+	// Labels are added to every PrometheusRule, e.g. to match the
+	// ruleSelector of a Prometheus.
+	Labels map[string]string
+}
+
+// ParsePrometheusRuleLabels parses the --prometheus-rule-labels flag value:
+// comma-separated key=value pairs.
+func ParsePrometheusRuleLabels(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	out := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid prometheus-rule-labels entry %q: expected key=value", entry)
+		}
+		out[key] = strings.TrimSpace(val)
+	}
+	return out, nil
+}
+
+// prometheusRuleName is the name of the PrometheusRule of target.
+func prometheusRuleName(target string) string {
+	return "customrouter-" + target
+}
+
+// syncPrometheusRule writes the PrometheusRule alerting on the route budget,
+// partitions and per-host route misses of target, or deletes it once the
+// target has no routes left. It does nothing unless PrometheusRules is set,
+// and skips targets when the PrometheusRule CRD is not installed.
+func (r *CustomHTTPRouteReconciler) syncPrometheusRule(ctx context.Context, target string, hasRoutes bool) error {
+	if r.PrometheusRules == nil {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+
+	rule := r.buildPrometheusRule(target)
+	if !hasRoutes || rule.Object["spec"] == nil {
+		err := r.Delete(ctx, rule)
+		if err != nil && !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return fmt.Errorf("failed to delete PrometheusRule %s/%s: %w", rule.GetNamespace(), rule.GetName(), err)
+		}
+		return nil
+	}
+
+	if err := ef.UpsertUnstructured(ctx, r.Client, rule); err != nil {
+		if meta.IsNoMatchError(err) {
+			logger.Info("PrometheusRule CRD not installed, skipping alert rules", "target", target)
+			return nil
+		}
+		return fmt.Errorf("failed to upsert PrometheusRule %s/%s: %w", rule.GetNamespace(), rule.GetName(), err)
+	}
+	return nil
+}
+
+// buildPrometheusRule returns the PrometheusRule of target. Its spec is
+// left unset when every alert is disabled.
+func (r *CustomHTTPRouteReconciler) buildPrometheusRule(target string) *unstructured.Unstructured {
+	opts := r.PrometheusRules
+	rule := &unstructured.Unstructured{}
+	rule.SetGroupVersionKind(prometheusRuleGVK)
+	rule.SetName(prometheusRuleName(target))
+	rule.SetNamespace(r.ConfigMapNamespace)
+	ruleLabels := make(map[string]string, len(opts.Labels)+2)
+	for k, v := range opts.Labels {
+		ruleLabels[k] = v
+	}
+	ruleLabels[configMapManagedByLabel] = configMapManagedByValue
+	ruleLabels[configMapTargetLabel] = target
+	rule.SetLabels(ruleLabels)
+
+	selector := "target=" + strconv.Quote(target)
+	var alerts []interface{}
+	if opts.BudgetRatio > 0 && r.MaxRoutesPerTarget > 0 {
+		alerts = append(alerts, prometheusAlert(target, opts.For,
+			"CustomRouterRouteBudgetNearlyExhausted",
+			fmt.Sprintf("customrouter_target_routes{%s} / customrouter_target_route_budget{%s} > %s",
+				selector, selector, formatThreshold(opts.BudgetRatio)),
+			"Target {{ $labels.target }} is close to its route budget",
+			"Target {{ $labels.target }} uses {{ $value | humanizePercentage }} of its route budget; "+
+				"CustomHTTPRoutes that do not fit are left out of its route table."))
+	}
+	if opts.MaxPartitions > 0 {
+		alerts = append(alerts, prometheusAlert(target, opts.For,
+			"CustomRouterTooManyPartitions",
+			fmt.Sprintf("customrouter_target_configmap_partitions{%s} > %d", selector, opts.MaxPartitions),
+			"Target {{ $labels.target }} is split into many route ConfigMaps",
+			"The route table of target {{ $labels.target }} is split into {{ $value }} ConfigMaps."))
+	}
+	if opts.MissRatio > 0 {
+		hostSelector := selector + `,host!=""`
+		alerts = append(alerts, prometheusAlert(target, opts.For,
+			"CustomRouterHostRouteMissRatioHigh",
+			fmt.Sprintf("sum by (target, host) (rate(customrouter_host_requests_total{%s,route_found=\"false\"}[5m]))\n"+
+				"  / sum by (target, host) (rate(customrouter_host_requests_total{%s}[5m])) > %s",
+				hostSelector, hostSelector, formatThreshold(opts.MissRatio)),
+			"Many requests for {{ $labels.host }} match no route",
+			"{{ $value | humanizePercentage }} of the requests for {{ $labels.host }} on target "+
+				"{{ $labels.target }} match no route."))
+	}
+	if len(alerts) == 0 {
+		return rule
+	}
+
+	rule.Object["spec"] = map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  prometheusRuleName(target),
+				"rules": alerts,
+			},
+		},
+	}
+	return rule
+}
+
+// prometheusAlert returns an alerting rule labeled with target.
+func prometheusAlert(target, forDuration, name, expr, summary, description string) map[string]interface{} {
+	alert := map[string]interface{}{
+		"alert": name,
+		"expr":  expr,
+		"labels": map[string]interface{}{
+			"severity": "warning",
+			"target":   target,
+		},
+		"annotations": map[string]interface{}{
+			"summary":     summary,
+			"description": description,
+		},
+	}
+	if forDuration != "" {
+		alert["for"] = forDuration
+	}
+	return alert
+}
+
+// formatThreshold formats a ratio threshold for a PromQL expression.
+func formatThreshold(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
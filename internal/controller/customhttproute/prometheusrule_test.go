@@ -0,0 +1,113 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParsePrometheusRuleLabels(t *testing.T) {
+	got, err := ParsePrometheusRuleLabels(" release = kube-prometheus-stack ,team=edge")
+	if err != nil {
+		t.Fatalf("ParsePrometheusRuleLabels failed: %v", err)
+	}
+	want := map[string]string{"release": "kube-prometheus-stack", "team": "edge"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePrometheusRuleLabels() = %v, want %v", got, want)
+	}
+	for _, bad := range []string{"release", "=edge"} {
+		if _, err := ParsePrometheusRuleLabels(bad); err == nil {
+			t.Errorf("ParsePrometheusRuleLabels(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestBuildPrometheusRule(t *testing.T) {
+	alertNames := func(rule *unstructured.Unstructured) []string {
+		groups, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+		if len(groups) == 0 {
+			return nil
+		}
+		var names []string
+		for _, alert := range groups[0].(map[string]interface{})["rules"].([]interface{}) {
+			names = append(names, alert.(map[string]interface{})["alert"].(string))
+		}
+		return names
+	}
+
+	t.Run("all alerts", func(t *testing.T) {
+		r := &CustomHTTPRouteReconciler{
+			ConfigMapNamespace: "customrouter",
+			MaxRoutesPerTarget: 1000,
+			PrometheusRules: &PrometheusRuleOptions{
+				BudgetRatio:   0.9,
+				MaxPartitions: 8,
+				MissRatio:     0.2,
+				For:           "15m",
+				Labels:        map[string]string{"release": "prometheus"},
+			},
+		}
+		rule := r.buildPrometheusRule("web")
+		if rule.GetName() != "customrouter-web" || rule.GetNamespace() != "customrouter" {
+			t.Errorf("PrometheusRule = %s/%s, want customrouter/customrouter-web", rule.GetNamespace(), rule.GetName())
+		}
+		wantLabels := map[string]string{
+			"release":               "prometheus",
+			configMapManagedByLabel: configMapManagedByValue,
+			configMapTargetLabel:    "web",
+		}
+		if !reflect.DeepEqual(rule.GetLabels(), wantLabels) {
+			t.Errorf("labels = %v, want %v", rule.GetLabels(), wantLabels)
+		}
+		want := []string{
+			"CustomRouterRouteBudgetNearlyExhausted",
+			"CustomRouterTooManyPartitions",
+			"CustomRouterHostRouteMissRatioHigh",
+		}
+		if got := alertNames(rule); !reflect.DeepEqual(got, want) {
+			t.Errorf("alerts = %v, want %v", got, want)
+		}
+
+		groups, _, _ := unstructured.NestedSlice(rule.Object, "spec", "groups")
+		budget := groups[0].(map[string]interface{})["rules"].([]interface{})[0].(map[string]interface{})
+		wantExpr := `customrouter_target_routes{target="web"} / customrouter_target_route_budget{target="web"} > 0.9`
+		if budget["expr"] != wantExpr {
+			t.Errorf("budget expr = %q, want %q", budget["expr"], wantExpr)
+		}
+		if budget["for"] != "15m" {
+			t.Errorf("for = %v, want 15m", budget["for"])
+		}
+	})
+
+	t.Run("unlimited budget", func(t *testing.T) {
+		r := &CustomHTTPRouteReconciler{PrometheusRules: &PrometheusRuleOptions{BudgetRatio: 0.9, MaxPartitions: 8}}
+		want := []string{"CustomRouterTooManyPartitions"}
+		if got := alertNames(r.buildPrometheusRule("web")); !reflect.DeepEqual(got, want) {
+			t.Errorf("alerts = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("every alert disabled", func(t *testing.T) {
+		r := &CustomHTTPRouteReconciler{MaxRoutesPerTarget: 1000, PrometheusRules: &PrometheusRuleOptions{}}
+		if spec := r.buildPrometheusRule("web").Object["spec"]; spec != nil {
+			t.Errorf("spec = %v, want none", spec)
+		}
+	})
+}
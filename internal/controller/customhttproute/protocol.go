@@ -0,0 +1,103 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
+)
+
+// reconcileProtocolHintsFromRoutes aggregates protocolHints rules, hash
+// policies and backend protocols across every CustomHTTPRoute and renders
+// the per-EPA protocol EnvoyFilter. Parallels
+// reconcileCORSFromRoutes — either the EPA reconciler or the CustomHTTPRoute
+// reconciler can drive convergence.
+func (r *CustomHTTPRouteReconciler) reconcileProtocolHintsFromRoutes(
+	ctx context.Context,
+	routeList *v1alpha1.CustomHTTPRouteList,
+	epaList *v1alpha1.ExternalProcessorAttachmentList,
+) error {
+	logger := log.FromContext(ctx)
+
+	entries := ef.CollectProtocolHintEntries(routeList)
+	backends := ef.CollectBackendProtocols(routeList)
+
+	if epaList == nil {
+		epaList = &v1alpha1.ExternalProcessorAttachmentList{}
+		if err := r.List(ctx, epaList); err != nil {
+			return fmt.Errorf("failed to list ExternalProcessorAttachments: %w", err)
+		}
+	}
+
+	if len(epaList.Items) == 0 {
+		if len(entries) > 0 || len(backends) > 0 {
+			logger.Info("CustomHTTPRoutes declare protocolHints or backend protocols but no ExternalProcessorAttachment exists, skipping protocol EnvoyFilter")
+		}
+		return nil
+	}
+
+	for i := range epaList.Items {
+		epa := &epaList.Items[i]
+		if epa.EffectiveProvider() != v1alpha1.GatewayProviderIstio {
+			continue
+		}
+		if !ef.SelectorResolved(epa) {
+			// See ef.SelectorResolved; the attachment's reconcile writes the
+			// filter once its Gateway selector resolves.
+			logger.V(1).Info("Skipping protocol EnvoyFilter: gateway selector of the attachment not resolved yet",
+				"epa", epa.Name,
+				"namespace", epa.Namespace)
+			continue
+		}
+
+		if len(entries) == 0 && len(backends) == 0 {
+			key := types.NamespacedName{
+				Name:      epa.Name + ef.ProtocolFilterSuffix,
+				Namespace: epa.Namespace,
+			}
+			if err := ef.DeleteEnvoyFilters(ctx, r.Client, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		envoyFilter, err := ef.BuildProtocolEnvoyFilter(epa, entries, backends)
+		if err != nil {
+			return fmt.Errorf("failed to build protocol EnvoyFilter for EPA %s/%s: %w",
+				epa.Namespace, epa.Name, err)
+		}
+
+		if err := ef.UpsertEnvoyFilters(ctx, r.Client, epa, envoyFilter); err != nil {
+			return fmt.Errorf("failed to reconcile protocol EnvoyFilter for EPA %s/%s: %w",
+				epa.Namespace, epa.Name, err)
+		}
+
+		logger.Info("Protocol EnvoyFilter reconciled from CustomHTTPRoutes",
+			"epa", epa.Name,
+			"namespace", epa.Namespace,
+			"protocolEntries", len(entries),
+			"backendProtocols", len(backends))
+	}
+
+	return nil
+}
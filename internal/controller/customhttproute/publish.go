@@ -0,0 +1,83 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// publishRoutes uploads the merged routes of target to RoutesBucket, for
+// consumers outside the cluster (see routes.BucketLoader). Unlike the
+// ConfigMaps, the object is never partitioned: it always holds the whole
+// route table of the target. A target without routes gets an empty table
+// rather than no object, so pollers drop the routes instead of keeping the
+// last ones. Unchanged content is not uploaded again.
+func (r *CustomHTTPRouteReconciler) publishRoutes(ctx context.Context, target string, config *routes.RoutesConfig) error {
+	if r.RoutesBucket == nil {
+		return nil
+	}
+
+	data, err := r.encodeRoutes(config)
+	if err != nil {
+		return fmt.Errorf("failed to serialize routes for target %s: %w", target, err)
+	}
+	checksum := routes.BucketChecksum(data)
+	if r.publishedChecksum(target) == checksum {
+		return nil
+	}
+
+	metadata := map[string]string{
+		routes.BucketMetadataSHA256:        checksum,
+		routes.BucketMetadataTarget:        target,
+		routes.BucketMetadataFormatVersion: strconv.Itoa(max(r.RoutesFormat.Version, routes.FormatVersion1)),
+	}
+	if err := r.RoutesBucket.Put(ctx, routes.BucketObjectKey(target), data, metadata); err != nil {
+		return fmt.Errorf("failed to publish routes for target %s: %w", target, err)
+	}
+	r.setPublishedChecksum(target, checksum)
+
+	log.FromContext(ctx).Info("Routes published to bucket",
+		"target", target,
+		"key", routes.BucketObjectKey(target),
+		"hostsCount", len(config.Hosts),
+		"bytes", len(data))
+	return nil
+}
+
+// publishedChecksum returns the checksum of the last object published for
+// target, or "" when none was published by this process.
+func (r *CustomHTTPRouteReconciler) publishedChecksum(target string) string {
+	r.publishedMu.Lock()
+	defer r.publishedMu.Unlock()
+	return r.publishedChecksums[target]
+}
+
+// setPublishedChecksum records the checksum of the object published for target.
+func (r *CustomHTTPRouteReconciler) setPublishedChecksum(target, checksum string) {
+	r.publishedMu.Lock()
+	defer r.publishedMu.Unlock()
+	if r.publishedChecksums == nil {
+		r.publishedChecksums = make(map[string]string)
+	}
+	r.publishedChecksums[target] = checksum
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// recordingBucket is an objectstore.Bucket that keeps every Put.
+type recordingBucket struct {
+	mu   sync.Mutex
+	puts []recordedPut
+}
+
+type recordedPut struct {
+	key      string
+	data     []byte
+	metadata map[string]string
+}
+
+func (b *recordingBucket) Get(context.Context, string, string) (*objectstore.Object, error) {
+	return nil, objectstore.ErrNotFound
+}
+
+func (b *recordingBucket) Put(_ context.Context, key string, data []byte, metadata map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.puts = append(b.puts, recordedPut{key: key, data: data, metadata: metadata})
+	return nil
+}
+
+func (b *recordingBucket) Delete(context.Context, string) error {
+	return nil
+}
+
+func TestRebuildPublishesRoutesToBucket(t *testing.T) {
+	ctx := context.Background()
+	route := routeForTarget("target-a", "/a")
+	bucket := &recordingBucket{}
+	r := newReconciler(route)
+	r.RoutesBucket = bucket
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if len(bucket.puts) != 1 {
+		t.Fatalf("expected 1 upload, got %d", len(bucket.puts))
+	}
+	put := bucket.puts[0]
+	if put.key != routes.BucketObjectKey("target-a") {
+		t.Errorf("uploaded key = %q, want %q", put.key, routes.BucketObjectKey("target-a"))
+	}
+	if put.metadata[routes.BucketMetadataSHA256] != routes.BucketChecksum(put.data) {
+		t.Errorf("sha256 metadata %q does not match the body", put.metadata[routes.BucketMetadataSHA256])
+	}
+	config, err := routes.DecodeRoutesConfig(put.data)
+	if err != nil {
+		t.Fatalf("failed to decode uploaded routes: %v", err)
+	}
+	if len(config.Hosts["a.example.com"]) != 1 {
+		t.Errorf("uploaded hosts = %v, want the route of a.example.com", config.Hosts)
+	}
+
+	// Unchanged routes are not uploaded again.
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if len(bucket.puts) != 1 {
+		t.Fatalf("expected no upload for unchanged routes, got %d uploads", len(bucket.puts))
+	}
+
+	// Removing the last route publishes an empty table.
+	if err := r.Delete(ctx, route); err != nil {
+		t.Fatalf("failed to delete route: %v", err)
+	}
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if len(bucket.puts) != 2 {
+		t.Fatalf("expected an upload after the last route was removed, got %d uploads", len(bucket.puts))
+	}
+	config, err = routes.DecodeRoutesConfig(bucket.puts[1].data)
+	if err != nil {
+		t.Fatalf("failed to decode uploaded routes: %v", err)
+	}
+	if len(config.Hosts) != 0 {
+		t.Errorf("uploaded hosts = %v, want none", config.Hosts)
+	}
+}
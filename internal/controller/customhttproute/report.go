@@ -0,0 +1,260 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const (
+	// routingReportBaseName is the base name of the routing report ConfigMap
+	// of a target: "customrouter-routing-report-<target>". It does not start
+	// with configMapBaseName, so it is never taken for a route partition.
+	routingReportBaseName = "customrouter-routing-report"
+
+	// routingReportLabel holds the target of a routing report ConfigMap. The
+	// report does not carry configMapTargetLabel, so extprocs never load it.
+	routingReportLabel = "customrouter.freepik.com/routing-report"
+
+	// routingReportDataKey is the ConfigMap data key of the routing report.
+	routingReportDataKey = "report.json"
+
+	// maxShadowedRoutesInCondition caps the shadowed routes listed in the
+	// RoutesShadowed condition message of a CustomHTTPRoute.
+	maxShadowedRoutesInCondition = 5
+)
+
+// RoutingReport is the routing report of a target, written as JSON to its
+// routing report ConfigMap.
+type RoutingReport struct {
+	Target string `json:"target"`
+
+	// ShadowedRoutes lists the routes that can never match because an
+	// earlier route of their host matches every request they would, by host
+	// then evaluation order.
+	ShadowedRoutes []ShadowedRoute `json:"shadowedRoutes"`
+}
+
+// ShadowedRoute is a route of the routing report that can never match.
+type ShadowedRoute struct {
+	Host       string      `json:"host"`
+	Route      ReportRoute `json:"route"`
+	ShadowedBy ReportRoute `json:"shadowedBy"`
+}
+
+// ReportRoute identifies a route of the routing report.
+type ReportRoute struct {
+	// Source is the namespace/name of the CustomHTTPRoute of the route.
+	Source   string `json:"source"`
+	Type     string `json:"type"`
+	Path     string `json:"path"`
+	Priority int32  `json:"priority"`
+	Method   string `json:"method,omitempty"`
+	Scheme   string `json:"scheme,omitempty"`
+}
+
+func (r ReportRoute) String() string {
+	s := r.Type + " " + r.Path
+	if r.Method != "" {
+		s = r.Method + " " + s
+	}
+	if r.Scheme != "" {
+		s = r.Scheme + " " + s
+	}
+	return s
+}
+
+// buildRoutingReport finds the shadowed routes of the admitted
+// CustomHTTPRoutes of target. The routes of every host are put in the order
+// MergeRoutesConfig evaluates them in, so it must be called with the same
+// admitted routes, before MergeRoutesConfig sorts them in place. The second
+// return value maps every CustomHTTPRoute with shadowed routes to their
+// descriptions, for its status.
+func buildRoutingReport(
+	target string,
+	admitted []expandedRoute,
+	strategy string,
+) (*RoutingReport, map[types.NamespacedName][]string) {
+	type sourcedRoute struct {
+		route  *routes.Route
+		source types.NamespacedName
+	}
+
+	byHost := make(map[string][]sourcedRoute)
+	for _, e := range admitted {
+		source := types.NamespacedName{Namespace: e.route.Namespace, Name: e.route.Name}
+		for host, hostRoutes := range e.hosts {
+			for i := range hostRoutes {
+				route := &hostRoutes[i]
+				// Marked on a copy: the expanded routes are shared.
+				if strategy == routes.MatchStrategyMostSpecific {
+					marked := *route
+					marked.MostSpecific = true
+					route = &marked
+				}
+				byHost[host] = append(byHost[host], sourcedRoute{route: route, source: source})
+			}
+		}
+	}
+	hosts := make([]string, 0, len(byHost))
+	for host := range byHost {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	report := &RoutingReport{Target: target, ShadowedRoutes: []ShadowedRoute{}}
+	var shadowed map[types.NamespacedName][]string
+	for _, host := range hosts {
+		entries := byHost[host]
+		sort.SliceStable(entries, func(i, j int) bool {
+			return routes.RouteLess(entries[i].route, entries[j].route)
+		})
+		hostRoutes := make([]routes.Route, len(entries))
+		for i, entry := range entries {
+			hostRoutes[i] = *entry.route
+		}
+
+		for _, s := range routes.FindShadowedRoutes(hostRoutes) {
+			route, by := entries[s.Route], entries[s.ShadowedBy]
+			item := ShadowedRoute{
+				Host:       host,
+				Route:      reportRoute(route.route, route.source),
+				ShadowedBy: reportRoute(by.route, by.source),
+			}
+			report.ShadowedRoutes = append(report.ShadowedRoutes, item)
+
+			message := fmt.Sprintf("%s on %s is shadowed by %s", item.Route, host, item.ShadowedBy)
+			if by.source != route.source {
+				message += " of " + item.ShadowedBy.Source
+			}
+			if shadowed == nil {
+				shadowed = make(map[types.NamespacedName][]string)
+			}
+			shadowed[route.source] = append(shadowed[route.source], message)
+		}
+	}
+	return report, shadowed
+}
+
+// reportRoute returns the report entry of route, from the CustomHTTPRoute source.
+func reportRoute(route *routes.Route, source types.NamespacedName) ReportRoute {
+	return ReportRoute{
+		Source:   source.String(),
+		Type:     route.Type,
+		Path:     route.Path,
+		Priority: route.Priority,
+		Method:   route.Method,
+		Scheme:   route.Scheme,
+	}
+}
+
+// routingReportName returns the name of the routing report ConfigMap of target.
+func routingReportName(target string) string {
+	return fmt.Sprintf("%s-%s", routingReportBaseName, target)
+}
+
+// syncRoutingReport writes the routing report of target to its ConfigMap, or
+// deletes the ConfigMap when report is nil. Unchanged reports are not
+// written again.
+func (r *CustomHTTPRouteReconciler) syncRoutingReport(ctx context.Context, target string, report *RoutingReport) error {
+	key := types.NamespacedName{Name: routingReportName(target), Namespace: r.ConfigMapNamespace}
+
+	existing := &corev1.ConfigMap{}
+	err := r.Get(ctx, key, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get routing report for target %s: %w", target, err)
+	}
+	found := err == nil
+
+	if report == nil {
+		if !found {
+			return nil
+		}
+		if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete routing report for target %s: %w", target, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize routing report for target %s: %w", target, err)
+	}
+	reportLabels := map[string]string{
+		"app.kubernetes.io/name": "customrouter",
+		configMapManagedByLabel:  configMapManagedByValue,
+		routingReportLabel:       target,
+	}
+
+	if !found {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    reportLabels,
+			},
+			Data: map[string]string{routingReportDataKey: string(data)},
+		}
+		if err := r.Create(ctx, cm); err != nil {
+			return fmt.Errorf("failed to create routing report for target %s: %w", target, err)
+		}
+		return nil
+	}
+
+	if existing.Data[routingReportDataKey] == string(data) && mapsEqual(existing.Labels, reportLabels) {
+		return nil
+	}
+	existing.Labels = reportLabels
+	existing.Data = map[string]string{routingReportDataKey: string(data)}
+	if err := r.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to update routing report for target %s: %w", target, err)
+	}
+	return nil
+}
+
+// setShadowedRoutes records the shadowed routes the last rebuild of target
+// found, by CustomHTTPRoute, replacing the previous set.
+func (r *CustomHTTPRouteReconciler) setShadowedRoutes(target string, shadowed map[types.NamespacedName][]string) {
+	r.shadowMu.Lock()
+	defer r.shadowMu.Unlock()
+	if len(shadowed) == 0 {
+		delete(r.shadowedRoutes, target)
+		return
+	}
+	if r.shadowedRoutes == nil {
+		r.shadowedRoutes = make(map[string]map[types.NamespacedName][]string)
+	}
+	r.shadowedRoutes[target] = shadowed
+}
+
+// routeShadowing returns the descriptions of the routes of the given
+// CustomHTTPRoute that the last rebuild of target found shadowed.
+func (r *CustomHTTPRouteReconciler) routeShadowing(target string, key types.NamespacedName) []string {
+	r.shadowMu.Lock()
+	defer r.shadowMu.Unlock()
+	return r.shadowedRoutes[target][key]
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func prefixRoute(name, path string, priority int32) *v1alpha1.CustomHTTPRoute {
+	return &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{"shop.example.com"},
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Rules: []v1alpha1.Rule{{
+				BackendRefs: []v1alpha1.BackendRef{{Name: name, Namespace: "ns", Port: 80}},
+				Matches:     []v1alpha1.PathMatch{{Path: path, Type: v1alpha1.MatchTypePathPrefix, Priority: priority}},
+			}},
+		},
+	}
+}
+
+func TestRebuildReportsShadowedRoutes(t *testing.T) {
+	ctx := context.Background()
+	broad := prefixRoute("broad", "/api", 2000)
+	narrow := prefixRoute("narrow", "/api/v1", 1000)
+	other := prefixRoute("other", "/api-docs", 1000)
+	r := newReconciler(broad, narrow, other)
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+
+	shadowed := r.routeShadowing("default", types.NamespacedName{Namespace: "ns", Name: "narrow"})
+	want := "prefix /api/v1 on shop.example.com is shadowed by prefix /api of ns/broad"
+	if len(shadowed) != 1 || shadowed[0] != want {
+		t.Errorf("narrow shadowed routes = %v, want [%s]", shadowed, want)
+	}
+	for _, name := range []string{"broad", "other"} {
+		if got := r.routeShadowing("default", types.NamespacedName{Namespace: "ns", Name: name}); got != nil {
+			t.Errorf("%s shadowed routes = %v, want none", name, got)
+		}
+	}
+
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: routingReportName("default"), Namespace: "test-ns"}
+	if err := r.Get(ctx, key, cm); err != nil {
+		t.Fatalf("routing report not written: %v", err)
+	}
+	if _, ok := cm.Labels[configMapTargetLabel]; ok {
+		t.Error("routing report carries the target label extprocs load ConfigMaps by")
+	}
+	var report RoutingReport
+	if err := json.Unmarshal([]byte(cm.Data[routingReportDataKey]), &report); err != nil {
+		t.Fatalf("invalid routing report: %v", err)
+	}
+	if len(report.ShadowedRoutes) != 1 || report.ShadowedRoutes[0].Route.Source != "ns/narrow" ||
+		report.ShadowedRoutes[0].ShadowedBy.Source != "ns/broad" {
+		t.Errorf("report = %+v, want ns/narrow shadowed by ns/broad", report)
+	}
+
+	// Removing every route of the target deletes the report.
+	for _, route := range []*v1alpha1.CustomHTTPRoute{broad, narrow, other} {
+		if err := r.Delete(ctx, route); err != nil {
+			t.Fatalf("failed to delete %s: %v", route.Name, err)
+		}
+	}
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if err := r.Get(ctx, key, cm); !errors.IsNotFound(err) {
+		t.Errorf("routing report still present after removing the routes: %v", err)
+	}
+	if got := r.routeShadowing("default", types.NamespacedName{Namespace: "ns", Name: "narrow"}); got != nil {
+		t.Errorf("shadowed routes kept after removing the routes: %v", got)
+	}
+}
+
+func TestUpdateConditionRoutesShadowed(t *testing.T) {
+	r := &CustomHTTPRouteReconciler{}
+	route := &v1alpha1.CustomHTTPRoute{}
+
+	r.UpdateConditionRoutesShadowed(route, nil)
+	cond := route.Status.Conditions[0]
+	if cond.Status != metav1.ConditionFalse || cond.Reason != "NoShadowedRoutes" {
+		t.Errorf("condition = %+v, want False/NoShadowedRoutes", cond)
+	}
+
+	shadowed := []string{"a", "b", "c", "d", "e", "f", "g"}
+	r.UpdateConditionRoutesShadowed(route, shadowed)
+	cond = route.Status.Conditions[0]
+	if cond.Status != metav1.ConditionTrue || cond.Reason != "RoutesShadowed" {
+		t.Errorf("condition = %+v, want True/RoutesShadowed", cond)
+	}
+	if !strings.HasPrefix(cond.Message, "7 route(s) can never match: a; b; c; d; e") ||
+		!strings.HasSuffix(cond.Message, "; and 2 more") {
+		t.Errorf("message = %q", cond.Message)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// namespaceRouterConfigs is what the CustomRouterConfigs selecting a
+// namespace give its CustomHTTPRoutes.
+type namespaceRouterConfigs struct {
+	// specs are the specs of the CustomRouterConfigs, ordered by name.
+	specs []*v1alpha1.CustomRouterConfigSpec
+	// key names the CustomRouterConfigs and their resourceVersions, so the
+	// expansion cache tells a change to any of them apart.
+	key string
+}
+
+// inheritRouterConfigs replaces the CustomHTTPRoutes of customRoutes that
+// inherit defaults from CustomRouterConfigs with copies that have them set
+// (see CustomHTTPRouteSpec.InheritDefaults), so everything after it, the
+// expansion included, sees the defaults like fields of the route. The second
+// return value maps the UID of every route replaced to the key of its
+// CustomRouterConfigs, for the expansion cache.
+func (r *CustomHTTPRouteReconciler) inheritRouterConfigs(
+	ctx context.Context,
+	customRoutes []*v1alpha1.CustomHTTPRoute,
+) ([]*v1alpha1.CustomHTTPRoute, map[types.UID]string, error) {
+	configList := &v1alpha1.CustomRouterConfigList{}
+	if err := r.List(ctx, configList); err != nil {
+		return nil, nil, fmt.Errorf("failed to list CustomRouterConfigs: %w", err)
+	}
+	if len(configList.Items) == 0 {
+		return customRoutes, nil, nil
+	}
+	sort.Slice(configList.Items, func(i, j int) bool {
+		return configList.Items[i].Name < configList.Items[j].Name
+	})
+
+	byNamespace := make(map[string]*namespaceRouterConfigs)
+	inherited := make(map[types.UID]string)
+	for i, route := range customRoutes {
+		configs, seen := byNamespace[route.Namespace]
+		if !seen {
+			var err error
+			configs, err = r.selectRouterConfigs(ctx, route.Namespace, configList.Items)
+			if err != nil {
+				return nil, nil, err
+			}
+			byNamespace[route.Namespace] = configs
+		}
+		if len(configs.specs) == 0 {
+			continue
+		}
+		inheriting := route.DeepCopy()
+		if inheriting.Spec.InheritDefaults(configs.specs) {
+			customRoutes[i] = inheriting
+			inherited[route.UID] = configs.key
+		}
+	}
+	return customRoutes, inherited, nil
+}
+
+// selectRouterConfigs returns the CustomRouterConfigs of configs, ordered
+// by name, that select namespace. A CustomRouterConfig with an invalid
+// namespaceSelector selects none.
+func (r *CustomHTTPRouteReconciler) selectRouterConfigs(
+	ctx context.Context,
+	namespace string,
+	configs []v1alpha1.CustomRouterConfig,
+) (*namespaceRouterConfigs, error) {
+	var ns corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+	selected := &namespaceRouterConfigs{}
+	var key strings.Builder
+	for i := range configs {
+		ok, err := configs[i].SelectsNamespace(ns.Labels)
+		if err != nil || !ok {
+			continue
+		}
+		selected.specs = append(selected.specs, &configs[i].Spec)
+		key.WriteString(configs[i].Name)
+		key.WriteByte('@')
+		key.WriteString(configs[i].ResourceVersion)
+		key.WriteByte('\n')
+	}
+	selected.key = key.String()
+	return selected, nil
+}
+
+// findRoutesForRouterConfig returns reconcile requests for every
+// CustomHTTPRoute. The namespaces a CustomRouterConfig selected before a
+// change are not known, so the routes of all of them are rebuilt.
+func (r *CustomHTTPRouteReconciler) findRoutesForRouterConfig(ctx context.Context, _ client.Object) []reconcile.Request {
+	routeList := &v1alpha1.CustomHTTPRouteList{}
+	if err := r.List(ctx, routeList); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(routeList.Items))
+	for i := range routeList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      routeList.Items[i].Name,
+				Namespace: routeList.Items[i].Namespace,
+			},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestRebuildInheritsRouterConfigs(t *testing.T) {
+	ctx := context.Background()
+	inheriting := budgetRoute("inheriting", time.Now(), "/a")
+	inheriting.UID = "uid-inheriting"
+	own := budgetRoute("own", time.Now(), "/b")
+	own.Spec.PathPrefixes = &v1alpha1.PathPrefixes{Policy: v1alpha1.PathPrefixPolicyDisabled}
+	unselected := budgetRoute("unselected", time.Now(), "/c")
+	unselected.Namespace = "other"
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "ns",
+		Labels: map[string]string{"site": "web"},
+	}}
+	config := &v1alpha1.CustomRouterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "locales"},
+		Spec: v1alpha1.CustomRouterConfigSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"site": "web"}},
+			PathPrefixes: &v1alpha1.PathPrefixes{
+				Values: []string{"es"},
+				Policy: v1alpha1.PathPrefixPolicyRequired,
+			},
+		},
+	}
+	r := newReconciler(inheriting, own, unselected, ns, config)
+
+	routesData := func() string {
+		t.Helper()
+		if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+			t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+		}
+		cms := &corev1.ConfigMapList{}
+		if err := r.List(ctx, cms, client.InNamespace("test-ns"), client.MatchingLabels{configMapTargetLabel: "default"}); err != nil {
+			t.Fatalf("failed to list ConfigMaps: %v", err)
+		}
+		if len(cms.Items) != 1 {
+			t.Fatalf("expected 1 ConfigMap, got %d", len(cms.Items))
+		}
+		return cms.Items[0].Data[routesDataKey]
+	}
+
+	data := routesData()
+	if !strings.Contains(data, `"/es/a"`) || strings.Contains(data, `"/a"`) {
+		t.Errorf("route of a selected namespace did not inherit the Required pathPrefixes: %s", data)
+	}
+	if !strings.Contains(data, `"/b"`) || strings.Contains(data, `"/es/b"`) {
+		t.Errorf("route setting its own pathPrefixes inherited the config's: %s", data)
+	}
+	if !strings.Contains(data, `"/c"`) || strings.Contains(data, `"/es/c"`) {
+		t.Errorf("route of a namespace the config does not select inherited it: %s", data)
+	}
+
+	// A change to the config reaches the route, although the route's own
+	// generation, and with it its cached expansion, did not change.
+	config.Spec.PathPrefixes.Values = []string{"fr"}
+	if err := r.Update(ctx, config); err != nil {
+		t.Fatalf("failed to update CustomRouterConfig: %v", err)
+	}
+	data = routesData()
+	if !strings.Contains(data, `"/fr/a"`) || strings.Contains(data, `"/es/a"`) {
+		t.Errorf("route did not pick up the changed pathPrefixes: %s", data)
+	}
+
+	// Once the namespace is no longer selected, the defaults are gone.
+	ns.Labels = nil
+	if err := r.Update(ctx, ns); err != nil {
+		t.Fatalf("failed to update namespace: %v", err)
+	}
+	data = routesData()
+	if !strings.Contains(data, `"/a"`) || strings.Contains(data, `"/fr/a"`) {
+		t.Errorf("route still inherits from a config no longer selecting its namespace: %s", data)
+	}
+}
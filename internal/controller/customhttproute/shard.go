@@ -0,0 +1,381 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/internal/controller"
+)
+
+const (
+	// ShardLabel names the shard that wrote a route ConfigMap. ConfigMaps
+	// written by an unsharded controller do not carry it.
+	ShardLabel = "customrouter.freepik.com/shard"
+
+	// shardSelectorAnnotation records the --target-shard of the shard that
+	// wrote a route ConfigMap, so other shards can tell whether it still
+	// claims the target.
+	shardSelectorAnnotation = "customrouter.freepik.com/shard-selector"
+)
+
+// shardNamePattern is the format of a shard name, which ends up in a label
+// value and in the name of the shard's leader election Lease.
+var shardNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// TargetShard selects the targets a controller instance owns (--target-shard),
+// so that several controller deployments split the targets of a large
+// installation between them. A nil TargetShard owns every target.
+type TargetShard struct {
+	// Name identifies the shard in the ShardLabel of its ConfigMaps and in
+	// its leader election Lease. It defaults to a name derived from the
+	// selector.
+	Name string
+
+	selector string
+
+	// hashFrom, hashTo and hashCount select the targets whose FNV-32a hash
+	// modulo hashCount is in [hashFrom, hashTo]; unused when targets is set.
+	hashFrom, hashTo, hashCount uint32
+
+	// targets lists the owned targets of a targets: selector.
+	targets map[string]bool
+}
+
+// ParseTargetShard parses a --target-shard value:
+//
+//   - "hash:<index>/<count>" owns the targets whose hash modulo count is
+//     index, e.g. "hash:0/4" for the first of four shards;
+//   - "hash:<from>-<to>/<count>" owns the hash range [from, to], so shards
+//     can be split without moving the targets of the others;
+//   - "targets:<name>,<name>..." owns the listed targets.
+//
+// An empty value returns nil, which owns every target.
+func ParseTargetShard(value string) (*TargetShard, error) {
+	if value == "" {
+		return nil, nil
+	}
+	kind, spec, ok := strings.Cut(value, ":")
+	if !ok || spec == "" {
+		return nil, fmt.Errorf("invalid target shard %q: want hash:<from>[-<to>]/<count> or targets:<name>,...", value)
+	}
+	shard := &TargetShard{selector: value, Name: defaultShardName(value)}
+	switch kind {
+	case "hash":
+		hashRange, count, ok := strings.Cut(spec, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid target shard %q: missing /<count>", value)
+		}
+		from, to, isRange := strings.Cut(hashRange, "-")
+		if !isRange {
+			to = from
+		}
+		var err error
+		if shard.hashFrom, err = parseShardUint(from); err != nil {
+			return nil, fmt.Errorf("invalid target shard %q: %w", value, err)
+		}
+		if shard.hashTo, err = parseShardUint(to); err != nil {
+			return nil, fmt.Errorf("invalid target shard %q: %w", value, err)
+		}
+		if shard.hashCount, err = parseShardUint(count); err != nil {
+			return nil, fmt.Errorf("invalid target shard %q: %w", value, err)
+		}
+		if shard.hashCount == 0 || shard.hashFrom > shard.hashTo || shard.hashTo >= shard.hashCount {
+			return nil, fmt.Errorf("invalid target shard %q: want 0 <= from <= to < count", value)
+		}
+	case "targets":
+		shard.targets = make(map[string]bool)
+		for _, target := range strings.Split(spec, ",") {
+			if target = strings.TrimSpace(target); target != "" {
+				shard.targets[target] = true
+			}
+		}
+		if len(shard.targets) == 0 {
+			return nil, fmt.Errorf("invalid target shard %q: no target listed", value)
+		}
+	default:
+		return nil, fmt.Errorf("invalid target shard %q: unknown kind %q (want hash or targets)", value, kind)
+	}
+	return shard, nil
+}
+
+// parseShardUint parses a number of a hash shard selector.
+func parseShardUint(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return uint32(n), nil
+}
+
+// defaultShardName derives a shard name from its selector, e.g. "hash-0-4"
+// from "hash:0/4".
+func defaultShardName(selector string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(selector) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := b.String()
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.Trim(name, "-")
+}
+
+// ValidateShardName checks a --shard-name flag value.
+func ValidateShardName(name string) error {
+	if !shardNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid shard name %q: want at most 63 lowercase alphanumerics or '-', starting and ending with an alphanumeric", name)
+	}
+	return nil
+}
+
+// Owns reports whether the shard owns target.
+func (s *TargetShard) Owns(target string) bool {
+	if s == nil {
+		return true
+	}
+	if s.targets != nil {
+		return s.targets[target]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(target))
+	bucket := h.Sum32() % s.hashCount
+	return bucket >= s.hashFrom && bucket <= s.hashTo
+}
+
+// String returns the selector the shard was parsed from, or "" for nil.
+func (s *TargetShard) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.selector
+}
+
+// name returns the shard name, or "" for the unsharded controller.
+func (s *TargetShard) name() string {
+	if s == nil {
+		return ""
+	}
+	return s.Name
+}
+
+// LeaderElectionID returns the leader election ID of shard in an
+// installation whose unsharded controller uses base. Every shard elects its
+// own leader, so the shards run side by side.
+func LeaderElectionID(base string, shard *TargetShard) string {
+	return shardLeaderElectionID(base, shard.name())
+}
+
+// shardLeaderElectionID returns the leader election ID of the shard named
+// name, base for the unsharded controller.
+func shardLeaderElectionID(base, name string) string {
+	if name == "" {
+		return base
+	}
+	return name + "." + base
+}
+
+// ShardLeases reads the leader election Leases of the controllers of an
+// installation, to tell a ConfigMap owned by a running shard from one left
+// behind by a shard that was removed or reconfigured.
+type ShardLeases struct {
+	// Reader reads the Leases, typically the manager's API reader: Leases
+	// are only read on an ownership change, so they are not cached.
+	Reader client.Reader
+
+	// Namespace is the namespace of the leader election Leases.
+	Namespace string
+
+	// LeaderElectionID is the leader election ID of the unsharded
+	// controller, from which the ID of every shard is derived (see
+	// LeaderElectionID).
+	LeaderElectionID string
+}
+
+// held reports whether the Lease of shard is held and was renewed within
+// its lease duration.
+func (l *ShardLeases) held(ctx context.Context, shard string, now time.Time) (bool, error) {
+	lease := &coordinationv1.Lease{}
+	key := types.NamespacedName{Namespace: l.Namespace, Name: shardLeaderElectionID(l.LeaderElectionID, shard)}
+	if err := l.Reader.Get(ctx, key, lease); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read the leader election Lease of shard %q: %w", shard, err)
+	}
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return false, nil
+	}
+	expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+	return now.Before(expiry), nil
+}
+
+// ShardConflictError reports a target owned by another running shard, when
+// the --target-shard selectors of two controllers overlap.
+type ShardConflictError struct {
+	Target string
+	Owner  string
+}
+
+func (e *ShardConflictError) Error() string {
+	owner := e.Owner
+	if owner == "" {
+		owner = "the unsharded controller"
+	} else {
+		owner = fmt.Sprintf("shard %q", owner)
+	}
+	return fmt.Sprintf("target %s is owned by %s, which is running and still selects it; fix the overlapping --target-shard selectors", e.Target, owner)
+}
+
+// checkShardOwnership refuses to rebuild a target whose ConfigMaps were
+// written by another controller that still selects the target and holds its
+// leader election Lease. ConfigMaps of a shard that is gone or no longer
+// selects the target are taken over by the next rebuild, which relabels
+// them. Without ShardLeases there is no way to tell and nothing is checked.
+func (r *CustomHTTPRouteReconciler) checkShardOwnership(ctx context.Context, target string) error {
+	if r.ShardLeases == nil {
+		return nil
+	}
+	configMapList := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMapList, &client.ListOptions{
+		Namespace: r.ConfigMapNamespace,
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			configMapManagedByLabel: configMapManagedByValue,
+			configMapTargetLabel:    target,
+		}),
+	}); err != nil {
+		return fmt.Errorf("failed to list ConfigMaps for target %s: %w", target, err)
+	}
+
+	own := r.Shard.name()
+	checked := make(map[string]bool)
+	now := time.Now()
+	for i := range configMapList.Items {
+		cm := &configMapList.Items[i]
+		owner := cm.Labels[ShardLabel]
+		if owner == own || checked[owner] {
+			continue
+		}
+		checked[owner] = true
+		// A selector that does not parse cannot claim anything.
+		ownerShard, err := ParseTargetShard(cm.Annotations[shardSelectorAnnotation])
+		if err != nil || !ownerShard.Owns(target) {
+			continue
+		}
+		held, err := r.ShardLeases.held(ctx, owner, now)
+		if err != nil {
+			return err
+		}
+		if held {
+			return &ShardConflictError{Target: target, Owner: owner}
+		}
+		log.FromContext(ctx).Info("taking over the ConfigMaps of a stopped shard",
+			"target", target, "previousShard", owner, "shard", own)
+	}
+	return nil
+}
+
+// shardLabels sets the ownership label and annotation of the shard on the
+// labels and annotations of a route ConfigMap. The unsharded controller sets
+// none.
+func (r *CustomHTTPRouteReconciler) shardLabels(configMapLabels, configMapAnnotations map[string]string) {
+	if r.Shard == nil {
+		return
+	}
+	configMapLabels[ShardLabel] = r.Shard.Name
+	configMapAnnotations[shardSelectorAnnotation] = r.Shard.String()
+}
+
+// shardPredicate filters the CustomHTTPRoute events of a sharded controller
+// down to the routes of its targets, and those that just moved away from one
+// of them (see releaseMovedRoute).
+func (r *CustomHTTPRouteReconciler) shardPredicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		route, ok := obj.(*v1alpha1.CustomHTTPRoute)
+		if !ok {
+			return false
+		}
+		if r.Shard.Owns(route.Spec.TargetRef.Name) {
+			return true
+		}
+		previous, ok := route.Annotations[lastTargetAnnotation]
+		return ok && r.Shard.Owns(previous)
+	})
+}
+
+// handoverPending reports whether route moved away from a target of another
+// shard, which has not dropped it from its ConfigMaps yet. The shard of the
+// previous target acknowledges it by rewriting the last-target annotation.
+func (r *CustomHTTPRouteReconciler) handoverPending(route *v1alpha1.CustomHTTPRoute) bool {
+	previous, ok := route.Annotations[lastTargetAnnotation]
+	return ok && previous != route.Spec.TargetRef.Name && !r.Shard.Owns(previous)
+}
+
+// releaseMovedRoute handles a route of a target this shard does not own. When
+// it moved away from one of this shard's targets, that target is rebuilt
+// without it, and the last-target annotation is pointed at the new target to
+// hand the route over to its shard (see handoverPending). Other routes are
+// left to their own shard.
+func (r *CustomHTTPRouteReconciler) releaseMovedRoute(ctx context.Context, route *v1alpha1.CustomHTTPRoute) (ctrl.Result, error) {
+	previous, ok := route.Annotations[lastTargetAnnotation]
+	if !ok || previous == route.Spec.TargetRef.Name || !r.Shard.Owns(previous) {
+		return ctrl.Result{}, nil
+	}
+	log.FromContext(ctx).Info("CustomHTTPRoute moved to a target of another shard, rebuilding its previous target",
+		"name", route.Name,
+		"namespace", route.Namespace,
+		"previousTarget", previous,
+		"newTarget", route.Spec.TargetRef.Name)
+	requeueAfter, err := r.rebuildTarget(ctx, previous, true)
+	if err != nil || requeueAfter > 0 {
+		return ctrl.Result{RequeueAfter: requeueAfter}, err
+	}
+	err = controller.UpdateWithRetry(ctx, r.Client, route, func(object client.Object) error {
+		moved := object.(*v1alpha1.CustomHTTPRoute)
+		if moved.Annotations[lastTargetAnnotation] == previous {
+			moved.Annotations[lastTargetAnnotation] = moved.Spec.TargetRef.Name
+		}
+		return nil
+	})
+	return ctrl.Result{}, client.IgnoreNotFound(err)
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestParseTargetShard(t *testing.T) {
+	for _, value := range []string{
+		"hash", "hash:", "hash:1", "hash:4/4", "hash:2-1/4", "hash:0/0", "hash:a/4",
+		"targets:", "targets: , ", "name:a",
+	} {
+		if _, err := ParseTargetShard(value); err == nil {
+			t.Errorf("ParseTargetShard(%q) succeeded, want an error", value)
+		}
+	}
+
+	shard, err := ParseTargetShard("")
+	if err != nil || shard != nil {
+		t.Fatalf("ParseTargetShard(\"\") = %v, %v, want nil, nil", shard, err)
+	}
+	if !shard.Owns("anything") {
+		t.Error("the unsharded controller must own every target")
+	}
+
+	shard, err = ParseTargetShard("targets:internal, public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shard.Name != "targets-internal-public" {
+		t.Errorf("Name = %q, want targets-internal-public", shard.Name)
+	}
+	if !shard.Owns("internal") || !shard.Owns("public") || shard.Owns("other") {
+		t.Error("a targets shard must own exactly the listed targets")
+	}
+}
+
+func TestTargetShardHashPartitionsTargets(t *testing.T) {
+	shards := make([]*TargetShard, 4)
+	for i := range shards {
+		var err error
+		if shards[i], err = ParseTargetShard(fmt.Sprintf("hash:%d/4", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lowerHalf, err := ParseTargetShard("hash:0-1/4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lowerHalf.Name != "hash-0-1-4" {
+		t.Errorf("Name = %q, want hash-0-1-4", lowerHalf.Name)
+	}
+
+	for i := range 200 {
+		target := fmt.Sprintf("target-%d", i)
+		owners := 0
+		for _, shard := range shards {
+			if shard.Owns(target) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("target %s is owned by %d shards, want 1", target, owners)
+		}
+		if lowerHalf.Owns(target) != (shards[0].Owns(target) || shards[1].Owns(target)) {
+			t.Fatalf("hash:0-1/4 must own the targets of hash:0/4 and hash:1/4, not %s", target)
+		}
+	}
+}
+
+// shardedConfigMap returns a route ConfigMap of target written by shard.
+func shardedConfigMap(target, shard, selector string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "customrouter-routes-" + target + "-0",
+			Namespace: "test-ns",
+			Labels: map[string]string{
+				configMapManagedByLabel: configMapManagedByValue,
+				configMapTargetLabel:    target,
+				ShardLabel:              shard,
+			},
+			Annotations: map[string]string{shardSelectorAnnotation: selector},
+		},
+	}
+}
+
+// shardLease returns the leader election Lease of shard, last renewed at
+// renewed.
+func shardLease(shard string, renewed time.Time) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shardLeaderElectionID("base", shard),
+			Namespace: "system",
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To("pod"),
+			LeaseDurationSeconds: ptr.To(int32(15)),
+			RenewTime:            &metav1.MicroTime{Time: renewed},
+		},
+	}
+}
+
+func TestCheckShardOwnership(t *testing.T) {
+	shard, err := ParseTargetShard("targets:public")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		objs         []client.Object
+		wantConflict bool
+	}{
+		{name: "no ConfigMaps"},
+		{
+			name: "own ConfigMaps",
+			objs: []client.Object{shardedConfigMap("public", shard.Name, shard.String())},
+		},
+		{
+			name: "running shard still selecting the target",
+			objs: []client.Object{
+				shardedConfigMap("public", "hash-0-1", "hash:0/1"),
+				shardLease("hash-0-1", time.Now()),
+			},
+			wantConflict: true,
+		},
+		{
+			name: "running unsharded controller",
+			objs: []client.Object{
+				shardedConfigMap("public", "", ""),
+				shardLease("", time.Now()),
+			},
+			wantConflict: true,
+		},
+		{
+			name: "stopped shard",
+			objs: []client.Object{
+				shardedConfigMap("public", "hash-0-1", "hash:0/1"),
+				shardLease("hash-0-1", time.Now().Add(-time.Minute)),
+			},
+		},
+		{
+			name: "shard without a Lease",
+			objs: []client.Object{shardedConfigMap("public", "hash-0-1", "hash:0/1")},
+		},
+		{
+			name: "running shard no longer selecting the target",
+			objs: []client.Object{
+				shardedConfigMap("public", "targets-internal", "targets:internal"),
+				shardLease("targets-internal", time.Now()),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReconciler()
+			for _, obj := range tt.objs {
+				if err := r.Create(context.Background(), obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.Shard = shard
+			r.ShardLeases = &ShardLeases{Reader: r.Client, Namespace: "system", LeaderElectionID: "base"}
+
+			err := r.checkShardOwnership(context.Background(), "public")
+			var conflict *ShardConflictError
+			if got := errors.As(err, &conflict); got != tt.wantConflict {
+				t.Fatalf("checkShardOwnership() = %v, want conflict %v", err, tt.wantConflict)
+			}
+			if !tt.wantConflict && err != nil {
+				t.Fatalf("checkShardOwnership() = %v", err)
+			}
+		})
+	}
+}
+
+func TestRebuildConfigMapsForTarget_ShardLabels(t *testing.T) {
+	route := &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "route-a", Namespace: "ns", UID: "uid-a"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{"a.example.com"},
+			TargetRef: v1alpha1.TargetRef{Name: "public"},
+			Rules: []v1alpha1.Rule{{
+				BackendRefs: []v1alpha1.BackendRef{{Name: "svc", Namespace: "ns", Port: 80}},
+				Matches:     []v1alpha1.PathMatch{{Path: "/a", Type: "Exact"}},
+			}},
+		},
+	}
+	r := newReconciler(route, shardedConfigMap("public", "old", "targets:public"))
+	r.Shard, _ = ParseTargetShard("targets:public")
+
+	if err := r.rebuildConfigMapsForTarget(context.Background(), "public"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: "customrouter-routes-public-0", Namespace: "test-ns"}
+	if err := r.Get(context.Background(), key, cm); err != nil {
+		t.Fatal(err)
+	}
+	if cm.Labels[ShardLabel] != "targets-public" || cm.Annotations[shardSelectorAnnotation] != "targets:public" {
+		t.Errorf("ConfigMap not taken over: labels %v, annotations %v", cm.Labels, cm.Annotations)
+	}
+
+	// Going back to a single controller drops the shard label.
+	r.Shard = nil
+	r.partitionHashes = nil
+	if err := r.rebuildConfigMapsForTarget(context.Background(), "public"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if err := r.Get(context.Background(), key, cm); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cm.Labels[ShardLabel]; ok {
+		t.Errorf("unsharded ConfigMap still labelled: %v", cm.Labels)
+	}
+	if _, ok := cm.Annotations[shardSelectorAnnotation]; ok {
+		t.Errorf("unsharded ConfigMap still annotated: %v", cm.Annotations)
+	}
+}
+
+func TestReleaseMovedRoute(t *testing.T) {
+	route := &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "route-a", Namespace: "ns", UID: "uid-a",
+			Annotations: map[string]string{lastTargetAnnotation: "internal"},
+		},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{"a.example.com"},
+			TargetRef: v1alpha1.TargetRef{Name: "public"},
+			Rules: []v1alpha1.Rule{{
+				BackendRefs: []v1alpha1.BackendRef{{Name: "svc", Namespace: "ns", Port: 80}},
+				Matches:     []v1alpha1.PathMatch{{Path: "/a", Type: "Exact"}},
+			}},
+		},
+	}
+	internal := shardedConfigMap("internal", "targets-internal", "targets:internal")
+	r := newReconciler(route, internal)
+	r.Shard, _ = ParseTargetShard("targets:internal")
+	r.StateGCInterval = -1
+
+	public, _ := ParseTargetShard("targets:public")
+	publicShard := &CustomHTTPRouteReconciler{Shard: public}
+	if !publicShard.handoverPending(route) {
+		t.Fatal("the shard of the new target must wait for the handover")
+	}
+
+	if _, err := r.releaseMovedRoute(context.Background(), route); err != nil {
+		t.Fatalf("releaseMovedRoute failed: %v", err)
+	}
+	cm := &corev1.ConfigMap{}
+	err := r.Get(context.Background(), client.ObjectKeyFromObject(internal), cm)
+	if err == nil {
+		t.Error("the previous target still has its ConfigMap")
+	}
+	moved := &v1alpha1.CustomHTTPRoute{}
+	if err := r.Get(context.Background(), client.ObjectKeyFromObject(route), moved); err != nil {
+		t.Fatal(err)
+	}
+	if moved.Annotations[lastTargetAnnotation] != "public" {
+		t.Errorf("last target = %q, want public", moved.Annotations[lastTargetAnnotation])
+	}
+	if publicShard.handoverPending(moved) {
+		t.Error("handover still pending after the release")
+	}
+}
@@ -19,6 +19,8 @@ package customhttproute
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -80,6 +82,110 @@ func (r *CustomHTTPRouteReconciler) UpdateConditionConfigMapFailed(object *v1alp
 	})
 }
 
+// UpdateConditionRouteBudgetExceeded sets the ConfigMapSynced condition to False for a route left
+// out of its target's ConfigMaps by the route budget
+func (r *CustomHTTPRouteReconciler) UpdateConditionRouteBudgetExceeded(object *v1alpha1.CustomHTTPRoute, message string) {
+	meta.SetStatusCondition(&object.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionTypeConfigMapSynced,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: object.Generation,
+		Reason:             controller.ConditionReasonRouteBudgetExceeded,
+		Message:            message,
+	})
+}
+
+// UpdateConditionTargetNotAllowed sets the ConfigMapSynced condition to False for a route left
+// out of its target's ConfigMaps because its namespace does not allow the target
+func (r *CustomHTTPRouteReconciler) UpdateConditionTargetNotAllowed(object *v1alpha1.CustomHTTPRoute, message string) {
+	meta.SetStatusCondition(&object.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionTypeConfigMapSynced,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: object.Generation,
+		Reason:             controller.ConditionReasonTargetNotAllowed,
+		Message:            message,
+	})
+}
+
+// UpdateConditionRoutesShadowed sets the RoutesShadowed condition from the
+// descriptions of the route's shadowed routes returned by routeShadowing.
+func (r *CustomHTTPRouteReconciler) UpdateConditionRoutesShadowed(object *v1alpha1.CustomHTTPRoute, shadowed []string) {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionTypeRoutesShadowed,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: object.Generation,
+		Reason:             controller.ConditionReasonNoShadowedRoutes,
+		Message:            controller.ConditionReasonNoShadowedRoutesMessage,
+	}
+	if len(shadowed) > 0 {
+		listed := shadowed
+		if len(listed) > maxShadowedRoutesInCondition {
+			listed = listed[:maxShadowedRoutesInCondition]
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = controller.ConditionReasonRoutesShadowed
+		condition.Message = fmt.Sprintf("%d route(s) can never match: %s", len(shadowed), strings.Join(listed, "; "))
+		if more := len(shadowed) - len(listed); more > 0 {
+			condition.Message += fmt.Sprintf("; and %d more", more)
+		}
+	}
+	meta.SetStatusCondition(&object.Status.Conditions, condition)
+}
+
+// UpdateConditionHTTPProxyRoutesSkipped sets the HTTPProxyRoutesSkipped
+// condition from the descriptions of the route's routes left out of the
+// HTTPProxies, returned by skippedHTTPProxyRoutes. Routes of targets not
+// written as HTTPProxies carry no such condition.
+func (r *CustomHTTPRouteReconciler) UpdateConditionHTTPProxyRoutesSkipped(object *v1alpha1.CustomHTTPRoute, skipped []string) {
+	if _, ok := r.HTTPProxyTargets[object.Spec.TargetRef.Name]; !ok {
+		meta.RemoveStatusCondition(&object.Status.Conditions, v1alpha1.ConditionTypeHTTPProxyRoutesSkipped)
+		return
+	}
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionTypeHTTPProxyRoutesSkipped,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: object.Generation,
+		Reason:             controller.ConditionReasonAllRoutesExpressed,
+		Message:            controller.ConditionReasonAllRoutesExpressedMessage,
+	}
+	if len(skipped) > 0 {
+		listed := skipped
+		if len(listed) > maxShadowedRoutesInCondition {
+			listed = listed[:maxShadowedRoutesInCondition]
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = controller.ConditionReasonHTTPProxyRoutesSkipped
+		condition.Message = fmt.Sprintf("%d route(s) not served through the HTTPProxies: %s",
+			len(skipped), strings.Join(listed, "; "))
+		if more := len(skipped) - len(listed); more > 0 {
+			condition.Message += fmt.Sprintf("; and %d more", more)
+		}
+	}
+	meta.SetStatusCondition(&object.Status.Conditions, condition)
+}
+
+// UpdateConditionRulesExpired sets the RulesExpired condition from the
+// indexes of the route's rules expired at now.
+func (r *CustomHTTPRouteReconciler) UpdateConditionRulesExpired(object *v1alpha1.CustomHTTPRoute, now time.Time) {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionTypeRulesExpired,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: object.Generation,
+		Reason:             controller.ConditionReasonNoExpiredRules,
+		Message:            controller.ConditionReasonNoExpiredRulesMessage,
+	}
+	if expired := object.Spec.ExpiredRules(now); len(expired) > 0 {
+		listed := make([]string, len(expired))
+		for i, rule := range expired {
+			listed[i] = fmt.Sprintf("rules[%d] (expired %s)", rule,
+				object.Spec.Rules[rule].ExpiresAt.UTC().Format(time.RFC3339))
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = controller.ConditionReasonRulesExpired
+		condition.Message = fmt.Sprintf("%d rule(s) expired and no longer routed: %s", len(expired), strings.Join(listed, "; "))
+	}
+	meta.SetStatusCondition(&object.Status.Conditions, condition)
+}
+
 // UpdateConditionCatchAllProgrammed sets the CatchAllProgrammed condition from the given evaluation result.
 func (r *CustomHTTPRouteReconciler) UpdateConditionCatchAllProgrammed(
 	object *v1alpha1.CustomHTTPRoute,
@@ -98,8 +204,26 @@ func (r *CustomHTTPRouteReconciler) UpdateConditionCatchAllProgrammed(
 	})
 }
 
+// UpdateConditionBackendsResolved sets the BackendsResolved condition from the
+// list of unresolved backendRefs returned by ResolveBackends.
+func (r *CustomHTTPRouteReconciler) UpdateConditionBackendsResolved(object *v1alpha1.CustomHTTPRoute, unresolved []string) {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionTypeBackendsResolved,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: object.Generation,
+		Reason:             controller.ConditionReasonBackendsResolved,
+		Message:            controller.ConditionReasonBackendsResolvedMessage,
+	}
+	if len(unresolved) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = controller.ConditionReasonBackendNotFound
+		condition.Message = strings.Join(unresolved, "; ")
+	}
+	meta.SetStatusCondition(&object.Status.Conditions, condition)
+}
+
 // ComputeCatchAllProgrammedStatus resolves the CatchAllProgrammed state for a route by listing
-// the routes and EPAs needed to decide dedup and overrides. Returns NotConfigured without
+// the routes, EPAs and HostnameSets needed to decide dedup and overrides. Returns NotConfigured without
 // any List call when the spec has no catchAllRoute.
 func (r *CustomHTTPRouteReconciler) ComputeCatchAllProgrammedStatus(
 	ctx context.Context,
@@ -125,13 +249,20 @@ func (r *CustomHTTPRouteReconciler) ComputeCatchAllProgrammedStatus(
 		}
 	}
 
-	return ef.EvaluateCatchAllProgrammed(route, routeList, epaList), nil
+	hostnameSets := &v1alpha1.HostnameSetList{}
+	if err := r.List(ctx, hostnameSets); err != nil {
+		return ef.CatchAllProgrammedStatus{}, fmt.Errorf("failed to list HostnameSets: %w", err)
+	}
+
+	return ef.EvaluateCatchAllProgrammed(route, routeList, epaList, hostnameSets), nil
 }
 
 func catchAllMessageFor(reason string) string {
 	switch reason {
 	case controller.ConditionReasonCatchAllProgrammed:
 		return controller.ConditionReasonCatchAllProgrammedMessage
+	case controller.ConditionReasonCatchAllTLSPassthrough:
+		return controller.ConditionReasonCatchAllTLSPassthroughMessage
 	case controller.ConditionReasonCatchAllNotConfigured:
 		return controller.ConditionReasonCatchAllNotConfiguredMessage
 	case controller.ConditionReasonCatchAllNoEPA:
@@ -55,7 +55,7 @@ func newEPAWithCatchAll(name string, hostnames []string) v1alpha1.ExternalProces
 
 func TestEvaluateCatchAllProgrammed_NotConfigured(t *testing.T) {
 	route := &v1alpha1.CustomHTTPRoute{}
-	got := ef.EvaluateCatchAllProgrammed(route, &v1alpha1.CustomHTTPRouteList{}, &v1alpha1.ExternalProcessorAttachmentList{})
+	got := ef.EvaluateCatchAllProgrammed(route, &v1alpha1.CustomHTTPRouteList{}, &v1alpha1.ExternalProcessorAttachmentList{}, nil)
 	if got.Programmed || got.Reason != controller.ConditionReasonCatchAllNotConfigured {
 		t.Errorf("expected NotConfigured, got %+v", got)
 	}
@@ -64,7 +64,7 @@ func TestEvaluateCatchAllProgrammed_NotConfigured(t *testing.T) {
 func TestEvaluateCatchAllProgrammed_NoEPA(t *testing.T) {
 	route := newRouteWithCatchAll("r", []string{"a.com"})
 	routeList := &v1alpha1.CustomHTTPRouteList{Items: []v1alpha1.CustomHTTPRoute{route}}
-	got := ef.EvaluateCatchAllProgrammed(&route, routeList, &v1alpha1.ExternalProcessorAttachmentList{})
+	got := ef.EvaluateCatchAllProgrammed(&route, routeList, &v1alpha1.ExternalProcessorAttachmentList{}, nil)
 	if got.Programmed || got.Reason != controller.ConditionReasonCatchAllNoEPA {
 		t.Errorf("expected NoExternalProcessor, got %+v", got)
 	}
@@ -76,7 +76,7 @@ func TestEvaluateCatchAllProgrammed_Programmed(t *testing.T) {
 	epa := v1alpha1.ExternalProcessorAttachment{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "epa"}}
 	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{epa}}
 
-	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList)
+	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList, nil)
 	if !got.Programmed || got.Reason != controller.ConditionReasonCatchAllProgrammed {
 		t.Fatalf("expected Programmed, got %+v", got)
 	}
@@ -85,13 +85,26 @@ func TestEvaluateCatchAllProgrammed_Programmed(t *testing.T) {
 	}
 }
 
+func TestEvaluateCatchAllProgrammed_TLSPassthrough(t *testing.T) {
+	route := newRouteWithCatchAll("r", []string{"a.com"})
+	route.Spec.CatchAllRoute.ListenerProtocol = v1alpha1.ListenerProtocolTLSPassthrough
+	routeList := &v1alpha1.CustomHTTPRouteList{Items: []v1alpha1.CustomHTTPRoute{route}}
+	epa := v1alpha1.ExternalProcessorAttachment{ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: "epa"}}
+	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{epa}}
+
+	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList, nil)
+	if !got.Programmed || got.Reason != controller.ConditionReasonCatchAllTLSPassthrough {
+		t.Errorf("expected ProgrammedTLSPassthrough, got %+v", got)
+	}
+}
+
 func TestEvaluateCatchAllProgrammed_OverriddenByEPA(t *testing.T) {
 	route := newRouteWithCatchAll("r", []string{"a.com"})
 	routeList := &v1alpha1.CustomHTTPRouteList{Items: []v1alpha1.CustomHTTPRoute{route}}
 	epa := newEPAWithCatchAll("epa", []string{"a.com"})
 	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{epa}}
 
-	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList)
+	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList, nil)
 	if got.Programmed || got.Reason != controller.ConditionReasonCatchAllOverriddenByEPA {
 		t.Errorf("expected OverriddenByEPA, got %+v", got)
 	}
@@ -104,12 +117,12 @@ func TestEvaluateCatchAllProgrammed_OverriddenByRoute(t *testing.T) {
 	epa := v1alpha1.ExternalProcessorAttachment{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "epa"}}
 	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{epa}}
 
-	got := ef.EvaluateCatchAllProgrammed(&loser, routeList, epaList)
+	got := ef.EvaluateCatchAllProgrammed(&loser, routeList, epaList, nil)
 	if got.Programmed || got.Reason != controller.ConditionReasonCatchAllOverriddenByRoute {
 		t.Errorf("expected OverriddenByRoute for loser, got %+v", got)
 	}
 
-	gotWinner := ef.EvaluateCatchAllProgrammed(&winner, routeList, epaList)
+	gotWinner := ef.EvaluateCatchAllProgrammed(&winner, routeList, epaList, nil)
 	if !gotWinner.Programmed || gotWinner.Reason != controller.ConditionReasonCatchAllProgrammed {
 		t.Errorf("expected Programmed for winner, got %+v", gotWinner)
 	}
@@ -123,7 +136,7 @@ func TestEvaluateCatchAllProgrammed_OverrideOnSomeEPAsStillProgrammed(t *testing
 	epa2 := v1alpha1.ExternalProcessorAttachment{ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: "epa-2"}}
 	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{epa1, epa2}}
 
-	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList)
+	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList, nil)
 	if !got.Programmed || got.Reason != controller.ConditionReasonCatchAllProgrammed {
 		t.Errorf("expected Programmed because EPA-2 carries the route, got %+v", got)
 	}
@@ -136,7 +149,7 @@ func TestEvaluateCatchAllProgrammed_OverrideOnAllEPAsIsOverridden(t *testing.T)
 	epa2 := newEPAWithCatchAll("epa-2", []string{"a.com"})
 	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{epa1, epa2}}
 
-	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList)
+	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList, nil)
 	if got.Programmed || got.Reason != controller.ConditionReasonCatchAllOverriddenByEPA {
 		t.Errorf("expected OverriddenByEPA when every EPA overrides, got %+v", got)
 	}
@@ -150,7 +163,7 @@ func TestEvaluateCatchAllProgrammed_MixedLossesFavorEPAReason(t *testing.T) {
 	epa := newEPAWithCatchAll("epa", []string{"b.com"})
 	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{epa}}
 
-	got := ef.EvaluateCatchAllProgrammed(&loser, routeList, epaList)
+	got := ef.EvaluateCatchAllProgrammed(&loser, routeList, epaList, nil)
 	if got.Programmed || got.Reason != controller.ConditionReasonCatchAllOverriddenByEPA {
 		t.Errorf("expected OverriddenByEPA with mixed losses, got %+v", got)
 	}
@@ -196,6 +209,7 @@ func TestUpdateConditionCatchAllProgrammed_TrueAndFalse(t *testing.T) {
 func TestCatchAllMessageFor_AllReasons(t *testing.T) {
 	cases := map[string]string{
 		controller.ConditionReasonCatchAllProgrammed:        controller.ConditionReasonCatchAllProgrammedMessage,
+		controller.ConditionReasonCatchAllTLSPassthrough:    controller.ConditionReasonCatchAllTLSPassthroughMessage,
 		controller.ConditionReasonCatchAllNotConfigured:     controller.ConditionReasonCatchAllNotConfiguredMessage,
 		controller.ConditionReasonCatchAllNoEPA:             controller.ConditionReasonCatchAllNoEPAMessage,
 		controller.ConditionReasonCatchAllOverriddenByEPA:   controller.ConditionReasonCatchAllOverriddenByEPAMessage,
@@ -210,3 +224,23 @@ func TestCatchAllMessageFor_AllReasons(t *testing.T) {
 		t.Errorf("unknown reason should return empty string, got %q", got)
 	}
 }
+
+func TestEvaluateCatchAllProgrammed_OverriddenByEPAHostnameSet(t *testing.T) {
+	route := newRouteWithCatchAll("r", []string{"a.com"})
+	routeList := &v1alpha1.CustomHTTPRouteList{Items: []v1alpha1.CustomHTTPRoute{route}}
+	epa := newEPAWithCatchAll("epa", nil)
+	epa.Spec.CatchAllRoute.HostnameSetSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"group": "web"}}
+	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{epa}}
+	hostnameSets := &v1alpha1.HostnameSetList{Items: []v1alpha1.HostnameSet{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: "web", Labels: map[string]string{"group": "web"}},
+		Spec:       v1alpha1.HostnameSetSpec{Hostnames: []string{"a.com"}},
+	}}}
+
+	if got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList, nil); !got.Programmed {
+		t.Errorf("expected Programmed without the HostnameSet, got %+v", got)
+	}
+	got := ef.EvaluateCatchAllProgrammed(&route, routeList, epaList, hostnameSets)
+	if got.Programmed || got.Reason != controller.ConditionReasonCatchAllOverriddenByEPA {
+		t.Errorf("expected OverriddenByEPA, got %+v", got)
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package customhttproute
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -41,6 +42,7 @@ import (
 
 	"github.com/freepik-company/customrouter/api/v1alpha1"
 	"github.com/freepik-company/customrouter/internal/controller"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
 	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
@@ -67,7 +69,9 @@ const (
 	// lastTargetAnnotation tracks the previous targetRef to clean up stale ConfigMaps on target changes
 	lastTargetAnnotation = "customrouter.freepik.com/last-target"
 
-	// hadCatchAllAnnotation tracks whether the route previously had catchAllRoute configured
+	// hadCatchAllAnnotation used to track whether the route previously had
+	// catchAllRoute configured. The catch-all EnvoyFilter is now owned by the
+	// ExternalProcessorAttachment controller, so the annotation is removed.
 	hadCatchAllAnnotation = "customrouter.freepik.com/had-catch-all"
 
 	// hadMirrorAnnotation tracks whether the route previously had a request-mirror action
@@ -76,6 +80,17 @@ const (
 	// hadCORSAnnotation tracks whether the route previously had a cors action
 	hadCORSAnnotation = "customrouter.freepik.com/had-cors"
 
+	// hadProtocolHintsAnnotation tracks whether the route previously had a rule with protocolHints
+	hadProtocolHintsAnnotation = "customrouter.freepik.com/had-protocol-hints"
+
+	// routesCountAnnotation is the number of routes in a route ConfigMap. The
+	// sum across the ConfigMaps of a target is the target's route usage.
+	routesCountAnnotation = "customrouter.freepik.com/routes"
+
+	// routeBudgetAnnotation is the route budget of the ConfigMap's target
+	// (--max-routes-per-target). It is absent when the budget is unlimited.
+	routeBudgetAnnotation = "customrouter.freepik.com/route-budget"
+
 	// annotationValueTrue is the canonical string value for boolean true annotations
 	annotationValueTrue = "true"
 )
@@ -111,12 +126,12 @@ func (r *CustomHTTPRouteReconciler) ReconcileObject(
 	}
 
 	// Snapshot current annotation state BEFORE any modifications. These are
-	// used below to detect whether catch-all / mirror / CORS axes were
+	// used below to detect whether mirror / CORS / protocol hint axes were
 	// previously active and therefore need reconciliation even when the
 	// current spec no longer declares them.
-	hadCatchAll := resourceManifest.Annotations[hadCatchAllAnnotation] == annotationValueTrue
 	hadMirror := resourceManifest.Annotations[hadMirrorAnnotation] == annotationValueTrue
 	hadCORS := resourceManifest.Annotations[hadCORSAnnotation] == annotationValueTrue
+	hadProtocolHints := resourceManifest.Annotations[hadProtocolHintsAnnotation] == annotationValueTrue
 
 	// If the target changed, clean up the old target first. It goes through the
 	// same single-flight + cooldown path as the current target (rebuildTarget),
@@ -125,7 +140,14 @@ func (r *CustomHTTPRouteReconciler) ReconcileObject(
 	// before it is added to the new target below; if the old target is busy or
 	// in cooldown we requeue without touching the new target, so the route is
 	// never briefly present on both.
-	if previousTarget, ok := resourceManifest.Annotations[lastTargetAnnotation]; ok && previousTarget != target {
+	//
+	// A previous target owned by another shard is rebuilt by that shard
+	// instead (see releaseMovedRoute); until it hands the route over, the
+	// last-target annotation is left pointing at it.
+	annotationTarget := target
+	if r.handoverPending(resourceManifest) {
+		annotationTarget = resourceManifest.Annotations[lastTargetAnnotation]
+	} else if previousTarget, ok := resourceManifest.Annotations[lastTargetAnnotation]; ok && previousTarget != target {
 		logger.Info("Target changed, also rebuilding previous target",
 			"name", resourceManifest.Name,
 			"previousTarget", previousTarget,
@@ -158,24 +180,24 @@ func (r *CustomHTTPRouteReconciler) ReconcileObject(
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil, nil, nil
 	}
 
-	// Reconcile catch-all / mirror / CORS EnvoyFilters when any axis is
+	// Reconcile mirror / CORS / protocol EnvoyFilters when any axis is
 	// active or was previously active for this route. To avoid listing
 	// CustomHTTPRoutes and ExternalProcessorAttachments three separate
 	// times (once per axis), list them once here and pass them into each
 	// reconciler. On a controller resync against a large catalogue this
 	// removes 4 redundant API/cache reads (2 axes × 2 list types) per
 	// reconcile, on top of the writes already saved by the cooldown.
-	hasCatchAll := resourceManifest.Spec.CatchAllRoute != nil
 	hasMirror := routeHasMirrorAction(resourceManifest)
 	hasCORS := routeHasCORSAction(resourceManifest)
-	needCatchAll := hasCatchAll || eventType == watch.Deleted || hadCatchAll
 	needMirror := hasMirror || eventType == watch.Deleted || hadMirror
 	needCORS := hasCORS || eventType == watch.Deleted || hadCORS
+	hasProtocolHints := routeHasProtocolHints(resourceManifest)
+	needProtocolHints := hasProtocolHints || eventType == watch.Deleted || hadProtocolHints
 
 	var routeList *v1alpha1.CustomHTTPRouteList
 	var epaList *v1alpha1.ExternalProcessorAttachmentList
 
-	if needCatchAll || needMirror || needCORS {
+	if needMirror || needCORS || needProtocolHints {
 		routeList = &v1alpha1.CustomHTTPRouteList{}
 		if err := r.List(ctx, routeList); err != nil {
 			return ctrl.Result{}, nil, nil, fmt.Errorf("failed to list CustomHTTPRoutes for envoyfilter reconciliation: %w", err)
@@ -185,11 +207,6 @@ func (r *CustomHTTPRouteReconciler) ReconcileObject(
 			return ctrl.Result{}, nil, nil, fmt.Errorf("failed to list ExternalProcessorAttachments for envoyfilter reconciliation: %w", err)
 		}
 
-		if needCatchAll {
-			if err := r.reconcileCatchAllFromRoutes(ctx, routeList, epaList); err != nil {
-				return ctrl.Result{}, nil, nil, fmt.Errorf("failed to reconcile catch-all routes: %w", err)
-			}
-		}
 		if needMirror {
 			if err := r.reconcileMirrorFromRoutes(ctx, routeList, epaList); err != nil {
 				return ctrl.Result{}, nil, nil, fmt.Errorf("failed to reconcile mirror routes: %w", err)
@@ -200,6 +217,11 @@ func (r *CustomHTTPRouteReconciler) ReconcileObject(
 				return ctrl.Result{}, nil, nil, fmt.Errorf("failed to reconcile cors routes: %w", err)
 			}
 		}
+		if needProtocolHints {
+			if err := r.reconcileProtocolHintsFromRoutes(ctx, routeList, epaList); err != nil {
+				return ctrl.Result{}, nil, nil, fmt.Errorf("failed to reconcile protocol-hinted routes: %w", err)
+			}
+		}
 	}
 
 	// Batch-update all tracking annotations in a single API call to minimise
@@ -207,7 +229,8 @@ func (r *CustomHTTPRouteReconciler) ReconcileObject(
 	// Previously each annotation was updated separately, triggering up to 4
 	// additional reconcile cycles per route change.
 	if eventType != watch.Deleted {
-		if err := r.ensureAnnotations(ctx, resourceManifest, target, hasCatchAll, hasMirror, hasCORS); err != nil {
+		expansion := r.routeExpansionSummary(target, client.ObjectKeyFromObject(resourceManifest))
+		if err := r.ensureAnnotations(ctx, resourceManifest, annotationTarget, hasMirror, hasCORS, hasProtocolHints, expansion); err != nil {
 			return ctrl.Result{}, nil, nil, fmt.Errorf("failed to update tracking annotations: %w", err)
 		}
 	}
@@ -255,7 +278,9 @@ func (r *CustomHTTPRouteReconciler) drainSiblingsForDeletion(
 		if s.UID == selfUID {
 			continue
 		}
-		if s.DeletionTimestamp.IsZero() {
+		// A sibling with a drain period removes its own finalizer once the
+		// period is over; until then its routes stay in the table.
+		if s.DeletionTimestamp.IsZero() || s.Spec.DeletionDrainSeconds > 0 {
 			continue
 		}
 		if !controllerutil.ContainsFinalizer(s, controller.ResourceFinalizer) {
@@ -282,7 +307,7 @@ func (r *CustomHTTPRouteReconciler) drainSiblingsForDeletion(
 
 // routeHasCORSAction returns true if any rule in the route declares a cors action.
 func routeHasCORSAction(cr *v1alpha1.CustomHTTPRoute) bool {
-	for _, rule := range cr.Spec.Rules {
+	for _, rule := range cr.Spec.ActiveRules() {
 		for _, a := range rule.Actions {
 			if a.Type == v1alpha1.ActionTypeCORS {
 				return true
@@ -292,10 +317,22 @@ func routeHasCORSAction(cr *v1alpha1.CustomHTTPRoute) bool {
 	return false
 }
 
+// routeHasProtocolHints returns true if any rule in the route sets
+// protocolHints or hashPolicy, or any backendRef sets a protocol, all
+// rendered in the protocol EnvoyFilter.
+func routeHasProtocolHints(cr *v1alpha1.CustomHTTPRoute) bool {
+	for _, rule := range cr.Spec.Rules {
+		if rule.ProtocolHints != "" || rule.HashPolicy != nil {
+			return true
+		}
+	}
+	return ef.HasBackendProtocols(cr)
+}
+
 // routeHasMirrorAction returns true if any rule in the route declares a
 // request-mirror action. Kept package-local for use in the reconcile trigger.
 func routeHasMirrorAction(cr *v1alpha1.CustomHTTPRoute) bool {
-	for _, rule := range cr.Spec.Rules {
+	for _, rule := range cr.Spec.ActiveRules() {
 		for _, a := range rule.Actions {
 			if a.Type == v1alpha1.ActionTypeRequestMirror {
 				return true
@@ -306,16 +343,18 @@ func routeHasMirrorAction(cr *v1alpha1.CustomHTTPRoute) bool {
 }
 
 // ensureAnnotations batch-updates all tracking annotations (last-target,
-// had-catch-all, had-mirror, had-cors) in a single API call. This replaces
+// had-mirror, had-cors, had-protocol-hints) and the expansion annotations in
+// a single API call, dropping the legacy had-catch-all one. This replaces
 // the previous per-annotation Update calls that each triggered a new
 // reconcile via the controller watch, multiplying etcd writes.
 func (r *CustomHTTPRouteReconciler) ensureAnnotations(
 	ctx context.Context,
 	resource *v1alpha1.CustomHTTPRoute,
 	target string,
-	hasCatchAll, hasMirror, hasCORS bool,
+	hasMirror, hasCORS, hasProtocolHints bool,
+	expansion *expansionSummary,
 ) error {
-	if annotationsUpToDate(resource.Annotations, target, hasCatchAll, hasMirror, hasCORS) {
+	if annotationsUpToDate(resource.Annotations, target, hasMirror, hasCORS, hasProtocolHints, expansion) {
 		return nil
 	}
 
@@ -323,25 +362,34 @@ func (r *CustomHTTPRouteReconciler) ensureAnnotations(
 		resource.Annotations = make(map[string]string)
 	}
 	resource.Annotations[lastTargetAnnotation] = target
-	setBoolAnnotation(resource.Annotations, hadCatchAllAnnotation, hasCatchAll)
+	delete(resource.Annotations, hadCatchAllAnnotation)
 	setBoolAnnotation(resource.Annotations, hadMirrorAnnotation, hasMirror)
 	setBoolAnnotation(resource.Annotations, hadCORSAnnotation, hasCORS)
+	setBoolAnnotation(resource.Annotations, hadProtocolHintsAnnotation, hasProtocolHints)
+	setExpansionAnnotations(resource.Annotations, expansion)
 
 	return r.Update(ctx, resource)
 }
 
 // annotationsUpToDate returns true when all tracking annotations already
 // reflect the desired state, so no Update call is needed.
-func annotationsUpToDate(ann map[string]string, target string, hasCatchAll, hasMirror, hasCORS bool) bool {
+func annotationsUpToDate(
+	ann map[string]string,
+	target string,
+	hasMirror, hasCORS, hasProtocolHints bool,
+	expansion *expansionSummary,
+) bool {
 	if ann == nil {
 		return false
 	}
 	if ann[lastTargetAnnotation] != target {
 		return false
 	}
-	return boolAnnotationCurrent(ann, hadCatchAllAnnotation, hasCatchAll) &&
+	return boolAnnotationCurrent(ann, hadCatchAllAnnotation, false) &&
 		boolAnnotationCurrent(ann, hadMirrorAnnotation, hasMirror) &&
-		boolAnnotationCurrent(ann, hadCORSAnnotation, hasCORS)
+		boolAnnotationCurrent(ann, hadCORSAnnotation, hasCORS) &&
+		boolAnnotationCurrent(ann, hadProtocolHintsAnnotation, hasProtocolHints) &&
+		expansionAnnotationsCurrent(ann, expansion)
 }
 
 // boolAnnotationCurrent checks if a boolean annotation matches the desired state.
@@ -366,6 +414,10 @@ func setBoolAnnotation(ann map[string]string, key string, value bool) {
 func (r *CustomHTTPRouteReconciler) rebuildConfigMapsForTarget(ctx context.Context, target string) error {
 	logger := log.FromContext(ctx)
 
+	if err := r.checkShardOwnership(ctx, target); err != nil {
+		return err
+	}
+
 	// List only CustomHTTPRoutes for this target using the field indexer
 	routeList := &v1alpha1.CustomHTTPRouteList{}
 	if err := r.List(ctx, routeList, client.MatchingFields{
@@ -374,15 +426,38 @@ func (r *CustomHTTPRouteReconciler) rebuildConfigMapsForTarget(ctx context.Conte
 		return fmt.Errorf("failed to list CustomHTTPRoutes for target %s: %w", target, err)
 	}
 
-	// Collect active (non-deleting) routes for this target
+	// Collect the routes for this target that are not being deleted, or
+	// still drain after their deletion (see DeletionDrainRemaining)
+	now := time.Now()
 	var targetRoutes []*v1alpha1.CustomHTTPRoute
 	for i := range routeList.Items {
 		route := &routeList.Items[i]
-		if route.DeletionTimestamp.IsZero() {
+		if route.DeletionTimestamp.IsZero() || route.DeletionDrainRemaining(now) > 0 {
 			targetRoutes = append(targetRoutes, route)
 		}
 	}
 
+	// Leave out the CustomHTTPRoutes whose namespace does not allow the
+	// target; their status reports it (see Reconcile).
+	targetRoutes, denied, err := r.filterNamespaceTargets(ctx, target, targetRoutes)
+	if err != nil {
+		return err
+	}
+	r.setTargetDenials(target, denied)
+	for key := range denied {
+		logger.Info("CustomHTTPRoute excluded from target: not allowed in its namespace",
+			"name", key.Name,
+			"namespace", key.Namespace,
+			"target", target)
+	}
+
+	// Give the routes the defaults of the CustomRouterConfigs selecting
+	// their namespace before anything reads their spec.
+	targetRoutes, inherited, err := r.inheritRouterConfigs(ctx, targetRoutes)
+	if err != nil {
+		return err
+	}
+
 	// Sort the routes deterministically by (namespace, name). The cache's
 	// field-indexer List returns items in a non-deterministic order (it
 	// iterates an internal map), so without this the per-host merge order of
@@ -399,17 +474,36 @@ func (r *CustomHTTPRouteReconciler) rebuildConfigMapsForTarget(ctx context.Conte
 		return targetRoutes[i].Name < targetRoutes[j].Name
 	})
 
+	seen := make(map[types.UID]bool, len(targetRoutes))
+	for _, route := range targetRoutes {
+		seen[route.UID] = true
+	}
+	r.expansions.prune(target, seen)
+
 	// Track active ConfigMap names for this target
 	activeNames := make(map[string]bool)
 
+	// config stays empty when the target has no routes left, which is what
+	// gets published to the routes bucket and the host files.
+	config := routes.MergeRoutesConfig()
+	var admitted []expandedRoute
+	var report *RoutingReport
+
 	if len(targetRoutes) > 0 {
 		// Pre-resolve ExternalName services for this target's routes
 		externalNames := r.resolveExternalNames(ctx, targetRoutes)
-
-		// Expand routes from all CustomHTTPRoutes for this target
-		allRoutes := make([]map[string][]routes.Route, 0, len(targetRoutes))
+		namesKey := externalNamesKey(externalNames)
+
+		// Expand routes from all CustomHTTPRoutes for this target, reusing
+		// the expansion of those whose spec did not change
+		expandedRoutes := make([]expandedRoute, 0, len(targetRoutes))
+		warnings := make(map[types.NamespacedName][]string)
+		var summaries map[types.NamespacedName]expansionSummary
+		if r.ExpansionAnnotations {
+			summaries = make(map[types.NamespacedName]expansionSummary, len(targetRoutes))
+		}
 		for _, route := range targetRoutes {
-			expanded, err := routes.ExpandRoutes(route, externalNames)
+			expanded, routeWarnings, err := r.expansions.expand(target, route, externalNames, namesKey, inherited[route.UID])
 			if err != nil {
 				logger.Error(err, "skipping CustomHTTPRoute due to route expansion limit",
 					"name", route.Name,
@@ -417,32 +511,111 @@ func (r *CustomHTTPRouteReconciler) rebuildConfigMapsForTarget(ctx context.Conte
 					"target", target)
 				continue
 			}
-			allRoutes = append(allRoutes, expanded)
+			key := types.NamespacedName{Namespace: route.Namespace, Name: route.Name}
+			for _, w := range routeWarnings {
+				warnings[key] = append(warnings[key], w.String())
+			}
+			if r.RoutesFormat.Version >= routes.FormatVersion2 {
+				routes.AssignRouteIdentity(expanded, route.Namespace+"/"+route.Name)
+				if r.OmitRouteSource {
+					routes.StripRouteSource(expanded)
+				}
+			}
+			if !route.DeletionTimestamp.IsZero() {
+				markDraining(expanded)
+			}
+			// Expired rules are pruned here rather than in the expansion,
+			// which is cached per generation; Reconcile requeues the route
+			// for its next expiry so the rebuild happens on time.
+			routes.PruneExpired(expanded, now)
+			count := 0
+			for _, hostRoutes := range expanded {
+				count += len(hostRoutes)
+			}
+			if summaries != nil {
+				summary, err := summarizeExpansion(expanded, count)
+				if err != nil {
+					return fmt.Errorf("failed to hash routes of CustomHTTPRoute %s: %w", key, err)
+				}
+				summaries[key] = summary
+			}
+			expandedRoutes = append(expandedRoutes, expandedRoute{route: route, hosts: expanded, routes: count})
+		}
+		r.setExpansionWarnings(target, warnings)
+		r.setExpansionSummaries(target, summaries)
+
+		// Leave out the CustomHTTPRoutes that do not fit in the target's
+		// route budget; their status reports it (see Reconcile).
+		var excluded map[types.NamespacedName]string
+		admitted, excluded = r.applyRouteBudget(target, expandedRoutes)
+		r.setRouteBudgetExclusions(ctx, target, excluded)
+		for key, reason := range excluded {
+			logger.Info("CustomHTTPRoute excluded from target: route budget exceeded",
+				"name", key.Name,
+				"namespace", key.Namespace,
+				"target", target,
+				"reason", reason)
+		}
+
+		// Find the routes that can never match before the merge sorts the
+		// admitted routes in place; their CustomHTTPRoutes' status reports
+		// them (see Reconcile).
+		var shadowed map[types.NamespacedName][]string
+		strategy := r.matchStrategy(target)
+		report, shadowed = buildRoutingReport(target, admitted, strategy)
+		r.setShadowedRoutes(target, shadowed)
+
+		allRoutes := make([]map[string][]routes.Route, 0, len(admitted))
+		for _, e := range admitted {
+			allRoutes = append(allRoutes, e.hosts)
 		}
 
 		// Merge all routes into a single config
-		config := routes.MergeRoutesConfig(allRoutes...)
+		config = routes.MergeRoutesConfig(allRoutes...)
+		config.ApplyMatchStrategy(strategy)
+		r.recordTargetRoutes(target, config.RouteCount(), len(excluded))
+		drainingCustomHTTPRoutes, drainingRoutes := 0, 0
+		for _, e := range admitted {
+			if !e.route.DeletionTimestamp.IsZero() {
+				drainingCustomHTTPRoutes++
+				drainingRoutes += e.routes
+			}
+		}
+		recordTargetDraining(target, drainingCustomHTTPRoutes, drainingRoutes)
 
 		// Partition the config into multiple ConfigMaps if needed
 		partitions, err := r.partitionConfig(target, config)
 		if err != nil {
 			return fmt.Errorf("failed to partition routes for target %s: %w", target, err)
 		}
+		recordTargetPartitions(target, config, partitions)
+
+		// Create or update the ConfigMaps for this target, unless it is
+		// only served through HTTPProxies; its ConfigMaps are then stale.
+		if r.writesConfigMaps(target) {
+			setPartitionGeneration(partitions)
+			if err := r.upsertConfigMaps(ctx, partitions); err != nil {
+				return fmt.Errorf("failed to upsert ConfigMaps for target %s: %w", target, err)
+			}
 
-		// Create or update the ConfigMaps for this target
-		if err := r.upsertConfigMaps(ctx, partitions); err != nil {
-			return fmt.Errorf("failed to upsert ConfigMaps for target %s: %w", target, err)
-		}
+			for _, p := range partitions {
+				activeNames[p.Name] = true
+			}
 
-		for _, p := range partitions {
-			activeNames[p.Name] = true
+			logger.Info("ConfigMaps updated successfully",
+				"target", target,
+				"namespace", r.ConfigMapNamespace,
+				"hostsCount", len(config.Hosts),
+				"partitions", len(partitions))
 		}
+	}
 
-		logger.Info("ConfigMaps updated successfully",
-			"target", target,
-			"namespace", r.ConfigMapNamespace,
-			"hostsCount", len(config.Hosts),
-			"partitions", len(partitions))
+	if err := r.syncHTTPProxies(ctx, target, admitted); err != nil {
+		return err
+	}
+
+	if err := r.syncHostnameAutomation(ctx, target, admitted); err != nil {
+		return err
 	}
 
 	// Delete stale ConfigMaps for this target
@@ -450,6 +623,22 @@ func (r *CustomHTTPRouteReconciler) rebuildConfigMapsForTarget(ctx context.Conte
 		return err
 	}
 
+	if err := r.publishRoutes(ctx, target, config); err != nil {
+		return err
+	}
+
+	if err := r.writeHostFiles(ctx, target, config); err != nil {
+		return err
+	}
+
+	if err := r.syncRoutingReport(ctx, target, report); err != nil {
+		return err
+	}
+
+	if err := r.syncPrometheusRule(ctx, target, len(targetRoutes) > 0); err != nil {
+		return err
+	}
+
 	// When all routes for this target have been removed, purge the
 	// in-memory cooldown and hash-cache entries so they don't accumulate
 	// as targets are created and deleted over the lifetime of the process.
@@ -469,21 +658,30 @@ func (r *CustomHTTPRouteReconciler) resolveExternalNames(
 	externalNames := make(map[string]string)
 	seen := make(map[string]bool)
 
+	resolve := func(ref v1alpha1.BackendRef) {
+		key := ref.Name + "/" + ref.Namespace
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		svc := &corev1.Service{}
+		if err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: ref.Namespace}, svc); err != nil {
+			return
+		}
+		if svc.Spec.Type == corev1.ServiceTypeExternalName {
+			externalNames[key] = svc.Spec.ExternalName
+		}
+	}
+
 	for _, route := range targetRoutes {
-		for _, rule := range route.Spec.Rules {
+		for _, rule := range route.Spec.ActiveRules() {
 			for _, ref := range rule.BackendRefs {
-				key := ref.Name + "/" + ref.Namespace
-				if seen[key] {
-					continue
-				}
-				seen[key] = true
-				svc := &corev1.Service{}
-				if err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: ref.Namespace}, svc); err != nil {
-					continue
-				}
-				if svc.Spec.Type == corev1.ServiceTypeExternalName {
-					externalNames[key] = svc.Spec.ExternalName
-				}
+				resolve(ref)
+			}
+		}
+		if route.Spec.OverrideHeader != nil {
+			for _, variant := range route.Spec.OverrideHeader.Variants {
+				resolve(variant.BackendRef)
 			}
 		}
 	}
@@ -495,23 +693,73 @@ func (r *CustomHTTPRouteReconciler) partitionConfig(
 	target string,
 	config *routes.RoutesConfig,
 ) ([]ConfigMapPartition, error) {
+	if r.PartitionStrategy == PartitionStrategyHostHash {
+		partitions, err := r.partitionByHostHash(target, config)
+		if err != nil {
+			return nil, err
+		}
+		return r.compressPartitions(partitions)
+	}
+
 	// Try single partition first
-	data, err := config.ToJSON()
+	data, err := r.encodeRoutes(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize routes for target %s: %w", target, err)
 	}
+	single := ConfigMapPartition{
+		Name:   r.partitionName(target, 0),
+		Target: target,
+		Data:   string(data),
+		Routes: config.RouteCount(),
+	}
 	if len(data) <= maxConfigMapSize {
-		return []ConfigMapPartition{
-			{
-				Name:   r.partitionName(target, 0),
-				Target: target,
-				Data:   string(data),
-			},
-		}, nil
+		return r.compressPartitions([]ConfigMapPartition{single})
+	}
+
+	// A document too large for one ConfigMap may still fit compressed,
+	// which postpones splitting the target.
+	if r.RoutesGzipThreshold > 0 {
+		compressed, err := routes.CompressRoutesDocument(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress routes for target %s: %w", target, err)
+		}
+		if len(compressed) <= maxConfigMapSize {
+			single.Compressed = compressed
+			return []ConfigMapPartition{single}, nil
+		}
 	}
 
 	// Need to split by hosts
-	return r.splitByHosts(target, config)
+	partitions, err := r.splitByHosts(target, config)
+	if err != nil {
+		return nil, err
+	}
+	return r.compressPartitions(partitions)
+}
+
+// compressPartitions gzips the partitions whose routes document exceeds
+// RoutesGzipThreshold, so they are written as binaryData.
+func (r *CustomHTTPRouteReconciler) compressPartitions(partitions []ConfigMapPartition) ([]ConfigMapPartition, error) {
+	if r.RoutesGzipThreshold <= 0 {
+		return partitions, nil
+	}
+	for i := range partitions {
+		p := &partitions[i]
+		if p.Compressed != nil || len(p.Data) <= r.RoutesGzipThreshold {
+			continue
+		}
+		compressed, err := routes.CompressRoutesDocument([]byte(p.Data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress partition %s: %w", p.Name, err)
+		}
+		p.Compressed = compressed
+	}
+	return partitions, nil
+}
+
+// encodeRoutes serializes a routes config in the configured wire format.
+func (r *CustomHTTPRouteReconciler) encodeRoutes(config *routes.RoutesConfig) ([]byte, error) {
+	return routes.EncodeRoutesConfig(config, r.RoutesFormat)
 }
 
 // ConfigMapPartition represents a single ConfigMap partition
@@ -519,6 +767,114 @@ type ConfigMapPartition struct {
 	Name   string
 	Target string
 	Data   string
+
+	// Compressed is Data gzip-compressed. When set, the ConfigMap stores it
+	// under the routes.CompressedRoutesDataKey binaryData key instead of
+	// Data under routesDataKey.
+	Compressed []byte
+
+	// Encrypted is Compressed, or Data when it is not set, sealed by
+	// routes.EncryptConfigMap. When set, the ConfigMap stores it under the
+	// routes.EncryptedRoutesDataKey binaryData key instead of both.
+	Encrypted []byte
+
+	// Routes is the number of routes in Data, published on the ConfigMap as
+	// the routesCountAnnotation.
+	Routes int
+
+	// Generation and Partitions are the generation of the target's route
+	// table and its number of partitions, published on every partition as
+	// the routes.GenerationAnnotation and routes.PartitionsAnnotation.
+	Generation string
+	Partitions int
+}
+
+// setPartitionGeneration stamps every partition of a target with the
+// generation of their route table and their count, so readers only load
+// the partitions once all of them are written.
+func setPartitionGeneration(partitions []ConfigMapPartition) {
+	names := make([]string, len(partitions))
+	documents := make([]string, len(partitions))
+	for i, p := range partitions {
+		names[i], documents[i] = p.Name, p.Data
+	}
+	generation := routes.RoutesGeneration(names, documents)
+	for i := range partitions {
+		partitions[i].Generation = generation
+		partitions[i].Partitions = len(partitions)
+	}
+}
+
+// Size is the number of bytes the partition stores in its ConfigMap.
+func (p ConfigMapPartition) Size() int {
+	if p.Encrypted != nil {
+		return len(p.Encrypted)
+	}
+	if p.Compressed != nil {
+		return len(p.Compressed)
+	}
+	return len(p.Data)
+}
+
+// configMapData returns the data and binaryData of the partition ConfigMap.
+func (p ConfigMapPartition) configMapData() (map[string]string, map[string][]byte) {
+	if p.Encrypted != nil {
+		return nil, map[string][]byte{routes.EncryptedRoutesDataKey: p.Encrypted}
+	}
+	if p.Compressed != nil {
+		return nil, map[string][]byte{routes.CompressedRoutesDataKey: p.Compressed}
+	}
+	return map[string]string{routesDataKey: p.Data}, nil
+}
+
+// storedIn reports whether cm already holds the routes of the partition,
+// in the same form.
+func (p ConfigMapPartition) storedIn(cm *corev1.ConfigMap) bool {
+	_, plain := cm.Data[routesDataKey]
+	_, compressed := cm.BinaryData[routes.CompressedRoutesDataKey]
+	_, encrypted := cm.BinaryData[routes.EncryptedRoutesDataKey]
+	switch {
+	case p.Encrypted != nil:
+		return !plain && !compressed && bytes.Equal(cm.BinaryData[routes.EncryptedRoutesDataKey], p.Encrypted)
+	case p.Compressed != nil:
+		return !plain && !encrypted && bytes.Equal(cm.BinaryData[routes.CompressedRoutesDataKey], p.Compressed)
+	}
+	return !compressed && !encrypted && cm.Data[routesDataKey] == p.Data
+}
+
+// encrypt seals the routes of the partition when its target's routes are
+// encrypted. The ConfigMap identity is part of the sealed data, so it runs
+// once the partition is named.
+func (r *CustomHTTPRouteReconciler) encrypt(p *ConfigMapPartition) error {
+	if r.RoutesEncryptionKey == nil || (r.RoutesEncryptionTargets != nil && !r.RoutesEncryptionTargets[p.Target]) {
+		return nil
+	}
+	document := p.Compressed
+	if document == nil {
+		document = []byte(p.Data)
+	}
+	sealed, err := routes.EncryptConfigMap(r.RoutesEncryptionKey, r.ConfigMapNamespace, p.Name, p.Target, document)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt partition %s: %w", p.Name, err)
+	}
+	p.Encrypted = sealed
+	return nil
+}
+
+// ParseRoutesEncryptionTargets parses the --routes-encryption-targets flag
+// value, a comma-separated list of targets. Empty returns nil: every target.
+func ParseRoutesEncryptionTargets(value string) map[string]bool {
+	var targets map[string]bool
+	for _, target := range strings.Split(value, ",") {
+		if target = strings.TrimSpace(target); target == "" {
+			continue
+		}
+		if targets == nil {
+			targets = make(map[string]bool)
+		}
+		targets[target] = true
+	}
+	return targets
 }
 
 // splitByHosts splits the config into multiple partitions, each containing a subset of hosts
@@ -526,6 +882,17 @@ func (r *CustomHTTPRouteReconciler) splitByHosts(
 	target string,
 	config *routes.RoutesConfig,
 ) ([]ConfigMapPartition, error) {
+	partitions, _, err := r.splitByHostsFrom(target, config, 0)
+	return partitions, err
+}
+
+// splitByHostsFrom is splitByHosts numbering the partitions from startIndex.
+// The second return value is the next free partition index.
+func (r *CustomHTTPRouteReconciler) splitByHostsFrom(
+	target string,
+	config *routes.RoutesConfig,
+	startIndex int,
+) ([]ConfigMapPartition, int, error) {
 	var partitions []ConfigMapPartition
 
 	// Sort hosts for deterministic ordering
@@ -540,7 +907,7 @@ func (r *CustomHTTPRouteReconciler) splitByHosts(
 		Hosts:   make(map[string][]routes.Route),
 	}
 	currentSize := 0
-	partIndex := 0
+	partIndex := startIndex
 
 	for _, host := range hosts {
 		hostRoutes := config.Hosts[host]
@@ -550,9 +917,9 @@ func (r *CustomHTTPRouteReconciler) splitByHosts(
 			Version: config.Version,
 			Hosts:   map[string][]routes.Route{host: hostRoutes},
 		}
-		hostData, err := hostConfig.ToJSON()
+		hostData, err := r.encodeRoutes(hostConfig)
 		if err != nil {
-			return nil, fmt.Errorf("failed to serialize host %s: %w", host, err)
+			return nil, startIndex, fmt.Errorf("failed to serialize host %s: %w", host, err)
 		}
 		hostSize := len(hostData)
 
@@ -560,14 +927,15 @@ func (r *CustomHTTPRouteReconciler) splitByHosts(
 		if hostSize > maxConfigMapSize {
 			// Flush current partition if not empty
 			if len(currentPartition.Hosts) > 0 {
-				partData, err := currentPartition.ToJSON()
+				partData, err := r.encodeRoutes(currentPartition)
 				if err != nil {
-					return nil, fmt.Errorf("failed to serialize partition %d: %w", partIndex, err)
+					return nil, startIndex, fmt.Errorf("failed to serialize partition %d: %w", partIndex, err)
 				}
 				partitions = append(partitions, ConfigMapPartition{
 					Name:   r.partitionName(target, partIndex),
 					Target: target,
 					Data:   string(partData),
+					Routes: currentPartition.RouteCount(),
 				})
 				partIndex++
 				currentPartition = &routes.RoutesConfig{
@@ -580,7 +948,7 @@ func (r *CustomHTTPRouteReconciler) splitByHosts(
 			// Split this host's routes across multiple partitions
 			hostPartitions, nextIndex, err := r.splitHostRoutes(target, host, hostRoutes, partIndex)
 			if err != nil {
-				return nil, err
+				return nil, startIndex, err
 			}
 			partitions = append(partitions, hostPartitions...)
 			partIndex = nextIndex
@@ -590,14 +958,15 @@ func (r *CustomHTTPRouteReconciler) splitByHosts(
 		// Check if adding this host would exceed the limit
 		if currentSize+hostSize > maxConfigMapSize && len(currentPartition.Hosts) > 0 {
 			// Flush current partition
-			partData, err := currentPartition.ToJSON()
+			partData, err := r.encodeRoutes(currentPartition)
 			if err != nil {
-				return nil, fmt.Errorf("failed to serialize partition %d: %w", partIndex, err)
+				return nil, startIndex, fmt.Errorf("failed to serialize partition %d: %w", partIndex, err)
 			}
 			partitions = append(partitions, ConfigMapPartition{
 				Name:   r.partitionName(target, partIndex),
 				Target: target,
 				Data:   string(partData),
+				Routes: currentPartition.RouteCount(),
 			})
 			partIndex++
 
@@ -616,18 +985,20 @@ func (r *CustomHTTPRouteReconciler) splitByHosts(
 
 	// Flush remaining partition
 	if len(currentPartition.Hosts) > 0 {
-		partData, err := currentPartition.ToJSON()
+		partData, err := r.encodeRoutes(currentPartition)
 		if err != nil {
-			return nil, fmt.Errorf("failed to serialize final partition %d: %w", partIndex, err)
+			return nil, startIndex, fmt.Errorf("failed to serialize final partition %d: %w", partIndex, err)
 		}
 		partitions = append(partitions, ConfigMapPartition{
 			Name:   r.partitionName(target, partIndex),
 			Target: target,
 			Data:   string(partData),
+			Routes: currentPartition.RouteCount(),
 		})
+		partIndex++
 	}
 
-	return partitions, nil
+	return partitions, partIndex, nil
 }
 
 // splitHostRoutes splits a single host's routes across multiple partitions.
@@ -670,7 +1041,14 @@ func (r *CustomHTTPRouteReconciler) splitHostRoutes(
 	// route mutation only modifies its own bucket's ConfigMap; bucketCount
 	// only grows (one-shot re-bucketing event) when total payload more than
 	// doubles since the last bucket-count step.
-	baseSize := len(fmt.Sprintf(`{"version":1,"hosts":{"%s":[]}}`, host))
+	baseData, err := r.encodeRoutes(&routes.RoutesConfig{
+		Version: 1,
+		Hosts:   map[string][]routes.Route{host: {}},
+	})
+	if err != nil {
+		return nil, startIndex, fmt.Errorf("failed to serialize host %s: %w", host, err)
+	}
+	baseSize := len(baseData)
 	usableSize := maxConfigMapSize - baseSize
 	if usableSize <= 0 {
 		usableSize = maxConfigMapSize
@@ -769,7 +1147,7 @@ func (r *CustomHTTPRouteReconciler) splitHostRoutes(
 			Version: 1,
 			Hosts:   map[string][]routes.Route{host: bucket},
 		}
-		partData, err := partConfig.ToJSON()
+		partData, err := r.encodeRoutes(partConfig)
 		if err != nil {
 			return nil, startIndex, fmt.Errorf("failed to serialize bucket %d for host %s: %w", bucketIdx, host, err)
 		}
@@ -777,6 +1155,7 @@ func (r *CustomHTTPRouteReconciler) splitHostRoutes(
 			Name:   r.partitionName(target, startIndex+bucketIdx),
 			Target: target,
 			Data:   string(partData),
+			Routes: len(bucket),
 		})
 	}
 	return partitions, startIndex + bucketCount, nil
@@ -850,6 +1229,9 @@ func (r routesByIdentity) Less(i, j int) bool {
 	if a.Method != b.Method {
 		return a.Method < b.Method
 	}
+	if a.Scheme != b.Scheme {
+		return a.Scheme < b.Scheme
+	}
 	if a.Backend != b.Backend {
 		return a.Backend < b.Backend
 	}
@@ -889,6 +1271,11 @@ func routeBucket(host string, route routes.Route, bucketCount uint32) uint32 {
 		_, _ = h.Write([]byte(qm.Type))
 		_, _ = h.Write([]byte{2})
 	}
+	// Only written when set, so routes without a scheme keep their bucket.
+	if route.Scheme != "" {
+		_, _ = h.Write([]byte(route.Scheme))
+		_, _ = h.Write([]byte{3})
+	}
 	return h.Sum32() % bucketCount
 }
 
@@ -949,11 +1336,15 @@ func (r *CustomHTTPRouteReconciler) upsertSingleConfigMap(
 	partition ConfigMapPartition,
 ) error {
 	// Fast-path: skip the entire Get+Compare cycle when the partition
-	// content has not changed since the last successful write.
-	dataHash := fnvHash(partition.Data)
+	// content and generation have not changed since the last successful
+	// write.
+	dataHash := fnvHash(partition.Data + "\x00" + partition.Generation)
 	if r.partitionHashHit(partition.Name, dataHash) {
 		return nil
 	}
+	if err := r.encrypt(&partition); err != nil {
+		return err
+	}
 
 	configMapKey := types.NamespacedName{
 		Name:      partition.Name,
@@ -972,6 +1363,25 @@ func (r *CustomHTTPRouteReconciler) upsertSingleConfigMap(
 		configMapPartLabel:       partNumber,
 	}
 
+	configMapAnnotations := map[string]string{
+		routesCountAnnotation:     strconv.Itoa(partition.Routes),
+		routes.ConsumerAnnotation: routes.ConsumerFlags(partition.Target, r.ConfigMapNamespace),
+	}
+	var partitions string
+	if partition.Generation != "" {
+		partitions = strconv.Itoa(partition.Partitions)
+		configMapAnnotations[routes.GenerationAnnotation] = partition.Generation
+		configMapAnnotations[routes.PartitionsAnnotation] = partitions
+	}
+	if r.MaxRoutesPerTarget > 0 {
+		configMapAnnotations[routeBudgetAnnotation] = strconv.Itoa(r.MaxRoutesPerTarget)
+	}
+	if r.RoutesSigningKey != nil {
+		configMapAnnotations[routes.SignatureAnnotation] = routes.SignConfigMap(r.RoutesSigningKey,
+			r.ConfigMapNamespace, partition.Name, partition.Target, partition.Generation, partitions, partition.Data)
+	}
+	r.shardLabels(configMapLabels, configMapAnnotations)
+
 	backoff := wait.Backoff{
 		Steps:    5,
 		Duration: 200 * time.Millisecond,
@@ -988,14 +1398,13 @@ func (r *CustomHTTPRouteReconciler) upsertSingleConfigMap(
 		if errors.IsNotFound(err) {
 			cm := &corev1.ConfigMap{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      partition.Name,
-					Namespace: r.ConfigMapNamespace,
-					Labels:    configMapLabels,
-				},
-				Data: map[string]string{
-					routesDataKey: partition.Data,
+					Name:        partition.Name,
+					Namespace:   r.ConfigMapNamespace,
+					Labels:      configMapLabels,
+					Annotations: configMapAnnotations,
 				},
 			}
+			cm.Data, cm.BinaryData = partition.configMapData()
 			return r.Create(ctx, cm)
 		}
 
@@ -1003,16 +1412,26 @@ func (r *CustomHTTPRouteReconciler) upsertSingleConfigMap(
 			return err
 		}
 
-		// Skip update if content and labels are already correct
-		if existingCM.Data[routesDataKey] == partition.Data &&
-			mapsEqual(existingCM.Labels, configMapLabels) {
+		// Skip update if content, labels and managed annotations are already correct
+		if partition.storedIn(existingCM) &&
+			mapsEqual(existingCM.Labels, configMapLabels) &&
+			managedAnnotationsEqual(existingCM.Annotations, configMapAnnotations) {
 			return nil
 		}
 
 		existingCM.Labels = configMapLabels
-		existingCM.Data = map[string]string{
-			routesDataKey: partition.Data,
+		if existingCM.Annotations == nil {
+			existingCM.Annotations = make(map[string]string)
+		}
+		delete(existingCM.Annotations, routeBudgetAnnotation)
+		delete(existingCM.Annotations, routes.SignatureAnnotation)
+		delete(existingCM.Annotations, routes.GenerationAnnotation)
+		delete(existingCM.Annotations, routes.PartitionsAnnotation)
+		delete(existingCM.Annotations, shardSelectorAnnotation)
+		for k, v := range configMapAnnotations {
+			existingCM.Annotations[k] = v
 		}
+		existingCM.Data, existingCM.BinaryData = partition.configMapData()
 		return r.Update(ctx, existingCM)
 	})
 
@@ -1070,6 +1489,23 @@ func mapsEqual(a, b map[string]string) bool {
 	return true
 }
 
+// managedAnnotationsEqual reports whether the route usage, signature and
+// generation annotations of a ConfigMap match want. Other annotations are
+// ignored.
+func managedAnnotationsEqual(existing, want map[string]string) bool {
+	for _, key := range []string{
+		routesCountAnnotation, routes.ConsumerAnnotation, routeBudgetAnnotation, routes.SignatureAnnotation,
+		routes.GenerationAnnotation, routes.PartitionsAnnotation, shardSelectorAnnotation,
+	} {
+		got, gotOK := existing[key]
+		value, wantOK := want[key]
+		if gotOK != wantOK || got != value {
+			return false
+		}
+	}
+	return true
+}
+
 // fnvHash returns the FNV-32a hash of a string.
 func fnvHash(s string) uint32 {
 	h := fnv.New32a()
@@ -18,16 +18,21 @@ package customhttproute
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"github.com/freepik-company/customrouter/api/v1alpha1"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
 	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
@@ -35,6 +40,7 @@ func newScheme() *runtime.Scheme {
 	s := runtime.NewScheme()
 	_ = v1alpha1.AddToScheme(s)
 	_ = corev1.AddToScheme(s)
+	_ = coordinationv1.AddToScheme(s)
 	return s
 }
 
@@ -104,6 +110,234 @@ func TestPartitionConfig_SinglePartition(t *testing.T) {
 	}
 }
 
+func TestRebuildConfigMapsForTarget_FormatV2(t *testing.T) {
+	route := &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "route-a", Namespace: "ns", UID: "uid-a"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{"a.example.com"},
+			TargetRef: v1alpha1.TargetRef{Name: "target-a"},
+			Rules: []v1alpha1.Rule{
+				{
+					BackendRefs: []v1alpha1.BackendRef{{Name: "svc", Namespace: "ns", Port: 80}},
+					Matches:     []v1alpha1.PathMatch{{Path: "/a", Type: "Exact"}},
+				},
+			},
+		},
+	}
+
+	r := newReconciler(route)
+	r.RoutesFormat = routes.EncodeOptions{Version: routes.FormatVersion2, Compress: true}
+
+	if err := r.rebuildConfigMapsForTarget(context.Background(), "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(context.Background(), types.NamespacedName{
+		Name: "customrouter-routes-target-a-0", Namespace: "test-ns",
+	}, cm); err != nil {
+		t.Fatalf("expected ConfigMap for target-a, got error: %v", err)
+	}
+
+	config, err := routes.DecodeRoutesConfig([]byte(cm.Data[routesDataKey]))
+	if err != nil {
+		t.Fatalf("failed to decode ConfigMap data: %v", err)
+	}
+	if config.Version != routes.FormatVersion2 {
+		t.Errorf("expected format version 2, got %d", config.Version)
+	}
+	hostRoutes := config.Hosts["a.example.com"]
+	if len(hostRoutes) != 1 {
+		t.Fatalf("expected 1 route, got %d", len(hostRoutes))
+	}
+	if hostRoutes[0].Source != "ns/route-a" || hostRoutes[0].ID == "" {
+		t.Errorf("expected route identity to be set, got id=%q source=%q", hostRoutes[0].ID, hostRoutes[0].Source)
+	}
+	if hostRoutes[0].SourceRule != "rules[0]" {
+		t.Errorf("expected source rule rules[0], got %q", hostRoutes[0].SourceRule)
+	}
+
+	r.OmitRouteSource = true
+	if err := r.rebuildConfigMapsForTarget(context.Background(), "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if err := r.Get(context.Background(), types.NamespacedName{
+		Name: "customrouter-routes-target-a-0", Namespace: "test-ns",
+	}, cm); err != nil {
+		t.Fatalf("expected ConfigMap for target-a, got error: %v", err)
+	}
+	config, err = routes.DecodeRoutesConfig([]byte(cm.Data[routesDataKey]))
+	if err != nil {
+		t.Fatalf("failed to decode ConfigMap data: %v", err)
+	}
+	omitted := config.Hosts["a.example.com"][0]
+	if omitted.Source != "" || omitted.SourceRule != "" || omitted.ID != hostRoutes[0].ID {
+		t.Errorf("expected only the route id with OmitRouteSource, got id=%q source=%q rule=%q",
+			omitted.ID, omitted.Source, omitted.SourceRule)
+	}
+}
+
+func TestPartitionConfig_GzipAvoidsSplit(t *testing.T) {
+	config := &routes.RoutesConfig{Version: 1, Hosts: map[string][]routes.Route{}}
+	for i := 0; i < 12000; i++ {
+		config.Hosts[fmt.Sprintf("host-%05d.example.com", i)] = []routes.Route{
+			{Path: "/api", Type: "prefix", Backend: "svc.ns.svc.cluster.local:80"},
+		}
+	}
+
+	r := &CustomHTTPRouteReconciler{ConfigMapNamespace: "ns"}
+	partitions, err := r.partitionConfig("default", config)
+	if err != nil {
+		t.Fatalf("partitionConfig returned error: %v", err)
+	}
+	if len(partitions) < 2 {
+		t.Fatalf("expected the uncompressed routes to be split, got %d partition", len(partitions))
+	}
+
+	r.RoutesGzipThreshold = 512 * 1024
+	partitions, err = r.partitionConfig("default", config)
+	if err != nil {
+		t.Fatalf("partitionConfig returned error: %v", err)
+	}
+	if len(partitions) != 1 || partitions[0].Compressed == nil {
+		t.Fatalf("expected a single compressed partition, got %d", len(partitions))
+	}
+	if size := partitions[0].Size(); size > maxConfigMapSize || size != len(partitions[0].Compressed) {
+		t.Errorf("Size() = %d, want the compressed size under %d", size, maxConfigMapSize)
+	}
+}
+
+func TestRebuildConfigMapsForTarget_GzipThreshold(t *testing.T) {
+	ctx := context.Background()
+	route := &v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "route-a", Namespace: "ns", UID: "uid-a"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{"a.example.com"},
+			TargetRef: v1alpha1.TargetRef{Name: "target-a"},
+			Rules: []v1alpha1.Rule{
+				{
+					BackendRefs: []v1alpha1.BackendRef{{Name: "svc", Namespace: "ns", Port: 80}},
+					Matches:     []v1alpha1.PathMatch{{Path: "/a", Type: "Exact"}},
+				},
+			},
+		},
+	}
+	key := types.NamespacedName{Name: "customrouter-routes-target-a-0", Namespace: "test-ns"}
+
+	r := newReconciler(route)
+	r.RoutesGzipThreshold = 1
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, key, cm); err != nil {
+		t.Fatalf("expected ConfigMap for target-a, got error: %v", err)
+	}
+	if len(cm.Data) != 0 {
+		t.Errorf("expected no plain routes data, got keys %v", cm.Data)
+	}
+	data, ok, err := routes.ConfigMapRoutesData(cm, nil)
+	if err != nil || !ok {
+		t.Fatalf("ConfigMapRoutesData() = %v, %v", ok, err)
+	}
+	config, err := routes.DecodeRoutesConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("failed to decode ConfigMap data: %v", err)
+	}
+	if len(config.Hosts["a.example.com"]) != 1 {
+		t.Errorf("expected 1 route for a.example.com, got %+v", config.Hosts)
+	}
+
+	// Disabling compression writes the plain key back and drops the
+	// compressed one.
+	r.RoutesGzipThreshold = 0
+	r.partitionHashes = nil
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if err := r.Get(ctx, key, cm); err != nil {
+		t.Fatalf("failed to get ConfigMap: %v", err)
+	}
+	if cm.Data[routesDataKey] != data || len(cm.BinaryData) != 0 {
+		t.Errorf("expected plain routes data only, got data %v and binaryData keys %d", cm.Data, len(cm.BinaryData))
+	}
+}
+
+func TestRebuildConfigMapsForTarget_Encryption(t *testing.T) {
+	ctx := context.Background()
+	newRoute := func(name, target string) *v1alpha1.CustomHTTPRoute {
+		return &v1alpha1.CustomHTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", UID: types.UID("uid-" + name)},
+			Spec: v1alpha1.CustomHTTPRouteSpec{
+				Hostnames: []string{name + ".example.com"},
+				TargetRef: v1alpha1.TargetRef{Name: target},
+				Rules: []v1alpha1.Rule{
+					{
+						BackendRefs: []v1alpha1.BackendRef{{Name: "svc", Namespace: "ns", Port: 80}},
+						Matches:     []v1alpha1.PathMatch{{Path: "/", Type: "PathPrefix"}},
+					},
+				},
+			},
+		}
+	}
+	encryptionKey := []byte("0123456789abcdef0123456789abcdef")
+
+	r := newReconciler(newRoute("a", "target-a"), newRoute("b", "target-b"))
+	r.RoutesEncryptionKey = encryptionKey
+	r.RoutesEncryptionTargets = ParseRoutesEncryptionTargets("target-a")
+	r.RoutesGzipThreshold = 1
+	for _, target := range []string{"target-a", "target-b"} {
+		if err := r.rebuildConfigMapsForTarget(ctx, target); err != nil {
+			t.Fatalf("rebuildConfigMapsForTarget(%s) failed: %v", target, err)
+		}
+	}
+
+	encrypted := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: "customrouter-routes-target-a-0", Namespace: "test-ns"}
+	if err := r.Get(ctx, key, encrypted); err != nil {
+		t.Fatalf("failed to get ConfigMap: %v", err)
+	}
+	if len(encrypted.Data) != 0 || len(encrypted.BinaryData) != 1 || encrypted.BinaryData[routes.EncryptedRoutesDataKey] == nil {
+		t.Fatalf("expected only encrypted routes, got data %v and binaryData %v", encrypted.Data, encrypted.BinaryData)
+	}
+	if _, _, err := routes.ConfigMapRoutesData(encrypted, nil); !errors.Is(err, routes.ErrRoutesEncrypted) {
+		t.Errorf("ConfigMapRoutesData() without a key error = %v, want ErrRoutesEncrypted", err)
+	}
+	data, ok, err := routes.ConfigMapRoutesData(encrypted, encryptionKey)
+	if err != nil || !ok {
+		t.Fatalf("ConfigMapRoutesData() = %v, %v", ok, err)
+	}
+	config, err := routes.DecodeRoutesConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("failed to decode ConfigMap data: %v", err)
+	}
+	if len(config.Hosts["a.example.com"]) != 1 {
+		t.Errorf("expected 1 route for a.example.com, got %+v", config.Hosts)
+	}
+
+	// The sealed routes are stable, so an unchanged target is not rewritten.
+	version := encrypted.ResourceVersion
+	r.partitionHashes = nil
+	if err := r.rebuildConfigMapsForTarget(ctx, "target-a"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	if err := r.Get(ctx, key, encrypted); err != nil {
+		t.Fatalf("failed to get ConfigMap: %v", err)
+	}
+	if encrypted.ResourceVersion != version {
+		t.Errorf("unchanged encrypted ConfigMap was rewritten")
+	}
+
+	// Targets left out of RoutesEncryptionTargets stay readable without the key.
+	plain := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "customrouter-routes-target-b-0", Namespace: "test-ns"}, plain); err != nil {
+		t.Fatalf("failed to get ConfigMap: %v", err)
+	}
+	if _, encrypted := plain.BinaryData[routes.EncryptedRoutesDataKey]; encrypted {
+		t.Error("target-b is not listed in RoutesEncryptionTargets but was encrypted")
+	}
+}
+
 func TestRebuildConfigMapsForTarget_OnlyAffectsOwnTarget(t *testing.T) {
 	route1 := &v1alpha1.CustomHTTPRoute{
 		ObjectMeta: metav1.ObjectMeta{Name: "route-a", Namespace: "ns", UID: "uid-a"},
@@ -203,6 +437,13 @@ func TestRebuildConfigMapsForTarget_CleansStalePartitions(t *testing.T) {
 	}, cm0); err != nil {
 		t.Fatalf("expected partition 0 to exist: %v", err)
 	}
+	if cm0.Annotations[routes.GenerationAnnotation] == "" || cm0.Annotations[routes.PartitionsAnnotation] != "1" {
+		t.Errorf("annotations = %v, want a generation of 1 partition", cm0.Annotations)
+	}
+	if got, want := cm0.Annotations[routes.ConsumerAnnotation],
+		"--target-name=target-a --routes-configmap-namespace=test-ns"; got != want {
+		t.Errorf("consumer annotation = %q, want %q", got, want)
+	}
 
 	// Stale partition 1 should be deleted
 	cm1 := &corev1.ConfigMap{}
@@ -258,6 +499,10 @@ func TestUpsertSingleConfigMap_SkipsUnchanged(t *testing.T) {
 			Name:      "customrouter-routes-target-a-0",
 			Namespace: "test-ns",
 			Labels:    labels,
+			Annotations: map[string]string{
+				routesCountAnnotation:     "1",
+				routes.ConsumerAnnotation: routes.ConsumerFlags("target-a", "test-ns"),
+			},
 		},
 		Data: map[string]string{routesDataKey: data},
 	}
@@ -268,6 +513,7 @@ func TestUpsertSingleConfigMap_SkipsUnchanged(t *testing.T) {
 		Name:   "customrouter-routes-target-a-0",
 		Target: "target-a",
 		Data:   data,
+		Routes: 1,
 	}
 
 	// Should succeed without error (skip update)
@@ -311,6 +557,54 @@ func TestUpsertSingleConfigMap_CreatesNew(t *testing.T) {
 	}
 }
 
+func TestUpsertSingleConfigMap_SignsRoutes(t *testing.T) {
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "customrouter-routes-target-a-0", Namespace: "test-ns"}
+	r := newReconciler()
+	r.RoutesSigningKey = []byte("shared-secret")
+
+	partition := ConfigMapPartition{
+		Name:       key.Name,
+		Target:     "target-a",
+		Data:       `{"version":1,"hosts":{}}`,
+		Generation: "0123456789abcdef",
+		Partitions: 1,
+	}
+	if err := r.upsertSingleConfigMap(ctx, partition); err != nil {
+		t.Fatalf("upsertSingleConfigMap failed: %v", err)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, key, cm); err != nil {
+		t.Fatalf("expected ConfigMap to be created: %v", err)
+	}
+	if !routes.VerifyConfigMap(r.RoutesSigningKey, cm.Namespace, cm.Name, cm.Labels[configMapTargetLabel],
+		cm.Annotations[routes.GenerationAnnotation], cm.Annotations[routes.PartitionsAnnotation],
+		cm.Data[routesDataKey], cm.Annotations[routes.SignatureAnnotation]) {
+		t.Fatalf("signature %q does not verify", cm.Annotations[routes.SignatureAnnotation])
+	}
+	if routes.VerifyConfigMap(r.RoutesSigningKey, cm.Namespace, cm.Name, cm.Labels[configMapTargetLabel],
+		cm.Annotations[routes.GenerationAnnotation], "2",
+		cm.Data[routesDataKey], cm.Annotations[routes.SignatureAnnotation]) {
+		t.Error("signature verifies with another partitions annotation")
+	}
+
+	// A restart with a rotated key re-signs the ConfigMap even though the data
+	// is unchanged.
+	r.RoutesSigningKey = []byte("rotated-secret")
+	r.partitionHashes = nil
+	if err := r.upsertSingleConfigMap(ctx, partition); err != nil {
+		t.Fatalf("upsertSingleConfigMap failed: %v", err)
+	}
+	if err := r.Get(ctx, key, cm); err != nil {
+		t.Fatalf("failed to get ConfigMap: %v", err)
+	}
+	if !routes.VerifyConfigMap(r.RoutesSigningKey, cm.Namespace, cm.Name, cm.Labels[configMapTargetLabel],
+		cm.Annotations[routes.GenerationAnnotation], cm.Annotations[routes.PartitionsAnnotation],
+		cm.Data[routesDataKey], cm.Annotations[routes.SignatureAnnotation]) {
+		t.Error("ConfigMap was not re-signed with the rotated key")
+	}
+}
+
 func TestResolveExternalNames(t *testing.T) {
 	extSvc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{Name: "ext-svc", Namespace: "ns"},
@@ -401,3 +695,72 @@ func TestDeleteStaleConfigMapsForTarget_OnlyDeletesOwnTarget(t *testing.T) {
 		t.Errorf("target-b ConfigMap should still exist: %v", err)
 	}
 }
+
+func TestEnvoyFiltersSkipUnresolvedAttachments(t *testing.T) {
+	ctx := context.Background()
+	route := v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "ns"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"www.example.com"},
+			Rules: []v1alpha1.Rule{{
+				Matches: []v1alpha1.PathMatch{{Path: "/", Type: v1alpha1.MatchTypePathPrefix}},
+				Actions: []v1alpha1.Action{
+					{
+						Type:   v1alpha1.ActionTypeRequestMirror,
+						Mirror: &v1alpha1.MirrorConfig{BackendRef: v1alpha1.BackendRef{Name: "shadow", Namespace: "ns", Port: 80}},
+					},
+					{Type: v1alpha1.ActionTypeCORS, CORS: &v1alpha1.CORSConfig{AllowOrigins: []string{"https://example.com"}}},
+				},
+				BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "ns", Port: 80}},
+			}},
+		},
+	}
+	resolved := v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "resolved", Namespace: "istio-system"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: v1alpha1.GatewayRef{Selector: map[string]string{"istio": "ingressgateway"}},
+		},
+	}
+	// Names a Gateway whose workload selector the attachment controller
+	// has not recorded in the status yet.
+	unresolved := v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "unresolved", Namespace: "istio-system"},
+		Spec:       v1alpha1.ExternalProcessorAttachmentSpec{GatewayRef: v1alpha1.GatewayRef{Name: "public"}},
+	}
+
+	r := newReconciler()
+	r.Scheme.AddKnownTypeWithName(ef.GVK, &unstructured.Unstructured{})
+	r.Scheme.AddKnownTypeWithName(ef.GVK.GroupVersion().WithKind(ef.GVK.Kind+"List"), &unstructured.UnstructuredList{})
+	routeList := &v1alpha1.CustomHTTPRouteList{Items: []v1alpha1.CustomHTTPRoute{route}}
+	epaList := &v1alpha1.ExternalProcessorAttachmentList{Items: []v1alpha1.ExternalProcessorAttachment{unresolved, resolved}}
+
+	if err := r.reconcileMirrorFromRoutes(ctx, routeList, epaList); err != nil {
+		t.Fatalf("reconcileMirrorFromRoutes failed: %v", err)
+	}
+	if err := r.reconcileCORSFromRoutes(ctx, routeList, epaList); err != nil {
+		t.Fatalf("reconcileCORSFromRoutes failed: %v", err)
+	}
+
+	filters := &unstructured.UnstructuredList{}
+	filters.SetGroupVersionKind(ef.GVK.GroupVersion().WithKind(ef.GVK.Kind + "List"))
+	if err := r.List(ctx, filters); err != nil {
+		t.Fatalf("failed to list EnvoyFilters: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, item := range filters.Items {
+		names[item.GetName()] = true
+		labels, _, _ := unstructured.NestedStringMap(item.Object, "spec", "workloadSelector", "labels")
+		if len(labels) == 0 {
+			t.Errorf("EnvoyFilter %s selects every workload of its namespace", item.GetName())
+		}
+	}
+	for _, name := range []string{"resolved" + ef.MirrorFilterSuffix, "resolved" + ef.CORSFilterSuffix} {
+		if !names[name] {
+			t.Errorf("missing EnvoyFilter %s of the resolved attachment; got %v", name, names)
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("got EnvoyFilters %v, want none for the unresolved attachment", names)
+	}
+}
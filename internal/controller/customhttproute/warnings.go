@@ -0,0 +1,77 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// maxStatusWarnings caps status.warnings, so a route with many warnings does
+// not grow its object without bound.
+const maxStatusWarnings = 16
+
+// eventReasonExpansionWarning is the reason of the Events recorded for new
+// expansion warnings.
+const eventReasonExpansionWarning = "ExpansionWarning"
+
+// setExpansionWarnings records the warnings the last rebuild of target got
+// expanding its CustomHTTPRoutes, replacing the previous set.
+func (r *CustomHTTPRouteReconciler) setExpansionWarnings(target string, warnings map[types.NamespacedName][]string) {
+	r.warningsMu.Lock()
+	defer r.warningsMu.Unlock()
+	if len(warnings) == 0 {
+		delete(r.expansionWarnings, target)
+		return
+	}
+	if r.expansionWarnings == nil {
+		r.expansionWarnings = make(map[string]map[types.NamespacedName][]string)
+	}
+	r.expansionWarnings[target] = warnings
+}
+
+// routeExpansionWarnings returns the warnings the last rebuild of target got
+// expanding the given CustomHTTPRoute.
+func (r *CustomHTTPRouteReconciler) routeExpansionWarnings(target string, key types.NamespacedName) []string {
+	r.warningsMu.Lock()
+	defer r.warningsMu.Unlock()
+	return r.expansionWarnings[target][key]
+}
+
+// UpdateWarnings sets status.warnings from the route's expansion warnings
+// and records a Warning Event for each one the status did not list yet, so
+// they surface in kubectl describe as well.
+func (r *CustomHTTPRouteReconciler) UpdateWarnings(object *v1alpha1.CustomHTTPRoute, warnings []string) {
+	listed := warnings
+	if len(listed) > maxStatusWarnings {
+		listed = append(slices.Clone(listed[:maxStatusWarnings-1]),
+			fmt.Sprintf("and %d more", len(warnings)-maxStatusWarnings+1))
+	}
+	if r.Recorder != nil {
+		for _, w := range listed {
+			if !slices.Contains(object.Status.Warnings, w) {
+				r.Recorder.Event(object, corev1.EventTypeWarning, eventReasonExpansionWarning, w)
+			}
+		}
+	}
+	object.Status.Warnings = listed
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customhttproute
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestRebuildRecordsExpansionWarnings(t *testing.T) {
+	ctx := context.Background()
+	split := budgetRoute("split", time.Now(), "/a")
+	split.Spec.Rules[0].BackendRefs = append(split.Spec.Rules[0].BackendRefs,
+		v1alpha1.BackendRef{Name: "canary", Namespace: "ns", Port: 80})
+	plain := budgetRoute("plain", time.Now(), "/b")
+	r := newReconciler(split, plain)
+
+	if err := r.rebuildConfigMapsForTarget(ctx, "default"); err != nil {
+		t.Fatalf("rebuildConfigMapsForTarget failed: %v", err)
+	}
+	got := r.routeExpansionWarnings("default", types.NamespacedName{Namespace: "ns", Name: "split"})
+	if len(got) != 1 || !strings.HasPrefix(got[0], "rules[0].backendRefs: only the first of 2") {
+		t.Errorf("warnings of split = %v, want the ignored backendRef", got)
+	}
+	if got := r.routeExpansionWarnings("default", types.NamespacedName{Namespace: "ns", Name: "plain"}); len(got) != 0 {
+		t.Errorf("warnings of plain = %v, want none", got)
+	}
+}
+
+func TestUpdateWarnings(t *testing.T) {
+	recorder := record.NewFakeRecorder(maxStatusWarnings + 4)
+	r := &CustomHTTPRouteReconciler{Recorder: recorder}
+	route := &v1alpha1.CustomHTTPRoute{}
+
+	r.UpdateWarnings(route, []string{"a", "b"})
+	if len(route.Status.Warnings) != 2 || len(recorder.Events) != 2 {
+		t.Fatalf("warnings = %v with %d events, want 2 of each", route.Status.Warnings, len(recorder.Events))
+	}
+	if event := <-recorder.Events; event != "Warning ExpansionWarning a" {
+		t.Errorf("event = %q, want Warning ExpansionWarning a", event)
+	}
+	<-recorder.Events
+
+	// Warnings already on the status are not recorded again.
+	r.UpdateWarnings(route, []string{"b", "c"})
+	if len(recorder.Events) != 1 {
+		t.Fatalf("got %d events, want 1 for the new warning", len(recorder.Events))
+	}
+	<-recorder.Events
+
+	many := make([]string, maxStatusWarnings+3)
+	for i := range many {
+		many[i] = fmt.Sprintf("w%d", i)
+	}
+	r.UpdateWarnings(route, many)
+	if len(route.Status.Warnings) != maxStatusWarnings {
+		t.Fatalf("got %d warnings, want %d", len(route.Status.Warnings), maxStatusWarnings)
+	}
+	if last := route.Status.Warnings[maxStatusWarnings-1]; last != "and 4 more" {
+		t.Errorf("last warning = %q, want and 4 more", last)
+	}
+
+	r.UpdateWarnings(route, nil)
+	if route.Status.Warnings != nil {
+		t.Errorf("warnings = %v, want none", route.Status.Warnings)
+	}
+}
@@ -0,0 +1,638 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoyfilter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/internal/controller"
+)
+
+// DefaultCatchAllPorts are the listener ports against which HTTP_ROUTE INSERT_FIRST
+// patches are emitted when a hostname is already covered by an HTTPRoute. Patches
+// targeting a non-existing (hostname, port) virtual host are silently ignored by
+// Istio, so emitting both is safe.
+var DefaultCatchAllPorts = []int{80, 443}
+
+// CatchAllPassthroughPort is the Gateway port whose listener gets the filter chains
+// of TLS passthrough catch-all hostnames.
+const CatchAllPassthroughPort = 443
+
+// CatchAllEntry represents a hostname with its default backend for catch-all routing.
+type CatchAllEntry struct {
+	Hostname   string
+	BackendRef v1alpha1.BackendRef
+
+	// ExcludePaths are served ahead of the catch-all routes (see
+	// buildCatchAllExcludeRoute).
+	ExcludePaths []v1alpha1.CatchAllExcludePath
+
+	// ListenerProtocol is the protocol of the Gateway listener serving
+	// Hostname; empty means HTTP.
+	ListenerProtocol v1alpha1.ListenerProtocol
+}
+
+// ReconcileCatchAll renders the catch-all EnvoyFilter of epa (and its copies
+// for additional Gateways) from the catchAllRoute of epa and of the routes in
+// routeList, or deletes it when no hostname is left. The filter has a single
+// writer, the ExternalProcessorAttachment controller, so two reconcilers never
+// race over it. Returns the number of catch-all hostnames.
+func ReconcileCatchAll(
+	ctx context.Context,
+	cl client.Client,
+	epa *v1alpha1.ExternalProcessorAttachment,
+	routeList *v1alpha1.CustomHTTPRouteList,
+) (int, error) {
+	hostnameSets, err := ListCatchAllHostnameSets(ctx, cl, epa)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := CatchAllHostnames(epa, hostnameSets); err != nil {
+		return 0, err
+	}
+	entries := MergeCatchAllEntries(CollectCatchAllEntries(routeList), epa, hostnameSets)
+	if len(entries) == 0 {
+		key := types.NamespacedName{Name: epa.Name + CatchAllFilterSuffix, Namespace: epa.Namespace}
+		if err := DeleteEnvoyFilters(ctx, cl, key); err != nil {
+			return 0, fmt.Errorf("failed to delete catch-all EnvoyFilter: %w", err)
+		}
+		return 0, nil
+	}
+
+	hostnames := make([]string, 0, len(entries))
+	for _, e := range entries {
+		hostnames = append(hostnames, e.Hostname)
+	}
+	httpRouteList := &gatewayv1.HTTPRouteList{}
+	if err := cl.List(ctx, httpRouteList); err != nil {
+		return 0, fmt.Errorf("failed to list HTTPRoutes: %w", err)
+	}
+	hostnamesWithHTTPRoute := CollectHostnamesWithHTTPRoute(httpRouteList, hostnames)
+
+	envoyFilter, err := BuildCatchAllEnvoyFilter(epa, entries, hostnamesWithHTTPRoute)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build catch-all EnvoyFilter: %w", err)
+	}
+	if err := UpsertEnvoyFilters(ctx, cl, epa, envoyFilter); err != nil {
+		return 0, fmt.Errorf("failed to reconcile catch-all EnvoyFilter: %w", err)
+	}
+	return len(entries), nil
+}
+
+// CollectCatchAllEntries extracts catch-all entries from all CustomHTTPRoutes that declare catchAllRoute.
+// When multiple routes declare the same hostname, the first one in lexicographic order of
+// namespace/name wins, ensuring a deterministic result across reconciliations.
+func CollectCatchAllEntries(routeList *v1alpha1.CustomHTTPRouteList) []CatchAllEntry {
+	hostnameMap := make(map[string]CatchAllEntry)
+
+	ordered := orderedRoutesWithCatchAll(routeList)
+	for _, route := range ordered {
+		for _, hostname := range route.Spec.ServedHostnames() {
+			if _, exists := hostnameMap[hostname]; exists {
+				continue
+			}
+			hostnameMap[hostname] = CatchAllEntry{
+				Hostname:         hostname,
+				BackendRef:       route.Spec.CatchAllRoute.BackendRef,
+				ExcludePaths:     route.Spec.CatchAllRoute.ExcludePaths,
+				ListenerProtocol: route.Spec.CatchAllRoute.ListenerProtocol,
+			}
+		}
+	}
+
+	return sortedEntries(hostnameMap)
+}
+
+// orderedRoutesWithCatchAll returns non-deleting routes with a non-nil catchAllRoute,
+// sorted by "namespace/name" to provide a stable iteration order for dedup decisions.
+func orderedRoutesWithCatchAll(routeList *v1alpha1.CustomHTTPRouteList) []*v1alpha1.CustomHTTPRoute {
+	out := make([]*v1alpha1.CustomHTTPRoute, 0, len(routeList.Items))
+	for i := range routeList.Items {
+		route := &routeList.Items[i]
+		if route.DeletionTimestamp != nil && !route.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if route.Spec.CatchAllRoute == nil {
+			continue
+		}
+		out = append(out, route)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return routeKey(out[i]) < routeKey(out[j])
+	})
+	return out
+}
+
+func routeKey(route *v1alpha1.CustomHTTPRoute) string {
+	return route.Namespace + "/" + route.Name
+}
+
+// ListCatchAllHostnameSets lists the HostnameSets in the namespace of epa
+// when its catchAllRoute selects some, or returns nil.
+func ListCatchAllHostnameSets(
+	ctx context.Context,
+	cl client.Client,
+	epa *v1alpha1.ExternalProcessorAttachment,
+) (*v1alpha1.HostnameSetList, error) {
+	if epa.Spec.CatchAllRoute == nil || epa.Spec.CatchAllRoute.HostnameSetSelector == nil {
+		return nil, nil
+	}
+	hostnameSets := &v1alpha1.HostnameSetList{}
+	if err := cl.List(ctx, hostnameSets, client.InNamespace(epa.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list HostnameSets: %w", err)
+	}
+	return hostnameSets, nil
+}
+
+// CatchAllHostnames returns the hostnames of the catchAllRoute of epa: its
+// own hostnames plus those of the HostnameSets of hostnameSets in the
+// namespace of epa matching its hostnameSetSelector, without duplicates.
+// An invalid selector is reported along with the epa's own hostnames.
+func CatchAllHostnames(epa *v1alpha1.ExternalProcessorAttachment, hostnameSets *v1alpha1.HostnameSetList) ([]string, error) {
+	catchAll := epa.Spec.CatchAllRoute
+	if catchAll == nil {
+		return nil, nil
+	}
+	hostnames := slices.Clone(catchAll.Hostnames)
+	if catchAll.HostnameSetSelector == nil || hostnameSets == nil {
+		return hostnames, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(catchAll.HostnameSetSelector)
+	if err != nil {
+		return hostnames, fmt.Errorf("invalid catchAllRoute.hostnameSetSelector: %w", err)
+	}
+	seen := make(map[string]bool, len(hostnames))
+	for _, h := range hostnames {
+		seen[h] = true
+	}
+	for i := range hostnameSets.Items {
+		set := &hostnameSets.Items[i]
+		if set.Namespace != epa.Namespace || !selector.Matches(labels.Set(set.Labels)) {
+			continue
+		}
+		for _, h := range set.Spec.Hostnames {
+			if !seen[h] {
+				seen[h] = true
+				hostnames = append(hostnames, h)
+			}
+		}
+	}
+	return hostnames, nil
+}
+
+// MergeCatchAllEntries merges entries from CustomHTTPRoutes with the EPA's own catchAllRoute config,
+// whose hostnames include those of the selected sets of hostnameSets (see CatchAllHostnames).
+// EPA entries take precedence (override) for the same hostname, excludePaths
+// and listenerProtocol included.
+func MergeCatchAllEntries(
+	routeEntries []CatchAllEntry,
+	epa *v1alpha1.ExternalProcessorAttachment,
+	hostnameSets *v1alpha1.HostnameSetList,
+) []CatchAllEntry {
+	merged := make(map[string]CatchAllEntry, len(routeEntries))
+
+	for _, entry := range routeEntries {
+		merged[entry.Hostname] = entry
+	}
+
+	if epa.Spec.CatchAllRoute != nil {
+		hostnames, _ := CatchAllHostnames(epa, hostnameSets)
+		for _, hostname := range hostnames {
+			merged[hostname] = CatchAllEntry{
+				Hostname:         hostname,
+				BackendRef:       epa.Spec.CatchAllRoute.BackendRef,
+				ExcludePaths:     epa.Spec.CatchAllRoute.ExcludePaths,
+				ListenerProtocol: epa.Spec.CatchAllRoute.ListenerProtocol,
+			}
+		}
+	}
+
+	return sortedEntries(merged)
+}
+
+// CollectHostnamesWithHTTPRoute returns the subset of the given hostnames that are
+// also declared in any existing HTTPRoute. This drives per-hostname selection between
+// "ADD a virtual host" (no HTTPRoute exists) and "inject into the existing virtual host"
+// (HTTPRoute exists and already owns the domain).
+func CollectHostnamesWithHTTPRoute(httpRouteList *gatewayv1.HTTPRouteList, hostnames []string) map[string]bool {
+	out := map[string]bool{}
+	if httpRouteList == nil || len(hostnames) == 0 {
+		return out
+	}
+	target := make(map[string]struct{}, len(hostnames))
+	for _, h := range hostnames {
+		target[h] = struct{}{}
+	}
+	for i := range httpRouteList.Items {
+		hr := &httpRouteList.Items[i]
+		for _, h := range hr.Spec.Hostnames {
+			if _, ok := target[string(h)]; ok {
+				out[string(h)] = true
+			}
+		}
+	}
+	return out
+}
+
+// BuildCatchAllEnvoyFilter builds the catch-all EnvoyFilter unstructured object.
+// For each hostname the emitted patch depends on whether an HTTPRoute already owns
+// the domain (see hostnamesWithHTTPRoute): if yes, HTTP_ROUTE INSERT_FIRST patches
+// inject the fallback into the existing virtual host (avoids Envoy's "Duplicate entry
+// of domain" error); otherwise the legacy VIRTUAL_HOST ADD creates a new virtual host.
+func BuildCatchAllEnvoyFilter(
+	epa *v1alpha1.ExternalProcessorAttachment,
+	entries []CatchAllEntry,
+	hostnamesWithHTTPRoute map[string]bool,
+) (*unstructured.Unstructured, error) {
+	filterName := epa.Name + CatchAllFilterSuffix
+
+	ef := &unstructured.Unstructured{}
+	ef.SetGroupVersionKind(GVK)
+	ef.SetName(filterName)
+	ef.SetNamespace(epa.Namespace)
+	ef.SetLabels(StandardLabels(epa.Name))
+	ef.SetOwnerReferences([]metav1.OwnerReference{NewOwnerReference(epa)})
+
+	selectorInterface := SelectorToInterface(epa.WorkloadSelector())
+
+	configPatches := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		for _, patch := range buildCatchAllPatches(epa, entry, hostnamesWithHTTPRoute[entry.Hostname]) {
+			configPatches = append(configPatches, patch)
+		}
+	}
+
+	spec := map[string]interface{}{
+		"workloadSelector": map[string]interface{}{
+			"labels": selectorInterface,
+		},
+		"configPatches": configPatches,
+	}
+
+	if err := unstructured.SetNestedField(ef.Object, spec, "spec"); err != nil {
+		return nil, fmt.Errorf("failed to set spec: %w", err)
+	}
+
+	return ef, nil
+}
+
+// buildCatchAllPatches returns the config patches for one hostname. When no HTTPRoute
+// owns the domain, one VIRTUAL_HOST ADD is returned. When an HTTPRoute already owns
+// the domain, one HTTP_ROUTE INSERT_FIRST per port in DefaultCatchAllPorts is returned
+// — Envoy would reject a second virtual host with the same domain, so the fallback is
+// injected into the existing one instead.
+//
+// Excluded paths are part of the added virtual host, or inserted before the injected
+// fallback with one HTTP_ROUTE INSERT_BEFORE per path and port.
+//
+// TLS passthrough hostnames never reach the HTTP connection manager and get a single
+// FILTER_CHAIN ADD instead (see buildCatchAllPassthroughPatch).
+func buildCatchAllPatches(epa *v1alpha1.ExternalProcessorAttachment, entry CatchAllEntry, hostnameHasHTTPRoute bool) []map[string]interface{} {
+	if entry.ListenerProtocol == v1alpha1.ListenerProtocolTLSPassthrough {
+		return []map[string]interface{}{buildCatchAllPassthroughPatch(epa, entry)}
+	}
+	if !hostnameHasHTTPRoute {
+		return []map[string]interface{}{buildCatchAllVirtualHostPatch(epa, entry)}
+	}
+	patches := make([]map[string]interface{}, 0, len(DefaultCatchAllPorts)*(1+len(entry.ExcludePaths)))
+	for _, port := range DefaultCatchAllPorts {
+		patches = append(patches, buildCatchAllHTTPRoutePatch(epa, entry, port))
+		for i := range entry.ExcludePaths {
+			patches = append(patches, buildCatchAllExcludePatch(epa, entry, &entry.ExcludePaths[i], port))
+		}
+	}
+	return patches
+}
+
+// buildCatchAllVirtualHostPatch builds the legacy VIRTUAL_HOST ADD patch, creating a
+// new virtual host with the excluded paths, the header-gated dynamic route and the
+// default fallback, in that order.
+func buildCatchAllVirtualHostPatch(epa *v1alpha1.ExternalProcessorAttachment, entry CatchAllEntry) map[string]interface{} {
+	clusterName := RefClusterName(epa, entry.BackendRef)
+	timeout := GetRouteTimeout(epa)
+
+	dynamicRoute := map[string]interface{}{
+		"cluster_header": "x-customrouter-cluster",
+		"timeout":        timeout,
+	}
+	ApplyRetryPolicy(dynamicRoute, epa)
+
+	dynamicMatch := map[string]interface{}{
+		"prefix": "/",
+	}
+	ApplyRoutingDecisionMatch(dynamicMatch, epa)
+
+	vhostRoutes := make([]interface{}, 0, len(entry.ExcludePaths)+2)
+	for i := range entry.ExcludePaths {
+		vhostRoutes = append(vhostRoutes, buildCatchAllExcludeRoute(epa, entry, &entry.ExcludePaths[i]))
+	}
+	vhostRoutes = append(vhostRoutes,
+		map[string]interface{}{
+			"name":  "customrouter-dynamic-route",
+			"match": dynamicMatch,
+			"route": dynamicRoute,
+		},
+		map[string]interface{}{
+			"name": "default",
+			"match": map[string]interface{}{
+				"prefix": "/",
+			},
+			"route": map[string]interface{}{
+				"cluster": clusterName,
+				"timeout": timeout,
+			},
+		},
+	)
+
+	return map[string]interface{}{
+		"applyTo": "VIRTUAL_HOST",
+		"match": map[string]interface{}{
+			"context": "GATEWAY",
+		},
+		"patch": map[string]interface{}{
+			"operation": "ADD",
+			"value": map[string]interface{}{
+				"name":    fmt.Sprintf("customrouter-catchall-%s", entry.Hostname),
+				"domains": []interface{}{entry.Hostname},
+				"routes":  vhostRoutes,
+			},
+		},
+	}
+}
+
+// buildCatchAllHTTPRoutePatch injects only the default fallback route at the top of
+// the virtual host "<hostname>:<port>" (owned by the HTTPRoute). The header-gated
+// dynamic route is already injected into every virtual host by the <epa>-routes
+// EnvoyFilter, so duplicating it here would be redundant.
+func buildCatchAllHTTPRoutePatch(epa *v1alpha1.ExternalProcessorAttachment, entry CatchAllEntry, port int) map[string]interface{} {
+	clusterName := RefClusterName(epa, entry.BackendRef)
+
+	return map[string]interface{}{
+		"applyTo": "HTTP_ROUTE",
+		"match": map[string]interface{}{
+			"context": "GATEWAY",
+			"routeConfiguration": map[string]interface{}{
+				"vhost": map[string]interface{}{
+					"name": fmt.Sprintf("%s:%d", entry.Hostname, port),
+				},
+			},
+		},
+		"patch": map[string]interface{}{
+			"operation": "INSERT_FIRST",
+			"value": map[string]interface{}{
+				"name": catchAllRouteName(entry),
+				"match": map[string]interface{}{
+					"prefix": "/",
+				},
+				"route": map[string]interface{}{
+					"cluster": clusterName,
+					"timeout": GetRouteTimeout(epa),
+				},
+			},
+		},
+	}
+}
+
+// buildCatchAllExcludePatch inserts the route of an excluded path right before the
+// fallback buildCatchAllHTTPRoutePatch injects into "<hostname>:<port>".
+func buildCatchAllExcludePatch(
+	epa *v1alpha1.ExternalProcessorAttachment,
+	entry CatchAllEntry,
+	exclude *v1alpha1.CatchAllExcludePath,
+	port int,
+) map[string]interface{} {
+	return map[string]interface{}{
+		"applyTo": "HTTP_ROUTE",
+		"match": map[string]interface{}{
+			"context": "GATEWAY",
+			"routeConfiguration": map[string]interface{}{
+				"vhost": map[string]interface{}{
+					"name": fmt.Sprintf("%s:%d", entry.Hostname, port),
+					"route": map[string]interface{}{
+						"name": catchAllRouteName(entry),
+					},
+				},
+			},
+		},
+		"patch": map[string]interface{}{
+			"operation": "INSERT_BEFORE",
+			"value":     buildCatchAllExcludeRoute(epa, entry, exclude),
+		},
+	}
+}
+
+// buildCatchAllExcludeRoute returns the route serving an excluded path: a direct
+// 200 response, or for PassThrough the catch-all backend with the ext_proc filter
+// disabled, so neither the external processor nor the routes it produced see it.
+func buildCatchAllExcludeRoute(
+	epa *v1alpha1.ExternalProcessorAttachment,
+	entry CatchAllEntry,
+	exclude *v1alpha1.CatchAllExcludePath,
+) map[string]interface{} {
+	route := map[string]interface{}{
+		"name": fmt.Sprintf("customrouter-catchall-exclude-%s-%s", entry.Hostname, exclude.Path),
+		"match": map[string]interface{}{
+			"path": exclude.Path,
+		},
+	}
+	if exclude.Action == v1alpha1.CatchAllExcludePassThrough {
+		route["route"] = map[string]interface{}{
+			"cluster": RefClusterName(epa, entry.BackendRef),
+			"timeout": GetRouteTimeout(epa),
+		}
+		route["typed_per_filter_config"] = map[string]interface{}{
+			extProcFilterName: map[string]interface{}{
+				"@type":    extProcPerRouteTypeURL,
+				"disabled": true,
+			},
+		}
+		return route
+	}
+	route["direct_response"] = map[string]interface{}{
+		"status": int64(http.StatusOK),
+	}
+	return route
+}
+
+// buildCatchAllPassthroughPatch adds a filter chain to the CatchAllPassthroughPort
+// listener that proxies TLS connections whose SNI is the hostname, still encrypted,
+// to the catch-all backend. The external processor never sees these connections.
+func buildCatchAllPassthroughPatch(epa *v1alpha1.ExternalProcessorAttachment, entry CatchAllEntry) map[string]interface{} {
+	name := fmt.Sprintf("customrouter-catchall-%s", entry.Hostname)
+	return map[string]interface{}{
+		"applyTo": "FILTER_CHAIN",
+		"match": map[string]interface{}{
+			"context": "GATEWAY",
+			"listener": map[string]interface{}{
+				"portNumber": int64(CatchAllPassthroughPort),
+			},
+		},
+		"patch": map[string]interface{}{
+			"operation": "ADD",
+			"value": map[string]interface{}{
+				"name": name,
+				"filter_chain_match": map[string]interface{}{
+					"server_names": []interface{}{entry.Hostname},
+				},
+				"filters": []interface{}{
+					map[string]interface{}{
+						"name": "envoy.filters.network.tcp_proxy",
+						"typed_config": map[string]interface{}{
+							"@type":       tcpProxyTypeURL,
+							"stat_prefix": name,
+							"cluster":     RefClusterName(epa, entry.BackendRef),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// catchAllRouteName is the name of the fallback route injected for entry.
+func catchAllRouteName(entry CatchAllEntry) string {
+	return fmt.Sprintf("customrouter-catchall-%s", entry.Hostname)
+}
+
+// CatchAllProgrammedStatus describes whether a CustomHTTPRoute's catchAllRoute ends up
+// applied on at least one EPA's catch-all EnvoyFilter, and if not, which reason prevails.
+type CatchAllProgrammedStatus struct {
+	Programmed bool
+	Reason     string
+	Hostnames  []string // hostnames of the route that won both dedup and EPA override (when Programmed=true)
+}
+
+// EvaluateCatchAllProgrammed determines the programming state of a route's catchAllRoute.
+// hostnameSets holds the HostnameSets the EPAs may select, or nil.
+// The result's Reason is one of the ConditionReasonCatchAll* constants from the controller package.
+func EvaluateCatchAllProgrammed(
+	route *v1alpha1.CustomHTTPRoute,
+	routeList *v1alpha1.CustomHTTPRouteList,
+	epaList *v1alpha1.ExternalProcessorAttachmentList,
+	hostnameSets *v1alpha1.HostnameSetList,
+) CatchAllProgrammedStatus {
+	if route == nil || route.Spec.CatchAllRoute == nil {
+		return CatchAllProgrammedStatus{Reason: controller.ConditionReasonCatchAllNotConfigured}
+	}
+
+	if epaList == nil || len(epaList.Items) == 0 {
+		return CatchAllProgrammedStatus{Reason: controller.ConditionReasonCatchAllNoEPA}
+	}
+
+	selfKey := routeKey(route)
+	var wonHostnames []string
+	for _, hostname := range route.Spec.ServedHostnames() {
+		if winnerHostnameRoute(hostname, routeList) == selfKey {
+			wonHostnames = append(wonHostnames, hostname)
+		}
+	}
+
+	var programmed, lostByEPA []string
+	for _, hostname := range wonHostnames {
+		// A hostname is lost only if every EPA overrides it, because each EPA produces
+		// its own catch-all EnvoyFilter: the route's catch-all still reaches the dataplane
+		// through any EPA that does not declare the hostname in its own catchAllRoute.
+		if hostnameOverriddenByEveryEPA(hostname, epaList, hostnameSets) {
+			lostByEPA = append(lostByEPA, hostname)
+		} else {
+			programmed = append(programmed, hostname)
+		}
+	}
+
+	if len(programmed) > 0 {
+		reason := controller.ConditionReasonCatchAllProgrammed
+		if route.Spec.CatchAllRoute.ListenerProtocol == v1alpha1.ListenerProtocolTLSPassthrough {
+			reason = controller.ConditionReasonCatchAllTLSPassthrough
+		}
+		return CatchAllProgrammedStatus{
+			Programmed: true,
+			Reason:     reason,
+			Hostnames:  programmed,
+		}
+	}
+
+	if len(lostByEPA) > 0 {
+		return CatchAllProgrammedStatus{Reason: controller.ConditionReasonCatchAllOverriddenByEPA}
+	}
+	return CatchAllProgrammedStatus{Reason: controller.ConditionReasonCatchAllOverriddenByRoute}
+}
+
+// winnerHostnameRoute returns the namespace/name of the route that wins the dedup for hostname,
+// or "" if no route declares it. The winner is the first in lexicographic order of namespace/name.
+func winnerHostnameRoute(hostname string, routeList *v1alpha1.CustomHTTPRouteList) string {
+	if routeList == nil {
+		return ""
+	}
+	ordered := orderedRoutesWithCatchAll(routeList)
+	for _, r := range ordered {
+		for _, h := range r.Spec.ServedHostnames() {
+			if h == hostname {
+				return routeKey(r)
+			}
+		}
+	}
+	return ""
+}
+
+// hostnameOverriddenByEveryEPA reports whether every EPA declares hostname in its own
+// catchAllRoute hostnames, selected HostnameSets included. Returns false if any EPA has no
+// catchAllRoute or does not declare the hostname, because that EPA will carry the route's
+// catch-all through to the dataplane.
+func hostnameOverriddenByEveryEPA(
+	hostname string,
+	epaList *v1alpha1.ExternalProcessorAttachmentList,
+	hostnameSets *v1alpha1.HostnameSetList,
+) bool {
+	if epaList == nil || len(epaList.Items) == 0 {
+		return false
+	}
+	for i := range epaList.Items {
+		epa := &epaList.Items[i]
+		if epa.Spec.CatchAllRoute == nil {
+			return false
+		}
+		hostnames, _ := CatchAllHostnames(epa, hostnameSets)
+		if !slices.Contains(hostnames, hostname) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedEntries converts a hostname→CatchAllEntry map to a slice sorted by hostname.
+func sortedEntries(m map[string]CatchAllEntry) []CatchAllEntry {
+	entries := make([]CatchAllEntry, 0, len(m))
+	for _, entry := range m {
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Hostname < entries[j].Hostname
+	})
+	return entries
+}
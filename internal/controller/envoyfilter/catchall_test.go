@@ -0,0 +1,522 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoyfilter
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const (
+	hostACom  = "a.com"
+	svcEPASvc = "epa-svc"
+)
+
+func TestCollectCatchAllEntries_Empty(t *testing.T) {
+	routeList := &v1alpha1.CustomHTTPRouteList{}
+	entries := CollectCatchAllEntries(routeList)
+	if len(entries) != 0 {
+		t.Errorf("expected 0 entries, got %d", len(entries))
+	}
+}
+
+func TestCollectCatchAllEntries_NoCatchAll(t *testing.T) {
+	routeList := &v1alpha1.CustomHTTPRouteList{
+		Items: []v1alpha1.CustomHTTPRoute{
+			{
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{"example.com"},
+					Rules: []v1alpha1.Rule{
+						{Matches: []v1alpha1.PathMatch{{Path: "/"}}},
+					},
+				},
+			},
+		},
+	}
+	entries := CollectCatchAllEntries(routeList)
+	if len(entries) != 0 {
+		t.Errorf("expected 0 entries, got %d", len(entries))
+	}
+}
+
+func TestCollectCatchAllEntries_SingleRoute(t *testing.T) {
+	routeList := &v1alpha1.CustomHTTPRouteList{
+		Items: []v1alpha1.CustomHTTPRoute{
+			{
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{"example.com", "www.example.com"},
+					CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+						BackendRef: v1alpha1.BackendRef{
+							Name:      "web",
+							Namespace: "default",
+							Port:      80,
+						},
+					},
+					Rules: []v1alpha1.Rule{
+						{Matches: []v1alpha1.PathMatch{{Path: "/"}}},
+					},
+				},
+			},
+		},
+	}
+	entries := CollectCatchAllEntries(routeList)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Hostname != "example.com" {
+		t.Errorf("expected first hostname to be example.com, got %s", entries[0].Hostname)
+	}
+	if entries[1].Hostname != "www.example.com" {
+		t.Errorf("expected second hostname to be www.example.com, got %s", entries[1].Hostname)
+	}
+	if entries[0].BackendRef.Name != "web" {
+		t.Errorf("expected backendRef name to be web, got %s", entries[0].BackendRef.Name)
+	}
+}
+
+func TestCollectCatchAllEntries_MultipleRoutes(t *testing.T) {
+	routeList := &v1alpha1.CustomHTTPRouteList{
+		Items: []v1alpha1.CustomHTTPRoute{
+			{
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{hostACom},
+					CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+						BackendRef: v1alpha1.BackendRef{Name: "svc-a", Namespace: "ns-a", Port: 80},
+					},
+					Rules: []v1alpha1.Rule{
+						{Matches: []v1alpha1.PathMatch{{Path: "/"}}},
+					},
+				},
+			},
+			{
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{"b.com"},
+					CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+						BackendRef: v1alpha1.BackendRef{Name: "svc-b", Namespace: "ns-b", Port: 8080},
+					},
+					Rules: []v1alpha1.Rule{
+						{Matches: []v1alpha1.PathMatch{{Path: "/"}}},
+					},
+				},
+			},
+		},
+	}
+	entries := CollectCatchAllEntries(routeList)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Hostname != hostACom || entries[0].BackendRef.Name != "svc-a" {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Hostname != "b.com" || entries[1].BackendRef.Name != "svc-b" {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+}
+
+func TestCollectCatchAllEntries_SkipsDeleting(t *testing.T) {
+	now := metav1.NewTime(time.Now())
+	routeList := &v1alpha1.CustomHTTPRouteList{
+		Items: []v1alpha1.CustomHTTPRoute{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					DeletionTimestamp: &now,
+				},
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{"deleting.com"},
+					CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+						BackendRef: v1alpha1.BackendRef{Name: "svc", Namespace: "ns", Port: 80},
+					},
+					Rules: []v1alpha1.Rule{
+						{Matches: []v1alpha1.PathMatch{{Path: "/"}}},
+					},
+				},
+			},
+		},
+	}
+	entries := CollectCatchAllEntries(routeList)
+	if len(entries) != 0 {
+		t.Errorf("expected 0 entries (route being deleted), got %d", len(entries))
+	}
+}
+
+func TestCollectCatchAllEntries_DuplicateHostnameFirstNameWins(t *testing.T) {
+	routeList := &v1alpha1.CustomHTTPRouteList{
+		Items: []v1alpha1.CustomHTTPRoute{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "z-route"},
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{"example.com"},
+					CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+						BackendRef: v1alpha1.BackendRef{Name: "svc-1", Namespace: "ns", Port: 80},
+					},
+					Rules: []v1alpha1.Rule{
+						{Matches: []v1alpha1.PathMatch{{Path: "/"}}},
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "a-route"},
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{"example.com"},
+					CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+						BackendRef: v1alpha1.BackendRef{Name: "svc-2", Namespace: "ns", Port: 80},
+					},
+					Rules: []v1alpha1.Rule{
+						{Matches: []v1alpha1.PathMatch{{Path: "/"}}},
+					},
+				},
+			},
+		},
+	}
+	entries := CollectCatchAllEntries(routeList)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry (deduplicated), got %d", len(entries))
+	}
+	if entries[0].BackendRef.Name != "svc-2" {
+		t.Errorf("expected first-in-lex-order (a-route → svc-2) to win, got %s", entries[0].BackendRef.Name)
+	}
+}
+
+func TestMergeCatchAllEntries_OnlyRoutes(t *testing.T) {
+	routeEntries := []CatchAllEntry{
+		{Hostname: hostACom, BackendRef: v1alpha1.BackendRef{Name: "svc-a", Namespace: "ns", Port: 80}},
+	}
+	epa := &v1alpha1.ExternalProcessorAttachment{}
+
+	merged := MergeCatchAllEntries(routeEntries, epa, nil)
+	if len(merged) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(merged))
+	}
+	if merged[0].Hostname != hostACom {
+		t.Errorf("expected a.com, got %s", merged[0].Hostname)
+	}
+}
+
+func TestMergeCatchAllEntries_OnlyEPA(t *testing.T) {
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			CatchAllRoute: &v1alpha1.CatchAllRouteConfig{
+				Hostnames:  []string{"epa.com"},
+				BackendRef: v1alpha1.BackendRef{Name: svcEPASvc, Namespace: "ns", Port: 80},
+			},
+		},
+	}
+
+	merged := MergeCatchAllEntries(nil, epa, nil)
+	if len(merged) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(merged))
+	}
+	if merged[0].BackendRef.Name != svcEPASvc {
+		t.Errorf("expected epa-svc, got %s", merged[0].BackendRef.Name)
+	}
+}
+
+func TestMergeCatchAllEntries_EPAOverrides(t *testing.T) {
+	routeEntries := []CatchAllEntry{
+		{Hostname: "shared.com", BackendRef: v1alpha1.BackendRef{Name: "route-svc", Namespace: "ns", Port: 80}},
+		{Hostname: "route-only.com", BackendRef: v1alpha1.BackendRef{Name: "route-svc", Namespace: "ns", Port: 80}},
+	}
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			CatchAllRoute: &v1alpha1.CatchAllRouteConfig{
+				Hostnames:  []string{"shared.com", "epa-only.com"},
+				BackendRef: v1alpha1.BackendRef{Name: svcEPASvc, Namespace: "ns", Port: 80},
+			},
+		},
+	}
+
+	merged := MergeCatchAllEntries(routeEntries, epa, nil)
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(merged))
+	}
+
+	entryMap := make(map[string]string)
+	for _, e := range merged {
+		entryMap[e.Hostname] = e.BackendRef.Name
+	}
+
+	if entryMap["shared.com"] != svcEPASvc {
+		t.Errorf("EPA should override route for shared.com, got %s", entryMap["shared.com"])
+	}
+	if entryMap["route-only.com"] != "route-svc" {
+		t.Errorf("route-only.com should keep route backend, got %s", entryMap["route-only.com"])
+	}
+	if entryMap["epa-only.com"] != svcEPASvc {
+		t.Errorf("epa-only.com should have EPA backend, got %s", entryMap["epa-only.com"])
+	}
+}
+
+func TestMergeCatchAllEntries_EPAExcludePaths(t *testing.T) {
+	routeEntries := []CatchAllEntry{
+		{
+			Hostname:     "shared.com",
+			BackendRef:   v1alpha1.BackendRef{Name: "route-svc", Namespace: "ns", Port: 80},
+			ExcludePaths: []v1alpha1.CatchAllExcludePath{{Path: "/route-health"}},
+		},
+		{
+			Hostname:     "route-only.com",
+			BackendRef:   v1alpha1.BackendRef{Name: "route-svc", Namespace: "ns", Port: 80},
+			ExcludePaths: []v1alpha1.CatchAllExcludePath{{Path: "/route-health"}},
+		},
+	}
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			CatchAllRoute: &v1alpha1.CatchAllRouteConfig{
+				Hostnames:    []string{"shared.com"},
+				BackendRef:   v1alpha1.BackendRef{Name: svcEPASvc, Namespace: "ns", Port: 80},
+				ExcludePaths: []v1alpha1.CatchAllExcludePath{{Path: "/healthz"}},
+			},
+		},
+	}
+
+	merged := MergeCatchAllEntries(routeEntries, epa, nil)
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(merged))
+	}
+	for _, e := range merged {
+		want := "/route-health"
+		if e.Hostname == "shared.com" {
+			want = "/healthz"
+		}
+		if len(e.ExcludePaths) != 1 || e.ExcludePaths[0].Path != want {
+			t.Errorf("%s excludePaths = %v, want only %s", e.Hostname, e.ExcludePaths, want)
+		}
+	}
+}
+
+func TestMergeCatchAllEntries_Empty(t *testing.T) {
+	epa := &v1alpha1.ExternalProcessorAttachment{}
+	merged := MergeCatchAllEntries(nil, epa, nil)
+	if len(merged) != 0 {
+		t.Errorf("expected 0 entries, got %d", len(merged))
+	}
+}
+
+func TestMergeCatchAllEntries_Sorted(t *testing.T) {
+	routeEntries := []CatchAllEntry{
+		{Hostname: "z.com", BackendRef: v1alpha1.BackendRef{Name: "svc", Namespace: "ns", Port: 80}},
+		{Hostname: hostACom, BackendRef: v1alpha1.BackendRef{Name: "svc", Namespace: "ns", Port: 80}},
+		{Hostname: "m.com", BackendRef: v1alpha1.BackendRef{Name: "svc", Namespace: "ns", Port: 80}},
+	}
+	epa := &v1alpha1.ExternalProcessorAttachment{}
+
+	merged := MergeCatchAllEntries(routeEntries, epa, nil)
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(merged))
+	}
+	if merged[0].Hostname != hostACom || merged[1].Hostname != "m.com" || merged[2].Hostname != "z.com" {
+		t.Errorf("expected sorted order, got: %s, %s, %s", merged[0].Hostname, merged[1].Hostname, merged[2].Hostname)
+	}
+}
+
+func TestBuildClusterName(t *testing.T) {
+	tests := []struct {
+		ref  v1alpha1.BackendRef
+		want string
+	}{
+		{v1alpha1.BackendRef{Name: "svc", Namespace: "ns", Port: 80}, "outbound|80||svc.ns.svc.cluster.local"},
+		{v1alpha1.BackendRef{Name: "api.example.com", Namespace: "ns", Port: 443}, "outbound|443||api.example.com"},
+	}
+	for _, tt := range tests {
+		if got := BuildClusterName(tt.ref); got != tt.want {
+			t.Errorf("BuildClusterName(%+v) = %q, want %q", tt.ref, got, tt.want)
+		}
+		// The processor names the cluster of a route backend the same way.
+		if got := BackendClusterName(routes.BackendAddress(tt.ref)); got != tt.want {
+			t.Errorf("BackendClusterName(%+v) = %q, want %q", tt.ref, got, tt.want)
+		}
+		if got := RefClusterName(&v1alpha1.ExternalProcessorAttachment{}, tt.ref); got != tt.want {
+			t.Errorf("RefClusterName(%+v) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+
+	epa := &v1alpha1.ExternalProcessorAttachment{Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+		ClusterName: &v1alpha1.ClusterNameConfig{Template: "{service}.{namespace}.{domain}:{port}", Domain: "mesh"},
+	}}
+	ref := v1alpha1.BackendRef{Name: "svc", Namespace: "ns", Port: 80}
+	if got := RefClusterName(epa, ref); got != "svc.ns.mesh:80" {
+		t.Errorf("RefClusterName() with a template = %q, want svc.ns.mesh:80", got)
+	}
+}
+
+func TestReconcileCatchAll(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(GVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(GVK.GroupVersion().WithKind(GVK.Kind+"List"), &unstructured.UnstructuredList{})
+	if err := gatewayv1.Install(scheme); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	applies := 0
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Apply: func(ctx context.Context, c client.WithWatch, obj runtime.ApplyConfiguration, opts ...client.ApplyOption) error {
+			applies++
+			return c.Apply(ctx, obj, opts...)
+		},
+	}).Build()
+	ctx := context.Background()
+
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "epa", Namespace: "istio-system"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: v1alpha1.GatewayRef{Selector: map[string]string{"istio": "public"}},
+		},
+	}
+	routeList := &v1alpha1.CustomHTTPRouteList{Items: []v1alpha1.CustomHTTPRoute{{
+		ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: "default"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{hostACom},
+			CatchAllRoute: &v1alpha1.CatchAllBackendRef{
+				BackendRef: v1alpha1.BackendRef{Name: "svc", Namespace: "default", Port: 80},
+			},
+		},
+	}}}
+	key := types.NamespacedName{Name: "epa" + CatchAllFilterSuffix, Namespace: "istio-system"}
+	exists := func() bool {
+		envoyFilter := &unstructured.Unstructured{}
+		envoyFilter.SetGroupVersionKind(GVK)
+		return cl.Get(ctx, key, envoyFilter) == nil
+	}
+
+	for i := 0; i < 2; i++ {
+		n, err := ReconcileCatchAll(ctx, cl, epa, routeList)
+		if err != nil {
+			t.Fatalf("ReconcileCatchAll: %v", err)
+		}
+		if n != 1 || !exists() {
+			t.Fatalf("pass %d: got %d hostnames, exists=%v, want 1 hostname and the EnvoyFilter", i, n, exists())
+		}
+	}
+	if applies != 1 {
+		t.Errorf("the catch-all EnvoyFilter was applied %d times, want once: an unchanged one is not written", applies)
+	}
+
+	if _, err := ReconcileCatchAll(ctx, cl, epa, &v1alpha1.CustomHTTPRouteList{}); err != nil {
+		t.Fatalf("ReconcileCatchAll: %v", err)
+	}
+	if exists() {
+		t.Error("catch-all EnvoyFilter without hostnames was not deleted")
+	}
+}
+
+func newHostnameSet(namespace, name string, labels map[string]string, hostnames ...string) v1alpha1.HostnameSet {
+	return v1alpha1.HostnameSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Spec:       v1alpha1.HostnameSetSpec{Hostnames: hostnames},
+	}
+}
+
+func TestCatchAllHostnames(t *testing.T) {
+	countries := map[string]string{"group": "countries"}
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "epa", Namespace: "istio-system"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			CatchAllRoute: &v1alpha1.CatchAllRouteConfig{
+				Hostnames:           []string{hostACom},
+				HostnameSetSelector: &metav1.LabelSelector{MatchLabels: countries},
+			},
+		},
+	}
+	hostnameSets := &v1alpha1.HostnameSetList{Items: []v1alpha1.HostnameSet{
+		newHostnameSet("istio-system", "europe", countries, "example.es", hostACom, "*.example.fr"),
+		newHostnameSet("istio-system", "other", map[string]string{"group": "other"}, "other.com"),
+		newHostnameSet("default", "elsewhere", countries, "elsewhere.com"),
+	}}
+
+	got, err := CatchAllHostnames(epa, hostnameSets)
+	if err != nil {
+		t.Fatalf("CatchAllHostnames: %v", err)
+	}
+	want := []string{hostACom, "example.es", "*.example.fr"}
+	if !slices.Equal(got, want) {
+		t.Errorf("CatchAllHostnames() = %v, want %v", got, want)
+	}
+
+	merged := MergeCatchAllEntries(nil, epa, hostnameSets)
+	if len(merged) != 3 || merged[0].Hostname != "*.example.fr" {
+		t.Errorf("MergeCatchAllEntries() = %+v, want the 3 hostnames sorted", merged)
+	}
+
+	epa.Spec.CatchAllRoute.HostnameSetSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "group", Operator: "Bogus"},
+	}}
+	got, err = CatchAllHostnames(epa, hostnameSets)
+	if err == nil {
+		t.Error("expected an error for an invalid selector")
+	}
+	if !slices.Equal(got, []string{hostACom}) {
+		t.Errorf("CatchAllHostnames() with an invalid selector = %v, want the own hostnames", got)
+	}
+}
+
+func TestReconcileCatchAllHostnameSets(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(GVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(GVK.GroupVersion().WithKind(GVK.Kind+"List"), &unstructured.UnstructuredList{})
+	if err := gatewayv1.Install(scheme); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	set := newHostnameSet("istio-system", "countries", map[string]string{"group": "countries"}, "*.example.com", "example.es")
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&set).Build()
+	ctx := context.Background()
+
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "epa", Namespace: "istio-system"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: v1alpha1.GatewayRef{Selector: map[string]string{"istio": "public"}},
+			CatchAllRoute: &v1alpha1.CatchAllRouteConfig{
+				HostnameSetSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"group": "countries"}},
+				BackendRef:          v1alpha1.BackendRef{Name: "svc", Namespace: "default", Port: 80},
+			},
+		},
+	}
+	n, err := ReconcileCatchAll(ctx, cl, epa, &v1alpha1.CustomHTTPRouteList{})
+	if err != nil {
+		t.Fatalf("ReconcileCatchAll: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("got %d catch-all hostnames, want 2", n)
+	}
+
+	envoyFilter := &unstructured.Unstructured{}
+	envoyFilter.SetGroupVersionKind(GVK)
+	key := types.NamespacedName{Name: "epa" + CatchAllFilterSuffix, Namespace: "istio-system"}
+	if err := cl.Get(ctx, key, envoyFilter); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	patches, _, _ := unstructured.NestedSlice(envoyFilter.Object, "spec", "configPatches")
+	domains, _, _ := unstructured.NestedStringSlice(patches[0].(map[string]interface{}), "patch", "value", "domains")
+	if !slices.Equal(domains, []string{"*.example.com"}) {
+		t.Errorf("first virtual host domains = %v, want the wildcard", domains)
+	}
+}
@@ -115,7 +115,7 @@ func CollectCORSEntries(routeList *v1alpha1.CustomHTTPRouteList) []CORSEntry {
 // hasCORSAction is a cheap pre-filter that skips ExpandRoutes when no CORS
 // action is declared anywhere in the resource.
 func hasCORSAction(cr *v1alpha1.CustomHTTPRoute) bool {
-	for _, rule := range cr.Spec.Rules {
+	for _, rule := range cr.Spec.ActiveRules() {
 		for _, a := range rule.Actions {
 			if a.Type == v1alpha1.ActionTypeCORS {
 				return true
@@ -144,7 +144,7 @@ func BuildCORSEnvoyFilter(
 	ef.SetLabels(StandardLabels(epa.Name))
 	ef.SetOwnerReferences([]metav1.OwnerReference{NewOwnerReference(epa)})
 
-	selectorInterface := SelectorToInterface(epa.Spec.GatewayRef.Selector)
+	selectorInterface := SelectorToInterface(epa.WorkloadSelector())
 
 	configPatches := make([]interface{}, 0, len(entries))
 	for i := range entries {
@@ -170,23 +170,21 @@ func buildCORSPatch(epa *v1alpha1.ExternalProcessorAttachment, entry *CORSEntry)
 	match := BuildRouteMatch(&entry.Route)
 
 	headers, _ := match["headers"].([]interface{})
-	if headers == nil {
-		headers = []interface{}{}
-	}
 	if matcher := authorityMatcher(entry.Hostname); matcher != nil {
 		headers = append(headers, matcher)
 	}
-	headers = append(headers, map[string]interface{}{
-		"name":          "x-customrouter-cluster",
-		"present_match": true,
-	})
-	match["headers"] = headers
+	if len(headers) > 0 {
+		match["headers"] = headers
+	}
+	ApplyRoutingDecisionMatch(match, epa)
 
 	routeAction := map[string]interface{}{
 		"cluster_header": "x-customrouter-cluster",
 		"timeout":        GetRouteTimeout(epa),
 	}
 	ApplyRetryPolicy(routeAction, epa)
+	ApplyProtocolHint(routeAction, entry.Route.ProtocolHint)
+	ApplyHashPolicy(routeAction, entry.Route.HashPolicy)
 
 	return map[string]interface{}{
 		"applyTo": "HTTP_ROUTE",
@@ -270,6 +268,7 @@ func corsRouteName(entry *CORSEntry) string {
 	h := sha1.New()
 	_, _ = h.Write([]byte(entry.Hostname + "|" + entry.Route.Path + "|" +
 		entry.Route.Type + "|" + entry.Route.Method + "|" +
+		routeSchemeKey(&entry.Route) +
 		corsPolicyFingerprint(&entry.Policy)))
 	return "customrouter-cors-" + hex.EncodeToString(h.Sum(nil))[:12]
 }
@@ -20,30 +20,29 @@ limitations under the License.
 package envoyfilter
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 
-	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/util/retry"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	"github.com/freepik-company/customrouter/api/v1alpha1"
-	"github.com/freepik-company/customrouter/internal/controller"
+	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
-// DefaultCatchAllPorts are the listener ports against which HTTP_ROUTE INSERT_FIRST
-// patches are emitted when a hostname is already covered by an HTTPRoute. Patches
-// targeting a non-existing (hostname, port) virtual host are silently ignored by
-// Istio, so emitting both is safe.
-var DefaultCatchAllPorts = []int{80, 443}
-
 const (
 	// EnvoyFilter name suffixes
 	ExtProcFilterSuffix  = "-extproc"
@@ -56,8 +55,37 @@ const (
 	OwnerLabel     = "customrouter.freepik.com/attachment"
 	AppNameLabel   = "app.kubernetes.io/name"
 	AppNameValue   = "customrouter"
+
+	// FieldManager is the server-side apply field manager of every object
+	// the operator writes.
+	FieldManager = "customrouter-controller"
 )
 
+// legacyFieldManagers are the field managers of objects written with Update
+// before the operator moved to server-side apply: the name of the operator
+// binary. Their fields are handed over to FieldManager on the next apply so
+// they do not conflict with it.
+var legacyFieldManagers = sets.New("manager")
+
+// conflictManagerPattern extracts the field manager from the message of a
+// server-side apply conflict cause.
+var conflictManagerPattern = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+// OwnershipConflictError is returned by UpsertUnstructured when another field
+// manager changed fields of an object the operator manages. The object is
+// left as it is until the change is reverted or the object is deleted.
+type OwnershipConflictError struct {
+	Kind     string
+	Name     string
+	Managers []string
+	Fields   []string
+}
+
+func (e *OwnershipConflictError) Error() string {
+	return fmt.Sprintf("%s %s has fields also managed by %s (%s): revert the change or delete the %s to let the operator recreate it",
+		e.Kind, e.Name, strings.Join(e.Managers, ", "), strings.Join(e.Fields, ", "), e.Kind)
+}
+
 // GVK is the GroupVersionKind for Istio EnvoyFilter resources.
 var GVK = schema.GroupVersionKind{
 	Group:   "networking.istio.io",
@@ -75,6 +103,20 @@ const DefaultRouteTimeout = "30s"
 // did rely on retries.
 const defaultRetryOn = "connect-failure,refused-stream,unavailable,cancelled,retriable-status-codes"
 
+const (
+	// extProcFilterName is the name the <epa>-extproc EnvoyFilter installs the
+	// external processor under; typed_per_filter_config entries must use it.
+	extProcFilterName = "envoy.filters.http.ext_proc"
+
+	// extProcPerRouteTypeURL is the per-route ext_proc override, used to turn
+	// the external processor off for a single route.
+	extProcPerRouteTypeURL = "type.googleapis.com/envoy.extensions.filters.http.ext_proc.v3.ExtProcPerRoute"
+
+	// tcpProxyTypeURL is the TCP proxy network filter forwarding TLS
+	// passthrough connections.
+	tcpProxyTypeURL = "type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy"
+)
+
 // defaultRetriableStatusCodes is the retriable_status_codes list applied when the
 // user enables retries without specifying the codes explicitly. Matches the legacy
 // hardcoded behaviour.
@@ -149,10 +191,31 @@ func ApplyRetryPolicy(routeAction map[string]interface{}, epa *v1alpha1.External
 	}
 }
 
-// CatchAllEntry represents a hostname with its default backend for catch-all routing.
-type CatchAllEntry struct {
-	Hostname   string
-	BackendRef v1alpha1.BackendRef
+// ApplyRoutingDecisionMatch adds to match, in place, the condition that only
+// lets through requests the external processor has routed: the presence of
+// the x-customrouter-cluster header, or with routingDecisionMatch Metadata the
+// presence of the cluster in the processor's routing dynamic metadata. Like
+// ApplyRetryPolicy it is shared by every generated customrouter route.
+func ApplyRoutingDecisionMatch(match map[string]interface{}, epa *v1alpha1.ExternalProcessorAttachment) {
+	if epa.Spec.RoutingDecisionMatch == v1alpha1.RoutingDecisionMatchMetadata {
+		match["dynamic_metadata"] = []interface{}{
+			map[string]interface{}{
+				"filter": routes.RoutingMetadataNamespace,
+				"path": []interface{}{
+					map[string]interface{}{"key": routes.RoutingMetadataCluster},
+				},
+				"value": map[string]interface{}{
+					"present_match": true,
+				},
+			},
+		}
+		return
+	}
+	headers, _ := match["headers"].([]interface{})
+	match["headers"] = append(headers, map[string]interface{}{
+		"name":          "x-customrouter-cluster",
+		"present_match": true,
+	})
 }
 
 // BoolPtr returns a pointer to the given bool value.
@@ -160,12 +223,16 @@ func BoolPtr(b bool) *bool {
 	return &b
 }
 
-// BuildClusterName builds the Istio cluster name for a BackendRef.
+// BuildClusterName builds the Istio cluster name for a BackendRef. It is
+// BackendClusterName of the address the routes carry for ref, so a name
+// with a dot is an external hostname everywhere a cluster is named.
 func BuildClusterName(ref v1alpha1.BackendRef) string {
-	if strings.Contains(ref.Name, ".") {
-		return fmt.Sprintf("outbound|%d||%s", ref.Port, ref.Name)
-	}
-	return fmt.Sprintf("outbound|%d||%s.%s.svc.cluster.local", ref.Port, ref.Name, ref.Namespace)
+	return BackendClusterName(routes.BackendAddress(ref))
+}
+
+// RefClusterName is ClusterName for a BackendRef.
+func RefClusterName(epa *v1alpha1.ExternalProcessorAttachment, ref v1alpha1.BackendRef) string {
+	return ClusterName(epa, routes.BackendAddress(ref))
 }
 
 // NewOwnerReference builds an owner reference for the given EPA.
@@ -197,384 +264,127 @@ func SelectorToInterface(selector map[string]string) map[string]interface{} {
 	return out
 }
 
-// UpsertUnstructured creates or updates an unstructured object with retry on conflict.
+// UpsertUnstructured creates or updates an unstructured object with
+// server-side apply as FieldManager. An object already holding the desired
+// content is left untouched, so a reconcile that regenerates the same object
+// writes nothing and triggers no further watch events. Ownership is not
+// forced: when another field manager changed a field the operator sets, the
+// apply is rejected and an *OwnershipConflictError is returned.
 func UpsertUnstructured(ctx context.Context, cl client.Client, obj *unstructured.Unstructured) error {
-	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
-		existing := &unstructured.Unstructured{}
-		existing.SetGroupVersionKind(obj.GroupVersionKind())
-		key := types.NamespacedName{
-			Name:      obj.GetName(),
-			Namespace: obj.GetNamespace(),
-		}
-
-		err := cl.Get(ctx, key, existing)
-		if errors.IsNotFound(err) {
-			return cl.Create(ctx, obj)
-		}
-		if err != nil {
-			return err
-		}
-
-		obj.SetResourceVersion(existing.GetResourceVersion())
-		return cl.Update(ctx, obj)
-	})
-}
-
-// DeleteEnvoyFilter deletes an EnvoyFilter by namespaced name. Returns nil if not found.
-func DeleteEnvoyFilter(ctx context.Context, cl client.Client, key types.NamespacedName) error {
-	ef := &unstructured.Unstructured{}
-	ef.SetGroupVersionKind(GVK)
-
-	err := cl.Get(ctx, key, ef)
-	if errors.IsNotFound(err) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(obj.GroupVersionKind())
+	key := types.NamespacedName{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+	}
+
+	err := cl.Get(ctx, key, existing)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return err
+	case unstructuredUpToDate(existing, obj):
 		return nil
-	}
-	if err != nil {
-		return fmt.Errorf("failed to get EnvoyFilter %s: %w", key.Name, err)
-	}
-
-	if err := cl.Delete(ctx, ef); err != nil && !errors.IsNotFound(err) {
-		return fmt.Errorf("failed to delete EnvoyFilter %s: %w", key.Name, err)
-	}
-	return nil
-}
-
-// CollectCatchAllEntries extracts catch-all entries from all CustomHTTPRoutes that declare catchAllRoute.
-// When multiple routes declare the same hostname, the first one in lexicographic order of
-// namespace/name wins, ensuring a deterministic result across reconciliations.
-func CollectCatchAllEntries(routeList *v1alpha1.CustomHTTPRouteList) []CatchAllEntry {
-	hostnameMap := make(map[string]v1alpha1.BackendRef)
-
-	ordered := orderedRoutesWithCatchAll(routeList)
-	for _, route := range ordered {
-		for _, hostname := range route.Spec.Hostnames {
-			if _, exists := hostnameMap[hostname]; exists {
-				continue
-			}
-			hostnameMap[hostname] = route.Spec.CatchAllRoute.BackendRef
+	default:
+		if err := upgradeManagedFields(ctx, cl, existing); err != nil {
+			return fmt.Errorf("failed to hand over the fields of %s %s to %s: %w",
+				obj.GetKind(), obj.GetName(), FieldManager, err)
 		}
 	}
 
-	return sortedEntries(hostnameMap)
-}
-
-// orderedRoutesWithCatchAll returns non-deleting routes with a non-nil catchAllRoute,
-// sorted by "namespace/name" to provide a stable iteration order for dedup decisions.
-func orderedRoutesWithCatchAll(routeList *v1alpha1.CustomHTTPRouteList) []*v1alpha1.CustomHTTPRoute {
-	out := make([]*v1alpha1.CustomHTTPRoute, 0, len(routeList.Items))
-	for i := range routeList.Items {
-		route := &routeList.Items[i]
-		if route.DeletionTimestamp != nil && !route.DeletionTimestamp.IsZero() {
-			continue
-		}
-		if route.Spec.CatchAllRoute == nil {
-			continue
-		}
-		out = append(out, route)
+	err = cl.Apply(ctx, client.ApplyConfigurationFromUnstructured(obj), client.FieldOwner(FieldManager))
+	if conflict := ownershipConflict(obj, err); conflict != nil {
+		return conflict
 	}
-	sort.SliceStable(out, func(i, j int) bool {
-		return routeKey(out[i]) < routeKey(out[j])
-	})
-	return out
-}
-
-func routeKey(route *v1alpha1.CustomHTTPRoute) string {
-	return route.Namespace + "/" + route.Name
+	return err
 }
 
-// MergeCatchAllEntries merges entries from CustomHTTPRoutes with the EPA's own catchAllRoute config.
-// EPA entries take precedence (override) for the same hostname.
-func MergeCatchAllEntries(routeEntries []CatchAllEntry, epa *v1alpha1.ExternalProcessorAttachment) []CatchAllEntry {
-	merged := make(map[string]v1alpha1.BackendRef, len(routeEntries))
-
-	for _, entry := range routeEntries {
-		merged[entry.Hostname] = entry.BackendRef
+// upgradeManagedFields hands the fields existing owns through
+// legacyFieldManagers over to FieldManager, once per object.
+func upgradeManagedFields(ctx context.Context, cl client.Client, existing *unstructured.Unstructured) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(existing, legacyFieldManagers, FieldManager)
+	if err != nil || patch == nil {
+		return err
 	}
-
-	if epa.Spec.CatchAllRoute != nil {
-		for _, hostname := range epa.Spec.CatchAllRoute.Hostnames {
-			merged[hostname] = epa.Spec.CatchAllRoute.BackendRef
-		}
-	}
-
-	return sortedEntries(merged)
+	return cl.Patch(ctx, existing, client.RawPatch(types.JSONPatchType, patch))
 }
 
-// CollectHostnamesWithHTTPRoute returns the subset of the given hostnames that are
-// also declared in any existing HTTPRoute. This drives per-hostname selection between
-// "ADD a virtual host" (no HTTPRoute exists) and "inject into the existing virtual host"
-// (HTTPRoute exists and already owns the domain).
-func CollectHostnamesWithHTTPRoute(httpRouteList *gatewayv1.HTTPRouteList, hostnames []string) map[string]bool {
-	out := map[string]bool{}
-	if httpRouteList == nil || len(hostnames) == 0 {
-		return out
-	}
-	target := make(map[string]struct{}, len(hostnames))
-	for _, h := range hostnames {
-		target[h] = struct{}{}
+// ownershipConflict returns the *OwnershipConflictError of obj when err is a
+// server-side apply conflict, or nil.
+func ownershipConflict(obj *unstructured.Unstructured, err error) *OwnershipConflictError {
+	var status apierrors.APIStatus
+	if !apierrors.IsConflict(err) || !errors.As(err, &status) || status.Status().Details == nil {
+		return nil
 	}
-	for i := range httpRouteList.Items {
-		hr := &httpRouteList.Items[i]
-		for _, h := range hr.Spec.Hostnames {
-			if _, ok := target[string(h)]; ok {
-				out[string(h)] = true
-			}
+	managers := sets.New[string]()
+	var fields []string
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
 		}
-	}
-	return out
-}
-
-// BuildCatchAllEnvoyFilter builds the catch-all EnvoyFilter unstructured object.
-// For each hostname the emitted patch depends on whether an HTTPRoute already owns
-// the domain (see hostnamesWithHTTPRoute): if yes, HTTP_ROUTE INSERT_FIRST patches
-// inject the fallback into the existing virtual host (avoids Envoy's "Duplicate entry
-// of domain" error); otherwise the legacy VIRTUAL_HOST ADD creates a new virtual host.
-func BuildCatchAllEnvoyFilter(
-	epa *v1alpha1.ExternalProcessorAttachment,
-	entries []CatchAllEntry,
-	hostnamesWithHTTPRoute map[string]bool,
-) (*unstructured.Unstructured, error) {
-	filterName := epa.Name + CatchAllFilterSuffix
-
-	ef := &unstructured.Unstructured{}
-	ef.SetGroupVersionKind(GVK)
-	ef.SetName(filterName)
-	ef.SetNamespace(epa.Namespace)
-	ef.SetLabels(StandardLabels(epa.Name))
-	ef.SetOwnerReferences([]metav1.OwnerReference{NewOwnerReference(epa)})
-
-	selectorInterface := SelectorToInterface(epa.Spec.GatewayRef.Selector)
-
-	configPatches := make([]interface{}, 0, len(entries))
-	for _, entry := range entries {
-		for _, patch := range buildCatchAllPatches(epa, entry, hostnamesWithHTTPRoute[entry.Hostname]) {
-			configPatches = append(configPatches, patch)
+		if m := conflictManagerPattern.FindStringSubmatch(cause.Message); m != nil {
+			managers.Insert(m[1])
 		}
+		fields = append(fields, cause.Field)
 	}
-
-	spec := map[string]interface{}{
-		"workloadSelector": map[string]interface{}{
-			"labels": selectorInterface,
-		},
-		"configPatches": configPatches,
-	}
-
-	if err := unstructured.SetNestedField(ef.Object, spec, "spec"); err != nil {
-		return nil, fmt.Errorf("failed to set spec: %w", err)
-	}
-
-	return ef, nil
-}
-
-// buildCatchAllPatches returns the config patches for one hostname. When no HTTPRoute
-// owns the domain, one VIRTUAL_HOST ADD is returned. When an HTTPRoute already owns
-// the domain, one HTTP_ROUTE INSERT_FIRST per port in DefaultCatchAllPorts is returned
-// — Envoy would reject a second virtual host with the same domain, so the fallback is
-// injected into the existing one instead.
-func buildCatchAllPatches(epa *v1alpha1.ExternalProcessorAttachment, entry CatchAllEntry, hostnameHasHTTPRoute bool) []map[string]interface{} {
-	if !hostnameHasHTTPRoute {
-		return []map[string]interface{}{buildCatchAllVirtualHostPatch(epa, entry)}
+	if managers.Len() == 0 {
+		return nil
 	}
-	patches := make([]map[string]interface{}, 0, len(DefaultCatchAllPorts))
-	for _, port := range DefaultCatchAllPorts {
-		patches = append(patches, buildCatchAllHTTPRoutePatch(epa, entry, port))
+	sort.Strings(fields)
+	return &OwnershipConflictError{
+		Kind:     obj.GetKind(),
+		Name:     obj.GetName(),
+		Managers: sets.List(managers),
+		Fields:   fields,
 	}
-	return patches
 }
 
-// buildCatchAllVirtualHostPatch builds the legacy VIRTUAL_HOST ADD patch, creating a
-// new virtual host with both the header-gated dynamic route and the default fallback.
-func buildCatchAllVirtualHostPatch(epa *v1alpha1.ExternalProcessorAttachment, entry CatchAllEntry) map[string]interface{} {
-	clusterName := BuildClusterName(entry.BackendRef)
-	timeout := GetRouteTimeout(epa)
-
-	dynamicRoute := map[string]interface{}{
-		"cluster_header": "x-customrouter-cluster",
-		"timeout":        timeout,
+// unstructuredUpToDate reports whether existing already has the spec of
+// desired, its labels and annotations, and its owner references. Specs are
+// compared as JSON, which ignores the different integer types of a built and
+// a decoded object; labels and annotations added by others are kept.
+func unstructuredUpToDate(existing, desired *unstructured.Unstructured) bool {
+	if !mapContains(existing.GetLabels(), desired.GetLabels()) ||
+		!mapContains(existing.GetAnnotations(), desired.GetAnnotations()) ||
+		!equality.Semantic.DeepEqual(existing.GetOwnerReferences(), desired.GetOwnerReferences()) {
+		return false
 	}
-	ApplyRetryPolicy(dynamicRoute, epa)
-
-	return map[string]interface{}{
-		"applyTo": "VIRTUAL_HOST",
-		"match": map[string]interface{}{
-			"context": "GATEWAY",
-		},
-		"patch": map[string]interface{}{
-			"operation": "ADD",
-			"value": map[string]interface{}{
-				"name":    fmt.Sprintf("customrouter-catchall-%s", entry.Hostname),
-				"domains": []interface{}{entry.Hostname},
-				"routes": []interface{}{
-					map[string]interface{}{
-						"name": "customrouter-dynamic-route",
-						"match": map[string]interface{}{
-							"prefix": "/",
-							"headers": []interface{}{
-								map[string]interface{}{
-									"name":          "x-customrouter-cluster",
-									"present_match": true,
-								},
-							},
-						},
-						"route": dynamicRoute,
-					},
-					map[string]interface{}{
-						"name": "default",
-						"match": map[string]interface{}{
-							"prefix": "/",
-						},
-						"route": map[string]interface{}{
-							"cluster": clusterName,
-							"timeout": timeout,
-						},
-					},
-				},
-			},
-		},
+	have, err := json.Marshal(existing.Object["spec"])
+	if err != nil {
+		return false
 	}
-}
-
-// buildCatchAllHTTPRoutePatch injects only the default fallback route at the top of
-// the virtual host "<hostname>:<port>" (owned by the HTTPRoute). The header-gated
-// dynamic route is already injected into every virtual host by the <epa>-routes
-// EnvoyFilter, so duplicating it here would be redundant.
-func buildCatchAllHTTPRoutePatch(epa *v1alpha1.ExternalProcessorAttachment, entry CatchAllEntry, port int) map[string]interface{} {
-	clusterName := BuildClusterName(entry.BackendRef)
-
-	return map[string]interface{}{
-		"applyTo": "HTTP_ROUTE",
-		"match": map[string]interface{}{
-			"context": "GATEWAY",
-			"routeConfiguration": map[string]interface{}{
-				"vhost": map[string]interface{}{
-					"name": fmt.Sprintf("%s:%d", entry.Hostname, port),
-				},
-			},
-		},
-		"patch": map[string]interface{}{
-			"operation": "INSERT_FIRST",
-			"value": map[string]interface{}{
-				"name": fmt.Sprintf("customrouter-catchall-%s", entry.Hostname),
-				"match": map[string]interface{}{
-					"prefix": "/",
-				},
-				"route": map[string]interface{}{
-					"cluster": clusterName,
-					"timeout": GetRouteTimeout(epa),
-				},
-			},
-		},
+	want, err := json.Marshal(desired.Object["spec"])
+	if err != nil {
+		return false
 	}
+	return bytes.Equal(have, want)
 }
 
-// CatchAllProgrammedStatus describes whether a CustomHTTPRoute's catchAllRoute ends up
-// applied on at least one EPA's catch-all EnvoyFilter, and if not, which reason prevails.
-type CatchAllProgrammedStatus struct {
-	Programmed bool
-	Reason     string
-	Hostnames  []string // hostnames of the route that won both dedup and EPA override (when Programmed=true)
-}
-
-// EvaluateCatchAllProgrammed determines the programming state of a route's catchAllRoute.
-// The result's Reason is one of the ConditionReasonCatchAll* constants from the controller package.
-func EvaluateCatchAllProgrammed(
-	route *v1alpha1.CustomHTTPRoute,
-	routeList *v1alpha1.CustomHTTPRouteList,
-	epaList *v1alpha1.ExternalProcessorAttachmentList,
-) CatchAllProgrammedStatus {
-	if route == nil || route.Spec.CatchAllRoute == nil {
-		return CatchAllProgrammedStatus{Reason: controller.ConditionReasonCatchAllNotConfigured}
-	}
-
-	if epaList == nil || len(epaList.Items) == 0 {
-		return CatchAllProgrammedStatus{Reason: controller.ConditionReasonCatchAllNoEPA}
-	}
-
-	selfKey := routeKey(route)
-	var wonHostnames []string
-	for _, hostname := range route.Spec.Hostnames {
-		if winnerHostnameRoute(hostname, routeList) == selfKey {
-			wonHostnames = append(wonHostnames, hostname)
-		}
-	}
-
-	var programmed, lostByEPA []string
-	for _, hostname := range wonHostnames {
-		// A hostname is lost only if every EPA overrides it, because each EPA produces
-		// its own catch-all EnvoyFilter: the route's catch-all still reaches the dataplane
-		// through any EPA that does not declare the hostname in its own catchAllRoute.
-		if hostnameOverriddenByEveryEPA(hostname, epaList) {
-			lostByEPA = append(lostByEPA, hostname)
-		} else {
-			programmed = append(programmed, hostname)
-		}
-	}
-
-	if len(programmed) > 0 {
-		return CatchAllProgrammedStatus{
-			Programmed: true,
-			Reason:     controller.ConditionReasonCatchAllProgrammed,
-			Hostnames:  programmed,
+// mapContains reports whether every entry of want is in have.
+func mapContains(have, want map[string]string) bool {
+	for k, v := range want {
+		if cur, ok := have[k]; !ok || cur != v {
+			return false
 		}
 	}
-
-	if len(lostByEPA) > 0 {
-		return CatchAllProgrammedStatus{Reason: controller.ConditionReasonCatchAllOverriddenByEPA}
-	}
-	return CatchAllProgrammedStatus{Reason: controller.ConditionReasonCatchAllOverriddenByRoute}
+	return true
 }
 
-// winnerHostnameRoute returns the namespace/name of the route that wins the dedup for hostname,
-// or "" if no route declares it. The winner is the first in lexicographic order of namespace/name.
-func winnerHostnameRoute(hostname string, routeList *v1alpha1.CustomHTTPRouteList) string {
-	if routeList == nil {
-		return ""
-	}
-	ordered := orderedRoutesWithCatchAll(routeList)
-	for _, r := range ordered {
-		for _, h := range r.Spec.Hostnames {
-			if h == hostname {
-				return routeKey(r)
-			}
-		}
-	}
-	return ""
-}
+// DeleteEnvoyFilter deletes an EnvoyFilter by namespaced name. Returns nil if not found.
+func DeleteEnvoyFilter(ctx context.Context, cl client.Client, key types.NamespacedName) error {
+	ef := &unstructured.Unstructured{}
+	ef.SetGroupVersionKind(GVK)
 
-// hostnameOverriddenByEveryEPA reports whether every EPA declares hostname in its own
-// catchAllRoute.Hostnames. Returns false if any EPA has no catchAllRoute or does not declare
-// the hostname, because that EPA will carry the route's catch-all through to the dataplane.
-func hostnameOverriddenByEveryEPA(hostname string, epaList *v1alpha1.ExternalProcessorAttachmentList) bool {
-	if epaList == nil || len(epaList.Items) == 0 {
-		return false
+	err := cl.Get(ctx, key, ef)
+	if apierrors.IsNotFound(err) {
+		return nil
 	}
-	for i := range epaList.Items {
-		epa := &epaList.Items[i]
-		if epa.Spec.CatchAllRoute == nil {
-			return false
-		}
-		found := false
-		for _, h := range epa.Spec.CatchAllRoute.Hostnames {
-			if h == hostname {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
+	if err != nil {
+		return fmt.Errorf("failed to get EnvoyFilter %s: %w", key.Name, err)
 	}
-	return true
-}
 
-// sortedEntries converts a hostname→BackendRef map to a sorted slice of CatchAllEntry.
-func sortedEntries(m map[string]v1alpha1.BackendRef) []CatchAllEntry {
-	entries := make([]CatchAllEntry, 0, len(m))
-	for hostname, ref := range m {
-		entries = append(entries, CatchAllEntry{Hostname: hostname, BackendRef: ref})
+	if err := cl.Delete(ctx, ef); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete EnvoyFilter %s: %w", key.Name, err)
 	}
-	sort.SliceStable(entries, func(i, j int) bool {
-		return entries[i].Hostname < entries[j].Hostname
-	})
-	return entries
+	return nil
 }
@@ -17,10 +17,18 @@ limitations under the License.
 package envoyfilter
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"github.com/freepik-company/customrouter/api/v1alpha1"
 	"github.com/freepik-company/customrouter/pkg/routes"
@@ -301,3 +309,247 @@ func getNestedSlice(obj map[string]interface{}, fields ...string) []interface{}
 	}
 	return nil
 }
+
+func TestApplyRoutingDecisionMatch(t *testing.T) {
+	epa := epaWithRetryPolicy(nil)
+	match := map[string]interface{}{"prefix": "/"}
+	ApplyRoutingDecisionMatch(match, epa)
+	want := []interface{}{
+		map[string]interface{}{"name": "x-customrouter-cluster", "present_match": true},
+	}
+	if !reflect.DeepEqual(match["headers"], want) {
+		t.Errorf("headers = %v, want %v", match["headers"], want)
+	}
+	if _, present := match["dynamic_metadata"]; present {
+		t.Error("dynamic_metadata should be absent in Header mode")
+	}
+
+	epa.Spec.RoutingDecisionMatch = v1alpha1.RoutingDecisionMatchMetadata
+	match = map[string]interface{}{"prefix": "/"}
+	ApplyRoutingDecisionMatch(match, epa)
+	if _, present := match["headers"]; present {
+		t.Error("the cluster header must not be matched in Metadata mode")
+	}
+	matchers, ok := match["dynamic_metadata"].([]interface{})
+	if !ok || len(matchers) != 1 {
+		t.Fatalf("dynamic_metadata = %v, want one matcher", match["dynamic_metadata"])
+	}
+	matcher := matchers[0].(map[string]interface{})
+	if matcher["filter"] != routes.RoutingMetadataNamespace {
+		t.Errorf("filter = %v, want %q", matcher["filter"], routes.RoutingMetadataNamespace)
+	}
+	wantPath := []interface{}{map[string]interface{}{"key": routes.RoutingMetadataCluster}}
+	if !reflect.DeepEqual(matcher["path"], wantPath) {
+		t.Errorf("path = %v, want %v", matcher["path"], wantPath)
+	}
+}
+
+func TestBuildCatchAllVirtualHostPatch_MetadataMatch(t *testing.T) {
+	entry := CatchAllEntry{
+		Hostname:   "example.com",
+		BackendRef: v1alpha1.BackendRef{Name: "default-backend", Namespace: "default", Port: 80},
+	}
+	epa := epaWithRetryPolicy(nil)
+	epa.Spec.RoutingDecisionMatch = v1alpha1.RoutingDecisionMatchMetadata
+
+	patch := buildCatchAllVirtualHostPatch(epa, entry)
+	routeSlice := patch["patch"].(map[string]interface{})["value"].(map[string]interface{})["routes"].([]interface{})
+	dynMatch := routeSlice[0].(map[string]interface{})["match"].(map[string]interface{})
+	if _, present := dynMatch["dynamic_metadata"]; !present {
+		t.Error("dynamic route should match on dynamic_metadata")
+	}
+	if _, present := dynMatch["headers"]; present {
+		t.Error("dynamic route should not match on the cluster header")
+	}
+	defMatch := routeSlice[1].(map[string]interface{})["match"].(map[string]interface{})
+	if _, present := defMatch["dynamic_metadata"]; present {
+		t.Error("default route must stay unconditional")
+	}
+}
+
+func TestBuildCatchAllVirtualHostPatch_ExcludePaths(t *testing.T) {
+	entry := CatchAllEntry{
+		Hostname:   "example.com",
+		BackendRef: v1alpha1.BackendRef{Name: "default-backend", Namespace: "default", Port: 80},
+		ExcludePaths: []v1alpha1.CatchAllExcludePath{
+			{Path: "/healthz"},
+			{Path: "/ready", Action: v1alpha1.CatchAllExcludePassThrough},
+		},
+	}
+
+	patch := buildCatchAllVirtualHostPatch(epaWithRetryPolicy(nil), entry)
+	routeSlice := patch["patch"].(map[string]interface{})["value"].(map[string]interface{})["routes"].([]interface{})
+	if len(routeSlice) != 4 {
+		t.Fatalf("expected the 2 excluded paths before the dynamic and default routes, got %d routes", len(routeSlice))
+	}
+
+	direct := routeSlice[0].(map[string]interface{})
+	if !reflect.DeepEqual(direct["match"], map[string]interface{}{"path": "/healthz"}) {
+		t.Errorf("routes[0] match = %v", direct["match"])
+	}
+	if !reflect.DeepEqual(direct["direct_response"], map[string]interface{}{"status": int64(200)}) {
+		t.Errorf("routes[0] direct_response = %v", direct["direct_response"])
+	}
+	if _, present := direct["route"]; present {
+		t.Error("a direct response route must not forward")
+	}
+
+	pass := routeSlice[1].(map[string]interface{})
+	if pass["route"].(map[string]interface{})["cluster"] != BuildClusterName(entry.BackendRef) {
+		t.Errorf("routes[1] route = %v, want the catch-all backend", pass["route"])
+	}
+	extProc := pass["typed_per_filter_config"].(map[string]interface{})[extProcFilterName].(map[string]interface{})
+	if extProc["disabled"] != true {
+		t.Errorf("routes[1] must disable ext_proc, got %v", extProc)
+	}
+
+	if routeSlice[2].(map[string]interface{})["name"] != "customrouter-dynamic-route" {
+		t.Errorf("routes[2] = %v, want the dynamic route", routeSlice[2])
+	}
+}
+
+func TestBuildCatchAllPatches_ExcludePathsWithHTTPRoute(t *testing.T) {
+	entry := CatchAllEntry{
+		Hostname:     "example.com",
+		BackendRef:   v1alpha1.BackendRef{Name: "default-backend", Namespace: "default", Port: 80},
+		ExcludePaths: []v1alpha1.CatchAllExcludePath{{Path: "/healthz"}},
+	}
+
+	patches := buildCatchAllPatches(epaWithRetryPolicy(nil), entry, true)
+	if len(patches) != 2*len(DefaultCatchAllPorts) {
+		t.Fatalf("expected a fallback and an exclude patch per port, got %d patches", len(patches))
+	}
+	for i, port := range DefaultCatchAllPorts {
+		fallback, exclude := patches[2*i], patches[2*i+1]
+		if op := fallback["patch"].(map[string]interface{})["operation"]; op != "INSERT_FIRST" {
+			t.Errorf("port %d: fallback operation = %v", port, op)
+		}
+		if op := exclude["patch"].(map[string]interface{})["operation"]; op != "INSERT_BEFORE" {
+			t.Errorf("port %d: exclude operation = %v", port, op)
+		}
+		vhost := exclude["match"].(map[string]interface{})["routeConfiguration"].(map[string]interface{})["vhost"].(map[string]interface{})
+		want := map[string]interface{}{
+			"name":  fmt.Sprintf("example.com:%d", port),
+			"route": map[string]interface{}{"name": "customrouter-catchall-example.com"},
+		}
+		if !reflect.DeepEqual(vhost, want) {
+			t.Errorf("port %d: exclude vhost match = %v, want %v", port, vhost, want)
+		}
+	}
+}
+
+func TestBuildCatchAllPatches_TLSPassthrough(t *testing.T) {
+	entry := CatchAllEntry{
+		Hostname:         "tls.example.com",
+		BackendRef:       v1alpha1.BackendRef{Name: "tls-backend", Namespace: "default", Port: 443},
+		ListenerProtocol: v1alpha1.ListenerProtocolTLSPassthrough,
+	}
+
+	for _, hasHTTPRoute := range []bool{false, true} {
+		patches := buildCatchAllPatches(epaWithRetryPolicy(nil), entry, hasHTTPRoute)
+		if len(patches) != 1 {
+			t.Fatalf("hasHTTPRoute=%v: expected a single patch, got %d", hasHTTPRoute, len(patches))
+		}
+		patch := patches[0]
+		if patch["applyTo"] != "FILTER_CHAIN" {
+			t.Errorf("applyTo = %v, want FILTER_CHAIN", patch["applyTo"])
+		}
+		listener := patch["match"].(map[string]interface{})["listener"].(map[string]interface{})
+		if listener["portNumber"] != int64(CatchAllPassthroughPort) {
+			t.Errorf("listener = %v, want port %d", listener, CatchAllPassthroughPort)
+		}
+		value := patch["patch"].(map[string]interface{})["value"].(map[string]interface{})
+		wantMatch := map[string]interface{}{"server_names": []interface{}{"tls.example.com"}}
+		if !reflect.DeepEqual(value["filter_chain_match"], wantMatch) {
+			t.Errorf("filter_chain_match = %v, want %v", value["filter_chain_match"], wantMatch)
+		}
+		filter := value["filters"].([]interface{})[0].(map[string]interface{})
+		config := filter["typed_config"].(map[string]interface{})
+		if filter["name"] != "envoy.filters.network.tcp_proxy" || config["cluster"] != BuildClusterName(entry.BackendRef) {
+			t.Errorf("filter = %v, want a tcp_proxy to the catch-all backend", filter)
+		}
+	}
+}
+
+// newApplyClient returns a fake client that knows EnvoyFilters and returns
+// managed fields, as the API server does.
+func newApplyClient() client.Client {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(GVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(GVK.GroupVersion().WithKind(GVK.Kind+"List"), &unstructured.UnstructuredList{})
+	return fake.NewClientBuilder().WithScheme(scheme).WithReturnManagedFields().Build()
+}
+
+// getEnvoyFilter returns the EnvoyFilter named like obj.
+func getEnvoyFilter(t *testing.T, cl client.Client, obj *unstructured.Unstructured) *unstructured.Unstructured {
+	t.Helper()
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(GVK)
+	if err := cl.Get(context.Background(), types.NamespacedName{
+		Name: obj.GetName(), Namespace: obj.GetNamespace(),
+	}, current); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return current
+}
+
+func TestUpsertUnstructuredReportsOwnershipConflict(t *testing.T) {
+	cl := newApplyClient()
+	ctx := context.Background()
+	desired := managedEnvoyFilter("epa-routes", map[string]string{"istio": "public"})
+	if err := UpsertUnstructured(ctx, cl, desired.DeepCopy()); err != nil {
+		t.Fatalf("UpsertUnstructured: %v", err)
+	}
+
+	// Someone edits the workload selector by hand.
+	edited := getEnvoyFilter(t, cl, desired)
+	_ = unstructured.SetNestedField(edited.Object, "internal", "spec", "workloadSelector", "labels", "istio")
+	if err := cl.Update(ctx, edited, client.FieldOwner("kubectl-edit")); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	err := UpsertUnstructured(ctx, cl, desired.DeepCopy())
+	var conflict *OwnershipConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("UpsertUnstructured = %v, want an OwnershipConflictError", err)
+	}
+	if !reflect.DeepEqual(conflict.Managers, []string{"kubectl-edit"}) ||
+		!reflect.DeepEqual(conflict.Fields, []string{".spec.workloadSelector.labels.istio"}) {
+		t.Errorf("conflict = %+v, want kubectl-edit on .spec.workloadSelector.labels.istio", conflict)
+	}
+	got, _, _ := unstructured.NestedString(getEnvoyFilter(t, cl, desired).Object, "spec", "workloadSelector", "labels", "istio")
+	if got != "internal" {
+		t.Errorf("workload selector = %q, want the edit left in place", got)
+	}
+}
+
+func TestUpsertUnstructuredTakesOverLegacyFields(t *testing.T) {
+	cl := newApplyClient()
+	ctx := context.Background()
+
+	// An EnvoyFilter written with Update by an operator release that did not
+	// use server-side apply, with a field the operator no longer sets.
+	legacy := managedEnvoyFilter("epa-routes", map[string]string{"istio": "public"})
+	_ = unstructured.SetNestedField(legacy.Object, int64(10), "spec", "priority")
+	if err := cl.Create(ctx, legacy, client.FieldOwner("manager")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	desired := managedEnvoyFilter("epa-routes", map[string]string{"istio": "internal"})
+	if err := UpsertUnstructured(ctx, cl, desired); err != nil {
+		t.Fatalf("UpsertUnstructured: %v", err)
+	}
+
+	current := getEnvoyFilter(t, cl, desired)
+	if got, _, _ := unstructured.NestedString(current.Object, "spec", "workloadSelector", "labels", "istio"); got != "internal" {
+		t.Errorf("workload selector = %q, want internal", got)
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(current.Object, "spec", "priority"); found {
+		t.Error("spec.priority kept, want it removed with the legacy fields")
+	}
+	for _, entry := range current.GetManagedFields() {
+		if entry.Manager != FieldManager {
+			t.Errorf("managed fields still list %q, want only %q", entry.Manager, FieldManager)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoyfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// GatewayCopyName returns the name of the copy of the EnvoyFilter name for
+// the n-th Gateway of spec.additionalGatewayRefs, counting from 1.
+func GatewayCopyName(name string, n int) string {
+	return name + "-" + strconv.Itoa(n)
+}
+
+// ErrSelectorNotResolved is returned by UpsertEnvoyFilters for an attachment
+// whose Gateway workload selector is not resolved yet.
+var ErrSelectorNotResolved = errors.New("gateway workload selector not resolved yet")
+
+// SelectorResolved reports whether the workload selector of the first
+// Gateway of epa is known, so its EnvoyFilters can be written.
+func SelectorResolved(epa *v1alpha1.ExternalProcessorAttachment) bool {
+	return len(epa.WorkloadSelector()) > 0
+}
+
+// UpsertEnvoyFilters upserts envoyFilter, built for the first workload
+// selector of epa, and a copy of it selecting the workload of each Gateway
+// of spec.additionalGatewayRefs, named by GatewayCopyName. Copies for
+// Gateways no longer listed are deleted. An empty workloadSelector would
+// select every workload of the namespace, so nothing is written while the
+// first selector is not resolved (ErrSelectorNotResolved), and the copy of
+// a Gateway whose selector is not resolved yet is left as it is.
+func UpsertEnvoyFilters(
+	ctx context.Context,
+	cl client.Client,
+	epa *v1alpha1.ExternalProcessorAttachment,
+	envoyFilter *unstructured.Unstructured,
+) error {
+	key := types.NamespacedName{Name: envoyFilter.GetName(), Namespace: envoyFilter.GetNamespace()}
+	if !SelectorResolved(epa) {
+		return fmt.Errorf("EnvoyFilter %s: %w", key, ErrSelectorNotResolved)
+	}
+	selectors := epa.WorkloadSelectors()
+
+	copies := make([]*unstructured.Unstructured, 0, len(selectors)-1)
+	for n := 1; n < len(selectors); n++ {
+		if len(selectors[n]) == 0 {
+			continue
+		}
+		gatewayCopy := envoyFilter.DeepCopy()
+		gatewayCopy.SetName(GatewayCopyName(key.Name, n))
+		if err := unstructured.SetNestedField(gatewayCopy.Object, SelectorToInterface(selectors[n]),
+			"spec", "workloadSelector", "labels"); err != nil {
+			return fmt.Errorf("failed to set workloadSelector of %s: %w", gatewayCopy.GetName(), err)
+		}
+		copies = append(copies, gatewayCopy)
+	}
+
+	if err := UpsertUnstructured(ctx, cl, envoyFilter); err != nil {
+		return err
+	}
+	for _, gatewayCopy := range copies {
+		if err := UpsertUnstructured(ctx, cl, gatewayCopy); err != nil {
+			return fmt.Errorf("failed to upsert EnvoyFilter %s: %w", gatewayCopy.GetName(), err)
+		}
+	}
+	return deleteGatewayCopies(ctx, cl, key, len(selectors)-1)
+}
+
+// DeleteEnvoyFilters deletes the EnvoyFilter named by key and its copies for
+// the Gateways of spec.additionalGatewayRefs. Returns nil if none exists.
+func DeleteEnvoyFilters(ctx context.Context, cl client.Client, key types.NamespacedName) error {
+	if err := DeleteEnvoyFilter(ctx, cl, key); err != nil {
+		return err
+	}
+	return deleteGatewayCopies(ctx, cl, key, 0)
+}
+
+// deleteGatewayCopies deletes the copies of the EnvoyFilter named by key for
+// the Gateways past the first keep of spec.additionalGatewayRefs.
+func deleteGatewayCopies(ctx context.Context, cl client.Client, key types.NamespacedName, keep int) error {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(GVK.GroupVersion().WithKind(GVK.Kind + "List"))
+	if err := cl.List(ctx, list,
+		client.InNamespace(key.Namespace),
+		client.MatchingLabels{ManagedByLabel: ManagedByValue},
+	); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list EnvoyFilters in %s: %w", key.Namespace, err)
+	}
+	for i := range list.Items {
+		item := &list.Items[i]
+		if n, ok := gatewayCopyIndex(key.Name, item.GetName()); !ok || n <= keep {
+			continue
+		}
+		if err := cl.Delete(ctx, item); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete EnvoyFilter %s: %w", item.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// gatewayCopyIndex returns n when name is GatewayCopyName(base, n).
+func gatewayCopyIndex(base, name string) (int, bool) {
+	suffix, ok := strings.CutPrefix(name, base+"-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n < 1 || strconv.Itoa(n) != suffix {
+		return 0, false
+	}
+	return n, true
+}
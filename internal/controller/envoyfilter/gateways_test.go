@@ -0,0 +1,146 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoyfilter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// managedEnvoyFilter returns an EnvoyFilter labeled as the controller's.
+func managedEnvoyFilter(name string, selector map[string]string) *unstructured.Unstructured {
+	envoyFilter := &unstructured.Unstructured{}
+	envoyFilter.SetGroupVersionKind(GVK)
+	envoyFilter.SetName(name)
+	envoyFilter.SetNamespace("istio-system")
+	envoyFilter.SetLabels(StandardLabels("epa"))
+	_ = unstructured.SetNestedField(envoyFilter.Object, SelectorToInterface(selector), "spec", "workloadSelector", "labels")
+	return envoyFilter
+}
+
+func TestUpsertEnvoyFilters(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(GVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(GVK.GroupVersion().WithKind(GVK.Kind+"List"), &unstructured.UnstructuredList{})
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		managedEnvoyFilter("epa-routes-3", map[string]string{"istio": "removed"}),
+		managedEnvoyFilter("epa-routes-x", map[string]string{"istio": "other"}),
+		managedEnvoyFilter("epa-mirror-1", map[string]string{"istio": "internal"}),
+	).Build()
+	ctx := context.Background()
+
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "epa", Namespace: "istio-system"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: v1alpha1.GatewayRef{Selector: map[string]string{"istio": "public"}},
+			AdditionalGatewayRefs: []v1alpha1.GatewayRef{
+				{Selector: map[string]string{"istio": "internal"}},
+				{Name: "unresolved"},
+			},
+		},
+	}
+	if err := UpsertEnvoyFilters(ctx, cl, epa, managedEnvoyFilter("epa-routes", epa.WorkloadSelector())); err != nil {
+		t.Fatalf("UpsertEnvoyFilters: %v", err)
+	}
+
+	selectorOf := func(name string) map[string]string {
+		envoyFilter := &unstructured.Unstructured{}
+		envoyFilter.SetGroupVersionKind(GVK)
+		if err := cl.Get(ctx, types.NamespacedName{Name: name, Namespace: "istio-system"}, envoyFilter); err != nil {
+			return nil
+		}
+		labels, _, _ := unstructured.NestedStringMap(envoyFilter.Object, "spec", "workloadSelector", "labels")
+		return labels
+	}
+	want := map[string]map[string]string{
+		"epa-routes":   {"istio": "public"},
+		"epa-routes-1": {"istio": "internal"},
+		// Not resolved yet: no copy selecting the whole namespace.
+		"epa-routes-2": nil,
+		// Its Gateway is no longer listed.
+		"epa-routes-3": nil,
+		"epa-routes-x": {"istio": "other"},
+		"epa-mirror-1": {"istio": "internal"},
+	}
+	for name, selector := range want {
+		if got := selectorOf(name); !reflect.DeepEqual(got, selector) {
+			t.Errorf("%s workloadSelector = %v, want %v", name, got, selector)
+		}
+	}
+
+	if err := DeleteEnvoyFilters(ctx, cl, types.NamespacedName{Name: "epa-routes", Namespace: "istio-system"}); err != nil {
+		t.Fatalf("DeleteEnvoyFilters: %v", err)
+	}
+	remaining := &unstructured.UnstructuredList{}
+	remaining.SetGroupVersionKind(GVK.GroupVersion().WithKind(GVK.Kind + "List"))
+	if err := cl.List(ctx, remaining, client.InNamespace("istio-system")); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var names []string
+	for _, item := range remaining.Items {
+		names = append(names, item.GetName())
+	}
+	if !reflect.DeepEqual(names, []string{"epa-mirror-1", "epa-routes-x"}) {
+		t.Errorf("EnvoyFilters after DeleteEnvoyFilters = %v, want the unrelated ones", names)
+	}
+
+	// Nothing is written until the first Gateway's selector is resolved.
+	unresolved := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "epa", Namespace: "istio-system"},
+		Spec:       v1alpha1.ExternalProcessorAttachmentSpec{GatewayRef: v1alpha1.GatewayRef{Name: "public"}},
+	}
+	err := UpsertEnvoyFilters(ctx, cl, unresolved, managedEnvoyFilter("epa-cors", unresolved.WorkloadSelector()))
+	if !errors.Is(err, ErrSelectorNotResolved) {
+		t.Errorf("UpsertEnvoyFilters with an unresolved selector = %v, want ErrSelectorNotResolved", err)
+	}
+	if got := selectorOf("epa-cors"); got != nil {
+		t.Errorf("epa-cors was written with workloadSelector %v", got)
+	}
+}
+
+func TestGatewayCopyIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   int
+		wantOK bool
+	}{
+		{name: "epa-routes-1", want: 1, wantOK: true},
+		{name: "epa-routes-12", want: 12, wantOK: true},
+		{name: "epa-routes"},
+		{name: "epa-routes-0"},
+		{name: "epa-routes-01"},
+		{name: "epa-routes-1-extproc"},
+		{name: "epa-mirror-1"},
+	}
+	for _, tt := range tests {
+		n, ok := gatewayCopyIndex("epa-routes", tt.name)
+		if n != tt.want || ok != tt.wantOK {
+			t.Errorf("gatewayCopyIndex(%q) = %d, %v, want %d, %v", tt.name, n, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -28,10 +28,15 @@ import (
 //   - Exact path     → "path": r.Path
 //   - PathPrefix     → "path_separated_prefix": r.Path (Gateway API segment boundary)
 //   - Regex          → "safe_regex": {"regex": r.Path} (RE2 engine, the default)
+//   - CaseInsensitive → "case_sensitive": false, or a leading (?i) for Regex
+//     (Envoy ignores case_sensitive for safe_regex)
 //   - Method         → header matcher on ":method" with exact_match
+//   - Scheme         → header matcher on ":scheme" with exact_match
 //   - Header Exact   → header matcher with exact_match
 //   - Header Regex   → header matcher with safe_regex_match
 //   - QueryParam     → query_parameters entry with string_match
+//   - Fraction       → runtime_fraction with routes.EnvoyPercent, which
+//     Envoy samples by the x-request-id like the extproc does
 //
 // Prefix matches on "/" degrade to a plain "prefix": "/" because Envoy
 // rejects path_separated_prefix values that end with "/" or are exactly "/".
@@ -42,8 +47,12 @@ func BuildRouteMatch(r *routes.Route) map[string]interface{} {
 	case routes.RouteTypeExact:
 		match["path"] = r.Path
 	case routes.RouteTypeRegex:
+		regex := r.Path
+		if r.CaseInsensitive {
+			regex = "(?i)" + regex
+		}
 		match["safe_regex"] = map[string]interface{}{
-			"regex": r.Path,
+			"regex": regex,
 		}
 	default:
 		if r.Path == "" || r.Path == "/" {
@@ -52,14 +61,23 @@ func BuildRouteMatch(r *routes.Route) map[string]interface{} {
 			match["path_separated_prefix"] = trimTrailingSlash(r.Path)
 		}
 	}
+	if r.CaseInsensitive && r.Type != routes.RouteTypeRegex {
+		match["case_sensitive"] = false
+	}
 
-	headerMatchers := make([]interface{}, 0, 1+len(r.Headers))
+	headerMatchers := make([]interface{}, 0, 2+len(r.Headers))
 	if r.Method != "" {
 		headerMatchers = append(headerMatchers, map[string]interface{}{
 			"name":        ":method",
 			"exact_match": r.Method,
 		})
 	}
+	if r.Scheme != "" {
+		headerMatchers = append(headerMatchers, map[string]interface{}{
+			"name":        ":scheme",
+			"exact_match": r.Scheme,
+		})
+	}
 	for i := range r.Headers {
 		h := &r.Headers[i]
 		headerMatchers = append(headerMatchers, buildHeaderMatcher(h))
@@ -77,9 +95,31 @@ func BuildRouteMatch(r *routes.Route) map[string]interface{} {
 		match["query_parameters"] = qps
 	}
 
+	if r.Fraction != nil {
+		match["runtime_fraction"] = buildRuntimeFraction(r.Fraction)
+	}
+
 	return match
 }
 
+// envoyDenominatorNames names the FractionalPercent denominators returned by
+// routes.EnvoyPercent.
+var envoyDenominatorNames = map[int64]string{
+	100:     "HUNDRED",
+	10000:   "TEN_THOUSAND",
+	1000000: "MILLION",
+}
+
+func buildRuntimeFraction(f *routes.RouteFraction) map[string]interface{} {
+	numerator, denominator := routes.EnvoyPercent(f.Numerator, f.Denominator)
+	return map[string]interface{}{
+		"default_value": map[string]interface{}{
+			"numerator":   numerator,
+			"denominator": envoyDenominatorNames[denominator],
+		},
+	}
+}
+
 func buildHeaderMatcher(h *routes.RouteHeaderMatch) map[string]interface{} {
 	m := map[string]interface{}{
 		"name": h.Name,
@@ -118,3 +158,12 @@ func trimTrailingSlash(p string) string {
 	}
 	return p
 }
+
+// routeSchemeKey returns the scheme segment of the generated route names of
+// r. It is empty for routes of any scheme, so their names do not change.
+func routeSchemeKey(r *routes.Route) string {
+	if r.Scheme == "" {
+		return ""
+	}
+	return r.Scheme + "|"
+}
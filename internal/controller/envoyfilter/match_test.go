@@ -66,6 +66,23 @@ func TestBuildRouteMatch(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "case-insensitive prefix",
+			route: routes.Route{Path: "/Shop", Type: routes.RouteTypePrefix, CaseInsensitive: true},
+			want: map[string]interface{}{
+				"path_separated_prefix": "/Shop",
+				"case_sensitive":        false,
+			},
+		},
+		{
+			name:  "case-insensitive regex uses the (?i) flag",
+			route: routes.Route{Path: "^/id/[0-9]+$", Type: routes.RouteTypeRegex, CaseInsensitive: true},
+			want: map[string]interface{}{
+				"safe_regex": map[string]interface{}{
+					"regex": "(?i)^/id/[0-9]+$",
+				},
+			},
+		},
 		{
 			name: "method emitted as :method pseudo-header",
 			route: routes.Route{
@@ -83,6 +100,23 @@ func TestBuildRouteMatch(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "scheme emitted as :scheme pseudo-header",
+			route: routes.Route{
+				Path:   "/foo",
+				Type:   routes.RouteTypeExact,
+				Scheme: "http",
+			},
+			want: map[string]interface{}{
+				"path": "/foo",
+				"headers": []interface{}{
+					map[string]interface{}{
+						"name":        ":scheme",
+						"exact_match": "http",
+					},
+				},
+			},
+		},
 		{
 			name: "exact header",
 			route: routes.Route{
@@ -191,6 +225,40 @@ func TestBuildRouteMatch(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "percentage fraction",
+			route: routes.Route{
+				Path:     "/checkout",
+				Type:     routes.RouteTypeExact,
+				Fraction: &routes.RouteFraction{Numerator: 10, Denominator: 100},
+			},
+			want: map[string]interface{}{
+				"path": "/checkout",
+				"runtime_fraction": map[string]interface{}{
+					"default_value": map[string]interface{}{
+						"numerator":   int64(10),
+						"denominator": "HUNDRED",
+					},
+				},
+			},
+		},
+		{
+			name: "fraction scaled to an Envoy denominator",
+			route: routes.Route{
+				Path:     "/checkout",
+				Type:     routes.RouteTypeExact,
+				Fraction: &routes.RouteFraction{Numerator: 1, Denominator: 8},
+			},
+			want: map[string]interface{}{
+				"path": "/checkout",
+				"runtime_fraction": map[string]interface{}{
+					"default_value": map[string]interface{}{
+						"numerator":   int64(1250),
+						"denominator": "TEN_THOUSAND",
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
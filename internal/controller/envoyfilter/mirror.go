@@ -122,7 +122,7 @@ var typePriority = map[string]int{
 // hasMirrorAction is a cheap pre-filter that skips ExpandRoutes for routes
 // that clearly have no mirror actions. Avoids unnecessary expansion work.
 func hasMirrorAction(cr *v1alpha1.CustomHTTPRoute) bool {
-	for _, rule := range cr.Spec.Rules {
+	for _, rule := range cr.Spec.ActiveRules() {
 		for _, a := range rule.Actions {
 			if a.Type == v1alpha1.ActionTypeRequestMirror {
 				return true
@@ -149,7 +149,7 @@ func BuildMirrorEnvoyFilter(
 	ef.SetLabels(StandardLabels(epa.Name))
 	ef.SetOwnerReferences([]metav1.OwnerReference{NewOwnerReference(epa)})
 
-	selectorInterface := SelectorToInterface(epa.Spec.GatewayRef.Selector)
+	selectorInterface := SelectorToInterface(epa.WorkloadSelector())
 
 	configPatches := make([]interface{}, 0, len(entries))
 	for i := range entries {
@@ -180,29 +180,27 @@ func buildMirrorPatch(epa *v1alpha1.ExternalProcessorAttachment, entry *MirrorEn
 
 	// Hostname-scope the mirror via :authority so the mirror route does not
 	// leak into virtual hosts owned by other CustomHTTPRoutes that happen to
-	// share a path shape. The x-customrouter-cluster presence check ensures
-	// we only run on requests ExtProc has already accepted.
+	// share a path shape. The routing decision match ensures we only run on
+	// requests ExtProc has already accepted.
 	headers, _ := match["headers"].([]interface{})
-	if headers == nil {
-		headers = []interface{}{}
-	}
 	if matcher := authorityMatcher(entry.Hostname); matcher != nil {
 		headers = append(headers, matcher)
 	}
-	headers = append(headers, map[string]interface{}{
-		"name":          "x-customrouter-cluster",
-		"present_match": true,
-	})
-	match["headers"] = headers
+	if len(headers) > 0 {
+		match["headers"] = headers
+	}
+	ApplyRoutingDecisionMatch(match, epa)
 
 	routeAction := map[string]interface{}{
 		"cluster_header": "x-customrouter-cluster",
 		"timeout":        GetRouteTimeout(epa),
 		"request_mirror_policies": []interface{}{
-			buildMirrorPolicy(&entry.Mirror),
+			buildMirrorPolicy(epa, &entry.Mirror),
 		},
 	}
 	ApplyRetryPolicy(routeAction, epa)
+	ApplyProtocolHint(routeAction, entry.Route.ProtocolHint)
+	ApplyHashPolicy(routeAction, entry.Route.HashPolicy)
 
 	return map[string]interface{}{
 		"applyTo": "HTTP_ROUTE",
@@ -230,9 +228,9 @@ func buildMirrorPatch(epa *v1alpha1.ExternalProcessorAttachment, entry *MirrorEn
 // buildMirrorPolicy assembles the request_mirror_policies entry. When Percent
 // is unset the mirror fires for every matched request; when set, runtime_fraction
 // gates it via Envoy's native fractional-percent sampler (denominator HUNDRED).
-func buildMirrorPolicy(m *routes.RouteMirror) map[string]interface{} {
+func buildMirrorPolicy(epa *v1alpha1.ExternalProcessorAttachment, m *routes.RouteMirror) map[string]interface{} {
 	policy := map[string]interface{}{
-		"cluster": BuildClusterName(m.BackendRef),
+		"cluster": RefClusterName(epa, m.BackendRef),
 	}
 	if m.Percent != nil && *m.Percent < 100 {
 		policy["runtime_fraction"] = map[string]interface{}{
@@ -252,6 +250,7 @@ func mirrorRouteName(entry *MirrorEntry) string {
 	h := sha1.New()
 	_, _ = h.Write([]byte(entry.Hostname + "|" + entry.Route.Path + "|" +
 		entry.Route.Type + "|" + entry.Route.Method + "|" +
+		routeSchemeKey(&entry.Route) +
 		BuildClusterName(entry.Mirror.BackendRef) + "|" +
 		percentString(entry.Mirror.Percent)))
 	return "customrouter-mirror-" + hex.EncodeToString(h.Sum(nil))[:12]
@@ -132,7 +132,7 @@ func TestCollectMirrorEntriesExpandsPerHostnameAndMirror(t *testing.T) {
 }
 
 func TestBuildMirrorPolicyIncludesRuntimeFraction(t *testing.T) {
-	p := buildMirrorPolicy(&routes.RouteMirror{
+	p := buildMirrorPolicy(&v1alpha1.ExternalProcessorAttachment{}, &routes.RouteMirror{
 		BackendRef: v1alpha1.BackendRef{Name: "shadow", Namespace: "default", Port: 80},
 		Percent:    int32Ptr(25),
 	})
@@ -147,7 +147,7 @@ func TestBuildMirrorPolicyIncludesRuntimeFraction(t *testing.T) {
 }
 
 func TestBuildMirrorPolicyOmitsRuntimeFractionFor100Percent(t *testing.T) {
-	p := buildMirrorPolicy(&routes.RouteMirror{
+	p := buildMirrorPolicy(&v1alpha1.ExternalProcessorAttachment{}, &routes.RouteMirror{
 		BackendRef: v1alpha1.BackendRef{Name: "shadow", Namespace: "default", Port: 80},
 		Percent:    int32Ptr(100),
 	})
@@ -157,7 +157,7 @@ func TestBuildMirrorPolicyOmitsRuntimeFractionFor100Percent(t *testing.T) {
 }
 
 func TestBuildMirrorPolicyOmitsRuntimeFractionWhenNil(t *testing.T) {
-	p := buildMirrorPolicy(&routes.RouteMirror{
+	p := buildMirrorPolicy(&v1alpha1.ExternalProcessorAttachment{}, &routes.RouteMirror{
 		BackendRef: v1alpha1.BackendRef{Name: "shadow", Namespace: "default", Port: 80},
 	})
 	if _, ok := p["runtime_fraction"]; ok {
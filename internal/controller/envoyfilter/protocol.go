@@ -0,0 +1,420 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoyfilter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const (
+	// ProtocolFilterSuffix is the EnvoyFilter name suffix for protocol-hinted
+	// (WebSocket / SSE) routes, routes with a hash policy and backend
+	// protocols.
+	ProtocolFilterSuffix = "-protocol"
+
+	// protocolPatchPriority keeps protocol patches aligned with mirror and
+	// CORS patches. See mirrorPatchPriority for the rationale.
+	protocolPatchPriority int64 = 10
+
+	// upstreamHTTPProtocolOptionsName and upstreamHTTPProtocolOptionsType
+	// identify the cluster extension selecting the upstream HTTP version.
+	upstreamHTTPProtocolOptionsName = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+	upstreamHTTPProtocolOptionsType = "type.googleapis.com/" + upstreamHTTPProtocolOptionsName
+
+	// streamingRouteTimeout disables the per-request route timeout so
+	// long-lived connections are not cut.
+	streamingRouteTimeout = "0s"
+)
+
+// ProtocolHintEntry is a (hostname, expanded route) tuple whose route carries
+// a protocol hint or a hash policy, ready to be rendered.
+type ProtocolHintEntry struct {
+	Hostname string
+	Route    routes.Route
+}
+
+// CollectProtocolHintEntries iterates every CustomHTTPRoute, expands its rules,
+// and emits one entry per (hostname, route) carrying a protocol hint or a
+// hash policy. The
+// output is sorted deterministically so repeated reconciles produce identical
+// EnvoyFilters.
+func CollectProtocolHintEntries(routeList *v1alpha1.CustomHTTPRouteList) []ProtocolHintEntry {
+	entries := make([]ProtocolHintEntry, 0, len(routeList.Items))
+
+	for i := range routeList.Items {
+		cr := &routeList.Items[i]
+		// A deleted CustomHTTPRoute keeps serving its routes while it drains.
+		if cr.DeletionTimestamp != nil && !cr.DeletionTimestamp.IsZero() && cr.DeletionDrainRemaining(time.Now()) == 0 {
+			continue
+		}
+		if !hasProtocolHints(cr) {
+			continue
+		}
+
+		hostMap, err := routes.ExpandRoutes(cr, nil)
+		if err != nil {
+			continue
+		}
+		for host, rs := range hostMap {
+			for j := range rs {
+				if rs[j].ProtocolHint == "" && rs[j].HashPolicy == nil {
+					continue
+				}
+				entries = append(entries, ProtocolHintEntry{
+					Hostname: host,
+					Route:    rs[j],
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Hostname != entries[j].Hostname {
+			return entries[i].Hostname < entries[j].Hostname
+		}
+		if entries[i].Route.Priority != entries[j].Route.Priority {
+			return entries[i].Route.Priority > entries[j].Route.Priority
+		}
+		if entries[i].Route.Type != entries[j].Route.Type {
+			return typePriority[entries[i].Route.Type] < typePriority[entries[j].Route.Type]
+		}
+		if len(entries[i].Route.Path) != len(entries[j].Route.Path) {
+			return len(entries[i].Route.Path) > len(entries[j].Route.Path)
+		}
+		if entries[i].Route.Path != entries[j].Route.Path {
+			return entries[i].Route.Path < entries[j].Route.Path
+		}
+		if entries[i].Route.Method != entries[j].Route.Method {
+			return entries[i].Route.Method < entries[j].Route.Method
+		}
+		return entries[i].Route.Scheme < entries[j].Route.Scheme
+	})
+
+	return entries
+}
+
+// BackendProtocolEntry is a route backend ("host:port") whose backendRef sets
+// a protocol, rendered as the protocol options of its upstream cluster.
+type BackendProtocolEntry struct {
+	Backend  string
+	Protocol string
+}
+
+// CollectBackendProtocols iterates every CustomHTTPRoute, expands its rules,
+// and emits one entry per backend of the expanded routes that sets a
+// protocol, sorted by backend. Protocols configure clusters shared by every
+// route, so when CustomHTTPRoutes disagree on a backend's protocol the first
+// of them in namespace/name order wins; validation already rejects a
+// disagreement within one CustomHTTPRoute.
+func CollectBackendProtocols(routeList *v1alpha1.CustomHTTPRouteList) []BackendProtocolEntry {
+	items := make([]*v1alpha1.CustomHTTPRoute, 0, len(routeList.Items))
+	for i := range routeList.Items {
+		cr := &routeList.Items[i]
+		// A deleted CustomHTTPRoute keeps serving its routes while it drains.
+		if cr.DeletionTimestamp != nil && !cr.DeletionTimestamp.IsZero() && cr.DeletionDrainRemaining(time.Now()) == 0 {
+			continue
+		}
+		if !HasBackendProtocols(cr) {
+			continue
+		}
+		items = append(items, cr)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	protocols := make(map[string]string)
+	for _, cr := range items {
+		hostMap, err := routes.ExpandRoutes(cr, nil)
+		if err != nil {
+			continue
+		}
+		// Within one CustomHTTPRoute every route agrees on a backend.
+		own := make(map[string]string)
+		for _, rs := range hostMap {
+			for j := range rs {
+				for backend, protocol := range rs[j].BackendProtocols {
+					own[backend] = protocol
+				}
+			}
+		}
+		for backend, protocol := range own {
+			if _, ok := protocols[backend]; !ok {
+				protocols[backend] = protocol
+			}
+		}
+	}
+
+	entries := make([]BackendProtocolEntry, 0, len(protocols))
+	for backend, protocol := range protocols {
+		entries = append(entries, BackendProtocolEntry{Backend: backend, Protocol: protocol})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Backend < entries[j].Backend })
+	return entries
+}
+
+// HasBackendProtocols is a cheap pre-filter reporting whether any backendRef
+// of cr read when expanding its routes sets a protocol.
+func HasBackendProtocols(cr *v1alpha1.CustomHTTPRoute) bool {
+	if o := cr.Spec.OverrideHeader; o != nil {
+		for i := range o.Variants {
+			if o.Variants[i].BackendRef.Protocol != "" {
+				return true
+			}
+		}
+	}
+	if d := cr.Spec.Defaults; d != nil {
+		for i := range d.BackendRefs {
+			if d.BackendRefs[i].Protocol != "" {
+				return true
+			}
+		}
+	}
+	for i := range cr.Spec.Rules {
+		rule := &cr.Spec.Rules[i]
+		for j := range rule.BackendRefs {
+			if rule.BackendRefs[j].Protocol != "" {
+				return true
+			}
+		}
+		if rule.OutlierPolicy != nil && rule.OutlierPolicy.FallbackBackendRef.Protocol != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// UpstreamProtocolOptions returns the typed_extension_protocol_options of a
+// cluster speaking protocol to its endpoints: HTTP/2 for h2 and h2c, HTTP/1.1
+// otherwise. TLS, which h2 also needs, is left to the caller.
+func UpstreamProtocolOptions(protocol string) map[string]interface{} {
+	httpConfig := map[string]interface{}{"http_protocol_options": map[string]interface{}{}}
+	if protocol == v1alpha1.BackendProtocolH2 || protocol == v1alpha1.BackendProtocolH2C {
+		httpConfig = map[string]interface{}{"http2_protocol_options": map[string]interface{}{}}
+	}
+	return map[string]interface{}{
+		upstreamHTTPProtocolOptionsName: map[string]interface{}{
+			"@type":                upstreamHTTPProtocolOptionsType,
+			"explicit_http_config": httpConfig,
+		},
+	}
+}
+
+// BackendClusterName is the name of the cluster the external processor
+// routes backend ("host:port") to, outbound|<port>||<host>, following
+// Istio's naming.
+func BackendClusterName(backend string) string {
+	return routes.ClusterNaming{}.ClusterName(backend)
+}
+
+// ClusterName is the name of the cluster of backend ("host:port") on the
+// Gateway of epa: BackendClusterName, unless epa sets clusterName.
+func ClusterName(epa *v1alpha1.ExternalProcessorAttachment, backend string) string {
+	return routes.ConvertClusterNaming(epa.Spec.ClusterName).ClusterName(backend)
+}
+
+// hasProtocolHints is a cheap pre-filter that skips ExpandRoutes when no rule
+// of the resource sets protocolHints or hashPolicy.
+func hasProtocolHints(cr *v1alpha1.CustomHTTPRoute) bool {
+	for _, rule := range cr.Spec.Rules {
+		if rule.ProtocolHints != "" || rule.HashPolicy != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyProtocolHint adjusts routeAction in place for long-lived connections:
+// the route timeout is disabled, retries are dropped (a retried upgrade or
+// event stream would replay the whole session) and, for WebSocket, the
+// upgrade is enabled on the route. A no-op when hint is empty. Shared with
+// the mirror and CORS builders so a hinted rule keeps its semantics whichever
+// injected route matches first.
+func ApplyProtocolHint(routeAction map[string]interface{}, hint string) {
+	if hint == "" {
+		return
+	}
+	routeAction["timeout"] = streamingRouteTimeout
+	delete(routeAction, "retry_policy")
+	if hint == routes.ProtocolHintWebSocket {
+		routeAction["upgrade_configs"] = []interface{}{
+			map[string]interface{}{
+				"upgrade_type": "websocket",
+			},
+		}
+	}
+}
+
+// ApplyHashPolicy sets the hash_policy of routeAction in place from policy, so
+// Envoy hashes the request on the header or cookie to pick the upstream
+// endpoint. A no-op when policy is nil. Shared with the mirror and CORS
+// builders like ApplyProtocolHint.
+func ApplyHashPolicy(routeAction map[string]interface{}, policy *routes.RouteHashPolicy) {
+	if policy == nil {
+		return
+	}
+	var hash map[string]interface{}
+	if policy.CookieName != "" {
+		cookie := map[string]interface{}{"name": policy.CookieName}
+		if policy.CookieTTL > 0 {
+			cookie["ttl"] = strconv.FormatFloat(policy.CookieTTL.Seconds(), 'f', -1, 64) + "s"
+		}
+		if policy.CookiePath != "" {
+			cookie["path"] = policy.CookiePath
+		}
+		hash = map[string]interface{}{"cookie": cookie}
+	} else {
+		hash = map[string]interface{}{
+			"header": map[string]interface{}{"header_name": policy.Header},
+		}
+	}
+	routeAction["hash_policy"] = []interface{}{hash}
+}
+
+// BuildProtocolEnvoyFilter builds the {epa}-protocol EnvoyFilter. For each
+// entry it emits an HTTP_ROUTE patch inserting an ExtProc-backed route ahead
+// of the generic dynamic route, with the protocol hint and hash policy
+// applied, and for each backend a CLUSTER patch merging its protocol into
+// the backend's outbound cluster.
+func BuildProtocolEnvoyFilter(
+	epa *v1alpha1.ExternalProcessorAttachment,
+	entries []ProtocolHintEntry,
+	backends []BackendProtocolEntry,
+) (*unstructured.Unstructured, error) {
+	filterName := epa.Name + ProtocolFilterSuffix
+
+	ef := &unstructured.Unstructured{}
+	ef.SetGroupVersionKind(GVK)
+	ef.SetName(filterName)
+	ef.SetNamespace(epa.Namespace)
+	ef.SetLabels(StandardLabels(epa.Name))
+	ef.SetOwnerReferences([]metav1.OwnerReference{NewOwnerReference(epa)})
+
+	selectorInterface := SelectorToInterface(epa.WorkloadSelector())
+
+	configPatches := make([]interface{}, 0, len(entries)+len(backends))
+	for i := range entries {
+		configPatches = append(configPatches, buildProtocolPatch(epa, &entries[i]))
+	}
+	for i := range backends {
+		configPatches = append(configPatches, buildBackendProtocolPatch(epa, &backends[i]))
+	}
+
+	spec := map[string]interface{}{
+		"workloadSelector": map[string]interface{}{
+			"labels": selectorInterface,
+		},
+		"priority":      protocolPatchPriority,
+		"configPatches": configPatches,
+	}
+
+	if err := unstructured.SetNestedField(ef.Object, spec, "spec"); err != nil {
+		return nil, fmt.Errorf("failed to set spec: %w", err)
+	}
+
+	return ef, nil
+}
+
+// buildBackendProtocolPatch merges the protocol options of entry into the
+// cluster Istio creates for the backend. The merge replaces the HTTP
+// version Istio derived from the Service port; TLS settings (mesh mTLS or a
+// DestinationRule) are kept.
+func buildBackendProtocolPatch(epa *v1alpha1.ExternalProcessorAttachment, entry *BackendProtocolEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"applyTo": "CLUSTER",
+		"match": map[string]interface{}{
+			"context": "GATEWAY",
+			"cluster": map[string]interface{}{
+				"name": ClusterName(epa, entry.Backend),
+			},
+		},
+		"patch": map[string]interface{}{
+			"operation": "MERGE",
+			"value": map[string]interface{}{
+				"typed_extension_protocol_options": UpstreamProtocolOptions(entry.Protocol),
+			},
+		},
+	}
+}
+
+func buildProtocolPatch(epa *v1alpha1.ExternalProcessorAttachment, entry *ProtocolHintEntry) map[string]interface{} {
+	match := BuildRouteMatch(&entry.Route)
+
+	headers, _ := match["headers"].([]interface{})
+	if matcher := authorityMatcher(entry.Hostname); matcher != nil {
+		headers = append(headers, matcher)
+	}
+	if len(headers) > 0 {
+		match["headers"] = headers
+	}
+	ApplyRoutingDecisionMatch(match, epa)
+
+	routeAction := map[string]interface{}{
+		"cluster_header": "x-customrouter-cluster",
+		"timeout":        GetRouteTimeout(epa),
+	}
+	ApplyRetryPolicy(routeAction, epa)
+	ApplyProtocolHint(routeAction, entry.Route.ProtocolHint)
+	ApplyHashPolicy(routeAction, entry.Route.HashPolicy)
+
+	return map[string]interface{}{
+		"applyTo": "HTTP_ROUTE",
+		"match": map[string]interface{}{
+			"context": "GATEWAY",
+			"routeConfiguration": map[string]interface{}{
+				"vhost": map[string]interface{}{
+					"route": map[string]interface{}{
+						"name": dynamicRouteName,
+					},
+				},
+			},
+		},
+		"patch": map[string]interface{}{
+			"operation": "INSERT_BEFORE",
+			"value": map[string]interface{}{
+				"name":  protocolRouteName(entry),
+				"match": match,
+				"route": routeAction,
+			},
+		},
+	}
+}
+
+// protocolRouteName derives a deterministic, Envoy-safe route name from the
+// entry so re-renders produce byte-identical EnvoyFilters.
+func protocolRouteName(entry *ProtocolHintEntry) string {
+	h := sha1.New()
+	_, _ = h.Write([]byte(entry.Hostname + "|" + entry.Route.Path + "|" +
+		entry.Route.Type + "|" + entry.Route.Method + "|" +
+		routeSchemeKey(&entry.Route) +
+		entry.Route.ProtocolHint))
+	return "customrouter-protocol-" + hex.EncodeToString(h.Sum(nil))[:12]
+}
@@ -0,0 +1,316 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoyfilter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestCollectProtocolHintEntries(t *testing.T) {
+	now := metav1.Now()
+	list := &v1alpha1.CustomHTTPRouteList{
+		Items: []v1alpha1.CustomHTTPRoute{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "hinted"},
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{testHostA, testHostB},
+					Rules: []v1alpha1.Rule{
+						{
+							Matches:       []v1alpha1.PathMatch{{Path: "/ws"}},
+							ProtocolHints: v1alpha1.ProtocolHintWebSocket,
+							BackendRefs:   []v1alpha1.BackendRef{{Name: "ws", Namespace: "default", Port: 80}},
+						},
+						{
+							Matches:     []v1alpha1.PathMatch{{Path: "/api"}},
+							BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 80}},
+						},
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "deleted", DeletionTimestamp: &now},
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{testHostA},
+					Rules: []v1alpha1.Rule{{
+						Matches:       []v1alpha1.PathMatch{{Path: "/events"}},
+						ProtocolHints: v1alpha1.ProtocolHintSSE,
+						BackendRefs:   []v1alpha1.BackendRef{{Name: "events", Namespace: "default", Port: 80}},
+					}},
+				},
+			},
+		},
+	}
+
+	entries := CollectProtocolHintEntries(list)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries (one per hostname of the hinted rule), got %d", len(entries))
+	}
+	for i, want := range []string{testHostA, testHostB} {
+		if entries[i].Hostname != want || entries[i].Route.Path != "/ws" {
+			t.Errorf("entry %d = %s %s, want %s /ws", i, entries[i].Hostname, entries[i].Route.Path, want)
+		}
+	}
+}
+
+func TestApplyProtocolHint(t *testing.T) {
+	tests := []struct {
+		name        string
+		hint        string
+		wantTimeout string
+		wantRetry   bool
+		wantUpgrade bool
+	}{
+		{"no hint keeps the route untouched", "", "30s", true, false},
+		{"websocket disables timeout and retries and upgrades", routes.ProtocolHintWebSocket, "0s", false, true},
+		{"sse disables timeout and retries", routes.ProtocolHintSSE, "0s", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeAction := map[string]interface{}{
+				"cluster_header": testClusterHeaderKey,
+				"timeout":        "30s",
+				"retry_policy":   map[string]interface{}{"num_retries": int64(2)},
+			}
+			ApplyProtocolHint(routeAction, tt.hint)
+
+			if routeAction["timeout"] != tt.wantTimeout {
+				t.Errorf("timeout = %v, want %s", routeAction["timeout"], tt.wantTimeout)
+			}
+			if _, ok := routeAction["retry_policy"]; ok != tt.wantRetry {
+				t.Errorf("retry_policy present = %v, want %v", ok, tt.wantRetry)
+			}
+			if _, ok := routeAction["upgrade_configs"]; ok != tt.wantUpgrade {
+				t.Errorf("upgrade_configs present = %v, want %v", ok, tt.wantUpgrade)
+			}
+		})
+	}
+}
+
+func TestCollectProtocolHintEntriesHashPolicy(t *testing.T) {
+	list := &v1alpha1.CustomHTTPRouteList{
+		Items: []v1alpha1.CustomHTTPRoute{{
+			ObjectMeta: metav1.ObjectMeta{Name: "sticky"},
+			Spec: v1alpha1.CustomHTTPRouteSpec{
+				Hostnames: []string{testHostA},
+				Rules: []v1alpha1.Rule{{
+					Matches:     []v1alpha1.PathMatch{{Path: "/jobs"}},
+					HashPolicy:  &v1alpha1.HashPolicy{Header: "x-queue"},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "workers", Namespace: "default", Port: 80}},
+				}},
+			},
+		}},
+	}
+
+	entries := CollectProtocolHintEntries(list)
+	if len(entries) != 1 || entries[0].Route.HashPolicy == nil || entries[0].Route.HashPolicy.Header != "x-queue" {
+		t.Fatalf("entries = %+v, want the /jobs route with its hash policy", entries)
+	}
+}
+
+func TestApplyHashPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *routes.RouteHashPolicy
+		want   interface{}
+	}{
+		{"no policy keeps the route untouched", nil, nil},
+		{
+			"header",
+			&routes.RouteHashPolicy{Header: "x-session-id"},
+			[]interface{}{map[string]interface{}{
+				"header": map[string]interface{}{"header_name": "x-session-id"},
+			}},
+		},
+		{
+			"cookie without ttl",
+			&routes.RouteHashPolicy{CookieName: "session"},
+			[]interface{}{map[string]interface{}{
+				"cookie": map[string]interface{}{"name": "session"},
+			}},
+		},
+		{
+			"generated cookie",
+			&routes.RouteHashPolicy{CookieName: "session", CookieTTL: time.Hour, CookiePath: "/"},
+			[]interface{}{map[string]interface{}{
+				"cookie": map[string]interface{}{"name": "session", "ttl": "3600s", "path": "/"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeAction := map[string]interface{}{"cluster_header": testClusterHeaderKey}
+			ApplyHashPolicy(routeAction, tt.policy)
+
+			got, ok := routeAction["hash_policy"]
+			if tt.want == nil {
+				if ok {
+					t.Errorf("hash_policy = %v, want none", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hash_policy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildProtocolEnvoyFilter(t *testing.T) {
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "istio-system"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: v1alpha1.GatewayRef{Selector: map[string]string{"istio": "gateway"}},
+		},
+	}
+	entries := []ProtocolHintEntry{{
+		Hostname: testHostA,
+		Route: routes.Route{
+			Path:         "/ws",
+			Type:         routes.RouteTypePrefix,
+			ProtocolHint: routes.ProtocolHintWebSocket,
+		},
+	}}
+
+	obj, err := BuildProtocolEnvoyFilter(epa, entries, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj.GetName() != "gw"+ProtocolFilterSuffix {
+		t.Errorf("name = %q", obj.GetName())
+	}
+
+	patches, _, _ := unstructured.NestedSlice(obj.Object, "spec", "configPatches")
+	if len(patches) != 1 {
+		t.Fatalf("expected 1 patch, got %d", len(patches))
+	}
+	patch := patches[0].(map[string]interface{})["patch"].(map[string]interface{})
+	if patch["operation"] != "INSERT_BEFORE" {
+		t.Errorf("operation = %v", patch["operation"])
+	}
+	route := patch["value"].(map[string]interface{})["route"].(map[string]interface{})
+	if route["timeout"] != streamingRouteTimeout || route["upgrade_configs"] == nil {
+		t.Errorf("route action = %v, want timeout 0s with upgrade_configs", route)
+	}
+}
+
+func TestCollectBackendProtocols(t *testing.T) {
+	grpcRef := v1alpha1.BackendRef{Name: "grpc", Namespace: "default", Port: 9000, Protocol: v1alpha1.BackendProtocolH2C}
+	list := &v1alpha1.CustomHTTPRouteList{
+		Items: []v1alpha1.CustomHTTPRoute{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "z-legacy", Namespace: "apps"},
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{testHostB},
+					Rules: []v1alpha1.Rule{{
+						Matches: []v1alpha1.PathMatch{{Path: "/legacy"}},
+						BackendRefs: []v1alpha1.BackendRef{{
+							Name: "grpc", Namespace: "default", Port: 9000, Protocol: v1alpha1.BackendProtocolHTTP11,
+						}},
+					}},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "a-grpc", Namespace: "apps"},
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					Hostnames: []string{testHostA},
+					Rules: []v1alpha1.Rule{
+						{
+							Matches:     []v1alpha1.PathMatch{{Path: "/grpc"}},
+							BackendRefs: []v1alpha1.BackendRef{grpcRef},
+						},
+						{
+							Matches:     []v1alpha1.PathMatch{{Path: "/web"}},
+							BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 80}},
+						},
+					},
+					OverrideHeader: &v1alpha1.OverrideHeader{
+						Variants: []v1alpha1.RouteVariant{{
+							Name: "next",
+							BackendRef: v1alpha1.BackendRef{
+								Name: "web-next", Namespace: "default", Port: 443, Protocol: v1alpha1.BackendProtocolH2,
+							},
+						}},
+					},
+				},
+			},
+		},
+	}
+
+	got := CollectBackendProtocols(list)
+	want := []BackendProtocolEntry{
+		{Backend: "grpc.default.svc.cluster.local:9000", Protocol: v1alpha1.BackendProtocolH2C},
+		{Backend: "web-next.default.svc.cluster.local:443", Protocol: v1alpha1.BackendProtocolH2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CollectBackendProtocols() = %v, want %v (the first route in namespace/name order wins)", got, want)
+	}
+}
+
+func TestBuildProtocolEnvoyFilterBackendProtocols(t *testing.T) {
+	epa := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "istio-system"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: v1alpha1.GatewayRef{Selector: map[string]string{"istio": "gateway"}},
+		},
+	}
+	backends := []BackendProtocolEntry{
+		{Backend: "grpc.default.svc.cluster.local:9000", Protocol: v1alpha1.BackendProtocolH2C},
+		{Backend: "legacy.default.svc.cluster.local:80", Protocol: v1alpha1.BackendProtocolHTTP11},
+	}
+
+	obj, err := BuildProtocolEnvoyFilter(epa, nil, backends)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	patches, _, _ := unstructured.NestedSlice(obj.Object, "spec", "configPatches")
+	if len(patches) != 2 {
+		t.Fatalf("expected 2 patches, got %d", len(patches))
+	}
+
+	for i, want := range []struct{ cluster, option string }{
+		{"outbound|9000||grpc.default.svc.cluster.local", "http2_protocol_options"},
+		{"outbound|80||legacy.default.svc.cluster.local", "http_protocol_options"},
+	} {
+		patch := patches[i].(map[string]interface{})
+		if patch["applyTo"] != "CLUSTER" {
+			t.Errorf("patch %d applyTo = %v, want CLUSTER", i, patch["applyTo"])
+		}
+		name, _, _ := unstructured.NestedString(patch, "match", "cluster", "name")
+		if name != want.cluster {
+			t.Errorf("patch %d cluster = %q, want %q", i, name, want.cluster)
+		}
+		operation, _, _ := unstructured.NestedString(patch, "patch", "operation")
+		if operation != "MERGE" {
+			t.Errorf("patch %d operation = %q, want MERGE", i, operation)
+		}
+		config, _, _ := unstructured.NestedMap(patch, "patch", "value", "typed_extension_protocol_options",
+			upstreamHTTPProtocolOptionsName, "explicit_http_config")
+		if _, ok := config[want.option]; !ok || len(config) != 1 {
+			t.Errorf("patch %d explicit_http_config = %v, want only %s", i, config, want.option)
+		}
+	}
+}
@@ -18,7 +18,11 @@ package externalprocessorattachment
 
 import (
 	"context"
+	"errors"
 
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -31,6 +35,7 @@ import (
 
 	crv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
 	"github.com/freepik-company/customrouter/internal/controller"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
 )
 
 // ExternalProcessorAttachmentReconciler reconciles a ExternalProcessorAttachment object
@@ -43,8 +48,12 @@ type ExternalProcessorAttachmentReconciler struct {
 // +kubebuilder:rbac:groups=customrouter.freepik.com,resources=externalprocessorattachments/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=customrouter.freepik.com,resources=externalprocessorattachments/finalizers,verbs=update
 // +kubebuilder:rbac:groups=customrouter.freepik.com,resources=customhttproutes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=customrouter.freepik.com,resources=hostnamesets,verbs=get;list;watch
 // +kubebuilder:rbac:groups=networking.istio.io,resources=envoyfilters,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.envoyproxy.io,resources=envoyextensionpolicies;envoypatchpolicies,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -68,8 +77,8 @@ func (r *ExternalProcessorAttachmentReconciler) Reconcile(ctx context.Context, r
 	// 3. Check if the resource instance is marked to be deleted
 	if !attachment.DeletionTimestamp.IsZero() {
 		if controllerutil.ContainsFinalizer(attachment, controller.ResourceFinalizer) {
-			if err = r.deleteEnvoyFilters(ctx, attachment); err != nil {
-				logger.Error(err, "Failed to delete EnvoyFilters", "name", req.Name)
+			if err = r.cleanupProviders(ctx, attachment); err != nil {
+				logger.Error(err, "Failed to delete gateway configuration", "name", req.Name)
 				return result, err
 			}
 
@@ -113,11 +122,16 @@ func (r *ExternalProcessorAttachmentReconciler) Reconcile(ctx context.Context, r
 		}
 	}()
 
-	// 6. Reconcile the EnvoyFilters
-	err = r.reconcileEnvoyFilters(ctx, attachment)
+	// 6. Reconcile the gateway configuration of the selected provider
+	err = r.reconcileProvider(ctx, attachment)
 	if err != nil {
-		r.updateConditionFailed(attachment, err.Error())
-		logger.Error(err, "Failed to reconcile EnvoyFilters", "name", req.Name)
+		var conflict *ef.OwnershipConflictError
+		if errors.As(err, &conflict) {
+			r.updateConditionOwnershipConflict(attachment, err.Error())
+		} else {
+			r.updateConditionFailed(attachment, err.Error())
+		}
+		logger.Error(err, "Failed to reconcile gateway configuration", "name", req.Name, "provider", attachment.EffectiveProvider())
 		return result, err
 	}
 
@@ -132,6 +146,10 @@ func (r *ExternalProcessorAttachmentReconciler) SetupWithManager(mgr ctrl.Manage
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&crv1alpha1.ExternalProcessorAttachment{}).
 		Watches(&gatewayv1.HTTPRoute{}, handler.EnqueueRequestsFromMapFunc(r.findEPAsForHTTPRoute)).
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(r.findEPAsForDeployment)).
+		Watches(&gatewayv1.Gateway{}, handler.EnqueueRequestsFromMapFunc(r.findEPAsForGateway)).
+		Watches(&crv1alpha1.CustomHTTPRoute{}, handler.EnqueueRequestsFromMapFunc(r.findEPAsForCustomHTTPRoute)).
+		Watches(&crv1alpha1.HostnameSet{}, handler.EnqueueRequestsFromMapFunc(r.findEPAsForHostnameSet)).
 		Named("externalprocessorattachment").
 		Complete(r)
 }
@@ -157,3 +175,68 @@ func (r *ExternalProcessorAttachmentReconciler) findEPAsForHTTPRoute(ctx context
 	}
 	return requests
 }
+
+// findEPAsForCustomHTTPRoute enqueues the EPAs whose generated configuration
+// depends on a CustomHTTPRoute: every envoy-gateway EPA, since their
+// EnvoyPatchPolicy carries the clusters of all route backends, and every
+// istio EPA when the route declares a catchAllRoute, since this controller is
+// the only writer of the catch-all EnvoyFilter. Updates map both the old and
+// the new object, so removing a catchAllRoute is seen too.
+func (r *ExternalProcessorAttachmentReconciler) findEPAsForCustomHTTPRoute(ctx context.Context, obj client.Object) []reconcile.Request {
+	route, ok := obj.(*crv1alpha1.CustomHTTPRoute)
+	if !ok {
+		return nil
+	}
+	epaList := &crv1alpha1.ExternalProcessorAttachmentList{}
+	if err := r.List(ctx, epaList); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range epaList.Items {
+		epa := &epaList.Items[i]
+		switch epa.EffectiveProvider() {
+		case crv1alpha1.GatewayProviderEnvoyGateway:
+		case crv1alpha1.GatewayProviderIstio:
+			if route.Spec.CatchAllRoute == nil {
+				continue
+			}
+		default:
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      epa.Name,
+				Namespace: epa.Namespace,
+			},
+		})
+	}
+	return requests
+}
+
+// findEPAsForHostnameSet enqueues the EPAs in the namespace of a HostnameSet
+// whose catchAllRoute selects it. Updates map both the old and the new
+// object, so a set losing the selected labels is seen too.
+func (r *ExternalProcessorAttachmentReconciler) findEPAsForHostnameSet(ctx context.Context, obj client.Object) []reconcile.Request {
+	epaList := &crv1alpha1.ExternalProcessorAttachmentList{}
+	if err := r.List(ctx, epaList, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range epaList.Items {
+		epa := &epaList.Items[i]
+		if epa.Spec.CatchAllRoute == nil || epa.Spec.CatchAllRoute.HostnameSetSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(epa.Spec.CatchAllRoute.HostnameSetSelector)
+		if err != nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      epa.Name,
+				Namespace: epa.Namespace,
+			},
+		})
+	}
+	return requests
+}
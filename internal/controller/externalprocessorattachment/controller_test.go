@@ -12,10 +12,23 @@ package externalprocessorattachment
 
 import (
 	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	earlyheadermutationv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/http/early_header_mutation/header_mutation/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -23,9 +36,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	crv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
 	"github.com/freepik-company/customrouter/internal/controller"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
+	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
 // TestReconcile_FinalizerRemoval_NamespaceGone_DoesNotError is a regression
@@ -156,3 +172,503 @@ func TestReconcile_FinalizerRemoval_RealErrorIsSurfaced(t *testing.T) {
 		t.Fatalf("finalizer should still be present after Forbidden Patch, got none")
 	}
 }
+
+func TestBuildGRPCService_DecisionHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		mode crv1alpha1.DecisionHeadersMode
+		want string
+	}{
+		{"unset adds no metadata", "", ""},
+		{"never", crv1alpha1.DecisionHeadersNever, "never"},
+		{"on debug", crv1alpha1.DecisionHeadersOnDebug, "on-debug"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attachment := &crv1alpha1.ExternalProcessorAttachment{
+				Spec: crv1alpha1.ExternalProcessorAttachmentSpec{DecisionHeaders: tt.mode},
+			}
+			service := buildGRPCService(attachment, "outbound|9001||extproc.default.svc.cluster.local")
+
+			metadata, ok := service["initial_metadata"].([]interface{})
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("unexpected initial_metadata %v", metadata)
+				}
+				return
+			}
+			if !ok || len(metadata) != 1 {
+				t.Fatalf("initial_metadata = %v, want one entry", service["initial_metadata"])
+			}
+			entry := metadata[0].(map[string]interface{})
+			if entry["key"] != routes.DecisionHeadersMetadataKey || entry["value"] != tt.want {
+				t.Errorf("initial_metadata entry = %v, want value %q", entry, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildGRPCService_UnmatchedRequestPolicy(t *testing.T) {
+	attachment := &crv1alpha1.ExternalProcessorAttachment{
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			DecisionHeaders:        crv1alpha1.DecisionHeadersNever,
+			UnmatchedRequestPolicy: crv1alpha1.UnmatchedRequestNotFound,
+		},
+	}
+	service := buildGRPCService(attachment, "outbound|9001||extproc.default.svc.cluster.local")
+
+	metadata, ok := service["initial_metadata"].([]interface{})
+	if !ok || len(metadata) != 2 {
+		t.Fatalf("initial_metadata = %v, want two entries", service["initial_metadata"])
+	}
+	entry := metadata[1].(map[string]interface{})
+	if entry["key"] != routes.UnmatchedPolicyMetadataKey || entry["value"] != routes.UnmatchedNotFound {
+		t.Errorf("initial_metadata entry = %v, want value %q", entry, routes.UnmatchedNotFound)
+	}
+}
+
+func TestBuildGRPCService_PathNormalization(t *testing.T) {
+	attachment := &crv1alpha1.ExternalProcessorAttachment{
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			PathNormalization: &crv1alpha1.PathNormalization{MergeSlashes: true, RejectEncodedSlashes: true},
+		},
+	}
+	service := buildGRPCService(attachment, "outbound|9001||extproc.default.svc.cluster.local")
+
+	metadata, ok := service["initial_metadata"].([]interface{})
+	if !ok || len(metadata) != 1 {
+		t.Fatalf("initial_metadata = %v, want one entry", service["initial_metadata"])
+	}
+	entry := metadata[0].(map[string]interface{})
+	want := "merge-slashes,reject-encoded-slashes"
+	if entry["key"] != routes.PathNormalizationMetadataKey || entry["value"] != want {
+		t.Errorf("initial_metadata entry = %v, want value %q", entry, want)
+	}
+}
+
+func TestBuildGRPCService_ClusterName(t *testing.T) {
+	attachment := &crv1alpha1.ExternalProcessorAttachment{
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			ClusterName: &crv1alpha1.ClusterNameConfig{Template: "{service}.{namespace}:{port}", Domain: "corp.internal"},
+		},
+	}
+	service := buildGRPCService(attachment, "extproc.default:9001")
+
+	metadata, ok := service["initial_metadata"].([]interface{})
+	if !ok || len(metadata) != 2 {
+		t.Fatalf("initial_metadata = %v, want two entries", service["initial_metadata"])
+	}
+	template := metadata[0].(map[string]interface{})
+	if template["key"] != routes.ClusterNameTemplateMetadataKey || template["value"] != "{service}.{namespace}:{port}" {
+		t.Errorf("initial_metadata entry = %v, want the template", template)
+	}
+	domain := metadata[1].(map[string]interface{})
+	if domain["key"] != routes.ClusterDomainMetadataKey || domain["value"] != "corp.internal" {
+		t.Errorf("initial_metadata entry = %v, want the domain", domain)
+	}
+}
+
+func TestBuildGRPCService_VariantSelector(t *testing.T) {
+	attachment := &crv1alpha1.ExternalProcessorAttachment{
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			VariantSelector: &crv1alpha1.VariantSelector{Cookie: "env"},
+		},
+	}
+	service := buildGRPCService(attachment, "extproc.default:9001")
+
+	metadata, ok := service["initial_metadata"].([]interface{})
+	if !ok || len(metadata) != 1 {
+		t.Fatalf("initial_metadata = %v, want one entry", service["initial_metadata"])
+	}
+	cookie := metadata[0].(map[string]interface{})
+	if cookie["key"] != routes.VariantCookieMetadataKey || cookie["value"] != "env" {
+		t.Errorf("initial_metadata entry = %v, want the variant cookie", cookie)
+	}
+}
+
+func TestBuildProcessingMode(t *testing.T) {
+	attachment := &crv1alpha1.ExternalProcessorAttachment{}
+	want := map[string]interface{}{
+		"request_header_mode":   "SEND",
+		"response_header_mode":  "SKIP",
+		"request_body_mode":     "NONE",
+		"response_body_mode":    "NONE",
+		"request_trailer_mode":  "SKIP",
+		"response_trailer_mode": "SKIP",
+	}
+	if got := buildProcessingMode(attachment); !reflect.DeepEqual(got, want) {
+		t.Errorf("default processing_mode = %v, want %v", got, want)
+	}
+
+	attachment.Spec.ProcessingMode = &crv1alpha1.ProcessingMode{
+		ResponseHeaderMode: crv1alpha1.HeaderProcessingModeSend,
+		RequestBodyMode:    crv1alpha1.BodyProcessingModeBufferedPartial,
+	}
+	want["response_header_mode"] = "SEND"
+	want["request_body_mode"] = "BUFFERED_PARTIAL"
+	if got := buildProcessingMode(attachment); !reflect.DeepEqual(got, want) {
+		t.Errorf("processing_mode = %v, want %v", got, want)
+	}
+}
+
+func TestBuildRoutesRouteMatch(t *testing.T) {
+	attachment := &crv1alpha1.ExternalProcessorAttachment{}
+	match := buildRoutesRouteMatch(attachment)
+	if match["prefix"] != "/" {
+		t.Errorf("prefix = %v, want /", match["prefix"])
+	}
+	if _, present := match["headers"]; !present {
+		t.Error("Header mode should match on the cluster header")
+	}
+
+	attachment.Spec.RoutingDecisionMatch = crv1alpha1.RoutingDecisionMatchMetadata
+	match = buildRoutesRouteMatch(attachment)
+	if _, present := match["headers"]; present {
+		t.Error("Metadata mode should not match on the cluster header")
+	}
+	if _, present := match["dynamic_metadata"]; !present {
+		t.Error("Metadata mode should match on dynamic_metadata")
+	}
+}
+
+func TestBuildExtProcTLSCluster(t *testing.T) {
+	const istioCluster = "outbound|9001||extproc.routing.svc.cluster.local"
+	newAttachment := func(tls *crv1alpha1.ExternalProcessorTLS) *crv1alpha1.ExternalProcessorAttachment {
+		return &crv1alpha1.ExternalProcessorAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "istio-system"},
+			Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+				ExternalProcessorRef: crv1alpha1.ExternalProcessorRef{
+					Service: crv1alpha1.ServiceRef{Name: "extproc", Namespace: "routing", Port: 9001},
+					TLS:     tls,
+				},
+			},
+		}
+	}
+
+	if cluster := buildExtProcTLSCluster(newAttachment(nil), istioCluster); cluster != nil {
+		t.Fatalf("expected no cluster without tls, got %v", cluster)
+	}
+
+	tests := []struct {
+		name       string
+		tls        *crv1alpha1.ExternalProcessorTLS
+		wantSNI    string
+		wantClient bool
+	}{
+		{
+			name:    "simple with default sni",
+			tls:     &crv1alpha1.ExternalProcessorTLS{Mode: crv1alpha1.ExternalProcessorTLSSimple, CredentialName: "extproc-tls"},
+			wantSNI: "extproc.routing.svc",
+		},
+		{
+			name: "mutual with explicit sni",
+			tls: &crv1alpha1.ExternalProcessorTLS{
+				Mode: crv1alpha1.ExternalProcessorTLSMutual, CredentialName: "extproc-tls", SNI: "extproc.example.com",
+			},
+			wantSNI:    "extproc.example.com",
+			wantClient: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Decode the added cluster the way Envoy would, so the test sees
+			// the cluster the gateway ends up with, not the patch.
+			raw, err := json.Marshal(buildExtProcTLSCluster(newAttachment(tt.tls), istioCluster))
+			if err != nil {
+				t.Fatalf("failed to marshal cluster: %v", err)
+			}
+			cluster := &clusterv3.Cluster{}
+			if err := protojson.Unmarshal(raw, cluster); err != nil {
+				t.Fatalf("cluster is not a valid Envoy cluster: %v", err)
+			}
+			if err := cluster.ValidateAll(); err != nil {
+				t.Fatalf("cluster fails Envoy validation: %v", err)
+			}
+
+			if cluster.GetName() != extProcTLSClusterPrefix+"|istio-system/gw" {
+				t.Errorf("name = %q, want one per attachment", cluster.GetName())
+			}
+			if len(cluster.GetTransportSocketMatches()) != 0 {
+				t.Errorf("cluster has transport_socket_matches, which take precedence over its transport_socket")
+			}
+			if cluster.GetType() != clusterv3.Cluster_EDS || cluster.GetEdsClusterConfig().GetServiceName() != istioCluster {
+				t.Errorf("endpoints = %v %q, want Istio's EDS for %s",
+					cluster.GetType(), cluster.GetEdsClusterConfig().GetServiceName(), istioCluster)
+			}
+			if _, ok := cluster.GetTypedExtensionProtocolOptions()["envoy.extensions.upstreams.http.v3.HttpProtocolOptions"]; !ok {
+				t.Error("cluster does not speak HTTP/2, which gRPC needs")
+			}
+
+			tlsContext := &tlsv3.UpstreamTlsContext{}
+			if err := cluster.GetTransportSocket().GetTypedConfig().UnmarshalTo(tlsContext); err != nil {
+				t.Fatalf("transport socket is not an UpstreamTlsContext: %v", err)
+			}
+			if tlsContext.GetSni() != tt.wantSNI {
+				t.Errorf("sni = %q, want %s", tlsContext.GetSni(), tt.wantSNI)
+			}
+			validation := tlsContext.GetCommonTlsContext().GetCombinedValidationContext()
+			if got := validation.GetValidationContextSdsSecretConfig().GetName(); got != "kubernetes://extproc-tls-cacert" {
+				t.Errorf("validation secret = %q, want kubernetes://extproc-tls-cacert", got)
+			}
+			sans := validation.GetDefaultValidationContext().GetMatchTypedSubjectAltNames()
+			if len(sans) != 1 || sans[0].GetMatcher().GetExact() != tt.wantSNI {
+				t.Errorf("verified SANs = %v, want %s", sans, tt.wantSNI)
+			}
+			hasClient := len(tlsContext.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs()) > 0
+			if hasClient != tt.wantClient {
+				t.Errorf("client certificate configured = %v, want %v", hasClient, tt.wantClient)
+			}
+		})
+	}
+
+	// The ext_proc filter talks to the added cluster, not Istio's.
+	scheme := runtime.NewScheme()
+	if err := crv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	scheme.AddKnownTypeWithName(ef.GVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(ef.GVK.GroupVersion().WithKind(ef.GVK.Kind+"List"), &unstructured.UnstructuredList{})
+	attachment := newAttachment(tests[0].tls)
+	attachment.Spec.GatewayRef.Selector = map[string]string{"istio": "ingressgateway"}
+	r := &ExternalProcessorAttachmentReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+	if err := r.reconcileExtProcEnvoyFilter(context.Background(), attachment); err != nil {
+		t.Fatalf("reconcileExtProcEnvoyFilter failed: %v", err)
+	}
+	filter := &unstructured.Unstructured{}
+	filter.SetGroupVersionKind(ef.GVK)
+	key := types.NamespacedName{Namespace: attachment.Namespace, Name: attachment.Name + ef.ExtProcFilterSuffix}
+	if err := r.Get(context.Background(), key, filter); err != nil {
+		t.Fatalf("failed to get the ext_proc EnvoyFilter: %v", err)
+	}
+	patches, _, _ := unstructured.NestedSlice(filter.Object, "spec", "configPatches")
+	var grpcCluster, addedCluster string
+	for _, p := range patches {
+		patch := p.(map[string]interface{})
+		if name, ok, _ := unstructured.NestedString(patch,
+			"patch", "value", "typed_config", "grpc_service", "envoy_grpc", "cluster_name"); ok {
+			grpcCluster = name
+		}
+		if op, _, _ := unstructured.NestedString(patch, "patch", "operation"); op == "ADD" && patch["applyTo"] == "CLUSTER" {
+			addedCluster, _, _ = unstructured.NestedString(patch, "patch", "value", "name")
+		}
+		if _, ok, _ := unstructured.NestedMap(patch, "match", "cluster"); ok {
+			t.Errorf("the filter still patches an existing cluster: %v", patch)
+		}
+	}
+	if addedCluster == "" || grpcCluster != addedCluster {
+		t.Errorf("ext_proc cluster = %q, want the added TLS cluster %q", grpcCluster, addedCluster)
+	}
+}
+
+func TestFindEPAsForCustomHTTPRoute(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := crv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	istio := &crv1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "istio", Namespace: "istio-system"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(istio, envoyGatewayAttachment("gateways")).Build()
+	r := &ExternalProcessorAttachmentReconciler{Client: cl, Scheme: scheme}
+
+	names := func(route *crv1alpha1.CustomHTTPRoute) []string {
+		var out []string
+		for _, req := range r.findEPAsForCustomHTTPRoute(context.Background(), route) {
+			out = append(out, req.Namespace+"/"+req.Name)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	route := &crv1alpha1.CustomHTTPRoute{ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: "default"}}
+	if got, want := names(route), []string{"gateways/epa"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without catchAllRoute: got %v, want %v", got, want)
+	}
+	route.Spec.CatchAllRoute = &crv1alpha1.CatchAllBackendRef{
+		BackendRef: crv1alpha1.BackendRef{Name: "svc", Namespace: "default", Port: 80},
+	}
+	if got, want := names(route), []string{"gateways/epa", "istio-system/istio"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with catchAllRoute: got %v, want %v", got, want)
+	}
+}
+
+func TestFindEPAsForHostnameSet(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := crv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	selecting := &crv1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "selecting", Namespace: "istio-system"},
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			CatchAllRoute: &crv1alpha1.CatchAllRouteConfig{
+				HostnameSetSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"group": "countries"}},
+			},
+		},
+	}
+	fixed := &crv1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "fixed", Namespace: "istio-system"},
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			CatchAllRoute: &crv1alpha1.CatchAllRouteConfig{Hostnames: []string{"example.com"}},
+		},
+	}
+	elsewhere := selecting.DeepCopy()
+	elsewhere.Namespace = "gateways"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(selecting, fixed, elsewhere).Build()
+	r := &ExternalProcessorAttachmentReconciler{Client: cl, Scheme: scheme}
+
+	set := &crv1alpha1.HostnameSet{ObjectMeta: metav1.ObjectMeta{
+		Name: "countries", Namespace: "istio-system", Labels: map[string]string{"group": "countries"},
+	}}
+	var got []string
+	for _, req := range r.findEPAsForHostnameSet(context.Background(), set) {
+		got = append(got, req.Namespace+"/"+req.Name)
+	}
+	if want := []string{"istio-system/selecting"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	set.Labels = nil
+	if got := r.findEPAsForHostnameSet(context.Background(), set); len(got) != 0 {
+		t.Errorf("unselected set enqueued %v", got)
+	}
+}
+
+func TestReconcile_OwnershipConflictIsReported(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := crv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	if err := gatewayv1.Install(scheme); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	scheme.AddKnownTypeWithName(ef.GVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(ef.GVK.GroupVersion().WithKind(ef.GVK.Kind+"List"), &unstructured.UnstructuredList{})
+
+	attachment := &crv1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "epa",
+			Namespace:  "istio-system",
+			Finalizers: []string{controller.ResourceFinalizer},
+		},
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: crv1alpha1.GatewayRef{Selector: map[string]string{"istio": "public"}},
+			ExternalProcessorRef: crv1alpha1.ExternalProcessorRef{
+				Service: crv1alpha1.ServiceRef{Name: "extproc", Namespace: "customrouter", Port: 9001},
+			},
+		},
+	}
+	conflictOnApply := interceptor.Funcs{
+		Apply: func(ctx context.Context, c client.WithWatch, obj runtime.ApplyConfiguration, opts ...client.ApplyOption) error {
+			return apierrors.NewApplyConflict([]metav1.StatusCause{{
+				Type:    metav1.CauseTypeFieldManagerConflict,
+				Message: `conflict with "kubectl-edit" using networking.istio.io/v1alpha3`,
+				Field:   ".spec.priority",
+			}}, "Apply failed with 1 conflict")
+		},
+	}
+	cl := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(attachment).
+		WithStatusSubresource(attachment).
+		WithInterceptorFuncs(conflictOnApply).
+		Build()
+	r := &ExternalProcessorAttachmentReconciler{Client: cl, Scheme: scheme}
+
+	key := types.NamespacedName{Name: attachment.Name, Namespace: attachment.Namespace}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err == nil {
+		t.Fatal("Reconcile succeeded, want the ownership conflict returned")
+	}
+
+	got := &crv1alpha1.ExternalProcessorAttachment{}
+	if err := cl.Get(context.Background(), key, got); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, ConditionTypeReady)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "OwnershipConflict" {
+		t.Fatalf("Ready = %+v, want False/OwnershipConflict", cond)
+	}
+	if !strings.Contains(cond.Message, "kubectl-edit") {
+		t.Errorf("message = %q, want the conflicting field manager", cond.Message)
+	}
+}
+
+func TestEdgeHeaderMutation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := crv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	scheme.AddKnownTypeWithName(ef.GVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(ef.GVK.GroupVersion().WithKind(ef.GVK.Kind+"List"), &unstructured.UnstructuredList{})
+	attachment := &crv1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "istio-system"},
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: crv1alpha1.GatewayRef{Selector: map[string]string{"istio": "ingressgateway"}},
+			ExternalProcessorRef: crv1alpha1.ExternalProcessorRef{
+				Service: crv1alpha1.ServiceRef{Name: "extproc", Namespace: "routing", Port: 9001},
+			},
+		},
+	}
+	r := &ExternalProcessorAttachmentReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+	if err := r.reconcileExtProcEnvoyFilter(context.Background(), attachment); err != nil {
+		t.Fatalf("reconcileExtProcEnvoyFilter failed: %v", err)
+	}
+	filter := &unstructured.Unstructured{}
+	filter.SetGroupVersionKind(ef.GVK)
+	key := types.NamespacedName{Namespace: attachment.Namespace, Name: attachment.Name + ef.ExtProcFilterSuffix}
+	if err := r.Get(context.Background(), key, filter); err != nil {
+		t.Fatalf("failed to get the ext_proc EnvoyFilter: %v", err)
+	}
+
+	// The removal must run before route selection, so it is merged into
+	// the connection manager rather than inserted as an HTTP filter.
+	patches, _, _ := unstructured.NestedSlice(filter.Object, "spec", "configPatches")
+	var merged map[string]interface{}
+	for _, p := range patches {
+		patch := p.(map[string]interface{})
+		if _, ok, _ := unstructured.NestedMap(patch, "patch", "value", "typed_config", "mutations"); ok {
+			t.Errorf("header removal still patched in as an HTTP filter: %v", patch)
+		}
+		if patch["applyTo"] == "NETWORK_FILTER" {
+			merged, _, _ = unstructured.NestedMap(patch, "patch", "value", "typed_config")
+		}
+	}
+	if merged == nil {
+		t.Fatal("no connection manager patch")
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		t.Fatalf("failed to marshal the patch: %v", err)
+	}
+	typed := &anypb.Any{}
+	if err := protojson.Unmarshal(raw, typed); err != nil {
+		t.Fatalf("patch is not a valid Envoy config: %v", err)
+	}
+	manager := &hcmv3.HttpConnectionManager{}
+	if err := typed.UnmarshalTo(manager); err != nil {
+		t.Fatalf("patch is not a connection manager config: %v", err)
+	}
+	extensions := manager.GetEarlyHeaderMutationExtensions()
+	if len(extensions) != 1 {
+		t.Fatalf("early header mutations = %v, want the edge header removal", extensions)
+	}
+	if err := extensions[0].ValidateAll(); err != nil {
+		t.Fatalf("early header mutation fails Envoy validation: %v", err)
+	}
+	mutation := &earlyheadermutationv3.HeaderMutation{}
+	if err := extensions[0].GetTypedConfig().UnmarshalTo(mutation); err != nil {
+		t.Fatalf("early header mutation is not a header_mutation: %v", err)
+	}
+	removed := map[string]bool{}
+	for _, m := range mutation.GetMutations() {
+		removed[m.GetRemove()] = true
+	}
+	for _, name := range []string{"x-customrouter-cluster", "x-customrouter-matched-path", "x-original-authority"} {
+		if !removed[name] {
+			t.Errorf("%s not removed at the edge, removed %v", name, removed)
+		}
+	}
+	if removed["x-customrouter-debug"] {
+		t.Error("debug header removed before the processor could read it")
+	}
+}
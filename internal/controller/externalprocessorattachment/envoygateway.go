@@ -0,0 +1,436 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalprocessorattachment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// Envoy Gateway policy kinds generated for provider envoy-gateway. The
+// policies are named like the EnvoyFilters they replace: <attachment>-extproc
+// and <attachment>-routes.
+var (
+	extensionPolicyGVK = schema.GroupVersionKind{
+		Group:   "gateway.envoyproxy.io",
+		Version: "v1alpha1",
+		Kind:    "EnvoyExtensionPolicy",
+	}
+	patchPolicyGVK = schema.GroupVersionKind{
+		Group:   "gateway.envoyproxy.io",
+		Version: "v1alpha1",
+		Kind:    "EnvoyPatchPolicy",
+	}
+)
+
+// backendConnectTimeout is the connect timeout of the backend clusters the
+// routes EnvoyPatchPolicy adds, and of the extproc TLS cluster on Istio.
+const backendConnectTimeout = "5s"
+
+// envoyGatewayProvider generates an EnvoyExtensionPolicy that inserts the
+// external processor and an EnvoyPatchPolicy that adds the dynamic route and
+// the clusters it forwards to, both targeting the Gateway named by
+// spec.gatewayRef.name.
+type envoyGatewayProvider struct {
+	r *ExternalProcessorAttachmentReconciler
+}
+
+func (p envoyGatewayProvider) reconcile(ctx context.Context, attachment *v1alpha1.ExternalProcessorAttachment) error {
+	logger := log.FromContext(ctx)
+	attachment.Status.GatewaySelector = nil
+	attachment.Status.AdditionalGatewaySelectors = nil
+
+	gatewayKey := types.NamespacedName{
+		Name:      attachment.Spec.GatewayRef.Name,
+		Namespace: attachment.GatewayNamespace(),
+	}
+	if gatewayKey.Name == "" {
+		return fmt.Errorf("provider %s requires gatewayRef.name", v1alpha1.GatewayProviderEnvoyGateway)
+	}
+	gateway := &gatewayv1.Gateway{}
+	if err := p.r.Get(ctx, gatewayKey, gateway); err != nil {
+		return fmt.Errorf("failed to get Gateway %s: %w", gatewayKey, err)
+	}
+
+	routeList := &v1alpha1.CustomHTTPRouteList{}
+	if err := p.r.List(ctx, routeList); err != nil {
+		return fmt.Errorf("failed to list CustomHTTPRoutes: %w", err)
+	}
+
+	extension, err := buildExtensionPolicy(attachment, gateway)
+	if err != nil {
+		return fmt.Errorf("failed to build EnvoyExtensionPolicy: %w", err)
+	}
+	if err := ef.UpsertUnstructured(ctx, p.r.Client, extension); err != nil {
+		return fmt.Errorf("failed to reconcile EnvoyExtensionPolicy: %w", err)
+	}
+
+	patch, err := buildPatchPolicy(attachment, gateway, collectBackendClusters(attachment, routeList))
+	if err != nil {
+		return fmt.Errorf("failed to build EnvoyPatchPolicy: %w", err)
+	}
+	if err := ef.UpsertUnstructured(ctx, p.r.Client, patch); err != nil {
+		return fmt.Errorf("failed to reconcile EnvoyPatchPolicy: %w", err)
+	}
+
+	if attachment.Spec.CatchAllRoute != nil || len(ef.CollectCatchAllEntries(routeList)) > 0 ||
+		len(ef.CollectMirrorEntries(routeList)) > 0 || len(ef.CollectCORSEntries(routeList)) > 0 ||
+		len(ef.CollectProtocolHintEntries(routeList)) > 0 {
+		logger.Info("catch-all routes, mirrors, CORS, protocol hints and hash policies are only generated for provider istio",
+			"name", attachment.Name, "provider", v1alpha1.GatewayProviderEnvoyGateway)
+	}
+
+	logger.Info("Envoy Gateway policies reconciled successfully",
+		"gateway", gatewayKey.String(),
+		"extension", extension.GetName(),
+		"patch", patch.GetName())
+	return nil
+}
+
+func (p envoyGatewayProvider) cleanup(ctx context.Context, attachment *v1alpha1.ExternalProcessorAttachment) error {
+	namespace := attachment.GatewayNamespace()
+	policies := []struct {
+		gvk  schema.GroupVersionKind
+		name string
+	}{
+		{extensionPolicyGVK, attachment.Name + ef.ExtProcFilterSuffix},
+		{patchPolicyGVK, attachment.Name + ef.RoutesFilterSuffix},
+	}
+	for _, policy := range policies {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(policy.gvk)
+		obj.SetName(policy.name)
+		obj.SetNamespace(namespace)
+		if err := p.r.Delete(ctx, obj); ignoreNoMatch(err) != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s %s: %w", policy.gvk.Kind, policy.name, err)
+		}
+	}
+	return nil
+}
+
+// newGatewayPolicy returns an empty Envoy Gateway policy of the given kind
+// for attachment. Policies must live in the Gateway's namespace; they are
+// only owned by the attachment when it lives there too, since owner
+// references cannot cross namespaces.
+func newGatewayPolicy(
+	attachment *v1alpha1.ExternalProcessorAttachment,
+	gvk schema.GroupVersionKind,
+	suffix string,
+) *unstructured.Unstructured {
+	policy := &unstructured.Unstructured{}
+	policy.SetGroupVersionKind(gvk)
+	policy.SetName(attachment.Name + suffix)
+	policy.SetNamespace(attachment.GatewayNamespace())
+	policy.SetLabels(ef.StandardLabels(attachment.Name))
+	if attachment.GatewayNamespace() == attachment.Namespace {
+		policy.SetOwnerReferences([]metav1.OwnerReference{ef.NewOwnerReference(attachment)})
+	}
+	return policy
+}
+
+// gatewayTargetRef is the policy target reference to gateway.
+func gatewayTargetRef(gateway *gatewayv1.Gateway) map[string]interface{} {
+	return map[string]interface{}{
+		"group": gatewayv1.GroupName,
+		"kind":  "Gateway",
+		"name":  gateway.Name,
+	}
+}
+
+// buildExtensionPolicy builds the EnvoyExtensionPolicy inserting the external
+// processor in front of every route of gateway.
+func buildExtensionPolicy(attachment *v1alpha1.ExternalProcessorAttachment, gateway *gatewayv1.Gateway) (*unstructured.Unstructured, error) {
+	svcRef := attachment.Spec.ExternalProcessorRef.Service
+	extProc := map[string]interface{}{
+		"backendRefs": []interface{}{
+			map[string]interface{}{
+				"name":      svcRef.Name,
+				"namespace": svcRef.Namespace,
+				"port":      int64(svcRef.Port),
+			},
+		},
+		"failOpen":       attachment.Spec.ExternalProcessorRef.FailureModeAllow,
+		"messageTimeout": getMessageTimeout(attachment),
+		"processingMode": buildGatewayProcessingMode(attachment),
+	}
+	// Envoy Gateway drops dynamic metadata from the processor unless its
+	// namespace is writable, which Metadata matching depends on.
+	if attachment.Spec.RoutingDecisionMatch == v1alpha1.RoutingDecisionMatchMetadata {
+		extProc["metadata"] = map[string]interface{}{
+			"writableNamespaces": []interface{}{routes.RoutingMetadataNamespace},
+		}
+	}
+
+	policy := newGatewayPolicy(attachment, extensionPolicyGVK, ef.ExtProcFilterSuffix)
+	spec := map[string]interface{}{
+		"targetRefs": []interface{}{gatewayTargetRef(gateway)},
+		"extProc":    []interface{}{extProc},
+	}
+	if err := unstructured.SetNestedField(policy.Object, spec, "spec"); err != nil {
+		return nil, fmt.Errorf("failed to set spec: %w", err)
+	}
+	return policy, nil
+}
+
+// buildGatewayProcessingMode returns the processingMode of the
+// EnvoyExtensionPolicy. Envoy Gateway sends the request headers, plus the
+// body when request has a body mode, and sends the response headers
+// whenever response is set, so a response body mode also sends them.
+func buildGatewayProcessingMode(attachment *v1alpha1.ExternalProcessorAttachment) map[string]interface{} {
+	mode := getProcessingMode(attachment)
+	request := map[string]interface{}{}
+	if mode.RequestBodyMode != v1alpha1.BodyProcessingModeNone {
+		request["body"] = string(mode.RequestBodyMode)
+	}
+	processingMode := map[string]interface{}{
+		"request": request,
+		// Lets routes with an outlier policy ask for their response
+		// headers, as on the Istio EnvoyFilter.
+		"allowModeOverride": true,
+	}
+	if mode.ResponseHeaderMode == v1alpha1.HeaderProcessingModeSend ||
+		mode.ResponseBodyMode != v1alpha1.BodyProcessingModeNone {
+		response := map[string]interface{}{}
+		if mode.ResponseBodyMode != v1alpha1.BodyProcessingModeNone {
+			response["body"] = string(mode.ResponseBodyMode)
+		}
+		processingMode["response"] = response
+	}
+	return processingMode
+}
+
+// buildPatchPolicy builds the EnvoyPatchPolicy that inserts the dynamic route
+// first in every virtual host of gateway's HTTP listeners, and adds the
+// clusters the route forwards to under the names the external processor
+// emits (outbound|<port>||<host>), which Envoy Gateway does not otherwise
+// create.
+func buildPatchPolicy(
+	attachment *v1alpha1.ExternalProcessorAttachment,
+	gateway *gatewayv1.Gateway,
+	clusters []backendCluster,
+) (*unstructured.Unstructured, error) {
+	route := DynamicRoute(attachment)
+
+	patches := make([]interface{}, 0)
+	for _, name := range routeConfigurationNames(gateway) {
+		patches = append(patches, map[string]interface{}{
+			"type": "type.googleapis.com/envoy.config.route.v3.RouteConfiguration",
+			"name": name,
+			"operation": map[string]interface{}{
+				"op":       "add",
+				"jsonPath": "$.virtual_hosts[*].routes",
+				"path":     "/0",
+				"value":    route,
+			},
+		})
+	}
+	for _, c := range clusters {
+		patches = append(patches, map[string]interface{}{
+			"type": "type.googleapis.com/envoy.config.cluster.v3.Cluster",
+			"name": c.name,
+			"operation": map[string]interface{}{
+				"op":    "add",
+				"path":  "",
+				"value": c.envoyCluster(),
+			},
+		})
+	}
+
+	policy := newGatewayPolicy(attachment, patchPolicyGVK, ef.RoutesFilterSuffix)
+	spec := map[string]interface{}{
+		"targetRef":   gatewayTargetRef(gateway),
+		"type":        "JSONPatch",
+		"jsonPatches": patches,
+	}
+	if err := unstructured.SetNestedField(policy.Object, spec, "spec"); err != nil {
+		return nil, fmt.Errorf("failed to set spec: %w", err)
+	}
+	return policy, nil
+}
+
+// routeConfigurationNames returns the names Envoy Gateway gives the route
+// configurations of gateway's HTTP and HTTPS listeners,
+// <namespace>/<gateway>/<listener>. Listeners sharing a port share the route
+// configuration of the first of them.
+func routeConfigurationNames(gateway *gatewayv1.Gateway) []string {
+	seenPorts := make(map[gatewayv1.PortNumber]bool)
+	var names []string
+	for _, listener := range gateway.Spec.Listeners {
+		if listener.Protocol != gatewayv1.HTTPProtocolType && listener.Protocol != gatewayv1.HTTPSProtocolType {
+			continue
+		}
+		if seenPorts[listener.Port] {
+			continue
+		}
+		seenPorts[listener.Port] = true
+		names = append(names, fmt.Sprintf("%s/%s/%s", gateway.Namespace, gateway.Name, listener.Name))
+	}
+	return names
+}
+
+// backendCluster is an upstream the external processor can route to.
+type backendCluster struct {
+	name string
+	host string
+	port int64
+
+	// protocol is the backendRef protocol of the backend, or empty for
+	// Envoy's default of HTTP/1.1 without TLS.
+	protocol string
+}
+
+// envoyCluster returns the Envoy cluster resolving the backend through DNS.
+// A protocol selects the upstream HTTP version; h2 also originates TLS,
+// offering h2 through ALPN and sending the backend host as SNI.
+func (c backendCluster) envoyCluster() map[string]interface{} {
+	cluster := map[string]interface{}{
+		"name":            c.name,
+		"type":            "STRICT_DNS",
+		"connect_timeout": backendConnectTimeout,
+		"lb_policy":       "ROUND_ROBIN",
+		"load_assignment": map[string]interface{}{
+			"cluster_name": c.name,
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"lb_endpoints": []interface{}{
+						map[string]interface{}{
+							"endpoint": map[string]interface{}{
+								"address": map[string]interface{}{
+									"socket_address": map[string]interface{}{
+										"address":    c.host,
+										"port_value": c.port,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if c.protocol != "" {
+		cluster["typed_extension_protocol_options"] = ef.UpstreamProtocolOptions(c.protocol)
+	}
+	if c.protocol == v1alpha1.BackendProtocolH2 {
+		cluster["transport_socket"] = map[string]interface{}{
+			"name": "envoy.transport_sockets.tls",
+			"typed_config": map[string]interface{}{
+				"@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext",
+				"sni":   c.host,
+				"common_tls_context": map[string]interface{}{
+					"alpn_protocols": []interface{}{v1alpha1.BackendProtocolH2},
+				},
+			},
+		}
+	}
+	return cluster
+}
+
+// collectBackendClusters returns the backends, including override variants,
+// of every route expanded from routeList, with their protocol, sorted by
+// cluster name, named as attachment sets.
+func collectBackendClusters(attachment *v1alpha1.ExternalProcessorAttachment, routeList *v1alpha1.CustomHTTPRouteList) []backendCluster {
+	protocols := make(map[string]string)
+	for _, entry := range ef.CollectBackendProtocols(routeList) {
+		protocols[entry.Backend] = entry.Protocol
+	}
+
+	byName := make(map[string]backendCluster)
+	add := func(backend string) {
+		if backend == "" {
+			return
+		}
+		host, port := (&routes.Route{Backend: backend}).ParseBackend()
+		portNumber, err := strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			return
+		}
+		name := ef.ClusterName(attachment, backend)
+		byName[name] = backendCluster{name: name, host: host, port: portNumber, protocol: protocols[backend]}
+	}
+
+	for i := range routeList.Items {
+		cr := &routeList.Items[i]
+		// A deleted CustomHTTPRoute keeps serving its routes while it drains.
+		if cr.DeletionTimestamp != nil && !cr.DeletionTimestamp.IsZero() && cr.DeletionDrainRemaining(time.Now()) == 0 {
+			continue
+		}
+		hostMap, err := routes.ExpandRoutes(cr, nil)
+		if err != nil {
+			continue
+		}
+		for _, rs := range hostMap {
+			for j := range rs {
+				if rs[j].UnmatchedPolicy != "" {
+					continue
+				}
+				add(rs[j].Backend)
+				for _, backend := range rs[j].Overrides {
+					add(backend)
+				}
+			}
+		}
+	}
+
+	clusters := make([]backendCluster, 0, len(byName))
+	for _, c := range byName {
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].name < clusters[j].name })
+	return clusters
+}
+
+// findEPAsForGateway enqueues the EPAs naming a Gateway, so envoy-gateway
+// EPAs follow its listeners and EPAs waiting for it are resolved once it is
+// created.
+func (r *ExternalProcessorAttachmentReconciler) findEPAsForGateway(ctx context.Context, obj client.Object) []reconcile.Request {
+	epaList := &v1alpha1.ExternalProcessorAttachmentList{}
+	if err := r.List(ctx, epaList); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range epaList.Items {
+		epa := &epaList.Items[i]
+		if !referencesGateway(epa, obj.GetName(), obj.GetNamespace()) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      epa.Name,
+				Namespace: epa.Namespace,
+			},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalprocessorattachment
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	crv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func envoyGatewayAttachment(namespace string) *crv1alpha1.ExternalProcessorAttachment {
+	return &crv1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "epa", Namespace: namespace},
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			Provider:   crv1alpha1.GatewayProviderEnvoyGateway,
+			GatewayRef: crv1alpha1.GatewayRef{Name: "public", Namespace: "gateways"},
+			ExternalProcessorRef: crv1alpha1.ExternalProcessorRef{
+				Service: crv1alpha1.ServiceRef{Name: "extproc", Namespace: "customrouter", Port: 9001},
+			},
+		},
+	}
+}
+
+func publicGateway() *gatewayv1.Gateway {
+	return &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "gateways"},
+		Spec: gatewayv1.GatewaySpec{
+			Listeners: []gatewayv1.Listener{
+				{Name: "http", Port: 80, Protocol: gatewayv1.HTTPProtocolType},
+				{Name: "https-a", Port: 443, Protocol: gatewayv1.HTTPSProtocolType},
+				{Name: "https-b", Port: 443, Protocol: gatewayv1.HTTPSProtocolType},
+				{Name: "tcp", Port: 5432, Protocol: gatewayv1.TCPProtocolType},
+			},
+		},
+	}
+}
+
+func TestBuildExtensionPolicy(t *testing.T) {
+	attachment := envoyGatewayAttachment("gateways")
+	attachment.Spec.RoutingDecisionMatch = crv1alpha1.RoutingDecisionMatchMetadata
+
+	policy, err := buildExtensionPolicy(attachment, publicGateway())
+	if err != nil {
+		t.Fatalf("buildExtensionPolicy: %v", err)
+	}
+	if policy.GetNamespace() != "gateways" || policy.GetName() != "epa-extproc" {
+		t.Errorf("policy = %s/%s, want gateways/epa-extproc", policy.GetNamespace(), policy.GetName())
+	}
+	if len(policy.GetOwnerReferences()) != 1 {
+		t.Errorf("policy in the attachment namespace must be owned by it, got %v", policy.GetOwnerReferences())
+	}
+
+	extProcs, _, _ := unstructured.NestedSlice(policy.Object, "spec", "extProc")
+	if len(extProcs) != 1 {
+		t.Fatalf("extProc = %v, want 1 entry", extProcs)
+	}
+	extProc := extProcs[0].(map[string]interface{})
+	backend := extProc["backendRefs"].([]interface{})[0]
+	wantBackend := map[string]interface{}{"name": "extproc", "namespace": "customrouter", "port": int64(9001)}
+	if !reflect.DeepEqual(backend, wantBackend) {
+		t.Errorf("backendRef = %v, want %v", backend, wantBackend)
+	}
+	namespaces, _, _ := unstructured.NestedStringSlice(extProc, "metadata", "writableNamespaces")
+	if !reflect.DeepEqual(namespaces, []string{"customrouter"}) {
+		t.Errorf("writableNamespaces = %v, want [customrouter]", namespaces)
+	}
+
+	other, err := buildExtensionPolicy(envoyGatewayAttachment("apps"), publicGateway())
+	if err != nil {
+		t.Fatalf("buildExtensionPolicy: %v", err)
+	}
+	if other.GetNamespace() != "gateways" || len(other.GetOwnerReferences()) != 0 {
+		t.Errorf("policy for an attachment in another namespace = %s with owners %v, want gateways without owners",
+			other.GetNamespace(), other.GetOwnerReferences())
+	}
+}
+
+func TestBuildGatewayProcessingMode(t *testing.T) {
+	attachment := envoyGatewayAttachment("gateways")
+	want := map[string]interface{}{
+		"request":           map[string]interface{}{},
+		"allowModeOverride": true,
+	}
+	if got := buildGatewayProcessingMode(attachment); !reflect.DeepEqual(got, want) {
+		t.Errorf("default processingMode = %v, want %v", got, want)
+	}
+
+	attachment.Spec.ProcessingMode = &crv1alpha1.ProcessingMode{
+		RequestBodyMode:  crv1alpha1.BodyProcessingModeBuffered,
+		ResponseBodyMode: crv1alpha1.BodyProcessingModeStreamed,
+	}
+	want = map[string]interface{}{
+		"request":           map[string]interface{}{"body": "Buffered"},
+		"response":          map[string]interface{}{"body": "Streamed"},
+		"allowModeOverride": true,
+	}
+	if got := buildGatewayProcessingMode(attachment); !reflect.DeepEqual(got, want) {
+		t.Errorf("processingMode = %v, want %v", got, want)
+	}
+
+	attachment.Spec.ProcessingMode = &crv1alpha1.ProcessingMode{ResponseHeaderMode: crv1alpha1.HeaderProcessingModeSend}
+	got := buildGatewayProcessingMode(attachment)
+	if !reflect.DeepEqual(got["response"], map[string]interface{}{}) {
+		t.Errorf("response = %v, want an empty response sending the headers", got["response"])
+	}
+}
+
+func TestBuildPatchPolicy(t *testing.T) {
+	clusters := []backendCluster{{name: "outbound|80||api.default.svc.cluster.local", host: "api.default.svc.cluster.local", port: 80}}
+
+	policy, err := buildPatchPolicy(envoyGatewayAttachment("gateways"), publicGateway(), clusters)
+	if err != nil {
+		t.Fatalf("buildPatchPolicy: %v", err)
+	}
+	patches, _, _ := unstructured.NestedSlice(policy.Object, "spec", "jsonPatches")
+
+	var routeConfigs, clusterNames []string
+	for _, p := range patches {
+		patch := p.(map[string]interface{})
+		switch patch["type"] {
+		case "type.googleapis.com/envoy.config.route.v3.RouteConfiguration":
+			routeConfigs = append(routeConfigs, patch["name"].(string))
+		case "type.googleapis.com/envoy.config.cluster.v3.Cluster":
+			clusterNames = append(clusterNames, patch["name"].(string))
+		}
+	}
+	if want := []string{"gateways/public/http", "gateways/public/https-a"}; !reflect.DeepEqual(routeConfigs, want) {
+		t.Errorf("route configurations = %v, want %v", routeConfigs, want)
+	}
+	if want := []string{"outbound|80||api.default.svc.cluster.local"}; !reflect.DeepEqual(clusterNames, want) {
+		t.Errorf("clusters = %v, want %v", clusterNames, want)
+	}
+}
+
+func TestCollectBackendClusters(t *testing.T) {
+	now := metav1.Now()
+	route := func(name, backend string, deleted bool) crv1alpha1.CustomHTTPRoute {
+		cr := crv1alpha1.CustomHTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: crv1alpha1.CustomHTTPRouteSpec{
+				Hostnames: []string{"example.com"},
+				Rules: []crv1alpha1.Rule{{
+					Matches:     []crv1alpha1.PathMatch{{Path: "/" + name}},
+					BackendRefs: []crv1alpha1.BackendRef{{Name: backend, Namespace: "default", Port: 8080}},
+				}},
+			},
+		}
+		if deleted {
+			cr.DeletionTimestamp = &now
+		}
+		return cr
+	}
+	list := &crv1alpha1.CustomHTTPRouteList{Items: []crv1alpha1.CustomHTTPRoute{
+		route("b", "web", false),
+		route("a", "api", false),
+		route("c", "api", false),
+		route("gone", "old", true),
+	}}
+	list.Items[0].Spec.Rules[0].BackendRefs[0].Protocol = crv1alpha1.BackendProtocolH2C
+
+	got := collectBackendClusters(&crv1alpha1.ExternalProcessorAttachment{}, list)
+	want := []backendCluster{
+		{name: "outbound|8080||api.default.svc.cluster.local", host: "api.default.svc.cluster.local", port: 8080},
+		{
+			name: "outbound|8080||web.default.svc.cluster.local", host: "web.default.svc.cluster.local", port: 8080,
+			protocol: crv1alpha1.BackendProtocolH2C,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectBackendClusters() = %+v, want %+v", got, want)
+	}
+
+	named := &crv1alpha1.ExternalProcessorAttachment{Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+		ClusterName: &crv1alpha1.ClusterNameConfig{Template: "{namespace}/{service}:{port}"},
+	}}
+	got = collectBackendClusters(named, list)
+	if len(got) != 2 || got[0].name != "default/api:8080" || got[1].name != "default/web:8080" {
+		t.Errorf("collectBackendClusters() with a cluster name template = %+v", got)
+	}
+}
+
+func TestBackendClusterProtocol(t *testing.T) {
+	tests := []struct {
+		protocol   string
+		wantOption string
+		wantTLS    bool
+	}{
+		{protocol: ""},
+		{protocol: crv1alpha1.BackendProtocolHTTP11, wantOption: "http_protocol_options"},
+		{protocol: crv1alpha1.BackendProtocolH2C, wantOption: "http2_protocol_options"},
+		{protocol: crv1alpha1.BackendProtocolH2, wantOption: "http2_protocol_options", wantTLS: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			cluster := backendCluster{
+				name: "outbound|443||api.example.com", host: "api.example.com", port: 443, protocol: tt.protocol,
+			}.envoyCluster()
+
+			config, _, _ := unstructured.NestedMap(cluster, "typed_extension_protocol_options",
+				"envoy.extensions.upstreams.http.v3.HttpProtocolOptions", "explicit_http_config")
+			if tt.wantOption == "" {
+				if _, ok := cluster["typed_extension_protocol_options"]; ok {
+					t.Errorf("typed_extension_protocol_options set without a protocol: %v", cluster)
+				}
+			} else if _, ok := config[tt.wantOption]; !ok {
+				t.Errorf("explicit_http_config = %v, want %s", config, tt.wantOption)
+			}
+
+			sni, _, _ := unstructured.NestedString(cluster, "transport_socket", "typed_config", "sni")
+			alpn, _, _ := unstructured.NestedSlice(cluster, "transport_socket", "typed_config",
+				"common_tls_context", "alpn_protocols")
+			if tt.wantTLS {
+				if sni != "api.example.com" || !reflect.DeepEqual(alpn, []interface{}{"h2"}) {
+					t.Errorf("transport_socket sni = %q, alpn = %v, want api.example.com and [h2]", sni, alpn)
+				}
+			} else if _, ok := cluster["transport_socket"]; ok {
+				t.Errorf("unexpected transport_socket for protocol %q", tt.protocol)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalprocessorattachment
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	crv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// resolveGatewaySelector records in status.gatewaySelector the workload
+// labels of the Gateway named by spec.gatewayRef.name: the selector of the
+// Deployment Istio manages for it. It clears the field when the attachment
+// uses a label selector instead. The Gateways named by
+// spec.additionalGatewayRefs are resolved the same way into
+// status.additionalGatewaySelectors.
+func (r *ExternalProcessorAttachmentReconciler) resolveGatewaySelector(
+	ctx context.Context,
+	attachment *crv1alpha1.ExternalProcessorAttachment,
+) error {
+	selector, err := r.resolveGatewayRef(ctx, attachment, attachment.Spec.GatewayRef)
+	if err != nil {
+		return err
+	}
+	attachment.Status.GatewaySelector = selector
+
+	var additional []map[string]string
+	for _, ref := range attachment.Spec.AdditionalGatewayRefs {
+		selector, err := r.resolveGatewayRef(ctx, attachment, ref)
+		if err != nil {
+			return err
+		}
+		additional = append(additional, selector)
+	}
+	attachment.Status.AdditionalGatewaySelectors = additional
+	return nil
+}
+
+// resolveGatewayRef returns the workload labels of the Gateway named by ref,
+// one of the Gateway references of attachment, or nil when ref is a label
+// selector.
+func (r *ExternalProcessorAttachmentReconciler) resolveGatewayRef(
+	ctx context.Context,
+	attachment *crv1alpha1.ExternalProcessorAttachment,
+	ref crv1alpha1.GatewayRef,
+) (map[string]string, error) {
+	if ref.Name == "" {
+		return nil, nil
+	}
+	namespace := attachment.GatewayRefNamespace(ref)
+
+	gateway := &gatewayv1.Gateway{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, gateway); err != nil {
+		return nil, fmt.Errorf("failed to get Gateway %s/%s: %w", namespace, ref.Name, err)
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deployments,
+		client.InNamespace(namespace),
+		client.MatchingLabels{crv1alpha1.GatewayNameLabel: ref.Name},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list Deployments of Gateway %s/%s: %w", namespace, ref.Name, err)
+	}
+	if len(deployments.Items) != 1 {
+		return nil, fmt.Errorf("found %d Deployments labeled %s=%s in namespace %s, want exactly 1",
+			len(deployments.Items), crv1alpha1.GatewayNameLabel, ref.Name, namespace)
+	}
+
+	deployment := &deployments.Items[0]
+	if deployment.Spec.Selector == nil || len(deployment.Spec.Selector.MatchLabels) == 0 {
+		return nil, fmt.Errorf("deployment %s/%s of Gateway %s has no matchLabels selector",
+			deployment.Namespace, deployment.Name, ref.Name)
+	}
+	return maps.Clone(deployment.Spec.Selector.MatchLabels), nil
+}
+
+// findEPAsForDeployment enqueues the EPAs referencing the Gateway a
+// Deployment is managed for, so they pick up its selector once it is created
+// or changed.
+func (r *ExternalProcessorAttachmentReconciler) findEPAsForDeployment(ctx context.Context, obj client.Object) []reconcile.Request {
+	gatewayName := obj.GetLabels()[crv1alpha1.GatewayNameLabel]
+	if gatewayName == "" {
+		return nil
+	}
+	epaList := &crv1alpha1.ExternalProcessorAttachmentList{}
+	if err := r.List(ctx, epaList); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range epaList.Items {
+		epa := &epaList.Items[i]
+		if !referencesGateway(epa, gatewayName, obj.GetNamespace()) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      epa.Name,
+				Namespace: epa.Namespace,
+			},
+		})
+	}
+	return requests
+}
+
+// referencesGateway reports whether one of the Gateway references of epa
+// names the Gateway name in namespace.
+func referencesGateway(epa *crv1alpha1.ExternalProcessorAttachment, name, namespace string) bool {
+	for _, ref := range epa.GatewayRefs() {
+		if ref.Name == name && epa.GatewayRefNamespace(ref) == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalprocessorattachment
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	crv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func gatewayDeployment(name, namespace, gateway string, matchLabels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{crv1alpha1.GatewayNameLabel: gateway},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: matchLabels},
+		},
+	}
+}
+
+func TestResolveGatewaySelector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	if err := crv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	if err := gatewayv1.Install(scheme); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+
+	gateway := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: "public", Namespace: "gateways"}}
+	workload := map[string]string{crv1alpha1.GatewayNameLabel: "public"}
+
+	tests := []struct {
+		name      string
+		objects   []client.Object
+		ref       crv1alpha1.GatewayRef
+		want      map[string]string
+		wantError string
+	}{
+		{
+			name:    "label selector leaves the status empty",
+			objects: []client.Object{gateway},
+			ref:     crv1alpha1.GatewayRef{Selector: map[string]string{"istio": "gateway"}},
+		},
+		{
+			name: "gateway name resolves to the deployment selector",
+			objects: []client.Object{
+				gateway,
+				gatewayDeployment("public-istio", "gateways", "public", workload),
+				gatewayDeployment("other-istio", "gateways", "other", map[string]string{"app": "other"}),
+			},
+			ref:  crv1alpha1.GatewayRef{Name: "public", Namespace: "gateways"},
+			want: workload,
+		},
+		{
+			name:      "missing gateway",
+			ref:       crv1alpha1.GatewayRef{Name: "public", Namespace: "gateways"},
+			wantError: "failed to get Gateway gateways/public",
+		},
+		{
+			name:      "gateway without deployment",
+			objects:   []client.Object{gateway},
+			ref:       crv1alpha1.GatewayRef{Name: "public", Namespace: "gateways"},
+			wantError: "found 0 Deployments",
+		},
+		{
+			name: "deployment in another namespace is not used",
+			objects: []client.Object{
+				gateway,
+				gatewayDeployment("public-istio", "istio-system", "public", workload),
+			},
+			ref:       crv1alpha1.GatewayRef{Name: "public", Namespace: "gateways"},
+			wantError: "found 0 Deployments",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ExternalProcessorAttachmentReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).Build(),
+				Scheme: scheme,
+			}
+			attachment := &crv1alpha1.ExternalProcessorAttachment{
+				ObjectMeta: metav1.ObjectMeta{Name: "epa", Namespace: "gateways"},
+				Spec:       crv1alpha1.ExternalProcessorAttachmentSpec{GatewayRef: tt.ref},
+				Status: crv1alpha1.ExternalProcessorAttachmentStatus{
+					GatewaySelector: map[string]string{"stale": "true"},
+				},
+			}
+
+			err := r.resolveGatewaySelector(context.Background(), attachment)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(attachment.Status.GatewaySelector, tt.want) {
+				t.Errorf("GatewaySelector = %v, want %v", attachment.Status.GatewaySelector, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveGatewaySelector_AdditionalGatewayRefs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme: %v", err)
+	}
+	if err := gatewayv1.Install(scheme); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+
+	internal := map[string]string{crv1alpha1.GatewayNameLabel: "internal"}
+	r := &ExternalProcessorAttachmentReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: "internal", Namespace: "gateways"}},
+			gatewayDeployment("internal-istio", "gateways", "internal", internal),
+		).Build(),
+		Scheme: scheme,
+	}
+	attachment := &crv1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "epa", Namespace: "gateways"},
+		Spec: crv1alpha1.ExternalProcessorAttachmentSpec{
+			GatewayRef: crv1alpha1.GatewayRef{Selector: map[string]string{"istio": "public"}},
+			AdditionalGatewayRefs: []crv1alpha1.GatewayRef{
+				{Selector: map[string]string{"istio": "partners"}},
+				{Name: "internal"},
+			},
+		},
+	}
+
+	if err := r.resolveGatewaySelector(context.Background(), attachment); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []map[string]string{nil, internal}
+	if !reflect.DeepEqual(attachment.Status.AdditionalGatewaySelectors, want) {
+		t.Errorf("AdditionalGatewaySelectors = %v, want %v", attachment.Status.AdditionalGatewaySelectors, want)
+	}
+
+	attachment.Spec.AdditionalGatewayRefs = append(attachment.Spec.AdditionalGatewayRefs, crv1alpha1.GatewayRef{Name: "missing"})
+	err := r.resolveGatewaySelector(context.Background(), attachment)
+	if err == nil || !strings.Contains(err.Error(), "failed to get Gateway gateways/missing") {
+		t.Errorf("error = %v, want the missing Gateway reported", err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalprocessorattachment
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// provider generates the gateway configuration of an attachment for one
+// gateway implementation (spec.provider).
+type provider interface {
+	// reconcile creates or updates the configuration of attachment.
+	reconcile(ctx context.Context, attachment *v1alpha1.ExternalProcessorAttachment) error
+
+	// cleanup deletes the configuration of attachment. Resource kinds that
+	// are not installed in the cluster count as already deleted.
+	cleanup(ctx context.Context, attachment *v1alpha1.ExternalProcessorAttachment) error
+}
+
+// providers returns the provider of every supported spec.provider value.
+func (r *ExternalProcessorAttachmentReconciler) providers() map[v1alpha1.GatewayProvider]provider {
+	return map[v1alpha1.GatewayProvider]provider{
+		v1alpha1.GatewayProviderIstio:        istioProvider{r},
+		v1alpha1.GatewayProviderEnvoyGateway: envoyGatewayProvider{r},
+	}
+}
+
+// reconcileProvider reconciles attachment with the provider it selects and
+// removes what the other providers generated before a spec.provider change.
+func (r *ExternalProcessorAttachmentReconciler) reconcileProvider(
+	ctx context.Context,
+	attachment *v1alpha1.ExternalProcessorAttachment,
+) error {
+	current := attachment.EffectiveProvider()
+	providers := r.providers()
+	p, ok := providers[current]
+	if !ok {
+		return fmt.Errorf("unsupported provider %q", current)
+	}
+	if err := p.reconcile(ctx, attachment); err != nil {
+		return err
+	}
+	for name, other := range providers {
+		if name == current {
+			continue
+		}
+		if err := other.cleanup(ctx, attachment); err != nil {
+			return fmt.Errorf("failed to clean up %s configuration: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// cleanupProviders deletes the configuration every provider generated for
+// attachment.
+func (r *ExternalProcessorAttachmentReconciler) cleanupProviders(
+	ctx context.Context,
+	attachment *v1alpha1.ExternalProcessorAttachment,
+) error {
+	for name, p := range r.providers() {
+		if err := p.cleanup(ctx, attachment); err != nil {
+			return fmt.Errorf("failed to clean up %s configuration: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ignoreNoMatch returns nil when err reports a resource kind that is not
+// installed, e.g. EnvoyFilters on a cluster without Istio.
+func ignoreNoMatch(err error) error {
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	return err
+}
+
+// istioProvider generates Istio EnvoyFilters selecting the Gateway workload.
+type istioProvider struct {
+	r *ExternalProcessorAttachmentReconciler
+}
+
+func (p istioProvider) reconcile(ctx context.Context, attachment *v1alpha1.ExternalProcessorAttachment) error {
+	if err := p.r.resolveGatewaySelector(ctx, attachment); err != nil {
+		return err
+	}
+	return p.r.reconcileEnvoyFilters(ctx, attachment)
+}
+
+func (p istioProvider) cleanup(ctx context.Context, attachment *v1alpha1.ExternalProcessorAttachment) error {
+	return ignoreNoMatch(p.r.deleteEnvoyFilters(ctx, attachment))
+}
@@ -49,3 +49,15 @@ func (r *ExternalProcessorAttachmentReconciler) updateConditionFailed(attachment
 		Message:            message,
 	})
 }
+
+// updateConditionOwnershipConflict sets the Ready condition to False because
+// another field manager changed an object the attachment generates.
+func (r *ExternalProcessorAttachmentReconciler) updateConditionOwnershipConflict(attachment *v1alpha1.ExternalProcessorAttachment, message string) {
+	meta.SetStatusCondition(&attachment.Status.Conditions, metav1.Condition{
+		Type:               ConditionTypeReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: attachment.Generation,
+		Reason:             "OwnershipConflict",
+		Message:            message,
+	})
+}
@@ -24,10 +24,10 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/log"
-	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	"github.com/freepik-company/customrouter/api/v1alpha1"
 	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
+	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
 // reconcileEnvoyFilters creates or updates the EnvoyFilters for this attachment
@@ -55,36 +55,11 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileEnvoyFilters(
 		return fmt.Errorf("failed to list CustomHTTPRoutes: %w", err)
 	}
 
-	// Collect catch-all entries from CustomHTTPRoutes and merge with EPA config
-	catchAllEntries := ef.CollectCatchAllEntries(routeList)
-	mergedEntries := ef.MergeCatchAllEntries(catchAllEntries, attachment)
-
-	if len(mergedEntries) > 0 {
-		hostnames := make([]string, 0, len(mergedEntries))
-		for _, e := range mergedEntries {
-			hostnames = append(hostnames, e.Hostname)
-		}
-		httpRouteList := &gatewayv1.HTTPRouteList{}
-		if err := r.List(ctx, httpRouteList); err != nil {
-			return fmt.Errorf("failed to list HTTPRoutes: %w", err)
-		}
-		hostnamesWithHTTPRoute := ef.CollectHostnamesWithHTTPRoute(httpRouteList, hostnames)
-
-		envoyFilter, err := ef.BuildCatchAllEnvoyFilter(attachment, mergedEntries, hostnamesWithHTTPRoute)
-		if err != nil {
-			return fmt.Errorf("failed to build catch-all EnvoyFilter: %w", err)
-		}
-		if err := ef.UpsertUnstructured(ctx, r.Client, envoyFilter); err != nil {
-			return fmt.Errorf("failed to reconcile catch-all EnvoyFilter: %w", err)
-		}
-	} else {
-		key := types.NamespacedName{
-			Name:      attachment.Name + ef.CatchAllFilterSuffix,
-			Namespace: attachment.Namespace,
-		}
-		if err := ef.DeleteEnvoyFilter(ctx, r.Client, key); err != nil {
-			return fmt.Errorf("failed to delete catch-all EnvoyFilter: %w", err)
-		}
+	// The catch-all EnvoyFilter is only written here, never by the
+	// CustomHTTPRoute controller (see ef.ReconcileCatchAll).
+	catchAllHostnames, err := ef.ReconcileCatchAll(ctx, r.Client, attachment, routeList)
+	if err != nil {
+		return err
 	}
 
 	mirrorEntries := ef.CollectMirrorEntries(routeList)
@@ -93,7 +68,7 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileEnvoyFilters(
 		if err != nil {
 			return fmt.Errorf("failed to build mirror EnvoyFilter: %w", err)
 		}
-		if err := ef.UpsertUnstructured(ctx, r.Client, envoyFilter); err != nil {
+		if err := ef.UpsertEnvoyFilters(ctx, r.Client, attachment, envoyFilter); err != nil {
 			return fmt.Errorf("failed to reconcile mirror EnvoyFilter: %w", err)
 		}
 	} else {
@@ -101,7 +76,7 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileEnvoyFilters(
 			Name:      attachment.Name + ef.MirrorFilterSuffix,
 			Namespace: attachment.Namespace,
 		}
-		if err := ef.DeleteEnvoyFilter(ctx, r.Client, key); err != nil {
+		if err := ef.DeleteEnvoyFilters(ctx, r.Client, key); err != nil {
 			return fmt.Errorf("failed to delete mirror EnvoyFilter: %w", err)
 		}
 	}
@@ -112,7 +87,7 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileEnvoyFilters(
 		if err != nil {
 			return fmt.Errorf("failed to build CORS EnvoyFilter: %w", err)
 		}
-		if err := ef.UpsertUnstructured(ctx, r.Client, envoyFilter); err != nil {
+		if err := ef.UpsertEnvoyFilters(ctx, r.Client, attachment, envoyFilter); err != nil {
 			return fmt.Errorf("failed to reconcile CORS EnvoyFilter: %w", err)
 		}
 	} else {
@@ -120,17 +95,39 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileEnvoyFilters(
 			Name:      attachment.Name + ef.CORSFilterSuffix,
 			Namespace: attachment.Namespace,
 		}
-		if err := ef.DeleteEnvoyFilter(ctx, r.Client, key); err != nil {
+		if err := ef.DeleteEnvoyFilters(ctx, r.Client, key); err != nil {
 			return fmt.Errorf("failed to delete CORS EnvoyFilter: %w", err)
 		}
 	}
 
+	protocolEntries := ef.CollectProtocolHintEntries(routeList)
+	backendProtocols := ef.CollectBackendProtocols(routeList)
+	if len(protocolEntries) > 0 || len(backendProtocols) > 0 {
+		envoyFilter, err := ef.BuildProtocolEnvoyFilter(attachment, protocolEntries, backendProtocols)
+		if err != nil {
+			return fmt.Errorf("failed to build protocol EnvoyFilter: %w", err)
+		}
+		if err := ef.UpsertEnvoyFilters(ctx, r.Client, attachment, envoyFilter); err != nil {
+			return fmt.Errorf("failed to reconcile protocol EnvoyFilter: %w", err)
+		}
+	} else {
+		key := types.NamespacedName{
+			Name:      attachment.Name + ef.ProtocolFilterSuffix,
+			Namespace: attachment.Namespace,
+		}
+		if err := ef.DeleteEnvoyFilters(ctx, r.Client, key); err != nil {
+			return fmt.Errorf("failed to delete protocol EnvoyFilter: %w", err)
+		}
+	}
+
 	logger.Info("EnvoyFilters reconciled successfully",
 		"extproc", attachment.Name+ef.ExtProcFilterSuffix,
 		"routes", attachment.Name+ef.RoutesFilterSuffix,
-		"catchallHostnames", len(mergedEntries),
+		"catchallHostnames", catchAllHostnames,
 		"mirrorEntries", len(mirrorEntries),
-		"corsEntries", len(corsEntries))
+		"corsEntries", len(corsEntries),
+		"protocolEntries", len(protocolEntries),
+		"backendProtocols", len(backendProtocols))
 
 	return nil
 }
@@ -143,8 +140,12 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileExtProcEnvoyFilter(
 	filterName := attachment.Name + ef.ExtProcFilterSuffix
 	svcRef := attachment.Spec.ExternalProcessorRef.Service
 
-	clusterName := fmt.Sprintf("outbound|%d||%s.%s.svc.cluster.local",
-		svcRef.Port, svcRef.Name, svcRef.Namespace)
+	clusterName := ef.ClusterName(attachment,
+		fmt.Sprintf("%s.%s.svc.cluster.local:%d", svcRef.Name, svcRef.Namespace, svcRef.Port))
+	tlsCluster := buildExtProcTLSCluster(attachment, clusterName)
+	if tlsCluster != nil {
+		clusterName, _ = tlsCluster["name"].(string)
+	}
 
 	envoyFilter := &unstructured.Unstructured{}
 	envoyFilter.SetGroupVersionKind(ef.GVK)
@@ -153,66 +154,248 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileExtProcEnvoyFilter(
 	envoyFilter.SetLabels(ef.StandardLabels(attachment.Name))
 	envoyFilter.SetOwnerReferences([]metav1.OwnerReference{ef.NewOwnerReference(attachment)})
 
-	selectorInterface := ef.SelectorToInterface(attachment.Spec.GatewayRef.Selector)
+	selectorInterface := ef.SelectorToInterface(attachment.WorkloadSelector())
+
+	typedConfig := ExtProcFilterConfig(attachment, clusterName)
 
 	spec := map[string]interface{}{
 		"workloadSelector": map[string]interface{}{
 			"labels": selectorInterface,
 		},
 		"configPatches": []interface{}{
+			// The header removal runs in the connection manager itself,
+			// before route selection and every HTTP filter.
 			map[string]interface{}{
-				"applyTo": "HTTP_FILTER",
-				"match": map[string]interface{}{
-					"context": "GATEWAY",
-					"listener": map[string]interface{}{
-						"filterChain": map[string]interface{}{
-							"filter": map[string]interface{}{
-								"name": "envoy.filters.network.http_connection_manager",
-								"subFilter": map[string]interface{}{
-									"name": "envoy.filters.http.router",
-								},
-							},
+				"applyTo": "NETWORK_FILTER",
+				"match":   connectionManagerMatch(),
+				"patch": map[string]interface{}{
+					"operation": "MERGE",
+					"value": map[string]interface{}{
+						"name": "envoy.filters.network.http_connection_manager",
+						"typed_config": map[string]interface{}{
+							"@type":                            connectionManagerType,
+							"early_header_mutation_extensions": []interface{}{EdgeHeaderMutation()},
 						},
 					},
 				},
+			},
+			map[string]interface{}{
+				"applyTo": "HTTP_FILTER",
+				"match":   routerFilterMatch(),
 				"patch": map[string]interface{}{
 					"operation": "INSERT_BEFORE",
 					"value": map[string]interface{}{
-						"name": "envoy.filters.http.ext_proc",
-						"typed_config": map[string]interface{}{
-							"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_proc.v3.ExternalProcessor",
-							"grpc_service": map[string]interface{}{
-								"envoy_grpc": map[string]interface{}{
-									"cluster_name": clusterName,
-								},
-								"timeout": getTimeout(attachment),
-							},
-							"failure_mode_allow": attachment.Spec.ExternalProcessorRef.FailureModeAllow,
-							"message_timeout":    getMessageTimeout(attachment),
-							"processing_mode": map[string]interface{}{
-								"request_header_mode":   "SEND",
-								"response_header_mode":  "SKIP",
-								"request_body_mode":     "NONE",
-								"response_body_mode":    "NONE",
-								"request_trailer_mode":  "SKIP",
-								"response_trailer_mode": "SKIP",
-							},
-							"mutation_rules": map[string]interface{}{
-								"allow_all_routing": true,
-								"allow_envoy":       false,
-							},
-						},
+						"name":         "envoy.filters.http.ext_proc",
+						"typed_config": typedConfig,
 					},
 				},
 			},
 		},
 	}
 
+	if tlsCluster != nil {
+		spec["configPatches"] = append(spec["configPatches"].([]interface{}), map[string]interface{}{
+			"applyTo": "CLUSTER",
+			"match": map[string]interface{}{
+				"context": "GATEWAY",
+			},
+			"patch": map[string]interface{}{
+				"operation": "ADD",
+				"value":     tlsCluster,
+			},
+		})
+	}
+
 	if err := unstructured.SetNestedField(envoyFilter.Object, spec, "spec"); err != nil {
 		return fmt.Errorf("failed to set spec: %w", err)
 	}
 
-	return ef.UpsertUnstructured(ctx, r.Client, envoyFilter)
+	return ef.UpsertEnvoyFilters(ctx, r.Client, attachment, envoyFilter)
+}
+
+// connectionManagerType is the typed_config type of the HTTP connection
+// manager network filter.
+const connectionManagerType = "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager"
+
+// connectionManagerMatch matches the gateway's HTTP connection managers.
+func connectionManagerMatch() map[string]interface{} {
+	return map[string]interface{}{
+		"context": "GATEWAY",
+		"listener": map[string]interface{}{
+			"filterChain": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"name": "envoy.filters.network.http_connection_manager",
+				},
+			},
+		},
+	}
+}
+
+// routerFilterMatch matches the router HTTP filter of the gateway's HTTP
+// connection managers.
+func routerFilterMatch() map[string]interface{} {
+	return map[string]interface{}{
+		"context": "GATEWAY",
+		"listener": map[string]interface{}{
+			"filterChain": map[string]interface{}{
+				"filter": map[string]interface{}{
+					"name": "envoy.filters.network.http_connection_manager",
+					"subFilter": map[string]interface{}{
+						"name": "envoy.filters.http.router",
+					},
+				},
+			},
+		},
+	}
+}
+
+// edgeStrippedHeaders are the routing decision headers the external
+// processor sets. None of them is an input of the processor, so the values
+// a client sent are dropped before it runs.
+var edgeStrippedHeaders = []string{
+	"x-customrouter-cluster",
+	"x-customrouter-matched-path",
+	"x-customrouter-matched-type",
+	"x-customrouter-degraded",
+	"x-customrouter-config-hash",
+	"x-original-authority",
+}
+
+// EdgeHeaderMutation returns the early header mutation the extproc
+// EnvoyFilter adds to the gateway's HTTP connection managers. The dynamic
+// route forwards on x-customrouter-cluster, so a client sending one itself
+// could pick any cluster whenever the processor does not rewrite the
+// request: when it is unreachable with failureModeAllow, or skipped. Early
+// header mutations run before the route is selected, unlike an HTTP filter,
+// whose removal would leave the cached route in place. The processor strips
+// spoofed headers too; this covers the requests it never sees. Exported for
+// the Envoy harness in test/envoy, like ExtProcFilterConfig.
+func EdgeHeaderMutation() map[string]interface{} {
+	mutations := make([]interface{}, 0, len(edgeStrippedHeaders))
+	for _, name := range edgeStrippedHeaders {
+		mutations = append(mutations, map[string]interface{}{"remove": name})
+	}
+	return map[string]interface{}{
+		"name": "customrouter.edge_header_removal",
+		"typed_config": map[string]interface{}{
+			"@type":     "type.googleapis.com/envoy.extensions.http.early_header_mutation.header_mutation.v3.HeaderMutation",
+			"mutations": mutations,
+		},
+	}
+}
+
+// ExtProcFilterConfig returns the typed_config of the ext_proc HTTP filter
+// the extproc EnvoyFilter inserts before the router, calling the processor
+// through clusterName. Exported for the Envoy harness in test/envoy, which
+// runs the same filter in a static Envoy config.
+func ExtProcFilterConfig(attachment *v1alpha1.ExternalProcessorAttachment, clusterName string) map[string]interface{} {
+	typedConfig := map[string]interface{}{
+		"@type":              "type.googleapis.com/envoy.extensions.filters.http.ext_proc.v3.ExternalProcessor",
+		"grpc_service":       buildGRPCService(attachment, clusterName),
+		"failure_mode_allow": attachment.Spec.ExternalProcessorRef.FailureModeAllow,
+		"message_timeout":    getMessageTimeout(attachment),
+		"processing_mode":    buildProcessingMode(attachment),
+		// Routes with an outlier policy ask for their response headers to
+		// count server errors; every other response skips the processor.
+		"allow_mode_override": true,
+		"mutation_rules": map[string]interface{}{
+			"allow_all_routing": true,
+			"allow_envoy":       false,
+		},
+	}
+	// Envoy drops dynamic metadata from the processor unless its namespace
+	// is accepted, which Metadata matching depends on.
+	if attachment.Spec.RoutingDecisionMatch == v1alpha1.RoutingDecisionMatchMetadata {
+		typedConfig["metadata_options"] = map[string]interface{}{
+			"receiving_namespaces": map[string]interface{}{
+				"untyped": []interface{}{routes.RoutingMetadataNamespace},
+			},
+		}
+	}
+	return typedConfig
+}
+
+// extProcTLSClusterPrefix starts the name of the clusters added by
+// buildExtProcTLSCluster.
+const extProcTLSClusterPrefix = "customrouter-extproc-tls"
+
+// buildExtProcTLSCluster returns the cluster the ext_proc filter of an
+// attachment with tls talks to, or nil when the attachment has no tls.
+//
+// Istio's own cluster for the extproc Service cannot be patched instead: with
+// auto mTLS it carries transport_socket_matches, which take precedence over a
+// merged transport_socket and send plaintext to endpoints outside the mesh.
+// The added cluster has the upstream TLS transport socket only, and takes its
+// endpoints from Istio's EDS for istioCluster, so it balances across the
+// extproc pods like the cluster it stands in for.
+//
+// Certificates are read through Istio's SDS with the same naming as a
+// credentialName: kubernetes://<name> for tls.crt/tls.key and
+// kubernetes://<name>-cacert for ca.crt.
+func buildExtProcTLSCluster(attachment *v1alpha1.ExternalProcessorAttachment, istioCluster string) map[string]interface{} {
+	tlsConfig := attachment.Spec.ExternalProcessorRef.TLS
+	if tlsConfig == nil {
+		return nil
+	}
+	svcRef := attachment.Spec.ExternalProcessorRef.Service
+	sni := tlsConfig.SNI
+	if sni == "" {
+		sni = fmt.Sprintf("%s.%s.svc", svcRef.Name, svcRef.Namespace)
+	}
+
+	sdsSecret := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"name": "kubernetes://" + name,
+			"sds_config": map[string]interface{}{
+				"ads":                  map[string]interface{}{},
+				"resource_api_version": "V3",
+			},
+		}
+	}
+
+	commonTLSContext := map[string]interface{}{
+		"alpn_protocols": []interface{}{"h2"},
+		"combined_validation_context": map[string]interface{}{
+			"default_validation_context": map[string]interface{}{
+				"match_typed_subject_alt_names": []interface{}{
+					map[string]interface{}{
+						"san_type": "DNS",
+						"matcher":  map[string]interface{}{"exact": sni},
+					},
+				},
+			},
+			"validation_context_sds_secret_config": sdsSecret(tlsConfig.CredentialName + "-cacert"),
+		},
+	}
+	if tlsConfig.Mode == v1alpha1.ExternalProcessorTLSMutual {
+		commonTLSContext["tls_certificate_sds_secret_configs"] = []interface{}{
+			sdsSecret(tlsConfig.CredentialName),
+		}
+	}
+
+	return map[string]interface{}{
+		// One cluster per attachment: two attachments of the same gateway
+		// may reach the same extproc with different credentials.
+		"name":            fmt.Sprintf("%s|%s/%s", extProcTLSClusterPrefix, attachment.Namespace, attachment.Name),
+		"type":            "EDS",
+		"connect_timeout": backendConnectTimeout,
+		"eds_cluster_config": map[string]interface{}{
+			"service_name": istioCluster,
+			"eds_config": map[string]interface{}{
+				"ads":                  map[string]interface{}{},
+				"resource_api_version": "V3",
+			},
+		},
+		"typed_extension_protocol_options": ef.UpstreamProtocolOptions(v1alpha1.BackendProtocolH2),
+		"transport_socket": map[string]interface{}{
+			"name": "envoy.transport_sockets.tls",
+			"typed_config": map[string]interface{}{
+				"@type":              "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext",
+				"sni":                sni,
+				"common_tls_context": commonTLSContext,
+			},
+		},
+	}
 }
 
 // reconcileRoutesEnvoyFilter creates or updates the routes EnvoyFilter
@@ -229,7 +412,7 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileRoutesEnvoyFilter(
 	envoyFilter.SetLabels(ef.StandardLabels(attachment.Name))
 	envoyFilter.SetOwnerReferences([]metav1.OwnerReference{ef.NewOwnerReference(attachment)})
 
-	selectorInterface := ef.SelectorToInterface(attachment.Spec.GatewayRef.Selector)
+	selectorInterface := ef.SelectorToInterface(attachment.WorkloadSelector())
 
 	spec := map[string]interface{}{
 		"workloadSelector": map[string]interface{}{
@@ -244,19 +427,7 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileRoutesEnvoyFilter(
 				},
 				"patch": map[string]interface{}{
 					"operation": "INSERT_FIRST",
-					"value": map[string]interface{}{
-						"name": "customrouter-dynamic-route",
-						"match": map[string]interface{}{
-							"prefix": "/",
-							"headers": []interface{}{
-								map[string]interface{}{
-									"name":          "x-customrouter-cluster",
-									"present_match": true,
-								},
-							},
-						},
-						"route": buildRoutesRouteAction(attachment),
-					},
+					"value":     DynamicRoute(attachment),
 				},
 			},
 		},
@@ -266,7 +437,29 @@ func (r *ExternalProcessorAttachmentReconciler) reconcileRoutesEnvoyFilter(
 		return fmt.Errorf("failed to set spec: %w", err)
 	}
 
-	return ef.UpsertUnstructured(ctx, r.Client, envoyFilter)
+	return ef.UpsertEnvoyFilters(ctx, r.Client, attachment, envoyFilter)
+}
+
+// DynamicRoute returns the route the routes EnvoyFilter inserts first in
+// every virtual host: it forwards the requests the external processor routed
+// to the cluster named in x-customrouter-cluster. Exported for the Envoy
+// harness in test/envoy, like ExtProcFilterConfig.
+func DynamicRoute(attachment *v1alpha1.ExternalProcessorAttachment) map[string]interface{} {
+	return map[string]interface{}{
+		"name":  "customrouter-dynamic-route",
+		"match": buildRoutesRouteMatch(attachment),
+		"route": buildRoutesRouteAction(attachment),
+	}
+}
+
+// buildRoutesRouteMatch builds the "match" stanza of the routes EnvoyFilter:
+// any path, gated on the external processor's routing decision.
+func buildRoutesRouteMatch(attachment *v1alpha1.ExternalProcessorAttachment) map[string]interface{} {
+	match := map[string]interface{}{
+		"prefix": "/",
+	}
+	ef.ApplyRoutingDecisionMatch(match, attachment)
+	return match
 }
 
 // buildRoutesRouteAction builds the "route" stanza emitted into the routes EnvoyFilter,
@@ -292,6 +485,7 @@ func (r *ExternalProcessorAttachmentReconciler) deleteEnvoyFilters(
 		ef.CatchAllFilterSuffix,
 		ef.MirrorFilterSuffix,
 		ef.CORSFilterSuffix,
+		ef.ProtocolFilterSuffix,
 	}
 
 	for _, suffix := range suffixes {
@@ -299,7 +493,7 @@ func (r *ExternalProcessorAttachmentReconciler) deleteEnvoyFilters(
 			Name:      attachment.Name + suffix,
 			Namespace: attachment.Namespace,
 		}
-		if err := ef.DeleteEnvoyFilter(ctx, r.Client, key); err != nil {
+		if err := ef.DeleteEnvoyFilters(ctx, r.Client, key); err != nil {
 			return err
 		}
 	}
@@ -307,6 +501,66 @@ func (r *ExternalProcessorAttachmentReconciler) deleteEnvoyFilters(
 	return nil
 }
 
+// buildGRPCService returns the ext_proc grpc_service block. Per-attachment
+// extproc settings travel as gRPC initial metadata on every stream.
+func buildGRPCService(attachment *v1alpha1.ExternalProcessorAttachment, clusterName string) map[string]interface{} {
+	service := map[string]interface{}{
+		"envoy_grpc": map[string]interface{}{
+			"cluster_name": clusterName,
+		},
+		"timeout": getTimeout(attachment),
+	}
+	var metadata []interface{}
+	if mode := routes.ConvertDecisionHeadersMode(attachment.Spec.DecisionHeaders); mode != "" {
+		metadata = append(metadata, map[string]interface{}{
+			"key":   routes.DecisionHeadersMetadataKey,
+			"value": mode,
+		})
+	}
+	if policy := routes.ConvertUnmatchedRequestPolicy(attachment.Spec.UnmatchedRequestPolicy); policy != "" {
+		metadata = append(metadata, map[string]interface{}{
+			"key":   routes.UnmatchedPolicyMetadataKey,
+			"value": policy,
+		})
+	}
+	if normalization := routes.ConvertPathNormalization(attachment.Spec.PathNormalization); normalization != "" {
+		metadata = append(metadata, map[string]interface{}{
+			"key":   routes.PathNormalizationMetadataKey,
+			"value": normalization,
+		})
+	}
+	naming := routes.ConvertClusterNaming(attachment.Spec.ClusterName)
+	if naming.Template != "" {
+		metadata = append(metadata, map[string]interface{}{
+			"key":   routes.ClusterNameTemplateMetadataKey,
+			"value": naming.Template,
+		})
+	}
+	if naming.Domain != "" {
+		metadata = append(metadata, map[string]interface{}{
+			"key":   routes.ClusterDomainMetadataKey,
+			"value": naming.Domain,
+		})
+	}
+	selector := routes.ConvertVariantSelector(attachment.Spec.VariantSelector)
+	if selector.Header != "" {
+		metadata = append(metadata, map[string]interface{}{
+			"key":   routes.VariantHeaderMetadataKey,
+			"value": selector.Header,
+		})
+	}
+	if selector.Cookie != "" {
+		metadata = append(metadata, map[string]interface{}{
+			"key":   routes.VariantCookieMetadataKey,
+			"value": selector.Cookie,
+		})
+	}
+	if len(metadata) > 0 {
+		service["initial_metadata"] = metadata
+	}
+	return service
+}
+
 // getTimeout returns the configured timeout or the default "5s"
 func getTimeout(attachment *v1alpha1.ExternalProcessorAttachment) string {
 	if attachment.Spec.ExternalProcessorRef.Timeout != "" {
@@ -315,6 +569,52 @@ func getTimeout(attachment *v1alpha1.ExternalProcessorAttachment) string {
 	return "5s"
 }
 
+// envoyProcessingModes maps the processing modes of the attachment API to
+// the enum names of Envoy's ext_proc ProcessingMode.
+var envoyProcessingModes = map[string]string{
+	string(v1alpha1.HeaderProcessingModeSend):          "SEND",
+	string(v1alpha1.HeaderProcessingModeSkip):          "SKIP",
+	string(v1alpha1.BodyProcessingModeNone):            "NONE",
+	string(v1alpha1.BodyProcessingModeStreamed):        "STREAMED",
+	string(v1alpha1.BodyProcessingModeBuffered):        "BUFFERED",
+	string(v1alpha1.BodyProcessingModeBufferedPartial): "BUFFERED_PARTIAL",
+}
+
+// getProcessingMode returns the processing mode of attachment with unset
+// fields defaulted: response headers skipped and no bodies sent.
+func getProcessingMode(attachment *v1alpha1.ExternalProcessorAttachment) v1alpha1.ProcessingMode {
+	mode := v1alpha1.ProcessingMode{}
+	if attachment.Spec.ProcessingMode != nil {
+		mode = *attachment.Spec.ProcessingMode
+	}
+	if mode.ResponseHeaderMode == "" {
+		mode.ResponseHeaderMode = v1alpha1.HeaderProcessingModeSkip
+	}
+	if mode.RequestBodyMode == "" {
+		mode.RequestBodyMode = v1alpha1.BodyProcessingModeNone
+	}
+	if mode.ResponseBodyMode == "" {
+		mode.ResponseBodyMode = v1alpha1.BodyProcessingModeNone
+	}
+	return mode
+}
+
+// buildProcessingMode returns the processing_mode of the ext_proc filter.
+// Request headers are always sent, since routing depends on them, and
+// trailers are always skipped, since the external processor does not
+// answer them.
+func buildProcessingMode(attachment *v1alpha1.ExternalProcessorAttachment) map[string]interface{} {
+	mode := getProcessingMode(attachment)
+	return map[string]interface{}{
+		"request_header_mode":   "SEND",
+		"response_header_mode":  envoyProcessingModes[string(mode.ResponseHeaderMode)],
+		"request_body_mode":     envoyProcessingModes[string(mode.RequestBodyMode)],
+		"response_body_mode":    envoyProcessingModes[string(mode.ResponseBodyMode)],
+		"request_trailer_mode":  "SKIP",
+		"response_trailer_mode": "SKIP",
+	}
+}
+
 // getMessageTimeout returns the configured message timeout or the default "5s"
 func getMessageTimeout(attachment *v1alpha1.ExternalProcessorAttachment) string {
 	if attachment.Spec.ExternalProcessorRef.MessageTimeout != "" {
@@ -0,0 +1,338 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package explain finds the route a request matches and where it comes
+// from: its CustomHTTPRoute, rule and route ConfigMap. It backs the
+// kubectl-customroute plugin.
+package explain
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// Labels of the route ConfigMaps written by the controller.
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "customrouter-controller"
+	TargetLabel    = "customrouter.freepik.com/target"
+)
+
+// UnmatchedRule is the Result.Rule of the fallback route a CustomHTTPRoute
+// setting unmatchedRequestPolicy gets for each hostname.
+const UnmatchedRule = -1
+
+// AliasRedirectRule is the Result.Rule of the redirect route of a hostname
+// alias with redirect set.
+const AliasRedirectRule = -2
+
+// MaintenanceRule is the Result.Rule of a maintenance route of a
+// CustomHTTPRoute setting spec.maintenance.
+const MaintenanceRule = -3
+
+// Request is the request to explain.
+type Request struct {
+	// Host is the request hostname; a port is ignored.
+	Host string
+
+	// Path is the request path, without the query string.
+	Path string
+
+	// Method is the request method. Empty matches only routes without a
+	// method constraint.
+	Method string
+
+	// Scheme is the request scheme, "http" or "https". Empty is https, like
+	// the external processor assumes without :scheme or X-Forwarded-Proto.
+	Scheme string
+
+	// Headers are the request headers, keyed by lowercased name.
+	Headers map[string]string
+
+	// QueryParams are the query parameters of the request.
+	QueryParams map[string]string
+
+	// MatchStrategy is the operator's match strategy for the targets;
+	// empty is FirstMatch.
+	MatchStrategy string
+
+	// Variant is the route table variant the request selects (see
+	// CustomHTTPRoute spec.variant); empty selects the routes without one.
+	Variant string
+}
+
+// ParseRequest builds a Request from a URL such as
+// "https://www.example.com/api/users?id=1" or "www.example.com/api". The
+// scheme is only set when the URL has one.
+func ParseRequest(rawURL string) (Request, error) {
+	hasScheme := strings.Contains(rawURL, "://")
+	if !hasScheme {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Request{}, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	if u.Hostname() == "" {
+		return Request{}, fmt.Errorf("invalid URL %q: no hostname", rawURL)
+	}
+	req := Request{
+		Host:    u.Hostname(),
+		Path:    u.EscapedPath(),
+		Headers: map[string]string{},
+	}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	if hasScheme {
+		req.Scheme = strings.ToLower(u.Scheme)
+	}
+	if u.RawQuery != "" {
+		req.QueryParams = map[string]string{}
+		for name, values := range u.Query() {
+			req.QueryParams[name] = values[0]
+		}
+	}
+	return req, nil
+}
+
+// Result is the route a request matches in one target.
+type Result struct {
+	// Target is the targetRef name the route belongs to.
+	Target string `json:"target"`
+
+	// Host is the normalized request hostname.
+	Host string `json:"host"`
+
+	// Route is the matching route. Nil when the target serves the host but
+	// no route matches the request.
+	Route *routes.Route `json:"route,omitempty"`
+
+	// Source is the CustomHTTPRoute ("namespace/name") the route was
+	// expanded from, and Rule the index of its rule, UnmatchedRule,
+	// AliasRedirectRule or MaintenanceRule.
+	Source string `json:"source,omitempty"`
+	Rule   int    `json:"rule"`
+
+	// ConfigMaps lists the route ConfigMaps ("namespace/name") holding the
+	// routes of Host for Target. Empty when they were not written yet.
+	ConfigMaps []string `json:"configMaps,omitempty"`
+}
+
+// origin is where an expanded route comes from.
+type origin struct {
+	source string
+	rule   int
+}
+
+// Explain returns, for every target with a CustomHTTPRoute serving req.Host,
+// the route req matches, evaluated like the external processor does over
+// the routes the controller would generate from customRoutes. configMaps are
+// the route ConfigMaps in the cluster, used to tell where the routes live.
+// Results are sorted by target.
+func Explain(customRoutes []v1alpha1.CustomHTTPRoute, configMaps []corev1.ConfigMap, req Request) ([]Result, error) {
+	host := strings.ToLower(req.Host)
+	if i := strings.Index(host, ":"); i != -1 {
+		host = host[:i]
+	}
+
+	byTarget := make(map[string][]*v1alpha1.CustomHTTPRoute)
+	for i := range customRoutes {
+		cr := &customRoutes[i]
+		if !cr.DeletionTimestamp.IsZero() || !servesHost(cr, host) {
+			continue
+		}
+		byTarget[cr.Spec.TargetRef.Name] = append(byTarget[cr.Spec.TargetRef.Name], cr)
+	}
+	targets := make([]string, 0, len(byTarget))
+	for target := range byTarget {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	match := routes.RequestMatch{
+		Path:        req.Path,
+		Method:      req.Method,
+		Scheme:      req.Scheme,
+		Headers:     req.Headers,
+		QueryParams: req.QueryParams,
+		Variant:     req.Variant,
+	}
+	if match.Scheme == "" {
+		match.Scheme = "https"
+	}
+	results := make([]Result, 0, len(targets))
+	for _, target := range targets {
+		config, origins, err := expandTarget(byTarget[target], req.MatchStrategy)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", target, err)
+		}
+		result := Result{
+			Target:     target,
+			Host:       host,
+			Rule:       UnmatchedRule,
+			ConfigMaps: configMapsForHost(configMaps, target, host),
+		}
+		if route := config.FindRoute(host, match); route != nil {
+			o := origins[route.ID]
+			result.Route = route
+			result.Source = o.source
+			result.Rule = o.rule
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// servesHost reports whether cr lists host among its hostnames or hostname
+// aliases.
+func servesHost(cr *v1alpha1.CustomHTTPRoute, host string) bool {
+	for _, h := range cr.Spec.ServedHostnames() {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTarget merges the routes of customRoutes like the controller does,
+// ordered by strategy, one rule at a time so every route can be traced back
+// to its rule. Routes
+// are told apart by their format v2 id, which is stamped on them.
+func expandTarget(
+	customRoutes []*v1alpha1.CustomHTTPRoute, strategy string,
+) (*routes.RoutesConfig, map[string]origin, error) {
+	sort.Slice(customRoutes, func(i, j int) bool {
+		if customRoutes[i].Namespace != customRoutes[j].Namespace {
+			return customRoutes[i].Namespace < customRoutes[j].Namespace
+		}
+		return customRoutes[i].Name < customRoutes[j].Name
+	})
+
+	var expanded []map[string][]routes.Route
+	origins := make(map[string]origin)
+	add := func(cr *v1alpha1.CustomHTTPRoute, rule int) error {
+		hosts, err := routes.ExpandRoutes(cr, nil)
+		if err != nil {
+			return err
+		}
+		source := cr.Namespace + "/" + cr.Name
+		routes.AssignRouteIdentity(hosts, source)
+		for _, hostRoutes := range hosts {
+			for i := range hostRoutes {
+				// Identical matches of two rules share an id; the first
+				// rule sorts first and wins, as in the merged table.
+				if _, ok := origins[hostRoutes[i].ID]; !ok {
+					origins[hostRoutes[i].ID] = origin{source: source, rule: rule}
+				}
+			}
+		}
+		expanded = append(expanded, hosts)
+		return nil
+	}
+
+	for _, cr := range customRoutes {
+		// Redirecting aliases are expanded on their own, once.
+		var routedAliases, redirectAliases []v1alpha1.HostnameAlias
+		for _, alias := range cr.Spec.HostnameAliases {
+			if alias.Redirect {
+				redirectAliases = append(redirectAliases, alias)
+			} else {
+				routedAliases = append(routedAliases, alias)
+			}
+		}
+		for i := range cr.Spec.Rules {
+			single := cr.DeepCopy()
+			single.Spec.Rules = []v1alpha1.Rule{cr.Spec.Rules[i]}
+			single.Spec.UnmatchedRequestPolicy = ""
+			single.Spec.HostnameAliases = routedAliases
+			single.Spec.Maintenance = nil
+			if err := add(single, i); err != nil {
+				return nil, nil, err
+			}
+		}
+		if routes.ConvertUnmatchedRequestPolicy(cr.Spec.UnmatchedRequestPolicy) != "" {
+			fallback := cr.DeepCopy()
+			fallback.Spec.Rules = nil
+			fallback.Spec.HostnameAliases = routedAliases
+			fallback.Spec.Maintenance = nil
+			if err := add(fallback, UnmatchedRule); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(redirectAliases) > 0 {
+			redirects := cr.DeepCopy()
+			redirects.Spec.Hostnames = nil
+			redirects.Spec.Rules = nil
+			redirects.Spec.UnmatchedRequestPolicy = ""
+			redirects.Spec.HostnameAliases = redirectAliases
+			redirects.Spec.Maintenance = nil
+			if err := add(redirects, AliasRedirectRule); err != nil {
+				return nil, nil, err
+			}
+		}
+		if cr.Spec.Maintenance.IsEnabled() {
+			// Only the maintenance routes, on the hostnames they apply to.
+			maintenance := cr.DeepCopy()
+			maintenance.Spec.Maintenance.Hostnames = cr.Spec.MaintenanceHostnames()
+			maintenance.Spec.Hostnames = nil
+			maintenance.Spec.Rules = nil
+			maintenance.Spec.UnmatchedRequestPolicy = ""
+			maintenance.Spec.HostnameAliases = nil
+			if err := add(maintenance, MaintenanceRule); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	config := routes.MergeRoutesConfig(expanded...)
+	config.ApplyMatchStrategy(strategy)
+	if err := config.CompileRegexes(); err != nil {
+		return nil, nil, err
+	}
+	return config, origins, nil
+}
+
+// configMapsForHost returns the route ConfigMaps of target holding routes
+// for host.
+func configMapsForHost(configMaps []corev1.ConfigMap, target, host string) []string {
+	var names []string
+	for i := range configMaps {
+		cm := &configMaps[i]
+		if cm.Labels[ManagedByLabel] != ManagedByValue || cm.Labels[TargetLabel] != target {
+			continue
+		}
+		data, ok, err := routes.ConfigMapRoutesData(cm, nil)
+		if err != nil || !ok {
+			continue
+		}
+		config, err := routes.DecodeRoutesConfig([]byte(data))
+		if err != nil {
+			continue
+		}
+		if _, ok := config.Hosts[host]; ok {
+			names = append(names, cm.Namespace+"/"+cm.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
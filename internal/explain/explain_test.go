@@ -0,0 +1,260 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package explain
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestParseRequest(t *testing.T) {
+	req, err := ParseRequest("WWW.example.com:8443/api/users?id=1&id=2")
+	if err != nil {
+		t.Fatalf("ParseRequest failed: %v", err)
+	}
+	if req.Host != "WWW.example.com" || req.Path != "/api/users" || req.Scheme != "" {
+		t.Errorf("ParseRequest() = %+v", req)
+	}
+	if !reflect.DeepEqual(req.QueryParams, map[string]string{"id": "1"}) {
+		t.Errorf("QueryParams = %v, want the first value of id", req.QueryParams)
+	}
+
+	req, err = ParseRequest("https://example.com")
+	if err != nil || req.Path != "/" || req.Scheme != "https" || req.QueryParams != nil {
+		t.Errorf("ParseRequest(https://example.com) = %+v, %v", req, err)
+	}
+	if _, err := ParseRequest("http:///api"); err == nil {
+		t.Error("ParseRequest without a hostname succeeded, want an error")
+	}
+}
+
+func newCustomRoute(namespace, name, target string, hostnames []string, rules ...v1alpha1.Rule) v1alpha1.CustomHTTPRoute {
+	return v1alpha1.CustomHTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: target},
+			Hostnames: hostnames,
+			Rules:     rules,
+		},
+	}
+}
+
+func newRule(path string, matchType v1alpha1.MatchType, service string) v1alpha1.Rule {
+	return v1alpha1.Rule{
+		Matches:     []v1alpha1.PathMatch{{Path: path, Type: matchType}},
+		BackendRefs: []v1alpha1.BackendRef{{Name: service, Namespace: "shop", Port: 8080}},
+	}
+}
+
+func TestExplain(t *testing.T) {
+	web := newCustomRoute("shop", "web", "public", []string{"www.example.com"},
+		newRule("/", v1alpha1.MatchTypePathPrefix, "web"),
+		newRule("/api", v1alpha1.MatchTypeExact, "api"),
+	)
+	blog := newCustomRoute("blog", "blog", "public", []string{"www.example.com"},
+		newRule("/blog", v1alpha1.MatchTypePathPrefix, "blog"),
+	)
+	internal := newCustomRoute("shop", "internal", "private", []string{"www.example.com", "admin.example.com"},
+		newRule("/admin", v1alpha1.MatchTypePathPrefix, "admin"),
+	)
+	internal.Spec.UnmatchedRequestPolicy = v1alpha1.UnmatchedRequestNotFound
+	customRoutes := []v1alpha1.CustomHTTPRoute{web, blog, internal}
+
+	document, err := routes.MergeRoutesConfig(map[string][]routes.Route{
+		"www.example.com": {{Path: "/", Type: routes.RouteTypePrefix, Backend: "web.shop.svc.cluster.local:8080"}},
+	}).ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON failed: %v", err)
+	}
+	compressed, err := routes.CompressRoutesDocument(document)
+	if err != nil {
+		t.Fatalf("CompressRoutesDocument failed: %v", err)
+	}
+	configMaps := []corev1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "customrouter",
+				Name:      "customrouter-routes-public-0",
+				Labels:    map[string]string{ManagedByLabel: ManagedByValue, TargetLabel: "public"},
+			},
+			BinaryData: map[string][]byte{routes.CompressedRoutesDataKey: compressed},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "customrouter",
+				Name:      "customrouter-routes-public-1",
+				Labels:    map[string]string{ManagedByLabel: ManagedByValue, TargetLabel: "public"},
+			},
+			Data: map[string]string{"routes.json": `{"version":1,"hosts":{}}`},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		target  string
+		source  string
+		rule    int
+		backend string
+	}{
+		{name: "exact rule", path: "/api", target: "public", source: "shop/web", rule: 1, backend: "api.shop.svc.cluster.local:8080"},
+		{name: "prefix rule", path: "/api/users", target: "public", source: "shop/web", rule: 0, backend: "web.shop.svc.cluster.local:8080"},
+		{name: "other source", path: "/blog/post", target: "public", source: "blog/blog", rule: 0, backend: "blog.shop.svc.cluster.local:8080"},
+		{name: "private rule", path: "/admin/users", target: "private", source: "shop/internal", rule: 0, backend: "admin.shop.svc.cluster.local:8080"},
+		{name: "private fallback", path: "/other", target: "private", source: "shop/internal", rule: UnmatchedRule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Explain(customRoutes, configMaps, Request{Host: "WWW.example.com:443", Path: tt.path, Method: "GET"})
+			if err != nil {
+				t.Fatalf("Explain failed: %v", err)
+			}
+			if len(results) != 2 || results[0].Target != "private" || results[1].Target != "public" {
+				t.Fatalf("expected results for private and public, got %+v", results)
+			}
+			var result Result
+			for _, r := range results {
+				if r.Target == tt.target {
+					result = r
+				}
+			}
+			if result.Host != "www.example.com" {
+				t.Errorf("Host = %q, want www.example.com", result.Host)
+			}
+			if result.Route == nil {
+				t.Fatalf("no route matched %s", tt.path)
+			}
+			if result.Source != tt.source || result.Rule != tt.rule || result.Route.Backend != tt.backend {
+				t.Errorf("matched %s rule %d backend %q, want %s rule %d backend %q",
+					result.Source, result.Rule, result.Route.Backend, tt.source, tt.rule, tt.backend)
+			}
+		})
+	}
+
+	results, err := Explain(customRoutes, configMaps, Request{Host: "www.example.com", Path: "/"})
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if want := []string{"customrouter/customrouter-routes-public-0"}; !reflect.DeepEqual(results[1].ConfigMaps, want) {
+		t.Errorf("public ConfigMaps = %v, want %v", results[1].ConfigMaps, want)
+	}
+	if results[0].ConfigMaps != nil {
+		t.Errorf("private ConfigMaps = %v, want none", results[0].ConfigMaps)
+	}
+}
+
+func TestExplainNoMatch(t *testing.T) {
+	customRoutes := []v1alpha1.CustomHTTPRoute{
+		newCustomRoute("shop", "web", "public", []string{"www.example.com"},
+			newRule("/api", v1alpha1.MatchTypeExact, "api"),
+		),
+	}
+
+	results, err := Explain(customRoutes, nil, Request{Host: "www.example.com", Path: "/other"})
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Route != nil || results[0].Source != "" {
+		t.Errorf("expected a result without a route, got %+v", results)
+	}
+
+	results, err = Explain(customRoutes, nil, Request{Host: "api.example.com", Path: "/api"})
+	if err != nil || len(results) != 0 {
+		t.Errorf("Explain(api.example.com) = %+v, %v; want no results", results, err)
+	}
+}
+
+func TestExplainHostnameAliases(t *testing.T) {
+	web := newCustomRoute("shop", "web", "public", []string{"example.com"},
+		newRule("/api", v1alpha1.MatchTypePathPrefix, "api"),
+	)
+	web.Spec.HostnameAliases = []v1alpha1.HostnameAlias{
+		{Hostname: "example.net", Canonical: "example.com"},
+		{Hostname: "www.example.com", Canonical: "example.com", Redirect: true},
+	}
+	customRoutes := []v1alpha1.CustomHTTPRoute{web}
+
+	results, err := Explain(customRoutes, nil, Request{Host: "example.net", Path: "/api/users"})
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Route == nil || results[0].Rule != 0 ||
+		results[0].Route.Backend != "api.shop.svc.cluster.local:8080" {
+		t.Errorf("routed alias = %+v, want rule 0", results)
+	}
+
+	results, err = Explain(customRoutes, nil, Request{Host: "www.example.com", Path: "/api/users"})
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Route == nil || results[0].Rule != AliasRedirectRule ||
+		results[0].Source != "shop/web" {
+		t.Errorf("redirecting alias = %+v, want the alias redirect", results)
+	}
+}
+
+func TestExplainMaintenance(t *testing.T) {
+	web := newCustomRoute("shop", "web", "public", []string{"example.com"},
+		newRule("/", v1alpha1.MatchTypePathPrefix, "web"),
+	)
+	web.Spec.Maintenance = &v1alpha1.Maintenance{Paths: []string{"/checkout"}}
+	customRoutes := []v1alpha1.CustomHTTPRoute{web}
+
+	results, err := Explain(customRoutes, nil, Request{Host: "example.com", Path: "/checkout/pay"})
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Route == nil || results[0].Rule != MaintenanceRule ||
+		results[0].Route.Maintenance == nil || results[0].Source != "shop/web" {
+		t.Errorf("maintenance path = %+v, want the maintenance route", results)
+	}
+
+	results, err = Explain(customRoutes, nil, Request{Host: "example.com", Path: "/blog"})
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Route == nil || results[0].Rule != 0 {
+		t.Errorf("other path = %+v, want rule 0", results)
+	}
+}
+
+func TestExplainVariant(t *testing.T) {
+	blue := newCustomRoute("shop", "web-blue", "public", []string{"app.example.com"},
+		newRule("/", v1alpha1.MatchTypePathPrefix, "blue"),
+	)
+	green := newCustomRoute("shop", "web-green", "public", []string{"app.example.com"},
+		newRule("/", v1alpha1.MatchTypePathPrefix, "green"),
+	)
+	green.Spec.Variant = "green"
+	customRoutes := []v1alpha1.CustomHTTPRoute{blue, green}
+
+	for variant, want := range map[string]string{"": "shop/web-blue", "green": "shop/web-green", "purple": "shop/web-blue"} {
+		results, err := Explain(customRoutes, nil, Request{Host: "app.example.com", Path: "/", Variant: variant})
+		if err != nil {
+			t.Fatalf("Explain failed: %v", err)
+		}
+		if len(results) != 1 || results[0].Route == nil || results[0].Source != want {
+			t.Errorf("variant %q = %+v, want the route of %s", variant, results, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Analytics exporter defaults.
+const (
+	DefaultAnalyticsBatchSize     = 500
+	DefaultAnalyticsFlushInterval = 5 * time.Second
+	DefaultAnalyticsBufferSize    = 10000
+)
+
+// AnalyticsConfig configures the export of routing decisions to an
+// analytics store.
+type AnalyticsConfig struct {
+	// Sink is AnalyticsSinkHTTP, AnalyticsSinkClickHouse or
+	// AnalyticsSinkBigQuery. Empty disables the export.
+	Sink string
+
+	// Endpoint is the URL batches are POSTed to (http), the URL of the
+	// ClickHouse HTTP interface (clickhouse), or a BigQuery API endpoint
+	// override (bigquery, empty = the public API).
+	Endpoint string
+
+	// Table is "database.table" (clickhouse) or "project.dataset.table"
+	// (bigquery).
+	Table string
+
+	// BatchSize is the most records written at once; a full batch is
+	// written without waiting for FlushInterval.
+	BatchSize int
+
+	// FlushInterval is the longest a record waits to be written.
+	FlushInterval time.Duration
+
+	// BufferSize is how many records may wait to be written. Records of a
+	// full buffer are dropped, so a slow sink never delays requests.
+	BufferSize int
+}
+
+// AnalyticsRecord is the routing decision of a request.
+type AnalyticsRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Target    string    `json:"target"`
+	Host      string    `json:"host"`
+	Method    string    `json:"method"`
+
+	// PathTemplate is the path pattern of the matched route, e.g. /api or
+	// ^/items/[0-9]+$, never the request path.
+	PathTemplate string `json:"path_template"`
+	MatchType    string `json:"match_type"`
+
+	// Route is the "namespace/name" of the CustomHTTPRoute that generated
+	// the matched route, Rule its rule and Owner the owner it declares.
+	Route      string `json:"route"`
+	Rule       string `json:"rule"`
+	Owner      string `json:"owner,omitempty"`
+	RouteID    string `json:"route_id"`
+	RouteFound bool   `json:"route_found"`
+	Backend    string `json:"backend"`
+
+	// LatencyMicros is how long the processor took to route the request.
+	LatencyMicros int64 `json:"latency_us"`
+}
+
+// analyticsExporter buffers routing decisions and writes them to a sink in
+// batches from a single goroutine, so requests never wait on the sink.
+type analyticsExporter struct {
+	sink    AnalyticsSink
+	target  string
+	records chan AnalyticsRecord
+
+	batchSize     int
+	flushInterval time.Duration
+	logger        *zap.Logger
+}
+
+// newAnalyticsExporter returns an exporter writing the routing decisions of
+// target to sink. Zero config sizes and intervals use the defaults. It only
+// writes once Run is called.
+func newAnalyticsExporter(sink AnalyticsSink, config AnalyticsConfig, target string, logger *zap.Logger) *analyticsExporter {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultAnalyticsBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultAnalyticsFlushInterval
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultAnalyticsBufferSize
+	}
+	return &analyticsExporter{
+		sink:          sink,
+		target:        target,
+		records:       make(chan AnalyticsRecord, config.BufferSize),
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval,
+		logger:        logger,
+	}
+}
+
+// record queues the routing decision of a request, or drops it when the
+// buffer is full.
+func (e *analyticsExporter) record(ctx *requestContext) {
+	record := AnalyticsRecord{
+		Timestamp:     ctx.startTime.UTC(),
+		Target:        e.target,
+		Host:          ctx.authority,
+		Method:        ctx.method,
+		RouteFound:    ctx.routeFound,
+		LatencyMicros: time.Since(ctx.startTime).Microseconds(),
+	}
+	if ctx.routeFound {
+		record.PathTemplate = ctx.matchedPattern
+		record.MatchType = ctx.matchedType
+		record.Route = ctx.routeSource
+		record.Rule = ctx.routeRule
+		record.Owner = ctx.routeOwner
+		record.RouteID = ctx.routeID
+		record.Backend = ctx.matchedBackend
+	}
+	select {
+	case e.records <- record:
+	default:
+		analyticsRecordsTotal.WithLabelValues("dropped").Inc()
+	}
+}
+
+// run writes the queued records until ctx is done, then writes what is
+// left in a last batch.
+func (e *analyticsExporter) run(ctx context.Context) {
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]AnalyticsRecord, 0, e.batchSize)
+	for {
+		select {
+		case record := <-e.records:
+			batch = append(batch, record)
+			if len(batch) < e.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			for len(e.records) > 0 && len(batch) < e.batchSize {
+				batch = append(batch, <-e.records)
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), analyticsSinkTimeout)
+			e.flush(flushCtx, batch)
+			cancel()
+			return
+		}
+		e.flush(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes batch to the sink. A failed batch is dropped: analytics are
+// best effort and retrying would only grow the backlog of a failing sink.
+func (e *analyticsExporter) flush(ctx context.Context, batch []AnalyticsRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	start := time.Now()
+	err := e.sink.Write(ctx, batch)
+	analyticsWriteDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		analyticsRecordsTotal.WithLabelValues("failed").Add(float64(len(batch)))
+		e.logger.Warn("failed to export routing analytics",
+			zap.Int("records", len(batch)),
+			zap.Error(err),
+		)
+		return
+	}
+	analyticsRecordsTotal.WithLabelValues("exported").Add(float64(len(batch)))
+}
+
+// SetAnalytics exports the routing decision of every request to sink, as
+// configured by config, for the target the processor serves. It must be
+// called before the processor serves requests, and the exporter only writes
+// once RunAnalytics is called.
+func (p *Processor) SetAnalytics(sink AnalyticsSink, config AnalyticsConfig, target string) {
+	p.analytics = newAnalyticsExporter(sink, config, target, p.logger)
+}
+
+// RunAnalytics writes the exported routing decisions until ctx is done. It
+// returns at once when SetAnalytics was not called.
+func (p *Processor) RunAnalytics(ctx context.Context) {
+	if p.analytics != nil {
+		p.analytics.run(ctx)
+	}
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestNewAnalyticsSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  AnalyticsConfig
+		wantErr bool
+	}{
+		{name: "http", config: AnalyticsConfig{Sink: AnalyticsSinkHTTP, Endpoint: "https://collector.example.com/routes"}},
+		{name: "http without endpoint", config: AnalyticsConfig{Sink: AnalyticsSinkHTTP}, wantErr: true},
+		{name: "clickhouse", config: AnalyticsConfig{Sink: AnalyticsSinkClickHouse, Endpoint: "http://clickhouse:8123", Table: "analytics.routes"}},
+		{name: "clickhouse table injection", config: AnalyticsConfig{Sink: AnalyticsSinkClickHouse, Endpoint: "http://clickhouse:8123", Table: "routes; DROP TABLE x"}, wantErr: true},
+		{name: "bigquery", config: AnalyticsConfig{Sink: AnalyticsSinkBigQuery, Table: "project.dataset.routes"}},
+		{name: "bigquery without project", config: AnalyticsConfig{Sink: AnalyticsSinkBigQuery, Table: "dataset.routes"}, wantErr: true},
+		{name: "unknown", config: AnalyticsConfig{Sink: "kafka"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAnalyticsSink(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAnalyticsSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAnalyticsSink_ClickHouse(t *testing.T) {
+	t.Setenv(ClickHouseUserEnv, "exporter")
+	t.Setenv(ClickHousePasswordEnv, "secret")
+
+	var query, user, key string
+	var rows []AnalyticsRecord
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		user, key = r.Header.Get("X-ClickHouse-User"), r.Header.Get("X-ClickHouse-Key")
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var row AnalyticsRecord
+			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+				t.Errorf("invalid JSONEachRow line %q: %v", scanner.Text(), err)
+			}
+			rows = append(rows, row)
+		}
+	}))
+	defer server.Close()
+
+	sink, err := NewAnalyticsSink(AnalyticsConfig{Sink: AnalyticsSinkClickHouse, Endpoint: server.URL, Table: "analytics.routes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []AnalyticsRecord{
+		{Host: "example.com", PathTemplate: "/api", Route: "default/api", RouteFound: true},
+		{Host: "example.com"},
+	}
+	if err := sink.Write(context.Background(), records); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if query != "INSERT INTO analytics.routes FORMAT JSONEachRow" {
+		t.Errorf("query = %q", query)
+	}
+	if user != "exporter" || key != "secret" {
+		t.Errorf("credentials = %q/%q, want exporter/secret", user, key)
+	}
+	if len(rows) != 2 || rows[0].Route != "default/api" || rows[1].RouteFound {
+		t.Errorf("rows = %+v, want the 2 records", rows)
+	}
+}
+
+func TestAnalyticsSink_BigQuery(t *testing.T) {
+	tokenRequests := 0
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			t.Error("token request without Metadata-Flavor: Google")
+		}
+		tokenRequests++
+		_, _ = io.WriteString(w, `{"access_token":"ya29.token","expires_in":3600,"token_type":"Bearer"}`)
+	}))
+	defer tokens.Close()
+
+	var path, authorization string
+	var insert struct {
+		Rows []struct {
+			JSON AnalyticsRecord `json:"json"`
+		} `json:"rows"`
+	}
+	rejectRows := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, authorization = r.URL.Path, r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&insert); err != nil {
+			t.Errorf("invalid insertAll body: %v", err)
+		}
+		if rejectRows {
+			_, _ = io.WriteString(w, `{"insertErrors":[{"index":0,"errors":[{"reason":"invalid","message":"no such field"}]}]}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	defer server.Close()
+
+	sink, err := NewAnalyticsSink(AnalyticsConfig{Sink: AnalyticsSinkBigQuery, Endpoint: server.URL, Table: "my-project.analytics.routes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.(*bigQuerySink).tokenURL = tokens.URL
+
+	records := []AnalyticsRecord{{Host: "example.com", Backend: "api.default.svc.cluster.local:8080"}}
+	for range 2 {
+		if err := sink.Write(context.Background(), records); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if path != "/bigquery/v2/projects/my-project/datasets/analytics/tables/routes/insertAll" {
+		t.Errorf("path = %q", path)
+	}
+	if authorization != "Bearer ya29.token" {
+		t.Errorf("Authorization = %q", authorization)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("token requested %d times, want 1 (cached)", tokenRequests)
+	}
+	if len(insert.Rows) != 1 || insert.Rows[0].JSON.Backend != records[0].Backend {
+		t.Errorf("rows = %+v", insert.Rows)
+	}
+
+	rejectRows = true
+	if err := sink.Write(context.Background(), records); err == nil {
+		t.Error("Write() succeeded although BigQuery rejected the rows")
+	}
+}
+
+// memorySink collects the batches written to it.
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]AnalyticsRecord
+}
+
+func (s *memorySink) Write(_ context.Context, records []AnalyticsRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]AnalyticsRecord(nil), records...))
+	return nil
+}
+
+func (s *memorySink) written() [][]AnalyticsRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+func TestAnalyticsExporter(t *testing.T) {
+	sink := &memorySink{}
+	exporter := newAnalyticsExporter(sink, AnalyticsConfig{BatchSize: 2, FlushInterval: time.Hour, BufferSize: 3}, "public", zap.NewNop())
+
+	matched := &requestContext{
+		startTime:      time.Now(),
+		authority:      "example.com",
+		method:         "GET",
+		path:           "/api/items",
+		routeFound:     true,
+		matchedPattern: "/api",
+		matchedType:    "prefix",
+		matchedBackend: "api.default.svc.cluster.local:8080",
+		routeSource:    "default/api",
+		routeRule:      "0",
+		routeOwner:     "team-api",
+	}
+	unmatched := &requestContext{startTime: time.Now(), authority: "example.com", path: "/unknown"}
+
+	// A full buffer drops records instead of blocking the request.
+	dropped := testutil.ToFloat64(analyticsRecordsTotal.WithLabelValues("dropped"))
+	for range 3 {
+		exporter.record(matched)
+	}
+	exporter.record(unmatched)
+	if got := testutil.ToFloat64(analyticsRecordsTotal.WithLabelValues("dropped")); got != dropped+1 {
+		t.Errorf("dropped records = %v, want %v", got, dropped+1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		exporter.run(ctx)
+		close(done)
+	}()
+	// A full batch is written without waiting for the flush interval.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.written()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The last record is written when the exporter stops.
+	exporter.record(unmatched)
+	cancel()
+	<-done
+
+	batches := sink.written()
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 2 {
+		t.Fatalf("batches = %v, want 2 batches of 2 records", batches)
+	}
+	got := batches[0][0]
+	if got.Target != "public" || got.PathTemplate != "/api" || got.Route != "default/api" || got.Owner != "team-api" ||
+		got.Backend == "" || !got.RouteFound {
+		t.Errorf("record = %+v, want the matched route", got)
+	}
+	if last := batches[1][1]; last.RouteFound || last.PathTemplate != "" || last.Host != "example.com" {
+		t.Errorf("record = %+v, want the unmatched request", last)
+	}
+}
@@ -0,0 +1,299 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Analytics sink kinds, selected with ServerConfig.Analytics.Sink.
+const (
+	// AnalyticsSinkHTTP POSTs every batch as newline-delimited JSON.
+	AnalyticsSinkHTTP = "http"
+
+	// AnalyticsSinkClickHouse inserts every batch into a ClickHouse table
+	// through its HTTP interface.
+	AnalyticsSinkClickHouse = "clickhouse"
+
+	// AnalyticsSinkBigQuery streams every batch into a BigQuery table with
+	// the tabledata.insertAll API.
+	AnalyticsSinkBigQuery = "bigquery"
+)
+
+const (
+	// defaultBigQueryEndpoint is the BigQuery REST API.
+	defaultBigQueryEndpoint = "https://bigquery.googleapis.com"
+
+	// gceTokenURL serves access tokens of the workload's Google service
+	// account (GKE Workload Identity or the node's service account).
+	gceTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+	// analyticsSinkTimeout bounds a single batch write.
+	analyticsSinkTimeout = 30 * time.Second
+
+	// maxSinkErrorBody caps how much of an error response is reported.
+	maxSinkErrorBody = 1024
+)
+
+// Environment variables holding the analytics sink credentials, kept out of
+// flags so they do not show up in the pod spec.
+const (
+	// AnalyticsTokenEnv is a bearer token sent to the http and bigquery
+	// sinks. The bigquery sink asks the GCE metadata server for one when it
+	// is unset.
+	AnalyticsTokenEnv = "ANALYTICS_TOKEN"
+
+	// ClickHouseUserEnv and ClickHousePasswordEnv authenticate the
+	// clickhouse sink.
+	ClickHouseUserEnv     = "CLICKHOUSE_USER"
+	ClickHousePasswordEnv = "CLICKHOUSE_PASSWORD"
+)
+
+// clickHouseTable matches a "table" or "database.table" name.
+var clickHouseTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// AnalyticsSink writes batches of routing decisions to an analytics store.
+type AnalyticsSink interface {
+	Write(ctx context.Context, records []AnalyticsRecord) error
+}
+
+// NewAnalyticsSink returns the sink config selects. Credentials are read
+// from the environment (AnalyticsTokenEnv, ClickHouseUserEnv and
+// ClickHousePasswordEnv).
+func NewAnalyticsSink(config AnalyticsConfig) (AnalyticsSink, error) {
+	client := &http.Client{Timeout: analyticsSinkTimeout}
+	token := os.Getenv(AnalyticsTokenEnv)
+
+	switch config.Sink {
+	case AnalyticsSinkHTTP:
+		if _, err := url.ParseRequestURI(config.Endpoint); err != nil || config.Endpoint == "" {
+			return nil, fmt.Errorf("the http analytics sink needs an endpoint URL: %q", config.Endpoint)
+		}
+		return &httpSink{client: client, endpoint: config.Endpoint, token: token}, nil
+
+	case AnalyticsSinkClickHouse:
+		if _, err := url.ParseRequestURI(config.Endpoint); err != nil || config.Endpoint == "" {
+			return nil, fmt.Errorf("the clickhouse analytics sink needs the URL of its HTTP interface: %q", config.Endpoint)
+		}
+		if !clickHouseTable.MatchString(config.Table) {
+			return nil, fmt.Errorf("invalid clickhouse table %q, must be table or database.table", config.Table)
+		}
+		query := url.Values{}
+		query.Set("query", "INSERT INTO "+config.Table+" FORMAT JSONEachRow")
+		query.Set("date_time_input_format", "best_effort")
+		return &httpSink{
+			client:   client,
+			endpoint: strings.TrimSuffix(config.Endpoint, "/") + "/?" + query.Encode(),
+			headers: map[string]string{
+				"X-ClickHouse-User": os.Getenv(ClickHouseUserEnv),
+				"X-ClickHouse-Key":  os.Getenv(ClickHousePasswordEnv),
+			},
+		}, nil
+
+	case AnalyticsSinkBigQuery:
+		parts := strings.Split(config.Table, ".")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid bigquery table %q, must be project.dataset.table", config.Table)
+		}
+		endpoint := config.Endpoint
+		if endpoint == "" {
+			endpoint = defaultBigQueryEndpoint
+		}
+		return &bigQuerySink{
+			client: client,
+			endpoint: fmt.Sprintf("%s/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll",
+				strings.TrimSuffix(endpoint, "/"),
+				url.PathEscape(parts[0]), url.PathEscape(parts[1]), url.PathEscape(parts[2])),
+			token:    token,
+			tokenURL: gceTokenURL,
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid analytics sink %q, must be %s, %s or %s",
+		config.Sink, AnalyticsSinkHTTP, AnalyticsSinkClickHouse, AnalyticsSinkBigQuery)
+}
+
+// httpSink POSTs batches as newline-delimited JSON, one record per line.
+// ClickHouse's JSONEachRow input format is the same encoding.
+type httpSink struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	headers  map[string]string
+}
+
+func (s *httpSink) Write(ctx context.Context, records []AnalyticsRecord) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			return fmt.Errorf("encoding analytics record: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	for name, value := range s.headers {
+		if value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	_, err = doSinkRequest(s.client, req)
+	return err
+}
+
+// bigQuerySink streams batches with the tabledata.insertAll API.
+type bigQuerySink struct {
+	client   *http.Client
+	endpoint string
+
+	// token is a static access token. When empty, tokens are requested
+	// from tokenURL and cached until they expire.
+	token    string
+	tokenURL string
+
+	mu          sync.Mutex
+	cached      string
+	cachedUntil time.Time
+}
+
+// bigQueryInsertRequest is the tabledata.insertAll request body.
+type bigQueryInsertRequest struct {
+	Rows []bigQueryRow `json:"rows"`
+}
+
+type bigQueryRow struct {
+	JSON *AnalyticsRecord `json:"json"`
+}
+
+// bigQueryInsertResponse is the part of the tabledata.insertAll response
+// reporting rows that were not inserted; the request itself succeeds.
+type bigQueryInsertResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+func (s *bigQuerySink) Write(ctx context.Context, records []AnalyticsRecord) error {
+	insert := bigQueryInsertRequest{Rows: make([]bigQueryRow, len(records))}
+	for i := range records {
+		insert.Rows[i].JSON = &records[i]
+	}
+	body, err := json.Marshal(insert)
+	if err != nil {
+		return fmt.Errorf("encoding analytics records: %w", err)
+	}
+
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	respBody, err := doSinkRequest(s.client, req)
+	if err != nil {
+		return err
+	}
+
+	var resp bigQueryInsertResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("decoding insertAll response: %w", err)
+	}
+	if len(resp.InsertErrors) > 0 {
+		first := resp.InsertErrors[0]
+		reason := ""
+		if len(first.Errors) > 0 {
+			reason = first.Errors[0].Reason + ": " + first.Errors[0].Message
+		}
+		return fmt.Errorf("bigquery rejected %d of %d rows, row %d: %s",
+			len(resp.InsertErrors), len(records), first.Index, reason)
+	}
+	return nil
+}
+
+// accessToken returns the static token, or a cached or fresh token from
+// the metadata server.
+func (s *bigQuerySink) accessToken(ctx context.Context) (string, error) {
+	if s.token != "" {
+		return s.token, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached != "" && time.Now().Before(s.cachedUntil) {
+		return s.cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	body, err := doSinkRequest(s.client, req)
+	if err != nil {
+		return "", fmt.Errorf("requesting bigquery access token: %w", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid access token response from %s", s.tokenURL)
+	}
+	s.cached = token.AccessToken
+	// Refresh a minute early so a token never expires mid-request.
+	s.cachedUntil = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return s.cached, nil
+}
+
+// doSinkRequest sends req and returns the response body, or an error for a
+// non-2xx status.
+func doSinkRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxSinkErrorBody))
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return io.ReadAll(resp.Body)
+}
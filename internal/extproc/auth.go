@@ -0,0 +1,197 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/freepik-company/customrouter/pkg/matcher"
+	"github.com/freepik-company/customrouter/pkg/routes"
+	"go.uber.org/zap"
+)
+
+// maxAuthDenialBodySize caps how much of a denial body from the authorization
+// service is relayed to the client.
+const maxAuthDenialBodySize = 64 * 1024
+
+// authDenialHeaders are the authorization response headers relayed to the
+// client when a request is denied, so login redirects and authentication
+// challenges keep working.
+var authDenialHeaders = []string{"location", "www-authenticate", "set-cookie", "content-type"}
+
+// authDecision is the outcome of the require-auth actions of a route.
+type authDecision struct {
+	// denial is the immediate response returned to the client when the
+	// request is not authorized. Nil when the request may be forwarded.
+	denial *extprocv3.ProcessingResponse
+
+	// setHeaders and removeHeaders are applied to the forwarded request:
+	// the configured upstream headers are copied from the authorization
+	// response, or stripped when the response does not carry them so
+	// clients cannot spoof them.
+	setHeaders    []*corev3.HeaderValueOption
+	removeHeaders []string
+}
+
+// newAuthClient returns the HTTP client used for require-auth checks.
+// Redirects are not followed: a 3xx from the authorization service is a
+// denial that must reach the client (typically a redirect to a login page).
+func newAuthClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// authorize runs every require-auth action of the route in order and stops
+// at the first denial.
+func (p *Processor) authorize(ctx context.Context, route *routes.Route, vars *matcher.Vars, requestHeaders map[string]string) *authDecision {
+	decision := &authDecision{}
+	for _, action := range route.Actions {
+		if action.Type != routes.ActionTypeRequireAuth || action.AuthURL == "" {
+			continue
+		}
+		p.checkAuth(ctx, action, vars, requestHeaders, decision)
+		if decision.denial != nil {
+			return decision
+		}
+	}
+	return decision
+}
+
+// checkAuth performs a single authorization request and records its outcome
+// in the decision.
+func (p *Processor) checkAuth(ctx context.Context, action routes.RouteAction, vars *matcher.Vars, requestHeaders map[string]string, decision *authDecision) {
+	timeout := time.Duration(action.AuthTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = routes.DefaultAuthTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, action.AuthURL, nil)
+	if err != nil {
+		p.authFailure(action, decision, err)
+		return
+	}
+	for _, name := range action.AuthForwardHeaders {
+		if value, ok := requestHeaders[strings.ToLower(name)]; ok {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("X-Forwarded-Method", vars.Method)
+	req.Header.Set("X-Forwarded-Proto", vars.Scheme)
+	req.Header.Set("X-Forwarded-Host", vars.Host)
+	req.Header.Set("X-Forwarded-Uri", vars.Path)
+
+	resp, err := p.authClient.Do(req)
+	if err != nil {
+		p.authFailure(action, decision, err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		authChecksTotal.WithLabelValues("allowed").Inc()
+		for _, name := range action.AuthUpstreamHeaders {
+			values := resp.Header.Values(name)
+			if len(values) == 0 {
+				decision.removeHeaders = append(decision.removeHeaders, name)
+				continue
+			}
+			decision.setHeaders = append(decision.setHeaders, &corev3.HeaderValueOption{
+				Header: &corev3.HeaderValue{
+					Key:      strings.ToLower(name),
+					RawValue: []byte(strings.Join(values, ",")),
+				},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			})
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxAuthDenialBodySize))
+
+	case resp.StatusCode >= 500:
+		p.authFailure(action, decision, nil)
+
+	default:
+		authChecksTotal.WithLabelValues("denied").Inc()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxAuthDenialBodySize))
+		var headers []*corev3.HeaderValueOption
+		for _, name := range authDenialHeaders {
+			for _, value := range resp.Header.Values(name) {
+				headers = append(headers, &corev3.HeaderValueOption{
+					Header: &corev3.HeaderValue{
+						Key:      name,
+						RawValue: []byte(value),
+					},
+					AppendAction: corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD,
+				})
+			}
+		}
+		p.logger.Debug("request denied by authorization service",
+			zap.String("auth_url", action.AuthURL),
+			zap.Int("status_code", resp.StatusCode),
+		)
+		decision.denial = buildAuthDenial(resp.StatusCode, headers, body)
+	}
+}
+
+// authFailure handles an authorization service that could not give an
+// answer: the request is let through when the action fails open, and denied
+// with 403 otherwise, matching Envoy's ext_authz default. A request let
+// through has the action's upstream headers stripped, since no
+// authorization response vouches for the values the client sent.
+func (p *Processor) authFailure(action routes.RouteAction, decision *authDecision, err error) {
+	authChecksTotal.WithLabelValues("error").Inc()
+	p.logger.Warn("authorization service unavailable",
+		zap.String("auth_url", action.AuthURL),
+		zap.Bool("fail_open", action.AuthFailOpen),
+		zap.Error(err),
+	)
+	if action.AuthFailOpen {
+		decision.removeHeaders = append(decision.removeHeaders, action.AuthUpstreamHeaders...)
+		return
+	}
+	decision.denial = buildAuthDenial(http.StatusForbidden, nil, nil)
+}
+
+// buildAuthDenial creates the immediate response returned to the client
+// when a require-auth check denies the request.
+func buildAuthDenial(statusCode int, headers []*corev3.HeaderValueOption, body []byte) *extprocv3.ProcessingResponse {
+	resp := &extprocv3.ImmediateResponse{
+		Status: &typev3.HttpStatus{
+			Code: typev3.StatusCode(statusCode),
+		},
+		Body: body,
+	}
+	if len(headers) > 0 {
+		resp.Headers = &extprocv3.HeaderMutation{SetHeaders: headers}
+	}
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: resp,
+		},
+	}
+}
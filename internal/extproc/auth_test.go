@@ -0,0 +1,210 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/freepik-company/customrouter/pkg/matcher"
+	"github.com/freepik-company/customrouter/pkg/routes"
+	"go.uber.org/zap"
+)
+
+func authRoute(url string, mutate func(*routes.RouteAction)) *routes.Route {
+	action := routes.RouteAction{
+		Type:                routes.ActionTypeRequireAuth,
+		AuthURL:             url,
+		AuthForwardHeaders:  routes.DefaultAuthForwardHeaders,
+		AuthUpstreamHeaders: []string{"x-user-id", "x-user-roles"},
+		AuthTimeoutMs:       1000,
+	}
+	if mutate != nil {
+		mutate(&action)
+	}
+	return &routes.Route{
+		Path:    "/api",
+		Type:    routes.RouteTypePrefix,
+		Backend: "api.default.svc.cluster.local:8080",
+		Actions: []routes.RouteAction{action},
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-Uri") != "/api/items?q=1" || r.Header.Get("X-Forwarded-Method") != "POST" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			w.Header().Set("X-User-Id", "42")
+			w.WriteHeader(http.StatusOK)
+		case "Bearer broken":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "":
+			w.Header().Set("Location", "https://login.example.com/")
+			w.WriteHeader(http.StatusFound)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("invalid token"))
+		}
+	}))
+	defer authServer.Close()
+
+	p := NewProcessor(nil, zap.NewNop(), false)
+	vars := &matcher.Vars{Host: "example.com", Path: "/api/items?q=1", Method: "POST", Scheme: "https"}
+
+	tests := []struct {
+		name          string
+		authorization string
+		mutate        func(*routes.RouteAction)
+		wantStatus    int
+		wantHeader    string
+		wantSet       map[string]string
+		wantRemoved   []string
+	}{
+		{
+			name:          "allowed copies upstream headers and strips missing ones",
+			authorization: "Bearer good",
+			wantSet:       map[string]string{"x-user-id": "42"},
+			wantRemoved:   []string{"x-user-roles"},
+		},
+		{
+			name:          "401 is relayed with its challenge and body",
+			authorization: "Bearer bad",
+			wantStatus:    http.StatusUnauthorized,
+			wantHeader:    "www-authenticate",
+		},
+		{
+			name:       "redirect to login is relayed, not followed",
+			wantStatus: http.StatusFound,
+			wantHeader: "location",
+		},
+		{
+			name:          "5xx denies with 403 by default",
+			authorization: "Bearer broken",
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "5xx is let through when failing open, without upstream headers",
+			authorization: "Bearer broken",
+			mutate:        func(a *routes.RouteAction) { a.AuthFailOpen = true },
+			wantRemoved:   []string{"x-user-id", "x-user-roles"},
+		},
+		{
+			name:          "unreachable service failing open strips upstream headers",
+			authorization: "Bearer good",
+			mutate: func(a *routes.RouteAction) {
+				a.AuthURL = "http://127.0.0.1:1/"
+				a.AuthFailOpen = true
+			},
+			wantRemoved: []string{"x-user-id", "x-user-roles"},
+		},
+		{
+			name:          "unreachable service denies with 403",
+			authorization: "Bearer good",
+			mutate:        func(a *routes.RouteAction) { a.AuthURL = "http://127.0.0.1:1/" },
+			wantStatus:    http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.authorization != "" {
+				headers["authorization"] = tt.authorization
+			}
+			decision := p.authorize(context.Background(), authRoute(authServer.URL+"/verify", tt.mutate), vars, headers)
+
+			if tt.wantStatus == 0 {
+				if decision.denial != nil {
+					t.Fatalf("expected request to be allowed, got %v", decision.denial)
+				}
+				set := map[string]string{}
+				for _, h := range decision.setHeaders {
+					set[h.Header.Key] = string(h.Header.RawValue)
+				}
+				for k, v := range tt.wantSet {
+					if set[k] != v {
+						t.Errorf("upstream header %q = %q, want %q", k, set[k], v)
+					}
+				}
+				if !slices.Equal(decision.removeHeaders, tt.wantRemoved) {
+					t.Errorf("removed headers = %v, want %v", decision.removeHeaders, tt.wantRemoved)
+				}
+				return
+			}
+
+			immediate := decision.denial.GetImmediateResponse()
+			if immediate == nil {
+				t.Fatalf("expected an immediate response, got %v", decision.denial)
+			}
+			if got := int(immediate.Status.Code); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			if tt.wantHeader != "" {
+				found := false
+				for _, h := range immediate.GetHeaders().GetSetHeaders() {
+					if h.Header.Key == tt.wantHeader {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("expected header %q in denial, got %v", tt.wantHeader, immediate.GetHeaders())
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizeTimeout(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer authServer.Close()
+
+	p := NewProcessor(nil, zap.NewNop(), false)
+	route := authRoute(authServer.URL, func(a *routes.RouteAction) { a.AuthTimeoutMs = 20 })
+
+	start := time.Now()
+	decision := p.authorize(context.Background(), route, &matcher.Vars{}, map[string]string{})
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("authorization did not honor the timeout, took %v", elapsed)
+	}
+	if got := int(decision.denial.GetImmediateResponse().GetStatus().GetCode()); got != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", got, http.StatusForbidden)
+	}
+}
+
+func TestAuthorizeWithoutAuthActions(t *testing.T) {
+	p := NewProcessor(nil, zap.NewNop(), false)
+	route := &routes.Route{Actions: []routes.RouteAction{{Type: routes.ActionTypeHeaderSet, HeaderName: "x", Value: "y"}}}
+
+	decision := p.authorize(context.Background(), route, &matcher.Vars{}, nil)
+	if decision.denial != nil || len(decision.setHeaders) != 0 || len(decision.removeHeaders) != 0 {
+		t.Errorf("expected an empty decision, got %+v", decision)
+	}
+}
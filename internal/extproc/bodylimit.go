@@ -0,0 +1,92 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"strconv"
+	"strings"
+
+	extprocfilterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// checkRequestSize enforces the MaxRequestBytes of route on a request from
+// its headers. tooLarge is set when its Content-Length is over the limit.
+// bufferBody is set when the request has a body of unknown length, which
+// must then be buffered (see bufferRequestBody) and checked by
+// checkRequestBody.
+func checkRequestSize(
+	route *routes.Route,
+	requestHeaders map[string]string,
+	endOfStream bool,
+) (tooLarge, bufferBody bool) {
+	if route.MaxRequestBytes <= 0 || endOfStream {
+		return false, false
+	}
+	if value, ok := requestHeaders["content-length"]; ok {
+		if length, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return length > route.MaxRequestBytes, false
+		}
+	}
+	return false, true
+}
+
+// bufferRequestBody asks Envoy to send the whole request body before it
+// forwards the request, so processRequestBody can reject it. The ext_proc
+// filter must allow mode overrides; the attachment's EnvoyFilter does. A
+// body larger than the Envoy buffer limit is answered with 413 by Envoy.
+func bufferRequestBody(resp *extprocv3.ProcessingResponse) {
+	if resp.ModeOverride == nil {
+		resp.ModeOverride = &extprocfilterv3.ProcessingMode{}
+	}
+	resp.ModeOverride.RequestBodyMode = extprocfilterv3.ProcessingMode_BUFFERED
+}
+
+// processRequestBody checks a request body buffered by bufferRequestBody
+// against the limit of its route.
+func (p *Processor) processRequestBody(body *extprocv3.HttpBody, streamCtx *streamContext) *extprocv3.ProcessingResponse {
+	if streamCtx != nil && streamCtx.maxRequestBytes > 0 {
+		streamCtx.requestBodyBytes += int64(len(body.GetBody()))
+		if streamCtx.requestBodyBytes > streamCtx.maxRequestBytes {
+			// The request never reaches the backend.
+			streamCtx.trackOutlier = false
+			requestsTooLargeTotal.Inc()
+			return buildRequestTooLargeResponse()
+		}
+	}
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_RequestBody{
+			RequestBody: &extprocv3.BodyResponse{},
+		},
+	}
+}
+
+// buildRequestTooLargeResponse answers a request over the maxRequestBytes
+// of its route.
+func buildRequestTooLargeResponse() *extprocv3.ProcessingResponse {
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode_PayloadTooLarge},
+				Details: "customrouter_request_too_large",
+			},
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package extproc
+
+import (
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocfilterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestProcessRequest_MaxRequestBytes(t *testing.T) {
+	route := &routes.Route{
+		Path:            "/upload",
+		Type:            routes.RouteTypePrefix,
+		Backend:         "legacy.default.svc.cluster.local:8080",
+		MaxRequestBytes: 10,
+	}
+
+	tests := []struct {
+		name          string
+		contentLength string
+		endOfStream   bool
+		body          string
+		wantRejected  bool
+		wantBuffered  bool
+	}{
+		{name: "content-length within limit", contentLength: "10"},
+		{name: "content-length over limit", contentLength: "11", wantRejected: true},
+		{name: "no body", endOfStream: true},
+		{name: "chunked body within limit", body: "0123456789", wantBuffered: true},
+		{name: "chunked body over limit", body: "0123456789a", wantBuffered: true, wantRejected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+			streamCtx := &streamContext{}
+			headers := []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: "/upload/file"},
+				{Key: ":method", Value: "POST"},
+			}
+			if tt.contentLength != "" {
+				headers = append(headers, &corev3.HeaderValue{Key: "content-length", Value: tt.contentLength})
+			}
+			resp, _, err := p.processRequest(&extprocv3.ProcessingRequest{
+				Request: &extprocv3.ProcessingRequest_RequestHeaders{
+					RequestHeaders: &extprocv3.HttpHeaders{
+						Headers:     &corev3.HeaderMap{Headers: headers},
+						EndOfStream: tt.endOfStream,
+					},
+				},
+			}, streamCtx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			buffered := resp.GetModeOverride().GetRequestBodyMode() == extprocfilterv3.ProcessingMode_BUFFERED
+			if buffered != tt.wantBuffered {
+				t.Errorf("request body buffered = %v, want %v", buffered, tt.wantBuffered)
+			}
+			if buffered {
+				resp, _, err = p.processRequest(&extprocv3.ProcessingRequest{
+					Request: &extprocv3.ProcessingRequest_RequestBody{
+						RequestBody: &extprocv3.HttpBody{Body: []byte(tt.body), EndOfStream: true},
+					},
+				}, streamCtx)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			rejected := resp.GetImmediateResponse().GetStatus().GetCode() == typev3.StatusCode_PayloadTooLarge
+			if rejected != tt.wantRejected {
+				t.Errorf("rejected with 413 = %v, want %v (response %v)", rejected, tt.wantRejected, resp)
+			}
+		})
+	}
+}
+
+func TestTrackResponseKeepsBodyBuffering(t *testing.T) {
+	resp := &extprocv3.ProcessingResponse{}
+	bufferRequestBody(resp)
+	trackResponse(resp)
+	mode := resp.GetModeOverride()
+	if mode.GetRequestBodyMode() != extprocfilterv3.ProcessingMode_BUFFERED ||
+		mode.GetResponseHeaderMode() != extprocfilterv3.ProcessingMode_SEND {
+		t.Errorf("mode override = %v, want buffered request body and sent response headers", mode)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// SetClusterNaming configures how the cluster of the backend a request is
+// routed to is named, when the attachment sets no clusterName. The zero
+// value names clusters like Istio.
+func (p *Processor) SetClusterNaming(n routes.ClusterNaming) {
+	p.clusterNaming = n
+}
+
+// streamClusterNaming returns the clusterName settings an
+// ExternalProcessorAttachment passed as gRPC initial metadata. An invalid
+// template is ignored, like a template that was not set.
+func streamClusterNaming(ctx context.Context) routes.ClusterNaming {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return routes.ClusterNaming{}
+	}
+	var n routes.ClusterNaming
+	if values := md.Get(routes.ClusterNameTemplateMetadataKey); len(values) > 0 &&
+		routes.ValidateClusterNameTemplate(values[0]) == nil {
+		n.Template = values[0]
+	}
+	if values := md.Get(routes.ClusterDomainMetadataKey); len(values) > 0 {
+		n.Domain = values[0]
+	}
+	return n
+}
+
+// resolveClusterNaming returns the cluster naming of the requests of a
+// stream: the attachment's settings over the processor default.
+func (p *Processor) resolveClusterNaming(streamCtx *streamContext) routes.ClusterNaming {
+	if streamCtx == nil {
+		return p.clusterNaming
+	}
+	return p.clusterNaming.Merge(streamCtx.clusterNaming)
+}
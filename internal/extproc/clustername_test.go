@@ -0,0 +1,100 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestStreamClusterNaming(t *testing.T) {
+	if got := streamClusterNaming(context.Background()); got != (routes.ClusterNaming{}) {
+		t.Errorf("without metadata = %+v, want none", got)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		routes.ClusterNameTemplateMetadataKey, "{service}.{namespace}:{port}",
+		routes.ClusterDomainMetadataKey, "corp.internal"))
+	want := routes.ClusterNaming{Template: "{service}.{namespace}:{port}", Domain: "corp.internal"}
+	if got := streamClusterNaming(ctx); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	ctx = metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(routes.ClusterNameTemplateMetadataKey, "outbound||{host}"))
+	if got := streamClusterNaming(ctx); got != (routes.ClusterNaming{}) {
+		t.Errorf("invalid template = %+v, want none", got)
+	}
+}
+
+func TestProcessRequestHeaders_ClusterNaming(t *testing.T) {
+	route := &routes.Route{
+		Path:    "/api",
+		Type:    routes.RouteTypePrefix,
+		Backend: "api.default.svc.cluster.local:8080",
+	}
+	request := &extprocv3.HttpHeaders{
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":authority", Value: "example.com"},
+			{Key: ":path", Value: "/api"},
+		}},
+	}
+
+	tests := []struct {
+		name   string
+		flags  routes.ClusterNaming
+		stream routes.ClusterNaming
+		want   string
+	}{
+		{name: "default", want: "outbound|8080||api.default.svc.cluster.local"},
+		{
+			name:  "processor flags",
+			flags: routes.ClusterNaming{Domain: "corp.internal"},
+			want:  "outbound|8080||api.default.svc.corp.internal",
+		},
+		{
+			name:   "attachment overrides the template",
+			flags:  routes.ClusterNaming{Domain: "corp.internal"},
+			stream: routes.ClusterNaming{Template: "{service}.{namespace}.{domain}:{port}"},
+			want:   "api.default.corp.internal:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+			p.SetClusterNaming(tt.flags)
+
+			resp, _, err := p.processRequestHeaders(request, &streamContext{clusterNaming: tt.stream})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := setHeaderValue(resp, "x-customrouter-cluster"); got != tt.want {
+				t.Errorf("x-customrouter-cluster = %q, want %q", got, tt.want)
+			}
+			cluster := resp.GetDynamicMetadata().GetFields()[routes.RoutingMetadataNamespace].
+				GetStructValue().GetFields()[routes.RoutingMetadataCluster].GetStringValue()
+			if cluster != tt.want {
+				t.Errorf("routing metadata cluster = %q, want %q", cluster, tt.want)
+			}
+		})
+	}
+}
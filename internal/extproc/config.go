@@ -19,7 +19,11 @@ package extproc
 import (
 	"time"
 
+	"go.uber.org/zap"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
 // ServerConfig holds gRPC server configuration options
@@ -31,9 +35,31 @@ type ServerConfig struct {
 	// Only ConfigMaps with label customrouter.freepik.com/target=<TargetName> will be loaded
 	TargetName string
 
-	// K8sClient is the Kubernetes client for reading ConfigMaps
+	// K8sClient is the Kubernetes client for reading ConfigMaps. Not needed
+	// when RoutesBucket is set, unless RuntimeConfigMap or
+	// BackendHealthEndpoints is.
 	K8sClient kubernetes.Interface
 
+	// RoutesBucket, when set, replaces the route ConfigMaps as the route
+	// source: routes are read from the object the controller publishes
+	// there for TargetName, for extprocs running outside the cluster.
+	RoutesBucket objectstore.Bucket
+
+	// RoutesBucketPollInterval is how often RoutesBucket is checked for new
+	// routes. Zero uses routes.DefaultBucketPollInterval.
+	RoutesBucketPollInterval time.Duration
+
+	// TLSCertFile and TLSKeyFile, when set, serve the gRPC listener over TLS
+	// with this certificate and key. They are reloaded when the files change.
+	// Empty serves plaintext, for meshes that already encrypt the hop.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSClientCAFile, when set, requires clients (Envoy) to present a
+	// certificate signed by one of the CAs in this PEM bundle (mTLS).
+	// Requires TLSCertFile.
+	TLSClientCAFile string
+
 	// MaxRecvMsgSize is the maximum message size the server can receive (bytes)
 	MaxRecvMsgSize int
 
@@ -66,14 +92,71 @@ type ServerConfig struct {
 	// AccessLogEnabled enables access logging
 	AccessLogEnabled bool
 
+	// AccessLogSampleRate is the fraction of requests, from 0 to 1, that get
+	// an access log line when AccessLogEnabled is set.
+	AccessLogSampleRate float64
+
+	// DebugLogRate, when positive, is the most debug log lines written per
+	// second; the rest are dropped. 0 writes every debug line.
+	DebugLogRate float64
+
+	// LogLevel, when set, is the level of the logger passed to NewServer, so
+	// RuntimeConfigMap can change it.
+	LogLevel *zap.AtomicLevel
+
+	// RuntimeConfigMap, when set, is the "namespace/name" of a ConfigMap
+	// watched for settings applied without a restart: the log level, the
+	// access log and its sample rate, and the debug trace hosts (see
+	// ParseRuntimeConfig). Keys it leaves out, or a deleted ConfigMap, fall
+	// back to the flags. Requires K8sClient.
+	RuntimeConfigMap string
+
+	// BackendHealthEndpoints watches the EndpointSlices of every namespace,
+	// so fallback chains with the Endpoints signal skip the backends without
+	// ready endpoints. When false those chains always use their first
+	// backend. Requires K8sClient.
+	BackendHealthEndpoints bool
+
 	// RoutesNamespace restricts ConfigMap loading to a specific namespace.
 	// Empty string means all namespaces (backward compatible).
 	RoutesNamespace string
 
+	// AllowedSourceNamespaces, when non-empty, lists the only namespaces
+	// route ConfigMaps are loaded from; labeled ConfigMaps in any other
+	// namespace are ignored.
+	AllowedSourceNamespaces []string
+
+	// RoutesSigningKey, when set, is the key shared with the controller's
+	// --routes-signing-key-file: only route ConfigMaps carrying a valid
+	// routes.SignatureAnnotation are loaded.
+	RoutesSigningKey []byte
+
+	// RoutesEncryptionKey, when set, is the key shared with the controller's
+	// --routes-encryption-key-file, decrypting the route ConfigMaps it
+	// encrypts.
+	RoutesEncryptionKey []byte
+
 	// MetricsAddr is the address to expose Prometheus metrics on (e.g. ":9090").
 	// Empty string disables the metrics endpoint.
 	MetricsAddr string
 
+	// HealthAddr is the address to serve the plain HTTP /healthz, /readyz and
+	// /version endpoints on (e.g. ":8081"), for HTTP probes and load-balancer
+	// checks, along with the /debug/routes endpoints. Empty string disables
+	// the listener; gRPC health is always served.
+	HealthAddr string
+
+	// RoutesHistorySize is how many route table generations are kept for the
+	// /debug/routes endpoints on HealthAddr, to export them and diff them
+	// against the current one. Zero, the default, disables the endpoints:
+	// they export the whole route table, decrypted, to anyone reaching
+	// HealthAddr unless RoutesDebugToken is set.
+	RoutesHistorySize int
+
+	// RoutesDebugToken, when non-empty, must be sent as an
+	// "Authorization: Bearer" header to the /debug/routes endpoints.
+	RoutesDebugToken string
+
 	// RoutePartitionHeader, when non-empty, enables a header-based fast-path
 	// index for route lookup: requests carrying this header are matched only
 	// against the routes that share its value, instead of scanning every route
@@ -83,29 +166,174 @@ type ServerConfig struct {
 	// no-op unless explicitly set.
 	RoutePartitionHeader string
 
+	// MaxRouteTableBytes, when positive, is the memory budget of the route
+	// table: a load whose merged table has a larger estimated size (see
+	// routes.RoutesConfig.EstimatedSize) is not served, the previous table
+	// is kept and the largest hosts are logged and exported, so targets can
+	// be split before the processor runs out of memory.
+	//
+	// The budget bounds one table, not the memory of the processor. Up to
+	// RoutesHistorySize tables are kept (at least the one served), sharing
+	// the hosts that did not change, a reload holds the new table besides
+	// them, and the informer caches the route ConfigMaps, up to about one
+	// more table when uncompressed. Compiled regexes and the partition and
+	// variant indexes come on top. Size the memory limit for about
+	// max(RoutesHistorySize, 1)+2 times the budget.
+	MaxRouteTableBytes int
+
 	// RoutesReloadDebounce coalesces ConfigMap change events: after a change,
 	// the loader waits this long (absorbing further changes) before rebuilding
 	// the route table once, capping full rebuilds at one per window under churn.
 	// This protects CPU when many ConfigMaps change rapidly (e.g. large
 	// sandbox environments). Zero rebuilds on every event.
 	RoutesReloadDebounce time.Duration
+
+	// RoutesReloadJitter adds a random delay of up to this long before every
+	// route table rebuild, so the replicas of a target spread their rebuilds
+	// instead of all running them at once. Zero disables it.
+	RoutesReloadJitter time.Duration
+
+	// RoutesResyncPeriod is how often the ConfigMap informer re-delivers
+	// every cached route ConfigMap, triggering a rebuild that only decodes
+	// what changed. Zero uses routes.DefaultResyncPeriod; negative disables
+	// resyncs.
+	RoutesResyncPeriod time.Duration
+
+	// SnapshotPath, when non-empty, is a local file where the last-known-good
+	// merged route config is persisted after every successful load. On start,
+	// an existing snapshot is served immediately while the ConfigMaps are
+	// loaded in the background, so a slow or unavailable API server does not
+	// delay (or fail) the extproc start. Empty disables snapshots.
+	SnapshotPath string
+
+	// DecisionHeaders is the default mode for the x-original-authority and
+	// x-customrouter-matched-* headers describing the routing decision:
+	// "always", "never" or "on-debug". Routes and attachments may override it.
+	// Defaults to on-debug so routing internals do not reach backends unless
+	// a request asks for them.
+	DecisionHeaders string
+
+	// DebugHeader is the request header that enables the decision headers in
+	// "on-debug" mode.
+	DebugHeader string
+
+	// DebugHeaderValue, when non-empty, is the value DebugHeader must carry
+	// for "on-debug" to emit the decision headers, so only clients knowing it
+	// can see routing internals. Empty accepts any value.
+	DebugHeaderValue string
+
+	// ConfigHashHeader adds the x-customrouter-config-hash header, the hash
+	// of the route table being served, to requests carrying DebugHeader: to
+	// the forwarded request, or to the response of requests answered right
+	// away. The hash is always exported as a metric and in access logs.
+	ConfigHashHeader bool
+
+	// RequireRoutes makes NewServer fail when no routes exist for
+	// TargetName (see checkTarget) instead of starting with an empty route
+	// table and a warning.
+	RequireRoutes bool
+
+	// HostMetrics records host_requests_total, the requests of each host of
+	// the route table labeled with TargetName, for per-host route miss
+	// ratios. Like the other request metrics, it needs AccessLogEnabled.
+	HostMetrics bool
+
+	// MissDiagnostics logs, for every request matching no route of a host
+	// of the route table, the nearest route and why it did not match, and
+	// counts the reasons in route_miss_reasons_total.
+	MissDiagnostics bool
+
+	// ScrubHeaders are the scrub patterns (see routes.ScrubsHeader) of the
+	// client request headers removed from every request before it is
+	// forwarded, on top of the scrubHeaders of the matched route.
+	ScrubHeaders []string
+
+	// ReentryGuard marks every request the processor lets through with the
+	// x-customrouter-processed header and lets a request carrying a valid
+	// marker through without rewriting it again when the filter runs on it
+	// again (see Processor.SetReentryGuard).
+	ReentryGuard bool
+
+	// ReentryKey signs the ReentryGuard markers. The replicas of a target
+	// must share it to recognize each other's markers; nil uses a random
+	// key per process.
+	ReentryKey []byte
+
+	// RetainRouteCache stops the processor from asking Envoy to clear its
+	// route cache after setting the routing headers (see
+	// Processor.SetClearRouteCache).
+	RetainRouteCache bool
+
+	// DebugTraceHosts lists the hostnames ("*" for all) whose requests may
+	// ask for a decision trace by setting DebugHeader to "true": the
+	// candidate routes inspected, why each was skipped and the route and
+	// actions applied are then logged for that request. Empty disables it.
+	DebugTraceHosts []string
+
+	// DebugTraceToken, when non-empty, must also be sent in the
+	// x-customrouter-debug-token header for a request to be traced.
+	DebugTraceToken string
+
+	// UnmatchedRequestPolicy is the default for requests no route matches:
+	// "passthrough" lets them continue to the Envoy route they would have
+	// taken, "404" and "503" answer them with that status. Hostnames and
+	// attachments may override it.
+	UnmatchedRequestPolicy string
+
+	// PathNormalization is the default normalization of request paths
+	// before matching them. Attachments may override it.
+	PathNormalization routes.PathNormalization
+
+	// ClusterNaming is the default naming of the cluster a request is
+	// routed to (x-customrouter-cluster). Attachments may override it.
+	ClusterNaming routes.ClusterNaming
+
+	// VariantSelector is the default selector of the route table variant
+	// of a request. Attachments may override it.
+	VariantSelector routes.VariantSelector
+
+	// RedirectAltSvc is the Alt-Svc header sent with redirect responses
+	// whose action sets none, e.g. `h3=":443"; ma=86400` so HTTP/3 clients
+	// are not downgraded by following them. Empty sends none.
+	RedirectAltSvc string
+
+	// Overload sets when the processor is overloaded and how it degrades
+	// routing then. The zero value never degrades.
+	Overload OverloadPolicy
+
+	// Analytics exports the routing decision of every request to an
+	// analytics store, independently of the access log. The zero value
+	// exports nothing.
+	Analytics AnalyticsConfig
 }
 
 // DefaultServerConfig returns a ServerConfig with production-ready defaults
 func DefaultServerConfig() *ServerConfig {
 	return &ServerConfig{
-		Addr:                  ":9001",
-		TargetName:            "",
-		MaxRecvMsgSize:        4 * 1024 * 1024,  // 4MB
-		MaxSendMsgSize:        4 * 1024 * 1024,  // 4MB
-		MaxConcurrentStreams:  1000,             // High concurrency for ext_proc
-		KeepaliveTime:         30 * time.Second, // Ping every 30s if idle
-		KeepaliveTimeout:      10 * time.Second, // Wait 10s for ping response
-		MaxConnectionIdle:     5 * time.Minute,  // Close idle connections after 5m
-		MaxConnectionAge:      30 * time.Minute, // Force reconnect after 30m for load balancing
-		MaxConnectionAgeGrace: 10 * time.Second, // Grace period for in-flight requests
-		AccessLogEnabled:      true,
-		MetricsAddr:           ":9090",
-		RoutesReloadDebounce:  2 * time.Second,
+		Addr:                   ":9001",
+		TargetName:             "",
+		MaxRecvMsgSize:         4 * 1024 * 1024,  // 4MB
+		MaxSendMsgSize:         4 * 1024 * 1024,  // 4MB
+		MaxConcurrentStreams:   1000,             // High concurrency for ext_proc
+		KeepaliveTime:          30 * time.Second, // Ping every 30s if idle
+		KeepaliveTimeout:       10 * time.Second, // Wait 10s for ping response
+		MaxConnectionIdle:      5 * time.Minute,  // Close idle connections after 5m
+		MaxConnectionAge:       30 * time.Minute, // Force reconnect after 30m for load balancing
+		MaxConnectionAgeGrace:  10 * time.Second, // Grace period for in-flight requests
+		AccessLogEnabled:       true,
+		AccessLogSampleRate:    1,
+		MetricsAddr:            ":9090",
+		HealthAddr:             ":8081",
+		RoutesHistorySize:      DefaultRoutesHistorySize,
+		RoutesReloadDebounce:   2 * time.Second,
+		DecisionHeaders:        routes.DecisionHeadersOnDebug,
+		DebugHeader:            DefaultDebugHeader,
+		UnmatchedRequestPolicy: routes.UnmatchedPassthrough,
+		Overload:               OverloadPolicy{Action: OverloadActionShedRegex},
+		Analytics: AnalyticsConfig{
+			BatchSize:     DefaultAnalyticsBatchSize,
+			FlushInterval: DefaultAnalyticsFlushInterval,
+			BufferSize:    DefaultAnalyticsBufferSize,
+		},
 	}
 }
@@ -0,0 +1,88 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// ConfigHashHeader carries the hash of the route table that routed a debug
+// request (see routes.RoutesConfig.Hash), so requests answered by replicas
+// serving different routes can be told apart.
+const ConfigHashHeader = "x-customrouter-config-hash"
+
+// SetConfigHashHeader enables ConfigHashHeader on requests that carry the
+// debug header (see SetDecisionHeaders).
+func (p *Processor) SetConfigHashHeader(enabled bool) {
+	p.configHashHeader = enabled
+}
+
+// SetConfigHash records the hash of the route table being served. It is
+// called on every route table swap, concurrently with requests.
+func (p *Processor) SetConfigHash(hash string) {
+	p.configHash.Store(hash)
+}
+
+// currentConfigHash returns the hash recorded by SetConfigHash, or "" before
+// any was.
+func (p *Processor) currentConfigHash() string {
+	hash, _ := p.configHash.Load().(string)
+	return hash
+}
+
+// addConfigHashHeader adds ConfigHashHeader to the response to the request
+// headers of reqCtx when it asked for it: to the forwarded request, or to
+// the response Envoy sends back when the request is answered right away
+// (redirects, unmatched and denied requests). A value a client sent itself
+// is removed from other requests (see sanitizeRequestHeaders).
+func (p *Processor) addConfigHashHeader(resp *extprocv3.ProcessingResponse, reqCtx *requestContext) {
+	if !p.configHashHeader || resp == nil || reqCtx == nil {
+		return
+	}
+	header := &corev3.HeaderValueOption{
+		Header: &corev3.HeaderValue{
+			Key:      ConfigHashHeader,
+			RawValue: []byte(reqCtx.configHash),
+		},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+
+	switch r := resp.Response.(type) {
+	case *extprocv3.ProcessingResponse_ImmediateResponse:
+		if !reqCtx.emitConfigHash {
+			return
+		}
+		if r.ImmediateResponse.Headers == nil {
+			r.ImmediateResponse.Headers = &extprocv3.HeaderMutation{}
+		}
+		r.ImmediateResponse.Headers.SetHeaders = append(r.ImmediateResponse.Headers.SetHeaders, header)
+	case *extprocv3.ProcessingResponse_RequestHeaders:
+		if r.RequestHeaders.Response == nil {
+			r.RequestHeaders.Response = &extprocv3.CommonResponse{}
+		}
+		common := r.RequestHeaders.Response
+		if common.HeaderMutation == nil {
+			common.HeaderMutation = &extprocv3.HeaderMutation{}
+		}
+		if reqCtx.emitConfigHash {
+			common.HeaderMutation.SetHeaders = append(common.HeaderMutation.SetHeaders, header)
+		} else {
+			common.HeaderMutation.RemoveHeaders = append(common.HeaderMutation.RemoveHeaders, ConfigHashHeader)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package extproc
+
+import (
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestProcessRequest_ConfigHashHeader(t *testing.T) {
+	matched := &routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080"}
+
+	tests := []struct {
+		name        string
+		enabled     bool
+		route       *routes.Route
+		unmatched   string
+		debug       bool
+		wantSet     bool
+		wantRemoved bool
+	}{
+		{name: "disabled", route: matched, debug: true, wantRemoved: true},
+		{name: "enabled without debug header", enabled: true, route: matched, wantRemoved: true},
+		{name: "enabled with debug header", enabled: true, route: matched, debug: true, wantSet: true},
+		{name: "passthrough unmatched request", enabled: true, debug: true, wantSet: true},
+		{name: "immediate response", enabled: true, unmatched: routes.UnmatchedNotFound, debug: true, wantSet: true},
+		{name: "immediate response without debug header", enabled: true, unmatched: routes.UnmatchedNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(staticRouteFinder{route: tt.route}, zap.NewNop(), false)
+			p.SetUnmatchedPolicy(tt.unmatched)
+			p.SetConfigHashHeader(tt.enabled)
+			p.SetConfigHash("0123456789abcdef")
+
+			headers := []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: "/api/items"},
+				{Key: ":method", Value: "GET"},
+				{Key: ConfigHashHeader, Value: "spoofed"},
+			}
+			if tt.debug {
+				headers = append(headers, &corev3.HeaderValue{Key: "x-customrouter-debug", Value: "1"})
+			}
+			resp, reqCtx, err := p.processRequest(&extprocv3.ProcessingRequest{
+				Request: &extprocv3.ProcessingRequest_RequestHeaders{
+					RequestHeaders: &extprocv3.HttpHeaders{Headers: &corev3.HeaderMap{Headers: headers}},
+				},
+			}, &streamContext{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reqCtx.configHash != "0123456789abcdef" {
+				t.Errorf("configHash = %q, want it for the access log", reqCtx.configHash)
+			}
+
+			mutation := resp.GetRequestHeaders().GetResponse().GetHeaderMutation()
+			if immediate := resp.GetImmediateResponse(); immediate != nil {
+				mutation = immediate.GetHeaders()
+			}
+			var set string
+			for _, h := range mutation.GetSetHeaders() {
+				if h.GetHeader().GetKey() == ConfigHashHeader {
+					set = string(h.GetHeader().GetRawValue())
+				}
+			}
+			removed := false
+			for _, h := range mutation.GetRemoveHeaders() {
+				removed = removed || h == ConfigHashHeader
+			}
+
+			if (set != "") != tt.wantSet || (tt.wantSet && set != "0123456789abcdef") {
+				t.Errorf("%s set to %q, want set = %v", ConfigHashHeader, set, tt.wantSet)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("%s removed = %v, want %v", ConfigHashHeader, removed, tt.wantRemoved)
+			}
+		})
+	}
+}
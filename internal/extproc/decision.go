@@ -0,0 +1,140 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// DefaultDebugHeader is the request header that enables decision headers
+// when the effective mode is on-debug.
+const DefaultDebugHeader = "x-customrouter-debug"
+
+// decisionHeaderNames are the request headers describing the routing
+// decision. They are stripped from the request when emission is disabled so
+// a client cannot inject values that upstreams would trust.
+var decisionHeaderNames = []string{
+	"x-original-authority",
+	"x-customrouter-matched-path",
+	"x-customrouter-matched-type",
+}
+
+// SetDecisionHeaders configures when the routing decision headers are added
+// to forwarded requests. mode is the default used when neither the route nor
+// the attachment sets one; debugHeader and debugValue select the requests
+// that get the headers in on-debug mode (an empty debugValue accepts any
+// value).
+func (p *Processor) SetDecisionHeaders(mode, debugHeader, debugValue string) {
+	if debugHeader == "" {
+		debugHeader = DefaultDebugHeader
+	}
+	p.decisionHeaders = mode
+	p.debugHeader = strings.ToLower(debugHeader)
+	p.debugHeaderValue = debugValue
+}
+
+// streamDecisionHeaders returns the decisionHeaders mode an
+// ExternalProcessorAttachment passed as gRPC initial metadata, or "" when
+// none (or an unknown one) was set.
+func streamDecisionHeaders(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(routes.DecisionHeadersMetadataKey)
+	if len(values) == 0 || !routes.ValidDecisionHeadersMode(values[0]) {
+		return ""
+	}
+	return values[0]
+}
+
+// emitDecisionHeaders reports whether the decision headers are added for a
+// request matching route. The route setting wins over the attachment
+// setting, which wins over the processor default; no setting at all keeps
+// the historical always-on behavior.
+func (p *Processor) emitDecisionHeaders(route *routes.Route, streamCtx *streamContext, requestHeaders map[string]string) bool {
+	mode := route.DecisionHeaders
+	if mode == "" {
+		mode = streamCtx.decisionHeaders
+	}
+	if mode == "" {
+		mode = p.decisionHeaders
+	}
+
+	switch mode {
+	case routes.DecisionHeadersNever:
+		return false
+	case routes.DecisionHeadersOnDebug:
+		return p.debugRequested(requestHeaders)
+	default:
+		return true
+	}
+}
+
+// debugRequested reports whether the request carries the debug header, with
+// the configured value when one is set.
+func (p *Processor) debugRequested(requestHeaders map[string]string) bool {
+	value, ok := requestHeaders[p.debugHeaderName()]
+	if !ok {
+		return false
+	}
+	return p.debugHeaderValue == "" || value == p.debugHeaderValue
+}
+
+// debugHeaderName returns the lowercased debug header, defaulting when the
+// processor was built without SetDecisionHeaders.
+func (p *Processor) debugHeaderName() string {
+	if p.debugHeader == "" {
+		return DefaultDebugHeader
+	}
+	return p.debugHeader
+}
+
+// routingMetadata returns the routing decision for a request forwarded to
+// clusterName by route, as Envoy dynamic metadata under
+// routes.RoutingMetadataNamespace. It is emitted whatever the decision
+// headers mode: metadata never reaches the upstream.
+func routingMetadata(clusterName string, route *routes.Route) *structpb.Struct {
+	decision := map[string]*structpb.Value{
+		routes.RoutingMetadataCluster:     structpb.NewStringValue(clusterName),
+		routes.RoutingMetadataMatchedPath: structpb.NewStringValue(route.Path),
+		routes.RoutingMetadataMatchedType: structpb.NewStringValue(route.Type),
+	}
+	if route.ID != "" {
+		decision[routes.RoutingMetadataRouteID] = structpb.NewStringValue(route.ID)
+	}
+	if route.Source != "" {
+		decision[routes.RoutingMetadataRouteSource] = structpb.NewStringValue(route.Source)
+	}
+	if route.SourceRule != "" {
+		decision[routes.RoutingMetadataRouteRule] = structpb.NewStringValue(route.SourceRule)
+	}
+	if route.Owner != "" {
+		decision[routes.RoutingMetadataRouteOwner] = structpb.NewStringValue(route.Owner)
+	}
+	return &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			routes.RoutingMetadataNamespace: structpb.NewStructValue(&structpb.Struct{Fields: decision}),
+		},
+	}
+}
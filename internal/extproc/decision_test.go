@@ -0,0 +1,173 @@
+package extproc
+
+import (
+	"context"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestProcessRequestHeaders_DecisionHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultMode string
+		debugValue  string
+		streamMode  string
+		routeMode   string
+		debug       string
+		want        bool
+	}{
+		{name: "unset processor keeps always", want: true},
+		{name: "never default", defaultMode: routes.DecisionHeadersNever, want: false},
+		{name: "on-debug without header", defaultMode: routes.DecisionHeadersOnDebug, want: false},
+		{name: "on-debug with header", defaultMode: routes.DecisionHeadersOnDebug, debug: "1", want: true},
+		{name: "on-debug with wrong secret", defaultMode: routes.DecisionHeadersOnDebug, debugValue: "s3cret", debug: "1", want: false},
+		{name: "on-debug with secret", defaultMode: routes.DecisionHeadersOnDebug, debugValue: "s3cret", debug: "s3cret", want: true},
+		{name: "attachment overrides default", defaultMode: routes.DecisionHeadersAlways, streamMode: routes.DecisionHeadersNever, want: false},
+		{name: "route overrides attachment", streamMode: routes.DecisionHeadersNever, routeMode: routes.DecisionHeadersAlways, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &routes.Route{
+				Path:            "/api",
+				Type:            routes.RouteTypePrefix,
+				Backend:         "api.default.svc.cluster.local:8080",
+				DecisionHeaders: tt.routeMode,
+			}
+			p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+			if tt.defaultMode != "" {
+				p.SetDecisionHeaders(tt.defaultMode, "", tt.debugValue)
+			}
+
+			headers := []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: "/api/items"},
+				{Key: ":method", Value: "GET"},
+			}
+			if tt.debug != "" {
+				headers = append(headers, &corev3.HeaderValue{Key: "X-Customrouter-Debug", Value: tt.debug})
+			}
+			resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+				Headers: &corev3.HeaderMap{Headers: headers},
+			}, &streamContext{decisionHeaders: tt.streamMode})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			mutation := resp.GetRequestHeaders().GetResponse().GetHeaderMutation()
+			set := map[string]bool{}
+			for _, h := range mutation.GetSetHeaders() {
+				set[h.GetHeader().GetKey()] = true
+			}
+			removed := map[string]bool{}
+			for _, h := range mutation.GetRemoveHeaders() {
+				removed[h] = true
+			}
+
+			if !set["x-customrouter-cluster"] {
+				t.Error("x-customrouter-cluster must always be set")
+			}
+			for _, name := range decisionHeaderNames {
+				if set[name] != tt.want {
+					t.Errorf("%s set = %v, want %v", name, set[name], tt.want)
+				}
+				if removed[name] == tt.want {
+					t.Errorf("%s removed = %v, want %v", name, removed[name], !tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamDecisionHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"no metadata", context.Background(), ""},
+		{"valid mode", metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(routes.DecisionHeadersMetadataKey, routes.DecisionHeadersOnDebug)), routes.DecisionHeadersOnDebug},
+		{"unknown mode ignored", metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(routes.DecisionHeadersMetadataKey, "sometimes")), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamDecisionHeaders(tt.ctx); got != tt.want {
+				t.Errorf("streamDecisionHeaders() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessRequestHeaders_RoutingMetadata(t *testing.T) {
+	route := &routes.Route{
+		ID:         "default/api#0",
+		Source:     "default/api",
+		SourceRule: "rules[0]",
+		Owner:      "team-api",
+		Path:       "/api",
+		Type:       routes.RouteTypePrefix,
+		Backend:    "api.default.svc.cluster.local:8080",
+	}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+	// Metadata is emitted even when the decision headers are not.
+	p.SetDecisionHeaders(routes.DecisionHeadersNever, "", "")
+
+	resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":authority", Value: "example.com"},
+			{Key: ":path", Value: "/api/items"},
+			{Key: ":method", Value: "GET"},
+		}},
+	}, &streamContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decision := resp.GetDynamicMetadata().GetFields()[routes.RoutingMetadataNamespace].GetStructValue().GetFields()
+	want := map[string]string{
+		routes.RoutingMetadataCluster:     "outbound|8080||api.default.svc.cluster.local",
+		routes.RoutingMetadataMatchedPath: "/api",
+		routes.RoutingMetadataMatchedType: routes.RouteTypePrefix,
+		routes.RoutingMetadataRouteID:     "default/api#0",
+		routes.RoutingMetadataRouteSource: "default/api",
+		routes.RoutingMetadataRouteRule:   "rules[0]",
+		routes.RoutingMetadataRouteOwner:  "team-api",
+	}
+	for key, value := range want {
+		if got := decision[key].GetStringValue(); got != value {
+			t.Errorf("metadata %s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestProcessRequestHeaders_NoRoutingMetadataOnMiss(t *testing.T) {
+	p := NewProcessor(staticRouteFinder{}, zap.NewNop(), false)
+
+	resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":authority", Value: "example.com"},
+			{Key: ":path", Value: "/missing"},
+		}},
+	}, &streamContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.GetDynamicMetadata() != nil {
+		t.Errorf("unmatched request must carry no routing metadata, got %v", resp.GetDynamicMetadata())
+	}
+}
+
+func TestDefaultServerConfigDecisionHeaders(t *testing.T) {
+	if got := DefaultServerConfig().DecisionHeaders; got != routes.DecisionHeadersOnDebug {
+		t.Errorf("default decision headers mode = %q, want %q", got, routes.DecisionHeadersOnDebug)
+	}
+}
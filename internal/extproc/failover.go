@@ -0,0 +1,239 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// endpointsHealth counts the ready endpoints of every Service from its
+// EndpointSlices, for the Endpoints signal of fallback chains.
+type endpointsHealth struct {
+	client kubernetes.Interface
+	logger *zap.Logger
+
+	mu sync.RWMutex
+	// slices are the Service ("namespace/name") and ready endpoints of each
+	// EndpointSlice, keyed by "namespace/name" of the slice.
+	slices map[string]sliceEndpoints
+	// ready is the sum of the ready endpoints of the slices of each Service.
+	ready map[string]int
+
+	// synced is set once the first list of EndpointSlices is counted.
+	synced atomic.Bool
+}
+
+// sliceEndpoints are the ready endpoints of an EndpointSlice of a Service.
+type sliceEndpoints struct {
+	service string
+	ready   int
+}
+
+func newEndpointsHealth(client kubernetes.Interface, logger *zap.Logger) *endpointsHealth {
+	return &endpointsHealth{
+		client: client,
+		logger: logger,
+		slices: make(map[string]sliceEndpoints),
+		ready:  make(map[string]int),
+	}
+}
+
+// start watches the EndpointSlices of every namespace until ctx is done.
+func (h *endpointsHealth) start(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactory(h.client, 0)
+	informer := factory.Discovery().V1().EndpointSlices().Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { h.update(obj) },
+		UpdateFunc: func(_, obj any) { h.update(obj) },
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+				h.set(slice.Namespace+"/"+slice.Name, sliceEndpoints{})
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to watch EndpointSlices: %w", err)
+	}
+	if err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		h.logger.Warn("watching EndpointSlices failed, keeping the last backend health", zap.Error(err))
+	}); err != nil {
+		return fmt.Errorf("failed to watch EndpointSlices: %w", err)
+	}
+	factory.Start(ctx.Done())
+	go func() {
+		if cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			h.synced.Store(true)
+		}
+	}()
+	return nil
+}
+
+// update counts the ready endpoints of the EndpointSlice obj. Endpoints
+// without a ready condition are ready, as for kube-proxy.
+func (h *endpointsHealth) update(obj any) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	var counted sliceEndpoints
+	if service := slice.Labels[discoveryv1.LabelServiceName]; service != "" {
+		counted.service = slice.Namespace + "/" + service
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready == nil || *ep.Conditions.Ready {
+				counted.ready++
+			}
+		}
+	}
+	h.set(slice.Namespace+"/"+slice.Name, counted)
+}
+
+// set replaces the counted endpoints of the slice key; a zero counted
+// forgets the slice.
+func (h *endpointsHealth) set(key string, counted sliceEndpoints) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if prev, ok := h.slices[key]; ok {
+		if h.ready[prev.service] -= prev.ready; h.ready[prev.service] == 0 {
+			delete(h.ready, prev.service)
+		}
+		delete(h.slices, key)
+	}
+	if counted.service == "" {
+		return
+	}
+	h.slices[key] = counted
+	h.ready[counted.service] += counted.ready
+}
+
+// healthy reports whether backend, a "host:port" of the route table, has
+// ready endpoints. Backends that are not Services of the cluster are
+// healthy, and so is every backend until the EndpointSlices are synced.
+func (h *endpointsHealth) healthy(backend string) bool {
+	service, ok := backendService(backend)
+	if !ok || !h.synced.Load() {
+		return true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.ready[service] > 0
+}
+
+// backendService returns the "namespace/name" of the Service of a
+// "name.namespace.svc.cluster.local:port" backend.
+func backendService(backend string) (string, bool) {
+	host, _, err := net.SplitHostPort(backend)
+	if err != nil {
+		return "", false
+	}
+	host, ok := strings.CutSuffix(host, ".svc.cluster.local")
+	if !ok {
+		return "", false
+	}
+	name, namespace, ok := strings.Cut(host, ".")
+	if !ok || name == "" || namespace == "" || strings.Contains(namespace, ".") {
+		return "", false
+	}
+	return namespace + "/" + name, true
+}
+
+// SetEndpointsHealth sets the EndpointSlice watcher of the Endpoints signal
+// of fallback chains. Without one every backend is healthy by Endpoints. It
+// must be called before the processor serves requests.
+func (p *Processor) SetEndpointsHealth(h *endpointsHealth) {
+	p.endpoints = h
+}
+
+// applyBackendFailover sends a route with a fallback chain to the first
+// backend of the chain that is healthy, or to its own backend while none
+// is. The route is copied when it is failed over, so the shared route table
+// is never mutated. It reports whether the response of the request must be
+// tracked, which the Responses signal needs.
+func (p *Processor) applyBackendFailover(route *routes.Route, logger *zap.Logger) (*routes.Route, bool) {
+	chain := route.Failover
+	if chain == nil {
+		return route, false
+	}
+	track := chain.Signal == routes.FailoverSignalResponses
+	for _, backend := range chain.Backends {
+		if !p.backendHealthy(chain, backend) {
+			continue
+		}
+		if backend == route.Backend {
+			return route, track
+		}
+		logger.Debug("backend unhealthy, failing over along the chain",
+			zap.String("backend", route.Backend),
+			zap.String("fallback", backend),
+			zap.String("signal", chain.Signal),
+		)
+		backendFailoversTotal.WithLabelValues(chain.Signal).Inc()
+		failedOver := *route
+		failedOver.Backend = backend
+		return &failedOver, track
+	}
+	return route, track
+}
+
+// backendHealthy reports whether backend of chain is healthy by its signal.
+func (p *Processor) backendHealthy(chain *routes.RouteFailover, backend string) bool {
+	if chain.Signal == routes.FailoverSignalResponses {
+		return !p.outliers.ejected(backend)
+	}
+	return p.endpoints == nil || p.endpoints.healthy(backend)
+}
+
+// failoverOutlier is the outlier policy the responses of a backend of a
+// chain with the Responses signal are tracked with.
+func failoverOutlier(chain *routes.RouteFailover) *routes.RouteOutlier {
+	return &routes.RouteOutlier{
+		ErrorRatePercent: chain.ErrorRatePercent,
+		MinRequests:      chain.MinRequests,
+		IntervalMs:       chain.IntervalMs,
+		EjectionMs:       chain.EjectionMs,
+	}
+}
+
+// usesEndpointsSignal reports whether a route of config has a fallback
+// chain with the Endpoints signal.
+func usesEndpointsSignal(config *routes.RoutesConfig) bool {
+	if config == nil {
+		return false
+	}
+	for _, hostRoutes := range config.Hosts {
+		for i := range hostRoutes {
+			if f := hostRoutes[i].Failover; f != nil && f.Signal == routes.FailoverSignalEndpoints {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package extproc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestBackendService(t *testing.T) {
+	tests := []struct {
+		backend string
+		want    string
+		ok      bool
+	}{
+		{"api.default.svc.cluster.local:8080", "default/api", true},
+		{"api.example.com:443", "", false},
+		{"api.default.svc.cluster.local", "", false},
+		{"api.default.other.svc.cluster.local:80", "", false},
+		{"10.0.0.1:80", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := backendService(tt.backend)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("backendService(%q) = %q, %v, want %q, %v", tt.backend, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func boolPtr(v bool) *bool { return &v }
+
+// endpointSlice returns an EndpointSlice of service with an endpoint per
+// ready condition.
+func endpointSlice(namespace, name, service string, ready ...*bool) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+	for _, r := range ready {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{"10.0.0.1"},
+			Conditions: discoveryv1.EndpointConditions{Ready: r},
+		})
+	}
+	return slice
+}
+
+func TestEndpointsHealth(t *testing.T) {
+	const (
+		api      = "api.default.svc.cluster.local:8080"
+		fallback = "fallback.default.svc.cluster.local:8080"
+		missing  = "missing.default.svc.cluster.local:8080"
+		external = "api.example.com:443"
+	)
+	cs := fake.NewSimpleClientset(
+		endpointSlice("default", "api-a", "api", boolPtr(false)),
+		endpointSlice("default", "api-b", "api", nil),
+		endpointSlice("default", "fallback-a", "fallback", boolPtr(false), boolPtr(false)),
+	)
+	h := newEndpointsHealth(cs, zap.NewNop())
+	if !h.healthy(missing) {
+		t.Fatal("backends must be healthy until the EndpointSlices are synced")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := h.start(ctx); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("the EndpointSlices to sync", h.synced.Load)
+
+	if !h.healthy(api) {
+		t.Error("api has an endpoint without a ready condition, it must be healthy")
+	}
+	if h.healthy(fallback) {
+		t.Error("fallback has no ready endpoint, it must be unhealthy")
+	}
+	if h.healthy(missing) {
+		t.Error("a Service without EndpointSlices must be unhealthy")
+	}
+	if !h.healthy(external) {
+		t.Error("backends outside the cluster must be healthy")
+	}
+
+	slices := cs.DiscoveryV1().EndpointSlices("default")
+	if err := slices.Delete(ctx, "api-b", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete EndpointSlice: %v", err)
+	}
+	if _, err := slices.Update(ctx, endpointSlice("default", "fallback-a", "fallback", boolPtr(false), boolPtr(true)), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update EndpointSlice: %v", err)
+	}
+	waitFor("the changes to be counted", func() bool {
+		return !h.healthy(api) && h.healthy(fallback)
+	})
+}
+
+func TestProcessRequestHeaders_BackendFailover(t *testing.T) {
+	const (
+		primary   = "api.default.svc.cluster.local:8080"
+		secondary = "api.backup.svc.cluster.local:8080"
+		external  = "api.example.com:443"
+	)
+	route := &routes.Route{
+		Path:    "/api",
+		Type:    routes.RouteTypePrefix,
+		Backend: primary,
+		Failover: &routes.RouteFailover{
+			Backends: []string{primary, secondary, external},
+			Signal:   routes.FailoverSignalEndpoints,
+		},
+	}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+
+	request := func() (*extprocv3.ProcessingResponse, *streamContext) {
+		t.Helper()
+		streamCtx := &streamContext{}
+		resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: "/api/items"},
+				{Key: ":method", Value: "GET"},
+			}},
+		}, streamCtx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp, streamCtx
+	}
+
+	// Without an EndpointSlice watcher every backend is healthy.
+	resp, streamCtx := request()
+	if got := setHeaderValue(resp, "x-customrouter-cluster"); got != "outbound|8080||api.default.svc.cluster.local" {
+		t.Errorf("cluster = %q, want the primary backend", got)
+	}
+	if resp.GetModeOverride() != nil || streamCtx.trackOutlier {
+		t.Error("the Endpoints signal must not track responses")
+	}
+
+	h := newEndpointsHealth(fake.NewSimpleClientset(), zap.NewNop())
+	h.synced.Store(true)
+	p.SetEndpointsHealth(h)
+
+	// Neither Service has ready endpoints: the external backend is next.
+	resp, _ = request()
+	if got := setHeaderValue(resp, "x-customrouter-cluster"); got != "outbound|443||api.example.com" {
+		t.Errorf("cluster = %q, want the external backend", got)
+	}
+	h.update(endpointSlice("backup", "api-a", "api", boolPtr(true)))
+	resp, _ = request()
+	if got := setHeaderValue(resp, "x-customrouter-cluster"); got != "outbound|8080||api.backup.svc.cluster.local" {
+		t.Errorf("cluster = %q, want the secondary backend", got)
+	}
+	if route.Backend != primary {
+		t.Errorf("shared route was mutated: backend = %q", route.Backend)
+	}
+
+	// The Responses signal ejects backends by their 5xx responses.
+	route.Failover = &routes.RouteFailover{
+		Backends:         []string{primary, secondary},
+		Signal:           routes.FailoverSignalResponses,
+		ErrorRatePercent: 50,
+		MinRequests:      2,
+		IntervalMs:       10_000,
+		EjectionMs:       30_000,
+	}
+	for range 2 {
+		resp, streamCtx := request()
+		if got := setHeaderValue(resp, "x-customrouter-cluster"); got != "outbound|8080||api.default.svc.cluster.local" {
+			t.Fatalf("cluster = %q, want the primary backend", got)
+		}
+		if !streamCtx.trackOutlier {
+			t.Fatal("the Responses signal must track responses")
+		}
+		p.recordOutlierResponse(&extprocv3.HttpHeaders{
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: ":status", Value: "503"}}},
+		}, streamCtx)
+	}
+	resp, streamCtx = request()
+	if got := setHeaderValue(resp, "x-customrouter-cluster"); got != "outbound|8080||api.backup.svc.cluster.local" {
+		t.Errorf("cluster = %q, want the secondary backend while the primary is ejected", got)
+	}
+	if !streamCtx.trackOutlier || streamCtx.matchedRoute.Backend != secondary {
+		t.Error("the responses of the secondary backend must be tracked")
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// Version and Commit identify the build. They are meant to be set at link
+// time, e.g. -ldflags "-X github.com/freepik-company/customrouter/internal/extproc.Version=v1.2.3".
+// When unset, Commit falls back to the VCS revision embedded by the Go toolchain.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// VersionInfo is the body served on /version.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// BuildVersionInfo returns the version of the running binary.
+func BuildVersionInfo() VersionInfo {
+	info := VersionInfo{
+		Version:   Version,
+		Commit:    Commit,
+		GoVersion: runtime.Version(),
+	}
+	if info.Commit == "" {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range bi.Settings {
+				if setting.Key == "vcs.revision" {
+					info.Commit = setting.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+// loadStatusSource is the part of the route loader the health handler needs.
+type loadStatusSource interface {
+	Status() routes.LoadStatus
+}
+
+// healthResponse is the body served on /readyz.
+type healthResponse struct {
+	Status string            `json:"status"`
+	Routes routes.LoadStatus `json:"routes"`
+}
+
+// HealthHandler serves the plain HTTP probe endpoints:
+//
+//   - /healthz reports the process is up; it never depends on the API server.
+//   - /readyz returns 200 once a route table (from ConfigMaps or a snapshot)
+//     is being served and 503 before that, with the load status as JSON. The
+//     status is "degraded" while the last table loaded was rejected for
+//     exceeding the memory budget and the previous one is served.
+//   - /version returns the build version as JSON.
+func HealthHandler(loader loadStatusSource) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		status := loader.Status()
+		resp := healthResponse{Status: "ok", Routes: status}
+		code := http.StatusOK
+		switch {
+		case !status.Loaded():
+			resp.Status = "routes not loaded"
+			code = http.StatusServiceUnavailable
+		case status.OverBudget != nil:
+			resp.Status = "degraded"
+		}
+		writeJSON(w, code, resp)
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, BuildVersionInfo())
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+type staticStatus routes.LoadStatus
+
+func (s staticStatus) Status() routes.LoadStatus { return routes.LoadStatus(s) }
+
+func TestHealthHandler(t *testing.T) {
+	loaded := staticStatus{Source: routes.LoadSourceConfigMaps, Hosts: 2, Routes: 5}
+	snapshot := staticStatus{Source: routes.LoadSourceSnapshot, Hosts: 1, Routes: 1, LastError: "api server unavailable"}
+	overBudget := loaded
+	overBudget.OverBudget = &routes.TableBudgetError{Bytes: 2048, MaxBytes: 1024, Routes: 5}
+
+	tests := []struct {
+		name     string
+		status   staticStatus
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "healthz without routes", status: staticStatus{}, path: "/healthz", wantCode: http.StatusOK, wantBody: "ok"},
+		{name: "readyz before any load", status: staticStatus{}, path: "/readyz", wantCode: http.StatusServiceUnavailable, wantBody: "routes not loaded"},
+		{name: "readyz from configmaps", status: loaded, path: "/readyz", wantCode: http.StatusOK, wantBody: `"source":"configmaps"`},
+		{name: "readyz from snapshot", status: snapshot, path: "/readyz", wantCode: http.StatusOK, wantBody: `"lastError":"api server unavailable"`},
+		{name: "readyz over budget", status: overBudget, path: "/readyz", wantCode: http.StatusOK, wantBody: `"status":"degraded"`},
+		{name: "version", status: staticStatus{}, path: "/version", wantCode: http.StatusOK, wantBody: `"goVersion"`},
+		{name: "unknown path", status: loaded, path: "/metrics", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			HealthHandler(tt.status).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestBuildVersionInfo(t *testing.T) {
+	oldVersion, oldCommit := Version, Commit
+	Version, Commit = "v1.2.3", "abc123"
+	defer func() { Version, Commit = oldVersion, oldCommit }()
+
+	rec := httptest.NewRecorder()
+	HealthHandler(staticStatus{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var info VersionInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode /version: %v", err)
+	}
+	if info.Version != "v1.2.3" || info.Commit != "abc123" {
+		t.Errorf("version info = %+v", info)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// DefaultRoutesHistorySize is how many route table generations are kept for
+// the /debug/routes endpoints by default: none, since they export the whole
+// decrypted route table on the health listener.
+const DefaultRoutesHistorySize = 0
+
+// maxImportedRoutesSize caps the routes document accepted by
+// POST /debug/routes/diff when no route table budget is set.
+const maxImportedRoutesSize = 64 << 20 // 64 MiB
+
+// RouteGeneration is a route table the extproc served.
+type RouteGeneration struct {
+	// Generation numbers the route tables served since the process started,
+	// from 1.
+	Generation int64 `json:"generation"`
+
+	// LoadedAt is when the route table was swapped in and Source where it
+	// came from (see routes.LoadStatus).
+	LoadedAt time.Time `json:"loadedAt"`
+	Source   string    `json:"source"`
+
+	Hosts  int `json:"hosts"`
+	Routes int `json:"routes"`
+
+	config *routes.RoutesConfig
+}
+
+// RouteHistory keeps the last route tables the extproc served, so the
+// route update that coincided with an incident can be found afterwards.
+// Route tables are immutable once served and unchanged hosts share their
+// route slices between generations, so an old generation mostly costs the
+// hosts that changed since.
+type RouteHistory struct {
+	mu          sync.Mutex
+	generations []RouteGeneration // oldest first
+	size        int
+	next        int64
+}
+
+// NewRouteHistory returns a history keeping the last size route tables.
+func NewRouteHistory(size int) *RouteHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &RouteHistory{size: size, next: 1}
+}
+
+// Record adds config, loaded with status, as the newest generation. A config
+// that is already the newest one is not recorded again.
+func (h *RouteHistory) Record(config *routes.RoutesConfig, status routes.LoadStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if n := len(h.generations); n > 0 && h.generations[n-1].config == config {
+		return
+	}
+	h.generations = append(h.generations, RouteGeneration{
+		Generation: h.next,
+		LoadedAt:   status.LastLoad,
+		Source:     status.Source,
+		Hosts:      len(config.Hosts),
+		Routes:     config.RouteCount(),
+		config:     config,
+	})
+	h.next++
+	if len(h.generations) > h.size {
+		// Copy rather than reslice so dropped configs can be collected.
+		h.generations = append([]RouteGeneration(nil), h.generations[len(h.generations)-h.size:]...)
+	}
+}
+
+// Generations returns the recorded generations, oldest first.
+func (h *RouteHistory) Generations() []RouteGeneration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]RouteGeneration(nil), h.generations...)
+}
+
+// Current returns the newest generation, or false before any was recorded.
+func (h *RouteHistory) Current() (RouteGeneration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.generations) == 0 {
+		return RouteGeneration{}, false
+	}
+	return h.generations[len(h.generations)-1], true
+}
+
+// Get returns the given generation, or false when it is not, or no longer,
+// kept.
+func (h *RouteHistory) Get(generation int64) (RouteGeneration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, g := range h.generations {
+		if g.Generation == generation {
+			return g, true
+		}
+	}
+	return RouteGeneration{}, false
+}
+
+// routesExport is the body served on /debug/routes.
+type routesExport struct {
+	RouteGeneration
+	Config *routes.RoutesConfig `json:"config"`
+}
+
+// routesDiffResponse is the body served on /debug/routes/diff.
+type routesDiffResponse struct {
+	// From is the compared generation, or nil for an imported routes
+	// document.
+	From *RouteGeneration `json:"from,omitempty"`
+	To   RouteGeneration  `json:"to"`
+	routes.RoutesDiff
+}
+
+// RoutesDebugHandler serves the route tables kept in history:
+//
+//   - /debug/routes exports the current route table as JSON, or generation N
+//     with ?generation=N.
+//   - /debug/routes/generations lists the kept generations.
+//   - /debug/routes/diff?generation=N returns what changed from generation N
+//     to the current route table. A POST instead compares a routes document
+//     in the request body (in any format the ConfigMaps use, e.g. an earlier
+//     /debug/routes export's config or another replica's) to it.
+//
+// With a non-empty token, every request must carry it as an
+// "Authorization: Bearer" header. maxImportBytes caps the POST body; zero or
+// less uses maxImportedRoutesSize.
+func RoutesDebugHandler(history *RouteHistory, token string, maxImportBytes int) http.Handler {
+	if maxImportBytes <= 0 {
+		maxImportBytes = maxImportedRoutesSize
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/routes", func(w http.ResponseWriter, r *http.Request) {
+		g, ok := history.Current()
+		if raw := r.URL.Query().Get("generation"); raw != "" {
+			g, ok = lookupGeneration(w, history, raw)
+			if !ok {
+				return
+			}
+		} else if !ok {
+			writeJSONError(w, http.StatusServiceUnavailable, "routes not loaded")
+			return
+		}
+		writeJSON(w, http.StatusOK, routesExport{RouteGeneration: g, Config: g.config})
+	})
+	mux.HandleFunc("/debug/routes/generations", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, history.Generations())
+	})
+	mux.HandleFunc("/debug/routes/diff", func(w http.ResponseWriter, r *http.Request) {
+		current, ok := history.Current()
+		if !ok {
+			writeJSONError(w, http.StatusServiceUnavailable, "routes not loaded")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			raw := r.URL.Query().Get("generation")
+			if raw == "" {
+				writeJSONError(w, http.StatusBadRequest, "missing generation query parameter")
+				return
+			}
+			from, ok := lookupGeneration(w, history, raw)
+			if !ok {
+				return
+			}
+			writeJSON(w, http.StatusOK, routesDiffResponse{
+				From:       &from,
+				To:         current,
+				RoutesDiff: routes.DiffRoutesConfigs(from.config, current.config),
+			})
+		case http.MethodPost:
+			data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxImportBytes)))
+			if err != nil {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			imported, err := routes.DecodeRoutesConfig(data)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid routes document: %v", err))
+				return
+			}
+			writeJSON(w, http.StatusOK, routesDiffResponse{
+				To:         current,
+				RoutesDiff: routes.DiffRoutesConfigs(imported, current.config),
+			})
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+	if token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// lookupGeneration returns the generation named by raw, writing the error
+// response when it is invalid or no longer kept.
+func lookupGeneration(w http.ResponseWriter, history *RouteHistory, raw string) (RouteGeneration, bool) {
+	generation, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid generation %q", raw))
+		return RouteGeneration{}, false
+	}
+	g, ok := history.Get(generation)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound,
+			fmt.Sprintf("generation %d is not kept, see /debug/routes/generations", generation))
+		return RouteGeneration{}, false
+	}
+	return g, true
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
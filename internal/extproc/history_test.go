@@ -0,0 +1,157 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func historyConfig(backend string) *routes.RoutesConfig {
+	return &routes.RoutesConfig{
+		Version: 1,
+		Hosts: map[string][]routes.Route{
+			"www.example.com": {{Path: "/api", Type: routes.RouteTypePrefix, Backend: backend}},
+		},
+	}
+}
+
+func TestRouteHistoryRecord(t *testing.T) {
+	history := NewRouteHistory(2)
+	first := historyConfig("one:80")
+	history.Record(first, routes.LoadStatus{Source: routes.LoadSourceSnapshot})
+	history.Record(first, routes.LoadStatus{Source: routes.LoadSourceConfigMaps})
+	history.Record(historyConfig("two:80"), routes.LoadStatus{Source: routes.LoadSourceConfigMaps})
+	history.Record(historyConfig("three:80"), routes.LoadStatus{Source: routes.LoadSourceConfigMaps})
+
+	generations := history.Generations()
+	if len(generations) != 2 || generations[0].Generation != 2 || generations[1].Generation != 3 {
+		t.Fatalf("generations = %+v, want 2 and 3", generations)
+	}
+	if _, ok := history.Get(1); ok {
+		t.Error("generation 1 still kept beyond the history size")
+	}
+	if current, _ := history.Current(); current.Generation != 3 || current.Routes != 1 {
+		t.Errorf("current = %+v, want generation 3 with 1 route", current)
+	}
+}
+
+func TestRoutesDebugHandler(t *testing.T) {
+	history := NewRouteHistory(5)
+	history.Record(historyConfig("one:80"), routes.LoadStatus{Source: routes.LoadSourceConfigMaps})
+	history.Record(historyConfig("two:80"), routes.LoadStatus{Source: routes.LoadSourceConfigMaps})
+	imported, err := historyConfig("one:80").ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "export current", method: http.MethodGet, path: "/debug/routes", wantCode: http.StatusOK, wantBody: `"backend":"two:80"`},
+		{name: "export generation", method: http.MethodGet, path: "/debug/routes?generation=1", wantCode: http.StatusOK, wantBody: `"backend":"one:80"`},
+		{name: "generations", method: http.MethodGet, path: "/debug/routes/generations", wantCode: http.StatusOK, wantBody: `"generation":2`},
+		{name: "diff", method: http.MethodGet, path: "/debug/routes/diff?generation=1", wantCode: http.StatusOK, wantBody: `"status":"changed"`},
+		{name: "diff without generation", method: http.MethodGet, path: "/debug/routes/diff", wantCode: http.StatusBadRequest},
+		{name: "diff invalid generation", method: http.MethodGet, path: "/debug/routes/diff?generation=x", wantCode: http.StatusBadRequest},
+		{name: "diff unknown generation", method: http.MethodGet, path: "/debug/routes/diff?generation=7", wantCode: http.StatusNotFound, wantBody: "not kept"},
+		{name: "diff imported", method: http.MethodPost, path: "/debug/routes/diff", body: string(imported), wantCode: http.StatusOK, wantBody: `"removed":[{"path":"/api","type":"prefix","backend":"one:80"`},
+		{name: "diff invalid import", method: http.MethodPost, path: "/debug/routes/diff", body: "{", wantCode: http.StatusBadRequest},
+		{name: "diff method", method: http.MethodDelete, path: "/debug/routes/diff", wantCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			RoutesDebugHandler(history, "", 0).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	RoutesDebugHandler(history, "", 0).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/routes/diff?generation=2", nil))
+	var resp struct {
+		From  RouteGeneration   `json:"from"`
+		To    RouteGeneration   `json:"to"`
+		Hosts []routes.HostDiff `json:"hosts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode diff: %v", err)
+	}
+	if resp.From.Generation != 2 || resp.To.Generation != 2 || len(resp.Hosts) != 0 {
+		t.Errorf("diff of the current generation = %+v, want no changes", resp)
+	}
+}
+
+func TestRoutesDebugHandlerToken(t *testing.T) {
+	history := NewRouteHistory(1)
+	history.Record(historyConfig("one:80"), routes.LoadStatus{Source: routes.LoadSourceConfigMaps})
+	handler := RoutesDebugHandler(history, "s3cret", 0)
+
+	for _, auth := range []string{"", "Bearer wrong", "s3cret"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || strings.Contains(rec.Body.String(), "one:80") {
+			t.Errorf("Authorization %q: code = %d, want 401 without the routes", auth, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "one:80") {
+		t.Errorf("code = %d, body = %q, want the routes", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRoutesDebugHandlerImportLimit(t *testing.T) {
+	history := NewRouteHistory(1)
+	history.Record(historyConfig("one:80"), routes.LoadStatus{Source: routes.LoadSourceConfigMaps})
+	imported, err := historyConfig("one:80").ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/debug/routes/diff", strings.NewReader(string(imported)))
+	RoutesDebugHandler(history, "", len(imported)-1).ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("code = %d, want 413 for a document over the limit", rec.Code)
+	}
+}
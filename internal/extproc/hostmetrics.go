@@ -0,0 +1,66 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"strconv"
+
+	"github.com/freepik-company/customrouter/pkg/matcher"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// routeTable is implemented by route finders exposing the route table they
+// serve, such as routes.K8sLoader and routes.BucketLoader.
+type routeTable interface {
+	GetConfig() *routes.RoutesConfig
+}
+
+// SetHostMetrics enables host_requests_total, labeled with target, the
+// target name of the route table. Only hosts of the route table get their
+// own series; other authorities are counted under an empty host, which
+// keeps the series bounded whatever clients send. An empty target disables
+// the metric.
+func (p *Processor) SetHostMetrics(target string) {
+	p.hostMetricsTarget = target
+}
+
+// recordHostRequest counts the request of ctx in host_requests_total.
+func (p *Processor) recordHostRequest(ctx *requestContext) {
+	if p.hostMetricsTarget == "" {
+		return
+	}
+	hostRequestsTotal.WithLabelValues(p.hostMetricsTarget, p.metricHost(ctx.authority),
+		strconv.FormatBool(ctx.routeFound)).Inc()
+}
+
+// metricHost returns the host label of authority: the host without port
+// when the route table has routes for it, "" otherwise.
+func (p *Processor) metricHost(authority string) string {
+	table, ok := p.routeFinder.(routeTable)
+	if !ok {
+		return ""
+	}
+	config := table.GetConfig()
+	if config == nil {
+		return ""
+	}
+	host := matcher.StripPort(authority)
+	if _, ok := config.Hosts[host]; !ok {
+		return ""
+	}
+	return host
+}
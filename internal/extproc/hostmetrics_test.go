@@ -0,0 +1,71 @@
+package extproc
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// tableRouteFinder serves config, like the route loaders.
+type tableRouteFinder struct {
+	config *routes.RoutesConfig
+}
+
+func (f tableRouteFinder) FindRoute(host string, req routes.RequestMatch) *routes.Route {
+	return f.config.FindRoute(host, req)
+}
+
+func (f tableRouteFinder) GetConfig() *routes.RoutesConfig {
+	return f.config
+}
+
+func TestRecordHostRequest(t *testing.T) {
+	finder := tableRouteFinder{config: &routes.RoutesConfig{Hosts: map[string][]routes.Route{
+		"example.com": {{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080"}},
+	}}}
+
+	tests := []struct {
+		name      string
+		target    string
+		authority string
+		found     bool
+		wantHost  string
+	}{
+		{name: "host of the route table", target: "hosts-a", authority: "example.com", found: true,
+			wantHost: "example.com"},
+		{name: "port stripped", target: "hosts-b", authority: "example.com:8443", wantHost: "example.com"},
+		{name: "unknown host", target: "hosts-c", authority: "attacker.example", wantHost: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(finder, zap.NewNop(), false)
+			p.SetHostMetrics(tt.target)
+			found := "false"
+			if tt.found {
+				found = "true"
+			}
+			counter := hostRequestsTotal.WithLabelValues(tt.target, tt.wantHost, found)
+			before := testutil.ToFloat64(counter)
+
+			p.recordHostRequest(&requestContext{authority: tt.authority, routeFound: tt.found})
+
+			if got := testutil.ToFloat64(counter); got != before+1 {
+				t.Errorf("host_requests_total{host=%q} = %v, want %v", tt.wantHost, got, before+1)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		p := NewProcessor(finder, zap.NewNop(), false)
+		counter := hostRequestsTotal.WithLabelValues("", "example.com", "true")
+		before := testutil.ToFloat64(counter)
+		p.recordHostRequest(&requestContext{authority: "example.com", routeFound: true})
+		if got := testutil.ToFloat64(counter); got != before {
+			t.Errorf("host_requests_total = %v, want no request recorded", got)
+		}
+	})
+}
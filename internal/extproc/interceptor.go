@@ -0,0 +1,205 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamInterceptors returns the interceptors every gRPC stream of the
+// server goes through, outermost first: observeStreams counts the stream
+// and its messages and tags its logs, recoverStreams turns a panic of the
+// handler into an Internal error for that stream only.
+func streamInterceptors(logger *zap.Logger) []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		observeStreams(logger),
+		recoverStreams(logger),
+	}
+}
+
+// observeStreams records the per-stream metrics and gives the handler,
+// through the stream context, a logger that tags every line with the
+// x-request-id of the request once its headers are received (see
+// streamLogger).
+func observeStreams(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		method := info.FullMethod
+		streamsOpen.WithLabelValues(method).Inc()
+		defer streamsOpen.WithLabelValues(method).Dec()
+
+		stream := &observedStream{ServerStream: ss, method: method}
+		tagged := logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return &requestIDCore{Core: core, stream: stream}
+		}))
+		stream.ctx = context.WithValue(ss.Context(), streamLoggerKey{}, tagged)
+
+		err := handler(srv, stream)
+		streamsTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+		return err
+	}
+}
+
+// recoverStreams recovers a panic of the stream handler. Envoy then sees
+// the stream fail with Internal and applies the failure mode of the
+// attachment to that request, while every other stream keeps going.
+func recoverStreams(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				panicsRecoveredTotal.WithLabelValues(info.FullMethod).Inc()
+				streamLogger(ss.Context(), logger).Error("recovered panic while processing stream",
+					zap.String("method", info.FullMethod),
+					zap.Any("panic", r),
+					zap.Stack("stack"),
+				)
+				err = status.Errorf(codes.Internal, "panic while processing stream: %v", r)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// streamLoggerKey is the context key of the logger observeStreams gives
+// each stream.
+type streamLoggerKey struct{}
+
+// streamLogger returns the logger of the stream whose context is ctx, or
+// fallback when the stream did not go through observeStreams (e.g. in
+// tests).
+func streamLogger(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(streamLoggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// observedStream counts the messages of a stream and remembers the
+// x-request-id of the last request headers received on it.
+type observedStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	method    string
+	requestID atomic.Pointer[string]
+}
+
+func (s *observedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *observedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	streamMessagesTotal.WithLabelValues(s.method, "received").Inc()
+	if req, ok := m.(*extprocv3.ProcessingRequest); ok {
+		if id := requestID(req); id != "" {
+			s.requestID.Store(&id)
+		}
+	}
+	return nil
+}
+
+func (s *observedStream) SendMsg(m any) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	streamMessagesTotal.WithLabelValues(s.method, "sent").Inc()
+	return nil
+}
+
+// requestID returns the x-request-id header of req when it carries the
+// request headers, or "" otherwise.
+func requestID(req *extprocv3.ProcessingRequest) string {
+	for _, h := range req.GetRequestHeaders().GetHeaders().GetHeaders() {
+		if strings.EqualFold(h.Key, "x-request-id") {
+			if h.Value == "" {
+				return string(h.RawValue)
+			}
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// requestIDCore adds the request_id field to the lines of a stream once
+// its request headers have been received.
+type requestIDCore struct {
+	zapcore.Core
+	stream *observedStream
+}
+
+func (c *requestIDCore) With(fields []zapcore.Field) zapcore.Core {
+	return &requestIDCore{Core: c.Core.With(fields), stream: c.stream}
+}
+
+func (c *requestIDCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	// The wrapped core decides, so that its sampling and debug rate limit
+	// still apply, but the line is written through this core.
+	if c.Core.Check(ent, nil) == nil {
+		return ce
+	}
+	return ce.AddCore(ent, c)
+}
+
+func (c *requestIDCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if id := c.stream.requestID.Load(); id != nil {
+		fields = append(fields, zap.String("request_id", *id))
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// limitDebugLogs returns logger with its debug lines limited to perSecond,
+// or logger itself when perSecond is not positive. The lines over the
+// limit are dropped and counted in debug_logs_dropped_total; lines of
+// other levels are never limited.
+func limitDebugLogs(logger *zap.Logger, perSecond float64) *zap.Logger {
+	if perSecond <= 0 {
+		return logger
+	}
+	limiter := rate.NewLimiter(rate.Limit(perSecond), max(1, int(perSecond)))
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &debugLimitCore{Core: core, limiter: limiter}
+	}))
+}
+
+// debugLimitCore drops the debug lines its limiter does not allow.
+type debugLimitCore struct {
+	zapcore.Core
+	limiter *rate.Limiter
+}
+
+func (c *debugLimitCore) With(fields []zapcore.Field) zapcore.Core {
+	return &debugLimitCore{Core: c.Core.With(fields), limiter: c.limiter}
+}
+
+func (c *debugLimitCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level == zapcore.DebugLevel && c.Enabled(ent.Level) && !c.limiter.Allow() {
+		debugLogsDroppedTotal.Inc()
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeServerStream receives reqs in order, then io.EOF.
+type fakeServerStream struct {
+	grpc.ServerStream
+	reqs []*extprocv3.ProcessingRequest
+	sent int
+}
+
+func (s *fakeServerStream) Context() context.Context { return context.Background() }
+
+func (s *fakeServerStream) RecvMsg(m any) error {
+	if len(s.reqs) == 0 {
+		return io.EOF
+	}
+	proto.Merge(m.(*extprocv3.ProcessingRequest), s.reqs[0])
+	s.reqs = s.reqs[1:]
+	return nil
+}
+
+func (s *fakeServerStream) SendMsg(any) error {
+	s.sent++
+	return nil
+}
+
+// chainStream runs handler behind the interceptors of the server, as
+// grpc.ChainStreamInterceptor does.
+func chainStream(logger *zap.Logger, ss grpc.ServerStream, method string, handler grpc.StreamHandler) error {
+	info := &grpc.StreamServerInfo{FullMethod: method}
+	interceptors := streamInterceptors(logger)
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(srv any, ss grpc.ServerStream) error {
+			return interceptor(srv, ss, info, next)
+		}
+	}
+	return handler(nil, ss)
+}
+
+func TestStreamInterceptorsRecoverPanics(t *testing.T) {
+	const method = "/test.Panic/Process"
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	err := chainStream(zap.New(core), &fakeServerStream{}, method, func(any, grpc.ServerStream) error {
+		var headers *extprocv3.HttpHeaders
+		_ = headers.Headers.Headers // nil pointer dereference
+		return nil
+	})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("error = %v, want code Internal", err)
+	}
+	if got := testutil.ToFloat64(panicsRecoveredTotal.WithLabelValues(method)); got != 1 {
+		t.Errorf("grpc_panics_recovered_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(streamsTotal.WithLabelValues(method, codes.Internal.String())); got != 1 {
+		t.Errorf("grpc_streams_total{code=Internal} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(streamsOpen.WithLabelValues(method)); got != 0 {
+		t.Errorf("grpc_streams_open = %v after the stream ended, want 0", got)
+	}
+	if logs.FilterMessage("recovered panic while processing stream").Len() != 1 {
+		t.Errorf("panic not logged: %v", logs.All())
+	}
+}
+
+func TestStreamInterceptorsTagRequestID(t *testing.T) {
+	const method = "/test.Tag/Process"
+	core, logs := observer.New(zapcore.InfoLevel)
+	stream := &fakeServerStream{reqs: []*extprocv3.ProcessingRequest{{
+		Request: &extprocv3.ProcessingRequest_RequestHeaders{RequestHeaders: &extprocv3.HttpHeaders{
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: ":path", Value: "/"},
+				{Key: "x-request-id", RawValue: []byte("req-123")},
+			}},
+		}},
+	}}}
+
+	err := chainStream(zap.New(core), stream, method, func(_ any, ss grpc.ServerStream) error {
+		logger := streamLogger(ss.Context(), zap.NewNop())
+		logger.Info("before headers")
+		for {
+			req := &extprocv3.ProcessingRequest{}
+			if err := ss.RecvMsg(req); err == io.EOF {
+				break
+			}
+			logger.Info("after headers")
+			if err := ss.SendMsg(&extprocv3.ProcessingResponse{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+
+	if fields := logs.FilterMessage("before headers").All()[0].ContextMap(); fields["request_id"] != nil {
+		t.Errorf("line logged before the request headers tagged with request_id %v", fields["request_id"])
+	}
+	if fields := logs.FilterMessage("after headers").All()[0].ContextMap(); fields["request_id"] != "req-123" {
+		t.Errorf("request_id = %v, want req-123", fields["request_id"])
+	}
+	if got := testutil.ToFloat64(streamMessagesTotal.WithLabelValues(method, "received")); got != 1 {
+		t.Errorf("grpc_stream_messages_total{direction=received} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(streamMessagesTotal.WithLabelValues(method, "sent")); got != 1 || stream.sent != 1 {
+		t.Errorf("grpc_stream_messages_total{direction=sent} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(streamsTotal.WithLabelValues(method, codes.OK.String())); got != 1 {
+		t.Errorf("grpc_streams_total{code=OK} = %v, want 1", got)
+	}
+}
+
+func TestLimitDebugLogs(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	if limitDebugLogs(zap.New(core), 0).Core() != core {
+		t.Error("a rate of 0 must not limit the debug lines")
+	}
+
+	logger := limitDebugLogs(zap.New(core), 1).With(zap.String("stream", "a"))
+	dropped := testutil.ToFloat64(debugLogsDroppedTotal)
+	for range 5 {
+		logger.Debug("debug")
+	}
+	logger.Info("info")
+	logger.Info("info")
+
+	if got := logs.FilterMessage("debug").Len(); got != 1 {
+		t.Errorf("%d debug lines written, want 1 with a burst of 1", got)
+	}
+	if got := logs.FilterMessage("info").Len(); got != 2 {
+		t.Errorf("%d info lines written, want 2: only debug lines are limited", got)
+	}
+	if got := testutil.ToFloat64(debugLogsDroppedTotal) - dropped; got != 4 {
+		t.Errorf("debug_logs_dropped_total grew by %v, want 4", got)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// buildMaintenanceResponse answers a request matched by a maintenance route
+// with its maintenance response, so it never reaches a backend.
+func buildMaintenanceResponse(m *routes.RouteMaintenance) *extprocv3.ProcessingResponse {
+	var headers []*corev3.HeaderValueOption
+	if m.RetryAfter != "" {
+		headers = append(headers, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{Key: "retry-after", RawValue: []byte(m.RetryAfter)},
+		})
+	}
+	if m.ContentType != "" {
+		headers = append(headers, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{Key: "content-type", RawValue: []byte(m.ContentType)},
+		})
+	}
+	// Caches must not keep the maintenance page once the maintenance ends.
+	headers = append(headers, &corev3.HeaderValueOption{
+		Header: &corev3.HeaderValue{Key: "cache-control", RawValue: []byte("no-store")},
+	})
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(m.StatusCode)},
+				Headers: &extprocv3.HeaderMutation{SetHeaders: headers},
+				Body:    []byte(m.Body),
+				Details: "customrouter_maintenance",
+			},
+		},
+	}
+}
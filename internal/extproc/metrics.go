@@ -21,6 +21,8 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
 const metricsNamespace = "customrouter"
@@ -62,6 +64,15 @@ var (
 		},
 	)
 
+	hostRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "host_requests_total",
+			Help:      "Total number of requests per host of the route table, by whether a route matched. Other hosts are counted under host=\"\".",
+		},
+		[]string{"target", "host", "route_found"},
+	)
+
 	processingErrorsTotal = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: metricsNamespace,
@@ -69,6 +80,341 @@ var (
 			Help:      "Total number of errors during request processing.",
 		},
 	)
+
+	authChecksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "auth_checks_total",
+			Help:      "Total number of require-auth checks by result (allowed, denied, error).",
+		},
+		[]string{"result"},
+	)
+
+	outlierEjectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "outlier_ejections_total",
+			Help:      "Total number of backend ejections by route outlier policies and Responses fallback chains.",
+		},
+		[]string{"backend"},
+	)
+
+	outlierFailoversTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "outlier_failovers_total",
+			Help:      "Total number of requests sent to a fallback backend because their backend was ejected.",
+		},
+	)
+
+	backendFailoversTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "backend_failovers_total",
+			Help:      "Total number of requests sent along the fallback chain of their route because its backend was unhealthy, by health signal.",
+		},
+		[]string{"signal"},
+	)
+
+	maintenanceResponsesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "maintenance_responses_total",
+			Help:      "Total number of requests answered with a maintenance response.",
+		},
+	)
+
+	requestsTooLargeTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_too_large_total",
+			Help:      "Total number of requests answered with 413 because their body exceeds the maxRequestBytes of their route.",
+		},
+	)
+
+	upgradeRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upgrade_requests_total",
+			Help:      "Total number of protocol upgrade attempts handled by strip-upgrade and deny-upgrade actions, by action (stripped, denied).",
+		},
+		[]string{"action"},
+	)
+
+	reservedHeadersStrippedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "reserved_headers_stripped_total",
+			Help:      "Total number of client-sent routing decision headers (x-customrouter-cluster and the other headers the extproc sets) stripped before forwarding, by header.",
+		},
+		[]string{"header"},
+	)
+
+	requestHeadersScrubbedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_headers_scrubbed_total",
+			Help:      "Total number of client request headers removed before forwarding by --scrub-headers (target) or the matched route's scrubHeaders (route), by policy.",
+		},
+		[]string{"policy"},
+	)
+
+	reentryRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "reentry_requests_total",
+			Help:      "Total number of requests carrying an x-customrouter-processed marker under --reentry-guard, by result: skipped (valid marker, checked but not rewritten again, forwarded to the first run's cluster) or invalid (forged, expired or from another key; processed again).",
+		},
+		[]string{"result"},
+	)
+
+	hostAuthorityMismatchTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "host_authority_mismatch_total",
+			Help:      "Total number of requests whose Host header differed from :authority and was overwritten with it.",
+		},
+	)
+
+	routeMissReasonsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_miss_reasons_total",
+			Help:      "Total number of requests matching no route, by why their nearest route did not match and the path variant it would have matched. Recorded with --miss-diagnostics.",
+		},
+		[]string{"reason", "hint"},
+	)
+
+	drainingRouteMatchesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "draining_route_matches_total",
+			Help:      "Total number of requests matched by routes of deleted CustomHTTPRoutes kept while they drain.",
+		},
+	)
+
+	overloadActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "overload_active",
+			Help:      "1 while the external processor is overloaded and degrades routing, 0 otherwise.",
+		},
+	)
+
+	overloadRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "overload_requests_total",
+			Help:      "Total number of requests processed while overloaded, by overload action (shed-regex, fail-open).",
+		},
+		[]string{"action"},
+	)
+
+	analyticsRecordsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "analytics_records_total",
+			Help:      "Total number of routing decisions handled by the analytics exporter, by result (exported, failed, dropped).",
+		},
+		[]string{"result"},
+	)
+
+	analyticsWriteDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "analytics_write_duration_seconds",
+			Help:      "Histogram of the duration of analytics batch writes in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		},
+	)
+
+	streamsOpen = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_streams_open",
+			Help:      "Number of gRPC streams being served, by method.",
+		},
+		[]string{"method"},
+	)
+
+	streamsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_streams_total",
+			Help:      "Total number of finished gRPC streams, by method and status code.",
+		},
+		[]string{"method", "code"},
+	)
+
+	streamMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_stream_messages_total",
+			Help:      "Total number of gRPC stream messages, by method and direction (received, sent).",
+		},
+		[]string{"method", "direction"},
+	)
+
+	panicsRecoveredTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "grpc_panics_recovered_total",
+			Help:      "Total number of panics recovered while serving gRPC streams, by method; each fails its stream with Internal.",
+		},
+		[]string{"method"},
+	)
+
+	debugLogsDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "debug_logs_dropped_total",
+			Help:      "Total number of debug log lines dropped by --debug-log-rate.",
+		},
+	)
+
+	routeTableHosts = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_hosts",
+			Help:      "Number of hosts in the route table being served.",
+		},
+	)
+
+	routeTableRoutes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_routes",
+			Help:      "Number of routes in the route table being served.",
+		},
+	)
+
+	routeTableRegexes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_compiled_regexes",
+			Help:      "Number of compiled regexes (path, header and query parameter matches) in the route table being served.",
+		},
+	)
+
+	routeTableBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_bytes",
+			Help:      "Estimated memory held by the routes of the route table being served, in bytes.",
+		},
+	)
+
+	routeConfigMapsSkipped = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_configmaps_skipped",
+			Help:      "Route ConfigMaps the last load left out: untrusted (namespace or signature) or unreadable (not decompressible or decryptable).",
+		},
+		[]string{"reason"},
+	)
+
+	routeTableMaxBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_max_bytes",
+			Help:      "Memory budget of the route table (--max-route-table-bytes), in bytes; 0 when unlimited.",
+		},
+	)
+
+	routeTableOverBudget = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_over_budget",
+			Help:      "1 while the last route table loaded exceeded --max-route-table-bytes and the previous one is served instead.",
+		},
+	)
+
+	routeTableOverBudgetHostBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_over_budget_host_bytes",
+			Help:      "Estimated size of the largest hosts of the route table rejected by --max-route-table-bytes, in bytes.",
+		},
+		[]string{"host"},
+	)
+
+	routeTableRejectionsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_rejections_total",
+			Help:      "Total number of route tables not served because they exceeded --max-route-table-bytes.",
+		},
+	)
+
+	routeReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_reloads_total",
+			Help:      "Total number of route table reloads, by result (changed, unchanged).",
+		},
+		[]string{"result"},
+	)
+
+	routeTableChangesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_changes_total",
+			Help:      "Total number of hosts and routes added, removed or changed by route table reloads.",
+		},
+		[]string{"object", "change"},
+	)
+
+	routeTableConfigInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_config_info",
+			Help:      "Always 1, labeled with the hash of the route table being served; replicas with different hashes serve different routes.",
+		},
+		[]string{"config_hash"},
+	)
+
+	routeTableLoadedTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_table_loaded_timestamp_seconds",
+			Help:      "Unix time the route table being served was loaded.",
+		},
+	)
+
+	targetFound = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_found",
+			Help:      "1 when routes exist for the target the processor serves, 0 when --target-name matches no route ConfigMap or bucket object.",
+		},
+		[]string{"target"},
+	)
+
+	targetConfigMaps = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "target_configmaps",
+			Help:      "Route ConfigMaps of the target in --routes-configmap-namespace (all namespaces when empty); 0 when the controller writes them elsewhere or not at all.",
+		},
+		[]string{"target", "namespace"},
+	)
+
+	runtimeConfigLoadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "runtime_config_loads_total",
+			Help:      "Total number of runtime config ConfigMap versions seen, by result (success, error).",
+		},
+		[]string{"result"},
+	)
+
+	runtimeConfigLastApplied = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "runtime_config_applied_timestamp_seconds",
+			Help:      "Unix time the runtime config being used was applied.",
+		},
+	)
 )
 
 func init() {
@@ -77,10 +423,76 @@ func init() {
 		requestDuration,
 		routeMatchesTotal,
 		routeNotFoundTotal,
+		hostRequestsTotal,
 		processingErrorsTotal,
+		authChecksTotal,
+		outlierEjectionsTotal,
+		outlierFailoversTotal,
+		backendFailoversTotal,
+		maintenanceResponsesTotal,
+		requestsTooLargeTotal,
+		upgradeRequestsTotal,
+		reservedHeadersStrippedTotal,
+		requestHeadersScrubbedTotal,
+		reentryRequestsTotal,
+		hostAuthorityMismatchTotal,
+		routeMissReasonsTotal,
+		drainingRouteMatchesTotal,
+		overloadActive,
+		overloadRequestsTotal,
+		analyticsRecordsTotal,
+		analyticsWriteDuration,
+		streamsOpen,
+		streamsTotal,
+		streamMessagesTotal,
+		panicsRecoveredTotal,
+		debugLogsDroppedTotal,
+		routeTableHosts,
+		routeTableRoutes,
+		routeTableRegexes,
+		routeTableBytes,
+		routeConfigMapsSkipped,
+		routeTableMaxBytes,
+		routeTableOverBudget,
+		routeTableOverBudgetHostBytes,
+		routeTableRejectionsTotal,
+		routeReloadsTotal,
+		routeTableChangesTotal,
+		routeTableConfigInfo,
+		routeTableLoadedTimestamp,
+		targetFound,
+		targetConfigMaps,
+		runtimeConfigLoadsTotal,
+		runtimeConfigLastApplied,
 	)
 }
 
+// recordRouteTable publishes the size of the route table described by status.
+func recordRouteTable(status routes.LoadStatus) {
+	routeTableHosts.Set(float64(status.Hosts))
+	routeTableRoutes.Set(float64(status.Routes))
+	routeTableRegexes.Set(float64(status.Regexes))
+	routeTableBytes.Set(float64(status.Bytes))
+	routeConfigMapsSkipped.WithLabelValues("untrusted").Set(float64(len(status.RejectedConfigMaps)))
+	routeConfigMapsSkipped.WithLabelValues("unreadable").Set(float64(len(status.UnreadableConfigMaps)))
+	// Only the current hash is exported, so counting the distinct hashes
+	// across replicas measures how far a route update has propagated.
+	routeTableConfigInfo.Reset()
+	routeTableConfigInfo.WithLabelValues(status.ConfigHash).Set(1)
+	if !status.LastLoad.IsZero() {
+		routeTableLoadedTimestamp.Set(float64(status.LastLoad.UnixNano()) / 1e9)
+	}
+	routeTableOverBudgetHostBytes.Reset()
+	if status.OverBudget == nil {
+		routeTableOverBudget.Set(0)
+		return
+	}
+	routeTableOverBudget.Set(1)
+	for _, host := range status.OverBudget.LargestHosts {
+		routeTableOverBudgetHostBytes.WithLabelValues(host.Host).Set(float64(host.Bytes))
+	}
+}
+
 // MetricsHandler returns an HTTP handler for Prometheus metrics.
 func MetricsHandler() http.Handler {
 	return promhttp.Handler()
@@ -0,0 +1,69 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/matcher"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// SetMissDiagnostics enables the explanation of route misses: a request
+// matching no route of a host of the route table is compared again with
+// every route of the host, and the nearest route and the reason it did not
+// match are logged and counted in route_miss_reasons_total. It costs a
+// full scan of the host per miss.
+func (p *Processor) SetMissDiagnostics(enabled bool) {
+	p.missDiagnostics = enabled
+}
+
+// diagnoseMiss logs and counts why match, the request of reqCtx, matched no
+// route, when miss diagnostics are enabled.
+func (p *Processor) diagnoseMiss(logger *zap.Logger, reqCtx *requestContext, match routes.RequestMatch) {
+	if !p.missDiagnostics {
+		return
+	}
+	table, ok := p.routeFinder.(routeTable)
+	if !ok {
+		return
+	}
+	config := table.GetConfig()
+	if config == nil {
+		return
+	}
+	miss := config.ExplainMiss(matcher.StripPort(reqCtx.authority), match)
+	routeMissReasonsTotal.WithLabelValues(miss.Reason, miss.Hint).Inc()
+
+	fields := []zap.Field{
+		zap.String("host", reqCtx.authority),
+		zap.String("path", reqCtx.path),
+		zap.String("method", reqCtx.method),
+		zap.String("reason", miss.Reason),
+		zap.Int("candidates_evaluated", miss.Evaluated),
+	}
+	if miss.Hint != "" {
+		fields = append(fields, zap.String("hint", miss.Hint))
+	}
+	if miss.Nearest != nil {
+		fields = append(fields, zap.Any("nearest", newTraceCandidate(miss.Nearest, miss.Reason)))
+	}
+	if miss.CommonPrefix != "" {
+		fields = append(fields, zap.String("common_prefix", miss.CommonPrefix))
+	}
+	logger.Info("route miss", fields...)
+}
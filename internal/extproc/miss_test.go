@@ -0,0 +1,56 @@
+package extproc
+
+import (
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestProcessRequestHeaders_MissDiagnostics(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		core, logs := observer.New(zap.InfoLevel)
+		p := NewProcessor(tableRouteFinder{config: traceTestConfig()}, zap.New(core), false)
+		p.SetMissDiagnostics(enabled)
+		counter := routeMissReasonsTotal.WithLabelValues(routes.MismatchPath, "")
+		before := testutil.ToFloat64(counter)
+
+		_, reqCtx, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com:443"},
+				{Key: ":path", Value: "/admi/"},
+				{Key: ":method", Value: "GET"},
+			}},
+		}, &streamContext{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reqCtx.routeFound {
+			t.Fatal("request must not match")
+		}
+
+		entries := logs.FilterMessage("route miss").All()
+		if !enabled {
+			if len(entries) != 0 || testutil.ToFloat64(counter) != before {
+				t.Errorf("disabled diagnostics logged %d misses", len(entries))
+			}
+			continue
+		}
+		if len(entries) != 1 || testutil.ToFloat64(counter) != before+1 {
+			t.Fatalf("logged %d misses, want 1 counted", len(entries))
+		}
+		fields := entries[0].ContextMap()
+		if fields["reason"] != routes.MismatchPath || fields["common_prefix"] != "/admi" {
+			t.Errorf("miss fields = %v, want reason path and common prefix /admi", fields)
+		}
+		nearest, ok := fields["nearest"].(traceCandidate)
+		if !ok || nearest.Path != "/admin" {
+			t.Errorf("nearest = %v, want the /admin route", fields["nearest"])
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// SetPathNormalization configures how request paths are normalized before
+// matching when the attachment sets no pathNormalization. The default
+// normalizes nothing.
+func (p *Processor) SetPathNormalization(n routes.PathNormalization) {
+	p.pathNormalization = n
+}
+
+// streamPathNormalization returns the pathNormalization an
+// ExternalProcessorAttachment passed as gRPC initial metadata, or nil when
+// none (or an invalid one) was set.
+func streamPathNormalization(ctx context.Context) *routes.PathNormalization {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+	values := md.Get(routes.PathNormalizationMetadataKey)
+	if len(values) == 0 {
+		return nil
+	}
+	n, err := routes.ParsePathNormalization(values[0])
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+// resolvePathNormalization returns the path normalization applied to the
+// requests of a stream: the attachment's, or the processor default.
+func (p *Processor) resolvePathNormalization(streamCtx *streamContext) routes.PathNormalization {
+	if streamCtx != nil && streamCtx.pathNormalization != nil {
+		return *streamCtx.pathNormalization
+	}
+	return p.pathNormalization
+}
+
+// normalizeRequestPath normalizes the path of reqCtx, and rawPath (the
+// :path with its query string) along with it, before the route lookup. It
+// returns false when the path is rejected.
+func (p *Processor) normalizeRequestPath(reqCtx *requestContext, rawPath *string, streamCtx *streamContext) bool {
+	n := p.resolvePathNormalization(streamCtx)
+	if n == (routes.PathNormalization{}) {
+		return true
+	}
+	normalized, ok := routes.NormalizePath(reqCtx.path, n)
+	if !ok {
+		return false
+	}
+	if normalized != reqCtx.path {
+		reqCtx.originalPath = *rawPath
+		*rawPath = normalized + (*rawPath)[len(reqCtx.path):]
+		reqCtx.path = normalized
+	}
+	return true
+}
+
+// buildRejectedPathResponse answers a request whose path the path
+// normalization rejects.
+func buildRejectedPathResponse() *extprocv3.ProcessingResponse {
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode_BadRequest},
+				Details: "customrouter_rejected_path",
+			},
+		},
+	}
+}
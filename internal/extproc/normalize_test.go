@@ -0,0 +1,133 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// pathRecordingRouteFinder returns route for every request, recording the
+// path it was asked for.
+type pathRecordingRouteFinder struct {
+	route *routes.Route
+	path  *string
+}
+
+func (f pathRecordingRouteFinder) FindRoute(_ string, req routes.RequestMatch) *routes.Route {
+	*f.path = req.Path
+	return f.route
+}
+
+func TestProcessRequestHeaders_PathNormalization(t *testing.T) {
+	route := &routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:80"}
+	all := &routes.PathNormalization{MergeSlashes: true, DecodeUnreserved: true, RejectEncodedSlashes: true}
+
+	tests := []struct {
+		name       string
+		processor  routes.PathNormalization
+		stream     *routes.PathNormalization
+		path       string
+		wantLookup string
+		wantPath   string // forwarded :path, "" when unchanged
+		wantStatus typev3.StatusCode
+	}{
+		{name: "default normalizes nothing", path: "//api//v1?q=1", wantLookup: "//api//v1"},
+		{
+			name:       "processor default",
+			processor:  routes.PathNormalization{MergeSlashes: true},
+			path:       "//api//v1?q=//x",
+			wantLookup: "/api/v1",
+			wantPath:   "/api/v1?q=//x",
+		},
+		{name: "attachment normalization", stream: all, path: "/%61pi/%7Ev1", wantLookup: "/api/~v1", wantPath: "/api/~v1"},
+		{name: "normalized path unchanged", stream: all, path: "/api/v1?q=%2F", wantLookup: "/api/v1"},
+		{name: "encoded slash rejected", stream: all, path: "/api%2Fv1", wantStatus: typev3.StatusCode_BadRequest},
+		{
+			name:       "attachment disables the default",
+			processor:  routes.PathNormalization{RejectEncodedSlashes: true},
+			stream:     &routes.PathNormalization{},
+			path:       "/api%2fv1",
+			wantLookup: "/api%2fv1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lookup string
+			p := NewProcessor(pathRecordingRouteFinder{route: route, path: &lookup}, zap.NewNop(), false)
+			p.SetPathNormalization(tt.processor)
+
+			resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+					{Key: ":authority", Value: "example.com"},
+					{Key: ":path", Value: tt.path},
+					{Key: ":method", Value: "GET"},
+				}},
+			}, &streamContext{pathNormalization: tt.stream})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.wantStatus != 0 {
+				if got := resp.GetImmediateResponse().GetStatus().GetCode(); got != tt.wantStatus {
+					t.Errorf("status = %v, want %v", got, tt.wantStatus)
+				}
+				if lookup != "" {
+					t.Errorf("route looked up for %q, want none", lookup)
+				}
+				return
+			}
+			if lookup != tt.wantLookup {
+				t.Errorf("route looked up for %q, want %q", lookup, tt.wantLookup)
+			}
+			if got := setHeaderValue(resp, ":path"); got != tt.wantPath {
+				t.Errorf(":path = %q, want %q", got, tt.wantPath)
+			}
+			if tt.wantPath != "" {
+				if got := setHeaderValue(resp, "x-envoy-original-path"); got != tt.path {
+					t.Errorf("x-envoy-original-path = %q, want %q", got, tt.path)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamPathNormalization(t *testing.T) {
+	if got := streamPathNormalization(context.Background()); got != nil {
+		t.Errorf("without metadata = %v, want nil", got)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(routes.PathNormalizationMetadataKey, "merge-slashes,reject-encoded-slashes"))
+	got := streamPathNormalization(ctx)
+	if got == nil || *got != (routes.PathNormalization{MergeSlashes: true, RejectEncodedSlashes: true}) {
+		t.Errorf("got %v, want merge-slashes and reject-encoded-slashes", got)
+	}
+	ctx = metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(routes.PathNormalizationMetadataKey, "bogus"))
+	if got := streamPathNormalization(ctx); got != nil {
+		t.Errorf("invalid metadata = %v, want nil", got)
+	}
+}
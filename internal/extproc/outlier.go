@@ -0,0 +1,180 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	extprocfilterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// outlierTracker counts the responses of the backends of routes with an
+// outlier policy and ejects a backend once too many of them are server
+// errors. The state is local to the processor: each extproc replica ejects
+// backends from the responses it has seen.
+type outlierTracker struct {
+	mu       sync.Mutex
+	backends map[string]*backendStats
+
+	// now returns the current time; tests replace it.
+	now func() time.Time
+}
+
+// backendStats are the responses of a backend in the current interval.
+type backendStats struct {
+	windowStart  time.Time
+	requests     int32
+	failures     int32
+	ejectedUntil time.Time
+}
+
+func newOutlierTracker() *outlierTracker {
+	return &outlierTracker{
+		backends: make(map[string]*backendStats),
+		now:      time.Now,
+	}
+}
+
+// ejected reports whether backend is ejected.
+func (t *outlierTracker) ejected(backend string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats, ok := t.backends[backend]
+	return ok && t.now().Before(stats.ejectedUntil)
+}
+
+// record counts a response of backend, failed when it is a server error,
+// and ejects the backend for policy.EjectionMs once failures reach
+// policy.ErrorRatePercent of at least policy.MinRequests responses within
+// policy.IntervalMs. It reports whether this response ejected the backend.
+func (t *outlierTracker) record(backend string, policy *routes.RouteOutlier, failed bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	stats, ok := t.backends[backend]
+	if !ok {
+		stats = &backendStats{windowStart: now}
+		t.backends[backend] = stats
+	}
+	if now.Before(stats.ejectedUntil) {
+		// Responses of requests sent before the ejection do not count
+		// towards the next interval.
+		return false
+	}
+	if now.Sub(stats.windowStart) >= time.Duration(policy.IntervalMs)*time.Millisecond {
+		stats.windowStart = now
+		stats.requests = 0
+		stats.failures = 0
+	}
+
+	stats.requests++
+	if failed {
+		stats.failures++
+	}
+	if stats.requests < policy.MinRequests ||
+		int64(stats.failures)*100 < int64(policy.ErrorRatePercent)*int64(stats.requests) {
+		return false
+	}
+
+	stats.ejectedUntil = now.Add(time.Duration(policy.EjectionMs) * time.Millisecond)
+	stats.windowStart = stats.ejectedUntil
+	stats.requests = 0
+	stats.failures = 0
+	return true
+}
+
+// applyOutlierPolicy fails a route with an outlier policy over to its
+// fallback backend while its backend is ejected. The route is copied so the
+// shared route table is never mutated. It reports whether the response of
+// the request must be tracked, which is the case when the route was not
+// failed over.
+func (p *Processor) applyOutlierPolicy(route *routes.Route) (*routes.Route, bool) {
+	if route.Outlier == nil {
+		return route, false
+	}
+	if !p.outliers.ejected(route.Backend) {
+		return route, true
+	}
+	p.logger.Debug("backend ejected, failing over",
+		zap.String("backend", route.Backend),
+		zap.String("fallback", route.Outlier.FallbackBackend),
+	)
+	outlierFailoversTotal.Inc()
+	failedOver := *route
+	failedOver.Backend = route.Outlier.FallbackBackend
+	return &failedOver, false
+}
+
+// trackResponse asks Envoy to send the response headers of the request, so
+// its status reaches recordOutlierResponse. The ext_proc filter must allow
+// mode overrides; the attachment's EnvoyFilter does.
+func trackResponse(resp *extprocv3.ProcessingResponse) {
+	if resp.ModeOverride == nil {
+		resp.ModeOverride = &extprocfilterv3.ProcessingMode{}
+	}
+	resp.ModeOverride.ResponseHeaderMode = extprocfilterv3.ProcessingMode_SEND
+}
+
+// recordOutlierResponse counts the response of a tracked request towards
+// the outlier policy of its route, or the thresholds of its Responses
+// fallback chain. 5xx responses are failures.
+func (p *Processor) recordOutlierResponse(headers *extprocv3.HttpHeaders, streamCtx *streamContext) {
+	if streamCtx == nil || !streamCtx.trackOutlier || streamCtx.matchedRoute == nil {
+		return
+	}
+	// A stream carries a single response.
+	streamCtx.trackOutlier = false
+
+	var status int
+	for _, h := range headers.GetHeaders().GetHeaders() {
+		if h.Key != ":status" {
+			continue
+		}
+		value := h.Value
+		if value == "" {
+			value = string(h.RawValue)
+		}
+		status, _ = strconv.Atoi(value)
+		break
+	}
+
+	route := streamCtx.matchedRoute
+	var policy *routes.RouteOutlier
+	var fallback zap.Field
+	if route.Failover != nil {
+		policy = failoverOutlier(route.Failover)
+		fallback = zap.Strings("chain", route.Failover.Backends)
+	} else {
+		policy = route.Outlier
+		fallback = zap.String("fallback", policy.FallbackBackend)
+	}
+	if p.outliers.record(route.Backend, policy, status >= 500) {
+		p.logger.Warn("backend ejected",
+			zap.String("backend", route.Backend),
+			fallback,
+			zap.Int64("ejection_ms", policy.EjectionMs),
+		)
+		outlierEjectionsTotal.WithLabelValues(route.Backend).Inc()
+	}
+}
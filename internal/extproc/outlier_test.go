@@ -0,0 +1,134 @@
+package extproc
+
+import (
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocfilterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestOutlierTracker(t *testing.T) {
+	policy := &routes.RouteOutlier{
+		FallbackBackend:  "fallback.default.svc.cluster.local:8080",
+		ErrorRatePercent: 50,
+		MinRequests:      4,
+		IntervalMs:       10_000,
+		EjectionMs:       30_000,
+	}
+	const backend = "api.default.svc.cluster.local:8080"
+
+	now := time.Unix(0, 0)
+	tracker := newOutlierTracker()
+	tracker.now = func() time.Time { return now }
+
+	// Errors below minRequests never eject.
+	for range 3 {
+		if tracker.record(backend, policy, true) {
+			t.Fatal("ejected before minRequests responses")
+		}
+	}
+	// A new interval starts over.
+	now = now.Add(10 * time.Second)
+	for _, failed := range []bool{true, false, false} {
+		if tracker.record(backend, policy, failed) {
+			t.Fatal("ejected below the error rate")
+		}
+	}
+	if !tracker.record(backend, policy, true) {
+		t.Fatal("2 errors out of 4 responses must eject the backend at 50%")
+	}
+	if !tracker.ejected(backend) {
+		t.Fatal("backend not ejected")
+	}
+	if tracker.ejected("other.default.svc.cluster.local:8080") {
+		t.Fatal("an unrelated backend must not be ejected")
+	}
+
+	// Late responses during the ejection are ignored.
+	for range 4 {
+		if tracker.record(backend, policy, true) {
+			t.Fatal("ejected again while ejected")
+		}
+	}
+	now = now.Add(30 * time.Second)
+	if tracker.ejected(backend) {
+		t.Fatal("backend still ejected after the ejection time")
+	}
+	if tracker.record(backend, policy, true) {
+		t.Fatal("responses during the ejection must not count after it")
+	}
+}
+
+func TestProcessRequestHeaders_OutlierPolicy(t *testing.T) {
+	route := &routes.Route{
+		Path:    "/api",
+		Type:    routes.RouteTypePrefix,
+		Backend: "api.default.svc.cluster.local:8080",
+		Outlier: &routes.RouteOutlier{
+			FallbackBackend:  "fallback.default.svc.cluster.local:8080",
+			ErrorRatePercent: 50,
+			MinRequests:      2,
+			IntervalMs:       10_000,
+			EjectionMs:       30_000,
+		},
+	}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+
+	request := func() (*extprocv3.ProcessingResponse, *streamContext) {
+		t.Helper()
+		streamCtx := &streamContext{}
+		resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: "/api/items"},
+				{Key: ":method", Value: "GET"},
+			}},
+		}, streamCtx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp, streamCtx
+	}
+	respond := func(streamCtx *streamContext, status string) {
+		p.recordOutlierResponse(&extprocv3.HttpHeaders{
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{{Key: ":status", RawValue: []byte(status)}}},
+		}, streamCtx)
+	}
+
+	for range 2 {
+		resp, streamCtx := request()
+		if resp.GetModeOverride().GetResponseHeaderMode() != extprocfilterv3.ProcessingMode_SEND {
+			t.Fatalf("tracked request must ask for its response headers, got %v", resp.GetModeOverride())
+		}
+		if got := setHeaderValue(resp, "x-customrouter-cluster"); got != "outbound|8080||api.default.svc.cluster.local" {
+			t.Fatalf("cluster = %q, want the api backend", got)
+		}
+		respond(streamCtx, "503")
+	}
+
+	resp, streamCtx := request()
+	if got := setHeaderValue(resp, "x-customrouter-cluster"); got != "outbound|8080||fallback.default.svc.cluster.local" {
+		t.Errorf("cluster = %q, want the fallback backend while the api backend is ejected", got)
+	}
+	if resp.GetModeOverride() != nil || streamCtx.trackOutlier {
+		t.Error("failed over requests must not be tracked")
+	}
+	if route.Backend != "api.default.svc.cluster.local:8080" {
+		t.Errorf("shared route was mutated: backend = %q", route.Backend)
+	}
+}
+
+// setHeaderValue returns the value a forward response sets for header key.
+func setHeaderValue(resp *extprocv3.ProcessingResponse, key string) string {
+	for _, h := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+		if h.GetHeader().GetKey() == key {
+			return string(h.GetHeader().GetRawValue())
+		}
+	}
+	return ""
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+)
+
+// Overload actions, what the processor does with requests while overloaded.
+const (
+	// OverloadActionShedRegex matches requests against exact and prefix
+	// routes only, skipping the evaluation of regex routes.
+	OverloadActionShedRegex = "shed-regex"
+
+	// OverloadActionFailOpen lets requests through unrouted, as if no route
+	// matched them, without looking them up. Requests to hosts with routes
+	// requiring auth or answering with maintenance are still looked up, so
+	// failing open never skips those checks.
+	OverloadActionFailOpen = "fail-open"
+)
+
+const (
+	// degradedHeader is added to the requests let through while
+	// overloaded, with the overload action as its value.
+	degradedHeader = "x-customrouter-degraded"
+
+	// overloadHoldTime is how long the processor stays degraded after the
+	// last request that found it overloaded. Degraded requests are cheap, so
+	// without it the processor would flap in and out of overload.
+	overloadHoldTime = 5 * time.Second
+
+	// overloadLatencyWeight is the weight of a new sample in the moving
+	// average of the route lookup latency, as 1/overloadLatencyWeight.
+	overloadLatencyWeight = 8
+)
+
+// OverloadPolicy sets when the processor is overloaded and what it does
+// then. The processor is overloaded while any set threshold is exceeded;
+// zero thresholds are not checked, and a policy with none is disabled.
+type OverloadPolicy struct {
+	// MaxInFlight is the number of request headers messages processed at
+	// the same time.
+	MaxInFlight int
+
+	// MaxGoroutines is the number of goroutines of the process.
+	MaxGoroutines int
+
+	// MaxLatency is the moving average of the route lookup latency.
+	MaxLatency time.Duration
+
+	// Action is OverloadActionShedRegex or OverloadActionFailOpen.
+	Action string
+}
+
+// Enabled reports whether the policy sets any threshold.
+func (o OverloadPolicy) Enabled() bool {
+	return o.MaxInFlight > 0 || o.MaxGoroutines > 0 || o.MaxLatency > 0
+}
+
+// Validate returns an error when the action of an enabled policy is not a
+// known overload action.
+func (o OverloadPolicy) Validate() error {
+	if !o.Enabled() {
+		return nil
+	}
+	switch o.Action {
+	case OverloadActionShedRegex, OverloadActionFailOpen:
+		return nil
+	}
+	return fmt.Errorf("invalid overload action %q, must be %s or %s",
+		o.Action, OverloadActionShedRegex, OverloadActionFailOpen)
+}
+
+// overloadManager tracks the load signals of an OverloadPolicy. It is lock
+// free: it is consulted by every request, and contention on it is highest
+// exactly when it matters.
+type overloadManager struct {
+	policy OverloadPolicy
+	logger *zap.Logger
+
+	inFlight atomic.Int64
+
+	// latencyNs is the moving average of the route lookup latency.
+	// Concurrent updates may lose a sample, which an average tolerates.
+	latencyNs atomic.Int64
+
+	// lastLookup is when the latest lookup was observed, or the average
+	// last decayed (Unix nanoseconds). Failing open stops the lookups, so
+	// without decaying the average would keep the processor overloaded.
+	lastLookup atomic.Int64
+
+	// degradedUntil is when the processor leaves degraded mode (Unix
+	// nanoseconds), and degraded whether it is in it, to log and export
+	// the transitions once.
+	degradedUntil atomic.Int64
+	degraded      atomic.Bool
+
+	// now and goroutines return the current time and goroutine count;
+	// tests replace them.
+	now        func() time.Time
+	goroutines func() int
+}
+
+func newOverloadManager(policy OverloadPolicy, logger *zap.Logger) *overloadManager {
+	return &overloadManager{
+		policy:     policy,
+		logger:     logger,
+		now:        time.Now,
+		goroutines: runtime.NumGoroutine,
+	}
+}
+
+// enter starts processing a request and returns the overload action to
+// apply to it, or "" when the processor is not overloaded. Every call must
+// be followed by exit.
+func (m *overloadManager) enter() string {
+	inFlight := m.inFlight.Add(1)
+	now := m.now()
+	m.decayLatency(now)
+
+	if reason := m.exceeded(inFlight); reason != "" {
+		m.degradedUntil.Store(now.Add(overloadHoldTime).UnixNano())
+		if m.degraded.CompareAndSwap(false, true) {
+			overloadActive.Set(1)
+			m.logger.Warn("extproc overloaded, degrading routing",
+				zap.String("reason", reason),
+				zap.String("action", m.policy.Action),
+				zap.Int64("in_flight", inFlight),
+				zap.Duration("lookup_latency", time.Duration(m.latencyNs.Load())),
+			)
+		}
+	} else if now.UnixNano() >= m.degradedUntil.Load() {
+		if m.degraded.CompareAndSwap(true, false) {
+			overloadActive.Set(0)
+			m.logger.Info("extproc no longer overloaded, routing restored")
+		}
+		return ""
+	}
+	overloadRequestsTotal.WithLabelValues(m.policy.Action).Inc()
+	return m.policy.Action
+}
+
+// exit finishes processing a request.
+func (m *overloadManager) exit() {
+	m.inFlight.Add(-1)
+}
+
+// observeLookup adds a route lookup latency to the moving average.
+func (m *overloadManager) observeLookup(d time.Duration) {
+	avg := m.latencyNs.Load()
+	m.latencyNs.Store(avg + (d.Nanoseconds()-avg)/overloadLatencyWeight)
+	m.lastLookup.Store(m.now().UnixNano())
+}
+
+// decayLatency halves the lookup latency average for every overloadHoldTime
+// without a lookup, so a processor failing open, which looks nothing up,
+// leaves overload once the hold time has passed a few times and probes the
+// latency again.
+func (m *overloadManager) decayLatency(now time.Time) {
+	if m.policy.MaxLatency <= 0 {
+		return
+	}
+	last := m.lastLookup.Load()
+	periods := (now.UnixNano() - last) / overloadHoldTime.Nanoseconds()
+	if periods <= 0 || !m.lastLookup.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	m.latencyNs.Store(m.latencyNs.Load() >> min(periods, 63))
+}
+
+// exceeded returns the first threshold of the policy the current load
+// exceeds, or "".
+func (m *overloadManager) exceeded(inFlight int64) string {
+	switch {
+	case m.policy.MaxInFlight > 0 && inFlight > int64(m.policy.MaxInFlight):
+		return "in_flight"
+	case m.policy.MaxLatency > 0 && m.latencyNs.Load() > m.policy.MaxLatency.Nanoseconds():
+		return "latency"
+	case m.policy.MaxGoroutines > 0 && m.goroutines() > m.policy.MaxGoroutines:
+		return "goroutines"
+	}
+	return ""
+}
+
+// SetOverloadPolicy enables load shedding with policy, or disables it when
+// the policy sets no threshold. It must be called before the processor
+// serves requests.
+func (p *Processor) SetOverloadPolicy(policy OverloadPolicy) {
+	if !policy.Enabled() {
+		p.overload = nil
+		return
+	}
+	p.overload = newOverloadManager(policy, p.logger)
+}
+
+// enterOverload is overloadManager.enter for the processor, which may have
+// no overload policy. The returned function must be called when the
+// request is processed.
+func (p *Processor) enterOverload() (action string, exit func()) {
+	if p.overload == nil {
+		return "", func() {}
+	}
+	return p.overload.enter(), p.overload.exit
+}
+
+// hasGuardedRoutes reports whether host has routes requiring auth or
+// answering with maintenance, whose requests must be looked up even when the
+// overload action fails open (see routes.RoutesConfig.HasGuardedRoutes).
+func (p *Processor) hasGuardedRoutes(host string) bool {
+	table, ok := p.routeFinder.(routeTable)
+	if !ok {
+		return false
+	}
+	if idx := strings.Index(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+	return table.GetConfig().HasGuardedRoutes(host)
+}
+
+// observeLookup records the latency of a route lookup started at start.
+func (p *Processor) observeLookup(start time.Time) {
+	if p.overload != nil {
+		p.overload.observeLookup(time.Since(start))
+	}
+}
+
+// addDegradedHeader marks the request let through by resp as processed
+// while overloaded with action.
+func addDegradedHeader(resp *extprocv3.ProcessingResponse, action string) {
+	mutation := resp.GetRequestHeaders().GetResponse().GetHeaderMutation()
+	if action == "" || mutation == nil {
+		return
+	}
+	mutation.SetHeaders = append(mutation.SetHeaders, &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: degradedHeader, RawValue: []byte(action)},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	})
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestOverloadPolicyValidate(t *testing.T) {
+	if err := (OverloadPolicy{Action: "drop"}).Validate(); err != nil {
+		t.Errorf("a disabled policy must not be validated: %v", err)
+	}
+	if err := (OverloadPolicy{MaxInFlight: 10, Action: "drop"}).Validate(); err == nil {
+		t.Error("Validate() accepted an unknown action")
+	}
+	for _, action := range []string{OverloadActionShedRegex, OverloadActionFailOpen} {
+		if err := (OverloadPolicy{MaxLatency: time.Millisecond, Action: action}).Validate(); err != nil {
+			t.Errorf("Validate(%q) = %v", action, err)
+		}
+	}
+}
+
+func TestOverloadManager(t *testing.T) {
+	now := time.Unix(0, 0)
+	goroutines := 10
+	m := newOverloadManager(OverloadPolicy{
+		MaxInFlight:   2,
+		MaxGoroutines: 100,
+		MaxLatency:    time.Millisecond,
+		Action:        OverloadActionShedRegex,
+	}, zap.NewNop())
+	m.now = func() time.Time { return now }
+	m.goroutines = func() int { return goroutines }
+
+	// Up to MaxInFlight concurrent requests are not overloaded.
+	if action := m.enter(); action != "" {
+		t.Fatalf("enter() = %q with 1 request in flight, want none", action)
+	}
+	if action := m.enter(); action != "" {
+		t.Fatalf("enter() = %q with 2 requests in flight, want none", action)
+	}
+	if action := m.enter(); action != OverloadActionShedRegex {
+		t.Fatalf("enter() = %q with 3 requests in flight, want %q", action, OverloadActionShedRegex)
+	}
+	if testutil.ToFloat64(overloadActive) != 1 {
+		t.Error("overload_active = 0 while overloaded")
+	}
+	m.exit()
+	m.exit()
+	m.exit()
+
+	// Degraded mode is held after the load drops.
+	now = now.Add(overloadHoldTime - time.Second)
+	if action := m.enter(); action != OverloadActionShedRegex {
+		t.Errorf("enter() = %q within the hold time, want %q", action, OverloadActionShedRegex)
+	}
+	m.exit()
+	now = now.Add(time.Second)
+	if action := m.enter(); action != "" {
+		t.Errorf("enter() = %q after the hold time, want none", action)
+	}
+	m.exit()
+	if testutil.ToFloat64(overloadActive) != 0 {
+		t.Error("overload_active = 1 after the overload ended")
+	}
+
+	// The goroutine count and the lookup latency are thresholds too.
+	goroutines = 101
+	if action := m.enter(); action == "" {
+		t.Error("enter() not overloaded with too many goroutines")
+	}
+	m.exit()
+	goroutines = 10
+	now = now.Add(overloadHoldTime)
+	for range 50 {
+		m.observeLookup(5 * time.Millisecond)
+	}
+	if action := m.enter(); action == "" {
+		t.Error("enter() not overloaded with a slow route lookup")
+	}
+	m.exit()
+}
+
+// recordingRouteFinder records the last request it was asked to match.
+type recordingRouteFinder struct {
+	route *routes.Route
+	last  routes.RequestMatch
+}
+
+func (f *recordingRouteFinder) FindRoute(_ string, req routes.RequestMatch) *routes.Route {
+	f.last = req
+	return f.route
+}
+
+func TestProcessRequestHeaders_Overload(t *testing.T) {
+	route := &routes.Route{Path: "/", Type: routes.RouteTypePrefix, Backend: "web.default.svc.cluster.local:8080"}
+	headers := &extprocv3.HttpHeaders{
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":authority", Value: "example.com"},
+			{Key: ":path", Value: "/items/42"},
+			{Key: ":method", Value: "GET"},
+		}},
+	}
+	degraded := func(resp *extprocv3.ProcessingResponse) string {
+		for _, h := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+			if h.GetHeader().GetKey() == degradedHeader {
+				return string(h.GetHeader().GetRawValue())
+			}
+		}
+		return ""
+	}
+
+	for _, action := range []string{OverloadActionShedRegex, OverloadActionFailOpen} {
+		t.Run(action, func(t *testing.T) {
+			finder := &recordingRouteFinder{route: route}
+			p := NewProcessor(finder, zap.NewNop(), false)
+			// With another request in flight, this one exceeds MaxInFlight.
+			p.SetOverloadPolicy(OverloadPolicy{MaxInFlight: 1, Action: action})
+			p.overload.inFlight.Add(1)
+
+			resp, reqCtx, err := p.processRequestHeaders(headers, &streamContext{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := degraded(resp); got != action {
+				t.Errorf("%s = %q, want %q", degradedHeader, got, action)
+			}
+			if p.overload.inFlight.Load() != 1 {
+				t.Errorf("in flight = %d after the request, want 1", p.overload.inFlight.Load())
+			}
+
+			switch action {
+			case OverloadActionShedRegex:
+				if !finder.last.SkipRegex {
+					t.Error("route lookup did not skip regex routes")
+				}
+				if !reqCtx.routeFound {
+					t.Error("routeFound = false, want the prefix route matched")
+				}
+			case OverloadActionFailOpen:
+				if finder.last.Path != "" {
+					t.Error("route lookup ran while failing open")
+				}
+				if reqCtx.routeFound {
+					t.Error("routeFound = true while failing open")
+				}
+				if !resp.GetRequestHeaders().GetResponse().GetClearRouteCache() {
+					t.Error("ClearRouteCache = false, want true")
+				}
+			}
+		})
+	}
+
+	p := NewProcessor(&recordingRouteFinder{route: route}, zap.NewNop(), false)
+	resp, _, err := p.processRequestHeaders(headers, &streamContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := degraded(resp); got != "" {
+		t.Errorf("%s = %q without an overload policy, want none", degradedHeader, got)
+	}
+}
+
+func TestOverloadManagerLatencyDecay(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := newOverloadManager(OverloadPolicy{MaxLatency: time.Millisecond, Action: OverloadActionFailOpen}, zap.NewNop())
+	m.now = func() time.Time { return now }
+
+	for range 50 {
+		m.observeLookup(5 * time.Millisecond)
+	}
+	if action := m.enter(); action != OverloadActionFailOpen {
+		t.Fatalf("enter() = %q with a slow route lookup, want %q", action, OverloadActionFailOpen)
+	}
+	m.exit()
+
+	// Failing open looks nothing up: without decay the average would keep
+	// the processor overloaded forever.
+	for i := range 10 {
+		now = now.Add(overloadHoldTime)
+		action := m.enter()
+		m.exit()
+		if action == "" {
+			if i < 2 {
+				t.Errorf("left overload after %d hold times, the average decays too fast", i+1)
+			}
+			return
+		}
+	}
+	t.Error("still overloaded after 10 hold times without a route lookup")
+}
+
+func TestProcessRequestHeaders_FailOpenGuardedHost(t *testing.T) {
+	maintenance := routes.Route{
+		Path:        "/",
+		Type:        routes.RouteTypePrefix,
+		Priority:    routes.MaintenancePriority,
+		Maintenance: &routes.RouteMaintenance{StatusCode: 503},
+	}
+	auth := routes.Route{
+		Path:    "/",
+		Type:    routes.RouteTypePrefix,
+		Backend: "web.default.svc.cluster.local:8080",
+		Actions: []routes.RouteAction{{Type: routes.ActionTypeRequireAuth, AuthURL: "http://auth.default.svc:8080/check"}},
+	}
+	config := &routes.RoutesConfig{Hosts: map[string][]routes.Route{
+		"down.example.com":   {maintenance},
+		"secure.example.com": {auth},
+		"open.example.com":   {{Path: "/", Type: routes.RouteTypePrefix, Backend: "web.default.svc.cluster.local:8080"}},
+	}}
+	config.BuildGuardedIndex()
+	p := NewProcessor(tableRouteFinder{config: config}, zap.NewNop(), false)
+	p.SetOverloadPolicy(OverloadPolicy{MaxInFlight: 1, Action: OverloadActionFailOpen})
+	p.overload.inFlight.Add(1)
+
+	request := func(host string) (*extprocv3.ProcessingResponse, *requestContext) {
+		resp, reqCtx, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: ":authority", Value: host},
+				{Key: ":path", Value: "/items"},
+				{Key: ":method", Value: "GET"},
+			}},
+		}, &streamContext{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", host, err)
+		}
+		return resp, reqCtx
+	}
+
+	if resp, _ := request("down.example.com"); resp.GetImmediateResponse().GetStatus().GetCode() != 503 {
+		t.Errorf("maintenance host failed open: got %v, want the maintenance response", resp)
+	}
+	if _, reqCtx := request("open.example.com"); reqCtx.routeFound {
+		t.Error("routeFound = true for a host without guarded routes, want it to fail open")
+	}
+	if !config.HasGuardedRoutes("secure.example.com") {
+		t.Error("HasGuardedRoutes(secure.example.com) = false for a require-auth route")
+	}
+}
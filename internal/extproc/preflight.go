@@ -0,0 +1,173 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// preflightTimeout bounds the ConfigMap listing of checkTarget.
+const preflightTimeout = 10 * time.Second
+
+// targetCheck is the outcome of checkTarget.
+type targetCheck struct {
+	// found is true when the route source has routes for the target.
+	found bool
+
+	// known are the targets the route ConfigMaps are labeled with, when
+	// they were listed.
+	known []string
+}
+
+// checkTarget reports whether routes exist for config.TargetName. A loaded
+// table with hosts settles it; otherwise, with ConfigMaps as the route
+// source, the route ConfigMaps are listed so a target whose ConfigMaps are
+// all empty is told from a --target-name no ConfigMap carries. A listing
+// error is returned along with the verdict from the table alone.
+func checkTarget(config *ServerConfig, status routes.LoadStatus) (targetCheck, error) {
+	if status.Hosts > 0 || config.RoutesBucket != nil || config.K8sClient == nil {
+		return targetCheck{found: status.Hosts > 0}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	known, err := routes.ConfigMapTargets(ctx, config.K8sClient, config.RoutesNamespace)
+	if err != nil {
+		return targetCheck{}, err
+	}
+	return targetCheck{found: slices.Contains(known, config.TargetName), known: known}, nil
+}
+
+// recordTargetFound runs checkTarget and sets the target_found gauge from
+// its verdict.
+func recordTargetFound(config *ServerConfig, status routes.LoadStatus, logger *zap.Logger) targetCheck {
+	check, err := checkTarget(config, status)
+	if err != nil {
+		logger.Warn("could not list route ConfigMaps to check --target-name", zap.Error(err))
+	}
+	targetFound.Reset()
+	value := 0.0
+	if check.found {
+		value = 1
+	}
+	targetFound.WithLabelValues(config.TargetName).Set(value)
+	return check
+}
+
+// warnTargetNotFound logs that no routes exist for the target.
+func warnTargetNotFound(config *ServerConfig, check targetCheck, logger *zap.Logger) {
+	logger.Warn("no routes found for target: every request is unmatched until routes for it are published; "+
+		"check that --target-name matches the targetRef.name of the CustomHTTPRoutes",
+		zap.String("target_name", config.TargetName),
+		zap.Strings("known_targets", check.known),
+	)
+}
+
+// namespaceCheck is the outcome of checkTargetNamespace.
+type namespaceCheck struct {
+	// configMaps is the number of route ConfigMaps of the target in
+	// --routes-configmap-namespace.
+	configMaps int
+
+	// elsewhere are the other namespaces holding route ConfigMaps of the
+	// target, looked up when --routes-configmap-namespace holds none, and
+	// consumer the ConsumerAnnotation of one of those ConfigMaps.
+	elsewhere []string
+	consumer  string
+}
+
+// checkTargetNamespace counts the route ConfigMaps of config.TargetName in
+// config.RoutesNamespace: those the last load merged or, when it merged none
+// (as when serving a snapshot), those a listing finds. When there are none
+// and a single namespace is watched, every namespace is listed for them, so
+// a controller writing to another --routes-configmap-namespace is told apart
+// from a target without routes. ok is false when ConfigMaps are not the
+// route source.
+func checkTargetNamespace(config *ServerConfig, status routes.LoadStatus) (check namespaceCheck, ok bool, err error) {
+	if config.RoutesBucket != nil || config.K8sClient == nil {
+		return namespaceCheck{}, false, nil
+	}
+	if status.Source == routes.LoadSourceConfigMaps && status.ConfigMaps > 0 {
+		return namespaceCheck{configMaps: status.ConfigMaps}, true, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	configMaps, err := routes.TargetConfigMaps(ctx, config.K8sClient, config.RoutesNamespace, config.TargetName)
+	if err != nil {
+		return namespaceCheck{}, false, err
+	}
+	check.configMaps = len(configMaps)
+	if check.configMaps > 0 || config.RoutesNamespace == "" {
+		return check, true, nil
+	}
+
+	// Listing every namespace needs cluster-wide read access to ConfigMaps;
+	// without it the count above still stands.
+	configMaps, err = routes.TargetConfigMaps(ctx, config.K8sClient, "", config.TargetName)
+	if err != nil {
+		return check, true, err
+	}
+	seen := make(map[string]bool)
+	for i := range configMaps {
+		ns := configMaps[i].Namespace
+		if !seen[ns] {
+			seen[ns] = true
+			check.elsewhere = append(check.elsewhere, ns)
+		}
+		if check.consumer == "" {
+			check.consumer = configMaps[i].Annotations[routes.ConsumerAnnotation]
+		}
+	}
+	sort.Strings(check.elsewhere)
+	return check, true, nil
+}
+
+// recordTargetConfigMaps runs checkTargetNamespace and sets the
+// target_configmaps gauge from its count.
+func recordTargetConfigMaps(config *ServerConfig, status routes.LoadStatus, logger *zap.Logger) namespaceCheck {
+	check, ok, err := checkTargetNamespace(config, status)
+	if err != nil {
+		logger.Warn("could not list route ConfigMaps to check --routes-configmap-namespace", zap.Error(err))
+	}
+	if ok {
+		targetConfigMaps.Reset()
+		targetConfigMaps.WithLabelValues(config.TargetName, config.RoutesNamespace).Set(float64(check.configMaps))
+	}
+	return check
+}
+
+// warnTargetNamespace logs that the route ConfigMaps of the
+// target are in namespaces other than the one watched. It logs nothing when
+// there are none anywhere; warnTargetNotFound covers that.
+func warnTargetNamespace(config *ServerConfig, check namespaceCheck, logger *zap.Logger) {
+	if check.configMaps > 0 || len(check.elsewhere) == 0 {
+		return
+	}
+	logger.Warn("route ConfigMaps for target are in another namespace: no routes are loaded from them; "+
+		"check that --routes-configmap-namespace matches the controller's",
+		zap.String("target_name", config.TargetName),
+		zap.String("routes_configmap_namespace", config.RoutesNamespace),
+		zap.Strings("namespaces", check.elsewhere),
+		zap.String("expected_flags", check.consumer),
+	)
+}
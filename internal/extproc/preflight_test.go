@@ -0,0 +1,172 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// routeConfigMap returns an empty route ConfigMap of target.
+func routeConfigMap(name, target string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "customrouter",
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by":    "customrouter-controller",
+				"customrouter.freepik.com/target": target,
+			},
+		},
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		routeConfigMap("customrouter-routes-public-0", "public"),
+		routeConfigMap("customrouter-routes-internal-0", "internal"),
+		routeConfigMap("customrouter-routes-internal-1", "internal"),
+	)
+	tests := []struct {
+		name   string
+		config *ServerConfig
+		status routes.LoadStatus
+		want   targetCheck
+	}{
+		{
+			name:   "loaded hosts",
+			config: &ServerConfig{TargetName: "typo", K8sClient: client},
+			status: routes.LoadStatus{Hosts: 2},
+			want:   targetCheck{found: true},
+		},
+		{
+			name:   "ConfigMaps of the target without hosts",
+			config: &ServerConfig{TargetName: "public", K8sClient: client},
+			want:   targetCheck{found: true, known: []string{"internal", "public"}},
+		},
+		{
+			name:   "misspelled target",
+			config: &ServerConfig{TargetName: "pubic", K8sClient: client},
+			want:   targetCheck{known: []string{"internal", "public"}},
+		},
+		{
+			name:   "other namespace",
+			config: &ServerConfig{TargetName: "public", K8sClient: client, RoutesNamespace: "other"},
+			want:   targetCheck{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkTarget(tt.config, tt.status)
+			if err != nil {
+				t.Fatalf("checkTarget: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkTarget = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServerRequireRoutes(t *testing.T) {
+	config := DefaultServerConfig()
+	config.TargetName = "pubic"
+	config.K8sClient = fake.NewSimpleClientset(routeConfigMap("customrouter-routes-public-0", "public"))
+
+	if _, err := NewServer(config, zap.NewNop()); err != nil {
+		t.Fatalf("NewServer without --require-routes: %v", err)
+	}
+
+	config.RequireRoutes = true
+	_, err := NewServer(config, zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), "[public]") {
+		t.Fatalf("NewServer with --require-routes = %v, want an error naming the known targets", err)
+	}
+}
+
+func TestCheckTargetNamespace(t *testing.T) {
+	consumer := routeConfigMap("customrouter-routes-public-0", "public")
+	consumer.Annotations = map[string]string{routes.ConsumerAnnotation: routes.ConsumerFlags("public", "customrouter")}
+	client := fake.NewSimpleClientset(consumer)
+	tests := []struct {
+		name   string
+		config *ServerConfig
+		status routes.LoadStatus
+		want   namespaceCheck
+	}{
+		{
+			name:   "loaded ConfigMaps",
+			config: &ServerConfig{TargetName: "public", K8sClient: client, RoutesNamespace: "other"},
+			status: routes.LoadStatus{Source: routes.LoadSourceConfigMaps, ConfigMaps: 3},
+			want:   namespaceCheck{configMaps: 3},
+		},
+		{
+			name:   "same namespace",
+			config: &ServerConfig{TargetName: "public", K8sClient: client, RoutesNamespace: "customrouter"},
+			want:   namespaceCheck{configMaps: 1},
+		},
+		{
+			name:   "other namespace",
+			config: &ServerConfig{TargetName: "public", K8sClient: client, RoutesNamespace: "other"},
+			want: namespaceCheck{
+				elsewhere: []string{"customrouter"},
+				consumer:  "--target-name=public --routes-configmap-namespace=customrouter",
+			},
+		},
+		{
+			name:   "no ConfigMaps anywhere",
+			config: &ServerConfig{TargetName: "internal", K8sClient: client, RoutesNamespace: "other"},
+			want:   namespaceCheck{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := checkTargetNamespace(tt.config, tt.status)
+			if err != nil || !ok {
+				t.Fatalf("checkTargetNamespace = %v, %v", ok, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkTargetNamespace = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok, _ := checkTargetNamespace(&ServerConfig{TargetName: "public"}, routes.LoadStatus{}); ok {
+		t.Error("checkTargetNamespace without a Kubernetes client = ok, want not checked")
+	}
+}
+
+func TestNewServerRequireRoutesOtherNamespace(t *testing.T) {
+	config := DefaultServerConfig()
+	config.TargetName = "public"
+	config.RoutesNamespace = "other"
+	config.RequireRoutes = true
+	config.K8sClient = fake.NewSimpleClientset(routeConfigMap("customrouter-routes-public-0", "public"))
+
+	_, err := NewServer(config, zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), "[customrouter]") {
+		t.Fatalf("NewServer with --require-routes = %v, want an error naming the namespace of the ConfigMaps", err)
+	}
+}
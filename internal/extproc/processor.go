@@ -18,12 +18,18 @@ limitations under the License.
 package extproc
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/freepik-company/customrouter/pkg/matcher"
 	"github.com/freepik-company/customrouter/pkg/routes"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
@@ -38,18 +44,114 @@ type RouteFinder interface {
 // Processor implements the Envoy external processor service
 type Processor struct {
 	extprocv3.UnimplementedExternalProcessorServer
-	routeFinder      RouteFinder
-	logger           *zap.Logger
-	accessLogEnabled bool
+	routeFinder RouteFinder
+	logger      *zap.Logger
+
+	// accessLogEnabled and accessLogSampleRate (float64 bits) control the
+	// access log. They can change at runtime, see SetAccessLog.
+	accessLogEnabled    atomic.Bool
+	accessLogSampleRate atomic.Uint64
+
+	// authClient performs the HTTP calls of require-auth actions.
+	authClient *http.Client
+
+	// decisionHeaders is the default decision headers mode, and debugHeader
+	// and debugHeaderValue select the requests that get them in on-debug
+	// mode. See SetDecisionHeaders.
+	decisionHeaders  string
+	debugHeader      string
+	debugHeaderValue string
+
+	// unmatchedPolicy is the default unmatched request policy. See
+	// SetUnmatchedPolicy.
+	unmatchedPolicy string
+
+	// pathNormalization is the default path normalization. See
+	// SetPathNormalization.
+	pathNormalization routes.PathNormalization
+
+	// clusterNaming is the default cluster naming. See SetClusterNaming.
+	clusterNaming routes.ClusterNaming
+
+	// variantSelector is the default route table variant selector. See
+	// SetVariantSelector.
+	variantSelector routes.VariantSelector
+
+	// scrubHeaders are the scrub patterns of the client request headers
+	// removed from every request. See SetScrubHeaders.
+	scrubHeaders []string
+
+	// redirectAltSvc is the default Alt-Svc header of redirect responses.
+	// See SetRedirectAltSvc.
+	redirectAltSvc string
+
+	// debugTraceHosts and debugTraceToken gate the per-request decision
+	// trace. The hosts can change at runtime. See SetDebugTrace.
+	debugTraceHosts atomic.Pointer[map[string]bool]
+	debugTraceToken string
+
+	// outliers tracks the backends of routes with an outlier policy.
+	outliers *outlierTracker
+
+	// endpoints tracks the ready endpoints of the backends of fallback
+	// chains with the Endpoints signal, nil when every backend is healthy by
+	// Endpoints. See SetEndpointsHealth.
+	endpoints *endpointsHealth
+
+	// configHash holds the hash of the route table being served, and
+	// configHashHeader adds it to debug requests. See SetConfigHash.
+	configHash       atomic.Value
+	configHashHeader bool
+
+	// hostMetricsTarget labels host_requests_total, recorded when it is set.
+	// See SetHostMetrics.
+	hostMetricsTarget string
+
+	// missDiagnostics explains route misses. See SetMissDiagnostics.
+	missDiagnostics bool
+
+	// overload sheds load while the processor is overloaded, nil when no
+	// overload policy is set. See SetOverloadPolicy.
+	overload *overloadManager
+
+	// analytics exports the routing decision of every request, nil when
+	// no analytics sink is set. See SetAnalytics.
+	analytics *analyticsExporter
+
+	// reentry marks the requests let through and recognizes them when the
+	// filter runs again, nil when the guard is off. See SetReentryGuard.
+	reentry *reentryGuard
+
+	// retainRouteCache keeps Envoy's route cache. See SetClearRouteCache.
+	retainRouteCache bool
 }
 
 // NewProcessor creates a new external processor
 func NewProcessor(routeFinder RouteFinder, logger *zap.Logger, accessLogEnabled bool) *Processor {
-	return &Processor{
-		routeFinder:      routeFinder,
-		logger:           logger,
-		accessLogEnabled: accessLogEnabled,
+	p := &Processor{
+		routeFinder: routeFinder,
+		logger:      logger,
+		authClient:  newAuthClient(),
+		outliers:    newOutlierTracker(),
 	}
+	p.SetAccessLog(accessLogEnabled, 1)
+	return p
+}
+
+// SetAccessLog enables or disables the access log and sets the fraction of
+// requests, from 0 to 1, that get an access log line. Request metrics are
+// recorded for every request while the access log is enabled. It is safe to
+// call while the processor serves requests.
+func (p *Processor) SetAccessLog(enabled bool, sampleRate float64) {
+	p.accessLogEnabled.Store(enabled)
+	p.accessLogSampleRate.Store(math.Float64bits(min(max(sampleRate, 0), 1)))
+}
+
+// accessLogSampled reports whether the current request gets an access log
+// line.
+func (p *Processor) accessLogSampled() bool {
+	rate := math.Float64frombits(p.accessLogSampleRate.Load())
+	return rate >= 1 || (rate > 0 && rand.Float64() < rate)
 }
 
 // requestContext holds information about the current request for logging
@@ -62,8 +164,28 @@ type requestContext struct {
 	matchedPattern   string
 	matchedType      string
 	matchedPriority  int32
+	overrideVariant  string
+	routeID          string
+	routeSource      string
+	routeRule        string
+	routeOwner       string
+	routeVariant     string
+	routeDraining    bool
 	routeFound       bool
 	processingTimeNs int64
+
+	// originalPath is the :path Envoy sent, with its query string, when
+	// path normalization changed it; path is then the normalized path.
+	originalPath string
+
+	// configHash is the hash of the route table that routed the request,
+	// and emitConfigHash whether it is added to the request's headers.
+	configHash     string
+	emitConfigHash bool
+
+	// clusterNaming names the cluster of the backend the request is
+	// forwarded to.
+	clusterNaming routes.ClusterNaming
 }
 
 // streamContext is the per-stream state shared across ext_proc phases
@@ -71,6 +193,14 @@ type requestContext struct {
 // so the matched route selected in the request phase is the one whose
 // response-side actions must be applied when the response headers arrive.
 type streamContext struct {
+	// ctx is the gRPC stream context. Outbound calls made while processing
+	// the request (e.g. require-auth checks) are cancelled with it.
+	ctx context.Context
+
+	// logger tags the lines of the stream with its request ID (see
+	// streamLogger); nil uses the logger of the processor.
+	logger *zap.Logger
+
 	// matchedRoute is the route selected during processRequestHeaders, or nil
 	// if no route matched. Read-only after the request phase completes.
 	matchedRoute *routes.Route
@@ -79,12 +209,73 @@ type streamContext struct {
 	// so response-side header actions can expand ${...} placeholders using
 	// the same source of truth as request-side actions. Read-only after the
 	// request phase completes.
-	vars *requestVars
+	vars *matcher.Vars
+
+	// decisionHeaders is the decision headers mode the attachment passed as
+	// stream metadata, or "" when it set none.
+	decisionHeaders string
+
+	// unmatchedPolicy is the unmatched request policy the attachment passed
+	// as stream metadata, or "" when it set none.
+	unmatchedPolicy string
+
+	// pathNormalization is the path normalization the attachment passed as
+	// stream metadata, or nil when it set none.
+	pathNormalization *routes.PathNormalization
+
+	// clusterNaming holds the clusterName settings the attachment passed as
+	// stream metadata; unset fields fall back to the processor's.
+	clusterNaming routes.ClusterNaming
+
+	// variantSelector is the variantSelector the attachment passed as
+	// stream metadata, or the zero value when it set none.
+	variantSelector routes.VariantSelector
+
+	// reentered is set while a request carrying a valid re-entry marker is
+	// processed: it is checked like any other, but let through without
+	// being rewritten or routed again (see SetReentryGuard), to
+	// reentryCluster, the cluster its first run routed it to.
+	reentered      bool
+	reentryCluster string
+
+	// trackOutlier is set when the response of the request counts towards
+	// the outlier policy, or the Responses fallback chain, of matchedRoute.
+	trackOutlier bool
+
+	// maxRequestBytes is the body limit of matchedRoute when its body is
+	// buffered to be checked, and requestBodyBytes the body seen so far.
+	maxRequestBytes  int64
+	requestBodyBytes int64
+}
+
+// context returns the stream context, or a background context when the
+// stream context is not set (e.g. in tests).
+func (s *streamContext) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// loggerFor returns the logger of the stream of streamCtx.
+func (p *Processor) loggerFor(streamCtx *streamContext) *zap.Logger {
+	if streamCtx == nil || streamCtx.logger == nil {
+		return p.logger
+	}
+	return streamCtx.logger
 }
 
 // Process handles the bidirectional stream from Envoy
 func (p *Processor) Process(stream extprocv3.ExternalProcessor_ProcessServer) error {
-	streamCtx := &streamContext{}
+	streamCtx := &streamContext{
+		ctx:               stream.Context(),
+		logger:            streamLogger(stream.Context(), p.logger),
+		decisionHeaders:   streamDecisionHeaders(stream.Context()),
+		unmatchedPolicy:   streamUnmatchedPolicy(stream.Context()),
+		pathNormalization: streamPathNormalization(stream.Context()),
+		clusterNaming:     streamClusterNaming(stream.Context()),
+		variantSelector:   streamVariantSelector(stream.Context()),
+	}
 	for {
 		req, err := stream.Recv()
 		if err == io.EOF {
@@ -97,7 +288,7 @@ func (p *Processor) Process(stream extprocv3.ExternalProcessor_ProcessServer) er
 		resp, reqCtx, err := p.processRequest(req, streamCtx)
 		if err != nil {
 			processingErrorsTotal.Inc()
-			p.logger.Error("failed to process request", zap.Error(err))
+			streamCtx.logger.Error("failed to process request", zap.Error(err))
 			return err
 		}
 
@@ -108,13 +299,16 @@ func (p *Processor) Process(stream extprocv3.ExternalProcessor_ProcessServer) er
 		}
 
 		// Log access after sending response
-		if p.accessLogEnabled && reqCtx != nil {
-			p.logAccess(reqCtx)
+		if p.accessLogEnabled.Load() && reqCtx != nil {
+			p.logAccess(streamCtx.logger, reqCtx)
+		}
+		if p.analytics != nil && reqCtx != nil {
+			p.analytics.record(reqCtx)
 		}
 	}
 }
 
-func (p *Processor) logAccess(ctx *requestContext) {
+func (p *Processor) logAccess(logger *zap.Logger, ctx *requestContext) {
 	ctx.processingTimeNs = time.Since(ctx.startTime).Nanoseconds()
 
 	// Record metrics
@@ -127,9 +321,14 @@ func (p *Processor) logAccess(ctx *requestContext) {
 	} else {
 		routeNotFoundTotal.Inc()
 	}
+	p.recordHostRequest(ctx)
+
+	if !p.accessLogSampled() {
+		return
+	}
 
 	if ctx.routeFound {
-		p.logger.Info("access",
+		logger.Info("access",
 			zap.String("original_authority", ctx.authority),
 			zap.String("new_authority", ctx.matchedBackend),
 			zap.String("path", ctx.path),
@@ -137,14 +336,23 @@ func (p *Processor) logAccess(ctx *requestContext) {
 			zap.String("matched_pattern", ctx.matchedPattern),
 			zap.String("matched_type", ctx.matchedType),
 			zap.Int32("matched_priority", ctx.matchedPriority),
+			zap.String("override_variant", ctx.overrideVariant),
+			zap.String("route_id", ctx.routeID),
+			zap.String("route_source", ctx.routeSource),
+			zap.String("route_rule", ctx.routeRule),
+			zap.String("route_owner", ctx.routeOwner),
+			zap.String("route_variant", ctx.routeVariant),
+			zap.Bool("route_draining", ctx.routeDraining),
+			zap.String("config_hash", ctx.configHash),
 			zap.Bool("route_found", true),
 			zap.Int64("processing_time_ns", ctx.processingTimeNs),
 		)
 	} else {
-		p.logger.Info("access",
+		logger.Info("access",
 			zap.String("original_authority", ctx.authority),
 			zap.String("path", ctx.path),
 			zap.String("method", ctx.method),
+			zap.String("config_hash", ctx.configHash),
 			zap.Bool("route_found", false),
 			zap.Int64("processing_time_ns", ctx.processingTimeNs),
 		)
@@ -152,31 +360,53 @@ func (p *Processor) logAccess(ctx *requestContext) {
 }
 
 func (p *Processor) processRequest(req *extprocv3.ProcessingRequest, streamCtx *streamContext) (*extprocv3.ProcessingResponse, *requestContext, error) {
+	logger := p.loggerFor(streamCtx)
+
 	// Debug: log request type
-	p.logger.Debug("processRequest called",
+	logger.Debug("processRequest called",
 		zap.String("request_type", fmt.Sprintf("%T", req.Request)),
 	)
 
 	switch r := req.Request.(type) {
 	case *extprocv3.ProcessingRequest_RequestHeaders:
-		p.logger.Debug("handling RequestHeaders")
-		return p.processRequestHeaders(r.RequestHeaders, streamCtx)
+		logger.Debug("handling RequestHeaders")
+		id := requestID(req)
+		// A request this processor already let through is a second run of
+		// the filter: routing it again would apply its rewrites twice. The
+		// marker may have been replayed, so the request is still checked,
+		// sanitized and scrubbed, which strips the marker too.
+		streamCtx.reentryCluster, streamCtx.reentered = p.reentered(r.RequestHeaders, id)
+		resp, reqCtx, err := p.processRequestHeaders(r.RequestHeaders, streamCtx)
+		if err != nil {
+			return resp, reqCtx, err
+		}
+		letThrough := streamCtx.reentered && resp.GetRequestHeaders() != nil
+		if !letThrough {
+			p.addConfigHashHeader(resp, reqCtx)
+			p.addProcessedMarker(resp, id)
+		}
+		p.sanitizeRequestHeaders(resp, r.RequestHeaders, reqCtx)
+		p.scrubRequestHeaders(resp, r.RequestHeaders, streamCtx.matchedRoute)
+		p.applyRouteCachePolicy(resp)
+		if letThrough {
+			logger.Debug("request already processed, letting it through")
+			// Logged and counted on its first run.
+			return resp, nil, nil
+		}
+		return resp, reqCtx, nil
 
 	case *extprocv3.ProcessingRequest_ResponseHeaders:
-		p.logger.Debug("handling ResponseHeaders")
+		logger.Debug("handling ResponseHeaders")
+		p.recordOutlierResponse(r.ResponseHeaders, streamCtx)
 		return p.processResponseHeaders(streamCtx), nil, nil
 
 	case *extprocv3.ProcessingRequest_RequestBody:
-		p.logger.Debug("handling RequestBody")
-		// We don't process request body
-		return &extprocv3.ProcessingResponse{
-			Response: &extprocv3.ProcessingResponse_RequestBody{
-				RequestBody: &extprocv3.BodyResponse{},
-			},
-		}, nil, nil
+		logger.Debug("handling RequestBody")
+		// Only bodies buffered for maxRequestBytes are inspected.
+		return p.processRequestBody(r.RequestBody, streamCtx), nil, nil
 
 	case *extprocv3.ProcessingRequest_ResponseBody:
-		p.logger.Debug("handling ResponseBody")
+		logger.Debug("handling ResponseBody")
 		// We don't process response body
 		return &extprocv3.ProcessingResponse{
 			Response: &extprocv3.ProcessingResponse_ResponseBody{
@@ -185,7 +415,7 @@ func (p *Processor) processRequest(req *extprocv3.ProcessingRequest, streamCtx *
 		}, nil, nil
 
 	default:
-		p.logger.Debug("handling unknown request type")
+		logger.Debug("handling unknown request type")
 		return nil, nil, nil
 	}
 }
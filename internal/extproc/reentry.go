@@ -0,0 +1,254 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// ProcessedHeader is the request header marking a request the processor
+// already let through, so a second run of the ext_proc filter on the same
+// request (see SetReentryGuard) leaves it alone.
+const ProcessedHeader = "x-customrouter-processed"
+
+// Results of a request carrying ProcessedHeader, the result label of
+// reentry_requests_total.
+const (
+	reentryResultSkipped = "skipped"
+	reentryResultInvalid = "invalid"
+)
+
+// reentryMarkerTTL is how long a marker is honoured after it was set. A
+// re-run of the filter happens within the same request, so a marker older
+// than this was replayed from a previous request.
+const reentryMarkerTTL = 30 * time.Second
+
+// reentryMarkerSkew is how far in the future a marker's timestamp may be,
+// for replicas whose clocks disagree slightly.
+const reentryMarkerSkew = 5 * time.Second
+
+// reentryGuard marks the requests the processor lets through and
+// recognizes its own markers. A marker is "<unix seconds>.<HMAC>", followed
+// by ".<cluster>" when the request was routed to a cluster, the HMAC
+// covering the target, the x-request-id, the timestamp and the cluster, so a
+// client cannot forge one to skip routing or pick a cluster, and one leaked
+// by an upstream expires quickly and only fits its request.
+type reentryGuard struct {
+	key    []byte
+	target string
+	now    func() time.Time
+}
+
+// SetReentryGuard makes the processor mark every request it lets through
+// with ProcessedHeader and let a request carrying a valid marker through
+// without rewriting it, logging it or counting it again, to the cluster the
+// marker names: the one its first run routed it to. Some
+// Envoy setups run the ext_proc filter a second time on a request, e.g. on
+// an internal redirect or after ClearRouteCache picks a route that goes
+// through the filter again; processing it again would apply its rewrites
+// twice.
+//
+// Upstreams see the marker, and one may echo it back to the client, so a
+// marker is no proof the request was checked: the route the request
+// matches now still answers with its maintenance, size, upgrade and
+// require-auth checks, and the reserved and scrubbed headers are removed,
+// the marker included.
+//
+// Markers are signed with key, which the replicas of target must share to
+// recognize each other's; a nil key generates one, so only this process
+// recognizes its markers.
+func (p *Processor) SetReentryGuard(key []byte, target string) {
+	if key == nil {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	p.reentry = &reentryGuard{key: key, target: target, now: time.Now}
+}
+
+// SetClearRouteCache sets whether the responses letting a request through
+// ask Envoy to clear its route cache, so the route is picked again from the
+// headers the processor set. It is on by default; turn it off only when the
+// Envoy route does not depend on those headers, e.g. a single route
+// forwarding on the x-customrouter-cluster cluster_header, since the route
+// Envoy picked before the processor ran is kept otherwise.
+func (p *Processor) SetClearRouteCache(enabled bool) {
+	p.retainRouteCache = !enabled
+}
+
+// sign returns the marker HMAC of the request with the given x-request-id
+// routed to cluster at the given unix time.
+func (g *reentryGuard) sign(requestID, cluster string, unix int64) []byte {
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write([]byte(g.target))
+	mac.Write([]byte{0})
+	mac.Write([]byte(requestID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(unix, 10)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(cluster))
+	return mac.Sum(nil)
+}
+
+// marker returns the ProcessedHeader value of the request with the given
+// x-request-id routed to cluster, or let through unrouted when cluster is
+// empty.
+func (g *reentryGuard) marker(requestID, cluster string) string {
+	unix := g.now().Unix()
+	value := strconv.FormatInt(unix, 10) + "." + hex.EncodeToString(g.sign(requestID, cluster, unix))
+	if cluster != "" {
+		value += "." + cluster
+	}
+	return value
+}
+
+// valid reports whether value is a marker this guard set on the request
+// with the given x-request-id less than reentryMarkerTTL ago, and returns
+// the cluster it names.
+func (g *reentryGuard) valid(value, requestID string) (string, bool) {
+	ts, rest, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", false
+	}
+	// Cluster names contain dots; the HMAC never does.
+	sig, cluster, _ := strings.Cut(rest, ".")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	age := g.now().Sub(time.Unix(unix, 0))
+	if age > reentryMarkerTTL || age < -reentryMarkerSkew {
+		return "", false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal(got, g.sign(requestID, cluster, unix)) {
+		return "", false
+	}
+	return cluster, true
+}
+
+// reentered reports whether the request carries a valid marker, i.e. the
+// processor already let it through, and returns the cluster its first run
+// routed it to. It counts the markers it sees.
+func (p *Processor) reentered(headers *extprocv3.HttpHeaders, requestID string) (string, bool) {
+	if p.reentry == nil {
+		return "", false
+	}
+	for _, h := range headers.GetHeaders().GetHeaders() {
+		if !strings.EqualFold(h.Key, ProcessedHeader) {
+			continue
+		}
+		value := h.Value
+		if value == "" {
+			value = string(h.RawValue)
+		}
+		if cluster, ok := p.reentry.valid(value, requestID); ok {
+			reentryRequestsTotal.WithLabelValues(reentryResultSkipped).Inc()
+			return cluster, true
+		}
+		reentryRequestsTotal.WithLabelValues(reentryResultInvalid).Inc()
+		return "", false
+	}
+	return "", false
+}
+
+// addProcessedMarker marks the request resp lets through with
+// ProcessedHeader, replacing any marker it carried, naming the cluster resp
+// routes it to. Responses answering the request right away are left alone.
+func (p *Processor) addProcessedMarker(resp *extprocv3.ProcessingResponse, requestID string) {
+	common := resp.GetRequestHeaders().GetResponse()
+	if p.reentry == nil || common == nil {
+		return
+	}
+	if common.HeaderMutation == nil {
+		common.HeaderMutation = &extprocv3.HeaderMutation{}
+	}
+	var cluster string
+	for _, h := range common.HeaderMutation.SetHeaders {
+		if h.GetHeader().GetKey() == "x-customrouter-cluster" {
+			cluster = string(h.GetHeader().GetRawValue())
+		}
+	}
+	common.HeaderMutation.SetHeaders = append(common.HeaderMutation.SetHeaders, &corev3.HeaderValueOption{
+		Header: &corev3.HeaderValue{
+			Key:      ProcessedHeader,
+			RawValue: []byte(p.reentry.marker(requestID, cluster)),
+		},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	})
+}
+
+// applyRouteCachePolicy drops the ClearRouteCache of resp when the route
+// cache is retained (see SetClearRouteCache).
+func (p *Processor) applyRouteCachePolicy(resp *extprocv3.ProcessingResponse) {
+	if common := resp.GetRequestHeaders().GetResponse(); p.retainRouteCache && common != nil {
+		common.ClearRouteCache = false
+	}
+}
+
+// buildReentryResponse lets a request the processor already let through
+// continue as its first run left it. The edge header removal strips the
+// x-customrouter-cluster that run set ahead of every run, so it is set again
+// from the marker, with the cluster routing metadata, for the dynamic route
+// to forward the request to the backend the first run chose. An empty
+// cluster, for a request the first run let through unrouted, leaves it to
+// the route Envoy picks by path and host.
+func buildReentryResponse(cluster string) *extprocv3.ProcessingResponse {
+	common := &extprocv3.CommonResponse{}
+	resp := &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_RequestHeaders{
+			RequestHeaders: &extprocv3.HeadersResponse{Response: common},
+		},
+	}
+	if cluster == "" {
+		return resp
+	}
+	common.ClearRouteCache = true
+	common.HeaderMutation = &extprocv3.HeaderMutation{
+		SetHeaders: []*corev3.HeaderValueOption{{
+			Header: &corev3.HeaderValue{
+				Key:      "x-customrouter-cluster",
+				RawValue: []byte(cluster),
+			},
+			AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		}},
+	}
+	resp.DynamicMetadata = &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			routes.RoutingMetadataNamespace: structpb.NewStructValue(&structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					routes.RoutingMetadataCluster: structpb.NewStringValue(cluster),
+				},
+			}),
+		},
+	}
+	return resp
+}
@@ -0,0 +1,244 @@
+package extproc
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestProcessRequest_ReentryGuard(t *testing.T) {
+	route := &routes.Route{
+		Path:    "/api",
+		Type:    routes.RouteTypePrefix,
+		Backend: "api.default.svc.cluster.local:8080",
+		Actions: []routes.RouteAction{
+			{Type: routes.ActionTypeRewrite, RewritePath: "/v2/api"},
+		},
+	}
+	now := time.Unix(1_700_000_000, 0)
+	first := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+	first.SetReentryGuard([]byte("shared-key"), "default")
+	first.reentry.now = func() time.Time { return now }
+	_, mutation := processSpoofed(t, first, &corev3.HeaderValue{Key: "x-request-id", Value: "req-1"})
+	marker, _, ok := setHeader(mutation, ProcessedHeader)
+	if !ok {
+		t.Fatalf("%s not set, set %v", ProcessedHeader, mutation.GetSetHeaders())
+	}
+	cluster, _, _ := setHeader(mutation, "x-customrouter-cluster")
+	ts, rest, _ := strings.Cut(marker, ".")
+	sig, _, _ := strings.Cut(rest, ".")
+
+	tests := []struct {
+		name      string
+		marker    string
+		requestID string
+		target    string
+		later     time.Duration
+		skipped   bool
+	}{
+		{name: "own marker", marker: marker, requestID: "req-1", target: "default", skipped: true},
+		{name: "marker of another replica", marker: marker, requestID: "req-1", target: "default", later: 10 * time.Second, skipped: true},
+		{name: "forged", marker: "1700000000.deadbeef", requestID: "req-1", target: "default"},
+		{name: "another cluster", marker: ts + "." + sig + ".outbound|443||payments.internal.svc.cluster.local", requestID: "req-1", target: "default"},
+		{name: "replayed on another request", marker: marker, requestID: "req-2", target: "default"},
+		{name: "expired", marker: marker, requestID: "req-1", target: "default", later: reentryMarkerTTL + time.Second},
+		{name: "another target", marker: marker, requestID: "req-1", target: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+			p.SetReentryGuard([]byte("shared-key"), tt.target)
+			p.reentry.now = func() time.Time { return now.Add(tt.later) }
+
+			_, mutation := processSpoofed(t, p,
+				&corev3.HeaderValue{Key: ProcessedHeader, Value: tt.marker},
+				&corev3.HeaderValue{Key: "x-request-id", Value: tt.requestID})
+
+			if !tt.skipped {
+				if _, _, ok := setHeader(mutation, "x-customrouter-cluster"); !ok {
+					t.Fatal("request with an invalid marker not routed again")
+				}
+				if value, _, _ := setHeader(mutation, ProcessedHeader); value == tt.marker {
+					t.Errorf("invalid marker %q kept", value)
+				}
+				return
+			}
+			// Only the cluster of the first run is set again, over the
+			// spoofed one: the request is not rewritten twice.
+			if len(mutation.GetSetHeaders()) != 1 {
+				t.Errorf("re-entered request rewritten again: set %v", mutation.GetSetHeaders())
+			}
+			if got, _, _ := setHeader(mutation, "x-customrouter-cluster"); got != cluster {
+				t.Errorf("x-customrouter-cluster = %q, want the first run's %q", got, cluster)
+			}
+			// Still sanitized, which strips the marker before the backend.
+			if !slices.Contains(mutation.GetRemoveHeaders(), ProcessedHeader) {
+				t.Errorf("%s not removed from a re-entered request, removed %v", ProcessedHeader, mutation.GetRemoveHeaders())
+			}
+		})
+	}
+
+	// Without the guard, a client-sent marker is stripped like any
+	// reserved header.
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+	_, mutation = processSpoofed(t, p, &corev3.HeaderValue{Key: ProcessedHeader, Value: marker})
+	if _, _, ok := setHeader(mutation, ProcessedHeader); ok {
+		t.Errorf("%s set without the guard", ProcessedHeader)
+	}
+	removed := false
+	for _, name := range mutation.GetRemoveHeaders() {
+		removed = removed || name == ProcessedHeader
+	}
+	if !removed {
+		t.Errorf("client-sent %s not removed, removed %v", ProcessedHeader, mutation.GetRemoveHeaders())
+	}
+}
+
+func TestProcessRequest_ReentryReplay(t *testing.T) {
+	// A backend echoing request headers leaks a valid marker, which the
+	// client replays with the same x-request-id.
+	route := &routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080"}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+	p.SetReentryGuard([]byte("shared-key"), "default")
+	p.SetScrubHeaders([]string{"x-internal-*"})
+	_, mutation := processSpoofed(t, p, &corev3.HeaderValue{Key: "x-request-id", Value: "req-1"})
+	marker, _, _ := setHeader(mutation, ProcessedHeader)
+
+	replay := func() *extprocv3.ProcessingResponse {
+		t.Helper()
+		resp, reqCtx, err := p.processRequest(&extprocv3.ProcessingRequest{
+			Request: &extprocv3.ProcessingRequest_RequestHeaders{
+				RequestHeaders: &extprocv3.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+					{Key: ":authority", Value: "example.com"},
+					{Key: ":path", Value: "/api/items"},
+					{Key: ":method", Value: "GET"},
+					{Key: "x-request-id", Value: "req-1"},
+					{Key: "x-internal-user", Value: "admin"},
+					{Key: ProcessedHeader, Value: marker},
+				}}},
+			},
+		}, &streamContext{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.GetRequestHeaders() != nil && reqCtx != nil {
+			t.Error("re-entered request logged again")
+		}
+		return resp
+	}
+
+	// The marker is honoured, but scrubbing still applies.
+	replayed := replay().GetRequestHeaders().GetResponse().GetHeaderMutation()
+	if _, _, ok := setHeader(replayed, "x-original-authority"); ok {
+		t.Fatal("replayed marker not recognized: the request was routed again")
+	}
+	removed := replayed.GetRemoveHeaders()
+	if !slices.Contains(removed, "x-internal-user") {
+		t.Errorf("scrubbed header not removed from a replayed request, removed %v", removed)
+	}
+
+	// So does the maintenance of the route.
+	route.Maintenance = &routes.RouteMaintenance{StatusCode: 503}
+	if got := replay().GetImmediateResponse().GetStatus().GetCode(); got != 503 {
+		t.Errorf("replayed request answered %v, want the 503 maintenance response", got)
+	}
+}
+
+func TestProcessRequest_ReentryKeepsBackend(t *testing.T) {
+	// The first run sends 10% of the requests to the canary; the second
+	// run must not re-roll that choice, nor lose it to the edge header
+	// removal.
+	stable := &routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "stable.default.svc.cluster.local:8080"}
+	canary := &routes.Route{
+		Path:    "/api",
+		Type:    routes.RouteTypePrefix,
+		Backend: "canary.default.svc.cluster.local:8080",
+		Actions: []routes.RouteAction{{Type: routes.ActionTypeRewrite, RewritePath: "/v2/api"}},
+	}
+	first := NewProcessor(staticRouteFinder{route: canary}, zap.NewNop(), false)
+	first.SetReentryGuard([]byte("shared-key"), "default")
+	_, mutation := processSpoofed(t, first, &corev3.HeaderValue{Key: "x-request-id", Value: "req-1"})
+	marker, _, _ := setHeader(mutation, ProcessedHeader)
+	want, _, _ := setHeader(mutation, "x-customrouter-cluster")
+	if want != "outbound|8080||canary.default.svc.cluster.local" {
+		t.Fatalf("first run routed to %q, want the canary", want)
+	}
+
+	for name, finder := range map[string]staticRouteFinder{
+		"another backend matches now": {route: stable},
+		"no route matches now":        {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			second := NewProcessor(finder, zap.NewNop(), false)
+			second.SetReentryGuard([]byte("shared-key"), "default")
+			// The edge removed the first run's x-customrouter-cluster.
+			resp, _, err := second.processRequest(&extprocv3.ProcessingRequest{
+				Request: &extprocv3.ProcessingRequest_RequestHeaders{
+					RequestHeaders: &extprocv3.HttpHeaders{Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+						{Key: ":authority", Value: "example.com"},
+						{Key: ":path", Value: "/v2/api/items"},
+						{Key: ":method", Value: "GET"},
+						{Key: "x-request-id", Value: "req-1"},
+						{Key: ProcessedHeader, Value: marker},
+					}}},
+				},
+			}, &streamContext{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			common := resp.GetRequestHeaders().GetResponse()
+			if got, _, _ := setHeader(common.GetHeaderMutation(), "x-customrouter-cluster"); got != want {
+				t.Errorf("x-customrouter-cluster = %q, want the first run's %q", got, want)
+			}
+			if _, _, ok := setHeader(common.GetHeaderMutation(), ":path"); ok {
+				t.Error("re-entered request rewritten again")
+			}
+			if !common.GetClearRouteCache() {
+				t.Error("route cache not cleared: Envoy keeps the route it picked without the cluster")
+			}
+			decision := resp.GetDynamicMetadata().GetFields()[routes.RoutingMetadataNamespace].GetStructValue()
+			if got := decision.GetFields()[routes.RoutingMetadataCluster].GetStringValue(); got != want {
+				t.Errorf("routing metadata cluster = %q, want %q", got, want)
+			}
+		})
+	}
+
+	// A request the first run let through unrouted re-enters unrouted.
+	unrouted := NewProcessor(staticRouteFinder{}, zap.NewNop(), false)
+	unrouted.SetReentryGuard([]byte("shared-key"), "default")
+	_, mutation = processSpoofed(t, unrouted, &corev3.HeaderValue{Key: "x-request-id", Value: "req-2"})
+	marker, _, _ = setHeader(mutation, ProcessedHeader)
+	_, mutation = processSpoofed(t, unrouted,
+		&corev3.HeaderValue{Key: "x-request-id", Value: "req-2"},
+		&corev3.HeaderValue{Key: ProcessedHeader, Value: marker})
+	if _, _, ok := setHeader(mutation, "x-customrouter-cluster"); ok {
+		t.Error("unrouted request routed on re-entry")
+	}
+}
+
+func TestProcessRequest_ClearRouteCache(t *testing.T) {
+	route := &routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080"}
+	for _, finder := range []staticRouteFinder{{route: route}, {}} {
+		p := NewProcessor(finder, zap.NewNop(), false)
+		common, _ := processSpoofed(t, p)
+		if !common.GetClearRouteCache() {
+			t.Errorf("matched %v: route cache not cleared by default", finder.route != nil)
+		}
+
+		p.SetClearRouteCache(false)
+		common, mutation := processSpoofed(t, p)
+		if common.GetClearRouteCache() {
+			t.Errorf("matched %v: route cache cleared with SetClearRouteCache(false)", finder.route != nil)
+		}
+		if len(mutation.GetRemoveHeaders()) == 0 {
+			t.Errorf("matched %v: spoofed headers no longer removed", finder.route != nil)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// maxLoggedHostDiffs is the most hosts listed in the reload log line; the
+// counts of the line cover every host.
+const maxLoggedHostDiffs = 20
+
+// logRouteReload logs and counts what a reload of the routes from source
+// changed, from the routes of from to those of to. Reloads that changed no
+// route, such as resyncs, are only logged at debug level.
+func logRouteReload(logger *zap.Logger, source string, from, to *routes.RoutesConfig, status routes.LoadStatus) {
+	diff := routes.DiffRoutesConfigs(from, to)
+	if diff.Empty() {
+		routeReloadsTotal.WithLabelValues("unchanged").Inc()
+		logger.Debug("routes configuration reloaded from "+source+", no route changed",
+			zap.Int("hosts", status.Hosts),
+		)
+		return
+	}
+	routeReloadsTotal.WithLabelValues("changed").Inc()
+
+	summary := diff.Summary()
+	routeTableChangesTotal.WithLabelValues("host", "added").Add(float64(summary.HostsAdded))
+	routeTableChangesTotal.WithLabelValues("host", "removed").Add(float64(summary.HostsRemoved))
+	routeTableChangesTotal.WithLabelValues("host", "changed").Add(float64(summary.HostsChanged))
+	routeTableChangesTotal.WithLabelValues("route", "added").Add(float64(summary.RoutesAdded))
+	routeTableChangesTotal.WithLabelValues("route", "removed").Add(float64(summary.RoutesRemoved))
+	routeTableChangesTotal.WithLabelValues("route", "changed").Add(float64(summary.RoutesChanged))
+
+	logger.Info("routes configuration reloaded from "+source,
+		zap.Int("hosts", status.Hosts),
+		zap.Int("routes", status.Routes),
+		zap.String("config_hash", status.ConfigHash),
+		zap.Int("hosts_added", summary.HostsAdded),
+		zap.Int("hosts_removed", summary.HostsRemoved),
+		zap.Int("hosts_changed", summary.HostsChanged),
+		zap.Int("routes_added", summary.RoutesAdded),
+		zap.Int("routes_removed", summary.RoutesRemoved),
+		zap.Int("routes_changed", summary.RoutesChanged),
+		zap.Strings("host_changes", hostChanges(diff)),
+	)
+}
+
+// hostChanges describes the changes of the first maxLoggedHostDiffs hosts of
+// diff, e.g. "example.com changed: +1 -0 ~2" for one route added and two
+// changed, and how many more hosts changed.
+func hostChanges(diff routes.RoutesDiff) []string {
+	hosts := diff.Hosts
+	if len(hosts) > maxLoggedHostDiffs {
+		hosts = hosts[:maxLoggedHostDiffs]
+	}
+	changes := make([]string, 0, len(hosts)+1)
+	for _, hd := range hosts {
+		added, removed, changed := hd.Counts()
+		change := fmt.Sprintf("%s %s: +%d -%d ~%d", hd.Host, hd.Status, added, removed, changed)
+		if hd.Reordered {
+			change += " reordered"
+		}
+		changes = append(changes, change)
+	}
+	if omitted := len(diff.Hosts) - len(hosts); omitted > 0 {
+		changes = append(changes, fmt.Sprintf("%d more hosts", omitted))
+	}
+	return changes
+}
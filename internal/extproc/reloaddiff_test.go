@@ -0,0 +1,97 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestLogRouteReload(t *testing.T) {
+	api := routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:80"}
+	apiV2 := routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api-v2.default.svc.cluster.local:80"}
+	docs := routes.Route{Path: "/docs", Type: routes.RouteTypeExact, Backend: "docs.default.svc.cluster.local:80"}
+	from := &routes.RoutesConfig{Hosts: map[string][]routes.Route{"a.com": {api}, "b.com": {docs}}}
+	to := &routes.RoutesConfig{Hosts: map[string][]routes.Route{"a.com": {apiV2, docs}, "c.com": {api}}}
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core)
+	changed := testutil.ToFloat64(routeReloadsTotal.WithLabelValues("changed"))
+	unchanged := testutil.ToFloat64(routeReloadsTotal.WithLabelValues("unchanged"))
+	routesAdded := testutil.ToFloat64(routeTableChangesTotal.WithLabelValues("route", "added"))
+	routesChanged := testutil.ToFloat64(routeTableChangesTotal.WithLabelValues("route", "changed"))
+
+	logRouteReload(logger, "ConfigMaps", from, to, routes.LoadStatus{Hosts: 2, Routes: 3, ConfigHash: "abc"})
+	logRouteReload(logger, "ConfigMaps", to, to, routes.LoadStatus{Hosts: 2, Routes: 3, ConfigHash: "abc"})
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("logged %d lines, want 2: %v", len(entries), entries)
+	}
+	if entries[0].Level != zapcore.InfoLevel || entries[1].Level != zapcore.DebugLevel {
+		t.Errorf("levels = %v, %v; want info for the change and debug for the no-op reload", entries[0].Level, entries[1].Level)
+	}
+	fields := entries[0].ContextMap()
+	for key, want := range map[string]int64{
+		"hosts_added": 1, "hosts_removed": 1, "hosts_changed": 1,
+		"routes_added": 2, "routes_removed": 1, "routes_changed": 1,
+	} {
+		if fields[key] != want {
+			t.Errorf("%s = %v, want %d", key, fields[key], want)
+		}
+	}
+	wantChanges := []any{"a.com changed: +1 -0 ~1", "b.com removed: +0 -1 ~0", "c.com added: +1 -0 ~0"}
+	if !reflect.DeepEqual(fields["host_changes"], wantChanges) {
+		t.Errorf("host_changes = %v, want %v", fields["host_changes"], wantChanges)
+	}
+
+	if got := testutil.ToFloat64(routeReloadsTotal.WithLabelValues("changed")) - changed; got != 1 {
+		t.Errorf("route_table_reloads_total{result=changed} grew by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(routeReloadsTotal.WithLabelValues("unchanged")) - unchanged; got != 1 {
+		t.Errorf("route_table_reloads_total{result=unchanged} grew by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(routeTableChangesTotal.WithLabelValues("route", "added")) - routesAdded; got != 2 {
+		t.Errorf("route_table_changes_total{object=route,change=added} grew by %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(routeTableChangesTotal.WithLabelValues("route", "changed")) - routesChanged; got != 1 {
+		t.Errorf("route_table_changes_total{object=route,change=changed} grew by %v, want 1", got)
+	}
+}
+
+func TestHostChangesTruncated(t *testing.T) {
+	to := &routes.RoutesConfig{Hosts: map[string][]routes.Route{}}
+	for i := range maxLoggedHostDiffs + 5 {
+		to.Hosts[fmt.Sprintf("host-%02d.com", i)] = []routes.Route{{Path: "/", Type: routes.RouteTypePrefix}}
+	}
+
+	changes := hostChanges(routes.DiffRoutesConfigs(nil, to))
+	if len(changes) != maxLoggedHostDiffs+1 {
+		t.Fatalf("got %d changes, want %d hosts and the count of the rest", len(changes), maxLoggedHostDiffs)
+	}
+	if last := changes[len(changes)-1]; last != "5 more hosts" {
+		t.Errorf("last change = %q, want %q", last, "5 more hosts")
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"sort"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+)
+
+// reservedHeaderPrefix is the prefix of the request headers the extproc
+// owns. A client sending one of them must not get a say in routing: the
+// dynamic route forwards on x-customrouter-cluster and upstreams may trust
+// the decision headers, so the values a client sent are stripped from every
+// request the extproc lets through.
+const reservedHeaderPrefix = "x-customrouter-"
+
+// routingHeaderNames are the reserved headers the extproc sets to carry its
+// routing decision. Stripping one a client sent is counted in
+// reserved_headers_stripped_total; other reserved headers, such as the
+// debug header, are request inputs and are stripped silently once read.
+var routingHeaderNames = map[string]bool{
+	"x-customrouter-cluster":      true,
+	"x-original-authority":        true,
+	"x-customrouter-matched-path": true,
+	"x-customrouter-matched-type": true,
+	degradedHeader:                true,
+	ConfigHashHeader:              true,
+	ProcessedHeader:               true,
+}
+
+// isReservedHeader reports whether the lowercase request header name is one
+// the extproc owns.
+func isReservedHeader(name string) bool {
+	return strings.HasPrefix(name, reservedHeaderPrefix) || routingHeaderNames[name]
+}
+
+// sanitizeRequestHeaders hardens the request resp lets through against
+// headers the client made up. It removes the reserved headers the client
+// sent, except those resp sets itself, and overwrites a host header that
+// differs from :authority, which the request was routed on, so upstreams
+// reading Host see the hostname that was matched. Responses answering the
+// request right away are left alone.
+func (p *Processor) sanitizeRequestHeaders(resp *extprocv3.ProcessingResponse, headers *extprocv3.HttpHeaders, reqCtx *requestContext) {
+	common := resp.GetRequestHeaders().GetResponse()
+	if common == nil || reqCtx == nil {
+		return
+	}
+	if common.HeaderMutation == nil {
+		common.HeaderMutation = &extprocv3.HeaderMutation{}
+	}
+	mutation := common.HeaderMutation
+
+	handled := make(map[string]bool, len(mutation.SetHeaders)+len(mutation.RemoveHeaders))
+	var authority string
+	for _, h := range mutation.SetHeaders {
+		key := strings.ToLower(h.GetHeader().GetKey())
+		handled[key] = true
+		if key == ":authority" {
+			authority = string(h.GetHeader().GetRawValue())
+		}
+	}
+	for _, name := range mutation.RemoveHeaders {
+		handled[strings.ToLower(name)] = true
+	}
+
+	var host string
+	var stripped []string
+	for _, h := range headers.GetHeaders().GetHeaders() {
+		name := strings.ToLower(h.Key)
+		if name == "host" {
+			host = h.Value
+			if host == "" {
+				host = string(h.RawValue)
+			}
+			continue
+		}
+		if !isReservedHeader(name) || handled[name] {
+			continue
+		}
+		handled[name] = true
+		stripped = append(stripped, name)
+		if routingHeaderNames[name] {
+			reservedHeadersStrippedTotal.WithLabelValues(name).Inc()
+		}
+	}
+	sort.Strings(stripped)
+	mutation.RemoveHeaders = append(mutation.RemoveHeaders, stripped...)
+	if len(stripped) > 0 {
+		// Envoy may have picked the dynamic route from a spoofed
+		// x-customrouter-cluster before the processor ran.
+		common.ClearRouteCache = true
+	}
+
+	if authority == "" {
+		authority = reqCtx.authority
+	}
+	mismatch := host != "" && authority != "" && !handled["host"] && !strings.EqualFold(host, authority)
+	if mismatch {
+		hostAuthorityMismatchTotal.Inc()
+		mutation.SetHeaders = append(mutation.SetHeaders, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{
+				Key:      "host",
+				RawValue: []byte(authority),
+			},
+			AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		})
+	}
+	if len(stripped) > 0 || mismatch {
+		p.logger.Debug("sanitized request headers",
+			zap.Strings("stripped", stripped),
+			zap.String("host", host),
+			zap.String("authority", authority),
+		)
+	}
+}
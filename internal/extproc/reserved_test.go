@@ -0,0 +1,160 @@
+package extproc
+
+import (
+	"slices"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// processSpoofed sends request headers carrying made-up routing headers
+// through p and returns the header mutation of the response.
+func processSpoofed(t *testing.T, p *Processor, extra ...*corev3.HeaderValue) (*extprocv3.CommonResponse, *extprocv3.HeaderMutation) {
+	t.Helper()
+	headers := append([]*corev3.HeaderValue{
+		{Key: ":authority", Value: "example.com"},
+		{Key: ":path", Value: "/api/items"},
+		{Key: ":method", Value: "GET"},
+		{Key: "x-customrouter-cluster", Value: "outbound|443||payments.internal.svc.cluster.local"},
+		{Key: "X-Customrouter-Matched-Path", Value: "/admin"},
+		{Key: "x-customrouter-anything", Value: "1"},
+		{Key: "x-original-authority", Value: "admin.example.com"},
+	}, extra...)
+	resp, _, err := p.processRequest(&extprocv3.ProcessingRequest{
+		Request: &extprocv3.ProcessingRequest_RequestHeaders{
+			RequestHeaders: &extprocv3.HttpHeaders{Headers: &corev3.HeaderMap{Headers: headers}},
+		},
+	}, &streamContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	common := resp.GetRequestHeaders().GetResponse()
+	if common == nil {
+		t.Fatalf("expected the request to be let through, got %v", resp)
+	}
+	return common, common.GetHeaderMutation()
+}
+
+// setHeader returns the value and append action mutation sets key with.
+func setHeader(mutation *extprocv3.HeaderMutation, key string) (string, corev3.HeaderValueOption_HeaderAppendAction, bool) {
+	for _, h := range mutation.GetSetHeaders() {
+		if h.GetHeader().GetKey() == key {
+			return string(h.GetHeader().GetRawValue()), h.GetAppendAction(), true
+		}
+	}
+	return "", 0, false
+}
+
+func TestProcessRequest_SpoofedHeadersMatched(t *testing.T) {
+	route := &routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080"}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+	p.SetDecisionHeaders(routes.DecisionHeadersNever, "", "")
+
+	common, mutation := processSpoofed(t, p)
+
+	cluster, action, ok := setHeader(mutation, "x-customrouter-cluster")
+	if !ok || cluster != "outbound|8080||api.default.svc.cluster.local" {
+		t.Errorf("x-customrouter-cluster = %q, want the matched backend's cluster", cluster)
+	}
+	if action != corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD {
+		t.Errorf("x-customrouter-cluster append action = %v, want the client's value overwritten", action)
+	}
+	if slices.Contains(mutation.GetRemoveHeaders(), "x-customrouter-cluster") {
+		t.Error("x-customrouter-cluster both set and removed")
+	}
+	for _, name := range []string{"x-customrouter-matched-path", "x-customrouter-anything", "x-original-authority"} {
+		if !slices.Contains(mutation.GetRemoveHeaders(), name) {
+			t.Errorf("spoofed %s not removed, removed %v", name, mutation.GetRemoveHeaders())
+		}
+	}
+	if !common.GetClearRouteCache() {
+		t.Error("route cache not cleared")
+	}
+}
+
+func TestProcessRequest_SpoofedHeadersUnmatched(t *testing.T) {
+	p := NewProcessor(staticRouteFinder{}, zap.NewNop(), false)
+
+	common, mutation := processSpoofed(t, p)
+
+	if _, _, ok := setHeader(mutation, "x-customrouter-cluster"); ok {
+		t.Error("x-customrouter-cluster set on an unmatched request")
+	}
+	for _, name := range []string{"x-customrouter-cluster", "x-customrouter-matched-path", "x-customrouter-anything", "x-original-authority"} {
+		if !slices.Contains(mutation.GetRemoveHeaders(), name) {
+			t.Errorf("spoofed %s not removed, removed %v", name, mutation.GetRemoveHeaders())
+		}
+	}
+	if !common.GetClearRouteCache() {
+		t.Error("route cache not cleared: Envoy could keep the route picked from the spoofed cluster")
+	}
+}
+
+func TestProcessRequest_SpoofedDebugHeaderIsRead(t *testing.T) {
+	route := &routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080"}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+	p.SetDecisionHeaders(routes.DecisionHeadersOnDebug, "", "")
+
+	_, mutation := processSpoofed(t, p, &corev3.HeaderValue{Key: DefaultDebugHeader, Value: "1"})
+
+	if path, _, _ := setHeader(mutation, "x-customrouter-matched-path"); path != "/api" {
+		t.Errorf("x-customrouter-matched-path = %q, want the matched route's path", path)
+	}
+	if !slices.Contains(mutation.GetRemoveHeaders(), DefaultDebugHeader) {
+		t.Errorf("%s not removed once read, removed %v", DefaultDebugHeader, mutation.GetRemoveHeaders())
+	}
+}
+
+func TestProcessRequest_HostAuthorityMismatch(t *testing.T) {
+	plain := &routes.Route{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080"}
+	rewritten := &routes.Route{
+		Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080",
+		Actions: []routes.RouteAction{{Type: routes.ActionTypeRewrite, RewriteHostname: "internal.example.com"}},
+	}
+
+	tests := []struct {
+		name     string
+		route    *routes.Route
+		host     string
+		wantHost string
+	}{
+		{name: "no host header", route: plain},
+		{name: "host matches authority", route: plain, host: "Example.com"},
+		{name: "host differs", route: plain, host: "admin.example.com", wantHost: "example.com"},
+		{name: "host differs on unmatched request", host: "admin.example.com", wantHost: "example.com"},
+		{name: "host differs on rewritten authority", route: rewritten, host: "admin.example.com", wantHost: "internal.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(staticRouteFinder{route: tt.route}, zap.NewNop(), false)
+			var extra []*corev3.HeaderValue
+			if tt.host != "" {
+				extra = append(extra, &corev3.HeaderValue{Key: "host", Value: tt.host})
+			}
+
+			_, mutation := processSpoofed(t, p, extra...)
+
+			host, action, ok := setHeader(mutation, "host")
+			if host != tt.wantHost {
+				t.Errorf("host set to %q, want %q", host, tt.wantHost)
+			}
+			if ok && action != corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD {
+				t.Errorf("host append action = %v, want the client's value overwritten", action)
+			}
+			hosts := 0
+			for _, h := range mutation.GetSetHeaders() {
+				if h.GetHeader().GetKey() == "host" {
+					hosts++
+				}
+			}
+			if hosts > 1 {
+				t.Errorf("host set %d times", hosts)
+			}
+		})
+	}
+}
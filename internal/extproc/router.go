@@ -18,57 +18,45 @@ package extproc
 
 import (
 	"fmt"
-	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/freepik-company/customrouter/pkg/matcher"
 	"github.com/freepik-company/customrouter/pkg/routes"
 	"go.uber.org/zap"
 )
 
-// requestVars holds extracted values for variable substitution
-type requestVars struct {
-	clientIP     string
-	requestID    string
-	host         string
-	path         string
-	method       string
-	scheme       string
-	pathSegments []string
-}
-
 // processRequestHeaders handles incoming request headers and determines routing
 func (p *Processor) processRequestHeaders(headers *extprocv3.HttpHeaders, streamCtx *streamContext) (*extprocv3.ProcessingResponse, *requestContext, error) {
 	reqCtx := &requestContext{
-		startTime: time.Now(),
+		startTime:     time.Now(),
+		clusterNaming: p.resolveClusterNaming(streamCtx),
 	}
-	vars := &requestVars{}
+	logger := p.loggerFor(streamCtx)
 	// Headers lowercased for case-insensitive matching by RouteHeaderMatch.
 	requestHeaders := map[string]string{}
-	// Query params are case-sensitive (RFC 3986).
-	requestQueryParams := map[string]string{}
+	var rawPath, scheme string
 
 	// Debug: log complete headers structure
-	p.logger.Debug("processRequestHeaders called",
+	logger.Debug("processRequestHeaders called",
 		zap.Bool("headers_nil", headers == nil),
 	)
 
 	if headers != nil {
-		p.logger.Debug("HttpHeaders structure",
+		logger.Debug("HttpHeaders structure",
 			zap.Bool("headers.Headers_nil", headers.Headers == nil),
 			zap.String("end_of_stream", fmt.Sprintf("%v", headers.EndOfStream)),
 		)
 
 		if headers.Headers != nil {
-			p.logger.Debug("HeaderMap info",
+			logger.Debug("HeaderMap info",
 				zap.Int("header_count", len(headers.Headers.Headers)),
 			)
 			for i, h := range headers.Headers.Headers {
-				p.logger.Debug("header entry",
+				logger.Debug("header entry",
 					zap.Int("index", i),
 					zap.String("key", h.Key),
 					zap.String("value", h.Value),
@@ -94,67 +82,168 @@ func (p *Processor) processRequestHeaders(headers *extprocv3.HttpHeaders, stream
 			switch h.Key {
 			case ":authority":
 				reqCtx.authority = value
-				vars.host = value
 			case ":path":
-				reqCtx.path = stripQueryString(value)
-				vars.path = value
-				vars.pathSegments = splitPath(value)
-				requestQueryParams = extractQueryParams(value)
+				reqCtx.path = matcher.StripQueryString(value)
+				rawPath = value
 			case ":method":
 				reqCtx.method = value
-				vars.method = value
 			case ":scheme":
-				vars.scheme = value
-			case "x-forwarded-for":
-				vars.clientIP = extractFirstIP(value)
-			case "x-request-id":
-				vars.requestID = value
-			case "x-forwarded-proto":
-				if vars.scheme == "" {
-					vars.scheme = value
-				}
+				scheme = value
 			}
 		}
 	}
 
-	// Default scheme to https if not set
-	if vars.scheme == "" {
-		vars.scheme = "https"
+	// Match the normalized path, so that variants of a path such as //api
+	// or /%61pi cannot bypass the routes written for /api.
+	if !p.normalizeRequestPath(reqCtx, &rawPath, streamCtx) {
+		logger.Debug("request path rejected by path normalization",
+			zap.String("host", reqCtx.authority),
+			zap.String("path", reqCtx.path),
+		)
+		return buildRejectedPathResponse(), reqCtx, nil
 	}
 
-	p.logger.Debug("extracted values",
+	reqCtx.configHash = p.currentConfigHash()
+	reqCtx.emitConfigHash = p.configHashHeader && p.debugRequested(requestHeaders)
+
+	// While overloaded, requests are either let through unrouted or matched
+	// against the cheap routes only, instead of queueing up until Envoy
+	// times them out.
+	overloadAction, exitOverload := p.enterOverload()
+	defer exitOverload()
+	if overloadAction == OverloadActionFailOpen && p.hasGuardedRoutes(reqCtx.authority) {
+		// Failing open would skip the auth or maintenance of a route.
+		overloadAction = ""
+	}
+	if overloadAction == OverloadActionFailOpen {
+		logger.Debug("request let through unrouted, extproc overloaded",
+			zap.String("host", reqCtx.authority),
+			zap.String("path", reqCtx.path),
+		)
+		resp := p.buildPassthroughResponse()
+		addDegradedHeader(resp, overloadAction)
+		return resp, reqCtx, nil
+	}
+
+	// The variable context ${...} placeholders of actions expand to.
+	vars := matcher.NewVars(matcher.Request{
+		Authority: reqCtx.authority,
+		Path:      rawPath,
+		Method:    reqCtx.method,
+		Scheme:    scheme,
+		Headers:   requestHeaders,
+	})
+
+	logger.Debug("extracted values",
 		zap.String("authority", reqCtx.authority),
 		zap.String("path", reqCtx.path),
 		zap.String("method", reqCtx.method),
-		zap.String("scheme", vars.scheme),
-		zap.String("client_ip", vars.clientIP),
-		zap.String("request_id", vars.requestID),
+		zap.String("scheme", vars.Scheme),
+		zap.String("client_ip", vars.ClientIP),
+		zap.String("request_id", vars.RequestID),
 	)
 
+	// A request asking for a decision trace gets its routing decision
+	// logged in full, without raising the log level of every request.
+	var trace *decisionTrace
+	if p.traceRequested(reqCtx.authority, requestHeaders) {
+		trace = &decisionTrace{host: reqCtx.authority, path: reqCtx.path, method: reqCtx.method}
+	}
+
+	// The route table variant the request selects; routes without a variant
+	// serve it when the host has none of that variant.
+	variant := p.resolveVariantSelector(streamCtx).Select(requestHeaders)
+	if trace != nil {
+		trace.variant = variant
+	}
+
 	// Find matching route
-	route := p.routeFinder.FindRoute(reqCtx.authority, routes.RequestMatch{
+	lookupStart := time.Now()
+	match := routes.RequestMatch{
 		Path:        reqCtx.path,
 		Method:      reqCtx.method,
+		Scheme:      vars.Scheme,
 		Headers:     requestHeaders,
-		QueryParams: requestQueryParams,
-	})
+		QueryParams: vars.QueryParams,
+		SkipRegex:   overloadAction == OverloadActionShedRegex,
+		Variant:     variant,
+	}
+	route := p.findRoute(reqCtx.authority, match, trace)
+	p.observeLookup(lookupStart)
+	// A hostname's fallback route only carries its unmatched request policy:
+	// reaching it means no real route matched.
+	var fallback *routes.Route
+	if route != nil && route.UnmatchedPolicy != "" {
+		fallback, route = route, nil
+	}
 	if route == nil {
-		p.logger.Debug("no matching route found",
+		policy := p.resolveUnmatchedPolicy(fallback, streamCtx)
+		logger.Debug("no matching route found",
 			zap.String("host", reqCtx.authority),
 			zap.String("path", reqCtx.path),
+			zap.String("policy", policy),
 		)
 		reqCtx.routeFound = false
-		return &extprocv3.ProcessingResponse{
-			Response: &extprocv3.ProcessingResponse_RequestHeaders{
-				RequestHeaders: &extprocv3.HeadersResponse{
-					Response: &extprocv3.CommonResponse{
-						HeaderMutation: &extprocv3.HeaderMutation{
-							RemoveHeaders: []string{"x-customrouter-cluster"},
-						},
-					},
-				},
-			},
-		}, reqCtx, nil
+		trace.log(p.logger, traceOutcomeUnmatched, nil, zap.String("policy", policy))
+		p.diagnoseMiss(logger, reqCtx, match)
+		// A re-entered request was rewritten by its first run, possibly to
+		// a path no route matches.
+		if streamCtx.reentered {
+			return buildReentryResponse(streamCtx.reentryCluster), reqCtx, nil
+		}
+		if status := unmatchedStatus(policy); status != 0 {
+			return buildUnmatchedResponse(status), reqCtx, nil
+		}
+		resp := p.buildPassthroughResponse()
+		addDegradedHeader(resp, overloadAction)
+		return resp, reqCtx, nil
+	}
+
+	// A maintenance route only matches while its maintenance applies to the
+	// request: answer with the maintenance response.
+	if route.Maintenance != nil {
+		reqCtx.routeFound = true
+		reqCtx.matchedPattern = route.Path
+		reqCtx.matchedType = route.Type
+		reqCtx.matchedPriority = route.Priority
+		reqCtx.routeID = route.ID
+		reqCtx.routeSource = route.Source
+		reqCtx.routeRule = route.SourceRule
+		reqCtx.routeOwner = route.Owner
+		reqCtx.routeVariant = route.Variant
+		recordDraining(reqCtx, route)
+		maintenanceResponsesTotal.Inc()
+		logger.Debug("maintenance response",
+			zap.String("host", reqCtx.authority),
+			zap.String("path", reqCtx.path),
+			zap.Int32("status_code", route.Maintenance.StatusCode),
+		)
+		trace.log(p.logger, traceOutcomeMaintenance, route)
+		return buildMaintenanceResponse(route.Maintenance), reqCtx, nil
+	}
+
+	// A request naming a backend variant through the route's override header
+	// is forwarded to that variant instead of the rule's backend.
+	route, reqCtx.overrideVariant = matcher.OverrideRoute(route, requestHeaders)
+	if reqCtx.overrideVariant != "" {
+		logger.Debug("backend overridden by request header",
+			zap.String("header", route.OverrideHeader),
+			zap.String("variant", reqCtx.overrideVariant),
+			zap.String("backend", route.Backend),
+		)
+	}
+
+	// A backend ejected by the route's outlier policy is failed over to the
+	// fallback backend, and an unhealthy one along the route's fallback
+	// chain. Override variants are picked by the client and are never
+	// failed over.
+	trackOutlier := false
+	if reqCtx.overrideVariant == "" {
+		if route.Failover != nil {
+			route, trackOutlier = p.applyBackendFailover(route, logger)
+		} else {
+			route, trackOutlier = p.applyOutlierPolicy(route)
+		}
 	}
 
 	// Populate request context with route match info
@@ -163,6 +252,12 @@ func (p *Processor) processRequestHeaders(headers *extprocv3.HttpHeaders, stream
 	reqCtx.matchedPattern = route.Path
 	reqCtx.matchedType = route.Type
 	reqCtx.matchedPriority = route.Priority
+	reqCtx.routeID = route.ID
+	reqCtx.routeSource = route.Source
+	reqCtx.routeRule = route.SourceRule
+	reqCtx.routeOwner = route.Owner
+	reqCtx.routeVariant = route.Variant
+	recordDraining(reqCtx, route)
 
 	// Stash the matched route and the request-time variable context so
 	// processResponseHeaders can apply response-side header mutations and
@@ -170,7 +265,7 @@ func (p *Processor) processRequestHeaders(headers *extprocv3.HttpHeaders, stream
 	streamCtx.matchedRoute = route
 	streamCtx.vars = vars
 
-	p.logger.Debug("route matched",
+	logger.Debug("route matched",
 		zap.String("originalHost", reqCtx.authority),
 		zap.String("path", reqCtx.path),
 		zap.String("backend", route.Backend),
@@ -180,100 +275,168 @@ func (p *Processor) processRequestHeaders(headers *extprocv3.HttpHeaders, stream
 		zap.Int("action_count", len(route.Actions)),
 	)
 
-	// Check if there's a redirect action - redirects take precedence
-	for _, action := range route.Actions {
-		if action.Type == routes.ActionTypeRedirect {
-			return p.buildRedirectResponse(action, route, vars, reqCtx)
+	// A request over the route's maxRequestBytes is answered with 413 before
+	// it reaches an auth service or the backend.
+	tooLarge, bufferBody := checkRequestSize(route, requestHeaders, headers.GetEndOfStream())
+	if tooLarge {
+		requestsTooLargeTotal.Inc()
+		trace.log(p.logger, traceOutcomeTooLarge, route, zap.Int64("max_request_bytes", route.MaxRequestBytes))
+		return buildRequestTooLargeResponse(), reqCtx, nil
+	}
+
+	// A route not meant for protocol upgrades rejects them before they reach
+	// an auth service or the backend.
+	if status := matcher.UpgradeDenial(route, requestHeaders); status != 0 {
+		upgradeRequestsTotal.WithLabelValues(upgradeActionDenied).Inc()
+		trace.log(p.logger, traceOutcomeUpgradeDenied, route, zap.Int32("status_code", status))
+		return buildUpgradeDeniedResponse(status), reqCtx, nil
+	}
+
+	// require-auth actions run first so a denied request is neither
+	// redirected nor forwarded.
+	auth := p.authorize(streamCtx.context(), route, vars, requestHeaders)
+	if auth.denial != nil {
+		trace.log(p.logger, traceOutcomeDenied, route, zap.String("override_variant", reqCtx.overrideVariant))
+		return auth.denial, reqCtx, nil
+	}
+
+	// A re-entered request was rewritten and routed by its first run.
+	if streamCtx.reentered {
+		resp := buildReentryResponse(streamCtx.reentryCluster)
+		common := resp.GetRequestHeaders().GetResponse()
+		if common.HeaderMutation == nil {
+			common.HeaderMutation = &extprocv3.HeaderMutation{}
 		}
+		common.HeaderMutation.SetHeaders = append(common.HeaderMutation.SetHeaders, auth.setHeaders...)
+		common.HeaderMutation.RemoveHeaders = append(common.HeaderMutation.RemoveHeaders, auth.removeHeaders...)
+		return resp, reqCtx, nil
 	}
 
-	// Build forwarding response with header mutations
-	return p.buildForwardResponse(route, vars, reqCtx)
-}
+	// Check if there's a redirect action - redirects take precedence, unless
+	// the route applies its actions sequentially: then the redirect sees the
+	// request as rewritten by the actions listed before it.
+	if redirect := matcher.EvaluateRedirect(route, vars); redirect != nil {
+		trace.log(p.logger, traceOutcomeRedirect, route, zap.String("override_variant", reqCtx.overrideVariant))
+		return p.buildRedirectResponse(redirect), reqCtx, nil
+	}
 
-// buildRedirectResponse creates an immediate redirect response
-func (p *Processor) buildRedirectResponse(action routes.RouteAction, route *routes.Route, vars *requestVars, reqCtx *requestContext) (*extprocv3.ProcessingResponse, *requestContext, error) {
-	// Build redirect URL components
-	scheme := action.RedirectScheme
-	if scheme == "" {
-		scheme = vars.scheme
-	}
-
-	hostname := action.RedirectHostname
-	if hostname == "" {
-		hostname = stripPort(vars.host)
-	}
-
-	path := substituteVariables(action.RedirectPath, vars)
-	if path == "" {
-		path = vars.path
-	} else if shouldReplacePrefixMatchForRedirect(action, route) {
-		// Strip the matched PathPrefix from the request path and append the
-		// remaining suffix to the redirect path (Gateway API ReplacePrefixMatch).
-		suffix := strings.TrimPrefix(vars.path, route.Path)
-		// Handle trailing-slash route matching path without slash:
-		// e.g. route.Path="/old-api/", vars.path="/old-api"
-		if suffix == vars.path && strings.HasSuffix(route.Path, "/") {
-			suffix = strings.TrimPrefix(vars.path, strings.TrimSuffix(route.Path, "/"))
+	// Build forwarding response with header mutations
+	decisionHeaders := p.emitDecisionHeaders(route, streamCtx, requestHeaders)
+	trace.log(p.logger, traceOutcomeForward, route,
+		zap.String("override_variant", reqCtx.overrideVariant),
+		zap.Bool("decision_headers", decisionHeaders),
+	)
+	resp, reqCtx, err := p.buildForwardResponse(route, vars, reqCtx, decisionHeaders)
+	if err == nil && trackOutlier {
+		trackResponse(resp)
+		streamCtx.trackOutlier = true
+	}
+	if err == nil && stripsUpgrade(route, requestHeaders) {
+		upgradeRequestsTotal.WithLabelValues(upgradeActionStripped).Inc()
+	}
+	if err == nil && bufferBody {
+		bufferRequestBody(resp)
+		streamCtx.maxRequestBytes = route.MaxRequestBytes
+	}
+	if err == nil {
+		addDegradedHeader(resp, overloadAction)
+		removeHeaders := append(auth.removeHeaders, p.traceRemoveHeaders()...)
+		if len(auth.setHeaders) > 0 || len(removeHeaders) > 0 {
+			mutation := resp.GetRequestHeaders().GetResponse().GetHeaderMutation()
+			mutation.SetHeaders = append(mutation.SetHeaders, auth.setHeaders...)
+			mutation.RemoveHeaders = append(mutation.RemoveHeaders, removeHeaders...)
 		}
-		path = joinRedirectPath(path, suffix)
 	}
+	return resp, reqCtx, err
+}
 
-	// Build port string
-	portStr := ""
-	if action.RedirectPort > 0 {
-		// Only include port if non-standard
-		if (scheme != "http" || action.RedirectPort != 80) &&
-			(scheme != "https" || action.RedirectPort != 443) {
-			portStr = ":" + strconv.Itoa(int(action.RedirectPort))
-		}
+// buildPassthroughResponse lets a request continue unrouted, to the Envoy
+// route it would have taken without the processor.
+func (p *Processor) buildPassthroughResponse() *extprocv3.ProcessingResponse {
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_RequestHeaders{
+			RequestHeaders: &extprocv3.HeadersResponse{
+				Response: &extprocv3.CommonResponse{
+					HeaderMutation: &extprocv3.HeaderMutation{
+						RemoveHeaders: append([]string{"x-customrouter-cluster"}, p.traceRemoveHeaders()...),
+					},
+					// Envoy may have picked the route before the processor
+					// ran, from an x-customrouter-cluster header the client
+					// sent: clear it so the dynamic route stops matching.
+					ClearRouteCache: true,
+				},
+			},
+		},
 	}
+}
 
-	// Build full redirect URL
-	redirectURL := scheme + "://" + hostname + portStr + path
+// SetRedirectAltSvc sets the Alt-Svc header of the redirect responses whose
+// action sets none. Redirects are immediate responses, which skip the
+// response headers Envoy adds to routed responses, so without it a client
+// that learned about HTTP/3 from the gateway's Alt-Svc is not told again
+// when it follows the redirect. Empty sends none.
+func (p *Processor) SetRedirectAltSvc(altSvc string) {
+	p.redirectAltSvc = altSvc
+}
 
-	statusCode := action.RedirectStatusCode
-	if statusCode == 0 {
-		statusCode = 302
+// buildRedirectResponse creates an immediate redirect response.
+func (p *Processor) buildRedirectResponse(redirect *matcher.Redirect) *extprocv3.ProcessingResponse {
+	altSvc := redirect.AltSvc
+	if altSvc == "" {
+		altSvc = p.redirectAltSvc
 	}
 
 	p.logger.Debug("sending redirect response",
-		zap.String("location", redirectURL),
-		zap.Int32("status_code", statusCode),
+		zap.String("location", redirect.Location),
+		zap.Int32("status_code", redirect.StatusCode),
+		zap.String("alt_svc", altSvc),
 	)
 
-	resp := &extprocv3.ProcessingResponse{
+	setHeaders := []*corev3.HeaderValueOption{
+		{
+			Header: &corev3.HeaderValue{
+				Key:      "location",
+				RawValue: []byte(redirect.Location),
+			},
+		},
+	}
+	if altSvc != "" {
+		setHeaders = append(setHeaders, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{
+				Key:      "alt-svc",
+				RawValue: []byte(altSvc),
+			},
+		})
+	}
+
+	return &extprocv3.ProcessingResponse{
 		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
 			ImmediateResponse: &extprocv3.ImmediateResponse{
 				Status: &typev3.HttpStatus{
-					Code: typev3.StatusCode(statusCode),
+					Code: typev3.StatusCode(redirect.StatusCode),
 				},
 				Headers: &extprocv3.HeaderMutation{
-					SetHeaders: []*corev3.HeaderValueOption{
-						{
-							Header: &corev3.HeaderValue{
-								Key:      "location",
-								RawValue: []byte(redirectURL),
-							},
-						},
-					},
+					SetHeaders: setHeaders,
 				},
 			},
 		},
 	}
-
-	return resp, reqCtx, nil
 }
 
-// buildForwardResponse creates a response that forwards to the backend with modifications
-func (p *Processor) buildForwardResponse(route *routes.Route, vars *requestVars, reqCtx *requestContext) (*extprocv3.ProcessingResponse, *requestContext, error) {
-	// Determine final authority (may be rewritten)
+// buildForwardResponse creates a response that forwards to the backend with modifications.
+// decisionHeaders adds the headers describing the routing decision; when false
+// they are removed from the request instead.
+func (p *Processor) buildForwardResponse(route *routes.Route, vars *matcher.Vars, reqCtx *requestContext, decisionHeaders bool) (*extprocv3.ProcessingResponse, *requestContext, error) {
+	// Apply the route's rewrite and header actions
+	fwd := matcher.ApplyActions(route, vars)
 	finalAuthority := route.Backend
-	finalPath := vars.path
+	if fwd.Authority != "" {
+		finalAuthority = fwd.Authority
+	}
+	finalPath := fwd.Path
 
 	// Build base headers
-	host, port := route.ParseBackend()
-	clusterName := fmt.Sprintf("outbound|%s||%s", port, host)
+	clusterName := reqCtx.clusterNaming.ClusterName(route.Backend)
 
 	setHeaders := []*corev3.HeaderValueOption{
 		{
@@ -281,101 +444,43 @@ func (p *Processor) buildForwardResponse(route *routes.Route, vars *requestVars,
 				Key:      "x-customrouter-cluster",
 				RawValue: []byte(clusterName),
 			},
-		},
-		{
-			Header: &corev3.HeaderValue{
-				Key:      "x-original-authority",
-				RawValue: []byte(reqCtx.authority),
-			},
-		},
-		{
-			Header: &corev3.HeaderValue{
-				Key:      "x-customrouter-matched-path",
-				RawValue: []byte(route.Path),
-			},
-		},
-		{
-			Header: &corev3.HeaderValue{
-				Key:      "x-customrouter-matched-type",
-				RawValue: []byte(route.Type),
-			},
+			AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
 		},
 	}
 
 	var removeHeaders []string
 
-	// Apply actions from the route
-	for _, action := range route.Actions {
-		switch action.Type {
-		case routes.ActionTypeRewrite:
-			if action.RewritePath != "" {
-				rewrittenBase := substituteVariables(action.RewritePath, vars)
-				if shouldReplacePrefixMatch(action, route, rewrittenBase) {
-					suffix := strings.TrimPrefix(vars.path, route.Path)
-					// Handle trailing-slash route matching path without slash:
-					// e.g. route.Path="/audio/download/", vars.path="/audio/download"
-					if suffix == vars.path && strings.HasSuffix(route.Path, "/") {
-						suffix = strings.TrimPrefix(vars.path, strings.TrimSuffix(route.Path, "/"))
-					}
-					finalPath = rewrittenBase + suffix
-				} else {
-					finalPath = rewrittenBase
-				}
-				p.logger.Debug("rewriting path",
-					zap.String("original", vars.path),
-					zap.String("rewritten", finalPath),
-				)
-			}
-			if action.RewriteHostname != "" {
-				finalAuthority = action.RewriteHostname
-				p.logger.Debug("rewriting hostname",
-					zap.String("original", route.Backend),
-					zap.String("rewritten", finalAuthority),
-				)
-			}
-
-		case routes.ActionTypeHeaderSet:
-			if action.HeaderName != "" {
-				value := substituteVariables(action.Value, vars)
-				setHeaders = append(setHeaders, &corev3.HeaderValueOption{
-					Header: &corev3.HeaderValue{
-						Key:      action.HeaderName,
-						RawValue: []byte(value),
-					},
-					AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
-				})
-				p.logger.Debug("setting header",
-					zap.String("name", action.HeaderName),
-					zap.String("value", value),
-				)
-			}
-
-		case routes.ActionTypeHeaderAdd:
-			if action.HeaderName != "" {
-				value := substituteVariables(action.Value, vars)
-				setHeaders = append(setHeaders, &corev3.HeaderValueOption{
-					Header: &corev3.HeaderValue{
-						Key:      action.HeaderName,
-						RawValue: []byte(value),
-					},
-					AppendAction: corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD,
-				})
-				p.logger.Debug("adding header",
-					zap.String("name", action.HeaderName),
-					zap.String("value", value),
-				)
-			}
-
-		case routes.ActionTypeHeaderRemove:
-			if action.HeaderName != "" {
-				removeHeaders = append(removeHeaders, action.HeaderName)
-				p.logger.Debug("removing header",
-					zap.String("name", action.HeaderName),
-				)
-			}
-		}
+	if decisionHeaders {
+		setHeaders = append(setHeaders,
+			&corev3.HeaderValueOption{
+				Header: &corev3.HeaderValue{
+					Key:      "x-original-authority",
+					RawValue: []byte(reqCtx.authority),
+				},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			},
+			&corev3.HeaderValueOption{
+				Header: &corev3.HeaderValue{
+					Key:      "x-customrouter-matched-path",
+					RawValue: []byte(route.Path),
+				},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			},
+			&corev3.HeaderValueOption{
+				Header: &corev3.HeaderValue{
+					Key:      "x-customrouter-matched-type",
+					RawValue: []byte(route.Type),
+				},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			},
+		)
+	} else {
+		removeHeaders = append(removeHeaders, decisionHeaderNames...)
 	}
 
+	setHeaders = append(setHeaders, headerValueOptions(fwd.SetHeaders)...)
+	removeHeaders = append(removeHeaders, fwd.RemoveHeaders...)
+
 	// Only rewrite authority/host if explicitly requested via RewriteHostname action
 	// Otherwise, keep the original authority so Istio can match the virtual host correctly
 	if finalAuthority != route.Backend {
@@ -387,24 +492,35 @@ func (p *Processor) buildForwardResponse(route *routes.Route, vars *requestVars,
 				},
 				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
 			},
-			&corev3.HeaderValueOption{
-				Header: &corev3.HeaderValue{
-					Key:      "host",
-					RawValue: []byte(finalAuthority),
-				},
-				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
-			},
 		)
+		// gRPC carries the authority only in :authority; a separate Host
+		// header is not part of the protocol.
+		if !route.GRPC {
+			setHeaders = append(setHeaders,
+				&corev3.HeaderValueOption{
+					Header: &corev3.HeaderValue{
+						Key:      "host",
+						RawValue: []byte(finalAuthority),
+					},
+					AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+				},
+			)
+		}
 	}
 
-	// Add path rewrite if path was changed
-	if finalPath != vars.path {
+	// Add path rewrite if path was changed. A normalized path is forwarded
+	// normalized, so the backend serves the path that was matched.
+	originalPath := vars.Path
+	if reqCtx.originalPath != "" {
+		originalPath = reqCtx.originalPath
+	}
+	if finalPath != originalPath {
 		// Preserve the original path so Istio/Envoy access logs can show it.
 		// The default log format reads %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%.
 		setHeaders = append(setHeaders, &corev3.HeaderValueOption{
 			Header: &corev3.HeaderValue{
 				Key:      "x-envoy-original-path",
-				RawValue: []byte(vars.path),
+				RawValue: []byte(originalPath),
 			},
 			AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
 		})
@@ -429,6 +545,7 @@ func (p *Processor) buildForwardResponse(route *routes.Route, vars *requestVars,
 				},
 			},
 		},
+		DynamicMetadata: routingMetadata(clusterName, route),
 	}
 
 	p.logger.Debug("sending forward response",
@@ -455,39 +572,8 @@ func (p *Processor) processResponseHeaders(streamCtx *streamContext) *extprocv3.
 		}
 	}
 
-	var setHeaders []*corev3.HeaderValueOption
-	var removeHeaders []string
-	for _, action := range streamCtx.matchedRoute.Actions {
-		switch action.Type {
-		case routes.ActionTypeResponseHeaderSet:
-			if action.HeaderName == "" {
-				continue
-			}
-			setHeaders = append(setHeaders, &corev3.HeaderValueOption{
-				Header: &corev3.HeaderValue{
-					Key:      action.HeaderName,
-					RawValue: []byte(substituteVariables(action.Value, streamCtx.vars)),
-				},
-				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
-			})
-		case routes.ActionTypeResponseHeaderAdd:
-			if action.HeaderName == "" {
-				continue
-			}
-			setHeaders = append(setHeaders, &corev3.HeaderValueOption{
-				Header: &corev3.HeaderValue{
-					Key:      action.HeaderName,
-					RawValue: []byte(substituteVariables(action.Value, streamCtx.vars)),
-				},
-				AppendAction: corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD,
-			})
-		case routes.ActionTypeResponseHeaderRemove:
-			if action.HeaderName == "" {
-				continue
-			}
-			removeHeaders = append(removeHeaders, action.HeaderName)
-		}
-	}
+	set, removeHeaders := matcher.ResponseHeaders(streamCtx.matchedRoute, streamCtx.vars)
+	setHeaders := headerValueOptions(set)
 
 	if len(setHeaders) == 0 && len(removeHeaders) == 0 {
 		return &extprocv3.ProcessingResponse{
@@ -497,7 +583,7 @@ func (p *Processor) processResponseHeaders(streamCtx *streamContext) *extprocv3.
 		}
 	}
 
-	p.logger.Debug("applying response header mutations",
+	p.loggerFor(streamCtx).Debug("applying response header mutations",
 		zap.Int("set", len(setHeaders)),
 		zap.Int("remove", len(removeHeaders)),
 	)
@@ -516,151 +602,36 @@ func (p *Processor) processResponseHeaders(streamCtx *streamContext) *extprocv3.
 	}
 }
 
-// extractFirstIP extracts the first IP from a comma-separated list (X-Forwarded-For)
-func extractFirstIP(xff string) string {
-	if xff == "" {
-		return ""
-	}
-	parts := strings.Split(xff, ",")
-	return strings.TrimSpace(parts[0])
-}
-
-// stripPort removes port from host:port string
-func stripPort(host string) string {
-	if idx := strings.LastIndex(host, ":"); idx != -1 {
-		// Check if this is an IPv6 address
-		if strings.Contains(host, "]") {
-			// IPv6 with port: [::1]:8080
-			if bracketIdx := strings.LastIndex(host, "]"); bracketIdx < idx {
-				return host[:idx]
-			}
-		} else if strings.Count(host, ":") == 1 {
-			// IPv4 with port: 127.0.0.1:8080
-			return host[:idx]
+// headerValueOptions converts the headers of actions to Envoy header
+// mutations, appending to or overwriting existing values.
+func headerValueOptions(headers []matcher.Header) []*corev3.HeaderValueOption {
+	if len(headers) == 0 {
+		return nil
+	}
+	options := make([]*corev3.HeaderValueOption, 0, len(headers))
+	for _, h := range headers {
+		appendAction := corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD
+		if h.Append {
+			appendAction = corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD
 		}
+		options = append(options, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{
+				Key:      h.Name,
+				RawValue: []byte(h.Value),
+			},
+			AppendAction: appendAction,
+		})
 	}
-	return host
-}
-
-// stripQueryString extracts the path component from a request target by
-// removing the query string and fragment. Per RFC 3986 §3.3, the path is
-// terminated by the first "?" or "#" character, or by the end of the URI.
-// Route matching should operate exclusively on the path component.
-func stripQueryString(path string) string {
-	if idx := strings.IndexAny(path, "?#"); idx != -1 {
-		return path[:idx]
-	}
-	return path
-}
-
-// extractQueryParams returns a flat map of the first value observed for each
-// query parameter name in the given ":path". Names are case-sensitive per
-// RFC 3986. Returns an empty map when no query string is present.
-// Invalid query strings are parsed on a best-effort basis.
-func extractQueryParams(rawPath string) map[string]string {
-	out := map[string]string{}
-	idx := strings.Index(rawPath, "?")
-	if idx == -1 || idx == len(rawPath)-1 {
-		return out
-	}
-	query := rawPath[idx+1:]
-	if hash := strings.Index(query, "#"); hash != -1 {
-		query = query[:hash]
-	}
-	values, err := url.ParseQuery(query)
-	if err != nil {
-		return out
-	}
-	for k, v := range values {
-		if len(v) > 0 {
-			out[k] = v[0]
-		}
-	}
-	return out
-}
-
-// splitPath splits a path into segments
-func splitPath(path string) []string {
-	// Remove query string and fragment (RFC 3986 §3.3)
-	if idx := strings.IndexAny(path, "?#"); idx != -1 {
-		path = path[:idx]
-	}
-	// Split and filter empty segments
-	parts := strings.Split(path, "/")
-	segments := make([]string, 0, len(parts))
-	for _, p := range parts {
-		if p != "" {
-			segments = append(segments, p)
-		}
-	}
-	return segments
-}
-
-// joinRedirectPath appends the stripped suffix to the redirect basePath
-// without producing a duplicate "/" between path segments, and without
-// inserting a "/" in front of a query ("?") or fragment ("#") delimiter
-// (RFC 3986 §3.3). The suffix comes from stripping the matched PathPrefix
-// from vars.path, which includes query/fragment as-is.
-func joinRedirectPath(basePath, suffix string) string {
-	if suffix == "" {
-		return basePath
-	}
-	switch suffix[0] {
-	case '?', '#':
-		return basePath + suffix
-	case '/':
-		if strings.HasSuffix(basePath, "/") {
-			return basePath + suffix[1:]
-		}
-		return basePath + suffix
-	default:
-		if strings.HasSuffix(basePath, "/") {
-			return basePath + suffix
-		}
-		return basePath + "/" + suffix
-	}
-}
-
-// shouldReplacePrefixMatchForRedirect determines whether a redirect should strip the
-// matched PathPrefix and append the remaining suffix to the redirect path.
-// Strictly opt-in (preserves backwards-compatible behaviour): only active when
-// the user explicitly sets replacePrefixMatch=true and the route is a PathPrefix.
-func shouldReplacePrefixMatchForRedirect(action routes.RouteAction, route *routes.Route) bool {
-	if action.RedirectReplacePrefixMatch == nil || !*action.RedirectReplacePrefixMatch {
-		return false
-	}
-	return route.Type == routes.RouteTypePrefix
-}
-
-// shouldReplacePrefixMatch determines whether a rewrite should use prefix replacement.
-// Explicit field takes precedence. Otherwise, convention: prefix rewrite for PathPrefix
-// routes whose rewritePath contains no variables (${...}); full rewrite otherwise.
-func shouldReplacePrefixMatch(action routes.RouteAction, route *routes.Route, _ string) bool {
-	if action.RewriteReplacePrefixMatch != nil {
-		return *action.RewriteReplacePrefixMatch
-	}
-	return route.Type == routes.RouteTypePrefix && !strings.Contains(action.RewritePath, "${")
+	return options
 }
 
-// substituteVariables replaces ${var} placeholders with actual values
-func substituteVariables(value string, vars *requestVars) string {
-	if vars == nil || value == "" {
-		return value
+// recordDraining notes a request matched by a route of a deleted
+// CustomHTTPRoute that is only kept while it drains, which would have been
+// cut off without the drain period.
+func recordDraining(reqCtx *requestContext, route *routes.Route) {
+	if !route.Draining {
+		return
 	}
-
-	result := value
-	result = strings.ReplaceAll(result, "${client_ip}", vars.clientIP)
-	result = strings.ReplaceAll(result, "${request_id}", vars.requestID)
-	result = strings.ReplaceAll(result, "${host}", vars.host)
-	result = strings.ReplaceAll(result, "${path}", vars.path)
-	result = strings.ReplaceAll(result, "${method}", vars.method)
-	result = strings.ReplaceAll(result, "${scheme}", vars.scheme)
-
-	// Handle path segments: ${path.segment.N}
-	for i, segment := range vars.pathSegments {
-		placeholder := fmt.Sprintf("${path.segment.%d}", i)
-		result = strings.ReplaceAll(result, placeholder, segment)
-	}
-
-	return result
+	reqCtx.routeDraining = true
+	drainingRouteMatchesTotal.Inc()
 }
@@ -4,313 +4,476 @@ import (
 	"testing"
 
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/freepik-company/customrouter/pkg/matcher"
 	"github.com/freepik-company/customrouter/pkg/routes"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/zap"
 )
 
-func boolPtr(v bool) *bool { return &v }
+func TestBuildForwardResponse_OriginalPathHeader(t *testing.T) {
+	logger := zap.NewNop()
+	p := NewProcessor(nil, logger, false)
 
-func TestShouldReplacePrefixMatch(t *testing.T) {
 	tests := []struct {
-		name          string
-		action        routes.RouteAction
-		routeType     string
-		rewrittenBase string
-		want          bool
+		name             string
+		route            *routes.Route
+		varsPath         string
+		wantOriginalPath string // empty means header should NOT be present
 	}{
 		{
-			name:      "prefix route, no variables -> prefix rewrite",
-			action:    routes.RouteAction{RewritePath: "/api/v1"},
-			routeType: routes.RouteTypePrefix,
-			want:      true,
-		},
-		{
-			name:      "prefix route, with variables -> full rewrite",
-			action:    routes.RouteAction{RewritePath: "/api/${path.segment.1}"},
-			routeType: routes.RouteTypePrefix,
-			want:      false,
-		},
-		{
-			name:      "exact route, no variables -> full rewrite",
-			action:    routes.RouteAction{RewritePath: "/api/v1"},
-			routeType: routes.RouteTypeExact,
-			want:      false,
-		},
-		{
-			name:      "regex route, no variables -> full rewrite",
-			action:    routes.RouteAction{RewritePath: "/api/v1"},
-			routeType: routes.RouteTypeRegex,
-			want:      false,
-		},
-		{
-			name:      "explicit true overrides convention on exact route",
-			action:    routes.RouteAction{RewritePath: "/api/v1", RewriteReplacePrefixMatch: boolPtr(true)},
-			routeType: routes.RouteTypeExact,
-			want:      true,
-		},
-		{
-			name:      "explicit false overrides convention on prefix route",
-			action:    routes.RouteAction{RewritePath: "/api/v1", RewriteReplacePrefixMatch: boolPtr(false)},
-			routeType: routes.RouteTypePrefix,
-			want:      false,
+			name: "rewrite sets x-envoy-original-path",
+			route: &routes.Route{
+				Path:    "/old",
+				Type:    routes.RouteTypePrefix,
+				Backend: "backend.ns.svc.cluster.local:80",
+				Actions: []routes.RouteAction{
+					{Type: routes.ActionTypeRewrite, RewritePath: "/new"},
+				},
+			},
+			varsPath:         "/old/sub?q=1",
+			wantOriginalPath: "/old/sub?q=1",
 		},
 		{
-			name:      "explicit true on prefix route with variables",
-			action:    routes.RouteAction{RewritePath: "/api/${host}", RewriteReplacePrefixMatch: boolPtr(true)},
-			routeType: routes.RouteTypePrefix,
-			want:      true,
+			name: "no rewrite omits x-envoy-original-path",
+			route: &routes.Route{
+				Path:    "/keep",
+				Type:    routes.RouteTypePrefix,
+				Backend: "backend.ns.svc.cluster.local:80",
+			},
+			varsPath:         "/keep/foo",
+			wantOriginalPath: "",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			route := &routes.Route{Type: tt.routeType}
-			got := shouldReplacePrefixMatch(tt.action, route, tt.rewrittenBase)
-			if got != tt.want {
-				t.Errorf("shouldReplacePrefixMatch() = %v, want %v", got, tt.want)
+			vars := matcher.NewVars(matcher.Request{Authority: "example.com", Path: tt.varsPath})
+			reqCtx := &requestContext{authority: "example.com"}
+
+			resp, _, err := p.buildForwardResponse(tt.route, vars, reqCtx, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			headers := resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders()
+			var got string
+			for _, h := range headers {
+				if h.GetHeader().GetKey() == "x-envoy-original-path" {
+					got = string(h.GetHeader().GetRawValue())
+					break
+				}
+			}
+
+			if tt.wantOriginalPath == "" && got != "" {
+				t.Errorf("expected no x-envoy-original-path header, got %q", got)
+			}
+			if tt.wantOriginalPath != "" && got != tt.wantOriginalPath {
+				t.Errorf("x-envoy-original-path = %q, want %q", got, tt.wantOriginalPath)
 			}
 		})
 	}
 }
 
-func TestJoinRedirectPath(t *testing.T) {
+func TestBuildForwardResponse_GRPC(t *testing.T) {
+	p := NewProcessor(nil, zap.NewNop(), false)
+
 	tests := []struct {
-		basePath string
-		suffix   string
-		want     string
+		name     string
+		grpc     bool
+		wantPath string
+		wantHost bool
 	}{
-		{"/app", "", "/app"},
-		{"/app", "/foo", "/app/foo"},
-		{"/app/", "/foo", "/app/foo"},
-		{"/app/", "foo", "/app/foo"},
-		{"/app", "foo", "/app/foo"},
-		{"/app", "?q=1", "/app?q=1"},
-		{"/app/", "?q=1", "/app/?q=1"},
-		{"/app", "#frag", "/app#frag"},
-		{"/app", "/foo?q=1", "/app/foo?q=1"},
-		{"/app", "/foo#frag", "/app/foo#frag"},
+		{"grpc route drops query and host", true, "/users.v2.UserService/GetUser", false},
+		{"http route keeps query and host", false, "/users.v2.UserService/GetUser?debug=1", true},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.basePath+"+"+tt.suffix, func(t *testing.T) {
-			got := joinRedirectPath(tt.basePath, tt.suffix)
-			if got != tt.want {
-				t.Errorf("joinRedirectPath(%q, %q) = %q, want %q", tt.basePath, tt.suffix, got, tt.want)
+		t.Run(tt.name, func(t *testing.T) {
+			route := &routes.Route{
+				Path:    "/users.v1.UserService/GetUser",
+				Type:    routes.RouteTypeExact,
+				Backend: "users.default.svc.cluster.local:9000",
+				GRPC:    tt.grpc,
+				Actions: []routes.RouteAction{{
+					Type:            routes.ActionTypeRewrite,
+					RewritePath:     "/users.v2.UserService/GetUser?debug=1",
+					RewriteHostname: "users-v2.default.svc.cluster.local",
+				}},
+			}
+			vars := &matcher.Vars{Path: "/users.v1.UserService/GetUser", Host: "api.example.com"}
+			reqCtx := &requestContext{authority: "api.example.com"}
+
+			resp, _, err := p.buildForwardResponse(route, vars, reqCtx, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			set := map[string]string{}
+			for _, h := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+				set[h.GetHeader().GetKey()] = string(h.GetHeader().GetRawValue())
+			}
+			if set[":path"] != tt.wantPath {
+				t.Errorf(":path = %q, want %q", set[":path"], tt.wantPath)
+			}
+			if set[":authority"] != "users-v2.default.svc.cluster.local" {
+				t.Errorf(":authority = %q", set[":authority"])
+			}
+			if _, ok := set["host"]; ok != tt.wantHost {
+				t.Errorf("host header set = %v, want %v", ok, tt.wantHost)
 			}
 		})
 	}
 }
 
-func TestShouldReplacePrefixMatchForRedirect(t *testing.T) {
+func TestBuildForwardResponse_SequentialActions(t *testing.T) {
+	p := NewProcessor(nil, zap.NewNop(), false)
+
+	actions := []routes.RouteAction{
+		{Type: routes.ActionTypeHeaderSet, HeaderName: "x-trace", Value: "1"},
+		{Type: routes.ActionTypeRewrite, RewriteHostname: "eu.example.com"},
+		{Type: routes.ActionTypeRewrite, RewritePath: "/${host}${path}"},
+		{Type: routes.ActionTypeHeaderSet, HeaderName: "x-target", Value: "${host}${path}"},
+		{Type: routes.ActionTypeHeaderRemove, HeaderName: "X-Trace"},
+	}
+
 	tests := []struct {
-		name      string
-		action    routes.RouteAction
-		routeType string
-		want      bool
+		name       string
+		sequential bool
+		want       map[string]string
+		wantTrace  bool
 	}{
 		{
-			name:      "nil flag on prefix route -> off (backwards compatible)",
-			action:    routes.RouteAction{RedirectPath: "/app"},
-			routeType: routes.RouteTypePrefix,
-			want:      false,
-		},
-		{
-			name:      "explicit false on prefix route -> off",
-			action:    routes.RouteAction{RedirectPath: "/app", RedirectReplacePrefixMatch: boolPtr(false)},
-			routeType: routes.RouteTypePrefix,
-			want:      false,
-		},
-		{
-			name:      "explicit true on prefix route -> on",
-			action:    routes.RouteAction{RedirectPath: "/app", RedirectReplacePrefixMatch: boolPtr(true)},
-			routeType: routes.RouteTypePrefix,
-			want:      true,
-		},
-		{
-			name:      "explicit true on exact route -> off (only prefix supported)",
-			action:    routes.RouteAction{RedirectPath: "/app", RedirectReplacePrefixMatch: boolPtr(true)},
-			routeType: routes.RouteTypeExact,
-			want:      false,
+			name: "fixed actions see the original request",
+			want: map[string]string{
+				":path":      "/api.example.com/v1/items",
+				":authority": "eu.example.com",
+				"x-target":   "api.example.com/v1/items",
+			},
+			wantTrace: true,
 		},
 		{
-			name:      "explicit true on regex route -> off",
-			action:    routes.RouteAction{RedirectPath: "/app", RedirectReplacePrefixMatch: boolPtr(true)},
-			routeType: routes.RouteTypeRegex,
-			want:      false,
+			name:       "sequential actions see the previous rewrites",
+			sequential: true,
+			want: map[string]string{
+				":path":      "/eu.example.com/v1/items",
+				":authority": "eu.example.com",
+				"x-target":   "eu.example.com/eu.example.com/v1/items",
+			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			route := &routes.Route{Type: tt.routeType}
-			got := shouldReplacePrefixMatchForRedirect(tt.action, route)
-			if got != tt.want {
-				t.Errorf("shouldReplacePrefixMatchForRedirect() = %v, want %v", got, tt.want)
+			route := &routes.Route{
+				Path:              "/v1",
+				Type:              routes.RouteTypePrefix,
+				Backend:           "api.default.svc.cluster.local:8080",
+				Actions:           actions,
+				SequentialActions: tt.sequential,
 			}
-		})
-	}
-}
+			vars := matcher.NewVars(matcher.Request{Authority: "api.example.com", Path: "/v1/items"})
+			reqCtx := &requestContext{authority: "api.example.com"}
 
-func TestSplitPath(t *testing.T) {
-	tests := []struct {
-		path string
-		want []string
-	}{
-		{"/foo/bar", []string{"foo", "bar"}},
-		{"/foo/bar?q=1", []string{"foo", "bar"}},
-		{"/", nil},
-		{"/a/b/c/d", []string{"a", "b", "c", "d"}},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.path, func(t *testing.T) {
-			got := splitPath(tt.path)
-			if len(got) == 0 && len(tt.want) == 0 {
-				return
+			resp, _, err := p.buildForwardResponse(route, vars, reqCtx, true)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-			if len(got) != len(tt.want) {
-				t.Fatalf("splitPath(%q) = %v, want %v", tt.path, got, tt.want)
+
+			set := map[string]string{}
+			for _, h := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+				set[h.GetHeader().GetKey()] = string(h.GetHeader().GetRawValue())
 			}
-			for i := range got {
-				if got[i] != tt.want[i] {
-					t.Errorf("splitPath(%q)[%d] = %q, want %q", tt.path, i, got[i], tt.want[i])
+			for key, want := range tt.want {
+				if set[key] != want {
+					t.Errorf("%s = %q, want %q", key, set[key], want)
 				}
 			}
+			if _, ok := set["x-trace"]; ok != tt.wantTrace {
+				t.Errorf("x-trace set = %v, want %v", ok, tt.wantTrace)
+			}
+			if vars.Host != "api.example.com" || vars.Path != "/v1/items" {
+				t.Errorf("request vars were mutated: host %q, path %q", vars.Host, vars.Path)
+			}
 		})
 	}
 }
 
-func TestStripQueryString(t *testing.T) {
+func TestProcessRequestHeaders_SequentialRedirect(t *testing.T) {
+	route := &routes.Route{
+		Path:              "/old",
+		Type:              routes.RouteTypePrefix,
+		SequentialActions: true,
+		Actions: []routes.RouteAction{
+			{Type: routes.ActionTypeRewrite, RewritePath: "/new"},
+			{Type: routes.ActionTypeRewrite, RewriteHostname: "www.example.com"},
+			{Type: routes.ActionTypeRedirect, RedirectStatusCode: 301},
+		},
+	}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+
+	resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":authority", Value: "example.com"},
+			{Key: ":path", Value: "/old/page?q=1"},
+			{Key: ":method", Value: "GET"},
+			{Key: ":scheme", Value: "https"},
+		}},
+	}, &streamContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	immediate := resp.GetImmediateResponse()
+	if immediate == nil {
+		t.Fatalf("expected an immediate redirect response, got %v", resp)
+	}
+	var location string
+	for _, h := range immediate.GetHeaders().GetSetHeaders() {
+		if h.GetHeader().GetKey() == "location" {
+			location = string(h.GetHeader().GetRawValue())
+		}
+	}
+	if want := "https://www.example.com/new/page?q=1"; location != want {
+		t.Errorf("location = %q, want %q", location, want)
+	}
+}
+
+func TestBuildRedirectResponse_AltSvc(t *testing.T) {
 	tests := []struct {
-		input string
-		want  string
+		name     string
+		fallback string
+		action   string
+		want     string
 	}{
-		{"/example", "/example"},
-		{"/example?key=value", "/example"},
-		{"/example?", "/example"},
-		{"/example?key=value&other=test", "/example"},
-		{"/path/to/resource?q=search+term", "/path/to/resource"},
-		{"/", "/"},
-		{"/?q=1", "/"},
-		{"", ""},
-		// RFC 3986 §3.3: path is also terminated by '#'
-		{"/example#section", "/example"},
-		{"/example#", "/example"},
-		{"/path/to/resource#top", "/path/to/resource"},
-		// '?' before '#': query terminates the path first
-		{"/example?q=1#frag", "/example"},
-		// '#' before '?': fragment terminates the path first
-		{"/example#frag?notquery", "/example"},
+		{name: "none"},
+		{name: "processor default", fallback: `h3=":443"; ma=86400`, want: `h3=":443"; ma=86400`},
+		{name: "action overrides", fallback: `h3=":443"; ma=86400`, action: "clear", want: "clear"},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			got := stripQueryString(tt.input)
-			if got != tt.want {
-				t.Errorf("stripQueryString(%q) = %q, want %q", tt.input, got, tt.want)
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(staticRouteFinder{}, zap.NewNop(), false)
+			p.SetRedirectAltSvc(tt.fallback)
+
+			resp := p.buildRedirectResponse(&matcher.Redirect{
+				Location:   "https://www.example.com/",
+				StatusCode: 301,
+				AltSvc:     tt.action,
+			})
+			var altSvc string
+			for _, h := range resp.GetImmediateResponse().GetHeaders().GetSetHeaders() {
+				if h.GetHeader().GetKey() == "alt-svc" {
+					altSvc = string(h.GetHeader().GetRawValue())
+				}
+			}
+			if altSvc != tt.want {
+				t.Errorf("alt-svc = %q, want %q", altSvc, tt.want)
 			}
 		})
 	}
 }
 
-func TestExtractQueryParams(t *testing.T) {
+// staticRouteFinder returns the same route for every request.
+type staticRouteFinder struct{ route *routes.Route }
+
+func (f staticRouteFinder) FindRoute(string, routes.RequestMatch) *routes.Route { return f.route }
+
+func TestProcessRequestHeaders_OverrideHeader(t *testing.T) {
+	route := &routes.Route{
+		Path:           "/api",
+		Type:           routes.RouteTypePrefix,
+		Backend:        "api.default.svc.cluster.local:8080",
+		OverrideHeader: "x-route-override",
+		Overrides:      map[string]string{"alice": "api-alice.preview.svc.cluster.local:9090"},
+	}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+
 	tests := []struct {
-		name  string
-		input string
-		want  map[string]string
+		name        string
+		override    string
+		wantCluster string
 	}{
-		{"no query", "/api", map[string]string{}},
-		{"empty query", "/api?", map[string]string{}},
-		{"single param", "/api?version=2", map[string]string{"version": "2"}},
-		{"multiple params", "/api?a=1&b=two", map[string]string{"a": "1", "b": "two"}},
-		{"url-encoded value", "/api?q=hello%20world", map[string]string{"q": "hello world"}},
-		{"repeated param keeps first", "/api?x=1&x=2", map[string]string{"x": "1"}},
-		{"fragment stripped before parsing", "/api?q=1#frag", map[string]string{"q": "1"}},
+		{"no header uses the rule backend", "", "outbound|8080||api.default.svc.cluster.local"},
+		{"known variant uses its backend", "alice", "outbound|9090||api-alice.preview.svc.cluster.local"},
+		{"unknown variant uses the rule backend", "bob", "outbound|8080||api.default.svc.cluster.local"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := extractQueryParams(tt.input)
-			if len(got) != len(tt.want) {
-				t.Fatalf("extractQueryParams(%q) = %v, want %v", tt.input, got, tt.want)
+			headers := []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: "/api/items"},
+				{Key: ":method", Value: "GET"},
+			}
+			if tt.override != "" {
+				headers = append(headers, &corev3.HeaderValue{Key: "X-Route-Override", Value: tt.override})
+			}
+			resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+				Headers: &corev3.HeaderMap{Headers: headers},
+			}, &streamContext{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-			for k, v := range tt.want {
-				if got[k] != v {
-					t.Errorf("extractQueryParams(%q)[%q] = %q, want %q", tt.input, k, got[k], v)
+
+			var got string
+			for _, h := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+				if h.GetHeader().GetKey() == "x-customrouter-cluster" {
+					got = string(h.GetHeader().GetRawValue())
 				}
 			}
+			if got != tt.wantCluster {
+				t.Errorf("x-customrouter-cluster = %q, want %q", got, tt.wantCluster)
+			}
+			if route.Backend != "api.default.svc.cluster.local:8080" {
+				t.Errorf("shared route was mutated: backend = %q", route.Backend)
+			}
 		})
 	}
 }
 
-func TestBuildForwardResponse_OriginalPathHeader(t *testing.T) {
-	logger := zap.NewNop()
-	p := NewProcessor(nil, logger, false)
+func TestProcessRequestHeaders_UnmatchedPolicy(t *testing.T) {
+	fallback := &routes.Route{Path: "/", Type: routes.RouteTypePrefix, UnmatchedPolicy: routes.UnmatchedServiceUnavailable}
 
 	tests := []struct {
-		name             string
-		route            *routes.Route
-		varsPath         string
-		wantOriginalPath string // empty means header should NOT be present
+		name       string
+		route      *routes.Route
+		stream     string
+		processor  string
+		wantStatus typev3.StatusCode // 0 means the request passes through
 	}{
-		{
-			name: "rewrite sets x-envoy-original-path",
-			route: &routes.Route{
-				Path:    "/old",
-				Type:    routes.RouteTypePrefix,
-				Backend: "backend.ns.svc.cluster.local:80",
-				Actions: []routes.RouteAction{
-					{Type: routes.ActionTypeRewrite, RewritePath: "/new"},
-				},
-			},
-			varsPath:         "/old/sub?q=1",
-			wantOriginalPath: "/old/sub?q=1",
-		},
-		{
-			name: "no rewrite omits x-envoy-original-path",
-			route: &routes.Route{
-				Path:    "/keep",
-				Type:    routes.RouteTypePrefix,
-				Backend: "backend.ns.svc.cluster.local:80",
-			},
-			varsPath:         "/keep/foo",
-			wantOriginalPath: "",
-		},
+		{"default passes through", nil, "", "", 0},
+		{"processor default", nil, "", routes.UnmatchedNotFound, typev3.StatusCode_NotFound},
+		{"attachment wins over processor", nil, routes.UnmatchedPassthrough, routes.UnmatchedNotFound, 0},
+		{"hostname wins over attachment", fallback, routes.UnmatchedNotFound, "", typev3.StatusCode_ServiceUnavailable},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			vars := &requestVars{
-				path:         tt.varsPath,
-				host:         "example.com",
-				pathSegments: splitPath(tt.varsPath),
-			}
-			reqCtx := &requestContext{authority: "example.com"}
-
-			resp, _, err := p.buildForwardResponse(tt.route, vars, reqCtx)
+			p := NewProcessor(staticRouteFinder{route: tt.route}, zap.NewNop(), false)
+			p.SetUnmatchedPolicy(tt.processor)
+
+			resp, reqCtx, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+				Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+					{Key: ":authority", Value: "example.com"},
+					{Key: ":path", Value: "/unknown"},
+					{Key: ":method", Value: "GET"},
+				}},
+			}, &streamContext{unmatchedPolicy: tt.stream})
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-
-			headers := resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders()
-			var got string
-			for _, h := range headers {
-				if h.GetHeader().GetKey() == "x-envoy-original-path" {
-					got = string(h.GetHeader().GetRawValue())
-					break
-				}
+			if reqCtx.routeFound {
+				t.Errorf("routeFound = true, want false")
 			}
 
-			if tt.wantOriginalPath == "" && got != "" {
-				t.Errorf("expected no x-envoy-original-path header, got %q", got)
+			immediate := resp.GetImmediateResponse()
+			if tt.wantStatus == 0 {
+				if immediate != nil {
+					t.Fatalf("got immediate response %v, want passthrough", immediate)
+				}
+				remove := resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders()
+				if len(remove) != 1 || remove[0] != "x-customrouter-cluster" {
+					t.Errorf("RemoveHeaders = %v, want [x-customrouter-cluster]", remove)
+				}
+				if !resp.GetRequestHeaders().GetResponse().GetClearRouteCache() {
+					t.Error("ClearRouteCache = false, want true")
+				}
+				return
 			}
-			if tt.wantOriginalPath != "" && got != tt.wantOriginalPath {
-				t.Errorf("x-envoy-original-path = %q, want %q", got, tt.wantOriginalPath)
+			if immediate.GetStatus().GetCode() != tt.wantStatus {
+				t.Errorf("status = %v, want %v", immediate.GetStatus().GetCode(), tt.wantStatus)
 			}
 		})
 	}
 }
 
+func TestProcessRequestHeaders_DrainingRoute(t *testing.T) {
+	for _, draining := range []bool{false, true} {
+		route := &routes.Route{
+			Path:     "/checkout",
+			Type:     routes.RouteTypePrefix,
+			Backend:  "checkout.default.svc.cluster.local:8080",
+			Draining: draining,
+		}
+		p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+		before := testutil.ToFloat64(drainingRouteMatchesTotal)
+
+		_, reqCtx, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+			Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: "/checkout/pay"},
+				{Key: ":method", Value: "POST"},
+			}},
+		}, &streamContext{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reqCtx.routeFound || reqCtx.routeDraining != draining {
+			t.Errorf("draining=%v: routeFound=%v routeDraining=%v, want the route matched and flagged accordingly",
+				draining, reqCtx.routeFound, reqCtx.routeDraining)
+		}
+		want := before
+		if draining {
+			want++
+		}
+		if got := testutil.ToFloat64(drainingRouteMatchesTotal); got != want {
+			t.Errorf("draining=%v: draining_route_matches_total = %v, want %v", draining, got, want)
+		}
+	}
+}
+
+func TestProcessRequestHeaders_Maintenance(t *testing.T) {
+	route := &routes.Route{
+		Path:     "/",
+		Type:     routes.RouteTypePrefix,
+		Priority: routes.MaintenancePriority,
+		Maintenance: &routes.RouteMaintenance{
+			StatusCode:  503,
+			RetryAfter:  "3600",
+			ContentType: "text/plain",
+			Body:        "back soon",
+		},
+	}
+	p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+
+	resp, reqCtx, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+		Headers: &corev3.HeaderMap{Headers: []*corev3.HeaderValue{
+			{Key: ":authority", Value: "example.com"},
+			{Key: ":path", Value: "/shop"},
+			{Key: ":method", Value: "GET"},
+		}},
+	}, &streamContext{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reqCtx.routeFound {
+		t.Errorf("routeFound = false, want true")
+	}
+
+	immediate := resp.GetImmediateResponse()
+	if immediate == nil {
+		t.Fatalf("got %v, want an immediate response", resp)
+	}
+	if immediate.GetStatus().GetCode() != typev3.StatusCode_ServiceUnavailable {
+		t.Errorf("status = %v, want 503", immediate.GetStatus().GetCode())
+	}
+	if string(immediate.GetBody()) != "back soon" {
+		t.Errorf("body = %q, want %q", immediate.GetBody(), "back soon")
+	}
+	got := make(map[string]string)
+	for _, h := range immediate.GetHeaders().GetSetHeaders() {
+		got[h.GetHeader().GetKey()] = string(h.GetHeader().GetRawValue())
+	}
+	want := map[string]string{"retry-after": "3600", "content-type": "text/plain", "cache-control": "no-store"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("header %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
 func TestProcessResponseHeaders(t *testing.T) {
 	logger := zap.NewNop()
 	p := NewProcessor(nil, logger, false)
@@ -410,9 +573,9 @@ func TestProcessResponseHeaders(t *testing.T) {
 					{Type: routes.ActionTypeResponseHeaderAdd, HeaderName: "X-Original-Path", Value: "${path}"},
 				},
 			},
-			vars: &requestVars{
-				requestID: "req-42",
-				path:      "/orig",
+			vars: &matcher.Vars{
+				RequestID: "req-42",
+				Path:      "/orig",
 			},
 		})
 		set := resp.GetResponseHeaders().GetResponse().GetHeaderMutation().SetHeaders
@@ -427,34 +590,3 @@ func TestProcessResponseHeaders(t *testing.T) {
 		}
 	})
 }
-
-func TestSubstituteVariables(t *testing.T) {
-	vars := &requestVars{
-		clientIP:     "1.2.3.4",
-		requestID:    "req-123",
-		host:         "example.com",
-		path:         "/foo/bar?q=1",
-		method:       "GET",
-		scheme:       "https",
-		pathSegments: []string{"foo", "bar"},
-	}
-
-	tests := []struct {
-		input string
-		want  string
-	}{
-		{"/api/${path.segment.0}", "/api/foo"},
-		{"${scheme}://${host}${path}", "https://example.com/foo/bar?q=1"},
-		{"/static", "/static"},
-		{"", ""},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			got := substituteVariables(tt.input, vars)
-			if got != tt.want {
-				t.Errorf("substituteVariables(%q) = %q, want %q", tt.input, got, tt.want)
-			}
-		})
-	}
-}
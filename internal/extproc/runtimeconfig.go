@@ -0,0 +1,206 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Keys of the runtime config ConfigMap. Keys left out keep the value of
+// their flag.
+const (
+	// RuntimeConfigLogLevel is the log level: debug, info, warn or error.
+	RuntimeConfigLogLevel = "log-level"
+
+	// RuntimeConfigAccessLog enables or disables the access log.
+	RuntimeConfigAccessLog = "access-log"
+
+	// RuntimeConfigAccessLogSampleRate is the fraction of requests, from 0
+	// to 1, that get an access log line.
+	RuntimeConfigAccessLogSampleRate = "access-log-sample-rate"
+
+	// RuntimeConfigDebugTraceHosts is the comma-separated list of hosts
+	// allowed a decision trace, like --debug-trace-hosts.
+	RuntimeConfigDebugTraceHosts = "debug-trace-hosts"
+)
+
+// RuntimeConfig holds the settings the extproc applies without a restart.
+type RuntimeConfig struct {
+	LogLevel            zapcore.Level
+	AccessLog           bool
+	AccessLogSampleRate float64
+	DebugTraceHosts     []string
+}
+
+// ParseRuntimeConfig returns defaults with the keys set in data applied. An
+// unknown key or an invalid value fails the whole ConfigMap, so a typo never
+// applies half of a change.
+func ParseRuntimeConfig(data map[string]string, defaults RuntimeConfig) (RuntimeConfig, error) {
+	config := defaults
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := strings.TrimSpace(data[key])
+		switch key {
+		case RuntimeConfigLogLevel:
+			level, err := zapcore.ParseLevel(value)
+			if err != nil || level > zapcore.ErrorLevel {
+				return RuntimeConfig{}, fmt.Errorf("invalid %s %q: must be debug, info, warn or error", key, value)
+			}
+			config.LogLevel = level
+		case RuntimeConfigAccessLog:
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return RuntimeConfig{}, fmt.Errorf("invalid %s %q: must be true or false", key, value)
+			}
+			config.AccessLog = enabled
+		case RuntimeConfigAccessLogSampleRate:
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate < 0 || rate > 1 {
+				return RuntimeConfig{}, fmt.Errorf("invalid %s %q: must be a number from 0 to 1", key, value)
+			}
+			config.AccessLogSampleRate = rate
+		case RuntimeConfigDebugTraceHosts:
+			config.DebugTraceHosts = nil
+			for _, host := range strings.Split(value, ",") {
+				if host = strings.TrimSpace(host); host != "" {
+					config.DebugTraceHosts = append(config.DebugTraceHosts, host)
+				}
+			}
+		default:
+			return RuntimeConfig{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return config, nil
+}
+
+// ParseConfigMapRef parses a "namespace/name" ConfigMap reference.
+func ParseConfigMapRef(ref string) (namespace, name string, err error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid ConfigMap reference %q: must be namespace/name", ref)
+	}
+	return namespace, name, nil
+}
+
+// runtimeConfigWatcher applies the runtime config ConfigMap to the processor
+// and the log level whenever it changes. A deleted ConfigMap restores the
+// flag values; an invalid one is logged and leaves the current settings.
+type runtimeConfigWatcher struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	defaults  RuntimeConfig
+	processor *Processor
+	level     *zap.AtomicLevel
+	logger    *zap.Logger
+
+	// mu serializes apply, so the settings always come from a single
+	// version of the ConfigMap.
+	mu sync.Mutex
+}
+
+// start starts the informer watching the ConfigMap until ctx is done.
+func (w *runtimeConfigWatcher) start(ctx context.Context) error {
+	selector := fields.OneTermEqualSelector("metadata.name", w.name).String()
+	factory := informers.NewSharedInformerFactoryWithOptions(w.client, 0,
+		informers.WithNamespace(w.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = selector
+		}),
+	)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { w.apply(obj) },
+		UpdateFunc: func(_, obj any) { w.apply(obj) },
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if cm, ok := obj.(*corev1.ConfigMap); ok && cm.Name == w.name {
+				w.apply(nil)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to watch runtime config ConfigMap: %w", err)
+	}
+	if err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		w.logger.Warn("watching runtime config ConfigMap failed, keeping the current settings", zap.Error(err))
+	}); err != nil {
+		return fmt.Errorf("failed to watch runtime config ConfigMap: %w", err)
+	}
+	factory.Start(ctx.Done())
+	return nil
+}
+
+// apply applies the runtime config of obj, or the defaults when obj is nil.
+func (w *runtimeConfigWatcher) apply(obj any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	config := w.defaults
+	if obj != nil {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok || cm.Name != w.name {
+			return
+		}
+		parsed, err := ParseRuntimeConfig(cm.Data, w.defaults)
+		if err != nil {
+			runtimeConfigLoadsTotal.WithLabelValues("error").Inc()
+			w.logger.Warn("invalid runtime config ConfigMap, keeping the current settings",
+				zap.String("configmap", w.namespace+"/"+w.name),
+				zap.String("resource_version", cm.ResourceVersion),
+				zap.Error(err))
+			return
+		}
+		config = parsed
+	}
+
+	if w.level != nil {
+		w.level.SetLevel(config.LogLevel)
+	}
+	w.processor.SetAccessLog(config.AccessLog, config.AccessLogSampleRate)
+	w.processor.SetDebugTraceHosts(config.DebugTraceHosts)
+	runtimeConfigLoadsTotal.WithLabelValues("success").Inc()
+	runtimeConfigLastApplied.SetToCurrentTime()
+
+	w.logger.Info("runtime config applied",
+		zap.String("configmap", w.namespace+"/"+w.name),
+		zap.Bool("configmap_found", obj != nil),
+		zap.String("log_level", config.LogLevel.String()),
+		zap.Bool("access_log", config.AccessLog),
+		zap.Float64("access_log_sample_rate", config.AccessLogSampleRate),
+		zap.Strings("debug_trace_hosts", config.DebugTraceHosts))
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseRuntimeConfig(t *testing.T) {
+	defaults := RuntimeConfig{
+		LogLevel:            zapcore.InfoLevel,
+		AccessLog:           true,
+		AccessLogSampleRate: 1,
+		DebugTraceHosts:     []string{"example.com"},
+	}
+
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    RuntimeConfig
+		wantErr bool
+	}{
+		{name: "empty keeps the defaults", want: defaults},
+		{
+			name: "all keys",
+			data: map[string]string{
+				RuntimeConfigLogLevel:            "debug",
+				RuntimeConfigAccessLog:           "false",
+				RuntimeConfigAccessLogSampleRate: "0.25",
+				RuntimeConfigDebugTraceHosts:     " a.example.com, ,b.example.com",
+			},
+			want: RuntimeConfig{
+				LogLevel:            zapcore.DebugLevel,
+				AccessLogSampleRate: 0.25,
+				DebugTraceHosts:     []string{"a.example.com", "b.example.com"},
+			},
+		},
+		{
+			name: "empty hosts disable tracing",
+			data: map[string]string{RuntimeConfigDebugTraceHosts: ""},
+			want: RuntimeConfig{LogLevel: zapcore.InfoLevel, AccessLog: true, AccessLogSampleRate: 1},
+		},
+		{name: "invalid level", data: map[string]string{RuntimeConfigLogLevel: "verbose"}, wantErr: true},
+		{name: "fatal level", data: map[string]string{RuntimeConfigLogLevel: "fatal"}, wantErr: true},
+		{name: "invalid access log", data: map[string]string{RuntimeConfigAccessLog: "yes please"}, wantErr: true},
+		{name: "sample rate above 1", data: map[string]string{RuntimeConfigAccessLogSampleRate: "1.5"}, wantErr: true},
+		{name: "unknown key", data: map[string]string{"log-levle": "debug"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRuntimeConfig(tt.data, defaults)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRuntimeConfig() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRuntimeConfig() error = %v", err)
+			}
+			if got.LogLevel != tt.want.LogLevel || got.AccessLog != tt.want.AccessLog ||
+				got.AccessLogSampleRate != tt.want.AccessLogSampleRate ||
+				!slices.Equal(got.DebugTraceHosts, tt.want.DebugTraceHosts) {
+				t.Errorf("ParseRuntimeConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfigMapRef(t *testing.T) {
+	if ns, name, err := ParseConfigMapRef("customrouter/extproc-runtime"); err != nil || ns != "customrouter" || name != "extproc-runtime" {
+		t.Errorf("ParseConfigMapRef() = %q, %q, %v", ns, name, err)
+	}
+	for _, ref := range []string{"extproc-runtime", "/name", "ns/", "ns/a/b"} {
+		if _, _, err := ParseConfigMapRef(ref); err == nil {
+			t.Errorf("ParseConfigMapRef(%q) succeeded, want an error", ref)
+		}
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	p := NewProcessor(nil, zap.New(core), true)
+
+	p.SetAccessLog(true, 0)
+	p.logAccess(p.logger, &requestContext{startTime: time.Now(), authority: "example.com", path: "/"})
+	if logs.Len() != 0 {
+		t.Errorf("expected no access log line at sample rate 0, got %d", logs.Len())
+	}
+
+	p.SetAccessLog(true, 1)
+	p.logAccess(p.logger, &requestContext{startTime: time.Now(), authority: "example.com", path: "/"})
+	if logs.FilterMessage("access").Len() != 1 {
+		t.Errorf("expected an access log line at sample rate 1, got %d", logs.Len())
+	}
+}
+
+func TestRuntimeConfigWatcher(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "extproc-runtime", Namespace: "customrouter"},
+		Data: map[string]string{
+			RuntimeConfigLogLevel:        "debug",
+			RuntimeConfigAccessLog:       "false",
+			RuntimeConfigDebugTraceHosts: "example.com",
+		},
+	}
+	cs := fake.NewSimpleClientset(cm)
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	p := NewProcessor(nil, zap.NewNop(), true)
+	w := &runtimeConfigWatcher{
+		client:    cs,
+		namespace: "customrouter",
+		name:      "extproc-runtime",
+		defaults:  RuntimeConfig{LogLevel: zapcore.InfoLevel, AccessLog: true, AccessLogSampleRate: 1},
+		processor: p,
+		level:     &level,
+		logger:    zap.NewNop(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := w.start(ctx); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("the ConfigMap to be applied", func() bool {
+		return level.Level() == zapcore.DebugLevel && !p.accessLogEnabled.Load() && p.debugTraceHosts.Load() != nil
+	})
+
+	// An invalid version keeps the current settings.
+	cm.Data = map[string]string{RuntimeConfigLogLevel: "loud"}
+	if _, err := cs.CoreV1().ConfigMaps("customrouter").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update ConfigMap: %v", err)
+	}
+	cm.Data = map[string]string{RuntimeConfigLogLevel: "warn", RuntimeConfigAccessLog: "false"}
+	if _, err := cs.CoreV1().ConfigMaps("customrouter").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update ConfigMap: %v", err)
+	}
+	waitFor("the update to be applied", func() bool {
+		return level.Level() == zapcore.WarnLevel && p.debugTraceHosts.Load() == nil
+	})
+
+	// Deleting the ConfigMap restores the flags.
+	if err := cs.CoreV1().ConfigMaps("customrouter").Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete ConfigMap: %v", err)
+	}
+	waitFor("the defaults to be restored", func() bool {
+		return level.Level() == zapcore.InfoLevel && p.accessLogEnabled.Load()
+	})
+}
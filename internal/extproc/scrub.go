@@ -0,0 +1,98 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"sort"
+	"strings"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// Policies whose scrub patterns removed a header, the policy label of
+// request_headers_scrubbed_total.
+const (
+	scrubPolicyTarget = "target"
+	scrubPolicyRoute  = "route"
+)
+
+// SetScrubHeaders sets the scrub patterns (see routes.ScrubsHeader) of the
+// client request headers removed from every request the processor lets
+// through, whether a route matched it or not. The scrubHeaders of the
+// matched route apply on top: a route's exceptions cannot keep a header
+// these patterns remove.
+func (p *Processor) SetScrubHeaders(patterns []string) {
+	p.scrubHeaders = patterns
+}
+
+// scrubRequestHeaders removes from the request resp lets through the client
+// headers scrubbed by the processor's patterns or by those of route, the
+// matched route (nil when none matched). Pseudo-headers, host and the
+// reserved headers, which sanitizeRequestHeaders handles, are never
+// scrubbed. Envoy applies removals before the headers resp sets, so a
+// header the route or an auth check sets reaches the backend with that
+// value alone. Responses answering the request right away are left alone.
+func (p *Processor) scrubRequestHeaders(resp *extprocv3.ProcessingResponse, headers *extprocv3.HttpHeaders, route *routes.Route) {
+	var routePatterns []string
+	if route != nil {
+		routePatterns = route.ScrubHeaders
+	}
+	if len(p.scrubHeaders) == 0 && len(routePatterns) == 0 {
+		return
+	}
+	common := resp.GetRequestHeaders().GetResponse()
+	if common == nil {
+		return
+	}
+	if common.HeaderMutation == nil {
+		common.HeaderMutation = &extprocv3.HeaderMutation{}
+	}
+	mutation := common.HeaderMutation
+
+	removed := make(map[string]bool, len(mutation.RemoveHeaders))
+	for _, name := range mutation.RemoveHeaders {
+		removed[strings.ToLower(name)] = true
+	}
+	var scrubbed []string
+	for _, h := range headers.GetHeaders().GetHeaders() {
+		name := strings.ToLower(h.Key)
+		if removed[name] || strings.HasPrefix(name, ":") || name == "host" || isReservedHeader(name) {
+			continue
+		}
+		var policy string
+		switch {
+		case routes.ScrubsHeader(p.scrubHeaders, name):
+			policy = scrubPolicyTarget
+		case routes.ScrubsHeader(routePatterns, name):
+			policy = scrubPolicyRoute
+		default:
+			continue
+		}
+		removed[name] = true
+		scrubbed = append(scrubbed, name)
+		requestHeadersScrubbedTotal.WithLabelValues(policy).Inc()
+	}
+	if len(scrubbed) == 0 {
+		return
+	}
+	sort.Strings(scrubbed)
+	mutation.RemoveHeaders = append(mutation.RemoveHeaders, scrubbed...)
+	p.logger.Debug("scrubbed request headers", zap.Strings("headers", scrubbed))
+}
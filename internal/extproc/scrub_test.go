@@ -0,0 +1,86 @@
+package extproc
+
+import (
+	"slices"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestProcessRequest_ScrubHeaders(t *testing.T) {
+	route := &routes.Route{
+		Path:         "/api",
+		Type:         routes.RouteTypePrefix,
+		Backend:      "api.default.svc.cluster.local:8080",
+		ScrubHeaders: []string{"x-tenant", "!x-internal-trace"},
+		Actions: []routes.RouteAction{
+			{Type: routes.ActionTypeHeaderSet, HeaderName: "x-user-id", Value: "anonymous"},
+		},
+	}
+	extra := []*corev3.HeaderValue{
+		{Key: "X-User-Id", Value: "admin"},
+		{Key: "x-internal-role", Value: "root"},
+		{Key: "x-internal-trace", Value: "1"},
+		{Key: "x-tenant", Value: "other"},
+		{Key: "accept", Value: "*/*"},
+		{Key: "host", Value: "example.com"},
+	}
+
+	tests := []struct {
+		name     string
+		finder   staticRouteFinder
+		patterns []string
+		removed  []string
+		kept     []string
+	}{
+		{
+			name:     "matched",
+			finder:   staticRouteFinder{route: route},
+			patterns: []string{"x-user-id", "x-internal-*", ":path"},
+			removed:  []string{"x-user-id", "x-internal-role", "x-internal-trace", "x-tenant"},
+			kept:     []string{"accept", "host", ":path"},
+		},
+		{
+			name:     "unmatched",
+			finder:   staticRouteFinder{},
+			patterns: []string{"x-user-id"},
+			removed:  []string{"x-user-id"},
+			kept:     []string{"x-tenant", "x-internal-role"},
+		},
+		{
+			name:    "route patterns only",
+			finder:  staticRouteFinder{route: route},
+			removed: []string{"x-tenant"},
+			kept:    []string{"x-user-id", "x-internal-trace"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(tt.finder, zap.NewNop(), false)
+			p.SetScrubHeaders(tt.patterns)
+
+			_, mutation := processSpoofed(t, p, extra...)
+
+			for _, name := range tt.removed {
+				if !slices.Contains(mutation.GetRemoveHeaders(), name) {
+					t.Errorf("%s not scrubbed, removed %v", name, mutation.GetRemoveHeaders())
+				}
+			}
+			for _, name := range tt.kept {
+				if slices.Contains(mutation.GetRemoveHeaders(), name) {
+					t.Errorf("%s scrubbed, removed %v", name, mutation.GetRemoveHeaders())
+				}
+			}
+			// Envoy removes before it sets: the route's value replaces the
+			// scrubbed one.
+			if tt.finder.route != nil {
+				if value, _, ok := setHeader(mutation, "x-user-id"); !ok || value != "anonymous" {
+					t.Errorf("x-user-id set to %q, want the route's value", value)
+				}
+			}
+		})
+	}
+}
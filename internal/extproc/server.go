@@ -18,6 +18,8 @@ package extproc
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -26,20 +28,75 @@ import (
 	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	"github.com/freepik-company/customrouter/pkg/routes"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
+// routeLoader is the route source of the server: the route ConfigMaps
+// (routes.K8sLoader) or an object storage bucket (routes.BucketLoader).
+type routeLoader interface {
+	RouteFinder
+	loadStatusSource
+	Load() error
+	LoadSnapshot() error
+	SaveSnapshot() error
+	GetConfig() *routes.RoutesConfig
+	Watch(onChange func(*routes.RoutesConfig)) error
+	RequestReload()
+	Close() error
+}
+
 // Server wraps the gRPC server for the external processor
 type Server struct {
 	grpcServer *grpc.Server
 	processor  *Processor
-	loader     *routes.K8sLoader
+	loader     routeLoader
 	logger     *zap.Logger
 	config     *ServerConfig
+
+	// source names where routes are loaded from, for logs.
+	source string
+
+	// fromSnapshot is true when the server starts serving from the local
+	// snapshot and the routes still have to be loaded from their source.
+	fromSnapshot bool
+
+	// history keeps the last route tables for the /debug/routes endpoints;
+	// nil when they are disabled.
+	history *RouteHistory
+
+	// runtimeConfig applies RuntimeConfigMap; nil when it is not set.
+	runtimeConfig *runtimeConfigWatcher
+
+	// endpoints watches the EndpointSlices of the Endpoints signal; nil
+	// when BackendHealthEndpoints is not set.
+	endpoints *endpointsHealth
+
+	// routesConfig is the route config of the last load, the next reload is
+	// diffed against. Only the route source's reload callback uses it.
+	routesConfig *routes.RoutesConfig
+
+	// targetFound is the last checkTarget verdict, so the warning is only
+	// logged again when routes for the target disappear. Only the route
+	// source's reload callback uses it.
+	targetFound bool
+
+	// namespaceWrong is set while the route ConfigMaps of the target are
+	// only found outside --routes-configmap-namespace, so the warning is
+	// only logged when that starts. Only the route source's reload callback
+	// uses it.
+	namespaceWrong bool
+
+	// endpointsIgnored is set while the routes have fallback chains with
+	// the Endpoints signal but endpoints is nil, so the warning is only
+	// logged when such chains appear. Only the route source's reload
+	// callback uses it.
+	endpointsIgnored bool
 }
 
 // NewServer creates a new extproc server with the given configuration
@@ -48,27 +105,177 @@ func NewServer(config *ServerConfig, logger *zap.Logger) (*Server, error) {
 		return nil, fmt.Errorf("config is required")
 	}
 
-	if config.K8sClient == nil {
-		return nil, fmt.Errorf("K8sClient is required")
-	}
-
 	if config.TargetName == "" {
 		return nil, fmt.Errorf("TargetName is required")
 	}
 
-	loader := routes.NewK8sLoader(config.K8sClient, routes.K8sLoaderConfig{
-		TargetName:      config.TargetName,
-		Namespace:       config.RoutesNamespace,
-		PartitionHeader: config.RoutePartitionHeader,
-		ReloadDebounce:  config.RoutesReloadDebounce,
-	})
+	var runtimeNamespace, runtimeName string
+	if config.RuntimeConfigMap != "" {
+		var err error
+		if runtimeNamespace, runtimeName, err = ParseConfigMapRef(config.RuntimeConfigMap); err != nil {
+			return nil, err
+		}
+		if config.K8sClient == nil {
+			return nil, fmt.Errorf("K8sClient is required to watch the runtime config ConfigMap")
+		}
+	}
+	if config.BackendHealthEndpoints && config.K8sClient == nil {
+		return nil, fmt.Errorf("K8sClient is required to watch EndpointSlices")
+	}
+
+	logger = limitDebugLogs(logger, config.DebugLogRate)
+
+	var tlsConfig *tls.Config
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" || config.TLSClientCAFile != "" {
+		var err error
+		if tlsConfig, err = newServerTLSConfig(config.TLSCertFile, config.TLSKeyFile, config.TLSClientCAFile, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	var analyticsSink AnalyticsSink
+	if config.Analytics.Sink != "" {
+		var err error
+		if analyticsSink, err = NewAnalyticsSink(config.Analytics); err != nil {
+			return nil, err
+		}
+	}
 
-	// Initial load
-	if err := loader.Load(); err != nil {
-		return nil, fmt.Errorf("failed to load routes from ConfigMaps: %w", err)
+	var loader routeLoader
+	source := "ConfigMaps"
+	if config.RoutesBucket != nil {
+		source = "bucket"
+	}
+	// onLoadError reports a failed background load; the loader keeps
+	// serving its current routes either way.
+	onLoadError := func(err error) {
+		var budgetErr *routes.TableBudgetError
+		if errors.As(err, &budgetErr) {
+			routeTableRejectionsTotal.Inc()
+			recordRouteTable(loader.Status())
+			warnOverBudget(budgetErr, logger)
+			return
+		}
+		logger.Warn("route "+source+" reload failed, serving the current routes", zap.Error(err))
+	}
+	if config.RoutesBucket != nil {
+		loader = routes.NewBucketLoader(routes.BucketLoaderConfig{
+			Bucket:          config.RoutesBucket,
+			TargetName:      config.TargetName,
+			PartitionHeader: config.RoutePartitionHeader,
+			PollInterval:    config.RoutesBucketPollInterval,
+			SnapshotPath:    config.SnapshotPath,
+			MaxBytes:        config.MaxRouteTableBytes,
+			OnError:         onLoadError,
+		})
+	} else {
+		if config.K8sClient == nil {
+			return nil, fmt.Errorf("K8sClient is required")
+		}
+		loader = routes.NewK8sLoader(config.K8sClient, routes.K8sLoaderConfig{
+			TargetName:        config.TargetName,
+			Namespace:         config.RoutesNamespace,
+			PartitionHeader:   config.RoutePartitionHeader,
+			ReloadDebounce:    config.RoutesReloadDebounce,
+			ReloadJitter:      config.RoutesReloadJitter,
+			ResyncPeriod:      config.RoutesResyncPeriod,
+			SnapshotPath:      config.SnapshotPath,
+			AllowedNamespaces: config.AllowedSourceNamespaces,
+			SigningKey:        config.RoutesSigningKey,
+			EncryptionKey:     config.RoutesEncryptionKey,
+			MaxBytes:          config.MaxRouteTableBytes,
+			OnError:           onLoadError,
+		})
+	}
+	routeTableMaxBytes.Set(float64(max(config.MaxRouteTableBytes, 0)))
+
+	// Initial load: serve from the snapshot when one is available and load
+	// the routes in the background once the server starts; otherwise block
+	// on the route source as before.
+	fromSnapshot := false
+	if config.SnapshotPath != "" {
+		if err := loader.LoadSnapshot(); err != nil {
+			logger.Info("route snapshot not usable, loading routes from "+source,
+				zap.String("snapshot_path", config.SnapshotPath),
+				zap.Error(err),
+			)
+		} else {
+			fromSnapshot = true
+			logger.Info("serving routes from snapshot until they are loaded from "+source,
+				zap.String("snapshot_path", config.SnapshotPath),
+				zap.Int("hosts", len(loader.GetConfig().Hosts)),
+			)
+		}
+	}
+	if !fromSnapshot {
+		if err := loader.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load routes from %s: %w", source, err)
+		}
+		warnRejectedSources(loader, logger)
+		if err := loader.SaveSnapshot(); err != nil {
+			logger.Warn("failed to save route snapshot", zap.Error(err))
+		}
+	}
+
+	recordRouteTable(loader.Status())
+	targetCheck := recordTargetFound(config, loader.Status(), logger)
+	namespaceCheck := recordTargetConfigMaps(config, loader.Status(), logger)
+	if !targetCheck.found {
+		if config.RequireRoutes {
+			if len(namespaceCheck.elsewhere) > 0 {
+				return nil, fmt.Errorf("no routes found for target %q in namespace %q (its route ConfigMaps are in %v), "+
+					"refusing to start because of --require-routes", config.TargetName, config.RoutesNamespace, namespaceCheck.elsewhere)
+			}
+			return nil, fmt.Errorf("no routes found for target %q (route ConfigMaps exist for targets %v), "+
+				"refusing to start because of --require-routes", config.TargetName, targetCheck.known)
+		}
+		warnTargetNotFound(config, targetCheck, logger)
+	}
+	warnTargetNamespace(config, namespaceCheck, logger)
+
+	var history *RouteHistory
+	if config.RoutesHistorySize > 0 {
+		history = NewRouteHistory(config.RoutesHistorySize)
+		history.Record(loader.GetConfig(), loader.Status())
+		if config.HealthAddr != "" && config.RoutesDebugToken == "" {
+			logger.Warn("/debug/routes exports the route table without authentication, set --routes-debug-token",
+				zap.String("health_addr", config.HealthAddr))
+		}
 	}
 
 	processor := NewProcessor(loader, logger, config.AccessLogEnabled)
+	processor.SetAccessLog(config.AccessLogEnabled, config.AccessLogSampleRate)
+	processor.SetDecisionHeaders(config.DecisionHeaders, config.DebugHeader, config.DebugHeaderValue)
+	processor.SetUnmatchedPolicy(config.UnmatchedRequestPolicy)
+	processor.SetPathNormalization(config.PathNormalization)
+	processor.SetClusterNaming(config.ClusterNaming)
+	processor.SetVariantSelector(config.VariantSelector)
+	processor.SetRedirectAltSvc(config.RedirectAltSvc)
+	processor.SetDebugTrace(config.DebugTraceHosts, config.DebugTraceToken)
+	processor.SetConfigHashHeader(config.ConfigHashHeader)
+	processor.SetOverloadPolicy(config.Overload)
+	processor.SetConfigHash(loader.Status().ConfigHash)
+	if config.HostMetrics {
+		processor.SetHostMetrics(config.TargetName)
+	}
+	processor.SetMissDiagnostics(config.MissDiagnostics)
+	processor.SetScrubHeaders(config.ScrubHeaders)
+	if config.ReentryGuard {
+		processor.SetReentryGuard(config.ReentryKey, config.TargetName)
+	}
+	processor.SetClearRouteCache(!config.RetainRouteCache)
+	if analyticsSink != nil {
+		processor.SetAnalytics(analyticsSink, config.Analytics, config.TargetName)
+	}
+	var endpoints *endpointsHealth
+	if config.BackendHealthEndpoints {
+		endpoints = newEndpointsHealth(config.K8sClient, logger)
+		processor.SetEndpointsHealth(endpoints)
+	}
+	endpointsIgnored := endpoints == nil && usesEndpointsSignal(loader.GetConfig())
+	if endpointsIgnored {
+		warnEndpointsIgnored(logger)
+	}
 
 	// Configure gRPC server options for production
 	grpcOpts := []grpc.ServerOption{
@@ -86,6 +293,10 @@ func NewServer(config *ServerConfig, logger *zap.Logger) (*Server, error) {
 			MinTime:             5 * time.Second, // Minimum time between pings from client
 			PermitWithoutStream: true,            // Allow pings even when no active streams
 		}),
+		grpc.ChainStreamInterceptor(streamInterceptors(logger)...),
+	}
+	if tlsConfig != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 
 	grpcServer := grpc.NewServer(grpcOpts...)
@@ -101,24 +312,131 @@ func NewServer(config *ServerConfig, logger *zap.Logger) (*Server, error) {
 		reflection.Register(grpcServer)
 	}
 
+	var runtimeConfig *runtimeConfigWatcher
+	if config.RuntimeConfigMap != "" {
+		level := zapcore.InfoLevel
+		if config.LogLevel != nil {
+			level = config.LogLevel.Level()
+		}
+		runtimeConfig = &runtimeConfigWatcher{
+			client:    config.K8sClient,
+			namespace: runtimeNamespace,
+			name:      runtimeName,
+			defaults: RuntimeConfig{
+				LogLevel:            level,
+				AccessLog:           config.AccessLogEnabled,
+				AccessLogSampleRate: config.AccessLogSampleRate,
+				DebugTraceHosts:     config.DebugTraceHosts,
+			},
+			processor: processor,
+			level:     config.LogLevel,
+			logger:    logger,
+		}
+	}
+
 	return &Server{
-		grpcServer: grpcServer,
-		processor:  processor,
-		loader:     loader,
-		logger:     logger,
-		config:     config,
+		grpcServer:       grpcServer,
+		processor:        processor,
+		loader:           loader,
+		logger:           logger,
+		config:           config,
+		source:           source,
+		fromSnapshot:     fromSnapshot,
+		history:          history,
+		runtimeConfig:    runtimeConfig,
+		endpoints:        endpoints,
+		routesConfig:     loader.GetConfig(),
+		targetFound:      targetCheck.found,
+		namespaceWrong:   len(namespaceCheck.elsewhere) > 0,
+		endpointsIgnored: endpointsIgnored,
 	}, nil
 }
 
+// warnEndpointsIgnored logs that the routes have fallback chains with the
+// Endpoints signal that stay on their first backend.
+func warnEndpointsIgnored(logger *zap.Logger) {
+	logger.Warn("routes have backendFailover chains with the Endpoints health signal, " +
+		"but --backend-health-endpoints is not set: they always use their first backend")
+}
+
+// warnRejectedSources logs the route ConfigMaps the last load ignored because
+// they failed the source namespace or signature checks, or could not be read.
+func warnRejectedSources(source loadStatusSource, logger *zap.Logger) {
+	status := source.Status()
+	if rejected := status.RejectedConfigMaps; len(rejected) > 0 {
+		logger.Warn("ignored route ConfigMaps from untrusted sources",
+			zap.Strings("configmaps", rejected))
+	}
+	if unreadable := status.UnreadableConfigMaps; len(unreadable) > 0 {
+		logger.Error("ignored route ConfigMaps whose routes cannot be read, their hosts are not served",
+			zap.Strings("configmaps", unreadable))
+	}
+}
+
+// warnOverBudget logs a route table rejected for exceeding
+// --max-route-table-bytes, with its largest hosts.
+func warnOverBudget(err *routes.TableBudgetError, logger *zap.Logger) {
+	hosts := make([]string, len(err.LargestHosts))
+	for i, h := range err.LargestHosts {
+		hosts[i] = fmt.Sprintf("%s=%d", h.Host, h.Bytes)
+	}
+	logger.Error("route table over memory budget: serving the previous routes; "+
+		"split the largest hosts into another target or raise --max-route-table-bytes",
+		zap.Int("bytes", err.Bytes),
+		zap.Int("max_bytes", err.MaxBytes),
+		zap.Int("routes", err.Routes),
+		zap.Strings("largest_hosts", hosts),
+	)
+}
+
 // Start starts the gRPC server and watches for config changes
 func (s *Server) Start(ctx context.Context) error {
-	// Start watching for ConfigMap changes
+	// Start watching the route source for changes
 	if err := s.loader.Watch(func(config *routes.RoutesConfig) {
-		s.logger.Debug("routes configuration reloaded from ConfigMaps",
-			zap.Int("hosts", len(config.Hosts)),
-		)
+		status := s.loader.Status()
+		logRouteReload(s.logger, s.source, s.routesConfig, config, status)
+		s.routesConfig = config
+		warnRejectedSources(s.loader, s.logger)
+		recordRouteTable(status)
+		check := recordTargetFound(s.config, status, s.logger)
+		if !check.found && s.targetFound {
+			warnTargetNotFound(s.config, check, s.logger)
+		}
+		s.targetFound = check.found
+		nsCheck := recordTargetConfigMaps(s.config, status, s.logger)
+		wrong := len(nsCheck.elsewhere) > 0
+		if wrong && !s.namespaceWrong {
+			warnTargetNamespace(s.config, nsCheck, s.logger)
+		}
+		s.namespaceWrong = wrong
+		ignored := s.endpoints == nil && usesEndpointsSignal(config)
+		if ignored && !s.endpointsIgnored {
+			warnEndpointsIgnored(s.logger)
+		}
+		s.endpointsIgnored = ignored
+		s.processor.SetConfigHash(status.ConfigHash)
+		if s.history != nil {
+			s.history.Record(config, status)
+		}
+		if err := s.loader.SaveSnapshot(); err != nil {
+			s.logger.Warn("failed to save route snapshot", zap.Error(err))
+		}
 	}); err != nil {
-		s.logger.Warn("failed to start ConfigMap watcher", zap.Error(err))
+		s.logger.Warn("failed to start "+s.source+" watcher", zap.Error(err))
+	}
+	if s.fromSnapshot {
+		s.loader.RequestReload()
+	}
+	go s.processor.RunAnalytics(ctx)
+	if s.runtimeConfig != nil {
+		if err := s.runtimeConfig.start(ctx); err != nil {
+			s.logger.Warn("failed to start runtime config watcher", zap.Error(err))
+		}
+	}
+	if s.endpoints != nil {
+		if err := s.endpoints.start(ctx); err != nil {
+			s.logger.Warn("failed to start EndpointSlice watcher, every backend is healthy by Endpoints", zap.Error(err))
+		}
 	}
 
 	listener, err := net.Listen("tcp", s.config.Addr)
@@ -129,9 +447,19 @@ func (s *Server) Start(ctx context.Context) error {
 	s.logger.Info("starting extproc server",
 		zap.String("addr", s.config.Addr),
 		zap.String("target_name", s.config.TargetName),
+		zap.Bool("tls", s.config.TLSCertFile != ""),
+		zap.Bool("mtls", s.config.TLSClientCAFile != ""),
+		zap.String("routes_source", s.source),
 		zap.String("routes_namespace", s.config.RoutesNamespace),
+		zap.Strings("allowed_source_namespaces", s.config.AllowedSourceNamespaces),
+		zap.Bool("routes_signature_required", s.config.RoutesSigningKey != nil),
+		zap.Bool("routes_decryption", s.config.RoutesEncryptionKey != nil),
 		zap.String("route_partition_header", s.config.RoutePartitionHeader),
+		zap.Int("max_route_table_bytes", s.config.MaxRouteTableBytes),
 		zap.Duration("routes_reload_debounce", s.config.RoutesReloadDebounce),
+		zap.Duration("routes_reload_jitter", s.config.RoutesReloadJitter),
+		zap.Duration("routes_resync_period", s.config.RoutesResyncPeriod),
+		zap.String("snapshot_path", s.config.SnapshotPath),
 		zap.Int("max_recv_msg_size", s.config.MaxRecvMsgSize),
 		zap.Int("max_send_msg_size", s.config.MaxSendMsgSize),
 		zap.Uint32("max_concurrent_streams", s.config.MaxConcurrentStreams),
@@ -140,7 +468,21 @@ func (s *Server) Start(ctx context.Context) error {
 		zap.Duration("max_connection_idle", s.config.MaxConnectionIdle),
 		zap.Duration("max_connection_age", s.config.MaxConnectionAge),
 		zap.Bool("access_log_enabled", s.config.AccessLogEnabled),
+		zap.Float64("access_log_sample_rate", s.config.AccessLogSampleRate),
+		zap.String("runtime_configmap", s.config.RuntimeConfigMap),
+		zap.Bool("backend_health_endpoints", s.config.BackendHealthEndpoints),
 		zap.String("metrics_addr", s.config.MetricsAddr),
+		zap.String("health_addr", s.config.HealthAddr),
+		zap.Int("routes_history_size", s.config.RoutesHistorySize),
+		zap.Bool("config_hash_header", s.config.ConfigHashHeader),
+		zap.Bool("host_metrics", s.config.HostMetrics),
+		zap.Bool("miss_diagnostics", s.config.MissDiagnostics),
+		zap.Strings("scrub_headers", s.config.ScrubHeaders),
+		zap.Int("overload_max_in_flight", s.config.Overload.MaxInFlight),
+		zap.Int("overload_max_goroutines", s.config.Overload.MaxGoroutines),
+		zap.Duration("overload_max_latency", s.config.Overload.MaxLatency),
+		zap.String("overload_action", s.config.Overload.Action),
+		zap.String("analytics_sink", s.config.Analytics.Sink),
 	)
 
 	// Start metrics HTTP server if configured
@@ -163,6 +505,35 @@ func (s *Server) Start(ctx context.Context) error {
 		}()
 	}
 
+	// Start health HTTP server if configured
+	var healthServer *http.Server
+	if s.config.HealthAddr != "" {
+		handler := HealthHandler(s.loader)
+		if s.history != nil {
+			mux := http.NewServeMux()
+			// Imported tables are capped at the route table budget: a
+			// bigger one could not be served anyway.
+			debugRoutes := RoutesDebugHandler(s.history, s.config.RoutesDebugToken, s.config.MaxRouteTableBytes)
+			mux.Handle("/debug/routes", debugRoutes)
+			mux.Handle("/debug/routes/", debugRoutes)
+			mux.Handle("/", handler)
+			handler = mux
+		}
+		healthServer = &http.Server{
+			Addr:              s.config.HealthAddr,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			s.logger.Info("starting health server",
+				zap.String("addr", s.config.HealthAddr),
+			)
+			if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.logger.Error("health server error", zap.Error(err))
+			}
+		}()
+	}
+
 	// Handle graceful shutdown
 	go func() {
 		<-ctx.Done()
@@ -170,6 +541,9 @@ func (s *Server) Start(ctx context.Context) error {
 		if metricsServer != nil {
 			_ = metricsServer.Close()
 		}
+		if healthServer != nil {
+			_ = healthServer.Close()
+		}
 		s.grpcServer.GracefulStop()
 		if err := s.loader.Close(); err != nil {
 			s.logger.Warn("failed to close loader", zap.Error(err))
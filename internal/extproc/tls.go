@@ -0,0 +1,172 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tlsReloadCheckInterval bounds how often the certificate files are checked
+// for changes. Handshakes are rare on the long-lived Envoy streams, but a
+// reconnect storm should not stat the files once per connection.
+const tlsReloadCheckInterval = 10 * time.Second
+
+// certReloader holds the serving certificate and the client CA pool of the
+// gRPC listener. Both are read from disk again when the files change, so a
+// rotated certificate (e.g. renewed by cert-manager in a mounted Secret) is
+// served to new connections without a restart. Existing connections keep
+// the certificate they were established with.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	logger       *zap.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  [3]time.Time
+	checkedAt time.Time
+}
+
+// newServerTLSConfig returns the TLS configuration of the gRPC listener:
+// certFile and keyFile are the serving certificate and, when clientCAFile is
+// set, clients must present a certificate signed by one of its CAs (mTLS).
+func newServerTLSConfig(certFile, keyFile, clientCAFile string, logger *zap.Logger) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("TLSCertFile and TLSKeyFile are both required for TLS")
+	}
+	r := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		logger:       logger,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.configForClient(), nil
+		},
+	}, nil
+}
+
+// configForClient returns the configuration for a new connection, reloading
+// the files first when they changed.
+func (r *certReloader) configForClient() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= tlsReloadCheckInterval {
+		r.checkedAt = time.Now()
+		if r.changed() {
+			if err := r.loadLocked(); err != nil {
+				// Keep serving the previous material; a half-written
+				// rotation is retried on the next check.
+				r.logger.Warn("failed to reload TLS certificates, keeping the previous ones", zap.Error(err))
+			} else {
+				r.logger.Info("reloaded TLS certificates",
+					zap.String("cert", r.certFile),
+					zap.String("client_ca", r.clientCAFile))
+			}
+		}
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+		NextProtos:   []string{"h2"},
+	}
+	if r.clientCAs != nil {
+		config.ClientCAs = r.clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config
+}
+
+func (r *certReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = time.Now()
+	return r.loadLocked()
+}
+
+// loadLocked reads the certificate, key and client CA. r.mu must be held.
+func (r *certReloader) loadLocked() error {
+	modTimes, err := r.statFiles()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.clientCAFile)
+		}
+	}
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed reports whether any file was modified since the last load.
+func (r *certReloader) changed() bool {
+	modTimes, err := r.statFiles()
+	if err != nil {
+		// Mounted Secrets are swapped through a symlink; a missing file is
+		// usually the middle of a swap. Try again on the next check.
+		return false
+	}
+	return modTimes != r.modTimes
+}
+
+func (r *certReloader) statFiles() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, path := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCert issues a certificate for name, self-signed when parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	pair, err := tls.X509KeyPair(c.pem, c.keyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake runs a TLS handshake between the server config and a client
+// trusting ca, presenting clientCert when non-nil.
+func handshake(t *testing.T, server *tls.Config, ca *testCert, clientCert *tls.Certificate) error {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &tls.Config{RootCAs: roots, ServerName: "extproc.ns.svc", NextProtos: []string{"h2"}}
+	if clientCert != nil {
+		client.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		// The handshake runs on the first write; a rejected client
+		// certificate makes it fail and sends the client an alert.
+		_, _ = conn.Write([]byte{0})
+	}()
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", listener.Addr().String(), client)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// With TLS 1.3 the client finishes its handshake before the server has
+	// verified its certificate; the rejection surfaces on the first read.
+	_, err = conn.Read(make([]byte, 1))
+	return err
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "extproc.ns.svc", ca)
+	clientPair := newTestCert(t, "envoy", ca).tlsCertificate(t)
+	untrusted := newTestCert(t, "envoy", newTestCert(t, "other-ca", nil)).tlsCertificate(t)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	now := time.Now()
+	writeFile(t, certFile, server.pem, now)
+	writeFile(t, keyFile, server.keyPEM(t), now)
+	writeFile(t, caFile, ca.pem, now)
+
+	t.Run("key without certificate", func(t *testing.T) {
+		if _, err := newServerTLSConfig("", keyFile, "", zap.NewNop()); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("server TLS", func(t *testing.T) {
+		config, err := newServerTLSConfig(certFile, keyFile, "", zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := handshake(t, config, ca, nil); err != nil {
+			t.Errorf("handshake without a client certificate failed: %v", err)
+		}
+	})
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		config, err := newServerTLSConfig(certFile, keyFile, caFile, zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := handshake(t, config, ca, &clientPair); err != nil {
+			t.Errorf("handshake with a trusted client certificate failed: %v", err)
+		}
+		if err := handshake(t, config, ca, nil); err == nil {
+			t.Error("handshake without a client certificate succeeded")
+		}
+		if err := handshake(t, config, ca, &untrusted); err == nil {
+			t.Error("handshake with an untrusted client certificate succeeded")
+		}
+	})
+}
+
+func TestCertReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	first := newTestCert(t, "extproc.ns.svc", ca)
+	second := newTestCert(t, "extproc.ns.svc", ca)
+
+	r := &certReloader{
+		certFile: filepath.Join(dir, "tls.crt"),
+		keyFile:  filepath.Join(dir, "tls.key"),
+		logger:   zap.NewNop(),
+	}
+	past := time.Now().Add(-time.Minute)
+	writeFile(t, r.certFile, first.pem, past)
+	writeFile(t, r.keyFile, first.keyPEM(t), past)
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	served := func() *big.Int {
+		r.checkedAt = time.Time{}
+		leaf, err := x509.ParseCertificate(r.configForClient().Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber
+	}
+	if got := served(); got.Cmp(first.cert.SerialNumber) != 0 {
+		t.Fatalf("serving serial %s, want the first certificate", got)
+	}
+
+	// A key that does not match the certificate keeps the previous pair.
+	writeFile(t, r.certFile, second.pem, time.Now())
+	if got := served(); got.Cmp(first.cert.SerialNumber) != 0 {
+		t.Errorf("serving serial %s after a half-written rotation, want the first certificate", got)
+	}
+
+	writeFile(t, r.keyFile, second.keyPEM(t), time.Now())
+	if got := served(); got.Cmp(second.cert.SerialNumber) != 0 {
+		t.Errorf("serving serial %s after rotation, want the second certificate", got)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/matcher"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// DebugTraceTokenHeader is the request header carrying the token a decision
+// trace request must present when the processor is configured with one. It
+// is removed from forwarded requests.
+const DebugTraceTokenHeader = "x-customrouter-debug-token"
+
+// maxTraceCandidates caps the candidate routes logged for one request, so a
+// host with thousands of routes does not produce an unbounded log entry.
+const maxTraceCandidates = 100
+
+// Outcomes of a traced request.
+const (
+	traceOutcomeForward       = "forward"
+	traceOutcomeRedirect      = "redirect"
+	traceOutcomeDenied        = "denied"
+	traceOutcomeUnmatched     = "unmatched"
+	traceOutcomeMaintenance   = "maintenance"
+	traceOutcomeTooLarge      = "too-large"
+	traceOutcomeUpgradeDenied = "upgrade-denied"
+)
+
+// RouteTracer is implemented by route finders able to report the routes a
+// lookup inspected, such as routes.K8sLoader and routes.BucketLoader.
+type RouteTracer interface {
+	TraceRoute(host string, req routes.RequestMatch) (*routes.Route, []routes.RouteCandidate)
+}
+
+// SetDebugTrace enables the per-request decision trace: a request carrying
+// the debug header set to "true" for one of hosts gets its routing decision
+// logged in full, whatever the log level. "*" allows every host; no hosts
+// disables tracing. A non-empty token must also be sent in
+// DebugTraceTokenHeader.
+func (p *Processor) SetDebugTrace(hosts []string, token string) {
+	p.debugTraceToken = token
+	p.SetDebugTraceHosts(hosts)
+}
+
+// SetDebugTraceHosts replaces the hosts allowed a decision trace (see
+// SetDebugTrace). It is safe to call while the processor serves requests.
+func (p *Processor) SetDebugTraceHosts(hosts []string) {
+	if len(hosts) == 0 {
+		p.debugTraceHosts.Store(nil)
+		return
+	}
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = true
+	}
+	p.debugTraceHosts.Store(&allowed)
+}
+
+// traceRequested reports whether a request to authority with headers asks
+// for a decision trace and is allowed one.
+func (p *Processor) traceRequested(authority string, headers map[string]string) bool {
+	allowed := p.debugTraceHosts.Load()
+	if allowed == nil || !strings.EqualFold(headers[p.debugHeaderName()], "true") {
+		return false
+	}
+	if !(*allowed)["*"] && !(*allowed)[strings.ToLower(matcher.StripPort(authority))] {
+		return false
+	}
+	if p.debugTraceToken == "" {
+		return true
+	}
+	token := headers[DebugTraceTokenHeader]
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.debugTraceToken)) == 1
+}
+
+// traceRemoveHeaders returns the request headers stripped from forwarded
+// requests so the trace token never reaches upstreams.
+func (p *Processor) traceRemoveHeaders() []string {
+	if p.debugTraceToken == "" {
+		return nil
+	}
+	return []string{DebugTraceTokenHeader}
+}
+
+// findRoute looks up the route of a request. With a non-nil trace it records
+// the routes inspected, when the route finder can report them.
+func (p *Processor) findRoute(host string, match routes.RequestMatch, trace *decisionTrace) *routes.Route {
+	if trace != nil {
+		if tracer, ok := p.routeFinder.(RouteTracer); ok {
+			route, candidates := tracer.TraceRoute(host, match)
+			trace.candidates = candidates
+			return route
+		}
+	}
+	return p.routeFinder.FindRoute(host, match)
+}
+
+// decisionTrace collects the routing decision of a traced request.
+type decisionTrace struct {
+	host   string
+	path   string
+	method string
+
+	// variant is the route table variant the request selected.
+	variant string
+
+	// candidates are the routes inspected by the lookup, in order.
+	candidates []routes.RouteCandidate
+}
+
+// traceCandidate is the logged form of a route.
+type traceCandidate struct {
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Method   string `json:"method,omitempty"`
+	Priority int32  `json:"priority"`
+	ID       string `json:"id,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Rule     string `json:"rule,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Variant  string `json:"variant,omitempty"`
+	Draining bool   `json:"draining,omitempty"`
+	Backend  string `json:"backend,omitempty"`
+	Skipped  string `json:"skipped,omitempty"`
+}
+
+func newTraceCandidate(route *routes.Route, skipped string) traceCandidate {
+	return traceCandidate{
+		Path:     route.Path,
+		Type:     route.Type,
+		Method:   route.Method,
+		Priority: route.Priority,
+		ID:       route.ID,
+		Source:   route.Source,
+		Rule:     route.SourceRule,
+		Owner:    route.Owner,
+		Variant:  route.Variant,
+		Draining: route.Draining,
+		Backend:  route.Backend,
+		Skipped:  skipped,
+	}
+}
+
+// log writes the decision trail of the request: the candidates inspected
+// and why each was skipped, then the outcome and the route it applied. A
+// nil trace logs nothing.
+func (t *decisionTrace) log(logger *zap.Logger, outcome string, route *routes.Route, fields ...zap.Field) {
+	if t == nil {
+		return
+	}
+
+	inspected := t.candidates
+	if len(inspected) > maxTraceCandidates {
+		inspected = inspected[:maxTraceCandidates]
+	}
+	candidates := make([]traceCandidate, 0, len(inspected))
+	for _, c := range inspected {
+		candidates = append(candidates, newTraceCandidate(c.Route, c.Skipped))
+	}
+
+	fields = append([]zap.Field{
+		zap.String("host", t.host),
+		zap.String("path", t.path),
+		zap.String("method", t.method),
+		zap.String("variant", t.variant),
+		zap.String("outcome", outcome),
+		zap.Int("candidates_inspected", len(t.candidates)),
+		zap.Any("candidates", candidates),
+	}, fields...)
+	if omitted := len(t.candidates) - len(inspected); omitted > 0 {
+		fields = append(fields, zap.Int("candidates_omitted", omitted))
+	}
+	if route != nil {
+		fields = append(fields,
+			zap.Any("matched", newTraceCandidate(route, "")),
+			zap.String("description", route.Description),
+			zap.Any("actions", route.Actions),
+		)
+	}
+	logger.Info("decision trace", fields...)
+}
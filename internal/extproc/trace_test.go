@@ -0,0 +1,122 @@
+package extproc
+
+import (
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func traceTestConfig() *routes.RoutesConfig {
+	return &routes.RoutesConfig{
+		Version: 1,
+		Hosts: map[string][]routes.Route{
+			"example.com": {
+				{Path: "/api", Type: routes.RouteTypePrefix, Method: "POST", Backend: "post.default.svc.cluster.local:8080"},
+				{Path: "/admin", Type: routes.RouteTypePrefix, Backend: "admin.default.svc.cluster.local:8080"},
+				{Path: "/api", Type: routes.RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080"},
+			},
+		},
+	}
+}
+
+func TestProcessRequestHeaders_DebugTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   []string
+		token   string
+		debug   string
+		sent    string
+		path    string
+		traced  bool
+		outcome string
+	}{
+		{name: "disabled", debug: "true", path: "/api/items"},
+		{name: "traced", hosts: []string{"example.com"}, debug: "true", path: "/api/items", traced: true, outcome: traceOutcomeForward},
+		{name: "any host", hosts: []string{"*"}, debug: "TRUE", path: "/api/items", traced: true, outcome: traceOutcomeForward},
+		{name: "unmatched", hosts: []string{"example.com"}, debug: "true", path: "/other", traced: true, outcome: traceOutcomeUnmatched},
+		{name: "header not true", hosts: []string{"example.com"}, debug: "1", path: "/api/items"},
+		{name: "host not allowed", hosts: []string{"other.com"}, debug: "true", path: "/api/items"},
+		{name: "token", hosts: []string{"example.com"}, token: "s3cret", sent: "s3cret", debug: "true", path: "/api/items", traced: true, outcome: traceOutcomeForward},
+		{name: "wrong token", hosts: []string{"example.com"}, token: "s3cret", sent: "guess", debug: "true", path: "/api/items"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.InfoLevel)
+			p := NewProcessor(traceTestConfig(), zap.New(core), false)
+			p.SetDebugTrace(tt.hosts, tt.token)
+
+			headers := []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: tt.path},
+				{Key: ":method", Value: "GET"},
+				{Key: "x-customrouter-debug", Value: tt.debug},
+			}
+			if tt.sent != "" {
+				headers = append(headers, &corev3.HeaderValue{Key: DebugTraceTokenHeader, Value: tt.sent})
+			}
+			resp, _, err := p.processRequestHeaders(&extprocv3.HttpHeaders{
+				Headers: &corev3.HeaderMap{Headers: headers},
+			}, &streamContext{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.token != "" {
+				removed := false
+				for _, h := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders() {
+					removed = removed || h == DebugTraceTokenHeader
+				}
+				if !removed {
+					t.Errorf("%s must be removed from forwarded requests", DebugTraceTokenHeader)
+				}
+			}
+
+			entries := logs.FilterMessage("decision trace").All()
+			if !tt.traced {
+				if len(entries) != 0 {
+					t.Fatalf("expected no decision trace, got %d", len(entries))
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 decision trace, got %d", len(entries))
+			}
+			fields := entries[0].ContextMap()
+			if fields["outcome"] != tt.outcome {
+				t.Errorf("outcome = %v, want %s", fields["outcome"], tt.outcome)
+			}
+			candidates, ok := fields["candidates"].([]traceCandidate)
+			if !ok {
+				t.Fatalf("candidates = %#v", fields["candidates"])
+			}
+			if tt.outcome == traceOutcomeUnmatched {
+				if len(candidates) != 3 {
+					t.Fatalf("expected every route inspected, got %+v", candidates)
+				}
+				if _, ok := fields["matched"]; ok {
+					t.Error("an unmatched request must not log a matched route")
+				}
+				return
+			}
+			want := []string{routes.MismatchMethod, routes.MismatchPath, ""}
+			if len(candidates) != len(want) {
+				t.Fatalf("expected %d candidates, got %+v", len(want), candidates)
+			}
+			for i, c := range candidates {
+				if c.Skipped != want[i] {
+					t.Errorf("candidate %d skipped = %q, want %q", i, c.Skipped, want[i])
+				}
+			}
+			matched, ok := fields["matched"].(traceCandidate)
+			if !ok || matched.Backend != "api.default.svc.cluster.local:8080" {
+				t.Errorf("matched = %#v, want the api route", fields["matched"])
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// SetUnmatchedPolicy configures what happens to requests matching no route
+// when neither the hostname nor the attachment sets a policy (one of the
+// routes.Unmatched* constants). The default is passthrough.
+func (p *Processor) SetUnmatchedPolicy(policy string) {
+	p.unmatchedPolicy = policy
+}
+
+// streamUnmatchedPolicy returns the unmatchedRequestPolicy an
+// ExternalProcessorAttachment passed as gRPC initial metadata, or "" when
+// none (or an unknown one) was set.
+func streamUnmatchedPolicy(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(routes.UnmatchedPolicyMetadataKey)
+	if len(values) == 0 || !routes.ValidUnmatchedPolicy(values[0]) {
+		return ""
+	}
+	return values[0]
+}
+
+// resolveUnmatchedPolicy returns the policy applied to an unmatched request.
+// The hostname's policy (carried by its fallback route, if any) wins over the
+// attachment's, which wins over the processor default.
+func (p *Processor) resolveUnmatchedPolicy(fallback *routes.Route, streamCtx *streamContext) string {
+	if fallback != nil && fallback.UnmatchedPolicy != "" {
+		return fallback.UnmatchedPolicy
+	}
+	if streamCtx.unmatchedPolicy != "" {
+		return streamCtx.unmatchedPolicy
+	}
+	return p.unmatchedPolicy
+}
+
+// unmatchedStatus returns the status an unmatched request is answered with
+// under policy, or 0 when it passes through.
+func unmatchedStatus(policy string) typev3.StatusCode {
+	switch policy {
+	case routes.UnmatchedNotFound:
+		return typev3.StatusCode_NotFound
+	case routes.UnmatchedServiceUnavailable:
+		return typev3.StatusCode_ServiceUnavailable
+	}
+	return 0
+}
+
+// buildUnmatchedResponse answers an unmatched request with status, so it
+// never reaches whatever Envoy route would otherwise take it.
+func buildUnmatchedResponse(status typev3.StatusCode) *extprocv3.ProcessingResponse {
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: status},
+				Details: "customrouter_no_route",
+			},
+		},
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/freepik-company/customrouter/pkg/matcher"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// Values of the action label of upgradeRequestsTotal.
+const (
+	upgradeActionStripped = "stripped"
+	upgradeActionDenied   = "denied"
+)
+
+// stripsUpgrade reports whether route forwards the request with its Upgrade
+// and Connection headers removed by a strip-upgrade action.
+func stripsUpgrade(route *routes.Route, requestHeaders map[string]string) bool {
+	if !matcher.IsUpgrade(requestHeaders) {
+		return false
+	}
+	for _, action := range route.Actions {
+		if action.Type == routes.ActionTypeStripUpgrade {
+			return true
+		}
+	}
+	return false
+}
+
+// buildUpgradeDeniedResponse rejects an upgrade attempt on a route with a
+// deny-upgrade action, so it never reaches a backend unable to handle it.
+func buildUpgradeDeniedResponse(status int32) *extprocv3.ProcessingResponse {
+	return &extprocv3.ProcessingResponse{
+		Response: &extprocv3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &extprocv3.ImmediateResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(status)},
+				Details: "customrouter_upgrade_denied",
+			},
+		},
+	}
+}
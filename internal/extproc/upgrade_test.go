@@ -0,0 +1,73 @@
+package extproc
+
+import (
+	"slices"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestProcessRequest_UpgradeActions(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      routes.RouteAction
+		upgrade     bool
+		wantStatus  int32
+		wantRemoved bool
+	}{
+		{name: "deny-upgrade rejects an upgrade", action: routes.RouteAction{Type: routes.ActionTypeDenyUpgrade, UpgradeStatusCode: 426}, upgrade: true, wantStatus: 426},
+		{name: "deny-upgrade forwards a plain request", action: routes.RouteAction{Type: routes.ActionTypeDenyUpgrade, UpgradeStatusCode: 400}},
+		{name: "strip-upgrade removes the upgrade headers", action: routes.RouteAction{Type: routes.ActionTypeStripUpgrade}, upgrade: true, wantRemoved: true},
+		{name: "strip-upgrade leaves a plain request", action: routes.RouteAction{Type: routes.ActionTypeStripUpgrade}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &routes.Route{
+				Path:    "/",
+				Type:    routes.RouteTypePrefix,
+				Backend: "legacy.default.svc.cluster.local:8080",
+				Actions: []routes.RouteAction{tt.action},
+			}
+			p := NewProcessor(staticRouteFinder{route: route}, zap.NewNop(), false)
+			headers := []*corev3.HeaderValue{
+				{Key: ":authority", Value: "example.com"},
+				{Key: ":path", Value: "/socket"},
+				{Key: ":method", Value: "GET"},
+			}
+			if tt.upgrade {
+				headers = append(headers,
+					&corev3.HeaderValue{Key: "upgrade", Value: "websocket"},
+					&corev3.HeaderValue{Key: "connection", Value: "Upgrade"},
+				)
+			}
+			resp, _, err := p.processRequest(&extprocv3.ProcessingRequest{
+				Request: &extprocv3.ProcessingRequest_RequestHeaders{
+					RequestHeaders: &extprocv3.HttpHeaders{
+						Headers:     &corev3.HeaderMap{Headers: headers},
+						EndOfStream: true,
+					},
+				},
+			}, &streamContext{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if status := int32(resp.GetImmediateResponse().GetStatus().GetCode()); status != tt.wantStatus {
+				t.Fatalf("immediate response status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantStatus != 0 {
+				return
+			}
+			removed := resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders()
+			stripped := slices.Contains(removed, "upgrade") && slices.Contains(removed, "connection")
+			if stripped != tt.wantRemoved {
+				t.Errorf("removed headers = %v, want upgrade headers removed = %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
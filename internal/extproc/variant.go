@@ -0,0 +1,58 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// SetVariantSelector configures how the route table variant of a request
+// is selected, when the attachment sets no variantSelector. The zero value
+// selects none, so only routes without a variant match.
+func (p *Processor) SetVariantSelector(s routes.VariantSelector) {
+	p.variantSelector = s
+}
+
+// streamVariantSelector returns the variantSelector an
+// ExternalProcessorAttachment passed as gRPC initial metadata.
+func streamVariantSelector(ctx context.Context) routes.VariantSelector {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return routes.VariantSelector{}
+	}
+	var s routes.VariantSelector
+	if values := md.Get(routes.VariantHeaderMetadataKey); len(values) > 0 {
+		s.Header = values[0]
+	}
+	if values := md.Get(routes.VariantCookieMetadataKey); len(values) > 0 {
+		s.Cookie = values[0]
+	}
+	return s
+}
+
+// resolveVariantSelector returns the variant selector of the requests of a
+// stream: the attachment's over the processor default.
+func (p *Processor) resolveVariantSelector(streamCtx *streamContext) routes.VariantSelector {
+	if streamCtx == nil {
+		return p.variantSelector
+	}
+	return p.variantSelector.Merge(streamCtx.variantSelector)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extproc
+
+import (
+	"context"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func TestStreamVariantSelector(t *testing.T) {
+	if got := streamVariantSelector(context.Background()); got != (routes.VariantSelector{}) {
+		t.Errorf("without metadata = %+v, want none", got)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		routes.VariantHeaderMetadataKey, "x-env",
+		routes.VariantCookieMetadataKey, "env"))
+	want := routes.VariantSelector{Header: "x-env", Cookie: "env"}
+	if got := streamVariantSelector(ctx); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestProcessRequestHeaders_Variant(t *testing.T) {
+	config := &routes.RoutesConfig{Hosts: map[string][]routes.Route{
+		"app.example.com": {
+			{Path: "/", Type: routes.RouteTypePrefix, Backend: "blue.default.svc.cluster.local:8080"},
+			{Path: "/", Type: routes.RouteTypePrefix, Backend: "green.default.svc.cluster.local:8080", Variant: "green"},
+		},
+	}}
+	config.BuildVariantIndex()
+
+	tests := []struct {
+		name    string
+		flags   routes.VariantSelector
+		stream  routes.VariantSelector
+		headers []*corev3.HeaderValue
+		want    string
+	}{
+		{
+			name:    "no selector",
+			headers: []*corev3.HeaderValue{{Key: "x-env", Value: "green"}},
+			want:    "blue.default.svc.cluster.local:8080",
+		},
+		{
+			name:    "header of the processor flags",
+			flags:   routes.VariantSelector{Header: "X-Env"},
+			headers: []*corev3.HeaderValue{{Key: "x-env", Value: "green"}},
+			want:    "green.default.svc.cluster.local:8080",
+		},
+		{
+			name:    "unknown variant falls back to the default routes",
+			flags:   routes.VariantSelector{Header: "x-env"},
+			headers: []*corev3.HeaderValue{{Key: "x-env", Value: "purple"}},
+			want:    "blue.default.svc.cluster.local:8080",
+		},
+		{
+			name:    "cookie of the attachment",
+			flags:   routes.VariantSelector{Header: "x-env"},
+			stream:  routes.VariantSelector{Cookie: "env"},
+			headers: []*corev3.HeaderValue{{Key: "x-env", Value: "blue"}, {Key: "cookie", Value: "session=1; env=green"}},
+			want:    "green.default.svc.cluster.local:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(tableRouteFinder{config: config}, zap.NewNop(), false)
+			p.SetVariantSelector(tt.flags)
+
+			headers := append([]*corev3.HeaderValue{
+				{Key: ":authority", Value: "app.example.com"},
+				{Key: ":path", Value: "/checkout"},
+			}, tt.headers...)
+			request := &extprocv3.HttpHeaders{Headers: &corev3.HeaderMap{Headers: headers}}
+			_, reqCtx, err := p.processRequestHeaders(request, &streamContext{variantSelector: tt.stream})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reqCtx.matchedBackend != tt.want {
+				t.Errorf("backend = %q, want %q", reqCtx.matchedBackend, tt.want)
+			}
+		})
+	}
+}
@@ -32,6 +32,7 @@ import (
 
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -42,12 +43,26 @@ import (
 
 // +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;create;update
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch;update;patch
+
+const (
+	// CustomHTTPRouteCRDName is the CRD served in several versions, whose
+	// conversion requests are answered by this operator.
+	CustomHTTPRouteCRDName = "customhttproutes.customrouter.freepik.com"
+
+	// ConversionWebhookPath is where controller-runtime serves CRD conversion.
+	ConversionWebhookPath = "/convert"
+)
 
 // EnsureCerts ensures a self-signed CA and server certificate exist in a shared Secret.
 // If the Secret already exists and the certs are valid, they are reused so that all
 // replicas share the same TLS identity. Otherwise, new certs are generated and stored.
-// Returns the CA PEM for use by the CABundleReconciler.
-func EnsureCerts(ctx context.Context, cl client.Client, certDir, webhookConfigName, serviceName, namespace string) ([]byte, error) {
+// The CRDs in conversionCRDs are pointed at the webhook Service as their
+// conversion webhook. Returns the CA PEM for use by the CABundleReconciler.
+func EnsureCerts(
+	ctx context.Context, cl client.Client, certDir, webhookConfigName, serviceName, namespace string,
+	conversionCRDs []string,
+) ([]byte, error) {
 	secretName := serviceName + "-tls"
 
 	dnsNames := []string{
@@ -95,6 +110,13 @@ func EnsureCerts(ctx context.Context, cl client.Client, certDir, webhookConfigNa
 		return nil, err
 	}
 
+	// --- Patch CRD conversion webhooks ---
+	for _, crdName := range conversionCRDs {
+		if err := patchCRDConversion(ctx, cl, crdName, serviceName, namespace, caPEM); err != nil {
+			return nil, err
+		}
+	}
+
 	return caPEM, nil
 }
 
@@ -291,13 +313,47 @@ func patchWebhookConfig(ctx context.Context, cl client.Client, webhookConfigName
 	})
 }
 
+// patchCRDConversion switches the CRD to webhook conversion served by the
+// given Service, trusting caPEM.
+func patchCRDConversion(ctx context.Context, cl client.Client, crdName, serviceName, namespace string, caPEM []byte) error {
+	path := ConversionWebhookPath
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var crd apiextensionsv1.CustomResourceDefinition
+		if err := cl.Get(ctx, types.NamespacedName{Name: crdName}, &crd); err != nil {
+			return fmt.Errorf("getting CRD %q: %w", crdName, err)
+		}
+		crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{
+			Strategy: apiextensionsv1.WebhookConverter,
+			Webhook: &apiextensionsv1.WebhookConversion{
+				ClientConfig: &apiextensionsv1.WebhookClientConfig{
+					Service: &apiextensionsv1.ServiceReference{
+						Namespace: namespace,
+						Name:      serviceName,
+						Path:      &path,
+					},
+					CABundle: caPEM,
+				},
+				ConversionReviewVersions: []string{"v1"},
+			},
+		}
+		return cl.Update(ctx, &crd)
+	})
+}
+
 // CABundleReconciler periodically ensures the ValidatingWebhookConfiguration
-// has the correct CA bundle. This handles Helm upgrades that may wipe the caBundle.
+// has the correct CA bundle, and the ConversionCRDs the conversion webhook.
+// This handles Helm upgrades (or CRD re-applies) that may wipe them.
 type CABundleReconciler struct {
 	Client     client.Client
 	ConfigName string
 	CaPEM      []byte
 	Interval   time.Duration
+
+	// ConversionCRDs, ServiceName and Namespace describe the CRDs whose
+	// conversion webhook is kept pointing at this operator's webhook Service.
+	ConversionCRDs []string
+	ServiceName    string
+	Namespace      string
 }
 
 func (r *CABundleReconciler) Start(ctx context.Context) error {
@@ -311,6 +367,11 @@ func (r *CABundleReconciler) Start(ctx context.Context) error {
 			if err := patchWebhookConfig(ctx, r.Client, r.ConfigName, r.CaPEM); err != nil {
 				log.FromContext(ctx).Error(err, "failed to reconcile CA bundle")
 			}
+			for _, crdName := range r.ConversionCRDs {
+				if err := patchCRDConversion(ctx, r.Client, crdName, r.ServiceName, r.Namespace, r.CaPEM); err != nil {
+					log.FromContext(ctx).Error(err, "failed to reconcile CRD conversion webhook", "crd", crdName)
+				}
+			}
 		}
 	}
 }
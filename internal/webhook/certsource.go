@@ -0,0 +1,122 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// CertSource selects where the webhook serving certificate comes from.
+type CertSource string
+
+const (
+	// CertSourceSelfSigned generates a self-signed CA and certificate
+	// (EnsureCerts) and keeps the CA bundle of the webhook configuration
+	// and the conversion CRDs patched.
+	CertSourceSelfSigned CertSource = "self-signed"
+
+	// CertSourceCertManager serves a certificate cert-manager issues into
+	// the Secret mounted at --webhook-cert-path. cert-manager's CA injector
+	// maintains the CA bundles, so the operator patches none.
+	CertSourceCertManager CertSource = "cert-manager"
+
+	// CertSourceSecret serves a certificate from a Secret mounted at
+	// --webhook-cert-path. The CA bundles are left to whoever manages the
+	// Secret.
+	CertSourceSecret CertSource = "secret"
+)
+
+// certManagerInjectAnnotations are the annotations asking cert-manager's CA
+// injector to set the CA bundle of an object.
+var certManagerInjectAnnotations = []string{
+	"cert-manager.io/inject-ca-from",
+	"cert-manager.io/inject-ca-from-secret",
+}
+
+// ParseCertSource parses the --webhook-cert-source flag value. Empty keeps
+// the behavior from before the flag existed: a certificate mounted at
+// certPath is served as a secret, otherwise one is self-signed.
+func ParseCertSource(value, certPath string) (CertSource, error) {
+	source := CertSource(value)
+	switch source {
+	case "":
+		if certPath != "" {
+			return CertSourceSecret, nil
+		}
+		return CertSourceSelfSigned, nil
+	case CertSourceSelfSigned:
+		return source, nil
+	case CertSourceCertManager, CertSourceSecret:
+		if certPath == "" {
+			return "", fmt.Errorf("--webhook-cert-source=%s requires --webhook-cert-path", source)
+		}
+		return source, nil
+	}
+	return "", fmt.Errorf("invalid --webhook-cert-source %q: expected self-signed, cert-manager or secret", value)
+}
+
+// PatchesCABundle reports whether the operator maintains the CA bundles of
+// the webhook configuration and conversion CRDs for certificates from s.
+func (s CertSource) PatchesCABundle() bool {
+	return s == CertSourceSelfSigned
+}
+
+// NewCertWatcher returns a watcher serving the certificate and key files in
+// certDir, reloaded whenever they change on disk (e.g. when the kubelet
+// updates a mounted Secret after a rotation). It must be added to the
+// manager to start watching, and fails when the files cannot be read.
+func NewCertWatcher(certDir, certName, keyName string) (*certwatcher.CertWatcher, error) {
+	watcher, err := certwatcher.New(filepath.Join(certDir, certName), filepath.Join(certDir, keyName))
+	if err != nil {
+		return nil, fmt.Errorf("loading webhook certificate from %s: %w", certDir, err)
+	}
+	logger := log.Log.WithName("webhook-certs")
+	watcher.RegisterCallback(func(cert tls.Certificate) {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			logger.Info("webhook certificate loaded",
+				"subject", leaf.Subject.String(), "serial", leaf.SerialNumber.String(), "notAfter", leaf.NotAfter)
+		}
+	})
+	return watcher, nil
+}
+
+// CheckCAInjection returns an error when the ValidatingWebhookConfiguration
+// named configName does not ask cert-manager to inject its CA bundle, so the
+// API server would not trust a cert-manager issued certificate.
+func CheckCAInjection(ctx context.Context, cl client.Client, configName string) error {
+	var webhookConfig admissionregistrationv1.ValidatingWebhookConfiguration
+	if err := cl.Get(ctx, types.NamespacedName{Name: configName}, &webhookConfig); err != nil {
+		return fmt.Errorf("getting webhook config %q: %w", configName, err)
+	}
+	for _, annotation := range certManagerInjectAnnotations {
+		if webhookConfig.Annotations[annotation] != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook config %q has no %s annotation: cert-manager will not inject its CA bundle",
+		configName, certManagerInjectAnnotations[0])
+}
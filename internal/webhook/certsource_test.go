@@ -0,0 +1,115 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseCertSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		certPath string
+		want     CertSource
+		wantErr  bool
+	}{
+		{name: "empty without cert path", want: CertSourceSelfSigned},
+		{name: "empty with cert path", certPath: "/certs", want: CertSourceSecret},
+		{name: "self-signed", value: "self-signed", want: CertSourceSelfSigned},
+		{name: "self-signed with cert path", value: "self-signed", certPath: "/certs", want: CertSourceSelfSigned},
+		{name: "cert-manager", value: "cert-manager", certPath: "/certs", want: CertSourceCertManager},
+		{name: "secret", value: "secret", certPath: "/certs", want: CertSourceSecret},
+		{name: "cert-manager without cert path", value: "cert-manager", wantErr: true},
+		{name: "secret without cert path", value: "secret", wantErr: true},
+		{name: "unknown", value: "vault", certPath: "/certs", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCertSource(tt.value, tt.certPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCertSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCertSource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCertWatcher(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewCertWatcher(dir, "tls.crt", "tls.key"); err == nil {
+		t.Fatal("NewCertWatcher() succeeded without certificate files")
+	}
+
+	_, certPEM, keyPEM, err := generateCerts("webhook", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCertsToDisk(dir, certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := NewCertWatcher(dir, "tls.crt", "tls.key")
+	if err != nil {
+		t.Fatalf("NewCertWatcher() error = %v", err)
+	}
+	cert, err := watcher.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("GetCertificate() = %v, %v", cert, err)
+	}
+}
+
+func TestCheckCAInjection(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = admissionregistrationv1.AddToScheme(scheme)
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{name: "inject-ca-from", annotations: map[string]string{"cert-manager.io/inject-ca-from": "ns/cert"}},
+		{name: "inject-ca-from-secret", annotations: map[string]string{"cert-manager.io/inject-ca-from-secret": "ns/secret"}},
+		{name: "no annotation", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &admissionregistrationv1.ValidatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: "customrouter", Annotations: tt.annotations},
+			}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()
+			err := CheckCAInjection(context.Background(), cl, "customrouter")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckCAInjection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).Build()
+	if err := CheckCAInjection(context.Background(), cl, "missing"); err == nil {
+		t.Error("CheckCAInjection() succeeded for a missing webhook config")
+	}
+}
@@ -32,6 +32,7 @@ import (
 // CustomHTTPRouteValidator validates CustomHTTPRoute resources.
 type CustomHTTPRouteValidator struct {
 	checker *HostnameChecker
+	policy  *AdmissionPolicy
 }
 
 var _ admission.CustomValidator = &CustomHTTPRouteValidator{}
@@ -43,31 +44,67 @@ func (v *CustomHTTPRouteValidator) ValidateCreate(ctx context.Context, obj runti
 		return nil, fmt.Errorf("expected CustomHTTPRoute, got %T", obj)
 	}
 
-	if err := route.Validate(); err != nil {
-		return nil, err
-	}
-	warnings, err := v.checker.CheckCustomHTTPRouteHostnames(ctx, route)
-	if err != nil {
-		return nil, err
-	}
-	return warnings, nil
+	return v.validate(ctx, route, nil)
 }
 
 // ValidateUpdate validates a CustomHTTPRoute on update.
-func (v *CustomHTTPRouteValidator) ValidateUpdate(ctx context.Context, _ runtime.Object, newObj runtime.Object) (admission.Warnings, error) {
+func (v *CustomHTTPRouteValidator) ValidateUpdate(ctx context.Context, oldObj runtime.Object, newObj runtime.Object) (admission.Warnings, error) {
 	route, ok := newObj.(*customrouterv1alpha1.CustomHTTPRoute)
 	if !ok {
 		return nil, fmt.Errorf("expected CustomHTTPRoute, got %T", newObj)
 	}
+	oldRoute, _ := oldObj.(*customrouterv1alpha1.CustomHTTPRoute)
 
+	return v.validate(ctx, route, oldRoute)
+}
+
+// validate runs the structural validation, the overlap analysis of the
+// route's own matches, the namespace's target allow-list, the admission
+// policy, the hostname conflict checks, the loop check and the simulation of
+// the route's rules. All but the structural validation run on the route with
+// the defaults it inherits from CustomRouterConfigs. oldRoute is nil on
+// create.
+func (v *CustomHTTPRouteValidator) validate(
+	ctx context.Context,
+	route, oldRoute *customrouterv1alpha1.CustomHTTPRoute,
+) (admission.Warnings, error) {
 	if err := route.Validate(); err != nil {
 		return nil, err
 	}
+	// Everything below checks the route the controller serves, with the
+	// defaults of the CustomRouterConfigs selecting its namespace.
+	resolver, err := newRouterConfigResolver(ctx, v.checker.Client)
+	if err != nil {
+		return nil, err
+	}
+	if route, err = resolver.Resolve(route); err != nil {
+		return nil, err
+	}
+	if oldRoute, err = resolver.Resolve(oldRoute); err != nil {
+		return nil, err
+	}
+	overlapWarnings, err := CheckRuleOverlaps(route, oldRoute)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.checker.CheckNamespaceTargets(ctx, route, oldRoute, v.policy.targetAllowList()); err != nil {
+		return nil, err
+	}
+	policyWarnings, err := v.policy.Check(ctx, v.checker.Client, route, oldRoute)
+	if err != nil {
+		return nil, err
+	}
 	warnings, err := v.checker.CheckCustomHTTPRouteHostnames(ctx, route)
 	if err != nil {
 		return nil, err
 	}
-	return warnings, nil
+	if err := v.checker.CheckRouteLoops(ctx, route, oldRoute); err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, route.ActionOrderWarnings()...)
+	warnings = append(warnings, overlapWarnings...)
+	warnings = append(warnings, SimulateRules(route)...)
+	return append(policyWarnings, warnings...), nil
 }
 
 // ValidateDelete is a no-op for CustomHTTPRoute.
@@ -75,12 +112,17 @@ func (v *CustomHTTPRouteValidator) ValidateDelete(_ context.Context, _ runtime.O
 	return nil, nil
 }
 
-// SetupCustomHTTPRouteWebhookWithManager registers the CustomHTTPRoute validating webhook.
-func SetupCustomHTTPRouteWebhookWithManager(mgr ctrl.Manager) error {
+// SetupCustomHTTPRouteWebhookWithManager registers the CustomHTTPRoute validating
+// webhook. policy may be nil to enforce only the built-in validation.
+// Because v1alpha1 is the conversion hub, the builder also serves the CRD
+// conversion webhook at ConversionWebhookPath when the manager's scheme
+// holds the other CustomHTTPRoute versions.
+func SetupCustomHTTPRouteWebhookWithManager(mgr ctrl.Manager, policy *AdmissionPolicy) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&customrouterv1alpha1.CustomHTTPRoute{}).
 		WithValidator(&CustomHTTPRouteValidator{
 			checker: &HostnameChecker{Client: mgr.GetClient()},
+			policy:  policy,
 		}).
 		Complete()
 }
@@ -41,6 +41,8 @@ type HostnameChecker struct {
 
 // CheckCustomHTTPRouteHostnames checks whether any hostname in the given CustomHTTPRoute
 // conflicts with another CustomHTTPRoute (same targetRef) or any HTTPRoute in the cluster.
+// route must have the defaults it inherits from CustomRouterConfigs set; the
+// other CustomHTTPRoutes get theirs here.
 // A conflict requires overlapping hostnames AND overlapping route matches
 // (same path with compatible method/headers/query parameters and no specificity
 // tie-break — see matchesOverlap). It excludes self by UID to allow updates.
@@ -49,41 +51,27 @@ type HostnameChecker struct {
 // CustomHTTPRoute, the overlap is reported as a warning instead of an error.
 // Conflicts with HTTPRoutes are always errors regardless of AllowOverlap.
 func (c *HostnameChecker) CheckCustomHTTPRouteHostnames(ctx context.Context, route *customrouterv1alpha1.CustomHTTPRoute) (admission.Warnings, error) {
-	hostnames := route.Spec.Hostnames
+	hostnames := route.Spec.RoutedHostnames()
 	if len(hostnames) == 0 {
 		return nil, nil
 	}
 	hostnameSet := toSet(hostnames)
 	routeMatches := extractCustomRouteMatches(route)
 
-	var allWarnings admission.Warnings
-
 	// Check against other CustomHTTPRoutes with the same targetRef
 	var customRoutes customrouterv1alpha1.CustomHTTPRouteList
-	if err := c.Client.List(ctx, &customRoutes); err != nil {
+	if err := listCustomHTTPRoutes(ctx, c.Client, &customRoutes); err != nil {
 		return nil, fmt.Errorf("listing CustomHTTPRoutes: %w", err)
 	}
-
+	others := customRoutes.Items[:0]
 	for i := range customRoutes.Items {
-		other := &customRoutes.Items[i]
-		if other.UID == route.UID {
-			continue
-		}
-		if other.Spec.TargetRef.Name != route.Spec.TargetRef.Name {
-			continue
-		}
-		hostConflicts := findOverlap(hostnameSet, other.Spec.Hostnames)
-		if len(hostConflicts) == 0 {
-			continue
-		}
-		// Same target + same hostname: only conflict if route matches overlap
-		otherMatches := extractCustomRouteMatches(other)
-		conflictContext := fmt.Sprintf("CustomHTTPRoute %s (target %q)", formatNamespacedName(other), route.Spec.TargetRef.Name)
-		result := classifyOverlaps(routeMatches, otherMatches, hostConflicts, conflictContext)
-		if len(result.Errors) > 0 {
-			return nil, errors.New(strings.Join(result.Errors, "; "))
+		if customRoutes.Items[i].UID != route.UID {
+			others = append(others, customRoutes.Items[i])
 		}
-		allWarnings = append(allWarnings, result.Warnings...)
+	}
+	allWarnings, err := CheckCustomHTTPRouteConflicts(route, others)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check against HTTPRoutes (hostname + path + header overlap is always an error)
@@ -114,8 +102,49 @@ func (c *HostnameChecker) CheckCustomHTTPRouteHostnames(ctx context.Context, rou
 	return allWarnings, nil
 }
 
+// CheckCustomHTTPRouteConflicts is the CustomHTTPRoute part of
+// CheckCustomHTTPRouteHostnames: it checks route against others, which must
+// not include route itself, without reading the cluster. The offline linter
+// runs it on the routes of a set of manifests.
+func CheckCustomHTTPRouteConflicts(
+	route *customrouterv1alpha1.CustomHTTPRoute,
+	others []customrouterv1alpha1.CustomHTTPRoute,
+) (admission.Warnings, error) {
+	hostnameSet := toSet(route.Spec.RoutedHostnames())
+	if len(hostnameSet) == 0 {
+		return nil, nil
+	}
+	routeMatches := extractCustomRouteMatches(route)
+
+	var warnings admission.Warnings
+	for i := range others {
+		other := &others[i]
+		if other.Spec.TargetRef.Name != route.Spec.TargetRef.Name {
+			continue
+		}
+		// Routes of different variants never match the same request.
+		if other.Spec.Variant != route.Spec.Variant {
+			continue
+		}
+		hostConflicts := findOverlap(hostnameSet, other.Spec.RoutedHostnames())
+		if len(hostConflicts) == 0 {
+			continue
+		}
+		// Same target + same hostname: only conflict if route matches overlap
+		otherMatches := extractCustomRouteMatches(other)
+		conflictContext := fmt.Sprintf("CustomHTTPRoute %s (target %q)", formatNamespacedName(other), route.Spec.TargetRef.Name)
+		result := classifyOverlaps(routeMatches, otherMatches, hostConflicts, conflictContext)
+		if len(result.Errors) > 0 {
+			return nil, errors.New(strings.Join(result.Errors, "; "))
+		}
+		warnings = append(warnings, result.Warnings...)
+	}
+	return warnings, nil
+}
+
 // CheckHTTPRouteHostnames checks whether any hostname in the given HTTPRoute
-// conflicts with an existing CustomHTTPRoute.
+// conflicts with an existing CustomHTTPRoute, with the defaults it inherits
+// from CustomRouterConfigs set.
 // A conflict requires overlapping hostnames AND overlapping route matches
 // (same path with compatible method/headers/query parameters and no
 // specificity tie-break — see matchesOverlap).
@@ -128,13 +157,13 @@ func (c *HostnameChecker) CheckHTTPRouteHostnames(ctx context.Context, httpRoute
 	hrMatches := extractHTTPRouteMatches(httpRoute)
 
 	var customRoutes customrouterv1alpha1.CustomHTTPRouteList
-	if err := c.Client.List(ctx, &customRoutes); err != nil {
+	if err := listCustomHTTPRoutes(ctx, c.Client, &customRoutes); err != nil {
 		return fmt.Errorf("listing CustomHTTPRoutes: %w", err)
 	}
 
 	for i := range customRoutes.Items {
 		cr := &customRoutes.Items[i]
-		hostConflicts := findOverlap(hostnameSet, cr.Spec.Hostnames)
+		hostConflicts := findOverlap(hostnameSet, cr.Spec.RoutedHostnames())
 		if len(hostConflicts) == 0 {
 			continue
 		}
@@ -155,15 +184,21 @@ func (c *HostnameChecker) CheckHTTPRouteHostnames(ctx context.Context, httpRoute
 // SortRoutes cannot place one strictly before the other; see matchesOverlap.
 // Priority mirrors PathMatch.Priority and is the leading SortRoutes key, so a
 // less specific rule with higher Priority can shadow a more specific one — the
-// conflict check accounts for that.
+// conflict check accounts for that. Fraction is "numerator/denominator" for
+// a match restricted to a share of requests, and empty otherwise.
+// CaseInsensitive mirrors PathMatch.CaseInsensitive; HTTPRoute matches are
+// always case-sensitive.
 type routeMatch struct {
-	PathType     string
-	Path         string
-	Method       string
-	Headers      []headerMatch
-	QueryParams  []queryParamMatch
-	Priority     int32
-	AllowOverlap bool
+	PathType        string
+	Path            string
+	CaseInsensitive bool
+	Method          string
+	Scheme          string
+	Headers         []headerMatch
+	QueryParams     []queryParamMatch
+	Fraction        string
+	Priority        int32
+	AllowOverlap    bool
 }
 
 func (r routeMatch) String() string {
@@ -173,12 +208,18 @@ func (r routeMatch) String() string {
 	if r.Method != "" {
 		base = fmt.Sprintf("%s %s:%s", r.Method, r.PathType, r.Path)
 	}
+	if r.CaseInsensitive {
+		base += " (case-insensitive)"
+	}
 	parts = append(parts, base)
 
+	if r.Scheme != "" {
+		parts = append(parts, fmt.Sprintf("scheme[%s]", r.Scheme))
+	}
 	if len(r.Headers) > 0 {
 		hdrs := make([]string, len(r.Headers))
 		for i, h := range r.Headers {
-			hdrs[i] = fmt.Sprintf("%s=%s", h.Name, h.Value)
+			hdrs[i] = h.String()
 		}
 		parts = append(parts, fmt.Sprintf("headers[%s]", strings.Join(hdrs, ",")))
 	}
@@ -189,6 +230,9 @@ func (r routeMatch) String() string {
 		}
 		parts = append(parts, fmt.Sprintf("params[%s]", strings.Join(qps, ",")))
 	}
+	if r.Fraction != "" {
+		parts = append(parts, fmt.Sprintf("fraction[%s]", r.Fraction))
+	}
 
 	if len(parts) == 1 {
 		return parts[0]
@@ -201,10 +245,30 @@ func (r routeMatch) String() string {
 // the conflict detector can degrade contradiction checks to "matches all"
 // without dropping the entry from the constraint count (which feeds into
 // specificity comparisons aligned with SortRoutes).
+//
+// Op carries the presence and negation operators (routes.HeaderMatchExists,
+// routes.HeaderMatchAbsent, routes.HeaderMatchNotValue); it is empty for
+// exact and regex matches.
 type headerMatch struct {
 	Name    string
 	Value   string
 	IsRegex bool
+	Op      string
+}
+
+// String renders the match for conflict messages and dedup keys.
+func (h headerMatch) String() string {
+	switch {
+	case h.Op == routes.HeaderMatchExists:
+		return h.Name + " exists"
+	case h.Op == routes.HeaderMatchAbsent:
+		return h.Name + " absent"
+	case h.Op == routes.HeaderMatchNotValue:
+		return h.Name + "!=" + h.Value
+	case h.IsRegex:
+		return h.Name + "~" + h.Value
+	}
+	return h.Name + "=" + h.Value
 }
 
 // queryParamMatch represents an HTTP query parameter matching criterion. See
@@ -235,21 +299,44 @@ func extractCustomRouteMatches(route *customrouterv1alpha1.CustomHTTPRoute) []ro
 		prefixes = route.Spec.PathPrefixes.Values
 	}
 
-	for i := range route.Spec.Rules {
-		rule := &route.Spec.Rules[i]
+	// Inherited defaults matter here: spec.defaults.priority feeds the
+	// priority compared below. Disabled rules serve nothing and cannot
+	// conflict; enabling them again goes through this check.
+	rules := route.Spec.ActiveRules()
+	for i := range rules {
+		rule := &rules[i]
 		policy := routes.GetEffectivePolicy(route.Spec.PathPrefixes, rule)
 		expandTypes := routes.GetEffectiveExpandMatchTypes(route.Spec.PathPrefixes, rule)
 
-		for _, m := range rule.Matches {
+		// gRPC matches compare as their HTTP equivalent and, like in
+		// ExpandRoutes, are never prefixed.
+		grpcStart := len(rule.Matches)
+		ruleMatches := make([]customrouterv1alpha1.PathMatch, 0, grpcStart+len(rule.GRPCMatches))
+		ruleMatches = append(ruleMatches, rule.Matches...)
+		for _, gm := range rule.GRPCMatches {
+			ruleMatches = append(ruleMatches, gm.PathMatch())
+		}
+
+		for j, m := range ruleMatches {
 			method := string(m.Method)
+			scheme := string(m.Scheme)
 			headerMatches := convertCustomHeaderMatches(m.Headers)
 			queryMatches := convertCustomQueryParamMatches(m.QueryParams)
 			headerKey := headerMatchesKey(headerMatches)
 			queryKey := queryParamMatchesKey(queryMatches)
-			expandedPaths := expandMatchPath(m, prefixes, policy, expandTypes)
+			fraction := fractionKey(m.Fraction)
+			var expandedPaths []expandedPath
+			if j >= grpcStart {
+				expandedPaths = []expandedPath{{pathType: string(m.Type), path: m.Path}}
+			} else {
+				expandedPaths = expandMatchPath(m, prefixes, policy, expandTypes)
+			}
 			for _, ep := range expandedPaths {
 				path := normalizePath(ep.path)
-				key := ep.pathType + ":" + path + "|" + method + "|" + headerKey + "|" + queryKey
+				key := ep.pathType + ":" + path + "|" + method + "|" + scheme + "|" + headerKey + "|" + queryKey + "|" + fraction
+				if m.CaseInsensitive {
+					key += "|i"
+				}
 				if entry, ok := seen[key]; ok {
 					// Conservative: if new rule disables allowOverlap, override
 					if entry.allowOverlap && !rule.AllowOverlap {
@@ -260,13 +347,16 @@ func extractCustomRouteMatches(route *customrouterv1alpha1.CustomHTTPRoute) []ro
 				}
 				seen[key] = seenEntry{index: len(matches), allowOverlap: rule.AllowOverlap}
 				matches = append(matches, routeMatch{
-					PathType:     ep.pathType,
-					Path:         path,
-					Method:       method,
-					Headers:      headerMatches,
-					QueryParams:  queryMatches,
-					Priority:     m.Priority,
-					AllowOverlap: rule.AllowOverlap,
+					PathType:        ep.pathType,
+					Path:            path,
+					CaseInsensitive: m.CaseInsensitive,
+					Method:          method,
+					Scheme:          scheme,
+					Headers:         headerMatches,
+					QueryParams:     queryMatches,
+					Fraction:        fraction,
+					Priority:        m.Priority,
+					AllowOverlap:    rule.AllowOverlap,
 				})
 			}
 		}
@@ -274,6 +364,15 @@ func extractCustomRouteMatches(route *customrouterv1alpha1.CustomHTTPRoute) []ro
 	return matches
 }
 
+// fractionKey renders a match fraction as "numerator/denominator", or ""
+// when the match has none.
+func fractionKey(f *customrouterv1alpha1.Fraction) string {
+	if f == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", f.Numerator, f.EffectiveDenominator())
+}
+
 // convertCustomHeaderMatches converts CustomHTTPRoute HeaderMatches to the
 // internal headerMatch form used by overlap detection. Regex matches are kept
 // (so the constraint count matches what SortRoutes sees) but flagged as
@@ -285,11 +384,20 @@ func convertCustomHeaderMatches(in []customrouterv1alpha1.HeaderMatch) []headerM
 	}
 	out := make([]headerMatch, 0, len(in))
 	for _, h := range in {
-		out = append(out, headerMatch{
+		hm := headerMatch{
 			Name:    h.Name,
 			Value:   h.Value,
 			IsRegex: h.Type == customrouterv1alpha1.HeaderMatchTypeRegularExpression,
-		})
+		}
+		switch h.Type {
+		case customrouterv1alpha1.HeaderMatchTypeExists:
+			hm.Op = routes.HeaderMatchExists
+		case customrouterv1alpha1.HeaderMatchTypeAbsent:
+			hm.Op = routes.HeaderMatchAbsent
+		case customrouterv1alpha1.HeaderMatchTypeNotValue:
+			hm.Op = routes.HeaderMatchNotValue
+		}
+		out = append(out, hm)
 	}
 	sort.SliceStable(out, func(i, j int) bool {
 		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
@@ -304,11 +412,8 @@ func headerMatchesKey(hs []headerMatch) string {
 	}
 	parts := make([]string, len(hs))
 	for i, h := range hs {
-		marker := "="
-		if h.IsRegex {
-			marker = "~"
-		}
-		parts[i] = strings.ToLower(h.Name) + marker + h.Value
+		h.Name = strings.ToLower(h.Name)
+		parts[i] = h.String()
 	}
 	return strings.Join(parts, ",")
 }
@@ -360,7 +465,11 @@ func expandMatchPath(m customrouterv1alpha1.PathMatch, prefixes []string, policy
 	pathType := string(m.Type)
 
 	if !routes.ShouldExpandMatchType(m.Type, expandTypes) {
-		return []expandedPath{{pathType: pathType, path: m.Path}}
+		path := m.Path
+		if m.Type != customrouterv1alpha1.MatchTypeRegex {
+			path = routes.UnprefixedPath(path)
+		}
+		return []expandedPath{{pathType: pathType, path: path}}
 	}
 
 	// Regex: use the same expansion as the operator
@@ -372,21 +481,21 @@ func expandMatchPath(m customrouterv1alpha1.PathMatch, prefixes []string, policy
 	// Exact and PathPrefix
 	switch policy {
 	case customrouterv1alpha1.PathPrefixPolicyDisabled:
-		return []expandedPath{{pathType: pathType, path: m.Path}}
+		return []expandedPath{{pathType: pathType, path: routes.UnprefixedPath(m.Path)}}
 
 	case customrouterv1alpha1.PathPrefixPolicyRequired:
 		result := make([]expandedPath, 0, len(prefixes))
 		for _, prefix := range prefixes {
-			result = append(result, expandedPath{pathType: pathType, path: "/" + prefix + m.Path})
+			result = append(result, expandedPath{pathType: pathType, path: routes.PrefixPath(prefix, m.Path)})
 		}
 		return result
 
 	case customrouterv1alpha1.PathPrefixPolicyOptional:
 		result := make([]expandedPath, 0, len(prefixes)+1)
 		for _, prefix := range prefixes {
-			result = append(result, expandedPath{pathType: pathType, path: "/" + prefix + m.Path})
+			result = append(result, expandedPath{pathType: pathType, path: routes.PrefixPath(prefix, m.Path)})
 		}
-		result = append(result, expandedPath{pathType: pathType, path: m.Path})
+		result = append(result, expandedPath{pathType: pathType, path: routes.UnprefixedPath(m.Path)})
 		return result
 
 	default:
@@ -494,13 +603,14 @@ func matchesCrossKindOverlap(a, b routeMatch) bool {
 }
 
 // matchesRequestCompat returns true when two route matches have the same path
-// and their method/header/query parameter constraints are compatible — i.e.
+// and their method/scheme/header/query parameter constraints are compatible — i.e.
 // at least one HTTP request could satisfy both sets simultaneously.
 func matchesRequestCompat(a, b routeMatch) bool {
-	if a.PathType != b.PathType || a.Path != b.Path {
+	if a.PathType != b.PathType || !pathsEqual(a, b) {
 		return false
 	}
 	return methodsCompatible(a.Method, b.Method) &&
+		methodsCompatible(a.Scheme, b.Scheme) &&
 		headersCompatible(a.Headers, b.Headers) &&
 		queryParamsCompatible(a.QueryParams, b.QueryParams)
 }
@@ -539,13 +649,27 @@ func specificityResolvable(a, b routeMatch) bool {
 
 // atLeastAsSpecific returns true when every request matching a also matches b,
 // i.e. b's constraints are a subset of a's. Path is assumed equal by callers.
-// Method: a must constrain at least as much as b (b empty, or both equal).
+// Method and Scheme: a must constrain at least as much as b (b empty, or
+// both equal).
 // Headers/QueryParams: every entry b requires must also be required by a with
 // the same name, value, and IsRegex flag.
+// Fraction: a must sample the same fraction as b, or b none. SortRoutes
+// places sampled routes first, so the unsampled one serves the rest.
+// CaseInsensitive: a must be case-sensitive when b is. SortRoutes places
+// case-sensitive routes first.
 func atLeastAsSpecific(a, b routeMatch) bool {
+	if a.CaseInsensitive && !b.CaseInsensitive {
+		return false
+	}
 	if b.Method != "" && !strings.EqualFold(a.Method, b.Method) {
 		return false
 	}
+	if b.Scheme != "" && a.Scheme != b.Scheme {
+		return false
+	}
+	if b.Fraction != "" && a.Fraction != b.Fraction {
+		return false
+	}
 	if !headersSubsume(a.Headers, b.Headers) {
 		return false
 	}
@@ -589,14 +713,11 @@ func queryParamsSubsume(sup, sub []queryParamMatch) bool {
 	return true
 }
 
-// effectivePriority returns the Priority value SortRoutes will use, defaulting
-// to v1alpha1.DefaultPriority when unset (the same default the operator
-// applies via getEffectivePriority on the runtime side).
+// effectivePriority returns the Priority value SortRoutes will use, with the
+// operator's priority band for the match type when unset (the same default
+// ExpandRoutes applies on the runtime side).
 func effectivePriority(rm routeMatch) int32 {
-	if rm.Priority <= 0 {
-		return customrouterv1alpha1.DefaultPriority
-	}
-	return rm.Priority
+	return routes.EffectivePriority(customrouterv1alpha1.MatchType(rm.PathType), rm.Priority)
 }
 
 // classifyOverlaps checks newMatches against existingMatches for overlaps.
@@ -657,10 +778,10 @@ func findOverlapWith(a, b []routeMatch, overlap func(routeMatch, routeMatch) boo
 
 // headersCompatible returns true if two sets of header matches could match the
 // same HTTP request. An empty header set matches all requests, so it is always
-// compatible. Two non-empty sets are incompatible only when they require
-// different exact values for the same header name (case-insensitive). Regex
-// matches on either side are conservatively treated as compatible since the
-// expression cannot be evaluated for contradictions here.
+// compatible. Two non-empty sets are incompatible only when their criteria on
+// the same header name (case-insensitive) contradict each other; see
+// headerPairCompatible. Regex matches on either side are conservatively treated
+// as compatible since the expression cannot be evaluated for contradictions here.
 func headersCompatible(a, b []headerMatch) bool {
 	if len(a) == 0 || len(b) == 0 {
 		return true
@@ -674,18 +795,53 @@ func headersCompatible(a, b []headerMatch) bool {
 		if !ok {
 			continue
 		}
-		if h.IsRegex || bh.IsRegex {
-			continue
-		}
-		if bh.Value != h.Value {
+		if !headerPairCompatible(h, bh) {
 			return false
 		}
 	}
 	return true
 }
 
+// headerPairCompatible reports whether two criteria on the same header can be
+// satisfied by one request. Absent contradicts anything that requires the
+// header to be present; NotValue contradicts an exact match on the value it
+// excludes. Regex and Exists only contradict Absent.
+func headerPairCompatible(x, y headerMatch) bool {
+	if x.Op == routes.HeaderMatchAbsent || y.Op == routes.HeaderMatchAbsent {
+		other := y
+		if y.Op == routes.HeaderMatchAbsent {
+			other = x
+		}
+		return other.Op == routes.HeaderMatchAbsent || other.Op == routes.HeaderMatchNotValue
+	}
+	if x.IsRegex || y.IsRegex || x.Op == routes.HeaderMatchExists || y.Op == routes.HeaderMatchExists {
+		return true
+	}
+	xNot, yNot := x.Op == routes.HeaderMatchNotValue, y.Op == routes.HeaderMatchNotValue
+	if xNot && yNot {
+		return true
+	}
+	if xNot || yNot {
+		return x.Value != y.Value
+	}
+	return x.Value == y.Value
+}
+
+// pathsEqual reports whether two matches of the same type are on the same
+// path. Paths are compared regardless of letter case when either match is
+// case-insensitive, except for Regex matches, whose patterns are compared
+// as written.
+func pathsEqual(a, b routeMatch) bool {
+	if (a.CaseInsensitive || b.CaseInsensitive) && a.PathType != string(customrouterv1alpha1.MatchTypeRegex) {
+		return strings.EqualFold(a.Path, b.Path)
+	}
+	return a.Path == b.Path
+}
+
 // normalizePath strips a single trailing slash from a path to prevent false
 // negatives (e.g. "/api" vs "/api/"). The root path "/" is preserved as-is.
+// The extproc's path normalization (routes.NormalizePath) is not applied: it
+// rewrites request paths, not the paths of the spec.
 func normalizePath(p string) string {
 	if len(p) > 1 && strings.HasSuffix(p, "/") {
 		return strings.TrimSuffix(p, "/")
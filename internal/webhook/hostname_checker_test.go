@@ -28,6 +28,7 @@ import (
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
 )
 
 func newScheme() *runtime.Scheme {
@@ -115,6 +116,12 @@ func newHTTPRouteWithMatches(hostnames []string, matches []gatewayv1.HTTPRouteMa
 	return hr
 }
 
+func newGRPCCustomHTTPRoute(name string, hostnames []string, grpcMatches []customrouterv1alpha1.GRPCMatch) *customrouterv1alpha1.CustomHTTPRoute {
+	cr := newCustomHTTPRouteWithPaths(name, "default", "default", hostnames, nil)
+	cr.Spec.Rules[0].GRPCMatches = grpcMatches
+	return cr
+}
+
 func ptrTo[T any](v T) *T {
 	return &v
 }
@@ -136,6 +143,31 @@ func TestCheckCustomHTTPRouteHostnames(t *testing.T) {
 			route:   newCustomHTTPRoute("route-a", "default", "default", []string{"example.com"}),
 			wantErr: false,
 		},
+		{
+			name: "conflict — same gRPC method in two routes",
+			route: newGRPCCustomHTTPRoute("route-a", []string{"api.example.com"},
+				[]customrouterv1alpha1.GRPCMatch{{Service: "users.v1.UserService", Method: "GetUser"}},
+			),
+			existingCR: []customrouterv1alpha1.CustomHTTPRoute{
+				*newGRPCCustomHTTPRoute("route-b", []string{"api.example.com"},
+					[]customrouterv1alpha1.GRPCMatch{{Service: "users.v1.UserService", Method: "GetUser"}},
+				),
+			},
+			wantErr:     true,
+			errContains: "route conflict",
+		},
+		{
+			name: "no conflict — different gRPC methods of one service",
+			route: newGRPCCustomHTTPRoute("route-a", []string{"api.example.com"},
+				[]customrouterv1alpha1.GRPCMatch{{Service: "users.v1.UserService", Method: "GetUser"}},
+			),
+			existingCR: []customrouterv1alpha1.CustomHTTPRoute{
+				*newGRPCCustomHTTPRoute("route-b", []string{"api.example.com"},
+					[]customrouterv1alpha1.GRPCMatch{{Service: "users.v1.UserService", Method: "ListUsers"}},
+				),
+			},
+			wantErr: false,
+		},
 		{
 			name:  "no conflict — different hostnames same target",
 			route: newCustomHTTPRoute("route-a", "default", "default", []string{"a.example.com"}),
@@ -161,6 +193,33 @@ func TestCheckCustomHTTPRouteHostnames(t *testing.T) {
 			wantErr:     true,
 			errContains: "route conflict",
 		},
+		{
+			name: "no conflict — same target, same hostname, same path, different variants",
+			route: func() *customrouterv1alpha1.CustomHTTPRoute {
+				cr := newCustomHTTPRoute("route-a", "default", "default", []string{"example.com"})
+				cr.Spec.Variant = "green"
+				return cr
+			}(),
+			existingCR: []customrouterv1alpha1.CustomHTTPRoute{
+				*newCustomHTTPRoute("route-b", "default", "default", []string{"example.com"}),
+			},
+			wantErr: false,
+		},
+		{
+			name: "conflict — same target, same hostname, same path, same variant",
+			route: func() *customrouterv1alpha1.CustomHTTPRoute {
+				cr := newCustomHTTPRoute("route-a", "default", "default", []string{"example.com"})
+				cr.Spec.Variant = "green"
+				return cr
+			}(),
+			existingCR: func() []customrouterv1alpha1.CustomHTTPRoute {
+				cr := newCustomHTTPRoute("route-b", "default", "default", []string{"example.com"})
+				cr.Spec.Variant = "green"
+				return []customrouterv1alpha1.CustomHTTPRoute{*cr}
+			}(),
+			wantErr:     true,
+			errContains: "route conflict",
+		},
 		{
 			name: "no conflict — same target, same hostname, different paths",
 			route: newCustomHTTPRouteWithPaths("route-a", "default", "default", []string{"example.com"},
@@ -210,6 +269,30 @@ func TestCheckCustomHTTPRouteHostnames(t *testing.T) {
 			wantErr:     true,
 			errContains: "route conflict",
 		},
+		{
+			name: "no conflict — same path, different scheme",
+			route: newCustomHTTPRouteWithPaths("route-a", "default", "default", []string{"example.com"},
+				[]customrouterv1alpha1.PathMatch{{Path: "/api", Type: customrouterv1alpha1.MatchTypePathPrefix, Scheme: customrouterv1alpha1.RequestSchemeHTTP}},
+			),
+			existingCR: []customrouterv1alpha1.CustomHTTPRoute{
+				*newCustomHTTPRouteWithPaths("route-b", "default", "default", []string{"example.com"},
+					[]customrouterv1alpha1.PathMatch{{Path: "/api", Type: customrouterv1alpha1.MatchTypePathPrefix, Scheme: customrouterv1alpha1.RequestSchemeHTTPS}},
+				),
+			},
+			wantErr: false,
+		},
+		{
+			name: "no conflict — scheme-restricted new route is strictly more specific",
+			route: newCustomHTTPRouteWithPaths("route-a", "default", "default", []string{"example.com"},
+				[]customrouterv1alpha1.PathMatch{{Path: "/api", Type: customrouterv1alpha1.MatchTypePathPrefix, Scheme: customrouterv1alpha1.RequestSchemeHTTP}},
+			),
+			existingCR: []customrouterv1alpha1.CustomHTTPRoute{
+				*newCustomHTTPRouteWithPaths("route-b", "default", "default", []string{"example.com"},
+					[]customrouterv1alpha1.PathMatch{{Path: "/api", Type: customrouterv1alpha1.MatchTypePathPrefix}},
+				),
+			},
+			wantErr: false,
+		},
 		{
 			name: "no conflict — method-restricted existing is strictly more specific",
 			route: newCustomHTTPRouteWithPaths("route-a", "default", "default", []string{"example.com"},
@@ -919,6 +1002,48 @@ func TestHeadersCompatible(t *testing.T) {
 			b:    []headerMatch{{Name: "X-Version", Value: "v2"}, {Name: "X-Env", Value: "prod"}},
 			want: false,
 		},
+		{
+			name: "absent vs exact — incompatible",
+			a:    []headerMatch{{Name: "X-Token", Op: routes.HeaderMatchAbsent}},
+			b:    []headerMatch{{Name: "X-Token", Value: "t"}},
+			want: false,
+		},
+		{
+			name: "absent vs exists — incompatible",
+			a:    []headerMatch{{Name: "X-Token", Op: routes.HeaderMatchExists}},
+			b:    []headerMatch{{Name: "x-token", Op: routes.HeaderMatchAbsent}},
+			want: false,
+		},
+		{
+			name: "absent vs regex — incompatible",
+			a:    []headerMatch{{Name: "X-Token", Op: routes.HeaderMatchAbsent}},
+			b:    []headerMatch{{Name: "X-Token", Value: ".*", IsRegex: true}},
+			want: false,
+		},
+		{
+			name: "absent vs not-value — compatible",
+			a:    []headerMatch{{Name: "X-Token", Op: routes.HeaderMatchAbsent}},
+			b:    []headerMatch{{Name: "X-Token", Value: "t", Op: routes.HeaderMatchNotValue}},
+			want: true,
+		},
+		{
+			name: "not-value vs exact on the excluded value — incompatible",
+			a:    []headerMatch{{Name: "X-Env", Value: "canary", Op: routes.HeaderMatchNotValue}},
+			b:    []headerMatch{{Name: "X-Env", Value: "canary"}},
+			want: false,
+		},
+		{
+			name: "not-value vs exact on another value — compatible",
+			a:    []headerMatch{{Name: "X-Env", Value: "canary"}},
+			b:    []headerMatch{{Name: "X-Env", Value: "prod", Op: routes.HeaderMatchNotValue}},
+			want: true,
+		},
+		{
+			name: "exists vs exact — compatible",
+			a:    []headerMatch{{Name: "X-Env", Op: routes.HeaderMatchExists}},
+			b:    []headerMatch{{Name: "X-Env", Value: "prod"}},
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1076,6 +1201,30 @@ func TestFindRouteMatchOverlap(t *testing.T) {
 			b:    []routeMatch{{PathType: "PathPrefix", Path: "/web"}},
 			want: 0,
 		},
+		{
+			name: "paths differing in case, both case-sensitive — no overlap",
+			a:    []routeMatch{{PathType: "PathPrefix", Path: "/API"}},
+			b:    []routeMatch{{PathType: "PathPrefix", Path: "/api"}},
+			want: 0,
+		},
+		{
+			name: "paths differing in case, both case-insensitive — overlap",
+			a:    []routeMatch{{PathType: "PathPrefix", Path: "/API", CaseInsensitive: true}},
+			b:    []routeMatch{{PathType: "PathPrefix", Path: "/api", CaseInsensitive: true}},
+			want: 1,
+		},
+		{
+			name: "case-sensitive path under a case-insensitive one — no overlap (specificity tie-break)",
+			a:    []routeMatch{{PathType: "PathPrefix", Path: "/API"}},
+			b:    []routeMatch{{PathType: "PathPrefix", Path: "/api", CaseInsensitive: true}},
+			want: 0,
+		},
+		{
+			name: "case-insensitive path with a higher priority than the case-sensitive one — overlap",
+			a:    []routeMatch{{PathType: "PathPrefix", Path: "/API"}},
+			b:    []routeMatch{{PathType: "PathPrefix", Path: "/api", CaseInsensitive: true, Priority: 2000}},
+			want: 1,
+		},
 		{
 			name: "same path, different headers — no overlap",
 			a:    []routeMatch{{PathType: "PathPrefix", Path: "/api", Headers: []headerMatch{{Name: "X-V", Value: "1"}}}},
@@ -1176,6 +1325,24 @@ func TestFindRouteMatchOverlap(t *testing.T) {
 			b:    []routeMatch{{PathType: "PathPrefix", Path: "/api", Headers: []headerMatch{{Name: "X-V", Value: "1"}}}},
 			want: 1,
 		},
+		{
+			name: "same path, one sampled — no overlap (sampled route sorts first)",
+			a:    []routeMatch{{PathType: "PathPrefix", Path: "/api", Fraction: "10/100"}},
+			b:    []routeMatch{{PathType: "PathPrefix", Path: "/api"}},
+			want: 0,
+		},
+		{
+			name: "same path, same fraction — overlap",
+			a:    []routeMatch{{PathType: "PathPrefix", Path: "/api", Fraction: "10/100"}},
+			b:    []routeMatch{{PathType: "PathPrefix", Path: "/api", Fraction: "10/100"}},
+			want: 1,
+		},
+		{
+			name: "sampled route shadowed by higher priority — overlap",
+			a:    []routeMatch{{PathType: "PathPrefix", Path: "/api", Fraction: "10/100"}},
+			b:    []routeMatch{{PathType: "PathPrefix", Path: "/api", Priority: 2000}},
+			want: 1,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,137 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// AllowLoopsAnnotation, set to "true" on a CustomHTTPRoute, admits rewrites
+// and redirects to hostnames served through its own target, for routes that
+// send requests back through the gateway on purpose (e.g. example.com
+// redirecting to www.example.com).
+const AllowLoopsAnnotation = "customrouter.freepik.com/allow-loops"
+
+// loopTarget is a hostname a rule sends requests to.
+type loopTarget struct {
+	field    string
+	hostname string
+}
+
+// CheckRouteLoops rejects a CustomHTTPRoute whose rewrite or redirect actions
+// name a hostname served by a CustomHTTPRoute on the same targetRef, itself
+// included. Those requests come back through the same gateway and external
+// processor and can loop. Routes carrying AllowLoopsAnnotation are not
+// checked, and neither are updates of a route being deleted or keeping the
+// target, hostnames and loop targets of oldRoute (nil on create): finalizer
+// removal and the controller's annotation writes must not be rejected
+// because another route started serving a hostname this one sends to.
+func (c *HostnameChecker) CheckRouteLoops(ctx context.Context, route, oldRoute *customrouterv1alpha1.CustomHTTPRoute) error {
+	if route.Annotations[AllowLoopsAnnotation] == "true" || route.DeletionTimestamp != nil {
+		return nil
+	}
+	targets := collectLoopTargets(route)
+	if len(targets) == 0 || loopTargetsUnchanged(route, oldRoute, targets) {
+		return nil
+	}
+
+	var customRoutes customrouterv1alpha1.CustomHTTPRouteList
+	if err := listCustomHTTPRoutes(ctx, c.Client, &customRoutes); err != nil {
+		return fmt.Errorf("listing CustomHTTPRoutes: %w", err)
+	}
+
+	// route itself is checked first; the stored copy of it is skipped by
+	// UID so an update is checked against its new hostnames.
+	candidates := []*customrouterv1alpha1.CustomHTTPRoute{route}
+	for i := range customRoutes.Items {
+		other := &customRoutes.Items[i]
+		if other.UID == route.UID || other.Spec.TargetRef.Name != route.Spec.TargetRef.Name {
+			continue
+		}
+		candidates = append(candidates, other)
+	}
+
+	for _, target := range targets {
+		for _, candidate := range candidates {
+			for _, hostname := range candidate.Spec.ServedHostnames() {
+				if !hostnameMatches(hostname, target.hostname) {
+					continue
+				}
+				return fmt.Errorf(
+					"%s: %q is served by CustomHTTPRoute %s on target %q, so requests loop through the gateway; set the %s=true annotation if this is intended",
+					target.field, target.hostname, formatNamespacedName(candidate), route.Spec.TargetRef.Name, AllowLoopsAnnotation,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// collectLoopTargets returns the rewrite and redirect hostnames of route's
+// enabled effective rules.
+func collectLoopTargets(route *customrouterv1alpha1.CustomHTTPRoute) []loopTarget {
+	if !route.Spec.IsEnabled() {
+		return nil
+	}
+	var targets []loopTarget
+	for i, rule := range route.Spec.EffectiveRules() {
+		if !rule.IsEnabled() {
+			continue
+		}
+		for _, action := range rule.Actions {
+			switch {
+			case action.Type == customrouterv1alpha1.ActionTypeRewrite && action.Rewrite != nil && action.Rewrite.Hostname != "":
+				targets = append(targets, loopTarget{
+					field:    fmt.Sprintf("rules[%d]: rewrite hostname", i),
+					hostname: action.Rewrite.Hostname,
+				})
+			case action.Type == customrouterv1alpha1.ActionTypeRedirect && action.Redirect != nil && action.Redirect.Hostname != "":
+				targets = append(targets, loopTarget{
+					field:    fmt.Sprintf("rules[%d]: redirect hostname", i),
+					hostname: action.Redirect.Hostname,
+				})
+			}
+		}
+	}
+	return targets
+}
+
+// loopTargetsUnchanged reports whether an update leaves everything the loop
+// check looks at on route itself as it was on oldRoute.
+func loopTargetsUnchanged(route, oldRoute *customrouterv1alpha1.CustomHTTPRoute, targets []loopTarget) bool {
+	if oldRoute == nil || oldRoute.Spec.TargetRef.Name != route.Spec.TargetRef.Name {
+		return false
+	}
+	return slices.Equal(collectLoopTargets(oldRoute), targets) &&
+		slices.Equal(oldRoute.Spec.ServedHostnames(), route.Spec.ServedHostnames())
+}
+
+// hostnameMatches reports whether a route hostname, possibly a "*." wildcard,
+// serves hostname. Hostnames are compared case-insensitively.
+func hostnameMatches(pattern, hostname string) bool {
+	pattern = strings.ToLower(pattern)
+	hostname = strings.ToLower(hostname)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(hostname, "."+suffix)
+	}
+	return pattern == hostname
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func withRewriteHostname(cr *customrouterv1alpha1.CustomHTTPRoute, hostname string) *customrouterv1alpha1.CustomHTTPRoute {
+	cr.Spec.Rules[0].Actions = append(cr.Spec.Rules[0].Actions, customrouterv1alpha1.Action{
+		Type:    customrouterv1alpha1.ActionTypeRewrite,
+		Rewrite: &customrouterv1alpha1.RewriteConfig{Hostname: hostname},
+	})
+	return cr
+}
+
+func withRedirectHostname(cr *customrouterv1alpha1.CustomHTTPRoute, hostname string) *customrouterv1alpha1.CustomHTTPRoute {
+	cr.Spec.Rules[0].Actions = append(cr.Spec.Rules[0].Actions, customrouterv1alpha1.Action{
+		Type:     customrouterv1alpha1.ActionTypeRedirect,
+		Redirect: &customrouterv1alpha1.RedirectConfig{Hostname: hostname},
+	})
+	return cr
+}
+
+func TestCheckRouteLoops(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  []runtime.Object
+		old       *customrouterv1alpha1.CustomHTTPRoute
+		route     *customrouterv1alpha1.CustomHTTPRoute
+		wantError string
+	}{
+		{
+			name:  "rewrite to an external hostname is allowed",
+			route: withRewriteHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "api.internal.svc"),
+		},
+		{
+			name:      "rewrite to its own hostname is rejected",
+			route:     withRewriteHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "example.com"),
+			wantError: `rules[0]: rewrite hostname: "example.com" is served by CustomHTTPRoute web/a`,
+		},
+		{
+			name: "redirect to a hostname on the same target is rejected",
+			existing: []runtime.Object{
+				newCustomHTTPRoute("b", "shop", "gw", []string{"www.example.com"}),
+			},
+			route:     withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "WWW.example.com"),
+			wantError: `rules[0]: redirect hostname: "WWW.example.com" is served by CustomHTTPRoute shop/b`,
+		},
+		{
+			name: "redirect to a hostname on another target is allowed",
+			existing: []runtime.Object{
+				newCustomHTTPRoute("b", "shop", "other", []string{"www.example.com"}),
+			},
+			route: withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "www.example.com"),
+		},
+		{
+			name: "wildcard hostnames serve their subdomains",
+			existing: []runtime.Object{
+				newCustomHTTPRoute("b", "shop", "gw", []string{"*.example.com"}),
+			},
+			route:     withRewriteHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "cdn.example.com"),
+			wantError: `served by CustomHTTPRoute shop/b`,
+		},
+		{
+			name: "the stored copy of the route is checked with its new hostnames",
+			existing: []runtime.Object{
+				newCustomHTTPRoute("a", "web", "gw", []string{"old.example.com"}),
+			},
+			route: withRewriteHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "old.example.com"),
+		},
+		{
+			name: "updates keeping the target, hostnames and loop targets are not checked",
+			existing: []runtime.Object{
+				newCustomHTTPRoute("b", "shop", "gw", []string{"www.example.com"}),
+			},
+			old:   withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "www.example.com"),
+			route: withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "www.example.com"),
+		},
+		{
+			name: "updates changing the loop targets are checked",
+			existing: []runtime.Object{
+				newCustomHTTPRoute("b", "shop", "gw", []string{"www.example.com"}),
+			},
+			old:       withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "shop.example.com"),
+			route:     withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "www.example.com"),
+			wantError: `served by CustomHTTPRoute shop/b`,
+		},
+		{
+			name:      "updates adding the loop target to the route's hostnames are checked",
+			old:       withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "www.example.com"),
+			route:     withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com", "www.example.com"}), "www.example.com"),
+			wantError: `served by CustomHTTPRoute web/a`,
+		},
+		{
+			name: "routes being deleted are not checked",
+			route: func() *customrouterv1alpha1.CustomHTTPRoute {
+				cr := withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com", "www.example.com"}), "www.example.com")
+				cr.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+				return cr
+			}(),
+		},
+		{
+			name: "annotated routes are not checked",
+			route: func() *customrouterv1alpha1.CustomHTTPRoute {
+				cr := withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com", "www.example.com"}), "www.example.com")
+				cr.Annotations = map[string]string{AllowLoopsAnnotation: "true"}
+				return cr
+			}(),
+		},
+	}
+
+	scheme := newScheme()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(tt.existing...).
+				Build()
+			checker := &HostnameChecker{Client: cl}
+
+			err := checker.CheckRouteLoops(context.Background(), tt.route, tt.old)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestValidateUpdateRemovesFinalizerOfLoopingRoute(t *testing.T) {
+	// The redirect target started being served on the same target after
+	// the route was admitted; removing the finalizer must still succeed.
+	other := newCustomHTTPRoute("b", "shop", "gw", []string{"www.example.com"})
+	old := withRedirectHostname(newCustomHTTPRoute("a", "web", "gw", []string{"example.com"}), "www.example.com")
+	old.Finalizers = []string{"customrouter.freepik.com/finalizer"}
+	old.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	route := old.DeepCopy()
+	route.Finalizers = nil
+
+	cl := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithRuntimeObjects(other).
+		Build()
+	validator := &CustomHTTPRouteValidator{checker: &HostnameChecker{Client: cl}}
+
+	if _, err := validator.ValidateUpdate(context.Background(), old, route); err != nil {
+		t.Fatalf("finalizer removal rejected: %v", err)
+	}
+}
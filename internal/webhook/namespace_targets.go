@@ -0,0 +1,63 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// CheckNamespaceTargets rejects a CustomHTTPRoute whose targetRef is not
+// allowed in its namespace, by the AllowedTargetsAnnotation of the Namespace
+// or, without it, by allowList. An update keeping
+// the stored targetRef is admitted, so routes created before the namespace
+// was restricted can still be updated and cleaned up; the controller does not
+// serve them either way. oldRoute is nil on create.
+func (c *HostnameChecker) CheckNamespaceTargets(
+	ctx context.Context,
+	route, oldRoute *customrouterv1alpha1.CustomHTTPRoute,
+	allowList customrouterv1alpha1.TargetAllowList,
+) error {
+	target := route.Spec.TargetRef.Name
+	if oldRoute != nil && oldRoute.Spec.TargetRef.Name == target {
+		return nil
+	}
+
+	var ns corev1.Namespace
+	err := c.Client.Get(ctx, types.NamespacedName{Name: route.Namespace}, &ns)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("getting namespace %s: %w", route.Namespace, err)
+	}
+	allowed, restricted := allowList.AllowedTargets(route.Namespace, ns.Annotations)
+	if !restricted || slices.Contains(allowed, target) {
+		return nil
+	}
+	list := strings.Join(allowed, ", ")
+	if list == "" {
+		list = "none"
+	}
+	return fmt.Errorf("targetRef %q is not allowed in namespace %s by %s (allowed: %s)",
+		target, route.Namespace, customrouterv1alpha1.TargetRestrictionSource(ns.Annotations), list)
+}
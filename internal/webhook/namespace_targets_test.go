@@ -0,0 +1,106 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestCheckNamespaceTargets(t *testing.T) {
+	restricted := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "team-a",
+		Annotations: map[string]string{customrouterv1alpha1.AllowedTargetsAnnotation: "internal, staging"},
+	}}
+	open := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}}
+
+	tests := []struct {
+		name      string
+		route     *customrouterv1alpha1.CustomHTTPRoute
+		oldRoute  *customrouterv1alpha1.CustomHTTPRoute
+		allowList customrouterv1alpha1.TargetAllowList
+		wantError string
+	}{
+		{
+			name:  "allowed target",
+			route: newCustomHTTPRoute("a", "team-a", "internal", []string{"example.com"}),
+		},
+		{
+			name:      "target not in the annotation",
+			route:     newCustomHTTPRoute("a", "team-a", "public", []string{"example.com"}),
+			wantError: `targetRef "public" is not allowed in namespace team-a`,
+		},
+		{
+			name:      "switching to a disallowed target",
+			route:     newCustomHTTPRoute("a", "team-a", "public", []string{"example.com"}),
+			oldRoute:  newCustomHTTPRoute("a", "team-a", "internal", []string{"example.com"}),
+			wantError: `allowed: internal, staging`,
+		},
+		{
+			name:     "update keeping a target allowed before",
+			route:    newCustomHTTPRoute("a", "team-a", "public", []string{"www.example.com"}),
+			oldRoute: newCustomHTTPRoute("a", "team-a", "public", []string{"example.com"}),
+		},
+		{
+			name:  "namespace without the annotation",
+			route: newCustomHTTPRoute("a", "team-b", "public", []string{"example.com"}),
+		},
+		{
+			name:      "target not in the operator's list",
+			route:     newCustomHTTPRoute("a", "team-b", "public", []string{"example.com"}),
+			allowList: customrouterv1alpha1.TargetAllowList{customrouterv1alpha1.AllNamespaces: {"internal"}},
+			wantError: `targetRef "public" is not allowed in namespace team-b by --policy-allowed-targets`,
+		},
+		{
+			name:      "annotation wins over the operator's list",
+			route:     newCustomHTTPRoute("a", "team-a", "staging", []string{"example.com"}),
+			allowList: customrouterv1alpha1.TargetAllowList{"team-a": {"public"}},
+		},
+		{
+			name:      "missing namespace falls back to the operator's list",
+			route:     newCustomHTTPRoute("a", "team-c", "public", []string{"example.com"}),
+			allowList: customrouterv1alpha1.TargetAllowList{"team-c": {"internal"}},
+			wantError: `allowed: internal`,
+		},
+	}
+
+	scheme := newScheme()
+	_ = corev1.AddToScheme(scheme)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(restricted, open).Build()
+	checker := &HostnameChecker{Client: cl}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checker.CheckNamespaceTargets(context.Background(), tt.route, tt.oldRoute, tt.allowList)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// ruleMatch is a match of a CustomHTTPRoute with the routes it expands to.
+type ruleMatch struct {
+	// field is the match's path in the spec, e.g. "rules[1].matches[0]".
+	field string
+
+	// match describes the match without its position, e.g. "prefix /api".
+	match string
+
+	rule         int
+	matchType    customrouterv1alpha1.MatchType
+	path         string
+	priority     int32
+	allowOverlap bool
+	routes       []routes.Route
+}
+
+// shadowedMatch is a match every request of which an earlier match of the
+// same CustomHTTPRoute takes.
+type shadowedMatch struct {
+	match, by *ruleMatch
+}
+
+// key identifies the shadowing by what the matches are rather than where
+// they are in the spec, so it survives rules being added or reordered.
+func (s shadowedMatch) key() string {
+	return s.match.match + "|" + s.by.match
+}
+
+// CheckRuleOverlaps analyses the matches of the enabled rules of route
+// against each other:
+//
+//   - A match that can never be reached because an earlier match of the
+//     route takes every request it would is rejected, with the priority
+//     that would make it reachable. It is only reported as a warning when
+//     either rule sets allowOverlap, or when oldRoute already had the same
+//     shadowed match, so existing routes can still be updated.
+//   - PathPrefix matches of different rules where one prefix contains the
+//     other with the same priority are reported as warnings: the longer
+//     prefix wins, which is rarely obvious from the manifest.
+//
+// oldRoute is nil on create.
+func CheckRuleOverlaps(route, oldRoute *customrouterv1alpha1.CustomHTTPRoute) (admission.Warnings, error) {
+	matches := ruleMatches(route)
+	if len(matches) < 2 {
+		return nil, nil
+	}
+
+	existing := make(map[string]bool)
+	if oldRoute != nil {
+		for _, s := range shadowedMatches(ruleMatches(oldRoute)) {
+			existing[s.key()] = true
+		}
+	}
+
+	var warnings admission.Warnings
+	var errs []string
+	for _, s := range shadowedMatches(matches) {
+		fix := fmt.Sprintf("give it a priority above %d or remove it", s.by.priority)
+		if s.by.priority >= routes.MaxPriority {
+			fix = fmt.Sprintf("lower the priority of %s or remove it", s.by.field)
+		}
+		msg := fmt.Sprintf("%s (%s) can never match: %s (%s, priority %d) takes every request it would; %s",
+			s.match.field, s.match.match, s.by.field, s.by.match, s.by.priority, fix)
+		if s.match.allowOverlap || s.by.allowOverlap || existing[s.key()] {
+			warnings = append(warnings, msg)
+			continue
+		}
+		errs = append(errs, msg)
+	}
+
+	for i, a := range matches {
+		for _, b := range matches[i+1:] {
+			if a.rule == b.rule || a.priority != b.priority || a.path == b.path ||
+				a.matchType != customrouterv1alpha1.MatchTypePathPrefix || b.matchType != customrouterv1alpha1.MatchTypePathPrefix {
+				continue
+			}
+			short, long := a, b
+			if len(short.path) > len(long.path) {
+				short, long = long, short
+			}
+			if !prefixContains(short.path, long.path) {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf(
+				"%s (%s) and %s (%s) overlap with the same priority %d: requests under %s go to %s; "+
+					"set explicit priorities to make the intended order visible",
+				short.field, short.match, long.field, long.match, a.priority, long.path, long.field))
+		}
+	}
+
+	if len(errs) > 0 {
+		return warnings, fmt.Errorf("overlapping matches: %s", strings.Join(errs, "; "))
+	}
+	return warnings, nil
+}
+
+// ruleMatches expands every match of the enabled rules of route on its own,
+// in spec order. Every host of a route gets the same routes, so they are
+// expanded for the first hostname only.
+func ruleMatches(route *customrouterv1alpha1.CustomHTTPRoute) []*ruleMatch {
+	if !route.Spec.IsEnabled() || len(route.Spec.Hostnames) == 0 {
+		return nil
+	}
+	hostname := route.Spec.Hostnames[0]
+
+	var matches []*ruleMatch
+	expand := func(rule customrouterv1alpha1.Rule, m *ruleMatch) {
+		single := &customrouterv1alpha1.CustomHTTPRoute{
+			Spec: customrouterv1alpha1.CustomHTTPRouteSpec{
+				Hostnames:    []string{hostname},
+				PathPrefixes: route.Spec.PathPrefixes,
+				Rules:        []customrouterv1alpha1.Rule{rule},
+			},
+		}
+		expanded, err := routes.ExpandRoutes(single, nil)
+		if err != nil || len(expanded[hostname]) == 0 {
+			return
+		}
+		m.routes = expanded[hostname]
+		m.priority = m.routes[0].Priority
+		matches = append(matches, m)
+	}
+
+	for i, rule := range route.Spec.EffectiveRules() {
+		if !rule.IsEnabled() {
+			continue
+		}
+		for j, match := range rule.Matches {
+			single := rule
+			single.Matches = []customrouterv1alpha1.PathMatch{match}
+			single.GRPCMatches = nil
+			matchType := match.Type
+			if matchType == "" {
+				matchType = customrouterv1alpha1.MatchTypePathPrefix
+			}
+			expand(single, &ruleMatch{
+				field:        fmt.Sprintf("rules[%d].matches[%d]", i, j),
+				match:        describeMatch(matchType, match.Path, string(match.Method)),
+				rule:         i,
+				matchType:    matchType,
+				path:         match.Path,
+				allowOverlap: rule.AllowOverlap,
+			})
+		}
+		for j, match := range rule.GRPCMatches {
+			single := rule
+			single.Matches = nil
+			single.GRPCMatches = []customrouterv1alpha1.GRPCMatch{match}
+			m := &ruleMatch{
+				field:        fmt.Sprintf("rules[%d].grpcMatches[%d]", i, j),
+				rule:         i,
+				allowOverlap: rule.AllowOverlap,
+			}
+			expand(single, m)
+			if len(m.routes) > 0 {
+				m.match = describeMatch("gRPC", m.routes[0].Path, "")
+			}
+		}
+	}
+	return matches
+}
+
+// shadowedMatches returns the matches none of whose routes can be reached,
+// each with the first other match shadowing one of them. Routes are put in
+// the order the extproc evaluates them in.
+func shadowedMatches(matches []*ruleMatch) []shadowedMatch {
+	var hostRoutes []routes.Route
+	var owners []int
+	for i, m := range matches {
+		for _, r := range m.routes {
+			hostRoutes = append(hostRoutes, r)
+			owners = append(owners, i)
+		}
+	}
+	// Sort the way SortRoutes does, moving the owners along.
+	order := make([]int, len(hostRoutes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return routes.RouteLess(&hostRoutes[order[i]], &hostRoutes[order[j]])
+	})
+	sorted := make([]routes.Route, len(order))
+	for i, k := range order {
+		sorted[i] = hostRoutes[k]
+	}
+
+	shadowedRoutes := make([]int, len(matches))
+	by := make([]int, len(matches))
+	for i := range by {
+		by[i] = -1
+	}
+	for _, s := range routes.FindShadowedRoutes(sorted) {
+		owner, shadower := owners[order[s.Route]], owners[order[s.ShadowedBy]]
+		shadowedRoutes[owner]++
+		if shadower != owner && by[owner] == -1 {
+			by[owner] = shadower
+		}
+	}
+
+	var shadowed []shadowedMatch
+	for i, m := range matches {
+		if by[i] != -1 && shadowedRoutes[i] == len(m.routes) {
+			shadowed = append(shadowed, shadowedMatch{match: m, by: matches[by[i]]})
+		}
+	}
+	return shadowed
+}
+
+// describeMatch describes a match for error messages, e.g. "GET prefix /api".
+func describeMatch(matchType customrouterv1alpha1.MatchType, path, method string) string {
+	kind := strings.ToLower(strings.TrimPrefix(string(matchType), "Path"))
+	desc := kind + " " + path
+	if method != "" {
+		desc = method + " " + desc
+	}
+	return desc
+}
+
+// prefixContains reports whether every path under the prefix long is also
+// under the prefix short, which must not be longer.
+func prefixContains(short, long string) bool {
+	if short == "/" || short == "" {
+		return true
+	}
+	short = strings.TrimSuffix(short, "/")
+	return long == short || strings.HasPrefix(long, short+"/")
+}
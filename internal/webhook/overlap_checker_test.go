@@ -0,0 +1,126 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"strings"
+	"testing"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func prefixMatch(path string, priority int32) customrouterv1alpha1.PathMatch {
+	return customrouterv1alpha1.PathMatch{Path: path, Type: customrouterv1alpha1.MatchTypePathPrefix, Priority: priority}
+}
+
+// newRouteWithRules returns a route with one rule per match.
+func newRouteWithRules(matches ...customrouterv1alpha1.PathMatch) *customrouterv1alpha1.CustomHTTPRoute {
+	cr := newCustomHTTPRoute("a", "web", "gw", []string{"example.com"})
+	cr.Spec.Rules = nil
+	for _, m := range matches {
+		cr.Spec.Rules = append(cr.Spec.Rules, customrouterv1alpha1.Rule{
+			Matches:     []customrouterv1alpha1.PathMatch{m},
+			BackendRefs: []customrouterv1alpha1.BackendRef{{Name: "svc", Namespace: "default", Port: 80}},
+		})
+	}
+	return cr
+}
+
+func TestCheckRuleOverlaps(t *testing.T) {
+	shadowing := newRouteWithRules(prefixMatch("/api", 2000), prefixMatch("/api/v1", 1000))
+	allowed := newRouteWithRules(prefixMatch("/api", 2000), prefixMatch("/api/v1", 1000))
+	allowed.Spec.Rules[1].AllowOverlap = true
+	topPriority := newRouteWithRules(prefixMatch("/", 10000), prefixMatch("/api", 5000))
+	disabled := newRouteWithRules(prefixMatch("/api", 2000), prefixMatch("/api/v1", 1000))
+	disabled.Spec.Rules[1].Enabled = new(bool)
+
+	tests := []struct {
+		name        string
+		route       *customrouterv1alpha1.CustomHTTPRoute
+		oldRoute    *customrouterv1alpha1.CustomHTTPRoute
+		wantError   string
+		wantWarning string
+	}{
+		{
+			name:  "longer prefix with the higher priority is fine",
+			route: newRouteWithRules(prefixMatch("/api", 1000), prefixMatch("/api/v1", 2000)),
+		},
+		{
+			name:  "prefixes that only share characters do not overlap",
+			route: newRouteWithRules(prefixMatch("/api", 1000), prefixMatch("/api-docs", 1000)),
+		},
+		{
+			name:  "shadowed prefix is rejected",
+			route: shadowing,
+			wantError: "rules[1].matches[0] (prefix /api/v1) can never match: rules[0].matches[0] " +
+				"(prefix /api, priority 2000) takes every request it would; give it a priority above 2000 or remove it",
+		},
+		{
+			name:        "shadowing already in the old route only warns",
+			route:       shadowing,
+			oldRoute:    newRouteWithRules(prefixMatch("/api", 2000), prefixMatch("/api/v1", 1000)),
+			wantWarning: "rules[1].matches[0] (prefix /api/v1) can never match",
+		},
+		{
+			name:        "allowOverlap only warns",
+			route:       allowed,
+			wantWarning: "rules[1].matches[0] (prefix /api/v1) can never match",
+		},
+		{
+			name:      "shadowing by the top priority suggests lowering it",
+			route:     topPriority,
+			wantError: "lower the priority of rules[0].matches[0] or remove it",
+		},
+		{
+			name:  "disabled rules are ignored",
+			route: disabled,
+		},
+		{
+			name:  "a method-specific match is not shadowed by another method",
+			route: newRouteWithRules(customrouterv1alpha1.PathMatch{Path: "/api", Method: "POST", Priority: 2000}, prefixMatch("/api/v1", 1000)),
+		},
+		{
+			name:  "equal priority nested prefixes warn",
+			route: newRouteWithRules(prefixMatch("/api", 0), prefixMatch("/api/v1", 0)),
+			wantWarning: "rules[0].matches[0] (prefix /api) and rules[1].matches[0] (prefix /api/v1) overlap " +
+				"with the same priority 1000: requests under /api/v1 go to rules[1].matches[0]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := CheckRuleOverlaps(tt.route, tt.oldRoute)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantWarning == "" {
+				if len(warnings) > 0 {
+					t.Fatalf("unexpected warnings: %v", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.wantWarning) {
+				t.Fatalf("expected one warning containing %q, got %v", tt.wantWarning, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// AdmissionPolicy holds the platform guardrails enforced on CustomHTTPRoutes
+// on top of the CRD schema limits. Zero values disable each check.
+//
+// A change that does not make a violation worse is always admitted, so
+// tightening the policy never blocks updates (or clean-up) of routes that
+// were created under a looser one.
+type AdmissionPolicy struct {
+	// MaxHostnames caps spec.hostnames and spec.hostnameAliases per CustomHTTPRoute.
+	MaxHostnames int
+
+	// MaxRules caps spec.rules per CustomHTTPRoute.
+	MaxRules int
+
+	// MaxNamespaceRoutes caps the expanded routes (hostnames × matches ×
+	// prefixes) of all CustomHTTPRoutes in a namespace combined.
+	MaxNamespaceRoutes int
+
+	// AllowedTargets restricts the targetRef names of the routes of
+	// namespaces without the AllowedTargetsAnnotation. Unlike the other
+	// limits it is enforced by CheckNamespaceTargets, not Check, and WarnOnly
+	// does not apply: the controller does not serve such routes either.
+	AllowedTargets customrouterv1alpha1.TargetAllowList
+
+	// WarnOnly returns the violations of Check as admission warnings instead
+	// of rejecting the request.
+	WarnOnly bool
+}
+
+// IsZero reports whether the policy enforces nothing.
+func (p *AdmissionPolicy) IsZero() bool {
+	return p == nil || (p.MaxHostnames == 0 && p.MaxRules == 0 &&
+		p.MaxNamespaceRoutes == 0)
+}
+
+// Check evaluates route against the policy. oldRoute is the stored object on
+// update and nil on create; both must have the defaults they inherit from
+// CustomRouterConfigs set.
+func (p *AdmissionPolicy) Check(
+	ctx context.Context,
+	c client.Reader,
+	route, oldRoute *customrouterv1alpha1.CustomHTTPRoute,
+) (admission.Warnings, error) {
+	if p.IsZero() {
+		return nil, nil
+	}
+
+	var violations []string
+
+	if p.MaxHostnames > 0 {
+		n := len(route.Spec.ServedHostnames())
+		if n > p.MaxHostnames && (oldRoute == nil || n > len(oldRoute.Spec.ServedHostnames())) {
+			violations = append(violations, fmt.Sprintf("%d hostnames exceed the limit of %d", n, p.MaxHostnames))
+		}
+	}
+
+	if p.MaxRules > 0 {
+		n := len(route.Spec.Rules)
+		if n > p.MaxRules && (oldRoute == nil || n > len(oldRoute.Spec.Rules)) {
+			violations = append(violations, fmt.Sprintf("%d rules exceed the limit of %d", n, p.MaxRules))
+		}
+	}
+
+	if p.MaxNamespaceRoutes > 0 {
+		violation, err := p.checkNamespaceRoutes(ctx, c, route, oldRoute)
+		if err != nil {
+			return nil, err
+		}
+		if violation != "" {
+			violations = append(violations, violation)
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil, nil
+	}
+	if p.WarnOnly {
+		warnings := make(admission.Warnings, len(violations))
+		for i, v := range violations {
+			warnings[i] = "admission policy: " + v
+		}
+		return warnings, nil
+	}
+	return nil, fmt.Errorf("CustomHTTPRoute %s/%s violates the admission policy: %s",
+		route.Namespace, route.Name, strings.Join(violations, "; "))
+}
+
+// targetAllowList returns the operator's allowed targets, nil when there is
+// no policy.
+func (p *AdmissionPolicy) targetAllowList() customrouterv1alpha1.TargetAllowList {
+	if p == nil {
+		return nil
+	}
+	return p.AllowedTargets
+}
+
+// checkNamespaceRoutes sums the expanded routes of every other
+// CustomHTTPRoute in the namespace plus the candidate, and reports a
+// violation when the total exceeds the quota and the candidate grew.
+func (p *AdmissionPolicy) checkNamespaceRoutes(
+	ctx context.Context,
+	c client.Reader,
+	route, oldRoute *customrouterv1alpha1.CustomHTTPRoute,
+) (string, error) {
+	own, err := countExpandedRoutes(route)
+	if err != nil {
+		return "", err
+	}
+	if oldRoute != nil {
+		previous, err := countExpandedRoutes(oldRoute)
+		if err == nil && own <= previous {
+			return "", nil
+		}
+	}
+
+	list := &customrouterv1alpha1.CustomHTTPRouteList{}
+	if err := listCustomHTTPRoutes(ctx, c, list, client.InNamespace(route.Namespace)); err != nil {
+		return "", fmt.Errorf("failed to list CustomHTTPRoutes in namespace %s: %w", route.Namespace, err)
+	}
+
+	total := own
+	for i := range list.Items {
+		other := &list.Items[i]
+		if other.Name == route.Name || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		n, err := countExpandedRoutes(other)
+		if err != nil {
+			continue
+		}
+		total += n
+	}
+
+	if total > p.MaxNamespaceRoutes {
+		return fmt.Sprintf("namespace %s would hold %d expanded routes, exceeding the limit of %d",
+			route.Namespace, total, p.MaxNamespaceRoutes), nil
+	}
+	return "", nil
+}
+
+// countExpandedRoutes returns how many runtime routes a CustomHTTPRoute
+// expands to across all of its hostnames.
+func countExpandedRoutes(route *customrouterv1alpha1.CustomHTTPRoute) (int, error) {
+	hosts, err := routes.ExpandRoutes(route, nil)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, hostRoutes := range hosts {
+		n += len(hostRoutes)
+	}
+	return n, nil
+}
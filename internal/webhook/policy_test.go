@@ -0,0 +1,116 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestAdmissionPolicyCheck(t *testing.T) {
+	// Each existing route in team-a expands to 2 routes (2 hostnames x 1 match).
+	existing := newCustomHTTPRoute("existing", "team-a", "public", []string{"a.example.com", "b.example.com"})
+
+	threeHosts := newCustomHTTPRoute("candidate", "team-a", "public", []string{"c.example.com", "d.example.com", "e.example.com"})
+	twoHosts := newCustomHTTPRoute("candidate", "team-a", "public", []string{"c.example.com", "d.example.com"})
+	oneHost := newCustomHTTPRoute("candidate", "team-a", "public", []string{"c.example.com"})
+
+	tests := []struct {
+		name         string
+		policy       AdmissionPolicy
+		route        *customrouterv1alpha1.CustomHTTPRoute
+		oldRoute     *customrouterv1alpha1.CustomHTTPRoute
+		wantErr      string
+		wantWarnings int
+	}{
+		{
+			name:   "zero policy admits anything",
+			policy: AdmissionPolicy{},
+			route:  threeHosts,
+		},
+		{
+			name:    "too many hostnames",
+			policy:  AdmissionPolicy{MaxHostnames: 2},
+			route:   threeHosts,
+			wantErr: "3 hostnames exceed the limit of 2",
+		},
+		{
+			name:     "shrinking an over-limit route is admitted",
+			policy:   AdmissionPolicy{MaxHostnames: 1},
+			route:    twoHosts,
+			oldRoute: threeHosts,
+		},
+		{
+			name:         "warn-only returns warnings",
+			policy:       AdmissionPolicy{MaxHostnames: 2, WarnOnly: true},
+			route:        threeHosts,
+			wantWarnings: 1,
+		},
+		{
+			name:   "route within every limit",
+			policy: AdmissionPolicy{MaxHostnames: 2, MaxRules: 1, MaxNamespaceRoutes: 3},
+			route:  oneHost,
+		},
+		{
+			name:    "namespace route quota exceeded",
+			policy:  AdmissionPolicy{MaxNamespaceRoutes: 4},
+			route:   threeHosts,
+			wantErr: "would hold 5 expanded routes",
+		},
+		{
+			name:   "namespace route quota respected",
+			policy: AdmissionPolicy{MaxNamespaceRoutes: 4},
+			route:  twoHosts,
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(existing).Build()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := tt.policy.Check(context.Background(), c, tt.route, tt.oldRoute)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %v, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestAdmissionPolicyMaxRules(t *testing.T) {
+	route := newCustomHTTPRoute("candidate", "team-a", "public", []string{"a.example.com"})
+	route.Spec.Rules = append(route.Spec.Rules, route.Spec.Rules[0])
+
+	policy := &AdmissionPolicy{MaxRules: 1}
+	if _, err := policy.Check(context.Background(), nil, route, nil); err == nil ||
+		!strings.Contains(err.Error(), "2 rules exceed the limit of 1") {
+		t.Errorf("expected a max-rules violation, got %v", err)
+	}
+}
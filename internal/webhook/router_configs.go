@@ -0,0 +1,75 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// newRouterConfigResolver returns a resolver for the CustomRouterConfigs in
+// the cluster, so the webhook checks routes with the defaults the controller
+// gives them.
+func newRouterConfigResolver(ctx context.Context, c client.Reader) (*customrouterv1alpha1.RouterConfigResolver, error) {
+	var configs customrouterv1alpha1.CustomRouterConfigList
+	if err := c.List(ctx, &configs); err != nil {
+		return nil, fmt.Errorf("listing CustomRouterConfigs: %w", err)
+	}
+	return customrouterv1alpha1.NewRouterConfigResolver(configs.Items, func(namespace string) (map[string]string, error) {
+		var ns corev1.Namespace
+		err := c.Get(ctx, types.NamespacedName{Name: namespace}, &ns)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("getting namespace %s: %w", namespace, err)
+		}
+		return ns.Labels, nil
+	}), nil
+}
+
+// listCustomHTTPRoutes lists the CustomHTTPRoutes matching opts into list,
+// with the defaults they inherit from CustomRouterConfigs set.
+func listCustomHTTPRoutes(
+	ctx context.Context,
+	c client.Reader,
+	list *customrouterv1alpha1.CustomHTTPRouteList,
+	opts ...client.ListOption,
+) error {
+	if err := c.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		return nil
+	}
+	resolver, err := newRouterConfigResolver(ctx, c)
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		resolved, err := resolver.Resolve(&list.Items[i])
+		if err != nil {
+			return err
+		}
+		list.Items[i] = *resolved
+	}
+	return nil
+}
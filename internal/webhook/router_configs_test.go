@@ -0,0 +1,102 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestValidateResolvesRouterConfigDefaults(t *testing.T) {
+	// Routes in namespaces labelled locale=es are served under /es.
+	config := &customrouterv1alpha1.CustomRouterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "locales"},
+		Spec: customrouterv1alpha1.CustomRouterConfigSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"locale": "es"}},
+			PathPrefixes: &customrouterv1alpha1.PathPrefixes{
+				Values: []string{"es"},
+				Policy: customrouterv1alpha1.PathPrefixPolicyRequired,
+			},
+		},
+	}
+	spanish := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop-es", Labels: map[string]string{"locale": "es"}}}
+	plain := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}}
+
+	prefixed := func(namespace string) *customrouterv1alpha1.CustomHTTPRoute {
+		return newCustomHTTPRouteWithPaths("cart", namespace, "gw", []string{"example.com"},
+			[]customrouterv1alpha1.PathMatch{{Path: "/cart", Type: customrouterv1alpha1.MatchTypePathPrefix}})
+	}
+	explicit := func(namespace string) *customrouterv1alpha1.CustomHTTPRoute {
+		return newCustomHTTPRouteWithPaths("cart-es", namespace, "gw", []string{"example.com"},
+			[]customrouterv1alpha1.PathMatch{{Path: "/es/cart", Type: customrouterv1alpha1.MatchTypePathPrefix}})
+	}
+
+	tests := []struct {
+		name      string
+		existing  *customrouterv1alpha1.CustomHTTPRoute
+		route     *customrouterv1alpha1.CustomHTTPRoute
+		wantError bool
+	}{
+		{
+			name:      "route inherits the prefix of the existing path",
+			existing:  explicit("shop"),
+			route:     prefixed("shop-es"),
+			wantError: true,
+		},
+		{
+			name:      "existing route inherits the prefix of the route path",
+			existing:  prefixed("shop-es"),
+			route:     explicit("shop"),
+			wantError: true,
+		},
+		{
+			name:     "namespace not selected",
+			existing: explicit("shop"),
+			route:    prefixed("shop"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := newScheme()
+			_ = corev1.AddToScheme(scheme)
+			cl := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(config, spanish, plain, tt.existing).
+				Build()
+			validator := &CustomHTTPRouteValidator{checker: &HostnameChecker{Client: cl}}
+
+			_, err := validator.ValidateCreate(context.Background(), tt.route)
+			if tt.wantError {
+				if err == nil || !strings.Contains(err.Error(), "route conflict") {
+					t.Fatalf("expected a route conflict, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/matcher"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// maxSimulatedPaths bounds the request paths built from a single regex, whose
+// alternations multiply them.
+const maxSimulatedPaths = 16
+
+// SimulateRules expands every match of the enabled rules of route on its own,
+// as the controller does, and runs the routes it gets through the match
+// engine of the extproc with request paths built from the match itself. It
+// warns about matches that expand to no route, such as a Required
+// pathPrefixes policy without prefix values, and about matches none of whose
+// routes accept a request for their own path, such as a regex anchored in
+// the middle or a path carrying a query string, which the extproc strips
+// before matching. Every host of a route gets the same routes, so they are
+// expanded for the first hostname only.
+func SimulateRules(route *customrouterv1alpha1.CustomHTTPRoute) admission.Warnings {
+	if !route.Spec.IsEnabled() || len(route.Spec.Hostnames) == 0 {
+		return nil
+	}
+	hostname := route.Spec.Hostnames[0]
+
+	var warnings admission.Warnings
+	for i, rule := range route.Spec.EffectiveRules() {
+		if !rule.IsEnabled() {
+			continue
+		}
+		for j, match := range rule.Matches {
+			single := rule
+			single.Matches = []customrouterv1alpha1.PathMatch{match}
+			single.GRPCMatches = nil
+			expanded, err := routes.ExpandRoutes(&customrouterv1alpha1.CustomHTTPRoute{
+				Spec: customrouterv1alpha1.CustomHTTPRouteSpec{
+					Hostnames:    []string{hostname},
+					PathPrefixes: route.Spec.PathPrefixes,
+					Rules:        []customrouterv1alpha1.Rule{single},
+				},
+			}, nil)
+			if err != nil {
+				continue
+			}
+
+			matchType := match.Type
+			if matchType == "" {
+				matchType = customrouterv1alpha1.MatchTypePathPrefix
+			}
+			field := fmt.Sprintf("rules[%d].matches[%d] (%s)", i, j,
+				describeMatch(matchType, match.Path, string(match.Method)))
+			hostRoutes := expanded[hostname]
+			if len(hostRoutes) == 0 {
+				reason := "it expands to no route"
+				if routes.GetEffectivePolicy(route.Spec.PathPrefixes, &rule) == customrouterv1alpha1.PathPrefixPolicyRequired {
+					reason = "the pathPrefixes policy is Required but there are no prefix values"
+				}
+				warnings = append(warnings, fmt.Sprintf("%s produces no routes: %s", field, reason))
+				continue
+			}
+			if path, ok := unmatchedOwnPath(hostRoutes); !ok {
+				msg := fmt.Sprintf("%s can never match: no request path can match its routes", field)
+				if path != "" {
+					msg = fmt.Sprintf("%s can never match: a request for %q, built from the match, is not matched by it",
+						field, path)
+				}
+				warnings = append(warnings, msg)
+			}
+		}
+	}
+	return warnings
+}
+
+// unmatchedOwnPath runs request paths built from each route against it and
+// reports whether every route matched one of its paths. Otherwise it returns
+// the path a route did not match, empty when no path could be built, as for
+// a regex that matches nothing.
+func unmatchedOwnPath(hostRoutes []routes.Route) (string, bool) {
+	for i := range hostRoutes {
+		// Only the path is simulated: the other criteria of the route are
+		// left out, so a request for the path alone can match it.
+		route := routes.Route{
+			Path:            hostRoutes[i].Path,
+			Type:            hostRoutes[i].Type,
+			CaseInsensitive: hostRoutes[i].CaseInsensitive,
+		}
+		paths := []string{route.Path}
+		if route.Type == routes.RouteTypeRegex {
+			re, err := syntax.Parse(route.Path, syntax.Perl)
+			if err != nil {
+				// Invalid patterns are rejected by validation.
+				continue
+			}
+			paths = regexPaths(re.Simplify())
+			if len(paths) == 0 {
+				return "", false
+			}
+		}
+
+		matched := false
+		for j, path := range paths {
+			if !strings.HasPrefix(path, "/") {
+				path = "/" + path
+			}
+			paths[j] = path
+			if route.Match(routes.RequestMatch{Path: matcher.StripQueryString(path)}) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return paths[0], false
+		}
+	}
+	return "", true
+}
+
+// regexPaths returns up to maxSimulatedPaths strings built from re, taking
+// each alternative of an alternation and the shortest run of a repetition.
+// Anchors and word boundaries add nothing, so a string may not match re
+// when they contradict it, which is what the caller looks for. It returns
+// none when re matches nothing.
+func regexPaths(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return nil
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return nil
+		}
+		return []string{string(classRune(re.Rune))}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return []string{"a"}
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexPaths(re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest:
+		return []string{""}
+	case syntax.OpRepeat:
+		if re.Min == 0 {
+			return []string{""}
+		}
+		var paths []string
+		for _, sub := range regexPaths(re.Sub[0]) {
+			paths = append(paths, strings.Repeat(sub, re.Min))
+		}
+		return paths
+	case syntax.OpConcat:
+		paths := []string{""}
+		for _, sub := range re.Sub {
+			subPaths := regexPaths(sub)
+			var next []string
+			for _, prefix := range paths {
+				for _, suffix := range subPaths {
+					if len(next) < maxSimulatedPaths {
+						next = append(next, prefix+suffix)
+					}
+				}
+			}
+			paths = next
+		}
+		return paths
+	case syntax.OpAlternate:
+		var paths []string
+		for _, sub := range re.Sub {
+			paths = append(paths, regexPaths(sub)...)
+		}
+		if len(paths) > maxSimulatedPaths {
+			paths = paths[:maxSimulatedPaths]
+		}
+		return paths
+	default:
+		// Empty matches, anchors and word boundaries.
+		return []string{""}
+	}
+}
+
+// classRune returns a rune of the character class given by its ranges,
+// preferring one that reads naturally in a path.
+func classRune(ranges []rune) rune {
+	for _, r := range "a0-_./" {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if ranges[i] <= r && r <= ranges[i+1] {
+				return r
+			}
+		}
+	}
+	return ranges[0]
+}
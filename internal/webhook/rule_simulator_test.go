@@ -0,0 +1,107 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"strings"
+	"testing"
+
+	customrouterv1alpha1 "github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func regexMatch(path string) customrouterv1alpha1.PathMatch {
+	return customrouterv1alpha1.PathMatch{Path: path, Type: customrouterv1alpha1.MatchTypeRegex}
+}
+
+func TestSimulateRules(t *testing.T) {
+	requiredNoValues := newRouteWithRules(prefixMatch("/api", 0))
+	requiredNoValues.Spec.PathPrefixes = &customrouterv1alpha1.PathPrefixes{
+		Policy: customrouterv1alpha1.PathPrefixPolicyRequired,
+	}
+	requiredWithValues := newRouteWithRules(prefixMatch("/api", 0), regexMatch("^/docs/.*$"))
+	requiredWithValues.Spec.PathPrefixes = &customrouterv1alpha1.PathPrefixes{
+		Policy: customrouterv1alpha1.PathPrefixPolicyRequired,
+		Values: []string{"es", "fr"},
+	}
+	disabled := newRouteWithRules(regexMatch("^/api$/v1"))
+	disabled.Spec.Enabled = new(bool)
+
+	tests := []struct {
+		name         string
+		route        *customrouterv1alpha1.CustomHTTPRoute
+		wantWarnings []string
+	}{
+		{
+			name:  "reachable matches",
+			route: newRouteWithRules(prefixMatch("/api", 0), regexMatch(`^/users/\d+/(edit|view)$`)),
+		},
+		{
+			name:  "required policy without prefix values",
+			route: requiredNoValues,
+			wantWarnings: []string{
+				"rules[0].matches[0] (prefix /api) produces no routes: the pathPrefixes policy is Required",
+			},
+		},
+		{
+			name:  "required policy with prefix values",
+			route: requiredWithValues,
+		},
+		{
+			name:  "regex anchored in the middle",
+			route: newRouteWithRules(regexMatch("^/api$/v1")),
+			wantWarnings: []string{
+				`rules[0].matches[0] (regex ^/api$/v1) can never match: a request for "/api/v1"`,
+			},
+		},
+		{
+			name:  "regex with one reachable alternative",
+			route: newRouteWithRules(regexMatch("^(/a$x|/b)")),
+		},
+		{
+			name:  "regex matching nothing",
+			route: newRouteWithRules(regexMatch(`/[^\x00-\x{10FFFF}]`)),
+			wantWarnings: []string{
+				"can never match: no request path can match its routes",
+			},
+		},
+		{
+			name:  "exact path with a query string",
+			route: newRouteWithRules(customrouterv1alpha1.PathMatch{Path: "/search?q=1", Type: customrouterv1alpha1.MatchTypeExact}),
+			wantWarnings: []string{
+				`rules[0].matches[0] (exact /search?q=1) can never match: a request for "/search?q=1"`,
+			},
+		},
+		{
+			name:  "disabled route",
+			route: disabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := SimulateRules(tt.route)
+			if len(warnings) != len(tt.wantWarnings) {
+				t.Fatalf("warnings = %q, want %d", warnings, len(tt.wantWarnings))
+			}
+			for i, want := range tt.wantWarnings {
+				if !strings.Contains(warnings[i], want) {
+					t.Errorf("warning %d = %q, want it to contain %q", i, warnings[i], want)
+				}
+			}
+		})
+	}
+}
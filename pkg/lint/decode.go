@@ -0,0 +1,249 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+	"sigs.k8s.io/yaml"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/api/v1alpha2"
+)
+
+// defaultNamespace is the namespace of manifests that do not set one, as
+// kubectl applies them without --namespace.
+const defaultNamespace = "default"
+
+// manifestExtensions are the extensions of the files LoadPaths reads from
+// directories.
+var manifestExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+var decoder = func() runtime.Decoder {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	if err := v1alpha2.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	return serializer.NewCodecFactory(scheme, serializer.EnableStrict).UniversalDeserializer()
+}()
+
+// LoadPaths reads the CustomHTTPRoutes of the manifest files in paths, and
+// the CustomRouterConfigs and Namespaces their defaults depend on.
+// Directories are walked for .yaml, .yml and .json files; "-" reads
+// standard input. Documents of other kinds are skipped, and documents that
+// cannot be decoded are returned as findings.
+func LoadPaths(paths []string) ([]Document, []Finding, error) {
+	var docs []Document
+	var findings []Finding
+	for _, path := range paths {
+		if path == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return nil, nil, fmt.Errorf("reading standard input: %w", err)
+			}
+			d, f := Decode("-", data)
+			docs, findings = append(docs, d...), append(findings, f...)
+			continue
+		}
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || (file != path && !manifestExtensions[strings.ToLower(filepath.Ext(file))]) {
+				return nil
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			d, f := Decode(file, data)
+			docs, findings = append(docs, d...), append(findings, f...)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return docs, findings, nil
+}
+
+// Decode reads the CustomHTTPRoutes, CustomRouterConfigs and Namespaces of
+// the YAML or JSON documents of a manifest file, converting other served
+// versions of CustomHTTPRoute to the v1alpha1 hub.
+// Unknown fields are reported, as the dry-run endpoint does.
+func Decode(file string, data []byte) ([]Document, []Finding) {
+	var docs []Document
+	var findings []Finding
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for index := 0; ; index++ {
+		raw, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			findings = append(findings, decodeFinding(file, fmt.Errorf("reading document %d: %w", index, err)))
+			break
+		}
+		doc, err := decodeDocument(raw)
+		if err != nil {
+			findings = append(findings, decodeFinding(file, fmt.Errorf("document %d: %w", index, err)))
+			continue
+		}
+		if doc != nil {
+			doc.File = file
+			docs = append(docs, *doc)
+		}
+	}
+	return docs, findings
+}
+
+// decodeDocument decodes a CustomHTTPRoute, CustomRouterConfig or Namespace
+// document. It returns nil for empty documents and documents of other kinds.
+func decodeDocument(raw []byte) (*Document, error) {
+	var meta metav1.TypeMeta
+	if err := yaml.Unmarshal(raw, &meta); err != nil {
+		return nil, err
+	}
+	gv, err := schema.ParseGroupVersion(meta.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case gv.Group == v1alpha1.GroupVersion.Group && meta.Kind == "CustomHTTPRoute":
+		route, err := decodeRoute(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &Document{Route: route}, nil
+	case gv.Group == v1alpha1.GroupVersion.Group && meta.Kind == "CustomRouterConfig":
+		config, err := decodeRouterConfig(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &Document{RouterConfig: config}, nil
+	case gv == corev1.SchemeGroupVersion && meta.Kind == "Namespace":
+		namespace := &corev1.Namespace{}
+		if err := yaml.Unmarshal(raw, namespace); err != nil {
+			return nil, err
+		}
+		return &Document{Namespace: namespace}, nil
+	}
+	return nil, nil
+}
+
+// decodeRouterConfig decodes a CustomRouterConfig document.
+func decodeRouterConfig(raw []byte) (*v1alpha1.CustomRouterConfig, error) {
+	obj, _, err := decoder.Decode(raw, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := obj.(*v1alpha1.CustomRouterConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a CustomRouterConfig, got %T", obj)
+	}
+	if p := config.Spec.PathPrefixes; p != nil && p.Policy == "" {
+		p.Policy = v1alpha1.PathPrefixPolicyOptional
+	}
+	return config, nil
+}
+
+// decodeRoute decodes a CustomHTTPRoute document.
+func decodeRoute(raw []byte) (*v1alpha1.CustomHTTPRoute, error) {
+	obj, _, err := decoder.Decode(raw, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var route *v1alpha1.CustomHTTPRoute
+	switch o := obj.(type) {
+	case *v1alpha1.CustomHTTPRoute:
+		route = o
+	case conversion.Convertible:
+		route = &v1alpha1.CustomHTTPRoute{}
+		if err := o.ConvertTo(route); err != nil {
+			return nil, fmt.Errorf("converting to %s: %w", v1alpha1.GroupVersion, err)
+		}
+	default:
+		return nil, fmt.Errorf("expected a CustomHTTPRoute, got %T", obj)
+	}
+	if route.Namespace == "" {
+		route.Namespace = defaultNamespace
+	}
+	applySchemaDefaults(route)
+	return route, nil
+}
+
+// applySchemaDefaults sets the defaults the API server applies from the CRD
+// schema, so the routes are checked as they would be stored.
+func applySchemaDefaults(route *v1alpha1.CustomHTTPRoute) {
+	spec := &route.Spec
+	if spec.PathPrefixes != nil && spec.PathPrefixes.Policy == "" {
+		spec.PathPrefixes.Policy = v1alpha1.PathPrefixPolicyOptional
+	}
+	if spec.Defaults != nil {
+		applyActionDefaults(spec.Defaults.Actions)
+	}
+	for i := range spec.Rules {
+		rule := &spec.Rules[i]
+		applyActionDefaults(rule.Actions)
+		for j := range rule.Matches {
+			match := &rule.Matches[j]
+			if match.Type == "" {
+				match.Type = v1alpha1.MatchTypePathPrefix
+			}
+			for k := range match.Headers {
+				if match.Headers[k].Type == "" {
+					match.Headers[k].Type = v1alpha1.HeaderMatchTypeExact
+				}
+			}
+			for k := range match.QueryParams {
+				if match.QueryParams[k].Type == "" {
+					match.QueryParams[k].Type = v1alpha1.QueryParamMatchTypeExact
+				}
+			}
+		}
+	}
+}
+
+func applyActionDefaults(actions []v1alpha1.Action) {
+	for i := range actions {
+		if r := actions[i].Redirect; r != nil && r.StatusCode == 0 {
+			r.StatusCode = 302
+		}
+	}
+}
+
+func decodeFinding(file string, err error) Finding {
+	return Finding{File: file, Check: CheckDecode, Severity: SeverityError, Message: err.Error()}
+}
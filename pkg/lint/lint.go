@@ -0,0 +1,317 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lint checks CustomHTTPRoute manifests offline, without a cluster:
+// it runs the admission webhook's validation, overlap, conflict and rule
+// simulation checks, finds routes shadowed by the routes of other
+// CustomHTTPRoutes of the same target and flags regular expressions that are
+// costly or likely mistaken. The customrouter lint command is built on it.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/internal/webhook"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// Severity is how serious a finding is.
+type Severity string
+
+const (
+	// SeverityError is a finding the admission webhook rejects, or a
+	// manifest that cannot be read.
+	SeverityError Severity = "error"
+	// SeverityWarning is a finding the route is admitted with.
+	SeverityWarning Severity = "warning"
+)
+
+// Checks reported in Finding.Check.
+const (
+	CheckDecode     = "decode"
+	CheckValidation = "validation"
+	CheckOverlap    = "overlap"
+	CheckConflict   = "conflict"
+	CheckShadowing  = "shadowing"
+	CheckSimulation = "simulation"
+	CheckRegex      = "regex"
+)
+
+// Finding is a problem found in a manifest.
+type Finding struct {
+	// File is the file of the manifest.
+	File string `json:"file"`
+
+	// Route is the namespace/name of the CustomHTTPRoute, empty when the
+	// manifest could not be decoded.
+	Route string `json:"route,omitempty"`
+
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	location := f.File
+	if f.Route != "" {
+		location += ": " + f.Route
+	}
+	return fmt.Sprintf("%s: %s [%s] %s", location, f.Severity, f.Check, f.Message)
+}
+
+// Document is an object read from a manifest file: a CustomHTTPRoute, or a
+// CustomRouterConfig or Namespace the defaults of the routes depend on.
+// Exactly one of Route, RouterConfig and Namespace is set.
+type Document struct {
+	File         string
+	Route        *v1alpha1.CustomHTTPRoute
+	RouterConfig *v1alpha1.CustomRouterConfig
+	Namespace    *corev1.Namespace
+}
+
+// Options tune the checks to the operator the routes are deployed with.
+type Options struct {
+	// MatchStrategy is the operator's match strategy for the targets of the
+	// routes; empty is FirstMatch. It decides the order shadowing is
+	// checked in.
+	MatchStrategy string
+}
+
+// Lint checks the routes of docs and returns their findings, in input order.
+// Routes are checked against each other as if they were all applied, in input
+// order, to an otherwise empty cluster: a route with an error is rejected and
+// left out of the checks of the routes after it. Like the controller, the
+// checks after the structural validation see the defaults routes inherit
+// from the CustomRouterConfigs of docs, selecting namespaces by the labels
+// of the Namespaces of docs; a namespace without one has no labels. Checks that need other objects, such as the
+// namespace target allow-lists, the admission policy, HTTPRoute conflicts
+// and redirect loops, are not run.
+func Lint(docs []Document, opts Options) []Finding {
+	var findings []Finding
+	add := func(doc Document, check string, severity Severity, message string) {
+		findings = append(findings, Finding{
+			File:     doc.File,
+			Route:    routeName(doc.Route),
+			Check:    check,
+			Severity: severity,
+			Message:  message,
+		})
+	}
+
+	resolver := routerConfigResolver(docs)
+	seen := make(map[string]string)
+	valid := make([]Document, 0, len(docs))
+	for _, doc := range docs {
+		if doc.Route == nil {
+			continue
+		}
+		name := routeName(doc.Route)
+		if file, ok := seen[name]; ok {
+			add(doc, CheckValidation, SeverityError, fmt.Sprintf("CustomHTTPRoute %s is also defined in %s", name, file))
+			continue
+		}
+		seen[name] = doc.File
+
+		if err := doc.Route.Validate(); err != nil {
+			add(doc, CheckValidation, SeverityError, err.Error())
+			continue
+		}
+		// Resolving reads no cluster and cannot fail.
+		doc.Route, _ = resolver.Resolve(doc.Route)
+		for _, w := range doc.Route.ActionOrderWarnings() {
+			add(doc, CheckValidation, SeverityWarning, w)
+		}
+
+		rejected := false
+		warnings, err := webhook.CheckRuleOverlaps(doc.Route, nil)
+		for _, w := range warnings {
+			add(doc, CheckOverlap, SeverityWarning, w)
+		}
+		if err != nil {
+			add(doc, CheckOverlap, SeverityError, err.Error())
+			rejected = true
+		}
+
+		others := make([]v1alpha1.CustomHTTPRoute, len(valid))
+		for i := range valid {
+			others[i] = *valid[i].Route
+		}
+		warnings, err = webhook.CheckCustomHTTPRouteConflicts(doc.Route, others)
+		for _, w := range warnings {
+			add(doc, CheckConflict, SeverityWarning, w)
+		}
+		if err != nil {
+			add(doc, CheckConflict, SeverityError, err.Error())
+			rejected = true
+		}
+
+		for _, w := range webhook.SimulateRules(doc.Route) {
+			add(doc, CheckSimulation, SeverityWarning, w)
+		}
+		for _, w := range regexWarnings(doc.Route) {
+			add(doc, CheckRegex, SeverityWarning, w)
+		}
+		if !rejected {
+			valid = append(valid, doc)
+		}
+	}
+
+	for _, s := range shadowedRoutes(valid, opts.MatchStrategy) {
+		add(s.doc, CheckShadowing, SeverityWarning, s.message)
+	}
+	return findings
+}
+
+// routerConfigResolver returns a resolver for the CustomRouterConfigs of
+// docs, or nil when there are none.
+func routerConfigResolver(docs []Document) *v1alpha1.RouterConfigResolver {
+	var configs []v1alpha1.CustomRouterConfig
+	namespaceLabels := make(map[string]map[string]string)
+	for _, doc := range docs {
+		switch {
+		case doc.RouterConfig != nil:
+			configs = append(configs, *doc.RouterConfig)
+		case doc.Namespace != nil:
+			namespaceLabels[doc.Namespace.Name] = doc.Namespace.Labels
+		}
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+	return v1alpha1.NewRouterConfigResolver(configs, func(namespace string) (map[string]string, error) {
+		return namespaceLabels[namespace], nil
+	})
+}
+
+// CountRoutes returns how many of docs are CustomHTTPRoutes.
+func CountRoutes(docs []Document) int {
+	n := 0
+	for _, doc := range docs {
+		if doc.Route != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// HasErrors reports whether findings holds an error.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// routeName returns the namespace/name of route.
+func routeName(route *v1alpha1.CustomHTTPRoute) string {
+	if route == nil {
+		return ""
+	}
+	return route.Namespace + "/" + route.Name
+}
+
+// shadowing is a route of doc shadowed by the route of another document.
+type shadowing struct {
+	doc     Document
+	message string
+}
+
+// shadowedRoutes merges the routes of docs per target and host the way the
+// operator does, and returns the routes an earlier route of another
+// CustomHTTPRoute matches every request of. Shadowing between the matches
+// of a single CustomHTTPRoute is left to CheckRuleOverlaps.
+func shadowedRoutes(docs []Document, strategy string) []shadowing {
+	byTarget := make(map[string][]Document)
+	for _, doc := range docs {
+		target := doc.Route.Spec.TargetRef.Name
+		byTarget[target] = append(byTarget[target], doc)
+	}
+	targets := make([]string, 0, len(byTarget))
+	for target := range byTarget {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	var shadowed []shadowing
+	for _, target := range targets {
+		targetDocs := byTarget[target]
+		// The operator merges the routes of a target in namespace/name order.
+		sort.SliceStable(targetDocs, func(i, j int) bool {
+			return routeName(targetDocs[i].Route) < routeName(targetDocs[j].Route)
+		})
+
+		bySource := make(map[string]Document, len(targetDocs))
+		merged := make(map[string][]routes.Route)
+		for _, doc := range targetDocs {
+			hosts, err := routes.ExpandRoutes(doc.Route, nil)
+			if err != nil {
+				continue
+			}
+			source := routeName(doc.Route)
+			bySource[source] = doc
+			routes.AssignRouteIdentity(hosts, source)
+			for host, hostRoutes := range hosts {
+				merged[host] = append(merged[host], hostRoutes...)
+			}
+		}
+
+		hosts := make([]string, 0, len(merged))
+		for host := range merged {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		for _, host := range hosts {
+			hostRoutes := merged[host]
+			for i := range hostRoutes {
+				hostRoutes[i].MostSpecific = strategy == routes.MatchStrategyMostSpecific
+			}
+			sort.SliceStable(hostRoutes, func(i, j int) bool {
+				return routes.RouteLess(&hostRoutes[i], &hostRoutes[j])
+			})
+			for _, s := range routes.FindShadowedRoutes(hostRoutes) {
+				route, by := &hostRoutes[s.Route], &hostRoutes[s.ShadowedBy]
+				if route.Source == by.Source {
+					continue
+				}
+				shadowed = append(shadowed, shadowing{
+					doc: bySource[route.Source],
+					message: fmt.Sprintf("%s on %s can never match: %s of %s matches every request it would",
+						describeRoute(route), host, describeRoute(by), by.Source),
+				})
+			}
+		}
+	}
+	return shadowed
+}
+
+// describeRoute returns the match of route, e.g. "GET prefix /api".
+func describeRoute(route *routes.Route) string {
+	parts := []string{route.Type, route.Path}
+	if route.Method != "" {
+		parts = append([]string{route.Method}, parts...)
+	}
+	if route.Scheme != "" {
+		parts = append([]string{route.Scheme}, parts...)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+const manifests = `
+apiVersion: customrouter.freepik.com/v1alpha1
+kind: CustomHTTPRoute
+metadata:
+  name: platform
+  namespace: edge
+spec:
+  targetRef:
+    name: default
+  hostnames: [www.example.com]
+  rules:
+    - matches:
+        - path: /api
+          priority: 2000
+      backendRefs:
+        - {name: api, namespace: edge, port: 8080}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+---
+apiVersion: customrouter.freepik.com/v1alpha1
+kind: CustomHTTPRoute
+metadata:
+  name: team
+  namespace: web
+spec:
+  targetRef:
+    name: default
+  hostnames: [www.example.com]
+  rules:
+    - matches:
+        - path: /api/v1
+        - path: /users/[0-9]+
+          type: Regex
+        - path: ^/health$
+          type: Regex
+      backendRefs:
+        - {name: api, namespace: web, port: 8080}
+---
+apiVersion: customrouter.freepik.com/v1alpha1
+kind: CustomHTTPRoute
+metadata:
+  name: copy
+  namespace: edge
+spec:
+  targetRef:
+    name: default
+  hostnames: [www.example.com]
+  rules:
+    - matches:
+        - path: /api
+          priority: 2000
+      backendRefs:
+        - {name: api, namespace: edge, port: 8080}
+---
+apiVersion: customrouter.freepik.com/v1alpha1
+kind: CustomHTTPRoute
+metadata:
+  name: typo
+spec:
+  targetRef:
+    name: default
+  hostname: [www.example.com]
+`
+
+func TestDecode(t *testing.T) {
+	docs, findings := Decode("routes.yaml", []byte(manifests))
+	if len(docs) != 3 {
+		t.Fatalf("Decode() returned %d routes, want 3: the Service is skipped and the typo fails", len(docs))
+	}
+	if len(findings) != 1 || findings[0].Check != CheckDecode || !strings.Contains(findings[0].Message, "hostname") {
+		t.Errorf("findings = %v, want the unknown field of the last document", findings)
+	}
+	if got := docs[1].Route.Spec.Rules[0].Matches[0].Type; got != v1alpha1.MatchTypePathPrefix {
+		t.Errorf("match type = %q, want the schema default %q", got, v1alpha1.MatchTypePathPrefix)
+	}
+}
+
+func TestLint(t *testing.T) {
+	docs, _ := Decode("routes.yaml", []byte(manifests))
+	findings := Lint(docs, Options{})
+
+	checks := make(map[string]Finding)
+	for _, f := range findings {
+		checks[f.Route+" "+f.Check] = f
+	}
+	for key, severity := range map[string]Severity{
+		"edge/copy conflict": SeverityError,
+		"web/team shadowing": SeverityWarning,
+		"web/team regex":     SeverityWarning,
+	} {
+		if f, ok := checks[key]; !ok || f.Severity != severity {
+			t.Errorf("no %s finding for %s in %v", severity, key, findings)
+		}
+	}
+	if !HasErrors(findings) {
+		t.Error("HasErrors() = false, want true for the conflict")
+	}
+	if _, ok := checks["edge/platform conflict"]; ok {
+		t.Error("the first of two conflicting routes is reported, want only the later one")
+	}
+}
+
+const routerConfigManifests = `
+apiVersion: customrouter.freepik.com/v1alpha1
+kind: CustomRouterConfig
+metadata:
+  name: locales
+spec:
+  namespaceSelector:
+    matchLabels: {locale: es}
+  pathPrefixes:
+    values: [es]
+    policy: Required
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: shop-es
+  labels: {locale: es}
+---
+apiVersion: customrouter.freepik.com/v1alpha1
+kind: CustomHTTPRoute
+metadata:
+  name: cart-es
+  namespace: shop
+spec:
+  targetRef:
+    name: default
+  hostnames: [www.example.com]
+  rules:
+    - matches:
+        - path: /es/cart
+      backendRefs:
+        - {name: cart, namespace: shop, port: 8080}
+---
+apiVersion: customrouter.freepik.com/v1alpha1
+kind: CustomHTTPRoute
+metadata:
+  name: cart
+  namespace: shop-es
+spec:
+  targetRef:
+    name: default
+  hostnames: [www.example.com]
+  rules:
+    - matches:
+        - path: /cart
+      backendRefs:
+        - {name: cart, namespace: shop-es, port: 8080}
+`
+
+func TestLintRouterConfigDefaults(t *testing.T) {
+	docs, findings := Decode("routes.yaml", []byte(routerConfigManifests))
+	if len(findings) != 0 {
+		t.Fatalf("Decode() findings = %v", findings)
+	}
+	if got := CountRoutes(docs); got != 2 {
+		t.Fatalf("CountRoutes() = %d, want 2", got)
+	}
+
+	// shop-es/cart inherits the /es prefix and serves /es/cart too.
+	findings = Lint(docs, Options{})
+	if len(findings) != 1 || findings[0].Route != "shop-es/cart" || findings[0].Check != CheckConflict {
+		t.Errorf("findings = %v, want a conflict of shop-es/cart", findings)
+	}
+
+	// Without its labels the namespace is not selected.
+	var unlabelled []Document
+	for _, doc := range docs {
+		if doc.Namespace == nil {
+			unlabelled = append(unlabelled, doc)
+		}
+	}
+	if findings := Lint(unlabelled, Options{}); len(findings) != 0 {
+		t.Errorf("findings without the Namespace = %v, want none", findings)
+	}
+}
+
+func TestRegexWarnings(t *testing.T) {
+	route := &v1alpha1.CustomHTTPRoute{Spec: v1alpha1.CustomHTTPRouteSpec{
+		Hostnames: []string{"www.example.com"},
+		Rules: []v1alpha1.Rule{{
+			Matches: []v1alpha1.PathMatch{
+				{Path: "^/users/[0-9]+$", Type: v1alpha1.MatchTypeRegex},
+				{Path: "/users/[0-9]+", Type: v1alpha1.MatchTypeRegex},
+				{Path: "^/health$", Type: v1alpha1.MatchTypeRegex},
+				{Path: "^/health$", Type: v1alpha1.MatchTypeRegex, CaseInsensitive: true},
+				{Path: "^/[a-z]{1000}[0-9]{1000}[A-Z]{1000}$", Type: v1alpha1.MatchTypeRegex},
+			},
+		}},
+	}}
+	warnings := regexWarnings(route)
+	want := []string{"matches[1] (regex /users/[0-9]+) is not anchored", "matches[2] (regex ^/health$) matches a single path",
+		"matches[4] (regex ^/[a-z]{1000}[0-9]{1000}[A-Z]{1000}$) compiles to"}
+	if len(warnings) != len(want) {
+		t.Fatalf("regexWarnings() = %q, want %d warnings", warnings, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(warnings[i], w) {
+			t.Errorf("warning %d = %q, want it to contain %q", i, warnings[i], w)
+		}
+	}
+}
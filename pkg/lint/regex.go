@@ -0,0 +1,171 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"fmt"
+	"regexp/syntax"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// maxRegexInstructions is the compiled size above which a regex is reported
+// as costly. Regex routes are tried one after another on every request that
+// reaches them, and their cost grows with the size of their program.
+const maxRegexInstructions = 2000
+
+// regexWarnings checks the regular expressions of the enabled rules of route:
+// regex paths, as expanded for its first hostname with the path prefixes
+// inserted, and regex header and query parameter values. A path regex that
+// is not anchored with ^ matches anywhere in the path, and one that matches a
+// single literal path is better served by an Exact match, which is found by
+// a map lookup and is never shed under overload.
+func regexWarnings(route *v1alpha1.CustomHTTPRoute) []string {
+	hostnames := route.Spec.RoutedHostnames()
+	if !route.Spec.IsEnabled() || len(hostnames) == 0 {
+		return nil
+	}
+
+	var warnings []string
+	for i, rule := range route.Spec.EffectiveRules() {
+		if !rule.IsEnabled() {
+			continue
+		}
+		for j, match := range rule.Matches {
+			field := fmt.Sprintf("rules[%d].matches[%d]", i, j)
+			if match.Type == v1alpha1.MatchTypeRegex {
+				warnings = append(warnings, pathRegexWarnings(route, rule, match, hostnames[0], field)...)
+			}
+			for k, h := range match.Headers {
+				if h.Type == v1alpha1.HeaderMatchTypeRegularExpression {
+					warnings = append(warnings, regexSizeWarnings(fmt.Sprintf("%s.headers[%d]", field, k), h.Value)...)
+				}
+			}
+			for k, q := range match.QueryParams {
+				if q.Type == v1alpha1.QueryParamMatchTypeRegularExpression {
+					warnings = append(warnings, regexSizeWarnings(fmt.Sprintf("%s.queryParams[%d]", field, k), q.Value)...)
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// pathRegexWarnings checks the regex routes match expands to.
+func pathRegexWarnings(
+	route *v1alpha1.CustomHTTPRoute, rule v1alpha1.Rule, match v1alpha1.PathMatch, hostname, field string,
+) []string {
+	single := rule
+	single.Matches = []v1alpha1.PathMatch{match}
+	single.GRPCMatches = nil
+	expanded, err := routes.ExpandRoutes(&v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames:    []string{hostname},
+			PathPrefixes: route.Spec.PathPrefixes,
+			Rules:        []v1alpha1.Rule{single},
+		},
+	}, nil)
+	if err != nil {
+		return nil
+	}
+
+	field = fmt.Sprintf("%s (regex %s)", field, match.Path)
+	var warnings []string
+	var unanchored, literal bool
+	for _, r := range expanded[hostname] {
+		if r.Type != routes.RouteTypeRegex {
+			continue
+		}
+		re, err := syntax.Parse(r.Path, syntax.Perl)
+		if err != nil {
+			continue
+		}
+		re = re.Simplify()
+		if !unanchored && !anchoredAtStart(re) {
+			unanchored = true
+			warnings = append(warnings, fmt.Sprintf(
+				"%s is not anchored with ^: it matches any path containing it, not only paths starting with it", field))
+		}
+		if !literal && !match.CaseInsensitive && literalPath(re) {
+			literal = true
+			warnings = append(warnings, fmt.Sprintf(
+				"%s matches a single path: use an Exact match, which is cheaper to evaluate", field))
+		}
+		if size := regexSize(re); size > maxRegexInstructions {
+			warnings = append(warnings, fmt.Sprintf(
+				"%s compiles to %d instructions, over %d: it is costly to evaluate on every request reaching it",
+				field, size, maxRegexInstructions))
+			break
+		}
+	}
+	return warnings
+}
+
+// regexSizeWarnings checks the compiled size of the regex value of field.
+func regexSizeWarnings(field, value string) []string {
+	re, err := syntax.Parse(value, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	if size := regexSize(re.Simplify()); size > maxRegexInstructions {
+		return []string{fmt.Sprintf(
+			"%s (regex %s) compiles to %d instructions, over %d: it is costly to evaluate on every request reaching it",
+			field, value, size, maxRegexInstructions)}
+	}
+	return nil
+}
+
+// regexSize returns the number of instructions re compiles to, 0 when it
+// does not compile.
+func regexSize(re *syntax.Regexp) int {
+	prog, err := syntax.Compile(re)
+	if err != nil {
+		return 0
+	}
+	return len(prog.Inst)
+}
+
+// anchoredAtStart reports whether every match of re starts at the beginning
+// of the text.
+func anchoredAtStart(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpBeginText:
+		return true
+	case syntax.OpConcat, syntax.OpCapture:
+		return len(re.Sub) > 0 && anchoredAtStart(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !anchoredAtStart(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// literalPath reports whether re is a case-sensitive literal anchored at
+// both ends, such as ^/health$.
+func literalPath(re *syntax.Regexp) bool {
+	if re.Op != syntax.OpConcat || len(re.Sub) != 3 {
+		return false
+	}
+	lit := re.Sub[1]
+	return re.Sub[0].Op == syntax.OpBeginText && re.Sub[2].Op == syntax.OpEndText &&
+		lit.Op == syntax.OpLiteral && lit.Flags&syntax.FoldCase == 0
+}
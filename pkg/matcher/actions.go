@@ -0,0 +1,407 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package matcher
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// Header is a header set by an action.
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+
+	// Append adds the value to an existing header (header-add) instead of
+	// overwriting it (header-set).
+	Append bool `json:"append,omitempty"`
+}
+
+// Redirect is the redirect a route answers a request with.
+type Redirect struct {
+	Location   string `json:"location"`
+	StatusCode int32  `json:"statusCode"`
+
+	// AltSvc is the Alt-Svc header the redirect action sets, or empty to
+	// leave it to the caller.
+	AltSvc string `json:"altSvc,omitempty"`
+}
+
+// Forward is the request a route forwards to its backend, as left by the
+// route's actions.
+type Forward struct {
+	// Path is the forwarded :path, query string included.
+	Path string `json:"path"`
+
+	// Authority is the hostname a rewrite action sets, or empty when the
+	// request keeps its authority.
+	Authority string `json:"authority,omitempty"`
+
+	// SetHeaders and RemoveHeaders are the request header actions, in the
+	// order they are applied.
+	SetHeaders    []Header `json:"setHeaders,omitempty"`
+	RemoveHeaders []string `json:"removeHeaders,omitempty"`
+}
+
+// EvaluateRedirect returns the redirect route answers the request of vars
+// with, or nil when it has no redirect action. A redirect takes precedence
+// over the other actions, unless the route applies its actions
+// sequentially: then the redirect sees the request as rewritten by the
+// actions listed before it.
+func EvaluateRedirect(route *routes.Route, vars *Vars) *Redirect {
+	if route.SequentialActions {
+		action, current := sequentialRedirect(route, vars)
+		if action == nil {
+			return nil
+		}
+		return redirectTo(*action, route, current, vars.Path)
+	}
+	for _, action := range route.Actions {
+		if action.Type == routes.ActionTypeRedirect {
+			return redirectTo(action, route, vars, vars.Path)
+		}
+	}
+	return nil
+}
+
+// redirectTo builds the redirect of action. matchedPath is the request path
+// the route matched, whose suffix a prefix replacement keeps.
+func redirectTo(action routes.RouteAction, route *routes.Route, vars *Vars, matchedPath string) *Redirect {
+	scheme := action.RedirectScheme
+	if scheme == "" {
+		scheme = vars.Scheme
+	}
+
+	hostname := action.RedirectHostname
+	port := action.RedirectPort
+	if hostname == "" {
+		var requestPort int32
+		hostname, requestPort = splitPort(vars.Host)
+		// A redirect to the same host and scheme keeps the port the client
+		// used, e.g. a NodePort; a scheme change implies its default port.
+		if port == 0 && !action.RedirectStripPort && scheme == vars.Scheme {
+			port = requestPort
+		}
+	}
+
+	path := vars.SubstitutePath(action.RedirectPath)
+	if path == "" {
+		path = vars.Path
+	} else if shouldReplacePrefixMatchForRedirect(action, route) {
+		// Strip the matched PathPrefix from the request path and append the
+		// remaining suffix to the redirect path (Gateway API ReplacePrefixMatch).
+		path = joinRedirectPath(path, prefixSuffix(route, matchedPath))
+	}
+
+	// Only include port if non-standard
+	portStr := ""
+	if port > 0 {
+		if (scheme != "http" || port != 80) &&
+			(scheme != "https" || port != 443) {
+			portStr = ":" + strconv.Itoa(int(port))
+		}
+	}
+
+	statusCode := action.RedirectStatusCode
+	if statusCode == 0 {
+		statusCode = 302
+	}
+
+	return &Redirect{
+		Location:   scheme + "://" + hostname + portStr + path,
+		StatusCode: statusCode,
+		AltSvc:     action.RedirectAltSvc,
+	}
+}
+
+// upgradeHeaders are the headers a strip-upgrade action removes.
+var upgradeHeaders = []string{"upgrade", "connection"}
+
+// IsUpgrade reports whether a request with the given headers (lowercased
+// names) attempts a protocol upgrade such as WebSocket. Envoy presents
+// HTTP/2 extended CONNECT requests in the HTTP/1.1 Upgrade form, so the
+// Upgrade header covers both.
+func IsUpgrade(headers map[string]string) bool {
+	return headers["upgrade"] != ""
+}
+
+// UpgradeDenial returns the status the deny-upgrade action of route rejects
+// the request with, or 0 when the route has none or the request does not
+// attempt an upgrade.
+func UpgradeDenial(route *routes.Route, headers map[string]string) int32 {
+	if !IsUpgrade(headers) {
+		return 0
+	}
+	for _, action := range route.Actions {
+		if action.Type == routes.ActionTypeDenyUpgrade {
+			if action.UpgradeStatusCode == 0 {
+				return routes.DefaultUpgradeStatusCode
+			}
+			return action.UpgradeStatusCode
+		}
+	}
+	return 0
+}
+
+// ApplyActions returns the request route forwards for the request of vars:
+// its path and authority after rewrite actions, and the request headers its
+// header and strip-upgrade actions set and remove. Redirect, require-auth,
+// deny-upgrade and response-side actions are not applied; see
+// EvaluateRedirect, UpgradeDenial and ResponseHeaders.
+func ApplyActions(route *routes.Route, vars *Vars) Forward {
+	fwd := Forward{Path: vars.Path}
+
+	// current is the request as seen by the next action: the original one, or
+	// for sequential routes the one left by the previous actions.
+	current := vars
+	if route.SequentialActions {
+		sequential := *vars
+		current = &sequential
+	}
+
+	for _, action := range route.Actions {
+		switch action.Type {
+		case routes.ActionTypeRewrite:
+			if rewritesPath(action) {
+				fwd.Path = rewritePath(action, route, current, vars.Path)
+			}
+			if action.RewriteHostname != "" {
+				fwd.Authority = action.RewriteHostname
+			}
+			if route.SequentialActions {
+				applyRewrite(current, action, fwd.Path)
+			}
+
+		case routes.ActionTypeHeaderSet, routes.ActionTypeHeaderAdd:
+			if action.HeaderName != "" {
+				fwd.SetHeaders = append(fwd.SetHeaders, Header{
+					Name:   action.HeaderName,
+					Value:  current.Substitute(action.Value),
+					Append: action.Type == routes.ActionTypeHeaderAdd,
+				})
+			}
+
+		case routes.ActionTypeHeaderRemove:
+			if action.HeaderName != "" {
+				if route.SequentialActions {
+					// Envoy removes headers before setting them, so values set
+					// by earlier actions are dropped here instead.
+					fwd.SetHeaders = dropHeader(fwd.SetHeaders, action.HeaderName)
+				}
+				fwd.RemoveHeaders = append(fwd.RemoveHeaders, action.HeaderName)
+			}
+
+		case routes.ActionTypeStripUpgrade:
+			if IsUpgrade(vars.Headers) {
+				for _, name := range upgradeHeaders {
+					if route.SequentialActions {
+						fwd.SetHeaders = dropHeader(fwd.SetHeaders, name)
+					}
+					fwd.RemoveHeaders = append(fwd.RemoveHeaders, name)
+				}
+			}
+		}
+	}
+
+	// gRPC paths are "/<service>/<method>" and never carry a query string,
+	// whatever the rewrite template expanded to.
+	if route.GRPC {
+		fwd.Path = StripQueryString(fwd.Path)
+	}
+	return fwd
+}
+
+// ResponseHeaders returns the response headers the response-header actions
+// of route set and remove, with placeholders expanded from the request of
+// vars.
+func ResponseHeaders(route *routes.Route, vars *Vars) (set []Header, remove []string) {
+	for _, action := range route.Actions {
+		if action.HeaderName == "" {
+			continue
+		}
+		switch action.Type {
+		case routes.ActionTypeResponseHeaderSet, routes.ActionTypeResponseHeaderAdd:
+			set = append(set, Header{
+				Name:   action.HeaderName,
+				Value:  vars.Substitute(action.Value),
+				Append: action.Type == routes.ActionTypeResponseHeaderAdd,
+			})
+		case routes.ActionTypeResponseHeaderRemove:
+			remove = append(remove, action.HeaderName)
+		}
+	}
+	return set, remove
+}
+
+// joinRedirectPath appends the stripped suffix to the redirect basePath
+// without producing a duplicate "/" between path segments, and without
+// inserting a "/" in front of a query ("?") or fragment ("#") delimiter
+// (RFC 3986 §3.3). The suffix comes from stripping the matched PathPrefix
+// from vars.Path, which includes query/fragment as-is.
+func joinRedirectPath(basePath, suffix string) string {
+	if suffix == "" {
+		return basePath
+	}
+	switch suffix[0] {
+	case '?', '#':
+		return basePath + suffix
+	case '/':
+		if strings.HasSuffix(basePath, "/") {
+			return basePath + suffix[1:]
+		}
+		return basePath + suffix
+	default:
+		if strings.HasSuffix(basePath, "/") {
+			return basePath + suffix
+		}
+		return basePath + "/" + suffix
+	}
+}
+
+// shouldReplacePrefixMatchForRedirect determines whether a redirect should strip the
+// matched PathPrefix and append the remaining suffix to the redirect path.
+// Strictly opt-in (preserves backwards-compatible behaviour): only active when
+// the user explicitly sets replacePrefixMatch=true and the route is a PathPrefix.
+func shouldReplacePrefixMatchForRedirect(action routes.RouteAction, route *routes.Route) bool {
+	if action.RedirectReplacePrefixMatch == nil || !*action.RedirectReplacePrefixMatch {
+		return false
+	}
+	return route.Type == routes.RouteTypePrefix
+}
+
+// shouldReplacePrefixMatch determines whether a rewrite should use prefix replacement.
+// Explicit field takes precedence. Otherwise, convention: prefix rewrite for PathPrefix
+// routes whose rewritePath contains no variables (${...}); full rewrite otherwise.
+func shouldReplacePrefixMatch(action routes.RouteAction, route *routes.Route, _ string) bool {
+	if action.RewriteReplacePrefixMatch != nil {
+		return *action.RewriteReplacePrefixMatch
+	}
+	return route.Type == routes.RouteTypePrefix && !strings.Contains(action.RewritePath, "${")
+}
+
+// rewritesPath reports whether the rewrite action sets the path, in full or
+// segment by segment.
+func rewritesPath(action routes.RouteAction) bool {
+	return action.RewritePath != "" || len(action.RewriteSegments) > 0
+}
+
+// rewritePath returns the path a rewrite action sets for the request vars.
+// A prefix replacement keeps the suffix of matchedPath, the request path the
+// route matched, even when earlier sequential rewrites changed vars.Path.
+func rewritePath(action routes.RouteAction, route *routes.Route, vars *Vars, matchedPath string) string {
+	if len(action.RewriteSegments) > 0 {
+		return rewriteSegments(action.RewriteSegments, vars)
+	}
+	rewrittenBase := vars.SubstitutePath(action.RewritePath)
+	if shouldReplacePrefixMatch(action, route, rewrittenBase) {
+		return rewrittenBase + prefixSuffix(route, matchedPath)
+	}
+	return rewrittenBase
+}
+
+// rewriteSegments returns the path of vars with the segments of segments
+// replaced by their value, expanded like a rewrite path, or removed when
+// the value expands to nothing. Segments are counted like
+// ${path.segment.N}, skipping empty ones; indexes past the last segment are
+// ignored, and a trailing slash and the query string are kept.
+func rewriteSegments(segments map[int]string, vars *Vars) string {
+	path, query := vars.Path, ""
+	if i := strings.IndexAny(path, "?#"); i != -1 {
+		path, query = path[:i], path[i:]
+	}
+	var b strings.Builder
+	for i, segment := range splitPath(path) {
+		if value, ok := segments[i]; ok {
+			segment = vars.SubstitutePath(value)
+		}
+		if segment != "" {
+			b.WriteByte('/')
+			b.WriteString(segment)
+		}
+	}
+	if b.Len() == 0 || strings.HasSuffix(path, "/") {
+		b.WriteByte('/')
+	}
+	b.WriteString(query)
+	return b.String()
+}
+
+// prefixSuffix returns the part of path after the prefix route matched.
+func prefixSuffix(route *routes.Route, path string) string {
+	if route.CaseInsensitive {
+		if suffix, ok := routes.TrimPrefixFold(path, route.Path); ok {
+			return suffix
+		}
+		if suffix, ok := routes.TrimPrefixFold(path, strings.TrimSuffix(route.Path, "/")); ok {
+			return suffix
+		}
+		return path
+	}
+	suffix := strings.TrimPrefix(path, route.Path)
+	// Handle trailing-slash route matching path without slash:
+	// e.g. route.Path="/audio/download/", path="/audio/download"
+	if suffix == path && strings.HasSuffix(route.Path, "/") {
+		suffix = strings.TrimPrefix(path, strings.TrimSuffix(route.Path, "/"))
+	}
+	return suffix
+}
+
+// applyRewrite updates vars, the request seen by the next action of a
+// sequential route, with a rewrite action that set the path to rewrittenPath.
+func applyRewrite(vars *Vars, action routes.RouteAction, rewrittenPath string) {
+	if rewritesPath(action) {
+		vars.Path = rewrittenPath
+		vars.PathSegments = splitPath(rewrittenPath)
+	}
+	if action.RewriteHostname != "" {
+		vars.Host = action.RewriteHostname
+	}
+}
+
+// sequentialRedirect returns the first redirect action of a sequential route
+// and the request as rewritten by the actions listed before it, or a nil
+// action when the route does not redirect.
+func sequentialRedirect(route *routes.Route, vars *Vars) (*routes.RouteAction, *Vars) {
+	current := *vars
+	for i := range route.Actions {
+		action := &route.Actions[i]
+		switch action.Type {
+		case routes.ActionTypeRedirect:
+			return action, &current
+		case routes.ActionTypeRewrite:
+			var path string
+			if rewritesPath(*action) {
+				path = rewritePath(*action, route, &current, vars.Path)
+			}
+			applyRewrite(&current, *action, path)
+		}
+	}
+	return nil, nil
+}
+
+// dropHeader removes the headers named name from headers, in place.
+func dropHeader(headers []Header, name string) []Header {
+	kept := headers[:0]
+	for _, h := range headers {
+		if !strings.EqualFold(h.Name, name) {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
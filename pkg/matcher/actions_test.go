@@ -0,0 +1,293 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func boolPtr(v bool) *bool { return &v }
+
+func TestShouldReplacePrefixMatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		action        routes.RouteAction
+		routeType     string
+		rewrittenBase string
+		want          bool
+	}{
+		{
+			name:      "prefix route, no variables -> prefix rewrite",
+			action:    routes.RouteAction{RewritePath: "/api/v1"},
+			routeType: routes.RouteTypePrefix,
+			want:      true,
+		},
+		{
+			name:      "prefix route, with variables -> full rewrite",
+			action:    routes.RouteAction{RewritePath: "/api/${path.segment.1}"},
+			routeType: routes.RouteTypePrefix,
+			want:      false,
+		},
+		{
+			name:      "exact route, no variables -> full rewrite",
+			action:    routes.RouteAction{RewritePath: "/api/v1"},
+			routeType: routes.RouteTypeExact,
+			want:      false,
+		},
+		{
+			name:      "regex route, no variables -> full rewrite",
+			action:    routes.RouteAction{RewritePath: "/api/v1"},
+			routeType: routes.RouteTypeRegex,
+			want:      false,
+		},
+		{
+			name:      "explicit true overrides convention on exact route",
+			action:    routes.RouteAction{RewritePath: "/api/v1", RewriteReplacePrefixMatch: boolPtr(true)},
+			routeType: routes.RouteTypeExact,
+			want:      true,
+		},
+		{
+			name:      "explicit false overrides convention on prefix route",
+			action:    routes.RouteAction{RewritePath: "/api/v1", RewriteReplacePrefixMatch: boolPtr(false)},
+			routeType: routes.RouteTypePrefix,
+			want:      false,
+		},
+		{
+			name:      "explicit true on prefix route with variables",
+			action:    routes.RouteAction{RewritePath: "/api/${host}", RewriteReplacePrefixMatch: boolPtr(true)},
+			routeType: routes.RouteTypePrefix,
+			want:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &routes.Route{Type: tt.routeType}
+			got := shouldReplacePrefixMatch(tt.action, route, tt.rewrittenBase)
+			if got != tt.want {
+				t.Errorf("shouldReplacePrefixMatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinRedirectPath(t *testing.T) {
+	tests := []struct {
+		basePath string
+		suffix   string
+		want     string
+	}{
+		{"/app", "", "/app"},
+		{"/app", "/foo", "/app/foo"},
+		{"/app/", "/foo", "/app/foo"},
+		{"/app/", "foo", "/app/foo"},
+		{"/app", "foo", "/app/foo"},
+		{"/app", "?q=1", "/app?q=1"},
+		{"/app/", "?q=1", "/app/?q=1"},
+		{"/app", "#frag", "/app#frag"},
+		{"/app", "/foo?q=1", "/app/foo?q=1"},
+		{"/app", "/foo#frag", "/app/foo#frag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.basePath+"+"+tt.suffix, func(t *testing.T) {
+			got := joinRedirectPath(tt.basePath, tt.suffix)
+			if got != tt.want {
+				t.Errorf("joinRedirectPath(%q, %q) = %q, want %q", tt.basePath, tt.suffix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldReplacePrefixMatchForRedirect(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    routes.RouteAction
+		routeType string
+		want      bool
+	}{
+		{
+			name:      "nil flag on prefix route -> off (backwards compatible)",
+			action:    routes.RouteAction{RedirectPath: "/app"},
+			routeType: routes.RouteTypePrefix,
+			want:      false,
+		},
+		{
+			name:      "explicit false on prefix route -> off",
+			action:    routes.RouteAction{RedirectPath: "/app", RedirectReplacePrefixMatch: boolPtr(false)},
+			routeType: routes.RouteTypePrefix,
+			want:      false,
+		},
+		{
+			name:      "explicit true on prefix route -> on",
+			action:    routes.RouteAction{RedirectPath: "/app", RedirectReplacePrefixMatch: boolPtr(true)},
+			routeType: routes.RouteTypePrefix,
+			want:      true,
+		},
+		{
+			name:      "explicit true on exact route -> off (only prefix supported)",
+			action:    routes.RouteAction{RedirectPath: "/app", RedirectReplacePrefixMatch: boolPtr(true)},
+			routeType: routes.RouteTypeExact,
+			want:      false,
+		},
+		{
+			name:      "explicit true on regex route -> off",
+			action:    routes.RouteAction{RedirectPath: "/app", RedirectReplacePrefixMatch: boolPtr(true)},
+			routeType: routes.RouteTypeRegex,
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &routes.Route{Type: tt.routeType}
+			got := shouldReplacePrefixMatchForRedirect(tt.action, route)
+			if got != tt.want {
+				t.Errorf("shouldReplacePrefixMatchForRedirect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateRedirectPort(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		scheme string
+		action routes.RouteAction
+		want   string
+	}{
+		{
+			name:   "request port is preserved",
+			host:   "staging.example.com:30443",
+			scheme: "https",
+			want:   "https://staging.example.com:30443/new",
+		},
+		{
+			name:   "default port of the scheme is left out",
+			host:   "example.com:443",
+			scheme: "https",
+			want:   "https://example.com/new",
+		},
+		{
+			name:   "IPv6 host with port",
+			host:   "[::1]:8080",
+			scheme: "http",
+			want:   "http://[::1]:8080/new",
+		},
+		{
+			name:   "IPv6 host without port",
+			host:   "[::1]",
+			scheme: "http",
+			want:   "http://[::1]/new",
+		},
+		{
+			name:   "invalid port is dropped",
+			host:   "example.com:http",
+			scheme: "http",
+			want:   "http://example.com/new",
+		},
+		{
+			name:   "scheme change uses its default port",
+			host:   "example.com:8080",
+			scheme: "http",
+			action: routes.RouteAction{RedirectScheme: "https"},
+			want:   "https://example.com/new",
+		},
+		{
+			name:   "hostname change drops the port",
+			host:   "example.com:8080",
+			scheme: "http",
+			action: routes.RouteAction{RedirectHostname: "www.example.com"},
+			want:   "http://www.example.com/new",
+		},
+		{
+			name:   "explicit port overrides the request port",
+			host:   "example.com:8080",
+			scheme: "http",
+			action: routes.RouteAction{RedirectPort: 9090},
+			want:   "http://example.com:9090/new",
+		},
+		{
+			name:   "preservePort false strips the request port",
+			host:   "example.com:8080",
+			scheme: "http",
+			action: routes.RouteAction{RedirectStripPort: true},
+			want:   "http://example.com/new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := tt.action
+			action.Type = routes.ActionTypeRedirect
+			action.RedirectPath = "/new"
+			route := &routes.Route{Path: "/old", Type: routes.RouteTypePrefix, Actions: []routes.RouteAction{action}}
+			vars := NewVars(Request{Authority: tt.host, Path: "/old", Scheme: tt.scheme})
+
+			redirect := EvaluateRedirect(route, vars)
+			if redirect == nil || redirect.Location != tt.want {
+				t.Errorf("EvaluateRedirect() = %+v, want location %q", redirect, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyActionsRewriteSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		segments map[int]string
+		want     string
+	}{
+		{
+			name:     "literal segment",
+			path:     "/api/shop/v1/items",
+			segments: map[int]string{2: "v2"},
+			want:     "/api/shop/v2/items",
+		},
+		{
+			name:     "swapped segments",
+			path:     "/api/shop/v1/items?page=2",
+			segments: map[int]string{1: "${path.segment.3}", 3: "${path.segment.1}"},
+			want:     "/api/items/v1/shop?page=2",
+		},
+		{
+			name:     "removed segment and trailing slash",
+			path:     "/api/internal/items/",
+			segments: map[int]string{1: ""},
+			want:     "/api/items/",
+		},
+		{
+			name:     "index past the last segment",
+			path:     "/api/items",
+			segments: map[int]string{1: "things", 4: "v2"},
+			want:     "/api/things",
+		},
+		{
+			name:     "header value is escaped",
+			path:     "/tenants/x/items",
+			segments: map[int]string{1: "${header.x-tenant}"},
+			want:     "/tenants/a%2Fb/items",
+		},
+		{
+			name:     "every segment removed",
+			path:     "/api",
+			segments: map[int]string{0: ""},
+			want:     "/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &routes.Route{
+				Path:    "/",
+				Type:    routes.RouteTypePrefix,
+				Actions: []routes.RouteAction{{Type: routes.ActionTypeRewrite, RewriteSegments: tt.segments}},
+			}
+			vars := NewVars(Request{Path: tt.path, Headers: map[string]string{"x-tenant": "a/b"}})
+			if got := ApplyActions(route, vars).Path; got != tt.want {
+				t.Errorf("ApplyActions() path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
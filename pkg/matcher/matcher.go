@@ -0,0 +1,198 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package matcher evaluates requests against a route table the way the
+// external processor does: it finds the route a request matches and applies
+// its actions, returning the resulting routing decision. The extproc is
+// built on the same functions, so test harnesses and other services linking
+// this package get the same decisions, given the path normalization the
+// extproc applies (Request.PathNormalization). Only what depends on the
+// extproc's runtime state differs: see Match.
+package matcher
+
+import (
+	"strings"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+// RouteFinder finds the route of a request. routes.RoutesConfig,
+// routes.K8sLoader and routes.BucketLoader implement it.
+type RouteFinder interface {
+	FindRoute(host string, req routes.RequestMatch) *routes.Route
+}
+
+// Request is an HTTP request, as the external processor receives it.
+type Request struct {
+	// Authority is the :authority (Host) of the request.
+	Authority string
+
+	// Path is the :path of the request, query string included.
+	Path string
+
+	// Method is the request method.
+	Method string
+
+	// Scheme is the :scheme of the request. Empty falls back to the
+	// X-Forwarded-Proto header, then to "https".
+	Scheme string
+
+	// Headers are the request headers, pseudo-headers excluded. Keys MUST be
+	// lowercased, as for routes.RequestMatch.
+	Headers map[string]string
+
+	// Variant is the route table variant the request selects, as for
+	// routes.RequestMatch.
+	Variant string
+
+	// PathNormalization is the normalization the extproc applies to the
+	// path before matching: its --path-normalization flag, or the
+	// pathNormalization of the ExternalProcessorAttachment. The zero value
+	// normalizes nothing.
+	PathNormalization routes.PathNormalization
+}
+
+// Decision is the routing decision for a request.
+type Decision struct {
+	// PathRejected is set when PathNormalization rejects the request path,
+	// which the external processor answers with 400. Nothing else is set.
+	PathRejected bool `json:"pathRejected,omitempty"`
+
+	// Route is the matched route, with Backend set to the override variant
+	// the request selects, if any. Nil when no route matched.
+	Route *routes.Route `json:"route,omitempty"`
+
+	// UnmatchedPolicy is the unmatchedRequestPolicy of the request's
+	// hostname (one of the routes.Unmatched* constants) when no route
+	// matched. Empty when the hostname sets none, and the external
+	// processor applies its default.
+	UnmatchedPolicy string `json:"unmatchedPolicy,omitempty"`
+
+	// Maintenance is the maintenance response the request is answered with
+	// when it matched an active maintenance route, which is then Route.
+	Maintenance *routes.RouteMaintenance `json:"maintenance,omitempty"`
+
+	// OverrideVariant is the override header variant the request selects.
+	OverrideVariant string `json:"overrideVariant,omitempty"`
+
+	// RequiresAuth reports whether the route has require-auth actions,
+	// which Match does not call: the decision assumes they allow the
+	// request.
+	RequiresAuth bool `json:"requiresAuth,omitempty"`
+
+	// UpgradeStatusCode is the status the route's deny-upgrade action
+	// rejects the request with, when it attempts a protocol upgrade.
+	UpgradeStatusCode int32 `json:"upgradeStatusCode,omitempty"`
+
+	// Redirect is set when the route answers the request with a redirect.
+	Redirect *Redirect `json:"redirect,omitempty"`
+
+	// Forward is the request forwarded to Route.Backend, when the route
+	// does not redirect.
+	Forward *Forward `json:"forward,omitempty"`
+
+	// ResponseSetHeaders and ResponseRemoveHeaders are the response headers
+	// the route's response-header actions set and remove.
+	ResponseSetHeaders    []Header `json:"responseSetHeaders,omitempty"`
+	ResponseRemoveHeaders []string `json:"responseRemoveHeaders,omitempty"`
+}
+
+// Matcher evaluates requests against the route table of a RouteFinder.
+type Matcher struct {
+	finder RouteFinder
+}
+
+// New returns a Matcher evaluating requests against the routes of finder.
+func New(finder RouteFinder) *Matcher {
+	return &Matcher{finder: finder}
+}
+
+// Match returns the routing decision for req. The decision does not depend
+// on the external processor's runtime state: require-auth checks are not
+// called, outlier policies never fail a route over and overload protection
+// never degrades the lookup.
+func (m *Matcher) Match(req Request) *Decision {
+	if req.PathNormalization != (routes.PathNormalization{}) {
+		path := StripQueryString(req.Path)
+		normalized, ok := routes.NormalizePath(path, req.PathNormalization)
+		if !ok {
+			return &Decision{PathRejected: true}
+		}
+		req.Path = normalized + req.Path[len(path):]
+	}
+	vars := NewVars(req)
+	// The route loaders strip the port before the lookup; a RoutesConfig
+	// finder does not.
+	host := req.Authority
+	if idx := strings.Index(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+	route := m.finder.FindRoute(host, routes.RequestMatch{
+		Path:        StripQueryString(req.Path),
+		Method:      req.Method,
+		Scheme:      vars.Scheme,
+		Headers:     req.Headers,
+		QueryParams: vars.QueryParams,
+		Variant:     req.Variant,
+	})
+	if route == nil {
+		return &Decision{}
+	}
+	// A hostname's fallback route only carries its unmatched request policy:
+	// reaching it means no real route matched.
+	if route.UnmatchedPolicy != "" {
+		return &Decision{UnmatchedPolicy: route.UnmatchedPolicy}
+	}
+	if route.Maintenance != nil {
+		return &Decision{Route: route, Maintenance: route.Maintenance}
+	}
+
+	decision := &Decision{}
+	route, decision.OverrideVariant = OverrideRoute(route, req.Headers)
+	decision.Route = route
+	for _, action := range route.Actions {
+		if action.Type == routes.ActionTypeRequireAuth {
+			decision.RequiresAuth = true
+		}
+	}
+	if status := UpgradeDenial(route, req.Headers); status != 0 {
+		decision.UpgradeStatusCode = status
+		return decision
+	}
+
+	if redirect := EvaluateRedirect(route, vars); redirect != nil {
+		decision.Redirect = redirect
+		return decision
+	}
+	fwd := ApplyActions(route, vars)
+	decision.Forward = &fwd
+	decision.ResponseSetHeaders, decision.ResponseRemoveHeaders = ResponseHeaders(route, vars)
+	return decision
+}
+
+// OverrideRoute returns route with Backend set to the backend variant the
+// request headers select through the route's override header, and the
+// variant name. The route is copied so the shared route table is never
+// mutated; it is returned as is when the request selects no variant.
+func OverrideRoute(route *routes.Route, headers map[string]string) (*routes.Route, string) {
+	backend, variant := route.OverrideBackend(headers)
+	if backend == "" {
+		return route, ""
+	}
+	overridden := *route
+	overridden.Backend = backend
+	return &overridden, variant
+}
@@ -0,0 +1,224 @@
+package matcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+func matcherTestConfig() *routes.RoutesConfig {
+	return &routes.RoutesConfig{
+		Version: 1,
+		Hosts: map[string][]routes.Route{
+			"example.com": {
+				{
+					Path:    "/old",
+					Type:    routes.RouteTypePrefix,
+					Backend: "web.default.svc.cluster.local:8080",
+					Actions: []routes.RouteAction{
+						{Type: routes.ActionTypeRedirect, RedirectPath: "/new", RedirectStatusCode: 301},
+					},
+				},
+				{
+					Path:           "/api",
+					Type:           routes.RouteTypePrefix,
+					Backend:        "api.default.svc.cluster.local:8080",
+					OverrideHeader: "x-route-override",
+					Overrides:      map[string]string{"alice": "api-alice.preview.svc.cluster.local:9090"},
+					Actions: []routes.RouteAction{
+						{Type: routes.ActionTypeRequireAuth, AuthURL: "http://auth.default.svc.cluster.local:80/"},
+						{Type: routes.ActionTypeRewrite, RewritePath: "/v2"},
+						{Type: routes.ActionTypeHeaderSet, HeaderName: "x-tenant", Value: "${query.tenant}"},
+						{Type: routes.ActionTypeHeaderRemove, HeaderName: "x-debug"},
+						{Type: routes.ActionTypeResponseHeaderAdd, HeaderName: "x-served-by", Value: "${host}"},
+					},
+				},
+				{
+					Path:            "/Docs",
+					Type:            routes.RouteTypePrefix,
+					CaseInsensitive: true,
+					Backend:         "docs.default.svc.cluster.local:8080",
+					Actions:         []routes.RouteAction{{Type: routes.ActionTypeRewrite, RewritePath: "/help"}},
+				},
+				{
+					Path:    "/legacy",
+					Type:    routes.RouteTypePrefix,
+					Backend: "legacy.default.svc.cluster.local:8080",
+					Actions: []routes.RouteAction{{Type: routes.ActionTypeStripUpgrade}},
+				},
+				{
+					Path:    "/reports",
+					Type:    routes.RouteTypePrefix,
+					Backend: "reports.default.svc.cluster.local:8080",
+					Actions: []routes.RouteAction{{Type: routes.ActionTypeDenyUpgrade, UpgradeStatusCode: 426}},
+				},
+				{Path: "/", Type: routes.RouteTypePrefix, UnmatchedPolicy: routes.UnmatchedNotFound},
+			},
+		},
+	}
+}
+
+func TestMatch(t *testing.T) {
+	m := New(matcherTestConfig())
+
+	t.Run("forward applies the actions", func(t *testing.T) {
+		d := m.Match(Request{
+			Authority: "example.com",
+			Path:      "/api/items?tenant=acme",
+			Method:    "GET",
+			Headers:   map[string]string{"x-route-override": "alice"},
+		})
+		if d.Route == nil || d.Route.Backend != "api-alice.preview.svc.cluster.local:9090" || d.OverrideVariant != "alice" {
+			t.Fatalf("route = %+v, variant %q, want the alice override", d.Route, d.OverrideVariant)
+		}
+		if !d.RequiresAuth || d.Redirect != nil {
+			t.Errorf("requiresAuth = %v, redirect = %+v", d.RequiresAuth, d.Redirect)
+		}
+		want := &Forward{
+			Path:          "/v2/items?tenant=acme",
+			SetHeaders:    []Header{{Name: "x-tenant", Value: "acme"}},
+			RemoveHeaders: []string{"x-debug"},
+		}
+		if !reflect.DeepEqual(d.Forward, want) {
+			t.Errorf("forward = %+v, want %+v", d.Forward, want)
+		}
+		if want := []Header{{Name: "x-served-by", Value: "example.com", Append: true}}; !reflect.DeepEqual(d.ResponseSetHeaders, want) {
+			t.Errorf("response headers = %+v, want %+v", d.ResponseSetHeaders, want)
+		}
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		d := m.Match(Request{Authority: "example.com", Path: "/old/page", Scheme: "http"})
+		want := &Redirect{Location: "http://example.com/new", StatusCode: 301}
+		if !reflect.DeepEqual(d.Redirect, want) || d.Forward != nil {
+			t.Errorf("redirect = %+v, forward = %+v, want %+v", d.Redirect, d.Forward, want)
+		}
+	})
+
+	t.Run("case-insensitive prefix rewrite", func(t *testing.T) {
+		d := m.Match(Request{Authority: "example.com", Path: "/DOCS/Intro"})
+		if d.Route == nil || d.Forward == nil || d.Forward.Path != "/help/Intro" {
+			t.Errorf("decision = %+v, want /DOCS/Intro rewritten to /help/Intro", d)
+		}
+	})
+
+	t.Run("strip-upgrade", func(t *testing.T) {
+		upgrade := map[string]string{"upgrade": "websocket", "connection": "Upgrade"}
+		d := m.Match(Request{Authority: "example.com", Path: "/legacy/ws", Headers: upgrade})
+		if want := []string{"upgrade", "connection"}; d.Forward == nil || !reflect.DeepEqual(d.Forward.RemoveHeaders, want) {
+			t.Errorf("forward = %+v, want %v removed", d.Forward, want)
+		}
+		d = m.Match(Request{Authority: "example.com", Path: "/legacy/page"})
+		if d.Forward == nil || len(d.Forward.RemoveHeaders) != 0 {
+			t.Errorf("forward = %+v, want no header removed from a plain request", d.Forward)
+		}
+	})
+
+	t.Run("deny-upgrade", func(t *testing.T) {
+		d := m.Match(Request{Authority: "example.com", Path: "/reports/live", Headers: map[string]string{"upgrade": "websocket"}})
+		if d.UpgradeStatusCode != 426 || d.Forward != nil {
+			t.Errorf("decision = %+v, want the upgrade rejected with 426", d)
+		}
+		d = m.Match(Request{Authority: "example.com", Path: "/reports/live"})
+		if d.UpgradeStatusCode != 0 || d.Forward == nil {
+			t.Errorf("decision = %+v, want a plain request forwarded", d)
+		}
+	})
+
+	t.Run("unmatched policy", func(t *testing.T) {
+		d := m.Match(Request{Authority: "example.com", Path: "/other"})
+		if d.Route != nil || d.UnmatchedPolicy != routes.UnmatchedNotFound {
+			t.Errorf("decision = %+v, want the 404 policy", d)
+		}
+	})
+
+	t.Run("port in the authority", func(t *testing.T) {
+		d := m.Match(Request{Authority: "example.com:8443", Path: "/api/items"})
+		if d.Route == nil || d.Route.Backend != "api.default.svc.cluster.local:8080" {
+			t.Errorf("decision = %+v, want the /api route", d)
+		}
+	})
+
+	t.Run("path normalization", func(t *testing.T) {
+		n := routes.PathNormalization{MergeSlashes: true, DecodeUnreserved: true, RejectEncodedSlashes: true}
+		d := m.Match(Request{Authority: "example.com", Path: "//%61pi/items?tenant=a", PathNormalization: n})
+		if d.Route == nil || d.Forward == nil || d.Forward.Path != "/v2/items?tenant=a" {
+			t.Errorf("decision = %+v, want //%%61pi/items matched and rewritten like /api/items", d)
+		}
+		d = m.Match(Request{Authority: "example.com", Path: "/api%2Fitems", PathNormalization: n})
+		if !d.PathRejected || d.Route != nil {
+			t.Errorf("decision = %+v, want the path rejected", d)
+		}
+		d = m.Match(Request{Authority: "example.com", Path: "//api/items"})
+		if d.Route != nil {
+			t.Errorf("decision = %+v, want //api/items not to match /api without normalization", d)
+		}
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		d := m.Match(Request{Authority: "other.com", Path: "/api"})
+		if d.Route != nil || d.UnmatchedPolicy != "" {
+			t.Errorf("decision = %+v, want no route", d)
+		}
+	})
+}
+
+func TestApplyActionsSequential(t *testing.T) {
+	actions := []routes.RouteAction{
+		{Type: routes.ActionTypeHeaderSet, HeaderName: "x-trace", Value: "1"},
+		{Type: routes.ActionTypeRewrite, RewriteHostname: "eu.example.com"},
+		{Type: routes.ActionTypeRewrite, RewritePath: "/${host}${path}"},
+		{Type: routes.ActionTypeHeaderSet, HeaderName: "x-target", Value: "${host}${path}"},
+		{Type: routes.ActionTypeHeaderRemove, HeaderName: "X-Trace"},
+	}
+
+	tests := []struct {
+		name       string
+		sequential bool
+		want       Forward
+	}{
+		{
+			name: "fixed actions see the original request",
+			want: Forward{
+				Path:      "/api.example.com/v1/items",
+				Authority: "eu.example.com",
+				SetHeaders: []Header{
+					{Name: "x-trace", Value: "1"},
+					{Name: "x-target", Value: "api.example.com/v1/items"},
+				},
+				RemoveHeaders: []string{"X-Trace"},
+			},
+		},
+		{
+			name:       "sequential actions see the previous rewrites",
+			sequential: true,
+			want: Forward{
+				Path:          "/eu.example.com/v1/items",
+				Authority:     "eu.example.com",
+				SetHeaders:    []Header{{Name: "x-target", Value: "eu.example.com/eu.example.com/v1/items"}},
+				RemoveHeaders: []string{"X-Trace"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &routes.Route{
+				Path:              "/v1",
+				Type:              routes.RouteTypePrefix,
+				Backend:           "api.default.svc.cluster.local:8080",
+				Actions:           actions,
+				SequentialActions: tt.sequential,
+			}
+			vars := NewVars(Request{Authority: "api.example.com", Path: "/v1/items"})
+
+			if got := ApplyActions(route, vars); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ApplyActions() = %+v, want %+v", got, tt.want)
+			}
+			if vars.Host != "api.example.com" || vars.Path != "/v1/items" {
+				t.Errorf("request vars were mutated: host %q, path %q", vars.Host, vars.Path)
+			}
+		})
+	}
+}
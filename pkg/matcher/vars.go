@@ -0,0 +1,282 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package matcher
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Vars is the variable context of a request: the values ${...}
+// placeholders of actions expand to.
+type Vars struct {
+	ClientIP     string
+	RequestID    string
+	Host         string
+	Path         string
+	Method       string
+	Scheme       string
+	PathSegments []string
+
+	// Headers (lowercased names, no pseudo-headers) and QueryParams of the
+	// request, read by ${header.<name>} and ${query.<name>}.
+	Headers     map[string]string
+	QueryParams map[string]string
+}
+
+// NewVars returns the variable context of req. The client IP is the first
+// X-Forwarded-For address, and the scheme falls back to X-Forwarded-Proto,
+// then to "https".
+func NewVars(req Request) *Vars {
+	vars := &Vars{
+		ClientIP:     extractFirstIP(req.Headers["x-forwarded-for"]),
+		RequestID:    req.Headers["x-request-id"],
+		Host:         req.Authority,
+		Path:         req.Path,
+		Method:       req.Method,
+		Scheme:       req.Scheme,
+		PathSegments: splitPath(req.Path),
+		Headers:      req.Headers,
+		QueryParams:  extractQueryParams(req.Path),
+	}
+	if vars.Scheme == "" {
+		vars.Scheme = req.Headers["x-forwarded-proto"]
+	}
+	if vars.Scheme == "" {
+		vars.Scheme = "https"
+	}
+	return vars
+}
+
+// maxRequestValueLength caps the request header and query parameter values
+// that ${header.<name>} and ${query.<name>} expand to. Longer values expand to
+// an empty string, so a client cannot inflate rewritten paths and headers.
+const maxRequestValueLength = 1024
+
+// Substitute replaces ${var} placeholders with actual values, for a header
+// value: ${header.<name>} and ${query.<name>} values are stripped of control
+// characters.
+func (v *Vars) Substitute(value string) string {
+	return v.expand(value, stripControlChars)
+}
+
+// SubstitutePath replaces ${var} placeholders with actual values, for a
+// request path: ${header.<name>} and ${query.<name>} values are
+// percent-encoded, so they can neither add path segments nor query
+// parameters.
+func (v *Vars) SubstitutePath(value string) string {
+	return v.expand(value, escapePathValue)
+}
+
+// expand replaces every ${var} placeholder of value in a single pass, so
+// text a variable expands to is never expanded again. escape is applied to
+// request header and query parameter values. Unknown placeholders are kept.
+func (v *Vars) expand(value string, escape func(string) string) string {
+	if v == nil || !strings.Contains(value, "${") {
+		return value
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(value[start:], '}')
+		if end == -1 {
+			break
+		}
+		end += start
+		b.WriteString(value[:start])
+		if s, ok := v.lookup(value[start+2:end], escape); ok {
+			b.WriteString(s)
+		} else {
+			b.WriteString(value[start : end+1])
+		}
+		value = value[end+1:]
+	}
+	b.WriteString(value)
+	return b.String()
+}
+
+// lookup returns the value of the variable name, escaping request header
+// and query parameter values with escape.
+func (v *Vars) lookup(name string, escape func(string) string) (string, bool) {
+	switch name {
+	case "client_ip":
+		return v.ClientIP, true
+	case "request_id":
+		return v.RequestID, true
+	case "host":
+		return v.Host, true
+	case "path":
+		return v.Path, true
+	case "method":
+		return v.Method, true
+	case "scheme":
+		return v.Scheme, true
+	}
+	if n, ok := strings.CutPrefix(name, "path.segment."); ok {
+		i, err := strconv.Atoi(n)
+		if err != nil || strconv.Itoa(i) != n || i < 0 || i >= len(v.PathSegments) {
+			return "", false
+		}
+		return v.PathSegments[i], true
+	}
+	if header, ok := strings.CutPrefix(name, "header."); ok && header != "" {
+		return escape(limitRequestValue(v.Headers[strings.ToLower(header)])), true
+	}
+	if param, ok := strings.CutPrefix(name, "query."); ok && param != "" {
+		return escape(limitRequestValue(v.QueryParams[param])), true
+	}
+	return "", false
+}
+
+// limitRequestValue returns value, or "" when it exceeds maxRequestValueLength.
+func limitRequestValue(value string) string {
+	if len(value) > maxRequestValueLength {
+		return ""
+	}
+	return value
+}
+
+// escapePathValue percent-encodes every byte of value outside the RFC 3986
+// unreserved set. The dot segments "." and ".." are encoded too, so a value
+// cannot climb out of the rewritten path.
+func escapePathValue(value string) string {
+	if value == "." || value == ".." {
+		return strings.Repeat("%2E", len(value))
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// stripControlChars removes the control characters Envoy rejects in header
+// values, such as CR and LF decoded from a query parameter.
+func stripControlChars(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\t' && (r < 0x20 || r == 0x7f) {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// extractFirstIP extracts the first IP from a comma-separated list (X-Forwarded-For)
+func extractFirstIP(xff string) string {
+	if xff == "" {
+		return ""
+	}
+	parts := strings.Split(xff, ",")
+	return strings.TrimSpace(parts[0])
+}
+
+// StripPort removes port from host:port string
+func StripPort(host string) string {
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		// Check if this is an IPv6 address
+		if strings.Contains(host, "]") {
+			// IPv6 with port: [::1]:8080
+			if bracketIdx := strings.LastIndex(host, "]"); bracketIdx < idx {
+				return host[:idx]
+			}
+		} else if strings.Count(host, ":") == 1 {
+			// IPv4 with port: 127.0.0.1:8080
+			return host[:idx]
+		}
+	}
+	return host
+}
+
+// splitPort splits host into the hostname, as returned by StripPort, and its
+// port, or 0 when host carries no valid port.
+func splitPort(host string) (string, int32) {
+	hostname := StripPort(host)
+	if len(hostname) == len(host) {
+		return host, 0
+	}
+	port, err := strconv.Atoi(host[len(hostname)+1:])
+	if err != nil || port < 1 || port > 65535 {
+		return hostname, 0
+	}
+	return hostname, int32(port)
+}
+
+// StripQueryString extracts the path component from a request target by
+// removing the query string and fragment. Per RFC 3986 §3.3, the path is
+// terminated by the first "?" or "#" character, or by the end of the URI.
+// Route matching should operate exclusively on the path component.
+func StripQueryString(path string) string {
+	if idx := strings.IndexAny(path, "?#"); idx != -1 {
+		return path[:idx]
+	}
+	return path
+}
+
+// extractQueryParams returns a flat map of the first value observed for each
+// query parameter name in the given ":path". Names are case-sensitive per
+// RFC 3986. Returns an empty map when no query string is present.
+// Invalid query strings are parsed on a best-effort basis.
+func extractQueryParams(rawPath string) map[string]string {
+	out := map[string]string{}
+	idx := strings.Index(rawPath, "?")
+	if idx == -1 || idx == len(rawPath)-1 {
+		return out
+	}
+	query := rawPath[idx+1:]
+	if hash := strings.Index(query, "#"); hash != -1 {
+		query = query[:hash]
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return out
+	}
+	for k, v := range values {
+		if len(v) > 0 {
+			out[k] = v[0]
+		}
+	}
+	return out
+}
+
+// splitPath splits a path into segments
+func splitPath(path string) []string {
+	// Remove query string and fragment (RFC 3986 §3.3)
+	if idx := strings.IndexAny(path, "?#"); idx != -1 {
+		path = path[:idx]
+	}
+	// Split and filter empty segments
+	parts := strings.Split(path, "/")
+	segments := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p != "" {
+			segments = append(segments, p)
+		}
+	}
+	return segments
+}
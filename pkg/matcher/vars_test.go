@@ -0,0 +1,165 @@
+package matcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/foo/bar", []string{"foo", "bar"}},
+		{"/foo/bar?q=1", []string{"foo", "bar"}},
+		{"/", nil},
+		{"/a/b/c/d", []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := splitPath(tt.path)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("splitPath(%q)[%d] = %q, want %q", tt.path, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStripQueryString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"/example", "/example"},
+		{"/example?key=value", "/example"},
+		{"/example?", "/example"},
+		{"/example?key=value&other=test", "/example"},
+		{"/path/to/resource?q=search+term", "/path/to/resource"},
+		{"/", "/"},
+		{"/?q=1", "/"},
+		{"", ""},
+		// RFC 3986 §3.3: path is also terminated by '#'
+		{"/example#section", "/example"},
+		{"/example#", "/example"},
+		{"/path/to/resource#top", "/path/to/resource"},
+		// '?' before '#': query terminates the path first
+		{"/example?q=1#frag", "/example"},
+		// '#' before '?': fragment terminates the path first
+		{"/example#frag?notquery", "/example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := StripQueryString(tt.input)
+			if got != tt.want {
+				t.Errorf("StripQueryString(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractQueryParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{"no query", "/api", map[string]string{}},
+		{"empty query", "/api?", map[string]string{}},
+		{"single param", "/api?version=2", map[string]string{"version": "2"}},
+		{"multiple params", "/api?a=1&b=two", map[string]string{"a": "1", "b": "two"}},
+		{"url-encoded value", "/api?q=hello%20world", map[string]string{"q": "hello world"}},
+		{"repeated param keeps first", "/api?x=1&x=2", map[string]string{"x": "1"}},
+		{"fragment stripped before parsing", "/api?q=1#frag", map[string]string{"q": "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractQueryParams(tt.input)
+			if len(got) != len(tt.want) {
+				t.Fatalf("extractQueryParams(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("extractQueryParams(%q)[%q] = %q, want %q", tt.input, k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	vars := &Vars{
+		ClientIP:     "1.2.3.4",
+		RequestID:    "req-123",
+		Host:         "example.com",
+		Path:         "/foo/bar?q=1",
+		Method:       "GET",
+		Scheme:       "https",
+		PathSegments: []string{"foo", "bar"},
+		Headers:      map[string]string{"x-tenant-id": "acme", "x-crlf": "a\r\nb", "x-long": strings.Repeat("a", maxRequestValueLength+1)},
+		QueryParams:  map[string]string{"ref": "news letter", "Ref": "upper"},
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"/api/${path.segment.0}", "/api/foo"},
+		{"${scheme}://${host}${path}", "https://example.com/foo/bar?q=1"},
+		{"/static", "/static"},
+		{"", ""},
+		{"${path.segment.2}|${path.segment.01}|${unknown}", "${path.segment.2}|${path.segment.01}|${unknown}"},
+		{"${header.X-Tenant-ID}/${query.ref}/${query.Ref}", "acme/news letter/upper"},
+		{"[${header.x-missing}][${query.missing}]", "[][]"},
+		{"${header.x-crlf}", "ab"},
+		{"${header.x-long}", ""},
+		{"${header.}", "${header.}"},
+		{"${unterminated", "${unterminated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := vars.Substitute(tt.input)
+			if got != tt.want {
+				t.Errorf("Substitute(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstitutePath(t *testing.T) {
+	vars := &Vars{
+		Path:        "/foo",
+		Headers:     map[string]string{"x-tenant-id": "a/b?c=d&e", "x-dots": "..", "x-nested": "${path}"},
+		QueryParams: map[string]string{"ref": "news letter"},
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"/t/${header.x-tenant-id}${path}", "/t/a%2Fb%3Fc%3Dd%26e/foo"},
+		{"/r?ref=${query.ref}", "/r?ref=news%20letter"},
+		{"/files/${header.x-dots}/secret", "/files/%2E%2E/secret"},
+		{"/n/${header.x-nested}", "/n/%24%7Bpath%7D"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := vars.SubstitutePath(tt.input)
+			if got != tt.want {
+				t.Errorf("SubstitutePath(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package objectstore reads and writes objects in S3-compatible buckets.
+// Google Cloud Storage is reached through its S3-compatible XML API, which
+// accepts the same requests when signed with HMAC keys.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Supported bucket URL schemes.
+const (
+	SchemeS3  = "s3"
+	SchemeGCS = "gs"
+)
+
+// gcsEndpoint is the S3-compatible XML API of Google Cloud Storage.
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// defaultTimeout bounds a single request when no HTTPClient is configured.
+const defaultTimeout = 30 * time.Second
+
+var (
+	// ErrNotFound is returned by Get when the object does not exist.
+	ErrNotFound = errors.New("object not found")
+
+	// ErrNotModified is returned by Get when the object still has the ETag
+	// passed as ifNoneMatch.
+	ErrNotModified = errors.New("object not modified")
+)
+
+// Object is an object read from a bucket.
+type Object struct {
+	Data []byte
+
+	// ETag identifies the object version; pass it back to Get to skip
+	// downloading an unchanged object.
+	ETag string
+
+	// Metadata holds the user metadata stored with the object, keyed by
+	// lowercase name without the x-amz-meta- prefix.
+	Metadata map[string]string
+}
+
+// Bucket reads and writes whole objects.
+type Bucket interface {
+	// Get reads key. When ifNoneMatch is non-empty and still matches the
+	// object's ETag, it returns ErrNotModified without the body.
+	Get(ctx context.Context, key, ifNoneMatch string) (*Object, error)
+
+	// Put writes key in a single request, so readers see either the
+	// previous object or the new one, never a partial write.
+	Put(ctx context.Context, key string, data []byte, metadata map[string]string) error
+
+	// Delete removes key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Config configures a bucket client.
+type Config struct {
+	// URL locates the bucket and an optional key prefix:
+	// s3://bucket/prefix or gs://bucket/prefix.
+	URL string
+
+	// Endpoint overrides the service endpoint, e.g. for MinIO. When set,
+	// requests use path-style addressing.
+	Endpoint string
+
+	// Region is the signing region. Defaults to AWS_REGION, then us-east-1;
+	// GCS always signs for "auto".
+	Region string
+
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials
+	// (HMAC keys for GCS), and required: instance roles, IRSA and workload
+	// identity are not supported.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// HTTPClient sends the requests. Defaults to a client with a 30s timeout.
+	HTTPClient *http.Client
+}
+
+// ConfigFromEnv returns a Config for bucketURL with the credentials and
+// region taken from the standard AWS_* environment variables.
+func ConfigFromEnv(bucketURL string) Config {
+	return Config{
+		URL:             bucketURL,
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// New returns a client for the bucket described by cfg.
+func New(cfg Config) (*S3Bucket, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bucket URL %q: %w", cfg.URL, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid bucket URL %q: missing bucket name", cfg.URL)
+	}
+	if u.Scheme != SchemeS3 && u.Scheme != SchemeGCS {
+		return nil, fmt.Errorf("invalid bucket URL %q: scheme must be %q or %q", cfg.URL, SchemeS3, SchemeGCS)
+	}
+	if cfg.AccessKeyID == "" {
+		return nil, errors.New("bucket credentials: an access key id is required, from AWS_ACCESS_KEY_ID " +
+			"(HMAC keys for GCS); instance roles, IRSA and workload identity are not supported")
+	}
+	if cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("bucket credentials: secret access key is required with an access key id")
+	}
+
+	b := &S3Bucket{
+		bucket:      u.Host,
+		prefix:      strings.Trim(u.Path, "/"),
+		region:      cfg.Region,
+		accessKey:   cfg.AccessKeyID,
+		secretKey:   cfg.SecretAccessKey,
+		token:       cfg.SessionToken,
+		client:      cfg.HTTPClient,
+		now:         time.Now,
+		endpoint:    strings.TrimSuffix(cfg.Endpoint, "/"),
+		pathStyle:   cfg.Endpoint != "",
+		description: cfg.URL,
+	}
+	if b.client == nil {
+		b.client = &http.Client{Timeout: defaultTimeout}
+	}
+
+	switch u.Scheme {
+	case SchemeS3:
+		if b.region == "" {
+			b.region = "us-east-1"
+		}
+		if b.endpoint == "" {
+			b.endpoint = "https://s3." + b.region + ".amazonaws.com"
+		}
+	case SchemeGCS:
+		b.region = "auto"
+		if b.endpoint == "" {
+			b.endpoint = gcsEndpoint
+			b.pathStyle = true
+		}
+	default:
+		return nil, fmt.Errorf("invalid bucket URL %q: scheme must be %q or %q", cfg.URL, SchemeS3, SchemeGCS)
+	}
+
+	if _, err := url.Parse(b.endpoint); err != nil {
+		return nil, fmt.Errorf("invalid bucket endpoint %q: %w", cfg.Endpoint, err)
+	}
+	return b, nil
+}
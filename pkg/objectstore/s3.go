@@ -0,0 +1,332 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	metadataHeaderPrefix = "x-amz-meta-"
+
+	// maxObjectSize bounds the body read by Get, so a wrong key or a hostile
+	// bucket cannot exhaust memory.
+	maxObjectSize = 64 << 20 // 64 MiB
+
+	// maxErrorBodySize is how much of an error response is kept for the
+	// error message.
+	maxErrorBodySize = 1 << 10
+)
+
+// S3Bucket is a Bucket backed by the S3 REST API, with requests signed
+// using AWS Signature Version 4.
+type S3Bucket struct {
+	bucket    string
+	prefix    string
+	endpoint  string
+	pathStyle bool
+	region    string
+
+	accessKey string
+	secretKey string
+	token     string
+
+	client *http.Client
+	now    func() time.Time
+
+	description string
+}
+
+// String returns the bucket URL the client was created for.
+func (b *S3Bucket) String() string {
+	return b.description
+}
+
+// Get implements Bucket.
+func (b *S3Bucket) Get(ctx context.Context, key, ifNoneMatch string) (*Object, error) {
+	req, err := b.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	b.sign(req, emptyPayloadHash)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", b.objectName(key), err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, ErrNotModified
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("get %s: %w", b.objectName(key), ErrNotFound)
+	default:
+		return nil, responseError("get", b.objectName(key), resp)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxObjectSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", b.objectName(key), err)
+	}
+	if len(data) > maxObjectSize {
+		return nil, fmt.Errorf("get %s: object exceeds %d bytes", b.objectName(key), maxObjectSize)
+	}
+
+	obj := &Object{
+		Data:     data,
+		ETag:     resp.Header.Get("ETag"),
+		Metadata: make(map[string]string),
+	}
+	for name, values := range resp.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, metadataHeaderPrefix) && len(values) > 0 {
+			obj.Metadata[strings.TrimPrefix(lower, metadataHeaderPrefix)] = values[0]
+		}
+	}
+	return obj, nil
+}
+
+// Put implements Bucket. The body is sent with its MD5 and SHA-256, so the
+// service rejects an upload corrupted in transit instead of storing it.
+func (b *S3Bucket) Put(ctx context.Context, key string, data []byte, metadata map[string]string) error {
+	req, err := b.newRequest(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	md5sum := md5.Sum(data)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5sum[:]))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range metadata {
+		req.Header.Set(metadataHeaderPrefix+strings.ToLower(name), value)
+	}
+	sum := sha256.Sum256(data)
+	b.sign(req, hex.EncodeToString(sum[:]))
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", b.objectName(key), err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError("put", b.objectName(key), resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Delete implements Bucket. S3 answers 204 whether or not the object
+// existed; GCS answers 404 for a missing one, which is not an error either.
+func (b *S3Bucket) Delete(ctx context.Context, key string) error {
+	req, err := b.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	b.sign(req, emptyPayloadHash)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", b.objectName(key), err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	default:
+		return responseError("delete", b.objectName(key), resp)
+	}
+}
+
+// objectKey joins the bucket prefix and key.
+func (b *S3Bucket) objectKey(key string) string {
+	if b.prefix == "" {
+		return key
+	}
+	return b.prefix + "/" + key
+}
+
+// objectName names key in errors.
+func (b *S3Bucket) objectName(key string) string {
+	return b.bucket + "/" + b.objectKey(key)
+}
+
+func (b *S3Bucket) newRequest(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	path := "/" + b.objectKey(key)
+	if b.pathStyle {
+		path = "/" + b.bucket + path
+	}
+	u, err := url.Parse(b.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bucket endpoint %q: %w", b.endpoint, err)
+	}
+	if !b.pathStyle {
+		u.Host = b.bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = escapePath(path)
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	return http.NewRequestWithContext(ctx, method, u.String(), reader)
+}
+
+// responseError turns a non-success response into an error carrying the
+// start of the service's error document.
+func responseError(op, name string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return fmt.Errorf("%s %s: unexpected status %s: %s", op, name, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// Signature Version 4 for the S3 service.
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	signingService   = "s3"
+	amzDateFormat    = "20060102T150405Z"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// sign adds the SigV4 Authorization header to req, covering every header
+// already set on it. payloadHash is the hex SHA-256 of the body.
+func (b *S3Bucket) sign(req *http.Request, payloadHash string) {
+	now := b.now().UTC()
+	amzDate := now.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.token != "" {
+		req.Header.Set("X-Amz-Security-Token", b.token)
+	}
+
+	canonicalHeaders, signedHeaders := canonicalizeHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{amzDate[:8], b.region, signingService, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), amzDate[:8])
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, signingService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, b.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalizeHeaders returns the canonical header block and the signed
+// header list of req, including the Host header Go sends implicitly.
+func canonicalizeHeaders(req *http.Request) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteByte(':')
+		sb.WriteString(headers[name])
+		sb.WriteByte('\n')
+	}
+	return sb.String(), strings.Join(names, ";")
+}
+
+// canonicalQuery encodes query parameters sorted by name and value.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escapePath URI-encodes every segment of an object path.
+func escapePath(path string) string {
+	return uriEncode(path, false)
+}
+
+// uriEncode percent-encodes s as SigV4 requires: everything but unreserved
+// characters, and '/' too when encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
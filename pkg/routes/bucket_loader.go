@@ -0,0 +1,337 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+)
+
+// Object metadata written with every published routes document.
+const (
+	// BucketMetadataSHA256 is the hex SHA-256 of the object body. Readers
+	// reject an object whose body does not match it.
+	BucketMetadataSHA256 = "sha256"
+
+	// BucketMetadataTarget is the target the routes were built for.
+	BucketMetadataTarget = "target"
+
+	// BucketMetadataFormatVersion is the wire format version of the body.
+	BucketMetadataFormatVersion = "format-version"
+)
+
+// DefaultBucketPollInterval is how often a BucketLoader checks the bucket
+// for a new routes object when PollInterval is zero.
+const DefaultBucketPollInterval = 10 * time.Second
+
+// BucketObjectKey returns the key, relative to the bucket prefix, of the
+// merged routes document published for target.
+func BucketObjectKey(target string) string {
+	return target + "/" + routesDataKey
+}
+
+// BucketChecksum returns the value of BucketMetadataSHA256 for data.
+func BucketChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// BucketLoader loads the routes of a target from the document the
+// controller publishes to an object storage bucket, for consumers that
+// cannot read the route ConfigMaps. It polls the object with a conditional
+// GET, so an unchanged object costs one 304 response per interval.
+type BucketLoader struct {
+	bucket          objectstore.Bucket
+	key             string
+	partitionHeader string
+	pollInterval    time.Duration
+	snapshotPath    string
+	maxBytes        int
+	onError         func(error)
+
+	config   *RoutesConfig
+	status   LoadStatus
+	mu       sync.RWMutex
+	onChange func(*RoutesConfig)
+
+	// etag is the ETag of the object behind the current config; guarded by
+	// loadMu, which also serializes loads.
+	etag   string
+	loadMu sync.Mutex
+
+	// reload asks the poll loop for an immediate load.
+	reload chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// BucketLoaderConfig holds configuration for the BucketLoader
+type BucketLoaderConfig struct {
+	// Bucket is where the controller publishes the routes.
+	Bucket objectstore.Bucket
+
+	// TargetName selects the routes object, see BucketObjectKey.
+	TargetName string
+
+	// PartitionHeader, when non-empty, enables the header-based fast-path
+	// index in FindRoute (see RoutesConfig.BuildPartitionIndex).
+	PartitionHeader string
+
+	// PollInterval is how often the object is checked for changes. When
+	// zero, DefaultBucketPollInterval is used.
+	PollInterval time.Duration
+
+	// SnapshotPath, when non-empty, is a local file holding the
+	// last-known-good merged config (see K8sLoaderConfig.SnapshotPath).
+	SnapshotPath string
+
+	// MaxBytes, when positive, is the largest route table the loader
+	// serves (see K8sLoaderConfig.MaxBytes).
+	MaxBytes int
+
+	// OnError, when set, is called with the error of every failed
+	// background load. The loader keeps serving its current config.
+	OnError func(error)
+}
+
+// NewBucketLoader creates a new object storage loader
+func NewBucketLoader(config BucketLoaderConfig) *BucketLoader {
+	ctx, cancel := context.WithCancel(context.Background())
+	pollInterval := config.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = DefaultBucketPollInterval
+	}
+	return &BucketLoader{
+		bucket:          config.Bucket,
+		key:             BucketObjectKey(config.TargetName),
+		partitionHeader: config.PartitionHeader,
+		pollInterval:    pollInterval,
+		snapshotPath:    config.SnapshotPath,
+		maxBytes:        config.MaxBytes,
+		onError:         config.OnError,
+		config: &RoutesConfig{
+			Version: 1,
+			Hosts:   make(map[string][]Route),
+		},
+		reload: make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Load fetches the routes object and swaps it in when it changed since the
+// last load. An unchanged object is not downloaded again.
+func (l *BucketLoader) Load() error {
+	_, err := l.load()
+	return err
+}
+
+// load is Load reporting whether a new config was swapped in.
+func (l *BucketLoader) load() (bool, error) {
+	l.loadMu.Lock()
+	defer l.loadMu.Unlock()
+
+	config, etag, err := l.fetch()
+	if errors.Is(err, objectstore.ErrNotModified) {
+		l.mu.Lock()
+		l.status.LastError = ""
+		l.mu.Unlock()
+		return false, nil
+	}
+	if err != nil {
+		l.mu.Lock()
+		recordLoadError(&l.status, err)
+		l.mu.Unlock()
+		return false, err
+	}
+
+	l.etag = etag
+	status := completeLoadStatus(LoadStatus{Source: LoadSourceBucket}, config)
+	l.mu.Lock()
+	l.config = config
+	l.status = status
+	l.mu.Unlock()
+	return true, nil
+}
+
+// fetch downloads, verifies and decodes the routes object.
+func (l *BucketLoader) fetch() (*RoutesConfig, string, error) {
+	obj, err := l.bucket.Get(l.ctx, l.key, l.etag)
+	if err != nil {
+		if errors.Is(err, objectstore.ErrNotModified) {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("failed to read routes object: %w", err)
+	}
+
+	if want := obj.Metadata[BucketMetadataSHA256]; want != "" {
+		if got := BucketChecksum(obj.Data); !strings.EqualFold(got, want) {
+			return nil, "", fmt.Errorf("routes object checksum mismatch: got %s, want %s", got, want)
+		}
+	}
+
+	config, err := DecodeRoutesConfig(obj.Data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse routes object: %w", err)
+	}
+	if config.Hosts == nil {
+		config.Hosts = make(map[string][]Route)
+	}
+	for host := range config.Hosts {
+		SortRoutes(config.Hosts[host])
+	}
+	if err := config.CompileRegexes(); err != nil {
+		return nil, "", fmt.Errorf("failed to compile regexes: %w", err)
+	}
+	if err := CheckTableBudget(config, l.maxBytes); err != nil {
+		return nil, "", err
+	}
+	config.BuildPartitionIndex(l.partitionHeader)
+	config.BuildVariantIndex()
+	config.BuildGuardedIndex()
+	return config, obj.ETag, nil
+}
+
+// LoadSnapshot replaces the current config with the snapshot stored at
+// SnapshotPath. It is meant for cold starts, before the first Load succeeds.
+func (l *BucketLoader) LoadSnapshot() error {
+	if l.snapshotPath == "" {
+		return fmt.Errorf("no snapshot path configured")
+	}
+	config, err := ReadSnapshot(l.snapshotPath)
+	if err != nil {
+		return err
+	}
+	if err := CheckTableBudget(config, l.maxBytes); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	config.BuildPartitionIndex(l.partitionHeader)
+	config.BuildVariantIndex()
+	config.BuildGuardedIndex()
+
+	status := completeLoadStatus(LoadStatus{Source: LoadSourceSnapshot}, config)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config
+	l.status = status
+	return nil
+}
+
+// SaveSnapshot persists the current config to SnapshotPath. It is a no-op
+// when no snapshot path is configured.
+func (l *BucketLoader) SaveSnapshot() error {
+	if l.snapshotPath == "" {
+		return nil
+	}
+	return WriteSnapshot(l.snapshotPath, l.GetConfig())
+}
+
+// Status returns the load status of the route table being served.
+func (l *BucketLoader) Status() LoadStatus {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.status
+}
+
+// GetConfig returns the current routes configuration
+func (l *BucketLoader) GetConfig() *RoutesConfig {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.config
+}
+
+// FindRoute finds the best matching route for a given host and request.
+func (l *BucketLoader) FindRoute(host string, req RequestMatch) *Route {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// Strip port from host if present
+	if idx := strings.Index(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+
+	return l.config.FindRoute(host, req)
+}
+
+// TraceRoute is FindRoute also returning the routes inspected, see
+// RoutesConfig.TraceRoute.
+func (l *BucketLoader) TraceRoute(host string, req RequestMatch) (*Route, []RouteCandidate) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if idx := strings.Index(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+
+	return l.config.TraceRoute(host, req)
+}
+
+// Watch starts polling the bucket; onChange runs after every load that
+// swapped in a new config.
+func (l *BucketLoader) Watch(onChange func(*RoutesConfig)) error {
+	l.onChange = onChange
+	go l.pollLoop()
+	return nil
+}
+
+// RequestReload asks the poll loop started by Watch to load now instead of
+// at the next tick, e.g. after serving from a snapshot on start.
+func (l *BucketLoader) RequestReload() {
+	select {
+	case l.reload <- struct{}{}:
+	default:
+	}
+}
+
+func (l *BucketLoader) pollLoop() {
+	ticker := time.NewTicker(l.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-l.reload:
+		}
+
+		// A failed load keeps serving the current config; the next tick
+		// retries.
+		changed, err := l.load()
+		if err != nil && l.onError != nil {
+			l.onError(err)
+		}
+		if err == nil && changed && l.onChange != nil {
+			l.onChange(l.GetConfig())
+		}
+	}
+}
+
+// Close stops polling and releases resources
+func (l *BucketLoader) Close() error {
+	l.cancel()
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freepik-company/customrouter/pkg/objectstore"
+)
+
+// memBucket is an in-memory objectstore.Bucket.
+type memBucket struct {
+	mu      sync.Mutex
+	objects map[string]*objectstore.Object
+	version int
+	gets    int
+}
+
+func newMemBucket() *memBucket {
+	return &memBucket{objects: make(map[string]*objectstore.Object)}
+}
+
+func (b *memBucket) Get(_ context.Context, key, ifNoneMatch string) (*objectstore.Object, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.gets++
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, objectstore.ErrNotFound
+	}
+	if ifNoneMatch != "" && ifNoneMatch == obj.ETag {
+		return nil, objectstore.ErrNotModified
+	}
+	return obj, nil
+}
+
+func (b *memBucket) Put(_ context.Context, key string, data []byte, metadata map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.version++
+	b.objects[key] = &objectstore.Object{Data: data, ETag: fmt.Sprintf(`"v%d"`, b.version), Metadata: metadata}
+	return nil
+}
+
+func (b *memBucket) Delete(_ context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, key)
+	return nil
+}
+
+func publishTestRoutes(t *testing.T, b *memBucket, target string, config *RoutesConfig) {
+	t.Helper()
+	data, err := EncodeRoutesConfig(config, EncodeOptions{Version: FormatVersion2})
+	if err != nil {
+		t.Fatalf("EncodeRoutesConfig() error = %v", err)
+	}
+	metadata := map[string]string{BucketMetadataSHA256: BucketChecksum(data), BucketMetadataTarget: target}
+	if err := b.Put(context.Background(), BucketObjectKey(target), data, metadata); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+}
+
+func bucketTestConfig(backend string) *RoutesConfig {
+	return &RoutesConfig{
+		Version: 1,
+		Hosts: map[string][]Route{
+			"example.com": {{Path: "/", Type: RouteTypePrefix, Backend: backend, Priority: 1000}},
+		},
+	}
+}
+
+func TestBucketLoaderLoad(t *testing.T) {
+	bucket := newMemBucket()
+	publishTestRoutes(t, bucket, "default", bucketTestConfig("web.default.svc.cluster.local:80"))
+
+	loader := NewBucketLoader(BucketLoaderConfig{Bucket: bucket, TargetName: "default"})
+	defer func() { _ = loader.Close() }()
+
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	route := loader.FindRoute("example.com:443", RequestMatch{Path: "/x", Method: "GET"})
+	if route == nil || route.Backend != "web.default.svc.cluster.local:80" {
+		t.Fatalf("FindRoute() = %+v, want the published route", route)
+	}
+	if status := loader.Status(); status.Source != LoadSourceBucket || status.Routes != 1 {
+		t.Errorf("Status() = %+v, want 1 route from the bucket", status)
+	}
+
+	// An unchanged object keeps the config without re-decoding it.
+	before := loader.GetConfig()
+	changed, err := loader.load()
+	if err != nil || changed {
+		t.Fatalf("load() of an unchanged object = %v, %v, want false, nil", changed, err)
+	}
+	if loader.GetConfig() != before {
+		t.Error("load() of an unchanged object replaced the config")
+	}
+
+	publishTestRoutes(t, bucket, "default", bucketTestConfig("api.default.svc.cluster.local:8080"))
+	if changed, err := loader.load(); err != nil || !changed {
+		t.Fatalf("load() of a new object = %v, %v, want true, nil", changed, err)
+	}
+	route = loader.FindRoute("example.com", RequestMatch{Path: "/x", Method: "GET"})
+	if route == nil || route.Backend != "api.default.svc.cluster.local:8080" {
+		t.Errorf("FindRoute() = %+v, want the republished route", route)
+	}
+}
+
+func TestBucketLoaderRejectsChecksumMismatch(t *testing.T) {
+	bucket := newMemBucket()
+	publishTestRoutes(t, bucket, "default", bucketTestConfig("web.default.svc.cluster.local:80"))
+	if err := NewBucketLoader(BucketLoaderConfig{Bucket: bucket, TargetName: "default"}).Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	obj := bucket.objects[BucketObjectKey("default")]
+	obj.Metadata[BucketMetadataSHA256] = strings.Repeat("0", 64)
+	obj.ETag = `"corrupted"`
+
+	loader := NewBucketLoader(BucketLoaderConfig{Bucket: bucket, TargetName: "default"})
+	err := loader.Load()
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Load() error = %v, want a checksum mismatch", err)
+	}
+	if status := loader.Status(); status.Loaded() || status.LastError == "" {
+		t.Errorf("Status() = %+v, want nothing loaded and the error recorded", status)
+	}
+}
+
+func TestBucketLoaderWatch(t *testing.T) {
+	bucket := newMemBucket()
+	publishTestRoutes(t, bucket, "default", bucketTestConfig("web.default.svc.cluster.local:80"))
+
+	loader := NewBucketLoader(BucketLoaderConfig{
+		Bucket:       bucket,
+		TargetName:   "default",
+		PollInterval: 10 * time.Millisecond,
+	})
+	defer func() { _ = loader.Close() }()
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	changes := make(chan *RoutesConfig, 1)
+	if err := loader.Watch(func(c *RoutesConfig) { changes <- c }); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	publishTestRoutes(t, bucket, "default", bucketTestConfig("api.default.svc.cluster.local:8080"))
+
+	select {
+	case config := <-changes:
+		if got := config.Hosts["example.com"][0].Backend; got != "api.default.svc.cluster.local:8080" {
+			t.Errorf("onChange config backend = %q, want the republished one", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("onChange not called after the object changed")
+	}
+}
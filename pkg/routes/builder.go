@@ -0,0 +1,371 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// builderHostname is the hostname pattern of CustomHTTPRoute spec.hostnames.
+var builderHostname = regexp.MustCompile(
+	`^(\*\.)?[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?(\.[A-Za-z0-9]([-A-Za-z0-9]*[A-Za-z0-9])?)*(:[0-9]{1,5})?$`)
+
+// builderMethods are the methods of the API's HTTPMethod enum.
+var builderMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true,
+	"CONNECT": true, "OPTIONS": true, "TRACE": true, "PATCH": true,
+}
+
+// builderRedirectStatusCodes are the status codes of the API's redirect
+// statusCode enum.
+var builderRedirectStatusCodes = map[int32]bool{301: true, 302: true, 303: true, 307: true, 308: true}
+
+// builderActionTypes are the action types the route table carries.
+// request-mirror and cors are rendered into Envoy config by the operator and
+// never reach the extproc, so they cannot be built here.
+var builderActionTypes = map[string]bool{
+	ActionTypeRedirect: true, ActionTypeRewrite: true,
+	ActionTypeHeaderSet: true, ActionTypeHeaderAdd: true, ActionTypeHeaderRemove: true,
+	ActionTypeResponseHeaderSet: true, ActionTypeResponseHeaderAdd: true, ActionTypeResponseHeaderRemove: true,
+	ActionTypeRequireAuth: true, ActionTypeStripUpgrade: true, ActionTypeDenyUpgrade: true,
+}
+
+// ConfigBuilder builds a RoutesConfig in code, for tools that generate
+// routes without going through CustomHTTPRoutes. Each call validates its
+// input and Build reports every error found, so a chain can be written
+// without checking errors along the way:
+//
+//	config, err := routes.NewConfigBuilder().
+//		Host("www.example.com").
+//		Prefix("/api").Service("api", "shop", 8080).
+//		Exact("/old").Redirect("", "/new", 301).
+//		Build()
+//
+// Host selects the host the following routes are added to, Exact, Prefix
+// and Regex start a route, and the other methods set fields of the route
+// last started. Routes get the priority of their match type unless one is
+// set, and each host's routes are sorted like the operator sorts them, so
+// EncodeRoutesConfig writes the document the operator would write for the
+// same routes.
+type ConfigBuilder struct {
+	hosts  map[string][]Route
+	host   string
+	source string
+	errs   []error
+
+	// explicit records the routes whose priority was set, by host.
+	explicit map[string]map[int]bool
+}
+
+// NewConfigBuilder returns an empty ConfigBuilder.
+func NewConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{
+		hosts:    make(map[string][]Route),
+		explicit: make(map[string]map[int]bool),
+	}
+}
+
+// errorf records a validation error, prefixed with the route it is about.
+func (b *ConfigBuilder) errorf(format string, args ...any) *ConfigBuilder {
+	err := fmt.Errorf(format, args...)
+	if route := b.current(); route != nil {
+		err = fmt.Errorf("host %s %s %s: %w", b.host, route.Type, route.Path, err)
+	} else if b.host != "" {
+		err = fmt.Errorf("host %s: %w", b.host, err)
+	}
+	b.errs = append(b.errs, err)
+	return b
+}
+
+// current returns the route last started on the current host, or nil.
+func (b *ConfigBuilder) current() *Route {
+	hostRoutes := b.hosts[b.host]
+	if len(hostRoutes) == 0 {
+		return nil
+	}
+	return &hostRoutes[len(hostRoutes)-1]
+}
+
+// Source sets the CustomHTTPRoute-like source ("namespace/name") of the
+// routes started after it. Build stamps those routes with it and a stable
+// id, which only the v2 format writes. Empty stops stamping.
+func (b *ConfigBuilder) Source(source string) *ConfigBuilder {
+	b.source = source
+	return b
+}
+
+// Host selects the host the routes started after it are added to, e.g.
+// "www.example.com" or "*.example.com".
+func (b *ConfigBuilder) Host(hostname string) *ConfigBuilder {
+	b.host = ""
+	if len(hostname) > 253 || !builderHostname.MatchString(hostname) {
+		return b.errorf("invalid hostname %q", hostname)
+	}
+	b.host = hostname
+	if _, ok := b.hosts[hostname]; !ok {
+		b.hosts[hostname] = nil
+	}
+	return b
+}
+
+// Exact starts a route matching path exactly.
+func (b *ConfigBuilder) Exact(path string) *ConfigBuilder {
+	return b.addRoute(RouteTypeExact, path)
+}
+
+// Prefix starts a route matching path and the paths under it.
+func (b *ConfigBuilder) Prefix(path string) *ConfigBuilder {
+	return b.addRoute(RouteTypePrefix, path)
+}
+
+// Regex starts a route matching the paths pattern (RE2 syntax) matches.
+func (b *ConfigBuilder) Regex(pattern string) *ConfigBuilder {
+	return b.addRoute(RouteTypeRegex, pattern)
+}
+
+func (b *ConfigBuilder) addRoute(routeType, path string) *ConfigBuilder {
+	if b.host == "" {
+		b.errs = append(b.errs, fmt.Errorf("%s route %s added before Host", routeType, path))
+		return b
+	}
+	b.hosts[b.host] = append(b.hosts[b.host], Route{Path: path, Type: routeType, Source: b.source})
+	switch {
+	case routeType == RouteTypeRegex && !IsValidRegex(path):
+		return b.errorf("invalid regex")
+	case routeType != RouteTypeRegex && !strings.HasPrefix(path, "/"):
+		return b.errorf("path must start with /")
+	}
+	return b
+}
+
+// route returns the route the field setters apply to, recording an error
+// naming setter when no route was started.
+func (b *ConfigBuilder) route(setter string) *Route {
+	route := b.current()
+	if route == nil {
+		b.errs = append(b.errs, fmt.Errorf("%s called before Exact, Prefix or Regex", setter))
+	}
+	return route
+}
+
+// Backend sets the backend of the route as "host:port".
+func (b *ConfigBuilder) Backend(address string) *ConfigBuilder {
+	route := b.route("Backend")
+	if route == nil {
+		return b
+	}
+	route.Backend = address
+	if err := validateBackend(address); err != nil {
+		return b.errorf("%w", err)
+	}
+	return b
+}
+
+// Service sets the backend of the route to a port of a Kubernetes Service,
+// named like the operator names the Services of backendRefs.
+func (b *ConfigBuilder) Service(name, namespace string, port int32) *ConfigBuilder {
+	return b.Backend(BackendAddress(v1alpha1.BackendRef{Name: name, Namespace: namespace, Port: port}))
+}
+
+// validateBackend checks a "host:port" backend address.
+func validateBackend(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid backend %q: %w", address, err)
+	}
+	if host == "" {
+		return fmt.Errorf("invalid backend %q: missing host", address)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid backend %q: port must be 1-65535", address)
+	}
+	return nil
+}
+
+// Method restricts the route to an HTTP method, e.g. "GET".
+func (b *ConfigBuilder) Method(method string) *ConfigBuilder {
+	route := b.route("Method")
+	if route == nil {
+		return b
+	}
+	route.Method = strings.ToUpper(method)
+	if !builderMethods[route.Method] {
+		return b.errorf("unknown method %q", method)
+	}
+	return b
+}
+
+// Header restricts the route to requests carrying header name with value.
+func (b *ConfigBuilder) Header(name, value string) *ConfigBuilder {
+	route := b.route("Header")
+	if route == nil {
+		return b
+	}
+	if name == "" {
+		return b.errorf("empty header name")
+	}
+	route.Headers = append(route.Headers, RouteHeaderMatch{Name: name, Value: value})
+	return b
+}
+
+// QueryParam restricts the route to requests carrying query parameter name
+// with value.
+func (b *ConfigBuilder) QueryParam(name, value string) *ConfigBuilder {
+	route := b.route("QueryParam")
+	if route == nil {
+		return b
+	}
+	if name == "" {
+		return b.errorf("empty query parameter name")
+	}
+	route.QueryParams = append(route.QueryParams, RouteQueryParamMatch{Name: name, Value: value})
+	return b
+}
+
+// Priority sets the priority of the route, 1-10000 like a match priority.
+// Routes of higher priority are evaluated first.
+func (b *ConfigBuilder) Priority(priority int32) *ConfigBuilder {
+	route := b.route("Priority")
+	if route == nil {
+		return b
+	}
+	if priority < 1 || priority > 10000 {
+		return b.errorf("priority %d out of range 1-10000", priority)
+	}
+	route.Priority = priority
+	if b.explicit[b.host] == nil {
+		b.explicit[b.host] = make(map[int]bool)
+	}
+	b.explicit[b.host][len(b.hosts[b.host])-1] = true
+	return b
+}
+
+// Redirect adds a redirect action to the route. Empty hostname and path
+// keep those of the request; statusCode is 301, 302, 303, 307 or 308, and
+// 0 means 302.
+func (b *ConfigBuilder) Redirect(hostname, path string, statusCode int32) *ConfigBuilder {
+	return b.Action(RouteAction{
+		Type:               ActionTypeRedirect,
+		RedirectHostname:   hostname,
+		RedirectPath:       path,
+		RedirectStatusCode: statusCode,
+	})
+}
+
+// Action adds an action to the route.
+func (b *ConfigBuilder) Action(action RouteAction) *ConfigBuilder {
+	route := b.route("Action")
+	if route == nil {
+		return b
+	}
+	if action.Type == ActionTypeRedirect && action.RedirectStatusCode == 0 {
+		action.RedirectStatusCode = 302
+	}
+	route.Actions = append(route.Actions, action)
+	switch {
+	case !builderActionTypes[action.Type]:
+		return b.errorf("unsupported action type %q", action.Type)
+	case action.Type == ActionTypeRedirect && !builderRedirectStatusCodes[action.RedirectStatusCode]:
+		return b.errorf("invalid redirect status code %d", action.RedirectStatusCode)
+	case strings.HasPrefix(action.Type, "header-") || strings.HasPrefix(action.Type, "response-header-"):
+		if action.HeaderName == "" {
+			return b.errorf("%s action without a header name", action.Type)
+		}
+	case action.Type == ActionTypeRequireAuth && action.AuthURL == "":
+		return b.errorf("require-auth action without an auth URL")
+	}
+	return b
+}
+
+// Owner sets who to contact about the route. Only the v2 format writes it.
+func (b *ConfigBuilder) Owner(owner string) *ConfigBuilder {
+	if route := b.route("Owner"); route != nil {
+		route.Owner = owner
+	}
+	return b
+}
+
+// Description sets what the route is for. Only the v2 format writes it.
+func (b *ConfigBuilder) Description(description string) *ConfigBuilder {
+	if route := b.route("Description"); route != nil {
+		route.Description = description
+	}
+	return b
+}
+
+// Build returns the RoutesConfig of the routes added so far, or every
+// validation error found. Routes without a backend must redirect. The
+// builder can keep being used afterwards.
+func (b *ConfigBuilder) Build() (*RoutesConfig, error) {
+	errs := append([]error(nil), b.errs...)
+	config := &RoutesConfig{Version: FormatVersion1, Hosts: make(map[string][]Route, len(b.hosts))}
+	for host, hostRoutes := range b.hosts {
+		built := make([]Route, len(hostRoutes))
+		for i := range hostRoutes {
+			route := hostRoutes[i]
+			route.Actions = append([]RouteAction(nil), route.Actions...)
+			route.Headers = append([]RouteHeaderMatch(nil), route.Headers...)
+			route.QueryParams = append([]RouteQueryParamMatch(nil), route.QueryParams...)
+			if route.Backend == "" && !hasRedirect(&route) {
+				errs = append(errs, fmt.Errorf("host %s %s %s: no backend, and no redirect action",
+					host, route.Type, route.Path))
+			}
+			if !b.explicit[host][i] {
+				route.Priority = EffectivePriority(builderMatchType(route.Type), 0)
+			}
+			if route.Source != "" {
+				route.ID = routeID(route.Source, host, &route)
+			}
+			built[i] = route
+		}
+		SortRoutes(built)
+		config.Hosts[host] = built
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return config, nil
+}
+
+// hasRedirect reports whether route has a redirect action.
+func hasRedirect(route *Route) bool {
+	for i := range route.Actions {
+		if route.Actions[i].Type == ActionTypeRedirect {
+			return true
+		}
+	}
+	return false
+}
+
+// builderMatchType returns the API match type of a route type.
+func builderMatchType(routeType string) v1alpha1.MatchType {
+	switch routeType {
+	case RouteTypeExact:
+		return v1alpha1.MatchTypeExact
+	case RouteTypeRegex:
+		return v1alpha1.MatchTypeRegex
+	default:
+		return v1alpha1.MatchTypePathPrefix
+	}
+}
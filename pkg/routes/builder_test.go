@@ -0,0 +1,147 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestConfigBuilderMatchesExpandRoutes(t *testing.T) {
+	built, err := NewConfigBuilder().
+		Host("www.example.com").
+		Prefix("/api").Service("api", "shop", 8080).
+		Exact("/old").Redirect("", "/new", 301).
+		Regex("^/items/[0-9]+$").Method("get").Header("x-env", "beta").Service("items", "shop", 8080).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"www.example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "shop", Port: 8080}},
+				},
+				{
+					Matches: []v1alpha1.PathMatch{{Path: "/old", Type: v1alpha1.MatchTypeExact}},
+					Actions: []v1alpha1.Action{{
+						Type:     v1alpha1.ActionTypeRedirect,
+						Redirect: &v1alpha1.RedirectConfig{Path: "/new", StatusCode: 301},
+					}},
+				},
+				{
+					Matches: []v1alpha1.PathMatch{{
+						Path: "^/items/[0-9]+$", Type: v1alpha1.MatchTypeRegex, Method: "GET",
+						Headers: []v1alpha1.HeaderMatch{{Name: "x-env", Value: "beta"}},
+					}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "items", Namespace: "shop", Port: 8080}},
+				},
+			},
+		},
+	}
+	expanded, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("ExpandRoutes failed: %v", err)
+	}
+
+	got, err := EncodeRoutesConfig(built, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("encoding the built config: %v", err)
+	}
+	want, err := EncodeRoutesConfig(MergeRoutesConfig(expanded), EncodeOptions{})
+	if err != nil {
+		t.Fatalf("encoding the expanded config: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("built config =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfigBuilderSource(t *testing.T) {
+	config, err := NewConfigBuilder().
+		Source("cms/pages").
+		Host("www.example.com").
+		Prefix("/blog").Backend("blog.example.net:443").Priority(2000).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	route := config.Hosts["www.example.com"][0]
+	if route.Source != "cms/pages" || route.ID == "" || route.Priority != 2000 {
+		t.Errorf("route = %+v, want source cms/pages, an id and priority 2000", route)
+	}
+}
+
+func TestConfigBuilderValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(*ConfigBuilder) *ConfigBuilder
+		wantErr string
+	}{
+		{"route before host", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Prefix("/")
+		}, "added before Host"},
+		{"setter before route", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Backend("web:80")
+		}, "Backend called before"},
+		{"invalid hostname", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("exa mple.com")
+		}, "invalid hostname"},
+		{"relative path", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Prefix("api").Backend("web:80")
+		}, "must start with /"},
+		{"invalid regex", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Regex("^/(a").Backend("web:80")
+		}, "invalid regex"},
+		{"backend without port", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Prefix("/").Backend("web")
+		}, "invalid backend"},
+		{"backend port out of range", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Prefix("/").Backend("web:70000")
+		}, "port must be 1-65535"},
+		{"unknown method", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Prefix("/").Method("FETCH").Backend("web:80")
+		}, "unknown method"},
+		{"priority out of range", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Prefix("/").Priority(20000).Backend("web:80")
+		}, "out of range"},
+		{"invalid redirect status", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Prefix("/").Redirect("", "/new", 200)
+		}, "invalid redirect status code"},
+		{"controller-only action", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Prefix("/").Backend("web:80").Action(RouteAction{Type: ActionTypeCORS})
+		}, "unsupported action type"},
+		{"no backend", func(b *ConfigBuilder) *ConfigBuilder {
+			return b.Host("example.com").Prefix("/")
+		}, "no backend"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.build(NewConfigBuilder()).Build()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Build() = %v, %v; want an error containing %q", config, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+const (
+	// DefaultClusterNameTemplate is Istio's name for the cluster of a
+	// Service port, outbound|<port>|<subset>|<host>.
+	DefaultClusterNameTemplate = "outbound|{port}|{subset}|{host}"
+
+	// DefaultClusterDomain is the Kubernetes cluster domain of Service
+	// hostnames.
+	DefaultClusterDomain = "cluster.local"
+)
+
+// ClusterNameTemplateMetadataKey and ClusterDomainMetadataKey are the gRPC
+// initial metadata keys through which an ExternalProcessorAttachment passes
+// its clusterName settings to the extproc on every ext_proc stream.
+const (
+	ClusterNameTemplateMetadataKey = "x-customrouter-cluster-name-template"
+	ClusterDomainMetadataKey       = "x-customrouter-cluster-domain"
+)
+
+// clusterNameVariable matches the variables of a cluster name template.
+var clusterNameVariable = regexp.MustCompile(`\{[^{}]*\}`)
+
+// clusterNameVariables are the variables a cluster name template may use.
+var clusterNameVariables = map[string]bool{
+	"{service}": true, "{namespace}": true, "{port}": true,
+	"{subset}": true, "{domain}": true, "{host}": true,
+}
+
+// ClusterNaming names the Envoy cluster of a backend, for gateways whose
+// clusters are not named like Istio's (sidecar-less setups, custom trust or
+// service domains). The zero value names them like Istio.
+type ClusterNaming struct {
+	// Template is the cluster name with {service}, {namespace}, {port},
+	// {subset}, {domain} and {host} variables. Empty means
+	// DefaultClusterNameTemplate.
+	Template string
+
+	// Domain is the cluster domain of Service backends, used in {domain}
+	// and {host}. Empty means DefaultClusterDomain.
+	Domain string
+}
+
+// ValidateClusterNameTemplate checks a cluster name template: it may only
+// use the known variables, and must name the port and the host or Service
+// so different backends never share a cluster.
+func ValidateClusterNameTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	for _, variable := range clusterNameVariable.FindAllString(template, -1) {
+		if !clusterNameVariables[variable] {
+			return fmt.Errorf("unknown variable %s in cluster name template %q", variable, template)
+		}
+	}
+	if !strings.Contains(template, "{port}") {
+		return fmt.Errorf("cluster name template %q must use {port}", template)
+	}
+	if !strings.Contains(template, "{host}") && !strings.Contains(template, "{service}") {
+		return fmt.Errorf("cluster name template %q must use {host} or {service}", template)
+	}
+	return nil
+}
+
+// ConvertClusterNaming returns the ClusterNaming of an attachment's
+// clusterName, the zero value when it sets none.
+func ConvertClusterNaming(config *v1alpha1.ClusterNameConfig) ClusterNaming {
+	if config == nil {
+		return ClusterNaming{}
+	}
+	return ClusterNaming{Template: config.Template, Domain: config.Domain}
+}
+
+// Merge returns n with the settings override sets replacing n's.
+func (n ClusterNaming) Merge(override ClusterNaming) ClusterNaming {
+	if override.Template != "" {
+		n.Template = override.Template
+	}
+	if override.Domain != "" {
+		n.Domain = override.Domain
+	}
+	return n
+}
+
+// ClusterName returns the name of the cluster of backend ("host:port"). A
+// Service backend (name.namespace.svc.cluster.local) fills {service} and
+// {namespace}, and its {host} takes the Domain. Any other host is used as
+// is for {service} and {host}, with an empty {namespace}. {subset} is always
+// empty: routes name whole Services.
+func (n ClusterNaming) ClusterName(backend string) string {
+	host, port := (&Route{Backend: backend}).ParseBackend()
+	if n == (ClusterNaming{}) {
+		return "outbound|" + port + "||" + host
+	}
+
+	template := n.Template
+	if template == "" {
+		template = DefaultClusterNameTemplate
+	}
+	domain := n.Domain
+	if domain == "" {
+		domain = DefaultClusterDomain
+	}
+	service, namespace := host, ""
+	if serviceHost, ok := strings.CutSuffix(host, ".svc.cluster.local"); ok {
+		if name, ns, ok := strings.Cut(serviceHost, "."); ok && name != "" && ns != "" && !strings.Contains(ns, ".") {
+			service, namespace = name, ns
+			host = name + "." + ns + ".svc." + domain
+		}
+	}
+	return strings.NewReplacer(
+		"{service}", service,
+		"{namespace}", namespace,
+		"{port}", port,
+		"{subset}", "",
+		"{domain}", domain,
+		"{host}", host,
+	).Replace(template)
+}
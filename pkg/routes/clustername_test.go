@@ -0,0 +1,77 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import "testing"
+
+func TestClusterNamingClusterName(t *testing.T) {
+	tests := []struct {
+		name    string
+		naming  ClusterNaming
+		backend string
+		want    string
+	}{
+		{"default", ClusterNaming{}, "api.default.svc.cluster.local:8080", "outbound|8080||api.default.svc.cluster.local"},
+		{"default external", ClusterNaming{}, "example.com:443", "outbound|443||example.com"},
+		{
+			"default template with domain", ClusterNaming{Domain: "corp.internal"},
+			"api.default.svc.cluster.local:8080", "outbound|8080||api.default.svc.corp.internal",
+		},
+		{
+			"custom template", ClusterNaming{Template: "{namespace}/{service}/{port}"},
+			"api.default.svc.cluster.local:8080", "default/api/8080",
+		},
+		{
+			"domain variable", ClusterNaming{Template: "{service}.{namespace}.{domain}_{port}", Domain: "mesh"},
+			"api.default.svc.cluster.local:80", "api.default.mesh_80",
+		},
+		{
+			"external backend", ClusterNaming{Template: "{service}|{namespace}|{host}|{port}"},
+			"example.com:443", "example.com||example.com|443",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.naming.ClusterName(tt.backend); got != tt.want {
+				t.Errorf("ClusterName(%q) = %q, want %q", tt.backend, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateClusterNameTemplate(t *testing.T) {
+	for _, template := range []string{"", DefaultClusterNameTemplate, "{service}.{namespace}:{port}"} {
+		if err := ValidateClusterNameTemplate(template); err != nil {
+			t.Errorf("ValidateClusterNameTemplate(%q) = %v", template, err)
+		}
+	}
+	for _, template := range []string{"outbound||{host}", "outbound|{port}||{namespace}", "{host}:{port}:{zone}"} {
+		if err := ValidateClusterNameTemplate(template); err == nil {
+			t.Errorf("ValidateClusterNameTemplate(%q) succeeded, want an error", template)
+		}
+	}
+}
+
+func TestClusterNamingMerge(t *testing.T) {
+	base := ClusterNaming{Template: "{host}:{port}", Domain: "corp.internal"}
+	if got := base.Merge(ClusterNaming{Domain: "mesh"}); got != (ClusterNaming{Template: "{host}:{port}", Domain: "mesh"}) {
+		t.Errorf("Merge() = %+v", got)
+	}
+	if got := base.Merge(ClusterNaming{}); got != base {
+		t.Errorf("Merge() of nothing = %+v, want %+v", got, base)
+	}
+}
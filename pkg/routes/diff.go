@@ -0,0 +1,232 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Host diff statuses reported in HostDiff.Status.
+const (
+	HostDiffAdded   = "added"
+	HostDiffRemoved = "removed"
+	HostDiffChanged = "changed"
+)
+
+// RoutesDiff is what changed between two route configs, by host.
+type RoutesDiff struct {
+	// Hosts lists the hosts whose routes differ, sorted by host.
+	Hosts []HostDiff `json:"hosts"`
+}
+
+// HostDiff is what changed in the routes of one host.
+type HostDiff struct {
+	Host string `json:"host"`
+
+	// Status is HostDiffAdded or HostDiffRemoved when the host is only in
+	// the new or the old config, and HostDiffChanged otherwise.
+	Status string `json:"status"`
+
+	// Added and Removed list the routes only in the new or the old config,
+	// in evaluation order.
+	Added   []Route `json:"added,omitempty"`
+	Removed []Route `json:"removed,omitempty"`
+
+	// Reordered is true when the host kept the same routes but evaluates
+	// them in a different order.
+	Reordered bool `json:"reordered,omitempty"`
+}
+
+// Empty reports whether both configs hold the same routes in the same order.
+func (d RoutesDiff) Empty() bool {
+	return len(d.Hosts) == 0
+}
+
+// DiffRoutesConfigs returns what changed from the routes of from to those
+// of to. Routes are compared by their serialized form, so two routes differ
+// when any field the extproc reads from the ConfigMap does. Either config
+// may be nil, which counts as having no hosts.
+func DiffRoutesConfigs(from, to *RoutesConfig) RoutesDiff {
+	var fromHosts, toHosts map[string][]Route
+	if from != nil {
+		fromHosts = from.Hosts
+	}
+	if to != nil {
+		toHosts = to.Hosts
+	}
+
+	hosts := make([]string, 0, len(fromHosts)+len(toHosts))
+	for host := range fromHosts {
+		hosts = append(hosts, host)
+	}
+	for host := range toHosts {
+		if _, ok := fromHosts[host]; !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	diff := RoutesDiff{Hosts: []HostDiff{}}
+	for _, host := range hosts {
+		oldRoutes, inFrom := fromHosts[host]
+		newRoutes, inTo := toHosts[host]
+		switch {
+		case !inFrom:
+			diff.Hosts = append(diff.Hosts, HostDiff{Host: host, Status: HostDiffAdded, Added: newRoutes})
+		case !inTo:
+			diff.Hosts = append(diff.Hosts, HostDiff{Host: host, Status: HostDiffRemoved, Removed: oldRoutes})
+		default:
+			if hd, changed := diffHostRoutes(host, oldRoutes, newRoutes); changed {
+				diff.Hosts = append(diff.Hosts, hd)
+			}
+		}
+	}
+	return diff
+}
+
+// diffHostRoutes compares the routes a host has in two configs, reporting
+// whether they differ at all.
+func diffHostRoutes(host string, oldRoutes, newRoutes []Route) (HostDiff, bool) {
+	// The K8sLoader reuses the route slices of unchanged hosts across
+	// reloads, so most hosts are compared without serializing a route.
+	if len(oldRoutes) == len(newRoutes) && (len(oldRoutes) == 0 || &oldRoutes[0] == &newRoutes[0]) {
+		return HostDiff{}, false
+	}
+
+	oldKeys := routeKeys(oldRoutes)
+	newKeys := routeKeys(newRoutes)
+
+	// Routes are a multiset: a route listed twice and then once was removed
+	// once.
+	remaining := make(map[string]int, len(newKeys))
+	for _, key := range newKeys {
+		remaining[key]++
+	}
+	hd := HostDiff{Host: host, Status: HostDiffChanged}
+	for i, key := range oldKeys {
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		hd.Removed = append(hd.Removed, oldRoutes[i])
+	}
+	kept := make(map[string]int, len(oldKeys))
+	for _, key := range oldKeys {
+		kept[key]++
+	}
+	for i, key := range newKeys {
+		if kept[key] > 0 {
+			kept[key]--
+			continue
+		}
+		hd.Added = append(hd.Added, newRoutes[i])
+	}
+
+	if len(hd.Added) == 0 && len(hd.Removed) == 0 {
+		for i := range oldKeys {
+			if oldKeys[i] != newKeys[i] {
+				hd.Reordered = true
+				break
+			}
+		}
+		if !hd.Reordered {
+			return HostDiff{}, false
+		}
+	}
+	return hd, true
+}
+
+// routeKeys returns the serialized form of every route, to compare them.
+func routeKeys(hostRoutes []Route) []string {
+	keys := make([]string, len(hostRoutes))
+	for i := range hostRoutes {
+		// Routes hold only plain data, so marshaling cannot fail.
+		data, _ := json.Marshal(&hostRoutes[i])
+		keys[i] = string(data)
+	}
+	return keys
+}
+
+// DiffSummary counts what changed between two route configs.
+type DiffSummary struct {
+	HostsAdded   int `json:"hostsAdded"`
+	HostsRemoved int `json:"hostsRemoved"`
+	HostsChanged int `json:"hostsChanged"`
+
+	RoutesAdded   int `json:"routesAdded"`
+	RoutesRemoved int `json:"routesRemoved"`
+	RoutesChanged int `json:"routesChanged"`
+}
+
+// Summary counts the hosts and routes of the diff. A removed route and an
+// added route that match the same requests (see HostDiff.Counts) count as
+// one changed route.
+func (d RoutesDiff) Summary() DiffSummary {
+	var s DiffSummary
+	for _, hd := range d.Hosts {
+		switch hd.Status {
+		case HostDiffAdded:
+			s.HostsAdded++
+		case HostDiffRemoved:
+			s.HostsRemoved++
+		default:
+			s.HostsChanged++
+		}
+		added, removed, changed := hd.Counts()
+		s.RoutesAdded += added
+		s.RoutesRemoved += removed
+		s.RoutesChanged += changed
+	}
+	return s
+}
+
+// Counts returns how many routes of the host were added, removed and
+// changed. A route is changed rather than removed and added when the new
+// config has a route matching the same requests (type, path, method,
+// header and query parameter matches) with, e.g., another backend,
+// priority or actions.
+func (hd HostDiff) Counts() (added, removed, changed int) {
+	removedMatches := make(map[string]int, len(hd.Removed))
+	for i := range hd.Removed {
+		removedMatches[routeMatchKey(&hd.Removed[i])]++
+	}
+	for i := range hd.Added {
+		key := routeMatchKey(&hd.Added[i])
+		if removedMatches[key] > 0 {
+			removedMatches[key]--
+			changed++
+		}
+	}
+	return len(hd.Added) - changed, len(hd.Removed) - changed, changed
+}
+
+// routeMatchKey returns the serialized form of the fields of r that decide
+// which requests it matches.
+func routeMatchKey(r *Route) string {
+	data, _ := json.Marshal(struct {
+		Type            string
+		Path            string
+		Method          string
+		Scheme          string
+		Headers         []RouteHeaderMatch
+		QueryParams     []RouteQueryParamMatch
+		CaseInsensitive bool
+		GRPC            bool
+	}{r.Type, r.Path, r.Method, r.Scheme, r.Headers, r.QueryParams, r.CaseInsensitive, r.GRPC})
+	return string(data)
+}
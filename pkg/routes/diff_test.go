@@ -0,0 +1,125 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRoutesConfigs(t *testing.T) {
+	api := Route{Path: "/api", Type: RouteTypePrefix, Backend: "api.default.svc.cluster.local:80"}
+	apiV2 := Route{Path: "/api", Type: RouteTypePrefix, Backend: "api-v2.default.svc.cluster.local:80"}
+	docs := Route{Path: "/docs", Type: RouteTypeExact, Backend: "docs.default.svc.cluster.local:80"}
+	shared := []Route{api, docs}
+
+	tests := []struct {
+		name     string
+		from, to *RoutesConfig
+		want     []HostDiff
+	}{
+		{
+			name: "identical configs",
+			from: &RoutesConfig{Hosts: map[string][]Route{"a.com": {api, docs}}},
+			to:   &RoutesConfig{Hosts: map[string][]Route{"a.com": {api, docs}}},
+			want: []HostDiff{},
+		},
+		{
+			name: "shared route slices",
+			from: &RoutesConfig{Hosts: map[string][]Route{"a.com": shared}},
+			to:   &RoutesConfig{Hosts: map[string][]Route{"a.com": shared}},
+			want: []HostDiff{},
+		},
+		{
+			name: "added and removed hosts",
+			from: &RoutesConfig{Hosts: map[string][]Route{"a.com": {api}}},
+			to:   &RoutesConfig{Hosts: map[string][]Route{"b.com": {docs}}},
+			want: []HostDiff{
+				{Host: "a.com", Status: HostDiffRemoved, Removed: []Route{api}},
+				{Host: "b.com", Status: HostDiffAdded, Added: []Route{docs}},
+			},
+		},
+		{
+			name: "changed backend",
+			from: &RoutesConfig{Hosts: map[string][]Route{"a.com": {api, docs}}},
+			to:   &RoutesConfig{Hosts: map[string][]Route{"a.com": {apiV2, docs}}},
+			want: []HostDiff{{Host: "a.com", Status: HostDiffChanged, Added: []Route{apiV2}, Removed: []Route{api}}},
+		},
+		{
+			name: "duplicate route removed once",
+			from: &RoutesConfig{Hosts: map[string][]Route{"a.com": {api, api}}},
+			to:   &RoutesConfig{Hosts: map[string][]Route{"a.com": {api}}},
+			want: []HostDiff{{Host: "a.com", Status: HostDiffChanged, Removed: []Route{api}}},
+		},
+		{
+			name: "reordered routes",
+			from: &RoutesConfig{Hosts: map[string][]Route{"a.com": {api, docs}}},
+			to:   &RoutesConfig{Hosts: map[string][]Route{"a.com": {docs, api}}},
+			want: []HostDiff{{Host: "a.com", Status: HostDiffChanged, Reordered: true}},
+		},
+		{
+			name: "nil config",
+			to:   &RoutesConfig{Hosts: map[string][]Route{"a.com": {api}}},
+			want: []HostDiff{{Host: "a.com", Status: HostDiffAdded, Added: []Route{api}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffRoutesConfigs(tt.from, tt.to)
+			if !reflect.DeepEqual(got.Hosts, tt.want) {
+				t.Errorf("DiffRoutesConfigs() = %+v, want %+v", got.Hosts, tt.want)
+			}
+			if got.Empty() != (len(tt.want) == 0) {
+				t.Errorf("Empty() = %v", got.Empty())
+			}
+		})
+	}
+}
+
+func TestRoutesDiffSummary(t *testing.T) {
+	api := Route{Path: "/api", Type: RouteTypePrefix, Backend: "api.default.svc.cluster.local:80"}
+	apiV2 := Route{Path: "/api", Type: RouteTypePrefix, Backend: "api-v2.default.svc.cluster.local:80"}
+	apiPost := Route{Path: "/api", Type: RouteTypePrefix, Method: "POST", Backend: "api.default.svc.cluster.local:80"}
+	docs := Route{Path: "/docs", Type: RouteTypeExact, Backend: "docs.default.svc.cluster.local:80"}
+	blog := Route{Path: "/blog", Type: RouteTypePrefix, Backend: "blog.default.svc.cluster.local:80"}
+
+	from := &RoutesConfig{Hosts: map[string][]Route{
+		"a.com": {api, docs},
+		"b.com": {blog},
+		"c.com": {api, docs},
+	}}
+	to := &RoutesConfig{Hosts: map[string][]Route{
+		// /api changed backend, /docs was removed and POST /api added.
+		"a.com": {apiV2, apiPost},
+		"c.com": {docs, api},
+		"d.com": {blog, docs},
+	}}
+
+	got := DiffRoutesConfigs(from, to).Summary()
+	want := DiffSummary{
+		HostsAdded:    1, // d.com
+		HostsRemoved:  1, // b.com
+		HostsChanged:  2, // a.com, c.com (reordered)
+		RoutesAdded:   3, // POST /api on a.com, both routes of d.com
+		RoutesRemoved: 2, // /docs on a.com, /blog of b.com
+		RoutesChanged: 1, // /api on a.com
+	}
+	if got != want {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// EncryptedRoutesDataKey is the route ConfigMap binaryData key holding a
+// routes document sealed by EncryptConfigMap, written instead of the
+// routes.json and CompressedRoutesDataKey keys for targets whose routes are
+// encrypted.
+const EncryptedRoutesDataKey = "routes.json.enc"
+
+// encryptionVersion is the first byte of a sealed document, so the scheme
+// can change without misreading older ConfigMaps. Both versions are AES-GCM
+// with a 12-byte nonce following the version byte. Version 1 used the key
+// for both AES and the nonce HMAC; version 2 derives a subkey for each with
+// HKDF. Version 1 documents are still decrypted.
+const (
+	encryptionVersion   byte = 2
+	encryptionVersionV1 byte = 1
+)
+
+// HKDF labels of the subkeys derived from a routes encryption key.
+const (
+	encryptionKeyLabel = "customrouter routes encryption key"
+	nonceKeyLabel      = "customrouter routes nonce key"
+)
+
+// gzipMagic starts a gzip stream, which tells a sealed compressed document
+// from a JSON one.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ErrRoutesEncrypted is returned when a route ConfigMap is encrypted and no
+// key was given to decrypt it.
+var ErrRoutesEncrypted = errors.New("routes are encrypted and no encryption key is configured")
+
+// EncryptConfigMap seals document, the stored form of the routes of the
+// route ConfigMap namespace/name for target, with AES-GCM. The namespace,
+// name and target are authenticated as additional data, so a sealed
+// document copied to another ConfigMap or target does not decrypt.
+//
+// The nonce is derived from a subkey, the ConfigMap and the document, so
+// sealing the same routes again gives the same bytes and an unchanged
+// ConfigMap is not rewritten on every reconcile. It only repeats for the
+// exact same plaintext, which GCM tolerates; it reveals whether two
+// versions of a ConfigMap hold the same routes and nothing else.
+func EncryptConfigMap(key []byte, namespace, name, target string, document []byte) ([]byte, error) {
+	if !validAESKeySize(len(key)) {
+		return nil, fmt.Errorf("invalid routes encryption key: %d bytes, must be 16, 24 or 32", len(key))
+	}
+	aead, err := newConfigMapAEAD(deriveKey(key, encryptionKeyLabel, len(key)))
+	if err != nil {
+		return nil, err
+	}
+	aad := configMapAAD(namespace, name, target)
+
+	mac := hmac.New(sha256.New, deriveKey(key, nonceKeyLabel, sha256.Size))
+	_, _ = mac.Write(aad)
+	_, _ = mac.Write(document)
+	nonce := mac.Sum(nil)[:aead.NonceSize()]
+
+	sealed := make([]byte, 0, 1+len(nonce)+len(document)+aead.Overhead())
+	sealed = append(sealed, encryptionVersion)
+	sealed = append(sealed, nonce...)
+	return aead.Seal(sealed, nonce, document, aad), nil
+}
+
+// DecryptConfigMap opens a document sealed by EncryptConfigMap for the
+// route ConfigMap namespace/name for target.
+func DecryptConfigMap(key []byte, namespace, name, target string, sealed []byte) ([]byte, error) {
+	if !validAESKeySize(len(key)) {
+		return nil, fmt.Errorf("invalid routes encryption key: %d bytes, must be 16, 24 or 32", len(key))
+	}
+	var aeadKey []byte
+	switch {
+	case len(sealed) > 0 && sealed[0] == encryptionVersion:
+		aeadKey = deriveKey(key, encryptionKeyLabel, len(key))
+	case len(sealed) > 0 && sealed[0] == encryptionVersionV1:
+		aeadKey = key
+	default:
+		return nil, fmt.Errorf("%w: unknown routes encryption version", ErrUnsupportedFormat)
+	}
+	aead, err := newConfigMapAEAD(aeadKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[1:]
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("encrypted routes are truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	document, err := aead.Open(nil, nonce, ciphertext, configMapAAD(namespace, name, target))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt routes: wrong key or tampered ConfigMap")
+	}
+	return document, nil
+}
+
+// deriveKey derives the subkey of key labeled label with HKDF-SHA256, so the
+// AES key and the nonce HMAC key are independent.
+func deriveKey(key []byte, label string, length int) []byte {
+	subkey, err := hkdf.Key(sha256.New, key, nil, label, length)
+	if err != nil {
+		// Only lengths over 255 hash sizes fail.
+		panic(err)
+	}
+	return subkey
+}
+
+func newConfigMapAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routes encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// configMapAAD length-prefixes the ConfigMap identity, like SignConfigMap,
+// so the boundaries of its parts cannot be shifted.
+func configMapAAD(namespace, name, target string) []byte {
+	var buf bytes.Buffer
+	for _, part := range []string{namespace, name, target} {
+		_ = binary.Write(&buf, binary.BigEndian, uint64(len(part)))
+		buf.WriteString(part)
+	}
+	return buf.Bytes()
+}
+
+// ReadEncryptionKey reads an AES key file, such as a mounted Secret key:
+// 16, 24 or 32 bytes (AES-128, -192 or -256), or their base64 encoding like
+// the output of "openssl rand -base64 32". A key of one of those lengths is
+// used as is, even when it is valid base64. Surrounding whitespace is
+// trimmed.
+func ReadEncryptionKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key: %w", err)
+	}
+	key := bytes.TrimSpace(data)
+	if validAESKeySize(len(key)) {
+		return key, nil
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(string(key)); err == nil && validAESKeySize(len(decoded)) {
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("encryption key file %s must hold a 16, 24 or 32-byte key, raw or base64-encoded", path)
+}
+
+func validAESKeySize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEncryptAndDecryptConfigMap(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	document := []byte(`{"version":1,"hosts":{}}`)
+	sealed, err := EncryptConfigMap(key, "routes", "customrouter-routes-default-0", "default", document)
+	if err != nil {
+		t.Fatalf("EncryptConfigMap() error = %v", err)
+	}
+	if bytes.Contains(sealed, document) {
+		t.Fatal("sealed document holds the plaintext")
+	}
+	again, err := EncryptConfigMap(key, "routes", "customrouter-routes-default-0", "default", document)
+	if err != nil || !bytes.Equal(again, sealed) {
+		t.Error("sealing the same routes again must give the same bytes")
+	}
+
+	tests := []struct {
+		name                      string
+		key                       []byte
+		namespace, cmName, target string
+		ok                        bool
+	}{
+		{"same inputs", key, "routes", "customrouter-routes-default-0", "default", true},
+		{"other key", []byte("fedcba9876543210fedcba9876543210"), "routes", "customrouter-routes-default-0", "default", false},
+		{"copied to another namespace", key, "team-a", "customrouter-routes-default-0", "default", false},
+		{"renamed", key, "routes", "customrouter-routes-default-1", "default", false},
+		{"relabeled to another target", key, "routes", "customrouter-routes-default-0", "internal", false},
+		{"shifted boundary", key, "route", "scustomrouter-routes-default-0", "default", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptConfigMap(tt.key, tt.namespace, tt.cmName, tt.target, sealed)
+			if tt.ok && (err != nil || !bytes.Equal(got, document)) {
+				t.Errorf("DecryptConfigMap() = %q, %v; want the document", got, err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("DecryptConfigMap() succeeded, want an error")
+			}
+		})
+	}
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := DecryptConfigMap(key, "routes", "customrouter-routes-default-0", "default", tampered); err == nil {
+		t.Error("a tampered document decrypted")
+	}
+	if _, err := DecryptConfigMap(key, "routes", "customrouter-routes-default-0", "default", sealed[:10]); err == nil {
+		t.Error("a truncated document decrypted")
+	}
+	if _, err := EncryptConfigMap([]byte("short"), "routes", "cm", "default", document); err == nil {
+		t.Error("expected an error for an invalid key size")
+	}
+}
+
+func TestDecryptConfigMapVersion1(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	document := []byte(`{"version":1,"hosts":{}}`)
+	aad := configMapAAD("routes", "customrouter-routes-default-0", "default")
+
+	// Version 1 sealed with the key itself.
+	aead, err := newConfigMapAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := bytes.Repeat([]byte{7}, aead.NonceSize())
+	sealed := append([]byte{encryptionVersionV1}, nonce...)
+	sealed = aead.Seal(sealed, nonce, document, aad)
+
+	got, err := DecryptConfigMap(key, "routes", "customrouter-routes-default-0", "default", sealed)
+	if err != nil || !bytes.Equal(got, document) {
+		t.Errorf("DecryptConfigMap(version 1) = %q, %v; want the document", got, err)
+	}
+
+	// Version 2 seals with a subkey, not with the key itself.
+	sealed, err = EncryptConfigMap(key, "routes", "customrouter-routes-default-0", "default", document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed[0] != encryptionVersion {
+		t.Fatalf("version = %d, want %d", sealed[0], encryptionVersion)
+	}
+	if _, err := aead.Open(nil, sealed[1:1+aead.NonceSize()], sealed[1+aead.NonceSize():], aad); err == nil {
+		t.Error("version 2 document opens with the raw key, want a derived AES key")
+	}
+}
+
+func TestConfigMapRoutesDataEncrypted(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	document := `{"version":1,"hosts":{"a.example.com":[]}}`
+	compressed, err := CompressRoutesDocument([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, stored := range map[string][]byte{"plain": []byte(document), "compressed": compressed} {
+		t.Run(name, func(t *testing.T) {
+			cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      "customrouter-routes-default-0",
+				Namespace: "routes",
+				Labels:    map[string]string{configMapTargetLabel: "default"},
+			}}
+			sealed, err := EncryptConfigMap(key, cm.Namespace, cm.Name, "default", stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cm.BinaryData = map[string][]byte{EncryptedRoutesDataKey: sealed}
+
+			if _, _, err := ConfigMapRoutesData(cm, nil); !errors.Is(err, ErrRoutesEncrypted) {
+				t.Errorf("ConfigMapRoutesData() without a key error = %v, want ErrRoutesEncrypted", err)
+			}
+			data, ok, err := ConfigMapRoutesData(cm, key)
+			if err != nil || !ok || data != document {
+				t.Errorf("ConfigMapRoutesData() = %q, %v, %v; want the document", data, ok, err)
+			}
+		})
+	}
+}
+
+func TestReadEncryptionKey(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	raw := "0123456789abcdef0123456789abcdef"
+	encoded := base64.StdEncoding.EncodeToString([]byte(raw))
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"raw", raw + "\n", raw},
+		{"base64", "  " + encoded + "\n", raw},
+		{"too short", "secret", ""},
+		{"empty", "\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ReadEncryptionKey(write(tt.name, tt.content))
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("ReadEncryptionKey() = %q, want an error", key)
+				}
+				return
+			}
+			if err != nil || string(key) != tt.want {
+				t.Errorf("ReadEncryptionKey() = %q, %v; want %q", key, err, tt.want)
+			}
+		})
+	}
+	if _, err := ReadEncryptionKey(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/freepik-company/customrouter/api/v1alpha1"
 )
@@ -30,11 +31,44 @@ const (
 	MaxRoutesPerCRD = 500_000
 )
 
+// Warning is a non-fatal issue found while expanding a CustomHTTPRoute: its
+// routes were generated, but do not reflect all of its spec.
+type Warning struct {
+	// Field is the path of the spec field the warning is about, e.g.
+	// "rules[1].backendRefs".
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// String formats the warning the way the CustomHTTPRoute status lists it.
+func (w Warning) String() string {
+	return w.Field + ": " + w.Message
+}
+
 // ExpandRoutes expands a CustomHTTPRoute into a list of routes per host.
 // It caps the total number of generated routes to MaxRoutesPerCRD to prevent
-// resource exhaustion from overly large CRDs.
+// resource exhaustion from overly large CRDs. Disabled rules, and every rule
+// of a disabled route, are left out. Hostname aliases get the routes of their
+// canonical hostname, or a single redirect route to it. An enabled
+// spec.maintenance adds maintenance routes in front of them.
 func ExpandRoutes(cr *v1alpha1.CustomHTTPRoute, externalNames map[string]string) (map[string][]Route, error) {
+	hosts, _, err := ExpandRoutesWithWarnings(cr, externalNames)
+	return hosts, err
+}
+
+// ExpandRoutesWithWarnings is ExpandRoutes that also returns, in spec order,
+// the warnings about what of the spec the routes leave out. Warnings never
+// fail the expansion.
+func ExpandRoutesWithWarnings(
+	cr *v1alpha1.CustomHTTPRoute,
+	externalNames map[string]string,
+) (map[string][]Route, []Warning, error) {
 	hosts := make(map[string][]Route)
+	// A disabled route contributes nothing, not even the fallback route of
+	// its unmatchedRequestPolicy.
+	if !cr.Spec.IsEnabled() {
+		return hosts, nil, nil
+	}
 
 	numPrefixes := 0
 	if cr.Spec.PathPrefixes != nil {
@@ -42,31 +76,211 @@ func ExpandRoutes(cr *v1alpha1.CustomHTTPRoute, externalNames map[string]string)
 	}
 	var totalMatches int
 	for _, rule := range cr.Spec.Rules {
-		totalMatches += len(rule.Matches)
+		totalMatches += len(rule.Matches) + len(rule.GRPCMatches)
 	}
 	multiplier := numPrefixes + 1
-	estimatedRoutes := len(cr.Spec.Hostnames) * totalMatches * multiplier
+	hostnames := cr.Spec.RoutedHostnames()
+	estimatedRoutes := len(hostnames) * totalMatches * multiplier
 	if estimatedRoutes > MaxRoutesPerCRD {
-		return nil, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"CustomHTTPRoute %s/%s would generate ~%d routes (limit %d): reduce hostnames, rules, matches, or prefixes",
 			cr.Namespace, cr.Name, estimatedRoutes, MaxRoutesPerCRD,
 		)
 	}
 
-	for _, hostname := range cr.Spec.Hostnames {
+	overrideHeader, overrides, overrideProtocols := buildOverrides(cr.Spec.OverrideHeader, externalNames)
+	decisionHeaders := ConvertDecisionHeadersMode(cr.Spec.DecisionHeaders)
+	unmatchedPolicy := ConvertUnmatchedRequestPolicy(cr.Spec.UnmatchedRequestPolicy)
+	scrubHeaders := ConvertScrubHeaders(cr.Spec.ScrubHeaders)
+	// Iterate every rule rather than ActiveRules so SourceRule indexes
+	// spec.rules as written.
+	rules := cr.Spec.EffectiveRules()
+
+	for _, hostname := range hostnames {
 		var routes []Route
 
-		for _, rule := range cr.Spec.Rules {
-			ruleRoutes := expandRule(cr.Spec.PathPrefixes, &rule, externalNames)
+		for i := range rules {
+			if !rules[i].IsEnabled() {
+				continue
+			}
+			ruleRoutes := expandRule(cr.Spec.PathPrefixes, &rules[i], externalNames)
+			sourceRule := fmt.Sprintf("rules[%d]", i)
+			for j := range ruleRoutes {
+				ruleRoutes[j].SourceRule = sourceRule
+				ruleRoutes[j].Owner = rules[i].Owner
+				ruleRoutes[j].Description = rules[i].Description
+			}
 			routes = append(routes, ruleRoutes...)
 		}
+		applyOverrides(routes, overrideHeader, overrides, overrideProtocols)
+		if decisionHeaders != "" {
+			for i := range routes {
+				routes[i].DecisionHeaders = decisionHeaders
+			}
+		}
+		if unmatchedPolicy != "" {
+			route := unmatchedRoute(unmatchedPolicy)
+			route.SourceRule = "unmatchedRequestPolicy"
+			routes = append(routes, route)
+		}
+		if cr.Spec.Precedence != 0 {
+			for i := range routes {
+				routes[i].Precedence = cr.Spec.Precedence
+			}
+		}
+		if len(scrubHeaders) > 0 {
+			for i := range routes {
+				routes[i].ScrubHeaders = scrubHeaders
+			}
+		}
 
 		SortRoutes(routes)
 
 		hosts[hostname] = routes
 	}
 
-	return hosts, nil
+	for i, alias := range cr.Spec.HostnameAliases {
+		if alias.Redirect {
+			route := aliasRedirectRoute(alias.Canonical)
+			route.Precedence = cr.Spec.Precedence
+			route.SourceRule = fmt.Sprintf("hostnameAliases[%d]", i)
+			hosts[alias.Hostname] = []Route{route}
+		}
+	}
+
+	if maintenance := convertMaintenance(cr.Spec.Maintenance); maintenance != nil {
+		for _, hostname := range cr.Spec.MaintenanceHostnames() {
+			routes := maintenanceRoutes(maintenance, cr.Spec.Maintenance.Paths)
+			for i := range routes {
+				routes[i].Precedence = cr.Spec.Precedence
+				routes[i].SourceRule = "maintenance"
+			}
+			routes = append(routes, hosts[hostname]...)
+			SortRoutes(routes)
+			hosts[hostname] = routes
+		}
+	}
+
+	documentRoutes(hosts, cr.Spec.Owner, cr.Spec.Description)
+	if cr.Spec.Variant != "" {
+		for _, hostRoutes := range hosts {
+			for i := range hostRoutes {
+				hostRoutes[i].Variant = cr.Spec.Variant
+			}
+		}
+	}
+
+	return hosts, expansionWarnings(cr), nil
+}
+
+// documentRoutes gives the routes whose rule sets no owner or description
+// those of their CustomHTTPRoute.
+func documentRoutes(hosts map[string][]Route, owner, description string) {
+	if owner == "" && description == "" {
+		return
+	}
+	for _, hostRoutes := range hosts {
+		for i := range hostRoutes {
+			if hostRoutes[i].Owner == "" {
+				hostRoutes[i].Owner = owner
+			}
+			if hostRoutes[i].Description == "" {
+				hostRoutes[i].Description = description
+			}
+		}
+	}
+}
+
+// expansionWarnings returns the warnings about the active rules of cr.
+func expansionWarnings(cr *v1alpha1.CustomHTTPRoute) []Warning {
+	var warnings []Warning
+	defaultsWarned := false
+	for i, rule := range cr.Spec.EffectiveRules() {
+		if !rule.IsEnabled() || len(rule.BackendRefs) < 2 || rule.BackendFailover != nil {
+			continue
+		}
+		// Rules without backendRefs of their own get those of defaults,
+		// which are only reported once.
+		field := fmt.Sprintf("rules[%d].backendRefs", i)
+		if len(cr.Spec.Rules[i].BackendRefs) == 0 {
+			if defaultsWarned {
+				continue
+			}
+			field, defaultsWarned = "defaults.backendRefs", true
+		}
+		warnings = append(warnings, Warning{
+			Field: field,
+			Message: fmt.Sprintf("only the first of %d backendRefs receives traffic, the others are ignored",
+				len(rule.BackendRefs)),
+		})
+	}
+	return warnings
+}
+
+// buildOverrides converts spec.overrideHeader into the lowercased header name,
+// the variant-to-backend map carried by each route and the protocols of the
+// variant backends that set one.
+func buildOverrides(
+	cfg *v1alpha1.OverrideHeader,
+	externalNames map[string]string,
+) (string, map[string]string, map[string]string) {
+	if cfg == nil || len(cfg.Variants) == 0 {
+		return "", nil, nil
+	}
+	header := cfg.Name
+	if header == "" {
+		header = v1alpha1.DefaultOverrideHeaderName
+	}
+	overrides := make(map[string]string, len(cfg.Variants))
+	var protocols map[string]string
+	for _, v := range cfg.Variants {
+		backend := buildBackendString([]v1alpha1.BackendRef{v.BackendRef}, externalNames)
+		overrides[v.Name] = backend
+		protocols = addBackendProtocol(protocols, backend, v.BackendRef.Protocol)
+	}
+	return strings.ToLower(header), overrides, protocols
+}
+
+// applyOverrides attaches the override header and variants to every route
+// that forwards to a backend. Redirect-only routes have no backend to
+// override and are left untouched.
+func applyOverrides(routes []Route, header string, overrides, protocols map[string]string) {
+	if header == "" {
+		return
+	}
+	for i := range routes {
+		if routes[i].Backend == "" {
+			continue
+		}
+		routes[i].OverrideHeader = header
+		routes[i].Overrides = overrides
+		if len(protocols) > 0 {
+			merged := make(map[string]string, len(routes[i].BackendProtocols)+len(protocols))
+			for backend, protocol := range protocols {
+				merged[backend] = protocol
+			}
+			for backend, protocol := range routes[i].BackendProtocols {
+				merged[backend] = protocol
+			}
+			routes[i].BackendProtocols = merged
+		}
+	}
+}
+
+// addBackendProtocol records protocol for backend in protocols, allocating
+// it on first use. Empty backends and protocols are ignored; the first
+// protocol recorded for a backend is kept.
+func addBackendProtocol(protocols map[string]string, backend, protocol string) map[string]string {
+	if backend == "" || protocol == "" {
+		return protocols
+	}
+	if protocols == nil {
+		protocols = make(map[string]string)
+	}
+	if _, ok := protocols[backend]; !ok {
+		protocols[backend] = protocol
+	}
+	return protocols
 }
 
 // expandRule expands a single rule into multiple routes based on path prefixes
@@ -88,24 +302,33 @@ func expandRule(specPrefixes *v1alpha1.PathPrefixes, rule *v1alpha1.Rule, extern
 
 	for _, match := range rule.Matches {
 		matchType := getMatchType(match.Type)
-		priority := getEffectivePriority(match.Priority)
+		priority := EffectivePriority(match.Type, match.Priority)
 
 		shouldExpand := ShouldExpandMatchType(match.Type, expandTypes)
 
 		method := string(match.Method)
+		scheme := string(match.Scheme)
 		headers := convertHeaderMatches(match.Headers)
 		queryParams := convertQueryParamMatches(match.QueryParams)
+		fraction := convertFraction(match.Fraction)
 
 		if !shouldExpand {
+			path := match.Path
+			if match.Type != v1alpha1.MatchTypeRegex {
+				path = UnprefixedPath(path)
+			}
 			routes = append(routes, Route{
-				Path:        match.Path,
-				Type:        matchType,
-				Backend:     backend,
-				Priority:    priority,
-				Actions:     actions,
-				Method:      method,
-				Headers:     headers,
-				QueryParams: queryParams,
+				Path:            path,
+				Type:            matchType,
+				CaseInsensitive: match.CaseInsensitive,
+				Backend:         backend,
+				Priority:        priority,
+				Actions:         actions,
+				Method:          method,
+				Scheme:          scheme,
+				Headers:         headers,
+				QueryParams:     queryParams,
+				Fraction:        fraction,
 			})
 			continue
 		}
@@ -113,30 +336,37 @@ func expandRule(specPrefixes *v1alpha1.PathPrefixes, rule *v1alpha1.Rule, extern
 		if match.Type == v1alpha1.MatchTypeRegex {
 			expandedPath := ExpandRegexWithPrefixes(match.Path, prefixes, policy)
 			routes = append(routes, Route{
-				Path:        expandedPath,
-				Type:        matchType,
-				Backend:     backend,
-				Priority:    priority,
-				Actions:     actions,
-				Method:      method,
-				Headers:     headers,
-				QueryParams: queryParams,
+				Path:            expandedPath,
+				Type:            matchType,
+				CaseInsensitive: match.CaseInsensitive,
+				Backend:         backend,
+				Priority:        priority,
+				Actions:         actions,
+				Method:          method,
+				Scheme:          scheme,
+				Headers:         headers,
+				QueryParams:     queryParams,
+				Fraction:        fraction,
 			})
 			continue
 		}
 
-		// Exact and PathPrefix: expand by generating separate routes per prefix
+		// Exact and PathPrefix: expand by generating separate routes per prefix,
+		// either prepended or substituted at the {prefix} placeholder
 		switch policy {
 		case v1alpha1.PathPrefixPolicyDisabled:
 			routes = append(routes, Route{
-				Path:        match.Path,
-				Type:        matchType,
-				Backend:     backend,
-				Priority:    priority,
-				Actions:     actions,
-				Method:      method,
-				Headers:     headers,
-				QueryParams: queryParams,
+				Path:            UnprefixedPath(match.Path),
+				Type:            matchType,
+				CaseInsensitive: match.CaseInsensitive,
+				Backend:         backend,
+				Priority:        priority,
+				Actions:         actions,
+				Method:          method,
+				Scheme:          scheme,
+				Headers:         headers,
+				QueryParams:     queryParams,
+				Fraction:        fraction,
 			})
 
 		case v1alpha1.PathPrefixPolicyRequired:
@@ -147,14 +377,17 @@ func expandRule(specPrefixes *v1alpha1.PathPrefixes, rule *v1alpha1.Rule, extern
 					prefixedActions = applyPreservePrefix(actions, prefix)
 				}
 				routes = append(routes, Route{
-					Path:        prefixPath(prefix, match.Path),
-					Type:        matchType,
-					Backend:     backend,
-					Priority:    priority,
-					Actions:     prefixedActions,
-					Method:      method,
-					Headers:     headers,
-					QueryParams: queryParams,
+					Path:            PrefixPath(prefix, match.Path),
+					Type:            matchType,
+					CaseInsensitive: match.CaseInsensitive,
+					Backend:         backend,
+					Priority:        priority,
+					Actions:         prefixedActions,
+					Method:          method,
+					Scheme:          scheme,
+					Headers:         headers,
+					QueryParams:     queryParams,
+					Fraction:        fraction,
 				})
 			}
 
@@ -166,29 +399,51 @@ func expandRule(specPrefixes *v1alpha1.PathPrefixes, rule *v1alpha1.Rule, extern
 					prefixedActions = applyPreservePrefix(actions, prefix)
 				}
 				routes = append(routes, Route{
-					Path:        prefixPath(prefix, match.Path),
-					Type:        matchType,
-					Backend:     backend,
-					Priority:    priority,
-					Actions:     prefixedActions,
-					Method:      method,
-					Headers:     headers,
-					QueryParams: queryParams,
+					Path:            PrefixPath(prefix, match.Path),
+					Type:            matchType,
+					CaseInsensitive: match.CaseInsensitive,
+					Backend:         backend,
+					Priority:        priority,
+					Actions:         prefixedActions,
+					Method:          method,
+					Scheme:          scheme,
+					Headers:         headers,
+					QueryParams:     queryParams,
+					Fraction:        fraction,
 				})
 			}
 			routes = append(routes, Route{
-				Path:        match.Path,
-				Type:        matchType,
-				Backend:     backend,
-				Priority:    priority,
-				Actions:     actions,
-				Method:      method,
-				Headers:     headers,
-				QueryParams: queryParams,
+				Path:            UnprefixedPath(match.Path),
+				Type:            matchType,
+				CaseInsensitive: match.CaseInsensitive,
+				Backend:         backend,
+				Priority:        priority,
+				Actions:         actions,
+				Method:          method,
+				Scheme:          scheme,
+				Headers:         headers,
+				QueryParams:     queryParams,
+				Fraction:        fraction,
 			})
 		}
 	}
 
+	// gRPC matches are never prefixed: a gRPC path is always
+	// "/<service>/<method>".
+	for _, grpcMatch := range rule.GRPCMatches {
+		match := grpcMatch.PathMatch()
+		routes = append(routes, Route{
+			Path:     match.Path,
+			Type:     getMatchType(match.Type),
+			Backend:  backend,
+			Priority: EffectivePriority(match.Type, match.Priority),
+			Actions:  actions,
+			Method:   string(match.Method),
+			Headers:  convertHeaderMatches(match.Headers),
+			GRPC:     true,
+		})
+	}
+
 	if len(mirrors) > 0 {
 		for i := range routes {
 			routes[i].Mirrors = mirrors
@@ -199,21 +454,158 @@ func expandRule(specPrefixes *v1alpha1.PathPrefixes, rule *v1alpha1.Rule, extern
 			routes[i].CORS = cors
 		}
 	}
+	if rule.ProtocolHints != "" {
+		for i := range routes {
+			routes[i].ProtocolHint = string(rule.ProtocolHints)
+		}
+	}
+	if hashPolicy := convertHashPolicy(rule.HashPolicy); hashPolicy != nil {
+		for i := range routes {
+			routes[i].HashPolicy = hashPolicy
+		}
+	}
+	// Redirect-only routes have no backend to eject.
+	if outlier := convertOutlierPolicy(rule.OutlierPolicy, externalNames); outlier != nil {
+		for i := range routes {
+			if routes[i].Backend != "" {
+				routes[i].Outlier = outlier
+			}
+		}
+	}
+	if failover := convertBackendFailover(rule, externalNames); failover != nil {
+		for i := range routes {
+			if routes[i].Backend != "" {
+				routes[i].Failover = failover
+			}
+		}
+	}
+	// Redirect-only routes never forward a body.
+	if rule.MaxRequestBytes != nil {
+		for i := range routes {
+			if routes[i].Backend != "" {
+				routes[i].MaxRequestBytes = *rule.MaxRequestBytes
+			}
+		}
+	}
+	if rule.ActionOrder == v1alpha1.ActionOrderSequential {
+		for i := range routes {
+			routes[i].SequentialActions = true
+		}
+	}
+	if rule.ExpiresAt != nil {
+		expiresAt := rule.ExpiresAt.UTC()
+		for i := range routes {
+			routes[i].ExpiresAt = &expiresAt
+		}
+	}
+	if protocols := ruleBackendProtocols(rule, externalNames); protocols != nil {
+		for i := range routes {
+			if routes[i].Backend != "" {
+				routes[i].BackendProtocols = protocols
+			}
+		}
+	}
 
 	return routes
 }
 
-// prefixPath prepends a language prefix to a path, avoiding double slashes.
+// PrefixPlaceholder marks where a path prefix is substituted inside a match
+// path, e.g. "/app/{prefix}/settings". Without it, prefixes are prepended.
+const PrefixPlaceholder = "{prefix}"
+
+// PrefixPath applies a language prefix to a path, avoiding double slashes.
+// When the path contains PrefixPlaceholder, the prefix is substituted at the
+// placeholder location instead of being prepended.
 // For path "/", it returns "/<prefix>" instead of "/<prefix>/".
-func prefixPath(prefix, path string) string {
+func PrefixPath(prefix, path string) string {
+	if strings.Contains(path, PrefixPlaceholder) {
+		return strings.ReplaceAll(path, PrefixPlaceholder, prefix)
+	}
 	if path == "/" {
 		return "/" + prefix
 	}
 	return "/" + prefix + path
 }
 
+// UnprefixedPath returns the path used for the unprefixed variant of a match.
+// Paths without PrefixPlaceholder are returned unchanged; otherwise the
+// placeholder segment is dropped, so "/app/{prefix}/settings" becomes
+// "/app/settings" and "/{prefix}" becomes "/".
+func UnprefixedPath(path string) string {
+	if !strings.Contains(path, PrefixPlaceholder) {
+		return path
+	}
+	out := strings.ReplaceAll(path, "/"+PrefixPlaceholder, "")
+	out = strings.ReplaceAll(out, PrefixPlaceholder, "")
+	if out == "" {
+		return "/"
+	}
+	return out
+}
+
+// ConvertDecisionHeadersMode maps the CRD decisionHeaders value to its
+// runtime form. Empty (unset) stays empty.
+func ConvertDecisionHeadersMode(mode v1alpha1.DecisionHeadersMode) string {
+	switch mode {
+	case v1alpha1.DecisionHeadersAlways:
+		return DecisionHeadersAlways
+	case v1alpha1.DecisionHeadersNever:
+		return DecisionHeadersNever
+	case v1alpha1.DecisionHeadersOnDebug:
+		return DecisionHeadersOnDebug
+	}
+	return ""
+}
+
+// ConvertUnmatchedRequestPolicy maps the CRD unmatchedRequestPolicy value to
+// its runtime form. Empty (unset) stays empty.
+func ConvertUnmatchedRequestPolicy(policy v1alpha1.UnmatchedRequestPolicy) string {
+	switch policy {
+	case v1alpha1.UnmatchedRequestPassthrough:
+		return UnmatchedPassthrough
+	case v1alpha1.UnmatchedRequestNotFound:
+		return UnmatchedNotFound
+	case v1alpha1.UnmatchedRequestServiceUnavailable:
+		return UnmatchedServiceUnavailable
+	}
+	return ""
+}
+
+// unmatchedRoute returns the fallback route carrying a hostname's unmatched
+// request policy. Priority 0 is below the priority any rule can have, and a
+// "/" prefix matches every request, so it is only reached on a miss.
+func unmatchedRoute(policy string) Route {
+	return Route{
+		Path:            "/",
+		Type:            RouteTypePrefix,
+		Priority:        0,
+		UnmatchedPolicy: policy,
+	}
+}
+
+// aliasRedirectPriority is the priority of the route of a redirecting
+// hostname alias: the highest a rule can set, so the canonicalization
+// redirect wins over routes other CustomHTTPRoutes declare for the alias.
+const aliasRedirectPriority = 10000
+
+// aliasRedirectRoute returns the route of a redirecting hostname alias: it
+// answers every request with a 301 to the same path and query on canonical.
+func aliasRedirectRoute(canonical string) Route {
+	return Route{
+		Path:     "/",
+		Type:     RouteTypePrefix,
+		Priority: aliasRedirectPriority,
+		Actions: []RouteAction{{
+			Type:               ActionTypeRedirect,
+			RedirectHostname:   canonical,
+			RedirectStatusCode: 301,
+		}},
+	}
+}
+
 // convertHeaderMatches converts API HeaderMatch entries to runtime RouteHeaderMatch.
-// The Type field is normalized to the runtime constants (Exact → "", Regex → "regex").
+// The Type field is normalized to the runtime constants (Exact → "", Regex → "regex",
+// Exists → "exists", Absent → "absent", NotValue → "not-value").
 func convertHeaderMatches(apiHeaders []v1alpha1.HeaderMatch) []RouteHeaderMatch {
 	if len(apiHeaders) == 0 {
 		return nil
@@ -224,8 +616,15 @@ func convertHeaderMatches(apiHeaders []v1alpha1.HeaderMatch) []RouteHeaderMatch
 			Name:  h.Name,
 			Value: h.Value,
 		}
-		if h.Type == v1alpha1.HeaderMatchTypeRegularExpression {
+		switch h.Type {
+		case v1alpha1.HeaderMatchTypeRegularExpression:
 			out[i].Type = HeaderMatchRegex
+		case v1alpha1.HeaderMatchTypeExists:
+			out[i].Type = HeaderMatchExists
+		case v1alpha1.HeaderMatchTypeAbsent:
+			out[i].Type = HeaderMatchAbsent
+		case v1alpha1.HeaderMatchTypeNotValue:
+			out[i].Type = HeaderMatchNotValue
 		}
 	}
 	return out
@@ -251,6 +650,110 @@ func convertQueryParamMatches(apiParams []v1alpha1.QueryParamMatch) []RouteQuery
 	return out
 }
 
+// convertFraction converts an API fraction to a route fraction, applying the
+// default denominator.
+func convertFraction(f *v1alpha1.Fraction) *RouteFraction {
+	if f == nil {
+		return nil
+	}
+	return &RouteFraction{
+		Numerator:   f.Numerator,
+		Denominator: f.EffectiveDenominator(),
+	}
+}
+
+// Defaults of the optional outlierPolicy fields.
+const (
+	DefaultOutlierErrorRatePercent = 50
+	DefaultOutlierMinRequests      = 10
+	DefaultOutlierInterval         = 30 * time.Second
+	DefaultOutlierEjectionTime     = 30 * time.Second
+)
+
+// convertOutlierPolicy converts an API outlier policy to a route outlier
+// policy, applying the defaults. The fallback backend is resolved the same
+// way as rule backends.
+func convertOutlierPolicy(p *v1alpha1.OutlierPolicy, externalNames map[string]string) *RouteOutlier {
+	if p == nil {
+		return nil
+	}
+	outlier := &RouteOutlier{
+		FallbackBackend:  buildBackendString([]v1alpha1.BackendRef{p.FallbackBackendRef}, externalNames),
+		ErrorRatePercent: DefaultOutlierErrorRatePercent,
+		MinRequests:      DefaultOutlierMinRequests,
+		IntervalMs:       DefaultOutlierInterval.Milliseconds(),
+		EjectionMs:       DefaultOutlierEjectionTime.Milliseconds(),
+	}
+	if p.ErrorRatePercent > 0 {
+		outlier.ErrorRatePercent = p.ErrorRatePercent
+	}
+	if p.MinRequests > 0 {
+		outlier.MinRequests = p.MinRequests
+	}
+	if d, err := time.ParseDuration(p.Interval); err == nil && d > 0 {
+		outlier.IntervalMs = d.Milliseconds()
+	}
+	if d, err := time.ParseDuration(p.EjectionTime); err == nil && d > 0 {
+		outlier.EjectionMs = d.Milliseconds()
+	}
+	return outlier
+}
+
+// convertHashPolicy converts an API hash policy to a route hash policy.
+func convertHashPolicy(p *v1alpha1.HashPolicy) *RouteHashPolicy {
+	if p == nil {
+		return nil
+	}
+	out := &RouteHashPolicy{Header: p.Header}
+	if c := p.Cookie; c != nil {
+		out.CookieName = c.Name
+		out.CookiePath = c.Path
+		if d, err := time.ParseDuration(c.TTL); err == nil && d > 0 {
+			out.CookieTTL = d
+		}
+	}
+	return out
+}
+
+// convertBackendFailover converts the backendFailover of rule to the
+// fallback chain of its routes, applying the outlierPolicy defaults to the
+// thresholds of the Responses signal. The backendRefs are resolved the same
+// way as the rule backend, which is the first of the chain.
+func convertBackendFailover(rule *v1alpha1.Rule, externalNames map[string]string) *RouteFailover {
+	f := rule.BackendFailover
+	if f == nil || len(rule.BackendRefs) < 2 {
+		return nil
+	}
+	failover := &RouteFailover{
+		Backends: make([]string, len(rule.BackendRefs)),
+		Signal:   FailoverSignalEndpoints,
+	}
+	for i := range rule.BackendRefs {
+		failover.Backends[i] = buildBackendString(rule.BackendRefs[i:i+1], externalNames)
+	}
+	if f.HealthSignal != v1alpha1.BackendHealthResponses {
+		return failover
+	}
+	failover.Signal = FailoverSignalResponses
+	failover.ErrorRatePercent = DefaultOutlierErrorRatePercent
+	failover.MinRequests = DefaultOutlierMinRequests
+	failover.IntervalMs = DefaultOutlierInterval.Milliseconds()
+	failover.EjectionMs = DefaultOutlierEjectionTime.Milliseconds()
+	if f.ErrorRatePercent > 0 {
+		failover.ErrorRatePercent = f.ErrorRatePercent
+	}
+	if f.MinRequests > 0 {
+		failover.MinRequests = f.MinRequests
+	}
+	if d, err := time.ParseDuration(f.Interval); err == nil && d > 0 {
+		failover.IntervalMs = d.Milliseconds()
+	}
+	if d, err := time.ParseDuration(f.EjectionTime); err == nil && d > 0 {
+		failover.EjectionMs = d.Milliseconds()
+	}
+	return failover
+}
+
 // convertActions converts API actions to route actions. Mirror and CORS
 // actions are intentionally excluded — they are dispatched natively by Envoy,
 // and carrying them through the ConfigMap would bloat the ExtProc hot path
@@ -273,7 +776,11 @@ func convertActions(apiActions []v1alpha1.Action) []RouteAction {
 		switch a.Type {
 		case v1alpha1.ActionTypeRedirect:
 			if a.Redirect != nil {
-				action.RedirectScheme = a.Redirect.Scheme
+				// An empty scheme already keeps the request's.
+				if a.Redirect.Scheme != v1alpha1.RedirectSchemePreserve {
+					action.RedirectScheme = a.Redirect.Scheme
+				}
+				action.RedirectAltSvc = a.Redirect.AltSvc
 				action.RedirectHostname = a.Redirect.Hostname
 				action.RedirectPath = a.Redirect.Path
 				if a.Redirect.Port != nil {
@@ -284,6 +791,9 @@ func convertActions(apiActions []v1alpha1.Action) []RouteAction {
 					action.RedirectStatusCode = 302
 				}
 				action.RedirectReplacePrefixMatch = a.Redirect.ReplacePrefixMatch
+				if a.Redirect.PreservePort != nil && !*a.Redirect.PreservePort {
+					action.RedirectStripPort = true
+				}
 				if a.Redirect.PreservePrefix != nil && *a.Redirect.PreservePrefix {
 					action.preservePrefix = true
 				}
@@ -291,6 +801,7 @@ func convertActions(apiActions []v1alpha1.Action) []RouteAction {
 		case v1alpha1.ActionTypeRewrite:
 			if a.Rewrite != nil {
 				action.RewritePath = a.Rewrite.Path
+				action.RewriteSegments = convertRewriteSegments(a.Rewrite.Segments)
 				action.RewriteHostname = a.Rewrite.Hostname
 				action.RewriteReplacePrefixMatch = a.Rewrite.ReplacePrefixMatch
 				if a.Rewrite.PreservePrefix != nil && *a.Rewrite.PreservePrefix {
@@ -305,6 +816,25 @@ func convertActions(apiActions []v1alpha1.Action) []RouteAction {
 			}
 		case v1alpha1.ActionTypeHeaderRemove, v1alpha1.ActionTypeResponseHeaderRemove:
 			action.HeaderName = a.HeaderName
+		case v1alpha1.ActionTypeRequireAuth:
+			if a.Auth != nil {
+				action.AuthURL = buildAuthURL(a.Auth)
+				action.AuthForwardHeaders = a.Auth.ForwardHeaders
+				if len(action.AuthForwardHeaders) == 0 {
+					action.AuthForwardHeaders = DefaultAuthForwardHeaders
+				}
+				action.AuthUpstreamHeaders = a.Auth.UpstreamHeaders
+				action.AuthTimeoutMs = DefaultAuthTimeout.Milliseconds()
+				if d, err := time.ParseDuration(a.Auth.Timeout); err == nil && d > 0 {
+					action.AuthTimeoutMs = d.Milliseconds()
+				}
+				action.AuthFailOpen = a.Auth.FailOpen
+			}
+		case v1alpha1.ActionTypeDenyUpgrade:
+			action.UpgradeStatusCode = a.UpgradeStatusCode
+			if action.UpgradeStatusCode == 0 {
+				action.UpgradeStatusCode = DefaultUpgradeStatusCode
+			}
 		}
 
 		actions = append(actions, action)
@@ -366,6 +896,22 @@ func actionsNeedPreservePrefix(actions []RouteAction) bool {
 	return false
 }
 
+// convertRewriteSegments maps the CRD rewrite.segments to their runtime
+// form, keyed by segment index. Keys that are not a segment index, which
+// validation rejects, are dropped.
+func convertRewriteSegments(segments map[string]string) map[int]string {
+	if len(segments) == 0 {
+		return nil
+	}
+	converted := make(map[int]string, len(segments))
+	for key, value := range segments {
+		if index, err := v1alpha1.RewriteSegmentIndex(key); err == nil {
+			converted[index] = value
+		}
+	}
+	return converted
+}
+
 // applyPreservePrefix clones the actions slice and prepends the prefix to
 // rewrite/redirect paths for actions that have preservePrefix=true.
 func applyPreservePrefix(actions []RouteAction, prefix string) []RouteAction {
@@ -452,14 +998,6 @@ func getMatchType(t v1alpha1.MatchType) string {
 	}
 }
 
-// getEffectivePriority returns the priority to use, defaulting to DefaultPriority if not set
-func getEffectivePriority(priority int32) int32 {
-	if priority == 0 {
-		return v1alpha1.DefaultPriority
-	}
-	return priority
-}
-
 // buildBackendString builds the backend address from BackendRefs
 func buildBackendString(refs []v1alpha1.BackendRef, externalNames map[string]string) string {
 	if len(refs) == 0 {
@@ -467,63 +1005,166 @@ func buildBackendString(refs []v1alpha1.BackendRef, externalNames map[string]str
 	}
 	// For now, use the first backend ref
 	ref := refs[0]
-	// If the name contains a dot, treat it as an external hostname
-	// and don't append the .svc.cluster.local suffix
-	if strings.Contains(ref.Name, ".") {
-		return ref.Name + ":" + strconv.Itoa(int(ref.Port))
-	}
 	// Check if this is an ExternalName service
-	if externalNames != nil {
+	if externalNames != nil && !strings.Contains(ref.Name, ".") {
 		if extName, ok := externalNames[ref.Name+"/"+ref.Namespace]; ok {
 			return extName + ":" + strconv.Itoa(int(ref.Port))
 		}
 	}
+	return BackendAddress(ref)
+}
+
+// BackendAddress returns the "host:port" address of ref. A name containing a
+// dot is an external hostname and is used as is; any other name is a Service
+// of ref's namespace. Shared with the EnvoyFilter cluster names so the
+// controllers and the external processor agree on them.
+func BackendAddress(ref v1alpha1.BackendRef) string {
+	if strings.Contains(ref.Name, ".") {
+		return ref.Name + ":" + strconv.Itoa(int(ref.Port))
+	}
 	return ref.Name + "." + ref.Namespace + ".svc.cluster.local:" + strconv.Itoa(int(ref.Port))
 }
 
+// ruleBackendProtocols returns the protocols of the backend of rule and of
+// its outlier fallback, or nil when neither sets one. Only the first
+// backendRef is routed to, like in buildBackendString, unless the rule sets
+// backendFailover: then every backendRef of the chain is.
+func ruleBackendProtocols(rule *v1alpha1.Rule, externalNames map[string]string) map[string]string {
+	var protocols map[string]string
+	refs := rule.BackendRefs
+	if rule.BackendFailover == nil && len(refs) > 1 {
+		refs = refs[:1]
+	}
+	for i := range refs {
+		protocols = addBackendProtocol(protocols,
+			buildBackendString(refs[i:i+1], externalNames), refs[i].Protocol)
+	}
+	if p := rule.OutlierPolicy; p != nil {
+		protocols = addBackendProtocol(protocols,
+			buildBackendString([]v1alpha1.BackendRef{p.FallbackBackendRef}, externalNames), p.FallbackBackendRef.Protocol)
+	}
+	return protocols
+}
+
+// DefaultAuthForwardHeaders are the request headers sent to the authorization
+// service when a require-auth action does not list any.
+var DefaultAuthForwardHeaders = []string{"authorization", "cookie"}
+
+// DefaultAuthTimeout bounds the authorization request when a require-auth
+// action does not set a timeout.
+const DefaultAuthTimeout = time.Second
+
+// DefaultUpgradeStatusCode is the status a deny-upgrade action rejects
+// upgrade attempts with when it does not set upgradeStatusCode.
+const DefaultUpgradeStatusCode int32 = 400
+
+// buildAuthURL returns the URL the extproc calls to authorize a request. The
+// backend host is resolved the same way as rule backends, except that
+// ExternalName services are addressed through their in-cluster name.
+func buildAuthURL(cfg *v1alpha1.AuthConfig) string {
+	path := cfg.Path
+	if path == "" {
+		path = "/"
+	}
+	return "http://" + buildBackendString([]v1alpha1.BackendRef{cfg.BackendRef}, nil) + path
+}
+
 // typePriority defines the sort precedence of route types: exact > regex > prefix.
 var typePriority = map[string]int{RouteTypeExact: 0, RouteTypeRegex: 1, RouteTypePrefix: 2}
 
 // SortRoutes sorts routes by priority (descending), then by type, then by path
 // length. When those are tied, more specific request match constraints win:
-// method-constrained routes come before unconstrained routes, followed by
-// routes with more header matches and then more query param matches.
+// method-constrained routes come before unconstrained routes, then
+// scheme-constrained ones, followed by routes with more header matches, then more query param matches, then
+// routes restricted to a fraction of requests, then case-sensitive routes
+// before case-insensitive ones. Routes still tied are ordered
+// by Precedence (descending), then keep their input order. Routes of a
+// MostSpecific host are ordered by specificity before priority instead (see
+// mostSpecificLess).
 func SortRoutes(routes []Route) {
 	sort.SliceStable(routes, func(i, j int) bool {
-		// First by priority descending (higher priority first)
-		if routes[i].Priority != routes[j].Priority {
-			return routes[i].Priority > routes[j].Priority
-		}
+		return RouteLess(&routes[i], &routes[j])
+	})
+}
 
-		// Then by type priority: exact > regex > prefix
-		pi, pj := typePriority[routes[i].Type], typePriority[routes[j].Type]
-		if pi != pj {
-			return pi < pj
-		}
+// RouteLess reports whether route a is evaluated before route b: the order
+// SortRoutes sorts the routes of a host in.
+func RouteLess(a, b *Route) bool {
+	if a.MostSpecific && b.MostSpecific {
+		return mostSpecificLess(a, b)
+	}
 
-		// Then by path length descending (longer paths first)
-		if len(routes[i].Path) != len(routes[j].Path) {
-			return len(routes[i].Path) > len(routes[j].Path)
-		}
+	// First by priority descending (higher priority first)
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
 
-		// Then by method specificity: constrained routes before unconstrained routes
-		mi, mj := routeMethodSpecificity(routes[i]), routeMethodSpecificity(routes[j])
-		if mi != mj {
-			return mi > mj
-		}
+	if c := compareSpecificity(a, b); c != 0 {
+		return c < 0
+	}
 
-		// Then by header specificity: more header matches first
-		if len(routes[i].Headers) != len(routes[j].Headers) {
-			return len(routes[i].Headers) > len(routes[j].Headers)
-		}
+	// Then the routes of CustomHTTPRoutes with a higher precedence
+	if a.Precedence != b.Precedence {
+		return a.Precedence > b.Precedence
+	}
+
+	return false
+}
 
-		// Then by query param specificity: more query param matches first
-		if len(routes[i].QueryParams) != len(routes[j].QueryParams) {
-			return len(routes[i].QueryParams) > len(routes[j].QueryParams)
+// compareSpecificity returns -1 when route a is more specific than route b,
+// 1 when it is less specific, and 0 when neither is.
+func compareSpecificity(a, b *Route) int {
+	order := func(aFirst bool) int {
+		if aFirst {
+			return -1
 		}
+		return 1
+	}
 
-		return false
-	})
+	// By type priority: exact > regex > prefix
+	pi, pj := typePriority[a.Type], typePriority[b.Type]
+	if pi != pj {
+		return order(pi < pj)
+	}
+
+	// Then by path length descending (longer paths first)
+	if len(a.Path) != len(b.Path) {
+		return order(len(a.Path) > len(b.Path))
+	}
+
+	// Then by method specificity: constrained routes before unconstrained routes
+	mi, mj := routeMethodSpecificity(*a), routeMethodSpecificity(*b)
+	if mi != mj {
+		return order(mi > mj)
+	}
+
+	// Then scheme-constrained routes before the routes of any scheme
+	if si, sj := a.Scheme != "", b.Scheme != ""; si != sj {
+		return order(si)
+	}
+
+	// Then by header specificity: more header matches first
+	if len(a.Headers) != len(b.Headers) {
+		return order(len(a.Headers) > len(b.Headers))
+	}
+
+	// Then by query param specificity: more query param matches first
+	if len(a.QueryParams) != len(b.QueryParams) {
+		return order(len(a.QueryParams) > len(b.QueryParams))
+	}
+
+	// Then sampled routes before the unsampled ones they carve requests from
+	if fi, fj := a.Fraction != nil, b.Fraction != nil; fi != fj {
+		return order(fi)
+	}
+
+	// Then case-sensitive routes before the case-insensitive ones they carve
+	// requests from
+	if a.CaseInsensitive != b.CaseInsensitive {
+		return order(!a.CaseInsensitive)
+	}
+
+	return 0
 }
 
 // routeMethodSpecificity reports whether a route restricts the HTTP method.
@@ -536,7 +1177,9 @@ func routeMethodSpecificity(route Route) int {
 	return 1
 }
 
-// MergeRoutesConfig merges routes from multiple CustomHTTPRoutes into a single config
+// MergeRoutesConfig merges routes from multiple CustomHTTPRoutes into a single config.
+// Routes of a host that tie in SortRoutes are ordered by their Precedence,
+// then by the order of configs.
 func MergeRoutesConfig(configs ...map[string][]Route) *RoutesConfig {
 	result := &RoutesConfig{
 		Version: 1,
@@ -573,21 +1216,41 @@ func ExpandRegexWithPrefixes(pattern string, prefixes []string, policy v1alpha1.
 		return pattern
 	}
 
-	// Build the language alternation group
-	langGroup := "(" + strings.Join(prefixes, "|") + ")"
+	// Build the language alternation group. Prefix values are literals, so
+	// they are quoted to keep metacharacters (e.g. ".") from matching
+	// prefixes outside the configured list.
+	quoted := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		quoted[i] = regexp.QuoteMeta(p)
+	}
+	langGroup := "(" + strings.Join(quoted, "|") + ")"
 
 	// If the pattern contains {prefix}, substitute it inline
-	if strings.Contains(pattern, "{prefix}") {
+	if strings.Contains(pattern, PrefixPlaceholder) {
 		switch policy {
 		case v1alpha1.PathPrefixPolicyRequired:
-			return strings.ReplaceAll(pattern, "{prefix}", langGroup)
+			return strings.ReplaceAll(pattern, PrefixPlaceholder, langGroup)
 		case v1alpha1.PathPrefixPolicyOptional:
-			return strings.ReplaceAll(pattern, "{prefix}", langGroup+"?")
+			return strings.ReplaceAll(pattern, PrefixPlaceholder, langGroup+"?")
 		default:
 			return pattern
 		}
 	}
 
+	// A leading flag group such as (?i) applies to the whole pattern and
+	// must stay in front of it, so the prefix goes after the flags (and
+	// after a ^ the flags follow).
+	if flags, rest := splitLeadingFlags(pattern); flags != "" {
+		return flags + ExpandRegexWithPrefixes(rest, prefixes, policy)
+	}
+
+	// A top-level alternation (e.g. ^/a|^/b) cannot be handled by inserting
+	// the prefix in front of the first branch only: the remaining branches
+	// would still match unprefixed paths under the Required policy.
+	if branches := splitTopLevelAlternation(pattern); len(branches) > 1 {
+		return expandAlternationWithPrefixes(pattern, branches, langGroup, policy)
+	}
+
 	// Find where to insert the language prefix pattern
 	// We need to insert after ^ (if present) and before the first /
 	hasStartAnchor := strings.HasPrefix(pattern, "^")
@@ -628,6 +1291,112 @@ func ExpandRegexWithPrefixes(pattern string, prefixes []string, policy v1alpha1.
 	return result
 }
 
+// leadingFlagGroup matches an inline flag group, e.g. (?i) or (?s-U), at the
+// start of a pattern or right after its ^ anchor.
+var leadingFlagGroup = regexp.MustCompile(`^\^?(\(\?(?:[imsU]+(?:-[imsU]*)?|-[imsU]+)\))`)
+
+// splitLeadingFlags returns the leading inline flag group of pattern and the
+// pattern without it, or "" and pattern when it has none.
+func splitLeadingFlags(pattern string) (flags, rest string) {
+	m := leadingFlagGroup.FindStringSubmatchIndex(pattern)
+	if m == nil {
+		return "", pattern
+	}
+	return pattern[m[2]:m[3]], pattern[:m[2]] + pattern[m[3]:]
+}
+
+// expandAlternationWithPrefixes expands a pattern made of several top-level
+// branches by factoring the prefix pattern out in front of a non-capturing
+// group holding every branch. All branches must start with "/" (optionally
+// preceded by ^), and either all or none of them must be anchored; otherwise
+// the pattern is returned unchanged, mirroring the single-branch behavior.
+func expandAlternationWithPrefixes(pattern string, branches []string, langGroup string, policy v1alpha1.PathPrefixPolicy) string {
+	anchored := 0
+	stripped := make([]string, len(branches))
+	for i, b := range branches {
+		if strings.HasPrefix(b, "^") {
+			anchored++
+			b = b[1:]
+		}
+		if !strings.HasPrefix(b, "/") {
+			return pattern
+		}
+		stripped[i] = b
+	}
+	if anchored != 0 && anchored != len(branches) {
+		return pattern
+	}
+
+	var prefixPattern string
+	switch policy {
+	case v1alpha1.PathPrefixPolicyRequired:
+		prefixPattern = "/" + langGroup
+	case v1alpha1.PathPrefixPolicyOptional:
+		prefixPattern = "(?:/" + langGroup + ")?"
+	default:
+		return pattern
+	}
+
+	result := prefixPattern + "(?:" + strings.Join(stripped, "|") + ")"
+	if anchored > 0 {
+		result = "^" + result
+	}
+	return result
+}
+
+// splitTopLevelAlternation splits a regex into its top-level "|" branches.
+// Alternations nested inside groups, character classes, escapes and \Q...\E
+// quoted sections are left intact. A pattern without a top-level alternation
+// is returned as a single branch.
+func splitTopLevelAlternation(pattern string) []string {
+	var branches []string
+	depth := 0
+	inClass := false
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(pattern) && pattern[i+1] == 'Q' {
+				end := strings.Index(pattern[i+2:], `\E`)
+				if end < 0 {
+					i = len(pattern)
+				} else {
+					i += 2 + end + 1
+				}
+				continue
+			}
+			i++
+		case inClass:
+			if c == '[' && i+1 < len(pattern) && pattern[i+1] == ':' {
+				if end := strings.Index(pattern[i+2:], ":]"); end >= 0 {
+					i += 2 + end + 1
+				}
+			} else if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+			// A leading "]" (optionally after "^") is a literal, not the end
+			// of the class.
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '|' && depth == 0:
+			branches = append(branches, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(branches, pattern[start:])
+}
+
 // IsValidRegex checks if a regex pattern compiles successfully
 func IsValidRegex(pattern string) bool {
 	_, err := regexp.Compile(pattern)
@@ -0,0 +1,258 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// propertyPrefixes is the prefix list shared by the property tests. It mixes
+// plain language codes, full locales and a value containing a regex
+// metacharacter, which must be matched literally.
+var propertyPrefixes = []string{"es", "fr", "zh-CN", "v1.0"}
+
+// propertyPatterns are the seed patterns used by both the property tests and
+// the fuzz corpus. They cover anchors, nested groups, top-level alternation
+// and the inline {prefix} placeholder.
+var propertyPatterns = []string{
+	"^/users/[0-9]+$",
+	"^/products/(?P<id>[a-z0-9-]+)/reviews$",
+	"^/(users|accounts)/[0-9]+$",
+	"^/$",
+	"/api/v[0-9]+/",
+	"^/a$|^/b$",
+	"/a|/b",
+	"^/a|/b",
+	"^/x[|]y$|^/z$",
+	`^/\Q|\E/q$`,
+	"^/_app/data/[^/]+/{prefix}/",
+	"^/{prefix}/data/[^/]+/{prefix}/",
+	"api/v1",
+	"(?i)^/users/[0-9]+$",
+	"^(?i)/users/abc$",
+	"(?i)^/a$|^/b$",
+}
+
+// propertyPaths returns request paths exercising listed prefixes, unlisted
+// prefixes, prefix-like segments and unprefixed paths for the given suffixes.
+func propertyPaths(suffixes ...string) []string {
+	var paths []string
+	for _, s := range suffixes {
+		paths = append(paths, s)
+		for _, p := range append([]string{"de", "v1x0", "esx", "es/es"}, propertyPrefixes...) {
+			paths = append(paths, "/"+p+s)
+		}
+	}
+	return paths
+}
+
+// placeholderCompiles mirrors the CRD validation for {prefix} patterns: a
+// pattern is only admitted when both the Required and Optional substitutions
+// compile.
+func placeholderCompiles(pattern string) bool {
+	for _, group := range []string{"(test)", "(test)?"} {
+		if !IsValidRegex(strings.ReplaceAll(pattern, "{prefix}", group)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAnchoredExpansion reports whether the pattern goes through the anchored
+// insertion path of ExpandRegexWithPrefixes, where the matched set can be
+// described exactly in terms of the original pattern.
+func isAnchoredExpansion(pattern string) bool {
+	if strings.Contains(pattern, "{prefix}") {
+		return false
+	}
+	for _, b := range splitTopLevelAlternation(pattern) {
+		if !strings.HasPrefix(b, "^/") {
+			return false
+		}
+	}
+	return true
+}
+
+// checkExpansionProperties asserts the invariants of ExpandRegexWithPrefixes
+// for one pattern, prefix list and request path:
+//
+//   - every expansion of an admissible pattern compiles;
+//   - Disabled and empty prefix lists leave the pattern untouched;
+//   - Optional matches a superset of both Required and Disabled;
+//   - for anchored patterns, Required matches exactly the original pattern
+//     behind one of the listed prefixes, and Optional additionally matches
+//     the original pattern itself, so no unlisted prefix ever matches.
+func checkExpansionProperties(t *testing.T, pattern string, prefixes []string, path string) {
+	t.Helper()
+
+	if !placeholderCompiles(pattern) {
+		return
+	}
+	original := regexp.MustCompile(pattern)
+
+	expanded := map[v1alpha1.PathPrefixPolicy]*regexp.Regexp{}
+	for _, policy := range []v1alpha1.PathPrefixPolicy{
+		v1alpha1.PathPrefixPolicyOptional,
+		v1alpha1.PathPrefixPolicyRequired,
+		v1alpha1.PathPrefixPolicyDisabled,
+	} {
+		out := ExpandRegexWithPrefixes(pattern, prefixes, policy)
+		re, err := regexp.Compile(out)
+		if err != nil {
+			t.Fatalf("policy %s: expansion does not compile:\ninput:  %q\noutput: %q\nerror:  %v", policy, pattern, out, err)
+		}
+		if (policy == v1alpha1.PathPrefixPolicyDisabled || len(prefixes) == 0) && out != pattern {
+			t.Fatalf("policy %s with prefixes %q must not modify the pattern: %q -> %q", policy, prefixes, pattern, out)
+		}
+		expanded[policy] = re
+	}
+
+	optional := expanded[v1alpha1.PathPrefixPolicyOptional].MatchString(path)
+	required := expanded[v1alpha1.PathPrefixPolicyRequired].MatchString(path)
+	disabled := expanded[v1alpha1.PathPrefixPolicyDisabled].MatchString(path)
+
+	if required && !optional {
+		t.Fatalf("path %q matches Required but not Optional for %q (prefixes %q)", path, pattern, prefixes)
+	}
+	if disabled && !optional && !strings.Contains(pattern, "{prefix}") {
+		t.Fatalf("path %q matches Disabled but not Optional for %q (prefixes %q)", path, pattern, prefixes)
+	}
+
+	if len(prefixes) == 0 || !isAnchoredExpansion(pattern) {
+		return
+	}
+
+	behindPrefix := false
+	for _, p := range prefixes {
+		if rest, ok := strings.CutPrefix(path, "/"+p); ok && original.MatchString(rest) {
+			behindPrefix = true
+			break
+		}
+	}
+	if required != behindPrefix {
+		t.Fatalf("Required expansion of %q (prefixes %q) on %q: got match=%v, want %v", pattern, prefixes, path, required, behindPrefix)
+	}
+	if want := behindPrefix || original.MatchString(path); optional != want {
+		t.Fatalf("Optional expansion of %q (prefixes %q) on %q: got match=%v, want %v", pattern, prefixes, path, optional, want)
+	}
+}
+
+func TestExpandRegexWithPrefixesProperties(t *testing.T) {
+	suffixes := []string{"/", "/users/1", "/users/abc", "/accounts/2", "/products/p-1/reviews",
+		"/a", "/b", "/x|y", "/z", "/|/q", "/api/v2/", "/_app/data/id/es/x.json", "/es/data/id/fr/"}
+
+	for _, pattern := range propertyPatterns {
+		t.Run(pattern, func(t *testing.T) {
+			for _, path := range propertyPaths(suffixes...) {
+				checkExpansionProperties(t, pattern, propertyPrefixes, path)
+				checkExpansionProperties(t, pattern, nil, path)
+			}
+		})
+	}
+}
+
+func TestExpandRegexQuotesPrefixes(t *testing.T) {
+	expanded := ExpandRegexWithPrefixes("^/docs$", []string{"v1.0"}, v1alpha1.PathPrefixPolicyRequired)
+	if expected := `^/(v1\.0)/docs$`; expanded != expected {
+		t.Fatalf("expected %q, got %q", expected, expanded)
+	}
+	if matchesRegex(expanded, "/v1x0/docs") {
+		t.Errorf("expanded regex %q must not treat '.' in a prefix as a wildcard", expanded)
+	}
+}
+
+func TestExpandRegexTopLevelAlternation(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		policy   v1alpha1.PathPrefixPolicy
+		expected string
+	}{
+		{
+			name:     "anchored branches required",
+			input:    "^/a$|^/b$",
+			policy:   v1alpha1.PathPrefixPolicyRequired,
+			expected: "^/(es|fr)(?:/a$|/b$)",
+		},
+		{
+			name:     "anchored branches optional",
+			input:    "^/a$|^/b$",
+			policy:   v1alpha1.PathPrefixPolicyOptional,
+			expected: "^(?:/(es|fr))?(?:/a$|/b$)",
+		},
+		{
+			name:     "unanchored branches required",
+			input:    "/a|/b",
+			policy:   v1alpha1.PathPrefixPolicyRequired,
+			expected: "/(es|fr)(?:/a|/b)",
+		},
+		{
+			name:     "mixed anchors left unchanged",
+			input:    "^/a|/b",
+			policy:   v1alpha1.PathPrefixPolicyRequired,
+			expected: "^/a|/b",
+		},
+		{
+			name:     "branch not starting with slash left unchanged",
+			input:    "^/a|b",
+			policy:   v1alpha1.PathPrefixPolicyRequired,
+			expected: "^/a|b",
+		},
+		{
+			name:     "pipe inside character class is not an alternation",
+			input:    "^/x[|]y$",
+			policy:   v1alpha1.PathPrefixPolicyRequired,
+			expected: "^/(es|fr)/x[|]y$",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ExpandRegexWithPrefixes(tt.input, []string{"es", "fr"}, tt.policy)
+			if result != tt.expected {
+				t.Errorf("\ninput:    %s\nexpected: %s\ngot:      %s", tt.input, tt.expected, result)
+			}
+		})
+	}
+}
+
+func FuzzExpandRegexWithPrefixes(f *testing.F) {
+	for _, pattern := range propertyPatterns {
+		f.Add(pattern, "es", "v1.0", "/es/users/1")
+		f.Add(pattern, "fr", "", "/a")
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, prefixA, prefixB, path string) {
+		// Prefix values arrive through the Kubernetes API as JSON strings and
+		// are therefore always valid UTF-8.
+		var prefixes []string
+		for _, p := range []string{prefixA, prefixB} {
+			if !utf8.ValidString(p) {
+				return
+			}
+			if p != "" {
+				prefixes = append(prefixes, p)
+			}
+		}
+		checkExpansionProperties(t, pattern, prefixes, path)
+	})
+}
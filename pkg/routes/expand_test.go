@@ -1,9 +1,12 @@
 package routes
 
 import (
+	"encoding/json"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/freepik-company/customrouter/api/v1alpha1"
 )
@@ -344,6 +347,18 @@ func TestConvertActions(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "rewrite action with segments",
+			input: []v1alpha1.Action{
+				{
+					Type:    v1alpha1.ActionTypeRewrite,
+					Rewrite: &v1alpha1.RewriteConfig{Segments: map[string]string{"2": "v2", "4": "${path.segment.3}"}},
+				},
+			},
+			expected: []RouteAction{
+				{Type: "rewrite", RewriteSegments: map[int]string{2: "v2", 4: "${path.segment.3}"}},
+			},
+		},
 		{
 			name: "header-set action",
 			input: []v1alpha1.Action{
@@ -495,51 +510,764 @@ func TestExpandRoutesWithActions(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	routes, ok := result["example.com"]
-	if !ok {
-		t.Fatal("expected routes for example.com")
-	}
-
-	if len(routes) != 1 {
-		t.Fatalf("expected 1 route, got %d", len(routes))
-	}
-
-	route := routes[0]
-	if len(route.Actions) != 2 {
-		t.Fatalf("expected 2 actions, got %d", len(route.Actions))
-	}
-
-	if route.Actions[0].Type != "rewrite" || route.Actions[0].RewritePath != testPathCmsBlog {
-		t.Errorf("unexpected first action: %+v", route.Actions[0])
-	}
-
-	if route.Actions[1].Type != "header-set" || route.Actions[1].HeaderName != "X-Backend" {
-		t.Errorf("unexpected second action: %+v", route.Actions[1])
+	routes, ok := result["example.com"]
+	if !ok {
+		t.Fatal("expected routes for example.com")
+	}
+
+	if len(routes) != 1 {
+		t.Fatalf("expected 1 route, got %d", len(routes))
+	}
+
+	route := routes[0]
+	if len(route.Actions) != 2 {
+		t.Fatalf("expected 2 actions, got %d", len(route.Actions))
+	}
+
+	if route.Actions[0].Type != "rewrite" || route.Actions[0].RewritePath != testPathCmsBlog {
+		t.Errorf("unexpected first action: %+v", route.Actions[0])
+	}
+
+	if route.Actions[1].Type != "header-set" || route.Actions[1].HeaderName != "X-Backend" {
+		t.Errorf("unexpected second action: %+v", route.Actions[1])
+	}
+}
+
+func TestExpandRoutesWithRedirect(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches: []v1alpha1.PathMatch{
+						{Path: "/old-page", Type: v1alpha1.MatchTypeExact},
+					},
+					Actions: []v1alpha1.Action{
+						{
+							Type: v1alpha1.ActionTypeRedirect,
+							Redirect: &v1alpha1.RedirectConfig{
+								Path:       "/new-page",
+								StatusCode: 301,
+							},
+						},
+					},
+					BackendRefs: []v1alpha1.BackendRef{
+						{Name: "dummy", Namespace: "default", Port: 80},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	routes, ok := result["example.com"]
+	if !ok {
+		t.Fatal("expected routes for example.com")
+	}
+
+	if len(routes) != 1 {
+		t.Fatalf("expected 1 route, got %d", len(routes))
+	}
+
+	route := routes[0]
+	if len(route.Actions) != 1 {
+		t.Fatalf("expected 1 action, got %d", len(route.Actions))
+	}
+
+	action := route.Actions[0]
+	if action.Type != "redirect" {
+		t.Errorf("expected redirect action, got %s", action.Type)
+	}
+	if action.RedirectPath != "/new-page" {
+		t.Errorf("expected redirect path /new-page, got %s", action.RedirectPath)
+	}
+	if action.RedirectStatusCode != 301 {
+		t.Errorf("expected status 301, got %d", action.RedirectStatusCode)
+	}
+}
+
+func TestExpandRoutesWithOverrideHeader(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			OverrideHeader: &v1alpha1.OverrideHeader{
+				Variants: []v1alpha1.RouteVariant{
+					{Name: "alice", BackendRef: v1alpha1.BackendRef{Name: "api-alice", Namespace: "preview", Port: 8080}},
+					{Name: "legacy", BackendRef: v1alpha1.BackendRef{Name: "legacy-api", Namespace: "preview", Port: 80}},
+				},
+			},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+				},
+				{
+					Matches: []v1alpha1.PathMatch{{Path: "/old", Type: v1alpha1.MatchTypeExact}},
+					Actions: []v1alpha1.Action{{
+						Type:     v1alpha1.ActionTypeRedirect,
+						Redirect: &v1alpha1.RedirectConfig{Path: "/new"},
+					}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, map[string]string{"legacy-api/preview": "legacy.example.net"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, route := range result["example.com"] {
+		switch route.Path {
+		case "/api":
+			if route.OverrideHeader != v1alpha1.DefaultOverrideHeaderName {
+				t.Errorf("expected override header %q, got %q", v1alpha1.DefaultOverrideHeaderName, route.OverrideHeader)
+			}
+			want := map[string]string{
+				"alice":  "api-alice.preview.svc.cluster.local:8080",
+				"legacy": "legacy.example.net:80",
+			}
+			if !reflect.DeepEqual(route.Overrides, want) {
+				t.Errorf("expected overrides %v, got %v", want, route.Overrides)
+			}
+		case "/old":
+			if route.OverrideHeader != "" || route.Overrides != nil {
+				t.Errorf("redirect-only route must not carry overrides, got %q %v", route.OverrideHeader, route.Overrides)
+			}
+		default:
+			t.Errorf("unexpected route %q", route.Path)
+		}
+	}
+}
+
+func TestExpandRoutesWithDecisionHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		mode v1alpha1.DecisionHeadersMode
+		want string
+	}{
+		{"unset inherits", "", ""},
+		{"always", v1alpha1.DecisionHeadersAlways, DecisionHeadersAlways},
+		{"never", v1alpha1.DecisionHeadersNever, DecisionHeadersNever},
+		{"on debug", v1alpha1.DecisionHeadersOnDebug, DecisionHeadersOnDebug},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &v1alpha1.CustomHTTPRoute{
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					TargetRef:       v1alpha1.TargetRef{Name: "default"},
+					Hostnames:       []string{"example.com"},
+					DecisionHeaders: tt.mode,
+					Rules: []v1alpha1.Rule{{
+						Matches:     []v1alpha1.PathMatch{{Path: "/api", Type: v1alpha1.MatchTypePathPrefix}},
+						BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+					}},
+				},
+			}
+
+			result, err := ExpandRoutes(cr, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, route := range result["example.com"] {
+				if route.DecisionHeaders != tt.want {
+					t.Errorf("route %q decisionHeaders = %q, want %q", route.Path, route.DecisionHeaders, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandRoutesWithProtocolHints(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:       []v1alpha1.PathMatch{{Path: "/ws", Type: v1alpha1.MatchTypePathPrefix}},
+					ProtocolHints: v1alpha1.ProtocolHintWebSocket,
+					BackendRefs:   []v1alpha1.BackendRef{{Name: "ws", Namespace: "default", Port: 8080}},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{"/ws": ProtocolHintWebSocket, "/api": ""}
+	for _, route := range result["example.com"] {
+		if route.ProtocolHint != want[route.Path] {
+			t.Errorf("route %q protocolHint = %q, want %q", route.Path, route.ProtocolHint, want[route.Path])
+		}
+	}
+}
+
+func TestExpandRoutesWithOutlierPolicy(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+					OutlierPolicy: &v1alpha1.OutlierPolicy{
+						FallbackBackendRef: v1alpha1.BackendRef{Name: "api-fallback", Namespace: "backup", Port: 8080},
+						MinRequests:        20,
+						EjectionTime:       "1m",
+					},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/web", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := RouteOutlier{
+		FallbackBackend:  "api-fallback.backup.svc.cluster.local:8080",
+		ErrorRatePercent: DefaultOutlierErrorRatePercent,
+		MinRequests:      20,
+		IntervalMs:       DefaultOutlierInterval.Milliseconds(),
+		EjectionMs:       time.Minute.Milliseconds(),
+	}
+	for _, route := range result["example.com"] {
+		switch route.Path {
+		case "/api":
+			if route.Outlier == nil || *route.Outlier != want {
+				t.Errorf("route /api outlier = %+v, want %+v", route.Outlier, want)
+			}
+		case "/web":
+			if route.Outlier != nil {
+				t.Errorf("route /web outlier = %+v, want nil", route.Outlier)
+			}
+		}
+	}
+}
+
+func TestExpandRoutesWithBackendFailover(t *testing.T) {
+	us := v1alpha1.BackendRef{Name: "api", Namespace: "us", Port: 8080}
+	eu := v1alpha1.BackendRef{Name: "api", Namespace: "eu", Port: 8080, Protocol: v1alpha1.BackendProtocolH2C}
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Defaults:  &v1alpha1.RuleDefaults{BackendRefs: []v1alpha1.BackendRef{us, eu}},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:         []v1alpha1.PathMatch{{Path: "/api", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendFailover: &v1alpha1.BackendFailover{},
+				},
+				{
+					Matches: []v1alpha1.PathMatch{{Path: "/orders", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendFailover: &v1alpha1.BackendFailover{
+						HealthSignal: v1alpha1.BackendHealthResponses,
+						MinRequests:  20,
+						EjectionTime: "1m",
+					},
+				},
+			},
+		},
+	}
+
+	hosts, warnings, err := ExpandRoutesWithWarnings(cr, nil)
+	if err != nil {
+		t.Fatalf("ExpandRoutesWithWarnings: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none: every backendRef of a failover chain receives traffic", warnings)
+	}
+
+	chain := []string{"api.us.svc.cluster.local:8080", "api.eu.svc.cluster.local:8080"}
+	want := map[string]RouteFailover{
+		"/api": {Backends: chain, Signal: FailoverSignalEndpoints},
+		"/orders": {
+			Backends:         chain,
+			Signal:           FailoverSignalResponses,
+			ErrorRatePercent: DefaultOutlierErrorRatePercent,
+			MinRequests:      20,
+			IntervalMs:       DefaultOutlierInterval.Milliseconds(),
+			EjectionMs:       time.Minute.Milliseconds(),
+		},
+	}
+	for _, route := range hosts["example.com"] {
+		if route.Failover == nil || !reflect.DeepEqual(*route.Failover, want[route.Path]) {
+			t.Errorf("route %s failover = %+v, want %+v", route.Path, route.Failover, want[route.Path])
+		}
+		if route.Backend != chain[0] {
+			t.Errorf("route %s backend = %q, want the head of the chain %q", route.Path, route.Backend, chain[0])
+		}
+		if got := route.BackendProtocols[chain[1]]; got != v1alpha1.BackendProtocolH2C {
+			t.Errorf("route %s protocol of %s = %q, want h2c", route.Path, chain[1], got)
+		}
+	}
+}
+
+func TestExpandRoutesWithMaxRequestBytes(t *testing.T) {
+	limit := int64(1 << 20)
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:         []v1alpha1.PathMatch{{Path: "/upload", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendRefs:     []v1alpha1.BackendRef{{Name: "legacy", Namespace: "default", Port: 8080}},
+					MaxRequestBytes: &limit,
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/web", Type: v1alpha1.MatchTypePathPrefix}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]int64{"/upload": limit, "/web": 0}
+	for _, route := range result["example.com"] {
+		if route.MaxRequestBytes != want[route.Path] {
+			t.Errorf("route %q maxRequestBytes = %d, want %d", route.Path, route.MaxRequestBytes, want[route.Path])
+		}
+	}
+}
+
+func TestExpandRoutesDisabled(t *testing.T) {
+	disabled := false
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef:              v1alpha1.TargetRef{Name: "default"},
+			Hostnames:              []string{"example.com"},
+			UnmatchedRequestPolicy: v1alpha1.UnmatchedRequestNotFound,
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/beta"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "beta", Namespace: "default", Port: 8080}},
+					Enabled:     &disabled,
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hostRoutes := result["example.com"]
+	if len(hostRoutes) != 2 || hostRoutes[0].Path != "/api" || hostRoutes[1].UnmatchedPolicy == "" {
+		t.Fatalf("routes = %+v, want /api and the fallback only", hostRoutes)
+	}
+	if hostRoutes[0].SourceRule != "rules[0]" || hostRoutes[1].SourceRule != "unmatchedRequestPolicy" {
+		t.Errorf("source rules = %q, %q, want rules[0] and unmatchedRequestPolicy",
+			hostRoutes[0].SourceRule, hostRoutes[1].SourceRule)
+	}
+
+	cr.Spec.Enabled = &disabled
+	result, err = ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result) != 0 {
+		t.Errorf("disabled route expanded to %+v, want nothing", result)
+	}
+}
+
+func TestExpandRoutesHostnameAliases(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			HostnameAliases: []v1alpha1.HostnameAlias{
+				{Hostname: "example.net", Canonical: "example.com"},
+				{Hostname: "www.example.com", Canonical: "example.com", Redirect: true},
+			},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result) != 3 {
+		t.Fatalf("hosts = %v, want the hostname and both aliases", result)
+	}
+	if !reflect.DeepEqual(result["example.net"], result["example.com"]) {
+		t.Errorf("alias routes = %+v, want the routes of example.com %+v", result["example.net"], result["example.com"])
+	}
+
+	redirect := result["www.example.com"]
+	if len(redirect) != 1 || redirect[0].Path != "/" || redirect[0].Type != RouteTypePrefix || redirect[0].Backend != "" {
+		t.Fatalf("redirecting alias routes = %+v, want a single / redirect", redirect)
+	}
+	want := []RouteAction{{Type: ActionTypeRedirect, RedirectHostname: "example.com", RedirectStatusCode: 301}}
+	if !reflect.DeepEqual(redirect[0].Actions, want) {
+		t.Errorf("redirect actions = %+v, want %+v", redirect[0].Actions, want)
+	}
+	if redirect[0].SourceRule != "hostnameAliases[1]" {
+		t.Errorf("redirect source rule = %q, want hostnameAliases[1]", redirect[0].SourceRule)
+	}
+}
+
+func TestExpandRoutesOwnerAndDescription(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef:              v1alpha1.TargetRef{Name: "default"},
+			Hostnames:              []string{"example.com"},
+			UnmatchedRequestPolicy: v1alpha1.UnmatchedRequestNotFound,
+			Owner:                  "team-shop",
+			Description:            "Storefront",
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/", Priority: 1}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 8080}},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/pay"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "pay", Namespace: "default", Port: 8080}},
+					Owner:       "team-payments",
+					Description: "Checkout payments",
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, route := range result["example.com"] {
+		wantOwner, wantDescription := "team-shop", "Storefront"
+		if route.SourceRule == "rules[1]" {
+			wantOwner, wantDescription = "team-payments", "Checkout payments"
+		}
+		if route.Owner != wantOwner || route.Description != wantDescription {
+			t.Errorf("%s route %q owner = %q, description = %q, want %q and %q",
+				route.SourceRule, route.Path, route.Owner, route.Description, wantOwner, wantDescription)
+		}
+	}
+}
+
+func TestExpandRoutesWithUnmatchedRequestPolicy(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef:              v1alpha1.TargetRef{Name: "default"},
+			Hostnames:              []string{"example.com"},
+			UnmatchedRequestPolicy: v1alpha1.UnmatchedRequestNotFound,
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/", Type: v1alpha1.MatchTypePathPrefix, Priority: 1}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 8080}},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api", Type: v1alpha1.MatchTypeExact}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hostRoutes := result["example.com"]
+	if len(hostRoutes) != 3 {
+		t.Fatalf("got %d routes, want the 2 rule routes and the fallback", len(hostRoutes))
+	}
+	last := hostRoutes[len(hostRoutes)-1]
+	if last.UnmatchedPolicy != UnmatchedNotFound || last.Path != "/" || last.Type != RouteTypePrefix {
+		t.Errorf("last route = %+v, want the 404 fallback", last)
+	}
+	for _, route := range hostRoutes[:len(hostRoutes)-1] {
+		if route.UnmatchedPolicy != "" {
+			t.Errorf("route %q unmatchedPolicy = %q, want empty", route.Path, route.UnmatchedPolicy)
+		}
+	}
+
+	config := MergeRoutesConfig(result)
+	if got := config.FindRoute("example.com", RequestMatch{Path: "/other"}); got == nil || got.Backend == "" {
+		t.Errorf("FindRoute(/other) = %+v, want the lowest priority rule, not the fallback", got)
+	}
+}
+
+func TestMergeRoutesConfigPrecedence(t *testing.T) {
+	customRoute := func(backend string, precedence int32) *v1alpha1.CustomHTTPRoute {
+		return &v1alpha1.CustomHTTPRoute{
+			Spec: v1alpha1.CustomHTTPRouteSpec{
+				TargetRef:  v1alpha1.TargetRef{Name: "default"},
+				Hostnames:  []string{"example.com"},
+				Precedence: precedence,
+				Rules: []v1alpha1.Rule{
+					{
+						Matches:     []v1alpha1.PathMatch{{Path: "/api"}},
+						BackendRefs: []v1alpha1.BackendRef{{Name: backend, Namespace: "default", Port: 8080}},
+					},
+					{
+						Matches:     []v1alpha1.PathMatch{{Path: "/api/" + backend}},
+						BackendRefs: []v1alpha1.BackendRef{{Name: backend, Namespace: "default", Port: 8080}},
+					},
+				},
+			},
+		}
+	}
+
+	team, err := ExpandRoutes(customRoute("team", 0), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	platform, err := ExpandRoutes(customRoute("platform", 100), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := platform["example.com"][0].Precedence; got != 100 {
+		t.Fatalf("platform route precedence = %d, want 100", got)
+	}
+
+	// The team CustomHTTPRoute comes first, as it would by namespace/name.
+	config := MergeRoutesConfig(team, platform)
+	if got := config.FindRoute("example.com", RequestMatch{Path: "/api/items"}); got == nil || !strings.HasPrefix(got.Backend, "platform.") {
+		t.Errorf("tied route = %+v, want the platform route", got)
+	}
+	// Precedence only breaks ties: a more specific route still wins.
+	if got := config.FindRoute("example.com", RequestMatch{Path: "/api/team/items"}); got == nil || !strings.HasPrefix(got.Backend, "team.") {
+		t.Errorf("longer prefix route = %+v, want the team route", got)
+	}
+}
+
+func TestExpandRoutesWithFraction(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "stable", Namespace: "default", Port: 8080}},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/api", Fraction: &v1alpha1.Fraction{Numerator: 100}}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "canary", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hostRoutes := result["example.com"]
+	if len(hostRoutes) != 2 {
+		t.Fatalf("got %d routes, want 2", len(hostRoutes))
+	}
+	if f := hostRoutes[0].Fraction; f == nil || f.Numerator != 100 || f.Denominator != v1alpha1.DefaultFractionDenominator {
+		t.Fatalf("first route fraction = %+v, want 100/%d sorted before the unsampled route", f, v1alpha1.DefaultFractionDenominator)
+	}
+
+	config := MergeRoutesConfig(result)
+	sampled := config.FindRoute("example.com", RequestMatch{Path: "/api", Headers: map[string]string{RequestIDHeader: "abc"}})
+	if sampled == nil || !strings.HasPrefix(sampled.Backend, "canary.") {
+		t.Errorf("request with id = %+v, want the canary route", sampled)
+	}
+	unsampled := config.FindRoute("example.com", RequestMatch{Path: "/api"})
+	if unsampled == nil || !strings.HasPrefix(unsampled.Backend, "stable.") {
+		t.Errorf("request without id = %+v, want the stable route", unsampled)
+	}
+}
+
+func TestExpandRegexWithInlineFlags(t *testing.T) {
+	prefixes := []string{"es", "fr"}
+	tests := []struct {
+		name     string
+		input    string
+		policy   v1alpha1.PathPrefixPolicy
+		expected string
+	}{
+		{
+			name:     "leading flags required",
+			input:    "(?i)^/legacy/[0-9]+$",
+			policy:   v1alpha1.PathPrefixPolicyRequired,
+			expected: "(?i)^/(es|fr)/legacy/[0-9]+$",
+		},
+		{
+			name:     "flags after the anchor optional",
+			input:    "^(?is)/legacy$",
+			policy:   v1alpha1.PathPrefixPolicyOptional,
+			expected: "(?is)^(?:/(es|fr))?/legacy$",
+		},
+		{
+			name:     "flags with a top-level alternation",
+			input:    "(?i)^/a$|^/b$",
+			policy:   v1alpha1.PathPrefixPolicyRequired,
+			expected: "(?i)^/(es|fr)(?:/a$|/b$)",
+		},
+		{
+			name:     "scoped flag group is not a leading flag group",
+			input:    "(?i:/legacy)$",
+			policy:   v1alpha1.PathPrefixPolicyRequired,
+			expected: "(?i:/legacy)$",
+		},
+		{
+			name:     "disabled",
+			input:    "(?i)^/legacy$",
+			policy:   v1alpha1.PathPrefixPolicyDisabled,
+			expected: "(?i)^/legacy$",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandRegexWithPrefixes(tt.input, prefixes, tt.policy); got != tt.expected {
+				t.Errorf("ExpandRegexWithPrefixes(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandRoutesCaseInsensitive(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			PathPrefixes: &v1alpha1.PathPrefixes{
+				Values: []string{"es"},
+				Policy: v1alpha1.PathPrefixPolicyOptional,
+			},
+			Rules: []v1alpha1.Rule{{
+				Matches: []v1alpha1.PathMatch{
+					{Path: "/Shop", CaseInsensitive: true},
+					{Path: "/Legacy/Item.aspx", Type: v1alpha1.MatchTypeExact, CaseInsensitive: true},
+					{Path: "^/id/[0-9]+$", Type: v1alpha1.MatchTypeRegex, CaseInsensitive: true},
+					{Path: "/Strict", Type: v1alpha1.MatchTypeExact},
+				},
+				BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 8080}},
+			}},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config := MergeRoutesConfig(result)
+	if err := config.CompileRegexes(); err != nil {
+		t.Fatalf("CompileRegexes failed: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/shop", true},
+		{"/SHOP/cart", true},
+		{"/es/shop", true},
+		{"/shopping", false},
+		{"/legacy/item.ASPX", true},
+		{"/ES/legacy/item.aspx", true},
+		{"/ID/42", true},
+		{"/es/Id/42", true},
+		{"/Strict", true},
+		{"/strict", false},
+	}
+	for _, tt := range tests {
+		if got := config.FindRoute("example.com", RequestMatch{Path: tt.path}) != nil; got != tt.want {
+			t.Errorf("FindRoute(%q) matched = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExpandRoutesWithSequentialActions(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/seq", Type: v1alpha1.MatchTypePathPrefix}},
+					ActionOrder: v1alpha1.ActionOrderSequential,
+					BackendRefs: []v1alpha1.BackendRef{{Name: "seq", Namespace: "default", Port: 8080}},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/fixed", Type: v1alpha1.MatchTypePathPrefix}},
+					ActionOrder: v1alpha1.ActionOrderFixed,
+					BackendRefs: []v1alpha1.BackendRef{{Name: "fixed", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]bool{"/seq": true, "/fixed": false}
+	for _, route := range result["example.com"] {
+		if route.SequentialActions != want[route.Path] {
+			t.Errorf("route %q sequentialActions = %v, want %v", route.Path, route.SequentialActions, want[route.Path])
+		}
 	}
 }
 
-func TestExpandRoutesWithRedirect(t *testing.T) {
+func TestExpandRoutesWithDefaults(t *testing.T) {
 	cr := &v1alpha1.CustomHTTPRoute{
 		Spec: v1alpha1.CustomHTTPRouteSpec{
 			TargetRef: v1alpha1.TargetRef{Name: "default"},
 			Hostnames: []string{"example.com"},
+			Defaults: &v1alpha1.RuleDefaults{
+				Actions: []v1alpha1.Action{{
+					Type:   v1alpha1.ActionTypeResponseHeaderSet,
+					Header: &v1alpha1.HeaderConfig{Name: "X-Frame-Options", Value: "DENY"},
+				}},
+				BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 80}},
+				Priority:    2000,
+			},
 			Rules: []v1alpha1.Rule{
 				{
-					Matches: []v1alpha1.PathMatch{
-						{Path: "/old-page", Type: v1alpha1.MatchTypeExact},
-					},
-					Actions: []v1alpha1.Action{
-						{
-							Type: v1alpha1.ActionTypeRedirect,
-							Redirect: &v1alpha1.RedirectConfig{
-								Path:       "/new-page",
-								StatusCode: 301,
-							},
-						},
-					},
-					BackendRefs: []v1alpha1.BackendRef{
-						{Name: "dummy", Namespace: "default", Port: 80},
-					},
+					Matches: []v1alpha1.PathMatch{{Path: "/", Type: v1alpha1.MatchTypePathPrefix}},
+				},
+				{
+					Matches: []v1alpha1.PathMatch{{Path: "/api", Type: v1alpha1.MatchTypePathPrefix, Priority: 3000}},
+					Actions: []v1alpha1.Action{{
+						Type:   v1alpha1.ActionTypeResponseHeaderSet,
+						Header: &v1alpha1.HeaderConfig{Name: "x-frame-options", Value: "SAMEORIGIN"},
+					}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
 				},
 			},
 		},
@@ -550,29 +1278,75 @@ func TestExpandRoutesWithRedirect(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	routes, ok := result["example.com"]
-	if !ok {
-		t.Fatal("expected routes for example.com")
+	want := map[string]struct {
+		backend  string
+		priority int32
+		frame    string
+	}{
+		"/":    {backend: "web.default.svc.cluster.local:80", priority: 2000, frame: "DENY"},
+		"/api": {backend: "api.default.svc.cluster.local:8080", priority: 3000, frame: "SAMEORIGIN"},
 	}
+	routes := result["example.com"]
+	if len(routes) != len(want) {
+		t.Fatalf("expected %d routes, got %d", len(want), len(routes))
+	}
+	for _, route := range routes {
+		w := want[route.Path]
+		if route.Backend != w.backend || route.Priority != w.priority {
+			t.Errorf("route %q = %s (priority %d), want %s (priority %d)",
+				route.Path, route.Backend, route.Priority, w.backend, w.priority)
+		}
+		if len(route.Actions) != 1 || route.Actions[0].Value != w.frame {
+			t.Errorf("route %q actions = %+v, want one header-set with value %q", route.Path, route.Actions, w.frame)
+		}
+	}
+}
 
-	if len(routes) != 1 {
-		t.Fatalf("expected 1 route, got %d", len(routes))
+func TestExpandRoutesWithGRPCMatches(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"api.example.com"},
+			PathPrefixes: &v1alpha1.PathPrefixes{
+				Values: []string{"es", "fr"},
+				Policy: v1alpha1.PathPrefixPolicyRequired,
+			},
+			Rules: []v1alpha1.Rule{{
+				GRPCMatches: []v1alpha1.GRPCMatch{
+					{Service: "users.v1.UserService", Method: "GetUser", Priority: 2000},
+					{Service: "users.v1.AdminService"},
+				},
+				BackendRefs: []v1alpha1.BackendRef{{Name: "users", Namespace: "default", Port: 9000}},
+			}},
+		},
 	}
 
-	route := routes[0]
-	if len(route.Actions) != 1 {
-		t.Fatalf("expected 1 action, got %d", len(route.Actions))
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
 
-	action := route.Actions[0]
-	if action.Type != "redirect" {
-		t.Errorf("expected redirect action, got %s", action.Type)
+	got := result["api.example.com"]
+	if len(got) != 2 {
+		t.Fatalf("expected 2 unprefixed routes, got %d: %+v", len(got), got)
 	}
-	if action.RedirectPath != "/new-page" {
-		t.Errorf("expected redirect path /new-page, got %s", action.RedirectPath)
+	want := map[string]string{
+		"/users.v1.UserService/GetUser": RouteTypeExact,
+		"/users.v1.AdminService/":       RouteTypePrefix,
 	}
-	if action.RedirectStatusCode != 301 {
-		t.Errorf("expected status 301, got %d", action.RedirectStatusCode)
+	for _, route := range got {
+		if want[route.Path] != route.Type {
+			t.Errorf("route %q type %q, want %q", route.Path, route.Type, want[route.Path])
+		}
+		if !route.GRPC || route.Method != "POST" {
+			t.Errorf("route %q: grpc=%v method=%q, want grpc POST", route.Path, route.GRPC, route.Method)
+		}
+		if len(route.Headers) != 1 || route.Headers[0].Name != "content-type" || route.Headers[0].Type != HeaderMatchRegex {
+			t.Errorf("route %q: expected a content-type regex header match, got %+v", route.Path, route.Headers)
+		}
+		if route.Backend != "users.default.svc.cluster.local:9000" {
+			t.Errorf("route %q backend = %q", route.Path, route.Backend)
+		}
 	}
 }
 
@@ -1204,6 +1978,138 @@ func TestExpandRoutesWithInlinePrefixPlaceholder(t *testing.T) {
 	}
 }
 
+func TestExpandStaticMatchesWithInlinePrefixPlaceholder(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		matchType v1alpha1.MatchType
+		policy    v1alpha1.PathPrefixPolicy
+		expected  []string
+	}{
+		{
+			name:      "exact required",
+			path:      "/app/{prefix}/settings",
+			matchType: v1alpha1.MatchTypeExact,
+			policy:    v1alpha1.PathPrefixPolicyRequired,
+			expected:  []string{"/app/es/settings", "/app/fr/settings"},
+		},
+		{
+			name:      "exact optional drops the placeholder segment",
+			path:      "/app/{prefix}/settings",
+			matchType: v1alpha1.MatchTypeExact,
+			policy:    v1alpha1.PathPrefixPolicyOptional,
+			expected:  []string{"/app/es/settings", "/app/fr/settings", "/app/settings"},
+		},
+		{
+			name:      "path prefix optional",
+			path:      "/static/{prefix}",
+			matchType: v1alpha1.MatchTypePathPrefix,
+			policy:    v1alpha1.PathPrefixPolicyOptional,
+			expected:  []string{"/static/es", "/static/fr", "/static"},
+		},
+		{
+			name:      "path prefix disabled drops the placeholder segment",
+			path:      "/app/{prefix}/settings",
+			matchType: v1alpha1.MatchTypePathPrefix,
+			policy:    v1alpha1.PathPrefixPolicyDisabled,
+			expected:  []string{"/app/settings"},
+		},
+		{
+			name:      "placeholder as the whole path",
+			path:      "/{prefix}",
+			matchType: v1alpha1.MatchTypeExact,
+			policy:    v1alpha1.PathPrefixPolicyOptional,
+			expected:  []string{"/es", "/fr", "/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &v1alpha1.CustomHTTPRoute{
+				Spec: v1alpha1.CustomHTTPRouteSpec{
+					TargetRef: v1alpha1.TargetRef{Name: "default"},
+					Hostnames: []string{"example.com"},
+					PathPrefixes: &v1alpha1.PathPrefixes{
+						Values: []string{"es", "fr"},
+						Policy: tt.policy,
+					},
+					Rules: []v1alpha1.Rule{
+						{
+							Matches: []v1alpha1.PathMatch{{Path: tt.path, Type: tt.matchType}},
+							BackendRefs: []v1alpha1.BackendRef{
+								{Name: "web", Namespace: "web", Port: 80},
+							},
+						},
+					},
+				},
+			}
+
+			result, err := ExpandRoutes(cr, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			routes := result["example.com"]
+			if len(routes) != len(tt.expected) {
+				t.Fatalf("expected %d routes, got %d: %+v", len(tt.expected), len(routes), routes)
+			}
+
+			paths := make(map[string]bool)
+			for _, r := range routes {
+				paths[r.Path] = true
+			}
+			for _, expected := range tt.expected {
+				if !paths[expected] {
+					t.Errorf("missing expected path %s; got paths: %v", expected, paths)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandStaticInlinePrefixPreservePrefix(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			PathPrefixes: &v1alpha1.PathPrefixes{
+				Values: []string{"es"},
+				Policy: v1alpha1.PathPrefixPolicyRequired,
+			},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches: []v1alpha1.PathMatch{
+						{Path: "/app/{prefix}/settings", Type: v1alpha1.MatchTypeExact},
+					},
+					Actions: []v1alpha1.Action{
+						{
+							Type:    v1alpha1.ActionTypeRewrite,
+							Rewrite: &v1alpha1.RewriteConfig{Path: "/settings", PreservePrefix: boolPtr(true)},
+						},
+					},
+					BackendRefs: []v1alpha1.BackendRef{
+						{Name: "web", Namespace: "web", Port: 80},
+					},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	routes := result["example.com"]
+	if len(routes) != 1 {
+		t.Fatalf("expected 1 route, got %d: %+v", len(routes), routes)
+	}
+	if routes[0].Path != "/app/es/settings" {
+		t.Errorf("expected path /app/es/settings, got %s", routes[0].Path)
+	}
+	if got := routes[0].Actions[0].RewritePath; got != "/es/settings" {
+		t.Errorf("expected rewrite path /es/settings, got %s", got)
+	}
+}
+
 func TestExpandRegexWithoutPlaceholderUnchanged(t *testing.T) {
 	langPrefixes := []string{"es", "fr", "it"}
 
@@ -1247,6 +2153,42 @@ func TestExpandRegexWithoutPlaceholderUnchanged(t *testing.T) {
 
 func boolPtr(v bool) *bool { return &v }
 
+func TestConvertActionsRedirectPreservePort(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input *bool
+		want  bool
+	}{{"unset", nil, false}, {"true", boolPtr(true), false}, {"false", boolPtr(false), true}} {
+		actions := convertActions([]v1alpha1.Action{{
+			Type:     v1alpha1.ActionTypeRedirect,
+			Redirect: &v1alpha1.RedirectConfig{Path: "/new", PreservePort: tt.input},
+		}})
+		if got := actions[0].RedirectStripPort; got != tt.want {
+			t.Errorf("preservePort %s: RedirectStripPort = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConvertActionsRedirectSchemeAndAltSvc(t *testing.T) {
+	actions := convertActions([]v1alpha1.Action{
+		{
+			Type:     v1alpha1.ActionTypeRedirect,
+			Redirect: &v1alpha1.RedirectConfig{Scheme: v1alpha1.RedirectSchemePreserve, Hostname: "www.example.com"},
+		},
+		{
+			Type:     v1alpha1.ActionTypeRedirect,
+			Redirect: &v1alpha1.RedirectConfig{Scheme: "https", AltSvc: `h3=":443"; ma=86400`},
+		},
+	})
+	if actions[0].RedirectScheme != "" {
+		t.Errorf("scheme preserve: RedirectScheme = %q, want empty to keep the request scheme", actions[0].RedirectScheme)
+	}
+	if actions[1].RedirectScheme != "https" || actions[1].RedirectAltSvc != `h3=":443"; ma=86400` {
+		t.Errorf("RedirectScheme = %q, RedirectAltSvc = %q, want https and the altSvc",
+			actions[1].RedirectScheme, actions[1].RedirectAltSvc)
+	}
+}
+
 func TestConvertActionsPassesReplacePrefixMatch(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -1291,6 +2233,74 @@ func TestConvertActionsPassesReplacePrefixMatch(t *testing.T) {
 	}
 }
 
+func TestConvertActionsRequireAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     *v1alpha1.AuthConfig
+		expected RouteAction
+	}{
+		{
+			name: "defaults",
+			auth: &v1alpha1.AuthConfig{
+				BackendRef: v1alpha1.BackendRef{Name: "authz", Namespace: "auth", Port: 8080},
+			},
+			expected: RouteAction{
+				Type:               ActionTypeRequireAuth,
+				AuthURL:            "http://authz.auth.svc.cluster.local:8080/",
+				AuthForwardHeaders: DefaultAuthForwardHeaders,
+				AuthTimeoutMs:      1000,
+			},
+		},
+		{
+			name: "explicit settings and external hostname",
+			auth: &v1alpha1.AuthConfig{
+				BackendRef:      v1alpha1.BackendRef{Name: "auth.example.com", Namespace: "auth", Port: 443},
+				Path:            "/verify",
+				ForwardHeaders:  []string{"x-api-key"},
+				UpstreamHeaders: []string{"x-user-id"},
+				Timeout:         "250ms",
+				FailOpen:        true,
+			},
+			expected: RouteAction{
+				Type:                ActionTypeRequireAuth,
+				AuthURL:             "http://auth.example.com:443/verify",
+				AuthForwardHeaders:  []string{"x-api-key"},
+				AuthUpstreamHeaders: []string{"x-user-id"},
+				AuthTimeoutMs:       250,
+				AuthFailOpen:        true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := convertActions([]v1alpha1.Action{{Type: v1alpha1.ActionTypeRequireAuth, Auth: tt.auth}})
+			if len(actions) != 1 {
+				t.Fatalf("expected 1 action, got %d", len(actions))
+			}
+			if !reflect.DeepEqual(actions[0], tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, actions[0])
+			}
+		})
+	}
+}
+
+func TestConvertActionsUpgrade(t *testing.T) {
+	actions := convertActions([]v1alpha1.Action{
+		{Type: v1alpha1.ActionTypeStripUpgrade},
+		{Type: v1alpha1.ActionTypeDenyUpgrade},
+		{Type: v1alpha1.ActionTypeDenyUpgrade, UpgradeStatusCode: 426},
+	})
+	expected := []RouteAction{
+		{Type: ActionTypeStripUpgrade},
+		{Type: ActionTypeDenyUpgrade, UpgradeStatusCode: DefaultUpgradeStatusCode},
+		{Type: ActionTypeDenyUpgrade, UpgradeStatusCode: 426},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actions)
+	}
+}
+
 func TestBuildBackendStringWithExternalNames(t *testing.T) {
 	externalNames := map[string]string{
 		"profile-svc/apps": "stable.profile.apps.internal",
@@ -2189,3 +3199,118 @@ func TestFindRoutePrefersMoreSpecificMatches(t *testing.T) {
 		}
 	})
 }
+
+func TestExpandRoutesBackendProtocols(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches: []v1alpha1.PathMatch{{Path: "/grpc"}},
+					BackendRefs: []v1alpha1.BackendRef{{
+						Name: "grpc", Namespace: "default", Port: 9000, Protocol: v1alpha1.BackendProtocolH2C,
+					}},
+					OutlierPolicy: &v1alpha1.OutlierPolicy{
+						FallbackBackendRef: v1alpha1.BackendRef{
+							Name: "grpc.backup.example.com", Namespace: "backup", Port: 443, Protocol: v1alpha1.BackendProtocolH2,
+						},
+						MinRequests:  20,
+						EjectionTime: "1m",
+					},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/web"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 80}},
+				},
+				{
+					Matches: []v1alpha1.PathMatch{{Path: "/old", Type: v1alpha1.MatchTypeExact}},
+					Actions: []v1alpha1.Action{{
+						Type:     v1alpha1.ActionTypeRedirect,
+						Redirect: &v1alpha1.RedirectConfig{Path: "/web"},
+					}},
+				},
+			},
+			OverrideHeader: &v1alpha1.OverrideHeader{
+				Variants: []v1alpha1.RouteVariant{{
+					Name:       "legacy",
+					BackendRef: v1alpha1.BackendRef{Name: "web-legacy", Namespace: "default", Port: 80, Protocol: v1alpha1.BackendProtocolHTTP11},
+				}},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]map[string]string{
+		"/grpc": {
+			"grpc.default.svc.cluster.local:9000":     v1alpha1.BackendProtocolH2C,
+			"grpc.backup.example.com:443":             v1alpha1.BackendProtocolH2,
+			"web-legacy.default.svc.cluster.local:80": v1alpha1.BackendProtocolHTTP11,
+		},
+		"/web": {
+			"web-legacy.default.svc.cluster.local:80": v1alpha1.BackendProtocolHTTP11,
+		},
+		"/old": nil,
+	}
+	for _, r := range result["example.com"] {
+		if !reflect.DeepEqual(r.BackendProtocols, want[r.Path]) {
+			t.Errorf("%s: BackendProtocols = %v, want %v", r.Path, r.BackendProtocols, want[r.Path])
+		}
+	}
+
+	data, err := json.Marshal(result["example.com"])
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(data), "h2c") {
+		t.Errorf("backend protocols leaked into the serialized routes: %s", data)
+	}
+}
+
+func TestExpandRoutesWithWarnings(t *testing.T) {
+	web := v1alpha1.BackendRef{Name: "web", Namespace: "default", Port: 80}
+	canary := v1alpha1.BackendRef{Name: "web-canary", Namespace: "default", Port: 80}
+	disabled := false
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Defaults:  &v1alpha1.RuleDefaults{BackendRefs: []v1alpha1.BackendRef{web, canary}},
+			Rules: []v1alpha1.Rule{
+				{Matches: []v1alpha1.PathMatch{{Path: "/a"}}},
+				{Matches: []v1alpha1.PathMatch{{Path: "/b"}}, BackendRefs: []v1alpha1.BackendRef{web}},
+				{Matches: []v1alpha1.PathMatch{{Path: "/c"}}, BackendRefs: []v1alpha1.BackendRef{canary, web}},
+				{Matches: []v1alpha1.PathMatch{{Path: "/d"}}},
+				{Matches: []v1alpha1.PathMatch{{Path: "/e"}}, BackendRefs: []v1alpha1.BackendRef{web, canary}, Enabled: &disabled},
+			},
+		},
+	}
+
+	hosts, warnings, err := ExpandRoutesWithWarnings(cr, nil)
+	if err != nil {
+		t.Fatalf("ExpandRoutesWithWarnings: %v", err)
+	}
+	if got := len(hosts["example.com"]); got != 4 {
+		t.Errorf("got %d routes, want 4", got)
+	}
+	want := []string{
+		"defaults.backendRefs: only the first of 2 backendRefs receives traffic, the others are ignored",
+		"rules[2].backendRefs: only the first of 2 backendRefs receives traffic, the others are ignored",
+	}
+	if len(warnings) != len(want) {
+		t.Fatalf("warnings = %v, want %v", warnings, want)
+	}
+	for i, w := range warnings {
+		if w.String() != want[i] {
+			t.Errorf("warnings[%d] = %q, want %q", i, w, want[i])
+		}
+	}
+
+	cr.Spec.Enabled = &disabled
+	if _, warnings, _ := ExpandRoutesWithWarnings(cr, nil); len(warnings) != 0 {
+		t.Errorf("disabled route warnings = %v, want none", warnings)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import "time"
+
+// Expired reports whether the route's rule expired at now; a zero now means
+// the current time.
+func (r *Route) Expired(now time.Time) bool {
+	if r.ExpiresAt == nil {
+		return false
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return !now.Before(*r.ExpiresAt)
+}
+
+// PruneExpired removes from hosts, in place, the routes expired at now and
+// returns how many it removed. Hosts left without routes are deleted.
+func PruneExpired(hosts map[string][]Route, now time.Time) int {
+	removed := 0
+	for host, hostRoutes := range hosts {
+		kept := hostRoutes[:0]
+		for i := range hostRoutes {
+			if hostRoutes[i].Expired(now) {
+				removed++
+				continue
+			}
+			kept = append(kept, hostRoutes[i])
+		}
+		if len(kept) == 0 {
+			delete(hosts, host)
+			continue
+		}
+		hosts[host] = kept
+	}
+	return removed
+}
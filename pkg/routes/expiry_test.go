@@ -0,0 +1,113 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestExpandRoutesExpiresAt(t *testing.T) {
+	expiresAt := time.Date(2026, 12, 1, 0, 0, 0, 0, time.FixedZone("CET", 3600))
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:   []v1alpha1.PathMatch{{Path: "/black-friday"}},
+					ExpiresAt: &metav1.Time{Time: expiresAt},
+					Actions: []v1alpha1.Action{{
+						Type:     v1alpha1.ActionTypeRedirect,
+						Redirect: &v1alpha1.RedirectConfig{Path: "/deals", StatusCode: 302},
+					}},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config := MergeRoutesConfig(result)
+	if err := config.CompileRegexes(); err != nil {
+		t.Fatalf("CompileRegexes: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		wantPath string
+	}{
+		{"before expiry", expiresAt.Add(-time.Minute), "/black-friday"},
+		{"expiry is inclusive", expiresAt, "/"},
+		{"after expiry", expiresAt.Add(time.Hour), "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := config.FindRoute("example.com", RequestMatch{Path: "/black-friday", Time: tt.at})
+			if route == nil || route.Path != tt.wantPath {
+				t.Fatalf("FindRoute() = %+v, want the %s route", route, tt.wantPath)
+			}
+		})
+	}
+
+	for _, route := range config.Hosts["example.com"] {
+		if route.Path != "/black-friday" {
+			continue
+		}
+		if route.ExpiresAt == nil || !route.ExpiresAt.Equal(expiresAt) || route.ExpiresAt.Location() != time.UTC {
+			t.Errorf("ExpiresAt = %v, want %v in UTC", route.ExpiresAt, expiresAt)
+		}
+		if got := route.Mismatch(RequestMatch{Path: "/black-friday", Time: expiresAt}); got != MismatchExpired {
+			t.Errorf("Mismatch() = %q, want %q", got, MismatchExpired)
+		}
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Second), now.Add(time.Hour)
+	hosts := map[string][]Route{
+		"a.example.com": {
+			{Path: "/old", ExpiresAt: &past},
+			{Path: "/new", ExpiresAt: &future},
+			{Path: "/"},
+		},
+		"b.example.com": {{Path: "/campaign", ExpiresAt: &past}},
+	}
+
+	if got := PruneExpired(hosts, now); got != 2 {
+		t.Errorf("PruneExpired() = %d, want 2", got)
+	}
+	if _, ok := hosts["b.example.com"]; ok {
+		t.Error("b.example.com kept without routes")
+	}
+	kept := hosts["a.example.com"]
+	if len(kept) != 2 || kept[0].Path != "/new" || kept[1].Path != "/" {
+		t.Errorf("a.example.com routes = %+v, want /new and /", kept)
+	}
+}
@@ -0,0 +1,349 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// Wire format versions of the routes document stored in ConfigMaps.
+//
+// Version 1 is the original {"version":1,"hosts":{...}} document. Version 2
+// adds a per-route id and source reference (CustomHTTPRoute and rule), a checksum of the hosts payload
+// and an optional compressed encoding. Uncompressed v2 documents stay
+// readable by v1 readers, which ignore the unknown fields.
+const (
+	FormatVersion1 = 1
+	FormatVersion2 = 2
+
+	// MaxFormatVersion is the newest format this package can read and write.
+	MaxFormatVersion = FormatVersion2
+)
+
+// EncodingGzip marks a v2 document whose hosts are carried gzip-compressed
+// and base64-encoded in the payload field instead of in hosts.
+const EncodingGzip = "gzip"
+
+// CompressedRoutesDataKey is the route ConfigMap binaryData key holding a
+// gzip-compressed routes document, written instead of the routes.json data
+// key when the document is too large to store as is.
+const CompressedRoutesDataKey = "routes.json.gz"
+
+// ErrUnsupportedFormat is returned when a document was written in a format
+// this reader does not understand.
+var ErrUnsupportedFormat = errors.New("unsupported routes format")
+
+// maxDecompressedSize bounds a compressed payload once inflated, so a
+// corrupted or hostile ConfigMap cannot exhaust the extproc's memory.
+const maxDecompressedSize = 64 << 20 // 64 MiB
+
+// EncodeOptions selects the wire format written by EncodeRoutesConfig.
+type EncodeOptions struct {
+	// Version is the format version to write. Zero means FormatVersion1.
+	Version int
+
+	// Compress stores the hosts gzip-compressed. Requires Version 2, and
+	// every reader must understand v2, since v1 readers see no routes.
+	Compress bool
+}
+
+// Validate reports whether the options describe a format that can be written.
+func (o EncodeOptions) Validate() error {
+	version := o.version()
+	if version < FormatVersion1 || version > MaxFormatVersion {
+		return fmt.Errorf("%w: version %d (supported: %d-%d)", ErrUnsupportedFormat, version, FormatVersion1, MaxFormatVersion)
+	}
+	if o.Compress && version < FormatVersion2 {
+		return fmt.Errorf("compression requires routes format version %d or later", FormatVersion2)
+	}
+	return nil
+}
+
+func (o EncodeOptions) version() int {
+	if o.Version == 0 {
+		return FormatVersion1
+	}
+	return o.Version
+}
+
+// wireConfig is the on-the-wire envelope of a v2+ routes document. Hosts is
+// kept raw so the checksum is computed over the exact bytes written, which
+// lets a reader verify documents that carry fields it does not know about.
+type wireConfig struct {
+	Version int `json:"version"`
+
+	// MinReaderVersion is the oldest format a reader must support to
+	// interpret the document. It lets a writer publish a newer version that
+	// only adds optional fields without locking out older readers.
+	MinReaderVersion int `json:"minReaderVersion,omitempty"`
+
+	// Checksum is the hex SHA-256 of the uncompressed hosts JSON.
+	Checksum string `json:"checksum,omitempty"`
+
+	Encoding string          `json:"encoding,omitempty"`
+	Payload  string          `json:"payload,omitempty"`
+	Hosts    json.RawMessage `json:"hosts,omitempty"`
+}
+
+// EncodeRoutesConfig serializes config in the requested wire format. v1
+// output is byte-identical to ToJSON, with the v2-only route fields dropped.
+func EncodeRoutesConfig(config *RoutesConfig, opts EncodeOptions) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.version() == FormatVersion1 {
+		v1 := ConvertToV1(config)
+		return v1.ToJSON()
+	}
+
+	hosts, err := marshalHosts(config.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(hosts)
+	wire := wireConfig{
+		Version:          opts.version(),
+		MinReaderVersion: FormatVersion1,
+		Checksum:         hex.EncodeToString(sum[:]),
+	}
+
+	if opts.Compress {
+		compressed, err := CompressRoutesDocument(hosts)
+		if err != nil {
+			return nil, err
+		}
+		wire.MinReaderVersion = FormatVersion2
+		wire.Encoding = EncodingGzip
+		wire.Payload = base64.StdEncoding.EncodeToString(compressed)
+	} else {
+		wire.Hosts = hosts
+	}
+
+	return json.Marshal(wire)
+}
+
+// DecodeRoutesConfig parses a routes document written in any supported
+// format. Documents newer than MaxFormatVersion are accepted only when they
+// declare a minReaderVersion this package supports; anything else fails with
+// ErrUnsupportedFormat so callers keep serving their last good config rather
+// than misreading it.
+func DecodeRoutesConfig(data []byte) (*RoutesConfig, error) {
+	var wire wireConfig
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, err
+	}
+
+	// Documents written before versioning was enforced may omit it.
+	if wire.Version == 0 {
+		wire.Version = FormatVersion1
+	}
+	if wire.Version > MaxFormatVersion &&
+		(wire.MinReaderVersion == 0 || wire.MinReaderVersion > MaxFormatVersion) {
+		return nil, fmt.Errorf("%w: version %d requires a reader for version %d, this reader supports up to %d",
+			ErrUnsupportedFormat, wire.Version, max(wire.MinReaderVersion, wire.Version), MaxFormatVersion)
+	}
+
+	hosts := []byte(wire.Hosts)
+	switch wire.Encoding {
+	case "":
+	case EncodingGzip:
+		var err error
+		if hosts, err = decompressPayload(wire.Payload); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown encoding %q", ErrUnsupportedFormat, wire.Encoding)
+	}
+
+	if wire.Checksum != "" {
+		sum := sha256.Sum256(hosts)
+		if got := hex.EncodeToString(sum[:]); got != wire.Checksum {
+			return nil, fmt.Errorf("routes checksum mismatch: got %s, want %s", got, wire.Checksum)
+		}
+	}
+
+	config := &RoutesConfig{Version: wire.Version}
+	if len(hosts) > 0 && string(hosts) != "null" {
+		if err := json.Unmarshal(hosts, &config.Hosts); err != nil {
+			return nil, fmt.Errorf("failed to parse hosts: %w", err)
+		}
+	}
+	return config, nil
+}
+
+// ConvertToV1 returns config as a v1 document, stripping the route fields v1
+// does not define. The input is returned unchanged when there is nothing to
+// strip, so the common v1-only path does not copy the route table.
+func ConvertToV1(config *RoutesConfig) *RoutesConfig {
+	if !hasV2RouteFields(config) {
+		if config.Version == FormatVersion1 {
+			return config
+		}
+		return &RoutesConfig{Version: FormatVersion1, Hosts: config.Hosts}
+	}
+	out := &RoutesConfig{
+		Version: FormatVersion1,
+		Hosts:   make(map[string][]Route, len(config.Hosts)),
+	}
+	for host, hostRoutes := range config.Hosts {
+		converted := make([]Route, len(hostRoutes))
+		for i := range hostRoutes {
+			converted[i] = hostRoutes[i]
+			converted[i].ID = ""
+			converted[i].Source = ""
+			converted[i].SourceRule = ""
+			converted[i].Owner = ""
+			converted[i].Description = ""
+		}
+		out.Hosts[host] = converted
+	}
+	return out
+}
+
+// AssignRouteIdentity stamps every route with its source CustomHTTPRoute
+// ("namespace/name") and a stable id derived from the source, host and match
+// conditions. Identity is only carried by the v2 format.
+func AssignRouteIdentity(hosts map[string][]Route, source string) {
+	for host, hostRoutes := range hosts {
+		for i := range hostRoutes {
+			hostRoutes[i].Source = source
+			hostRoutes[i].ID = routeID(source, host, &hostRoutes[i])
+		}
+	}
+}
+
+// StripRouteSource clears the Source and SourceRule of every route, keeping
+// its ID, for route documents that must not name the CustomHTTPRoutes they
+// were expanded from. Owner and Description, written for that purpose, are
+// kept.
+func StripRouteSource(hosts map[string][]Route) {
+	for _, hostRoutes := range hosts {
+		for i := range hostRoutes {
+			hostRoutes[i].Source = ""
+			hostRoutes[i].SourceRule = ""
+		}
+	}
+}
+
+// routeID hashes the fields that identify a route within its source, so the
+// id survives reconciles and changes only when the match itself changes.
+func routeID(source, host string, r *Route) string {
+	h := fnv.New64a()
+	for _, s := range []string{source, host, r.Type, r.Path, r.Method} {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	for _, hm := range r.Headers {
+		_, _ = h.Write([]byte(hm.Name + "\x01" + hm.Value + "\x01" + hm.Type + "\x02"))
+	}
+	for _, qm := range r.QueryParams {
+		_, _ = h.Write([]byte(qm.Name + "\x01" + qm.Value + "\x01" + qm.Type + "\x02"))
+	}
+	if f := r.Fraction; f != nil {
+		_, _ = fmt.Fprintf(h, "%d/%d\x03", f.Numerator, f.Denominator)
+	}
+	if r.CaseInsensitive {
+		_, _ = h.Write([]byte("caseInsensitive\x05"))
+	}
+	if r.Scheme != "" {
+		_, _ = h.Write([]byte("scheme=" + r.Scheme + "\x05"))
+	}
+	// A maintenance route must not share the id of a "/" rule match.
+	if r.Maintenance != nil {
+		_, _ = h.Write([]byte("maintenance\x04"))
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func hasV2RouteFields(config *RoutesConfig) bool {
+	for _, hostRoutes := range config.Hosts {
+		for i := range hostRoutes {
+			r := &hostRoutes[i]
+			if r.ID != "" || r.Source != "" || r.SourceRule != "" || r.Owner != "" || r.Description != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// marshalHosts serializes the hosts map with the same encoder settings as
+// ToJSON, so checksums are stable across writers.
+func marshalHosts(hosts map[string][]Route) ([]byte, error) {
+	buf := acquireJSONBuffer()
+	defer releaseJSONBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(hosts); err != nil {
+		return nil, err
+	}
+	out := bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+	return append([]byte(nil), out...), nil
+}
+
+func decompressPayload(payload string) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode compressed routes: %w", err)
+	}
+	return DecompressRoutesDocument(compressed)
+}
+
+// CompressRoutesDocument gzips a routes document, as stored under
+// CompressedRoutesDataKey.
+func CompressRoutesDocument(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress routes: %w", err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress routes: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress routes: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecompressRoutesDocument inflates a document written by
+// CompressRoutesDocument, refusing anything larger than maxDecompressedSize.
+func DecompressRoutesDocument(compressed []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress routes: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(zr, maxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress routes: %w", err)
+	}
+	if len(data) > maxDecompressedSize {
+		return nil, fmt.Errorf("decompressed routes exceed %d bytes", maxDecompressedSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func formatTestConfig() *RoutesConfig {
+	hosts := map[string][]Route{
+		"example.com": {
+			{Path: "/api", Type: RouteTypePrefix, Backend: "api.default.svc.cluster.local:8080", Priority: 1000,
+				SourceRule: "rules[0]", Owner: "team-api", Description: "Public API"},
+			{Path: "/search", Type: RouteTypeExact, Backend: "search.default.svc.cluster.local:80", Priority: 1000,
+				QueryParams: []RouteQueryParamMatch{{Name: "q", Value: "a&b"}}, SourceRule: "rules[1]"},
+		},
+	}
+	AssignRouteIdentity(hosts, "default/my-route")
+	return &RoutesConfig{Version: FormatVersion1, Hosts: hosts}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		opts EncodeOptions
+	}{
+		{name: "v1", opts: EncodeOptions{Version: FormatVersion1}},
+		{name: "v2", opts: EncodeOptions{Version: FormatVersion2}},
+		{name: "v2 compressed", opts: EncodeOptions{Version: FormatVersion2, Compress: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := formatTestConfig()
+			data, err := EncodeRoutesConfig(config, tt.opts)
+			if err != nil {
+				t.Fatalf("EncodeRoutesConfig: %v", err)
+			}
+			decoded, err := DecodeRoutesConfig(data)
+			if err != nil {
+				t.Fatalf("DecodeRoutesConfig: %v", err)
+			}
+			if decoded.Version != tt.opts.Version {
+				t.Errorf("version = %d, want %d", decoded.Version, tt.opts.Version)
+			}
+
+			want := config.Hosts
+			if tt.opts.Version == FormatVersion1 {
+				want = ConvertToV1(config).Hosts
+			}
+			if !reflect.DeepEqual(decoded.Hosts, want) {
+				t.Errorf("hosts mismatch:\n got: %+v\nwant: %+v", decoded.Hosts, want)
+			}
+		})
+	}
+}
+
+func TestEncodeV1MatchesToJSON(t *testing.T) {
+	config := formatTestConfig()
+	data, err := EncodeRoutesConfig(config, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("EncodeRoutesConfig: %v", err)
+	}
+	legacy, err := ConvertToV1(config).ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	if !bytes.Equal(data, legacy) {
+		t.Errorf("v1 encoding drifted from ToJSON:\n got: %s\nwant: %s", data, legacy)
+	}
+	if bytes.Contains(data, []byte(`"id"`)) || bytes.Contains(data, []byte(`"source"`)) ||
+		bytes.Contains(data, []byte(`"sourceRule"`)) {
+		t.Errorf("v1 encoding must not carry v2 route fields: %s", data)
+	}
+	if config.Hosts["example.com"][0].ID == "" {
+		t.Error("ConvertToV1 must not mutate its input")
+	}
+}
+
+func TestDecodeRoutesConfigCompatibility(t *testing.T) {
+	v2, err := EncodeRoutesConfig(formatTestConfig(), EncodeOptions{Version: FormatVersion2})
+	if err != nil {
+		t.Fatalf("EncodeRoutesConfig: %v", err)
+	}
+	// A future writer that only adds optional fields keeps minReaderVersion
+	// low; one that breaks compatibility raises it.
+	v3Readable := bytes.Replace(v2, []byte(`"version":2`), []byte(`"version":3,"futureField":true`), 1)
+	v3Only := bytes.Replace(v3Readable, []byte(`"minReaderVersion":1`), []byte(`"minReaderVersion":3`), 1)
+
+	tests := []struct {
+		name      string
+		data      string
+		wantErr   error
+		wantHosts int
+	}{
+		{name: "legacy document without version", data: `{"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"b:80","priority":1}]}}`, wantHosts: 1},
+		{name: "empty v1 document", data: `{"version":1,"hosts":{}}`},
+		{name: "newer version readable by v2", data: string(v3Readable), wantHosts: 1},
+		{name: "newer version requiring a newer reader", data: string(v3Only), wantErr: ErrUnsupportedFormat},
+		{name: "newer version without negotiation", data: `{"version":9,"hosts":{}}`, wantErr: ErrUnsupportedFormat},
+		{name: "unknown encoding", data: `{"version":2,"encoding":"zstd","payload":"AA=="}`, wantErr: ErrUnsupportedFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := DecodeRoutesConfig([]byte(tt.data))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeRoutesConfig: %v", err)
+			}
+			if len(config.Hosts) != tt.wantHosts {
+				t.Errorf("hosts = %d, want %d", len(config.Hosts), tt.wantHosts)
+			}
+		})
+	}
+}
+
+func TestDecodeRoutesConfigChecksumMismatch(t *testing.T) {
+	data, err := EncodeRoutesConfig(formatTestConfig(), EncodeOptions{Version: FormatVersion2})
+	if err != nil {
+		t.Fatalf("EncodeRoutesConfig: %v", err)
+	}
+	tampered := bytes.Replace(data, []byte("/api"), []byte("/apx"), 1)
+
+	if _, err := DecodeRoutesConfig(tampered); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+}
+
+func TestEncodeOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    EncodeOptions
+		wantErr bool
+	}{
+		{name: "zero value is v1", opts: EncodeOptions{}},
+		{name: "v2 compressed", opts: EncodeOptions{Version: FormatVersion2, Compress: true}},
+		{name: "compression needs v2", opts: EncodeOptions{Version: FormatVersion1, Compress: true}, wantErr: true},
+		{name: "unknown version", opts: EncodeOptions{Version: MaxFormatVersion + 1}, wantErr: true},
+		{name: "negative version", opts: EncodeOptions{Version: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAssignRouteIdentity(t *testing.T) {
+	a := formatTestConfig().Hosts["example.com"]
+	b := formatTestConfig().Hosts["example.com"]
+
+	if a[0].ID != b[0].ID {
+		t.Errorf("route id is not stable: %q vs %q", a[0].ID, b[0].ID)
+	}
+	if a[0].ID == a[1].ID {
+		t.Errorf("distinct routes share id %q", a[0].ID)
+	}
+	if a[0].Source != "default/my-route" {
+		t.Errorf("source = %q, want default/my-route", a[0].Source)
+	}
+}
+
+func TestStripRouteSource(t *testing.T) {
+	config := formatTestConfig()
+	id := config.Hosts["example.com"][0].ID
+	StripRouteSource(config.Hosts)
+
+	r := config.Hosts["example.com"][0]
+	if r.Source != "" || r.SourceRule != "" {
+		t.Errorf("source = %q, sourceRule = %q, want both empty", r.Source, r.SourceRule)
+	}
+	if r.ID != id {
+		t.Errorf("id = %q, want %q kept", r.ID, id)
+	}
+	if r.Owner != "team-api" || r.Description != "Public API" {
+		t.Errorf("owner = %q, description = %q, want both kept", r.Owner, r.Description)
+	}
+}
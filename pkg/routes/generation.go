@@ -0,0 +1,111 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// GenerationAnnotation and PartitionsAnnotation are written by the
+// controller on every route ConfigMap of a target: the generation of the
+// target's route table the ConfigMap belongs to, and how many ConfigMaps
+// that generation has. The K8sLoader only serves a generation once all of
+// its ConfigMaps are present, so a reader never merges the partitions of two
+// route tables, e.g. while the controller splits a target into more
+// ConfigMaps.
+const (
+	GenerationAnnotation = "customrouter.freepik.com/generation"
+	PartitionsAnnotation = "customrouter.freepik.com/partitions"
+)
+
+// RoutesGeneration returns the generation of a route table published in
+// the ConfigMaps named names, holding documents. It only depends on their
+// content, so republishing an unchanged table keeps the generation and does
+// not rewrite the ConfigMaps.
+func RoutesGeneration(names, documents []string) string {
+	h := fnv.New64a()
+	var length [8]byte
+	for i := range names {
+		for _, s := range []string{names[i], documents[i]} {
+			binary.BigEndian.PutUint64(length[:], uint64(len(s)))
+			_, _ = h.Write(length[:])
+			_, _ = h.Write([]byte(s))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// selectGeneration returns the route ConfigMaps to merge: those of the
+// complete generation, i.e. the one whose ConfigMaps are all present, with
+// its name. ConfigMaps written by a controller predating generations carry
+// no GenerationAnnotation; when none does, all of them are returned. ok is
+// false when no generation is complete, as while the controller is still
+// writing one.
+//
+// Should several generations be complete, as when a stale ConfigMap was not
+// deleted, the one with the most ConfigMaps, then the greatest name, wins.
+func selectGeneration(configMaps []*corev1.ConfigMap) (selected []*corev1.ConfigMap, generation string, ok bool) {
+	byGeneration := make(map[string][]*corev1.ConfigMap)
+	for _, cm := range configMaps {
+		if g := cm.Annotations[GenerationAnnotation]; g != "" {
+			byGeneration[g] = append(byGeneration[g], cm)
+		}
+	}
+	if len(byGeneration) == 0 {
+		return configMaps, "", true
+	}
+
+	generations := make([]string, 0, len(byGeneration))
+	for g := range byGeneration {
+		generations = append(generations, g)
+	}
+	sort.Strings(generations)
+	for _, g := range generations {
+		members := byGeneration[g]
+		if !generationComplete(members) {
+			continue
+		}
+		if !ok || len(members) >= len(selected) {
+			selected, generation, ok = members, g, true
+		}
+	}
+	return selected, generation, ok
+}
+
+// generationComplete reports whether members, the ConfigMaps of a
+// generation, are all of its ConfigMaps.
+func generationComplete(members []*corev1.ConfigMap) bool {
+	want := members[0].Annotations[PartitionsAnnotation]
+	partitions, err := strconv.Atoi(want)
+	if err != nil || partitions < 1 {
+		return false
+	}
+	names := make(map[string]bool, len(members))
+	for _, cm := range members {
+		if cm.Annotations[PartitionsAnnotation] != want {
+			return false
+		}
+		names[cm.Namespace+"/"+cm.Name] = true
+	}
+	return len(names) == partitions
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+// IsGuarded reports whether letting a request matching r through unrouted
+// would skip a check: a require-auth action or a maintenance response.
+func (r *Route) IsGuarded() bool {
+	if r.Maintenance != nil {
+		return true
+	}
+	for i := range r.Actions {
+		if r.Actions[i].Type == ActionTypeRequireAuth {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildGuardedIndex indexes the hosts with a guarded route (see
+// Route.IsGuarded), so HasGuardedRoutes does not scan a host's routes. Call
+// it after the routes are final.
+func (rc *RoutesConfig) BuildGuardedIndex() {
+	index := make(map[string]struct{})
+	for host, hostRoutes := range rc.Hosts {
+		for i := range hostRoutes {
+			if hostRoutes[i].IsGuarded() {
+				index[host] = struct{}{}
+				break
+			}
+		}
+	}
+	rc.guarded = index
+}
+
+// HasGuardedRoutes reports whether host has a route with a require-auth
+// action or a maintenance response, which the extproc must not fail open
+// past when overloaded.
+func (rc *RoutesConfig) HasGuardedRoutes(host string) bool {
+	if rc == nil {
+		return false
+	}
+	if rc.guarded != nil {
+		_, ok := rc.guarded[host]
+		return ok
+	}
+	for i := range rc.Hosts[host] {
+		if rc.Hosts[host][i].IsGuarded() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import "testing"
+
+func TestHasGuardedRoutes(t *testing.T) {
+	rc := &RoutesConfig{Hosts: map[string][]Route{
+		"auth.example.com": {
+			{Path: "/", Type: RouteTypePrefix},
+			{Path: "/admin", Type: RouteTypePrefix, Actions: []RouteAction{{Type: ActionTypeRequireAuth}}},
+		},
+		"down.example.com": {{Path: "/", Type: RouteTypePrefix, Maintenance: &RouteMaintenance{StatusCode: 503}}},
+		"open.example.com": {{Path: "/", Type: RouteTypePrefix, Actions: []RouteAction{{Type: ActionTypeHeaderSet}}}},
+	}}
+	want := map[string]bool{
+		"auth.example.com":    true,
+		"down.example.com":    true,
+		"open.example.com":    false,
+		"missing.example.com": false,
+	}
+	check := func(stage string) {
+		for host, guarded := range want {
+			if got := rc.HasGuardedRoutes(host); got != guarded {
+				t.Errorf("%s: HasGuardedRoutes(%q) = %v, want %v", stage, host, got, guarded)
+			}
+		}
+	}
+	check("without index")
+	rc.BuildGuardedIndex()
+	check("with index")
+}
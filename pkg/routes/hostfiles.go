@@ -0,0 +1,93 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HostFilesIndexName is the file listing the host files of a target (see
+// RenderHostFiles).
+const HostFilesIndexName = "index.json"
+
+// HostFile is the content of the file holding the routes of one host.
+type HostFile struct {
+	Host string `json:"host"`
+
+	// Routes are the routes of the host in evaluation order.
+	Routes []Route `json:"routes"`
+}
+
+// HostFilesIndex is the content of HostFilesIndexName.
+type HostFilesIndex struct {
+	// Hosts maps every host of the target to its file name.
+	Hosts map[string]string `json:"hosts"`
+}
+
+// HostFileName returns the file name holding the routes of host. Characters
+// outside [A-Za-z0-9.-], notably the "*" of wildcard hosts and the ":" of
+// ports, become "_", which hostnames never contain, so the name is valid as
+// a path segment, an object key and a ConfigMap key alike.
+func HostFileName(host string) string {
+	var b strings.Builder
+	for _, c := range host {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-':
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String() + ".json"
+}
+
+// RenderHostFiles renders the routes of config as one indented JSON file per
+// host plus HostFilesIndexName, keyed by file name. The output only depends
+// on the routes, so unchanged hosts render to the same bytes and a reviewer
+// diffing two renderings sees exactly the routes that changed.
+func RenderHostFiles(config *RoutesConfig) (map[string][]byte, error) {
+	hosts := make([]string, 0, len(config.Hosts))
+	for host := range config.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	files := make(map[string][]byte, len(hosts)+1)
+	index := HostFilesIndex{Hosts: make(map[string]string, len(hosts))}
+	for _, host := range hosts {
+		name := HostFileName(host)
+		if _, taken := files[name]; taken || name == HostFilesIndexName {
+			return nil, fmt.Errorf("host %q renders to the file %s, which another host or the index already uses", host, name)
+		}
+		data, err := json.MarshalIndent(HostFile{Host: host, Routes: config.Hosts[host]}, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to render routes of host %s: %w", host, err)
+		}
+		files[name] = append(data, '\n')
+		index.Hosts[host] = name
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to render host files index: %w", err)
+	}
+	files[HostFilesIndexName] = append(data, '\n')
+	return files, nil
+}
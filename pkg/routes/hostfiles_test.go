@@ -0,0 +1,91 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHostFileName(t *testing.T) {
+	tests := map[string]string{
+		"api.example.com":      "api.example.com.json",
+		"*.example.com":        "_.example.com.json",
+		"api.example.com:8080": "api.example.com_8080.json",
+	}
+	for host, want := range tests {
+		if got := HostFileName(host); got != want {
+			t.Errorf("HostFileName(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestRenderHostFiles(t *testing.T) {
+	config := MergeRoutesConfig(map[string][]Route{
+		"a.example.com": {{Path: "/a", Type: RouteTypePrefix, Backend: "svc-a.ns.svc.cluster.local:80"}},
+		"*.example.com": {{Path: "/", Type: RouteTypePrefix, Backend: "svc-b.ns.svc.cluster.local:80"}},
+	})
+
+	files, err := RenderHostFiles(config)
+	if err != nil {
+		t.Fatalf("RenderHostFiles() error = %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("RenderHostFiles() returned %d files, want 2 hosts and the index", len(files))
+	}
+
+	var index HostFilesIndex
+	if err := json.Unmarshal(files[HostFilesIndexName], &index); err != nil {
+		t.Fatalf("invalid index: %v", err)
+	}
+	if index.Hosts["*.example.com"] != "_.example.com.json" || index.Hosts["a.example.com"] != "a.example.com.json" {
+		t.Errorf("index = %v, want both hosts with their file names", index.Hosts)
+	}
+
+	var file HostFile
+	if err := json.Unmarshal(files["a.example.com.json"], &file); err != nil {
+		t.Fatalf("invalid host file: %v", err)
+	}
+	if file.Host != "a.example.com" || len(file.Routes) != 1 || file.Routes[0].Path != "/a" {
+		t.Errorf("host file = %+v, want the route of a.example.com", file)
+	}
+	// One field per line, so a changed route diffs as the lines it changed.
+	if !strings.Contains(string(files["a.example.com.json"]), "\n      \"path\": \"/a\",\n") {
+		t.Errorf("host file is not indented one field per line:\n%s", files["a.example.com.json"])
+	}
+
+	again, err := RenderHostFiles(config)
+	if err != nil {
+		t.Fatalf("RenderHostFiles() error = %v", err)
+	}
+	for name, data := range files {
+		if string(again[name]) != string(data) {
+			t.Errorf("%s rendered differently the second time", name)
+		}
+	}
+}
+
+func TestRenderHostFilesRejectsCollisions(t *testing.T) {
+	config := MergeRoutesConfig(map[string][]Route{
+		"*.example.com": {{Path: "/", Type: RouteTypePrefix, Backend: "a:80"}},
+		"_.example.com": {{Path: "/", Type: RouteTypePrefix, Backend: "b:80"}},
+	})
+	if _, err := RenderHostFiles(config); err == nil {
+		t.Error("RenderHostFiles() of two hosts with the same file name succeeded, want an error")
+	}
+}
@@ -17,18 +17,25 @@ limitations under the License.
 package routes
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -43,6 +50,19 @@ const (
 	routesDataKey = "routes.json"
 )
 
+// reloadRetryInterval is how long the reload loop waits before retrying a
+// rebuild that failed (e.g. the API server was briefly unavailable). The wait
+// doubles with every further consecutive failure, up to
+// maxReloadRetryInterval. Variables so tests can shorten them.
+var (
+	reloadRetryInterval    = 5 * time.Second
+	maxReloadRetryInterval = 5 * time.Minute
+)
+
+// DefaultResyncPeriod is how often the ConfigMap informer re-delivers every
+// cached ConfigMap when K8sLoaderConfig.ResyncPeriod is zero.
+const DefaultResyncPeriod = 10 * time.Minute
+
 // K8sLoader loads and watches route configurations from Kubernetes ConfigMaps
 type K8sLoader struct {
 	client          kubernetes.Interface
@@ -50,6 +70,15 @@ type K8sLoader struct {
 	namespace       string
 	partitionHeader string
 	reloadDebounce  time.Duration
+	reloadJitter    time.Duration
+	resyncPeriod    time.Duration
+	snapshotPath    string
+	onError         func(error)
+
+	allowedNamespaces map[string]bool
+	signingKey        []byte
+	encryptionKey     []byte
+	maxBytes          int
 
 	config   *RoutesConfig
 	mu       sync.RWMutex
@@ -61,10 +90,97 @@ type K8sLoader struct {
 	// pending rebuild instead of one rebuild per event.
 	dirty chan struct{}
 
+	// status tracks where the current config came from and the outcome of
+	// the last ConfigMap load; guarded by mu.
+	status LoadStatus
+
+	// merge caches the decoded ConfigMaps and merged config of the last
+	// successful build for the incremental merge in buildConfig. Guarded by
+	// buildMu, which also serializes builds.
+	merge   *mergeState
+	buildMu sync.Mutex
+
+	// lister reads the route ConfigMaps from the informer cache started by
+	// Watch, once synced reports it filled. Both are nil before Watch, when
+	// builds list from the API server. Guarded by buildMu.
+	lister listerscorev1.ConfigMapLister
+	synced cache.InformerSynced
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
+// Load sources reported in LoadStatus.Source.
+const (
+	LoadSourceNone       = ""
+	LoadSourceSnapshot   = "snapshot"
+	LoadSourceConfigMaps = "configmaps"
+	LoadSourceBucket     = "bucket"
+)
+
+// LoadStatus describes the route table currently being served.
+type LoadStatus struct {
+	// Source is where the current config came from: LoadSourceSnapshot,
+	// LoadSourceConfigMaps, LoadSourceBucket, or LoadSourceNone before
+	// anything was loaded.
+	Source string `json:"source"`
+
+	// LastLoad is when the current config was swapped in.
+	LastLoad time.Time `json:"lastLoad,omitempty"`
+
+	// LastError is the error of the most recent failed ConfigMap or bucket
+	// load, and is cleared by the next successful one.
+	LastError string `json:"lastError,omitempty"`
+
+	// ConfigHash is the RoutesConfig.Hash of the current config.
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Generation is the generation of the route ConfigMaps the current
+	// config was merged from (see GenerationAnnotation), empty for
+	// ConfigMaps without one. GenerationPending is set while the
+	// ConfigMaps of a newer generation are not all present: the current
+	// config is kept until they are.
+	Generation        string `json:"generation,omitempty"`
+	GenerationPending bool   `json:"generationPending,omitempty"`
+
+	// Hosts and Routes count the current config.
+	Hosts  int `json:"hosts"`
+	Routes int `json:"routes"`
+
+	// Regexes is the number of compiled regexes in the current config and
+	// Bytes an estimate of the memory its routes hold (see
+	// RoutesConfig.EstimatedSize).
+	Regexes int `json:"regexes"`
+	Bytes   int `json:"bytes"`
+
+	// ConfigMaps is the number of route ConfigMaps merged by the last load,
+	// and ReparsedConfigMaps how many of them were new or changed and had to
+	// be decoded. Both are zero when serving from a snapshot.
+	ConfigMaps         int `json:"configMaps,omitempty"`
+	ReparsedConfigMaps int `json:"reparsedConfigMaps,omitempty"`
+
+	// RejectedConfigMaps lists the ConfigMaps (namespace/name) the last load
+	// ignored because they are outside the allowed source namespaces or
+	// their signature did not verify.
+	RejectedConfigMaps []string `json:"rejectedConfigMaps,omitempty"`
+
+	// UnreadableConfigMaps lists the ConfigMaps (namespace/name: error) in
+	// the allowed source namespaces the last load ignored because their
+	// routes could not be decompressed or decrypted.
+	UnreadableConfigMaps []string `json:"unreadableConfigMaps,omitempty"`
+
+	// OverBudget, when set, describes the route table a load rejected for
+	// exceeding the loader's MaxBytes while the current config kept being
+	// served. It is cleared by the next config swapped in.
+	OverBudget *TableBudgetError `json:"overBudget,omitempty"`
+}
+
+// Loaded reports whether a route table (from ConfigMaps or a snapshot) is
+// being served.
+func (s LoadStatus) Loaded() bool {
+	return s.Source != LoadSourceNone
+}
+
 // K8sLoaderConfig holds configuration for the K8sLoader
 type K8sLoaderConfig struct {
 	// TargetName is the target external processor name to filter ConfigMaps
@@ -86,17 +202,77 @@ type K8sLoaderConfig struct {
 	// instead of one per ConfigMap write. Zero rebuilds on every event (legacy
 	// behaviour), though bursts still collapse via the buffered signal channel.
 	ReloadDebounce time.Duration
+
+	// ReloadJitter adds a random delay of up to this long before every
+	// rebuild, so the replicas of a target do not all rebuild at the same
+	// instant after a ConfigMap change. Zero disables it.
+	ReloadJitter time.Duration
+
+	// ResyncPeriod is how often the ConfigMap informer started by Watch
+	// re-delivers every cached ConfigMap, triggering a rebuild that only
+	// decodes what changed. When zero, DefaultResyncPeriod is used; a
+	// negative value disables resyncs.
+	ResyncPeriod time.Duration
+
+	// OnError, when set, is called with every error of a background rebuild
+	// or of the ConfigMap watch. The loader keeps serving its current config
+	// and retries either way.
+	OnError func(error)
+
+	// SnapshotPath, when non-empty, is a local file holding the last-known-good
+	// merged config (see LoadSnapshot and SaveSnapshot). It lets the extproc
+	// serve immediately on start while the ConfigMaps are still being loaded.
+	SnapshotPath string
+
+	// AllowedNamespaces, when non-empty, lists the only namespaces route
+	// ConfigMaps are loaded from. Labeled ConfigMaps elsewhere are ignored.
+	AllowedNamespaces []string
+
+	// SigningKey, when set, is the key shared with the controller: only
+	// ConfigMaps whose SignatureAnnotation verifies with it are loaded.
+	SigningKey []byte
+
+	// EncryptionKey, when set, decrypts the ConfigMaps the controller
+	// encrypts (see EncryptConfigMap). Plain ConfigMaps are loaded either
+	// way; an encrypted one without the key fails the load.
+	EncryptionKey []byte
+
+	// MaxBytes, when positive, is the largest EstimatedSize of a route
+	// table the loader serves. A load merging a larger one fails with a
+	// *TableBudgetError and the current config keeps being served.
+	MaxBytes int
 }
 
 // NewK8sLoader creates a new Kubernetes ConfigMap loader
 func NewK8sLoader(client kubernetes.Interface, config K8sLoaderConfig) *K8sLoader {
 	ctx, cancel := context.WithCancel(context.Background())
+	var allowedNamespaces map[string]bool
+	if len(config.AllowedNamespaces) > 0 {
+		allowedNamespaces = make(map[string]bool, len(config.AllowedNamespaces))
+		for _, ns := range config.AllowedNamespaces {
+			allowedNamespaces[ns] = true
+		}
+	}
+	resyncPeriod := config.ResyncPeriod
+	if resyncPeriod == 0 {
+		resyncPeriod = DefaultResyncPeriod
+	} else if resyncPeriod < 0 {
+		resyncPeriod = 0
+	}
 	return &K8sLoader{
-		client:          client,
-		targetName:      config.TargetName,
-		namespace:       config.Namespace,
-		partitionHeader: config.PartitionHeader,
-		reloadDebounce:  config.ReloadDebounce,
+		client:            client,
+		targetName:        config.TargetName,
+		namespace:         config.Namespace,
+		partitionHeader:   config.PartitionHeader,
+		reloadDebounce:    config.ReloadDebounce,
+		reloadJitter:      config.ReloadJitter,
+		resyncPeriod:      resyncPeriod,
+		snapshotPath:      config.SnapshotPath,
+		onError:           config.OnError,
+		allowedNamespaces: allowedNamespaces,
+		signingKey:        config.SigningKey,
+		encryptionKey:     config.EncryptionKey,
+		maxBytes:          config.MaxBytes,
 		config: &RoutesConfig{
 			Version: 1,
 			Hosts:   make(map[string][]Route),
@@ -111,83 +287,465 @@ func NewK8sLoader(client kubernetes.Interface, config K8sLoaderConfig) *K8sLoade
 // It builds the new config without holding the lock, then swaps it in
 // atomically so that FindRoute is never blocked on API calls.
 func (l *K8sLoader) Load() error {
-	config, err := l.buildConfig()
+	_, err := l.load()
+	return err
+}
+
+// load is Load, also reporting whether a new config was swapped in: it is
+// not while the controller is still writing the ConfigMaps of a generation.
+func (l *K8sLoader) load() (bool, error) {
+	config, stats, err := l.buildConfig()
+	if err != nil {
+		l.mu.Lock()
+		recordLoadError(&l.status, err)
+		l.mu.Unlock()
+		return false, err
+	}
+	if stats.pending {
+		l.mu.Lock()
+		l.status.GenerationPending = true
+		l.mu.Unlock()
+		return false, nil
+	}
+
+	l.swapConfig(config, LoadStatus{
+		Source:               LoadSourceConfigMaps,
+		Generation:           stats.generation,
+		ConfigMaps:           stats.configMaps,
+		ReparsedConfigMaps:   stats.reparsed,
+		RejectedConfigMaps:   stats.rejected,
+		UnreadableConfigMaps: stats.unreadable,
+	})
+	return true, nil
+}
+
+// LoadSnapshot replaces the current config with the snapshot stored at
+// SnapshotPath. It is meant for cold starts, before the first Load succeeds.
+func (l *K8sLoader) LoadSnapshot() error {
+	if l.snapshotPath == "" {
+		return fmt.Errorf("no snapshot path configured")
+	}
+	config, err := ReadSnapshot(l.snapshotPath)
 	if err != nil {
 		return err
 	}
+	if err := CheckTableBudget(config, l.maxBytes); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	config.BuildPartitionIndex(l.partitionHeader)
+	config.BuildVariantIndex()
+	config.BuildGuardedIndex()
+
+	l.swapConfig(config, LoadStatus{Source: LoadSourceSnapshot})
+	return nil
+}
+
+// swapConfig installs config as the served route table and records status,
+// completed with the load time and counts, as the load status.
+func (l *K8sLoader) swapConfig(config *RoutesConfig, status LoadStatus) {
+	status = completeLoadStatus(status, config)
 
 	l.mu.Lock()
+	defer l.mu.Unlock()
 	l.config = config
-	l.mu.Unlock()
+	l.status = status
+}
 
-	return nil
+// completeLoadStatus fills in the load time, the hash, the host and route
+// counts and the size of config, which is about to be served.
+func completeLoadStatus(status LoadStatus, config *RoutesConfig) LoadStatus {
+	status.LastLoad = time.Now()
+	status.ConfigHash = config.Hash()
+	status.Hosts = len(config.Hosts)
+	status.Routes = config.RouteCount()
+	status.Regexes = config.RegexCount()
+	status.Bytes = config.EstimatedSize()
+	return status
 }
 
-// buildConfig fetches and merges all ConfigMaps into a new RoutesConfig.
-// This is done without holding any lock.
-func (l *K8sLoader) buildConfig() (*RoutesConfig, error) {
-	// List all ConfigMaps with our labels (managed-by and target)
-	labelSelector := labels.SelectorFromSet(map[string]string{
-		configMapManagedByLabel: configMapManagedByValue,
-		configMapTargetLabel:    l.targetName,
-	})
+// Status returns the load status of the route table being served.
+func (l *K8sLoader) Status() LoadStatus {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.status
+}
 
-	configMaps, err := l.client.CoreV1().ConfigMaps(l.namespace).List(l.ctx, metav1.ListOptions{
-		LabelSelector: labelSelector.String(),
-	})
+// SaveSnapshot persists the current config to SnapshotPath. It is a no-op
+// when no snapshot path is configured.
+func (l *K8sLoader) SaveSnapshot() error {
+	if l.snapshotPath == "" {
+		return nil
+	}
+	return WriteSnapshot(l.snapshotPath, l.GetConfig())
+}
+
+// parsedConfigMap is a decoded route ConfigMap, kept between loads so an
+// unchanged ConfigMap is not decoded again. Every partition of a target gets
+// a new resourceVersion when the controller stamps a new generation on it,
+// so an unchanged one is recognized by the hash of its routes document too.
+type parsedConfigMap struct {
+	resourceVersion string
+	dataHash        [sha256.Size]byte
+	hosts           map[string][]Route
+}
+
+// mergeState is the outcome of the last successful buildConfig: the decoded
+// ConfigMaps it used and the merged config it produced.
+type mergeState struct {
+	configMaps map[string]parsedConfigMap
+	config     *RoutesConfig
+}
+
+// buildStats reports how much work a buildConfig call did.
+type buildStats struct {
+	configMaps int
+	reparsed   int
+	rejected   []string
+	unreadable []string
+
+	// generation is the generation of the ConfigMaps merged (see
+	// GenerationAnnotation), and pending is set when no build was done
+	// because no generation is complete yet.
+	generation string
+	pending    bool
+}
+
+// buildConfig fetches and merges all ConfigMaps into a new RoutesConfig.
+// This is done without holding any lock. It returns a nil config, with
+// stats.pending set, when the ConfigMaps of the newest generation are not
+// all present yet and the current config must be kept.
+//
+// The merge is incremental: ConfigMaps whose resourceVersion or routes did
+// not change since the last build are not decoded again, and hosts that appear only in
+// unchanged ConfigMaps keep their already sorted and compiled route slices
+// from the previous config. Only the hosts of added, modified or deleted
+// ConfigMaps are re-merged, so with many small ConfigMaps (see the
+// controller's host-hash partition strategy) a change to one hostname costs
+// one decode instead of a full reparse. The result is identical to a full
+// rebuild.
+func (l *K8sLoader) buildConfig() (*RoutesConfig, buildStats, error) {
+	l.buildMu.Lock()
+	defer l.buildMu.Unlock()
+
+	configMaps, err := l.listConfigMaps()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list ConfigMaps: %w", err)
+		return nil, buildStats{}, fmt.Errorf("failed to list ConfigMaps: %w", err)
 	}
 
 	// Sort by name for deterministic ordering. sort.Stable preserves the
 	// input order for equal keys; with unique ConfigMap names this matches
 	// sort.Slice, but the explicit guarantee is preferable here because the
 	// merged routes feed downstream byte-identical comparisons.
-	sort.SliceStable(configMaps.Items, func(i, j int) bool {
-		return configMaps.Items[i].Name < configMaps.Items[j].Name
+	sort.SliceStable(configMaps, func(i, j int) bool {
+		return configMaps[i].Name < configMaps[j].Name
 	})
 
-	// Merge all ConfigMaps
-	mergedConfig := &RoutesConfig{
-		Version: 1,
-		Hosts:   make(map[string][]Route),
+	prev := l.merge
+	parsed := make(map[string]parsedConfigMap, len(configMaps))
+	order := make([]string, 0, len(configMaps))
+	// changed collects the hosts that must be re-merged; nil means all.
+	var changed map[string]bool
+	if prev != nil {
+		changed = make(map[string]bool)
 	}
-
-	for _, cm := range configMaps.Items {
-		data, ok := cm.Data[routesDataKey]
+	stats := buildStats{}
+
+	trusted := make([]*corev1.ConfigMap, 0, len(configMaps))
+	documents := make(map[*corev1.ConfigMap]string, len(configMaps))
+	for _, cm := range configMaps {
+		// The namespace is checked before the routes are decompressed or
+		// decrypted, and a ConfigMap whose routes cannot be read is skipped
+		// rather than failing the load: anyone able to label a ConfigMap
+		// must not be able to block the reloads of the target.
+		if !l.allowedNamespace(cm) {
+			stats.rejected = append(stats.rejected, cm.Namespace+"/"+cm.Name)
+			continue
+		}
+		data, ok, err := ConfigMapRoutesData(cm, l.encryptionKey)
+		if errors.Is(err, ErrRoutesEncrypted) {
+			// A missing key is the external processor's misconfiguration,
+			// not the ConfigMap's: keep serving the current routes.
+			return nil, buildStats{}, fmt.Errorf("failed to read ConfigMap %s: %w", cm.Name, err)
+		}
+		if err != nil {
+			stats.unreadable = append(stats.unreadable, cm.Namespace+"/"+cm.Name+": "+err.Error())
+			continue
+		}
 		if !ok {
 			continue
 		}
+		if !l.signedSource(cm, data) {
+			stats.rejected = append(stats.rejected, cm.Namespace+"/"+cm.Name)
+			continue
+		}
+		trusted = append(trusted, cm)
+		documents[cm] = data
+	}
 
-		var config RoutesConfig
-		if err := json.Unmarshal([]byte(data), &config); err != nil {
-			return nil, fmt.Errorf("failed to parse ConfigMap %s: %w", cm.Name, err)
+	// Generations are selected among the trusted ConfigMaps only, so a
+	// rejected ConfigMap cannot complete or hold back a generation. Before
+	// anything is served, an incomplete generation is still loaded rather
+	// than serving nothing.
+	trusted, generation, complete := selectGeneration(trusted)
+	if !complete {
+		if prev != nil || l.Status().Loaded() {
+			stats.pending = true
+			return nil, stats, nil
+		}
+		generation = ""
+	}
+	stats.generation = generation
+
+	for _, cm := range trusted {
+		key := cm.Namespace + "/" + cm.Name
+		data := documents[cm]
+		order = append(order, key)
+		stats.configMaps++
+
+		var old parsedConfigMap
+		var hadOld bool
+		if prev != nil {
+			old, hadOld = prev.configMaps[key]
+		}
+		// An empty resourceVersion cannot prove the content is unchanged.
+		if hadOld && cm.ResourceVersion != "" && old.resourceVersion == cm.ResourceVersion {
+			parsed[key] = old
+			continue
+		}
+		dataHash := sha256.Sum256([]byte(data))
+		if hadOld && old.dataHash == dataHash {
+			old.resourceVersion = cm.ResourceVersion
+			parsed[key] = old
+			continue
+		}
+
+		config, err := DecodeRoutesConfig([]byte(data))
+		if err != nil {
+			return nil, buildStats{}, fmt.Errorf("failed to parse ConfigMap %s: %w", cm.Name, err)
+		}
+		stats.reparsed++
+		parsed[key] = parsedConfigMap{resourceVersion: cm.ResourceVersion, dataHash: dataHash, hosts: config.Hosts}
+
+		if changed != nil {
+			for host := range config.Hosts {
+				changed[host] = true
+			}
+			for host := range old.hosts {
+				changed[host] = true
+			}
 		}
+	}
+	if prev != nil {
+		for key, old := range prev.configMaps {
+			if _, ok := parsed[key]; !ok {
+				for host := range old.hosts {
+					changed[host] = true
+				}
+			}
+		}
+	}
 
-		// Merge hosts
-		for host, routes := range config.Hosts {
-			if existing, ok := mergedConfig.Hosts[host]; ok {
-				mergedConfig.Hosts[host] = append(existing, routes...)
-			} else {
-				mergedConfig.Hosts[host] = routes
+	// Merge all ConfigMaps
+	mergedConfig := &RoutesConfig{
+		Version: 1,
+		Hosts:   make(map[string][]Route),
+	}
+	reused := make(map[string]bool)
+
+	for _, key := range order {
+		for host, routes := range parsed[key].hosts {
+			if changed != nil && !changed[host] {
+				if prevRoutes, ok := prev.config.Hosts[host]; ok {
+					mergedConfig.Hosts[host] = prevRoutes
+					reused[host] = true
+					continue
+				}
 			}
+			mergedConfig.Hosts[host] = appendRouteCopies(mergedConfig.Hosts[host], routes)
 		}
 	}
 
-	// Sort routes for each host by priority
+	// Sort routes for each host by priority and compile their regexes
 	for host := range mergedConfig.Hosts {
+		if reused[host] {
+			continue
+		}
 		SortRoutes(mergedConfig.Hosts[host])
+		if err := compileRouteRegexes(mergedConfig.Hosts[host]); err != nil {
+			return nil, buildStats{}, fmt.Errorf("failed to compile regexes: %w", err)
+		}
 	}
 
-	// Compile regexes
-	if err := mergedConfig.CompileRegexes(); err != nil {
-		return nil, fmt.Errorf("failed to compile regexes: %w", err)
+	// A table over the budget is dropped along with the merge state, so
+	// the loader holds no more than the config it serves; the next build
+	// decodes every ConfigMap again.
+	if err := CheckTableBudget(mergedConfig, l.maxBytes); err != nil {
+		l.merge = nil
+		return nil, buildStats{}, err
 	}
 
 	// Build the header-based fast-path index (no-op when partitionHeader is empty).
 	mergedConfig.BuildPartitionIndex(l.partitionHeader)
+	mergedConfig.BuildVariantIndex()
+	mergedConfig.BuildGuardedIndex()
+
+	l.merge = &mergeState{configMaps: parsed, config: mergedConfig}
+	return mergedConfig, stats, nil
+}
+
+// labelSelector selects the route ConfigMaps of the target.
+func (l *K8sLoader) labelSelector() labels.Selector {
+	return labels.SelectorFromSet(map[string]string{
+		configMapManagedByLabel: configMapManagedByValue,
+		configMapTargetLabel:    l.targetName,
+	})
+}
+
+// ConsumerAnnotation is written by the controller on every route ConfigMap:
+// the external processor flags that load it (see ConsumerFlags), so an
+// external processor looking for its routes in the wrong namespace can tell
+// where they are.
+const ConsumerAnnotation = "customrouter.freepik.com/consumer"
+
+// ConsumerFlags returns the ConsumerAnnotation of the route ConfigMaps of
+// target written to namespace.
+func ConsumerFlags(target, namespace string) string {
+	return "--target-name=" + target + " --routes-configmap-namespace=" + namespace
+}
+
+// TargetConfigMaps lists the route ConfigMaps of target in namespace (all
+// namespaces when empty) from the API server.
+func TargetConfigMaps(ctx context.Context, client kubernetes.Interface, namespace, target string) ([]corev1.ConfigMap, error) {
+	list, err := client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			configMapManagedByLabel: configMapManagedByValue,
+			configMapTargetLabel:    target,
+		}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
 
-	return mergedConfig, nil
+// ConfigMapTargets returns the sorted targets the route ConfigMaps of
+// namespace (all namespaces when empty) are labeled with, whichever target
+// they belong to. Used to tell a target without routes from a misspelled one.
+func ConfigMapTargets(ctx context.Context, client kubernetes.Interface, namespace string) ([]string, error) {
+	list, err := client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			configMapManagedByLabel: configMapManagedByValue,
+		}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var targets []string
+	for i := range list.Items {
+		target := list.Items[i].Labels[configMapTargetLabel]
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// listConfigMaps returns the route ConfigMaps of the target: from the
+// informer cache once Watch started it and it has synced, from the API
+// server before that. The cached ConfigMaps are shared with the informer and
+// must not be modified. Callers hold buildMu.
+func (l *K8sLoader) listConfigMaps() ([]*corev1.ConfigMap, error) {
+	selector := l.labelSelector()
+	if l.lister != nil && l.synced() {
+		if l.namespace != "" {
+			return l.lister.ConfigMaps(l.namespace).List(selector)
+		}
+		return l.lister.List(selector)
+	}
+
+	list, err := l.client.CoreV1().ConfigMaps(l.namespace).List(l.ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	configMaps := make([]*corev1.ConfigMap, len(list.Items))
+	for i := range list.Items {
+		configMaps[i] = &list.Items[i]
+	}
+	return configMaps, nil
+}
+
+// ConfigMapRoutesData returns the routes document held by a route ConfigMap,
+// inflating the CompressedRoutesDataKey binaryData the controller writes for
+// large documents and decrypting the EncryptedRoutesDataKey binaryData with
+// encryptionKey. An encrypted ConfigMap without a key fails with
+// ErrRoutesEncrypted. ok is false when the ConfigMap holds none of the keys.
+func ConfigMapRoutesData(cm *corev1.ConfigMap, encryptionKey []byte) (data string, ok bool, err error) {
+	if data, ok := cm.Data[routesDataKey]; ok {
+		return data, true, nil
+	}
+	compressed, ok := cm.BinaryData[CompressedRoutesDataKey]
+	if !ok {
+		sealed, ok := cm.BinaryData[EncryptedRoutesDataKey]
+		if !ok {
+			return "", false, nil
+		}
+		if encryptionKey == nil {
+			return "", false, ErrRoutesEncrypted
+		}
+		document, err := DecryptConfigMap(encryptionKey, cm.Namespace, cm.Name, cm.Labels[configMapTargetLabel], sealed)
+		if err != nil {
+			return "", false, err
+		}
+		// The controller encrypts the compressed document of large targets.
+		if !bytes.HasPrefix(document, gzipMagic) {
+			return string(document), true, nil
+		}
+		compressed = document
+	}
+	inflated, err := DecompressRoutesDocument(compressed)
+	if err != nil {
+		return "", false, err
+	}
+	return string(inflated), true, nil
+}
+
+// allowedNamespace reports whether the route ConfigMap cm lives in one of
+// the allowed source namespaces. Nothing else of a ConfigMap outside them is
+// read.
+func (l *K8sLoader) allowedNamespace(cm *corev1.ConfigMap) bool {
+	return l.allowedNamespaces == nil || l.allowedNamespaces[cm.Namespace]
+}
+
+// signedSource reports whether the route ConfigMap cm, holding data, carries
+// a valid signature when a signing key is configured. The check runs before
+// the decoded ConfigMap cache, so a ConfigMap whose signature stops verifying
+// drops out of the merge on the next load.
+func (l *K8sLoader) signedSource(cm *corev1.ConfigMap, data string) bool {
+	if l.signingKey == nil {
+		return true
+	}
+	return VerifyConfigMap(l.signingKey, cm.Namespace, cm.Name, cm.Labels[configMapTargetLabel],
+		cm.Annotations[GenerationAnnotation], cm.Annotations[PartitionsAnnotation], data,
+		cm.Annotations[SignatureAnnotation])
+}
+
+// appendRouteCopies appends copies of routes to dst. The decoded ConfigMaps
+// are cached and shared with the config being served, so the merge must not
+// reorder their slices (SortRoutes) or write compiled regexes into their
+// header and query-param matches while FindRoute may be reading them.
+func appendRouteCopies(dst, routes []Route) []Route {
+	for _, route := range routes {
+		route.Headers = slices.Clone(route.Headers)
+		route.QueryParams = slices.Clone(route.QueryParams)
+		dst = append(dst, route)
+	}
+	return dst
 }
 
 // GetConfig returns the current routes configuration
@@ -210,16 +768,77 @@ func (l *K8sLoader) FindRoute(host string, req RequestMatch) *Route {
 	return l.config.FindRoute(host, req)
 }
 
-// Watch starts watching ConfigMaps for changes
+// TraceRoute is FindRoute also returning the routes inspected, see
+// RoutesConfig.TraceRoute.
+func (l *K8sLoader) TraceRoute(host string, req RequestMatch) (*Route, []RouteCandidate) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if idx := strings.Index(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+
+	return l.config.TraceRoute(host, req)
+}
+
+// Watch starts a ConfigMap informer and the reload loop rebuilding the
+// route table from its cache; onChange runs after every successful rebuild.
 func (l *K8sLoader) Watch(onChange func(*RoutesConfig)) error {
 	l.onChange = onChange
 
+	if err := l.startInformer(); err != nil {
+		return err
+	}
 	go l.reloadLoop()
-	go l.watchLoop()
 
 	return nil
 }
 
+// startInformer starts the shared informer caching the route ConfigMaps of
+// the target. Its events, resyncs included, only mark the config dirty: the
+// reload loop rate-limits the rebuilds, and a rebuild decodes only the
+// ConfigMaps whose resourceVersion changed.
+func (l *K8sLoader) startInformer() error {
+	selector := l.labelSelector().String()
+	factory := informers.NewSharedInformerFactoryWithOptions(l.client, l.resyncPeriod,
+		informers.WithNamespace(l.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector
+		}),
+	)
+	configMaps := factory.Core().V1().ConfigMaps()
+	informer := configMaps.Informer()
+
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { l.signalReload() },
+		UpdateFunc: func(any, any) { l.signalReload() },
+		DeleteFunc: func(any) { l.signalReload() },
+	}); err != nil {
+		return fmt.Errorf("failed to watch ConfigMaps: %w", err)
+	}
+	// The informer retries failed lists and watches with its own backoff;
+	// report the failures instead of only logging them through klog.
+	if err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		l.reportError(fmt.Errorf("watching ConfigMaps: %w", err))
+	}); err != nil {
+		return fmt.Errorf("failed to watch ConfigMaps: %w", err)
+	}
+
+	l.buildMu.Lock()
+	l.lister = configMaps.Lister()
+	l.synced = informer.HasSynced
+	l.buildMu.Unlock()
+
+	factory.Start(l.ctx.Done())
+	return nil
+}
+
+// RequestReload schedules a rebuild from the ConfigMaps on the reload loop
+// started by Watch, e.g. after serving from a snapshot on start.
+func (l *K8sLoader) RequestReload() {
+	l.signalReload()
+}
+
 // signalReload marks the config dirty without blocking. Multiple events between
 // rebuilds collapse into the single buffered slot.
 func (l *K8sLoader) signalReload() {
@@ -229,13 +848,58 @@ func (l *K8sLoader) signalReload() {
 	}
 }
 
+// reportError passes err to the OnError callback, if any.
+func (l *K8sLoader) reportError(err error) {
+	if l.onError != nil {
+		l.onError(err)
+	}
+}
+
+// reloadBackoff is how long the reload loop waits after the given number of
+// consecutive failed rebuilds: reloadRetryInterval, doubled for every
+// further failure, capped at maxReloadRetryInterval.
+func reloadBackoff(failures int) time.Duration {
+	wait := reloadRetryInterval
+	for i := 1; i < failures && wait < maxReloadRetryInterval; i++ {
+		wait *= 2
+	}
+	return min(wait, maxReloadRetryInterval)
+}
+
+// reloadJitterDelay returns a random delay in [0, jitter).
+func reloadJitterDelay(jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return rand.N(jitter)
+}
+
+// sleep waits for d, returning false if the loader is closed first.
+func (l *K8sLoader) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return l.ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-l.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
 // reloadLoop performs the actual rebuilds, decoupled from the watch event rate.
 // On the first dirty signal it (optionally) waits out the debounce window,
 // absorbing any further signals, then rebuilds the route table exactly once.
 // Under continuous ConfigMap churn this caps rebuilds at one per debounce
 // window instead of one per event — the rebuild walks the entire route set, so
 // this is the difference between idle and a pegged CPU on large configs.
+//
+// A failed rebuild is retried with exponential backoff (see reloadBackoff);
+// change signals arriving meanwhile are absorbed rather than retried early.
 func (l *K8sLoader) reloadLoop() {
+	failures := 0
 	for {
 		select {
 		case <-l.ctx.Done():
@@ -259,66 +923,34 @@ func (l *K8sLoader) reloadLoop() {
 				}
 			}
 		}
-
-		if err := l.Load(); err == nil && l.onChange != nil {
-			l.onChange(l.GetConfig())
-		}
-	}
-}
-
-func (l *K8sLoader) watchLoop() {
-	labelSelector := labels.SelectorFromSet(map[string]string{
-		configMapManagedByLabel: configMapManagedByValue,
-		configMapTargetLabel:    l.targetName,
-	})
-
-	for {
-		select {
-		case <-l.ctx.Done():
+		if !l.sleep(reloadJitterDelay(l.reloadJitter)) {
 			return
-		default:
 		}
 
-		watcher, err := l.client.CoreV1().ConfigMaps(l.namespace).Watch(l.ctx, metav1.ListOptions{
-			LabelSelector: labelSelector.String(),
-		})
+		swapped, err := l.load()
+		var budgetErr *TableBudgetError
+		if errors.As(err, &budgetErr) {
+			// The same ConfigMaps merge into the same table: wait for
+			// them to change instead of retrying.
+			failures = 0
+			l.reportError(err)
+			continue
+		}
 		if err != nil {
-			// Retry after a delay
-			select {
-			case <-l.ctx.Done():
+			// Retry later instead of waiting for the next ConfigMap event,
+			// so a transient API failure does not leave the table stale.
+			failures++
+			retry := reloadBackoff(failures)
+			l.reportError(fmt.Errorf("reloading routes (retrying in %s): %w", retry, err))
+			if !l.sleep(retry) {
 				return
-			case <-time.After(5 * time.Second):
-				continue
 			}
+			l.signalReload()
+			continue
 		}
-
-		l.handleWatchEvents(watcher)
-	}
-}
-
-func (l *K8sLoader) handleWatchEvents(watcher watch.Interface) {
-	defer watcher.Stop()
-
-	for {
-		select {
-		case <-l.ctx.Done():
-			return
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				// Watch channel closed, need to restart
-				return
-			}
-
-			switch event.Type {
-			case watch.Added, watch.Modified, watch.Deleted:
-				// Hand off to the debounced reload loop instead of rebuilding
-				// inline on every event.
-				l.signalReload()
-
-			case watch.Error:
-				// Watch error, need to restart
-				return
-			}
+		failures = 0
+		if swapped && l.onChange != nil {
+			l.onChange(l.GetConfig())
 		}
 	}
 }
@@ -17,7 +17,6 @@ limitations under the License.
 package routes
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -85,8 +84,8 @@ func (l *Loader) Load() error {
 			return fmt.Errorf("failed to read %s: %w", file, err)
 		}
 
-		var config RoutesConfig
-		if err := json.Unmarshal(data, &config); err != nil {
+		config, err := DecodeRoutesConfig(data)
+		if err != nil {
 			return fmt.Errorf("failed to parse %s: %w", file, err)
 		}
 
@@ -112,6 +111,8 @@ func (l *Loader) Load() error {
 
 	// Build the header-based fast-path index (no-op when PartitionHeader is empty).
 	mergedConfig.BuildPartitionIndex(l.PartitionHeader)
+	mergedConfig.BuildVariantIndex()
+	mergedConfig.BuildGuardedIndex()
 
 	l.config = mergedConfig
 	return nil
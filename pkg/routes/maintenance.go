@@ -0,0 +1,189 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// MaintenancePriority is the priority of maintenance routes: above any a
+// rule can set, and above the redirects of hostname aliases, so an active
+// maintenance answers before any other route of its hostname is tried.
+const MaintenancePriority = MaxPriority + 1
+
+// DefaultMaintenanceContentType is the Content-Type of a maintenance body
+// when maintenance.contentType is not set.
+const DefaultMaintenanceContentType = "text/html; charset=utf-8"
+
+// RouteMaintenance is the maintenance response of a maintenance route. The
+// route only matches requests inside the window that do not bypass it, so
+// outside of it requests fall through to the next route as if it did not
+// exist.
+type RouteMaintenance struct {
+	// Start and End bound the window; nil leaves it open on that side.
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+
+	StatusCode int32 `json:"statusCode"`
+
+	// RetryAfter is the Retry-After header value: seconds or an HTTP date.
+	RetryAfter  string `json:"retryAfter,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+
+	// BypassCIDRs lets through requests whose client address, the first
+	// X-Forwarded-For entry, is in one of them. BypassHeader (lowercased)
+	// lets through requests carrying it with the value BypassValue.
+	BypassCIDRs  []string `json:"bypassCIDRs,omitempty"`
+	BypassHeader string   `json:"bypassHeader,omitempty"`
+	BypassValue  string   `json:"bypassValue,omitempty"`
+
+	// bypassPrefixes are the parsed BypassCIDRs, populated during
+	// CompileRegexes(). Not serialized.
+	bypassPrefixes []netip.Prefix
+}
+
+// Applies reports whether the maintenance answers req: the request time is
+// inside the window and the request does not bypass it.
+func (m *RouteMaintenance) Applies(req RequestMatch) bool {
+	now := req.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if m.Start != nil && now.Before(*m.Start) {
+		return false
+	}
+	if m.End != nil && !now.Before(*m.End) {
+		return false
+	}
+	return !m.bypassed(req.Headers)
+}
+
+// bypassed reports whether a request with headers bypasses the maintenance.
+func (m *RouteMaintenance) bypassed(headers map[string]string) bool {
+	if m.BypassHeader != "" {
+		if v, ok := headers[m.BypassHeader]; ok && v == m.BypassValue {
+			return true
+		}
+	}
+	if len(m.BypassCIDRs) == 0 {
+		return false
+	}
+	xff := headers["x-forwarded-for"]
+	if i := strings.IndexByte(xff, ','); i != -1 {
+		xff = xff[:i]
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(xff))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	prefixes := m.bypassPrefixes
+	if prefixes == nil {
+		// Fallback: parse on the fly (slower)
+		prefixes = parseBypassCIDRs(m.BypassCIDRs)
+	}
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile parses BypassCIDRs. Invalid entries, which the webhook rejects,
+// are skipped.
+func (m *RouteMaintenance) compile() {
+	if len(m.BypassCIDRs) > 0 && m.bypassPrefixes == nil {
+		m.bypassPrefixes = parseBypassCIDRs(m.BypassCIDRs)
+	}
+}
+
+func parseBypassCIDRs(cidrs []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if p, err := netip.ParsePrefix(cidr); err == nil {
+			prefixes = append(prefixes, p.Masked())
+		}
+	}
+	return prefixes
+}
+
+// convertMaintenance converts spec.maintenance to the response of its
+// maintenance routes, or nil when it is not enabled.
+func convertMaintenance(m *v1alpha1.Maintenance) *RouteMaintenance {
+	if !m.IsEnabled() {
+		return nil
+	}
+	out := &RouteMaintenance{
+		StatusCode:  m.StatusCode,
+		ContentType: m.ContentType,
+		Body:        m.Body,
+	}
+	if out.StatusCode == 0 {
+		out.StatusCode = v1alpha1.DefaultMaintenanceStatusCode
+	}
+	if out.ContentType == "" && out.Body != "" {
+		out.ContentType = DefaultMaintenanceContentType
+	}
+	if m.Start != nil {
+		start := m.Start.UTC()
+		out.Start = &start
+	}
+	if m.End != nil {
+		end := m.End.UTC()
+		out.End = &end
+	}
+	switch {
+	case m.RetryAfterSeconds != nil:
+		out.RetryAfter = strconv.Itoa(int(*m.RetryAfterSeconds))
+	case out.End != nil:
+		out.RetryAfter = out.End.Format(http.TimeFormat)
+	}
+	if b := m.Bypass; b != nil {
+		out.BypassCIDRs = b.SourceCIDRs
+		if b.Header != nil {
+			out.BypassHeader = strings.ToLower(b.Header.Name)
+			out.BypassValue = b.Header.Value
+		}
+	}
+	return out
+}
+
+// maintenanceRoutes returns the maintenance routes of a hostname: one "/"
+// prefix route, or one per maintenance path.
+func maintenanceRoutes(maintenance *RouteMaintenance, paths []string) []Route {
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	out := make([]Route, len(paths))
+	for i, path := range paths {
+		out[i] = Route{
+			Path:        path,
+			Type:        RouteTypePrefix,
+			Priority:    MaintenancePriority,
+			Maintenance: maintenance,
+		}
+	}
+	return out
+}
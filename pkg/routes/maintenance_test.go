@@ -0,0 +1,137 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestExpandRoutesMaintenance(t *testing.T) {
+	start := time.Date(2026, 5, 1, 22, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{"example.com", "api.example.com"},
+			Maintenance: &v1alpha1.Maintenance{
+				Start:     &metav1.Time{Time: start},
+				End:       &metav1.Time{Time: end},
+				Hostnames: []string{"example.com"},
+				Paths:     []string{"/shop"},
+				Body:      "<h1>Back soon</h1>",
+				Bypass: &v1alpha1.MaintenanceBypass{
+					SourceCIDRs: []string{"10.0.0.0/8"},
+					Header:      &v1alpha1.MaintenanceBypassHeader{Name: "X-Maintenance-Bypass", Value: "secret"},
+				},
+			},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := len(result["api.example.com"]); got != 1 {
+		t.Errorf("api.example.com has %d routes, want only the rule route", got)
+	}
+	hostRoutes := result["example.com"]
+	if len(hostRoutes) != 2 || hostRoutes[0].Maintenance == nil {
+		t.Fatalf("example.com routes = %+v, want the maintenance route first", hostRoutes)
+	}
+	m := hostRoutes[0].Maintenance
+	if hostRoutes[0].Path != "/shop" || hostRoutes[0].Priority != MaintenancePriority {
+		t.Errorf("maintenance route = %+v, want a /shop prefix with priority %d", hostRoutes[0], MaintenancePriority)
+	}
+	if m.StatusCode != 503 || m.ContentType != DefaultMaintenanceContentType || m.BypassHeader != "x-maintenance-bypass" {
+		t.Errorf("maintenance = %+v, want the defaults and a lowercased bypass header", m)
+	}
+	if want := "Sat, 02 May 2026 00:00:00 GMT"; m.RetryAfter != want {
+		t.Errorf("RetryAfter = %q, want the end of the window %q", m.RetryAfter, want)
+	}
+
+	config := MergeRoutesConfig(result)
+	if err := config.CompileRegexes(); err != nil {
+		t.Fatalf("CompileRegexes: %v", err)
+	}
+	during := start.Add(time.Hour)
+	tests := []struct {
+		name            string
+		req             RequestMatch
+		wantMaintenance bool
+	}{
+		{"inside the window", RequestMatch{Path: "/shop/cart", Time: during}, true},
+		{"other path", RequestMatch{Path: "/blog", Time: during}, false},
+		{"before the window", RequestMatch{Path: "/shop", Time: start.Add(-time.Minute)}, false},
+		{"end is exclusive", RequestMatch{Path: "/shop", Time: end}, false},
+		{"bypass header", RequestMatch{Path: "/shop", Time: during,
+			Headers: map[string]string{"x-maintenance-bypass": "secret"}}, false},
+		{"wrong bypass header value", RequestMatch{Path: "/shop", Time: during,
+			Headers: map[string]string{"x-maintenance-bypass": "guess"}}, true},
+		{"bypass CIDR", RequestMatch{Path: "/shop", Time: during,
+			Headers: map[string]string{"x-forwarded-for": "10.1.2.3, 192.0.2.1"}}, false},
+		{"only the first forwarded address counts", RequestMatch{Path: "/shop", Time: during,
+			Headers: map[string]string{"x-forwarded-for": "192.0.2.1, 10.1.2.3"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := config.FindRoute("example.com", tt.req)
+			if route == nil {
+				t.Fatal("FindRoute() = nil, want a route")
+			}
+			if got := route.Maintenance != nil; got != tt.wantMaintenance {
+				t.Errorf("maintenance route matched = %v, want %v (route %+v)", got, tt.wantMaintenance, route)
+			}
+		})
+	}
+}
+
+func TestExpandRoutesMaintenanceDisabled(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef:   v1alpha1.TargetRef{Name: "default"},
+			Hostnames:   []string{"example.com"},
+			Maintenance: &v1alpha1.Maintenance{Enabled: new(bool)},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/"}},
+					BackendRefs: []v1alpha1.BackendRef{{Name: "web", Namespace: "default", Port: 8080}},
+				},
+			},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, route := range result["example.com"] {
+		if route.Maintenance != nil {
+			t.Errorf("got maintenance route %+v, want none while disabled", route)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import "fmt"
+
+// Match strategies: how the routes of a host are ordered, and therefore
+// which one the first-match evaluation of the extproc picks.
+const (
+	// MatchStrategyFirstMatch orders routes by priority first, then by
+	// specificity (see RouteLess). It is the default.
+	MatchStrategyFirstMatch = "FirstMatch"
+
+	// MatchStrategyMostSpecific orders routes by specificity first, like
+	// Gateway API HTTPRoutes, using priority only to break ties (see
+	// mostSpecificLess).
+	MatchStrategyMostSpecific = "MostSpecific"
+)
+
+// ValidateMatchStrategy reports an error unless strategy is one of the
+// MatchStrategy* constants.
+func ValidateMatchStrategy(strategy string) error {
+	switch strategy {
+	case MatchStrategyFirstMatch, MatchStrategyMostSpecific:
+		return nil
+	}
+	return fmt.Errorf("invalid match strategy %q (want %q or %q)",
+		strategy, MatchStrategyFirstMatch, MatchStrategyMostSpecific)
+}
+
+// ApplyMatchStrategy marks every route of rc with strategy and re-sorts the
+// routes of each host accordingly. Route slices are copied, so slices shared
+// with the configs rc was merged from are left alone. FirstMatch, the order
+// rc already has, leaves rc untouched.
+func (rc *RoutesConfig) ApplyMatchStrategy(strategy string) {
+	if strategy != MatchStrategyMostSpecific {
+		return
+	}
+	for host, hostRoutes := range rc.Hosts {
+		marked := make([]Route, len(hostRoutes))
+		copy(marked, hostRoutes)
+		for i := range marked {
+			marked[i].MostSpecific = true
+		}
+		SortRoutes(marked)
+		rc.Hosts[host] = marked
+	}
+}
+
+// matchStrategyTier splits MostSpecific routes into the ones specificity
+// does not reorder: routes at or above MaxPriority (maintenance routes and
+// hostname alias redirects) come first, and hostname fallback routes
+// (priority 0, below any rule) come last.
+func matchStrategyTier(r *Route) int {
+	switch {
+	case r.Priority >= MaxPriority:
+		return 0
+	case r.Priority < MinPriority:
+		return 2
+	}
+	return 1
+}
+
+// mostSpecificLess is RouteLess for routes of a MostSpecific host: the tier
+// (see matchStrategyTier), then specificity, then priority (descending), then
+// Precedence (descending).
+func mostSpecificLess(a, b *Route) bool {
+	if ta, tb := matchStrategyTier(a), matchStrategyTier(b); ta != tb {
+		return ta < tb
+	}
+	if c := compareSpecificity(a, b); c != 0 {
+		return c < 0
+	}
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.Precedence > b.Precedence
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyMatchStrategy(t *testing.T) {
+	newConfig := func() *RoutesConfig {
+		return &RoutesConfig{Hosts: map[string][]Route{"example.com": {
+			{Path: "/", Type: RouteTypePrefix, Priority: 0, UnmatchedPolicy: UnmatchedNotFound},
+			{Path: "/api", Type: RouteTypePrefix, Priority: 5000, Backend: "api"},
+			{Path: "/api/users", Type: RouteTypePrefix, Priority: 1000, Backend: "users"},
+			{Path: "/api/users", Type: RouteTypePrefix, Priority: 1000, Method: "POST", Backend: "users-write"},
+			{Path: "/api/users/me", Type: RouteTypeExact, Priority: 1000, Backend: "me"},
+			{Path: "/", Type: RouteTypePrefix, Priority: MaintenancePriority, Maintenance: &RouteMaintenance{}},
+		}}}
+	}
+	order := func(config *RoutesConfig) []string {
+		var out []string
+		for _, r := range config.Hosts["example.com"] {
+			name := r.Backend
+			switch {
+			case r.Maintenance != nil:
+				name = "maintenance"
+			case r.UnmatchedPolicy != "":
+				name = "fallback"
+			}
+			out = append(out, name)
+		}
+		return out
+	}
+
+	firstMatch := newConfig()
+	SortRoutes(firstMatch.Hosts["example.com"])
+	firstMatch.ApplyMatchStrategy(MatchStrategyFirstMatch)
+	want := []string{"maintenance", "api", "me", "users-write", "users", "fallback"}
+	if got := order(firstMatch); !reflect.DeepEqual(got, want) {
+		t.Errorf("FirstMatch order = %v, want %v", got, want)
+	}
+
+	mostSpecific := newConfig()
+	merged := mostSpecific.Hosts["example.com"]
+	mostSpecific.ApplyMatchStrategy(MatchStrategyMostSpecific)
+	want = []string{"maintenance", "me", "users-write", "users", "api", "fallback"}
+	if got := order(mostSpecific); !reflect.DeepEqual(got, want) {
+		t.Errorf("MostSpecific order = %v, want %v", got, want)
+	}
+	for _, r := range mostSpecific.Hosts["example.com"] {
+		if !r.MostSpecific {
+			t.Errorf("route %s %s not marked MostSpecific", r.Type, r.Path)
+		}
+	}
+	if merged[0].MostSpecific || merged[0].UnmatchedPolicy == "" {
+		t.Errorf("ApplyMatchStrategy modified the merged slice: %+v", merged[0])
+	}
+
+	// Loaders re-sort what they read; the marked routes keep their order.
+	resorted := append([]Route(nil), mostSpecific.Hosts["example.com"]...)
+	for i, j := 0, len(resorted)-1; i < j; i, j = i+1, j-1 {
+		resorted[i], resorted[j] = resorted[j], resorted[i]
+	}
+	SortRoutes(resorted)
+	if !reflect.DeepEqual(resorted, mostSpecific.Hosts["example.com"]) {
+		t.Errorf("re-sorted MostSpecific routes changed order")
+	}
+}
+
+func TestValidateMatchStrategy(t *testing.T) {
+	for _, strategy := range []string{MatchStrategyFirstMatch, MatchStrategyMostSpecific} {
+		if err := ValidateMatchStrategy(strategy); err != nil {
+			t.Errorf("ValidateMatchStrategy(%q) = %v, want nil", strategy, err)
+		}
+	}
+	for _, strategy := range []string{"", "mostspecific", "LongestMatch"} {
+		if err := ValidateMatchStrategy(strategy); err == nil {
+			t.Errorf("ValidateMatchStrategy(%q) succeeded, want an error", strategy)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"net/url"
+	"strings"
+)
+
+// MissNoHost is the RouteMiss reason of a request for a host without routes.
+// Other misses report the Mismatch reason of their nearest route, or
+// MismatchPath when no route is near.
+const MissNoHost = "no_host"
+
+// Path hints of a RouteMiss: how the request path differs from a path its
+// nearest route matches.
+const (
+	MissHintTrailingSlash    = "trailing_slash"
+	MissHintCase             = "case"
+	MissHintDuplicateSlashes = "duplicate_slashes"
+	MissHintEncoding         = "percent_encoding"
+)
+
+// RouteMiss explains why a request matched no route of its host.
+type RouteMiss struct {
+	// Reason is MissNoHost, or the Mismatch reason of Nearest.
+	Reason string
+
+	// Nearest is the route the request came closest to matching, or nil:
+	// the first route whose path matches (failing another criterion), else
+	// the first route matching a variant of the path (see Hint), else the
+	// exact or prefix route sharing the longest prefix with the path.
+	Nearest *Route
+
+	// Hint is the MissHint* variant of the path Nearest matches, if any.
+	Hint string
+
+	// CommonPrefix is the longest prefix the path shares with the path of
+	// Nearest, when Nearest was picked by it.
+	CommonPrefix string
+
+	// Evaluated is the number of routes of the host compared to the request.
+	Evaluated int
+}
+
+// ExplainMiss explains why req matched no route of host. It compares req
+// to every route of the host, several times over, so it is much slower than
+// FindRoute and meant for diagnosing misses only. Maintenance and
+// unmatched request policy routes, and routes of other variants, are left
+// out.
+func (rc *RoutesConfig) ExplainMiss(host string, req RequestMatch) RouteMiss {
+	hostRoutes, ok := rc.Hosts[host]
+	if !ok {
+		return RouteMiss{Reason: MissNoHost}
+	}
+	req.Variant = rc.hostVariant(host, req.Variant)
+
+	var candidates []*Route
+	for i := range hostRoutes {
+		r := &hostRoutes[i]
+		if r.UnmatchedPolicy != "" || r.Maintenance != nil || r.Variant != req.Variant {
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+	miss := RouteMiss{Reason: MismatchPath, Evaluated: len(candidates)}
+
+	for _, r := range candidates {
+		if r.matchPath(req.Path) {
+			miss.Nearest = r
+			miss.Reason = r.Mismatch(req)
+			return miss
+		}
+	}
+
+	variants := pathVariants(req.Path)
+	for _, r := range candidates {
+		for _, v := range variants {
+			if r.matchPath(v.path) {
+				miss.Nearest, miss.Hint = r, v.hint
+				return miss
+			}
+		}
+		if r.Type != RouteTypeRegex && !r.CaseInsensitive && r.matchPathFold(req.Path) {
+			miss.Nearest, miss.Hint = r, MissHintCase
+			return miss
+		}
+	}
+
+	longest := 0
+	for _, r := range candidates {
+		if r.Type == RouteTypeRegex {
+			continue
+		}
+		if n := commonPrefixLen(r.Path, req.Path); n > longest {
+			longest, miss.Nearest = n, r
+		}
+	}
+	miss.CommonPrefix = req.Path[:longest]
+	return miss
+}
+
+// pathVariant is a variant of a request path, and the hint naming how it
+// differs.
+type pathVariant struct {
+	path string
+	hint string
+}
+
+// pathVariants returns the variants of path that commonly explain a miss:
+// the trailing slash toggled, duplicate slashes merged and percent-encoding
+// decoded. Variants equal to path are left out.
+func pathVariants(path string) []pathVariant {
+	var variants []pathVariant
+	add := func(variant, hint string) {
+		if variant != path && variant != "" {
+			variants = append(variants, pathVariant{path: variant, hint: hint})
+		}
+	}
+	if strings.HasSuffix(path, "/") {
+		add(strings.TrimSuffix(path, "/"), MissHintTrailingSlash)
+	} else {
+		add(path+"/", MissHintTrailingSlash)
+	}
+	if strings.Contains(path, "//") {
+		merged := path
+		for strings.Contains(merged, "//") {
+			merged = strings.ReplaceAll(merged, "//", "/")
+		}
+		add(merged, MissHintDuplicateSlashes)
+	}
+	if strings.Contains(path, "%") {
+		if decoded, err := url.PathUnescape(path); err == nil {
+			add(decoded, MissHintEncoding)
+		}
+	}
+	return variants
+}
+
+// commonPrefixLen returns the length of the longest common prefix of a and
+// b, in bytes.
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import "testing"
+
+func TestExplainMiss(t *testing.T) {
+	config := &RoutesConfig{Hosts: map[string][]Route{
+		"example.com": {
+			{Path: "/checkout", Type: RouteTypeExact, Backend: "checkout:80"},
+			{Path: "/Docs", Type: RouteTypeExact, Backend: "docs:80"},
+			{Path: "/api", Type: RouteTypePrefix, Method: "POST", Backend: "api:80"},
+			{Path: "/products", Type: RouteTypePrefix, Backend: "products:80"},
+			{Path: "^/items/[0-9]+$", Type: RouteTypeRegex, Backend: "items:80"},
+			{Path: "/", Type: RouteTypePrefix, UnmatchedPolicy: UnmatchedNotFound},
+		},
+	}}
+	if err := config.CompileRegexes(); err != nil {
+		t.Fatalf("CompileRegexes failed: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		host         string
+		req          RequestMatch
+		wantReason   string
+		wantHint     string
+		wantNearest  string
+		commonPrefix string
+	}{
+		{name: "unknown host", host: "other.com", req: RequestMatch{Path: "/"}, wantReason: MissNoHost},
+		{
+			name: "path matches, method does not", host: "example.com",
+			req:        RequestMatch{Path: "/api/users", Method: "GET"},
+			wantReason: MismatchMethod, wantNearest: "/api",
+		},
+		{
+			name: "trailing slash", host: "example.com", req: RequestMatch{Path: "/checkout/"},
+			wantReason: MismatchPath, wantHint: MissHintTrailingSlash, wantNearest: "/checkout",
+		},
+		{
+			name: "duplicate slashes", host: "example.com", req: RequestMatch{Path: "//products/1"},
+			wantReason: MismatchPath, wantHint: MissHintDuplicateSlashes, wantNearest: "/products",
+		},
+		{
+			name: "percent encoding", host: "example.com", req: RequestMatch{Path: "/items/%31%32"},
+			wantReason: MismatchPath, wantHint: MissHintEncoding, wantNearest: "^/items/[0-9]+$",
+		},
+		{
+			name: "case", host: "example.com", req: RequestMatch{Path: "/docs"},
+			wantReason: MismatchPath, wantHint: MissHintCase, wantNearest: "/Docs",
+		},
+		{
+			name: "typo", host: "example.com", req: RequestMatch{Path: "/prodcts/1"},
+			wantReason: MismatchPath, wantNearest: "/products", commonPrefix: "/prod",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			miss := config.ExplainMiss(tt.host, tt.req)
+			if miss.Reason != tt.wantReason || miss.Hint != tt.wantHint || miss.CommonPrefix != tt.commonPrefix {
+				t.Errorf("ExplainMiss() = reason %q, hint %q, common prefix %q; want %q, %q, %q",
+					miss.Reason, miss.Hint, miss.CommonPrefix, tt.wantReason, tt.wantHint, tt.commonPrefix)
+			}
+			nearest := ""
+			if miss.Nearest != nil {
+				nearest = miss.Nearest.Path
+			}
+			if nearest != tt.wantNearest {
+				t.Errorf("nearest route = %q, want %q", nearest, tt.wantNearest)
+			}
+		})
+	}
+	if miss := config.ExplainMiss("example.com", RequestMatch{Path: "/x"}); miss.Evaluated != 5 {
+		t.Errorf("evaluated %d routes, want 5 without the unmatched request policy route", miss.Evaluated)
+	}
+}
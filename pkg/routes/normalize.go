@@ -0,0 +1,189 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// Path normalization options, see PathNormalization.
+const (
+	PathNormalizationMergeSlashes         = "merge-slashes"
+	PathNormalizationDecodeUnreserved     = "decode-unreserved"
+	PathNormalizationRejectEncodedSlashes = "reject-encoded-slashes"
+
+	// PathNormalizationNone disables every option, e.g. to override the
+	// extproc default from an attachment.
+	PathNormalizationNone = "none"
+)
+
+// PathNormalizationMetadataKey is the gRPC initial metadata key through which
+// an ExternalProcessorAttachment passes its pathNormalization to the extproc
+// on every ext_proc stream.
+const PathNormalizationMetadataKey = "x-customrouter-path-normalization"
+
+// PathNormalization is what the extproc normalizes in a request path before
+// matching it, so that variants of a path cannot bypass the routes written
+// for it. The query string is never touched.
+type PathNormalization struct {
+	// MergeSlashes collapses runs of slashes: //api//v1 becomes /api/v1.
+	MergeSlashes bool
+
+	// DecodeUnreserved decodes the percent-encoded unreserved characters of
+	// RFC 3986 (letters, digits, "-", ".", "_" and "~"), which mean the same
+	// encoded or not: /%61pi becomes /api.
+	DecodeUnreserved bool
+
+	// RejectEncodedSlashes rejects paths with an encoded slash or backslash
+	// (%2F, %5C), which backends disagree on whether to decode.
+	RejectEncodedSlashes bool
+}
+
+// ParsePathNormalization parses a comma-separated list of the
+// PathNormalization* options. Empty and PathNormalizationNone enable none.
+func ParsePathNormalization(s string) (PathNormalization, error) {
+	var n PathNormalization
+	for _, option := range strings.Split(s, ",") {
+		switch strings.TrimSpace(option) {
+		case "", PathNormalizationNone:
+		case PathNormalizationMergeSlashes:
+			n.MergeSlashes = true
+		case PathNormalizationDecodeUnreserved:
+			n.DecodeUnreserved = true
+		case PathNormalizationRejectEncodedSlashes:
+			n.RejectEncodedSlashes = true
+		default:
+			return PathNormalization{}, fmt.Errorf("unknown path normalization option %q", option)
+		}
+	}
+	return n, nil
+}
+
+// String formats n the way ParsePathNormalization reads it, or as
+// PathNormalizationNone when no option is enabled.
+func (n PathNormalization) String() string {
+	var options []string
+	if n.MergeSlashes {
+		options = append(options, PathNormalizationMergeSlashes)
+	}
+	if n.DecodeUnreserved {
+		options = append(options, PathNormalizationDecodeUnreserved)
+	}
+	if n.RejectEncodedSlashes {
+		options = append(options, PathNormalizationRejectEncodedSlashes)
+	}
+	if len(options) == 0 {
+		return PathNormalizationNone
+	}
+	return strings.Join(options, ",")
+}
+
+// ConvertPathNormalization maps the CRD pathNormalization to its runtime
+// form. Unset stays empty; set with every option off is
+// PathNormalizationNone.
+func ConvertPathNormalization(cfg *v1alpha1.PathNormalization) string {
+	if cfg == nil {
+		return ""
+	}
+	return PathNormalization{
+		MergeSlashes:         cfg.MergeSlashes,
+		DecodeUnreserved:     cfg.DecodeUnreserved,
+		RejectEncodedSlashes: cfg.RejectEncodedSlashes,
+	}.String()
+}
+
+// NormalizePath returns path, which must not include the query string,
+// normalized as n says, or false when n rejects it. Encoded slashes are
+// looked for after decoding, since decoding can form new escapes: /a%2%46b
+// becomes /a%2Fb.
+func NormalizePath(path string, n PathNormalization) (string, bool) {
+	if n.DecodeUnreserved && strings.IndexByte(path, '%') >= 0 {
+		path = decodeUnreserved(path)
+	}
+	if n.RejectEncodedSlashes && hasEncodedSlash(path) {
+		return "", false
+	}
+	if n.MergeSlashes && strings.Contains(path, "//") {
+		path = mergeSlashes(path)
+	}
+	return path, true
+}
+
+func hasEncodedSlash(path string) bool {
+	for i := 0; i+2 < len(path); i++ {
+		if path[i] != '%' {
+			continue
+		}
+		switch strings.ToUpper(path[i+1 : i+3]) {
+		case "2F", "5C":
+			return true
+		}
+	}
+	return false
+}
+
+// decodeUnreserved decodes the escapes of unreserved characters, leaving
+// every other escape, valid or not, as it is.
+func decodeUnreserved(path string) string {
+	var b strings.Builder
+	b.Grow(len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '%' && i+2 < len(path) {
+			hi, okHi := unhex(path[i+1])
+			lo, okLo := unhex(path[i+2])
+			if c := hi<<4 | lo; okHi && okLo && isUnreserved(c) {
+				b.WriteByte(c)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+func mergeSlashes(path string) string {
+	var b strings.Builder
+	b.Grow(len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && i > 0 && path[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestNormalizePath(t *testing.T) {
+	all := PathNormalization{MergeSlashes: true, DecodeUnreserved: true, RejectEncodedSlashes: true}
+	tests := []struct {
+		name   string
+		path   string
+		n      PathNormalization
+		want   string
+		reject bool
+	}{
+		{name: "nothing enabled", path: "//a/%61", want: "//a/%61"},
+		{name: "merge slashes", path: "//api///v1/", n: PathNormalization{MergeSlashes: true}, want: "/api/v1/"},
+		{name: "decode unreserved", path: "/%61p%49/%2d%2E%5f%7e", n: PathNormalization{DecodeUnreserved: true}, want: "/apI/-._~"},
+		{name: "reserved escapes kept", path: "/a%20b%3F%25%2F", n: PathNormalization{DecodeUnreserved: true}, want: "/a%20b%3F%25%2F"},
+		{name: "invalid escapes kept", path: "/a%zz%4", n: PathNormalization{DecodeUnreserved: true}, want: "/a%zz%4"},
+		{name: "encoded slash rejected", path: "/a%2fb", n: all, reject: true},
+		{name: "encoded backslash rejected", path: "/a%5Cb", n: all, reject: true},
+		{name: "encoded slash formed by decoding rejected", path: "/a%2%46b", n: all, reject: true},
+		{name: "encoded backslash formed by decoding rejected", path: "/a%%35Cb", n: all, reject: true},
+		{name: "everything", path: "//%61pi//v1", n: all, want: "/api/v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NormalizePath(tt.path, tt.n)
+			if ok == tt.reject {
+				t.Fatalf("NormalizePath(%q) ok = %v, want %v", tt.path, ok, !tt.reject)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePathNormalization(t *testing.T) {
+	for _, s := range []string{"", "none", "merge-slashes", "merge-slashes,decode-unreserved,reject-encoded-slashes"} {
+		n, err := ParsePathNormalization(s)
+		if err != nil {
+			t.Fatalf("ParsePathNormalization(%q): %v", s, err)
+		}
+		want := s
+		if want == "" {
+			want = PathNormalizationNone
+		}
+		if n.String() != want {
+			t.Errorf("ParsePathNormalization(%q).String() = %q", s, n.String())
+		}
+	}
+	if _, err := ParsePathNormalization("merge-slashes,lowercase"); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+
+	if got := ConvertPathNormalization(nil); got != "" {
+		t.Errorf("ConvertPathNormalization(nil) = %q, want empty", got)
+	}
+	if got := ConvertPathNormalization(&v1alpha1.PathNormalization{}); got != PathNormalizationNone {
+		t.Errorf("ConvertPathNormalization(off) = %q, want %q", got, PathNormalizationNone)
+	}
+	if got := ConvertPathNormalization(&v1alpha1.PathNormalization{DecodeUnreserved: true}); got != "decode-unreserved" {
+		t.Errorf("ConvertPathNormalization(decodeUnreserved) = %q", got)
+	}
+}
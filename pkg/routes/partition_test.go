@@ -71,6 +71,18 @@ func TestRoutePartitionValue(t *testing.T) {
 			want:   "",
 			wantOK: false,
 		},
+		{
+			name:   "absent env header is unpartitioned",
+			route:  Route{Headers: []RouteHeaderMatch{{Name: "env", Type: HeaderMatchAbsent}}},
+			want:   "",
+			wantOK: false,
+		},
+		{
+			name:   "not-value env header is unpartitioned",
+			route:  Route{Headers: []RouteHeaderMatch{{Name: "env", Value: "sbx-a", Type: HeaderMatchNotValue}}},
+			want:   "",
+			wantOK: false,
+		},
 		{
 			name:   "header name match is case-insensitive",
 			route:  Route{Headers: []RouteHeaderMatch{{Name: "Env", Value: "sbx-c"}}},
@@ -0,0 +1,140 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// Priority limits, as enforced by the CRD schema.
+const (
+	MinPriority int32 = 1
+	MaxPriority int32 = 10000
+)
+
+// PriorityBands are the priorities given to matches that set none, neither
+// directly nor through spec.defaults.priority, by match type.
+type PriorityBands struct {
+	Exact  int32
+	Regex  int32
+	Prefix int32
+}
+
+// UniformPriorityBands returns bands giving every match type priority.
+func UniformPriorityBands(priority int32) PriorityBands {
+	return PriorityBands{Exact: priority, Regex: priority, Prefix: priority}
+}
+
+// priorityBands is set once at startup by SetPriorityBands, before any route
+// is expanded, and only read afterwards.
+var priorityBands = UniformPriorityBands(v1alpha1.DefaultPriority)
+
+// SetPriorityBands sets the priorities ExpandRoutes gives matches without
+// one. It must be called before routes are expanded: changing it while the
+// controller runs would reorder routes without any CustomHTTPRoute changing.
+func SetPriorityBands(bands PriorityBands) {
+	priorityBands = bands
+}
+
+// CurrentPriorityBands returns the bands set with SetPriorityBands.
+func CurrentPriorityBands() PriorityBands {
+	return priorityBands
+}
+
+// For returns the band of matchType. An empty type is a PathPrefix.
+func (b PriorityBands) For(matchType v1alpha1.MatchType) int32 {
+	switch matchType {
+	case v1alpha1.MatchTypeExact:
+		return b.Exact
+	case v1alpha1.MatchTypeRegex:
+		return b.Regex
+	default:
+		return b.Prefix
+	}
+}
+
+// Validate checks that every band is a valid priority.
+func (b PriorityBands) Validate() error {
+	for _, band := range []struct {
+		name     string
+		priority int32
+	}{{"exact", b.Exact}, {"regex", b.Regex}, {"prefix", b.Prefix}} {
+		if band.priority < MinPriority || band.priority > MaxPriority {
+			return fmt.Errorf("%s priority %d is out of range [%d, %d]", band.name, band.priority, MinPriority, MaxPriority)
+		}
+	}
+	return nil
+}
+
+// String formats the bands the way ParsePriorityBands reads them.
+func (b PriorityBands) String() string {
+	return fmt.Sprintf("exact=%d,regex=%d,prefix=%d", b.Exact, b.Regex, b.Prefix)
+}
+
+// ParsePriorityBands parses bands written as "exact=3000,regex=2000,prefix=1000".
+// Match types left out get defaultPriority.
+func ParsePriorityBands(value string, defaultPriority int32) (PriorityBands, error) {
+	bands := UniformPriorityBands(defaultPriority)
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok {
+			return PriorityBands{}, fmt.Errorf("invalid priority band %q: expected type=priority", entry)
+		}
+		if seen[name] {
+			return PriorityBands{}, fmt.Errorf("duplicate priority band for %q", name)
+		}
+		seen[name] = true
+		priority, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 32)
+		if err != nil {
+			return PriorityBands{}, fmt.Errorf("invalid priority band %q: %w", entry, err)
+		}
+		switch name {
+		case "exact":
+			bands.Exact = int32(priority)
+		case "regex":
+			bands.Regex = int32(priority)
+		case "prefix":
+			bands.Prefix = int32(priority)
+		default:
+			return PriorityBands{}, fmt.Errorf("invalid priority band %q: type must be exact, regex or prefix", entry)
+		}
+	}
+	if err := bands.Validate(); err != nil {
+		return PriorityBands{}, err
+	}
+	return bands, nil
+}
+
+// EffectivePriority returns the priority of a match of matchType: priority
+// when set (spec.defaults.priority is applied to it beforehand), the match
+// type's band otherwise.
+func EffectivePriority(matchType v1alpha1.MatchType, priority int32) int32 {
+	if priority > 0 {
+		return priority
+	}
+	return priorityBands.For(matchType)
+}
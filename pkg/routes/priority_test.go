@@ -0,0 +1,105 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestParsePriorityBands(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    PriorityBands
+		wantErr bool
+	}{
+		{name: "empty uses the default", value: "", want: UniformPriorityBands(1000)},
+		{name: "all types", value: "exact=3000, regex=2000, prefix=1000", want: PriorityBands{Exact: 3000, Regex: 2000, Prefix: 1000}},
+		{name: "unlisted types use the default", value: "Exact=3000", want: PriorityBands{Exact: 3000, Regex: 1000, Prefix: 1000}},
+		{name: "unknown type", value: "glob=10", wantErr: true},
+		{name: "duplicate type", value: "exact=10,exact=20", wantErr: true},
+		{name: "missing priority", value: "exact", wantErr: true},
+		{name: "not a number", value: "exact=high", wantErr: true},
+		{name: "out of range", value: "regex=10001", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePriorityBands(tt.value, 1000)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParsePriorityBands("", 0); err == nil {
+		t.Error("expected an error for default priority 0")
+	}
+}
+
+func TestExpandRoutesPriorityBands(t *testing.T) {
+	defer SetPriorityBands(CurrentPriorityBands())
+	SetPriorityBands(PriorityBands{Exact: 3000, Regex: 2000, Prefix: 1000})
+
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			Hostnames: []string{"example.com"},
+			Rules: []v1alpha1.Rule{{
+				Matches: []v1alpha1.PathMatch{
+					{Path: "/a", Type: v1alpha1.MatchTypeExact},
+					{Path: "^/b$", Type: v1alpha1.MatchTypeRegex},
+					{Path: "/c"},
+					{Path: "/d", Type: v1alpha1.MatchTypeExact, Priority: 500},
+				},
+				BackendRefs: []v1alpha1.BackendRef{{Name: "svc", Namespace: "default", Port: 80}},
+			}},
+		},
+	}
+	hosts, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("ExpandRoutes: %v", err)
+	}
+	want := map[string]int32{"/a": 3000, "^/b$": 2000, "/c": 1000, "/d": 500}
+	for _, r := range hosts["example.com"] {
+		if r.Priority != want[r.Path] {
+			t.Errorf("%s: priority = %d, want %d", r.Path, r.Priority, want[r.Path])
+		}
+	}
+
+	// spec.defaults.priority still wins over the bands.
+	cr.Spec.Defaults = &v1alpha1.RuleDefaults{Priority: 1500}
+	hosts, err = ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("ExpandRoutes: %v", err)
+	}
+	want = map[string]int32{"/a": 1500, "^/b$": 1500, "/c": 1500, "/d": 500}
+	for _, r := range hosts["example.com"] {
+		if r.Priority != want[r.Path] {
+			t.Errorf("%s with defaults: priority = %d, want %d", r.Path, r.Priority, want[r.Path])
+		}
+	}
+}
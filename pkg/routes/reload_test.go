@@ -17,6 +17,12 @@ limitations under the License.
 package routes
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -26,6 +32,7 @@ import (
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
 	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 )
 
 func routesConfigMap() *corev1.ConfigMap {
@@ -125,3 +132,459 @@ func TestSignalReloadNeverBlocks(t *testing.T) {
 		t.Fatal("signalReload blocked")
 	}
 }
+
+func shardConfigMap(name, resourceVersion, data string) *corev1.ConfigMap {
+	cm := routesConfigMap()
+	cm.Name = name
+	cm.ResourceVersion = resourceVersion
+	cm.Data = map[string]string{routesDataKey: data}
+	return cm
+}
+
+// TestLoadMergesIncrementally asserts that a reload only decodes the
+// ConfigMaps whose resourceVersion changed, keeps the route slices of
+// untouched hosts, and still produces the same table as a full rebuild.
+func TestLoadMergesIncrementally(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewSimpleClientset(
+		shardConfigMap("cm-0", "1", `{"version":1,"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"a:80"}],"shared.com":[{"path":"/x","type":"prefix","backend":"x:80"}]}}`),
+		shardConfigMap("cm-1", "1", `{"version":1,"hosts":{"b.com":[{"path":"/","type":"prefix","backend":"b:80"}],"shared.com":[{"path":"/y","type":"exact","backend":"y:80"}]}}`),
+	)
+	l := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default"})
+	defer func() { _ = l.Close() }()
+
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if status := l.Status(); status.ConfigMaps != 2 || status.ReparsedConfigMaps != 2 {
+		t.Fatalf("first load status = %+v, want 2 ConfigMaps reparsed", status)
+	}
+	first := l.GetConfig()
+
+	updated := shardConfigMap("cm-1", "2", `{"version":1,"hosts":{"b.com":[{"path":"/","type":"prefix","backend":"b2:80"}],"shared.com":[{"path":"/y","type":"exact","backend":"y:80"}]}}`)
+	if _, err := cs.CoreV1().ConfigMaps("default").Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	second := l.GetConfig()
+
+	if status := l.Status(); status.ReparsedConfigMaps != 1 {
+		t.Errorf("second load reparsed %d ConfigMaps, want 1", status.ReparsedConfigMaps)
+	}
+	if &second.Hosts["a.com"][0] != &first.Hosts["a.com"][0] {
+		t.Error("host a.com only lives in the unchanged ConfigMap and should be reused")
+	}
+	if got := second.FindRoute("b.com", RequestMatch{Path: "/"}); got == nil || got.Backend != "b2:80" {
+		t.Errorf("b.com route = %+v, want backend b2:80", got)
+	}
+	if got := second.FindRoute("shared.com", RequestMatch{Path: "/x"}); got == nil || got.Backend != "x:80" {
+		t.Errorf("shared.com lost the routes of the unchanged ConfigMap: %+v", got)
+	}
+
+	full := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default"})
+	defer func() { _ = full.Close() }()
+	if err := full.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(second.Hosts, full.GetConfig().Hosts) {
+		t.Errorf("incremental merge differs from a full rebuild:\n got: %+v\nwant: %+v", second.Hosts, full.GetConfig().Hosts)
+	}
+
+	if err := cs.CoreV1().ConfigMaps("default").Delete(ctx, "cm-0", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	third := l.GetConfig()
+	if _, ok := third.Hosts["a.com"]; ok {
+		t.Error("hosts of a deleted ConfigMap must be dropped")
+	}
+	if got := third.Hosts["shared.com"]; len(got) != 1 || got[0].Backend != "y:80" {
+		t.Errorf("shared.com = %+v, want only the route of the remaining ConfigMap", got)
+	}
+	if status := l.Status(); status.ReparsedConfigMaps != 0 || status.ConfigMaps != 1 {
+		t.Errorf("status after delete = %+v, want 1 ConfigMap and nothing reparsed", status)
+	}
+}
+
+// generationConfigMap is shardConfigMap stamped with a generation of
+// partitions ConfigMaps.
+func generationConfigMap(name, resourceVersion, data, generation string, partitions int) *corev1.ConfigMap {
+	cm := shardConfigMap(name, resourceVersion, data)
+	cm.Annotations = map[string]string{
+		GenerationAnnotation: generation,
+		PartitionsAnnotation: strconv.Itoa(partitions),
+	}
+	return cm
+}
+
+// TestLoadReusesPartitionsOfNewGeneration asserts that a partition whose
+// routes did not change is not decoded again when a new generation stamped
+// on it changed its resourceVersion.
+func TestLoadReusesPartitionsOfNewGeneration(t *testing.T) {
+	ctx := context.Background()
+	a := `{"version":1,"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"a:80"}]}}`
+	cs := fake.NewSimpleClientset(
+		generationConfigMap("cm-0", "1", a, "g1", 2),
+		generationConfigMap("cm-1", "1", `{"version":1,"hosts":{"b.com":[{"path":"/","type":"prefix","backend":"b:80"}]}}`, "g1", 2),
+	)
+	l := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default"})
+	defer func() { _ = l.Close() }()
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	first := l.GetConfig()
+
+	for _, cm := range []*corev1.ConfigMap{
+		generationConfigMap("cm-0", "2", a, "g2", 2),
+		generationConfigMap("cm-1", "2", `{"version":1,"hosts":{"b.com":[{"path":"/","type":"prefix","backend":"b2:80"}]}}`, "g2", 2),
+	} {
+		if _, err := cs.CoreV1().ConfigMaps("default").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	status := l.Status()
+	if status.Generation != "g2" || status.ReparsedConfigMaps != 1 {
+		t.Errorf("status = %+v, want generation g2 with 1 ConfigMap reparsed", status)
+	}
+	second := l.GetConfig()
+	if &second.Hosts["a.com"][0] != &first.Hosts["a.com"][0] {
+		t.Error("host a.com only lives in the unchanged partition and should be reused")
+	}
+	if got := second.FindRoute("b.com", RequestMatch{Path: "/"}); got == nil || got.Backend != "b2:80" {
+		t.Errorf("b.com route = %+v, want backend b2:80", got)
+	}
+}
+
+// TestLoadWaitsForCompleteGeneration asserts that, while the controller
+// splits a target into two ConfigMaps, the loader keeps serving the old
+// table until both ConfigMaps of the new generation are written.
+func TestLoadWaitsForCompleteGeneration(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewSimpleClientset(generationConfigMap("cm-0", "1",
+		`{"version":1,"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"a:80"}],"b.com":[{"path":"/","type":"prefix","backend":"b:80"}]}}`,
+		"g1", 1))
+	l := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default"})
+	defer func() { _ = l.Close() }()
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	split := generationConfigMap("cm-0", "2",
+		`{"version":1,"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"a2:80"}]}}`, "g2", 2)
+	if _, err := cs.CoreV1().ConfigMaps("default").Update(ctx, split, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	swapped, err := l.load()
+	if err != nil || swapped {
+		t.Fatalf("load() = %v, %v; want the half-written generation held back", swapped, err)
+	}
+	if status := l.Status(); status.Generation != "g1" || !status.GenerationPending {
+		t.Errorf("status = %+v, want generation g1 served and g2 pending", status)
+	}
+	if got := l.FindRoute("b.com", RequestMatch{Path: "/"}); got == nil || got.Backend != "b:80" {
+		t.Errorf("b.com route = %+v, want the old table kept", got)
+	}
+
+	second := generationConfigMap("cm-1", "3",
+		`{"version":1,"hosts":{"b.com":[{"path":"/","type":"prefix","backend":"b2:80"}]}}`, "g2", 2)
+	if _, err := cs.CoreV1().ConfigMaps("default").Create(ctx, second, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if swapped, err := l.load(); err != nil || !swapped {
+		t.Fatalf("load() = %v, %v; want the complete generation swapped in", swapped, err)
+	}
+	if status := l.Status(); status.Generation != "g2" || status.GenerationPending {
+		t.Errorf("status = %+v, want generation g2 served", status)
+	}
+	for host, backend := range map[string]string{"a.com": "a2:80", "b.com": "b2:80"} {
+		if got := l.FindRoute(host, RequestMatch{Path: "/"}); got == nil || got.Backend != backend {
+			t.Errorf("%s route = %+v, want backend %s", host, got, backend)
+		}
+	}
+}
+
+// TestSelectGeneration asserts which ConfigMaps are merged.
+func TestSelectGeneration(t *testing.T) {
+	legacy := shardConfigMap("cm-0", "1", "")
+	old := generationConfigMap("cm-1", "1", "", "g1", 2)
+	current := []*corev1.ConfigMap{
+		generationConfigMap("cm-0", "2", "", "g2", 2),
+		generationConfigMap("cm-1", "2", "", "g2", 2),
+	}
+
+	if got, g, ok := selectGeneration([]*corev1.ConfigMap{legacy}); !ok || g != "" || len(got) != 1 {
+		t.Errorf("ConfigMaps without generations: got %d, %q, %v; want all of them", len(got), g, ok)
+	}
+	if _, _, ok := selectGeneration([]*corev1.ConfigMap{current[0], old}); ok {
+		t.Error("no generation is complete, want ok false")
+	}
+	if got, g, ok := selectGeneration(append([]*corev1.ConfigMap{old}, current...)); !ok || g != "g2" || len(got) != 2 {
+		t.Errorf("got %d ConfigMaps of %q, %v; want the 2 of g2", len(got), g, ok)
+	}
+}
+
+// TestLoadSkipsUntrustedConfigMaps asserts that ConfigMaps outside the
+// allowed namespaces or without a valid signature are left out of the merge
+// and reported in the load status.
+func TestLoadSkipsUntrustedConfigMaps(t *testing.T) {
+	key := []byte("shared-secret")
+	sign := func(cm *corev1.ConfigMap) *corev1.ConfigMap {
+		cm.Annotations = map[string]string{
+			SignatureAnnotation: SignConfigMap(key, cm.Namespace, cm.Name, cm.Labels[configMapTargetLabel], "", "", cm.Data[routesDataKey]),
+		}
+		return cm
+	}
+	withHost := func(cm *corev1.ConfigMap, ns, name, host string) *corev1.ConfigMap {
+		cm.Namespace, cm.Name = ns, name
+		cm.Data[routesDataKey] = `{"version":1,"hosts":{"` + host + `":[{"path":"/","type":"prefix","backend":"svc:80"}]}}`
+		return cm
+	}
+
+	trusted := sign(withHost(routesConfigMap(), "routes", "customrouter-routes-default-0", "trusted.com"))
+	otherNamespace := sign(withHost(routesConfigMap(), "team-a", "customrouter-routes-default-0", "other-ns.com"))
+	unsigned := withHost(routesConfigMap(), "routes", "customrouter-routes-default-1", "unsigned.com")
+	forged := withHost(routesConfigMap(), "routes", "customrouter-routes-default-2", "forged.com")
+	forged.Annotations = map[string]string{SignatureAnnotation: trusted.Annotations[SignatureAnnotation]}
+	// Outside the allowed namespaces nothing is read, so corrupted routes
+	// neither fail the load nor count as unreadable.
+	corrupted := withHost(routesConfigMap(), "team-b", "customrouter-routes-default-0", "corrupted.com")
+	corrupted.Data = nil
+	corrupted.BinaryData = map[string][]byte{CompressedRoutesDataKey: []byte("not gzip")}
+
+	cs := fake.NewSimpleClientset(trusted, otherNamespace, unsigned, forged, corrupted)
+	l := NewK8sLoader(cs, K8sLoaderConfig{
+		TargetName:        "default",
+		AllowedNamespaces: []string{"routes"},
+		SigningKey:        key,
+	})
+	defer func() { _ = l.Close() }()
+
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	hosts := l.GetConfig().Hosts
+	if _, ok := hosts["trusted.com"]; !ok || len(hosts) != 1 {
+		t.Errorf("hosts = %v, want only trusted.com", hosts)
+	}
+	want := []string{
+		"routes/customrouter-routes-default-1",
+		"routes/customrouter-routes-default-2",
+		"team-a/customrouter-routes-default-0",
+		"team-b/customrouter-routes-default-0",
+	}
+	if got := slices.Sorted(slices.Values(l.Status().RejectedConfigMaps)); !reflect.DeepEqual(got, want) {
+		t.Errorf("RejectedConfigMaps = %v, want %v", got, want)
+	}
+	if unreadable := l.Status().UnreadableConfigMaps; len(unreadable) != 0 {
+		t.Errorf("UnreadableConfigMaps = %v, want none", unreadable)
+	}
+}
+
+// TestLoadSkipsUndecryptableConfigMaps asserts that ConfigMaps are only
+// decrypted once their namespace is allowed, and that one sealed with
+// another key is left out without failing the load.
+func TestLoadSkipsUndecryptableConfigMaps(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	encrypt := func(cm *corev1.ConfigMap, key []byte) *corev1.ConfigMap {
+		sealed, err := EncryptConfigMap(key, cm.Namespace, cm.Name, "default", []byte(cm.Data[routesDataKey]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cm.Data = nil
+		cm.BinaryData = map[string][]byte{EncryptedRoutesDataKey: sealed}
+		return cm
+	}
+	withHost := func(ns, name, host string) *corev1.ConfigMap {
+		cm := routesConfigMap()
+		cm.Namespace, cm.Name = ns, name
+		cm.Data[routesDataKey] = `{"version":1,"hosts":{"` + host + `":[{"path":"/","type":"prefix","backend":"svc:80"}]}}`
+		return cm
+	}
+
+	trusted := encrypt(withHost("routes", "customrouter-routes-default-0", "trusted.com"), key)
+	otherKey := encrypt(withHost("routes", "customrouter-routes-default-1", "other-key.com"), []byte("fedcba9876543210"))
+	// Sealed with the right key, but outside the allowed namespaces: it is
+	// rejected before being decrypted.
+	forged := encrypt(withHost("team-a", "customrouter-routes-default-0", "forged.com"), key)
+
+	cs := fake.NewSimpleClientset(trusted, otherKey, forged)
+	l := NewK8sLoader(cs, K8sLoaderConfig{
+		TargetName:        "default",
+		AllowedNamespaces: []string{"routes"},
+		EncryptionKey:     key,
+	})
+	defer func() { _ = l.Close() }()
+
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	hosts := l.GetConfig().Hosts
+	if _, ok := hosts["trusted.com"]; !ok || len(hosts) != 1 {
+		t.Errorf("hosts = %v, want only trusted.com", hosts)
+	}
+	status := l.Status()
+	if !reflect.DeepEqual(status.RejectedConfigMaps, []string{"team-a/customrouter-routes-default-0"}) {
+		t.Errorf("RejectedConfigMaps = %v, want the team-a ConfigMap", status.RejectedConfigMaps)
+	}
+	if len(status.UnreadableConfigMaps) != 1 ||
+		!strings.HasPrefix(status.UnreadableConfigMaps[0], "routes/customrouter-routes-default-1: ") {
+		t.Errorf("UnreadableConfigMaps = %v, want the ConfigMap sealed with another key", status.UnreadableConfigMaps)
+	}
+}
+
+// TestLoadInflatesCompressedConfigMaps asserts that a ConfigMap carrying its
+// routes gzip-compressed in binaryData loads like a plain one, and that a
+// corrupted one is left out and reported without failing the load.
+func TestLoadInflatesCompressedConfigMaps(t *testing.T) {
+	document := `{"version":1,"hosts":{"gz.com":[{"path":"/","type":"prefix","backend":"gz:80"}]}}`
+	compressed, err := CompressRoutesDocument([]byte(document))
+	if err != nil {
+		t.Fatalf("CompressRoutesDocument: %v", err)
+	}
+	gz := shardConfigMap("cm-1", "1", "")
+	gz.Data = nil
+	gz.BinaryData = map[string][]byte{CompressedRoutesDataKey: compressed}
+
+	cs := fake.NewSimpleClientset(routesConfigMap(), gz)
+	l := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default"})
+	defer func() { _ = l.Close() }()
+
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	config := l.GetConfig()
+	if got := config.FindRoute("gz.com", RequestMatch{Path: "/"}); got == nil || got.Backend != "gz:80" {
+		t.Errorf("gz.com route = %+v, want backend gz:80", got)
+	}
+	if _, ok := config.Hosts["a.com"]; !ok {
+		t.Error("routes of the uncompressed ConfigMap are missing")
+	}
+
+	gz.ResourceVersion = "2"
+	gz.BinaryData[CompressedRoutesDataKey] = []byte("not gzip")
+	if _, err := cs.CoreV1().ConfigMaps("default").Update(context.Background(), gz, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load with a corrupted ConfigMap: %v", err)
+	}
+	config = l.GetConfig()
+	if _, ok := config.Hosts["gz.com"]; ok {
+		t.Error("routes of the corrupted ConfigMap are still served")
+	}
+	if _, ok := config.Hosts["a.com"]; !ok {
+		t.Error("routes of the readable ConfigMap are missing")
+	}
+	unreadable := l.Status().UnreadableConfigMaps
+	if len(unreadable) != 1 || !strings.HasPrefix(unreadable[0], "default/cm-1: ") || !strings.Contains(unreadable[0], "decompress") {
+		t.Errorf("UnreadableConfigMaps = %v, want default/cm-1 with a decompression error", unreadable)
+	}
+}
+
+func TestReloadBackoff(t *testing.T) {
+	oldRetry, oldMax := reloadRetryInterval, maxReloadRetryInterval
+	reloadRetryInterval, maxReloadRetryInterval = time.Second, 10*time.Second
+	defer func() { reloadRetryInterval, maxReloadRetryInterval = oldRetry, oldMax }()
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := reloadBackoff(i + 1); got != w {
+			t.Errorf("reloadBackoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestReloadJitterDelay(t *testing.T) {
+	if got := reloadJitterDelay(0); got != 0 {
+		t.Errorf("reloadJitterDelay(0) = %s, want 0", got)
+	}
+	for i := 0; i < 100; i++ {
+		if got := reloadJitterDelay(time.Second); got < 0 || got >= time.Second {
+			t.Fatalf("reloadJitterDelay(1s) = %s, want it in [0, 1s)", got)
+		}
+	}
+}
+
+// TestReloadLoopReportsErrors asserts that a failed rebuild reaches OnError
+// and is retried after the backoff.
+func TestReloadLoopReportsErrors(t *testing.T) {
+	oldRetry := reloadRetryInterval
+	reloadRetryInterval = 20 * time.Millisecond
+	defer func() { reloadRetryInterval = oldRetry }()
+
+	cs, lists := countingClient()
+	var failures int32 = 1
+	cs.PrependReactor("list", "configmaps", func(clienttesting.Action) (bool, k8sruntime.Object, error) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			return true, nil, errors.New("api server unavailable")
+		}
+		return false, nil, nil
+	})
+	reported := make(chan error, 10)
+	l := NewK8sLoader(cs, K8sLoaderConfig{
+		TargetName: "default",
+		OnError:    func(err error) { reported <- err },
+	})
+	defer func() { _ = l.Close() }()
+
+	go l.reloadLoop()
+	l.signalReload()
+
+	select {
+	case err := <-reported:
+		if !strings.Contains(err.Error(), "api server unavailable") {
+			t.Errorf("reported error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("failed rebuild was not reported")
+	}
+	deadline := time.After(2 * time.Second)
+	for l.Status().Source != LoadSourceConfigMaps {
+		select {
+		case <-deadline:
+			t.Fatalf("rebuild was not retried, %d lists", atomic.LoadInt32(lists))
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// TestWatchReloadsFromInformerCache asserts that Watch picks up ConfigMap
+// changes through the informer and rebuilds from its cache.
+func TestWatchReloadsFromInformerCache(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewSimpleClientset(shardConfigMap("cm-0", "1", `{"version":1,"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"a:80"}]}}`))
+	l := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default", ResyncPeriod: -1})
+	defer func() { _ = l.Close() }()
+
+	changes := make(chan *RoutesConfig, 10)
+	if err := l.Watch(func(config *RoutesConfig) { changes <- config }); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), l.synced) {
+		t.Fatal("informer did not sync")
+	}
+
+	updated := shardConfigMap("cm-0", "2", `{"version":1,"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"a2:80"}]}}`)
+	if _, err := cs.CoreV1().ConfigMaps("default").Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case config := <-changes:
+			if route := config.FindRoute("a.com", RequestMatch{Path: "/"}); route != nil && route.Backend == "a2:80" {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Watch did not reload the updated ConfigMap")
+		}
+	}
+}
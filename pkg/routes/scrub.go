@@ -0,0 +1,113 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateScrubPattern reports whether pattern is a scrub pattern (see
+// ScrubsHeader): an optional "!" followed by header name characters and
+// "*". A lone "*" scrubs every header its exceptions do not keep.
+func ValidateScrubPattern(pattern string) error {
+	name := strings.TrimPrefix(pattern, "!")
+	if name == "" {
+		return fmt.Errorf("empty header scrub pattern %q", pattern)
+	}
+	for _, c := range name {
+		if c == '*' || c == '-' || c == '_' || c == '.' ||
+			(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			continue
+		}
+		return fmt.Errorf("header scrub pattern %q has invalid character %q", pattern, c)
+	}
+	return nil
+}
+
+// ParseScrubPatterns parses a comma-separated list of scrub patterns into
+// their lowercase form.
+func ParseScrubPatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if err := ValidateScrubPattern(pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// ScrubsHeader reports whether the lowercase request header name is
+// scrubbed, removed from client requests before they are forwarded, under
+// the lowercase scrub patterns. "*" matches any run of characters, so
+// "x-internal-*" names every header starting with "x-internal-". A pattern
+// starting with "!" is an exception: headers it matches are kept even when
+// another pattern names them, whatever the order of the two.
+func ScrubsHeader(patterns []string, name string) bool {
+	scrubbed := false
+	for _, pattern := range patterns {
+		if exception, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchWildcard(exception, name) {
+				return false
+			}
+		} else if !scrubbed {
+			scrubbed = matchWildcard(pattern, name)
+		}
+	}
+	return scrubbed
+}
+
+// matchWildcard reports whether s matches pattern, where "*" matches any
+// run of characters, including none.
+func matchWildcard(pattern, s string) bool {
+	prefix, rest, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, prefix) {
+		return false
+	}
+	s = s[len(prefix):]
+	parts := strings.Split(rest, "*")
+	last := parts[len(parts)-1]
+	for _, part := range parts[:len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
+
+// ConvertScrubHeaders maps the CRD scrubHeaders to their lowercase runtime
+// form.
+func ConvertScrubHeaders(patterns []string) []string {
+	if len(patterns) == 0 {
+		return nil
+	}
+	converted := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		converted[i] = strings.ToLower(pattern)
+	}
+	return converted
+}
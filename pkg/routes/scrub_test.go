@@ -0,0 +1,116 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestScrubsHeader(t *testing.T) {
+	patterns := []string{"x-internal-*", "x-user-id", "!x-internal-trace-*", "*-secret"}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"x-user-id", true},
+		{"x-user-idx", false},
+		{"x-internal-role", true},
+		{"x-internal-", true},
+		{"x-internal-trace-id", false},
+		{"x-api-secret", true},
+		{"-secret", true},
+		{"accept", false},
+	}
+	for _, tt := range tests {
+		if got := ScrubsHeader(patterns, tt.name); got != tt.want {
+			t.Errorf("ScrubsHeader(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// An allowlist: everything but the exceptions.
+	allow := []string{"!accept*", "*", "!content-type"}
+	for name, want := range map[string]bool{"accept-language": false, "content-type": false, "cookie": true} {
+		if got := ScrubsHeader(allow, name); got != want {
+			t.Errorf("ScrubsHeader(allowlist, %q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"a*b*c", "abc", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "acb", false},
+		{"a*bc", "abcbc", true},
+		{"ab*ba", "aba", false},
+		{"*", "", true},
+		{"**", "x", true},
+	}
+	for _, tt := range tests {
+		if got := matchWildcard(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseScrubPatterns(t *testing.T) {
+	got, err := ParseScrubPatterns(" X-User-Id, x-internal-*,,!X-Internal-Trace ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"x-user-id", "x-internal-*", "!x-internal-trace"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseScrubPatterns = %q, want %q", got, want)
+	}
+	for _, invalid := range []string{"!", ":path", "x user", "x-a!b"} {
+		if _, err := ParseScrubPatterns(invalid); err == nil {
+			t.Errorf("ParseScrubPatterns(%q) accepted", invalid)
+		}
+	}
+}
+
+func TestExpandRoutesWithScrubHeaders(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef:              v1alpha1.TargetRef{Name: "default"},
+			Hostnames:              []string{"example.com"},
+			ScrubHeaders:           []string{"X-User-Id", "x-internal-*"},
+			UnmatchedRequestPolicy: v1alpha1.UnmatchedRequestPassthrough,
+			Rules: []v1alpha1.Rule{{
+				Matches:     []v1alpha1.PathMatch{{Path: "/api"}},
+				BackendRefs: []v1alpha1.BackendRef{{Name: "api", Namespace: "default", Port: 8080}},
+			}},
+		},
+	}
+	hosts, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(hosts["example.com"]) != 2 {
+		t.Fatalf("routes = %+v, want the rule's and the unmatched request route", hosts["example.com"])
+	}
+	for _, route := range hosts["example.com"] {
+		if want := []string{"x-user-id", "x-internal-*"}; !reflect.DeepEqual(route.ScrubHeaders, want) {
+			t.Errorf("route %q scrubHeaders = %q, want %q", route.Path, route.ScrubHeaders, want)
+		}
+	}
+}
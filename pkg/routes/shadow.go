@@ -0,0 +1,172 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"strings"
+)
+
+// Shadowing is a route that can never match because an earlier route of its
+// host matches every request it would. Route and ShadowedBy are indexes in
+// the routes given to FindShadowedRoutes.
+type Shadowing struct {
+	Route      int
+	ShadowedBy int
+}
+
+// FindShadowedRoutes returns the routes of a host that can never match, each
+// with the first earlier route that matches every request it would. The
+// routes must be in evaluation order, as left by SortRoutes.
+//
+// The check is conservative: a route is only reported when an earlier route
+// provably covers it, i.e. its path covers the route's path (the same exact
+// path, the same regex, or a prefix ending on a path segment boundary), it
+// matches any method or the same one, its header and query param matches are
+// a subset of the route's, it is not restricted to a fraction of requests,
+// and it has the same variant. Regex routes are only compared by their
+// pattern, so a regex that happens to cover another route is not reported.
+// The fallback routes of unmatchedRequestPolicy and maintenance routes are
+// ignored.
+func FindShadowedRoutes(hostRoutes []Route) []Shadowing {
+	var shadowed []Shadowing
+
+	// Indexes of the earlier routes, by type and path.
+	exact := make(map[string][]int)
+	prefix := make(map[string][]int)
+	regex := make(map[string][]int)
+
+	for i := range hostRoutes {
+		route := &hostRoutes[i]
+		if route.UnmatchedPolicy != "" || route.Maintenance != nil {
+			continue
+		}
+
+		by := -1
+		consider := func(candidates []int) {
+			for _, j := range candidates {
+				if (by == -1 || j < by) && covers(&hostRoutes[j], route) {
+					by = j
+					return
+				}
+			}
+		}
+		switch route.Type {
+		case RouteTypeExact, RouteTypePrefix:
+			if route.Type == RouteTypeExact {
+				consider(exact[route.Path])
+			}
+			for _, p := range coveringPrefixes(route.Path) {
+				consider(prefix[p])
+			}
+		case RouteTypeRegex:
+			consider(regex[route.Path])
+			consider(prefix["/"])
+			consider(prefix[""])
+		}
+		if by != -1 {
+			shadowed = append(shadowed, Shadowing{Route: i, ShadowedBy: by})
+		}
+
+		switch route.Type {
+		case RouteTypeExact:
+			exact[route.Path] = append(exact[route.Path], i)
+		case RouteTypePrefix:
+			prefix[route.Path] = append(prefix[route.Path], i)
+		case RouteTypeRegex:
+			regex[route.Path] = append(regex[route.Path], i)
+		}
+	}
+	return shadowed
+}
+
+// coveringPrefixes returns the prefix route paths that match every path a
+// prefix route on path matches (and so the exact path too): path itself, path
+// with a trailing slash, and path cut at every "/", with and without the
+// slash.
+func coveringPrefixes(path string) []string {
+	prefixes := []string{path, path + "/"}
+	for k := 0; k < len(path); k++ {
+		if path[k] == '/' {
+			prefixes = append(prefixes, path[:k], path[:k+1])
+		}
+	}
+	return prefixes
+}
+
+// covers reports whether the earlier route a matches every request route b
+// matches, paths aside: the caller only compares routes whose paths cover.
+func covers(a, b *Route) bool {
+	if a.UnmatchedPolicy != "" || a.Maintenance != nil || a.Fraction != nil {
+		return false
+	}
+	// Routes of different variants never see the same requests.
+	if a.Variant != b.Variant {
+		return false
+	}
+	// Paths are compared as written, so a case-sensitive route only covers
+	// the paths of another that also is.
+	if b.CaseInsensitive && !a.CaseInsensitive {
+		return false
+	}
+	if a.Method != "" && !strings.EqualFold(a.Method, b.Method) {
+		return false
+	}
+	if a.Scheme != "" && a.Scheme != b.Scheme {
+		return false
+	}
+	for _, h := range a.Headers {
+		if !containsHeaderMatch(b.Headers, h) {
+			return false
+		}
+	}
+	for _, q := range a.QueryParams {
+		if !containsQueryParamMatch(b.QueryParams, q) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsHeaderMatch reports whether matches holds a header match equal to m.
+func containsHeaderMatch(matches []RouteHeaderMatch, m RouteHeaderMatch) bool {
+	for _, h := range matches {
+		if strings.EqualFold(h.Name, m.Name) && h.Value == m.Value && matchTypeOrExact(h.Type) == matchTypeOrExact(m.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsQueryParamMatch reports whether matches holds a query param match
+// equal to m.
+func containsQueryParamMatch(matches []RouteQueryParamMatch, m RouteQueryParamMatch) bool {
+	for _, q := range matches {
+		if q.Name == m.Name && q.Value == m.Value && matchTypeOrExact(q.Type) == matchTypeOrExact(m.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTypeOrExact returns the comparison mode of a header or query param
+// match, HeaderMatchExact when unset.
+func matchTypeOrExact(matchType string) string {
+	if matchType == "" {
+		return HeaderMatchExact
+	}
+	return matchType
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindShadowedRoutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []Route
+		want   []Shadowing
+	}{
+		{
+			name: "higher priority prefix shadows a longer prefix",
+			routes: []Route{
+				{Path: "/api", Type: RouteTypePrefix, Priority: 2000},
+				{Path: "/api/v1", Type: RouteTypePrefix, Priority: 1000},
+			},
+			want: []Shadowing{{Route: 1, ShadowedBy: 0}},
+		},
+		{
+			name: "prefix does not cross a segment boundary",
+			routes: []Route{
+				{Path: "/api", Type: RouteTypePrefix, Priority: 2000},
+				{Path: "/api-docs", Type: RouteTypePrefix, Priority: 1000},
+			},
+		},
+		{
+			name: "trailing slash prefix shadows the path without it",
+			routes: []Route{
+				{Path: "/app/", Type: RouteTypePrefix, Priority: 2000},
+				{Path: "/app", Type: RouteTypeExact, Priority: 1000},
+				{Path: "/app/x", Type: RouteTypeExact, Priority: 1000},
+			},
+			want: []Shadowing{{Route: 1, ShadowedBy: 0}, {Route: 2, ShadowedBy: 0}},
+		},
+		{
+			name: "duplicate routes",
+			routes: []Route{
+				{Path: "/a", Type: RouteTypeExact, Backend: "one"},
+				{Path: "/a", Type: RouteTypeExact, Backend: "two"},
+				{Path: "^/b/[0-9]+$", Type: RouteTypeRegex, Backend: "one"},
+				{Path: "^/b/[0-9]+$", Type: RouteTypeRegex, Backend: "two"},
+			},
+			want: []Shadowing{{Route: 1, ShadowedBy: 0}, {Route: 3, ShadowedBy: 2}},
+		},
+		{
+			name: "case-insensitive routes shadow case-sensitive ones, not the other way round",
+			routes: []Route{
+				{Path: "/a", Type: RouteTypePrefix, Priority: 2000},
+				{Path: "/a/x", Type: RouteTypePrefix, CaseInsensitive: true, Priority: 1000},
+				{Path: "/b", Type: RouteTypePrefix, CaseInsensitive: true, Priority: 2000},
+				{Path: "/b/x", Type: RouteTypePrefix, Priority: 1000},
+			},
+			want: []Shadowing{{Route: 3, ShadowedBy: 2}},
+		},
+		{
+			name: "root prefix shadows regex routes",
+			routes: []Route{
+				{Path: "/", Type: RouteTypePrefix, Priority: 2000},
+				{Path: "^/b/.*$", Type: RouteTypeRegex, Priority: 1000},
+			},
+			want: []Shadowing{{Route: 1, ShadowedBy: 0}},
+		},
+		{
+			name: "narrower earlier routes shadow nothing",
+			routes: []Route{
+				{Path: "/a", Type: RouteTypePrefix, Method: "GET"},
+				{Path: "/a", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{{Name: "x-env", Value: "dev"}}},
+				{Path: "/a", Type: RouteTypePrefix, Fraction: &RouteFraction{Numerator: 1, Denominator: 10}},
+				{Path: "/a", Type: RouteTypePrefix},
+			},
+		},
+		{
+			name: "broader earlier route shadows a narrower one",
+			routes: []Route{
+				{Path: "/a", Type: RouteTypePrefix, Priority: 2000, Headers: []RouteHeaderMatch{{Name: "X-Env", Value: "dev"}}},
+				{Path: "/a/b", Type: RouteTypePrefix, Method: "GET", Headers: []RouteHeaderMatch{
+					{Name: "x-env", Value: "dev", Type: HeaderMatchExact},
+					{Name: "x-tenant", Value: "acme"},
+				}},
+				{Path: "/a/c", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{{Name: "x-env", Value: "prod"}}},
+			},
+			want: []Shadowing{{Route: 1, ShadowedBy: 0}},
+		},
+		{
+			name: "first covering route is reported",
+			routes: []Route{
+				{Path: "/a/b", Type: RouteTypePrefix, Priority: 3000},
+				{Path: "/a", Type: RouteTypePrefix, Priority: 2000},
+				{Path: "/a/b/c", Type: RouteTypeExact, Priority: 1000},
+			},
+			want: []Shadowing{{Route: 2, ShadowedBy: 0}},
+		},
+		{
+			name: "unmatched policy fallback is ignored",
+			routes: []Route{
+				{Path: "/a", Type: RouteTypePrefix},
+				{Path: "/", Type: RouteTypePrefix, UnmatchedPolicy: UnmatchedNotFound},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindShadowedRoutes(tt.routes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindShadowedRoutes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// SignatureAnnotation carries the HMAC the controller computes over a route
+// ConfigMap with the shared signing key. With a signing key configured, the
+// extproc only loads ConfigMaps whose signature verifies, so a ConfigMap
+// written by anyone but the controller is ignored even when it carries the
+// right labels.
+const SignatureAnnotation = "customrouter.freepik.com/routes-signature"
+
+// signaturePrefix names the MAC algorithm, so it can change without
+// misreading older signatures.
+const signaturePrefix = "hmac-sha256="
+
+// SignConfigMap returns the SignatureAnnotation value of the route ConfigMap
+// namespace/name for target holding data, with the GenerationAnnotation
+// generation and the PartitionsAnnotation partitions (both empty when it has
+// none). The namespace, name and target are part of the MAC, so a signed
+// ConfigMap copied elsewhere or relabeled to another target does not verify,
+// and so are the generation annotations, so a ConfigMap cannot be moved to
+// another generation or complete one it does not belong to.
+func SignConfigMap(key []byte, namespace, name, target, generation, partitions, data string) string {
+	mac := hmac.New(sha256.New, key)
+	for _, part := range []string{namespace, name, target, generation, partitions, data} {
+		// Length-prefix every part so their boundaries cannot be shifted.
+		_ = binary.Write(mac, binary.BigEndian, uint64(len(part)))
+		_, _ = mac.Write([]byte(part))
+	}
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyConfigMap reports whether signature is the valid SignatureAnnotation
+// of the route ConfigMap namespace/name for target holding data, with the
+// given generation annotations (see SignConfigMap).
+func VerifyConfigMap(key []byte, namespace, name, target, generation, partitions, data, signature string) bool {
+	want := SignConfigMap(key, namespace, name, target, generation, partitions, data)
+	return hmac.Equal([]byte(signature), []byte(want))
+}
+
+// ReadSigningKey reads a signing key file, such as a mounted Secret key.
+// Surrounding whitespace is trimmed, so a trailing newline does not change
+// the key.
+func ReadSigningKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("signing key file %s is empty", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignAndVerifyConfigMap(t *testing.T) {
+	key := []byte("shared-secret")
+	data := `{"version":1,"hosts":{}}`
+	signature := SignConfigMap(key, "routes", "customrouter-routes-default-0", "default", "abc", "2", data)
+
+	tests := []struct {
+		name                      string
+		key                       []byte
+		namespace, cmName, target string
+		generation, partitions, d string
+		want                      bool
+	}{
+		{"same inputs", key, "routes", "customrouter-routes-default-0", "default", "abc", "2", data, true},
+		{"other key", []byte("other"), "routes", "customrouter-routes-default-0", "default", "abc", "2", data, false},
+		{"copied to another namespace", key, "team-a", "customrouter-routes-default-0", "default", "abc", "2", data, false},
+		{"renamed", key, "routes", "customrouter-routes-default-1", "default", "abc", "2", data, false},
+		{"relabeled to another target", key, "routes", "customrouter-routes-default-0", "internal", "abc", "2", data, false},
+		{"moved to another generation", key, "routes", "customrouter-routes-default-0", "default", "abd", "2", data, false},
+		{"partitions changed", key, "routes", "customrouter-routes-default-0", "default", "abc", "1", data, false},
+		{"generation removed", key, "routes", "customrouter-routes-default-0", "default", "", "", data, false},
+		{"tampered data", key, "routes", "customrouter-routes-default-0", "default", "abc", "2", data + " ", false},
+		// Moving bytes between parts must not keep the MAC.
+		{"shifted boundary", key, "route", "scustomrouter-routes-default-0", "default", "abc", "2", data, false},
+		{"shifted generation boundary", key, "routes", "customrouter-routes-default-0", "default", "abc2", "", data, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := VerifyConfigMap(tt.key, tt.namespace, tt.cmName, tt.target, tt.generation, tt.partitions, tt.d, signature)
+			if got != tt.want {
+				t.Errorf("VerifyConfigMap = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if VerifyConfigMap(key, "routes", "customrouter-routes-default-0", "default", "abc", "2", data, "") {
+		t.Error("a missing signature verified")
+	}
+}
+
+func TestReadSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key")
+	if err := os.WriteFile(path, []byte("  secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ReadSigningKey(path)
+	if err != nil || string(key) != "secret" {
+		t.Errorf("ReadSigningKey = %q, %v; want the trimmed key", key, err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSigningKey(empty); err == nil {
+		t.Error("expected an error for an empty key file")
+	}
+	if _, err := ReadSigningKey(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteSnapshot persists the merged routes config to path. The file is
+// written to a temporary sibling and renamed into place, so a crash or a
+// concurrent reader never observes a partially written snapshot.
+func WriteSnapshot(path string, config *RoutesConfig) error {
+	data, err := EncodeRoutesConfig(config, EncodeOptions{Version: MaxFormatVersion})
+	if err != nil {
+		return fmt.Errorf("failed to serialize snapshot: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot in %s: %w", dir, err)
+	}
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to move snapshot into place: %w", err)
+	}
+	return nil
+}
+
+// ReadSnapshot loads a routes config previously written by WriteSnapshot.
+// Routes are re-sorted and their regexes compiled, so the result is ready
+// to serve; the partition index is left to the caller.
+func ReadSnapshot(path string) (*RoutesConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", path, err)
+	}
+
+	config, err := DecodeRoutesConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	if config.Hosts == nil {
+		config.Hosts = make(map[string][]Route)
+	}
+
+	for host := range config.Hosts {
+		SortRoutes(config.Hosts[host])
+	}
+
+	if err := config.CompileRegexes(); err != nil {
+		return nil, fmt.Errorf("failed to compile snapshot regexes: %w", err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	config := &RoutesConfig{
+		Version: 1,
+		Hosts: map[string][]Route{
+			"a.com": {
+				{Path: "/", Type: RouteTypePrefix, Backend: "root:80", Priority: 1000},
+				{Path: "^/users/[0-9]+$", Type: RouteTypeRegex, Backend: "users:80", Priority: 1000},
+			},
+		},
+	}
+
+	if err := WriteSnapshot(path, config); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the snapshot file, temporary files left behind: %v", entries)
+	}
+
+	loaded, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+	route := loaded.FindRoute("a.com", RequestMatch{Path: "/users/42"})
+	if route == nil || route.Backend != "users:80" {
+		t.Fatalf("expected the regex route to match after loading the snapshot, got %+v", route)
+	}
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := ReadSnapshot(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected an error for a missing snapshot")
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte(`{"version":1,"hosts":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSnapshot(corrupt); err == nil {
+		t.Error("expected an error for a truncated snapshot")
+	}
+}
+
+// TestK8sLoaderSnapshotColdStart asserts the loader can serve from a snapshot
+// while the API server is unavailable, and picks up the ConfigMaps (and
+// refreshes the snapshot) once a background reload succeeds.
+func TestK8sLoaderSnapshotColdStart(t *testing.T) {
+	oldRetry := reloadRetryInterval
+	reloadRetryInterval = 20 * time.Millisecond
+	defer func() { reloadRetryInterval = oldRetry }()
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	snapshot := &RoutesConfig{
+		Version: 1,
+		Hosts:   map[string][]Route{"a.com": {{Path: "/", Type: RouteTypePrefix, Backend: "from-snapshot:80"}}},
+	}
+	if err := WriteSnapshot(path, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	cs, _ := countingClient()
+	var failures int32 = 2
+	cs.PrependReactor("list", "configmaps", func(clienttesting.Action) (bool, k8sruntime.Object, error) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			return true, nil, errors.New("api server unavailable")
+		}
+		return false, nil, nil
+	})
+
+	l := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default", SnapshotPath: path})
+	defer func() { _ = l.Close() }()
+
+	if l.Status().Loaded() {
+		t.Fatal("a fresh loader must not report a loaded route table")
+	}
+	if err := l.LoadSnapshot(); err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if status := l.Status(); status.Source != LoadSourceSnapshot || status.Routes != 1 {
+		t.Errorf("status after snapshot = %+v, want source %q with 1 route", status, LoadSourceSnapshot)
+	}
+	if route := l.FindRoute("a.com", RequestMatch{Path: "/x"}); route == nil || route.Backend != "from-snapshot:80" {
+		t.Fatalf("expected to serve from snapshot, got %+v", route)
+	}
+
+	reloaded := make(chan struct{}, 1)
+	l.onChange = func(*RoutesConfig) {
+		if err := l.SaveSnapshot(); err != nil {
+			t.Errorf("SaveSnapshot: %v", err)
+		}
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	}
+	go l.reloadLoop()
+	l.RequestReload()
+
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("background reload did not recover from API failures")
+	}
+	if route := l.FindRoute("a.com", RequestMatch{Path: "/x"}); route == nil || route.Backend != "svc:80" {
+		t.Fatalf("expected ConfigMap routes after reload, got %+v", route)
+	}
+	if status := l.Status(); status.Source != LoadSourceConfigMaps || status.LastError != "" {
+		t.Errorf("status after reload = %+v, want source %q without error", status, LoadSourceConfigMaps)
+	}
+
+	saved, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Hosts["a.com"][0].Backend; got != "svc:80" {
+		t.Errorf("snapshot was not refreshed after reload, backend = %q", got)
+	}
+}
+
+func TestK8sLoaderSnapshotDisabled(t *testing.T) {
+	cs, _ := countingClient()
+	l := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default"})
+	defer func() { _ = l.Close() }()
+
+	if err := l.LoadSnapshot(); err == nil {
+		t.Error("expected LoadSnapshot to fail without a snapshot path")
+	}
+	if err := l.SaveSnapshot(); err != nil {
+		t.Errorf("SaveSnapshot without a path must be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// MaxBudgetHosts is how many of the largest hosts a TableBudgetError lists.
+const MaxBudgetHosts = 5
+
+// HostSize is the share of one host in the EstimatedSize of a route table.
+type HostSize struct {
+	Host   string `json:"host"`
+	Routes int    `json:"routes"`
+	Bytes  int    `json:"bytes"`
+}
+
+// HostSizes returns the size of every host of the route table, largest
+// first. Their bytes add up to EstimatedSize.
+func (rc *RoutesConfig) HostSizes() []HostSize {
+	sizes := make([]HostSize, 0, len(rc.Hosts))
+	for host, hostRoutes := range rc.Hosts {
+		size := HostSize{
+			Host:   host,
+			Routes: len(hostRoutes),
+			Bytes:  len(host) + int(unsafe.Sizeof(hostRoutes)),
+		}
+		for i := range hostRoutes {
+			size.Bytes += routeSize(&hostRoutes[i])
+		}
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Bytes != sizes[j].Bytes {
+			return sizes[i].Bytes > sizes[j].Bytes
+		}
+		return sizes[i].Host < sizes[j].Host
+	})
+	return sizes
+}
+
+// TableBudgetError is the error of a load whose merged route table is over
+// the loader's MaxBytes. The loader keeps serving its current table; the
+// largest hosts tell which routes to move to another target.
+type TableBudgetError struct {
+	// Bytes is the EstimatedSize of the rejected table and MaxBytes the
+	// budget it exceeds.
+	Bytes    int `json:"bytes"`
+	MaxBytes int `json:"maxBytes"`
+
+	// Routes is the route count of the rejected table.
+	Routes int `json:"routes"`
+
+	// LargestHosts are the MaxBudgetHosts largest hosts of the rejected
+	// table, largest first.
+	LargestHosts []HostSize `json:"largestHosts"`
+}
+
+func (e *TableBudgetError) Error() string {
+	hosts := make([]string, len(e.LargestHosts))
+	for i, h := range e.LargestHosts {
+		hosts[i] = fmt.Sprintf("%s (%d bytes)", h.Host, h.Bytes)
+	}
+	return fmt.Sprintf("route table of %d bytes exceeds the budget of %d bytes, largest hosts: %s",
+		e.Bytes, e.MaxBytes, strings.Join(hosts, ", "))
+}
+
+// CheckTableBudget returns a *TableBudgetError when the EstimatedSize of
+// config exceeds maxBytes, and nil when it fits or maxBytes is not positive.
+// It checks config alone: the tables the caller keeps besides it, such as
+// the previous one or a history, and the ConfigMaps it was decoded from are
+// for the caller to budget.
+func CheckTableBudget(config *RoutesConfig, maxBytes int) error {
+	if maxBytes <= 0 {
+		return nil
+	}
+	size := config.EstimatedSize()
+	if size <= maxBytes {
+		return nil
+	}
+	hosts := config.HostSizes()
+	if len(hosts) > MaxBudgetHosts {
+		hosts = hosts[:MaxBudgetHosts]
+	}
+	return &TableBudgetError{
+		Bytes:        size,
+		MaxBytes:     maxBytes,
+		Routes:       config.RouteCount(),
+		LargestHosts: hosts,
+	}
+}
+
+// recordLoadError records err, the error of a failed load, in status,
+// including the rejected table when it was over budget.
+func recordLoadError(status *LoadStatus, err error) {
+	status.LastError = err.Error()
+	var budgetErr *TableBudgetError
+	if errors.As(err, &budgetErr) {
+		status.OverBudget = budgetErr
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func budgetTestConfig() *RoutesConfig {
+	return &RoutesConfig{Hosts: map[string][]Route{
+		"small.com": {{Path: "/", Type: RouteTypePrefix, Backend: "s:80"}},
+		"big.com": {
+			{Path: "/a", Type: RouteTypePrefix, Backend: "b:80"},
+			{Path: "/b", Type: RouteTypePrefix, Backend: "b:80"},
+			{Path: "/c", Type: RouteTypePrefix, Backend: "b:80"},
+		},
+		"medium.com": {
+			{Path: "/a", Type: RouteTypePrefix, Backend: "m:80"},
+			{Path: "/b", Type: RouteTypePrefix, Backend: "m:80"},
+		},
+	}}
+}
+
+func TestHostSizes(t *testing.T) {
+	config := budgetTestConfig()
+	sizes := config.HostSizes()
+	var hosts []string
+	total := 0
+	for _, s := range sizes {
+		hosts = append(hosts, s.Host)
+		total += s.Bytes
+	}
+	if got := strings.Join(hosts, ","); got != "big.com,medium.com,small.com" {
+		t.Errorf("hosts = %s, want largest first", got)
+	}
+	if sizes[0].Routes != 3 {
+		t.Errorf("big.com routes = %d, want 3", sizes[0].Routes)
+	}
+	if want := config.EstimatedSize(); total != want {
+		t.Errorf("host sizes add up to %d, want EstimatedSize %d", total, want)
+	}
+}
+
+func TestCheckTableBudget(t *testing.T) {
+	config := budgetTestConfig()
+	size := config.EstimatedSize()
+
+	for _, maxBytes := range []int{0, -1, size} {
+		if err := CheckTableBudget(config, maxBytes); err != nil {
+			t.Errorf("CheckTableBudget(%d) = %v, want nil for a table of %d bytes", maxBytes, err, size)
+		}
+	}
+
+	err := CheckTableBudget(config, size-1)
+	var budgetErr *TableBudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("CheckTableBudget over budget = %v, want a *TableBudgetError", err)
+	}
+	if budgetErr.Bytes != size || budgetErr.MaxBytes != size-1 || budgetErr.Routes != 6 {
+		t.Errorf("error = %+v, want %d bytes over %d with 6 routes", budgetErr, size, size-1)
+	}
+	if len(budgetErr.LargestHosts) != 3 || budgetErr.LargestHosts[0].Host != "big.com" {
+		t.Errorf("largest hosts = %+v, want big.com first", budgetErr.LargestHosts)
+	}
+	if !strings.Contains(err.Error(), "big.com (") {
+		t.Errorf("error message %q does not name the largest host", err)
+	}
+}
+
+func TestLoadKeepsConfigOverBudget(t *testing.T) {
+	ctx := context.Background()
+	small := `{"version":1,"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"a:80"}]}}`
+	large := `{"version":1,"hosts":{"a.com":[{"path":"/","type":"prefix","backend":"a:80"}],` +
+		`"b.com":[{"path":"/` + strings.Repeat("x", 4096) + `","type":"prefix","backend":"b:80"}]}}`
+	cs := fake.NewSimpleClientset(shardConfigMap("cm-0", "1", small))
+	l := NewK8sLoader(cs, K8sLoaderConfig{TargetName: "default", MaxBytes: 4096})
+	defer func() { _ = l.Close() }()
+
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	served := l.GetConfig()
+
+	if _, err := cs.CoreV1().ConfigMaps("default").Update(ctx, shardConfigMap("cm-0", "2", large), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := l.Load()
+	var budgetErr *TableBudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("Load over budget = %v, want a *TableBudgetError", err)
+	}
+	if l.GetConfig() != served {
+		t.Error("config over budget replaced the served one")
+	}
+	status := l.Status()
+	if status.OverBudget == nil || status.OverBudget.LargestHosts[0].Host != "b.com" || status.LastError == "" {
+		t.Errorf("status = %+v, want the rejected table with b.com largest", status)
+	}
+	if status.Hosts != 1 {
+		t.Errorf("status counts %d hosts, want those of the served config", status.Hosts)
+	}
+
+	if _, err := cs.CoreV1().ConfigMaps("default").Update(ctx, shardConfigMap("cm-0", "3", small), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Load(); err != nil {
+		t.Fatalf("Load back within budget: %v", err)
+	}
+	if status := l.Status(); status.OverBudget != nil || status.LastError != "" {
+		t.Errorf("status = %+v, want the over budget state cleared", status)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+// Match criteria reported by Route.Mismatch.
+const (
+	MismatchVariant     = "variant"
+	MismatchMethod      = "method"
+	MismatchScheme      = "scheme"
+	MismatchHeaders     = "headers"
+	MismatchQueryParams = "query_params"
+	MismatchFraction    = "fraction"
+	MismatchPath        = "path"
+	MismatchMaintenance = "maintenance"
+	MismatchExpired     = "expired"
+	MismatchShed        = "shed"
+)
+
+// RouteCandidate is a route TraceRoute inspected.
+type RouteCandidate struct {
+	Route *Route
+
+	// Skipped is the Mismatch reason the route was passed over for, or ""
+	// for the route that matched.
+	Skipped string
+}
+
+// TraceRoute is FindRoute also returning every route it inspected, in
+// order, up to and including the match. It is slower than FindRoute and
+// meant for explaining single requests.
+func (rc *RoutesConfig) TraceRoute(host string, req RequestMatch) (*Route, []RouteCandidate) {
+	hostRoutes, ok := rc.Hosts[host]
+	if !ok {
+		return nil, nil
+	}
+	req.Variant = rc.hostVariant(host, req.Variant)
+
+	var trail []RouteCandidate
+	inspect := func(r *Route) bool {
+		reason := r.Mismatch(req)
+		trail = append(trail, RouteCandidate{Route: r, Skipped: reason})
+		return reason == ""
+	}
+
+	if candidates, ok := rc.partitionCandidates(host, req); ok {
+		for _, r := range candidates {
+			if inspect(r) {
+				return r, trail
+			}
+		}
+		return nil, trail
+	}
+	for i := range hostRoutes {
+		if inspect(&hostRoutes[i]) {
+			return &hostRoutes[i], trail
+		}
+	}
+	return nil, trail
+}
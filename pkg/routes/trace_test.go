@@ -0,0 +1,77 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import "testing"
+
+func TestTraceRoute(t *testing.T) {
+	config := &RoutesConfig{
+		Version: 1,
+		Hosts: map[string][]Route{
+			testHost: {
+				{Path: "/api", Type: RouteTypePrefix, Method: "POST", Backend: "post:80"},
+				{Path: "/api", Type: RouteTypePrefix, Headers: envHeader("beta"), Backend: "beta:80"},
+				{Path: "/api", Type: RouteTypePrefix, QueryParams: []RouteQueryParamMatch{{Name: "v", Value: "2"}}, Backend: "v2:80"},
+				{Path: "/api", Type: RouteTypePrefix, Fraction: &RouteFraction{Numerator: 1, Denominator: 2}, Backend: "canary:80"},
+				{Path: "/admin", Type: RouteTypePrefix, Backend: "admin:80"},
+				{Path: "/api", Type: RouteTypePrefix, Backend: "api:80"},
+				{Path: "/", Type: RouteTypePrefix, Backend: "root:80"},
+			},
+		},
+	}
+
+	route, trail := config.TraceRoute(testHost, RequestMatch{Path: "/api/users", Method: "GET"})
+	if route == nil || route.Backend != "api:80" {
+		t.Fatalf("TraceRoute matched %s, want api:80", backendOf(route))
+	}
+	want := []string{MismatchMethod, MismatchHeaders, MismatchQueryParams, MismatchFraction, MismatchPath, ""}
+	if len(trail) != len(want) {
+		t.Fatalf("trail has %d candidates, want %d", len(trail), len(want))
+	}
+	for i, c := range trail {
+		if c.Skipped != want[i] {
+			t.Errorf("candidate %d skipped = %q, want %q", i, c.Skipped, want[i])
+		}
+	}
+	if trail[len(trail)-1].Route != route {
+		t.Error("the last candidate must be the matched route")
+	}
+
+	if route, trail := config.TraceRoute("other.com", RequestMatch{Path: "/"}); route != nil || trail != nil {
+		t.Errorf("TraceRoute(other.com) = %s, %v; want no route and no trail", backendOf(route), trail)
+	}
+}
+
+func TestTraceRouteMatchesFindRoute(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		config := buildSandboxConfig(t, indexed)
+		for _, env := range []string{"sbx-a", "sbx-unknown", ""} {
+			for _, path := range []string{"/images", "/static/app.js", "/healthz", "/"} {
+				headers := map[string]string{}
+				if env != "" {
+					headers["env"] = env
+				}
+				req := RequestMatch{Path: path, Method: "GET", Headers: headers}
+				route, _ := config.TraceRoute(testHost, req)
+				if want := config.FindRoute(testHost, req); !sameRoute(route, want) {
+					t.Errorf("indexed=%v env=%q path=%q: TraceRoute matched %s, FindRoute %s",
+						indexed, env, path, backendOf(route), backendOf(want))
+				}
+			}
+		}
+	}
+}
@@ -20,10 +20,16 @@ package routes
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"hash/fnv"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unsafe"
 
 	"github.com/freepik-company/customrouter/api/v1alpha1"
 )
@@ -40,15 +46,38 @@ type RouteAction struct {
 	RedirectStatusCode         int32  `json:"redirectStatusCode,omitempty"`
 	RedirectReplacePrefixMatch *bool  `json:"redirectReplacePrefixMatch,omitempty"`
 
+	// RedirectAltSvc is the Alt-Svc header sent with the redirect
+	// (redirect.altSvc), overriding the extproc's default.
+	RedirectAltSvc string `json:"redirectAltSvc,omitempty"`
+
+	// RedirectStripPort leaves the request port out of a redirect that sets
+	// neither RedirectPort nor RedirectHostname (redirect.preservePort false).
+	RedirectStripPort bool `json:"redirectStripPort,omitempty"`
+
 	// For rewrite
 	RewritePath               string `json:"rewritePath,omitempty"`
 	RewriteHostname           string `json:"rewriteHostname,omitempty"`
 	RewriteReplacePrefixMatch *bool  `json:"rewriteReplacePrefixMatch,omitempty"`
 
+	// RewriteSegments replaces single segments of the request path, by
+	// 0-based index, instead of the whole path (rewrite.segments). An
+	// empty value removes the segment.
+	RewriteSegments map[int]string `json:"rewriteSegments,omitempty"`
+
 	// For header operations
 	HeaderName string `json:"headerName,omitempty"`
 	Value      string `json:"value,omitempty"`
 
+	// For require-auth
+	AuthURL             string   `json:"authUrl,omitempty"`
+	AuthForwardHeaders  []string `json:"authForwardHeaders,omitempty"`
+	AuthUpstreamHeaders []string `json:"authUpstreamHeaders,omitempty"`
+	AuthTimeoutMs       int64    `json:"authTimeoutMs,omitempty"`
+	AuthFailOpen        bool     `json:"authFailOpen,omitempty"`
+
+	// For deny-upgrade
+	UpgradeStatusCode int32 `json:"upgradeStatusCode,omitempty"`
+
 	// preservePrefix is an expansion-time flag, not serialized to JSON.
 	// When true, the prefix from pathPrefixes expansion is prepended to the
 	// rewrite/redirect path for prefixed routes.
@@ -56,9 +85,14 @@ type RouteAction struct {
 }
 
 // HeaderMatchExact and HeaderMatchRegex are the comparison modes for RouteHeaderMatch.
+// HeaderMatchExists, HeaderMatchAbsent and HeaderMatchNotValue are
+// header-only operators: they test presence or negate an exact comparison.
 const (
-	HeaderMatchExact = "exact"
-	HeaderMatchRegex = "regex"
+	HeaderMatchExact    = "exact"
+	HeaderMatchRegex    = "regex"
+	HeaderMatchExists   = "exists"
+	HeaderMatchAbsent   = "absent"
+	HeaderMatchNotValue = "not-value"
 )
 
 // RouteHeaderMatch represents a single header matching criterion on a Route.
@@ -67,7 +101,9 @@ const (
 type RouteHeaderMatch struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
-	// Type is one of HeaderMatchExact (default, case-sensitive) or HeaderMatchRegex.
+	// Type is one of HeaderMatchExact (default, case-sensitive),
+	// HeaderMatchRegex, HeaderMatchExists, HeaderMatchAbsent or
+	// HeaderMatchNotValue. Value is ignored by exists and absent.
 	Type string `json:"type,omitempty"`
 
 	// compiledRegex is populated during CompileRegexes() for Type=regex. Not serialized.
@@ -87,6 +123,68 @@ type RouteQueryParamMatch struct {
 	compiledRegex *regexp.Regexp
 }
 
+// RouteFraction restricts a route to Numerator out of every Denominator
+// requests, picked by a hash of the request id (see InFraction).
+type RouteFraction struct {
+	Numerator   int32 `json:"numerator"`
+	Denominator int32 `json:"denominator"`
+}
+
+// envoyDenominators are the denominators of an Envoy FractionalPercent, in
+// increasing order.
+var envoyDenominators = [...]int64{100, 10000, 1000000}
+
+// EnvoyPercent returns numerator out of denominator as an Envoy
+// FractionalPercent: over the smallest of 100, 10000 and 1000000 that is a
+// multiple of denominator, or over 1000000, rounded to the nearest, when
+// none is. InFraction picks requests with the same values, so a route match
+// built from it agrees with the extproc on every UUID request id.
+func EnvoyPercent(numerator, denominator int32) (int64, int64) {
+	for _, d := range envoyDenominators {
+		if d%int64(denominator) == 0 {
+			return int64(numerator) * (d / int64(denominator)), d
+		}
+	}
+	d := envoyDenominators[len(envoyDenominators)-1]
+	return (int64(numerator)*d + int64(denominator)/2) / int64(denominator), d
+}
+
+// RouteOutlier is the outlier policy of a route: once ErrorRatePercent of
+// at least MinRequests responses of its backend within IntervalMs are server
+// errors, the extproc sends the route's requests to FallbackBackend for
+// EjectionMs.
+type RouteOutlier struct {
+	FallbackBackend  string `json:"fallbackBackend"`
+	ErrorRatePercent int32  `json:"errorRatePercent"`
+	MinRequests      int32  `json:"minRequests"`
+	IntervalMs       int64  `json:"intervalMs"`
+	EjectionMs       int64  `json:"ejectionMs"`
+}
+
+// Health signals of a RouteFailover, the values of the API's
+// BackendHealthSignal.
+const (
+	FailoverSignalEndpoints = "Endpoints"
+	FailoverSignalResponses = "Responses"
+)
+
+// RouteFailover is the fallback chain of a route: the extproc sends the
+// route's requests to the first of Backends that is healthy by Signal, and
+// to Backends[0], the route's Backend, while none is. The thresholds apply
+// to the Responses signal, as in RouteOutlier.
+type RouteFailover struct {
+	Backends         []string `json:"backends"`
+	Signal           string   `json:"signal"`
+	ErrorRatePercent int32    `json:"errorRatePercent,omitempty"`
+	MinRequests      int32    `json:"minRequests,omitempty"`
+	IntervalMs       int64    `json:"intervalMs,omitempty"`
+	EjectionMs       int64    `json:"ejectionMs,omitempty"`
+}
+
+// RequestIDHeader is the request header whose value selects the requests
+// of a RouteFraction.
+const RequestIDHeader = "x-request-id"
+
 // Route represents a single expanded route for the proxy
 type Route struct {
 	Path     string        `json:"path"`
@@ -95,10 +193,52 @@ type Route struct {
 	Priority int32         `json:"priority"`
 	Actions  []RouteAction `json:"actions,omitempty"`
 
+	// Precedence is the spec.precedence of the CustomHTTPRoute the route was
+	// expanded from. SortRoutes uses it to order routes of different
+	// CustomHTTPRoutes that tie on every other criterion.
+	Precedence int32 `json:"precedence,omitempty"`
+
+	// MostSpecific marks the routes of a target using the MostSpecific match
+	// strategy (see RoutesConfig.ApplyMatchStrategy): SortRoutes then orders
+	// them by specificity before priority.
+	MostSpecific bool `json:"mostSpecific,omitempty"`
+
+	// ID and Source identify the route and the CustomHTTPRoute
+	// ("namespace/name") it was expanded from. Only written by the v2
+	// format; see AssignRouteIdentity.
+	ID     string `json:"id,omitempty"`
+	Source string `json:"source,omitempty"`
+
+	// SourceRule is the part of the CustomHTTPRoute spec the route was
+	// expanded from: "rules[N]" (N indexing spec.rules, disabled rules
+	// included), "hostnameAliases[N]", "maintenance" or
+	// "unmatchedRequestPolicy". Only written by the v2 format, like Source.
+	SourceRule string `json:"sourceRule,omitempty"`
+
+	// Owner and Description document the route for whoever debugs it: the
+	// owner and description of its rule, or else of its CustomHTTPRoute.
+	// Only written by the v2 format, like Source.
+	Owner       string `json:"owner,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Variant is the spec.variant of the CustomHTTPRoute the route was
+	// expanded from. Routes with a variant only match requests selecting it
+	// (RequestMatch.Variant); see RoutesConfig.FindRoute.
+	Variant string `json:"variant,omitempty"`
+
+	// Draining is true for the routes of a deleted CustomHTTPRoute kept for
+	// its deletionDrainSeconds. They still route; the flag only lets the
+	// extproc report the requests that would otherwise have been cut off.
+	Draining bool `json:"draining,omitempty"`
+
 	// Method restricts the route to a specific HTTP method (e.g. "GET").
 	// Empty means any method matches. Case-insensitive comparison at match time.
 	Method string `json:"method,omitempty"`
 
+	// Scheme restricts the route to requests with this scheme ("http" or
+	// "https"). Empty means any scheme matches.
+	Scheme string `json:"scheme,omitempty"`
+
 	// Headers are the header matching criteria. All listed headers must be
 	// satisfied by the request (AND). Empty means no header constraint.
 	Headers []RouteHeaderMatch `json:"headers,omitempty"`
@@ -107,6 +247,73 @@ type Route struct {
 	// must be satisfied by the request (AND). Empty means no query constraint.
 	QueryParams []RouteQueryParamMatch `json:"queryParams,omitempty"`
 
+	// CaseInsensitive matches Path regardless of letter case, for every
+	// route type.
+	CaseInsensitive bool `json:"caseInsensitive,omitempty"`
+
+	// Fraction restricts the route to a share of requests. Nil means every
+	// request matching the other criteria matches.
+	Fraction *RouteFraction `json:"fraction,omitempty"`
+
+	// GRPC marks a route expanded from a gRPC match. Path rewrites of gRPC
+	// routes never carry a query string, and a hostname rewrite only sets
+	// :authority (gRPC has no Host header).
+	GRPC bool `json:"grpc,omitempty"`
+
+	// OverrideHeader is the lowercased request header selecting a backend
+	// variant, and Overrides maps its accepted values to alternate backends
+	// (same "host:port" format as Backend). Both are empty unless the
+	// CustomHTTPRoute sets spec.overrideHeader.
+	OverrideHeader string            `json:"overrideHeader,omitempty"`
+	Overrides      map[string]string `json:"overrides,omitempty"`
+
+	// Outlier fails the route over to a fallback backend while its backend
+	// returns too many server errors. Nil unless the rule sets outlierPolicy.
+	Outlier *RouteOutlier `json:"outlier,omitempty"`
+
+	// Failover sends the route's requests to the first healthy backend of
+	// a fallback chain. Nil unless the rule sets backendFailover.
+	Failover *RouteFailover `json:"failover,omitempty"`
+
+	// MaxRequestBytes is the largest request body the route forwards; the
+	// extproc answers larger requests with 413. Zero means no limit.
+	MaxRequestBytes int64 `json:"maxRequestBytes,omitempty"`
+
+	// ExpiresAt is when the rule of the route expires (rule expiresAt): the
+	// route stops matching from then on. Nil means it never expires.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// DecisionHeaders overrides, for this route, when the extproc adds its
+	// routing decision headers to the forwarded request (one of the
+	// DecisionHeaders* constants). Empty defers to the attachment and
+	// extproc defaults.
+	DecisionHeaders string `json:"decisionHeaders,omitempty"`
+
+	// ScrubHeaders are the lowercase scrub patterns (see ScrubsHeader) of
+	// the client request headers the extproc removes before forwarding a
+	// request matching the route, on top of its --scrub-headers. Empty
+	// unless the CustomHTTPRoute sets spec.scrubHeaders.
+	ScrubHeaders []string `json:"scrubHeaders,omitempty"`
+
+	// UnmatchedPolicy marks the fallback route expanded for each hostname of
+	// a CustomHTTPRoute setting unmatchedRequestPolicy (one of the
+	// Unmatched* constants). It sorts after every other route of the host,
+	// so it matches exactly the requests no route matches; the extproc then
+	// applies the policy instead of forwarding them.
+	UnmatchedPolicy string `json:"unmatchedPolicy,omitempty"`
+
+	// Maintenance marks a maintenance route expanded for each hostname (and
+	// path) of a CustomHTTPRoute under spec.maintenance. It sorts before
+	// every other route of the host, matches only while the maintenance
+	// applies to the request, and is answered with the maintenance response.
+	Maintenance *RouteMaintenance `json:"maintenance,omitempty"`
+
+	// SequentialActions applies Actions in the order they are listed, each
+	// seeing the request as left by the previous ones (actionOrder
+	// Sequential). When false, a redirect takes precedence and rewrites and
+	// header actions all see the original request.
+	SequentialActions bool `json:"sequentialActions,omitempty"`
+
 	// Mirrors lists request-mirror targets for this route. These are consumed
 	// by the controller when generating Envoy request_mirror_policies and are
 	// NEVER serialized to the ConfigMap — the ExtProc data plane does not
@@ -119,6 +326,23 @@ type Route struct {
 	// typed_per_filter_config entry) and never reaches the ExtProc data plane.
 	CORS *RouteCORS `json:"-"`
 
+	// ProtocolHint is the rule's protocolHints (one of the ProtocolHint*
+	// constants), or empty. Like CORS, it is consumed only by the controller,
+	// which renders a dedicated Envoy route without timeout and retries.
+	ProtocolHint string `json:"-"`
+
+	// HashPolicy is the rule's hashPolicy, or nil. Like ProtocolHint, it is
+	// consumed only by the controller, which renders it as the hash_policy
+	// of a dedicated Envoy route.
+	HashPolicy *RouteHashPolicy `json:"-"`
+
+	// BackendProtocols maps the backends of the route (Backend, Overrides,
+	// the Outlier fallback and the Failover chain) whose backendRef sets a protocol to it (one
+	// of the v1alpha1.BackendProtocol* constants). Like ProtocolHint, it is
+	// consumed only by the controller, which renders it on the backends'
+	// upstream clusters.
+	BackendProtocols map[string]string `json:"-"`
+
 	// compiledRegex is the compiled regex for regex type routes (not serialized)
 	compiledRegex *regexp.Regexp
 }
@@ -135,6 +359,16 @@ type RouteCORS struct {
 	MaxAge           int32
 }
 
+// RouteHashPolicy is the runtime representation of a rule's hashPolicy:
+// either Header or CookieName is set. A zero CookieTTL leaves the cookie to
+// the client; otherwise Envoy generates it with that lifetime.
+type RouteHashPolicy struct {
+	Header     string
+	CookieName string
+	CookieTTL  time.Duration
+	CookiePath string
+}
+
 // RouteMirror is the runtime representation of a request-mirror action.
 // BackendRef is preserved as-is (rather than flattened to a host:port string)
 // so the controller can translate it into Envoy's cluster-naming convention
@@ -150,8 +384,24 @@ type RouteMirror struct {
 type RequestMatch struct {
 	Path        string
 	Method      string
+	Scheme      string            // :scheme, else X-Forwarded-Proto, else "https"
 	Headers     map[string]string // keys MUST be lowercased by caller
 	QueryParams map[string]string // case-sensitive keys (RFC 3986)
+
+	// Time is when the request is evaluated, against maintenance windows
+	// and route expiry.
+	// Zero means now.
+	Time time.Time
+
+	// SkipRegex makes regex routes mismatch without evaluating their
+	// pattern, so only exact and prefix routes are served. The extproc sets
+	// it to shed load while overloaded.
+	SkipRegex bool
+
+	// Variant is the route table variant the request selects. FindRoute
+	// falls back to the routes without a variant when the host has no
+	// route of this variant.
+	Variant string
 }
 
 // RoutesConfig is the top-level structure for the ConfigMap data
@@ -171,6 +421,14 @@ type RoutesConfig struct {
 	// result as a full scan — just over far fewer routes. Built by
 	// BuildPartitionIndex; nil when partitioning is disabled.
 	partitions map[string]map[string][]*Route
+
+	// variants indexes, per host, the route variants it has. Built by
+	// BuildVariantIndex; nil means the host routes are scanned instead.
+	variants map[string]map[string]struct{}
+
+	// guarded indexes the hosts with a guarded route. Built by
+	// BuildGuardedIndex; nil means the host routes are scanned instead.
+	guarded map[string]struct{}
 }
 
 // RouteType constants
@@ -180,6 +438,12 @@ const (
 	RouteTypeRegex  = "regex"
 )
 
+// ProtocolHint constants
+const (
+	ProtocolHintWebSocket = "websocket"
+	ProtocolHintSSE       = "sse"
+)
+
 // ActionType constants
 const (
 	ActionTypeRedirect             = "redirect"
@@ -192,15 +456,75 @@ const (
 	ActionTypeResponseHeaderRemove = "response-header-remove"
 	ActionTypeRequestMirror        = "request-mirror"
 	ActionTypeCORS                 = "cors"
+	ActionTypeRequireAuth          = "require-auth"
+	ActionTypeStripUpgrade         = "strip-upgrade"
+	ActionTypeDenyUpgrade          = "deny-upgrade"
 )
 
-// ParseJSON parses a JSON byte slice into a RoutesConfig
-func ParseJSON(data []byte) (*RoutesConfig, error) {
-	var config RoutesConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, err
+// DecisionHeaders modes, see Route.DecisionHeaders.
+const (
+	DecisionHeadersAlways  = "always"
+	DecisionHeadersNever   = "never"
+	DecisionHeadersOnDebug = "on-debug"
+)
+
+// DecisionHeadersMetadataKey is the gRPC initial metadata key through which
+// an ExternalProcessorAttachment passes its decisionHeaders mode to the
+// extproc on every ext_proc stream.
+const DecisionHeadersMetadataKey = "x-customrouter-decision-headers"
+
+// ValidDecisionHeadersMode reports whether mode is one of the
+// DecisionHeaders* constants.
+func ValidDecisionHeadersMode(mode string) bool {
+	switch mode {
+	case DecisionHeadersAlways, DecisionHeadersNever, DecisionHeadersOnDebug:
+		return true
+	}
+	return false
+}
+
+// Unmatched request policies, see Route.UnmatchedPolicy.
+const (
+	UnmatchedPassthrough        = "passthrough"
+	UnmatchedNotFound           = "404"
+	UnmatchedServiceUnavailable = "503"
+)
+
+// UnmatchedPolicyMetadataKey is the gRPC initial metadata key through which
+// an ExternalProcessorAttachment passes its unmatchedRequestPolicy to the
+// extproc on every ext_proc stream.
+const UnmatchedPolicyMetadataKey = "x-customrouter-unmatched-policy"
+
+// ValidUnmatchedPolicy reports whether policy is one of the Unmatched*
+// constants.
+func ValidUnmatchedPolicy(policy string) bool {
+	switch policy {
+	case UnmatchedPassthrough, UnmatchedNotFound, UnmatchedServiceUnavailable:
+		return true
 	}
-	return &config, nil
+	return false
+}
+
+// RoutingMetadataNamespace is the Envoy dynamic metadata namespace the extproc
+// writes its routing decision to. Unlike the x-customrouter-cluster header, a
+// client cannot set it, so generated Envoy routes may match on it instead.
+const RoutingMetadataNamespace = "customrouter"
+
+// Keys of the routing decision in RoutingMetadataNamespace.
+const (
+	RoutingMetadataCluster     = "cluster"
+	RoutingMetadataMatchedPath = "matched_path"
+	RoutingMetadataMatchedType = "matched_type"
+	RoutingMetadataRouteID     = "route_id"
+	RoutingMetadataRouteSource = "route_source"
+	RoutingMetadataRouteRule   = "route_rule"
+	RoutingMetadataRouteOwner  = "route_owner"
+)
+
+// ParseJSON parses a routes document in any supported format into a
+// RoutesConfig. See DecodeRoutesConfig.
+func ParseJSON(data []byte) (*RoutesConfig, error) {
+	return DecodeRoutesConfig(data)
 }
 
 // jsonBufferPool reuses bytes.Buffer instances across ToJSON / MarshalRoute
@@ -258,39 +582,167 @@ func (rc *RoutesConfig) ToJSON() ([]byte, error) {
 	return copied, nil
 }
 
+// RouteCount returns the number of routes across all hosts.
+func (rc *RoutesConfig) RouteCount() int {
+	count := 0
+	for _, hostRoutes := range rc.Hosts {
+		count += len(hostRoutes)
+	}
+	return count
+}
+
+// Hash returns a short hex digest of the serialized config. Replicas serving
+// the same routes get the same hash whatever the source (ConfigMaps, bucket
+// or snapshot), so comparing hashes shows which replicas lag behind.
+func (rc *RoutesConfig) Hash() string {
+	h := sha256.New()
+	// Encoding into a hash cannot fail, and map keys are encoded sorted.
+	_ = json.NewEncoder(h).Encode(rc)
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// RegexCount returns the number of compiled regexes (path, header and query
+// parameter matches) across all hosts.
+func (rc *RoutesConfig) RegexCount() int {
+	count := 0
+	for _, hostRoutes := range rc.Hosts {
+		for i := range hostRoutes {
+			route := &hostRoutes[i]
+			if route.compiledRegex != nil {
+				count++
+			}
+			for j := range route.Headers {
+				if route.Headers[j].compiledRegex != nil {
+					count++
+				}
+			}
+			for j := range route.QueryParams {
+				if route.QueryParams[j].compiledRegex != nil {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// EstimatedSize approximates the bytes held by the routes of the config: the
+// route, action and match structs plus the strings they reference. Compiled
+// regexes and the partition, variant and guarded host indexes are not
+// included, and strings shared
+// between routes are counted once per route, so it is meant for trends and
+// alerting rather than exact accounting.
+func (rc *RoutesConfig) EstimatedSize() int {
+	size := 0
+	for host, hostRoutes := range rc.Hosts {
+		size += len(host) + int(unsafe.Sizeof(hostRoutes))
+		for i := range hostRoutes {
+			size += routeSize(&hostRoutes[i])
+		}
+	}
+	return size
+}
+
+// routeSize is the EstimatedSize of a single route.
+func routeSize(route *Route) int {
+	size := int(unsafe.Sizeof(*route)) +
+		len(route.Path) + len(route.Type) + len(route.Backend) +
+		len(route.ID) + len(route.Source) + len(route.SourceRule) + len(route.Owner) + len(route.Description) +
+		len(route.Variant) +
+		len(route.Method) + len(route.Scheme) +
+		len(route.OverrideHeader) + len(route.DecisionHeaders) + len(route.UnmatchedPolicy)
+	if m := route.Maintenance; m != nil {
+		size += int(unsafe.Sizeof(*m)) + len(m.RetryAfter) + len(m.ContentType) + len(m.Body) +
+			len(m.BypassHeader) + len(m.BypassValue)
+		for _, cidr := range m.BypassCIDRs {
+			size += len(cidr)
+		}
+	}
+	for _, h := range route.Headers {
+		size += int(unsafe.Sizeof(h)) + len(h.Name) + len(h.Value) + len(h.Type)
+	}
+	for _, q := range route.QueryParams {
+		size += int(unsafe.Sizeof(q)) + len(q.Name) + len(q.Value) + len(q.Type)
+	}
+	for value, backend := range route.Overrides {
+		size += len(value) + len(backend)
+	}
+	if route.Fraction != nil {
+		size += int(unsafe.Sizeof(*route.Fraction))
+	}
+	if route.Outlier != nil {
+		size += int(unsafe.Sizeof(*route.Outlier)) + len(route.Outlier.FallbackBackend)
+	}
+	if route.Failover != nil {
+		size += int(unsafe.Sizeof(*route.Failover)) + len(route.Failover.Signal)
+		for _, backend := range route.Failover.Backends {
+			size += int(unsafe.Sizeof(backend)) + len(backend)
+		}
+	}
+	for i := range route.Actions {
+		a := &route.Actions[i]
+		size += int(unsafe.Sizeof(*a)) + len(a.Type) +
+			len(a.RedirectScheme) + len(a.RedirectHostname) + len(a.RedirectPath) + len(a.RedirectAltSvc) +
+			len(a.RewritePath) + len(a.RewriteHostname) +
+			len(a.HeaderName) + len(a.Value) + len(a.AuthURL)
+		for _, segment := range a.RewriteSegments {
+			size += int(unsafe.Sizeof(0)) + len(segment)
+		}
+		for _, h := range a.AuthForwardHeaders {
+			size += len(h)
+		}
+		for _, h := range a.AuthUpstreamHeaders {
+			size += len(h)
+		}
+	}
+	return size
+}
+
 // CompileRegexes compiles all regex patterns in the routes config (both path
 // regex routes and header matches with Type=regex). Should be called after
 // loading the config.
 func (rc *RoutesConfig) CompileRegexes() error {
 	for host := range rc.Hosts {
-		for i := range rc.Hosts[host] {
-			route := &rc.Hosts[host][i]
-			if route.Type == RouteTypeRegex {
-				re, err := regexp.Compile(route.Path)
+		if err := compileRouteRegexes(rc.Hosts[host]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileRouteRegexes compiles the regex patterns, and parses the
+// maintenance bypass CIDRs, of a single host's routes in place.
+func compileRouteRegexes(routes []Route) error {
+	for i := range routes {
+		route := &routes[i]
+		if route.Maintenance != nil {
+			route.Maintenance.compile()
+		}
+		if route.Type == RouteTypeRegex {
+			re, err := regexp.Compile(route.pathRegex())
+			if err != nil {
+				return err
+			}
+			route.compiledRegex = re
+		}
+		for j := range route.Headers {
+			h := &route.Headers[j]
+			if h.Type == HeaderMatchRegex {
+				re, err := regexp.Compile(h.Value)
 				if err != nil {
 					return err
 				}
-				route.compiledRegex = re
-			}
-			for j := range route.Headers {
-				h := &route.Headers[j]
-				if h.Type == HeaderMatchRegex {
-					re, err := regexp.Compile(h.Value)
-					if err != nil {
-						return err
-					}
-					h.compiledRegex = re
-				}
+				h.compiledRegex = re
 			}
-			for j := range route.QueryParams {
-				q := &route.QueryParams[j]
-				if q.Type == HeaderMatchRegex {
-					re, err := regexp.Compile(q.Value)
-					if err != nil {
-						return err
-					}
-					q.compiledRegex = re
+		}
+		for j := range route.QueryParams {
+			q := &route.QueryParams[j]
+			if q.Type == HeaderMatchRegex {
+				re, err := regexp.Compile(q.Value)
+				if err != nil {
+					return err
 				}
+				q.compiledRegex = re
 			}
 		}
 	}
@@ -366,9 +818,9 @@ func (rc *RoutesConfig) BuildPartitionIndex(header string) {
 // routePartitionValue returns the exact value a route requires for the given
 // (lowercased) header, and whether the route is eligible for partitioning.
 // A route is partitionable only when it constrains the header with exactly one
-// exact-match criterion. Routes with no such header, a regex match on it, or
-// multiple criteria on it are treated as unpartitioned (they must be considered
-// for every header value).
+// exact-match criterion. Routes with no such header, any other operator on it
+// (regex, exists, absent, not-value), or multiple criteria on it are treated
+// as unpartitioned (they must be considered for every header value).
 func routePartitionValue(r *Route, header string) (string, bool) {
 	value := ""
 	count := 0
@@ -376,7 +828,7 @@ func routePartitionValue(r *Route, header string) (string, bool) {
 		if !strings.EqualFold(r.Headers[i].Name, header) {
 			continue
 		}
-		if r.Headers[i].Type == HeaderMatchRegex {
+		if t := r.Headers[i].Type; t != "" && t != HeaderMatchExact {
 			return "", false
 		}
 		value = r.Headers[i].Value
@@ -393,28 +845,26 @@ func routePartitionValue(r *Route, header string) (string, bool) {
 // request carries the partition header, only that value's candidate subset is
 // scanned; the result is identical to the full scan, just faster. Otherwise it
 // falls back to scanning every route for the host in sorted order.
+//
+// Only routes of the variant req selects are considered, or the routes
+// without a variant when the host has none of that variant.
 func (rc *RoutesConfig) FindRoute(host string, req RequestMatch) *Route {
 	hostRoutes, ok := rc.Hosts[host]
 	if !ok {
 		return nil
 	}
+	req.Variant = rc.hostVariant(host, req.Variant)
 
-	if rc.partitionHeader != "" && rc.partitions != nil {
-		if v := req.Headers[rc.partitionHeader]; v != "" {
-			if hostPart, ok := rc.partitions[host]; ok {
-				if candidates, ok := hostPart[v]; ok {
-					// The candidate set is the complete set of routes that can
-					// possibly match this header value, so a miss here is a real
-					// no-match — no need to fall back to the full scan.
-					for _, r := range candidates {
-						if r.Match(req) {
-							return r
-						}
-					}
-					return nil
-				}
+	if candidates, ok := rc.partitionCandidates(host, req); ok {
+		// The candidate set is the complete set of routes that can possibly
+		// match this header value, so a miss here is a real no-match — no
+		// need to fall back to the full scan.
+		for _, r := range candidates {
+			if r.Match(req) {
+				return r
 			}
 		}
+		return nil
 	}
 
 	for i := range hostRoutes {
@@ -425,24 +875,73 @@ func (rc *RoutesConfig) FindRoute(host string, req RequestMatch) *Route {
 	return nil
 }
 
+// partitionCandidates returns the partition index candidates of host for the
+// partition header value req carries. ok is false when the index does not
+// apply and every route of the host must be scanned.
+func (rc *RoutesConfig) partitionCandidates(host string, req RequestMatch) (candidates []*Route, ok bool) {
+	if rc.partitionHeader == "" || rc.partitions == nil {
+		return nil, false
+	}
+	v := req.Headers[rc.partitionHeader]
+	if v == "" {
+		return nil, false
+	}
+	hostPart, ok := rc.partitions[host]
+	if !ok {
+		return nil, false
+	}
+	candidates, ok = hostPart[v]
+	return candidates, ok
+}
+
 // Match checks if the given request matches this route. All match criteria
 // (path, method, headers, ...) are AND-combined; an empty criterion on the
 // Route means "match any value for this dimension".
 func (r *Route) Match(req RequestMatch) bool {
+	return r.Mismatch(req) == ""
+}
+
+// Mismatch returns the first match criterion req fails, in the order Match
+// evaluates them, or "" when req matches the route.
+func (r *Route) Mismatch(req RequestMatch) string {
+	if r.Variant != req.Variant {
+		return MismatchVariant
+	}
 	if !r.matchMethod(req.Method) {
-		return false
+		return MismatchMethod
+	}
+	if r.Scheme != "" && !strings.EqualFold(r.Scheme, req.Scheme) {
+		return MismatchScheme
 	}
 	if !r.matchHeaders(req.Headers) {
-		return false
+		return MismatchHeaders
 	}
 	if !r.matchQueryParams(req.QueryParams) {
-		return false
+		return MismatchQueryParams
+	}
+	if !r.matchFraction(req.Headers) {
+		return MismatchFraction
+	}
+	if req.SkipRegex && r.Type == RouteTypeRegex {
+		return MismatchShed
+	}
+	if !r.matchPath(req.Path) {
+		return MismatchPath
 	}
-	return r.matchPath(req.Path)
+	if r.Maintenance != nil && !r.Maintenance.Applies(req) {
+		return MismatchMaintenance
+	}
+	if r.Expired(req.Time) {
+		return MismatchExpired
+	}
+	return ""
 }
 
 // matchPath evaluates only the path portion of the match.
 func (r *Route) matchPath(path string) bool {
+	if r.CaseInsensitive && r.Type != RouteTypeRegex {
+		return r.matchPathFold(path)
+	}
 	switch r.Type {
 	case RouteTypeExact:
 		return path == r.Path
@@ -466,7 +965,7 @@ func (r *Route) matchPath(path string) bool {
 			return r.compiledRegex.MatchString(path)
 		}
 		// Fallback: compile on the fly (slower)
-		re, err := regexp.Compile(r.Path)
+		re, err := regexp.Compile(r.pathRegex())
 		if err != nil {
 			return false
 		}
@@ -476,6 +975,41 @@ func (r *Route) matchPath(path string) bool {
 	}
 }
 
+// matchPathFold is matchPath for exact and prefix routes matching their
+// path regardless of letter case.
+func (r *Route) matchPathFold(path string) bool {
+	switch r.Type {
+	case RouteTypeExact:
+		return strings.EqualFold(path, r.Path)
+	case RouteTypePrefix:
+		if rest, ok := TrimPrefixFold(path, r.Path); ok {
+			if len(rest) == 0 || rest[0] == '/' || strings.HasSuffix(r.Path, "/") {
+				return true
+			}
+		}
+		return strings.HasSuffix(r.Path, "/") && strings.EqualFold(path, strings.TrimSuffix(r.Path, "/"))
+	default:
+		return false
+	}
+}
+
+// pathRegex returns the pattern a regex route matches paths with.
+func (r *Route) pathRegex() string {
+	if r.CaseInsensitive {
+		return "(?i)" + r.Path
+	}
+	return r.Path
+}
+
+// TrimPrefixFold returns s without prefix, compared regardless of letter
+// case, and whether s starts with it.
+func TrimPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
 // matchMethod returns true when the route has no method restriction or the
 // request method matches it (case-insensitive).
 func (r *Route) matchMethod(method string) bool {
@@ -489,7 +1023,8 @@ func (r *Route) matchMethod(method string) bool {
 // is satisfied by the request headers. Header names are matched case-insensitively.
 // An Exact match compares values case-sensitively per RFC 7230 semantics; a
 // regex match uses the compiled pattern (falling back to on-the-fly compilation
-// if CompileRegexes was not called).
+// if CompileRegexes was not called). Exists and Absent only test presence;
+// NotValue is satisfied by a missing header or any other value.
 func (r *Route) matchHeaders(requestHeaders map[string]string) bool {
 	if len(r.Headers) == 0 {
 		return true
@@ -497,11 +1032,23 @@ func (r *Route) matchHeaders(requestHeaders map[string]string) bool {
 	for i := range r.Headers {
 		h := &r.Headers[i]
 		reqValue, ok := requestHeaders[strings.ToLower(h.Name)]
-		if !ok {
-			return false
-		}
 		switch h.Type {
+		case HeaderMatchAbsent:
+			if ok {
+				return false
+			}
+		case HeaderMatchNotValue:
+			if ok && reqValue == h.Value {
+				return false
+			}
+		case HeaderMatchExists:
+			if !ok {
+				return false
+			}
 		case HeaderMatchRegex:
+			if !ok {
+				return false
+			}
 			if h.compiledRegex != nil {
 				if !h.compiledRegex.MatchString(reqValue) {
 					return false
@@ -516,7 +1063,7 @@ func (r *Route) matchHeaders(requestHeaders map[string]string) bool {
 				return false
 			}
 		default:
-			if reqValue != h.Value {
+			if !ok || reqValue != h.Value {
 				return false
 			}
 		}
@@ -524,6 +1071,42 @@ func (r *Route) matchHeaders(requestHeaders map[string]string) bool {
 	return true
 }
 
+// matchFraction returns true when the route has no Fraction or the request
+// id falls in it. A request without a request id is never in a fraction.
+func (r *Route) matchFraction(requestHeaders map[string]string) bool {
+	if r.Fraction == nil {
+		return true
+	}
+	id := requestHeaders[RequestIDHeader]
+	if id == "" {
+		return false
+	}
+	return InFraction(id, r.Fraction.Numerator, r.Fraction.Denominator)
+}
+
+// InFraction reports whether requestID is one of the numerator out of every
+// denominator request ids. The answer only depends on the id, and a
+// requestID in a fraction is also in every larger fraction with the same
+// denominator, so raising the numerator of a rollout keeps the requests it
+// already selected.
+//
+// It follows Envoy's runtime_fraction route match: the value of a UUID
+// request id is its first 8 hex digits, compared against EnvoyPercent.
+// Other request ids, which Envoy would sample at random, are hashed.
+func InFraction(requestID string, numerator, denominator int32) bool {
+	if denominator <= 0 || numerator <= 0 {
+		return false
+	}
+	n, d := EnvoyPercent(numerator, denominator)
+	value, err := strconv.ParseUint(requestID[:min(len(requestID), 8)], 16, 64)
+	if len(requestID) < 8 || err != nil {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(requestID))
+		value = h.Sum64()
+	}
+	return value%uint64(d) < uint64(n)
+}
+
 // matchQueryParams returns true when every required RouteQueryParamMatch on
 // the route is satisfied by the request query parameters. Parameter names are
 // matched case-sensitively (RFC 3986).
@@ -570,3 +1153,22 @@ func (r *Route) ParseBackend() (host string, port string) {
 	}
 	return r.Backend, "80"
 }
+
+// OverrideBackend returns the backend variant selected by the request's
+// override header, and the variant name. It returns empty strings when the
+// route has no overrides or the request does not select a known variant.
+// Header keys MUST be lowercased by the caller, as for RequestMatch.
+func (r *Route) OverrideBackend(requestHeaders map[string]string) (backend, variant string) {
+	if r.OverrideHeader == "" || len(r.Overrides) == 0 {
+		return "", ""
+	}
+	variant, ok := requestHeaders[r.OverrideHeader]
+	if !ok {
+		return "", ""
+	}
+	backend, ok = r.Overrides[variant]
+	if !ok {
+		return "", ""
+	}
+	return backend, variant
+}
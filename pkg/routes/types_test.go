@@ -3,6 +3,8 @@ package routes
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"testing"
 )
 
@@ -303,6 +305,70 @@ func TestRouteMatchHeaders(t *testing.T) {
 			req:       RequestMatch{Path: "/api", Headers: map[string]string{"user-agent": "Mozilla/5.0 (X11; Linux)"}},
 			wantMatch: true,
 		},
+		{
+			name: "regex header match requires the header",
+			route: Route{Path: "/api", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{
+				{Name: "User-Agent", Value: ".*", Type: HeaderMatchRegex},
+			}},
+			req:       RequestMatch{Path: "/api", Headers: map[string]string{}},
+			wantMatch: false,
+		},
+		{
+			name: "exists matches any value",
+			route: Route{Path: "/api", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{
+				{Name: "X-Debug", Type: HeaderMatchExists},
+			}},
+			req:       RequestMatch{Path: "/api", Headers: map[string]string{"x-debug": ""}},
+			wantMatch: true,
+		},
+		{
+			name: "exists does not match a missing header",
+			route: Route{Path: "/api", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{
+				{Name: "X-Debug", Type: HeaderMatchExists},
+			}},
+			req:       RequestMatch{Path: "/api", Headers: map[string]string{}},
+			wantMatch: false,
+		},
+		{
+			name: "absent matches a missing header",
+			route: Route{Path: "/api", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{
+				{Name: "X-Internal-Token", Type: HeaderMatchAbsent},
+			}},
+			req:       RequestMatch{Path: "/api", Headers: map[string]string{"x-tenant": "acme"}},
+			wantMatch: true,
+		},
+		{
+			name: "absent does not match a present header",
+			route: Route{Path: "/api", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{
+				{Name: "X-Internal-Token", Type: HeaderMatchAbsent},
+			}},
+			req:       RequestMatch{Path: "/api", Headers: map[string]string{"x-internal-token": "secret"}},
+			wantMatch: false,
+		},
+		{
+			name: "not-value matches a different value",
+			route: Route{Path: "/api", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{
+				{Name: "X-Env", Value: "canary", Type: HeaderMatchNotValue},
+			}},
+			req:       RequestMatch{Path: "/api", Headers: map[string]string{"x-env": "prod"}},
+			wantMatch: true,
+		},
+		{
+			name: "not-value matches a missing header",
+			route: Route{Path: "/api", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{
+				{Name: "X-Env", Value: "canary", Type: HeaderMatchNotValue},
+			}},
+			req:       RequestMatch{Path: "/api", Headers: map[string]string{}},
+			wantMatch: true,
+		},
+		{
+			name: "not-value rejects the excluded value",
+			route: Route{Path: "/api", Type: RouteTypePrefix, Headers: []RouteHeaderMatch{
+				{Name: "X-Env", Value: "canary", Type: HeaderMatchNotValue},
+			}},
+			req:       RequestMatch{Path: "/api", Headers: map[string]string{"x-env": "canary"}},
+			wantMatch: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -366,6 +432,183 @@ func TestRouteMatchMethod(t *testing.T) {
 	}
 }
 
+func TestRouteMatchScheme(t *testing.T) {
+	tests := []struct {
+		name      string
+		route     Route
+		req       RequestMatch
+		wantMatch bool
+	}{
+		{
+			name:      "empty route scheme matches any request scheme",
+			route:     Route{Path: "/api", Type: RouteTypePrefix},
+			req:       RequestMatch{Path: "/api", Scheme: "http"},
+			wantMatch: true,
+		},
+		{
+			name:      "same scheme matches",
+			route:     Route{Path: "/api", Type: RouteTypePrefix, Scheme: "http"},
+			req:       RequestMatch{Path: "/api", Scheme: "HTTP"},
+			wantMatch: true,
+		},
+		{
+			name:      "different scheme does not match",
+			route:     Route{Path: "/api", Type: RouteTypePrefix, Scheme: "http"},
+			req:       RequestMatch{Path: "/api", Scheme: "https"},
+			wantMatch: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.route.Match(tt.req); got != tt.wantMatch {
+				t.Errorf("Match(%+v) on Route{Scheme:%q} = %v, want %v",
+					tt.req, tt.route.Scheme, got, tt.wantMatch)
+			}
+		})
+	}
+	route := Route{Path: "/api", Type: RouteTypePrefix, Scheme: "http"}
+	if got := route.Mismatch(RequestMatch{Path: "/api", Scheme: "https"}); got != MismatchScheme {
+		t.Errorf("Mismatch() = %q, want %q", got, MismatchScheme)
+	}
+}
+
+func TestSortRoutesSchemeBeforeAnyScheme(t *testing.T) {
+	rs := []Route{
+		{Path: "/api", Type: RouteTypePrefix, Backend: "any"},
+		{Path: "/api", Type: RouteTypePrefix, Scheme: "http", Backend: "http"},
+	}
+	SortRoutes(rs)
+	if rs[0].Backend != "http" {
+		t.Errorf("first route = %q, want the scheme-constrained route first", rs[0].Backend)
+	}
+}
+
+func TestRouteMismatchSkipRegex(t *testing.T) {
+	regex := Route{Path: "^/items/[0-9]+$", Type: RouteTypeRegex}
+	prefix := Route{Path: "/items", Type: RouteTypePrefix}
+
+	if got := regex.Mismatch(RequestMatch{Path: "/items/42"}); got != "" {
+		t.Fatalf("Mismatch() = %q, want a match", got)
+	}
+	if got := regex.Mismatch(RequestMatch{Path: "/items/42", SkipRegex: true}); got != MismatchShed {
+		t.Errorf("Mismatch() with SkipRegex = %q, want %q", got, MismatchShed)
+	}
+	if !prefix.Match(RequestMatch{Path: "/items/42", SkipRegex: true}) {
+		t.Error("SkipRegex must not skip prefix routes")
+	}
+}
+
+func TestRouteMatchFraction(t *testing.T) {
+	none := &RouteFraction{Numerator: 0, Denominator: 100}
+	all := &RouteFraction{Numerator: 100, Denominator: 100}
+
+	tests := []struct {
+		name      string
+		fraction  *RouteFraction
+		headers   map[string]string
+		wantMatch bool
+	}{
+		{name: "no fraction matches without request id", wantMatch: true},
+		{name: "full fraction matches", fraction: all, headers: map[string]string{RequestIDHeader: "abc"}, wantMatch: true},
+		{name: "empty fraction never matches", fraction: none, headers: map[string]string{RequestIDHeader: "abc"}, wantMatch: false},
+		{name: "missing request id never matches", fraction: all, wantMatch: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := Route{Path: "/api", Type: RouteTypePrefix, Fraction: tt.fraction}
+			got := route.Match(RequestMatch{Path: "/api", Headers: tt.headers})
+			if got != tt.wantMatch {
+				t.Errorf("Match() = %v, want %v", got, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestInFraction(t *testing.T) {
+	const total = 10000
+	in10, in20 := 0, 0
+	for i := 0; i < total; i++ {
+		id := fmt.Sprintf("req-%d", i)
+		a := InFraction(id, 10, 100)
+		if a != InFraction(id, 10, 100) {
+			t.Fatalf("InFraction(%q) is not deterministic", id)
+		}
+		b := InFraction(id, 20, 100)
+		if a && !b {
+			t.Fatalf("request %q is in the 10%% fraction but not in the 20%% one", id)
+		}
+		if a {
+			in10++
+		}
+		if b {
+			in20++
+		}
+	}
+	if in10 < 800 || in10 > 1200 {
+		t.Errorf("10%% fraction selected %d of %d requests", in10, total)
+	}
+	if in20 < 1800 || in20 > 2200 {
+		t.Errorf("20%% fraction selected %d of %d requests", in20, total)
+	}
+}
+
+func TestRouteOverrideBackend(t *testing.T) {
+	route := Route{
+		Path:           "/api",
+		Type:           RouteTypePrefix,
+		Backend:        "api.default.svc.cluster.local:8080",
+		OverrideHeader: "x-route-override",
+		Overrides:      map[string]string{"alice": "api-alice.preview.svc.cluster.local:8080"},
+	}
+
+	tests := []struct {
+		name        string
+		route       Route
+		headers     map[string]string
+		wantBackend string
+		wantVariant string
+	}{
+		{
+			name:        "known variant selects its backend",
+			route:       route,
+			headers:     map[string]string{"x-route-override": "alice"},
+			wantBackend: "api-alice.preview.svc.cluster.local:8080",
+			wantVariant: "alice",
+		},
+		{
+			name:    "unknown variant keeps the default backend",
+			route:   route,
+			headers: map[string]string{"x-route-override": "mallory"},
+		},
+		{
+			name:    "variant names are case-sensitive",
+			route:   route,
+			headers: map[string]string{"x-route-override": "Alice"},
+		},
+		{
+			name:    "missing header keeps the default backend",
+			route:   route,
+			headers: map[string]string{},
+		},
+		{
+			name:    "route without overrides ignores the header",
+			route:   Route{Path: "/api", Type: RouteTypePrefix, Backend: "api:80"},
+			headers: map[string]string{"x-route-override": "alice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, variant := tt.route.OverrideBackend(tt.headers)
+			if backend != tt.wantBackend || variant != tt.wantVariant {
+				t.Errorf("OverrideBackend() = (%q, %q), want (%q, %q)", backend, variant, tt.wantBackend, tt.wantVariant)
+			}
+		})
+	}
+}
+
 // TestToJSON_StableBytesAcrossSpecialChars is a tripwire for the
 // partitionHashes dedup in the controller: ToJSON must emit bytes that are
 // identical to a plain json.Marshal call, in particular for routes whose
@@ -410,3 +653,88 @@ func TestToJSON_StableBytesAcrossSpecialChars(t *testing.T) {
 		t.Fatalf("ToJSON not deterministic across calls:\nfirst:  %s\nsecond: %s", got, got2)
 	}
 }
+
+func TestRoutesConfigStats(t *testing.T) {
+	rc := &RoutesConfig{Hosts: map[string][]Route{
+		"a.example.com": {
+			{Path: "^/v[0-9]+/", Type: RouteTypeRegex, Backend: "api:80"},
+			{
+				Path: "/", Type: RouteTypePrefix, Backend: "web:80",
+				Headers:     []RouteHeaderMatch{{Name: "x-env", Value: "^canary$", Type: HeaderMatchRegex}},
+				QueryParams: []RouteQueryParamMatch{{Name: "v", Value: "2"}},
+			},
+		},
+		"b.example.com": {{Path: "/", Type: RouteTypePrefix, Backend: "web:80"}},
+	}}
+	if err := rc.CompileRegexes(); err != nil {
+		t.Fatalf("CompileRegexes: %v", err)
+	}
+
+	if got := rc.RegexCount(); got != 2 {
+		t.Errorf("RegexCount() = %d, want 2", got)
+	}
+
+	size := rc.EstimatedSize()
+	if size <= 0 {
+		t.Fatalf("EstimatedSize() = %d, want > 0", size)
+	}
+	rc.Hosts["b.example.com"][0].Actions = []RouteAction{{Type: "header-set", HeaderName: "x-a", Value: "b"}}
+	if grown := rc.EstimatedSize(); grown <= size {
+		t.Errorf("EstimatedSize() = %d after adding an action, want more than %d", grown, size)
+	}
+}
+
+func TestRoutesConfigHash(t *testing.T) {
+	build := func(backend string) *RoutesConfig {
+		return &RoutesConfig{Version: 1, Hosts: map[string][]Route{
+			"a.example.com": {{Path: "/", Type: RouteTypePrefix, Backend: backend}},
+			"b.example.com": {{Path: "/api", Type: RouteTypePrefix, Backend: "api:80"}},
+		}}
+	}
+
+	hash := build("web:80").Hash()
+	if len(hash) != 16 {
+		t.Fatalf("Hash() = %q, want 16 hex characters", hash)
+	}
+	if again := build("web:80").Hash(); again != hash {
+		t.Errorf("Hash() of an equal config = %q, want %q", again, hash)
+	}
+	if other := build("web-v2:80").Hash(); other == hash {
+		t.Error("Hash() unchanged after changing a backend")
+	}
+}
+
+func TestInFractionFollowsEnvoy(t *testing.T) {
+	tests := []struct {
+		numerator, denominator int32
+		wantNumerator          int64
+		wantDenominator        int64
+	}{
+		{10, 100, 10, 100},
+		{1, 8, 1250, 10000},
+		{3, 1000, 30, 10000},
+		{7, 200000, 35, 1000000},
+		{1, 3, 333333, 1000000},
+	}
+	for _, tt := range tests {
+		n, d := EnvoyPercent(tt.numerator, tt.denominator)
+		if n != tt.wantNumerator || d != tt.wantDenominator {
+			t.Errorf("EnvoyPercent(%d, %d) = %d/%d, want %d/%d",
+				tt.numerator, tt.denominator, n, d, tt.wantNumerator, tt.wantDenominator)
+		}
+	}
+
+	// Envoy samples a UUID request id by the value of its first 8 hex
+	// digits modulo the denominator.
+	for _, id := range []string{
+		"00000009-1111-4111-8111-111111111111", // 9 % 100 = 9: in 10%
+		"0000000a-1111-4111-8111-111111111111", // 10 % 100 = 10: not in 10%
+		"00000064-1111-4111-8111-111111111111", // 100 % 100 = 0: in 10%
+	} {
+		value, _ := strconv.ParseUint(id[:8], 16, 64)
+		want := value%100 < 10
+		if got := InFraction(id, 10, 100); got != want {
+			t.Errorf("InFraction(%s, 10, 100) = %v, want %v as in Envoy", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"strings"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+// VariantHeaderMetadataKey and VariantCookieMetadataKey are the gRPC initial
+// metadata keys through which an ExternalProcessorAttachment passes its
+// variantSelector to the extproc on every ext_proc stream.
+const (
+	VariantHeaderMetadataKey = "x-customrouter-variant-header"
+	VariantCookieMetadataKey = "x-customrouter-variant-cookie"
+)
+
+// VariantSelector picks the route table variant of a request from a header
+// or a cookie. The zero value selects no variant.
+type VariantSelector struct {
+	// Header is the request header carrying the variant.
+	Header string
+
+	// Cookie is the cookie carrying the variant.
+	Cookie string
+}
+
+// ConvertVariantSelector returns the VariantSelector of an attachment's
+// variantSelector, the zero value when it sets none.
+func ConvertVariantSelector(selector *v1alpha1.VariantSelector) VariantSelector {
+	if selector == nil {
+		return VariantSelector{}
+	}
+	return VariantSelector{Header: selector.Header, Cookie: selector.Cookie}
+}
+
+// Merge returns s with the settings override sets replacing s's. An
+// override setting either source replaces both, so an attachment selecting
+// by cookie does not also inherit the default header.
+func (s VariantSelector) Merge(override VariantSelector) VariantSelector {
+	if override != (VariantSelector{}) {
+		return override
+	}
+	return s
+}
+
+// Select returns the variant headers (lowercased names) select: the value of
+// Header, else of the Cookie cookie, else "". The cookie header is parsed
+// leniently: a malformed cookie next to the Cookie cookie is skipped rather
+// than hiding it.
+func (s VariantSelector) Select(headers map[string]string) string {
+	if s.Header != "" {
+		if v := headers[strings.ToLower(s.Header)]; v != "" {
+			return v
+		}
+	}
+	if s.Cookie != "" {
+		if raw := headers["cookie"]; raw != "" {
+			return cookieValue(raw, s.Cookie)
+		}
+	}
+	return ""
+}
+
+// cookieValue returns the value of the cookie name in the cookie header raw,
+// or "". Pairs that are not name=value are skipped, and a value in double
+// quotes is unquoted.
+func cookieValue(raw, name string) string {
+	for _, pair := range strings.Split(raw, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(k) != name {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = v[1 : len(v)-1]
+		}
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// BuildVariantIndex indexes the variants of the routes of every host, so
+// FindRoute does not scan a host's routes to tell whether it has the
+// variant a request selects. Call it after the routes are final.
+func (rc *RoutesConfig) BuildVariantIndex() {
+	rc.variants = nil
+	index := make(map[string]map[string]struct{})
+	for host, hostRoutes := range rc.Hosts {
+		for i := range hostRoutes {
+			if v := hostRoutes[i].Variant; v != "" {
+				if index[host] == nil {
+					index[host] = make(map[string]struct{})
+				}
+				index[host][v] = struct{}{}
+			}
+		}
+	}
+	rc.variants = index
+}
+
+// hostVariant returns the variant of the routes of host a request selecting
+// variant is matched against: variant when host has routes of it, else ""
+// for the routes without a variant.
+func (rc *RoutesConfig) hostVariant(host, variant string) string {
+	if variant == "" {
+		return ""
+	}
+	if rc.variants != nil {
+		if _, ok := rc.variants[host][variant]; ok {
+			return variant
+		}
+		return ""
+	}
+	for i := range rc.Hosts[host] {
+		if rc.Hosts[host][i].Variant == variant {
+			return variant
+		}
+	}
+	return ""
+}
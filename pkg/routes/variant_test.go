@@ -0,0 +1,158 @@
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+func TestVariantSelectorSelect(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector VariantSelector
+		headers  map[string]string
+		want     string
+	}{
+		{"zero value", VariantSelector{}, map[string]string{"x-env": "green"}, ""},
+		{"header", VariantSelector{Header: "X-Env"}, map[string]string{"x-env": "green"}, "green"},
+		{"header absent", VariantSelector{Header: "x-env"}, map[string]string{}, ""},
+		{"cookie", VariantSelector{Cookie: "env"}, map[string]string{"cookie": "a=1; env=green"}, "green"},
+		{"cookie absent", VariantSelector{Cookie: "env"}, map[string]string{"cookie": "a=1"}, ""},
+		{
+			"malformed sibling cookie", VariantSelector{Cookie: "env"},
+			map[string]string{"cookie": `bad"name=1; flag; x=a b; env=green`}, "green",
+		},
+		{"quoted cookie", VariantSelector{Cookie: "env"}, map[string]string{"cookie": `env="green"`}, "green"},
+		{"empty cookie", VariantSelector{Cookie: "env"}, map[string]string{"cookie": "env=; env=green"}, "green"},
+		{
+			"header wins", VariantSelector{Header: "x-env", Cookie: "env"},
+			map[string]string{"x-env": "blue", "cookie": "env=green"}, "blue",
+		},
+		{
+			"cookie without header", VariantSelector{Header: "x-env", Cookie: "env"},
+			map[string]string{"cookie": "env=green"}, "green",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.selector.Select(tt.headers); got != tt.want {
+				t.Errorf("Select() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariantSelectorMerge(t *testing.T) {
+	base := VariantSelector{Header: "x-env"}
+	if got := base.Merge(VariantSelector{}); got != base {
+		t.Errorf("Merge(zero) = %+v, want %+v", got, base)
+	}
+	override := VariantSelector{Cookie: "env"}
+	if got := base.Merge(override); got != override {
+		t.Errorf("Merge(%+v) = %+v, want the override", override, got)
+	}
+}
+
+func TestFindRouteVariant(t *testing.T) {
+	newConfig := func() *RoutesConfig {
+		return &RoutesConfig{Hosts: map[string][]Route{
+			"app.example.com": {
+				{Path: "/api", Type: RouteTypePrefix, Backend: "api-green:80", Variant: "green"},
+				{Path: "/", Type: RouteTypePrefix, Backend: "web-green:80", Variant: "green"},
+				{Path: "/", Type: RouteTypePrefix, Backend: "web:80"},
+			},
+			"other.example.com": {
+				{Path: "/", Type: RouteTypePrefix, Backend: "other:80"},
+			},
+		}}
+	}
+
+	tests := []struct {
+		host    string
+		path    string
+		variant string
+		want    string
+	}{
+		{"app.example.com", "/api/users", "", "web:80"},
+		{"app.example.com", "/api/users", "green", "api-green:80"},
+		{"app.example.com", "/", "green", "web-green:80"},
+		{"app.example.com", "/api/users", "purple", "web:80"},
+		{"other.example.com", "/", "green", "other:80"},
+	}
+	for _, indexed := range []bool{false, true} {
+		config := newConfig()
+		if indexed {
+			config.BuildVariantIndex()
+		}
+		for _, tt := range tests {
+			req := RequestMatch{Path: tt.path, Variant: tt.variant}
+			route := config.FindRoute(tt.host, req)
+			if route == nil || route.Backend != tt.want {
+				t.Errorf("indexed=%v FindRoute(%s%s, variant %q) = %v, want %s", indexed, tt.host, tt.path, tt.variant, route, tt.want)
+			}
+			traced, _ := config.TraceRoute(tt.host, req)
+			if traced != route {
+				t.Errorf("indexed=%v TraceRoute(%s%s, variant %q) = %v, want %v", indexed, tt.host, tt.path, tt.variant, traced, route)
+			}
+		}
+	}
+
+	_, trail := newConfig().TraceRoute("app.example.com", RequestMatch{Path: "/api"})
+	if len(trail) != 3 || trail[0].Skipped != MismatchVariant || trail[1].Skipped != MismatchVariant {
+		t.Errorf("trail = %+v, want the green routes skipped for their variant", trail)
+	}
+}
+
+func TestExpandRoutesVariant(t *testing.T) {
+	cr := &v1alpha1.CustomHTTPRoute{
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef:              v1alpha1.TargetRef{Name: "default"},
+			Hostnames:              []string{"app.example.com"},
+			UnmatchedRequestPolicy: v1alpha1.UnmatchedRequestNotFound,
+			Variant:                "green",
+			Rules: []v1alpha1.Rule{{
+				Matches:     []v1alpha1.PathMatch{{Path: "/"}},
+				BackendRefs: []v1alpha1.BackendRef{{Name: "web-green", Namespace: "default", Port: 8080}},
+			}},
+		},
+	}
+
+	result, err := ExpandRoutes(cr, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result["app.example.com"]) == 0 {
+		t.Fatal("no routes expanded")
+	}
+	for _, route := range result["app.example.com"] {
+		if route.Variant != "green" {
+			t.Errorf("%s route %q variant = %q, want green", route.SourceRule, route.Path, route.Variant)
+		}
+	}
+}
+
+func TestFindShadowedRoutesVariant(t *testing.T) {
+	hostRoutes := []Route{
+		{Path: "/", Type: RouteTypePrefix, Backend: "web-green:80", Variant: "green"},
+		{Path: "/", Type: RouteTypePrefix, Backend: "web:80"},
+	}
+	if shadowed := FindShadowedRoutes(hostRoutes); len(shadowed) != 0 {
+		t.Errorf("FindShadowedRoutes() = %+v, want routes of different variants unshadowed", shadowed)
+	}
+}
@@ -0,0 +1,456 @@
+//go:build envoy
+// +build envoy
+
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package envoy runs the external processor behind a real Envoy and asserts
+// what reaches the backends. Envoy gets a static config equivalent to the
+// generated EnvoyFilters: the same ext_proc filter and dynamic route, ahead
+// of a catch-all 404 standing in for the gateway's other routes, and one
+// cluster per backend under the name the processor emits. This catches what
+// unit tests cannot, such as the route cache not being cleared after the
+// processor mutates the request.
+//
+// The tests start Envoy with Docker on the host network, so they need a
+// Linux Docker host, and only build with the envoy tag:
+//
+//	go test -tags=envoy ./test/envoy/ -v
+//
+// ENVOY_IMAGE overrides the Envoy image.
+package envoy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	extprocv3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+	ef "github.com/freepik-company/customrouter/internal/controller/envoyfilter"
+	"github.com/freepik-company/customrouter/internal/controller/externalprocessorattachment"
+	"github.com/freepik-company/customrouter/internal/extproc"
+	"github.com/freepik-company/customrouter/pkg/routes"
+)
+
+const (
+	defaultEnvoyImage = "envoyproxy/envoy:v1.33-latest"
+
+	// loopback is where the processor, the backends and Envoy listen. Every
+	// Service the routes reference resolves to it, as an ExternalName would.
+	loopback = "127.0.0.1"
+
+	// extProcClusterName is the processor's cluster in the static config.
+	extProcClusterName = "customrouter-extproc"
+
+	// notFoundBody is answered by the catch-all route, for requests the
+	// dynamic route does not take.
+	notFoundBody = "no route"
+
+	envoyReadyTimeout = 2 * time.Minute
+)
+
+// echoRequest is the request an echo backend received, which it answers
+// with as JSON.
+type echoRequest struct {
+	Backend string            `json:"backend"`
+	Method  string            `json:"method"`
+	Host    string            `json:"host"`
+	URI     string            `json:"uri"`
+	Headers map[string]string `json:"headers"`
+}
+
+// startEchoBackend starts an HTTP backend answering every request with the
+// echoRequest it received, and returns its port.
+func startEchoBackend(t *testing.T, name string) int32 {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(loopback, "0"))
+	if err != nil {
+		t.Fatalf("listen for backend %s: %v", name, err)
+	}
+	server := &http.Server{
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers := make(map[string]string, len(r.Header))
+			for name, values := range r.Header {
+				headers[strings.ToLower(name)] = values[0]
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(echoRequest{
+				Backend: name,
+				Method:  r.Method,
+				Host:    r.Host,
+				URI:     r.RequestURI,
+				Headers: headers,
+			})
+		}),
+	}
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return int32(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// harness is an Envoy routing through the external processor.
+type harness struct {
+	baseURL string
+	client  *http.Client
+
+	// stopProcessor stops the external processor, leaving Envoy to apply
+	// the attachment's failureModeAllow.
+	stopProcessor func()
+}
+
+// startHarness serves crs the way the operator would, through a route table
+// encoded and decoded like the route ConfigMaps, and starts Envoy in front
+// of the processor with attachment's ext_proc filter and dynamic route.
+func startHarness(
+	t *testing.T,
+	attachment *v1alpha1.ExternalProcessorAttachment,
+	crs []v1alpha1.CustomHTTPRoute,
+) *harness {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker not found: the Envoy tests need Docker")
+	}
+
+	config := serveRoutes(t, crs)
+	grpcPort, stopProcessor := startProcessor(t, config)
+
+	listenerPort, adminPort := freePort(t), freePort(t)
+	bootstrap := map[string]interface{}{
+		"admin": map[string]interface{}{
+			"address": socketAddress(loopback, adminPort),
+		},
+		"static_resources": map[string]interface{}{
+			"listeners": []interface{}{listener(attachment, listenerPort)},
+			"clusters":  clusters(config, grpcPort),
+		},
+	}
+	data, err := json.Marshal(bootstrap)
+	if err != nil {
+		t.Fatalf("marshal Envoy bootstrap: %v", err)
+	}
+	startEnvoy(t, string(data), adminPort)
+
+	return &harness{
+		baseURL: "http://" + net.JoinHostPort(loopback, strconv.Itoa(int(listenerPort))),
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		stopProcessor: stopProcessor,
+	}
+}
+
+// serveRoutes expands crs, resolving every Service to loopback, and returns
+// the route table the processor would load from the ConfigMaps.
+func serveRoutes(t *testing.T, crs []v1alpha1.CustomHTTPRoute) *routes.RoutesConfig {
+	t.Helper()
+	externalNames := make(map[string]string)
+	resolve := func(ref v1alpha1.BackendRef) {
+		externalNames[ref.Name+"/"+ref.Namespace] = loopback
+	}
+
+	expanded := make([]map[string][]routes.Route, 0, len(crs))
+	for i := range crs {
+		cr := &crs[i]
+		if err := cr.Validate(); err != nil {
+			t.Fatalf("CustomHTTPRoute %s is invalid: %v", cr.Name, err)
+		}
+		for _, rule := range cr.Spec.EffectiveRules() {
+			for _, ref := range rule.BackendRefs {
+				resolve(ref)
+			}
+		}
+		if cr.Spec.OverrideHeader != nil {
+			for _, v := range cr.Spec.OverrideHeader.Variants {
+				resolve(v.BackendRef)
+			}
+		}
+		hosts, err := routes.ExpandRoutes(cr, externalNames)
+		if err != nil {
+			t.Fatalf("expand CustomHTTPRoute %s: %v", cr.Name, err)
+		}
+		expanded = append(expanded, hosts)
+	}
+
+	data, err := routes.EncodeRoutesConfig(routes.MergeRoutesConfig(expanded...),
+		routes.EncodeOptions{Version: routes.FormatVersion2})
+	if err != nil {
+		t.Fatalf("encode routes: %v", err)
+	}
+	config, err := routes.DecodeRoutesConfig(data)
+	if err != nil {
+		t.Fatalf("decode routes: %v", err)
+	}
+	if err := config.CompileRegexes(); err != nil {
+		t.Fatalf("compile routes: %v", err)
+	}
+	return config
+}
+
+// startProcessor serves config over ext_proc and returns the gRPC port and
+// a function stopping the server. Decision headers are always added, so
+// tests can assert the match.
+func startProcessor(t *testing.T, config *routes.RoutesConfig) (int32, func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(loopback, "0"))
+	if err != nil {
+		t.Fatalf("listen for the processor: %v", err)
+	}
+	processor := extproc.NewProcessor(config, zaptest.NewLogger(t), false)
+	processor.SetDecisionHeaders(routes.DecisionHeadersAlways, "", "")
+
+	server := grpc.NewServer()
+	extprocv3.RegisterExternalProcessorServer(server, processor)
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(server.Stop)
+	return int32(ln.Addr().(*net.TCPAddr).Port), server.Stop
+}
+
+// listener is the HTTP listener: the edge header removal as an early header
+// mutation, the ext_proc filter before the router, and the dynamic route
+// ahead of a catch-all 404.
+func listener(attachment *v1alpha1.ExternalProcessorAttachment, port int32) map[string]interface{} {
+	manager := map[string]interface{}{
+		"@type":       "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+		"stat_prefix": "customrouter",
+		"early_header_mutation_extensions": []interface{}{
+			externalprocessorattachment.EdgeHeaderMutation(),
+		},
+		"route_config": map[string]interface{}{
+			"name": "customrouter",
+			"virtual_hosts": []interface{}{
+				map[string]interface{}{
+					"name":    "all",
+					"domains": []interface{}{"*"},
+					"routes": []interface{}{
+						externalprocessorattachment.DynamicRoute(attachment),
+						map[string]interface{}{
+							"name":  "not-found",
+							"match": map[string]interface{}{"prefix": "/"},
+							"direct_response": map[string]interface{}{
+								"status": 404,
+								"body":   map[string]interface{}{"inline_string": notFoundBody},
+							},
+						},
+					},
+				},
+			},
+		},
+		"http_filters": []interface{}{
+			map[string]interface{}{
+				"name":         "envoy.filters.http.ext_proc",
+				"typed_config": externalprocessorattachment.ExtProcFilterConfig(attachment, extProcClusterName),
+			},
+			map[string]interface{}{
+				"name": "envoy.filters.http.router",
+				"typed_config": map[string]interface{}{
+					"@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
+				},
+			},
+		},
+	}
+	return map[string]interface{}{
+		"name":    "http",
+		"address": socketAddress(loopback, port),
+		"filter_chains": []interface{}{
+			map[string]interface{}{
+				"filters": []interface{}{
+					map[string]interface{}{
+						"name":         "envoy.filters.network.http_connection_manager",
+						"typed_config": manager,
+					},
+				},
+			},
+		},
+	}
+}
+
+// clusters returns the processor's cluster and one cluster per backend of
+// config, named outbound|<port>||<host> like the clusters Istio creates.
+func clusters(config *routes.RoutesConfig, grpcPort int32) []interface{} {
+	out := []interface{}{
+		staticCluster(extProcClusterName, loopback, grpcPort, v1alpha1.BackendProtocolH2C),
+	}
+	seen := make(map[string]bool)
+	add := func(backend string) {
+		if backend == "" || seen[backend] {
+			return
+		}
+		seen[backend] = true
+		host, port := (&routes.Route{Backend: backend}).ParseBackend()
+		portNumber, _ := strconv.ParseInt(port, 10, 32)
+		out = append(out, staticCluster(ef.BackendClusterName(backend), host, int32(portNumber), ""))
+	}
+	for _, hostRoutes := range config.Hosts {
+		for i := range hostRoutes {
+			add(hostRoutes[i].Backend)
+			for _, backend := range hostRoutes[i].Overrides {
+				add(backend)
+			}
+			if hostRoutes[i].Outlier != nil {
+				add(hostRoutes[i].Outlier.FallbackBackend)
+			}
+		}
+	}
+	return out
+}
+
+func staticCluster(name, host string, port int32, protocol string) map[string]interface{} {
+	cluster := map[string]interface{}{
+		"name":            name,
+		"type":            "STATIC",
+		"connect_timeout": "1s",
+		"load_assignment": map[string]interface{}{
+			"cluster_name": name,
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"lb_endpoints": []interface{}{
+						map[string]interface{}{
+							"endpoint": map[string]interface{}{"address": socketAddress(host, port)},
+						},
+					},
+				},
+			},
+		},
+	}
+	if protocol != "" {
+		cluster["typed_extension_protocol_options"] = ef.UpstreamProtocolOptions(protocol)
+	}
+	return cluster
+}
+
+func socketAddress(host string, port int32) map[string]interface{} {
+	return map[string]interface{}{
+		"socket_address": map[string]interface{}{"address": host, "port_value": port},
+	}
+}
+
+// freePort returns a loopback port nothing listens on.
+func freePort(t *testing.T) int32 {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(loopback, "0"))
+	if err != nil {
+		t.Fatalf("find a free port: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+	return int32(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// startEnvoy runs Envoy with bootstrap and waits until its admin endpoint
+// reports it ready. Its logs are printed when the test fails.
+func startEnvoy(t *testing.T, bootstrap string, adminPort int32) {
+	t.Helper()
+	image := os.Getenv("ENVOY_IMAGE")
+	if image == "" {
+		image = defaultEnvoyImage
+	}
+
+	out, err := exec.Command("docker", "run", "-d", "--network", "host", image,
+		"--config-yaml", bootstrap, "--log-level", "warn").CombinedOutput()
+	if err != nil {
+		t.Fatalf("docker run %s: %v\n%s", image, err, out)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	container := lines[len(lines)-1]
+	t.Cleanup(func() {
+		if t.Failed() {
+			logs, _ := exec.Command("docker", "logs", container).CombinedOutput()
+			t.Logf("Envoy logs:\n%s", logs)
+		}
+		_ = exec.Command("docker", "rm", "-f", container).Run()
+	})
+
+	ready := "http://" + net.JoinHostPort(loopback, strconv.Itoa(int(adminPort))) + "/ready"
+	ctx, cancel := context.WithTimeout(context.Background(), envoyReadyTimeout)
+	defer cancel()
+	for {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ready, nil)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Envoy not ready after %s", envoyReadyTimeout)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// do sends a request for host and path (query string included) through
+// Envoy, returning the response and its body.
+func (h *harness) do(t *testing.T, method, host, path string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, h.baseURL+path, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Host = host
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s%s: %v", method, host, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response of %s %s%s: %v", method, host, path, err)
+	}
+	return resp, body
+}
+
+// forwarded sends a GET through Envoy and returns what the backend received,
+// failing the test unless a backend answered.
+func (h *harness) forwarded(t *testing.T, host, path string, header http.Header) echoRequest {
+	t.Helper()
+	resp, body := h.do(t, http.MethodGet, host, path, header)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s%s: status %d, want 200 from a backend: %s", host, path, resp.StatusCode, body)
+	}
+	var got echoRequest
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&got); err != nil {
+		t.Fatalf("GET %s%s: response is not from an echo backend: %v: %s", host, path, err, body)
+	}
+	return got
+}
+
+// String describes the request for failure messages.
+func (e echoRequest) String() string {
+	return fmt.Sprintf("%s got %s %s%s", e.Backend, e.Method, e.Host, e.URI)
+}
@@ -0,0 +1,262 @@
+//go:build envoy
+// +build envoy
+
+/*
+Copyright 2024-2026 Freepik Company S.L.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envoy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/freepik-company/customrouter/api/v1alpha1"
+)
+
+const (
+	shopHost = "shop.example.com"
+	apiHost  = "api.example.com"
+)
+
+func backendRef(name string, port int32) v1alpha1.BackendRef {
+	return v1alpha1.BackendRef{Name: name, Namespace: "e2e", Port: port}
+}
+
+func TestRouting(t *testing.T) {
+	web := backendRef("web", startEchoBackend(t, "web"))
+	checkout := backendRef("checkout", startEchoBackend(t, "checkout"))
+	legacy := backendRef("legacy", startEchoBackend(t, "legacy"))
+
+	attachment := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "e2e", Namespace: "e2e"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			ExternalProcessorRef: v1alpha1.ExternalProcessorRef{
+				Service: v1alpha1.ServiceRef{Name: "customrouter", Namespace: "e2e", Port: 9001},
+			},
+		},
+	}
+	crs := []v1alpha1.CustomHTTPRoute{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "e2e"},
+			Spec: v1alpha1.CustomHTTPRouteSpec{
+				TargetRef: v1alpha1.TargetRef{Name: "default"},
+				Hostnames: []string{shopHost},
+				Rules: []v1alpha1.Rule{
+					{
+						Matches:     []v1alpha1.PathMatch{{Path: "/"}},
+						BackendRefs: []v1alpha1.BackendRef{web},
+					},
+					{
+						Matches:     []v1alpha1.PathMatch{{Path: "/checkout"}},
+						BackendRefs: []v1alpha1.BackendRef{checkout},
+						Actions: []v1alpha1.Action{{
+							Type:   v1alpha1.ActionTypeHeaderSet,
+							Header: &v1alpha1.HeaderConfig{Name: "x-env", Value: "prod"},
+						}},
+					},
+					{
+						Matches:     []v1alpha1.PathMatch{{Path: "/v1"}},
+						BackendRefs: []v1alpha1.BackendRef{legacy},
+						Actions: []v1alpha1.Action{{
+							Type:    v1alpha1.ActionTypeRewrite,
+							Rewrite: &v1alpha1.RewriteConfig{Path: "/v2"},
+						}},
+					},
+					{
+						Matches:     []v1alpha1.PathMatch{{Path: "/legacy"}},
+						BackendRefs: []v1alpha1.BackendRef{legacy},
+						Actions: []v1alpha1.Action{{
+							Type:    v1alpha1.ActionTypeRewrite,
+							Rewrite: &v1alpha1.RewriteConfig{Hostname: "legacy.internal"},
+						}},
+					},
+					{
+						Matches:     []v1alpha1.PathMatch{{Path: "/old", Type: v1alpha1.MatchTypeExact}},
+						BackendRefs: []v1alpha1.BackendRef{web},
+						Actions: []v1alpha1.Action{{
+							Type:     v1alpha1.ActionTypeRedirect,
+							Redirect: &v1alpha1.RedirectConfig{Path: "/new", StatusCode: http.StatusMovedPermanently},
+						}},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "e2e"},
+			Spec: v1alpha1.CustomHTTPRouteSpec{
+				TargetRef: v1alpha1.TargetRef{Name: "default"},
+				Hostnames: []string{apiHost},
+				Rules: []v1alpha1.Rule{{
+					Matches: []v1alpha1.PathMatch{{
+						Path: `^/users/[0-9]+$`,
+						Type: v1alpha1.MatchTypeRegex,
+					}},
+					BackendRefs: []v1alpha1.BackendRef{checkout},
+				}},
+			},
+		},
+	}
+	h := startHarness(t, attachment, crs)
+
+	t.Run("prefix route reaches its backend", func(t *testing.T) {
+		got := h.forwarded(t, shopHost, "/products/42", nil)
+		if got.Backend != "web" || got.URI != "/products/42" || got.Host != shopHost {
+			t.Errorf("%s, want web got GET %s/products/42", got, shopHost)
+		}
+		if path := got.Headers["x-customrouter-matched-path"]; path != "/" {
+			t.Errorf("x-customrouter-matched-path = %q, want /", path)
+		}
+	})
+
+	t.Run("longest prefix wins", func(t *testing.T) {
+		got := h.forwarded(t, shopHost, "/checkout/cart", nil)
+		if got.Backend != "checkout" {
+			t.Errorf("%s, want checkout", got)
+		}
+	})
+
+	t.Run("header-set action", func(t *testing.T) {
+		got := h.forwarded(t, shopHost, "/checkout", http.Header{"X-Env": {"dev"}})
+		if env := got.Headers["x-env"]; env != "prod" {
+			t.Errorf("x-env = %q, want prod", env)
+		}
+	})
+
+	t.Run("prefix rewrite keeps the suffix and query", func(t *testing.T) {
+		got := h.forwarded(t, shopHost, "/v1/items?page=2", nil)
+		if got.Backend != "legacy" || got.URI != "/v2/items?page=2" {
+			t.Errorf("%s, want legacy got /v2/items?page=2", got)
+		}
+	})
+
+	t.Run("hostname rewrite", func(t *testing.T) {
+		got := h.forwarded(t, shopHost, "/legacy/page", nil)
+		if got.Backend != "legacy" || got.Host != "legacy.internal" {
+			t.Errorf("%s, want legacy got host legacy.internal", got)
+		}
+		if authority := got.Headers["x-original-authority"]; authority != shopHost {
+			t.Errorf("x-original-authority = %q, want %s", authority, shopHost)
+		}
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		resp, body := h.do(t, http.MethodGet, shopHost, "/old", nil)
+		if resp.StatusCode != http.StatusMovedPermanently {
+			t.Fatalf("status %d, want 301: %s", resp.StatusCode, body)
+		}
+		if location := resp.Header.Get("Location"); !strings.HasSuffix(location, shopHost+"/new") {
+			t.Errorf("Location = %q, want it to end in %s/new", location, shopHost)
+		}
+	})
+
+	t.Run("regex route", func(t *testing.T) {
+		got := h.forwarded(t, apiHost, "/users/7", nil)
+		if got.Backend != "checkout" {
+			t.Errorf("%s, want checkout", got)
+		}
+	})
+
+	t.Run("unmatched request falls through", func(t *testing.T) {
+		resp, body := h.do(t, http.MethodGet, apiHost, "/users/me", nil)
+		if resp.StatusCode != http.StatusNotFound || string(body) != notFoundBody {
+			t.Errorf("status %d %q, want 404 %q", resp.StatusCode, body, notFoundBody)
+		}
+	})
+
+	t.Run("client cluster header is not honoured", func(t *testing.T) {
+		// The processor removes the header on unmatched requests, so the
+		// route cache must not keep the decision Envoy made before it did.
+		header := http.Header{"X-Customrouter-Cluster": {fmt.Sprintf("outbound|%d||%s", web.Port, loopback)}}
+		resp, body := h.do(t, http.MethodGet, "unknown.example.com", "/", header)
+		if resp.StatusCode != http.StatusNotFound || string(body) != notFoundBody {
+			t.Errorf("status %d %q, want 404 %q", resp.StatusCode, body, notFoundBody)
+		}
+	})
+
+	t.Run("client routing headers cannot steer a matched request", func(t *testing.T) {
+		header := http.Header{
+			"X-Customrouter-Cluster":      {fmt.Sprintf("outbound|%d||%s", checkout.Port, loopback)},
+			"X-Customrouter-Matched-Path": {"/checkout"},
+		}
+		got := h.forwarded(t, shopHost, "/products/42", header)
+		if got.Backend != "web" {
+			t.Errorf("%s, want web", got)
+		}
+		if path := got.Headers["x-customrouter-matched-path"]; path != "/" {
+			t.Errorf("x-customrouter-matched-path = %q, want /", path)
+		}
+	})
+}
+
+func TestRoutingFailOpen(t *testing.T) {
+	web := backendRef("web", startEchoBackend(t, "web"))
+	checkout := backendRef("checkout", startEchoBackend(t, "checkout"))
+
+	attachment := &v1alpha1.ExternalProcessorAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: "e2e", Namespace: "e2e"},
+		Spec: v1alpha1.ExternalProcessorAttachmentSpec{
+			ExternalProcessorRef: v1alpha1.ExternalProcessorRef{
+				Service:          v1alpha1.ServiceRef{Name: "customrouter", Namespace: "e2e", Port: 9001},
+				FailureModeAllow: true,
+			},
+		},
+	}
+	crs := []v1alpha1.CustomHTTPRoute{{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "e2e"},
+		Spec: v1alpha1.CustomHTTPRouteSpec{
+			TargetRef: v1alpha1.TargetRef{Name: "default"},
+			Hostnames: []string{shopHost},
+			Rules: []v1alpha1.Rule{
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/"}},
+					BackendRefs: []v1alpha1.BackendRef{web},
+				},
+				{
+					Matches:     []v1alpha1.PathMatch{{Path: "/checkout"}},
+					BackendRefs: []v1alpha1.BackendRef{checkout},
+				},
+			},
+		},
+	}}
+	h := startHarness(t, attachment, crs)
+
+	if got := h.forwarded(t, shopHost, "/products/42", nil); got.Backend != "web" {
+		t.Fatalf("%s, want web while the processor runs", got)
+	}
+	h.stopProcessor()
+
+	t.Run("unreachable processor lets requests through unrouted", func(t *testing.T) {
+		resp, body := h.do(t, http.MethodGet, shopHost, "/products/42", nil)
+		if resp.StatusCode != http.StatusNotFound || string(body) != notFoundBody {
+			t.Errorf("status %d %q, want 404 %q", resp.StatusCode, body, notFoundBody)
+		}
+	})
+
+	t.Run("client cluster header is removed before route selection", func(t *testing.T) {
+		// Nothing rewrites the request, so the dynamic route would forward
+		// on the client's header if it were still there when Envoy picks
+		// the route.
+		header := http.Header{"X-Customrouter-Cluster": {fmt.Sprintf("outbound|%d||%s", checkout.Port, loopback)}}
+		resp, body := h.do(t, http.MethodGet, shopHost, "/products/42", header)
+		if resp.StatusCode != http.StatusNotFound || string(body) != notFoundBody {
+			t.Errorf("status %d %q, want 404 %q: the client picked the cluster", resp.StatusCode, body, notFoundBody)
+		}
+	})
+}